@@ -1,5 +1,11 @@
 package api
 
+import (
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
 // TokenAuth is used to perform token backend operations on Vault
 type TokenAuth struct {
 	c *Client
@@ -64,6 +70,79 @@ func (c *TokenAuth) LookupAccessor(accessor string) (*Secret, error) {
 	return ParseSecret(resp.Body)
 }
 
+// ListAccessors returns the accessors of all outstanding tokens. This
+// requires sudo capability.
+func (c *TokenAuth) ListAccessors() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/auth/token/accessors")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Keys []string `mapstructure:"keys"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// SearchAccessors returns the accessors of the tokens with the given
+// display name and metadata. Either may be left empty. This requires sudo
+// capability.
+func (c *TokenAuth) SearchAccessors(displayName string, meta map[string]string) ([]string, error) {
+	r := c.c.NewRequest("PUT", "/v1/auth/token/accessors/search")
+	body := map[string]interface{}{
+		"meta": meta,
+	}
+	if displayName != "" {
+		body["display_name"] = displayName
+	}
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Keys []string `mapstructure:"keys"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
 func (c *TokenAuth) LookupSelf() (*Secret, error) {
 	r := c.c.NewRequest("GET", "/v1/auth/token/lookup-self")
 
@@ -162,6 +241,103 @@ func (c *TokenAuth) RevokeTree(token string) error {
 	return nil
 }
 
+// ListRoles returns the names of the token roles.
+func (c *TokenAuth) ListRoles() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/auth/token/roles")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Keys []string `mapstructure:"keys"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// ReadRole returns the named token role, or nil if it does not exist.
+func (c *TokenAuth) ReadRole(name string) (*TokenRole, error) {
+	r := c.c.NewRequest("GET", "/v1/auth/token/roles/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result TokenRole
+	if err := mapstructure.WeakDecode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// WriteRole creates or updates a token role.
+func (c *TokenAuth) WriteRole(role *TokenRole) error {
+	body := map[string]interface{}{
+		"allowed_policies":    strings.Join(role.AllowedPolicies, ","),
+		"disallowed_policies": strings.Join(role.DisallowedPolicies, ","),
+		"orphan":              role.Orphan,
+		"period":              role.Period,
+		"explicit_max_ttl":    role.ExplicitMaxTTL,
+		"path_suffix":         role.PathSuffix,
+		"renewable":           role.Renewable,
+	}
+
+	r := c.c.NewRequest("POST", "/v1/auth/token/roles/"+role.Name)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// DeleteRole deletes the named token role.
+func (c *TokenAuth) DeleteRole(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/auth/token/roles/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
 // TokenCreateRequest is the options structure for creating a token.
 type TokenCreateRequest struct {
 	ID              string            `json:"id,omitempty"`
@@ -175,4 +351,20 @@ type TokenCreateRequest struct {
 	DisplayName     string            `json:"display_name"`
 	NumUses         int               `json:"num_uses"`
 	Renewable       *bool             `json:"renewable,omitempty"`
+	Period          string            `json:"period,omitempty"`
+	BoundCIDRs      []string          `json:"bound_cidrs,omitempty"`
+	Type            string            `json:"type,omitempty"`
+}
+
+// TokenRole constrains the tokens created against it with CreateWithRole.
+// Period and ExplicitMaxTTL are given in seconds.
+type TokenRole struct {
+	Name               string   `mapstructure:"name"`
+	AllowedPolicies    []string `mapstructure:"allowed_policies"`
+	DisallowedPolicies []string `mapstructure:"disallowed_policies"`
+	Orphan             bool     `mapstructure:"orphan"`
+	Period             int      `mapstructure:"period"`
+	ExplicitMaxTTL     int      `mapstructure:"explicit_max_ttl"`
+	PathSuffix         string   `mapstructure:"path_suffix"`
+	Renewable          bool     `mapstructure:"renewable"`
 }
@@ -206,3 +206,152 @@ func TestAuthTokenRenew(t *testing.T) {
 		t.Error("expected lease to be renewable")
 	}
 }
+
+func TestAuthTokenRoles(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	config := DefaultConfig()
+	config.Address = addr
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(token)
+
+	tokens := client.Auth().Token()
+	err = tokens.WriteRole(&TokenRole{
+		Name:            "deploy",
+		AllowedPolicies: []string{"deploy"},
+		Orphan:          true,
+		Period:          3600,
+		PathSuffix:      "ci-deploy",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	role, err := tokens.ReadRole("deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role == nil || !role.Orphan || role.Period != 3600 || role.PathSuffix != "ci-deploy" ||
+		len(role.AllowedPolicies) != 1 || role.AllowedPolicies[0] != "deploy" {
+		t.Fatalf("bad: %#v", role)
+	}
+
+	roles, err := tokens.ListRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != "deploy" {
+		t.Fatalf("bad: %#v", roles)
+	}
+
+	// Tokens created against the role are constrained by it
+	secret, err := tokens.CreateWithRole(&TokenCreateRequest{Policies: []string{"root"}}, "deploy")
+	if err == nil {
+		t.Fatalf("expected error, got %#v", secret)
+	}
+	secret, err = tokens.CreateWithRole(&TokenCreateRequest{Policies: []string{"deploy"}}, "deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Auth.LeaseDuration != 3600 {
+		t.Errorf("expected 3600 seconds, got %d", secret.Auth.LeaseDuration)
+	}
+
+	if err := tokens.DeleteRole("deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if role, err := tokens.ReadRole("deploy"); err != nil || role != nil {
+		t.Fatalf("bad: %#v %v", role, err)
+	}
+}
+
+func TestAuthTokenListAccessors(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	config := DefaultConfig()
+	config.Address = addr
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(token)
+
+	secret, err := client.Auth().Token().Create(&TokenCreateRequest{
+		Policies: []string{"default"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessors, err := client.Auth().Token().ListAccessors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, accessor := range accessors {
+		if accessor == secret.Auth.Accessor {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("accessor %s not in %v", secret.Auth.Accessor, accessors)
+	}
+
+	// Accessors can only be listed with sudo capability
+	client.SetToken(secret.Auth.ClientToken)
+	if _, err := client.Auth().Token().ListAccessors(); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAuthTokenSearchAccessors(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	config := DefaultConfig()
+	config.Address = addr
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(token)
+
+	secret, err := client.Auth().Token().Create(&TokenCreateRequest{
+		Policies: []string{"default"},
+		Metadata: map[string]string{"app": "web"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Auth().Token().Create(&TokenCreateRequest{
+		Policies: []string{"default"},
+		Metadata: map[string]string{"app": "db"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	accessors, err := client.Auth().Token().SearchAccessors("", map[string]string{"app": "web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accessors) != 1 || accessors[0] != secret.Auth.Accessor {
+		t.Fatalf("bad: %v", accessors)
+	}
+
+	// Tokens can only be searched with sudo capability
+	client.SetToken(secret.Auth.ClientToken)
+	if _, err := client.Auth().Token().SearchAccessors("", map[string]string{"app": "web"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
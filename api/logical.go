@@ -22,7 +22,16 @@ func (c *Client) Logical() *Logical {
 }
 
 func (c *Logical) Read(path string) (*Secret, error) {
+	return c.ReadWithData(path, nil)
+}
+
+// ReadWithData reads from a path, passing data as query parameters, such
+// as the version of a versioned secret
+func (c *Logical) ReadWithData(path string, data map[string][]string) (*Secret, error) {
 	r := c.c.NewRequest("GET", "/v1/"+path)
+	for k, v := range data {
+		r.Params[k] = v
+	}
 	resp, err := c.c.RawRequest(r)
 	if resp != nil {
 		defer resp.Body.Close()
@@ -75,6 +84,29 @@ func (c *Logical) Write(path string, data map[string]interface{}) (*Secret, erro
 	return nil, nil
 }
 
+// JSONMergePatch updates some of the fields at a path: fields holding null
+// are removed, and objects are merged with the existing ones
+func (c *Logical) JSONMergePatch(path string, data map[string]interface{}) (*Secret, error) {
+	r := c.c.NewRequest("PATCH", "/v1/"+path)
+	if err := r.SetJSONBody(data); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == 200 {
+		return ParseSecret(resp.Body)
+	}
+
+	return nil, nil
+}
+
 func (c *Logical) Delete(path string) (*Secret, error) {
 	r := c.c.NewRequest("DELETE", "/v1/"+path)
 	resp, err := c.c.RawRequest(r)
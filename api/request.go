@@ -19,6 +19,10 @@ type Request struct {
 	Obj         interface{}
 	Body        io.Reader
 	BodySize    int64
+
+	// ControlGroupID is the ID of the approved control group request this
+	// request carries out
+	ControlGroupID string
 }
 
 // SetJSONBody is used to set a request body that is a JSON-encoded value.
@@ -67,5 +71,9 @@ func (r *Request) ToHTTP() (*http.Request, error) {
 		req.Header.Set("X-Vault-Wrap-TTL", r.WrapTTL)
 	}
 
+	if len(r.ControlGroupID) != 0 {
+		req.Header.Set("X-Vault-Control-Group", r.ControlGroupID)
+	}
+
 	return req, nil
 }
@@ -1,6 +1,10 @@
 package api
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
 
 func (c *Sys) CapabilitiesSelf(path string) ([]string, error) {
 	return c.Capabilities(c.c.Token(), path)
@@ -44,3 +48,93 @@ func (c *Sys) Capabilities(token, path string) ([]string, error) {
 	}
 	return capabilities, nil
 }
+
+// CapabilitiesPaths returns the capabilities of the token on each of the
+// given paths, in a single request.
+func (c *Sys) CapabilitiesPaths(token string, paths []string) (map[string][]string, error) {
+	body := map[string]interface{}{
+		"token": token,
+		"paths": paths,
+	}
+
+	reqPath := "/v1/sys/capabilities"
+	if token == c.c.Token() {
+		reqPath = fmt.Sprintf("%s-self", reqPath)
+	}
+
+	r := c.c.NewRequest("POST", reqPath)
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result map[string][]string
+	if err := mapstructure.Decode(secret.Data["paths"], &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExplainCapabilities returns which policy rules allow or deny the token the
+// given operation on a path.
+func (c *Sys) ExplainCapabilities(token, path, operation string, data map[string]interface{}) (*CapabilitiesExplanation, error) {
+	body := map[string]interface{}{
+		"token":     token,
+		"path":      path,
+		"operation": operation,
+	}
+	if data != nil {
+		body["data"] = data
+	}
+
+	r := c.c.NewRequest("POST", "/v1/sys/capabilities-explain")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result CapabilitiesExplanation
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type CapabilitiesExplanation struct {
+	Allowed bool                      `mapstructure:"allowed"`
+	Sudo    bool                      `mapstructure:"sudo"`
+	Pattern string                    `mapstructure:"pattern"`
+	Sources []*CapabilitiesRuleSource `mapstructure:"sources"`
+	Reason  string                    `mapstructure:"reason"`
+}
+
+type CapabilitiesRuleSource struct {
+	Policy string `mapstructure:"policy"`
+	Path   string `mapstructure:"path"`
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ControlGroupRequest returns the status of a request waiting for approval
+// by a control group.
+func (c *Sys) ControlGroupRequest(id string) (*ControlGroupStatus, error) {
+	return c.controlGroup("/v1/sys/control-group/request", id)
+}
+
+// ControlGroupAuthorize approves a request waiting for approval by a control
+// group, using the token of the client.
+func (c *Sys) ControlGroupAuthorize(id string) (*ControlGroupStatus, error) {
+	return c.controlGroup("/v1/sys/control-group/authorize", id)
+}
+
+func (c *Sys) controlGroup(path, id string) (*ControlGroupStatus, error) {
+	body := map[string]string{
+		"id": id,
+	}
+
+	r := c.c.NewRequest("PUT", path)
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result ControlGroupStatus
+	if err := mapstructure.WeakDecode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+type ControlGroupStatus struct {
+	ID                string                       `mapstructure:"control_group_id"`
+	Path              string                       `mapstructure:"path"`
+	Operation         string                       `mapstructure:"operation"`
+	Requester         string                       `mapstructure:"requester"`
+	Policy            string                       `mapstructure:"policy"`
+	ApprovalsRequired int                          `mapstructure:"approvals_required"`
+	Authorizations    []*ControlGroupAuthorization `mapstructure:"authorizations"`
+	Approved          bool                         `mapstructure:"approved"`
+	CreationTime      string                       `mapstructure:"creation_time"`
+	ExpireTime        string                       `mapstructure:"expire_time"`
+}
+
+type ControlGroupAuthorization struct {
+	DisplayName string `mapstructure:"display_name"`
+	Time        string `mapstructure:"time"`
+}
@@ -0,0 +1,24 @@
+package api
+
+// MFAValidate completes a login waiting for MFA, with the passcodes of its
+// MFA methods by method name, and returns the secret of the login. Methods
+// without passcodes, such as Duo pushes, are given an empty string.
+func (c *Sys) MFAValidate(requestID string, payload map[string]string) (*Secret, error) {
+	body := map[string]interface{}{
+		"mfa_request_id": requestID,
+		"mfa_payload":    payload,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/mfa/validate")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ParseSecret(resp.Body)
+}
@@ -81,6 +81,16 @@ func (c *Sys) Remount(from, to string) error {
 	return err
 }
 
+// UpgradeMount upgrades a generic mount to the versioned kv backend
+func (c *Sys) UpgradeMount(path string) error {
+	r := c.c.NewRequest("POST", fmt.Sprintf("/v1/sys/mounts/%s/upgrade", path))
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
 func (c *Sys) TuneMount(path string, config MountConfigInput) error {
 	body := structs.Map(config)
 	r := c.c.NewRequest("POST", fmt.Sprintf("/v1/sys/mounts/%s/tune", path))
@@ -32,6 +32,38 @@ func (c *Sys) ListPolicies() ([]string, error) {
 	return result.Policies, err
 }
 
+// ListPoliciesDetailed returns the metadata of each policy, keyed by name.
+func (c *Sys) ListPoliciesDetailed() (map[string]map[string]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policy")
+	r.Params.Set("detailed", "true")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || secret.Data == nil || len(secret.Data) == 0 {
+		return nil, nil
+	}
+
+	var result listPoliciesDetailedResp
+	err = mapstructure.Decode(secret.Data, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]map[string]string, len(result.KeyInfo))
+	for name, info := range result.KeyInfo {
+		policies[name] = info.Metadata
+	}
+	return policies, nil
+}
+
 func (c *Sys) GetPolicy(name string) (string, error) {
 	r := c.c.NewRequest("GET", fmt.Sprintf("/v1/sys/policy/%s", name))
 	resp, err := c.c.RawRequest(r)
@@ -63,11 +95,72 @@ func (c *Sys) GetPolicy(name string) (string, error) {
 	return result.Rules, err
 }
 
+// GetPolicyMetadata returns the metadata stored with the named policy.
+func (c *Sys) GetPolicyMetadata(name string) (map[string]string, error) {
+	r := c.c.NewRequest("GET", fmt.Sprintf("/v1/sys/policy/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == nil || secret.Data == nil || len(secret.Data) == 0 {
+		return nil, nil
+	}
+
+	var result getPoliciesResp
+	err = mapstructure.Decode(secret.Data, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.Metadata, err
+}
+
 func (c *Sys) PutPolicy(name, rules string) error {
-	body := map[string]string{
+	return c.putPolicy(name, map[string]interface{}{
 		"rules": rules,
-	}
+	})
+}
 
+// PutPolicyWithMetadata writes a policy along with metadata such as its
+// description or owner.
+func (c *Sys) PutPolicyWithMetadata(name, rules string, metadata map[string]string) error {
+	return c.putPolicy(name, map[string]interface{}{
+		"rules":    rules,
+		"metadata": metadata,
+	})
+}
+
+// PutPolicyWithSyntax writes a policy whose rules are written in the given
+// syntax, "hcl" or "hcl2".
+func (c *Sys) PutPolicyWithSyntax(name, rules, syntax string) error {
+	return c.putPolicy(name, map[string]interface{}{
+		"rules":  rules,
+		"syntax": syntax,
+	})
+}
+
+// PutPolicySigned writes a policy along with a detached PGP signature of its
+// rules, which is checked against the keys trusted to sign policies.
+func (c *Sys) PutPolicySigned(name, rules, signature string) error {
+	return c.putPolicy(name, map[string]interface{}{
+		"rules":     rules,
+		"signature": signature,
+	})
+}
+
+func (c *Sys) putPolicy(name string, body map[string]interface{}) error {
 	r := c.c.NewRequest("PUT", fmt.Sprintf("/v1/sys/policy/%s", name))
 	if err := r.SetJSONBody(body); err != nil {
 		return err
@@ -82,6 +175,72 @@ func (c *Sys) PutPolicy(name, rules string) error {
 	return nil
 }
 
+func (c *Sys) ValidatePolicy(rules string) (*PolicyValidation, error) {
+	body := map[string]string{
+		"rules": rules,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/policy-validate")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result PolicyValidation
+	err = mapstructure.Decode(secret.Data, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, err
+}
+
+// DiffPolicy compares the given rules with the stored rules of the named
+// policy, without writing anything.
+func (c *Sys) DiffPolicy(name, rules string) (*PolicyDiff, error) {
+	body := map[string]string{
+		"rules": rules,
+	}
+
+	r := c.c.NewRequest("PUT", fmt.Sprintf("/v1/sys/policy/%s/diff", name))
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("data from server response is empty")
+	}
+
+	var result PolicyDiff
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
 func (c *Sys) DeletePolicy(name string) error {
 	r := c.c.NewRequest("DELETE", fmt.Sprintf("/v1/sys/policy/%s", name))
 	resp, err := c.c.RawRequest(r)
@@ -91,10 +250,109 @@ func (c *Sys) DeletePolicy(name string) error {
 	return err
 }
 
+// DeletePolicyRevoke deletes the named policy and revokes the tokens that
+// reference it, returning how many there were.
+func (c *Sys) DeletePolicyRevoke(name string) (int, error) {
+	r := c.c.NewRequest("DELETE", fmt.Sprintf("/v1/sys/policy/%s", name))
+	r.Params.Set("revoke", "true")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			RevokedTokens int `json:"revoked_tokens"`
+		} `json:"data"`
+	}
+	if err := resp.DecodeJSON(&result); err != nil {
+		return 0, err
+	}
+	return result.Data.RevokedTokens, nil
+}
+
+// UnmountedPolicyPaths returns, for each policy with any, the path patterns
+// that can never match as no backend is mounted where they point.
+func (c *Sys) UnmountedPolicyPaths() (map[string][]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policy-unmounted")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Policies map[string][]string `mapstructure:"policies"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Policies, nil
+}
+
+// PurgePolicyCache clears the policies, policy groups and ACLs cached by
+// the server.
+func (c *Sys) PurgePolicyCache() error {
+	r := c.c.NewRequest("PUT", "/v1/sys/policy-cache/purge")
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
 type getPoliciesResp struct {
-	Rules string `json:"rules"`
+	Rules    string            `json:"rules"`
+	Metadata map[string]string `json:"metadata"`
 }
 
 type listPoliciesResp struct {
 	Policies []string `json:"policies"`
 }
+
+type listPoliciesDetailedResp struct {
+	KeyInfo map[string]struct {
+		Metadata map[string]string `json:"metadata"`
+	} `mapstructure:"key_info"`
+}
+
+// PolicyValidation is the result of validating the rules of a policy
+type PolicyValidation struct {
+	Valid    bool           `mapstructure:"valid"`
+	Errors   []*PolicyIssue `mapstructure:"errors"`
+	Warnings []*PolicyIssue `mapstructure:"warnings"`
+}
+
+// PolicyDiff is the difference between candidate rules and the stored rules
+// of a policy
+type PolicyDiff struct {
+	Exists    bool              `mapstructure:"exists"`
+	Identical bool              `mapstructure:"identical"`
+	Added     []*PolicyPathDiff `mapstructure:"added"`
+	Removed   []*PolicyPathDiff `mapstructure:"removed"`
+	Changed   []*PolicyPathDiff `mapstructure:"changed"`
+}
+
+// PolicyPathDiff describes how the rules for a path pattern differ
+type PolicyPathDiff struct {
+	Path                string   `mapstructure:"path"`
+	AddedCapabilities   []string `mapstructure:"added_capabilities"`
+	RemovedCapabilities []string `mapstructure:"removed_capabilities"`
+	Settings            []string `mapstructure:"settings"`
+}
+
+// PolicyIssue is an error or warning about the rules of a policy. Line is
+// zero if the issue is not tied to a line.
+type PolicyIssue struct {
+	Line    int    `mapstructure:"line"`
+	Message string `mapstructure:"message"`
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ListRulePolicies returns the names of the rule policies.
+func (c *Sys) ListRulePolicies() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policy-rule")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		Keys []string `mapstructure:"keys"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return result.Keys, nil
+}
+
+// GetRulePolicy returns the named rule policy, or nil if it does not exist.
+func (c *Sys) GetRulePolicy(name string) (*RulePolicy, error) {
+	r := c.c.NewRequest("GET", fmt.Sprintf("/v1/sys/policy-rule/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil || len(secret.Data) == 0 {
+		return nil, nil
+	}
+
+	var result RulePolicy
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// PutRulePolicy writes a rule policy.
+func (c *Sys) PutRulePolicy(policy *RulePolicy) error {
+	body := map[string]interface{}{
+		"paths":     policy.Paths,
+		"condition": policy.Condition,
+		"time_zone": policy.TimeZone,
+	}
+
+	r := c.c.NewRequest("PUT", fmt.Sprintf("/v1/sys/policy-rule/%s", policy.Name))
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// DeleteRulePolicy deletes the named rule policy.
+func (c *Sys) DeleteRulePolicy(name string) error {
+	r := c.c.NewRequest("DELETE", fmt.Sprintf("/v1/sys/policy-rule/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RulePolicy is a policy checked after the path rules of ACL policies have
+// allowed a request, which denies requests to its paths for which its
+// condition is false.
+type RulePolicy struct {
+	Name      string   `mapstructure:"name"`
+	Paths     []string `mapstructure:"paths"`
+	Condition string   `mapstructure:"condition"`
+	TimeZone  string   `mapstructure:"time_zone"`
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// ListDeletedPolicies returns the deleted policies that can be restored,
+// keyed by name.
+func (c *Sys) ListDeletedPolicies() (map[string]*DeletedPolicy, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policy-trash")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+		if resp.StatusCode == 404 {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, nil
+	}
+
+	var result struct {
+		KeyInfo map[string]struct {
+			DeleteTime string `mapstructure:"delete_time"`
+			PurgeTime  string `mapstructure:"purge_time"`
+		} `mapstructure:"key_info"`
+	}
+	if err := mapstructure.Decode(secret.Data, &result); err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]*DeletedPolicy, len(result.KeyInfo))
+	for name, info := range result.KeyInfo {
+		deleteTime, err := time.Parse(time.RFC3339Nano, info.DeleteTime)
+		if err != nil {
+			return nil, err
+		}
+		purgeTime, err := time.Parse(time.RFC3339Nano, info.PurgeTime)
+		if err != nil {
+			return nil, err
+		}
+		deleted[name] = &DeletedPolicy{
+			DeleteTime: deleteTime,
+			PurgeTime:  purgeTime,
+		}
+	}
+	return deleted, nil
+}
+
+// RestorePolicy restores the named deleted policy.
+func (c *Sys) RestorePolicy(name string) error {
+	r := c.c.NewRequest("PUT", fmt.Sprintf("/v1/sys/policy-trash/restore/%s", name))
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// PolicyTrashRetention returns how long deleted policies can be restored.
+func (c *Sys) PolicyTrashRetention() (time.Duration, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policy-trash/config")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, nil
+	}
+
+	var result struct {
+		Retention int64 `mapstructure:"retention"`
+	}
+	if err := mapstructure.WeakDecode(secret.Data, &result); err != nil {
+		return 0, err
+	}
+	return time.Duration(result.Retention) * time.Second, nil
+}
+
+// SetPolicyTrashRetention sets how long deleted policies can be restored.
+// Policies are deleted outright if it is zero.
+func (c *Sys) SetPolicyTrashRetention(retention time.Duration) error {
+	body := map[string]interface{}{
+		"retention": int64(retention.Seconds()),
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/policy-trash/config")
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
+// DeletedPolicy is a deleted policy that can be restored until PurgeTime.
+type DeletedPolicy struct {
+	DeleteTime time.Time
+	PurgeTime  time.Time
+}
@@ -41,13 +41,14 @@ func (f *FormatJSON) FormatRequest(
 		},
 
 		Request: JSONRequest{
-			ClientToken: req.ClientToken,
-			ID:          req.ID,
-			Operation:   req.Operation,
-			Path:        req.Path,
-			Data:        req.Data,
-			RemoteAddr:  getRemoteAddr(req),
-			WrapTTL:     int(req.WrapTTL / time.Second),
+			ClientToken:   req.ClientToken,
+			ID:            req.ID,
+			Operation:     req.Operation,
+			Path:          req.Path,
+			Data:          req.Data,
+			RemoteAddr:    getRemoteAddr(req),
+			WrapTTL:       int(req.WrapTTL / time.Second),
+			ShadowDenials: req.ShadowDenials,
 		},
 	})
 }
@@ -112,13 +113,14 @@ func (f *FormatJSON) FormatResponse(
 		},
 
 		Request: JSONRequest{
-			ClientToken: req.ClientToken,
-			ID:          req.ID,
-			Operation:   req.Operation,
-			Path:        req.Path,
-			Data:        req.Data,
-			RemoteAddr:  getRemoteAddr(req),
-			WrapTTL:     int(req.WrapTTL / time.Second),
+			ClientToken:   req.ClientToken,
+			ID:            req.ID,
+			Operation:     req.Operation,
+			Path:          req.Path,
+			Data:          req.Data,
+			RemoteAddr:    getRemoteAddr(req),
+			WrapTTL:       int(req.WrapTTL / time.Second),
+			ShadowDenials: req.ShadowDenials,
 		},
 
 		Response: JSONResponse{
@@ -158,6 +160,10 @@ type JSONRequest struct {
 	Data        map[string]interface{} `json:"data"`
 	RemoteAddr  string                 `json:"remote_address"`
 	WrapTTL     int                    `json:"wrap_ttl"`
+
+	// ShadowDenials are the policies in shadow mode that would have denied
+	// the request
+	ShadowDenials []string `json:"shadow_denials,omitempty"`
 }
 
 type JSONResponse struct {
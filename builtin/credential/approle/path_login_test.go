@@ -2,6 +2,7 @@ package approle
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 )
@@ -53,3 +54,134 @@ func TestAppRole_RoleLogin(t *testing.T) {
 		t.Fatalf("expected a non-nil auth object in the response")
 	}
 }
+
+func TestAppRole_RoleLogin_CIDRList(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	createRole(t, b, storage, "role1", "a,b,c")
+	roleUpdateReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/bound-cidr-list",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"bound_cidr_list": "10.0.0.0/8,127.0.0.0/8",
+		},
+	}
+	resp, err = b.HandleRequest(roleUpdateReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/role1/role-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	roleID := resp.Data["role_id"]
+
+	// SecretIDs cannot be used from outside of the role's CIDR blocks
+	roleSecretIDReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"cidr_list": "192.168.0.0/16",
+		},
+	}
+	resp, err = b.HandleRequest(roleSecretIDReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: err:%v resp:%#v", err, resp)
+	}
+
+	roleSecretIDReq.Data["cidr_list"] = "127.0.0.1/32"
+	resp, err = b.HandleRequest(roleSecretIDReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	secretID := resp.Data["secret_id"]
+
+	loginReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "login",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		},
+		Connection: &logical.Connection{RemoteAddr: "10.0.0.1"},
+	}
+
+	// The address is within the role's blocks, but not the SecretID's
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: err:%v resp:%#v", err, resp)
+	}
+
+	loginReq.Connection.RemoteAddr = "127.0.0.1"
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Auth == nil {
+		t.Fatalf("expected a non-nil auth object in the response")
+	}
+}
+
+func TestAppRole_RoleLogin_ExpiredSecretID(t *testing.T) {
+	var resp *logical.Response
+	var err error
+	b, storage := createBackendWithStorage(t)
+
+	createRole(t, b, storage, "role1", "a,b,c")
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id-ttl",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"secret_id_ttl": 1,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/role1/role-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	roleID := resp.Data["role_id"]
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "role/role1/secret-id",
+		Storage:   storage,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	secretID := resp.Data["secret_id"]
+
+	// The SecretID is not valid once expired, although it is not tidied yet
+	time.Sleep(1500 * time.Millisecond)
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "login",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: err:%v resp:%#v", err, resp)
+	}
+}
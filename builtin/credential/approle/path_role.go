@@ -354,6 +354,13 @@ be renewed. Defaults to 0, in which case the value will fall back to the system/
 					Description: `Metadata to be tied to the SecretID. This should be a JSON
 formatted string containing the metadata in key value pairs.`,
 				},
+				"cidr_list": &framework.FieldSchema{
+					Type: framework.TypeString,
+					Description: `Comma separated list of CIDR blocks enforcing SecretIDs to be used from
+specific set of IP addresses. If 'bound_cidr_list' is set on the role, then the
+list of CIDR blocks listed here should be a subset of the CIDR blocks listed on
+the role.`,
+				},
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.pathRoleSecretIDUpdate,
@@ -397,6 +404,13 @@ formatted string containing the metadata in key value pairs.`,
 					Description: `Metadata to be tied to the SecretID. This should be a JSON
 formatted string containing metadata in key value pairs.`,
 				},
+				"cidr_list": &framework.FieldSchema{
+					Type: framework.TypeString,
+					Description: `Comma separated list of CIDR blocks enforcing SecretIDs to be used from
+specific set of IP addresses. If 'bound_cidr_list' is set on the role, then the
+list of CIDR blocks listed here should be a subset of the CIDR blocks listed on
+the role.`,
+				},
 			},
 			Callbacks: map[logical.Operation]framework.OperationFunc{
 				logical.UpdateOperation: b.pathRoleCustomSecretIDUpdate,
@@ -1456,6 +1470,17 @@ func (b *backend) handleRoleSecretIDCommon(req *logical.Request, data *framework
 		return logical.ErrorResponse(fmt.Sprintf("failed to parse metadata: %v", err)), nil
 	}
 
+	cidrList := data.Get("cidr_list").(string)
+	if err = validateCIDRList(cidrList); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to validate cidr_list: %v", err)), nil
+	}
+	secretIDStorage.CIDRList = parseCIDRList(cidrList)
+
+	// Restricting a SecretID can only narrow the addresses allowed by the role
+	if role.BoundCIDRList != "" && !cidrListSubset(parseCIDRList(role.BoundCIDRList), secretIDStorage.CIDRList) {
+		return logical.ErrorResponse("cidr_list must be a subset of the bound_cidr_list of the role"), nil
+	}
+
 	if secretIDStorage, err = b.registerSecretIDEntry(req.Storage, roleName, secretID, role.HMACKey, secretIDStorage); err != nil {
 		return nil, fmt.Errorf("failed to store SecretID: %s", err)
 	}
@@ -1570,8 +1595,9 @@ The value of 'secret_id' can be retrieved using 'role/<role_name>/secret-id' end
 		`Comma separated list of CIDR blocks, if set, specifies blocks of IP
 addresses which can perform the login operation`,
 		`During login, the IP address of the client will be checked to see if it
-belongs to the CIDR blocks specified. If CIDR blocks were set and if the
-IP is not encompassed by it, login fails`,
+belongs to any of the CIDR blocks specified. If CIDR blocks were set and if
+the IP is not encompassed by them, login fails. SecretIDs can be further
+restricted to a subset of these blocks using the 'cidr_list' parameter.`,
 	},
 	"role-policies": {
 		"Policies of the role.",
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -46,6 +47,10 @@ type secretIDStorageEntry struct {
 
 	// Metadata that belongs to the SecretID.
 	Metadata map[string]string `json:"metadata" structs:"metadata" mapstructure:"metadata"`
+
+	// CIDR blocks that the login operation using this SecretID is restricted
+	// to. These must be within the bound_cidr_list of the role, if set.
+	CIDRList []string `json:"cidr_list" structs:"cidr_list" mapstructure:"cidr_list"`
 }
 
 // Represents the payload of the storage entry of the accessor that maps to a unique
@@ -73,6 +78,69 @@ func validateCIDRList(cidrList string) error {
 	return nil
 }
 
+// Splits the comma separated list of CIDR blocks into its blocks
+func parseCIDRList(cidrList string) []string {
+	var blocks []string
+	for _, block := range strutil.ParseStringSlice(cidrList, ",") {
+		if block = strings.TrimSpace(block); block != "" {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks
+}
+
+// Checks if every CIDR block in subset is contained in one of the blocks in
+// superset. The blocks are expected to have been validated.
+func cidrListSubset(superset, subset []string) bool {
+	for _, block := range subset {
+		_, subNet, err := net.ParseCIDR(block)
+		if err != nil {
+			return false
+		}
+		subOnes, _ := subNet.Mask.Size()
+
+		contained := false
+		for _, superBlock := range superset {
+			_, superNet, err := net.ParseCIDR(superBlock)
+			if err != nil {
+				continue
+			}
+			superOnes, _ := superNet.Mask.Size()
+			if superNet.Contains(subNet.IP) && superOnes <= subOnes {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks if the source address of the request belongs to any of the CIDR blocks
+func verifyCIDRList(req *logical.Request, cidrBlocks []string) error {
+	var addr string
+	if req.Connection != nil {
+		addr = req.Connection.RemoteAddr
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return fmt.Errorf("unauthorized source address")
+	}
+
+	for _, block := range cidrBlocks {
+		_, cidr, err := net.ParseCIDR(block)
+		if err != nil {
+			return fmt.Errorf("invalid cidr: %s", err)
+		}
+		if cidr.Contains(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("unauthorized source address")
+}
+
 // Checks if the Role represented by the RoleID still exists
 func (b *backend) validateRoleID(s logical.Storage, roleID string) (*roleStorageEntry, string, error) {
 	// Look for the storage entry that maps the roleID to role
@@ -118,6 +186,15 @@ func (b *backend) validateCredentials(req *logical.Request, data *framework.Fiel
 		return nil, "", metadata, err
 	}
 
+	if role.BoundCIDRList != "" {
+		// If 'bound_cidr_list' was set, verify the CIDR restrictions. This is
+		// done before validating the SecretID so that attempts from other
+		// addresses do not consume its uses.
+		if err := verifyCIDRList(req, parseCIDRList(role.BoundCIDRList)); err != nil {
+			return nil, "", metadata, err
+		}
+	}
+
 	if role.BindSecretID {
 		// If 'bind_secret_id' was set on role, look for the field 'secret_id'
 		// to be specified and validate it.
@@ -129,7 +206,7 @@ func (b *backend) validateCredentials(req *logical.Request, data *framework.Fiel
 		// Check if the SecretID supplied is valid. If use limit was specified
 		// on the SecretID, it will be decremented in this call.
 		var valid bool
-		valid, metadata, err = b.validateBindSecretID(req.Storage, roleName, secretID, role.HMACKey)
+		valid, metadata, err = b.validateBindSecretID(req, roleName, secretID, role.HMACKey)
 		if err != nil {
 			return nil, "", metadata, err
 		}
@@ -138,30 +215,16 @@ func (b *backend) validateCredentials(req *logical.Request, data *framework.Fiel
 		}
 	}
 
-	if role.BoundCIDRList != "" {
-		// If 'bound_cidr_list' was set, verify the CIDR restrictions
-		cidrBlocks := strings.Split(role.BoundCIDRList, ",")
-		for _, block := range cidrBlocks {
-			_, cidr, err := net.ParseCIDR(block)
-			if err != nil {
-				return nil, "", metadata, fmt.Errorf("invalid cidr: %s", err)
-			}
-
-			var addr string
-			if req.Connection != nil {
-				addr = req.Connection.RemoteAddr
-			}
-			if addr == "" || !cidr.Contains(net.ParseIP(addr)) {
-				return nil, "", metadata, fmt.Errorf("unauthorized source address")
-			}
-		}
-	}
-
 	return role, roleName, metadata, nil
 }
 
-// validateBindSecretID is used to determine if the given SecretID is a valid one.
-func (b *backend) validateBindSecretID(s logical.Storage, roleName, secretID, hmacKey string) (bool, map[string]string, error) {
+// validateBindSecretID is used to determine if the given SecretID is a valid
+// one. Expired SecretIDs are not valid, even before they are tidied, and
+// SecretIDs restricted to CIDR blocks are only valid for requests from within
+// them.
+func (b *backend) validateBindSecretID(req *logical.Request, roleName, secretID, hmacKey string) (bool, map[string]string, error) {
+	s := req.Storage
+
 	secretIDHMAC, err := createHMAC(hmacKey, secretID)
 	if err != nil {
 		return false, nil, fmt.Errorf("failed to create HMAC of secret_id: %s", err)
@@ -192,6 +255,18 @@ func (b *backend) validateBindSecretID(s logical.Storage, roleName, secretID, hm
 		return false, nil, err
 	}
 
+	if !result.ExpirationTime.IsZero() && time.Now().After(result.ExpirationTime) {
+		lock.RUnlock()
+		return false, nil, nil
+	}
+
+	if len(result.CIDRList) != 0 {
+		if err := verifyCIDRList(req, result.CIDRList); err != nil {
+			lock.RUnlock()
+			return false, nil, err
+		}
+	}
+
 	// SecretIDNumUses will be zero only if the usage limit was not set at all,
 	// in which case, the SecretID will remain to be valid as long as it is not
 	// expired.
@@ -2,11 +2,17 @@ package awsec2
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
@@ -1274,3 +1280,193 @@ func TestBackendAcc_LoginAndWhitelistIdentity(t *testing.T) {
 		t.Fatalf("login attempt failed")
 	}
 }
+
+// iamLoginData signs an sts:GetCallerIdentity request to the given endpoint
+// and returns the login data presenting it
+func iamLoginData(t *testing.T, endpoint, serverID, body string) map[string]interface{} {
+	req, err := http.NewRequest("POST", endpoint+"/", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	if serverID != "" {
+		req.Header.Set(iamServerIDHeader, serverID)
+	}
+
+	signer := v4.NewSigner(credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", ""))
+	if _, err := signer.Sign(req, strings.NewReader(body), "sts", "us-east-1", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	headers, err := json.Marshal(req.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]interface{}{
+		"role":                    "lambda",
+		"iam_http_request_method": "POST",
+		"iam_request_url":         base64.StdEncoding.EncodeToString([]byte(req.URL.String())),
+		"iam_request_body":        base64.StdEncoding.EncodeToString([]byte(body)),
+		"iam_request_headers":     base64.StdEncoding.EncodeToString(headers),
+	}
+}
+
+func TestBackend_pathLoginIAM(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The fake STS endpoint returns the identity of an assumed role for
+	// signed sts:GetCallerIdentity requests
+	callerARN := "arn:aws:sts::123456789012:assumed-role/lambda-role/my-function"
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") ||
+			r.FormValue("Action") != "GetCallerIdentity" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprintf(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetCallerIdentityResult>
+    <Arn>%s</Arn>
+    <UserId>AROAEXAMPLE:my-function</UserId>
+    <Account>123456789012</Account>
+  </GetCallerIdentityResult>
+</GetCallerIdentityResponse>`, callerARN)
+	}))
+	defer sts.Close()
+
+	write := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+			Storage:   storage,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := write("config/client", map[string]interface{}{
+		"sts_endpoint":               sts.URL,
+		"iam_server_id_header_value": "vault.example.com",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Roles of the iam auth type must be bound to a principal, and cannot
+	// have the bounds of the ec2 auth type
+	for _, data := range []map[string]interface{}{
+		{"auth_type": "iam"},
+		{"auth_type": "iam", "bound_iam_principal_arn": "arn:aws:iam::123456789012:role/lambda-role", "bound_ami_id": "ami-1234"},
+		{"auth_type": "bogus", "bound_iam_principal_arn": "arn:aws:iam::123456789012:role/lambda-role"},
+		{"bound_ami_id": "ami-1234", "bound_iam_principal_arn": "arn:aws:iam::123456789012:role/lambda-role"},
+	} {
+		if resp := write("role/lambda", data); resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+	if resp := write("role/lambda", map[string]interface{}{
+		"auth_type":               "iam",
+		"bound_iam_principal_arn": "arn:aws:iam::123456789012:role/lambda-*",
+		"bound_account_id":        "123456789012",
+		"policies":                "lambda",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := write("role/lambda", map[string]interface{}{
+		"auth_type": "ec2",
+	}); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	body := "Action=GetCallerIdentity&Version=2011-06-15"
+	resp := write("login", iamLoginData(t, sts.URL, "vault.example.com", body))
+	if resp == nil || resp.Auth == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if !policyutil.EquivalentPolicies(resp.Auth.Policies, []string{"default", "lambda"}) {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if resp.Auth.Metadata["canonical_arn"] != "arn:aws:iam::123456789012:role/lambda-role" ||
+		resp.Auth.Metadata["client_arn"] != callerARN ||
+		resp.Auth.Metadata["auth_type"] != "iam" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	auth := resp.Auth
+
+	// Requests for other actions or endpoints, or not bound to this server,
+	// are rejected before being sent
+	for _, data := range []map[string]interface{}{
+		iamLoginData(t, sts.URL, "vault.example.com", "Action=ListUsers&Version=2010-05-08"),
+		iamLoginData(t, sts.URL, "vault.example.com", body+"&RoleArn=bogus"),
+		iamLoginData(t, "http://sts.example.com", "vault.example.com", body),
+		iamLoginData(t, sts.URL, "other.example.com", body),
+		iamLoginData(t, sts.URL, "", body),
+	} {
+		if resp := write("login", data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %#v", resp)
+		}
+	}
+
+	// Principals that are not bound to the role are rejected
+	callerARN = "arn:aws:iam::123456789012:user/alice"
+	if resp := write("login", iamLoginData(t, sts.URL, "vault.example.com", body)); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// Tokens are renewed as long as the role still allows the principal
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Auth:      auth,
+	}
+	auth.IssueTime = time.Now()
+	resp, err = b.HandleRequest(renewReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	write("role/lambda", map[string]interface{}{
+		"bound_iam_principal_arn": "arn:aws:iam::123456789012:role/other",
+	})
+	if _, err := b.HandleRequest(renewReq); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestBackend_canonicalPrincipalARN(t *testing.T) {
+	cases := map[string]string{
+		"arn:aws:sts::123456789012:assumed-role/ecs-task/1a2b3c": "arn:aws:iam::123456789012:role/ecs-task",
+		"arn:aws-cn:sts::123456789012:assumed-role/web/i-1234":   "arn:aws-cn:iam::123456789012:role/web",
+		"arn:aws:iam::123456789012:user/division/alice":          "arn:aws:iam::123456789012:user/division/alice",
+		"arn:aws:sts::123456789012:federated-user/alice":         "",
+		"arn:aws:s3:::bucket":                                    "",
+		"bogus":                                                  "",
+	}
+	for arn, expected := range cases {
+		canonical, err := canonicalPrincipalARN(arn)
+		if expected == "" {
+			if err == nil {
+				t.Fatalf("%s: expected an error", arn)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %v", arn, err)
+		}
+		if canonical != expected {
+			t.Fatalf("%s: bad: %s", arn, canonical)
+		}
+	}
+}
@@ -27,6 +27,18 @@ func pathConfigClient(b *backend) *framework.Path {
 				Default:     "",
 				Description: "URL to override the default generated endpoint for making AWS EC2 API calls.",
 			},
+
+			"sts_endpoint": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "",
+				Description: "URL of the AWS STS endpoint the sts:GetCallerIdentity requests of the iam auth type are sent to. Defaults to https://sts.amazonaws.com.",
+			},
+
+			"iam_server_id_header_value": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "",
+				Description: "If set, the value the signed X-Vault-AWS-IAM-Server-ID header of the sts:GetCallerIdentity requests of the iam auth type must have. This prevents requests signed for another server from being replayed.",
+			},
 		},
 
 		ExistenceCheck: b.pathConfigClientExistenceCheck,
@@ -159,6 +171,27 @@ func (b *backend) pathConfigClientCreateUpdate(
 		configEntry.Endpoint = data.Get("endpoint").(string)
 	}
 
+	// The STS settings are only used by logins of the iam auth type, so the
+	// cached EC2 clients do not need to be flushed when they change.
+	stsEndpointStr, ok := data.GetOk("sts_endpoint")
+	if ok {
+		configEntry.STSEndpoint = stsEndpointStr.(string)
+	} else if req.Operation == logical.CreateOperation {
+		configEntry.STSEndpoint = data.Get("sts_endpoint").(string)
+	}
+	if configEntry.STSEndpoint != "" {
+		if _, err := parseSTSEndpoint(configEntry.STSEndpoint); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	serverIDStr, ok := data.GetOk("iam_server_id_header_value")
+	if ok {
+		configEntry.IAMServerIDHeaderValue = serverIDStr.(string)
+	} else if req.Operation == logical.CreateOperation {
+		configEntry.IAMServerIDHeaderValue = data.Get("iam_server_id_header_value").(string)
+	}
+
 	// Since this endpoint supports both create operation and update operation,
 	// the error checks for access_key and secret_key not being set are not present.
 	// This allows calling this endpoint multiple times to provide the values.
@@ -186,6 +219,9 @@ type clientConfig struct {
 	AccessKey string `json:"access_key" structs:"access_key" mapstructure:"access_key"`
 	SecretKey string `json:"secret_key" structs:"secret_key" mapstructure:"secret_key"`
 	Endpoint  string `json:"endpoint" structs:"endpoint" mapstructure:"endpoint"`
+
+	STSEndpoint            string `json:"sts_endpoint" structs:"sts_endpoint" mapstructure:"sts_endpoint"`
+	IAMServerIDHeaderValue string `json:"iam_server_id_header_value" structs:"iam_server_id_header_value" mapstructure:"iam_server_id_header_value"`
 }
 
 const pathConfigClientHelpSyn = `
@@ -196,4 +232,9 @@ const pathConfigClientHelpDesc = `
 aws-ec2 auth backend makes DescribeInstances API call to retrieve information regarding
 the instance that performs login. The aws_secret_key and aws_access_key registered with
 Vault should have the permissions to make the API call.
+
+Logins of the iam auth type send the signed sts:GetCallerIdentity request of the
+client to 'sts_endpoint'. No credentials are needed for that. If
+'iam_server_id_header_value' is set, these requests must carry it in the signed
+X-Vault-AWS-IAM-Server-ID header.
 `
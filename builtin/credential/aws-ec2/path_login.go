@@ -37,6 +37,27 @@ If a matching role is not found, login fails.`,
 option is enabled on either the role or the role tag, then nonce parameter is
 optional. It is a required parameter otherwise.`,
 			},
+
+			"iam_http_request_method": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `HTTP method of the signed sts:GetCallerIdentity request, for logins of the
+iam auth type. It must be POST.`,
+			},
+
+			"iam_request_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded URL of the signed sts:GetCallerIdentity request.",
+			},
+
+			"iam_request_body": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded body of the signed sts:GetCallerIdentity request.",
+			},
+
+			"iam_request_headers": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded JSON object of the headers of the signed sts:GetCallerIdentity request.",
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -205,6 +226,12 @@ func (b *backend) parseIdentityDocument(s logical.Storage, pkcs7B64 string) (*id
 func (b *backend) pathLoginUpdate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 
+	// Logins of the iam auth type present a signed request instead of an
+	// identity document
+	if _, ok := data.GetOk("iam_http_request_method"); ok {
+		return b.pathLoginUpdateIAM(req, data)
+	}
+
 	pkcs7B64 := data.Get("pkcs7").(string)
 	if pkcs7B64 == "" {
 		return logical.ErrorResponse("missing pkcs7"), nil
@@ -242,6 +269,9 @@ func (b *backend) pathLoginUpdate(
 	if roleEntry == nil {
 		return logical.ErrorResponse(fmt.Sprintf("entry for role '%s' not found", roleName)), nil
 	}
+	if roleEntry.AuthType != ec2AuthType {
+		return logical.ErrorResponse(fmt.Sprintf("role '%s' does not allow logins of the ec2 auth type", roleName)), nil
+	}
 
 	// Verify that the AMI ID of the instance trying to login matches the
 	// AMI ID specified as a constraint on the role.
@@ -397,6 +427,7 @@ func (b *backend) pathLoginUpdate(
 				"role_tag_max_ttl": rTagMaxTTL.String(),
 				"role":             roleName,
 				"ami_id":           identityDoc.AmiID,
+				"auth_type":        ec2AuthType,
 			},
 			LeaseOptions: logical.LeaseOptions{
 				Renewable: true,
@@ -492,6 +523,10 @@ func (b *backend) handleRoleTagLogin(s logical.Storage, identityDoc *identityDoc
 // pathLoginRenew is used to renew an authenticated token.
 func (b *backend) pathLoginRenew(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.Auth.Metadata["auth_type"] == iamAuthType {
+		return b.pathLoginRenewIAM(req, data)
+	}
+
 	instanceID := req.Auth.Metadata["instance_id"]
 	if instanceID == "" {
 		return nil, fmt.Errorf("unable to fetch instance ID from metadata during renewal")
@@ -582,7 +617,7 @@ Authenticates an EC2 instance with Vault.
 `
 
 const pathLoginDesc = `
-An EC2 instance is authenticated using the PKCS#7 signature of the instance identity
+With roles of the ec2 auth type, an EC2 instance is authenticated using the PKCS#7 signature of the instance identity
 document and a client created nonce. This nonce should be unique and should be used by
 the instance for all future logins, unless 'disallow_reauthenitcation' option on the
 registered role is enabled, in which case client nonce is optional.
@@ -595,4 +630,11 @@ By default, a cron task will periodically look for expired entries in the whitel
 and deletes them. The duration to periodically run this, is one hour by default.
 However, this can be configured using the 'config/tidy/identities' endpoint. This tidy
 action can be triggered via the API as well, using the 'tidy/identities' endpoint.
+
+With roles of the iam auth type, an IAM principal is authenticated by presenting
+an sts:GetCallerIdentity request signed with its credentials, using the
+'iam_http_request_method', 'iam_request_url', 'iam_request_body' and
+'iam_request_headers' parameters. The request is sent to AWS STS by Vault, and
+the ARN of the caller it returns must match the 'bound_iam_principal_arn' of the
+role. No identity whitelist entry is created for these logins.
 `
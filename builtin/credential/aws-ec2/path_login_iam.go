@@ -0,0 +1,362 @@
+package awsec2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	ec2AuthType = "ec2"
+	iamAuthType = "iam"
+
+	// defaultSTSEndpoint is where the sts:GetCallerIdentity requests are sent
+	// unless configured otherwise
+	defaultSTSEndpoint = "https://sts.amazonaws.com"
+
+	// iamServerIDHeader is the header binding signed requests to a server
+	iamServerIDHeader = "X-Vault-AWS-IAM-Server-ID"
+)
+
+// parseSTSEndpoint parses the URL of an STS endpoint
+func parseSTSEndpoint(endpoint string) (*url.URL, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sts_endpoint: %s", err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("sts_endpoint must be an http or https URL")
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("sts_endpoint cannot have a path")
+	}
+	return u, nil
+}
+
+// pathLoginUpdateIAM is used to create a Vault token for an IAM principal,
+// by submitting the sts:GetCallerIdentity request it signed to AWS STS.
+func (b *backend) pathLoginUpdateIAM(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	method := data.Get("iam_http_request_method").(string)
+	if method != "POST" {
+		return logical.ErrorResponse("iam_http_request_method must be POST"), nil
+	}
+
+	rawURL, err := base64.StdEncoding.DecodeString(data.Get("iam_request_url").(string))
+	if err != nil {
+		return logical.ErrorResponse("failed to base64 decode iam_request_url"), nil
+	}
+	body, err := base64.StdEncoding.DecodeString(data.Get("iam_request_body").(string))
+	if err != nil {
+		return logical.ErrorResponse("failed to base64 decode iam_request_body"), nil
+	}
+	rawHeaders, err := base64.StdEncoding.DecodeString(data.Get("iam_request_headers").(string))
+	if err != nil {
+		return logical.ErrorResponse("failed to base64 decode iam_request_headers"), nil
+	}
+	headers, err := parseIAMRequestHeaders(rawHeaders)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	clientConfig, err := b.lockedClientConfigEntry(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	stsEndpoint := defaultSTSEndpoint
+	serverID := ""
+	if clientConfig != nil {
+		if clientConfig.STSEndpoint != "" {
+			stsEndpoint = clientConfig.STSEndpoint
+		}
+		serverID = clientConfig.IAMServerIDHeaderValue
+	}
+
+	requestURL, err := validateIAMRequest(stsEndpoint, serverID, string(rawURL), body, headers)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	roleEntry, err := b.lockedAWSRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if roleEntry == nil {
+		return logical.ErrorResponse(fmt.Sprintf("entry for role '%s' not found", roleName)), nil
+	}
+	if roleEntry.AuthType != iamAuthType {
+		return logical.ErrorResponse(fmt.Sprintf("role '%s' does not allow logins of the iam auth type", roleName)), nil
+	}
+
+	identity, err := submitCallerIdentityRequest(method, requestURL, body, headers)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("failed to verify the caller identity: %s", err)), nil
+	}
+
+	canonicalARN, err := canonicalPrincipalARN(identity.Arn)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if roleEntry.BoundAccountID != "" && identity.Account != roleEntry.BoundAccountID {
+		return logical.ErrorResponse(fmt.Sprintf("Account ID '%s' does not belong to role '%s'", identity.Account, roleName)), nil
+	}
+	if !principalARNMatches(roleEntry.BoundIamPrincipalARN, canonicalARN) {
+		return logical.ErrorResponse(fmt.Sprintf("IAM principal %s does not belong to role %s", canonicalARN, roleName)), nil
+	}
+
+	shortestMaxTTL := b.System().MaxLeaseTTL()
+	if roleEntry.MaxTTL > time.Duration(0) && roleEntry.MaxTTL < shortestMaxTTL {
+		shortestMaxTTL = roleEntry.MaxTTL
+	}
+
+	resp := &logical.Response{
+		Auth: &logical.Auth{
+			Policies: roleEntry.Policies,
+			Metadata: map[string]string{
+				"auth_type":      iamAuthType,
+				"role":           roleName,
+				"account_id":     identity.Account,
+				"canonical_arn":  canonicalARN,
+				"client_arn":     identity.Arn,
+				"client_user_id": identity.UserId,
+			},
+			DisplayName: canonicalARN,
+			LeaseOptions: logical.LeaseOptions{
+				Renewable: true,
+				TTL:       roleEntry.TTL,
+			},
+		},
+	}
+
+	// Cap the TTL value.
+	if shortestMaxTTL < roleEntry.TTL {
+		resp.AddWarning(fmt.Sprintf("Role ttl of %d exceeded the effective max_ttl of %d; ttl value is capped appropriately", roleEntry.TTL/time.Second, shortestMaxTTL/time.Second))
+		resp.Auth.TTL = shortestMaxTTL
+	}
+
+	return resp, nil
+}
+
+// pathLoginRenewIAM is used to renew a token issued to an IAM principal. The
+// role must still exist and allow the principal, with the same policies.
+func (b *backend) pathLoginRenewIAM(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := req.Auth.Metadata["role"]
+	if roleName == "" {
+		return nil, fmt.Errorf("unable to fetch role from metadata during renewal")
+	}
+
+	roleEntry, err := b.lockedAWSRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if roleEntry == nil {
+		return nil, fmt.Errorf("role entry not found")
+	}
+	if roleEntry.AuthType != iamAuthType {
+		return nil, fmt.Errorf("role %s no longer allows logins of the iam auth type", roleName)
+	}
+	if roleEntry.BoundAccountID != "" && req.Auth.Metadata["account_id"] != roleEntry.BoundAccountID {
+		return nil, fmt.Errorf("account ID %s no longer belongs to role %s", req.Auth.Metadata["account_id"], roleName)
+	}
+	if !principalARNMatches(roleEntry.BoundIamPrincipalARN, req.Auth.Metadata["canonical_arn"]) {
+		return nil, fmt.Errorf("IAM principal %s no longer belongs to role %s", req.Auth.Metadata["canonical_arn"], roleName)
+	}
+	if !policyutil.EquivalentPolicies(roleEntry.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies on role %s have changed, cannot renew", roleName)
+	}
+
+	return framework.LeaseExtend(roleEntry.TTL, roleEntry.MaxTTL, b.System())(req, data)
+}
+
+// parseIAMRequestHeaders parses the JSON object of the headers of a signed
+// request, whose values can be strings or lists of strings
+func parseIAMRequestHeaders(raw []byte) (http.Header, error) {
+	var headersRaw map[string]interface{}
+	if err := jsonutil.DecodeJSON(raw, &headersRaw); err != nil {
+		return nil, fmt.Errorf("failed to parse iam_request_headers: %s", err)
+	}
+
+	headers := make(http.Header)
+	for name, value := range headersRaw {
+		switch v := value.(type) {
+		case string:
+			headers.Add(name, v)
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("value of header %q in iam_request_headers must be a string or a list of strings", name)
+				}
+				headers.Add(name, s)
+			}
+		default:
+			return nil, fmt.Errorf("value of header %q in iam_request_headers must be a string or a list of strings", name)
+		}
+	}
+	return headers, nil
+}
+
+// validateIAMRequest checks that the signed request is an
+// sts:GetCallerIdentity request to the STS endpoint, and nothing else, so
+// that the credentials of the client cannot be used for any other action.
+// It returns the URL the request is to be sent to.
+func validateIAMRequest(stsEndpoint, serverID, rawURL string, body []byte, headers http.Header) (string, error) {
+	endpoint, err := parseSTSEndpoint(stsEndpoint)
+	if err != nil {
+		return "", err
+	}
+	requestURL, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("error parsing iam_request_url: %s", err)
+	}
+	if requestURL.Scheme != endpoint.Scheme || requestURL.Host != endpoint.Host {
+		return "", fmt.Errorf("iam_request_url must be a request to %s", stsEndpoint)
+	}
+	if (requestURL.Path != "" && requestURL.Path != "/") || requestURL.RawQuery != "" {
+		return "", fmt.Errorf("iam_request_url cannot have a path or a query")
+	}
+
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		return "", fmt.Errorf("error parsing iam_request_body: %s", err)
+	}
+	if len(params) != 2 || params.Get("Action") != "GetCallerIdentity" || params.Get("Version") == "" {
+		return "", fmt.Errorf("iam_request_body must only be an sts:GetCallerIdentity action")
+	}
+
+	authorization := headers.Get("Authorization")
+	if authorization == "" {
+		return "", fmt.Errorf("iam_request_headers must have a signed Authorization header")
+	}
+	if serverID != "" {
+		if headers.Get(iamServerIDHeader) != serverID {
+			return "", fmt.Errorf("missing or invalid %s header", iamServerIDHeader)
+		}
+		if !headerIsSigned(authorization, iamServerIDHeader) {
+			return "", fmt.Errorf("the %s header is not signed", iamServerIDHeader)
+		}
+	}
+
+	return endpoint.Scheme + "://" + endpoint.Host + "/", nil
+}
+
+// headerIsSigned returns whether the given header is in the SignedHeaders of
+// an AWS Signature Version 4 Authorization header
+func headerIsSigned(authorization, header string) bool {
+	for _, part := range strings.Split(authorization, ",") {
+		part = strings.TrimSpace(part)
+		if i := strings.Index(part, "SignedHeaders="); i >= 0 {
+			for _, signed := range strings.Split(part[i+len("SignedHeaders="):], ";") {
+				if strings.EqualFold(signed, header) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// callerIdentity is the result of an sts:GetCallerIdentity request
+type callerIdentity struct {
+	Arn     string `xml:"GetCallerIdentityResult>Arn"`
+	UserId  string `xml:"GetCallerIdentityResult>UserId"`
+	Account string `xml:"GetCallerIdentityResult>Account"`
+}
+
+// submitCallerIdentityRequest sends the signed sts:GetCallerIdentity request
+// to AWS STS, which verifies its signature, and returns the identity of the
+// caller.
+func submitCallerIdentityRequest(method, requestURL string, body []byte, headers http.Header) (*callerIdentity, error) {
+	request, err := http.NewRequest(method, requestURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range headers {
+		for _, value := range values {
+			request.Header.Add(name, value)
+		}
+	}
+
+	client := cleanhttp.DefaultClient()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return fmt.Errorf("redirects are not followed")
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("received status code %d from STS: %s", response.StatusCode, responseBody)
+	}
+
+	var identity callerIdentity
+	if err := xml.Unmarshal(responseBody, &identity); err != nil {
+		return nil, fmt.Errorf("error parsing STS response: %s", err)
+	}
+	if identity.Arn == "" || identity.Account == "" {
+		return nil, fmt.Errorf("no caller identity found in STS response")
+	}
+	return &identity, nil
+}
+
+// canonicalPrincipalARN returns the ARN of the IAM principal behind the ARN
+// of a caller. The sessions of assumed roles are mapped to the ARN of the
+// role they were assumed from, without its path.
+func canonicalPrincipalARN(arn string) (string, error) {
+	// arn:partition:service:region:account:resource
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return "", fmt.Errorf("unrecognized ARN %q", arn)
+	}
+	partition, service, account, resource := parts[1], parts[2], parts[4], parts[5]
+
+	switch service {
+	case "iam":
+		return arn, nil
+	case "sts":
+		resourceParts := strings.Split(resource, "/")
+		if resourceParts[0] != "assumed-role" || len(resourceParts) < 3 {
+			return "", fmt.Errorf("unsupported principal %q", arn)
+		}
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", partition, account, resourceParts[1]), nil
+	default:
+		return "", fmt.Errorf("unrecognized ARN %q", arn)
+	}
+}
+
+// principalARNMatches returns whether the principal ARN matches the bound
+// ARN, which may end with a wildcard
+func principalARNMatches(bound, arn string) bool {
+	if bound == "" || arn == "" {
+		return false
+	}
+	if strings.HasSuffix(bound, "*") {
+		return strings.HasPrefix(arn, strings.TrimSuffix(bound, "*"))
+	}
+	return arn == bound
+}
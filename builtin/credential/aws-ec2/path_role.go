@@ -20,6 +20,19 @@ func pathRole(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "Name of the role.",
 			},
+			"auth_type": {
+				Type:    framework.TypeString,
+				Default: ec2AuthType,
+				Description: `The type of authentication allowed by this role, either "ec2" for EC2
+instance identity documents, or "iam" for signed sts:GetCallerIdentity
+requests. It cannot be changed once the role is created.`,
+			},
+			"bound_iam_principal_arn": {
+				Type: framework.TypeString,
+				Description: `ARN of the IAM principal allowed to login with a role of the "iam" auth
+type. Assumed roles match the ARN of the role they were assumed from. A
+trailing "*" matches any ARN with the preceding prefix.`,
+			},
 			"bound_ami_id": {
 				Type: framework.TypeString,
 				Description: `If set, defines a constraint on the EC2 instances that they should be
@@ -138,6 +151,12 @@ func (b *backend) nonLockedAWSRole(s logical.Storage, role string) (*awsRoleEntr
 	if err := entry.DecodeJSON(&result); err != nil {
 		return nil, err
 	}
+
+	// Roles created before the iam auth type was added are of the ec2 auth
+	// type
+	if result.AuthType == "" {
+		result.AuthType = ec2AuthType
+	}
 	return &result, nil
 }
 
@@ -215,6 +234,25 @@ func (b *backend) pathRoleCreateUpdate(
 		roleEntry = &awsRoleEntry{}
 	}
 
+	authTypeRaw, ok := data.GetOk("auth_type")
+	if ok {
+		authType := authTypeRaw.(string)
+		if roleEntry.AuthType != "" && roleEntry.AuthType != authType {
+			return logical.ErrorResponse("auth_type cannot be changed"), nil
+		}
+		roleEntry.AuthType = authType
+	}
+	if roleEntry.AuthType == "" {
+		roleEntry.AuthType = data.Get("auth_type").(string)
+	}
+	if roleEntry.AuthType != ec2AuthType && roleEntry.AuthType != iamAuthType {
+		return logical.ErrorResponse(fmt.Sprintf("invalid auth_type %q", roleEntry.AuthType)), nil
+	}
+
+	if boundIamPrincipalARNRaw, ok := data.GetOk("bound_iam_principal_arn"); ok {
+		roleEntry.BoundIamPrincipalARN = boundIamPrincipalARNRaw.(string)
+	}
+
 	// Set BoundAmiID only if it is supplied. There can't be a default value.
 	if boundAmiIDRaw, ok := data.GetOk("bound_ami_id"); ok {
 		roleEntry.BoundAmiID = boundAmiIDRaw.(string)
@@ -229,14 +267,30 @@ func (b *backend) pathRoleCreateUpdate(
 		roleEntry.BoundIamARN = boundIamARNRaw.(string)
 	}
 
-	// Ensure that at least one bound is set on the role
-	switch {
-	case roleEntry.BoundAccountID != "":
-	case roleEntry.BoundAmiID != "":
-	case roleEntry.BoundIamARN != "":
-	default:
+	switch roleEntry.AuthType {
+	case ec2AuthType:
+		if roleEntry.BoundIamPrincipalARN != "" {
+			return logical.ErrorResponse("bound_iam_principal_arn can only be set on roles of the iam auth type"), nil
+		}
+
+		// Ensure that at least one bound is set on the role
+		switch {
+		case roleEntry.BoundAccountID != "":
+		case roleEntry.BoundAmiID != "":
+		case roleEntry.BoundIamARN != "":
+		default:
 
-		return logical.ErrorResponse("at least be one bound parameter should be specified on the role"), nil
+			return logical.ErrorResponse("at least be one bound parameter should be specified on the role"), nil
+		}
+	case iamAuthType:
+		// The principal is the only bound the caller identity can be
+		// matched against, apart from the account
+		if roleEntry.BoundIamPrincipalARN == "" {
+			return logical.ErrorResponse("bound_iam_principal_arn must be set on roles of the iam auth type"), nil
+		}
+		if roleEntry.BoundAmiID != "" || roleEntry.BoundIamARN != "" {
+			return logical.ErrorResponse("bound_ami_id and bound_iam_role_arn can only be set on roles of the ec2 auth type"), nil
+		}
 	}
 
 	policiesStr, ok := data.GetOk("policies")
@@ -296,6 +350,9 @@ func (b *backend) pathRoleCreateUpdate(
 	}
 
 	roleTagStr, ok := data.GetOk("role_tag")
+	if ok && roleEntry.AuthType == iamAuthType && roleTagStr.(string) != "" {
+		return logical.ErrorResponse("role_tag can only be set on roles of the ec2 auth type"), nil
+	}
 	if ok {
 		roleEntry.RoleTag = roleTagStr.(string)
 		// There is a limit of 127 characters on the tag key for AWS EC2 instances.
@@ -332,6 +389,8 @@ func (b *backend) pathRoleCreateUpdate(
 
 // Struct to hold the information associated with an AMI ID in Vault.
 type awsRoleEntry struct {
+	AuthType                 string        `json:"auth_type" structs:"auth_type" mapstructure:"auth_type"`
+	BoundIamPrincipalARN     string        `json:"bound_iam_principal_arn" structs:"bound_iam_principal_arn" mapstructure:"bound_iam_principal_arn"`
 	BoundAmiID               string        `json:"bound_ami_id" structs:"bound_ami_id" mapstructure:"bound_ami_id"`
 	BoundAccountID           string        `json:"bound_account_id" structs:"bound_account_id" mapstructure:"bound_account_id"`
 	BoundIamARN              string        `json:"bound_iam_role_arn" structs:"bound_iam_role_arn" mapstructure:"bound_iam_role_arn"`
@@ -350,6 +409,11 @@ Create a role and associate policies to it.
 
 const pathRoleDesc = `
 A precondition for login is that a role should be created in the backend.
+Roles of the "ec2" auth type authenticate EC2 instances with their instance
+identity document, while roles of the "iam" auth type authenticate IAM
+principals, such as the roles of Lambda functions and ECS tasks, with a
+signed sts:GetCallerIdentity request.
+
 The login endpoint takes in the role name against which the instance
 should be validated. After authenticating the instance, the authorization
 for the instance to access Vault's resources is determined by the policies
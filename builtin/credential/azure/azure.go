@@ -0,0 +1,198 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/jwtutil"
+)
+
+// computeAPIVersion is the version of the Azure Resource Manager compute
+// API used to look up virtual machines and scale sets
+const computeAPIVersion = "2018-06-01"
+
+// discoveryDoc is the OpenID Connect discovery document of a tenant,
+// limited to the fields used here
+type discoveryDoc struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+// computeResource is a virtual machine or scale set, limited to the fields
+// used here
+type computeResource struct {
+	Location string `json:"location"`
+	Identity *struct {
+		PrincipalID            string `json:"principalId"`
+		UserAssignedIdentities map[string]struct {
+			PrincipalID string `json:"principalId"`
+		} `json:"userAssignedIdentities"`
+	} `json:"identity"`
+}
+
+// hasPrincipal returns whether the given principal is an identity of the
+// resource, either system or user assigned
+func (r *computeResource) hasPrincipal(principalID string) bool {
+	if r.Identity == nil || principalID == "" {
+		return false
+	}
+	if r.Identity.PrincipalID == principalID {
+		return true
+	}
+	for _, identity := range r.Identity.UserAssignedIdentities {
+		if identity.PrincipalID == principalID {
+			return true
+		}
+	}
+	return false
+}
+
+// getJSON decodes the JSON document found at the given URL, sending the
+// given bearer token if any
+func (b *backend) getJSON(url, bearer string, out interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, url)
+	}
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, out); err != nil {
+		return fmt.Errorf("error decoding %s: %s", url, err)
+	}
+	return nil
+}
+
+// providerDiscovery returns the discovery document of the tenant
+func (b *backend) providerDiscovery(config *azureConfig) (*discoveryDoc, error) {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	return b.nonLockedProviderDiscovery(config)
+}
+
+// nonLockedProviderDiscovery returns the discovery document of the tenant,
+// fetching it if it is not cached
+func (b *backend) nonLockedProviderDiscovery(config *azureConfig) (*discoveryDoc, error) {
+	if b.discovery != nil {
+		return b.discovery, nil
+	}
+
+	var doc discoveryDoc
+	wellKnown := fmt.Sprintf("%s/%s/.well-known/openid-configuration", b.loginURL, url.QueryEscape(config.TenantID))
+	if err := b.getJSON(wellKnown, "", &doc); err != nil {
+		return nil, err
+	}
+	if doc.Issuer == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of tenant %q has no issuer or jwks_uri", config.TenantID)
+	}
+	b.discovery = &doc
+	return &doc, nil
+}
+
+// providerKeys returns the keys tokens of the tenant are signed with. Keys
+// are cached until the configuration is written, unless refresh is set.
+func (b *backend) providerKeys(config *azureConfig, refresh bool) ([]*jwtutil.PublicKey, error) {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	if b.cachedKeys != nil && !refresh {
+		return b.cachedKeys, nil
+	}
+
+	discovery, err := b.nonLockedProviderDiscovery(config)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.client.Get(discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, discovery.JWKSURI)
+	}
+	keys, err := jwtutil.ParseJWKS(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %s", discovery.JWKSURI, err)
+	}
+	b.cachedKeys = keys
+	return keys, nil
+}
+
+// resourceManagerToken returns an access token for the Azure Resource
+// Manager API, obtained with the client credentials of the configuration
+func (b *backend) resourceManagerToken(config *azureConfig) (string, error) {
+	if config.ClientID == "" {
+		return "", fmt.Errorf("client_id and client_secret must be configured to look up virtual machines")
+	}
+
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/token", b.loginURL, url.QueryEscape(config.TenantID))
+	resp, err := b.client.PostForm(tokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {config.ClientID},
+		"client_secret": {config.ClientSecret},
+		"resource":      {b.resourceManagerURL + "/"},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d fetching a Resource Manager token", resp.StatusCode)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, &token); err != nil {
+		return "", fmt.Errorf("error decoding the Resource Manager token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no access token found in the response of the tenant")
+	}
+	return token.AccessToken, nil
+}
+
+// lookupCompute looks up the scale set, or the virtual machine if vmssName
+// is empty, with the Azure Resource Manager API. The identity of the
+// instances of a scale set is that of the scale set.
+func (b *backend) lookupCompute(config *azureConfig, subscriptionID, resourceGroup, vmName, vmssName string) (*computeResource, error) {
+	for _, name := range []string{subscriptionID, resourceGroup, vmName, vmssName} {
+		if strings.ContainsAny(name, "/?#") {
+			return nil, fmt.Errorf("invalid resource name %q", name)
+		}
+	}
+
+	token, err := b.resourceManagerToken(config)
+	if err != nil {
+		return nil, err
+	}
+
+	kind, name := "virtualMachineScaleSets", vmssName
+	if vmssName == "" {
+		kind, name = "virtualMachines", vmName
+	}
+	resourceURL := fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/%s/%s?api-version=%s",
+		b.resourceManagerURL, subscriptionID, resourceGroup, kind, name, computeAPIVersion)
+
+	var resource computeResource
+	if err := b.getJSON(resourceURL, token, &resource); err != nil {
+		return nil, err
+	}
+	return &resource, nil
+}
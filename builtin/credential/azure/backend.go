@@ -0,0 +1,104 @@
+package azure
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// defaultLoginURL is the base URL of Azure Active Directory
+	defaultLoginURL = "https://login.microsoftonline.com"
+
+	// defaultResourceManagerURL is the base URL of the Azure Resource
+	// Manager API
+	defaultResourceManagerURL = "https://management.azure.com"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+type backend struct {
+	*framework.Backend
+
+	// Lock to make changes to the backend's configuration
+	configMutex sync.RWMutex
+
+	// Lock to make changes to role entries
+	roleMutex sync.RWMutex
+
+	// Lock protecting the cached provider details and keys
+	cacheMutex sync.Mutex
+
+	// discovery is the cached discovery document of the tenant, and
+	// cachedKeys the keys tokens are signed with. Both are reset when the
+	// configuration is written.
+	discovery  *discoveryDoc
+	cachedKeys []*jwtutil.PublicKey
+
+	client *http.Client
+
+	// The base URLs of the Azure APIs, and the current time. They are
+	// replaced in tests.
+	loginURL           string
+	resourceManagerURL string
+	now                func() time.Time
+}
+
+func Backend() *backend {
+	b := &backend{
+		client:             cleanhttp.DefaultClient(),
+		loginURL:           defaultLoginURL,
+		resourceManagerURL: defaultResourceManagerURL,
+		now:                time.Now,
+	}
+
+	b.Backend = &framework.Backend{
+		AuthRenew: b.pathLoginRenew,
+		Help:      backendHelp,
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathRole(b),
+			pathListRoles(b),
+			pathLogin(b),
+		},
+	}
+
+	return b
+}
+
+// resetCache drops the cached provider details and keys, so that they are
+// fetched again with the current configuration
+func (b *backend) resetCache() {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	b.discovery = nil
+	b.cachedKeys = nil
+}
+
+const backendHelp = `
+The Azure credential provider allows Azure virtual machines to authenticate
+with the access token of their Managed Service Identity.
+
+The token is verified with the keys of the Azure Active Directory tenant.
+The virtual machine, or scale set, named at login is then looked up with
+the Azure Resource Manager API, and must have the identity of the token.
+Its subscription, resource group and location are matched against the
+bounds of a role, which determines the policies of the issued token.
+
+After enabling the credential provider, use the "config" route to configure
+the tenant and the credentials used to reach the Azure Resource Manager
+API, and the "role" route to create roles.
+`
@@ -0,0 +1,325 @@
+package azure
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testTenant       = "tenant"
+	testResource     = "https://management.azure.com/"
+	testPrincipalID  = "principal"
+	testVMPath       = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachines/web-1"
+	testScaleSetPath = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/web"
+)
+
+// testAzure serves the endpoints of Azure Active Directory and of the
+// Azure Resource Manager API
+type testAzure struct {
+	t         *testing.T
+	server    *httptest.Server
+	keys      map[string]*rsa.PrivateKey
+	resources map[string]interface{}
+}
+
+func (a *testAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/" + testTenant + "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(&discoveryDoc{
+			Issuer:  "https://sts.windows.net/" + testTenant + "/",
+			JWKSURI: a.server.URL + "/keys",
+		})
+	case "/keys":
+		w.Write(jwtutil.TestJWKS(a.t, a.keys))
+	case "/" + testTenant + "/oauth2/token":
+		if r.FormValue("client_id") != "vault" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "arm-token"})
+	default:
+		resource, ok := a.resources[r.URL.Path]
+		if !ok || r.Header.Get("Authorization") != "Bearer arm-token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(resource)
+	}
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage, *testAzure, *rsa.PrivateKey) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	azure := &testAzure{
+		t:    t,
+		keys: map[string]*rsa.PrivateKey{"1": key},
+		resources: map[string]interface{}{
+			testVMPath: map[string]interface{}{
+				"location": "westus",
+				"identity": map[string]interface{}{"principalId": testPrincipalID},
+			},
+			testScaleSetPath: map[string]interface{}{
+				"location": "eastus",
+				"identity": map[string]interface{}{
+					"principalId": "other",
+					"userAssignedIdentities": map[string]interface{}{
+						"/subscriptions/sub/identity": map[string]interface{}{"principalId": testPrincipalID},
+					},
+				},
+			},
+		},
+	}
+	azure.server = httptest.NewServer(azure)
+
+	b := Backend()
+	b.loginURL = azure.server.URL
+	b.resourceManagerURL = azure.server.URL
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView, azure, key
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func testClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":    "https://sts.windows.net/" + testTenant + "/",
+		"aud":    testResource,
+		"oid":    testPrincipalID,
+		"groups": []string{"group-1"},
+		"iat":    now.Unix(),
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestBackend_Config(t *testing.T) {
+	b, storage, _, _ := createBackendWithStorage(t)
+
+	for _, data := range []map[string]interface{}{
+		{"resource": testResource},
+		{"tenant_id": testTenant},
+		{"tenant_id": testTenant, "resource": testResource, "client_id": "vault"},
+	} {
+		resp := testWrite(t, b, storage, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "config", map[string]interface{}{
+		"tenant_id":     testTenant,
+		"resource":      testResource,
+		"client_id":     "vault",
+		"client_secret": "secret",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["tenant_id"] != testTenant || resp.Data["client_id"] != "vault" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["client_secret"]; ok {
+		t.Fatalf("client_secret should not be returned")
+	}
+}
+
+func TestBackend_Role(t *testing.T) {
+	b, storage, _, _ := createBackendWithStorage(t)
+
+	resp := testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"policies": "web",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	resp = testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_resource_groups": "rg",
+		"policies":              "web",
+		"ttl":                   60,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/web",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if groups := resp.Data["bound_resource_groups"].([]string); len(groups) != 1 || groups[0] != "rg" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["ttl"] != time.Duration(60) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage, azure, key := createBackendWithStorage(t)
+
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"tenant_id":     testTenant,
+		"resource":      testResource,
+		"client_id":     "vault",
+		"client_secret": "secret",
+	})
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_service_principal_ids": testPrincipalID,
+		"bound_group_ids":             "group-1,group-2",
+		"policies":                    "web",
+	})
+	testWrite(t, b, storage, "role/machine", map[string]interface{}{
+		"bound_subscription_ids": "sub",
+		"bound_resource_groups":  "rg",
+		"bound_locations":        "westus,eastus",
+		"policies":               "web",
+	})
+
+	login := func(role string, claims map[string]interface{}, vm map[string]interface{}) *logical.Response {
+		data := map[string]interface{}{
+			"role": role,
+			"jwt":  jwtutil.TestSign(t, key, "1", claims),
+		}
+		for k, v := range vm {
+			data[k] = v
+		}
+		return testWrite(t, b, storage, "login", data)
+	}
+
+	resp := login("web", testClaims(), nil)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["principal_id"] != testPrincipalID {
+		t.Fatalf("bad auth: %#v", resp.Auth)
+	}
+
+	// Renewals check the role again
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      resp.Auth,
+	}
+	renewReq.Auth.IssueTime = time.Now()
+	if _, err := b.pathLoginRenew(renewReq, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_group_ids": "group-2",
+	})
+	if _, err := b.pathLoginRenew(renewReq, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	vm := map[string]interface{}{
+		"subscription_id":     "sub",
+		"resource_group_name": "rg",
+		"vm_name":             "web-1",
+	}
+	resp = login("machine", testClaims(), vm)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["location"] != "westus" || resp.Auth.DisplayName != "web-1" {
+		t.Fatalf("bad auth: %#v", resp.Auth)
+	}
+
+	// The identity of a scale set can be user assigned
+	scaleSet := map[string]interface{}{
+		"subscription_id":     "sub",
+		"resource_group_name": "rg",
+		"vmss_name":           "web",
+	}
+	resp = login("machine", testClaims(), scaleSet)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["location"] != "eastus" {
+		t.Fatalf("bad auth: %#v", resp.Auth)
+	}
+
+	otherPrincipal := testClaims()
+	otherPrincipal["oid"] = "other-principal"
+	otherIssuer := testClaims()
+	otherIssuer["iss"] = "https://sts.windows.net/other/"
+	otherAudience := testClaims()
+	otherAudience["aud"] = "https://vault.example.com"
+	expired := testClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	for _, c := range []struct {
+		role   string
+		claims map[string]interface{}
+		vm     map[string]interface{}
+	}{
+		{"web", testClaims(), nil},
+		{"machine", testClaims(), nil},
+		{"machine", otherPrincipal, vm},
+		{"machine", otherIssuer, vm},
+		{"machine", otherAudience, vm},
+		{"machine", expired, vm},
+		{"machine", testClaims(), map[string]interface{}{"vm_name": "web-1"}},
+		{"machine", testClaims(), map[string]interface{}{"subscription_id": "sub", "resource_group_name": "rg", "vm_name": "web-2"}},
+	} {
+		if resp := login(c.role, c.claims, c.vm); resp == nil || !resp.IsError() {
+			t.Fatalf("%s %v %v: expected an error: %#v", c.role, c.claims, c.vm, resp)
+		}
+	}
+
+	// Rotated keys are fetched again
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	azure.keys = map[string]*rsa.PrivateKey{"2": newKey}
+	resp = testWrite(t, b, storage, "login", map[string]interface{}{
+		"role":                "machine",
+		"jwt":                 jwtutil.TestSign(t, newKey, "2", testClaims()),
+		"subscription_id":     "sub",
+		"resource_group_name": "rg",
+		"vm_name":             "web-1",
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
@@ -0,0 +1,175 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"tenant_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The ID of the Azure Active Directory tenant issuing the tokens.",
+			},
+
+			"resource": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The resource the tokens must be issued for, which is their audience.",
+			},
+
+			"client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The client ID of the service principal used to query the Azure Resource Manager API.",
+			},
+
+			"client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The client secret of the service principal used to query the Azure Resource Manager API.",
+			},
+		},
+
+		ExistenceCheck: b.pathConfigExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConfigWrite,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathConfigExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+// lockedConfig returns the configuration of the backend, after acquiring
+// the configuration lock
+func (b *backend) lockedConfig(s logical.Storage) (*azureConfig, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	return b.nonLockedConfig(s)
+}
+
+// nonLockedConfig returns the configuration of the backend
+func (b *backend) nonLockedConfig(s logical.Storage) (*azureConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result azureConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The client secret is a credential, so it is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"tenant_id": config.TenantID,
+			"resource":  config.Resource,
+			"client_id": config.ClientID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	config, err := b.nonLockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &azureConfig{}
+	}
+
+	if tenantIDRaw, ok := data.GetOk("tenant_id"); ok {
+		config.TenantID = tenantIDRaw.(string)
+	}
+	if resourceRaw, ok := data.GetOk("resource"); ok {
+		config.Resource = resourceRaw.(string)
+	}
+	if clientIDRaw, ok := data.GetOk("client_id"); ok {
+		config.ClientID = clientIDRaw.(string)
+	}
+	if clientSecretRaw, ok := data.GetOk("client_secret"); ok {
+		config.ClientSecret = clientSecretRaw.(string)
+	}
+
+	if config.TenantID == "" {
+		return logical.ErrorResponse("tenant_id must be set"), nil
+	}
+	if config.Resource == "" {
+		return logical.ErrorResponse("resource must be set"), nil
+	}
+	if (config.ClientID == "") != (config.ClientSecret == "") {
+		return logical.ErrorResponse("client_id and client_secret must be set together"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetCache()
+
+	return nil, nil
+}
+
+// azureConfig holds the tenant tokens are issued by, and the credentials
+// used to query the Azure Resource Manager API
+type azureConfig struct {
+	TenantID     string `json:"tenant_id"`
+	Resource     string `json:"resource"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+const pathConfigHelpSyn = `
+Configures the Azure tenant and the credentials of the backend.
+`
+
+const pathConfigHelpDesc = `
+Tokens must be issued by the Azure Active Directory tenant 'tenant_id', for
+the resource 'resource'.
+
+The virtual machines and scale sets named at login are looked up with the
+Azure Resource Manager API, using the service principal 'client_id' and
+'client_secret'. It must be allowed to read the virtual machines and scale
+sets of the subscriptions logins are made from.
+`
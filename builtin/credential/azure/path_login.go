@@ -0,0 +1,279 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role against which the login is being attempted.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The access token of the Managed Service Identity of the virtual machine.",
+			},
+			"subscription_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The subscription of the virtual machine.",
+			},
+			"resource_group_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The resource group of the virtual machine.",
+			},
+			"vm_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the virtual machine.",
+			},
+			"vmss_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The name of the scale set the virtual machine belongs to.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+// azureEntity holds the details of the identity logging in. The details of
+// the virtual machine are only set when it was looked up.
+type azureEntity struct {
+	PrincipalID    string
+	GroupIDs       []string
+	SubscriptionID string
+	ResourceGroup  string
+	VMName         string
+	ScaleSet       string
+	Location       string
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	rawJWT := data.Get("jwt").(string)
+	if rawJWT == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("configure the azure credential backend first"), nil
+	}
+
+	token, err := b.verifyJWT(config, rawJWT)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	principalID, _ := token.StringClaim("oid")
+	if principalID == "" {
+		return logical.ErrorResponse("token has no oid claim"), nil
+	}
+	entity := &azureEntity{
+		PrincipalID: principalID,
+		GroupIDs:    token.StringsClaim("groups"),
+	}
+
+	// The virtual machine named at login is only trusted once it is found
+	// to have the identity of the token
+	vmName := data.Get("vm_name").(string)
+	vmssName := data.Get("vmss_name").(string)
+	if vmName != "" || vmssName != "" {
+		entity.SubscriptionID = data.Get("subscription_id").(string)
+		entity.ResourceGroup = data.Get("resource_group_name").(string)
+		entity.VMName = vmName
+		entity.ScaleSet = vmssName
+		if entity.SubscriptionID == "" || entity.ResourceGroup == "" {
+			return logical.ErrorResponse("subscription_id and resource_group_name must be given along with vm_name or vmss_name"), nil
+		}
+
+		resource, err := b.lookupCompute(config, entity.SubscriptionID, entity.ResourceGroup, vmName, vmssName)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error looking up the virtual machine: %s", err)), nil
+		}
+		if !resource.hasPrincipal(principalID) {
+			return logical.ErrorResponse("the identity of the token does not belong to the virtual machine"), nil
+		}
+		entity.Location = resource.Location
+	} else if role.requiresCompute() {
+		return logical.ErrorResponse("vm_name or vmss_name must be given to login with this role"), nil
+	}
+
+	if err := role.validate(entity); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	ttl, _, err := b.SanitizeTTL(role.TTL, role.MaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.Period > time.Duration(0) {
+		ttl = role.Period
+	}
+
+	displayName := principalID
+	if vmName != "" {
+		displayName = vmName
+	} else if vmssName != "" {
+		displayName = vmssName
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Period: role.Period,
+			InternalData: map[string]interface{}{
+				"role":      roleName,
+				"group_ids": strings.Join(entity.GroupIDs, ","),
+			},
+			Policies: role.Policies,
+			Metadata: map[string]string{
+				"role":                roleName,
+				"principal_id":        entity.PrincipalID,
+				"subscription_id":     entity.SubscriptionID,
+				"resource_group_name": entity.ResourceGroup,
+				"vm_name":             entity.VMName,
+				"vmss_name":           entity.ScaleSet,
+				"location":            entity.Location,
+			},
+			DisplayName: displayName,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       ttl,
+				Renewable: true,
+			},
+		},
+	}, nil
+}
+
+// verifyJWT parses the given token, and checks its signature, times, issuer
+// and audience according to the configuration
+func (b *backend) verifyJWT(config *azureConfig, rawJWT string) (*jwtutil.JWT, error) {
+	token, err := jwtutil.Parse(rawJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := b.providerKeys(config, false)
+	if err != nil {
+		return nil, err
+	}
+	// Azure rotates its keys, so they are fetched again if the token names
+	// a key that is not known
+	if err := token.Verify(keys); err != nil {
+		if token.Header.Kid == "" || jwtutil.HasKeyID(keys, token.Header.Kid) {
+			return nil, err
+		}
+		if keys, err = b.providerKeys(config, true); err != nil {
+			return nil, err
+		}
+		if err := token.Verify(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := token.ValidateTimes(b.now()); err != nil {
+		return nil, err
+	}
+	discovery, err := b.providerDiscovery(config)
+	if err != nil {
+		return nil, err
+	}
+	if issuer, _ := token.StringClaim("iss"); issuer != discovery.Issuer {
+		return nil, fmt.Errorf("token issuer %q is not the configured tenant", issuer)
+	}
+	if !strutil.StrListContains(token.StringsClaim("aud"), config.Resource) {
+		return nil, fmt.Errorf("token audience does not contain the configured resource")
+	}
+	return token, nil
+}
+
+// Invoked when the token issued by this backend is attempting a renewal.
+func (b *backend) pathLoginRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, ok := req.Auth.InternalData["role"].(string)
+	if !ok || roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// Ensure that the role still exists and allows the entity
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	groupIDs, _ := req.Auth.InternalData["group_ids"].(string)
+	entity := &azureEntity{
+		PrincipalID:    req.Auth.Metadata["principal_id"],
+		GroupIDs:       strutil.ParseStringSlice(groupIDs, ","),
+		SubscriptionID: req.Auth.Metadata["subscription_id"],
+		ResourceGroup:  req.Auth.Metadata["resource_group_name"],
+		VMName:         req.Auth.Metadata["vm_name"],
+		ScaleSet:       req.Auth.Metadata["vmss_name"],
+		Location:       req.Auth.Metadata["location"],
+	}
+	if err := role.validate(entity); err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies on role %s have changed, cannot renew", roleName)
+	}
+
+	// If 'Period' is set on the role, the token should never expire.
+	// Replenish the TTL with 'Period's value.
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, data)
+}
+
+const pathLoginHelpSyn = `
+Authenticates Azure virtual machines with Vault.
+`
+
+const pathLoginHelpDesc = `
+A virtual machine logs in by presenting the access token of its Managed
+Service Identity, obtained from the identity endpoint of the instance
+metadata service for the configured resource, along with the name of a
+role.
+
+If the role binds subscriptions, resource groups, locations or scale sets,
+the 'subscription_id', 'resource_group_name' and 'vm_name' or 'vmss_name'
+of the virtual machine must also be given. The virtual machine or scale set
+is looked up, and must have the identity of the token.
+`
@@ -0,0 +1,354 @@
+package azure
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"bound_service_principal_ids": {
+				Type: framework.TypeString,
+				Description: `Comma separated list of the IDs of the service principals, such as
+managed identities, allowed to login with this role.`,
+			},
+			"bound_group_ids": {
+				Type:        framework.TypeString,
+				Description: "Comma separated list of the IDs of the groups allowed to login with this role.",
+			},
+			"bound_subscription_ids": {
+				Type:        framework.TypeString,
+				Description: "Comma separated list of the subscriptions allowed to login with this role.",
+			},
+			"bound_resource_groups": {
+				Type:        framework.TypeString,
+				Description: "Comma separated list of the resource groups allowed to login with this role.",
+			},
+			"bound_locations": {
+				Type:        framework.TypeString,
+				Description: "Comma separated list of the locations allowed to login with this role.",
+			},
+			"bound_scale_sets": {
+				Type:        framework.TypeString,
+				Description: "Comma separated list of the scale sets allowed to login with this role.",
+			},
+			"policies": {
+				Type:        framework.TypeString,
+				Default:     "default",
+				Description: "Policies to be set on tokens issued using this role.",
+			},
+			"ttl": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `Duration in seconds after which the issued token should expire. Defaults
+to 0, in which case the value will fallback to the system/mount defaults.`,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Default:     0,
+				Description: "The maximum allowed lifetime of tokens issued using this role.",
+			},
+			"period": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `If set, indicates that the token generated using this role should never
+expire. The token should be renewed within the duration specified by this
+value. At each renewal, the token's TTL will be set to the value of this
+parameter.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathListRolesHelpSyn,
+		HelpDescription: pathListRolesHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathRoleExistenceCheck(req *logical.Request, data *framework.FieldData) (bool, error) {
+	entry, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return false, err
+	}
+	return entry != nil, nil
+}
+
+// lockedRole returns the role with the given name, after acquiring the
+// role lock
+func (b *backend) lockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	return b.nonLockedRole(s, roleName)
+}
+
+// nonLockedRole returns the role with the given name
+func (b *backend) nonLockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	return nil, req.Storage.Delete("role/" + strings.ToLower(roleName))
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	respData := structs.New(role).Map()
+
+	// Display the durations in seconds
+	respData["ttl"] = role.TTL / time.Second
+	respData["max_ttl"] = role.MaxTTL / time.Second
+	respData["period"] = role.Period / time.Second
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(data.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	role, err := b.nonLockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	newRole := role == nil
+	if newRole {
+		role = &roleEntry{}
+	}
+
+	if principalIDsRaw, ok := data.GetOk("bound_service_principal_ids"); ok {
+		role.BoundServicePrincipalIDs = strutil.ParseDedupAndSortStrings(principalIDsRaw.(string), ",")
+	}
+	if groupIDsRaw, ok := data.GetOk("bound_group_ids"); ok {
+		role.BoundGroupIDs = strutil.ParseDedupAndSortStrings(groupIDsRaw.(string), ",")
+	}
+	if subscriptionIDsRaw, ok := data.GetOk("bound_subscription_ids"); ok {
+		role.BoundSubscriptionIDs = strutil.ParseDedupAndSortStrings(subscriptionIDsRaw.(string), ",")
+	}
+	if resourceGroupsRaw, ok := data.GetOk("bound_resource_groups"); ok {
+		role.BoundResourceGroups = strutil.ParseDedupAndSortStrings(resourceGroupsRaw.(string), ",")
+	}
+	if locationsRaw, ok := data.GetOk("bound_locations"); ok {
+		role.BoundLocations = strutil.ParseDedupAndSortStrings(locationsRaw.(string), ",")
+	}
+	if scaleSetsRaw, ok := data.GetOk("bound_scale_sets"); ok {
+		role.BoundScaleSets = strutil.ParseDedupAndSortStrings(scaleSetsRaw.(string), ",")
+	}
+
+	// Roles must be bound, so that any identity of the tenant cannot login
+	if len(role.BoundServicePrincipalIDs) == 0 && len(role.BoundGroupIDs) == 0 &&
+		len(role.BoundSubscriptionIDs) == 0 && len(role.BoundResourceGroups) == 0 &&
+		len(role.BoundLocations) == 0 && len(role.BoundScaleSets) == 0 {
+		return logical.ErrorResponse("at least one bound must be set"), nil
+	}
+
+	if policiesRaw, ok := data.GetOk("policies"); ok {
+		role.Policies = policyutil.ParsePolicies(policiesRaw.(string))
+	} else if newRole {
+		role.Policies = policyutil.ParsePolicies(data.Get("policies").(string))
+	}
+
+	var resp logical.Response
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttlRaw.(int)) * time.Second
+		if defaultLeaseTTL := b.System().DefaultLeaseTTL(); role.TTL > defaultLeaseTTL {
+			resp.AddWarning(fmt.Sprintf("Given ttl of %d seconds greater than current mount/system default of %d seconds; ttl will be capped at login time", role.TTL/time.Second, defaultLeaseTTL/time.Second))
+		}
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+		if systemMaxTTL := b.System().MaxLeaseTTL(); role.MaxTTL > systemMaxTTL {
+			resp.AddWarning(fmt.Sprintf("Given max_ttl of %d seconds greater than current mount/system default of %d seconds; max_ttl will be capped at login time", role.MaxTTL/time.Second, systemMaxTTL/time.Second))
+		}
+	}
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("ttl and max_ttl cannot be negative"), nil
+	}
+	if role.MaxTTL != 0 && role.MaxTTL < role.TTL {
+		return logical.ErrorResponse("ttl should be shorter than max_ttl"), nil
+	}
+
+	if periodRaw, ok := data.GetOk("period"); ok {
+		role.Period = time.Duration(periodRaw.(int)) * time.Second
+		if role.Period > b.System().MaxLeaseTTL() {
+			return logical.ErrorResponse(fmt.Sprintf("period of %d seconds is greater than the backend's maximum TTL of %d seconds", role.Period/time.Second, b.System().MaxLeaseTTL()/time.Second)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Warnings()) == 0 {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// roleEntry binds Azure identities and virtual machines to the policies of
+// the tokens they are issued
+type roleEntry struct {
+	BoundServicePrincipalIDs []string      `json:"bound_service_principal_ids" structs:"bound_service_principal_ids" mapstructure:"bound_service_principal_ids"`
+	BoundGroupIDs            []string      `json:"bound_group_ids" structs:"bound_group_ids" mapstructure:"bound_group_ids"`
+	BoundSubscriptionIDs     []string      `json:"bound_subscription_ids" structs:"bound_subscription_ids" mapstructure:"bound_subscription_ids"`
+	BoundResourceGroups      []string      `json:"bound_resource_groups" structs:"bound_resource_groups" mapstructure:"bound_resource_groups"`
+	BoundLocations           []string      `json:"bound_locations" structs:"bound_locations" mapstructure:"bound_locations"`
+	BoundScaleSets           []string      `json:"bound_scale_sets" structs:"bound_scale_sets" mapstructure:"bound_scale_sets"`
+	Policies                 []string      `json:"policies" structs:"policies" mapstructure:"policies"`
+	TTL                      time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
+	MaxTTL                   time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	Period                   time.Duration `json:"period" structs:"period" mapstructure:"period"`
+}
+
+// requiresCompute returns whether the role binds the virtual machine, which
+// then has to be looked up at login
+func (r *roleEntry) requiresCompute() bool {
+	return len(r.BoundSubscriptionIDs) != 0 || len(r.BoundResourceGroups) != 0 ||
+		len(r.BoundLocations) != 0 || len(r.BoundScaleSets) != 0
+}
+
+// validate checks the details of an entity against the bounds of the role
+func (r *roleEntry) validate(entity *azureEntity) error {
+	if len(r.BoundServicePrincipalIDs) != 0 && !strutil.StrListContains(r.BoundServicePrincipalIDs, entity.PrincipalID) {
+		return fmt.Errorf("service principal %q is not bound to the role", entity.PrincipalID)
+	}
+	if len(r.BoundGroupIDs) != 0 && !anyContained(entity.GroupIDs, r.BoundGroupIDs) {
+		return fmt.Errorf("groups of service principal %q are not bound to the role", entity.PrincipalID)
+	}
+	if len(r.BoundSubscriptionIDs) != 0 && !strutil.StrListContains(r.BoundSubscriptionIDs, entity.SubscriptionID) {
+		return fmt.Errorf("subscription %q is not bound to the role", entity.SubscriptionID)
+	}
+	if len(r.BoundResourceGroups) != 0 && !strutil.StrListContains(r.BoundResourceGroups, entity.ResourceGroup) {
+		return fmt.Errorf("resource group %q is not bound to the role", entity.ResourceGroup)
+	}
+	if len(r.BoundLocations) != 0 && !strutil.StrListContains(r.BoundLocations, entity.Location) {
+		return fmt.Errorf("location %q is not bound to the role", entity.Location)
+	}
+	if len(r.BoundScaleSets) != 0 && !strutil.StrListContains(r.BoundScaleSets, entity.ScaleSet) {
+		return fmt.Errorf("scale set %q is not bound to the role", entity.ScaleSet)
+	}
+	return nil
+}
+
+// anyContained returns whether any of the values is in the list
+func anyContained(values, list []string) bool {
+	for _, value := range values {
+		if strutil.StrListContains(list, value) {
+			return true
+		}
+	}
+	return false
+}
+
+const pathRoleHelpSyn = `
+Create a role binding Azure identities to policies.
+`
+
+const pathRoleHelpDesc = `
+A role binds Azure identities to the policies of the tokens they are issued
+at login. The login endpoint takes the name of the role along with the
+access token of the identity.
+
+At least one of the bounds must be set. The service principal and group
+bounds are checked against the claims of the token. The subscription,
+resource group, location and scale set bounds are checked against the
+virtual machine or scale set named at login, which must then have the
+identity of the token.
+`
+
+const pathListRolesHelpSyn = `
+Lists all the roles that are registered with Vault.
+`
+
+const pathListRolesHelpDesc = `
+Roles will be listed by their respective role names.
+`
@@ -1,7 +1,11 @@
 package cert
 
 import (
+	"net/http"
 	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -36,10 +40,13 @@ func Backend() *backend {
 		}),
 
 		AuthRenew: b.pathLoginRenew,
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.crls = map[string]CRLInfo{}
 	b.crlUpdateMutex = &sync.RWMutex{}
+	b.client = cleanhttp.DefaultClient()
 
 	return &b
 }
@@ -50,6 +57,15 @@ type backend struct {
 
 	crls           map[string]CRLInfo
 	crlUpdateMutex *sync.RWMutex
+
+	// client is used to fetch CRLs and to query OCSP responders
+	client *http.Client
+}
+
+// periodicFunc refreshes the CRLs fetched from a URL once their refresh
+// interval has elapsed
+func (b *backend) periodicFunc(req *logical.Request) error {
+	return b.refreshCRLs(req.Storage, time.Now())
 }
 
 const backendHelp = `
@@ -1,9 +1,21 @@
 package cert
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 	"time"
@@ -799,3 +811,340 @@ func Test_Renew(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestBackend_CRLURL(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	lb, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := lb.(*backend)
+
+	issuedCRL, err := ioutil.ReadFile(testIssuedCertCRL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	served := issuedCRL
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if served == nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write(served)
+	}))
+	defer server.Close()
+
+	clientCA1, err := ioutil.ReadFile(testRootCACertPath1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "certs/cert1",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"certificate": clientCA1,
+			"policies":    "abc",
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	crlReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		Path:      "crls/issuedcrl",
+		Data: map[string]interface{}{
+			"crl": issuedCRL,
+			"url": server.URL,
+		},
+	}
+	resp, err = b.HandleRequest(crlReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error with both crl and url set")
+	}
+
+	crlReq.Data = map[string]interface{}{
+		"url": server.URL,
+	}
+	resp, err = b.HandleRequest(crlReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	connState := connectionState(t, serverCAPath, serverCertPath, serverKeyPath, testCertPath1, testKeyPath1)
+	loginReq := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Storage:   storage,
+		Path:      "login",
+		Connection: &logical.Connection{
+			ConnState: &connState,
+		},
+	}
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected failure due to revoked certificate")
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Storage:   storage,
+		Path:      "crls/issuedcrl",
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["url"] != server.URL || resp.Data["refresh_interval"] != time.Duration(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A CRL that cannot be fetched stays in effect
+	served = nil
+	if err := b.refreshCRLs(storage, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected failure due to revoked certificate")
+	}
+
+	// Serve a CRL which does not revoke the certificate; it is only picked up
+	// once the refresh interval elapsed
+	served, err = ioutil.ReadFile(testRootCertCRL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.refreshCRLs(storage, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected failure due to revoked certificate")
+	}
+
+	if err := b.refreshCRLs(storage, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = b.HandleRequest(loginReq)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+}
+
+// testOCSPResponder answers OCSP requests for certificates issued by its CA
+// with the status registered for their serial
+type testOCSPResponder struct {
+	t      *testing.T
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	status map[string]int
+}
+
+func (o *testOCSPResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	var req ocspRequest
+	if _, err := asn1.Unmarshal(body, &req); err != nil {
+		o.t.Fatal(err)
+	}
+	certID := req.TBSRequest.RequestList[0].Cert
+
+	now := time.Now()
+	single := ocspSingleResponse{
+		CertID:     certID,
+		ThisUpdate: now.Add(-time.Minute),
+		NextUpdate: now.Add(time.Hour),
+	}
+	status, ok := o.status[certID.SerialNumber.String()]
+	switch {
+	case ok && status == ocspGood:
+		single.Good = true
+	case ok && status == ocspRevoked:
+		single.Revoked = ocspRevokedInfo{RevocationTime: now.Add(-time.Hour)}
+	default:
+		single.Unknown = true
+	}
+
+	tbs, err := asn1.Marshal(ocspResponseData{
+		ResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, IsCompound: true, Bytes: o.ca.RawSubject},
+		ProducedAt:  now,
+		Responses:   []ocspSingleResponse{single},
+	})
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := o.caKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    ocspResponseData{Raw: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	})
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	resp, err := asn1.Marshal(ocspResponse{
+		ResponseBytes: ocspResponseBytes{
+			ResponseType: oidOCSPBasicResponse,
+			Response:     basic,
+		},
+	})
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	w.Write(resp)
+}
+
+func TestBackend_OCSP(t *testing.T) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OCSP CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responder := &testOCSPResponder{
+		t:      t,
+		ca:     ca,
+		caKey:  caKey,
+		status: map[string]int{"2": ocspGood, "3": ocspRevoked},
+	}
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	clientCert := func(serial int64) *tls.ConnectionState {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "client"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			OCSPServer:   []string{server.URL},
+		}, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	}
+
+	b := testFactory(t)
+	storage := &logical.InmemStorage{}
+	writeCA := func(data map[string]interface{}) {
+		data["certificate"] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}))
+		data["policies"] = "foo"
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "certs/ocsp",
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+	}
+	login := func(connState *tls.ConnectionState) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "login",
+			Storage:    storage,
+			Connection: &logical.Connection{ConnState: connState},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	good, revoked, unknown := clientCert(2), clientCert(3), clientCert(4)
+
+	// Without OCSP, the revoked certificate is allowed
+	writeCA(map[string]interface{}{})
+	if resp := login(revoked); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	writeCA(map[string]interface{}{"ocsp_enabled": true})
+	if resp := login(good); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	for _, connState := range []*tls.ConnectionState{revoked, unknown} {
+		if resp := login(connState); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %#v", resp)
+		}
+	}
+
+	// An unreachable responder denies logins, unless failing open
+	writeCA(map[string]interface{}{
+		"ocsp_enabled":          true,
+		"ocsp_servers_override": "http://127.0.0.1:0",
+	})
+	if resp := login(good); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	writeCA(map[string]interface{}{
+		"ocsp_enabled":          true,
+		"ocsp_servers_override": "http://127.0.0.1:0," + server.URL,
+		"ocsp_fail_open":        true,
+	})
+	if resp := login(unknown); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := login(revoked); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// Responses signed by another key are rejected
+	responder.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCA(map[string]interface{}{"ocsp_enabled": true})
+	if resp := login(good); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
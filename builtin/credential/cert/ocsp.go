@@ -0,0 +1,291 @@
+package cert
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// The status of a certificate as reported by an OCSP responder
+const (
+	ocspGood = iota
+	ocspRevoked
+	ocspUnknown
+)
+
+// maxOCSPResponseSize bounds the size of the responses read from OCSP
+// responders
+const maxOCSPResponseSize = 1024 * 1024
+
+var (
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// ocspSignatureAlgorithms maps the signature algorithms OCSP responses may
+// be signed with to their x509 counterpart
+var ocspSignatureAlgorithms = []struct {
+	oid       asn1.ObjectIdentifier
+	algorithm x509.SignatureAlgorithm
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, x509.SHA1WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, x509.SHA256WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, x509.SHA384WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, x509.SHA512WithRSA},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, x509.ECDSAWithSHA1},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, x509.ECDSAWithSHA256},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, x509.ECDSAWithSHA384},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, x509.ECDSAWithSHA512},
+}
+
+// The structures below are those of RFC 6960, limited to the fields used
+// here
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspTBSRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []ocspSingleRequest
+}
+
+type ocspSingleRequest struct {
+	Cert ocspCertID
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    ocspResponseData
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Raw         asn1.RawContent
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// newOCSPCertID returns the identifier of the certificate issued by issuer
+// with the given serial, using the given hash
+func newOCSPCertID(hash crypto.Hash, issuer *x509.Certificate, serial *big.Int) (*ocspCertID, error) {
+	var hashOID asn1.ObjectIdentifier
+	switch hash {
+	case crypto.SHA1:
+		hashOID = oidSHA1
+	case crypto.SHA256:
+		hashOID = oidSHA256
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm")
+	}
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return nil, err
+	}
+
+	nameHash := hash.New()
+	nameHash.Write(issuer.RawSubject)
+	keyHash := hash.New()
+	keyHash.Write(publicKeyInfo.PublicKey.RightAlign())
+
+	return &ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: hashOID, Parameters: asn1.NullRawValue},
+		NameHash:      nameHash.Sum(nil),
+		IssuerKeyHash: keyHash.Sum(nil),
+		SerialNumber:  serial,
+	}, nil
+}
+
+// matches returns whether the identifier names the certificate issued by
+// issuer with the given serial
+func (id *ocspCertID) matches(issuer *x509.Certificate, serial *big.Int) bool {
+	var hash crypto.Hash
+	switch {
+	case id.HashAlgorithm.Algorithm.Equal(oidSHA1):
+		hash = crypto.SHA1
+	case id.HashAlgorithm.Algorithm.Equal(oidSHA256):
+		hash = crypto.SHA256
+	default:
+		return false
+	}
+
+	expected, err := newOCSPCertID(hash, issuer, serial)
+	if err != nil {
+		return false
+	}
+	return id.SerialNumber != nil && id.SerialNumber.Cmp(serial) == 0 &&
+		bytes.Equal(id.NameHash, expected.NameHash) &&
+		bytes.Equal(id.IssuerKeyHash, expected.IssuerKeyHash)
+}
+
+// queryOCSP asks the OCSP responder at the given URL for the status of the
+// certificate, which must have been issued by issuer
+func (b *backend) queryOCSP(server string, cert, issuer *x509.Certificate) (int, error) {
+	certID, err := newOCSPCertID(crypto.SHA1, issuer, cert.SerialNumber)
+	if err != nil {
+		return ocspUnknown, err
+	}
+	reqBytes, err := asn1.Marshal(ocspRequest{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspSingleRequest{{Cert: *certID}},
+		},
+	})
+	if err != nil {
+		return ocspUnknown, err
+	}
+
+	httpReq, err := http.NewRequest("POST", server, bytes.NewReader(reqBytes))
+	if err != nil {
+		return ocspUnknown, err
+	}
+	httpReq.Header.Set("Content-Type", "application/ocsp-request")
+	httpReq.Header.Set("Accept", "application/ocsp-response")
+
+	resp, err := b.client.Do(httpReq)
+	if err != nil {
+		return ocspUnknown, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return ocspUnknown, fmt.Errorf("unexpected status code %d from OCSP responder %s", resp.StatusCode, server)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+	if err != nil {
+		return ocspUnknown, err
+	}
+
+	return parseOCSPResponse(body, cert, issuer, time.Now())
+}
+
+// parseOCSPResponse verifies the given OCSP response, and returns the status
+// it reports for the certificate. The response must be signed by issuer, or
+// by a responder certificate issued by issuer for OCSP signing.
+func parseOCSPResponse(raw []byte, cert, issuer *x509.Certificate, now time.Time) (int, error) {
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(raw, &resp); err != nil {
+		return ocspUnknown, fmt.Errorf("failed to parse OCSP response: %v", err)
+	} else if len(rest) != 0 {
+		return ocspUnknown, fmt.Errorf("trailing data in OCSP response")
+	}
+	if resp.Status != 0 {
+		return ocspUnknown, fmt.Errorf("OCSP responder returned status %d", resp.Status)
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidOCSPBasicResponse) {
+		return ocspUnknown, fmt.Errorf("unsupported OCSP response type")
+	}
+
+	var basic ocspBasicResponse
+	if rest, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return ocspUnknown, fmt.Errorf("failed to parse OCSP response: %v", err)
+	} else if len(rest) != 0 {
+		return ocspUnknown, fmt.Errorf("trailing data in OCSP response")
+	}
+
+	signer := issuer
+	if len(basic.Certificates) != 0 {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return ocspUnknown, fmt.Errorf("failed to parse OCSP responder certificate: %v", err)
+		}
+		if !responder.Equal(issuer) {
+			if err := responder.CheckSignatureFrom(issuer); err != nil {
+				return ocspUnknown, fmt.Errorf("OCSP responder certificate was not issued by the issuer of the client certificate")
+			}
+			delegated := false
+			for _, usage := range responder.ExtKeyUsage {
+				if usage == x509.ExtKeyUsageOCSPSigning {
+					delegated = true
+					break
+				}
+			}
+			if !delegated {
+				return ocspUnknown, fmt.Errorf("OCSP responder certificate is not allowed to sign OCSP responses")
+			}
+		}
+		signer = responder
+	}
+
+	algorithm := x509.UnknownSignatureAlgorithm
+	for _, candidate := range ocspSignatureAlgorithms {
+		if basic.SignatureAlgorithm.Algorithm.Equal(candidate.oid) {
+			algorithm = candidate.algorithm
+			break
+		}
+	}
+	if err := signer.CheckSignature(algorithm, basic.TBSResponseData.Raw, basic.Signature.RightAlign()); err != nil {
+		return ocspUnknown, fmt.Errorf("invalid OCSP response signature: %v", err)
+	}
+
+	for _, single := range basic.TBSResponseData.Responses {
+		if !single.CertID.matches(issuer, cert.SerialNumber) {
+			continue
+		}
+		if single.ThisUpdate.After(now.Add(time.Minute)) {
+			return ocspUnknown, fmt.Errorf("OCSP response is not valid yet")
+		}
+		if !single.NextUpdate.IsZero() && single.NextUpdate.Before(now) {
+			return ocspUnknown, fmt.Errorf("OCSP response has expired")
+		}
+
+		switch {
+		case bool(single.Good):
+			return ocspGood, nil
+		case !single.Revoked.RevocationTime.IsZero():
+			return ocspRevoked, nil
+		default:
+			return ocspUnknown, nil
+		}
+	}
+	return ocspUnknown, fmt.Errorf("OCSP response does not cover the client certificate")
+}
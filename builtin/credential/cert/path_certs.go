@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -61,6 +62,26 @@ seconds. Defaults to system/backend default TTL.`,
 				Description: `TTL for tokens issued by this backend.
 Defaults to system/backend default TTL time.`,
 			},
+
+			"ocsp_enabled": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, the revocation status of client
+certificates issued by this CA is checked with OCSP
+at login and renewal.`,
+			},
+
+			"ocsp_servers_override": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Comma-separated list of OCSP responder URLs,
+used instead of those named in client certificates.`,
+			},
+
+			"ocsp_fail_open": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If set, logins are allowed when no OCSP
+responder gives the status of the client certificate.
+Revoked certificates are denied regardless.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -129,6 +150,10 @@ func (b *backend) pathCertRead(
 			"display_name": cert.DisplayName,
 			"policies":     strings.Join(cert.Policies, ","),
 			"ttl":          duration / time.Second,
+
+			"ocsp_enabled":          cert.OCSPEnabled,
+			"ocsp_servers_override": strings.Join(cert.OCSPServersOverride, ","),
+			"ocsp_fail_open":        cert.OCSPFailOpen,
 		},
 	}, nil
 }
@@ -165,10 +190,13 @@ func (b *backend) pathCertWrite(
 	}
 
 	certEntry := &CertEntry{
-		Name:        name,
-		Certificate: certificate,
-		DisplayName: displayName,
-		Policies:    policies,
+		Name:                name,
+		Certificate:         certificate,
+		DisplayName:         displayName,
+		Policies:            policies,
+		OCSPEnabled:         d.Get("ocsp_enabled").(bool),
+		OCSPServersOverride: strutil.ParseStringSlice(d.Get("ocsp_servers_override").(string), ","),
+		OCSPFailOpen:        d.Get("ocsp_fail_open").(bool),
 	}
 
 	// Parse the lease duration or default to backend/system default
@@ -201,6 +229,10 @@ type CertEntry struct {
 	DisplayName string
 	Policies    []string
 	TTL         time.Duration
+
+	OCSPEnabled         bool
+	OCSPServersOverride []string
+	OCSPFailOpen        bool
 }
 
 const pathCertHelpSyn = `
@@ -214,4 +246,9 @@ that are allowed to authenticate.
 Deleting a certificate will not revoke auth for prior authenticated connections.
 To do this, do a revoke on "login". If you don't need to revoke login immediately,
 then the next renew will cause the lease to expire.
+
+When "ocsp_enabled" is set on a CA, the client certificate is also checked with
+the OCSP responders named in it, or those of "ocsp_servers_override", and is
+denied if it is revoked. If no responder gives its status, it is denied unless
+"ocsp_fail_open" is set.
 `
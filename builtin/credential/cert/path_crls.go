@@ -3,8 +3,12 @@ package cert
 import (
 	"crypto/x509"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"math/big"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/helper/certutil"
@@ -28,12 +32,26 @@ May be DER or PEM encoded. Note: the expiration time
 is ignored; if the CRL is no longer valid, delete it
 using the same name as specified here.`,
 			},
+
+			"url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The URL the CRL is fetched from, instead of
+being given in "crl". The CRL is fetched again
+every "refresh_interval".`,
+			},
+
+			"refresh_interval": &framework.FieldSchema{
+				Type:    framework.TypeDurationSecond,
+				Default: 3600,
+				Description: `The interval at which a CRL fetched from
+"url" is fetched again. Defaults to one hour.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.DeleteOperation: b.pathCRLDelete,
 			logical.ReadOperation:   b.pathCRLRead,
-			logical.UpdateOperation:  b.pathCRLWrite,
+			logical.UpdateOperation: b.pathCRLWrite,
 		},
 
 		HelpSynopsis:    pathCRLsHelpSyn,
@@ -163,6 +181,7 @@ func (b *backend) pathCRLRead(
 	}
 
 	retData = structs.New(&crl).Map()
+	retData["refresh_interval"] = crl.RefreshInterval / time.Second
 
 	return &logical.Response{
 		Data: retData,
@@ -176,40 +195,145 @@ func (b *backend) pathCRLWrite(
 		return logical.ErrorResponse(`"name" parameter cannot be empty`), nil
 	}
 	crl := d.Get("crl").(string)
+	crlURL := d.Get("url").(string)
 
-	certList, err := x509.ParseCRL([]byte(crl))
-	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("failed to parse CRL: %v", err)), nil
+	switch {
+	case crl == "" && crlURL == "":
+		return logical.ErrorResponse(`one of "crl" or "url" must be set`), nil
+	case crl != "" && crlURL != "":
+		return logical.ErrorResponse(`"crl" and "url" are mutually exclusive`), nil
 	}
-	if certList == nil {
-		return logical.ErrorResponse("parsed CRL is nil"), nil
+
+	var crlInfo *CRLInfo
+	var err error
+	if crlURL != "" {
+		refreshInterval := time.Duration(d.Get("refresh_interval").(int)) * time.Second
+		if refreshInterval <= 0 {
+			return logical.ErrorResponse(`"refresh_interval" must be positive`), nil
+		}
+		crlInfo, err = b.fetchCRL(crlURL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("failed to fetch CRL: %v", err)), nil
+		}
+		crlInfo.RefreshInterval = refreshInterval
+		crlInfo.LastRefresh = time.Now()
+	} else {
+		crlInfo, err = parseCRL([]byte(crl))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
 	}
 
 	b.crlUpdateMutex.Lock()
 	defer b.crlUpdateMutex.Unlock()
 
-	crlInfo := CRLInfo{
+	return nil, b.setCRL(req.Storage, name, crlInfo)
+}
+
+// setCRL stores the CRL under the given name. The CRL update lock must be
+// held.
+func (b *backend) setCRL(storage logical.Storage, name string, crlInfo *CRLInfo) error {
+	entry, err := logical.StorageEntryJSON("crls/"+name, crlInfo)
+	if err != nil {
+		return err
+	}
+	if err = storage.Put(entry); err != nil {
+		return err
+	}
+
+	b.crls[name] = *crlInfo
+	return nil
+}
+
+// parseCRL returns the revoked serials of the given DER or PEM encoded CRL
+func parseCRL(crl []byte) (*CRLInfo, error) {
+	certList, err := x509.ParseCRL(crl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CRL: %v", err)
+	}
+	if certList == nil {
+		return nil, fmt.Errorf("parsed CRL is nil")
+	}
+
+	crlInfo := &CRLInfo{
 		Serials: map[string]RevokedSerialInfo{},
 	}
 	for _, revokedCert := range certList.TBSCertList.RevokedCertificates {
 		crlInfo.Serials[revokedCert.SerialNumber.String()] = RevokedSerialInfo{}
 	}
+	return crlInfo, nil
+}
 
-	entry, err := logical.StorageEntryJSON("crls/"+name, crlInfo)
+// fetchCRL fetches and parses the CRL found at the given URL
+func (b *backend) fetchCRL(crlURL string) (*CRLInfo, error) {
+	resp, err := b.client.Get(crlURL)
 	if err != nil {
 		return nil, err
 	}
-	if err = req.Storage.Put(entry); err != nil {
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, crlURL)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCRLSize))
+	if err != nil {
 		return nil, err
 	}
 
-	b.crls[name] = crlInfo
+	crlInfo, err := parseCRL(body)
+	if err != nil {
+		return nil, err
+	}
+	crlInfo.URL = crlURL
+	return crlInfo, nil
+}
 
-	return nil, nil
+// refreshCRLs fetches again the CRLs whose refresh interval has elapsed at
+// the given time. A CRL that cannot be fetched is kept as it is, and
+// fetching it is attempted again the next time.
+func (b *backend) refreshCRLs(storage logical.Storage, now time.Time) error {
+	b.crlUpdateMutex.RLock()
+	due := map[string]CRLInfo{}
+	for name, crl := range b.crls {
+		if crl.URL != "" && !now.Before(crl.LastRefresh.Add(crl.RefreshInterval)) {
+			due[name] = crl
+		}
+	}
+	b.crlUpdateMutex.RUnlock()
+
+	for name, crl := range due {
+		// The lock is not held while fetching, so the CRL is only replaced
+		// if it was not changed meanwhile
+		crlInfo, err := b.fetchCRL(crl.URL)
+		if err != nil {
+			b.Logger().Printf("[WARN] cert: failed to refresh CRL %s: %v", name, err)
+			continue
+		}
+		crlInfo.RefreshInterval = crl.RefreshInterval
+		crlInfo.LastRefresh = now
+
+		b.crlUpdateMutex.Lock()
+		current, ok := b.crls[name]
+		if ok && current.URL == crl.URL && current.LastRefresh.Equal(crl.LastRefresh) {
+			err = b.setCRL(storage, name, crlInfo)
+		}
+		b.crlUpdateMutex.Unlock()
+		if err != nil {
+			return fmt.Errorf("error storing CRL %s: %v", name, err)
+		}
+	}
+
+	return nil
 }
 
+// maxCRLSize bounds the size of the CRLs fetched from a URL
+const maxCRLSize = 16 * 1024 * 1024
+
 type CRLInfo struct {
-	Serials map[string]RevokedSerialInfo `json:"serials" structs:"serials" mapstructure:"serials"`
+	Serials         map[string]RevokedSerialInfo `json:"serials" structs:"serials" mapstructure:"serials"`
+	URL             string                       `json:"url" structs:"url" mapstructure:"url"`
+	RefreshInterval time.Duration                `json:"refresh_interval" structs:"refresh_interval" mapstructure:"refresh_interval"`
+	LastRefresh     time.Time                    `json:"last_refresh" structs:"last_refresh,omitnested" mapstructure:"last_refresh"`
 }
 
 type RevokedSerialInfo struct {
@@ -231,4 +355,8 @@ in which none of the serials are revoked by any CRL -- allows authentication.
 This allows authentication to succeed when interim parts of one chain have been
 revoked; for instance, if a certificate is signed by two intermediate CAs due to
 one of them expiring.
+
+A CRL is either given directly in "crl", or fetched from "url". A CRL fetched
+from a URL is fetched again every "refresh_interval"; if it cannot be fetched,
+the previous copy stays in effect.
 `
@@ -178,7 +178,53 @@ func (b *backend) verifyCredentials(req *logical.Request) (*ParsedCert, *logical
 	}
 
 	// Match the trusted chain with the policy
-	return b.matchPolicy(trustedChains, trusted), nil, nil
+	matched := b.matchPolicy(trustedChains, trusted)
+	if matched != nil && matched.Entry.OCSPEnabled {
+		if err := b.checkOCSP(matched.Entry, trustedChains[0]); err != nil {
+			return nil, logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	return matched, nil, nil
+}
+
+// checkOCSP checks the revocation status of the client certificate of the
+// chain with the OCSP responders of the trusted certificate, or else those
+// named in the client certificate
+func (b *backend) checkOCSP(entry *CertEntry, chain []*x509.Certificate) error {
+	// A trusted CA presented as the client certificate has no issuer to
+	// query the status with
+	if len(chain) < 2 {
+		return nil
+	}
+	cert, issuer := chain[0], chain[1]
+
+	servers := entry.OCSPServersOverride
+	if len(servers) == 0 {
+		servers = cert.OCSPServer
+	}
+
+	lastErr := fmt.Errorf("no OCSP responder is known for the client certificate")
+	for _, server := range servers {
+		status, err := b.queryOCSP(server, cert, issuer)
+		if err != nil {
+			b.Logger().Printf("[WARN] cert: OCSP query to %s failed: %v", server, err)
+			lastErr = err
+			continue
+		}
+		switch status {
+		case ocspGood:
+			return nil
+		case ocspRevoked:
+			return fmt.Errorf("client certificate has been revoked")
+		default:
+			lastErr = fmt.Errorf("OCSP responder %s does not know the client certificate", server)
+		}
+	}
+
+	if entry.OCSPFailOpen {
+		return nil
+	}
+	return fmt.Errorf("failed to check the revocation status of the client certificate: %v", lastErr)
 }
 
 // matchNonCAPolicy is used to match the client cert with the registered non-CA
@@ -0,0 +1,126 @@
+package gcp
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// googleCertsURL is the JWKS of the keys Google signs instance identity
+	// tokens with
+	googleCertsURL = "https://www.googleapis.com/oauth2/v3/certs"
+
+	// serviceAccountKeysURL is the prefix of the JWKS of the public keys of
+	// a service account, which is followed by the email of the account
+	serviceAccountKeysURL = "https://www.googleapis.com/service_accounts/v1/jwk/"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+type backend struct {
+	*framework.Backend
+
+	// Lock to make changes to role entries
+	roleMutex sync.RWMutex
+
+	// Lock protecting the cached Google keys
+	cacheMutex sync.Mutex
+
+	// googleKeys are the cached keys Google signs instance identity tokens
+	// with
+	googleKeys []*jwtutil.PublicKey
+
+	client *http.Client
+
+	// The URLs keys are fetched from, and the current time. They are
+	// replaced in tests.
+	googleCertsURL        string
+	serviceAccountKeysURL string
+	now                   func() time.Time
+}
+
+func Backend() *backend {
+	b := &backend{
+		client:                cleanhttp.DefaultClient(),
+		googleCertsURL:        googleCertsURL,
+		serviceAccountKeysURL: serviceAccountKeysURL,
+		now:                   time.Now,
+	}
+
+	b.Backend = &framework.Backend{
+		AuthRenew: b.pathLoginRenew,
+		Help:      backendHelp,
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+		Paths: []*framework.Path{
+			pathRole(b),
+			pathListRoles(b),
+			pathLogin(b),
+		},
+	}
+
+	return b
+}
+
+// fetchKeys fetches the keys of the JWKS at the given URL
+func (b *backend) fetchKeys(url string) ([]*jwtutil.PublicKey, error) {
+	resp, err := b.client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, url)
+	}
+	keys, err := jwtutil.ParseJWKS(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %s", url, err)
+	}
+	return keys, nil
+}
+
+// googleCerts returns the keys Google signs instance identity tokens with.
+// They are cached, unless refresh is set.
+func (b *backend) googleCerts(refresh bool) ([]*jwtutil.PublicKey, error) {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	if b.googleKeys != nil && !refresh {
+		return b.googleKeys, nil
+	}
+
+	keys, err := b.fetchKeys(b.googleCertsURL)
+	if err != nil {
+		return nil, err
+	}
+	b.googleKeys = keys
+	return keys, nil
+}
+
+const backendHelp = `
+The GCP credential provider allows Google Cloud Platform entities to
+authenticate with Vault.
+
+Two types of roles are supported. With "iam" roles, service accounts log in
+with a JWT they signed using the IAM API. With "gce" roles, Compute Engine
+instances log in with the identity token Google signs in their metadata.
+The project, zone and service account of the entity are then matched
+against the bounds of the role, which determines the policies of the issued
+token.
+
+After enabling the credential provider, use the "role" route to create
+roles.
+`
@@ -0,0 +1,328 @@
+package gcp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const testServiceAccount = "web@my-project.iam.gserviceaccount.com"
+
+// testKeyServer serves the JWKS of Google and of the service accounts
+type testKeyServer struct {
+	t               *testing.T
+	googleKeys      map[string]*rsa.PrivateKey
+	serviceAccounts map[string]map[string]*rsa.PrivateKey
+}
+
+func (s *testKeyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keys := s.googleKeys
+	if strings.HasPrefix(r.URL.Path, "/sa/") {
+		var ok bool
+		if keys, ok = s.serviceAccounts[strings.TrimPrefix(r.URL.Path, "/sa/")]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	}
+	w.Write(jwtutil.TestJWKS(s.t, keys))
+}
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func createBackendWithStorage(t *testing.T, keys *testKeyServer) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	server := httptest.NewServer(keys)
+
+	b := Backend()
+	b.googleCertsURL = server.URL + "/certs"
+	b.serviceAccountKeysURL = server.URL + "/sa/"
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func iamClaims(email, role string, exp time.Duration) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub": email,
+		"aud": "vault/" + role,
+		"iat": now.Unix(),
+		"exp": now.Add(exp).Unix(),
+	}
+}
+
+func gceClaims(role, project, zone string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":   "https://accounts.google.com",
+		"sub":   "1234567890",
+		"aud":   "vault/" + role,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"email": testServiceAccount,
+		"google": map[string]interface{}{
+			"compute_engine": map[string]interface{}{
+				"project_id":    project,
+				"zone":          zone,
+				"instance_id":   "42",
+				"instance_name": "web-1",
+			},
+		},
+	}
+}
+
+func TestBackend_Role(t *testing.T) {
+	b, storage := createBackendWithStorage(t, &testKeyServer{t: t})
+
+	for _, data := range []map[string]interface{}{
+		{"bound_projects": "my-project", "bound_service_accounts": "*"},
+		{"type": "ec2", "bound_projects": "my-project"},
+		{"type": "iam", "bound_service_accounts": "*"},
+		{"type": "iam", "bound_projects": "my-project"},
+		{"type": "iam", "bound_projects": "my-project", "bound_service_accounts": "*", "bound_zones": "us-central1-a"},
+		{"type": "gce", "bound_projects": "my-project", "max_jwt_exp": 60},
+	} {
+		resp := testWrite(t, b, storage, "role/invalid", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"type":                   "iam",
+		"bound_projects":         "my-project",
+		"bound_service_accounts": testServiceAccount,
+		"policies":               "dev",
+		"ttl":                    60,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/web",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["type"] != "iam" ||
+		resp.Data["max_jwt_exp"] != time.Duration(900) ||
+		resp.Data["ttl"] != time.Duration(60) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if policies := resp.Data["policies"].([]string); len(policies) != 2 {
+		t.Fatalf("bad policies: %#v", policies)
+	}
+
+	// The type cannot be changed
+	resp = testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"type": "gce",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
+
+func TestBackend_LoginIAM(t *testing.T) {
+	saKey := generateKey(t)
+	keys := &testKeyServer{
+		t: t,
+		serviceAccounts: map[string]map[string]*rsa.PrivateKey{
+			testServiceAccount: {"1": saKey},
+		},
+	}
+	b, storage := createBackendWithStorage(t, keys)
+
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"type":                   "iam",
+		"bound_projects":         "my-project",
+		"bound_service_accounts": testServiceAccount,
+		"policies":               "dev",
+	})
+
+	login := func(jwt string) *logical.Response {
+		return testWrite(t, b, storage, "login", map[string]interface{}{
+			"role": "web",
+			"jwt":  jwt,
+		})
+	}
+
+	resp := login(jwtutil.TestSign(t, saKey, "1", iamClaims(testServiceAccount, "web", 10*time.Minute)))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["project_id"] != "my-project" ||
+		resp.Auth.Metadata["service_account_email"] != testServiceAccount ||
+		resp.Auth.DisplayName != testServiceAccount {
+		t.Fatalf("bad auth: %#v", resp.Auth)
+	}
+
+	// Renewals check the role again
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      resp.Auth,
+	}
+	renewReq.Auth.IssueTime = time.Now()
+	if _, err := b.pathLoginRenew(renewReq, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_projects": "other-project",
+	})
+	if _, err := b.pathLoginRenew(renewReq, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_projects": "my-project",
+	})
+
+	otherKey := generateKey(t)
+	otherServiceAccount := "db@my-project.iam.gserviceaccount.com"
+	keys.serviceAccounts[otherServiceAccount] = map[string]*rsa.PrivateKey{"2": otherKey}
+
+	for _, jwt := range []string{
+		// Signed by another key
+		jwtutil.TestSign(t, otherKey, "1", iamClaims(testServiceAccount, "web", 10*time.Minute)),
+		// Expiring too far in the future
+		jwtutil.TestSign(t, saKey, "1", iamClaims(testServiceAccount, "web", time.Hour)),
+		// Expired
+		jwtutil.TestSign(t, saKey, "1", iamClaims(testServiceAccount, "web", -time.Hour)),
+		// For another role
+		jwtutil.TestSign(t, saKey, "1", iamClaims(testServiceAccount, "db", 10*time.Minute)),
+		// Of a service account not bound to the role
+		jwtutil.TestSign(t, otherKey, "2", iamClaims(otherServiceAccount, "web", 10*time.Minute)),
+		// Of an unknown service account
+		jwtutil.TestSign(t, saKey, "1", iamClaims("nobody@my-project.iam.gserviceaccount.com", "web", 10*time.Minute)),
+		"not-a-jwt",
+	} {
+		if resp := login(jwt); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %#v", resp)
+		}
+	}
+}
+
+func TestBackend_LoginGCE(t *testing.T) {
+	googleKey := generateKey(t)
+	keys := &testKeyServer{
+		t:          t,
+		googleKeys: map[string]*rsa.PrivateKey{"1": googleKey},
+	}
+	b, storage := createBackendWithStorage(t, keys)
+
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"type":           "gce",
+		"bound_projects": "my-project",
+		"bound_regions":  "us-central1",
+		"policies":       "dev",
+	})
+
+	login := func(jwt string) *logical.Response {
+		return testWrite(t, b, storage, "login", map[string]interface{}{
+			"role": "web",
+			"jwt":  jwt,
+		})
+	}
+
+	resp := login(jwtutil.TestSign(t, googleKey, "1", gceClaims("web", "my-project", "us-central1-a")))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.Metadata["zone"] != "us-central1-a" ||
+		resp.Auth.Metadata["instance_id"] != "42" ||
+		resp.Auth.Metadata["service_account_email"] != testServiceAccount ||
+		resp.Auth.DisplayName != "web-1" {
+		t.Fatalf("bad auth: %#v", resp.Auth)
+	}
+
+	// Rotated keys are fetched again
+	newKey := generateKey(t)
+	keys.googleKeys = map[string]*rsa.PrivateKey{"2": newKey}
+	resp = login(jwtutil.TestSign(t, newKey, "2", gceClaims("web", "my-project", "us-central1-b")))
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Zones and service accounts can be bound too
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_zones":            "us-central1-a",
+		"bound_service_accounts": "db@my-project.iam.gserviceaccount.com",
+	})
+
+	noDetails := gceClaims("web", "my-project", "us-central1-a")
+	delete(noDetails, "google")
+	otherIssuer := gceClaims("web", "my-project", "us-central1-a")
+	otherIssuer["iss"] = "https://example.com"
+
+	for _, claims := range []map[string]interface{}{
+		gceClaims("web", "my-project", "us-central1-a"),
+		gceClaims("web", "my-project", "us-central1-b"),
+		gceClaims("web", "other-project", "us-central1-a"),
+		gceClaims("db", "my-project", "us-central1-a"),
+		noDetails,
+		otherIssuer,
+	} {
+		if resp := login(jwtutil.TestSign(t, newKey, "2", claims)); resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", claims, resp)
+		}
+	}
+
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_service_accounts": testServiceAccount,
+	})
+	resp = login(jwtutil.TestSign(t, newKey, "2", gceClaims("web", "my-project", "us-central1-a")))
+	if resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Tokens signed by unknown keys are rejected
+	resp = login(jwtutil.TestSign(t, generateKey(t), "2", gceClaims("web", "my-project", "us-central1-a")))
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
+
+func TestZoneRegion(t *testing.T) {
+	for zone, region := range map[string]string{
+		"us-central1-a":   "us-central1",
+		"europe-west1-b":  "europe-west1",
+		"asia-east1":      "asia",
+		"invalid-zone-x1": "invalid-zone",
+	} {
+		if got := zoneRegion(zone); got != region {
+			t.Fatalf("%s: expected %q, got %q", zone, region, got)
+		}
+	}
+}
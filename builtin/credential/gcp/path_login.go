@@ -0,0 +1,301 @@
+package gcp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+// serviceAccountDomain is the domain of the emails of the service accounts
+// created in a project, which follows the project ID
+const serviceAccountDomain = ".iam.gserviceaccount.com"
+
+// googleIssuers are the issuers of instance identity tokens
+var googleIssuers = []string{"accounts.google.com", "https://accounts.google.com"}
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role against which the login is being attempted.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `A JWT signed by a service account for "iam" roles, or the identity token
+of the instance for "gce" roles.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+// gcpEntity holds the details of the entity logging in. The instance
+// details are only set for "gce" roles.
+type gcpEntity struct {
+	ProjectID      string
+	ServiceAccount string
+	Zone           string
+	InstanceID     string
+	InstanceName   string
+}
+
+// computeEngineClaims are the details of the instance found in the
+// "google" claim of instance identity tokens
+type computeEngineClaims struct {
+	ProjectID    string `mapstructure:"project_id"`
+	Zone         string `mapstructure:"zone"`
+	InstanceID   string `mapstructure:"instance_id"`
+	InstanceName string `mapstructure:"instance_name"`
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	rawJWT := data.Get("jwt").(string)
+	if rawJWT == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+
+	token, err := jwtutil.Parse(rawJWT)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var entity *gcpEntity
+	switch role.RoleType {
+	case iamRoleType:
+		entity, err = b.iamEntity(role, token)
+	case gceRoleType:
+		entity, err = b.gceEntity(token)
+	default:
+		return nil, fmt.Errorf("role %q has an invalid type %q", roleName, role.RoleType)
+	}
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// The audience ties the JWT to the role, so that it cannot be replayed
+	// against other roles or services
+	if !strutil.StrListContains(token.StringsClaim("aud"), "vault/"+roleName) {
+		return logical.ErrorResponse(fmt.Sprintf("JWT audience must be %q", "vault/"+roleName)), nil
+	}
+	if err := role.validate(entity); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	ttl, _, err := b.SanitizeTTL(role.TTL, role.MaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.Period > time.Duration(0) {
+		ttl = role.Period
+	}
+
+	metadata := map[string]string{
+		"role":                  roleName,
+		"project_id":            entity.ProjectID,
+		"service_account_email": entity.ServiceAccount,
+	}
+	displayName := entity.ServiceAccount
+	if role.RoleType == gceRoleType {
+		metadata["zone"] = entity.Zone
+		metadata["instance_id"] = entity.InstanceID
+		metadata["instance_name"] = entity.InstanceName
+		displayName = entity.InstanceName
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Period: role.Period,
+			InternalData: map[string]interface{}{
+				"role": roleName,
+			},
+			Policies:    role.Policies,
+			Metadata:    metadata,
+			DisplayName: displayName,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       ttl,
+				Renewable: true,
+			},
+		},
+	}, nil
+}
+
+// iamEntity verifies a JWT signed by a service account, and returns the
+// service account and its project
+func (b *backend) iamEntity(role *roleEntry, token *jwtutil.JWT) (*gcpEntity, error) {
+	email, _ := token.StringClaim("sub")
+	if !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("JWT subject must be the email of a service account")
+	}
+
+	// The public keys of service accounts are published by Google, so the
+	// signature proves the JWT was signed by the service account
+	keys, err := b.fetchKeys(b.serviceAccountKeysURL + url.QueryEscape(email))
+	if err != nil {
+		return nil, err
+	}
+	if err := token.Verify(keys); err != nil {
+		return nil, err
+	}
+
+	now := b.now()
+	if err := token.ValidateTimes(now); err != nil {
+		return nil, err
+	}
+	exp, _, _ := token.TimeClaim("exp")
+	if exp.Sub(now) > role.MaxJWTExp+jwtutil.ClockSkewLeeway {
+		return nil, fmt.Errorf("JWT expires more than %d seconds in the future", role.MaxJWTExp/time.Second)
+	}
+
+	projectID, err := serviceAccountProject(email)
+	if err != nil {
+		return nil, err
+	}
+	return &gcpEntity{
+		ProjectID:      projectID,
+		ServiceAccount: email,
+	}, nil
+}
+
+// gceEntity verifies the identity token of a Compute Engine instance, and
+// returns the details of the instance
+func (b *backend) gceEntity(token *jwtutil.JWT) (*gcpEntity, error) {
+	keys, err := b.googleCerts(false)
+	if err != nil {
+		return nil, err
+	}
+	// Google rotates its keys, so they are fetched again if the token
+	// names a key that is not known
+	if err := token.Verify(keys); err != nil {
+		if token.Header.Kid == "" || jwtutil.HasKeyID(keys, token.Header.Kid) {
+			return nil, err
+		}
+		if keys, err = b.googleCerts(true); err != nil {
+			return nil, err
+		}
+		if err := token.Verify(keys); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := token.ValidateTimes(b.now()); err != nil {
+		return nil, err
+	}
+	if issuer, _ := token.StringClaim("iss"); !strutil.StrListContains(googleIssuers, issuer) {
+		return nil, fmt.Errorf("JWT issuer %q is not Google", issuer)
+	}
+
+	google, _ := token.Claims["google"].(map[string]interface{})
+	var instance computeEngineClaims
+	if err := mapstructure.Decode(google["compute_engine"], &instance); err != nil {
+		return nil, fmt.Errorf("error decoding the compute_engine claim: %s", err)
+	}
+	if instance.ProjectID == "" || instance.Zone == "" {
+		return nil, fmt.Errorf("JWT has no instance details; request the identity token with format=full")
+	}
+
+	email, _ := token.StringClaim("email")
+	return &gcpEntity{
+		ProjectID:      instance.ProjectID,
+		ServiceAccount: email,
+		Zone:           instance.Zone,
+		InstanceID:     instance.InstanceID,
+		InstanceName:   instance.InstanceName,
+	}, nil
+}
+
+// serviceAccountProject returns the ID of the project the given service
+// account was created in
+func serviceAccountProject(email string) (string, error) {
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.HasSuffix(domain, serviceAccountDomain) {
+		return "", fmt.Errorf("project of service account %q cannot be determined", email)
+	}
+	return strings.TrimSuffix(domain, serviceAccountDomain), nil
+}
+
+// Invoked when the token issued by this backend is attempting a renewal.
+func (b *backend) pathLoginRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, ok := req.Auth.InternalData["role"].(string)
+	if !ok || roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// Ensure that the role still exists and allows the entity
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	entity := &gcpEntity{
+		ProjectID:      req.Auth.Metadata["project_id"],
+		ServiceAccount: req.Auth.Metadata["service_account_email"],
+		Zone:           req.Auth.Metadata["zone"],
+	}
+	if err := role.validate(entity); err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies on role %s have changed, cannot renew", roleName)
+	}
+
+	// If 'Period' is set on the role, the token should never expire.
+	// Replenish the TTL with 'Period's value.
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, data)
+}
+
+const pathLoginHelpSyn = `
+Authenticates GCP entities with Vault.
+`
+
+const pathLoginHelpDesc = `
+The JWT must have the audience "vault/<role>", where <role> is the name of
+the role given.
+
+For "iam" roles, the JWT is signed by a service account using the
+signJwt method of the IAM API, and its subject is the email of the service
+account. It must expire within the 'max_jwt_exp' of the role.
+
+For "gce" roles, the JWT is the identity token of the instance, fetched
+from the metadata server with format=full so that it holds the details of
+the instance.
+`
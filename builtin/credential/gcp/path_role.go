@@ -0,0 +1,386 @@
+package gcp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	iamRoleType = "iam"
+	gceRoleType = "gce"
+
+	// defaultMaxJWTExp is how far in the future the JWTs of service
+	// accounts can expire by default
+	defaultMaxJWTExp = 15 * time.Minute
+)
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"type": {
+				Type: framework.TypeString,
+				Description: `Type of the role, either "iam" or "gce". It cannot be changed once the
+role is created.`,
+			},
+			"bound_projects": {
+				Type:        framework.TypeString,
+				Description: "Comma separated list of project IDs allowed to login with this role.",
+			},
+			"bound_service_accounts": {
+				Type: framework.TypeString,
+				Description: `Comma separated list of service account emails allowed to login with this
+role. If set to "*", all service accounts of the bound projects are
+allowed. Required for "iam" roles.`,
+			},
+			"bound_zones": {
+				Type:        framework.TypeString,
+				Description: `Comma separated list of zones allowed to login with a "gce" role.`,
+			},
+			"bound_regions": {
+				Type:        framework.TypeString,
+				Description: `Comma separated list of regions allowed to login with a "gce" role.`,
+			},
+			"max_jwt_exp": {
+				Type: framework.TypeDurationSecond,
+				Description: `How far in the future, in seconds, the JWTs of service accounts can
+expire when logging in with an "iam" role. Defaults to 900.`,
+			},
+			"policies": {
+				Type:        framework.TypeString,
+				Default:     "default",
+				Description: "Policies to be set on tokens issued using this role.",
+			},
+			"ttl": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `Duration in seconds after which the issued token should expire. Defaults
+to 0, in which case the value will fallback to the system/mount defaults.`,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Default:     0,
+				Description: "The maximum allowed lifetime of tokens issued using this role.",
+			},
+			"period": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `If set, indicates that the token generated using this role should never
+expire. The token should be renewed within the duration specified by this
+value. At each renewal, the token's TTL will be set to the value of this
+parameter.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathListRolesHelpSyn,
+		HelpDescription: pathListRolesHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathRoleExistenceCheck(req *logical.Request, data *framework.FieldData) (bool, error) {
+	entry, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return false, err
+	}
+	return entry != nil, nil
+}
+
+// lockedRole returns the role with the given name, after acquiring the
+// role lock
+func (b *backend) lockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	return b.nonLockedRole(s, roleName)
+}
+
+// nonLockedRole returns the role with the given name
+func (b *backend) nonLockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	return nil, req.Storage.Delete("role/" + strings.ToLower(roleName))
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	respData := structs.New(role).Map()
+
+	// Display the durations in seconds
+	respData["max_jwt_exp"] = role.MaxJWTExp / time.Second
+	respData["ttl"] = role.TTL / time.Second
+	respData["max_ttl"] = role.MaxTTL / time.Second
+	respData["period"] = role.Period / time.Second
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(data.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	role, err := b.nonLockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	newRole := role == nil
+	if newRole {
+		role = &roleEntry{}
+	}
+
+	roleType := data.Get("type").(string)
+	switch {
+	case newRole && roleType != iamRoleType && roleType != gceRoleType:
+		return logical.ErrorResponse(fmt.Sprintf("type must be %q or %q", iamRoleType, gceRoleType)), nil
+	case !newRole && roleType != "" && roleType != role.RoleType:
+		return logical.ErrorResponse("type of an existing role cannot be changed"), nil
+	}
+	if newRole {
+		role.RoleType = roleType
+	}
+
+	if projectsRaw, ok := data.GetOk("bound_projects"); ok {
+		role.BoundProjects = strutil.ParseDedupAndSortStrings(projectsRaw.(string), ",")
+	}
+	if serviceAccountsRaw, ok := data.GetOk("bound_service_accounts"); ok {
+		role.BoundServiceAccounts = strutil.ParseDedupAndSortStrings(serviceAccountsRaw.(string), ",")
+	}
+	if zonesRaw, ok := data.GetOk("bound_zones"); ok {
+		role.BoundZones = strutil.ParseDedupAndSortStrings(zonesRaw.(string), ",")
+	}
+	if regionsRaw, ok := data.GetOk("bound_regions"); ok {
+		role.BoundRegions = strutil.ParseDedupAndSortStrings(regionsRaw.(string), ",")
+	}
+	if maxJWTExpRaw, ok := data.GetOk("max_jwt_exp"); ok {
+		role.MaxJWTExp = time.Duration(maxJWTExpRaw.(int)) * time.Second
+	} else if newRole && role.RoleType == iamRoleType {
+		role.MaxJWTExp = defaultMaxJWTExp
+	}
+
+	// Roles must be bound, so that any entity of GCP cannot login
+	if len(role.BoundProjects) == 0 {
+		return logical.ErrorResponse("bound_projects must be set"), nil
+	}
+	switch role.RoleType {
+	case iamRoleType:
+		if len(role.BoundServiceAccounts) == 0 {
+			return logical.ErrorResponse("bound_service_accounts must be set for iam roles"), nil
+		}
+		if len(role.BoundZones) != 0 || len(role.BoundRegions) != 0 {
+			return logical.ErrorResponse("bound_zones and bound_regions can only be set for gce roles"), nil
+		}
+		if role.MaxJWTExp <= 0 {
+			return logical.ErrorResponse("max_jwt_exp must be positive"), nil
+		}
+	case gceRoleType:
+		if role.MaxJWTExp != 0 {
+			return logical.ErrorResponse("max_jwt_exp can only be set for iam roles"), nil
+		}
+	}
+
+	if policiesRaw, ok := data.GetOk("policies"); ok {
+		role.Policies = policyutil.ParsePolicies(policiesRaw.(string))
+	} else if newRole {
+		role.Policies = policyutil.ParsePolicies(data.Get("policies").(string))
+	}
+
+	var resp logical.Response
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttlRaw.(int)) * time.Second
+		if defaultLeaseTTL := b.System().DefaultLeaseTTL(); role.TTL > defaultLeaseTTL {
+			resp.AddWarning(fmt.Sprintf("Given ttl of %d seconds greater than current mount/system default of %d seconds; ttl will be capped at login time", role.TTL/time.Second, defaultLeaseTTL/time.Second))
+		}
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+		if systemMaxTTL := b.System().MaxLeaseTTL(); role.MaxTTL > systemMaxTTL {
+			resp.AddWarning(fmt.Sprintf("Given max_ttl of %d seconds greater than current mount/system default of %d seconds; max_ttl will be capped at login time", role.MaxTTL/time.Second, systemMaxTTL/time.Second))
+		}
+	}
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("ttl and max_ttl cannot be negative"), nil
+	}
+	if role.MaxTTL != 0 && role.MaxTTL < role.TTL {
+		return logical.ErrorResponse("ttl should be shorter than max_ttl"), nil
+	}
+
+	if periodRaw, ok := data.GetOk("period"); ok {
+		role.Period = time.Duration(periodRaw.(int)) * time.Second
+		if role.Period > b.System().MaxLeaseTTL() {
+			return logical.ErrorResponse(fmt.Sprintf("period of %d seconds is greater than the backend's maximum TTL of %d seconds", role.Period/time.Second, b.System().MaxLeaseTTL()/time.Second)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Warnings()) == 0 {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// roleEntry binds GCP entities to the policies of the tokens they are
+// issued
+type roleEntry struct {
+	RoleType             string        `json:"type" structs:"type" mapstructure:"type"`
+	BoundProjects        []string      `json:"bound_projects" structs:"bound_projects" mapstructure:"bound_projects"`
+	BoundServiceAccounts []string      `json:"bound_service_accounts" structs:"bound_service_accounts" mapstructure:"bound_service_accounts"`
+	BoundZones           []string      `json:"bound_zones" structs:"bound_zones" mapstructure:"bound_zones"`
+	BoundRegions         []string      `json:"bound_regions" structs:"bound_regions" mapstructure:"bound_regions"`
+	MaxJWTExp            time.Duration `json:"max_jwt_exp" structs:"max_jwt_exp" mapstructure:"max_jwt_exp"`
+	Policies             []string      `json:"policies" structs:"policies" mapstructure:"policies"`
+	TTL                  time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
+	MaxTTL               time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	Period               time.Duration `json:"period" structs:"period" mapstructure:"period"`
+}
+
+// validate checks the details of an entity against the bounds of the role
+func (r *roleEntry) validate(entity *gcpEntity) error {
+	if !strutil.StrListContains(r.BoundProjects, entity.ProjectID) {
+		return fmt.Errorf("project %q is not bound to the role", entity.ProjectID)
+	}
+	if len(r.BoundServiceAccounts) != 0 &&
+		!strutil.StrListContains(r.BoundServiceAccounts, "*") &&
+		!strutil.StrListContains(r.BoundServiceAccounts, entity.ServiceAccount) {
+		return fmt.Errorf("service account %q is not bound to the role", entity.ServiceAccount)
+	}
+	if r.RoleType != gceRoleType {
+		return nil
+	}
+
+	if len(r.BoundZones) != 0 && !strutil.StrListContains(r.BoundZones, entity.Zone) {
+		return fmt.Errorf("zone %q is not bound to the role", entity.Zone)
+	}
+	if len(r.BoundRegions) != 0 && !strutil.StrListContains(r.BoundRegions, zoneRegion(entity.Zone)) {
+		return fmt.Errorf("region of zone %q is not bound to the role", entity.Zone)
+	}
+	return nil
+}
+
+// zoneRegion returns the region of the given zone, such as "us-central1"
+// for "us-central1-a"
+func zoneRegion(zone string) string {
+	if i := strings.LastIndex(zone, "-"); i != -1 {
+		return zone[:i]
+	}
+	return zone
+}
+
+const pathRoleHelpSyn = `
+Create a role binding GCP entities to policies.
+`
+
+const pathRoleHelpDesc = `
+A role binds GCP entities to the policies of the tokens they are issued at
+login. Roles are of one of the following types, which cannot be changed:
+
+  * "iam": service accounts log in with a JWT signed with the IAM API.
+    'bound_service_accounts' must be set, and can be "*" to allow any
+    service account of the bound projects. 'max_jwt_exp' limits how far in
+    the future the JWT can expire.
+  * "gce": Compute Engine instances log in with their identity token. The
+    instances can be further bound by 'bound_zones', 'bound_regions' and
+    'bound_service_accounts'.
+
+'bound_projects' must be set for both types.
+`
+
+const pathListRolesHelpSyn = `
+Lists all the roles that are registered with Vault.
+`
+
+const pathListRolesHelpDesc = `
+Roles will be listed by their respective role names.
+`
@@ -1,8 +1,12 @@
 package github
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -186,3 +190,168 @@ func testAccLogin(t *testing.T, keys []string) logicaltest.TestStep {
 		Check: logicaltest.TestCheckAuth(keys),
 	}
 }
+
+// testGitHubServer mocks the GitHub API for a user of the "acme" organization
+// in the "SRE-Team" team, whose slug is "sre"
+type testGitHubServer struct {
+	login  string
+	scopes string
+	state  string
+	role   string
+}
+
+func (s *testGitHubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-OAuth-Scopes", s.scopes)
+
+	var body interface{}
+	switch r.URL.Path {
+	case "/user":
+		body = map[string]interface{}{"login": s.login}
+	case "/user/orgs":
+		body = []interface{}{map[string]interface{}{"login": "acme", "id": 1}}
+	case "/user/memberships/orgs/acme":
+		body = map[string]interface{}{"state": s.state, "role": s.role}
+	case "/user/teams":
+		body = []interface{}{
+			map[string]interface{}{
+				"name":         "SRE-Team",
+				"slug":         "sre",
+				"organization": map[string]interface{}{"id": 1},
+			},
+			map[string]interface{}{
+				"name":         "others",
+				"slug":         "others",
+				"organization": map[string]interface{}{"id": 2},
+			},
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestBackend_loginRestrictions(t *testing.T) {
+	gh := &testGitHubServer{login: "Alice", scopes: "admin:org, repo", state: "active", role: "member"}
+	server := httptest.NewServer(gh)
+	defer server.Close()
+
+	b, err := Factory(&logical.BackendConfig{
+		System: &logical.StaticSystemView{
+			DefaultLeaseTTLVal: time.Hour,
+			MaxLeaseTTLVal:     time.Hour,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Unable to create backend: %s", err)
+	}
+	storage := &logical.InmemStorage{}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		req := logical.TestRequest(t, op, path)
+		req.Storage = storage
+		req.Data = data
+		resp, err := b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	configure := func(data map[string]interface{}) {
+		data["organization"] = "acme"
+		data["base_url"] = server.URL + "/"
+		if resp := request(logical.UpdateOperation, "config", data); resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+	login := func() *logical.Response {
+		return request(logical.UpdateOperation, "login", map[string]interface{}{"token": "foo"})
+	}
+
+	request(logical.UpdateOperation, "map/teams/SRE-Team", map[string]interface{}{"value": "by-name"})
+	request(logical.UpdateOperation, "map/teams/sre", map[string]interface{}{"value": "by-slug"})
+	request(logical.UpdateOperation, "map/teams/others", map[string]interface{}{"value": "others"})
+
+	// Teams are mapped by name and slug by default
+	configure(map[string]interface{}{})
+	resp := login()
+	if resp.IsError() || !reflect.DeepEqual(resp.Auth.Policies, []string{"by-name", "by-slug"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	configure(map[string]interface{}{"map_teams_by": "slug"})
+	resp = login()
+	if resp.IsError() || !reflect.DeepEqual(resp.Auth.Policies, []string{"by-slug"}) {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, "config", nil)
+	if resp.Data["map_teams_by"] != "slug" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	configure(map[string]interface{}{"allowed_users": "bob,alice"})
+	if resp := login(); resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	configure(map[string]interface{}{"allowed_users": "bob"})
+	if resp := login(); !resp.IsError() {
+		t.Fatalf("expected error for user not allowed: %#v", resp)
+	}
+
+	configure(map[string]interface{}{"required_scopes": "read:org,repo:status"})
+	if resp := login(); resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	configure(map[string]interface{}{"required_scopes": "read:org,user"})
+	if resp := login(); !resp.IsError() {
+		t.Fatalf("expected error for missing scope: %#v", resp)
+	}
+
+	configure(map[string]interface{}{"required_org_role": "member"})
+	if resp := login(); resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	configure(map[string]interface{}{"required_org_role": "admin"})
+	if resp := login(); !resp.IsError() {
+		t.Fatalf("expected error for member: %#v", resp)
+	}
+	gh.role = "admin"
+	if resp := login(); resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	gh.state = "pending"
+	if resp := login(); !resp.IsError() {
+		t.Fatalf("expected error for pending membership: %#v", resp)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"required_org_role": "owner"},
+		{"map_teams_by": "id"},
+	} {
+		data["organization"] = "acme"
+		if resp := request(logical.UpdateOperation, "config", data); !resp.IsError() {
+			t.Fatalf("expected error: %#v", data)
+		}
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	granted := []string{"admin:org", "write:public_key", "repo"}
+	for scope, expected := range map[string]bool{
+		"admin:org":        true,
+		"write:org":        true,
+		"read:org":         true,
+		"read:public_key":  true,
+		"admin:public_key": false,
+		"repo":             true,
+		"repo:status":      true,
+		"user":             false,
+		"read:user":        false,
+		"admin:org_hook":   false,
+	} {
+		if hasScope(granted, scope) != expected {
+			t.Fatalf("%s: expected %v", scope, expected)
+		}
+	}
+}
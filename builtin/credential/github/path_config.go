@@ -3,6 +3,7 @@ package github
 import (
 	"fmt"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -32,14 +33,60 @@ API-compatible authentication server.`,
 				Type:        framework.TypeString,
 				Description: `Maximum duration after which authentication will be expired`,
 			},
+			"allowed_users": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the GitHub users
+allowed to log in. Any member of the
+organization can log in if empty.`,
+			},
+			"required_org_role": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `If set to "member" or "admin", users
+must have an active membership of the
+organization with at least that role.`,
+			},
+			"required_scopes": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the OAuth scopes
+tokens must have, such as "read:org".`,
+			},
+			"map_teams_by": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: mapTeamsByNameAndSlug,
+				Description: `Whether teams are mapped to policies by
+"name_and_slug", or by "slug" only, which
+is not affected by changes of display names.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
 			logical.UpdateOperation: b.pathConfigWrite,
 		},
 	}
 }
 
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"organization":      config.Org,
+			"base_url":          config.BaseURL,
+			"ttl":               config.TTL.String(),
+			"max_ttl":           config.MaxTTL.String(),
+			"allowed_users":     config.AllowedUsers,
+			"required_org_role": config.RequiredOrgRole,
+			"required_scopes":   config.RequiredScopes,
+			"map_teams_by":      config.teamMapping(),
+		},
+	}, nil
+}
+
 func (b *backend) pathConfigWrite(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	organization := data.Get("organization").(string)
@@ -74,11 +121,34 @@ func (b *backend) pathConfigWrite(
 		}
 	}
 
+	requiredOrgRole := data.Get("required_org_role").(string)
+	switch requiredOrgRole {
+	case "", "member", "admin":
+	default:
+		return logical.ErrorResponse("required_org_role must be 'member' or 'admin'"), nil
+	}
+
+	mapTeamsBy := data.Get("map_teams_by").(string)
+	switch mapTeamsBy {
+	case mapTeamsByNameAndSlug, mapTeamsBySlug:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("map_teams_by must be '%s' or '%s'", mapTeamsByNameAndSlug, mapTeamsBySlug)), nil
+	}
+
+	allowedUsers := data.Get("allowed_users").([]string)
+	for i, user := range allowedUsers {
+		allowedUsers[i] = strings.ToLower(user)
+	}
+
 	entry, err := logical.StorageEntryJSON("config", config{
-		Org:     organization,
-		BaseURL: baseURL,
-		TTL:     ttl,
-		MaxTTL:  maxTTL,
+		Org:             organization,
+		BaseURL:         baseURL,
+		TTL:             ttl,
+		MaxTTL:          maxTTL,
+		AllowedUsers:    allowedUsers,
+		RequiredOrgRole: requiredOrgRole,
+		RequiredScopes:  data.Get("required_scopes").([]string),
+		MapTeamsBy:      mapTeamsBy,
 	})
 
 	if err != nil {
@@ -109,9 +179,37 @@ func (b *backend) Config(s logical.Storage) (*config, error) {
 	return &result, nil
 }
 
+// The ways teams are mapped to policies
+const (
+	mapTeamsByNameAndSlug = "name_and_slug"
+	mapTeamsBySlug        = "slug"
+)
+
 type config struct {
 	Org     string        `json:"organization"`
 	BaseURL string        `json:"base_url"`
 	TTL     time.Duration `json:"ttl"`
 	MaxTTL  time.Duration `json:"max_ttl"`
+
+	// AllowedUsers are the lowercased logins of the users allowed to log
+	// in, or empty to allow any member of the organization
+	AllowedUsers []string `json:"allowed_users"`
+
+	// RequiredOrgRole is the role of the active organization membership
+	// users must have, if set
+	RequiredOrgRole string `json:"required_org_role"`
+
+	// RequiredScopes are the OAuth scopes tokens must have
+	RequiredScopes []string `json:"required_scopes"`
+
+	MapTeamsBy string `json:"map_teams_by"`
+}
+
+// teamMapping returns how teams are mapped to policies, which is by name and
+// slug for configurations written before it could be set
+func (c *config) teamMapping() string {
+	if c.MapTeamsBy == "" {
+		return mapTeamsByNameAndSlug
+	}
+	return c.MapTeamsBy
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/google/go-github/github"
 	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -126,11 +127,31 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 	}
 
 	// Get the user
-	user, _, err := client.Users.Get("")
+	user, userResp, err := client.Users.Get("")
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if len(config.AllowedUsers) != 0 && !strutil.StrListContains(config.AllowedUsers, strings.ToLower(*user.Login)) {
+		return nil, logical.ErrorResponse("user is not allowed to log in"), nil
+	}
+
+	// Verify that the token has the required scopes, which GitHub returns
+	// in a header of every response
+	if len(config.RequiredScopes) != 0 {
+		var scopes []string
+		for _, scope := range strings.Split(userResp.Header.Get("X-OAuth-Scopes"), ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+		for _, required := range config.RequiredScopes {
+			if !hasScope(scopes, required) {
+				return nil, logical.ErrorResponse(fmt.Sprintf("token does not have required scope %q", required)), nil
+			}
+		}
+	}
+
 	// Verify that the user is part of the organization
 	var org *github.Organization
 
@@ -161,6 +182,21 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 		return nil, logical.ErrorResponse("user is not part of required org"), nil
 	}
 
+	// Listed organizations include pending invitations, so the membership
+	// is checked when a role is required
+	if config.RequiredOrgRole != "" {
+		membership, _, err := client.Organizations.GetOrgMembership("", *org.Login)
+		if err != nil {
+			return nil, nil, err
+		}
+		if membership.State == nil || *membership.State != "active" {
+			return nil, logical.ErrorResponse("user is not an active member of required org"), nil
+		}
+		if config.RequiredOrgRole == "admin" && (membership.Role == nil || *membership.Role != "admin") {
+			return nil, logical.ErrorResponse("user is not an admin of required org"), nil
+		}
+	}
+
 	// Get the teams that this user is part of to determine the policies
 	var teamNames []string
 
@@ -187,7 +223,12 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 			continue
 		}
 
-		// Append the names so we can get the policies
+		// Append the names so we can get the policies. Slugs are kept
+		// when display names change, so they can be used on their own.
+		if config.teamMapping() == mapTeamsBySlug {
+			teamNames = append(teamNames, *t.Slug)
+			continue
+		}
 		teamNames = append(teamNames, *t.Name)
 		if *t.Name != *t.Slug {
 			teamNames = append(teamNames, *t.Slug)
@@ -205,6 +246,33 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 	}, nil, nil
 }
 
+// hasScope returns whether the granted OAuth scopes include the required
+// scope, directly or through a broader scope: "admin:org" includes
+// "write:org", which includes "read:org", and "repo" includes "repo:status"
+func hasScope(granted []string, required string) bool {
+	for _, scope := range granted {
+		if scope == required || strings.HasPrefix(required, scope+":") {
+			return true
+		}
+
+		i := strings.Index(required, ":")
+		if i == -1 || !strings.HasSuffix(scope, required[i:]) {
+			continue
+		}
+		switch required[:i] {
+		case "read":
+			if strings.HasPrefix(scope, "write:") || strings.HasPrefix(scope, "admin:") {
+				return true
+			}
+		case "write":
+			if strings.HasPrefix(scope, "admin:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type verifyCredentialsResp struct {
 	User     *github.User
 	Org      *github.Organization
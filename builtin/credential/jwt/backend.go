@@ -0,0 +1,99 @@
+package jwt
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+type backend struct {
+	*framework.Backend
+
+	// Lock to make changes to the backend's configuration
+	configMutex sync.RWMutex
+
+	// Lock to make changes to role entries
+	roleMutex sync.RWMutex
+
+	// Lock protecting the cached provider details and keys
+	cacheMutex sync.Mutex
+
+	// discovery is the cached discovery document of the OIDC provider, and
+	// cachedKeys the keys fetched from the JWKS. Both are reset when the
+	// configuration is written.
+	discovery  *discoveryDoc
+	cachedKeys []*jwtutil.PublicKey
+
+	// Lock protecting the OIDC states
+	oidcStateMutex sync.Mutex
+
+	// oidcStates holds the pending OIDC authorization requests, keyed by
+	// their state parameter
+	oidcStates map[string]*oidcState
+
+	// now returns the current time. It is replaced in tests.
+	now func() time.Time
+}
+
+func Backend() *backend {
+	b := &backend{
+		oidcStates: make(map[string]*oidcState),
+		now:        time.Now,
+	}
+
+	b.Backend = &framework.Backend{
+		AuthRenew: b.pathLoginRenew,
+		Help:      backendHelp,
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+				"oidc/auth_url",
+				"oidc/callback",
+			},
+		},
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathRole(b),
+			pathListRoles(b),
+			pathLogin(b),
+			pathOIDCAuthURL(b),
+			pathOIDCCallback(b),
+		},
+	}
+
+	return b
+}
+
+// resetCache drops the cached provider details and keys, so that they are
+// fetched again with the current configuration
+func (b *backend) resetCache() {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	b.discovery = nil
+	b.cachedKeys = nil
+}
+
+const backendHelp = `
+The JWT credential provider allows authentication using JWTs issued by an
+external identity provider, such as an OpenID Connect provider.
+
+JWTs are verified with statically configured public keys, with the keys of
+a JWKS, or with the keys of an OpenID Connect provider found through
+discovery. Their claims are then matched against the bounds of a role,
+which determines the policies of the issued token.
+
+With an OpenID Connect provider, users can also log in through the
+authorization code flow, using the "oidc/auth_url" and "oidc/callback"
+routes.
+
+After enabling the credential provider, use the "config" route to configure
+how JWTs are verified, and the "role" route to create roles.
+`
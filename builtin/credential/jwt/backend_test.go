@@ -0,0 +1,594 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/jwtutil"
+	vaulthttp "github.com/hashicorp/vault/http"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func publicKeyPEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func testClaims(issuer string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":    issuer,
+		"sub":    "alice",
+		"aud":    []string{"vault", "other"},
+		"exp":    now.Add(time.Minute).Unix(),
+		"iat":    now.Unix(),
+		"email":  "alice@example.com",
+		"groups": []string{"dev", "ops"},
+	}
+}
+
+func generateKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaKey, ecKey
+}
+
+func TestBackend_Config(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	rsaKey, _ := generateKeys(t)
+
+	jwks := jwksServer(t, map[string]crypto.Signer{"1": rsaKey})
+	defer jwks.Close()
+
+	cases := []map[string]interface{}{
+		{},
+		{"jwt_validation_pubkeys": "bogus"},
+		{"jwt_validation_pubkeys": publicKeyPEM(t, rsaKey), "jwks_url": jwks.URL},
+		{"jwks_url": jwks.URL + "/bogus"},
+		{"oidc_discovery_url": jwks.URL + "/jwks"},
+	}
+	for _, data := range cases {
+		resp := testWrite(t, b, storage, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "config", map[string]interface{}{
+		"jwks_url":           jwks.URL,
+		"oidc_client_secret": "secret",
+		"bound_issuer":       "issuer",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["jwks_url"] != jwks.URL || resp.Data["bound_issuer"] != "issuer" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["oidc_client_secret"]; ok {
+		t.Fatalf("client secret should not be returned: %#v", resp.Data)
+	}
+}
+
+func TestBackend_Role(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	cases := []map[string]interface{}{
+		{"policies": "dev"},
+		{"role_type": "bogus", "bound_subject": "alice"},
+		{"role_type": "oidc"},
+		{"bound_subject": "alice", "user_claim": ""},
+		{"bound_claims": map[string]interface{}{"groups": 1}},
+		{"bound_subject": "alice", "claim_mappings": map[string]interface{}{"email": "role"}},
+		{"bound_subject": "alice", "ttl": 600, "max_ttl": 60},
+	}
+	for _, data := range cases {
+		resp := testWrite(t, b, storage, "role/dev", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "role/dev", map[string]interface{}{
+		"bound_audiences": "vault",
+		"bound_claims": map[string]interface{}{
+			"groups": []interface{}{"dev", "admin"},
+		},
+		"claim_mappings": map[string]interface{}{
+			"email": "email",
+		},
+		"policies": "dev",
+		"ttl":      600,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/dev",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["ttl"].(time.Duration) != 600 ||
+		resp.Data["role_type"] != "jwt" ||
+		resp.Data["user_claim"] != "sub" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	boundClaims := resp.Data["bound_claims"].(map[string][]string)
+	if len(boundClaims["groups"]) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "role/",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 1 || keys[0] != "dev" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	rsaKey, ecKey := generateKeys(t)
+
+	login := func(role string, claims map[string]interface{}) *logical.Response {
+		return testWrite(t, b, storage, "login", map[string]interface{}{
+			"role": role,
+			"jwt":  jwtutil.TestSign(t, ecKey, "", claims),
+		})
+	}
+
+	testWrite(t, b, storage, "role/dev", map[string]interface{}{
+		"bound_audiences": "vault",
+		"bound_claims": map[string]interface{}{
+			"groups": []interface{}{"dev", "admin"},
+		},
+		"claim_mappings": map[string]interface{}{
+			"email":  "email",
+			"groups": "groups",
+		},
+		"user_claim": "email",
+		"policies":   "dev",
+	})
+
+	// The backend must be configured first
+	if resp := login("dev", testClaims("issuer")); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"jwt_validation_pubkeys": []string{publicKeyPEM(t, rsaKey), publicKeyPEM(t, ecKey)},
+		"bound_issuer":           "issuer",
+		"default_role":           "dev",
+	})
+
+	resp := login("", testClaims("issuer"))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if len(resp.Auth.Policies) != 2 || resp.Auth.Policies[0] != "default" || resp.Auth.Policies[1] != "dev" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if resp.Auth.DisplayName != "alice@example.com" ||
+		resp.Auth.Metadata["role"] != "dev" ||
+		resp.Auth.Metadata["email"] != "alice@example.com" ||
+		resp.Auth.Metadata["groups"] != "dev,ops" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	auth := resp.Auth
+
+	// JWTs whose claims do not match the role are rejected
+	for _, tweak := range []func(map[string]interface{}){
+		func(c map[string]interface{}) { c["iss"] = "other" },
+		func(c map[string]interface{}) { c["aud"] = "other" },
+		func(c map[string]interface{}) { c["groups"] = []string{"ops"} },
+		func(c map[string]interface{}) { delete(c, "email") },
+	} {
+		claims := testClaims("issuer")
+		tweak(claims)
+		if resp := login("dev", claims); resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", claims, resp)
+		}
+	}
+	if resp := login("bogus", testClaims("issuer")); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// OIDC roles cannot be used to login with a JWT
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"role_type":             "oidc",
+		"allowed_redirect_uris": "https://vault.example.com/callback",
+	})
+	if resp := login("web", testClaims("issuer")); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// Tokens are renewed as long as the role keeps the same policies
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Auth:      auth,
+	}
+	auth.IssueTime = time.Now()
+	resp, err := b.HandleRequest(renewReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	testWrite(t, b, storage, "role/dev", map[string]interface{}{
+		"policies": "admin",
+	})
+	if _, err := b.HandleRequest(renewReq); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+// testProvider is an OIDC provider, serving its discovery document, JWKS
+// and token endpoint
+type testProvider struct {
+	sync.Mutex
+	t      *testing.T
+	server *httptest.Server
+	keys   map[string]crypto.Signer
+
+	// codes maps the authorization codes to the claims of the ID tokens
+	// they are exchanged for
+	codes map[string]map[string]interface{}
+}
+
+func jwksServer(t *testing.T, keys map[string]crypto.Signer) *httptest.Server {
+	p := &testProvider{t: t, keys: keys}
+	p.server = httptest.NewServer(p)
+	return p.server
+}
+
+func newTestProvider(t *testing.T, keys map[string]crypto.Signer) *testProvider {
+	p := &testProvider{
+		t:     t,
+		keys:  keys,
+		codes: make(map[string]map[string]interface{}),
+	}
+	p.server = httptest.NewServer(p)
+	return p
+}
+
+func (p *testProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.Lock()
+	defer p.Unlock()
+
+	switch r.URL.Path {
+	case "/", "/jwks":
+		var jwks struct {
+			Keys []jwtutil.JSONWebKey `json:"keys"`
+		}
+		for kid, key := range p.keys {
+			pub := key.Public().(*rsa.PublicKey)
+			jwks.Keys = append(jwks.Keys, jwtutil.JSONWebKey{
+				Kty: "RSA",
+				Kid: kid,
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(&jwks)
+	case "/.well-known/openid-configuration":
+		json.NewEncoder(w).Encode(&discoveryDoc{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/auth",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	case "/token":
+		claims, ok := p.codes[r.FormValue("code")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var kid string
+		var key crypto.Signer
+		for kid, key = range p.keys {
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     jwtutil.TestSign(p.t, key, kid, claims),
+		})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBackend_JWKSRotation(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	key1, _ := generateKeys(t)
+	key2, _ := generateKeys(t)
+
+	provider := newTestProvider(t, map[string]crypto.Signer{"1": key1})
+	defer provider.server.Close()
+
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"jwks_url": provider.server.URL + "/jwks",
+	})
+	testWrite(t, b, storage, "role/dev", map[string]interface{}{
+		"bound_subject": "alice",
+	})
+
+	login := func(key crypto.Signer, kid string) *logical.Response {
+		return testWrite(t, b, storage, "login", map[string]interface{}{
+			"role": "dev",
+			"jwt":  jwtutil.TestSign(t, key, kid, testClaims("issuer")),
+		})
+	}
+
+	if resp := login(key1, "1"); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// A JWT signed with a new key is verified once the JWKS is fetched
+	// again
+	provider.Lock()
+	provider.keys["2"] = key2
+	provider.Unlock()
+	if resp := login(key2, "2"); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Known key IDs do not cause the JWKS to be fetched again
+	if resp := login(key1, "2"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
+
+func TestBackend_OIDC(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+	key, _ := generateKeys(t)
+
+	provider := newTestProvider(t, map[string]crypto.Signer{"1": key})
+	defer provider.server.Close()
+
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"oidc_discovery_url": provider.server.URL,
+		"oidc_client_id":     "vault",
+		"oidc_client_secret": "secret",
+	})
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"role_type":             "oidc",
+		"allowed_redirect_uris": "https://vault.example.com/callback",
+		"oidc_scopes":           "email",
+		"policies":              "web",
+	})
+
+	authURL := func(redirectURI string) *logical.Response {
+		return testWrite(t, b, storage, "oidc/auth_url", map[string]interface{}{
+			"role":         "web",
+			"redirect_uri": redirectURI,
+		})
+	}
+	callback := func(state, code string) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      "oidc/callback",
+			Storage:   storage,
+			Data: map[string]interface{}{
+				"state": state,
+				"code":  code,
+			},
+		})
+		if err != nil {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	if resp := authURL("https://evil.example.com/callback"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// start returns the state and nonce of a new authorization request
+	start := func() (string, string) {
+		resp := authURL("https://vault.example.com/callback")
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		u, err := url.Parse(resp.Data["auth_url"].(string))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := u.Query()
+		if u.Path != "/auth" ||
+			query.Get("client_id") != "vault" ||
+			query.Get("redirect_uri") != "https://vault.example.com/callback" ||
+			query.Get("scope") != "openid email" {
+			t.Fatalf("bad: %s", u)
+		}
+		return query.Get("state"), query.Get("nonce")
+	}
+
+	claims := func(nonce string) map[string]interface{} {
+		c := testClaims(provider.server.URL)
+		c["nonce"] = nonce
+		return c
+	}
+
+	state, nonce := start()
+	provider.Lock()
+	provider.codes["good"] = claims(nonce)
+	provider.codes["bad-nonce"] = claims("bogus")
+	provider.Unlock()
+
+	resp := callback(state, "good")
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp.Auth.DisplayName != "alice" || resp.Auth.Metadata["role"] != "web" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// States can only be used once
+	if resp := callback(state, "good"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// ID tokens must carry the nonce of the request
+	state, _ = start()
+	if resp := callback(state, "bad-nonce"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// States expire
+	state, nonce = start()
+	provider.Lock()
+	provider.codes["late"] = claims(nonce)
+	provider.Unlock()
+	b.now = func() time.Time { return time.Now().Add(2 * oidcStateTTL) }
+	if resp := callback(state, "late"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
+
+// The provider redirects the browser to the callback with the state and code
+// in the query string, which must reach the backend
+func TestBackend_OIDCCallbackHTTP(t *testing.T) {
+	if err := vault.AddTestCredentialBackend("jwt", Factory); err != nil {
+		t.Fatal(err)
+	}
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := vaulthttp.TestServer(t, core)
+	defer ln.Close()
+
+	key, _ := generateKeys(t)
+	provider := newTestProvider(t, map[string]crypto.Signer{"1": key})
+	defer provider.server.Close()
+
+	config := api.DefaultConfig()
+	config.Address = addr
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(token)
+
+	if err := client.Sys().EnableAuth("jwt", "jwt", ""); err != nil {
+		t.Fatal(err)
+	}
+	for path, data := range map[string]map[string]interface{}{
+		"auth/jwt/config": {
+			"oidc_discovery_url": provider.server.URL,
+			"oidc_client_id":     "vault",
+			"oidc_client_secret": "secret",
+		},
+		"auth/jwt/role/web": {
+			"role_type":             "oidc",
+			"allowed_redirect_uris": "https://vault.example.com/callback",
+			"policies":              "web",
+		},
+	} {
+		if _, err := client.Logical().Write(path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	secret, err := client.Logical().Write("auth/jwt/oidc/auth_url", map[string]interface{}{
+		"role":         "web",
+		"redirect_uri": "https://vault.example.com/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(secret.Data["auth_url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := testClaims(provider.server.URL)
+	claims["nonce"] = u.Query().Get("nonce")
+	provider.Lock()
+	provider.codes["good"] = claims
+	provider.Unlock()
+
+	query := url.Values{}
+	query.Set("state", u.Query().Get("state"))
+	query.Set("code", "good")
+	resp, err := http.Get(addr + "/v1/auth/jwt/oidc/callback?" + query.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("bad: %d", resp.StatusCode)
+	}
+	secret, err = api.ParseSecret(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.Auth == nil || secret.Auth.ClientToken == "" ||
+		secret.Auth.Metadata["role"] != "web" {
+		t.Fatalf("bad: %#v", secret)
+	}
+}
@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/jwtutil"
+)
+
+// httpClient returns a client trusting the given PEM encoded CA
+// certificates, or the system roots if none are given
+func httpClient(caPEM string) (*http.Client, error) {
+	client := cleanhttp.DefaultClient()
+	if caPEM == "" {
+		return client, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, fmt.Errorf("could not parse CA certificates")
+	}
+	transport := cleanhttp.DefaultTransport()
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs: pool,
+	}
+	client.Transport = transport
+	return client, nil
+}
+
+// getJSON decodes the JSON document found at the given URL
+func getJSON(client *http.Client, url string, out interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, url)
+	}
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, out); err != nil {
+		return fmt.Errorf("error decoding %s: %s", url, err)
+	}
+	return nil
+}
+
+// fetchJWKS fetches the keys of the JWKS at the given URL
+func fetchJWKS(client *http.Client, url string) ([]*jwtutil.PublicKey, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d fetching %s", resp.StatusCode, url)
+	}
+	keys, err := jwtutil.ParseJWKS(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching %s: %s", url, err)
+	}
+	return keys, nil
+}
+
+// discoveryDoc is the OpenID Connect discovery document of a provider,
+// limited to the fields used here
+type discoveryDoc struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// fetchDiscovery fetches the discovery document of the OpenID Connect
+// provider at the given URL, whose issuer must be that URL
+func fetchDiscovery(client *http.Client, discoveryURL string) (*discoveryDoc, error) {
+	wellKnown := strings.TrimSuffix(discoveryURL, "/") + "/.well-known/openid-configuration"
+
+	var doc discoveryDoc
+	if err := getJSON(client, wellKnown, &doc); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(discoveryURL, "/") {
+		return nil, fmt.Errorf("issuer %q of the discovery document does not match %q", doc.Issuer, discoveryURL)
+	}
+	if doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document has no jwks_uri")
+	}
+	return &doc, nil
+}
@@ -0,0 +1,260 @@
+package jwt
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"jwt_validation_pubkeys": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "List of PEM encoded public keys or certificates used to verify JWTs.",
+			},
+
+			"jwks_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "URL of a JWKS whose keys are used to verify JWTs.",
+			},
+
+			"jwks_ca_pem": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificates used to verify the certificate of the JWKS URL.",
+			},
+
+			"oidc_discovery_url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `URL of an OpenID Connect provider, whose discovery document is found at
+'/.well-known/openid-configuration' under it.`,
+			},
+
+			"oidc_discovery_ca_pem": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificates used to verify the certificate of the OIDC provider.",
+			},
+
+			"oidc_client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The client ID of Vault with the OIDC provider, used in the authorization code flow.",
+			},
+
+			"oidc_client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The client secret of Vault with the OIDC provider, used in the authorization code flow.",
+			},
+
+			"bound_issuer": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The value the "iss" claim of JWTs must match. With OIDC discovery, it
+defaults to the issuer of the provider.`,
+			},
+
+			"default_role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The role used when none is given at login.",
+			},
+		},
+
+		ExistenceCheck: b.pathConfigExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConfigWrite,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathConfigExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+// lockedConfig returns the configuration of the backend, after acquiring
+// the configuration lock
+func (b *backend) lockedConfig(s logical.Storage) (*jwtConfig, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	return b.nonLockedConfig(s)
+}
+
+// nonLockedConfig returns the configuration of the backend
+func (b *backend) nonLockedConfig(s logical.Storage) (*jwtConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result jwtConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The client secret is a credential, so it is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"jwt_validation_pubkeys": config.JWTValidationPubKeys,
+			"jwks_url":               config.JWKSURL,
+			"jwks_ca_pem":            config.JWKSCAPEM,
+			"oidc_discovery_url":     config.OIDCDiscoveryURL,
+			"oidc_discovery_ca_pem":  config.OIDCDiscoveryCAPEM,
+			"oidc_client_id":         config.OIDCClientID,
+			"bound_issuer":           config.BoundIssuer,
+			"default_role":           config.DefaultRole,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	config, err := b.nonLockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &jwtConfig{}
+	}
+
+	if pubKeysRaw, ok := data.GetOk("jwt_validation_pubkeys"); ok {
+		config.JWTValidationPubKeys = pubKeysRaw.([]string)
+	}
+	if jwksURLRaw, ok := data.GetOk("jwks_url"); ok {
+		config.JWKSURL = jwksURLRaw.(string)
+	}
+	if jwksCAPEMRaw, ok := data.GetOk("jwks_ca_pem"); ok {
+		config.JWKSCAPEM = jwksCAPEMRaw.(string)
+	}
+	if discoveryURLRaw, ok := data.GetOk("oidc_discovery_url"); ok {
+		config.OIDCDiscoveryURL = discoveryURLRaw.(string)
+	}
+	if discoveryCAPEMRaw, ok := data.GetOk("oidc_discovery_ca_pem"); ok {
+		config.OIDCDiscoveryCAPEM = discoveryCAPEMRaw.(string)
+	}
+	if clientIDRaw, ok := data.GetOk("oidc_client_id"); ok {
+		config.OIDCClientID = clientIDRaw.(string)
+	}
+	if clientSecretRaw, ok := data.GetOk("oidc_client_secret"); ok {
+		config.OIDCClientSecret = clientSecretRaw.(string)
+	}
+	if boundIssuerRaw, ok := data.GetOk("bound_issuer"); ok {
+		config.BoundIssuer = boundIssuerRaw.(string)
+	}
+	if defaultRoleRaw, ok := data.GetOk("default_role"); ok {
+		config.DefaultRole = defaultRoleRaw.(string)
+	}
+
+	// Exactly one source of keys must be configured
+	sources := 0
+	for _, set := range []bool{
+		len(config.JWTValidationPubKeys) != 0,
+		config.JWKSURL != "",
+		config.OIDCDiscoveryURL != "",
+	} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return logical.ErrorResponse("exactly one of jwt_validation_pubkeys, jwks_url and oidc_discovery_url must be set"), nil
+	}
+
+	// Check that the keys can be obtained with the new configuration
+	switch {
+	case len(config.JWTValidationPubKeys) != 0:
+		if _, err := jwtutil.ParsePublicKeysPEM(config.JWTValidationPubKeys); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error parsing jwt_validation_pubkeys: %s", err)), nil
+		}
+	case config.JWKSURL != "":
+		client, err := httpClient(config.JWKSCAPEM)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error parsing jwks_ca_pem: %s", err)), nil
+		}
+		if _, err := fetchJWKS(client, config.JWKSURL); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error fetching JWKS: %s", err)), nil
+		}
+	case config.OIDCDiscoveryURL != "":
+		client, err := httpClient(config.OIDCDiscoveryCAPEM)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error parsing oidc_discovery_ca_pem: %s", err)), nil
+		}
+		if _, err := fetchDiscovery(client, config.OIDCDiscoveryURL); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error fetching OIDC discovery document: %s", err)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetCache()
+
+	return nil, nil
+}
+
+// jwtConfig holds how JWTs are verified, and how the OIDC provider is
+// reached
+type jwtConfig struct {
+	JWTValidationPubKeys []string `json:"jwt_validation_pubkeys"`
+	JWKSURL              string   `json:"jwks_url"`
+	JWKSCAPEM            string   `json:"jwks_ca_pem"`
+	OIDCDiscoveryURL     string   `json:"oidc_discovery_url"`
+	OIDCDiscoveryCAPEM   string   `json:"oidc_discovery_ca_pem"`
+	OIDCClientID         string   `json:"oidc_client_id"`
+	OIDCClientSecret     string   `json:"oidc_client_secret"`
+	BoundIssuer          string   `json:"bound_issuer"`
+	DefaultRole          string   `json:"default_role"`
+}
+
+const pathConfigHelpSyn = `
+Configures how JWTs are verified.
+`
+
+const pathConfigHelpDesc = `
+JWTs are verified with the keys of exactly one of the following sources:
+
+  * 'jwt_validation_pubkeys', a list of PEM encoded public keys.
+  * 'jwks_url', the URL of a JWKS. The keys are fetched when first needed,
+    and fetched again when a JWT cannot be verified with them.
+  * 'oidc_discovery_url', the URL of an OpenID Connect provider, whose keys
+    are found through its discovery document.
+
+The authorization code flow requires 'oidc_discovery_url', along with the
+'oidc_client_id' and 'oidc_client_secret' of Vault with the provider.
+`
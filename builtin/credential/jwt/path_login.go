@@ -0,0 +1,320 @@
+package jwt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jwtutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role against which the login is being attempted. Defaults to the configured default_role.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The signed JWT to login with.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	rawJWT := data.Get("jwt").(string)
+	if rawJWT == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("configure the jwt credential backend first"), nil
+	}
+
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	if role.RoleType != roleTypeJWT {
+		return logical.ErrorResponse(fmt.Sprintf("role %q can only be used in the OIDC authorization code flow", roleName)), nil
+	}
+
+	token, err := b.verifyJWT(config, rawJWT)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.loginResponse(roleName, role, token)
+}
+
+// verifyJWT parses the given JWT, and checks its signature, times and
+// issuer according to the configuration
+func (b *backend) verifyJWT(config *jwtConfig, rawJWT string) (*jwtutil.JWT, error) {
+	token, err := jwtutil.Parse(rawJWT)
+	if err != nil {
+		return nil, err
+	}
+
+	expectedIssuer := config.BoundIssuer
+	if len(config.JWTValidationPubKeys) != 0 {
+		keys, err := jwtutil.ParsePublicKeysPEM(config.JWTValidationPubKeys)
+		if err != nil {
+			return nil, err
+		}
+		if err := token.Verify(keys); err != nil {
+			return nil, err
+		}
+	} else {
+		keys, err := b.providerKeys(config, false)
+		if err != nil {
+			return nil, err
+		}
+		// Keys may have been rotated since they were fetched, so they are
+		// fetched again if the JWT names a key that is not known
+		if err := token.Verify(keys); err != nil {
+			if token.Header.Kid == "" || jwtutil.HasKeyID(keys, token.Header.Kid) {
+				return nil, err
+			}
+			if keys, err = b.providerKeys(config, true); err != nil {
+				return nil, err
+			}
+			if err := token.Verify(keys); err != nil {
+				return nil, err
+			}
+		}
+
+		if expectedIssuer == "" && config.OIDCDiscoveryURL != "" {
+			discovery, err := b.providerDiscovery(config)
+			if err != nil {
+				return nil, err
+			}
+			expectedIssuer = discovery.Issuer
+		}
+	}
+
+	if err := token.ValidateTimes(b.now()); err != nil {
+		return nil, err
+	}
+	if expectedIssuer != "" {
+		if issuer, _ := token.StringClaim("iss"); issuer != expectedIssuer {
+			return nil, fmt.Errorf("JWT issuer %q does not match the bound issuer", issuer)
+		}
+	}
+	return token, nil
+}
+
+// providerKeys returns the keys of the configured JWKS, or of the OIDC
+// provider. Keys are cached until the configuration is written, unless
+// refresh is set.
+func (b *backend) providerKeys(config *jwtConfig, refresh bool) ([]*jwtutil.PublicKey, error) {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	if b.cachedKeys != nil && !refresh {
+		return b.cachedKeys, nil
+	}
+
+	caPEM := config.JWKSCAPEM
+	jwksURL := config.JWKSURL
+	if config.OIDCDiscoveryURL != "" {
+		discovery, err := b.nonLockedProviderDiscovery(config)
+		if err != nil {
+			return nil, err
+		}
+		caPEM = config.OIDCDiscoveryCAPEM
+		jwksURL = discovery.JWKSURI
+	}
+
+	client, err := httpClient(caPEM)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := fetchJWKS(client, jwksURL)
+	if err != nil {
+		return nil, err
+	}
+	b.cachedKeys = keys
+	return keys, nil
+}
+
+// providerDiscovery returns the discovery document of the OIDC provider
+func (b *backend) providerDiscovery(config *jwtConfig) (*discoveryDoc, error) {
+	b.cacheMutex.Lock()
+	defer b.cacheMutex.Unlock()
+
+	return b.nonLockedProviderDiscovery(config)
+}
+
+// nonLockedProviderDiscovery returns the discovery document of the OIDC
+// provider, fetching it if it is not cached
+func (b *backend) nonLockedProviderDiscovery(config *jwtConfig) (*discoveryDoc, error) {
+	if b.discovery != nil {
+		return b.discovery, nil
+	}
+	if config.OIDCDiscoveryURL == "" {
+		return nil, fmt.Errorf("oidc_discovery_url is not configured")
+	}
+
+	client, err := httpClient(config.OIDCDiscoveryCAPEM)
+	if err != nil {
+		return nil, err
+	}
+	discovery, err := fetchDiscovery(client, config.OIDCDiscoveryURL)
+	if err != nil {
+		return nil, err
+	}
+	b.discovery = discovery
+	return discovery, nil
+}
+
+// validateClaims checks the claims of a verified JWT against the bounds of
+// the role
+func (r *roleEntry) validateClaims(token *jwtutil.JWT) error {
+	if len(r.BoundAudiences) != 0 {
+		if !anyContained(token.StringsClaim("aud"), r.BoundAudiences) {
+			return fmt.Errorf("JWT audience does not match the bound audiences of the role")
+		}
+	}
+
+	if r.BoundSubject != "" {
+		if subject, _ := token.StringClaim("sub"); subject != r.BoundSubject {
+			return fmt.Errorf("JWT subject does not match the bound subject of the role")
+		}
+	}
+
+	for claim, allowed := range r.BoundClaims {
+		if !anyContained(token.StringsClaim(claim), allowed) {
+			return fmt.Errorf("JWT claim %q does not match the bound claims of the role", claim)
+		}
+	}
+	return nil
+}
+
+// anyContained returns whether any of the values is in the list
+func anyContained(values, list []string) bool {
+	for _, value := range values {
+		if strutil.StrListContains(list, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginResponse checks the claims of a verified JWT against the role, and
+// returns the auth of the token issued for it
+func (b *backend) loginResponse(roleName string, role *roleEntry, token *jwtutil.JWT) (*logical.Response, error) {
+	if err := role.validateClaims(token); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	user, ok := token.StringClaim(role.UserClaim)
+	if !ok || user == "" {
+		return logical.ErrorResponse(fmt.Sprintf("JWT has no %q claim", role.UserClaim)), nil
+	}
+
+	metadata := map[string]string{
+		"role": roleName,
+	}
+	for claim, key := range role.ClaimMappings {
+		if values := token.StringsClaim(claim); len(values) != 0 {
+			metadata[key] = strings.Join(values, ",")
+		}
+	}
+
+	ttl, _, err := b.SanitizeTTL(role.TTL, role.MaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.Period > time.Duration(0) {
+		ttl = role.Period
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Period: role.Period,
+			InternalData: map[string]interface{}{
+				"role": roleName,
+			},
+			Policies:    role.Policies,
+			Metadata:    metadata,
+			DisplayName: user,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       ttl,
+				Renewable: true,
+			},
+		},
+	}, nil
+}
+
+// Invoked when the token issued by this backend is attempting a renewal.
+func (b *backend) pathLoginRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, ok := req.Auth.InternalData["role"].(string)
+	if !ok || roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// Ensure that the role still exists, with the same policies
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies on role %s have changed, cannot renew", roleName)
+	}
+
+	// If 'Period' is set on the role, the token should never expire.
+	// Replenish the TTL with 'Period's value.
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, data)
+}
+
+const pathLoginHelpSyn = `
+Authenticates using a JWT issued by an external identity provider.
+`
+
+const pathLoginHelpDesc = `
+The JWT is verified with the configured keys, and must not have expired.
+Its claims must then match the bounds of the given role, which must be of
+type "jwt". If no role is given, the configured 'default_role' is used.
+`
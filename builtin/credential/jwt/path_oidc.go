@@ -0,0 +1,261 @@
+package jwt
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// oidcStateTTL is how long an authorization request can take to complete
+const oidcStateTTL = 10 * time.Minute
+
+// oidcState is a pending OIDC authorization request
+type oidcState struct {
+	roleName    string
+	redirectURI string
+	nonce       string
+	expiration  time.Time
+}
+
+func pathOIDCAuthURL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/auth_url$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role against which the login is being attempted. Defaults to the configured default_role.",
+			},
+			"redirect_uri": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The URI the OIDC provider redirects to after authentication. It must be allowed by the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOIDCAuthURL,
+		},
+
+		HelpSynopsis:    pathOIDCAuthURLHelpSyn,
+		HelpDescription: pathOIDCAuthURLHelpDesc,
+	}
+}
+
+func pathOIDCCallback(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "oidc/callback$",
+		Fields: map[string]*framework.FieldSchema{
+			"state": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The state parameter returned by the OIDC provider.",
+			},
+			"code": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The authorization code returned by the OIDC provider.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathOIDCCallback,
+			logical.UpdateOperation: b.pathOIDCCallback,
+		},
+
+		HelpSynopsis:    pathOIDCCallbackHelpSyn,
+		HelpDescription: pathOIDCCallbackHelpDesc,
+	}
+}
+
+// oidcRole returns the role to use in the authorization code flow, along
+// with the configuration, or an error response
+func (b *backend) oidcRole(s logical.Storage, roleName string) (*jwtConfig, string, *roleEntry, *logical.Response, error) {
+	config, err := b.lockedConfig(s)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if config == nil || config.OIDCDiscoveryURL == "" || config.OIDCClientID == "" {
+		return nil, "", nil, logical.ErrorResponse("the jwt credential backend is not configured for OIDC"), nil
+	}
+
+	if roleName == "" {
+		roleName = config.DefaultRole
+	}
+	if roleName == "" {
+		return nil, "", nil, logical.ErrorResponse("missing role"), nil
+	}
+
+	role, err := b.lockedRole(s, roleName)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	if role == nil {
+		return nil, "", nil, logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+	if role.RoleType != roleTypeOIDC {
+		return nil, "", nil, logical.ErrorResponse(fmt.Sprintf("role %q cannot be used in the OIDC authorization code flow", roleName)), nil
+	}
+	return config, roleName, role, nil, nil
+}
+
+// oauth2Config returns the configuration of the OAuth2 client for the
+// given role
+func (b *backend) oauth2Config(config *jwtConfig, role *roleEntry, redirectURI string) (*oauth2.Config, error) {
+	discovery, err := b.providerDiscovery(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Config{
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  discovery.AuthorizationEndpoint,
+			TokenURL: discovery.TokenEndpoint,
+		},
+		RedirectURL: redirectURI,
+		Scopes:      append([]string{"openid"}, role.OIDCScopes...),
+	}, nil
+}
+
+func (b *backend) pathOIDCAuthURL(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	redirectURI := data.Get("redirect_uri").(string)
+	if redirectURI == "" {
+		return logical.ErrorResponse("missing redirect_uri"), nil
+	}
+
+	config, roleName, role, resp, err := b.oidcRole(req.Storage, data.Get("role").(string))
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	if !strutil.StrListContains(role.AllowedRedirectURIs, redirectURI) {
+		return logical.ErrorResponse(fmt.Sprintf("redirect_uri %q is not allowed by the role", redirectURI)), nil
+	}
+
+	oauth2Config, err := b.oauth2Config(config, role, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	stateID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	b.oidcStateMutex.Lock()
+	now := b.now()
+	for id, state := range b.oidcStates {
+		if now.After(state.expiration) {
+			delete(b.oidcStates, id)
+		}
+	}
+	b.oidcStates[stateID] = &oidcState{
+		roleName:    roleName,
+		redirectURI: redirectURI,
+		nonce:       nonce,
+		expiration:  now.Add(oidcStateTTL),
+	}
+	b.oidcStateMutex.Unlock()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"auth_url": oauth2Config.AuthCodeURL(stateID, oauth2.SetAuthURLParam("nonce", nonce)),
+		},
+	}, nil
+}
+
+// takeOIDCState removes the given pending authorization request, and
+// returns it unless it has expired
+func (b *backend) takeOIDCState(stateID string) *oidcState {
+	b.oidcStateMutex.Lock()
+	defer b.oidcStateMutex.Unlock()
+
+	state, ok := b.oidcStates[stateID]
+	if !ok {
+		return nil
+	}
+	delete(b.oidcStates, stateID)
+	if b.now().After(state.expiration) {
+		return nil
+	}
+	return state
+}
+
+func (b *backend) pathOIDCCallback(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	code := data.Get("code").(string)
+	if code == "" {
+		return logical.ErrorResponse("missing code"), nil
+	}
+
+	// States can only be used once
+	state := b.takeOIDCState(data.Get("state").(string))
+	if state == nil {
+		return logical.ErrorResponse("invalid or expired state"), nil
+	}
+
+	config, roleName, role, resp, err := b.oidcRole(req.Storage, state.roleName)
+	if resp != nil || err != nil {
+		return resp, err
+	}
+	oauth2Config, err := b.oauth2Config(config, role, state.redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := httpClient(config.OIDCDiscoveryCAPEM)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.WithValue(oauth2.NoContext, oauth2.HTTPClient, client)
+	oauth2Token, err := oauth2Config.Exchange(ctx, code)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error exchanging the authorization code: %s", err)), nil
+	}
+	rawIDToken, ok := oauth2Token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return logical.ErrorResponse("no id_token found in the response of the OIDC provider"), nil
+	}
+
+	token, err := b.verifyJWT(config, rawIDToken)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if nonce, _ := token.StringClaim("nonce"); nonce != state.nonce {
+		return logical.ErrorResponse("invalid ID token nonce"), nil
+	}
+	if !strutil.StrListContains(token.StringsClaim("aud"), config.OIDCClientID) {
+		return logical.ErrorResponse("ID token audience does not contain the client ID"), nil
+	}
+
+	return b.loginResponse(roleName, role, token)
+}
+
+const pathOIDCAuthURLHelpSyn = `
+Returns the URL to start the OIDC authorization code flow with.
+`
+
+const pathOIDCAuthURLHelpDesc = `
+The user is sent to the returned URL to authenticate with the OIDC
+provider, which then redirects to 'redirect_uri' with a state and a code.
+These are given to the "oidc/callback" route to complete the login. The
+role must be of type "oidc", and must allow 'redirect_uri'.
+`
+
+const pathOIDCCallbackHelpSyn = `
+Completes the OIDC authorization code flow.
+`
+
+const pathOIDCCallbackHelpDesc = `
+The code returned by the OIDC provider is exchanged for an ID token, whose
+claims must match the bounds of the role the flow was started with. A
+state can only be used once, within 10 minutes of being created.
+`
@@ -0,0 +1,394 @@
+package jwt
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	roleTypeJWT  = "jwt"
+	roleTypeOIDC = "oidc"
+)
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"role_type": {
+				Type:    framework.TypeString,
+				Default: roleTypeJWT,
+				Description: `Type of the role, either "jwt" for logins with a JWT, or "oidc" for the
+OIDC authorization code flow.`,
+			},
+			"bound_audiences": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma separated list of audiences, one of which the "aud" claim must contain.`,
+			},
+			"user_claim": {
+				Type:        framework.TypeString,
+				Default:     "sub",
+				Description: "The claim identifying the user, used as the display name of the token.",
+			},
+			"bound_subject": {
+				Type:        framework.TypeString,
+				Description: `The value the "sub" claim must match.`,
+			},
+			"bound_claims": {
+				Type: framework.TypeMap,
+				Description: `Map of claims to the values they must match. A claim given a list of
+values must match one of them.`,
+			},
+			"claim_mappings": {
+				Type:        framework.TypeMap,
+				Description: "Map of claims to the metadata keys of the token they are copied to.",
+			},
+			"policies": {
+				Type:        framework.TypeString,
+				Default:     "default",
+				Description: "Policies to be set on tokens issued using this role.",
+			},
+			"ttl": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `Duration in seconds after which the issued token should expire. Defaults
+to 0, in which case the value will fallback to the system/mount defaults.`,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Default:     0,
+				Description: "The maximum allowed lifetime of tokens issued using this role.",
+			},
+			"period": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `If set, indicates that the token generated using this role should never
+expire. The token should be renewed within the duration specified by this
+value. At each renewal, the token's TTL will be set to the value of this
+parameter.`,
+			},
+			"allowed_redirect_uris": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the redirect URIs allowed in the OIDC authorization code flow.",
+			},
+			"oidc_scopes": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: `Comma separated list of scopes requested in the OIDC authorization code flow, in addition to "openid".`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathListRolesHelpSyn,
+		HelpDescription: pathListRolesHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathRoleExistenceCheck(req *logical.Request, data *framework.FieldData) (bool, error) {
+	entry, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return false, err
+	}
+	return entry != nil, nil
+}
+
+// lockedRole returns the role with the given name, after acquiring the
+// role lock
+func (b *backend) lockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	return b.nonLockedRole(s, roleName)
+}
+
+// nonLockedRole returns the role with the given name
+func (b *backend) nonLockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	return nil, req.Storage.Delete("role/" + strings.ToLower(roleName))
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	respData := structs.New(role).Map()
+
+	// Display the durations in seconds
+	respData["ttl"] = role.TTL / time.Second
+	respData["max_ttl"] = role.MaxTTL / time.Second
+	respData["period"] = role.Period / time.Second
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(data.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	role, err := b.nonLockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	// Defaults are applied to new roles, whether they are written with a
+	// create or an update operation
+	newRole := role == nil
+	if newRole {
+		role = &roleEntry{}
+	}
+
+	if roleTypeRaw, ok := data.GetOk("role_type"); ok {
+		role.RoleType = roleTypeRaw.(string)
+	} else if newRole {
+		role.RoleType = data.Get("role_type").(string)
+	}
+	if role.RoleType != roleTypeJWT && role.RoleType != roleTypeOIDC {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role_type %q", role.RoleType)), nil
+	}
+
+	if audiencesRaw, ok := data.GetOk("bound_audiences"); ok {
+		role.BoundAudiences = audiencesRaw.([]string)
+	}
+	if userClaimRaw, ok := data.GetOk("user_claim"); ok {
+		role.UserClaim = userClaimRaw.(string)
+	} else if newRole {
+		role.UserClaim = data.Get("user_claim").(string)
+	}
+	if role.UserClaim == "" {
+		return logical.ErrorResponse("user_claim cannot be empty"), nil
+	}
+	if subjectRaw, ok := data.GetOk("bound_subject"); ok {
+		role.BoundSubject = subjectRaw.(string)
+	}
+
+	if boundClaimsRaw, ok := data.GetOk("bound_claims"); ok {
+		role.BoundClaims = make(map[string][]string)
+		for claim, value := range boundClaimsRaw.(map[string]interface{}) {
+			switch v := value.(type) {
+			case string:
+				role.BoundClaims[claim] = []string{v}
+			case []interface{}:
+				for _, item := range v {
+					s, ok := item.(string)
+					if !ok {
+						return logical.ErrorResponse(fmt.Sprintf("bound_claims value for %q must be a string or a list of strings", claim)), nil
+					}
+					role.BoundClaims[claim] = append(role.BoundClaims[claim], s)
+				}
+			default:
+				return logical.ErrorResponse(fmt.Sprintf("bound_claims value for %q must be a string or a list of strings", claim)), nil
+			}
+		}
+	}
+
+	if claimMappingsRaw, ok := data.GetOk("claim_mappings"); ok {
+		role.ClaimMappings = make(map[string]string)
+		targets := make(map[string]bool)
+		for claim, value := range claimMappingsRaw.(map[string]interface{}) {
+			key, ok := value.(string)
+			if !ok || key == "" {
+				return logical.ErrorResponse(fmt.Sprintf("claim_mappings value for %q must be a metadata key", claim)), nil
+			}
+			// The role name is always set in the metadata
+			if key == "role" || targets[key] {
+				return logical.ErrorResponse(fmt.Sprintf("metadata key %q cannot be used twice in claim_mappings", key)), nil
+			}
+			targets[key] = true
+			role.ClaimMappings[claim] = key
+		}
+	}
+
+	if redirectURIsRaw, ok := data.GetOk("allowed_redirect_uris"); ok {
+		role.AllowedRedirectURIs = redirectURIsRaw.([]string)
+		for _, uri := range role.AllowedRedirectURIs {
+			if _, err := url.Parse(uri); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error parsing redirect URI %q: %s", uri, err)), nil
+			}
+		}
+	}
+	if scopesRaw, ok := data.GetOk("oidc_scopes"); ok {
+		role.OIDCScopes = scopesRaw.([]string)
+	}
+
+	switch role.RoleType {
+	case roleTypeJWT:
+		// Roles must be bound, so that any JWT of the issuer cannot login
+		if len(role.BoundAudiences) == 0 && role.BoundSubject == "" && len(role.BoundClaims) == 0 {
+			return logical.ErrorResponse("jwt roles must have at least one of bound_audiences, bound_subject and bound_claims set"), nil
+		}
+	case roleTypeOIDC:
+		if len(role.AllowedRedirectURIs) == 0 {
+			return logical.ErrorResponse("oidc roles must have allowed_redirect_uris set"), nil
+		}
+	}
+
+	if policiesRaw, ok := data.GetOk("policies"); ok {
+		role.Policies = policyutil.ParsePolicies(policiesRaw.(string))
+	} else if newRole {
+		role.Policies = policyutil.ParsePolicies(data.Get("policies").(string))
+	}
+
+	var resp logical.Response
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttlRaw.(int)) * time.Second
+		if defaultLeaseTTL := b.System().DefaultLeaseTTL(); role.TTL > defaultLeaseTTL {
+			resp.AddWarning(fmt.Sprintf("Given ttl of %d seconds greater than current mount/system default of %d seconds; ttl will be capped at login time", role.TTL/time.Second, defaultLeaseTTL/time.Second))
+		}
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+		if systemMaxTTL := b.System().MaxLeaseTTL(); role.MaxTTL > systemMaxTTL {
+			resp.AddWarning(fmt.Sprintf("Given max_ttl of %d seconds greater than current mount/system default of %d seconds; max_ttl will be capped at login time", role.MaxTTL/time.Second, systemMaxTTL/time.Second))
+		}
+	}
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("ttl and max_ttl cannot be negative"), nil
+	}
+	if role.MaxTTL != 0 && role.MaxTTL < role.TTL {
+		return logical.ErrorResponse("ttl should be shorter than max_ttl"), nil
+	}
+
+	if periodRaw, ok := data.GetOk("period"); ok {
+		role.Period = time.Duration(periodRaw.(int)) * time.Second
+		if role.Period > b.System().MaxLeaseTTL() {
+			return logical.ErrorResponse(fmt.Sprintf("period of %d seconds is greater than the backend's maximum TTL of %d seconds", role.Period/time.Second, b.System().MaxLeaseTTL()/time.Second)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Warnings()) == 0 {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// roleEntry binds the claims of JWTs to the policies of the tokens they are
+// issued
+type roleEntry struct {
+	RoleType            string              `json:"role_type" structs:"role_type" mapstructure:"role_type"`
+	BoundAudiences      []string            `json:"bound_audiences" structs:"bound_audiences" mapstructure:"bound_audiences"`
+	UserClaim           string              `json:"user_claim" structs:"user_claim" mapstructure:"user_claim"`
+	BoundSubject        string              `json:"bound_subject" structs:"bound_subject" mapstructure:"bound_subject"`
+	BoundClaims         map[string][]string `json:"bound_claims" structs:"bound_claims" mapstructure:"bound_claims"`
+	ClaimMappings       map[string]string   `json:"claim_mappings" structs:"claim_mappings" mapstructure:"claim_mappings"`
+	Policies            []string            `json:"policies" structs:"policies" mapstructure:"policies"`
+	TTL                 time.Duration       `json:"ttl" structs:"ttl" mapstructure:"ttl"`
+	MaxTTL              time.Duration       `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	Period              time.Duration       `json:"period" structs:"period" mapstructure:"period"`
+	AllowedRedirectURIs []string            `json:"allowed_redirect_uris" structs:"allowed_redirect_uris" mapstructure:"allowed_redirect_uris"`
+	OIDCScopes          []string            `json:"oidc_scopes" structs:"oidc_scopes" mapstructure:"oidc_scopes"`
+}
+
+const pathRoleHelpSyn = `
+Create a role binding the claims of JWTs to policies.
+`
+
+const pathRoleHelpDesc = `
+A role binds JWTs, by the values of their claims, to the policies of the
+tokens they are issued at login.
+
+Roles of type "jwt" are used to log in with a JWT, and must have at least
+one of 'bound_audiences', 'bound_subject' and 'bound_claims' set. Roles of
+type "oidc" are used in the OIDC authorization code flow, and must have
+'allowed_redirect_uris' set.
+
+The value of the 'user_claim' claim is used as the display name of the
+token, and the claims in 'claim_mappings' are copied to its metadata.
+`
+
+const pathListRolesHelpSyn = `
+Lists all the roles that are registered with Vault.
+`
+
+const pathListRolesHelpDesc = `
+Roles will be listed by their respective role names.
+`
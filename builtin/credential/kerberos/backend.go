@@ -0,0 +1,92 @@
+package kerberos
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathConfigLDAP(&b),
+			pathUsers(&b),
+			pathUsersList(&b),
+			pathGroups(&b),
+			pathGroupsList(&b),
+			pathLogin(&b),
+		},
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	b.lookupLDAPGroups = ldap.LookupGroups
+	b.seen = make(map[string]time.Time)
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// lookupLDAPGroups returns the LDAP groups of a user. It is only
+	// replaced in tests.
+	lookupLDAPGroups func(cfg *ldap.ConfigEntry, username string) ([]string, error)
+
+	// seen holds the authenticators used recently, until they are too old
+	// to be accepted anyway, so that they cannot be replayed
+	seenLock sync.Mutex
+	seen     map[string]time.Time
+}
+
+// checkReplay records the authenticator of the given client, and returns an
+// error if it was already used
+func (b *backend) checkReplay(client *clientIdentity, now time.Time) error {
+	b.seenLock.Lock()
+	defer b.seenLock.Unlock()
+
+	for key, expiry := range b.seen {
+		if expiry.Before(now) {
+			delete(b.seen, key)
+		}
+	}
+
+	key := fmt.Sprintf("%s@%s/%d/%d", client.Name, client.Realm, client.CTime.Unix(), client.CUSec)
+	if _, ok := b.seen[key]; ok {
+		return fmt.Errorf("authenticator has already been used")
+	}
+	b.seen[key] = client.CTime.Add(clockSkew)
+	return nil
+}
+
+const backendHelp = `
+The Kerberos credential provider allows authentication with SPNEGO tokens,
+as sent by browsers and HTTP clients of hosts joined to a Kerberos realm or
+an Active Directory domain, so that users can log in without a password.
+
+Tokens are verified with the keytab of the service principal of Vault.
+Policies are associated with users and groups through the "users/" and
+"groups/" endpoints. When an LDAP server is configured with "config/ldap",
+the LDAP groups of users are looked up as well.
+
+After enabling the credential provider, use the "config" endpoint to
+configure it.
+`
@@ -0,0 +1,539 @@
+package kerberos
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testService = "HTTP/vault.example.com"
+	testRealm   = "EXAMPLE.COM"
+)
+
+func TestNFold(t *testing.T) {
+	for _, c := range []struct {
+		in       string
+		n        int
+		expected string
+	}{
+		{"012345", 8, "be072631276b1955"},
+		{"password", 7, "78a07b6caf85fa"},
+		{"Rough Consensus, and Running Code", 8, "bb6ed30870b7f0e0"},
+		{"password", 21, "59e4a8ca7c0385c3c37b3f6d2000247cb6e6bd5b3e"},
+		{"MASSACHVSETTS INSTITVTE OF TECHNOLOGY", 24, "db3b0d8f0b061e603282b308a50841229ad798fab9540c1b"},
+		{"kerberos", 16, "6b65726265726f737b9b5b2b93132b93"},
+	} {
+		if out := hex.EncodeToString(nfold([]byte(c.in), c.n)); out != c.expected {
+			t.Fatalf("%d-fold(%q): expected %s, got %s", c.n*8, c.in, c.expected, out)
+		}
+	}
+}
+
+func TestDecryptCTS(t *testing.T) {
+	key, _ := hex.DecodeString("636869636b656e207465726979616b69")
+	for _, c := range []struct {
+		plaintext  string
+		ciphertext string
+	}{
+		{"I would like the ", "c6353568f2bf8cb4d8a580362da7ff7f97"},
+		{"I would like the General Gau's ", "fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5"},
+		{"I would like the General Gau's C", "39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584"},
+	} {
+		ciphertext, _ := hex.DecodeString(c.ciphertext)
+		plaintext, err := decryptCTS(key, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plaintext) != c.plaintext {
+			t.Fatalf("expected %q, got %q", c.plaintext, plaintext)
+		}
+		if encrypted := testEncryptCTS(t, key, plaintext); !bytes.Equal(encrypted, ciphertext) {
+			t.Fatalf("expected %x, got %x", ciphertext, encrypted)
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	for _, etype := range []int32{etypeAES128CTSHMACSHA196, etypeAES256CTSHMACSHA196, etypeRC4HMAC} {
+		key := testKey(t, etype)
+		for _, size := range []int{0, 1, 16, 37} {
+			plaintext := make([]byte, size)
+			rand.Read(plaintext)
+			ciphertext := testEncrypt(t, etype, key, keyUsageTicket, plaintext)
+
+			decrypted, err := decrypt(etype, key, keyUsageTicket, ciphertext)
+			if err != nil {
+				t.Fatalf("etype %d, size %d: %v", etype, size, err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("etype %d, size %d: expected %x, got %x", etype, size, plaintext, decrypted)
+			}
+
+			// Keys are derived for each usage
+			if _, err := decrypt(etype, key, keyUsageAuthenticator, ciphertext); err == nil {
+				t.Fatalf("etype %d: expected an error with another usage", etype)
+			}
+			ciphertext[len(ciphertext)-1] ^= 1
+			if _, err := decrypt(etype, key, keyUsageTicket, ciphertext); err == nil {
+				t.Fatalf("etype %d: expected an error with a modified ciphertext", etype)
+			}
+		}
+	}
+}
+
+func TestParseKeytab(t *testing.T) {
+	keys := []*keytabEntry{
+		{Principal: testService, Realm: testRealm, KVNO: 2, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)},
+		{Principal: testService, Realm: testRealm, KVNO: 300, EType: etypeRC4HMAC, Key: testKey(t, etypeRC4HMAC)},
+	}
+	raw := testKeytab(keys)
+
+	// Deleted entries are skipped
+	hole := []byte{0xff, 0xff, 0xff, 0xfc, 0, 0, 0, 0}
+	raw = append(raw[:2], append(hole, raw[2:]...)...)
+
+	parsed, err := parseKeytab(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), len(parsed))
+	}
+	for i, key := range keys {
+		if fmt.Sprintf("%#v", parsed[i]) != fmt.Sprintf("%#v", key) {
+			t.Fatalf("expected %#v, got %#v", key, parsed[i])
+		}
+	}
+
+	for _, raw := range [][]byte{nil, {0x05, 0x01}, raw[:len(raw)-3]} {
+		if _, err := parseKeytab(raw); err == nil {
+			t.Fatalf("%x: expected an error", raw)
+		}
+	}
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func TestBackend_Config(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	keytab := base64.StdEncoding.EncodeToString(testKeytab([]*keytabEntry{
+		{Principal: testService, Realm: testRealm, KVNO: 1, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)},
+	}))
+	for _, data := range []map[string]interface{}{
+		{"service_account": testService},
+		{"service_account": testService, "keytab": "not base64"},
+		{"service_account": testService, "keytab": base64.StdEncoding.EncodeToString([]byte{0x05, 0x02})},
+		{"service_account": "HTTP/other.example.com", "keytab": keytab},
+		{"service_account": testService + "@" + testRealm, "keytab": keytab},
+	} {
+		resp := testWrite(t, b, storage, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "config", map[string]interface{}{
+		"service_account": testService,
+		"keytab":          keytab,
+		"ttl":             60,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["service_account"] != testService || resp.Data["ttl"] != time.Duration(60) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["keytab"]; ok {
+		t.Fatalf("keytab should not be returned")
+	}
+
+	// The LDAP server is searched without the password of users
+	resp = testWrite(t, b, storage, "config/ldap", map[string]interface{}{
+		"url": "ldap://ldap.example.com",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	aesKey := &keytabEntry{Principal: testService, Realm: testRealm, KVNO: 3, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)}
+	oldKey := &keytabEntry{Principal: testService, Realm: testRealm, KVNO: 2, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)}
+	rc4Key := &keytabEntry{Principal: testService, Realm: testRealm, KVNO: 3, EType: etypeRC4HMAC, Key: testKey(t, etypeRC4HMAC)}
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"service_account": testService,
+		"keytab":          base64.StdEncoding.EncodeToString(testKeytab([]*keytabEntry{oldKey, aesKey, rc4Key})),
+	})
+	testWrite(t, b, storage, "users/alice", map[string]interface{}{
+		"policies": "alice",
+	})
+	testWrite(t, b, storage, "groups/admins", map[string]interface{}{
+		"policies": "admin",
+	})
+
+	login := func(token string) *logical.Response {
+		return testWrite(t, b, storage, "login", map[string]interface{}{
+			"spnego": token,
+		})
+	}
+
+	// Authenticators are told apart by their time, to the microsecond
+	now := time.Now()
+	next := func() time.Time {
+		now = now.Add(time.Microsecond)
+		return now
+	}
+	for _, key := range []*keytabEntry{aesKey, oldKey, rc4Key} {
+		resp := login(testToken(t, key, "alice", testRealm, now, next()))
+		if resp == nil || resp.IsError() || resp.Auth == nil {
+			t.Fatalf("etype %d, kvno %d: bad: %#v", key.EType, key.KVNO, resp)
+		}
+		if strings.Join(resp.Auth.Policies, ",") != "alice,default" {
+			t.Fatalf("bad policies: %#v", resp.Auth.Policies)
+		}
+		if resp.Auth.Metadata["username"] != "alice" || resp.Auth.Metadata["realm"] != testRealm {
+			t.Fatalf("bad metadata: %#v", resp.Auth.Metadata)
+		}
+	}
+
+	// Tokens cannot be replayed
+	token := testToken(t, aesKey, "alice", testRealm, now, next())
+	if resp := login("Negotiate " + token); resp == nil || resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := login(token); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	wrongKey := &keytabEntry{Principal: testService, Realm: testRealm, KVNO: 3, EType: etypeAES256CTSHMACSHA196, Key: testKey(t, etypeAES256CTSHMACSHA196)}
+	otherService := &keytabEntry{Principal: "HTTP/other.example.com", Realm: testRealm, KVNO: 3, EType: etypeAES256CTSHMACSHA196, Key: aesKey.Key}
+	unknownKVNO := &keytabEntry{Principal: testService, Realm: testRealm, KVNO: 4, EType: etypeAES256CTSHMACSHA196, Key: aesKey.Key}
+	for name, token := range map[string]string{
+		"not base64":        "not base64",
+		"not a token":       base64.StdEncoding.EncodeToString([]byte("token")),
+		"wrong key":         testToken(t, wrongKey, "alice", testRealm, now, now),
+		"other service":     testToken(t, otherService, "alice", testRealm, now, now),
+		"unknown kvno":      testToken(t, unknownKVNO, "alice", testRealm, now, now),
+		"other realm":       testToken(t, aesKey, "alice", "OTHER.COM", now, now),
+		"expired ticket":    testToken(t, aesKey, "alice", testRealm, now.Add(-24*time.Hour), now),
+		"old authenticator": testToken(t, aesKey, "alice", testRealm, now, now.Add(-time.Hour)),
+		"no policies":       testToken(t, aesKey, "bob", testRealm, now, now),
+	} {
+		if resp := login(token); resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected an error: %#v", name, resp)
+		}
+	}
+
+	// The LDAP groups of users are looked up when configured
+	ldapGroups := map[string][]string{
+		"alice": []string{"admins"},
+		"bob":   []string{"admins", "devs"},
+	}
+	b.lookupLDAPGroups = func(cfg *ldap.ConfigEntry, username string) ([]string, error) {
+		if cfg.BindDN != "cn=vault,dc=example,dc=com" {
+			t.Fatalf("bad LDAP configuration: %#v", cfg)
+		}
+		return ldapGroups[username], nil
+	}
+	resp := testWrite(t, b, storage, "config/ldap", map[string]interface{}{
+		"url":      "ldap://ldap.example.com",
+		"binddn":   "cn=vault,dc=example,dc=com",
+		"bindpass": "secret",
+		"userdn":   "ou=People,dc=example,dc=com",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp = login(testToken(t, aesKey, "bob", testRealm, now, next()))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if strings.Join(resp.Auth.Policies, ",") != "admin,default" {
+		t.Fatalf("bad policies: %#v", resp.Auth.Policies)
+	}
+
+	resp = login(testToken(t, aesKey, "alice", testRealm, now, next()))
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if strings.Join(resp.Auth.Policies, ",") != "admin,alice,default" {
+		t.Fatalf("bad policies: %#v", resp.Auth.Policies)
+	}
+
+	// Renewals check the groups again
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login",
+		Storage:   storage,
+		Auth:      resp.Auth,
+	}
+	renewReq.Auth.IssueTime = time.Now()
+	if _, err := b.pathLoginRenew(renewReq, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ldapGroups["alice"] = nil
+	if _, err := b.pathLoginRenew(renewReq, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func testKey(t *testing.T, etype int32) []byte {
+	size := 16
+	if etype == etypeAES256CTSHMACSHA196 {
+		size = 32
+	}
+	key := make([]byte, size)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testKeytab returns a keytab holding the given keys
+func testKeytab(keys []*keytabEntry) []byte {
+	buf := []byte{0x05, 0x02}
+	for _, key := range keys {
+		var record bytes.Buffer
+		writeString := func(s string) {
+			binary.Write(&record, binary.BigEndian, uint16(len(s)))
+			record.WriteString(s)
+		}
+		components := strings.Split(key.Principal, "/")
+		binary.Write(&record, binary.BigEndian, uint16(len(components)))
+		writeString(key.Realm)
+		for _, component := range components {
+			writeString(component)
+		}
+		binary.Write(&record, binary.BigEndian, uint32(1))
+		binary.Write(&record, binary.BigEndian, uint32(time.Now().Unix()))
+		record.WriteByte(byte(key.KVNO))
+		binary.Write(&record, binary.BigEndian, uint16(key.EType))
+		binary.Write(&record, binary.BigEndian, uint16(len(key.Key)))
+		record.Write(key.Key)
+		binary.Write(&record, binary.BigEndian, key.KVNO)
+
+		size := make([]byte, 4)
+		binary.BigEndian.PutUint32(size, uint32(record.Len()))
+		buf = append(buf, size...)
+		buf = append(buf, record.Bytes()...)
+	}
+	return buf
+}
+
+// testToken returns a base64 encoded SPNEGO token for the service of the
+// given key, for a ticket issued at ticketTime and an authenticator created
+// at authTime
+func testToken(t *testing.T, key *keytabEntry, client, realm string, ticketTime, authTime time.Time) string {
+	sessionKey := encryptionKey{KeyType: key.EType, KeyValue: testKey(t, key.EType)}
+	cname := testPrincipalName(client)
+
+	encPart := testApplication(t, tagEncTicketPart, encTicketPart{
+		Flags:     asn1.BitString{Bytes: []byte{0, 0, 0, 0}, BitLength: 32},
+		Key:       sessionKey,
+		CRealm:    testGeneralString(t, 2, realm),
+		CName:     cname,
+		Transited: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 4, IsCompound: true},
+		AuthTime:  ticketTime.UTC().Truncate(time.Second),
+		EndTime:   ticketTime.Add(10 * time.Hour).UTC().Truncate(time.Second),
+	})
+	sname := testPrincipalName(key.Principal)
+	sname.NameType = 2
+	tkt := testApplication(t, tagTicket, ticket{
+		TktVNO: 5,
+		Realm:  testGeneralString(t, 1, key.Realm),
+		SName:  sname,
+		EncPart: encryptedData{
+			EType:  key.EType,
+			KVNO:   int(key.KVNO),
+			Cipher: testEncrypt(t, key.EType, key.Key, keyUsageTicket, encPart),
+		},
+	})
+
+	auth := testApplication(t, tagAuthenticator, authenticator{
+		AuthenticatorVNO: 5,
+		CRealm:           testGeneralString(t, 1, realm),
+		CName:            cname,
+		CUSec:            authTime.Nanosecond() / 1000,
+		CTime:            authTime.UTC().Truncate(time.Second),
+	})
+	req := testApplication(t, tagAPReq, apReq{
+		PVNO:      5,
+		MsgType:   tagAPReq,
+		APOptions: asn1.BitString{Bytes: []byte{0, 0, 0, 0}, BitLength: 32},
+		Ticket:    asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 3, IsCompound: true, Bytes: tkt},
+		Authenticator: encryptedData{
+			EType:  sessionKey.KeyType,
+			Cipher: testEncrypt(t, sessionKey.KeyType, sessionKey.KeyValue, keyUsageAuthenticator, auth),
+		},
+	})
+
+	krb5Token := testGSSToken(t, oidKRB5, append(append([]byte{}, krb5APReqID...), req...))
+	init, err := asn1.Marshal(negTokenInit{
+		MechTypes: []asn1.ObjectIdentifier{oidKRB5},
+		MechToken: krb5Token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	choice, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: init})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(testGSSToken(t, oidSPNEGO, choice))
+}
+
+func testPrincipalName(name string) principalName {
+	p := principalName{NameType: 1}
+	for _, component := range strings.Split(name, "/") {
+		p.NameString = append(p.NameString, asn1.RawValue{Tag: 27, Bytes: []byte(component)})
+	}
+	return p
+}
+
+func testGeneralString(t *testing.T, tag int, s string) asn1.RawValue {
+	inner, err := asn1.Marshal(asn1.RawValue{Tag: 27, Bytes: []byte(s)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: inner}
+}
+
+func testApplication(t *testing.T, tag int, v interface{}) []byte {
+	inner, err := asn1.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: tag, IsCompound: true, Bytes: inner})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func testGSSToken(t *testing.T, mech asn1.ObjectIdentifier, inner []byte) []byte {
+	oid, err := asn1.Marshal(mech)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: 0, IsCompound: true, Bytes: append(oid, inner...)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// testEncrypt is the counterpart of decrypt
+func testEncrypt(t *testing.T, etype int32, key []byte, usage uint32, plaintext []byte) []byte {
+	if etype == etypeRC4HMAC {
+		usageBytes := make([]byte, 4)
+		binary.LittleEndian.PutUint32(usageBytes, usage)
+		mac := hmac.New(md5.New, key)
+		mac.Write(usageBytes)
+		k1 := mac.Sum(nil)
+
+		data := make([]byte, 8, 8+len(plaintext))
+		rand.Read(data)
+		data = append(data, plaintext...)
+		mac = hmac.New(md5.New, k1)
+		mac.Write(data)
+		checksum := mac.Sum(nil)
+
+		mac = hmac.New(md5.New, k1)
+		mac.Write(checksum)
+		c, err := rc4.NewCipher(mac.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted := make([]byte, len(data))
+		c.XORKeyStream(encrypted, data)
+		return append(checksum, encrypted...)
+	}
+
+	ke, err := deriveKey(key, usageConstant(usage, 0xAA))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ki, err := deriveKey(key, usageConstant(usage, 0x55))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, aes.BlockSize, aes.BlockSize+len(plaintext))
+	rand.Read(data)
+	data = append(data, plaintext...)
+	mac := hmac.New(sha1.New, ki)
+	mac.Write(data)
+	return append(testEncryptCTS(t, ke, data), mac.Sum(nil)[:aesHMACSize]...)
+}
+
+// testEncryptCTS is the counterpart of decryptCTS
+func testEncryptCTS(t *testing.T, key, plaintext []byte) []byte {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padded := make([]byte, (len(plaintext)+aes.BlockSize-1)/aes.BlockSize*aes.BlockSize)
+	copy(padded, plaintext)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(encrypted, padded)
+	if len(encrypted) == aes.BlockSize {
+		return encrypted
+	}
+
+	n := len(encrypted)
+	last := append([]byte{}, encrypted[n-aes.BlockSize:]...)
+	copy(encrypted[n-aes.BlockSize:], encrypted[n-2*aes.BlockSize:n-aes.BlockSize])
+	copy(encrypted[n-2*aes.BlockSize:], last)
+	return encrypted[:len(plaintext)]
+}
@@ -0,0 +1,239 @@
+package kerberos
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+)
+
+// The encryption types supported to decrypt tickets and authenticators
+const (
+	etypeAES128CTSHMACSHA196 = 17
+	etypeAES256CTSHMACSHA196 = 18
+	etypeRC4HMAC             = 23
+)
+
+// The key usages of RFC 4120 used to decrypt AP-REQ messages
+const (
+	keyUsageTicket        = 2
+	keyUsageAuthenticator = 11
+)
+
+// aesHMACSize is the size of the truncated HMAC-SHA1 appended to the
+// ciphertext of the AES encryption types
+const aesHMACSize = 12
+
+// decrypt decrypts and checks the integrity of the given ciphertext, with
+// the key of the given encryption type derived for the given usage
+func decrypt(etype int32, key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	switch etype {
+	case etypeAES128CTSHMACSHA196, etypeAES256CTSHMACSHA196:
+		if (etype == etypeAES128CTSHMACSHA196 && len(key) != 16) || (etype == etypeAES256CTSHMACSHA196 && len(key) != 32) {
+			return nil, fmt.Errorf("invalid key size for encryption type %d", etype)
+		}
+		return decryptAES(key, usage, ciphertext)
+	case etypeRC4HMAC:
+		if len(key) != 16 {
+			return nil, fmt.Errorf("invalid key size for encryption type %d", etype)
+		}
+		return decryptRC4(key, usage, ciphertext)
+	default:
+		return nil, fmt.Errorf("unsupported encryption type %d", etype)
+	}
+}
+
+// decryptAES decrypts ciphertext with the aes128-cts-hmac-sha1-96 or
+// aes256-cts-hmac-sha1-96 encryption type of RFC 3962
+func decryptAES(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < aes.BlockSize+aesHMACSize {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	ke, err := deriveKey(key, usageConstant(usage, 0xAA))
+	if err != nil {
+		return nil, err
+	}
+	ki, err := deriveKey(key, usageConstant(usage, 0x55))
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := ciphertext[:len(ciphertext)-aesHMACSize]
+	checksum := ciphertext[len(ciphertext)-aesHMACSize:]
+	plaintext, err := decryptCTS(ke, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha1.New, ki)
+	mac.Write(plaintext)
+	if !hmac.Equal(mac.Sum(nil)[:aesHMACSize], checksum) {
+		return nil, fmt.Errorf("integrity check failed")
+	}
+
+	// The plaintext starts with a random confounder
+	return plaintext[aes.BlockSize:], nil
+}
+
+// usageConstant returns the constant the keys of the given usage are derived
+// with
+func usageConstant(usage uint32, kind byte) []byte {
+	constant := make([]byte, 5)
+	binary.BigEndian.PutUint32(constant, usage)
+	constant[4] = kind
+	return constant
+}
+
+// deriveKey implements the DK function of RFC 3961 for the AES encryption
+// types, for which random-to-key is the identity
+func deriveKey(key, constant []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	derived := make([]byte, 0, len(key)+aes.BlockSize)
+	in := nfold(constant, aes.BlockSize)
+	for len(derived) < len(key) {
+		out := make([]byte, aes.BlockSize)
+		block.Encrypt(out, in)
+		derived = append(derived, out...)
+		in = out
+	}
+	return derived[:len(key)], nil
+}
+
+// nfold implements the n-fold function of RFC 3961, folding in into n bytes
+func nfold(in []byte, n int) []byte {
+	inBytes := len(in)
+	inBits := inBytes * 8
+
+	// The input is repeated, rotated, lcm(n, len(in)) / len(in) times
+	a, b := n, inBytes
+	for b != 0 {
+		a, b = b, a%b
+	}
+	lcm := n * inBytes / a
+
+	out := make([]byte, n)
+	carry := 0
+	for i := lcm - 1; i >= 0; i-- {
+		// The most significant bit of the input which is added to this
+		// byte of the output
+		msbit := ((inBits - 1) +
+			((inBits + 13) * (i / inBytes)) +
+			((inBytes - i%inBytes) * 8)) % inBits
+
+		hi := int(in[((inBytes-1)-(msbit>>3))%inBytes])
+		lo := int(in[(inBytes-(msbit>>3))%inBytes])
+		carry += ((hi<<8 | lo) >> uint((msbit&7)+1)) & 0xff
+		carry += int(out[i%n])
+		out[i%n] = byte(carry)
+		carry >>= 8
+	}
+
+	// The carry wraps around in one's-complement addition
+	for i := n - 1; carry != 0 && i >= 0; i-- {
+		carry += int(out[i])
+		out[i] = byte(carry)
+		carry >>= 8
+	}
+	return out
+}
+
+// decryptCTS decrypts AES in CBC mode with ciphertext stealing, the last two
+// blocks being swapped, and an initial vector of zero, as in RFC 3962
+func decryptCTS(key, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aes.BlockSize {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	if len(ciphertext) == aes.BlockSize {
+		plaintext := make([]byte, aes.BlockSize)
+		block.Decrypt(plaintext, ciphertext)
+		return plaintext, nil
+	}
+
+	// The ciphertext is E(1)..E(n-2), E(n), then the first r bytes of
+	// E(n-1), where the last plaintext block of r bytes was padded with
+	// zeroes
+	n := (len(ciphertext) + aes.BlockSize - 1) / aes.BlockSize
+	r := len(ciphertext) - (n-1)*aes.BlockSize
+	head := ciphertext[:(n-2)*aes.BlockSize]
+	last := ciphertext[(n-2)*aes.BlockSize : (n-1)*aes.BlockSize]
+	partial := ciphertext[(n-1)*aes.BlockSize:]
+
+	iv := make([]byte, aes.BlockSize)
+	plaintext := make([]byte, 0, len(ciphertext))
+	if len(head) != 0 {
+		decrypted := make([]byte, len(head))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, head)
+		plaintext = append(plaintext, decrypted...)
+		iv = head[len(head)-aes.BlockSize:]
+	}
+
+	// Decrypting E(n) gives the padded last plaintext block xored with
+	// E(n-1), whose bytes past r are thus those of the decrypted block
+	d := make([]byte, aes.BlockSize)
+	block.Decrypt(d, last)
+	previous := make([]byte, aes.BlockSize)
+	copy(previous, partial)
+	copy(previous[r:], d[r:])
+
+	secondToLast := make([]byte, aes.BlockSize)
+	block.Decrypt(secondToLast, previous)
+	for i := range secondToLast {
+		secondToLast[i] ^= iv[i]
+	}
+	plaintext = append(plaintext, secondToLast...)
+	for i := 0; i < r; i++ {
+		plaintext = append(plaintext, d[i]^previous[i])
+	}
+	return plaintext, nil
+}
+
+// decryptRC4 decrypts ciphertext with the rc4-hmac encryption type of
+// RFC 4757
+func decryptRC4(key []byte, usage uint32, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < md5.Size+8 {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	// RFC 4757 maps the usage of the TGS-REP encrypted part
+	if usage == 9 {
+		usage = 8
+	}
+	usageBytes := make([]byte, 4)
+	binary.LittleEndian.PutUint32(usageBytes, usage)
+
+	mac := hmac.New(md5.New, key)
+	mac.Write(usageBytes)
+	k1 := mac.Sum(nil)
+
+	checksum := ciphertext[:md5.Size]
+	mac = hmac.New(md5.New, k1)
+	mac.Write(checksum)
+	k3 := mac.Sum(nil)
+
+	c, err := rc4.NewCipher(k3)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(ciphertext)-md5.Size)
+	c.XORKeyStream(plaintext, ciphertext[md5.Size:])
+
+	mac = hmac.New(md5.New, k1)
+	mac.Write(plaintext)
+	if !hmac.Equal(mac.Sum(nil), checksum) {
+		return nil, fmt.Errorf("integrity check failed")
+	}
+
+	// The plaintext starts with a random confounder
+	return plaintext[8:], nil
+}
@@ -0,0 +1,290 @@
+package kerberos
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clockSkew is the maximum difference allowed between the clocks of Vault
+// and of the clients and KDC
+const clockSkew = 5 * time.Minute
+
+// The ASN.1 application tags of the messages of RFC 4120 used here
+const (
+	tagTicket        = 1
+	tagAuthenticator = 2
+	tagEncTicketPart = 3
+	tagAPReq         = 14
+)
+
+var (
+	oidSPNEGO   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 2}
+	oidKRB5     = asn1.ObjectIdentifier{1, 2, 840, 113554, 1, 2, 2}
+	oidMSKRB5   = asn1.ObjectIdentifier{1, 2, 840, 48018, 1, 2, 2}
+	krb5APReqID = []byte{0x01, 0x00}
+)
+
+// The structures below are those of RFC 4120, limited to the fields used
+// here. Kerberos strings are GeneralStrings, which encoding/asn1 does not
+// decode, so they are kept raw along with their explicit tag, which
+// encoding/asn1 does not strip from raw values, and read with
+// generalString.
+
+type principalName struct {
+	NameType   int32           `asn1:"explicit,tag:0"`
+	NameString []asn1.RawValue `asn1:"explicit,tag:1"`
+}
+
+type encryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+type encryptionKey struct {
+	KeyType  int32  `asn1:"explicit,tag:0"`
+	KeyValue []byte `asn1:"explicit,tag:1"`
+}
+
+type apReq struct {
+	PVNO          int            `asn1:"explicit,tag:0"`
+	MsgType       int            `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue  `asn1:"tag:3"`
+	Authenticator encryptedData  `asn1:"explicit,tag:4"`
+}
+
+type ticket struct {
+	TktVNO  int           `asn1:"explicit,tag:0"`
+	Realm   asn1.RawValue `asn1:"tag:1"`
+	SName   principalName `asn1:"explicit,tag:2"`
+	EncPart encryptedData `asn1:"explicit,tag:3"`
+}
+
+type encTicketPart struct {
+	Flags     asn1.BitString `asn1:"explicit,tag:0"`
+	Key       encryptionKey  `asn1:"explicit,tag:1"`
+	CRealm    asn1.RawValue  `asn1:"tag:2"`
+	CName     principalName  `asn1:"explicit,tag:3"`
+	Transited asn1.RawValue  `asn1:"tag:4"`
+	AuthTime  time.Time      `asn1:"generalized,explicit,tag:5"`
+	StartTime time.Time      `asn1:"generalized,optional,explicit,tag:6"`
+	EndTime   time.Time      `asn1:"generalized,explicit,tag:7"`
+}
+
+type authenticator struct {
+	AuthenticatorVNO int           `asn1:"explicit,tag:0"`
+	CRealm           asn1.RawValue `asn1:"tag:1"`
+	CName            principalName `asn1:"explicit,tag:2"`
+	Cksum            asn1.RawValue `asn1:"optional,tag:3"`
+	CUSec            int           `asn1:"explicit,tag:4"`
+	CTime            time.Time     `asn1:"generalized,explicit,tag:5"`
+}
+
+type negTokenInit struct {
+	MechTypes []asn1.ObjectIdentifier `asn1:"explicit,tag:0"`
+	ReqFlags  asn1.BitString          `asn1:"optional,explicit,tag:1"`
+	MechToken []byte                  `asn1:"optional,explicit,tag:2"`
+}
+
+// String returns the components of the principal name joined by slashes
+func (p *principalName) String() string {
+	components := make([]string, len(p.NameString))
+	for i, component := range p.NameString {
+		components[i] = string(component.Bytes)
+	}
+	return strings.Join(components, "/")
+}
+
+// generalString returns the string held in the given explicitly tagged
+// GeneralString
+func generalString(tagged asn1.RawValue) string {
+	var value asn1.RawValue
+	if _, err := asn1.Unmarshal(tagged.Bytes, &value); err != nil {
+		return ""
+	}
+	return string(value.Bytes)
+}
+
+// unmarshalApplication decodes the ASN.1 structure wrapped in the given
+// application tag
+func unmarshalApplication(raw []byte, tag int, out interface{}) error {
+	var wrapper asn1.RawValue
+	if rest, err := asn1.Unmarshal(raw, &wrapper); err != nil {
+		return err
+	} else if len(rest) != 0 {
+		return fmt.Errorf("trailing data after application %d", tag)
+	}
+	if wrapper.Class != asn1.ClassApplication || wrapper.Tag != tag {
+		return fmt.Errorf("expected application %d", tag)
+	}
+	_, err := asn1.Unmarshal(wrapper.Bytes, out)
+	return err
+}
+
+// unwrapGSSToken returns the mechanism and inner token of a GSS-API initial
+// context token of RFC 2743
+func unwrapGSSToken(raw []byte) (asn1.ObjectIdentifier, []byte, error) {
+	var wrapper asn1.RawValue
+	if _, err := asn1.Unmarshal(raw, &wrapper); err != nil {
+		return nil, nil, err
+	}
+	if wrapper.Class != asn1.ClassApplication || wrapper.Tag != 0 {
+		return nil, nil, fmt.Errorf("not a GSS-API token")
+	}
+	var mech asn1.ObjectIdentifier
+	inner, err := asn1.Unmarshal(wrapper.Bytes, &mech)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mech, inner, nil
+}
+
+// extractAPReq returns the Kerberos AP-REQ of the given SPNEGO token, or of
+// the given Kerberos GSS-API token
+func extractAPReq(token []byte) ([]byte, error) {
+	mech, inner, err := unwrapGSSToken(token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the negotiation token: %v", err)
+	}
+
+	if mech.Equal(oidSPNEGO) {
+		var choice asn1.RawValue
+		if _, err := asn1.Unmarshal(inner, &choice); err != nil {
+			return nil, fmt.Errorf("failed to parse the SPNEGO token: %v", err)
+		}
+		if choice.Class != asn1.ClassContextSpecific || choice.Tag != 0 {
+			return nil, fmt.Errorf("SPNEGO token is not an initial token")
+		}
+		var init negTokenInit
+		if _, err := asn1.Unmarshal(choice.Bytes, &init); err != nil {
+			return nil, fmt.Errorf("failed to parse the SPNEGO token: %v", err)
+		}
+		if len(init.MechToken) == 0 {
+			return nil, fmt.Errorf("SPNEGO token does not contain a Kerberos token")
+		}
+		if mech, inner, err = unwrapGSSToken(init.MechToken); err != nil {
+			return nil, fmt.Errorf("failed to parse the Kerberos token: %v", err)
+		}
+	}
+
+	if !mech.Equal(oidKRB5) && !mech.Equal(oidMSKRB5) {
+		return nil, fmt.Errorf("unsupported mechanism %s; only Kerberos is supported", mech)
+	}
+	if len(inner) < 2 || inner[0] != krb5APReqID[0] || inner[1] != krb5APReqID[1] {
+		return nil, fmt.Errorf("Kerberos token is not an AP-REQ")
+	}
+	return inner[2:], nil
+}
+
+// verifyAPReq verifies the AP-REQ of the given negotiation token with the
+// keys of the service, and returns the authenticated client principal,
+// authenticator time and realm
+func verifyAPReq(token []byte, service string, keys []*keytabEntry, now time.Time) (*clientIdentity, error) {
+	rawReq, err := extractAPReq(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var req apReq
+	if err := unmarshalApplication(rawReq, tagAPReq, &req); err != nil {
+		return nil, fmt.Errorf("failed to parse the AP-REQ: %v", err)
+	}
+	if req.PVNO != 5 || req.MsgType != tagAPReq {
+		return nil, fmt.Errorf("unsupported AP-REQ")
+	}
+
+	var tkt ticket
+	if err := unmarshalApplication(req.Ticket.Bytes, tagTicket, &tkt); err != nil {
+		return nil, fmt.Errorf("failed to parse the ticket: %v", err)
+	}
+	realm := generalString(tkt.Realm)
+	if tkt.SName.String() != service {
+		return nil, fmt.Errorf("ticket is for %s, not for %s", tkt.SName.String(), service)
+	}
+
+	key := findKey(keys, service, realm, tkt.EncPart.EType, tkt.EncPart.KVNO)
+	if key == nil {
+		return nil, fmt.Errorf("no key of %s@%s with encryption type %d and version %d in the keytab",
+			service, realm, tkt.EncPart.EType, tkt.EncPart.KVNO)
+	}
+
+	plaintext, err := decrypt(tkt.EncPart.EType, key.Key, keyUsageTicket, tkt.EncPart.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the ticket: %v", err)
+	}
+	var encPart encTicketPart
+	if err := unmarshalApplication(plaintext, tagEncTicketPart, &encPart); err != nil {
+		return nil, fmt.Errorf("failed to parse the ticket: %v", err)
+	}
+
+	start := encPart.AuthTime
+	if !encPart.StartTime.IsZero() {
+		start = encPart.StartTime
+	}
+	if now.Add(clockSkew).Before(start) {
+		return nil, fmt.Errorf("ticket is not valid yet")
+	}
+	if now.Add(-clockSkew).After(encPart.EndTime) {
+		return nil, fmt.Errorf("ticket has expired")
+	}
+
+	plaintext, err = decrypt(encPart.Key.KeyType, encPart.Key.KeyValue, keyUsageAuthenticator, req.Authenticator.Cipher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the authenticator: %v", err)
+	}
+	var auth authenticator
+	if err := unmarshalApplication(plaintext, tagAuthenticator, &auth); err != nil {
+		return nil, fmt.Errorf("failed to parse the authenticator: %v", err)
+	}
+
+	// The authenticator proves that the client knows the session key of
+	// the ticket, and must be fresh
+	if auth.CName.String() != encPart.CName.String() || generalString(auth.CRealm) != generalString(encPart.CRealm) {
+		return nil, fmt.Errorf("authenticator does not match the ticket")
+	}
+	if auth.CTime.Before(now.Add(-clockSkew)) || auth.CTime.After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("authenticator time is not within the allowed clock skew")
+	}
+
+	return &clientIdentity{
+		Name:  encPart.CName.String(),
+		Realm: generalString(encPart.CRealm),
+		CTime: auth.CTime,
+		CUSec: auth.CUSec,
+	}, nil
+}
+
+// clientIdentity is the client authenticated by an AP-REQ
+type clientIdentity struct {
+	Name  string
+	Realm string
+
+	// The time of the authenticator, which identifies it along with the
+	// client
+	CTime time.Time
+	CUSec int
+}
+
+// findKey returns the key of the keytab for the given principal, encryption
+// type and version. The latest version is used if the version is not given.
+func findKey(keys []*keytabEntry, principal, realm string, etype int32, kvno int) *keytabEntry {
+	var found *keytabEntry
+	for _, key := range keys {
+		if key.Principal != principal || key.Realm != realm || key.EType != etype {
+			continue
+		}
+		if kvno != 0 {
+			if key.KVNO == uint32(kvno) {
+				return key
+			}
+			continue
+		}
+		if found == nil || key.KVNO > found.KVNO {
+			found = key
+		}
+	}
+	return found
+}
@@ -0,0 +1,133 @@
+package kerberos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+)
+
+// keytabEntry is a key of a service principal read from a keytab
+type keytabEntry struct {
+	Principal string
+	Realm     string
+	KVNO      uint32
+	EType     int32
+	Key       []byte
+}
+
+// parseKeytab parses a keytab in the format of MIT Kerberos, version 2,
+// which is also the format written by ktpass on Active Directory
+func parseKeytab(raw []byte) ([]*keytabEntry, error) {
+	if len(raw) < 2 || raw[0] != 0x05 || raw[1] != 0x02 {
+		return nil, fmt.Errorf("unsupported keytab format; only version 0x502 is supported")
+	}
+
+	var entries []*keytabEntry
+	r := &keytabReader{buf: raw[2:]}
+	for len(r.buf) != 0 {
+		size := int32(r.uint32())
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		// Deleted entries are holes of negative size
+		if size < 0 {
+			r.bytes(int(-size))
+			continue
+		}
+		record := &keytabReader{buf: r.bytes(int(size))}
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		entry, err := record.entry()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("keytab contains no key")
+	}
+	return entries, nil
+}
+
+// keytabReader reads the big-endian fields of a keytab, keeping the first
+// error encountered
+type keytabReader struct {
+	buf []byte
+	err error
+}
+
+func (r *keytabReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = fmt.Errorf("keytab is truncated")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *keytabReader) uint8() uint8 {
+	b := r.bytes(1)
+	if b == nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (r *keytabReader) uint16() uint16 {
+	b := r.bytes(2)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *keytabReader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *keytabReader) string() string {
+	return string(r.bytes(int(r.uint16())))
+}
+
+func (r *keytabReader) entry() (*keytabEntry, error) {
+	components := make([]string, r.uint16())
+	realm := r.string()
+	for i := range components {
+		components[i] = r.string()
+	}
+	r.uint32() // name type
+	r.uint32() // timestamp
+	kvno := uint32(r.uint8())
+	etype := int32(r.uint16())
+	key := r.bytes(int(r.uint16()))
+
+	// The 8 bit version number is superseded by a 32 bit one, if present
+	if len(r.buf) >= 4 {
+		if v := r.uint32(); v != 0 {
+			kvno = v
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return &keytabEntry{
+		Principal: strings.Join(components, "/"),
+		Realm:     realm,
+		KVNO:      kvno,
+		EType:     etype,
+		Key:       key,
+	}, nil
+}
@@ -0,0 +1,184 @@
+package kerberos
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config$`,
+		Fields: map[string]*framework.FieldSchema{
+			"keytab": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64 encoded keytab of the service principal.",
+			},
+
+			"service_account": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The service principal of Vault, without the realm, e.g. HTTP/vault.example.com.",
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which authentication will be expired.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum duration after which authentication will be expired.",
+			},
+		},
+
+		ExistenceCheck: b.pathConfigExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConfigWrite,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathConfigExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+// Config returns the configuration for this backend.
+func (b *backend) Config(s logical.Storage) (*ConfigEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ConfigEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The keytab holds the keys of the service, so it is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"service_account": config.ServiceAccount,
+			"ttl":             config.TTL / time.Second,
+			"max_ttl":         config.MaxTTL / time.Second,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ConfigEntry{}
+	}
+
+	if keytabRaw, ok := data.GetOk("keytab"); ok {
+		keytab, err := base64.StdEncoding.DecodeString(keytabRaw.(string))
+		if err != nil {
+			return logical.ErrorResponse("keytab must be base64 encoded"), nil
+		}
+		config.Keytab = keytab
+	}
+	if serviceAccountRaw, ok := data.GetOk("service_account"); ok {
+		config.ServiceAccount = serviceAccountRaw.(string)
+	}
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		config.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		config.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+
+	if config.ServiceAccount == "" {
+		return logical.ErrorResponse("service_account must be set"), nil
+	}
+	if strings.Contains(config.ServiceAccount, "@") {
+		return logical.ErrorResponse("service_account must not include the realm"), nil
+	}
+	if len(config.Keytab) == 0 {
+		return logical.ErrorResponse("keytab must be set"), nil
+	}
+	keys, err := parseKeytab(config.Keytab)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid keytab: %s", err)), nil
+	}
+	found := false
+	for _, key := range keys {
+		if key.Principal == config.ServiceAccount {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return logical.ErrorResponse(fmt.Sprintf("keytab has no key for %s", config.ServiceAccount)), nil
+	}
+	if config.MaxTTL != 0 && config.TTL > config.MaxTTL {
+		return logical.ErrorResponse("ttl should not be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ConfigEntry holds the service principal of Vault and its keys
+type ConfigEntry struct {
+	Keytab         []byte        `json:"keytab"`
+	ServiceAccount string        `json:"service_account"`
+	TTL            time.Duration `json:"ttl"`
+	MaxTTL         time.Duration `json:"max_ttl"`
+}
+
+const pathConfigHelpSyn = `
+Configures the Kerberos service principal of Vault.
+`
+
+const pathConfigHelpDesc = `
+Clients obtain tickets for the service principal 'service_account', such as
+HTTP/vault.example.com, from their KDC. The tickets are decrypted with the
+keys of the principal found in 'keytab', a base64 encoded keytab file as
+exported by ktutil or ktpass.
+
+Only the aes128-cts-hmac-sha1-96, aes256-cts-hmac-sha1-96 and rc4-hmac
+encryption types are supported.
+`
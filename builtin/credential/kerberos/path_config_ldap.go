@@ -0,0 +1,102 @@
+package kerberos
+
+import (
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfigLDAP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config/ldap$`,
+		Fields:  ldap.ConfigFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigLDAPRead,
+			logical.UpdateOperation: b.pathConfigLDAPWrite,
+			logical.DeleteOperation: b.pathConfigLDAPDelete,
+		},
+
+		HelpSynopsis:    pathConfigLDAPHelpSyn,
+		HelpDescription: pathConfigLDAPHelpDesc,
+	}
+}
+
+// ConfigLDAP returns the configuration of the LDAP server the groups of
+// users are looked up in, or nil if there is none
+func (b *backend) ConfigLDAP(s logical.Storage) (*ldap.ConfigEntry, error) {
+	entry, err := s.Get("config/ldap")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ldap.ConfigEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigLDAPRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	cfg, err := b.ConfigLDAP(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: structs.New(cfg).Map(),
+	}
+	resp.AddWarning("Read access to this endpoint should be controlled via ACLs as it will return the configuration information as-is, including any passwords.")
+	return resp, nil
+}
+
+func (b *backend) pathConfigLDAPWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	cfg, err := ldap.NewConfigEntry(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if cfg.BindDN == "" || cfg.BindPassword == "" {
+		return logical.ErrorResponse("binddn and bindpass must be set, since the passwords of users are not known"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config/ldap", cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigLDAPDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("config/ldap"); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+const pathConfigLDAPHelpSyn = `
+Configure the LDAP server the groups of users are looked up in.
+`
+
+const pathConfigLDAPHelpDesc = `
+This endpoint takes the same parameters as the "config" endpoint of the LDAP
+credential provider. When set, the LDAP groups of users are looked up at
+login and renewal, and the policies of the matching groups of this backend
+are granted.
+
+Since users do not log in with their password, the search is made while bound
+as 'binddn', which must be set along with 'bindpass'.
+`
@@ -0,0 +1,196 @@
+package kerberos
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `login$`,
+		Fields: map[string]*framework.FieldSchema{
+			"spnego": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Base64 encoded SPNEGO token, as sent in the "Authorization: Negotiate" header.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginSyn,
+		HelpDescription: pathLoginDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	spnego := strings.TrimSpace(d.Get("spnego").(string))
+	spnego = strings.TrimPrefix(spnego, "Negotiate ")
+	if spnego == "" {
+		return logical.ErrorResponse("missing spnego token"), nil
+	}
+	token, err := base64.StdEncoding.DecodeString(spnego)
+	if err != nil {
+		return logical.ErrorResponse("spnego token must be base64 encoded"), nil
+	}
+
+	cfg, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("kerberos backend not configured"), nil
+	}
+	keys, err := parseKeytab(cfg.Keytab)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	client, err := verifyAPReq(token, cfg.ServiceAccount, keys, now)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Tickets of other realms could name users of the same name, so only
+	// those of the realm of the service are accepted
+	if client.Realm != keyRealm(keys, cfg.ServiceAccount) {
+		return logical.ErrorResponse(fmt.Sprintf("realm %s is not allowed", client.Realm)), nil
+	}
+	if err := b.checkReplay(client, now); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	username := client.Name
+	policies, err := b.policies(req.Storage, username)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return logical.ErrorResponse("user is not a member of any authorized group"), nil
+	}
+
+	ttl, _, err := b.SanitizeTTL(cfg.TTL, cfg.MaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Policies: policies,
+			Metadata: map[string]string{
+				"username": username,
+				"realm":    client.Realm,
+				"policies": strings.Join(policies, ","),
+			},
+			DisplayName: username,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       ttl,
+				Renewable: true,
+			},
+		},
+	}, nil
+}
+
+// keyRealm returns the realm of the keys of the given principal
+func keyRealm(keys []*keytabEntry, principal string) string {
+	for _, key := range keys {
+		if key.Principal == principal {
+			return key.Realm
+		}
+	}
+	return ""
+}
+
+// policies returns the policies of the user, which are those of the user and
+// of its groups. Groups are those of the user in this backend and, if an
+// LDAP server is configured, those of the user in LDAP.
+func (b *backend) policies(s logical.Storage, username string) ([]string, error) {
+	var allGroups []string
+	var policies []string
+
+	user, err := b.User(s, username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		allGroups = append(allGroups, user.Groups...)
+		policies = append(policies, user.Policies...)
+	}
+
+	ldapCfg, err := b.ConfigLDAP(s)
+	if err != nil {
+		return nil, err
+	}
+	if ldapCfg != nil {
+		ldapGroups, err := b.lookupLDAPGroups(ldapCfg, username)
+		if err != nil {
+			return nil, err
+		}
+		allGroups = append(allGroups, ldapGroups...)
+	}
+
+	for _, groupName := range allGroups {
+		group, err := b.Group(s, groupName)
+		if err != nil {
+			return nil, err
+		}
+		if group != nil {
+			policies = append(policies, group.Policies...)
+		}
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	policies = policyutil.SanitizePolicies(policies, false)
+	sort.Strings(policies)
+	return policies, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	cfg, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("kerberos backend not configured")
+	}
+
+	// The ticket cannot be presented again, so the groups of the user are
+	// checked again instead
+	loginPolicies, err := b.policies(req.Storage, req.Auth.Metadata["username"])
+	if err != nil {
+		return nil, err
+	}
+	if !policyutil.EquivalentPolicies(loginPolicies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	return framework.LeaseExtend(cfg.TTL, cfg.MaxTTL, b.System())(req, d)
+}
+
+const pathLoginSyn = `
+Log in with a SPNEGO token.
+`
+
+const pathLoginDesc = `
+This endpoint authenticates using a SPNEGO token, the value of the
+"Authorization: Negotiate" header HTTP clients send to services of a Kerberos
+realm. The token holds a ticket for the service principal of Vault, which
+names the user. Only users of the realm of the service principal are allowed.
+`
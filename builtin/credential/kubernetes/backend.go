@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+type backend struct {
+	*framework.Backend
+
+	// Lock to make changes to the backend's configuration
+	configMutex sync.RWMutex
+
+	// Lock to make changes to role entries
+	roleMutex sync.RWMutex
+
+	// reviewFactory creates the reviewer used to verify service account
+	// JWTs with the configured cluster. It is replaced in tests.
+	reviewFactory tokenReviewFactory
+}
+
+func Backend() *backend {
+	b := &backend{
+		reviewFactory: newTokenReviewAPI,
+	}
+
+	b.Backend = &framework.Backend{
+		AuthRenew: b.pathLoginRenew,
+		Help:      backendHelp,
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login",
+			},
+		},
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathRole(b),
+			pathListRoles(b),
+			pathLogin(b),
+		},
+	}
+
+	return b
+}
+
+const backendHelp = `
+The Kubernetes credential provider allows pods to authenticate with the JWT
+of their service account.
+
+The JWT is verified using the token review API of the Kubernetes cluster,
+and the namespace and name of the service account it belongs to are then
+matched against the bounds of a role, which determines the policies of the
+issued token.
+
+After enabling the credential provider, use the "config" route to configure
+how the cluster is reached, and the "role" route to create roles.
+`
@@ -0,0 +1,275 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// testReviewer accepts the JWTs it knows of
+type testReviewer map[string]*tokenReviewResult
+
+func (t testReviewer) Review(jwt string) (*tokenReviewResult, error) {
+	sa, ok := t[jwt]
+	if !ok {
+		return nil, fmt.Errorf("JWT was not authenticated")
+	}
+	return sa, nil
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	b.reviewFactory = func(*kubeConfig) tokenReviewer {
+		return testReviewer{
+			"web-jwt": {Name: "web", Namespace: "prod", UID: "1234"},
+			"db-jwt":  {Name: "db", Namespace: "prod", UID: "5678"},
+		}
+	}
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func TestBackend_Config(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	resp := testWrite(t, b, storage, "config", map[string]interface{}{})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	resp = testWrite(t, b, storage, "config", map[string]interface{}{
+		"kubernetes_host":    "https://kubernetes.default",
+		"kubernetes_ca_cert": "bogus",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	resp = testWrite(t, b, storage, "config", map[string]interface{}{
+		"kubernetes_host":    "https://kubernetes.default",
+		"token_reviewer_jwt": "reviewer-jwt",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["kubernetes_host"] != "https://kubernetes.default" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["token_reviewer_jwt"]; ok {
+		t.Fatalf("reviewer JWT should not be returned: %#v", resp.Data)
+	}
+}
+
+func TestBackend_Role(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	cases := []map[string]interface{}{
+		{"bound_service_account_namespaces": "prod"},
+		{"bound_service_account_names": "web"},
+		{"bound_service_account_names": "*", "bound_service_account_namespaces": "*"},
+		{"bound_service_account_names": "web", "bound_service_account_namespaces": "prod", "ttl": 600, "max_ttl": 60},
+	}
+	for _, data := range cases {
+		resp := testWrite(t, b, storage, "role/web", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_service_account_names":      "web,worker",
+		"bound_service_account_namespaces": "prod",
+		"policies":                         "web,dev",
+		"ttl":                              600,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "role/web",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["ttl"].(time.Duration) != 600 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	names := resp.Data["bound_service_account_names"].([]string)
+	if len(names) != 2 || names[0] != "web" || names[1] != "worker" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "role/",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 1 || keys[0] != "web" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage := createBackendWithStorage(t)
+
+	login := func(role, jwt string) *logical.Response {
+		return testWrite(t, b, storage, "login", map[string]interface{}{
+			"role": role,
+			"jwt":  jwt,
+		})
+	}
+
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_service_account_names":      "web",
+		"bound_service_account_namespaces": "*",
+		"policies":                         "web",
+	})
+
+	// The backend must be configured first
+	if resp := login("web", "web-jwt"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"kubernetes_host": "https://kubernetes.default",
+	})
+
+	resp := login("web", "web-jwt")
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if len(resp.Auth.Policies) != 2 || resp.Auth.Policies[0] != "default" || resp.Auth.Policies[1] != "web" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	if resp.Auth.Metadata["service_account_namespace"] != "prod" ||
+		resp.Auth.Metadata["service_account_uid"] != "1234" ||
+		resp.Auth.DisplayName != "prod-web" {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	auth := resp.Auth
+
+	// Service accounts not bound to the role, and JWTs that are not
+	// authenticated, are rejected
+	for _, jwt := range []string{"db-jwt", "bogus-jwt"} {
+		if resp := login("web", jwt); resp == nil || !resp.IsError() {
+			t.Fatalf("%s: expected an error: %#v", jwt, resp)
+		}
+	}
+	if resp := login("bogus", "web-jwt"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// Tokens are renewed as long as the role allows the service account
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Auth:      auth,
+	}
+	auth.IssueTime = time.Now()
+	resp, err := b.HandleRequest(renewReq)
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	testWrite(t, b, storage, "role/web", map[string]interface{}{
+		"bound_service_account_names": "worker",
+	})
+	if _, err := b.HandleRequest(renewReq); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
+
+func TestTokenReviewAPI(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authentication.k8s.io/v1/tokenreviews" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		var review tokenReview
+		if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch review.Spec.Token {
+		case "web-jwt":
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:prod:web"
+			review.Status.User.UID = "1234"
+		case "user-jwt":
+			review.Status.Authenticated = true
+			review.Status.User.Username = "admin"
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&review)
+	}))
+	defer server.Close()
+
+	reviewer := newTokenReviewAPI(&kubeConfig{Host: server.URL})
+	sa, err := reviewer.Review("web-jwt")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sa.Name != "web" || sa.Namespace != "prod" || sa.UID != "1234" {
+		t.Fatalf("bad: %#v", sa)
+	}
+	// Without a reviewer JWT, the JWT reviews itself
+	if authorization != "Bearer web-jwt" {
+		t.Fatalf("bad: %s", authorization)
+	}
+
+	reviewer = newTokenReviewAPI(&kubeConfig{Host: server.URL, TokenReviewerJWT: "reviewer-jwt"})
+	if _, err := reviewer.Review("web-jwt"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if authorization != "Bearer reviewer-jwt" {
+		t.Fatalf("bad: %s", authorization)
+	}
+
+	// Only authenticated service accounts are accepted
+	for _, jwt := range []string{"bogus-jwt", "user-jwt"} {
+		if _, err := reviewer.Review(jwt); err == nil {
+			t.Fatalf("%s: expected an error", jwt)
+		}
+	}
+}
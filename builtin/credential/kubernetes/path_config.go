@@ -0,0 +1,167 @@
+package kubernetes
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"kubernetes_host": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Host must be a host string, a host:port pair, or a URL to the base of the Kubernetes API server.",
+			},
+
+			"kubernetes_ca_cert": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "PEM encoded CA certificate to verify the Kubernetes API server's certificate with.",
+			},
+
+			"token_reviewer_jwt": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `A service account JWT used to access the token review API. If not set,
+the JWT given at login is used to review itself, which requires every
+service account logging in to be allowed to create token reviews.`,
+			},
+		},
+
+		ExistenceCheck: b.pathConfigExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConfigWrite,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathConfigExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+// lockedConfig returns the configuration of the backend, after acquiring
+// the configuration lock
+func (b *backend) lockedConfig(s logical.Storage) (*kubeConfig, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	return b.nonLockedConfig(s)
+}
+
+// nonLockedConfig returns the configuration of the backend
+func (b *backend) nonLockedConfig(s logical.Storage) (*kubeConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result kubeConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The reviewer JWT is a credential, so it is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"kubernetes_host":    config.Host,
+			"kubernetes_ca_cert": config.CACert,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	config, err := b.nonLockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &kubeConfig{}
+	}
+
+	if hostRaw, ok := data.GetOk("kubernetes_host"); ok {
+		config.Host = hostRaw.(string)
+	}
+	if config.Host == "" {
+		return logical.ErrorResponse("missing kubernetes_host"), nil
+	}
+	if _, err := url.Parse(config.Host); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error parsing kubernetes_host: %s", err)), nil
+	}
+
+	if caCertRaw, ok := data.GetOk("kubernetes_ca_cert"); ok {
+		config.CACert = caCertRaw.(string)
+	}
+	if config.CACert != "" {
+		if !x509.NewCertPool().AppendCertsFromPEM([]byte(config.CACert)) {
+			return logical.ErrorResponse("kubernetes_ca_cert must contain a PEM encoded certificate"), nil
+		}
+	}
+
+	if jwtRaw, ok := data.GetOk("token_reviewer_jwt"); ok {
+		config.TokenReviewerJWT = jwtRaw.(string)
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// kubeConfig holds how the Kubernetes API server is reached
+type kubeConfig struct {
+	Host             string `json:"kubernetes_host"`
+	CACert           string `json:"kubernetes_ca_cert"`
+	TokenReviewerJWT string `json:"token_reviewer_jwt"`
+}
+
+const pathConfigHelpSyn = `
+Configures how the Kubernetes API server is reached.
+`
+
+const pathConfigHelpDesc = `
+Service account JWTs presented at login are verified by making a request to
+the token review API of the Kubernetes API server at 'kubernetes_host',
+whose certificate is verified with 'kubernetes_ca_cert' if given. The
+request is authenticated with 'token_reviewer_jwt', the JWT of a service
+account allowed to create token reviews.
+`
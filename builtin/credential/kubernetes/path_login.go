@@ -0,0 +1,149 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "login$",
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role against which the login is being attempted.",
+			},
+			"jwt": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "JWT of the service account attempting the login.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginHelpSyn,
+		HelpDescription: pathLoginHelpDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+	jwt := data.Get("jwt").(string)
+	if jwt == "" {
+		return logical.ErrorResponse("missing jwt"), nil
+	}
+
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid role name %q", roleName)), nil
+	}
+
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse("configure the kubernetes credential backend first"), nil
+	}
+
+	sa, err := b.reviewFactory(config).Review(jwt)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if !role.allows(sa) {
+		return logical.ErrorResponse(fmt.Sprintf("service account %s/%s is not authorized for this role", sa.Namespace, sa.Name)), nil
+	}
+
+	ttl, _, err := b.SanitizeTTL(role.TTL, role.MaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if role.Period > time.Duration(0) {
+		ttl = role.Period
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Period: role.Period,
+			InternalData: map[string]interface{}{
+				"role": roleName,
+			},
+			Policies: role.Policies,
+			Metadata: map[string]string{
+				"role":                      roleName,
+				"service_account_name":      sa.Name,
+				"service_account_namespace": sa.Namespace,
+				"service_account_uid":       sa.UID,
+			},
+			DisplayName: sa.Namespace + "-" + sa.Name,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       ttl,
+				Renewable: true,
+			},
+		},
+	}, nil
+}
+
+// Invoked when the token issued by this backend is attempting a renewal.
+func (b *backend) pathLoginRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	roleName, ok := req.Auth.InternalData["role"].(string)
+	if !ok || roleName == "" {
+		return nil, fmt.Errorf("failed to fetch role during renewal")
+	}
+
+	// Ensure that the role still exists and allows the service account
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate role %s during renewal: %s", roleName, err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("role %s does not exist during renewal", roleName)
+	}
+	sa := &tokenReviewResult{
+		Name:      req.Auth.Metadata["service_account_name"],
+		Namespace: req.Auth.Metadata["service_account_namespace"],
+	}
+	if !role.allows(sa) {
+		return nil, fmt.Errorf("service account %s/%s is no longer authorized for role %s", sa.Namespace, sa.Name, roleName)
+	}
+	if !policyutil.EquivalentPolicies(role.Policies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies on role %s have changed, cannot renew", roleName)
+	}
+
+	// If 'Period' is set on the role, the token should never expire.
+	// Replenish the TTL with 'Period's value.
+	if role.Period > time.Duration(0) {
+		req.Auth.TTL = role.Period
+		return &logical.Response{Auth: req.Auth}, nil
+	}
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, data)
+}
+
+const pathLoginHelpSyn = `
+Authenticates Kubernetes service accounts with Vault.
+`
+
+const pathLoginHelpDesc = `
+A service account logs in by presenting its JWT, usually found in the pod at
+/var/run/secrets/kubernetes.io/serviceaccount/token, along with the name of
+a role. The JWT is verified with the token review API of the cluster, and
+the service account it belongs to must be bound to the role.
+`
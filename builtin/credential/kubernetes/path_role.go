@@ -0,0 +1,294 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"bound_service_account_names": {
+				Type: framework.TypeString,
+				Description: `Comma separated list of service account names able to login with this
+role. If set to "*", all names are allowed.`,
+			},
+			"bound_service_account_namespaces": {
+				Type: framework.TypeString,
+				Description: `Comma separated list of namespaces allowed to login with this role. If
+set to "*", all namespaces are allowed.`,
+			},
+			"policies": {
+				Type:        framework.TypeString,
+				Default:     "default",
+				Description: "Policies to be set on tokens issued using this role.",
+			},
+			"ttl": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `Duration in seconds after which the issued token should expire. Defaults
+to 0, in which case the value will fallback to the system/mount defaults.`,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Default:     0,
+				Description: "The maximum allowed lifetime of tokens issued using this role.",
+			},
+			"period": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `If set, indicates that the token generated using this role should never
+expire. The token should be renewed within the duration specified by this
+value. At each renewal, the token's TTL will be set to the value of this
+parameter.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "role/?",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathListRolesHelpSyn,
+		HelpDescription: pathListRolesHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathRoleExistenceCheck(req *logical.Request, data *framework.FieldData) (bool, error) {
+	entry, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return false, err
+	}
+	return entry != nil, nil
+}
+
+// lockedRole returns the role with the given name, after acquiring the
+// role lock
+func (b *backend) lockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	return b.nonLockedRole(s, roleName)
+}
+
+// nonLockedRole returns the role with the given name
+func (b *backend) nonLockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("role").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	return nil, req.Storage.Delete("role/" + strings.ToLower(roleName))
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	roles, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.lockedRole(req.Storage, data.Get("role").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	respData := structs.New(role).Map()
+
+	// Display the durations in seconds
+	respData["ttl"] = role.TTL / time.Second
+	respData["max_ttl"] = role.MaxTTL / time.Second
+	respData["period"] = role.Period / time.Second
+
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(data.Get("role").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	role, err := b.nonLockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleEntry{}
+	}
+
+	if namesRaw, ok := data.GetOk("bound_service_account_names"); ok {
+		role.BoundServiceAccountNames = strutil.ParseDedupAndSortStrings(namesRaw.(string), ",")
+	}
+	if namespacesRaw, ok := data.GetOk("bound_service_account_namespaces"); ok {
+		role.BoundServiceAccountNamespaces = strutil.ParseDedupAndSortStrings(namespacesRaw.(string), ",")
+	}
+
+	// Roles must be bound, so that any JWT of the cluster cannot login
+	if len(role.BoundServiceAccountNames) == 0 {
+		return logical.ErrorResponse("bound_service_account_names must be set"), nil
+	}
+	if len(role.BoundServiceAccountNamespaces) == 0 {
+		return logical.ErrorResponse("bound_service_account_namespaces must be set"), nil
+	}
+	if strutil.StrListContains(role.BoundServiceAccountNames, "*") &&
+		strutil.StrListContains(role.BoundServiceAccountNamespaces, "*") {
+		return logical.ErrorResponse("bound_service_account_names and bound_service_account_namespaces cannot both be \"*\""), nil
+	}
+
+	if policiesRaw, ok := data.GetOk("policies"); ok {
+		role.Policies = policyutil.ParsePolicies(policiesRaw.(string))
+	} else if req.Operation == logical.CreateOperation {
+		role.Policies = policyutil.ParsePolicies(data.Get("policies").(string))
+	}
+
+	var resp logical.Response
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttlRaw.(int)) * time.Second
+		if defaultLeaseTTL := b.System().DefaultLeaseTTL(); role.TTL > defaultLeaseTTL {
+			resp.AddWarning(fmt.Sprintf("Given ttl of %d seconds greater than current mount/system default of %d seconds; ttl will be capped at login time", role.TTL/time.Second, defaultLeaseTTL/time.Second))
+		}
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+		if systemMaxTTL := b.System().MaxLeaseTTL(); role.MaxTTL > systemMaxTTL {
+			resp.AddWarning(fmt.Sprintf("Given max_ttl of %d seconds greater than current mount/system default of %d seconds; max_ttl will be capped at login time", role.MaxTTL/time.Second, systemMaxTTL/time.Second))
+		}
+	}
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("ttl and max_ttl cannot be negative"), nil
+	}
+	if role.MaxTTL != 0 && role.MaxTTL < role.TTL {
+		return logical.ErrorResponse("ttl should be shorter than max_ttl"), nil
+	}
+
+	if periodRaw, ok := data.GetOk("period"); ok {
+		role.Period = time.Duration(periodRaw.(int)) * time.Second
+		if role.Period > b.System().MaxLeaseTTL() {
+			return logical.ErrorResponse(fmt.Sprintf("period of %d seconds is greater than the backend's maximum TTL of %d seconds", role.Period/time.Second, b.System().MaxLeaseTTL()/time.Second)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Warnings()) == 0 {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// roleEntry binds service accounts to the policies of the tokens they are
+// issued
+type roleEntry struct {
+	BoundServiceAccountNames      []string      `json:"bound_service_account_names" structs:"bound_service_account_names" mapstructure:"bound_service_account_names"`
+	BoundServiceAccountNamespaces []string      `json:"bound_service_account_namespaces" structs:"bound_service_account_namespaces" mapstructure:"bound_service_account_namespaces"`
+	Policies                      []string      `json:"policies" structs:"policies" mapstructure:"policies"`
+	TTL                           time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
+	MaxTTL                        time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+	Period                        time.Duration `json:"period" structs:"period" mapstructure:"period"`
+}
+
+// allows returns whether the role allows the given service account to login
+func (r *roleEntry) allows(sa *tokenReviewResult) bool {
+	nameAllowed := strutil.StrListContains(r.BoundServiceAccountNames, "*") ||
+		strutil.StrListContains(r.BoundServiceAccountNames, sa.Name)
+	namespaceAllowed := strutil.StrListContains(r.BoundServiceAccountNamespaces, "*") ||
+		strutil.StrListContains(r.BoundServiceAccountNamespaces, sa.Namespace)
+	return nameAllowed && namespaceAllowed
+}
+
+const pathRoleHelpSyn = `
+Create a role binding service accounts to policies.
+`
+
+const pathRoleHelpDesc = `
+A role binds service accounts, by name and namespace, to the policies of
+the tokens they are issued at login. The login endpoint takes the name of
+the role along with the JWT of the service account.
+
+Both 'bound_service_account_names' and 'bound_service_account_namespaces'
+must be set. Either of them, but not both, can be "*" to allow any name or
+any namespace.
+`
+
+const pathListRolesHelpSyn = `
+Lists all the roles that are registered with Vault.
+`
+
+const pathListRolesHelpDesc = `
+Roles will be listed by their respective role names.
+`
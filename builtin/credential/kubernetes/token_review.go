@@ -0,0 +1,151 @@
+package kubernetes
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+// serviceAccountPrefix is the prefix of the user names Kubernetes gives
+// service accounts, followed by their namespace and name
+const serviceAccountPrefix = "system:serviceaccount:"
+
+// tokenReviewResult is the service account a JWT was issued to
+type tokenReviewResult struct {
+	Name      string
+	Namespace string
+	UID       string
+}
+
+// tokenReviewer verifies a service account JWT, returning the service
+// account it belongs to
+type tokenReviewer interface {
+	Review(jwt string) (*tokenReviewResult, error)
+}
+
+// tokenReviewFactory creates a reviewer for the given configuration
+type tokenReviewFactory func(config *kubeConfig) tokenReviewer
+
+// tokenReviewAPI verifies JWTs using the token review API of the
+// Kubernetes API server
+type tokenReviewAPI struct {
+	config *kubeConfig
+}
+
+func newTokenReviewAPI(config *kubeConfig) tokenReviewer {
+	return &tokenReviewAPI{config: config}
+}
+
+// tokenReview is the TokenReview resource of the Kubernetes API, limited
+// to the fields used here
+type tokenReview struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Spec       tokenReviewSpec   `json:"spec"`
+	Status     tokenReviewStatus `json:"status"`
+}
+
+type tokenReviewSpec struct {
+	Token string `json:"token"`
+}
+
+type tokenReviewStatus struct {
+	Authenticated bool            `json:"authenticated"`
+	User          tokenReviewUser `json:"user"`
+	Error         string          `json:"error"`
+}
+
+type tokenReviewUser struct {
+	Username string `json:"username"`
+	UID      string `json:"uid"`
+}
+
+func (t *tokenReviewAPI) Review(jwt string) (*tokenReviewResult, error) {
+	client := cleanhttp.DefaultClient()
+	if t.config.CACert != "" {
+		certPool := x509.NewCertPool()
+		certPool.AppendCertsFromPEM([]byte(t.config.CACert))
+		transport := cleanhttp.DefaultTransport()
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			RootCAs:    certPool,
+		}
+		client.Transport = transport
+	}
+
+	body, err := json.Marshal(&tokenReview{
+		APIVersion: "authentication.k8s.io/v1",
+		Kind:       "TokenReview",
+		Spec: tokenReviewSpec{
+			Token: jwt,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host := strings.TrimSuffix(t.config.Host, "/")
+	if !strings.Contains(host, "://") {
+		host = "https://" + host
+	}
+	req, err := http.NewRequest("POST", host+"/apis/authentication.k8s.io/v1/tokenreviews", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	// Without a reviewer JWT, the JWT being reviewed must be allowed to
+	// review itself
+	bearer := t.config.TokenReviewerJWT
+	if bearer == "" {
+		bearer = jwt
+	}
+	req.Header.Set("Authorization", "Bearer "+bearer)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error contacting the token review API: %s", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("not allowed to review tokens: the token reviewer JWT may be invalid or lack permissions")
+	default:
+		return nil, fmt.Errorf("unexpected status code from the token review API: %d", resp.StatusCode)
+	}
+
+	var result tokenReview
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, &result); err != nil {
+		return nil, fmt.Errorf("error decoding token review: %s", err)
+	}
+	if result.Status.Error != "" {
+		return nil, fmt.Errorf("token review failed: %s", result.Status.Error)
+	}
+	if !result.Status.Authenticated {
+		return nil, fmt.Errorf("JWT was not authenticated")
+	}
+
+	// Service accounts are named system:serviceaccount:<namespace>:<name>
+	if !strings.HasPrefix(result.Status.User.Username, serviceAccountPrefix) {
+		return nil, fmt.Errorf("JWT does not belong to a service account")
+	}
+	parts := strings.Split(strings.TrimPrefix(result.Status.User.Username, serviceAccountPrefix), ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("JWT does not belong to a service account")
+	}
+
+	return &tokenReviewResult{
+		Namespace: parts[0],
+		Name:      parts[1],
+		UID:       result.Status.User.UID,
+	}, nil
+}
@@ -3,6 +3,8 @@ package ldap
 import (
 	"bytes"
 	"fmt"
+	"strings"
+	"sync"
 	"text/template"
 
 	"github.com/go-ldap/ldap"
@@ -17,6 +19,7 @@ func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
 
 func Backend() *backend {
 	var b backend
+	b.setBindPassword = modifyBindPassword
 	b.Backend = &framework.Backend{
 		Help: backendHelp,
 
@@ -30,6 +33,7 @@ func Backend() *backend {
 
 		Paths: append([]*framework.Path{
 			pathConfig(&b),
+			pathConfigRotateRoot(&b),
 			pathGroups(&b),
 			pathGroupsList(&b),
 			pathUsers(&b),
@@ -46,6 +50,20 @@ func Backend() *backend {
 
 type backend struct {
 	*framework.Backend
+
+	// configLock serializes the changes of the configuration, so that the
+	// bind password is not rotated while it is reconfigured
+	configLock sync.Mutex
+
+	// setBindPassword changes the password of the bind DN on the LDAP
+	// server, so that it can be replaced in tests
+	setBindPassword func(cfg *ConfigEntry, password string) error
+}
+
+// searcher is the part of *ldap.Conn used to resolve groups, so that it can
+// be replaced in tests
+type searcher interface {
+	Search(*ldap.SearchRequest) (*ldap.SearchResult, error)
 }
 
 func EscapeLDAPValue(input string) string {
@@ -165,6 +183,35 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 	return policies, ldapResponse, nil
 }
 
+/*
+ * LookupGroups returns the LDAP groups of a user authenticated by other means,
+ * such as Kerberos. Since the password of the user is not known, the search is
+ * made while bound as cfg.BindDN, which must be set.
+ */
+func LookupGroups(cfg *ConfigEntry, username string) ([]string, error) {
+	if cfg.BindDN == "" || cfg.BindPassword == "" {
+		return nil, fmt.Errorf("binddn and bindpass must be configured to look up LDAP groups")
+	}
+
+	c, err := cfg.DialLDAP()
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("invalid connection returned from LDAP dial")
+	}
+	defer c.Close()
+
+	// With a bind DN configured, getBindDN binds as it and searches for the
+	// DN of the user
+	b := Backend()
+	userDN, err := b.getBindDN(cfg, c, username)
+	if err != nil {
+		return nil, err
+	}
+	return b.getLdapGroups(cfg, c, userDN, username)
+}
+
 /*
  * Parses a distinguished name and returns the CN portion.
  * Given a non-conforming string (such as an already-extracted CN),
@@ -179,7 +226,7 @@ func (b *backend) getCN(dn string) string {
 
 	for _, rdn := range parsedDN.RDNs {
 		for _, rdnAttr := range rdn.Attributes {
-			if rdnAttr.Type == "CN" {
+			if strings.EqualFold(rdnAttr.Type, "CN") {
 				return rdnAttr.Value
 			}
 		}
@@ -275,8 +322,11 @@ func (b *backend) getUserDN(cfg *ConfigEntry, c *ldap.Conn, bindDN string) (stri
  *
  * NOTE - If cfg.GroupFilter is empty, no query is performed and an empty result slice is returned.
  *
+ * If cfg.GroupNestingDepth is set, the groups containing the groups found are then resolved as well,
+ * see getNestedLdapGroups.
+ *
  */
-func (b *backend) getLdapGroups(cfg *ConfigEntry, c *ldap.Conn, userDN string, username string) ([]string, error) {
+func (b *backend) getLdapGroups(cfg *ConfigEntry, c searcher, userDN string, username string) ([]string, error) {
 	// retrieve the groups in a string/bool map as a structure to avoid duplicates inside
 	ldapMap := make(map[string]bool)
 
@@ -327,6 +377,9 @@ func (b *backend) getLdapGroups(cfg *ConfigEntry, c *ldap.Conn, userDN string, u
 		return nil, fmt.Errorf("LDAP search failed: %v", err)
 	}
 
+	// groupDNs holds the DNs of the group objects found, whose own groups are
+	// resolved when nesting is enabled
+	var groupDNs []string
 	for _, e := range result.Entries {
 		dn, err := ldap.ParseDN(e.DN)
 		if err != nil || len(dn.RDNs) == 0 {
@@ -339,11 +392,26 @@ func (b *backend) getLdapGroups(cfg *ConfigEntry, c *ldap.Conn, userDN string, u
 			for _, val := range values {
 				groupCN := b.getCN(val)
 				ldapMap[groupCN] = true
+
+				// Values such as memberOf name the group objects themselves
+				if isDN(val) {
+					groupDNs = append(groupDNs, val)
+				}
+			}
+			if !isDN(values[0]) {
+				groupDNs = append(groupDNs, e.DN)
 			}
 		} else {
 			// If groupattr didn't resolve, use self (enumerating group objects)
 			groupCN := b.getCN(e.DN)
 			ldapMap[groupCN] = true
+			groupDNs = append(groupDNs, e.DN)
+		}
+	}
+
+	if cfg.GroupNestingDepth > 0 {
+		if err := b.getNestedLdapGroups(cfg, c, groupDNs, ldapMap); err != nil {
+			return nil, err
 		}
 	}
 
@@ -355,6 +423,85 @@ func (b *backend) getLdapGroups(cfg *ConfigEntry, c *ldap.Conn, userDN string, u
 	return ldapGroups, nil
 }
 
+/*
+ * getNestedLdapGroups resolves the groups containing the given groups, and the groups containing these,
+ * up to cfg.GroupNestingDepth levels, adding them to ldapMap.
+ *
+ * This is for directories that cannot resolve nested groups in a single query, such as the
+ * LDAP_MATCHING_RULE_IN_CHAIN of Active Directory. At each level, the query is constructed according
+ * to cfg.NestedGroupFilter, a go template compiled with the following context: [GroupDN]
+ *    GroupDN - The DN of a group found at the previous level
+ *
+ * Groups already seen are not searched again, so that membership cycles terminate.
+ */
+func (b *backend) getNestedLdapGroups(cfg *ConfigEntry, c searcher, groupDNs []string, ldapMap map[string]bool) error {
+	t, err := template.New("nestedQueryTemplate").Parse(cfg.NestedGroupFilter)
+	if err != nil {
+		return fmt.Errorf("LDAP search failed due to template compilation error: %v", err)
+	}
+
+	seen := make(map[string]bool, len(groupDNs))
+	for _, dn := range groupDNs {
+		seen[strings.ToLower(dn)] = true
+	}
+
+	for depth := 0; depth < cfg.GroupNestingDepth && len(groupDNs) > 0; depth++ {
+		var parentDNs []string
+		for _, groupDN := range groupDNs {
+			context := struct {
+				GroupDN string
+			}{
+				ldap.EscapeFilter(groupDN),
+			}
+
+			var renderedQuery bytes.Buffer
+			t.Execute(&renderedQuery, context)
+
+			b.Logger().Printf("[DEBUG] auth/ldap: Searching nested groups, GroupDN=%s, query=%s", cfg.GroupDN, renderedQuery.String())
+
+			result, err := c.Search(&ldap.SearchRequest{
+				BaseDN: cfg.GroupDN,
+				Scope:  2, // subtree
+				Filter: renderedQuery.String(),
+				Attributes: []string{
+					"cn",
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("LDAP search for nested groups failed: %v", err)
+			}
+
+			for _, e := range result.Entries {
+				ldapMap[b.getCN(e.DN)] = true
+				if !seen[strings.ToLower(e.DN)] {
+					seen[strings.ToLower(e.DN)] = true
+					parentDNs = append(parentDNs, e.DN)
+				}
+			}
+		}
+		groupDNs = parentDNs
+	}
+
+	return nil
+}
+
+// isDN returns whether the given value is a distinguished name, as opposed
+// to a plain name such as a CN
+func isDN(value string) bool {
+	dn, err := ldap.ParseDN(value)
+	if err != nil || len(dn.RDNs) == 0 {
+		return false
+	}
+	for _, rdn := range dn.RDNs {
+		for _, attr := range rdn.Attributes {
+			if attr.Type == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 const backendHelp = `
 The "ldap" credential provider allows authentication querying
 a LDAP server, checking username and password, and associating groups
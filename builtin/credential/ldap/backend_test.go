@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-ldap/ldap"
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/mitchellh/mapstructure"
@@ -170,6 +171,15 @@ func TestBackend_configDefaultsAfterUpdate(t *testing.T) {
 						t.Errorf("Default mismatch: groupattr. Expected: '%s', received :'%s'", defaultGroupAttr, cfg["groupattr"])
 					}
 
+					defaultNestedGroupFilter := "(|(member={{.GroupDN}})(uniqueMember={{.GroupDN}}))"
+					if cfg["nested_group_filter"] != defaultNestedGroupFilter {
+						t.Errorf("Default mismatch: nested_group_filter. Expected: '%s', received :'%s'", defaultNestedGroupFilter, cfg["nested_group_filter"])
+					}
+
+					if cfg["group_nesting_depth"] != 0 {
+						t.Errorf("Default mismatch: group_nesting_depth. Expected: 0, received :'%v'", cfg["group_nesting_depth"])
+					}
+
 					defaultUserAttr := "cn"
 					if cfg["userattr"] != defaultUserAttr {
 						t.Errorf("Default mismatch: userattr. Expected: '%s', received :'%s'", defaultUserAttr, cfg["userattr"])
@@ -182,6 +192,138 @@ func TestBackend_configDefaultsAfterUpdate(t *testing.T) {
 	})
 }
 
+func TestBackend_rotateRoot(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(&logical.BackendConfig{
+		System:      logical.TestSystemView(),
+		StorageView: storage,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	passwords := map[string]string{}
+	b.setBindPassword = func(cfg *ConfigEntry, password string) error {
+		if passwords[cfg.BindDN] != cfg.BindPassword {
+			return fmt.Errorf("invalid credentials")
+		}
+		passwords[cfg.BindDN] = password
+		return nil
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+	}
+
+	// A bind DN and password are required
+	resp, err := request(logical.UpdateOperation, "config/rotate-root", nil)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: resp:%#v err:%v", resp, err)
+	}
+
+	bindDN := "cn=vault,dc=example,dc=com"
+	passwords[bindDN] = "initial"
+	if _, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"binddn":   bindDN,
+		"bindpass": "initial",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err = request(logical.UpdateOperation, "config/rotate-root", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp:%#v err:%v", resp, err)
+	}
+	if passwords[bindDN] == "initial" {
+		t.Fatal("expected the password to be rotated")
+	}
+
+	// The password is not returned, and is kept when the configuration is
+	// updated without it
+	if _, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"binddn":   bindDN,
+		"userattr": "uid",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request(logical.ReadOperation, "config", nil)
+	if err != nil || resp == nil {
+		t.Fatalf("bad: resp:%#v err:%v", resp, err)
+	}
+	if _, ok := resp.Data["bindpass"]; ok || resp.Data["userattr"] != "uid" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The stored password is used for the next rotation
+	resp, err = request(logical.UpdateOperation, "config/rotate-root", nil)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp:%#v err:%v", resp, err)
+	}
+}
+
+// testSearcher answers LDAP searches with the entries of their filter
+type testSearcher map[string][]*ldap.Entry
+
+func (s testSearcher) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	return &ldap.SearchResult{Entries: s[req.Filter]}, nil
+}
+
+func TestBackend_nestedGroups(t *testing.T) {
+	b := Backend()
+
+	const (
+		userDN        = "uid=alice,ou=people,dc=example,dc=com"
+		devDN         = "cn=dev,ou=groups,dc=example,dc=com"
+		engineeringDN = "cn=engineering,ou=groups,dc=example,dc=com"
+		staffDN       = "CN=staff,ou=groups,dc=example,dc=com"
+	)
+	parentsFilter := func(dn string) string {
+		return fmt.Sprintf("(|(member=%s)(uniqueMember=%s))", dn, dn)
+	}
+	// Group membership has a cycle: staff is a member of dev
+	searcher := testSearcher{
+		"(member=" + userDN + ")":    {ldap.NewEntry(devDN, map[string][]string{"cn": {"dev"}})},
+		"(uid=alice)":                {ldap.NewEntry(userDN, map[string][]string{"memberOf": {devDN}})},
+		parentsFilter(devDN):         {ldap.NewEntry(engineeringDN, nil)},
+		parentsFilter(engineeringDN): {ldap.NewEntry(staffDN, nil)},
+		parentsFilter(staffDN):       {ldap.NewEntry(devDN, nil)},
+	}
+
+	for _, c := range []struct {
+		groupFilter string
+		groupAttr   string
+		depth       int
+		expected    []string
+	}{
+		{"(member={{.UserDN}})", "cn", 0, []string{"dev"}},
+		{"(member={{.UserDN}})", "cn", 1, []string{"dev", "engineering"}},
+		{"(member={{.UserDN}})", "cn", 10, []string{"dev", "engineering", "staff"}},
+		{"(uid={{.Username}})", "memberOf", 0, []string{"dev"}},
+		{"(uid={{.Username}})", "memberOf", 2, []string{"dev", "engineering", "staff"}},
+	} {
+		cfg := &ConfigEntry{
+			GroupDN:           "ou=groups,dc=example,dc=com",
+			GroupFilter:       c.groupFilter,
+			GroupAttr:         c.groupAttr,
+			NestedGroupFilter: "(|(member={{.GroupDN}})(uniqueMember={{.GroupDN}}))",
+			GroupNestingDepth: c.depth,
+		}
+		groups, err := b.getLdapGroups(cfg, searcher, userDN, "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(groups)
+		if !reflect.DeepEqual(groups, c.expected) {
+			t.Fatalf("%s %s %d: expected %v, got %v", c.groupFilter, c.groupAttr, c.depth, c.expected, groups)
+		}
+	}
+}
+
 func testAccStepConfigUrl(t *testing.T) logicaltest.TestStep {
 	return logicaltest.TestStep{
 		Operation: logical.UpdateOperation,
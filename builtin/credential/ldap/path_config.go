@@ -16,92 +16,116 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
-func pathConfig(b *backend) *framework.Path {
-	return &framework.Path{
-		Pattern: `config`,
-		Fields: map[string]*framework.FieldSchema{
-			"url": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Default:     "ldap://127.0.0.1",
-				Description: "ldap URL to connect to (default: ldap://127.0.0.1)",
-			},
-
-			"userdn": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "LDAP domain to use for users (eg: ou=People,dc=example,dc=org)",
-			},
-
-			"binddn": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "LDAP DN for searching for the user DN (optional)",
-			},
-
-			"bindpass": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "LDAP password for searching for the user DN (optional)",
-			},
-
-			"groupdn": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "LDAP search base to use for group membership search (eg: ou=Groups,dc=example,dc=org)",
-			},
-
-			"groupfilter": &framework.FieldSchema{
-				Type:    framework.TypeString,
-				Default: "(|(memberUid={{.Username}})(member={{.UserDN}})(uniqueMember={{.UserDN}}))",
-				Description: `Go template for querying group membership of user (optional)
+// ConfigFields returns the schema of the configuration of the LDAP server.
+// It is shared with backends which look up the LDAP groups of users they
+// authenticate by other means.
+func ConfigFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"url": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "ldap://127.0.0.1",
+			Description: "ldap URL to connect to (default: ldap://127.0.0.1)",
+		},
+
+		"userdn": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "LDAP domain to use for users (eg: ou=People,dc=example,dc=org)",
+		},
+
+		"binddn": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "LDAP DN for searching for the user DN (optional)",
+		},
+
+		"bindpass": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "LDAP password for searching for the user DN (optional)",
+		},
+
+		"groupdn": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "LDAP search base to use for group membership search (eg: ou=Groups,dc=example,dc=org)",
+		},
+
+		"groupfilter": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "(|(memberUid={{.Username}})(member={{.UserDN}})(uniqueMember={{.UserDN}}))",
+			Description: `Go template for querying group membership of user (optional)
 The template can access the following context variables: UserDN, Username
 Example: (&(objectClass=group)(member:1.2.840.113556.1.4.1941:={{.UserDN}}))
 Default: (|(memberUid={{.Username}})(member={{.UserDN}})(uniqueMember={{.UserDN}}))`,
-			},
+		},
 
-			"groupattr": &framework.FieldSchema{
-				Type:    framework.TypeString,
-				Default: "cn",
-				Description: `LDAP attribute to follow on objects returned by <groupfilter>
+		"groupattr": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "cn",
+			Description: `LDAP attribute to follow on objects returned by <groupfilter>
 in order to enumerate user group membership.
 Examples: "cn" or "memberOf", etc.
 Default: cn`,
-			},
-
-			"upndomain": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "Enables userPrincipalDomain login with [username]@UPNDomain (optional)",
-			},
-
-			"userattr": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Default:     "cn",
-				Description: "Attribute used for users (default: cn)",
-			},
-
-			"certificate": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "CA certificate to use when verifying LDAP server certificate, must be x509 PEM encoded (optional)",
-			},
-
-			"discoverdn": &framework.FieldSchema{
-				Type:        framework.TypeBool,
-				Description: "Use anonymous bind to discover the bind DN of a user (optional)",
-			},
-
-			"insecure_tls": &framework.FieldSchema{
-				Type:        framework.TypeBool,
-				Description: "Skip LDAP server SSL Certificate verification - VERY insecure (optional)",
-			},
-
-			"starttls": &framework.FieldSchema{
-				Type:        framework.TypeBool,
-				Description: "Issue a StartTLS command after establishing unencrypted connection (optional)",
-			},
-
-			"tls_min_version": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Default:     "tls12",
-				Description: "Minimum TLS version to use. Accepted values are 'tls10', 'tls11' or 'tls12'. Defaults to 'tls12'",
-			},
 		},
 
+		"nested_group_filter": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "(|(member={{.GroupDN}})(uniqueMember={{.GroupDN}}))",
+			Description: `Go template for querying the groups containing a group, used to resolve
+nested groups (optional)
+The template can access the following context variables: GroupDN
+Default: (|(member={{.GroupDN}})(uniqueMember={{.GroupDN}}))`,
+		},
+
+		"group_nesting_depth": &framework.FieldSchema{
+			Type:    framework.TypeInt,
+			Default: 0,
+			Description: `Number of levels of nested groups to resolve with <nested_group_filter>.
+Not needed when <groupfilter> resolves nested groups itself.
+Default: 0, in which case nested groups are not resolved`,
+		},
+
+		"upndomain": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Enables userPrincipalDomain login with [username]@UPNDomain (optional)",
+		},
+
+		"userattr": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "cn",
+			Description: "Attribute used for users (default: cn)",
+		},
+
+		"certificate": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "CA certificate to use when verifying LDAP server certificate, must be x509 PEM encoded (optional)",
+		},
+
+		"discoverdn": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Use anonymous bind to discover the bind DN of a user (optional)",
+		},
+
+		"insecure_tls": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Skip LDAP server SSL Certificate verification - VERY insecure (optional)",
+		},
+
+		"starttls": &framework.FieldSchema{
+			Type:        framework.TypeBool,
+			Description: "Issue a StartTLS command after establishing unencrypted connection (optional)",
+		},
+
+		"tls_min_version": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "tls12",
+			Description: "Minimum TLS version to use. Accepted values are 'tls10', 'tls11' or 'tls12'. Defaults to 'tls12'",
+		},
+	}
+}
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config`,
+		Fields:  ConfigFields(),
+
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation:   b.pathConfigRead,
 			logical.UpdateOperation: b.pathConfigWrite,
@@ -123,7 +147,7 @@ func (b *backend) Config(req *logical.Request) (*ConfigEntry, error) {
 	}
 
 	// Create a new ConfigEntry, filling in defaults where appropriate
-	result, err := b.newConfigEntry(fd)
+	result, err := NewConfigEntry(fd)
 	if err != nil {
 		return nil, err
 	}
@@ -158,10 +182,15 @@ func (b *backend) pathConfigRead(
 		return nil, nil
 	}
 
+	// The bind password is never returned, so that it stays unknown once
+	// rotated
+	data := structs.New(cfg).Map()
+	delete(data, "bindpass")
+
 	resp := &logical.Response{
-		Data: structs.New(cfg).Map(),
+		Data: data,
 	}
-	resp.AddWarning("Read access to this endpoint should be controlled via ACLs as it will return the configuration information as-is, including any passwords.")
+	resp.AddWarning("Read access to this endpoint should be controlled via ACLs as it will return the configuration information as-is, except for the bind password.")
 	return resp, nil
 }
 
@@ -169,7 +198,7 @@ func (b *backend) pathConfigRead(
  * Creates and initializes a ConfigEntry object with its default values,
  * as specified by the passed schema.
  */
-func (b *backend) newConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
+func NewConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
 	cfg := new(ConfigEntry)
 
 	url := d.Get("url").(string)
@@ -198,6 +227,20 @@ func (b *backend) newConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
 
 		cfg.GroupFilter = groupfilter
 	}
+	nestedGroupFilter := d.Get("nested_group_filter").(string)
+	if nestedGroupFilter != "" {
+		// Validate the template before proceeding
+		_, err := template.New("nestedQueryTemplate").Parse(nestedGroupFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid nested_group_filter (%v)", err)
+		}
+
+		cfg.NestedGroupFilter = nestedGroupFilter
+	}
+	cfg.GroupNestingDepth = d.Get("group_nesting_depth").(int)
+	if cfg.GroupNestingDepth < 0 {
+		return nil, fmt.Errorf("group_nesting_depth cannot be negative")
+	}
 	groupattr := d.Get("groupattr").(string)
 	if groupattr != "" {
 		cfg.GroupAttr = groupattr
@@ -248,12 +291,27 @@ func (b *backend) newConfigEntry(d *framework.FieldData) (*ConfigEntry, error) {
 func (b *backend) pathConfigWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
+
 	// Build a ConfigEntry struct out of the supplied FieldData
-	cfg, err := b.newConfigEntry(d)
+	cfg, err := NewConfigEntry(d)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
 	}
 
+	// The bind password cannot be read back, so it is kept unless given or
+	// the bind DN changes
+	if cfg.BindPassword == "" && cfg.BindDN != "" {
+		existing, err := b.Config(req)
+		if err != nil {
+			return nil, err
+		}
+		if existing.BindDN == cfg.BindDN {
+			cfg.BindPassword = existing.BindPassword
+		}
+	}
+
 	entry, err := logical.StorageEntryJSON("config", cfg)
 	if err != nil {
 		return nil, err
@@ -266,20 +324,22 @@ func (b *backend) pathConfigWrite(
 }
 
 type ConfigEntry struct {
-	Url           string `json:"url" structs:"url" mapstructure:"url"`
-	UserDN        string `json:"userdn" structs:"userdn" mapstructure:"userdn"`
-	GroupDN       string `json:"groupdn" structs:"groupdn" mapstructure:"groupdn"`
-	GroupFilter   string `json:"groupfilter" structs:"groupfilter" mapstructure:"groupfilter"`
-	GroupAttr     string `json:"groupattr" structs:"groupattr" mapstructure:"groupattr"`
-	UPNDomain     string `json:"upndomain" structs:"upndomain" mapstructure:"upndomain"`
-	UserAttr      string `json:"userattr" structs:"userattr" mapstructure:"userattr"`
-	Certificate   string `json:"certificate" structs:"certificate" mapstructure:"certificate"`
-	InsecureTLS   bool   `json:"insecure_tls" structs:"insecure_tls" mapstructure:"insecure_tls"`
-	StartTLS      bool   `json:"starttls" structs:"starttls" mapstructure:"starttls"`
-	BindDN        string `json:"binddn" structs:"binddn" mapstructure:"binddn"`
-	BindPassword  string `json:"bindpass" structs:"bindpass" mapstructure:"bindpass"`
-	DiscoverDN    bool   `json:"discoverdn" structs:"discoverdn" mapstructure:"discoverdn"`
-	TLSMinVersion string `json:"tls_min_version" structs:"tls_min_version" mapstructure:"tls_min_version"`
+	Url               string `json:"url" structs:"url" mapstructure:"url"`
+	UserDN            string `json:"userdn" structs:"userdn" mapstructure:"userdn"`
+	GroupDN           string `json:"groupdn" structs:"groupdn" mapstructure:"groupdn"`
+	GroupFilter       string `json:"groupfilter" structs:"groupfilter" mapstructure:"groupfilter"`
+	GroupAttr         string `json:"groupattr" structs:"groupattr" mapstructure:"groupattr"`
+	NestedGroupFilter string `json:"nested_group_filter" structs:"nested_group_filter" mapstructure:"nested_group_filter"`
+	GroupNestingDepth int    `json:"group_nesting_depth" structs:"group_nesting_depth" mapstructure:"group_nesting_depth"`
+	UPNDomain         string `json:"upndomain" structs:"upndomain" mapstructure:"upndomain"`
+	UserAttr          string `json:"userattr" structs:"userattr" mapstructure:"userattr"`
+	Certificate       string `json:"certificate" structs:"certificate" mapstructure:"certificate"`
+	InsecureTLS       bool   `json:"insecure_tls" structs:"insecure_tls" mapstructure:"insecure_tls"`
+	StartTLS          bool   `json:"starttls" structs:"starttls" mapstructure:"starttls"`
+	BindDN            string `json:"binddn" structs:"binddn" mapstructure:"binddn"`
+	BindPassword      string `json:"bindpass" structs:"bindpass" mapstructure:"bindpass"`
+	DiscoverDN        bool   `json:"discoverdn" structs:"discoverdn" mapstructure:"discoverdn"`
+	TLSMinVersion     string `json:"tls_min_version" structs:"tls_min_version" mapstructure:"tls_min_version"`
 }
 
 func (c *ConfigEntry) GetTLSConfig(host string) (*tls.Config, error) {
@@ -0,0 +1,88 @@
+package ldap
+
+import (
+	"fmt"
+
+	"github.com/go-ldap/ldap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfigRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config/rotate-root`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathConfigRotateRootUpdate,
+		},
+
+		HelpSynopsis:    pathConfigRotateRootHelpSyn,
+		HelpDescription: pathConfigRotateRootHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRotateRootUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.configLock.Lock()
+	defer b.configLock.Unlock()
+
+	cfg, err := b.Config(req)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.BindDN == "" || cfg.BindPassword == "" {
+		return logical.ErrorResponse("binddn and bindpass must be configured to rotate the bind password"), nil
+	}
+
+	password, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	if err := b.setBindPassword(cfg, password); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error rotating the bind password: %s", err)), nil
+	}
+
+	cfg.BindPassword = password
+	entry, err := logical.StorageEntryJSON("config", cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, fmt.Errorf("the bind password was rotated but could not be stored: %s", err)
+	}
+
+	return nil, nil
+}
+
+// modifyBindPassword binds with the configured credentials and changes the
+// password of the bind DN with the password modify extended operation of
+// RFC 3062
+func modifyBindPassword(cfg *ConfigEntry, password string) error {
+	c, err := cfg.DialLDAP()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return fmt.Errorf("LDAP bind failed: %v", err)
+	}
+
+	_, err = c.PasswordModify(ldap.NewPasswordModifyRequest(cfg.BindDN, cfg.BindPassword, password))
+	return err
+}
+
+const pathConfigRotateRootHelpSyn = `
+Rotate the password of the bind DN.
+`
+
+const pathConfigRotateRootHelpDesc = `
+This endpoint sets a password generated by Vault for the configured bind DN,
+with the LDAP password modify extended operation, and stores it in place of
+the configured one. The password is never returned, so that only Vault knows
+it.
+
+The LDAP server must support the password modify extended operation of
+RFC 3062, which Active Directory does not.
+`
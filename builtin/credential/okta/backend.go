@@ -0,0 +1,72 @@
+package okta
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: backendHelp,
+
+		PathsSpecial: &logical.Paths{
+			Unauthenticated: []string{
+				"login/*",
+			},
+		},
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathUsers(&b),
+			pathUsersList(&b),
+			pathGroups(&b),
+			pathGroupsList(&b),
+			pathLogin(&b),
+		},
+
+		AuthRenew: b.pathLoginRenew,
+	}
+
+	b.client = cleanhttp.DefaultClient()
+	b.pushPollInterval = time.Second
+	b.pushTimeout = time.Minute
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	client *http.Client
+
+	// orgURL, when set, is used instead of the URL of the configured
+	// organization. It is only set in tests.
+	orgURL string
+
+	// pushPollInterval and pushTimeout control how long a login waits for
+	// the user to answer a push notification
+	pushPollInterval time.Duration
+	pushTimeout      time.Duration
+}
+
+const backendHelp = `
+The Okta credential provider allows authentication with the username and
+password of an Okta user.
+
+Policies are associated with Okta users and groups through the "users/" and
+"groups/" endpoints. The Okta groups of a user are looked up when an API token
+is configured. If Okta requires MFA for the user, the login is completed with
+a push notification, or with the "totp" passcode if given.
+
+After enabling the credential provider, use the "config" endpoint to
+configure it.
+`
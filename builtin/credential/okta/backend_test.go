@@ -0,0 +1,281 @@
+package okta
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// testOkta serves the parts of the Okta API used by the backend. Users
+// other than alice require MFA; carol rejects push notifications.
+type testOkta struct {
+	t      *testing.T
+	server *httptest.Server
+	polls  int
+}
+
+func (o *testOkta) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	if r.Method == "POST" {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			o.t.Fatal(err)
+		}
+	}
+
+	var resp interface{}
+	switch r.URL.Path {
+	case "/api/v1/authn":
+		if body["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		user := body["username"]
+		if user == "alice" {
+			resp = testAuthn("SUCCESS", user, "")
+			break
+		}
+		authn := testAuthn("MFA_REQUIRED", user, "")
+		authn["stateToken"] = "state-" + user
+		authn["_embedded"].(map[string]interface{})["factors"] = []interface{}{
+			map[string]interface{}{
+				"id":         "push",
+				"factorType": oktaFactorPush,
+				"_links": map[string]interface{}{
+					"verify": map[string]string{"href": o.server.URL + "/api/v1/authn/factors/push/verify"},
+				},
+			},
+			map[string]interface{}{
+				"id":         "totp",
+				"factorType": oktaFactorTOTP,
+				"_links": map[string]interface{}{
+					"verify": map[string]string{"href": o.server.URL + "/api/v1/authn/factors/totp/verify"},
+				},
+			},
+		}
+		resp = authn
+	case "/api/v1/authn/factors/totp/verify":
+		if body["passCode"] != "123456" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		resp = testAuthn("SUCCESS", strings.TrimPrefix(body["stateToken"], "state-"), "")
+	case "/api/v1/authn/factors/push/verify":
+		user := strings.TrimPrefix(body["stateToken"], "state-")
+		o.polls++
+		switch {
+		case o.polls < 3:
+			resp = testAuthn("MFA_CHALLENGE", user, "WAITING")
+		case user == "carol":
+			resp = testAuthn("MFA_CHALLENGE", user, "REJECTED")
+		default:
+			resp = testAuthn("SUCCESS", user, "")
+		}
+	case "/api/v1/users/id-alice/groups", "/api/v1/users/id-bob/groups":
+		if r.Header.Get("Authorization") != "SSWS token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		name := "admins"
+		if strings.Contains(r.URL.Path, "bob") {
+			name = "devs"
+		}
+		resp = []interface{}{
+			map[string]interface{}{"profile": map[string]string{"name": name}},
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func testAuthn(status, user, factorResult string) map[string]interface{} {
+	return map[string]interface{}{
+		"status":       status,
+		"factorResult": factorResult,
+		"_embedded": map[string]interface{}{
+			"user": map[string]string{"id": "id-" + user},
+		},
+	}
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage, *testOkta) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	okta := &testOkta{t: t}
+	okta.server = httptest.NewServer(okta)
+
+	b := Backend()
+	b.orgURL = okta.server.URL
+	b.pushPollInterval = time.Millisecond
+	if _, err := b.Backend.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView, okta
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func TestBackend_Config(t *testing.T) {
+	b, storage, okta := createBackendWithStorage(t)
+	defer okta.server.Close()
+
+	for _, data := range []map[string]interface{}{
+		{"token": "token"},
+		{"organization": "dev-123.okta.com"},
+	} {
+		resp := testWrite(t, b, storage, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testWrite(t, b, storage, "config", map[string]interface{}{
+		"organization": "dev-123",
+		"token":        "token",
+		"ttl":          60,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "config",
+		Storage:   storage,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Data["organization"] != "dev-123" || resp.Data["base_url"] != "okta.com" || resp.Data["ttl"] != time.Duration(60) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["token"]; ok {
+		t.Fatalf("token should not be returned")
+	}
+}
+
+func TestBackend_Login(t *testing.T) {
+	b, storage, okta := createBackendWithStorage(t)
+	defer okta.server.Close()
+
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"organization": "dev-123",
+	})
+	testWrite(t, b, storage, "groups/admins", map[string]interface{}{
+		"policies": "admin",
+	})
+	testWrite(t, b, storage, "groups/devs", map[string]interface{}{
+		"policies": "dev",
+	})
+	testWrite(t, b, storage, "users/alice", map[string]interface{}{
+		"policies": "alice",
+	})
+
+	login := func(user string, data map[string]interface{}) *logical.Response {
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		if _, ok := data["password"]; !ok {
+			data["password"] = "secret"
+		}
+		return testWrite(t, b, storage, "login/"+user, data)
+	}
+
+	// Without an API token, only the groups and policies of the backend apply
+	resp := login("alice", nil)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if strings.Join(resp.Auth.Policies, ",") != "alice,default" {
+		t.Fatalf("bad policies: %#v", resp.Auth.Policies)
+	}
+	if resp := login("bob", map[string]interface{}{"totp": "123456"}); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	testWrite(t, b, storage, "config", map[string]interface{}{
+		"token": "token",
+	})
+	resp = login("alice", nil)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if strings.Join(resp.Auth.Policies, ",") != "admin,alice,default" {
+		t.Fatalf("bad policies: %#v", resp.Auth.Policies)
+	}
+
+	// Renewals check the groups again
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Path:      "login/alice",
+		Storage:   storage,
+		Auth:      resp.Auth,
+	}
+	renewReq.Auth.IssueTime = time.Now()
+	if _, err := b.pathLoginRenew(renewReq, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testWrite(t, b, storage, "groups/admins", map[string]interface{}{
+		"policies": "other",
+	})
+	if _, err := b.pathLoginRenew(renewReq, nil); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// MFA with a TOTP passcode
+	resp = login("bob", map[string]interface{}{"totp": "123456"})
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if strings.Join(resp.Auth.Policies, ",") != "default,dev" {
+		t.Fatalf("bad policies: %#v", resp.Auth.Policies)
+	}
+
+	// MFA with a push notification, which is polled until accepted
+	resp = login("bob", nil)
+	if resp == nil || resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if okta.polls != 3 {
+		t.Fatalf("expected 3 polls, got %d", okta.polls)
+	}
+
+	okta.polls = 0
+	for _, c := range []struct {
+		user string
+		data map[string]interface{}
+	}{
+		{"alice", map[string]interface{}{"password": "wrong"}},
+		{"bob", map[string]interface{}{"totp": "654321"}},
+		{"carol", nil},
+	} {
+		if resp := login(c.user, c.data); resp == nil || !resp.IsError() {
+			t.Fatalf("%s %v: expected an error: %#v", c.user, c.data, resp)
+		}
+	}
+
+	// Push notifications that are not answered time out
+	okta.polls = -1000
+	b.pushTimeout = 10 * time.Millisecond
+	if resp := login("bob", nil); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
@@ -0,0 +1,211 @@
+package okta
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+// Factor types of the Okta MFA factors a login can be completed with
+const (
+	oktaFactorPush = "push"
+	oktaFactorTOTP = "token:software:totp"
+)
+
+// authnResponse is the response of the Okta authentication API, limited to
+// the fields used here
+type authnResponse struct {
+	Status       string `json:"status"`
+	StateToken   string `json:"stateToken"`
+	FactorResult string `json:"factorResult"`
+	Embedded     struct {
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+		Factors []oktaFactor `json:"factors"`
+	} `json:"_embedded"`
+	Links struct {
+		Next *oktaLink `json:"next"`
+	} `json:"_links"`
+}
+
+// oktaFactor is an MFA factor the user is enrolled in
+type oktaFactor struct {
+	ID         string `json:"id"`
+	FactorType string `json:"factorType"`
+	Links      struct {
+		Verify oktaLink `json:"verify"`
+	} `json:"_links"`
+}
+
+type oktaLink struct {
+	Href string `json:"href"`
+}
+
+type oktaGroup struct {
+	Profile struct {
+		Name string `json:"name"`
+	} `json:"profile"`
+}
+
+// apiURL returns the URL of the given path of the Okta API of the
+// organization
+func (b *backend) apiURL(cfg *ConfigEntry, path string) string {
+	base := cfg.URL()
+	if b.orgURL != "" {
+		base = b.orgURL
+	}
+	return base + "/api/v1/" + path
+}
+
+// call sends the request body as JSON to the Okta API, and decodes the
+// response into out. The API token is sent if given.
+func (b *backend) call(method, url, token string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "SSWS "+token)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d from Okta", resp.StatusCode)
+	}
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, out); err != nil {
+		return fmt.Errorf("error decoding the response of Okta: %s", err)
+	}
+	return nil
+}
+
+// authenticate checks the username and password with Okta, and completes
+// the MFA challenge if Okta requires one. It returns the Okta ID of the
+// user.
+func (b *backend) authenticate(cfg *ConfigEntry, username, password, totp string) (string, error) {
+	var authn authnResponse
+	err := b.call("POST", b.apiURL(cfg, "authn"), "", map[string]string{
+		"username": username,
+		"password": password,
+	}, &authn)
+	if err != nil {
+		// Okta answers invalid credentials with a 401
+		b.Logger().Printf("[DEBUG] auth/okta: authentication of %s failed: %s", username, err)
+		return "", fmt.Errorf("okta auth failed")
+	}
+
+	switch authn.Status {
+	case "SUCCESS":
+	case "MFA_REQUIRED":
+		if err := b.verifyMFA(&authn, totp); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("okta auth failed: user status is %s", authn.Status)
+	}
+
+	if authn.Embedded.User.ID == "" {
+		return "", fmt.Errorf("okta auth failed: no user in the response of Okta")
+	}
+	return authn.Embedded.User.ID, nil
+}
+
+// verifyMFA completes the MFA challenge of the authentication transaction,
+// with the TOTP factor if a passcode is given, or else with a push
+// notification
+func (b *backend) verifyMFA(authn *authnResponse, totp string) error {
+	factorType := oktaFactorPush
+	if totp != "" {
+		factorType = oktaFactorTOTP
+	}
+
+	var factor *oktaFactor
+	for i, f := range authn.Embedded.Factors {
+		if f.FactorType == factorType {
+			factor = &authn.Embedded.Factors[i]
+			break
+		}
+	}
+	if factor == nil {
+		return fmt.Errorf("okta MFA is required, but the user is not enrolled in the %s factor", factorType)
+	}
+
+	body := map[string]string{
+		"stateToken": authn.StateToken,
+	}
+	if totp != "" {
+		body["passCode"] = totp
+	}
+
+	var result authnResponse
+	if err := b.call("POST", factor.Links.Verify.Href, "", body, &result); err != nil {
+		b.Logger().Printf("[DEBUG] auth/okta: MFA verification failed: %s", err)
+		return fmt.Errorf("okta MFA verification failed")
+	}
+
+	// The result of a push notification is polled until the user answers
+	deadline := time.Now().Add(b.pushTimeout)
+	for result.Status == "MFA_CHALLENGE" && result.FactorResult == "WAITING" {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the okta push notification to be answered")
+		}
+		time.Sleep(b.pushPollInterval)
+
+		pollURL := factor.Links.Verify.Href
+		if result.Links.Next != nil && result.Links.Next.Href != "" {
+			pollURL = result.Links.Next.Href
+		}
+		result = authnResponse{}
+		if err := b.call("POST", pollURL, "", body, &result); err != nil {
+			b.Logger().Printf("[DEBUG] auth/okta: MFA verification failed: %s", err)
+			return fmt.Errorf("okta MFA verification failed")
+		}
+	}
+
+	if result.Status != "SUCCESS" {
+		if result.FactorResult != "" {
+			return fmt.Errorf("okta MFA verification failed: %s", result.FactorResult)
+		}
+		return fmt.Errorf("okta MFA verification failed")
+	}
+
+	if result.Embedded.User.ID != "" {
+		authn.Embedded.User = result.Embedded.User
+	}
+	return nil
+}
+
+// oktaGroups returns the names of the Okta groups of the user, looked up
+// with the API token of the configuration
+func (b *backend) oktaGroups(cfg *ConfigEntry, userID string) ([]string, error) {
+	var groups []oktaGroup
+	path := fmt.Sprintf("users/%s/groups", url.QueryEscape(userID))
+	if err := b.call("GET", b.apiURL(cfg, path), cfg.Token, nil, &groups); err != nil {
+		return nil, fmt.Errorf("error looking up the okta groups of the user: %s", err)
+	}
+
+	names := make([]string, 0, len(groups))
+	for _, group := range groups {
+		names = append(names, group.Profile.Name)
+	}
+	return names, nil
+}
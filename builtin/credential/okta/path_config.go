@@ -0,0 +1,184 @@
+package okta
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `config$`,
+		Fields: map[string]*framework.FieldSchema{
+			"organization": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The Okta organization, which is the first part of the URL, e.g. dev-123456.",
+			},
+
+			"token": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The Okta API token, used to look up the groups of users. Optional.",
+			},
+
+			"base_url": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "okta.com",
+				Description: `The domain of the organization, "okta.com" or "oktapreview.com". Defaults to "okta.com".`,
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Duration after which authentication will be expired.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum duration after which authentication will be expired.",
+			},
+		},
+
+		ExistenceCheck: b.pathConfigExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConfigWrite,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathConfigExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+// Config returns the configuration for this backend.
+func (b *backend) Config(s logical.Storage) (*ConfigEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result ConfigEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The API token is a credential, so it is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"organization": config.Org,
+			"base_url":     config.BaseURL,
+			"ttl":          config.TTL / time.Second,
+			"max_ttl":      config.MaxTTL / time.Second,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &ConfigEntry{
+			BaseURL: data.Get("base_url").(string),
+		}
+	}
+
+	if orgRaw, ok := data.GetOk("organization"); ok {
+		config.Org = orgRaw.(string)
+	}
+	if tokenRaw, ok := data.GetOk("token"); ok {
+		config.Token = tokenRaw.(string)
+	}
+	if baseURLRaw, ok := data.GetOk("base_url"); ok {
+		config.BaseURL = baseURLRaw.(string)
+	}
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		config.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		config.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+
+	if config.Org == "" {
+		return logical.ErrorResponse("organization must be set"), nil
+	}
+	if strings.ContainsAny(config.Org, "./:") {
+		return logical.ErrorResponse("organization must be the name of the organization, not its URL"), nil
+	}
+	if _, err := url.Parse(config.URL()); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid base_url: %s", err)), nil
+	}
+	if config.MaxTTL != 0 && config.TTL > config.MaxTTL {
+		return logical.ErrorResponse("ttl should not be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// ConfigEntry holds the Okta organization users log in to
+type ConfigEntry struct {
+	Org     string        `json:"organization"`
+	Token   string        `json:"token"`
+	BaseURL string        `json:"base_url"`
+	TTL     time.Duration `json:"ttl"`
+	MaxTTL  time.Duration `json:"max_ttl"`
+}
+
+// URL returns the URL of the Okta organization
+func (c *ConfigEntry) URL() string {
+	return fmt.Sprintf("https://%s.%s", c.Org, c.BaseURL)
+}
+
+const pathConfigHelpSyn = `
+Configures the Okta organization users log in to.
+`
+
+const pathConfigHelpDesc = `
+Users log in to the Okta organization 'organization', found at
+https://<organization>.<base_url>.
+
+The API token 'token' is optional. When set, the Okta groups of users are
+looked up at login and renewal, and the policies of the matching groups of
+this backend are granted. Without it, only the groups and policies
+configured for users in this backend apply.
+`
@@ -0,0 +1,174 @@
+package okta
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathLogin(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `login/(?P<username>.+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username to be used for login.",
+			},
+
+			"password": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password for this user.",
+			},
+
+			"totp": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "TOTP passcode, used when Okta requires MFA instead of a push notification.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathLogin,
+		},
+
+		HelpSynopsis:    pathLoginSyn,
+		HelpDescription: pathLoginDesc,
+	}
+}
+
+func (b *backend) pathLogin(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	username := d.Get("username").(string)
+	password := d.Get("password").(string)
+	totp := d.Get("totp").(string)
+
+	cfg, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("okta backend not configured"), nil
+	}
+
+	userID, err := b.authenticate(cfg, username, password, totp)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	policies, err := b.policies(req.Storage, cfg, username, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(policies) == 0 {
+		return logical.ErrorResponse("user is not a member of any authorized group"), nil
+	}
+
+	ttl, _, err := b.SanitizeTTL(cfg.TTL, cfg.MaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Auth: &logical.Auth{
+			Policies: policies,
+			Metadata: map[string]string{
+				"username": username,
+				"policies": strings.Join(policies, ","),
+			},
+			InternalData: map[string]interface{}{
+				"user_id": userID,
+			},
+			DisplayName: username,
+			LeaseOptions: logical.LeaseOptions{
+				TTL:       ttl,
+				Renewable: true,
+			},
+		},
+	}, nil
+}
+
+// policies returns the policies of the user, which are those of the user and
+// of its groups. Groups are those of the user in this backend and, if an API
+// token is configured, those of the user in Okta.
+func (b *backend) policies(s logical.Storage, cfg *ConfigEntry, username, userID string) ([]string, error) {
+	var allGroups []string
+	var policies []string
+
+	user, err := b.User(s, username)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		allGroups = append(allGroups, user.Groups...)
+		policies = append(policies, user.Policies...)
+	}
+
+	if cfg.Token != "" {
+		oktaGroups, err := b.oktaGroups(cfg, userID)
+		if err != nil {
+			return nil, err
+		}
+		allGroups = append(allGroups, oktaGroups...)
+	}
+
+	for _, groupName := range allGroups {
+		group, err := b.Group(s, groupName)
+		if err != nil {
+			return nil, err
+		}
+		if group != nil {
+			policies = append(policies, group.Policies...)
+		}
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	policies = policyutil.SanitizePolicies(policies, false)
+	sort.Strings(policies)
+	return policies, nil
+}
+
+func (b *backend) pathLoginRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if req.Auth == nil {
+		return nil, fmt.Errorf("request auth was nil")
+	}
+
+	cfg, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("okta backend not configured")
+	}
+
+	// The password is not kept, so that renewals do not trigger MFA
+	// challenges; the groups of the user are checked again instead
+	userID, _ := req.Auth.InternalData["user_id"].(string)
+	loginPolicies, err := b.policies(req.Storage, cfg, req.Auth.Metadata["username"], userID)
+	if err != nil {
+		return nil, err
+	}
+	if !policyutil.EquivalentPolicies(loginPolicies, req.Auth.Policies) {
+		return nil, fmt.Errorf("policies have changed, not renewing")
+	}
+
+	return framework.LeaseExtend(cfg.TTL, cfg.MaxTTL, b.System())(req, d)
+}
+
+const pathLoginSyn = `
+Log in with a username and password.
+`
+
+const pathLoginDesc = `
+This endpoint authenticates using a username and password of the configured
+Okta organization.
+
+If Okta requires MFA for the user, a push notification is sent to the user,
+and the login completes once it is accepted. If 'totp' is given, it is used
+as the passcode of the TOTP factor of the user instead.
+`
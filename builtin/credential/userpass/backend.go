@@ -28,6 +28,7 @@ func Backend() *backend {
 			pathUsersList(&b),
 			pathUserPolicies(&b),
 			pathUserPassword(&b),
+			pathConfig(&b),
 		},
 			mfa.MFAPaths(b.Backend, pathLogin(&b))...,
 		),
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/helper/passwordpolicy"
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/mitchellh/mapstructure"
@@ -325,3 +326,127 @@ func testAccStepReadUser(t *testing.T, name string, policies string) logicaltest
 		},
 	}
 }
+
+func TestBackend_passwordPolicy(t *testing.T) {
+	sysView := &logical.StaticSystemView{
+		DefaultLeaseTTLVal: testSysTTL,
+		MaxLeaseTTLVal:     testSysMaxTTL,
+		PasswordPolicies: map[string]*passwordpolicy.Policy{
+			"strict": &passwordpolicy.Policy{
+				Name:      "strict",
+				MinLength: 8,
+				MinDigits: 1,
+				History:   2,
+				MaxAge:    time.Hour,
+			},
+		},
+	}
+	b := Backend()
+	if _, err := b.Setup(&logical.BackendConfig{
+		System: sysView,
+	}); err != nil {
+		t.Fatalf("Unable to create backend: %s", err)
+	}
+	storage := &logical.InmemStorage{}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		req := logical.TestRequest(t, op, path)
+		req.Storage = storage
+		req.Data = data
+		return b.HandleRequest(req)
+	}
+	setPassword := func(password string) error {
+		resp, err := request(logical.UpdateOperation, "users/alice/password", map[string]interface{}{
+			"password": password,
+		})
+		if err == nil && resp.IsError() {
+			err = resp.Error()
+		}
+		return err
+	}
+	login := func(password string) *logical.Response {
+		resp, err := request(logical.UpdateOperation, "login/alice", map[string]interface{}{
+			"password": password,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+
+	// Users created before the policy is configured keep their password
+	if _, err := request(logical.UpdateOperation, "users/alice", map[string]interface{}{
+		"password": "weak",
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"password_policy": "missing",
+	})
+	if err != nil || !resp.IsError() {
+		t.Fatalf("expected error for missing policy: %#v %v", resp, err)
+	}
+	if _, err := request(logical.UpdateOperation, "config", map[string]interface{}{
+		"password_policy": "strict",
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err = request(logical.ReadOperation, "config", nil)
+	if err != nil || resp.Data["password_policy"] != "strict" {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	if resp := login("weak"); resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if _, err := request(logical.UpdateOperation, "users/bob", map[string]interface{}{
+		"password": "nodigits",
+	}); err == nil {
+		t.Fatalf("expected error creating user with weak password")
+	}
+	if err := setPassword("short1"); err == nil {
+		t.Fatalf("expected error for short password")
+	}
+
+	// The last two passwords cannot be reused
+	for _, password := range []string{"password1", "password2"} {
+		if err := setPassword(password); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if err := setPassword("password1"); err == nil {
+		t.Fatalf("expected error reusing password")
+	}
+	if err := setPassword("password2"); err == nil {
+		t.Fatalf("expected error reusing current password")
+	}
+	if err := setPassword("password3"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := setPassword("password1"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp := login("password1"); resp.IsError() || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Expired passwords cannot be used to log in
+	user, err := b.user(storage, "alice")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	user.PasswordSetTime = time.Now().Add(-2 * time.Hour)
+	if err := b.setUser(storage, "alice", user); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp := login("password1"); !resp.IsError() {
+		t.Fatalf("expected expired password error: %#v", resp)
+	}
+	if err := setPassword("password4"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp := login("password4"); resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
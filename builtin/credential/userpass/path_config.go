@@ -0,0 +1,145 @@
+package userpass
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"password_policy": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the password policy passwords must meet, from sys/policies/password.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) config(s logical.Storage) (*ConfigEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	var result ConfigEntry
+	if entry != nil {
+		if err := entry.DecodeJSON(&result); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+// passwordPolicy returns the password policy of the backend, or nil if none
+// is configured
+func (b *backend) passwordPolicy(s logical.Storage) (*passwordpolicy.Policy, error) {
+	config, err := b.config(s)
+	if err != nil {
+		return nil, err
+	}
+	if config.PasswordPolicy == "" {
+		return nil, nil
+	}
+
+	policy, err := b.System().PasswordPolicy(config.PasswordPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		return nil, fmt.Errorf("password policy '%s' does not exist", config.PasswordPolicy)
+	}
+	return policy, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"password_policy": config.PasswordPolicy,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config := &ConfigEntry{
+		PasswordPolicy: d.Get("password_policy").(string),
+	}
+	if config.PasswordPolicy != "" {
+		policy, err := b.System().PasswordPolicy(config.PasswordPolicy)
+		if err != nil {
+			return nil, err
+		}
+		if policy == nil {
+			return logical.ErrorResponse(fmt.Sprintf("password policy '%s' does not exist", config.PasswordPolicy)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(entry)
+}
+
+// checkPasswordPolicy checks a new password of a user against the password
+// policy of the backend, and against their previous passwords
+func checkPasswordPolicy(policy *passwordpolicy.Policy, userEntry *UserEntry, password string) error {
+	if err := policy.Check(password); err != nil {
+		return err
+	}
+
+	previous := userEntry.PasswordHistory
+	if len(previous) > policy.History {
+		previous = previous[len(previous)-policy.History:]
+	}
+	for _, hash := range previous {
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+			return fmt.Errorf("password was used recently and cannot be reused")
+		}
+	}
+	return nil
+}
+
+// passwordExpired returns whether the password of a user has expired
+func passwordExpired(policy *passwordpolicy.Policy, userEntry *UserEntry) bool {
+	return policy != nil && policy.Expired(userEntry.PasswordSetTime, time.Now())
+}
+
+type ConfigEntry struct {
+	// PasswordPolicy is the name of the password policy passwords must
+	// meet, if any
+	PasswordPolicy string `json:"password_policy"`
+}
+
+const pathConfigHelpSyn = `
+Configure the password policy of users.
+`
+
+const pathConfigHelpDesc = `
+This endpoint allows setting the password policy that the passwords
+of users must meet when they are set. Password policies are managed
+at "sys/policies/password" and can require a minimum length and
+characters of each class, prevent passwords from being reused, and
+expire passwords, after which their users cannot log in until their
+password is reset.
+`
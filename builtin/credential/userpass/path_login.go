@@ -66,6 +66,15 @@ func (b *backend) pathLogin(
 		}
 	}
 
+	// Users whose password has expired must have it reset
+	policy, err := b.passwordPolicy(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if passwordExpired(policy, user) {
+		return logical.ErrorResponse("password has expired"), nil
+	}
+
 	return &logical.Response{
 		Auth: &logical.Auth{
 			Policies: user.Policies,
@@ -2,6 +2,7 @@ package userpass
 
 import (
 	"fmt"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
@@ -48,7 +49,7 @@ func (b *backend) pathUserPasswordUpdate(
 
 	userErr, intErr := b.updateUserPassword(req, d, userEntry)
 	if intErr != nil {
-		return nil, err
+		return nil, intErr
 	}
 	if userErr != nil {
 		return logical.ErrorResponse(userErr.Error()), logical.ErrInvalidRequest
@@ -62,12 +63,34 @@ func (b *backend) updateUserPassword(req *logical.Request, d *framework.FieldDat
 	if password == "" {
 		return fmt.Errorf("missing password"), nil
 	}
+
+	policy, err := b.passwordPolicy(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if policy != nil {
+		if err := checkPasswordPolicy(policy, userEntry, password); err != nil {
+			return err, nil
+		}
+	}
+
 	// Generate a hash of the password
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 	userEntry.PasswordHash = hash
+	userEntry.PasswordSetTime = time.Now()
+
+	// Keep the hashes of as many passwords as the policy prevents reusing
+	var history [][]byte
+	if policy != nil && policy.History > 0 {
+		history = append(userEntry.PasswordHistory, hash)
+		if len(history) > policy.History {
+			history = history[len(history)-policy.History:]
+		}
+	}
+	userEntry.PasswordHistory = history
 	return nil, nil
 }
 
@@ -137,9 +137,10 @@ func (b *backend) pathUserRead(
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"policies": strings.Join(user.Policies, ","),
-			"ttl":      user.TTL.Seconds(),
-			"max_ttl":  user.MaxTTL.Seconds(),
+			"policies":          strings.Join(user.Policies, ","),
+			"ttl":               user.TTL.Seconds(),
+			"max_ttl":           user.MaxTTL.Seconds(),
+			"password_set_time": user.PasswordSetTime,
 		},
 	}, nil
 }
@@ -158,7 +159,7 @@ func (b *backend) userCreateUpdate(req *logical.Request, d *framework.FieldData)
 	if _, ok := d.GetOk("password"); ok {
 		userErr, intErr := b.updateUserPassword(req, d, userEntry)
 		if intErr != nil {
-			return nil, err
+			return nil, intErr
 		}
 		if userErr != nil {
 			return logical.ErrorResponse(userErr.Error()), logical.ErrInvalidRequest
@@ -205,6 +206,15 @@ type UserEntry struct {
 	// used instead of the actual password in Vault 0.2+.
 	PasswordHash []byte
 
+	// PasswordHistory holds the hashes of the most recent passwords,
+	// including the current one, which the password policy prevents
+	// reusing
+	PasswordHistory [][]byte
+
+	// PasswordSetTime is when the password was last set, from which it
+	// expires according to the password policy
+	PasswordSetTime time.Time
+
 	Policies []string
 
 	// Duration after which the user will be revoked unless renewed
@@ -0,0 +1,77 @@
+package ad
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	b, err := Backend(conf)
+	if err != nil {
+		return nil, err
+	}
+	return b.Setup(conf)
+}
+
+func Backend(conf *logical.BackendConfig) (*backend, error) {
+	salt, err := salt.NewSalt(conf.StorageView, &salt.Config{
+		HashFunc: salt.SHA256Hash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var b backend
+	b.salt = salt
+	b.setPassword = setADPassword
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListSets(&b),
+			pathSets(&b),
+			pathCheckOut(&b),
+			pathCheckIn(&b),
+			pathManageCheckIn(&b),
+			pathSetStatus(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretLibrary(&b),
+		},
+	}
+
+	return &b, nil
+}
+
+type backend struct {
+	*framework.Backend
+
+	// salt hashes the client tokens accounts are checked out by, so that
+	// only their hashes are stored
+	salt *salt.Salt
+
+	// checkOutLock serializes the changes of the sets and of the check-outs
+	// of their accounts
+	checkOutLock sync.Mutex
+
+	// setPassword changes the password of a service account on the domain
+	// controller, so that it can be replaced in tests
+	setPassword func(cfg *ldap.ConfigEntry, account, password string) error
+}
+
+const backendHelp = `
+The AD backend manages the passwords of existing Active Directory service
+accounts.
+
+Service accounts are grouped in library sets, whose accounts are checked out
+by a single user at a time. The password of an account is rotated when it is
+checked out and again when it is checked in, so that borrowers cannot use
+it once their lease expires or is revoked.
+`
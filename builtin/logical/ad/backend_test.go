@@ -0,0 +1,303 @@
+package ad
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testDirectory records the passwords set on service accounts
+type testDirectory struct {
+	passwords map[string]string
+	fail      bool
+}
+
+func (d *testDirectory) setPassword(cfg *ldap.ConfigEntry, account, password string) error {
+	if d.fail {
+		return fmt.Errorf("domain controller unavailable")
+	}
+	d.passwords[account] = password
+	return nil
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage, *testDirectory) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	directory := &testDirectory{passwords: make(map[string]string)}
+	b.setPassword = directory.setPassword
+	return b, config.StorageView, directory
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation:   op,
+		Path:        path,
+		Storage:     s,
+		Data:        data,
+		ClientToken: token,
+	})
+	if err != nil {
+		t.Fatalf("%s: err:%v resp:%#v", path, err, resp)
+	}
+	return resp
+}
+
+func TestBackend_config(t *testing.T) {
+	b, storage, _ := createBackendWithStorage(t)
+
+	for _, data := range []map[string]interface{}{
+		{"url": "ldaps://dc.example.com", "userdn": "dc=example,dc=com"},
+		{"url": "ldaps://dc.example.com", "binddn": "vault", "bindpass": "secret"},
+		{"url": "ldap://dc.example.com", "userdn": "dc=example,dc=com", "binddn": "vault", "bindpass": "secret"},
+		{"url": "ldaps://dc.example.com", "userdn": "dc=example,dc=com", "binddn": "vault", "bindpass": "secret", "password_length": 8},
+	} {
+		resp := testRequest(t, b, storage, "", logical.UpdateOperation, "config", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testRequest(t, b, storage, "", logical.UpdateOperation, "config", map[string]interface{}{
+		"url":      "ldap://dc.example.com",
+		"starttls": true,
+		"userdn":   "dc=example,dc=com",
+		"binddn":   "vault",
+		"bindpass": "secret",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	// The bind password is kept while the bind DN is unchanged
+	testRequest(t, b, storage, "", logical.UpdateOperation, "config", map[string]interface{}{
+		"url":             "ldaps://dc.example.com",
+		"userdn":          "dc=example,dc=com",
+		"binddn":          "vault",
+		"password_length": 32,
+	})
+	cfg, err := b.Config(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LDAP.BindPassword != "secret" || cfg.PasswordLength != 32 {
+		t.Fatalf("bad: %#v", cfg)
+	}
+
+	resp = testRequest(t, b, storage, "", logical.ReadOperation, "config", nil)
+	if resp.Data["url"] != "ldaps://dc.example.com" || resp.Data["password_length"] != 32 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["bindpass"]; ok {
+		t.Fatalf("bindpass should not be returned")
+	}
+}
+
+func TestBackend_library(t *testing.T) {
+	b, storage, directory := createBackendWithStorage(t)
+
+	testRequest(t, b, storage, "", logical.UpdateOperation, "config", map[string]interface{}{
+		"url":      "ldaps://dc.example.com",
+		"userdn":   "dc=example,dc=com",
+		"binddn":   "vault",
+		"bindpass": "secret",
+	})
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"service_account_names": "svc-1", "ttl": 7200, "max_ttl": 3600},
+	} {
+		resp := testRequest(t, b, storage, "", logical.UpdateOperation, "library/web", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+	resp := testRequest(t, b, storage, "", logical.UpdateOperation, "library/web", map[string]interface{}{
+		"service_account_names": "svc-2,svc-1",
+		"ttl":                   3600,
+		"max_ttl":               7200,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	// Accounts belong to one set
+	resp = testRequest(t, b, storage, "", logical.UpdateOperation, "library/database", map[string]interface{}{
+		"service_account_names": "svc-1",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, "", logical.ReadOperation, "library/web", nil)
+	if names := resp.Data["service_account_names"].([]string); len(names) != 2 || names[0] != "svc-1" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	checkOut := func(token string) *logical.Response {
+		return testRequest(t, b, storage, token, logical.UpdateOperation, "library/web/check-out", nil)
+	}
+
+	first := checkOut("alice")
+	if first == nil || first.IsError() || first.Secret == nil || first.Secret.TTL != time.Hour {
+		t.Fatalf("resp: %#v", first)
+	}
+	if first.Data["service_account_name"] != "svc-1" || first.Data["password"] != directory.passwords["svc-1"] {
+		t.Fatalf("bad: %#v", first.Data)
+	}
+	if password := first.Data["password"].(string); len(password) != defaultPasswordLength {
+		t.Fatalf("bad password: %s", password)
+	}
+
+	second := checkOut("bob")
+	if second == nil || second.IsError() || second.Data["service_account_name"] != "svc-2" {
+		t.Fatalf("resp: %#v", second)
+	}
+	if resp := checkOut("carol"); resp == nil || !resp.IsError() {
+		t.Fatalf("expected no account to be available: %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, "alice", logical.ReadOperation, "library/web/status", nil)
+	status := resp.Data["svc-1"].(map[string]interface{})
+	if status["available"] != false || status["checked_out_by_token"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Checked out accounts cannot be removed, nor their set deleted
+	resp = testRequest(t, b, storage, "", logical.UpdateOperation, "library/web", map[string]interface{}{
+		"service_account_names": "svc-1",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	resp = testRequest(t, b, storage, "", logical.DeleteOperation, "library/web", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	// Only the borrower checks an account in, which rotates its password
+	resp = testRequest(t, b, storage, "bob", logical.UpdateOperation, "library/web/check-in", map[string]interface{}{
+		"service_account_names": "svc-1",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	resp = testRequest(t, b, storage, "alice", logical.UpdateOperation, "library/web/check-in", nil)
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 || checkIns[0] != "svc-1" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if directory.passwords["svc-1"] == first.Data["password"] {
+		t.Fatalf("password not rotated at check-in")
+	}
+
+	// The lease of a checked in account neither renews nor checks in the
+	// next check-out of the account
+	third := checkOut("carol")
+	if third.Data["service_account_name"] != "svc-1" {
+		t.Fatalf("bad: %#v", third.Data)
+	}
+	first.Secret.IssueTime = time.Now()
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    first.Secret,
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: err:%v resp:%#v", err, resp)
+	}
+	password := directory.passwords["svc-1"]
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    first.Secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if directory.passwords["svc-1"] != password {
+		t.Fatalf("the revocation of a previous check-out rotated the password")
+	}
+
+	third.Secret.IssueTime = time.Now()
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    third.Secret,
+	})
+	if err != nil || resp == nil || resp.IsError() || resp.Secret.TTL != time.Hour {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Revoking the lease checks the account in, unless its password cannot
+	// be rotated
+	directory.fail = true
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    second.Secret,
+	}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	directory.fail = false
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    second.Secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if checkOut, err := b.CheckOut(storage, "svc-2"); err != nil || checkOut != nil {
+		t.Fatalf("account not checked in: %#v %v", checkOut, err)
+	}
+
+	// Operators check any account in
+	resp = testRequest(t, b, storage, "root", logical.UpdateOperation, "library/manage/web/check-in", map[string]interface{}{
+		"service_account_names": "svc-1",
+	})
+	if checkIns := resp.Data["check_ins"].([]string); len(checkIns) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, storage, "", logical.DeleteOperation, "library/web", nil)
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+}
+
+func TestGeneratePassword(t *testing.T) {
+	if _, err := generatePassword(minPasswordLength - 1); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	for i := 0; i < 100; i++ {
+		password, err := generatePassword(minPasswordLength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(password) != minPasswordLength {
+			t.Fatalf("bad password: %s", password)
+		}
+		for _, class := range passwordClasses {
+			if !strings.ContainsAny(password, class) {
+				t.Fatalf("password %q has no character of %q", password, class)
+			}
+		}
+	}
+}
+
+func TestEncodePassword(t *testing.T) {
+	if encoded := encodePassword("ab"); encoded != "\"\x00a\x00b\x00\"\x00" {
+		t.Fatalf("bad: %q", encoded)
+	}
+}
@@ -0,0 +1,113 @@
+package ad
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"unicode/utf16"
+
+	"github.com/go-ldap/ldap"
+	vaultldap "github.com/hashicorp/vault/builtin/credential/ldap"
+)
+
+// The character classes of generated passwords. Passwords contain all of
+// them, so that they meet the complexity requirements of Active Directory.
+var passwordClasses = []string{
+	"abcdefghijklmnopqrstuvwxyz",
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"0123456789",
+	"-_.!@#%^*+=?",
+}
+
+// minPasswordLength is the length of the shortest passwords which can be
+// generated, so that they have enough entropy
+const minPasswordLength = 14
+
+// generatePassword returns a random password of the given length, with at
+// least one character of every class
+func generatePassword(length int) (string, error) {
+	if length < minPasswordLength {
+		return "", fmt.Errorf("passwords must be at least %d characters long", minPasswordLength)
+	}
+
+	var all string
+	for _, class := range passwordClasses {
+		all += class
+	}
+
+	password := make([]byte, length)
+	for i := range password {
+		chars := all
+		if i < len(passwordClasses) {
+			chars = passwordClasses[i]
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return "", err
+		}
+		password[i] = chars[n.Int64()]
+	}
+
+	// Shuffle the characters so that the classes are not at fixed positions
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
+
+// encodePassword returns the value of the unicodePwd attribute setting a
+// password, which is the UTF-16LE encoding of the quoted password
+func encodePassword(password string) string {
+	encoded := utf16.Encode([]rune(`"` + password + `"`))
+	buf := make([]byte, 2*len(encoded))
+	for i, r := range encoded {
+		binary.LittleEndian.PutUint16(buf[2*i:], r)
+	}
+	return string(buf)
+}
+
+// setADPassword binds with the configured credentials, looks the service
+// account up by its sAMAccountName or userPrincipalName under the user DN,
+// and replaces its password. Active Directory only accepts password changes
+// over an encrypted connection.
+func setADPassword(cfg *vaultldap.ConfigEntry, account, password string) error {
+	c, err := cfg.DialLDAP()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Bind(cfg.BindDN, cfg.BindPassword); err != nil {
+		return fmt.Errorf("LDAP bind failed: %v", err)
+	}
+
+	filter := fmt.Sprintf("(|(sAMAccountName=%s)(userPrincipalName=%s))",
+		ldap.EscapeFilter(account), ldap.EscapeFilter(account))
+	result, err := c.Search(&ldap.SearchRequest{
+		BaseDN: cfg.UserDN,
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: filter,
+		Attributes: []string{
+			"distinguishedName",
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("LDAP search for service account %q failed: %v", account, err)
+	}
+	if len(result.Entries) != 1 {
+		return fmt.Errorf("service account %q not found or not unique under %q", account, cfg.UserDN)
+	}
+
+	modify := ldap.NewModifyRequest(result.Entries[0].DN)
+	modify.Replace("unicodePwd", []string{encodePassword(password)})
+	if err := c.Modify(modify); err != nil {
+		return fmt.Errorf("error setting the password of service account %q: %v", account, err)
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package ad
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// checkOutEntry is the check-out of a service account
+type checkOutEntry struct {
+	SetName string `json:"set_name"`
+
+	// ID identifies the check-out, so that the end of the lease of an
+	// earlier check-out of the account does not check in a later one
+	ID string `json:"id"`
+
+	// BorrowerID is the salted client token which checked the account out
+	BorrowerID string `json:"borrower_id"`
+}
+
+func pathCheckOut(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name") + "/check-out$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the set.",
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `TTL of the check-out, up to the TTL of the set.
+Defaults to the TTL of the set.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCheckOutUpdate,
+		},
+
+		HelpSynopsis:    pathCheckOutHelpSyn,
+		HelpDescription: pathCheckOutHelpDesc,
+	}
+}
+
+func pathCheckIn(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name") + "/check-in$",
+		Fields:  checkInFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCheckInUpdate(false),
+		},
+
+		HelpSynopsis:    pathCheckInHelpSyn,
+		HelpDescription: pathCheckInHelpDesc,
+	}
+}
+
+func pathManageCheckIn(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/manage/" + framework.GenericNameRegex("name") + "/check-in$",
+		Fields:  checkInFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCheckInUpdate(true),
+		},
+
+		HelpSynopsis:    pathCheckInHelpSyn,
+		HelpDescription: pathCheckInHelpDesc,
+	}
+}
+
+func checkInFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the set.",
+		},
+
+		"service_account_names": &framework.FieldSchema{
+			Type: framework.TypeCommaStringSlice,
+			Description: `Comma-separated list of the service accounts to
+check in. Defaults to the only account of the set checked
+out by the token.`,
+		},
+	}
+}
+
+func pathSetStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name") + "/status$",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the set.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathSetStatusRead,
+		},
+
+		HelpSynopsis:    pathSetStatusHelpSyn,
+		HelpDescription: pathSetStatusHelpDesc,
+	}
+}
+
+// CheckOut returns the check-out of the account, or nil if it is available
+func (b *backend) CheckOut(s logical.Storage, account string) (*checkOutEntry, error) {
+	entry, err := s.Get("checkout/" + account)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result checkOutEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// rotatePassword sets a new password on the account and returns it
+func (b *backend) rotatePassword(cfg *configEntry, account string) (string, error) {
+	password, err := generatePassword(cfg.PasswordLength)
+	if err != nil {
+		return "", err
+	}
+	if err := b.setPassword(cfg.LDAP, account, password); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+// checkIn rotates the password of the account, so that its borrower cannot
+// use it anymore, and makes it available again
+func (b *backend) checkIn(s logical.Storage, account string) error {
+	cfg, err := b.Config(s)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return fmt.Errorf("the backend is not configured")
+	}
+
+	if _, err := b.rotatePassword(cfg, account); err != nil {
+		return err
+	}
+	return s.Delete("checkout/" + account)
+}
+
+func (b *backend) pathCheckOutUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.checkOutLock.Lock()
+	defer b.checkOutLock.Unlock()
+
+	set, err := b.Set(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return logical.ErrorResponse(fmt.Sprintf("Set '%s' not found", name)), nil
+	}
+
+	ttl := set.TTL
+	if ttlRaw, ok := d.GetOk("ttl"); ok {
+		requested := time.Duration(ttlRaw.(int)) * time.Second
+		if set.TTL != 0 && requested > set.TTL {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"ttl cannot be greater than the ttl of the set, %s", set.TTL)), nil
+		}
+		ttl = requested
+	}
+
+	cfg, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return logical.ErrorResponse("the backend is not configured"), nil
+	}
+
+	var account string
+	for _, candidate := range set.ServiceAccountNames {
+		checkOut, err := b.CheckOut(req.Storage, candidate)
+		if err != nil {
+			return nil, err
+		}
+		if checkOut == nil {
+			account = candidate
+			break
+		}
+	}
+	if account == "" {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"no service account of set '%s' is available", name)), nil
+	}
+
+	checkOut := &checkOutEntry{
+		SetName:    name,
+		BorrowerID: b.salt.SaltID(req.ClientToken),
+	}
+	checkOut.ID, err = uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	// The password is rotated before the check-out is stored, so that an
+	// account is never handed out with the password of a previous borrower
+	password, err := b.rotatePassword(cfg, account)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("checkout/"+account, checkOut)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	resp := b.Secret(SecretLibraryType).Response(map[string]interface{}{
+		"service_account_name": account,
+		"password":             password,
+	}, map[string]interface{}{
+		"set_name":             name,
+		"service_account_name": account,
+		"check_out_id":         checkOut.ID,
+	})
+	resp.Secret.TTL = ttl
+	return resp, nil
+}
+
+func (b *backend) pathCheckInUpdate(manage bool) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		name := d.Get("name").(string)
+
+		b.checkOutLock.Lock()
+		defer b.checkOutLock.Unlock()
+
+		set, err := b.Set(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if set == nil {
+			return logical.ErrorResponse(fmt.Sprintf("Set '%s' not found", name)), nil
+		}
+
+		// Unless managing the set, or the set does not enforce it, only the
+		// accounts checked out by the token can be checked in
+		borrowerID := b.salt.SaltID(req.ClientToken)
+		enforce := !manage && !set.DisableCheckInEnforcement
+
+		accounts := d.Get("service_account_names").([]string)
+		if len(accounts) == 0 {
+			for _, account := range set.ServiceAccountNames {
+				checkOut, err := b.CheckOut(req.Storage, account)
+				if err != nil {
+					return nil, err
+				}
+				if checkOut != nil && (!enforce || checkOut.BorrowerID == borrowerID) {
+					accounts = append(accounts, account)
+				}
+			}
+			if len(accounts) != 1 {
+				return logical.ErrorResponse(
+					"service_account_names must be given unless exactly one account of the set can be checked in"), nil
+			}
+		}
+
+		var checkIns []string
+		for _, account := range accounts {
+			if !containsString(set.ServiceAccountNames, account) {
+				return logical.ErrorResponse(fmt.Sprintf(
+					"service account %q does not belong to set '%s'", account, name)), nil
+			}
+			checkOut, err := b.CheckOut(req.Storage, account)
+			if err != nil {
+				return nil, err
+			}
+			if checkOut == nil {
+				continue
+			}
+			if enforce && checkOut.BorrowerID != borrowerID {
+				return logical.ErrorResponse(fmt.Sprintf(
+					"service account %q was not checked out by this token", account)), nil
+			}
+			if err := b.checkIn(req.Storage, account); err != nil {
+				return nil, err
+			}
+			checkIns = append(checkIns, account)
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"check_ins": checkIns,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathSetStatusRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	set, err := b.Set(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, nil
+	}
+
+	borrowerID := b.salt.SaltID(req.ClientToken)
+	status := make(map[string]interface{}, len(set.ServiceAccountNames))
+	for _, account := range set.ServiceAccountNames {
+		checkOut, err := b.CheckOut(req.Storage, account)
+		if err != nil {
+			return nil, err
+		}
+		accountStatus := map[string]interface{}{
+			"available": checkOut == nil,
+		}
+		if checkOut != nil {
+			accountStatus["checked_out_by_token"] = checkOut.BorrowerID == borrowerID
+		}
+		status[account] = accountStatus
+	}
+
+	return &logical.Response{
+		Data: status,
+	}, nil
+}
+
+const pathCheckOutHelpSyn = `
+Check out a service account of a set.
+`
+
+const pathCheckOutHelpDesc = `
+This endpoint checks out an available service account of the set, and
+returns it with a newly rotated password. The account is checked in when the
+lease expires or is revoked, or at the "check-in" endpoint of the set.
+`
+
+const pathCheckInHelpSyn = `
+Check service accounts of a set in.
+`
+
+const pathCheckInHelpDesc = `
+This endpoint checks service accounts in, rotating their passwords so that
+their borrowers cannot use them anymore. At "library/<name>/check-in", only
+the accounts checked out by the token can be checked in, unless the set
+disables check-in enforcement; at "library/manage/<name>/check-in", any
+account of the set can be checked in.
+
+The checked in accounts are returned as "check_ins".
+`
+
+const pathSetStatusHelpSyn = `
+Show which service accounts of a set are available.
+`
+
+const pathSetStatusHelpDesc = `
+This endpoint returns the service accounts of the set, with whether they are
+available and, when checked out, whether the token checked them out.
+`
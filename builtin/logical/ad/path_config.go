@@ -0,0 +1,150 @@
+package ad
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/hashicorp/vault/builtin/credential/ldap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// defaultPasswordLength is the length of the generated passwords unless
+// configured otherwise
+const defaultPasswordLength = 24
+
+func pathConfig(b *backend) *framework.Path {
+	fields := ldap.ConfigFields()
+	fields["password_length"] = &framework.FieldSchema{
+		Type:        framework.TypeInt,
+		Default:     defaultPasswordLength,
+		Description: fmt.Sprintf("Length of the generated passwords, at least %d.", minPasswordLength),
+	}
+
+	return &framework.Path{
+		Pattern: "config",
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+type configEntry struct {
+	LDAP           *ldap.ConfigEntry `json:"ldap"`
+	PasswordLength int               `json:"password_length"`
+}
+
+// Config returns the configuration of the backend, or nil if there is none
+func (b *backend) Config(s logical.Storage) (*configEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result configEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	cfg, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url":             cfg.LDAP.Url,
+			"userdn":          cfg.LDAP.UserDN,
+			"binddn":          cfg.LDAP.BindDN,
+			"certificate":     cfg.LDAP.Certificate,
+			"insecure_tls":    cfg.LDAP.InsecureTLS,
+			"starttls":        cfg.LDAP.StartTLS,
+			"tls_min_version": cfg.LDAP.TLSMinVersion,
+			"password_length": cfg.PasswordLength,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	ldapCfg, err := ldap.NewConfigEntry(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// The bind password cannot be read back, so it is kept unless given or
+	// the bind DN changes
+	if ldapCfg.BindPassword == "" && ldapCfg.BindDN != "" {
+		existing, err := b.Config(req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.LDAP.BindDN == ldapCfg.BindDN {
+			ldapCfg.BindPassword = existing.LDAP.BindPassword
+		}
+	}
+
+	if ldapCfg.BindDN == "" || ldapCfg.BindPassword == "" {
+		return logical.ErrorResponse("binddn and bindpass must be set, to change the passwords of service accounts"), nil
+	}
+	if ldapCfg.UserDN == "" {
+		return logical.ErrorResponse("userdn must be set, to look service accounts up"), nil
+	}
+	u, err := url.Parse(ldapCfg.Url)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid url: %s", err)), nil
+	}
+	if u.Scheme != "ldaps" && !ldapCfg.StartTLS {
+		return logical.ErrorResponse("url must use ldaps or starttls must be set, since Active Directory only changes passwords over encrypted connections"), nil
+	}
+
+	cfg := &configEntry{
+		LDAP:           ldapCfg,
+		PasswordLength: d.Get("password_length").(int),
+	}
+	if cfg.PasswordLength < minPasswordLength {
+		return logical.ErrorResponse(fmt.Sprintf("password_length must be at least %d", minPasswordLength)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", cfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigHelpSyn = `
+Configure the Active Directory domain controller of the service accounts.
+`
+
+const pathConfigHelpDesc = `
+This endpoint takes the connection parameters of the "config" endpoint of the
+LDAP credential provider, and the length of the generated passwords.
+
+Vault binds as 'binddn', which must be allowed to reset the passwords of the
+service accounts, and looks them up under 'userdn' by their sAMAccountName
+or userPrincipalName. Active Directory only changes passwords over encrypted
+connections, so the url must use ldaps or 'starttls' must be set.
+
+The bind password is never returned.
+`
@@ -0,0 +1,297 @@
+package ad
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// librarySet is a set of service accounts which are checked out by a single
+// borrower at a time
+type librarySet struct {
+	ServiceAccountNames       []string      `json:"service_account_names"`
+	TTL                       time.Duration `json:"ttl"`
+	MaxTTL                    time.Duration `json:"max_ttl"`
+	DisableCheckInEnforcement bool          `json:"disable_check_in_enforcement"`
+}
+
+func pathListSets(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathSetList,
+		},
+
+		HelpSynopsis:    pathSetsHelpSyn,
+		HelpDescription: pathSetsHelpDesc,
+	}
+}
+
+func pathSets(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "library/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the set.",
+			},
+
+			"service_account_names": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the sAMAccountNames or
+userPrincipalNames of the service accounts of the set.
+An account can only belong to one set.`,
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default TTL of the check-outs of the set.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum TTL of the check-outs of the set.",
+			},
+
+			"disable_check_in_enforcement": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether the accounts of the set can be checked
+in by other tokens than the one they were checked out
+by.`,
+			},
+		},
+
+		ExistenceCheck: b.pathSetExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathSetWrite,
+			logical.UpdateOperation: b.pathSetWrite,
+			logical.ReadOperation:   b.pathSetRead,
+			logical.DeleteOperation: b.pathSetDelete,
+		},
+
+		HelpSynopsis:    pathSetsHelpSyn,
+		HelpDescription: pathSetsHelpDesc,
+	}
+}
+
+// Set returns the library set of the given name, or nil if there is none
+func (b *backend) Set(s logical.Storage, name string) (*librarySet, error) {
+	entry, err := s.Get("library/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result librarySet
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathSetExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	set, err := b.Set(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return set != nil, nil
+}
+
+func (b *backend) pathSetList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("library/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathSetRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	set, err := b.Set(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"service_account_names":        set.ServiceAccountNames,
+			"ttl":                          int64(set.TTL / time.Second),
+			"max_ttl":                      int64(set.MaxTTL / time.Second),
+			"disable_check_in_enforcement": set.DisableCheckInEnforcement,
+		},
+	}, nil
+}
+
+func (b *backend) pathSetWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if name == "manage" {
+		return logical.ErrorResponse(`"manage" is reserved for the check-in of accounts by operators`), nil
+	}
+
+	b.checkOutLock.Lock()
+	defer b.checkOutLock.Unlock()
+
+	set, err := b.Set(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		set = &librarySet{}
+	}
+	oldAccounts := set.ServiceAccountNames
+
+	if namesRaw, ok := d.GetOk("service_account_names"); ok {
+		set.ServiceAccountNames = nil
+		seen := make(map[string]bool)
+		for _, account := range namesRaw.([]string) {
+			if account != "" && !seen[account] {
+				seen[account] = true
+				set.ServiceAccountNames = append(set.ServiceAccountNames, account)
+			}
+		}
+		sort.Strings(set.ServiceAccountNames)
+	}
+	if ttlRaw, ok := d.GetOk("ttl"); ok {
+		set.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := d.GetOk("max_ttl"); ok {
+		set.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+	if enforcementRaw, ok := d.GetOk("disable_check_in_enforcement"); ok {
+		set.DisableCheckInEnforcement = enforcementRaw.(bool)
+	}
+
+	if len(set.ServiceAccountNames) == 0 {
+		return logical.ErrorResponse("service_account_names cannot be empty"), nil
+	}
+	if set.MaxTTL != 0 && set.TTL > set.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	// Accounts can only belong to one set, and are only removed from their
+	// set once checked in
+	for _, account := range set.ServiceAccountNames {
+		owner, err := b.accountSet(req.Storage, account)
+		if err != nil {
+			return nil, err
+		}
+		if owner != "" && owner != name {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"service account %q already belongs to set %q", account, owner)), nil
+		}
+	}
+	for _, account := range oldAccounts {
+		if containsString(set.ServiceAccountNames, account) {
+			continue
+		}
+		checkOut, err := b.CheckOut(req.Storage, account)
+		if err != nil {
+			return nil, err
+		}
+		if checkOut != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"service account %q is checked out and cannot be removed from the set", account)), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("library/"+name, set)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathSetDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	b.checkOutLock.Lock()
+	defer b.checkOutLock.Unlock()
+
+	set, err := b.Set(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return nil, nil
+	}
+
+	for _, account := range set.ServiceAccountNames {
+		checkOut, err := b.CheckOut(req.Storage, account)
+		if err != nil {
+			return nil, err
+		}
+		if checkOut != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"service account %q is checked out; check it in before deleting the set", account)), nil
+		}
+	}
+
+	if err := req.Storage.Delete("library/" + name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// accountSet returns the name of the set the account belongs to, or an
+// empty string if there is none
+func (b *backend) accountSet(s logical.Storage, account string) (string, error) {
+	names, err := s.List("library/")
+	if err != nil {
+		return "", err
+	}
+	for _, name := range names {
+		set, err := b.Set(s, name)
+		if err != nil {
+			return "", err
+		}
+		if set != nil && containsString(set.ServiceAccountNames, account) {
+			return name, nil
+		}
+	}
+	return "", nil
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
+
+const pathSetsHelpSyn = `
+Manage the library sets of service accounts.
+`
+
+const pathSetsHelpDesc = `
+This path lets you manage the library sets of the backend. The accounts of a
+set are checked out at "library/<name>/check-out", for the TTL of the set,
+and checked in at "library/<name>/check-in" or when their lease expires or
+is revoked.
+
+Unless "disable_check_in_enforcement" is set, only the token which checked
+an account out can check it in before its lease ends. Operators can check
+any account in at "library/manage/<name>/check-in".
+
+Checked out accounts cannot be removed from their set, and sets cannot be
+deleted while any of their accounts is checked out.
+`
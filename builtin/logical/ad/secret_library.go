@@ -0,0 +1,98 @@
+package ad
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretLibraryType = "library"
+
+func secretLibrary(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretLibraryType,
+		Fields: map[string]*framework.FieldSchema{
+			"service_account_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the service account",
+			},
+
+			"password": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password of the service account",
+			},
+		},
+
+		Renew:  b.secretLibraryRenew,
+		Revoke: b.secretLibraryRevoke,
+	}
+}
+
+// secretCheckOut returns the check-out of the secret if the account is still
+// checked out by it, or nil otherwise
+func (b *backend) secretCheckOut(req *logical.Request) (string, *checkOutEntry, error) {
+	accountRaw, ok := req.Secret.InternalData["service_account_name"]
+	if !ok {
+		return "", nil, fmt.Errorf("secret is missing service_account_name internal data")
+	}
+	idRaw, ok := req.Secret.InternalData["check_out_id"]
+	if !ok {
+		return "", nil, fmt.Errorf("secret is missing check_out_id internal data")
+	}
+
+	account := accountRaw.(string)
+	checkOut, err := b.CheckOut(req.Storage, account)
+	if err != nil {
+		return "", nil, err
+	}
+	if checkOut == nil || checkOut.ID != idRaw.(string) {
+		return account, nil, nil
+	}
+	return account, checkOut, nil
+}
+
+func (b *backend) secretLibraryRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	account, checkOut, err := b.secretCheckOut(req)
+	if err != nil {
+		return nil, err
+	}
+	if checkOut == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"service account %q was checked in", account)), nil
+	}
+
+	set, err := b.Set(req.Storage, checkOut.SetName)
+	if err != nil {
+		return nil, err
+	}
+	if set == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Set '%s' not found", checkOut.SetName)), nil
+	}
+
+	return framework.LeaseExtend(set.TTL, set.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretLibraryRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.checkOutLock.Lock()
+	defer b.checkOutLock.Unlock()
+
+	account, checkOut, err := b.secretCheckOut(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account was already checked in, and may have been checked out
+	// again since
+	if checkOut == nil {
+		return nil, nil
+	}
+
+	if err := b.checkIn(req.Storage, account); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
@@ -2,6 +2,7 @@ package aws
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -19,6 +20,7 @@ func Backend() *backend {
 
 		Paths: []*framework.Path{
 			pathConfigRoot(),
+			pathConfigRotateRoot(&b),
 			pathConfigLease(&b),
 			pathRoles(),
 			pathListRoles(&b),
@@ -39,6 +41,9 @@ func Backend() *backend {
 
 type backend struct {
 	*framework.Backend
+
+	// Serializes the rotations of the root credentials
+	rootLock sync.Mutex
 }
 
 const backendHelp = `
@@ -342,7 +342,7 @@ func testAccStepReadPolicy(t *testing.T, name string, value string) logicaltest.
 			}
 
 			var d struct {
-				Policy string `mapstructure:"policy"`
+				Policy string `mapstructure:"policy_document"`
 			}
 			if err := mapstructure.Decode(resp.Data, &d); err != nil {
 				return err
@@ -428,13 +428,13 @@ func testAccStepReadArnPolicy(t *testing.T, name string, value string) logicalte
 			}
 
 			var d struct {
-				Policy string `mapstructure:"arn"`
+				Policies []string `mapstructure:"policy_arns"`
 			}
 			if err := mapstructure.Decode(resp.Data, &d); err != nil {
 				return err
 			}
 
-			if d.Policy != value {
+			if len(d.Policies) != 1 || d.Policies[0] != value {
 				return fmt.Errorf("bad: %#v", resp)
 			}
 
@@ -452,3 +452,38 @@ func testAccStepWriteArnRoleRef(t *testing.T, roleName string) logicaltest.TestS
 		},
 	}
 }
+
+func TestBackend_rotateRootNotConfigured(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/rotate-root",
+		Storage:   config.StorageView,
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error without root credentials: resp:%#v err:%s", resp, err)
+	}
+
+	// Credentials from the environment cannot be rotated
+	req.Operation = logical.UpdateOperation
+	req.Path = "config/root"
+	req.Data = map[string]interface{}{
+		"region": "us-west-2",
+	}
+	if resp, err := b.HandleRequest(req); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp:%#v err:%s", resp, err)
+	}
+	req.Path = "config/rotate-root"
+	req.Data = nil
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error without access_key: resp:%#v err:%s", resp, err)
+	}
+}
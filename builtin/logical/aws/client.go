@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -57,3 +58,34 @@ func clientSTS(s logical.Storage) (*sts.STS, error) {
 	awsConfig, _ := getRootConfig(s)
 	return sts.New(session.New(awsConfig)), nil
 }
+
+// createUserInput is iam.CreateUserInput with the permissions boundary of
+// the user, which the vendored SDK does not support yet
+type createUserInput struct {
+	_ struct{} `type:"structure"`
+
+	Path                *string `min:"1" type:"string"`
+	PermissionsBoundary *string `min:"20" type:"string"`
+	UserName            *string `min:"1" type:"string" required:"true"`
+}
+
+// createUser creates an IAM user under the path, with the permissions
+// boundary if one is given
+func createUser(client *iam.IAM, username, path, permissionsBoundaryArn string) error {
+	input := &createUserInput{
+		UserName: aws.String(username),
+	}
+	if path != "" {
+		input.Path = aws.String(path)
+	}
+	if permissionsBoundaryArn != "" {
+		input.PermissionsBoundary = aws.String(permissionsBoundaryArn)
+	}
+
+	req := client.NewRequest(&request.Operation{
+		Name:       "CreateUser",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, input, &iam.CreateUserOutput{})
+	return req.Send()
+}
@@ -0,0 +1,61 @@
+package aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+func TestCreateUser(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		form = r.PostForm
+		w.Write([]byte(`<CreateUserResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <CreateUserResult>
+    <User>
+      <UserName>vault-user</UserName>
+      <Path>/vault/</Path>
+    </User>
+  </CreateUserResult>
+</CreateUserResponse>`))
+	}))
+	defer server.Close()
+
+	client := iam.New(session.New(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		Endpoint:    aws.String(server.URL),
+		Region:      aws.String("us-east-1"),
+	}))
+
+	err := createUser(client, "vault-user", "/vault/", "arn:aws:iam::123456789012:policy/boundary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, expected := range map[string]string{
+		"Action":              "CreateUser",
+		"UserName":            "vault-user",
+		"Path":                "/vault/",
+		"PermissionsBoundary": "arn:aws:iam::123456789012:policy/boundary",
+	} {
+		if form.Get(key) != expected {
+			t.Fatalf("bad: %s: %#v", key, form)
+		}
+	}
+
+	// The permissions boundary is optional
+	if err := createUser(client, "vault-user", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := form["PermissionsBoundary"]; ok || form.Get("UserName") != "vault-user" {
+		t.Fatalf("bad: %#v", form)
+	}
+}
@@ -0,0 +1,126 @@
+package aws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfigRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/rotate-root",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathConfigRotateRootUpdate,
+		},
+
+		HelpSynopsis:    pathConfigRotateRootHelpSyn,
+		HelpDescription: pathConfigRotateRootHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRotateRootUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.rootLock.Lock()
+	defer b.rootLock.Unlock()
+
+	entry, err := req.Storage.Get("config/root")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return logical.ErrorResponse("root credentials are not configured"), nil
+	}
+	var config rootConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, fmt.Errorf("error reading root configuration: %s", err)
+	}
+	// Credentials from the environment or instance metadata are not owned by
+	// Vault, so only configured access keys can be rotated
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return logical.ErrorResponse("cannot rotate credentials which are not configured with access_key and secret_key"), nil
+	}
+
+	client := rootIAMClient(&config)
+
+	// The new key belongs to the user of the current key
+	user, err := client.GetUser(&iam.GetUserInput{})
+	if err != nil {
+		return nil, fmt.Errorf("error getting the user of the root credentials: %s", err)
+	}
+	if user.User == nil || user.User.UserName == nil {
+		return nil, fmt.Errorf("no user returned for the root credentials")
+	}
+
+	created, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{
+		UserName: user.User.UserName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating access key: %s", err)
+	}
+	if created.AccessKey == nil || created.AccessKey.AccessKeyId == nil ||
+		created.AccessKey.SecretAccessKey == nil {
+		return nil, fmt.Errorf("no access key returned")
+	}
+
+	oldAccessKey := config.AccessKey
+	config.AccessKey = *created.AccessKey.AccessKeyId
+	config.SecretKey = *created.AccessKey.SecretAccessKey
+
+	entry, err = logical.StorageEntryJSON("config/root", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	// The old key is deleted with the new one, which also checks that it works
+	_, err = rootIAMClient(&config).DeleteAccessKey(&iam.DeleteAccessKeyInput{
+		AccessKeyId: aws.String(oldAccessKey),
+		UserName:    user.User.UserName,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error deleting the previous access key %s: %s", oldAccessKey, err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"access_key": config.AccessKey,
+		},
+	}, nil
+}
+
+// Returns an IAM client using exactly the given root credentials, rather
+// than falling back to the credential chain
+func rootIAMClient(config *rootConfig) *iam.IAM {
+	region := config.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	return iam.New(session.New(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, ""),
+		Region:      aws.String(region),
+		HTTPClient:  cleanhttp.DefaultClient(),
+	}))
+}
+
+const pathConfigRotateRootHelpSyn = `
+Request to rotate the root credentials.
+`
+
+const pathConfigRotateRootHelpDesc = `
+This path attempts to rotate the access key configured in "config/root". A
+new access key is created for the IAM user of the current one, stored in
+place of it, and the previous access key is deleted. The secret key of the
+new access key is never returned, so that only Vault knows it.
+
+The IAM user must be allowed to call iam:GetUser, iam:CreateAccessKey and
+iam:DeleteAccessKey on itself, and must have fewer than two access keys.
+`
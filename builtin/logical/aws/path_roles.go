@@ -4,14 +4,36 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-
-	"errors"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+const (
+	iamUserCred         = "iam_user"
+	assumedRoleCred     = "assumed_role"
+	federationTokenCred = "federation_token"
+)
+
+// awsRoleEntry is a role, stored under "role/". Roles written before
+// credential types existed are stored as their raw policy or ARN under
+// "policy/", and are converted when read.
+type awsRoleEntry struct {
+	CredentialTypes        []string      `json:"credential_types"`
+	PolicyDocument         string        `json:"policy_document"`
+	PolicyArns             []string      `json:"policy_arns"`
+	RoleArns               []string      `json:"role_arns"`
+	ExternalID             string        `json:"external_id"`
+	DefaultSTSTTL          time.Duration `json:"default_sts_ttl"`
+	MaxSTSTTL              time.Duration `json:"max_sts_ttl"`
+	UserPath               string        `json:"user_path"`
+	PermissionsBoundaryArn string        `json:"permissions_boundary_arn"`
+	IAMGroups              []string      `json:"iam_groups"`
+}
+
 func pathListRoles(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "roles/?$",
@@ -34,14 +56,69 @@ func pathRoles() *framework.Path {
 				Description: "Name of the policy",
 			},
 
-			"arn": &framework.FieldSchema{
+			"credential_type": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the types of credentials the role
+returns: "iam_user", "assumed_role" or "federation_token". Inferred
+from the other parameters if not given.`,
+			},
+
+			"policy_document": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `IAM policy document. It is the inline policy of IAM users,
+the policy of federation tokens, and restricts the permissions of
+assumed roles.`,
+			},
+
+			"policy_arns": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the ARNs of the managed policies attached to IAM users.",
+			},
+
+			"role_arns": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the ARNs of the roles which can be assumed.",
+			},
+
+			"external_id": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "ARN Reference to a managed policy",
+				Description: "External ID given when assuming the roles.",
+			},
+
+			"default_sts_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default lifetime of STS credentials, when not requested. Defaults to one hour.",
+			},
+
+			"max_sts_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum lifetime of STS credentials. Only limited by AWS if not set.",
+			},
+
+			"user_path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `IAM path of the IAM users, such as "/vault/". Defaults to "/".`,
+			},
+
+			"permissions_boundary_arn": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ARN of the managed policy set as the permissions boundary of IAM users.",
+			},
+
+			"iam_groups": &framework.FieldSchema{
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Comma separated list of the IAM groups IAM users are added to.",
+			},
+
+			"arn": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Deprecated; use "policy_arns" or "role_arns". ARN
+of a managed policy, or of a role to assume.`,
 			},
 
 			"policy": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "IAM policy document",
+				Description: `Deprecated; use "policy_document". IAM policy document.`,
 			},
 		},
 
@@ -58,17 +135,75 @@ func pathRoles() *framework.Path {
 
 func (b *backend) pathRoleList(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entries, err := req.Storage.List("policy/")
+	entries, err := req.Storage.List("role/")
 	if err != nil {
 		return nil, err
 	}
+	legacyEntries, err := req.Storage.List("policy/")
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range legacyEntries {
+		if !strutil.StrListContains(entries, name) {
+			entries = append(entries, name)
+		}
+	}
 	return logical.ListResponse(entries), nil
 }
 
+// getRole returns the named role, converting roles of the legacy format
+func getRole(s logical.Storage, name string) (*awsRoleEntry, error) {
+	entry, err := s.Get("role/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		var role awsRoleEntry
+		if err := entry.DecodeJSON(&role); err != nil {
+			return nil, err
+		}
+		return &role, nil
+	}
+
+	entry, err = s.Get("policy/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	return legacyRole(string(entry.Value)), nil
+}
+
+// legacyRole returns the role of a raw policy or ARN, with the credential
+// types it could be used for
+func legacyRole(value string) *awsRoleEntry {
+	switch {
+	case strings.HasPrefix(value, "arn:") && strings.Contains(value, ":role/"):
+		return &awsRoleEntry{
+			CredentialTypes: []string{assumedRoleCred},
+			RoleArns:        []string{value},
+		}
+	case strings.HasPrefix(value, "arn:"):
+		return &awsRoleEntry{
+			CredentialTypes: []string{iamUserCred},
+			PolicyArns:      []string{value},
+		}
+	default:
+		return &awsRoleEntry{
+			CredentialTypes: []string{iamUserCred, federationTokenCred},
+			PolicyDocument:  value,
+		}
+	}
+}
+
 func pathRolesDelete(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	err := req.Storage.Delete("policy/" + d.Get("name").(string))
-	if err != nil {
+	name := d.Get("name").(string)
+	if err := req.Storage.Delete("role/" + name); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete("policy/" + name); err != nil {
 		return nil, err
 	}
 
@@ -77,78 +212,167 @@ func pathRolesDelete(
 
 func pathRolesRead(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entry, err := req.Storage.Get("policy/" + d.Get("name").(string))
+	role, err := getRole(req.Storage, d.Get("name").(string))
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
+	if role == nil {
 		return nil, nil
 	}
 
-	val := string(entry.Value)
-	if strings.HasPrefix(val, "arn:") {
-		return &logical.Response{
-			Data: map[string]interface{}{
-				"arn": val,
-			},
-		}, nil
-	}
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"policy": val,
+			"credential_types":         role.CredentialTypes,
+			"policy_document":          role.PolicyDocument,
+			"policy_arns":              role.PolicyArns,
+			"role_arns":                role.RoleArns,
+			"external_id":              role.ExternalID,
+			"default_sts_ttl":          int64(role.DefaultSTSTTL.Seconds()),
+			"max_sts_ttl":              int64(role.MaxSTSTTL.Seconds()),
+			"user_path":                role.UserPath,
+			"permissions_boundary_arn": role.PermissionsBoundaryArn,
+			"iam_groups":               role.IAMGroups,
 		},
 	}, nil
 }
 
-func useInlinePolicy(d *framework.FieldData) (bool, error) {
-	bp := d.Get("policy").(string) != ""
-	ba := d.Get("arn").(string) != ""
+func pathRolesWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
 
-	if !bp && !ba {
-		return false, errors.New("Either policy or arn must be provided")
+	role := &awsRoleEntry{
+		CredentialTypes:        d.Get("credential_type").([]string),
+		PolicyDocument:         d.Get("policy_document").(string),
+		PolicyArns:             d.Get("policy_arns").([]string),
+		RoleArns:               d.Get("role_arns").([]string),
+		ExternalID:             d.Get("external_id").(string),
+		DefaultSTSTTL:          time.Duration(d.Get("default_sts_ttl").(int)) * time.Second,
+		MaxSTSTTL:              time.Duration(d.Get("max_sts_ttl").(int)) * time.Second,
+		UserPath:               d.Get("user_path").(string),
+		PermissionsBoundaryArn: d.Get("permissions_boundary_arn").(string),
+		IAMGroups:              d.Get("iam_groups").([]string),
 	}
-	if bp && ba {
-		return false, errors.New("Only one of policy or arn should be provided")
-	}
-	return bp, nil
-}
 
-func pathRolesWrite(
-	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	var buf bytes.Buffer
+	// The deprecated parameters are converted as roles of the legacy format
+	policy := d.Get("policy").(string)
+	arn := d.Get("arn").(string)
+	if policy != "" && arn != "" {
+		return logical.ErrorResponse("Only one of policy or arn should be provided"), nil
+	}
+	if policy != "" || arn != "" {
+		if role.PolicyDocument != "" || len(role.PolicyArns) != 0 || len(role.RoleArns) != 0 {
+			return logical.ErrorResponse("policy and arn cannot be combined with policy_document, policy_arns or role_arns"), nil
+		}
+		switch {
+		case policy != "":
+			role.PolicyDocument = policy
+		case strings.Contains(arn, ":role/"):
+			role.RoleArns = []string{arn}
+		default:
+			role.PolicyArns = []string{arn}
+		}
+	}
 
-	uip, err := useInlinePolicy(d)
-	if err != nil {
-		return nil, err
+	if len(role.CredentialTypes) == 0 {
+		role.CredentialTypes = inferCredentialTypes(role)
+	}
+	if role.UserPath == "" && role.hasCredentialType(iamUserCred) {
+		role.UserPath = "/"
 	}
 
-	if uip {
-		if err := json.Compact(&buf, []byte(d.Get("policy").(string))); err != nil {
+	if role.PolicyDocument != "" {
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, []byte(role.PolicyDocument)); err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
 				"Error compacting policy: %s", err)), nil
 		}
-		// Write the policy into storage
-		err := req.Storage.Put(&logical.StorageEntry{
-			Key:   "policy/" + d.Get("name").(string),
-			Value: buf.Bytes(),
-		})
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		// Write the arn ref into storage
-		err := req.Storage.Put(&logical.StorageEntry{
-			Key:   "policy/" + d.Get("name").(string),
-			Value: []byte(d.Get("arn").(string)),
-		})
-		if err != nil {
-			return nil, err
-		}
+		role.PolicyDocument = buf.String()
+	}
+
+	if err := role.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	// The role replaces any role of the legacy format
+	if err := req.Storage.Delete("policy/" + name); err != nil {
+		return nil, err
 	}
 
 	return nil, nil
 }
 
+// inferCredentialTypes returns the credential types a role can be used for
+// given its policies and roles
+func inferCredentialTypes(role *awsRoleEntry) []string {
+	if len(role.RoleArns) != 0 {
+		return []string{assumedRoleCred}
+	}
+	if role.PolicyDocument != "" && len(role.PolicyArns) == 0 &&
+		role.UserPath == "" && role.PermissionsBoundaryArn == "" && len(role.IAMGroups) == 0 {
+		return []string{iamUserCred, federationTokenCred}
+	}
+	return []string{iamUserCred}
+}
+
+func (r *awsRoleEntry) validate() error {
+	for _, credType := range r.CredentialTypes {
+		switch credType {
+		case iamUserCred:
+			if r.PolicyDocument == "" && len(r.PolicyArns) == 0 && len(r.IAMGroups) == 0 {
+				return fmt.Errorf("policy_document, policy_arns or iam_groups is required for the %s credential type", iamUserCred)
+			}
+		case assumedRoleCred:
+			if len(r.RoleArns) == 0 {
+				return fmt.Errorf("role_arns is required for the %s credential type", assumedRoleCred)
+			}
+		case federationTokenCred:
+			if r.PolicyDocument == "" {
+				return fmt.Errorf("policy_document is required for the %s credential type", federationTokenCred)
+			}
+		default:
+			return fmt.Errorf("unknown credential type %q", credType)
+		}
+	}
+
+	hasSTS := r.hasCredentialType(assumedRoleCred) || r.hasCredentialType(federationTokenCred)
+	if len(r.RoleArns) != 0 && !r.hasCredentialType(assumedRoleCred) {
+		return fmt.Errorf("role_arns is only valid for the %s credential type", assumedRoleCred)
+	}
+	if len(r.PolicyArns) != 0 && !r.hasCredentialType(iamUserCred) {
+		return fmt.Errorf("policy_arns is only valid for the %s credential type", iamUserCred)
+	}
+	if (r.UserPath != "" || r.PermissionsBoundaryArn != "" || len(r.IAMGroups) != 0) && !r.hasCredentialType(iamUserCred) {
+		return fmt.Errorf("user_path, permissions_boundary_arn and iam_groups are only valid for the %s credential type", iamUserCred)
+	}
+	// IAM paths are delimited by slashes, and limited to 512 characters
+	if r.UserPath != "" && (!strings.HasPrefix(r.UserPath, "/") || !strings.HasSuffix(r.UserPath, "/") || len(r.UserPath) > 512) {
+		return fmt.Errorf("user_path must begin and end with a slash, and be at most 512 characters long")
+	}
+	if r.ExternalID != "" && !r.hasCredentialType(assumedRoleCred) {
+		return fmt.Errorf("external_id is only valid for the %s credential type", assumedRoleCred)
+	}
+	if (r.DefaultSTSTTL != 0 || r.MaxSTSTTL != 0) && !hasSTS {
+		return fmt.Errorf("default_sts_ttl and max_sts_ttl are only valid for the %s and %s credential types", assumedRoleCred, federationTokenCred)
+	}
+	if r.MaxSTSTTL != 0 && r.DefaultSTSTTL > r.MaxSTSTTL {
+		return fmt.Errorf("default_sts_ttl cannot be greater than max_sts_ttl")
+	}
+
+	return nil
+}
+
+func (r *awsRoleEntry) hasCredentialType(credType string) bool {
+	return strutil.StrListContains(r.CredentialTypes, credType)
+}
+
 const pathListRolesHelpSyn = `List the existing roles in this backend`
 
 const pathListRolesHelpDesc = `Roles will be listed by the role name.`
@@ -159,16 +383,33 @@ Read, write and reference IAM policies that access keys can be made for.
 
 const pathRolesHelpDesc = `
 This path allows you to read and write roles that are used to
-create access keys. These roles are associated with IAM policies that
-map directly to the route to read the access keys. For example, if the
-backend is mounted at "aws" and you create a role at "aws/roles/deploy"
-then a user could request access credentials at "aws/creds/deploy".
-
-You can either supply a user inline policy (via the policy argument), or
-provide a reference to an existing AWS policy by supplying the full arn
-reference (via the arn argument). Inline user policies written are normal
-IAM policies. Vault will not attempt to parse these except to validate
-that they're basic JSON. No validation is performed on arn references.
+create access keys. For example, if the backend is mounted at "aws" and
+you create a role at "aws/roles/deploy" then a user could request access
+credentials at "aws/creds/deploy".
+
+Each role returns one or more types of credentials, given by
+"credential_type":
+
+  * "iam_user" creates an IAM user under "user_path", with the inline
+    policy of "policy_document", the managed policies of "policy_arns"
+    attached, the permissions boundary of "permissions_boundary_arn" and
+    the group memberships of "iam_groups", and returns an access key of the
+    user. It is revoked when its lease expires.
+
+  * "assumed_role" returns the STS credentials of one of the roles of
+    "role_arns", with the "external_id" if the trust policy of the role
+    requires one, and further restricted by "policy_document" if given.
+
+  * "federation_token" returns an STS federation token whose permissions
+    are those of "policy_document", within the permissions of the root
+    credentials.
+
+STS credentials expire by themselves, after "default_sts_ttl" unless
+another TTL is requested, up to "max_sts_ttl".
+
+Inline policies written are normal IAM policies. Vault will not attempt to
+parse these except to validate that they're basic JSON. No validation is
+performed on ARNs.
 
 To validate the keys, attempt to read an access key after writing the policy.
 `
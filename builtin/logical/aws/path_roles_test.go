@@ -1,6 +1,8 @@
 package aws
 
 import (
+	"reflect"
+	"sort"
 	"strconv"
 	"testing"
 
@@ -62,3 +64,252 @@ func TestBackend_PathListRoles(t *testing.T) {
 		t.Fatalf("failed to list all 10 roles")
 	}
 }
+
+func TestBackend_roleCredentialTypes(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: op,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatalf("bad: %s %s: %v", op, path, err)
+		}
+		return resp
+	}
+	expectError := func(op logical.Operation, path string, data map[string]interface{}) {
+		if resp := request(op, path, data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %s %s %#v: resp:%#v", op, path, data, resp)
+		}
+	}
+	expectOK := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp := request(op, path, data)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("bad: %s %s %#v: resp:%#v", op, path, data, resp)
+		}
+		return resp
+	}
+
+	policy := `{"Version": "2012-10-17", "Statement": []}`
+	roleArn := "arn:aws:iam::123456789012:role/deploy"
+
+	// The credential types are inferred from the policies and roles
+	for data, expected := range map[*map[string]interface{}][]string{
+		&map[string]interface{}{"policy_document": policy}:                               {iamUserCred, federationTokenCred},
+		&map[string]interface{}{"policy_arns": "arn:aws:iam::aws:policy/ReadOnlyAccess"}: {iamUserCred},
+		&map[string]interface{}{"role_arns": roleArn}:                                    {assumedRoleCred},
+		&map[string]interface{}{"policy": policy}:                                        {iamUserCred, federationTokenCred},
+		&map[string]interface{}{"arn": roleArn}:                                          {assumedRoleCred},
+	} {
+		expectOK(logical.UpdateOperation, "roles/inferred", *data)
+		resp := expectOK(logical.ReadOperation, "roles/inferred", nil)
+		if !reflect.DeepEqual(resp.Data["credential_types"], expected) {
+			t.Fatalf("bad: %#v: %#v", *data, resp.Data)
+		}
+	}
+
+	for _, data := range []map[string]interface{}{
+		{},
+		{"credential_type": "unknown", "policy_document": policy},
+		{"credential_type": iamUserCred, "role_arns": roleArn},
+		{"credential_type": assumedRoleCred, "policy_document": policy},
+		{"credential_type": federationTokenCred, "policy_arns": "arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		{"credential_type": iamUserCred, "policy_document": policy, "external_id": "id"},
+		{"credential_type": iamUserCred, "policy_document": policy, "default_sts_ttl": 60},
+		{"role_arns": roleArn, "default_sts_ttl": 7200, "max_sts_ttl": 3600},
+		{"policy_document": "not json"},
+		{"policy": policy, "arn": roleArn},
+		{"policy": policy, "role_arns": roleArn},
+	} {
+		expectError(logical.UpdateOperation, "roles/invalid", data)
+	}
+
+	expectOK(logical.UpdateOperation, "roles/deploy", map[string]interface{}{
+		"credential_type": assumedRoleCred,
+		"role_arns":       roleArn + ",arn:aws:iam::123456789012:role/other",
+		"policy_document": policy,
+		"external_id":     "secret-id",
+		"default_sts_ttl": 900,
+		"max_sts_ttl":     "2h",
+	})
+	resp := expectOK(logical.ReadOperation, "roles/deploy", nil)
+	expected := map[string]interface{}{
+		"credential_types":         []string{assumedRoleCred},
+		"policy_document":          `{"Version":"2012-10-17","Statement":[]}`,
+		"policy_arns":              []string{},
+		"role_arns":                []string{roleArn, "arn:aws:iam::123456789012:role/other"},
+		"external_id":              "secret-id",
+		"default_sts_ttl":          int64(900),
+		"max_sts_ttl":              int64(7200),
+		"user_path":                "",
+		"permissions_boundary_arn": "",
+		"iam_groups":               []string{},
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Requests are checked against the role before calling AWS
+	expectError(logical.ReadOperation, "sts/deploy", nil)
+	expectError(logical.UpdateOperation, "sts/deploy", map[string]interface{}{
+		"role_arn": "arn:aws:iam::123456789012:role/unknown",
+	})
+	expectError(logical.UpdateOperation, "creds/deploy", map[string]interface{}{
+		"role_arn": roleArn,
+		"ttl":      "3h",
+	})
+
+	expectOK(logical.UpdateOperation, "roles/managed", map[string]interface{}{
+		"policy_arns": "arn:aws:iam::aws:policy/ReadOnlyAccess",
+	})
+	expectError(logical.ReadOperation, "sts/managed", nil)
+	expectError(logical.UpdateOperation, "creds/managed", map[string]interface{}{
+		"ttl": 60,
+	})
+}
+
+func TestBackend_legacyRoles(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, value := range map[string]string{
+		"inline":  `{"Version":"2012-10-17"}`,
+		"managed": "arn:aws:iam::aws:policy/ReadOnlyAccess",
+		"assumed": "arn:aws:iam::123456789012:role/deploy",
+	} {
+		if err := config.StorageView.Put(&logical.StorageEntry{Key: "policy/" + name, Value: []byte(value)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, expected := range map[string]*awsRoleEntry{
+		"inline": &awsRoleEntry{
+			CredentialTypes: []string{iamUserCred, federationTokenCred},
+			PolicyDocument:  `{"Version":"2012-10-17"}`,
+		},
+		"managed": &awsRoleEntry{
+			CredentialTypes: []string{iamUserCred},
+			PolicyArns:      []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		},
+		"assumed": &awsRoleEntry{
+			CredentialTypes: []string{assumedRoleCred},
+			RoleArns:        []string{"arn:aws:iam::123456789012:role/deploy"},
+		},
+	} {
+		role, err := getRole(config.StorageView, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(role, expected) {
+			t.Fatalf("bad: %s: %#v", name, role)
+		}
+	}
+
+	// Writing a legacy role replaces it with a role of the new format
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "roles/inline",
+		Storage:   config.StorageView,
+		Data: map[string]interface{}{
+			"policy_document": `{"Version":"2012-10-17"}`,
+			"max_sts_ttl":     3600,
+		},
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp:%#v err:%v", resp, err)
+	}
+	if entry, err := config.StorageView.Get("policy/inline"); err != nil || entry != nil {
+		t.Fatalf("expected the legacy role to be deleted: %#v %v", entry, err)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "roles/",
+		Storage:   config.StorageView,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := resp.Data["keys"].([]string)
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"assumed", "inline", "managed"}) {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func TestBackend_roleIAMUserOptions(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "roles/users",
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"policy_arns": "arn:aws:iam::aws:policy/ReadOnlyAccess", "user_path": "vault/"},
+		{"policy_arns": "arn:aws:iam::aws:policy/ReadOnlyAccess", "user_path": "/vault"},
+		{"role_arns": "arn:aws:iam::123456789012:role/deploy", "iam_groups": "developers"},
+		{"credential_type": federationTokenCred, "policy_document": "{}", "permissions_boundary_arn": "arn:aws:iam::aws:policy/PowerUserAccess"},
+	} {
+		if resp := write(data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %#v: resp:%#v", data, resp)
+		}
+	}
+
+	// Groups are enough to grant permissions to users
+	if resp := write(map[string]interface{}{
+		"iam_groups": "developers,operators",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	role, err := getRole(config.StorageView, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(role.CredentialTypes, []string{iamUserCred}) || role.UserPath != "/" ||
+		!reflect.DeepEqual(role.IAMGroups, []string{"developers", "operators"}) {
+		t.Fatalf("bad: %#v", role)
+	}
+
+	if resp := write(map[string]interface{}{
+		"policy_document":          `{"Version":"2012-10-17"}`,
+		"policy_arns":              "arn:aws:iam::aws:policy/ReadOnlyAccess,arn:aws:iam::aws:policy/AmazonS3ReadOnlyAccess",
+		"user_path":                "/vault/",
+		"permissions_boundary_arn": "arn:aws:iam::123456789012:policy/boundary",
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+	role, err = getRole(config.StorageView, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(role.CredentialTypes, []string{iamUserCred}) || role.UserPath != "/vault/" ||
+		role.PermissionsBoundaryArn != "arn:aws:iam::123456789012:policy/boundary" || len(role.PolicyArns) != 2 {
+		t.Fatalf("bad: %#v", role)
+	}
+}
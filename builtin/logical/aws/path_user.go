@@ -2,9 +2,12 @@ package aws
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 	"github.com/mitchellh/mapstructure"
@@ -13,15 +16,11 @@ import (
 func pathUser(b *backend) *framework.Path {
 	return &framework.Path{
 		Pattern: "creds/" + framework.GenericNameRegex("name"),
-		Fields: map[string]*framework.FieldSchema{
-			"name": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "Name of the role",
-			},
-		},
+		Fields:  credsFields(),
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.ReadOperation: b.pathUserRead,
+			logical.ReadOperation:   b.pathUserRead,
+			logical.UpdateOperation: b.pathUserRead,
 		},
 
 		HelpSynopsis:    pathUserHelpSyn,
@@ -29,23 +28,106 @@ func pathUser(b *backend) *framework.Path {
 	}
 }
 
+// credsFields are the parameters of the requests of credentials
+func credsFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the role",
+		},
+		"role_arn": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "ARN of the role to assume, required if the role has several role_arns",
+		},
+		"ttl": &framework.FieldSchema{
+			Type:        framework.TypeDurationSecond,
+			Description: "Lifetime of STS credentials in seconds; defaults to the default_sts_ttl of the role",
+		},
+	}
+}
+
 func (b *backend) pathUserRead(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.credsRead(req, d, false)
+}
+
+// credsRead returns credentials of the first credential type of the role,
+// skipping IAM users if onlySTS is set
+func (b *backend) credsRead(
+	req *logical.Request, d *framework.FieldData, onlySTS bool) (*logical.Response, error) {
 	policyName := d.Get("name").(string)
 
-	// Read the policy
-	policy, err := req.Storage.Get("policy/" + policyName)
+	// Read the role
+	role, err := getRole(req.Storage, policyName)
 	if err != nil {
 		return nil, fmt.Errorf("error retrieving role: %s", err)
 	}
-	if policy == nil {
+	if role == nil {
 		return logical.ErrorResponse(fmt.Sprintf(
 			"Role '%s' not found", policyName)), nil
 	}
 
-	// Use the helper to create the secret
-	return b.secretAccessKeysCreate(
-		req.Storage, req.DisplayName, policyName, string(policy.Value))
+	var credType string
+	for _, t := range role.CredentialTypes {
+		if t != iamUserCred || !onlySTS {
+			credType = t
+			break
+		}
+	}
+
+	if credType == iamUserCred {
+		if d.Get("ttl").(int) != 0 || d.Get("role_arn").(string) != "" {
+			return logical.ErrorResponse("ttl and role_arn are only valid for STS credentials"), nil
+		}
+		// Use the helper to create the secret
+		return b.secretAccessKeysCreate(
+			req.Storage, req.DisplayName, policyName, role)
+	}
+
+	ttl := time.Duration(d.Get("ttl").(int)) * time.Second
+	if ttl == 0 {
+		ttl = role.DefaultSTSTTL
+	}
+	if ttl == 0 {
+		ttl = time.Hour
+	}
+	if role.MaxSTSTTL != 0 && ttl > role.MaxSTSTTL {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"ttl exceeds the max_sts_ttl of the role (%d)", int64(role.MaxSTSTTL.Seconds()))), nil
+	}
+	lifeTimeInSeconds := int64(ttl.Seconds())
+
+	switch credType {
+	case assumedRoleCred:
+		roleArn := d.Get("role_arn").(string)
+		switch {
+		case roleArn == "" && len(role.RoleArns) == 1:
+			roleArn = role.RoleArns[0]
+		case roleArn == "":
+			return logical.ErrorResponse(fmt.Sprintf(
+				"role_arn is required, one of: %s", strings.Join(role.RoleArns, ", "))), nil
+		case !strutil.StrListContains(role.RoleArns, roleArn):
+			return logical.ErrorResponse(fmt.Sprintf(
+				"role_arn '%s' is not allowed by role '%s'", roleArn, policyName)), nil
+		}
+		return b.assumeRole(
+			req.Storage,
+			req.DisplayName, policyName, roleArn, role.PolicyDocument, role.ExternalID,
+			lifeTimeInSeconds,
+		)
+	case federationTokenCred:
+		if d.Get("role_arn").(string) != "" {
+			return logical.ErrorResponse("role_arn is only valid for assumed roles"), nil
+		}
+		return b.secretTokenCreate(
+			req.Storage,
+			req.DisplayName, policyName, role.PolicyDocument,
+			lifeTimeInSeconds,
+		)
+	default:
+		return logical.ErrorResponse(
+			"Can't generate STS credentials for a managed policy; use a role to assume or an inline policy instead"), nil
+	}
 }
 
 func pathUserRollback(req *logical.Request, _kind string, data interface{}) error {
@@ -169,6 +251,10 @@ accessing AWS. The IAM policy used to back this key pair will be
 the "name" parameter. For example, if this backend is mounted at "aws",
 then "aws/creds/deploy" would generate access keys for the "deploy" role.
 
+The credentials are of the first credential type of the role. STS
+credentials are valid for "ttl", and the role to assume is given by
+"role_arn" if the role has several.
+
 The access keys will have a lease associated with them. The access keys
 can be revoked by using the lease ID.
 `
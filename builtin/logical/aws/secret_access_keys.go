@@ -6,8 +6,6 @@ import (
 	"regexp"
 	"time"
 
-	"strings"
-
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sts"
@@ -107,7 +105,7 @@ func (b *backend) secretTokenCreate(s logical.Storage,
 }
 
 func (b *backend) assumeRole(s logical.Storage,
-	displayName, policyName, policy string,
+	displayName, policyName, roleArn, policy, externalID string,
 	lifeTimeInSeconds int64) (*logical.Response, error) {
 	STSClient, err := clientSTS(s)
 	if err != nil {
@@ -116,12 +114,19 @@ func (b *backend) assumeRole(s logical.Storage,
 
 	username, usernameWarning := genUsername(displayName, policyName, "iam_user")
 
-	tokenResp, err := STSClient.AssumeRole(
-		&sts.AssumeRoleInput{
-			RoleSessionName: aws.String(username),
-			RoleArn:         aws.String(policy),
-			DurationSeconds: &lifeTimeInSeconds,
-		})
+	input := &sts.AssumeRoleInput{
+		RoleSessionName: aws.String(username),
+		RoleArn:         aws.String(roleArn),
+		DurationSeconds: &lifeTimeInSeconds,
+	}
+	// The policy further restricts the permissions of the role
+	if policy != "" {
+		input.Policy = aws.String(policy)
+	}
+	if externalID != "" {
+		input.ExternalId = aws.String(externalID)
+	}
+	tokenResp, err := STSClient.AssumeRole(input)
 
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -134,7 +139,7 @@ func (b *backend) assumeRole(s logical.Storage,
 		"security_token": *tokenResp.Credentials.SessionToken,
 	}, map[string]interface{}{
 		"username": username,
-		"policy":   policy,
+		"policy":   roleArn,
 		"is_sts":   true,
 	})
 
@@ -150,7 +155,7 @@ func (b *backend) assumeRole(s logical.Storage,
 
 func (b *backend) secretAccessKeysCreate(
 	s logical.Storage,
-	displayName, policyName string, policy string) (*logical.Response, error) {
+	displayName, policyName string, role *awsRoleEntry) (*logical.Response, error) {
 	client, err := clientIAM(s)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), nil
@@ -170,31 +175,30 @@ func (b *backend) secretAccessKeysCreate(
 	}
 
 	// Create the user
-	_, err = client.CreateUser(&iam.CreateUserInput{
-		UserName: aws.String(username),
-	})
+	err = createUser(client, username, role.UserPath, role.PermissionsBoundaryArn)
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
 			"Error creating IAM user: %s", err)), nil
 	}
 
-	if strings.HasPrefix(policy, "arn:") {
-		// Attach existing policy against user
+	// Attach existing policies against user
+	for _, arn := range role.PolicyArns {
 		_, err = client.AttachUserPolicy(&iam.AttachUserPolicyInput{
 			UserName:  aws.String(username),
-			PolicyArn: aws.String(policy),
+			PolicyArn: aws.String(arn),
 		})
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
 				"Error attaching user policy: %s", err)), nil
 		}
+	}
 
-	} else {
+	if role.PolicyDocument != "" {
 		// Add new inline user policy against user
 		_, err = client.PutUserPolicy(&iam.PutUserPolicyInput{
 			UserName:       aws.String(username),
 			PolicyName:     aws.String(policyName),
-			PolicyDocument: aws.String(policy),
+			PolicyDocument: aws.String(role.PolicyDocument),
 		})
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
@@ -202,6 +206,18 @@ func (b *backend) secretAccessKeysCreate(
 		}
 	}
 
+	// Add the user to the groups
+	for _, group := range role.IAMGroups {
+		_, err = client.AddUserToGroup(&iam.AddUserToGroupInput{
+			UserName:  aws.String(username),
+			GroupName: aws.String(group),
+		})
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"Error adding user to group: %s", err)), nil
+		}
+	}
+
 	// Create the keys
 	keyResp, err := client.CreateAccessKey(&iam.CreateAccessKeyInput{
 		UserName: aws.String(username),
@@ -225,7 +241,7 @@ func (b *backend) secretAccessKeysCreate(
 		"security_token": nil,
 	}, map[string]interface{}{
 		"username": username,
-		"policy":   policy,
+		"policy":   policyName,
 		"is_sts":   false,
 	})
 
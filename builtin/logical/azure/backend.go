@@ -0,0 +1,113 @@
+package azure
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// defaultLoginURL is the base URL of Azure Active Directory
+	defaultLoginURL = "https://login.microsoftonline.com"
+
+	// defaultGraphURL is the base URL of the Microsoft Graph API
+	defaultGraphURL = "https://graph.microsoft.com"
+
+	// defaultResourceManagerURL is the base URL of the Azure Resource
+	// Manager API
+	defaultResourceManagerURL = "https://management.azure.com"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+type backend struct {
+	*framework.Backend
+
+	// Lock to make changes to the backend's configuration
+	configMutex sync.RWMutex
+
+	// Lock to make changes to role entries
+	roleMutex sync.RWMutex
+
+	client *http.Client
+
+	// The base URLs of the Azure APIs, and the delay between the retries of
+	// role assignments. They are replaced in tests.
+	loginURL           string
+	graphURL           string
+	resourceManagerURL string
+	retryDelay         time.Duration
+}
+
+func Backend() *backend {
+	b := &backend{
+		client:             cleanhttp.DefaultClient(),
+		loginURL:           defaultLoginURL,
+		graphURL:           defaultGraphURL,
+		resourceManagerURL: defaultResourceManagerURL,
+		retryDelay:         5 * time.Second,
+	}
+
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathRole(b),
+			pathListRoles(b),
+			pathCreds(b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretServicePrincipal(b),
+			secretStaticServicePrincipal(b),
+		},
+
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: 5 * time.Minute,
+	}
+
+	return b
+}
+
+// azureClient returns a client calling the Azure APIs with the credentials
+// of the configuration
+func (b *backend) azureClient(s logical.Storage) (*azureClient, error) {
+	config, err := b.lockedConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("the backend is not configured")
+	}
+
+	return &azureClient{
+		http:               b.client,
+		config:             config,
+		loginURL:           b.loginURL,
+		graphURL:           b.graphURL,
+		resourceManagerURL: b.resourceManagerURL,
+		retryDelay:         b.retryDelay,
+	}, nil
+}
+
+const backendHelp = `
+The Azure backend dynamically generates Azure service principals.
+
+Roles either assign Azure roles to a service principal created for each
+set of credentials, which is deleted when their lease expires or is
+revoked, or add client secrets to an existing application, which are
+removed when their lease expires or is revoked.
+
+After mounting this backend, use the "config" path to configure the
+tenant and the credentials of the service principal managing the
+applications and role assignments, and the "roles" path to create roles.
+`
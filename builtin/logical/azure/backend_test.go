@@ -0,0 +1,410 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testTenant    = "tenant"
+	testScope     = "/subscriptions/sub/resourceGroups/web"
+	testRoleID    = "/subscriptions/sub/providers/Microsoft.Authorization/roleDefinitions/contributor"
+	testStaticApp = "static-app"
+)
+
+// testAzure serves the endpoints of Azure Active Directory, Microsoft Graph
+// and the Azure Resource Manager authorization API
+type testAzure struct {
+	t      *testing.T
+	server *httptest.Server
+
+	sync.Mutex
+	apps        map[string]*application
+	principals  map[string]*servicePrincipal
+	passwords   map[string][]string
+	assignments map[string]map[string]string
+	nextID      int
+
+	// failAssignments fails the next role assignments
+	failAssignments int
+}
+
+func newTestAzure(t *testing.T) *testAzure {
+	a := &testAzure{
+		t:           t,
+		apps:        make(map[string]*application),
+		principals:  make(map[string]*servicePrincipal),
+		passwords:   make(map[string][]string),
+		assignments: make(map[string]map[string]string),
+	}
+	a.apps[testStaticApp] = &application{ID: testStaticApp, AppID: "static-client", DisplayName: "static"}
+	a.server = httptest.NewServer(a)
+	return a
+}
+
+func (a *testAzure) id() string {
+	a.nextID++
+	return fmt.Sprintf("id-%d", a.nextID)
+}
+
+func (a *testAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+
+	path := r.URL.Path
+	if path == "/login/"+testTenant+"/oauth2/token" {
+		if r.FormValue("client_id") != "vault" || r.FormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"access_token": "token:" + r.FormValue("resource")})
+		return
+	}
+
+	var input map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&input)
+
+	switch {
+	case strings.HasPrefix(path, "/graph/"):
+		if r.Header.Get("Authorization") != "Bearer token:"+a.server.URL+"/graph/" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		a.serveGraph(w, r, strings.TrimPrefix(path, "/graph/v1.0/"), input)
+	case strings.HasPrefix(path, "/management/"):
+		if r.Header.Get("Authorization") != "Bearer token:"+a.server.URL+"/management/" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		a.serveResourceManager(w, r, strings.TrimPrefix(path, "/management"), input)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *testAzure) serveGraph(w http.ResponseWriter, r *http.Request, path string, input map[string]interface{}) {
+	parts := strings.Split(path, "/")
+	switch {
+	case path == "applications" && r.Method == "POST":
+		app := &application{ID: a.id(), AppID: a.id(), DisplayName: input["displayName"].(string)}
+		a.apps[app.ID] = app
+		json.NewEncoder(w).Encode(app)
+	case path == "applications" && r.Method == "GET":
+		var apps []*application
+		for _, app := range a.apps {
+			if r.URL.Query().Get("$filter") == fmt.Sprintf("displayName eq '%s'", app.DisplayName) {
+				apps = append(apps, app)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": apps})
+	case path == "servicePrincipals" && r.Method == "POST":
+		sp := &servicePrincipal{ID: a.id(), AppID: input["appId"].(string)}
+		a.principals[sp.ID] = sp
+		json.NewEncoder(w).Encode(sp)
+	case parts[0] == "applications" && a.apps[parts[1]] == nil:
+		w.WriteHeader(http.StatusNotFound)
+	case len(parts) == 2 && r.Method == "GET":
+		json.NewEncoder(w).Encode(a.apps[parts[1]])
+	case len(parts) == 2 && r.Method == "DELETE":
+		app := a.apps[parts[1]]
+		delete(a.apps, app.ID)
+		for id, sp := range a.principals {
+			if sp.AppID == app.AppID {
+				delete(a.principals, id)
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[2] == "addPassword":
+		keyID := a.id()
+		a.passwords[parts[1]] = append(a.passwords[parts[1]], keyID)
+		json.NewEncoder(w).Encode(&passwordCredential{
+			KeyID:       keyID,
+			SecretText:  "secret-" + keyID,
+			EndDateTime: input["passwordCredential"].(map[string]interface{})["endDateTime"].(string),
+		})
+	case len(parts) == 3 && parts[2] == "removePassword":
+		var kept []string
+		for _, keyID := range a.passwords[parts[1]] {
+			if keyID != input["keyId"] {
+				kept = append(kept, keyID)
+			}
+		}
+		a.passwords[parts[1]] = kept
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *testAzure) serveResourceManager(w http.ResponseWriter, r *http.Request, path string, input map[string]interface{}) {
+	if r.URL.Query().Get("api-version") != authorizationAPIVersion {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(path, "/providers/Microsoft.Authorization/roleDefinitions"):
+		var roles []map[string]interface{}
+		if r.URL.Query().Get("$filter") == "roleName eq 'Contributor'" {
+			roles = append(roles, map[string]interface{}{
+				"id":         testRoleID,
+				"properties": map[string]string{"roleName": "Contributor"},
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"value": roles})
+	case strings.Contains(path, "/providers/Microsoft.Authorization/roleAssignments/") && r.Method == "PUT":
+		if a.failAssignments > 0 {
+			a.failAssignments--
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{"code": "AuthorizationFailed", "message": "failed"},
+			})
+			return
+		}
+		properties := input["properties"].(map[string]interface{})
+		if a.principals[properties["principalId"].(string)] == nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{"code": "PrincipalNotFound", "message": "not found"},
+			})
+			return
+		}
+		a.assignments[path] = map[string]string{
+			"roleDefinitionId": properties["roleDefinitionId"].(string),
+			"principalId":      properties["principalId"].(string),
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("{}"))
+	case strings.Contains(path, "/providers/Microsoft.Authorization/roleAssignments/") && r.Method == "DELETE":
+		if a.assignments[path] == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		delete(a.assignments, path)
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (a *testAzure) counts() (apps, principals, assignments int) {
+	a.Lock()
+	defer a.Unlock()
+	return len(a.apps), len(a.principals), len(a.assignments)
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *testAzure) {
+	a := newTestAzure(t)
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	b.loginURL = a.server.URL + "/login"
+	b.graphURL = a.server.URL + "/graph"
+	b.resourceManagerURL = a.server.URL + "/management"
+	b.retryDelay = time.Millisecond
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	testOK(t, b, config.StorageView, logical.UpdateOperation, "config", map[string]interface{}{
+		"tenant_id":     testTenant,
+		"client_id":     "vault",
+		"client_secret": "secret",
+	})
+	return b, config.StorageView, a
+}
+
+func testRequest(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+}
+
+func testOK(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func testError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	resp, err := testRequest(b, s, op, path, data)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error: %s %s: resp: %#v", op, path, resp)
+	}
+}
+
+func TestBackend_config(t *testing.T) {
+	b, s, _ := testBackend(t)
+
+	resp := testOK(t, b, s, logical.ReadOperation, "config", nil)
+	if _, ok := resp.Data["client_secret"]; ok || resp.Data["tenant_id"] != testTenant || resp.Data["client_id"] != "vault" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testError(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"client_secret": "",
+	})
+}
+
+func TestBackend_roles(t *testing.T) {
+	b, s, _ := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"ttl": 60,
+	})
+	testError(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"azure_roles": `[{"role_name": "Unknown", "scope": "` + testScope + `"}]`,
+	})
+	testError(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"azure_roles": `[{"role_name": "Contributor"}]`,
+	})
+	testError(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"application_object_id": "unknown",
+	})
+	testError(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"azure_roles":           `[{"role_name": "Contributor", "scope": "` + testScope + `"}]`,
+		"application_object_id": testStaticApp,
+	})
+
+	testOK(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"azure_roles": `[{"role_name": "Contributor", "scope": "` + testScope + `/"}]`,
+		"ttl":         60,
+		"max_ttl":     120,
+	})
+	resp := testOK(t, b, s, logical.ReadOperation, "roles/web", nil)
+	azureRoles := resp.Data["azure_roles"].([]*azureRole)
+	if len(azureRoles) != 1 || azureRoles[0].RoleID != testRoleID || azureRoles[0].Scope != testScope ||
+		resp.Data["ttl"] != int64(60) || resp.Data["max_ttl"] != int64(120) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testOK(t, b, s, logical.ListOperation, "roles/", nil)
+	if fmt.Sprint(resp.Data["keys"]) != "[web]" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testOK(t, b, s, logical.DeleteOperation, "roles/web", nil)
+	if resp := testOK(t, b, s, logical.ReadOperation, "roles/web", nil); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestBackend_servicePrincipal(t *testing.T) {
+	b, s, a := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"azure_roles": `[{"role_name": "Contributor", "scope": "` + testScope + `"}]`,
+		"ttl":         60,
+		"max_ttl":     120,
+	})
+
+	resp := testOK(t, b, s, logical.ReadOperation, "creds/web", nil)
+	if resp.Secret == nil || resp.Secret.TTL != time.Minute || resp.Data["client_id"] == "" ||
+		!strings.HasPrefix(resp.Data["client_secret"].(string), "secret-") {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if apps, principals, assignments := a.counts(); apps != 2 || principals != 1 || assignments != 1 {
+		t.Fatalf("bad: %d %d %d", apps, principals, assignments)
+	}
+	for path, assignment := range a.assignments {
+		if !strings.HasPrefix(path, testScope+"/providers/Microsoft.Authorization/roleAssignments/") ||
+			assignment["roleDefinitionId"] != testRoleID {
+			t.Fatalf("bad: %s %#v", path, assignment)
+		}
+	}
+
+	// The internal data is stored as JSON with the lease
+	raw, err := json.Marshal(resp.Secret.InternalData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := resp.Secret
+	secret.InternalData = nil
+	if err := json.Unmarshal(raw, &secret.InternalData); err != nil {
+		t.Fatal(err)
+	}
+	secret.IssueTime = time.Now()
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil || resp.IsError() || resp.Secret.TTL != time.Minute {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Revoking the lease deletes the service principal and its assignments
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if apps, principals, assignments := a.counts(); apps != 1 || principals != 0 || assignments != 0 {
+		t.Fatalf("bad: %d %d %d", apps, principals, assignments)
+	}
+}
+
+func TestBackend_staticServicePrincipal(t *testing.T) {
+	b, s, a := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "roles/static", map[string]interface{}{
+		"application_object_id": testStaticApp,
+	})
+
+	resp := testOK(t, b, s, logical.ReadOperation, "creds/static", nil)
+	if resp.Secret == nil || resp.Data["client_id"] != "static-client" || len(a.passwords[testStaticApp]) != 1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    resp.Secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if len(a.passwords[testStaticApp]) != 0 || a.apps[testStaticApp] == nil {
+		t.Fatalf("bad: %#v", a.passwords)
+	}
+}
+
+func TestBackend_servicePrincipalRollback(t *testing.T) {
+	b, s, a := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"azure_roles": `[{"role_name": "Contributor", "scope": "` + testScope + `"}]`,
+	})
+
+	// Assigning the role fails, which leaves the service principal behind
+	a.failAssignments = 1
+	testError(t, b, s, logical.ReadOperation, "creds/web", nil)
+	if apps, principals, _ := a.counts(); apps != 2 || principals != 1 {
+		t.Fatalf("bad: %d %d", apps, principals)
+	}
+
+	testOK(t, b, s, logical.RollbackOperation, "", map[string]interface{}{
+		"immediate": true,
+	})
+	if apps, principals, assignments := a.counts(); apps != 1 || principals != 0 || assignments != 0 {
+		t.Fatalf("bad: %d %d %d", apps, principals, assignments)
+	}
+}
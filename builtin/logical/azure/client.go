@@ -0,0 +1,333 @@
+package azure
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	// authorizationAPIVersion is the version of the Azure Resource Manager
+	// authorization API used to manage role assignments
+	authorizationAPIVersion = "2018-01-01-preview"
+
+	// assignmentRetries is how many times role assignments of new service
+	// principals are retried, since principals take a while to replicate
+	assignmentRetries = 8
+)
+
+// azureClient calls the Microsoft Graph and Azure Resource Manager APIs with
+// the client credentials of the configuration
+type azureClient struct {
+	http   *http.Client
+	config *azureConfig
+
+	loginURL           string
+	graphURL           string
+	resourceManagerURL string
+
+	// retryDelay is the delay between the retries of role assignments
+	retryDelay time.Duration
+}
+
+// application is an Azure Active Directory application, limited to the
+// fields used here
+type application struct {
+	ID          string `json:"id"`
+	AppID       string `json:"appId"`
+	DisplayName string `json:"displayName"`
+}
+
+// servicePrincipal is the service principal of an application in the tenant
+type servicePrincipal struct {
+	ID    string `json:"id"`
+	AppID string `json:"appId"`
+}
+
+// passwordCredential is a client secret of an application
+type passwordCredential struct {
+	KeyID       string `json:"keyId"`
+	SecretText  string `json:"secretText"`
+	EndDateTime string `json:"endDateTime"`
+}
+
+// roleDefinition is an Azure role, limited to the fields used here
+type roleDefinition struct {
+	ID         string `json:"id"`
+	Properties struct {
+		RoleName string `json:"roleName"`
+	} `json:"properties"`
+}
+
+// apiError is an error returned by an Azure API
+type apiError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("status code %d: %s: %s", e.StatusCode, e.Code, e.Message)
+	}
+	return fmt.Sprintf("status code %d: %s", e.StatusCode, e.Message)
+}
+
+// isStatus returns whether err is an error of the Azure APIs with the given
+// status code
+func isStatus(err error, statusCode int) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == statusCode
+}
+
+// token returns an access token for the resource, obtained with the client
+// credentials of the configuration
+func (c *azureClient) token(resource string) (string, error) {
+	tokenURL := fmt.Sprintf("%s/%s/oauth2/token", c.loginURL, url.QueryEscape(c.config.TenantID))
+	resp, err := c.http.PostForm(tokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {c.config.ClientID},
+		"client_secret": {c.config.ClientSecret},
+		"resource":      {resource + "/"},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d fetching a token for %s", resp.StatusCode, resource)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := jsonutil.DecodeJSONFromReader(resp.Body, &token); err != nil {
+		return "", fmt.Errorf("error decoding the token for %s: %s", resource, err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("no access token found in the response of the tenant")
+	}
+	return token.AccessToken, nil
+}
+
+// call calls an API of the resource with a token for it, encoding the input
+// and decoding the output as JSON if they are not nil
+func (c *azureClient) call(resource, method, path string, input, output interface{}) error {
+	token, err := c.token(resource)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if input != nil {
+		raw, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, resource+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		raw, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 65536))
+		apiErr := &apiError{StatusCode: resp.StatusCode, Message: string(raw)}
+		if json.Unmarshal(raw, &errResp) == nil && errResp.Error.Message != "" {
+			apiErr.Code = errResp.Error.Code
+			apiErr.Message = errResp.Error.Message
+		}
+		return apiErr
+	}
+
+	if output != nil {
+		if err := jsonutil.DecodeJSONFromReader(resp.Body, output); err != nil {
+			return fmt.Errorf("error decoding the response of %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func (c *azureClient) graph(method, path string, input, output interface{}) error {
+	return c.call(c.graphURL, method, path, input, output)
+}
+
+func (c *azureClient) resourceManager(method, path string, input, output interface{}) error {
+	return c.call(c.resourceManagerURL, method, path, input, output)
+}
+
+// createApplication creates an application and its service principal
+func (c *azureClient) createApplication(displayName string) (*application, *servicePrincipal, error) {
+	var app application
+	err := c.graph("POST", "/v1.0/applications", map[string]string{
+		"displayName": displayName,
+	}, &app)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating application: %s", err)
+	}
+
+	var sp servicePrincipal
+	err = c.graph("POST", "/v1.0/servicePrincipals", map[string]string{
+		"appId": app.AppID,
+	}, &sp)
+	if err != nil {
+		return &app, nil, fmt.Errorf("error creating service principal: %s", err)
+	}
+
+	return &app, &sp, nil
+}
+
+// getApplication returns the application with the object ID, or nil if it
+// does not exist
+func (c *azureClient) getApplication(objectID string) (*application, error) {
+	var app application
+	err := c.graph("GET", "/v1.0/applications/"+url.PathEscape(objectID), nil, &app)
+	if isStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading application %s: %s", objectID, err)
+	}
+	return &app, nil
+}
+
+// findApplications returns the applications with the display name
+func (c *azureClient) findApplications(displayName string) ([]*application, error) {
+	var result struct {
+		Value []*application `json:"value"`
+	}
+	filter := url.Values{
+		"$filter": {fmt.Sprintf("displayName eq '%s'", strings.Replace(displayName, "'", "''", -1))},
+	}
+	if err := c.graph("GET", "/v1.0/applications?"+filter.Encode(), nil, &result); err != nil {
+		return nil, fmt.Errorf("error listing applications: %s", err)
+	}
+	return result.Value, nil
+}
+
+// deleteApplication deletes an application, which deletes its service
+// principal. Deleting an application which does not exist succeeds.
+func (c *azureClient) deleteApplication(objectID string) error {
+	err := c.graph("DELETE", "/v1.0/applications/"+url.PathEscape(objectID), nil, nil)
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error deleting application %s: %s", objectID, err)
+	}
+	return nil
+}
+
+// addPassword adds a client secret to an application, which expires at the
+// given time
+func (c *azureClient) addPassword(objectID, displayName string, expiration time.Time) (*passwordCredential, error) {
+	var password passwordCredential
+	err := c.graph("POST", "/v1.0/applications/"+url.PathEscape(objectID)+"/addPassword", map[string]interface{}{
+		"passwordCredential": map[string]string{
+			"displayName": displayName,
+			"endDateTime": expiration.UTC().Format(time.RFC3339),
+		},
+	}, &password)
+	if err != nil {
+		return nil, fmt.Errorf("error adding client secret to application %s: %s", objectID, err)
+	}
+	return &password, nil
+}
+
+// removePassword removes a client secret from an application. Removing a
+// secret of an application which does not exist succeeds.
+func (c *azureClient) removePassword(objectID, keyID string) error {
+	err := c.graph("POST", "/v1.0/applications/"+url.PathEscape(objectID)+"/removePassword", map[string]string{
+		"keyId": keyID,
+	}, nil)
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error removing client secret %s of application %s: %s", keyID, objectID, err)
+	}
+	return nil
+}
+
+// lookupRole returns the ID of the role with the name, assignable at the
+// scope
+func (c *azureClient) lookupRole(scope, roleName string) (string, error) {
+	var result struct {
+		Value []*roleDefinition `json:"value"`
+	}
+	query := url.Values{
+		"$filter":     {fmt.Sprintf("roleName eq '%s'", strings.Replace(roleName, "'", "''", -1))},
+		"api-version": {authorizationAPIVersion},
+	}
+	err := c.resourceManager("GET", scope+"/providers/Microsoft.Authorization/roleDefinitions?"+query.Encode(), nil, &result)
+	if err != nil {
+		return "", fmt.Errorf("error looking up role %q: %s", roleName, err)
+	}
+	if len(result.Value) != 1 {
+		return "", fmt.Errorf("found %d roles named %q at scope %s", len(result.Value), roleName, scope)
+	}
+	return result.Value[0].ID, nil
+}
+
+// newRoleAssignmentID returns the ID of a new role assignment at the scope.
+// Role assignments are named by the caller, so their IDs are known before
+// they are created.
+func newRoleAssignmentID(scope string) (string, error) {
+	name, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	return scope + "/providers/Microsoft.Authorization/roleAssignments/" + name, nil
+}
+
+// createRoleAssignment assigns the role to the principal. Principals which
+// were just created are not found until they are replicated, so the
+// assignment is retried meanwhile.
+func (c *azureClient) createRoleAssignment(assignmentID, roleID, principalID string) error {
+	for attempt := 0; ; attempt++ {
+		err := c.resourceManager("PUT", assignmentID+"?api-version="+authorizationAPIVersion, map[string]interface{}{
+			"properties": map[string]string{
+				"roleDefinitionId": roleID,
+				"principalId":      principalID,
+			},
+		}, nil)
+		if apiErr, ok := err.(*apiError); ok && apiErr.Code == "PrincipalNotFound" && attempt < assignmentRetries {
+			time.Sleep(c.retryDelay)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error assigning role %s: %s", roleID, err)
+		}
+		return nil
+	}
+}
+
+// deleteRoleAssignment deletes a role assignment. Deleting an assignment
+// which does not exist succeeds.
+func (c *azureClient) deleteRoleAssignment(assignmentID string) error {
+	err := c.resourceManager("DELETE", assignmentID+"?api-version="+authorizationAPIVersion, nil, nil)
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error deleting role assignment %s: %s", assignmentID, err)
+	}
+	return nil
+}
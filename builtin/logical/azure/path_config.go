@@ -0,0 +1,160 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"tenant_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The ID of the Azure Active Directory tenant of the service principals.",
+			},
+
+			"client_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The client ID of the service principal managing applications and role assignments.",
+			},
+
+			"client_secret": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The client secret of the service principal managing applications and role assignments.",
+			},
+		},
+
+		ExistenceCheck: b.pathConfigExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathConfigWrite,
+			logical.UpdateOperation: b.pathConfigWrite,
+			logical.ReadOperation:   b.pathConfigRead,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathConfigExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return false, err
+	}
+	return config != nil, nil
+}
+
+// lockedConfig returns the configuration of the backend, after acquiring
+// the configuration lock
+func (b *backend) lockedConfig(s logical.Storage) (*azureConfig, error) {
+	b.configMutex.RLock()
+	defer b.configMutex.RUnlock()
+
+	return b.nonLockedConfig(s)
+}
+
+// nonLockedConfig returns the configuration of the backend
+func (b *backend) nonLockedConfig(s logical.Storage) (*azureConfig, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result azureConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %s", err)
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.lockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The client secret is a credential, so it is not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"tenant_id": config.TenantID,
+			"client_id": config.ClientID,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.configMutex.Lock()
+	defer b.configMutex.Unlock()
+
+	config, err := b.nonLockedConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &azureConfig{}
+	}
+
+	if tenantIDRaw, ok := data.GetOk("tenant_id"); ok {
+		config.TenantID = tenantIDRaw.(string)
+	}
+	if clientIDRaw, ok := data.GetOk("client_id"); ok {
+		config.ClientID = clientIDRaw.(string)
+	}
+	if clientSecretRaw, ok := data.GetOk("client_secret"); ok {
+		config.ClientSecret = clientSecretRaw.(string)
+	}
+
+	if config.TenantID == "" {
+		return logical.ErrorResponse("tenant_id must be set"), nil
+	}
+	if config.ClientID == "" || config.ClientSecret == "" {
+		return logical.ErrorResponse("client_id and client_secret must be set"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// azureConfig holds the tenant of the service principals, and the
+// credentials used to manage them
+type azureConfig struct {
+	TenantID     string `json:"tenant_id"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+}
+
+const pathConfigHelpSyn = `
+Configures the Azure tenant and the credentials of the backend.
+`
+
+const pathConfigHelpDesc = `
+Service principals are created in the Azure Active Directory tenant
+'tenant_id', using the service principal 'client_id' and 'client_secret'.
+
+It must be allowed to manage applications with the Microsoft Graph API,
+such as with the Application.ReadWrite.OwnedBy permission, and to manage
+the role assignments of the scopes of the roles, such as with the "User
+Access Administrator" role.
+`
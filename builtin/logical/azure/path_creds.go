@@ -0,0 +1,163 @@
+package azure
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsRead,
+		},
+
+		HelpSynopsis:    pathCredsHelpSyn,
+		HelpDescription: pathCredsHelpDesc,
+	}
+}
+
+func (b *backend) pathCredsRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", roleName)), nil
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Client secrets expire on their own at the maximum TTL of their lease,
+	// in case their revocation fails
+	maxTTL := role.MaxTTL
+	if maxTTL == 0 || maxTTL > b.System().MaxLeaseTTL() {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+	expiration := time.Now().Add(maxTTL)
+
+	var resp *logical.Response
+	if role.ApplicationObjectID != "" {
+		resp, err = b.staticServicePrincipalCreate(client, roleName, role, expiration)
+	} else {
+		resp, err = b.servicePrincipalCreate(req.Storage, client, roleName, role, expiration)
+	}
+	if err != nil || resp.IsError() {
+		return resp, err
+	}
+
+	resp.Secret.TTL = role.TTL
+	return resp, nil
+}
+
+// servicePrincipalCreate creates a service principal with the Azure roles
+// of the role
+func (b *backend) servicePrincipalCreate(s logical.Storage, client *azureClient,
+	roleName string, role *roleEntry, expiration time.Time) (*logical.Response, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	displayName := fmt.Sprintf("vault-%s-%s", roleName, id)
+
+	assignmentIDs := make([]string, 0, len(role.AzureRoles))
+	for _, azureRole := range role.AzureRoles {
+		assignmentID, err := newRoleAssignmentID(azureRole.Scope)
+		if err != nil {
+			return nil, err
+		}
+		assignmentIDs = append(assignmentIDs, assignmentID)
+	}
+
+	// Write to the WAL that this application will be created. The IDs of the
+	// application are only known once it is created, so it is found by its
+	// unique display name on rollback.
+	walID, err := framework.PutWAL(s, walTypeServicePrincipal, &walServicePrincipal{
+		DisplayName:       displayName,
+		RoleAssignmentIDs: assignmentIDs,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %s", err)
+	}
+
+	app, sp, err := client.createApplication(displayName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	for i, azureRole := range role.AzureRoles {
+		if err := client.createRoleAssignment(assignmentIDs[i], azureRole.RoleID, sp.ID); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	password, err := client.addPassword(app.ID, "vault", expiration)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if err := framework.DeleteWAL(s, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %s", err)
+	}
+
+	return b.Secret(SecretServicePrincipalType).Response(map[string]interface{}{
+		"client_id":     app.AppID,
+		"client_secret": password.SecretText,
+	}, map[string]interface{}{
+		"role":                  roleName,
+		"application_object_id": app.ID,
+		"role_assignment_ids":   assignmentIDs,
+	}), nil
+}
+
+// staticServicePrincipalCreate adds a client secret to the existing
+// application of the role
+func (b *backend) staticServicePrincipalCreate(client *azureClient,
+	roleName string, role *roleEntry, expiration time.Time) (*logical.Response, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := client.addPassword(role.ApplicationObjectID, "vault-"+id, expiration)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return b.Secret(SecretStaticServicePrincipalType).Response(map[string]interface{}{
+		"client_id":     role.ApplicationID,
+		"client_secret": password.SecretText,
+	}, map[string]interface{}{
+		"role":                  roleName,
+		"application_object_id": role.ApplicationObjectID,
+		"key_id":                password.KeyID,
+	}), nil
+}
+
+const pathCredsHelpSyn = `
+Generate the credentials of a service principal for a role.
+`
+
+const pathCredsHelpDesc = `
+This path generates a client ID and a client secret for the role, either
+of a new service principal with the Azure roles of the role, or of the
+existing application of the role. The credentials are leased, and the
+service principal or client secret is deleted when the lease expires or
+is revoked.
+
+Azure Active Directory may take a few minutes to accept new credentials.
+`
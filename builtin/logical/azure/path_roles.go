@@ -0,0 +1,302 @@
+package azure
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+			"azure_roles": {
+				Type: framework.TypeString,
+				Description: `JSON list of the Azure roles assigned to the service principals of
+the role, each with a "scope" and a "role_name" or "role_id".`,
+			},
+			"application_object_id": {
+				Type: framework.TypeString,
+				Description: `Object ID of an existing application, which is issued client secrets
+instead of creating service principals.`,
+			},
+			"ttl": {
+				Type:    framework.TypeDurationSecond,
+				Default: 0,
+				Description: `Duration in seconds after which the issued credentials should expire.
+Defaults to 0, in which case the value will fallback to the system/mount defaults.`,
+			},
+			"max_ttl": {
+				Type:        framework.TypeDurationSecond,
+				Default:     0,
+				Description: "The maximum allowed lifetime of credentials issued using this role.",
+			},
+		},
+
+		ExistenceCheck: b.pathRoleExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.CreateOperation: b.pathRoleCreateUpdate,
+			logical.UpdateOperation: b.pathRoleCreateUpdate,
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathListRolesHelpSyn,
+		HelpDescription: pathListRolesHelpDesc,
+	}
+}
+
+// Establishes dichotomy of request operation between CreateOperation and UpdateOperation.
+// Returning 'true' forces an UpdateOperation, CreateOperation otherwise.
+func (b *backend) pathRoleExistenceCheck(req *logical.Request, data *framework.FieldData) (bool, error) {
+	entry, err := b.lockedRole(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return entry != nil, nil
+}
+
+// lockedRole returns the role with the given name, after acquiring the
+// role lock
+func (b *backend) lockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	return b.nonLockedRole(s, roleName)
+}
+
+// nonLockedRole returns the role with the given name
+func (b *backend) nonLockedRole(s logical.Storage, roleName string) (*roleEntry, error) {
+	entry, err := s.Get("roles/" + strings.ToLower(roleName))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := data.Get("name").(string)
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	return nil, req.Storage.Delete("roles/" + strings.ToLower(roleName))
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.roleMutex.RLock()
+	defer b.roleMutex.RUnlock()
+
+	roles, err := req.Storage.List("roles/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.lockedRole(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"azure_roles":           role.AzureRoles,
+			"application_object_id": role.ApplicationObjectID,
+			"ttl":                   int64(role.TTL / time.Second),
+			"max_ttl":               int64(role.MaxTTL / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleCreateUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	roleName := strings.ToLower(data.Get("name").(string))
+	if roleName == "" {
+		return logical.ErrorResponse("missing role"), nil
+	}
+
+	b.roleMutex.Lock()
+	defer b.roleMutex.Unlock()
+
+	role, err := b.nonLockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		role = &roleEntry{}
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if azureRolesRaw, ok := data.GetOk("azure_roles"); ok {
+		role.AzureRoles = nil
+		if raw := azureRolesRaw.(string); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &role.AzureRoles); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("error parsing azure_roles: %s", err)), nil
+			}
+		}
+
+		// Roles given by name are looked up once, so that their IDs are
+		// stable even if roles are renamed
+		for _, azureRole := range role.AzureRoles {
+			if azureRole.Scope == "" {
+				return logical.ErrorResponse("each of the azure_roles must have a scope"), nil
+			}
+			azureRole.Scope = strings.TrimSuffix(azureRole.Scope, "/")
+			if azureRole.RoleID != "" {
+				continue
+			}
+			if azureRole.RoleName == "" {
+				return logical.ErrorResponse("each of the azure_roles must have a role_name or a role_id"), nil
+			}
+			azureRole.RoleID, err = client.lookupRole(azureRole.Scope, azureRole.RoleName)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+
+	if appObjectIDRaw, ok := data.GetOk("application_object_id"); ok {
+		role.ApplicationObjectID = appObjectIDRaw.(string)
+		role.ApplicationID = ""
+		if role.ApplicationObjectID != "" {
+			app, err := client.getApplication(role.ApplicationObjectID)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+			if app == nil {
+				return logical.ErrorResponse(fmt.Sprintf("application %q does not exist", role.ApplicationObjectID)), nil
+			}
+			role.ApplicationID = app.AppID
+		}
+	}
+
+	// The roles of existing applications are assigned outside of Vault
+	if (len(role.AzureRoles) == 0) == (role.ApplicationObjectID == "") {
+		return logical.ErrorResponse("exactly one of azure_roles and application_object_id must be set"), nil
+	}
+
+	var resp logical.Response
+
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		role.TTL = time.Duration(ttlRaw.(int)) * time.Second
+		if defaultLeaseTTL := b.System().DefaultLeaseTTL(); role.TTL > defaultLeaseTTL {
+			resp.AddWarning(fmt.Sprintf("Given ttl of %d seconds greater than current mount/system default of %d seconds; ttl will be capped at issue time", role.TTL/time.Second, defaultLeaseTTL/time.Second))
+		}
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		role.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+		if systemMaxTTL := b.System().MaxLeaseTTL(); role.MaxTTL > systemMaxTTL {
+			resp.AddWarning(fmt.Sprintf("Given max_ttl of %d seconds greater than current mount/system default of %d seconds; max_ttl will be capped at issue time", role.MaxTTL/time.Second, systemMaxTTL/time.Second))
+		}
+	}
+	if role.TTL < 0 || role.MaxTTL < 0 {
+		return logical.ErrorResponse("ttl and max_ttl cannot be negative"), nil
+	}
+	if role.MaxTTL != 0 && role.MaxTTL < role.TTL {
+		return logical.ErrorResponse("ttl should be shorter than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("roles/"+roleName, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if len(resp.Warnings()) == 0 {
+		return nil, nil
+	}
+	return &resp, nil
+}
+
+// roleEntry either assigns Azure roles to the service principals created
+// for it, or issues client secrets of an existing application
+type roleEntry struct {
+	AzureRoles          []*azureRole  `json:"azure_roles"`
+	ApplicationObjectID string        `json:"application_object_id"`
+	ApplicationID       string        `json:"application_id"`
+	TTL                 time.Duration `json:"ttl"`
+	MaxTTL              time.Duration `json:"max_ttl"`
+}
+
+// azureRole is an Azure role assigned at a scope, such as a subscription or
+// a resource group
+type azureRole struct {
+	RoleName string `json:"role_name"`
+	RoleID   string `json:"role_id"`
+	Scope    string `json:"scope"`
+}
+
+const pathRoleHelpSyn = `
+Manage the roles of the backend.
+`
+
+const pathRoleHelpDesc = `
+A role either assigns the Azure roles of 'azure_roles' to a service
+principal created for each set of credentials, or issues client secrets of
+the existing application 'application_object_id'.
+
+The Azure roles are given as a JSON list, such as:
+
+    [{"role_name": "Contributor", "scope": "/subscriptions/<id>/resourceGroups/web"}]
+
+Roles given by name are looked up when the role is written.
+
+The service principals and client secrets are deleted when the lease of
+their credentials expires or is revoked. Client secrets also expire on
+their own after the maximum TTL of the role.
+`
+
+const pathListRolesHelpSyn = `
+Lists all the roles of the backend.
+`
+
+const pathListRolesHelpDesc = `
+The list contains the names of the roles.
+`
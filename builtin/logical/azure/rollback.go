@@ -0,0 +1,56 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const walTypeServicePrincipal = "service_principal"
+
+// walServicePrincipal is a service principal whose creation may have
+// failed, with the role assignments it may have
+type walServicePrincipal struct {
+	DisplayName       string
+	RoleAssignmentIDs []string
+}
+
+func (b *backend) walRollback(req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case walTypeServicePrincipal:
+		return b.servicePrincipalRollback(req, data)
+	default:
+		return fmt.Errorf("unknown type to rollback")
+	}
+}
+
+func (b *backend) servicePrincipalRollback(req *logical.Request, data interface{}) error {
+	var entry walServicePrincipal
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return err
+	}
+
+	for _, assignmentID := range entry.RoleAssignmentIDs {
+		if err := client.deleteRoleAssignment(assignmentID); err != nil {
+			return err
+		}
+	}
+
+	apps, err := client.findApplications(entry.DisplayName)
+	if err != nil {
+		return err
+	}
+	for _, app := range apps {
+		if err := client.deleteApplication(app.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package azure
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	SecretServicePrincipalType       = "service_principal"
+	SecretStaticServicePrincipalType = "static_service_principal"
+)
+
+func secretServicePrincipal(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type:   SecretServicePrincipalType,
+		Fields: secretFields(),
+
+		Renew:  b.secretRenew,
+		Revoke: b.secretServicePrincipalRevoke,
+	}
+}
+
+func secretStaticServicePrincipal(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type:   SecretStaticServicePrincipalType,
+		Fields: secretFields(),
+
+		Renew:  b.secretRenew,
+		Revoke: b.secretStaticServicePrincipalRevoke,
+	}
+}
+
+func secretFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"client_id": {
+			Type:        framework.TypeString,
+			Description: "Client ID",
+		},
+		"client_secret": {
+			Type:        framework.TypeString,
+			Description: "Client secret",
+		},
+	}
+}
+
+func (b *backend) secretRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing role internal data")
+	}
+
+	role, err := b.lockedRole(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("error during renew: could not find role with name %s", roleName)
+	}
+
+	f := framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())
+	return f(req, d)
+}
+
+func (b *backend) secretServicePrincipalRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	appObjectID, ok := req.Secret.InternalData["application_object_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing application_object_id internal data")
+	}
+	assignmentIDs, err := stringList(req.Secret.InternalData["role_assignment_ids"])
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The role assignments of a deleted principal are left behind, so they
+	// are deleted first
+	for _, assignmentID := range assignmentIDs {
+		if err := client.deleteRoleAssignment(assignmentID); err != nil {
+			return nil, err
+		}
+	}
+	if err := client.deleteApplication(appObjectID); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) secretStaticServicePrincipalRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	appObjectID, ok := req.Secret.InternalData["application_object_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing application_object_id internal data")
+	}
+	keyID, ok := req.Secret.InternalData["key_id"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing key_id internal data")
+	}
+
+	client, err := b.azureClient(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.removePassword(appObjectID, keyID); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// stringList converts a list of strings of the internal data of a secret,
+// which is a []interface{} once stored
+func stringList(raw interface{}) ([]string, error) {
+	switch list := raw.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		return list, nil
+	case []interface{}:
+		result := make([]string, 0, len(list))
+		for _, item := range list {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("unexpected item %#v in internal data", item)
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unexpected internal data %#v", raw)
+	}
+}
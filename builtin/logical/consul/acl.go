@@ -0,0 +1,158 @@
+package consul
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+// aclToken is a token of the ACL system of Consul 1.4 and later, which links
+// to policies, roles and identities instead of embedding legacy ACL rules
+type aclToken struct {
+	AccessorID        string                `json:",omitempty"`
+	SecretID          string                `json:",omitempty"`
+	Description       string                `json:",omitempty"`
+	Policies          []*aclLink            `json:",omitempty"`
+	Roles             []*aclLink            `json:",omitempty"`
+	ServiceIdentities []*aclServiceIdentity `json:",omitempty"`
+	NodeIdentities    []*aclNodeIdentity    `json:",omitempty"`
+	Local             bool                  `json:",omitempty"`
+	Namespace         string                `json:",omitempty"`
+	Partition         string                `json:",omitempty"`
+}
+
+// aclLink references a Consul policy or role by name
+type aclLink struct {
+	Name string
+}
+
+// aclServiceIdentity is a synthetic policy granting the permissions of a
+// service, in some datacenters or in all of them
+type aclServiceIdentity struct {
+	ServiceName string   `json:"ServiceName"`
+	Datacenters []string `json:"Datacenters,omitempty"`
+}
+
+// aclNodeIdentity is a synthetic policy granting the permissions of a node
+type aclNodeIdentity struct {
+	NodeName   string `json:"NodeName"`
+	Datacenter string `json:"Datacenter"`
+}
+
+// aclClient calls the token endpoints of the ACL system of Consul 1.4 and
+// later, which the vendored Consul API does not support
+type aclClient struct {
+	http    *http.Client
+	address string
+	token   string
+}
+
+func newACLClient(s logical.Storage) (*aclClient, error, error) {
+	conf, userErr, intErr := readConfigAccess(s)
+	if intErr != nil {
+		return nil, nil, intErr
+	}
+	if userErr != nil {
+		return nil, userErr, nil
+	}
+	if conf == nil {
+		return nil, nil, fmt.Errorf("no error received but no configuration found")
+	}
+
+	scheme := conf.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return &aclClient{
+		http:    cleanhttp.DefaultClient(),
+		address: scheme + "://" + conf.Address,
+		token:   conf.Token,
+	}, nil, nil
+}
+
+// aclStatusError is a response of the Consul API with an unexpected status
+type aclStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *aclStatusError) Error() string {
+	return fmt.Sprintf("Unexpected response code: %d (%s)", e.StatusCode, e.Message)
+}
+
+func (c *aclClient) call(method, path string, params url.Values, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	u := c.address + path
+	if len(params) != 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequest(method, u, &reqBody)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Consul-Token", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &aclStatusError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// createToken creates a token and returns it with its accessor and secret
+// IDs
+func (c *aclClient) createToken(token *aclToken) (*aclToken, error) {
+	var created aclToken
+	if err := c.call("PUT", "/v1/acl/token", nil, token, &created); err != nil {
+		return nil, err
+	}
+	if created.AccessorID == "" || created.SecretID == "" {
+		return nil, fmt.Errorf("consul did not return the created token")
+	}
+	return &created, nil
+}
+
+// deleteToken deletes the token of the accessor from its namespace and
+// partition. Tokens which do not exist anymore are not an error.
+func (c *aclClient) deleteToken(accessorID, namespace, partition string) error {
+	params := url.Values{}
+	if namespace != "" {
+		params.Set("ns", namespace)
+	}
+	if partition != "" {
+		params.Set("partition", partition)
+	}
+
+	err := c.call("DELETE", "/v1/acl/token/"+url.PathEscape(accessorID), params, nil, nil)
+	if statusErr, ok := err.(*aclStatusError); ok && statusErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,163 @@
+package consul
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testACLServer serves the token endpoints of the ACL system of Consul 1.4
+// and later
+type testACLServer struct {
+	sync.Mutex
+	tokens map[string]*aclToken
+}
+
+func (s *testACLServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+
+	if r.Header.Get("X-Consul-Token") != "master" {
+		http.Error(w, "Permission denied", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/acl/token" && r.Method == "PUT":
+		var token aclToken
+		json.NewDecoder(r.Body).Decode(&token)
+		token.AccessorID, _ = uuid.GenerateUUID()
+		token.SecretID, _ = uuid.GenerateUUID()
+		s.tokens[token.AccessorID] = &token
+		json.NewEncoder(w).Encode(&token)
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/token/") && r.Method == "DELETE":
+		token, ok := s.tokens[strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")]
+		if !ok {
+			http.Error(w, "ACL not found", http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("ns") != token.Namespace || r.URL.Query().Get("partition") != token.Partition {
+			http.Error(w, "ACL not found", http.StatusNotFound)
+			return
+		}
+		delete(s.tokens, token.AccessorID)
+		w.Write([]byte("true"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBackend_linkedTokens(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consul := &testACLServer{tokens: make(map[string]*aclToken)}
+	server := httptest.NewServer(consul)
+	defer server.Close()
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation:   op,
+			Path:        path,
+			Storage:     config.StorageView,
+			Data:        data,
+			DisplayName: "token",
+		})
+		if err != nil {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		return resp
+	}
+
+	request(logical.UpdateOperation, "config/access", map[string]interface{}{
+		"address": strings.TrimPrefix(server.URL, "http://"),
+		"token":   "master",
+	})
+
+	for _, data := range []map[string]interface{}{
+		{"policies": "web", "policy": "a2V5ICIiIHsgcG9saWN5ID0gInJlYWQiIH0="},
+		{"policies": "web", "token_type": "management"},
+		{"consul_namespace": "team"},
+		{"node_identities": "server-1"},
+		{"service_identities": ":dc1"},
+	} {
+		resp := request(logical.UpdateOperation, "roles/web", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := request(logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"policies":           "web-read, web-write",
+		"consul_roles":       "deployer",
+		"service_identities": "web:dc1,dc2;db",
+		"node_identities":    "server-1:dc1",
+		"consul_namespace":   "team",
+		"partition":          "apps",
+		"local":              true,
+		"lease":              "1h",
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp = request(logical.ReadOperation, "roles/web", nil)
+	if policies := resp.Data["policies"].([]string); len(policies) != 2 || policies[1] != "web-write" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if identities := resp.Data["service_identities"].([]string); len(identities) != 2 || identities[0] != "web:dc1,dc2" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["policy"]; ok || resp.Data["local"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = request(logical.ReadOperation, "creds/web", nil)
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("resp: %#v", resp)
+	}
+	token, ok := consul.tokens[resp.Data["accessor"].(string)]
+	if !ok || token.SecretID != resp.Data["token"] {
+		t.Fatalf("token not created: %#v", resp.Data)
+	}
+	if resp.Data["consul_namespace"] != "team" || resp.Data["partition"] != "apps" || resp.Data["local"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if len(token.Policies) != 2 || token.Policies[0].Name != "web-read" ||
+		len(token.Roles) != 1 || token.Roles[0].Name != "deployer" || !token.Local {
+		t.Fatalf("bad token: %#v", token)
+	}
+	if len(token.ServiceIdentities) != 2 || token.ServiceIdentities[0].ServiceName != "web" ||
+		len(token.ServiceIdentities[0].Datacenters) != 2 || token.ServiceIdentities[1].Datacenters != nil {
+		t.Fatalf("bad service identities: %#v", token.ServiceIdentities)
+	}
+	if len(token.NodeIdentities) != 1 || token.NodeIdentities[0].NodeName != "server-1" || token.NodeIdentities[0].Datacenter != "dc1" {
+		t.Fatalf("bad node identities: %#v", token.NodeIdentities)
+	}
+
+	// Revoking deletes the token from its namespace and partition, and
+	// succeeds once it is deleted
+	for i := 0; i < 2; i++ {
+		revokeResp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   config.StorageView,
+			Secret:    resp.Secret,
+		})
+		if err != nil || (revokeResp != nil && revokeResp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, revokeResp)
+		}
+		if len(consul.tokens) != 0 {
+			t.Fatalf("token not deleted: %#v", consul.tokens)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package consul
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -20,8 +21,57 @@ func pathRoles() *framework.Path {
 
 			"policy": &framework.FieldSchema{
 				Type: framework.TypeString,
-				Description: `Policy document, base64 encoded. Required
-for 'client' tokens.`,
+				Description: `Legacy ACL policy document, base64 encoded.
+Required for 'client' tokens unless the token links
+to Consul policies, roles or identities.`,
+			},
+
+			"policies": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the Consul ACL
+policies the tokens link to. Requires Consul 1.4
+or later.`,
+			},
+
+			"consul_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the Consul ACL roles
+the tokens link to. Requires Consul 1.5 or later.`,
+			},
+
+			"service_identities": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Semicolon-separated list of the service
+identities of the tokens, each given as
+'<service>[:<datacenter>,...]'. Requires Consul
+1.5 or later.`,
+			},
+
+			"node_identities": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the node identities
+of the tokens, each given as '<node>:<datacenter>'.
+Requires Consul 1.8 or later.`,
+			},
+
+			"consul_namespace": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Consul Enterprise namespace of the tokens.
+Defaults to the namespace of the token of Vault.`,
+			},
+
+			"partition": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Consul Enterprise admin partition of the
+tokens. Defaults to the partition of the token of
+Vault.`,
+			},
+
+			"local": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether the tokens are local to the
+datacenter of the Consul servers of Vault, instead
+of being replicated to every datacenter.`,
 			},
 
 			"token_type": &framework.FieldSchema{
@@ -44,6 +94,9 @@ Defaults to 'client'.`,
 			logical.UpdateOperation: pathRolesWrite,
 			logical.DeleteOperation: pathRolesDelete,
 		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
 	}
 }
 
@@ -71,8 +124,15 @@ func pathRolesRead(
 	// Generate the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"lease":      result.Lease.String(),
-			"token_type": result.TokenType,
+			"lease":              result.Lease.String(),
+			"token_type":         result.TokenType,
+			"policies":           result.Policies,
+			"consul_roles":       result.Roles,
+			"service_identities": result.ServiceIdentities,
+			"node_identities":    result.NodeIdentities,
+			"consul_namespace":   result.Namespace,
+			"partition":          result.Partition,
+			"local":              result.Local,
 		},
 	}
 	if result.Policy != "" {
@@ -94,36 +154,55 @@ func pathRolesWrite(
 	}
 
 	name := d.Get("name").(string)
+	role := roleConfig{
+		TokenType:         tokenType,
+		Policies:          nonEmpty(d.Get("policies").([]string)),
+		Roles:             nonEmpty(d.Get("consul_roles").([]string)),
+		ServiceIdentities: nonEmpty(strings.Split(d.Get("service_identities").(string), ";")),
+		NodeIdentities:    nonEmpty(d.Get("node_identities").([]string)),
+		Namespace:         d.Get("consul_namespace").(string),
+		Partition:         d.Get("partition").(string),
+		Local:             d.Get("local").(bool),
+	}
+	if _, err := role.serviceIdentities(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if _, err := role.nodeIdentities(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	policy := d.Get("policy").(string)
-	var policyRaw []byte
-	var err error
-	if tokenType != "management" {
+	switch {
+	case role.linked() && (policy != "" || tokenType == "management"):
+		return logical.ErrorResponse(
+			"policies, consul_roles, service_identities and node_identities cannot be used with a legacy policy or management tokens"), nil
+	case !role.linked() && (role.Namespace != "" || role.Partition != "" || role.Local):
+		return logical.ErrorResponse(
+			"consul_namespace, partition and local require policies, consul_roles, service_identities or node_identities"), nil
+	case tokenType != "management" && !role.linked():
 		if policy == "" {
 			return logical.ErrorResponse(
-				"policy cannot be empty when not using management tokens"), nil
+				"policy cannot be empty when not using management tokens or policies, consul_roles, service_identities or node_identities"), nil
 		}
-		policyRaw, err = base64.StdEncoding.DecodeString(d.Get("policy").(string))
+		policyRaw, err := base64.StdEncoding.DecodeString(policy)
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
 				"Error decoding policy base64: %s", err)), nil
 		}
+		role.Policy = string(policyRaw)
 	}
 
-	var lease time.Duration
 	leaseParam := d.Get("lease").(string)
 	if leaseParam != "" {
-		lease, err = time.ParseDuration(leaseParam)
+		lease, err := time.ParseDuration(leaseParam)
 		if err != nil {
 			return logical.ErrorResponse(fmt.Sprintf(
 				"error parsing given lease of %s: %s", leaseParam, err)), nil
 		}
+		role.Lease = lease
 	}
 
-	entry, err := logical.StorageEntryJSON("policy/"+name, roleConfig{
-		Policy:    string(policyRaw),
-		Lease:     lease,
-		TokenType: tokenType,
-	})
+	entry, err := logical.StorageEntryJSON("policy/"+name, role)
 	if err != nil {
 		return nil, err
 	}
@@ -148,4 +227,79 @@ type roleConfig struct {
 	Policy    string        `json:"policy"`
 	Lease     time.Duration `json:"lease"`
 	TokenType string        `json:"token_type"`
+
+	// The fields of the ACL system of Consul 1.4 and later
+	Policies          []string `json:"policies"`
+	Roles             []string `json:"consul_roles"`
+	ServiceIdentities []string `json:"service_identities"`
+	NodeIdentities    []string `json:"node_identities"`
+	Namespace         string   `json:"consul_namespace"`
+	Partition         string   `json:"partition"`
+	Local             bool     `json:"local"`
+}
+
+// linked returns whether the tokens of the role link to Consul policies,
+// roles or identities, instead of embedding a legacy policy
+func (r *roleConfig) linked() bool {
+	return len(r.Policies) != 0 || len(r.Roles) != 0 ||
+		len(r.ServiceIdentities) != 0 || len(r.NodeIdentities) != 0
+}
+
+func (r *roleConfig) serviceIdentities() ([]*aclServiceIdentity, error) {
+	var identities []*aclServiceIdentity
+	for _, raw := range r.ServiceIdentities {
+		parts := strings.SplitN(raw, ":", 2)
+		identity := &aclServiceIdentity{ServiceName: strings.TrimSpace(parts[0])}
+		if identity.ServiceName == "" {
+			return nil, fmt.Errorf("service identity %q has no service name", raw)
+		}
+		if len(parts) == 2 {
+			identity.Datacenters = nonEmpty(strings.Split(parts[1], ","))
+		}
+		identities = append(identities, identity)
+	}
+	return identities, nil
+}
+
+func (r *roleConfig) nodeIdentities() ([]*aclNodeIdentity, error) {
+	var identities []*aclNodeIdentity
+	for _, raw := range r.NodeIdentities {
+		parts := strings.SplitN(raw, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("node identity %q must be given as '<node>:<datacenter>'", raw)
+		}
+		identities = append(identities, &aclNodeIdentity{
+			NodeName:   parts[0],
+			Datacenter: parts[1],
+		})
+	}
+	return identities, nil
 }
+
+// nonEmpty returns the trimmed items which are not empty
+func nonEmpty(items []string) []string {
+	var result []string
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+const pathRolesHelpSyn = `
+Manage the roles that tokens can be created for.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles of the backend.
+
+The tokens of a role either link to the policies, roles and identities of
+the ACL system of Consul 1.4 and later, with the "policies",
+"consul_roles", "service_identities" and "node_identities" parameters, or
+embed the base64-encoded rules of the legacy ACL system in the "policy"
+parameter. Legacy 'management' tokens need neither.
+
+Linked tokens can be created in a Consul Enterprise namespace and admin
+partition, and be local to the datacenter of the Consul servers of Vault.
+`
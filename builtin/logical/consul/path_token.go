@@ -22,6 +22,9 @@ func pathToken(b *backend) *framework.Path {
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathTokenRead,
 		},
+
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
 	}
 }
 
@@ -46,17 +49,22 @@ func (b *backend) pathTokenRead(
 		result.TokenType = "client"
 	}
 
+	// Generate a random name for the token
+	tokenName := fmt.Sprintf("Vault %s %d", req.DisplayName, time.Now().Unix())
+
+	if result.linked() {
+		return b.createLinkedToken(req, name, tokenName, &result)
+	}
+
 	// Get the consul client
 	c, userErr, intErr := client(req.Storage)
 	if intErr != nil {
 		return nil, intErr
 	}
 	if userErr != nil {
-		return logical.ErrorResponse(err.Error()), nil
+		return logical.ErrorResponse(userErr.Error()), nil
 	}
 
-	// Generate a random name for the token
-	tokenName := fmt.Sprintf("Vault %s %d", req.DisplayName, time.Now().Unix())
 	// Create it
 	token, _, err := c.ACL().Create(&api.ACLEntry{
 		Name:  tokenName,
@@ -77,3 +85,72 @@ func (b *backend) pathTokenRead(
 
 	return s, nil
 }
+
+// createLinkedToken creates a token of the ACL system of Consul 1.4 and
+// later, linked to the policies, roles and identities of the role
+func (b *backend) createLinkedToken(req *logical.Request,
+	roleName, tokenName string, role *roleConfig) (*logical.Response, error) {
+	c, userErr, intErr := newACLClient(req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	serviceIdentities, err := role.serviceIdentities()
+	if err != nil {
+		return nil, err
+	}
+	nodeIdentities, err := role.nodeIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &aclToken{
+		Description:       fmt.Sprintf("%s (role %s)", tokenName, roleName),
+		ServiceIdentities: serviceIdentities,
+		NodeIdentities:    nodeIdentities,
+		Local:             role.Local,
+		Namespace:         role.Namespace,
+		Partition:         role.Partition,
+	}
+	for _, policy := range role.Policies {
+		token.Policies = append(token.Policies, &aclLink{Name: policy})
+	}
+	for _, consulRole := range role.Roles {
+		token.Roles = append(token.Roles, &aclLink{Name: consulRole})
+	}
+
+	created, err := c.createToken(token)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Use the helper to create the secret
+	s := b.Secret(SecretTokenType).Response(map[string]interface{}{
+		"token":            created.SecretID,
+		"accessor":         created.AccessorID,
+		"local":            created.Local,
+		"consul_namespace": created.Namespace,
+		"partition":        created.Partition,
+	}, map[string]interface{}{
+		"token":            created.SecretID,
+		"accessor":         created.AccessorID,
+		"consul_namespace": created.Namespace,
+		"partition":        created.Partition,
+	})
+	s.Secret.TTL = role.Lease
+
+	return s, nil
+}
+
+const pathTokenHelpSyn = `
+Generate a Consul ACL token from a specific role.
+`
+
+const pathTokenHelpDesc = `
+This path creates a Consul ACL token for a role. Tokens linked to Consul
+policies, roles or identities are returned with their accessor, namespace
+and partition. The token is deleted when the lease expires or is revoked.
+`
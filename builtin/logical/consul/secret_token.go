@@ -50,6 +50,22 @@ func secretTokenRevoke(
 		return nil, nil
 	}
 
+	// Tokens linked to Consul policies, roles or identities are deleted by
+	// accessor, from their namespace and partition
+	if accessorRaw, ok := req.Secret.InternalData["accessor"]; ok {
+		aclClient, userErr, intErr := newACLClient(req.Storage)
+		if intErr != nil {
+			return nil, intErr
+		}
+		if userErr != nil {
+			return nil, userErr
+		}
+
+		namespace, _ := req.Secret.InternalData["consul_namespace"].(string)
+		partition, _ := req.Secret.InternalData["partition"].(string)
+		return nil, aclClient.deleteToken(accessorRaw.(string), namespace, partition)
+	}
+
 	_, err := c.ACL().Destroy(tokenRaw.(string), nil)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,179 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/builtin/logical/database/plugins/cassandra"
+	"github.com/hashicorp/vault/builtin/logical/database/plugins/mssql"
+	"github.com/hashicorp/vault/builtin/logical/database/plugins/mysql"
+	"github.com/hashicorp/vault/builtin/logical/database/plugins/postgresql"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// builtinPlugins are the database plugins connections can use, by name
+var builtinPlugins = map[string]*dbplugin.Plugin{
+	"cassandra-database-plugin":  cassandra.Plugin,
+	"mssql-database-plugin":      mssql.Plugin,
+	"mysql-database-plugin":      mysql.Plugin,
+	"postgresql-database-plugin": postgresql.Plugin,
+}
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.plugins = builtinPlugins
+	b.connections = make(map[string]dbplugin.Database)
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathListConnections(&b),
+			pathConfigConnection(&b),
+			pathResetConnection(&b),
+			pathRotateRoot(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathCredsCreate(&b),
+			pathListStaticRoles(&b),
+			pathStaticRoles(&b),
+			pathStaticCreds(&b),
+			pathRotateRole(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretCreds(&b),
+		},
+
+		Clean:        b.closeAllDBs,
+		PeriodicFunc: b.periodicFunc,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	plugins map[string]*dbplugin.Plugin
+
+	// connections are the initialized databases of the configured
+	// connections, whose connection pools are reused across requests
+	connections map[string]dbplugin.Database
+	sync.RWMutex
+
+	// staticLock serializes the changes of static roles, so that their
+	// passwords are not rotated concurrently
+	staticLock sync.Mutex
+}
+
+// DB returns the initialized database of the named connection
+func (b *backend) DB(s logical.Storage, name string) (dbplugin.Database, error) {
+	b.RLock()
+	db, ok := b.connections[name]
+	b.RUnlock()
+	if ok {
+		return db, nil
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	// The database may have been initialized while waiting for the lock
+	if db, ok := b.connections[name]; ok {
+		return db, nil
+	}
+
+	config, err := b.DatabaseConfig(s, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("unknown connection: %s", name)
+	}
+
+	db, err = b.openDB(config, false)
+	if err != nil {
+		return nil, err
+	}
+	b.connections[name] = db
+	return db, nil
+}
+
+// openDB returns a database of the plugin of the connection, initialized
+// with its connection details
+func (b *backend) openDB(config *connectionConfig, verifyConnection bool) (dbplugin.Database, error) {
+	plugin, ok := b.plugins[config.PluginName]
+	if !ok {
+		return nil, fmt.Errorf("unknown plugin: %s", config.PluginName)
+	}
+
+	db, err := plugin.Open()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Initialize(config.ConnectionDetails, verifyConnection); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// closeDB closes the database of the named connection, if it is open. The
+// caller must hold the lock.
+func (b *backend) closeDB(name string) {
+	if db, ok := b.connections[name]; ok {
+		if err := db.Close(); err != nil {
+			b.Logger().Printf("[ERR] database: error closing connection %s: %s", name, err)
+		}
+		delete(b.connections, name)
+	}
+}
+
+// closeAllDBs closes the databases of all the connections when the backend
+// is unmounted
+func (b *backend) closeAllDBs() {
+	b.Lock()
+	defer b.Unlock()
+
+	for name := range b.connections {
+		b.closeDB(name)
+	}
+}
+
+// periodicFunc of the backend will be invoked once a minute by the
+// RollbackManager. It rotates the passwords of the static roles which are
+// due.
+func (b *backend) periodicFunc(req *logical.Request) error {
+	names, err := req.Storage.List("static-role/")
+	if err != nil {
+		return err
+	}
+
+	var result error
+	for _, name := range names {
+		if err := b.rotateStaticRoleIfDue(req.Storage, name); err != nil {
+			result = multierror.Append(result, errwrap.Wrapf(
+				fmt.Sprintf("failed to rotate the password of static role %s: {{err}}", name), err))
+		}
+	}
+	return result
+}
+
+const backendHelp = `
+The database backend dynamically generates database users.
+
+Connections to databases are configured under "config/", each with the plugin
+of the type of the database. Roles then hold the statements which create and
+revoke the users of a connection, and credentials are read from "creds/".
+Static roles manage the passwords of existing accounts instead, which are
+rotated periodically and read from "static-creds/".
+`
@@ -0,0 +1,532 @@
+package database
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+)
+
+// mockDatabase records the users it creates, and fails to initialize without
+// a connection_url
+type mockDatabase struct {
+	connectionURL string
+	username      string
+	password      string
+	closed        bool
+	users         map[string]time.Time
+	revoked       map[string]dbplugin.Statements
+	passwords     map[string]string
+	sync.Mutex
+}
+
+func (m *mockDatabase) Type() (string, error) {
+	return "mock", nil
+}
+
+func (m *mockDatabase) Initialize(config map[string]interface{}, verifyConnection bool) error {
+	m.Lock()
+	defer m.Unlock()
+
+	url, _ := config["connection_url"].(string)
+	if verifyConnection && url != "mock://ok" {
+		return fmt.Errorf("cannot connect to %q", url)
+	}
+	m.connectionURL = url
+	m.username, _ = config["username"].(string)
+	m.password, _ = config["password"].(string)
+	return nil
+}
+
+func (m *mockDatabase) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (string, string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if statements.CreationStatements == "" {
+		return "", "", fmt.Errorf("empty creation statements")
+	}
+	username, err := dbplugin.GenerateUsername(usernameConfig, 8, 8, 63)
+	if err != nil {
+		return "", "", err
+	}
+	m.users[username] = expiration
+	return username, "password", nil
+}
+
+func (m *mockDatabase) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.users[username]; !ok {
+		return fmt.Errorf("unknown user %s", username)
+	}
+	m.users[username] = expiration
+	return nil
+}
+
+func (m *mockDatabase) RevokeUser(statements dbplugin.Statements, username string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	delete(m.users, username)
+	m.revoked[username] = statements
+	return nil
+}
+
+func (m *mockDatabase) SetCredentials(statements dbplugin.Statements, username string, password string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if username == "missing" {
+		return fmt.Errorf("unknown user %s", username)
+	}
+	m.passwords[username] = password
+	return nil
+}
+
+func (m *mockDatabase) RotateRootCredentials(statements string) (string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.username == "" {
+		return "", fmt.Errorf("no username")
+	}
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return "", err
+	}
+	m.password = password
+	m.passwords[m.username] = password
+	return password, nil
+}
+
+func (m *mockDatabase) Close() error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.closed = true
+	return nil
+}
+
+// testBackend returns a backend whose plugins return mock databases, which
+// are appended to the returned slice as they are opened
+func testBackend(t *testing.T) (*backend, logical.Storage, *[]*mockDatabase) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+
+	var databases []*mockDatabase
+	newMock := func() (dbplugin.Database, error) {
+		db := &mockDatabase{
+			users:     make(map[string]time.Time),
+			revoked:   make(map[string]dbplugin.Statements),
+			passwords: make(map[string]string),
+		}
+		databases = append(databases, db)
+		return db, nil
+	}
+	b.plugins = map[string]*dbplugin.Plugin{
+		"mock-database-plugin": &dbplugin.Plugin{APIVersion: dbplugin.APIVersion, New: newMock},
+		"old-database-plugin":  &dbplugin.Plugin{APIVersion: dbplugin.APIVersion - 1, New: newMock},
+	}
+
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView, &databases
+}
+
+func testRequest(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(&logical.Request{
+		Operation:   op,
+		Path:        path,
+		Storage:     s,
+		Data:        data,
+		DisplayName: "token",
+	})
+}
+
+func testOK(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func testError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	resp, err := testRequest(b, s, op, path, data)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error: %s %s: resp: %#v", op, path, resp)
+	}
+}
+
+func TestBackend_config_connection(t *testing.T) {
+	b, s, databases := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":    "unknown-database-plugin",
+		"connection_url": "mock://ok",
+	})
+	testError(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":    "old-database-plugin",
+		"connection_url": "mock://ok",
+	})
+	testError(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":    "mock-database-plugin",
+		"connection_url": "mock://down",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":       "mock-database-plugin",
+		"connection_url":    "mock://down",
+		"verify_connection": false,
+	})
+
+	resp := testOK(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":          "mock-database-plugin",
+		"connection_url":       "mock://ok",
+		"max_open_connections": 5,
+		"allowed_roles":        "readonly,admin",
+	})
+	if len(resp.Warnings()) == 0 {
+		t.Fatal("expected warning")
+	}
+
+	// The database of the previous configuration is closed
+	if len(*databases) != 3 || !(*databases)[1].closed || (*databases)[2].closed {
+		t.Fatalf("bad: %#v", *databases)
+	}
+
+	resp = testOK(t, b, s, logical.ReadOperation, "config/mydb", nil)
+	details := resp.Data["connection_details"].(map[string]interface{})
+	if resp.Data["plugin_name"] != "mock-database-plugin" || details["connection_url"] != "mock://ok" ||
+		fmt.Sprint(details["max_open_connections"]) != "5" || len(details) != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if roles := resp.Data["allowed_roles"].([]string); len(roles) != 2 || roles[0] != "readonly" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testOK(t, b, s, logical.ListOperation, "config/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "mydb" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Resetting the connection reopens it
+	testOK(t, b, s, logical.UpdateOperation, "reset/mydb", nil)
+	if len(*databases) != 4 || !(*databases)[2].closed || (*databases)[3].connectionURL != "mock://ok" {
+		t.Fatalf("bad: %#v", *databases)
+	}
+
+	testOK(t, b, s, logical.DeleteOperation, "config/mydb", nil)
+	if !(*databases)[3].closed {
+		t.Fatal("expected the database to be closed")
+	}
+	testError(t, b, s, logical.UpdateOperation, "reset/mydb", nil)
+}
+
+func TestBackend_roles(t *testing.T) {
+	b, s, _ := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "roles/readonly", map[string]interface{}{
+		"creation_statements": "CREATE USER '{{name}}';",
+	})
+	testError(t, b, s, logical.UpdateOperation, "roles/readonly", map[string]interface{}{
+		"db_name":     "mydb",
+		"default_ttl": 600,
+		"max_ttl":     300,
+	})
+	testOK(t, b, s, logical.UpdateOperation, "roles/readonly", map[string]interface{}{
+		"db_name":               "mydb",
+		"creation_statements":   "CREATE USER '{{name}}';",
+		"revocation_statements": "DROP USER '{{name}}';",
+		"default_ttl":           "5m",
+		"max_ttl":               "1h",
+	})
+
+	resp := testOK(t, b, s, logical.ReadOperation, "roles/readonly", nil)
+	if resp.Data["db_name"] != "mydb" || resp.Data["creation_statements"] != "CREATE USER '{{name}}';" ||
+		resp.Data["default_ttl"] != int64(300) || resp.Data["max_ttl"] != int64(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testOK(t, b, s, logical.ListOperation, "roles/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "readonly" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testOK(t, b, s, logical.DeleteOperation, "roles/readonly", nil)
+	if resp := testOK(t, b, s, logical.ReadOperation, "roles/readonly", nil); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestBackend_creds(t *testing.T) {
+	b, s, databases := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":    "mock-database-plugin",
+		"connection_url": "mock://ok",
+		"allowed_roles":  "readonly",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "roles/readonly", map[string]interface{}{
+		"db_name":               "mydb",
+		"creation_statements":   "CREATE USER '{{name}}';",
+		"revocation_statements": "DROP USER '{{name}}';",
+		"default_ttl":           "5m",
+		"max_ttl":               "1h",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "roles/other", map[string]interface{}{
+		"db_name":             "mydb",
+		"creation_statements": "CREATE USER '{{name}}';",
+	})
+	db := (*databases)[0]
+
+	// Roles must be allowed by their connection
+	testError(t, b, s, logical.ReadOperation, "creds/other", nil)
+	testError(t, b, s, logical.ReadOperation, "creds/unknown", nil)
+
+	resp := testOK(t, b, s, logical.ReadOperation, "creds/readonly", nil)
+	username := resp.Data["username"].(string)
+	if resp.Data["password"] != "password" || resp.Secret.TTL != 5*time.Minute {
+		t.Fatalf("bad: %#v", resp)
+	}
+	expiration, ok := db.users[username]
+	if !ok {
+		t.Fatalf("user %s was not created", username)
+	}
+	if d := expiration.Sub(time.Now()); d < 4*time.Minute || d > 5*time.Minute {
+		t.Fatalf("bad expiration: %s", expiration)
+	}
+
+	// Renewing extends the expiration of the user
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	secret.Increment = 10 * time.Minute
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if d := db.users[username].Sub(time.Now()); d < 9*time.Minute || d > 10*time.Minute {
+		t.Fatalf("bad expiration: %s", db.users[username])
+	}
+
+	// Revoking drops the user with the statements of the role
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if _, ok := db.users[username]; ok {
+		t.Fatalf("user %s was not revoked", username)
+	}
+	if db.revoked[username].RevocationStatements != "DROP USER '{{name}}';" {
+		t.Fatalf("bad: %#v", db.revoked[username])
+	}
+
+	// Users of deleted roles are revoked with the default revocation
+	resp = testOK(t, b, s, logical.ReadOperation, "creds/readonly", nil)
+	username = resp.Data["username"].(string)
+	secret = resp.Secret
+	testOK(t, b, s, logical.DeleteOperation, "roles/readonly", nil)
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+	}
+	if _, ok := db.revoked[username]; !ok || db.revoked[username].RevocationStatements != "" {
+		t.Fatalf("bad: %#v", db.revoked)
+	}
+
+	// Unmounting closes the connections
+	b.Cleanup()
+	if !db.closed {
+		t.Fatal("expected the database to be closed")
+	}
+}
+
+func TestBackend_staticRoles(t *testing.T) {
+	b, s, databases := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":    "mock-database-plugin",
+		"connection_url": "mock://ok",
+		"allowed_roles":  "app,legacy,missing",
+	})
+	db := (*databases)[0]
+
+	testError(t, b, s, logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":  "mydb",
+		"username": "app",
+	})
+	testError(t, b, s, logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":         "mydb",
+		"username":        "app",
+		"rotation_period": 10,
+	})
+	testError(t, b, s, logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":           "mydb",
+		"username":          "app",
+		"rotation_schedule": "0 3 * *",
+	})
+	testError(t, b, s, logical.UpdateOperation, "static-roles/other", map[string]interface{}{
+		"db_name":         "mydb",
+		"username":        "other",
+		"rotation_period": "1h",
+	})
+	testError(t, b, s, logical.UpdateOperation, "static-roles/missing", map[string]interface{}{
+		"db_name":         "mydb",
+		"username":        "missing",
+		"rotation_period": "1h",
+	})
+	if resp := testOK(t, b, s, logical.ReadOperation, "static-roles/missing", nil); resp != nil {
+		t.Fatalf("a role whose password could not be set should not be stored: %#v", resp)
+	}
+
+	// The password is set when the role is created
+	testOK(t, b, s, logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"db_name":         "mydb",
+		"username":        "app",
+		"rotation_period": "1h",
+	})
+	resp := testOK(t, b, s, logical.ReadOperation, "static-creds/app", nil)
+	password := resp.Data["password"].(string)
+	if resp.Data["username"] != "app" || password == "" || db.passwords["app"] != password {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl < 3590 || ttl > 3600 {
+		t.Fatalf("bad ttl: %d", ttl)
+	}
+
+	resp = testOK(t, b, s, logical.ReadOperation, "static-roles/app", nil)
+	if resp.Data["rotation_period"] != int64(3600) || resp.Data["username"] != "app" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["password"]; ok {
+		t.Fatal("the password should not be returned")
+	}
+
+	// The account cannot be changed, but the rotation can
+	testError(t, b, s, logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"username": "other",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "static-roles/app", map[string]interface{}{
+		"rotation_schedule": "0 3 * * *",
+	})
+	resp = testOK(t, b, s, logical.ReadOperation, "static-creds/app", nil)
+	if resp.Data["password"] != password || resp.Data["rotation_schedule"] != "0 3 * * *" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Passwords can be rotated manually
+	testOK(t, b, s, logical.UpdateOperation, "rotate-role/app", nil)
+	resp = testOK(t, b, s, logical.ReadOperation, "static-creds/app", nil)
+	if resp.Data["password"] == password || db.passwords["app"] != resp.Data["password"] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	password = resp.Data["password"].(string)
+
+	testOK(t, b, s, logical.UpdateOperation, "static-roles/legacy", map[string]interface{}{
+		"db_name":         "mydb",
+		"username":        "legacy",
+		"rotation_period": "1h",
+	})
+	legacyPassword := db.passwords["legacy"]
+
+	// The periodic function rotates the passwords which are due
+	if err := b.periodicFunc(&logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	if db.passwords["app"] != password || db.passwords["legacy"] != legacyPassword {
+		t.Fatal("passwords should not be rotated before they are due")
+	}
+
+	for _, name := range []string{"app", "legacy"} {
+		role, err := b.StaticRole(s, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		role.LastVaultRotation = role.LastVaultRotation.Add(-25 * time.Hour)
+		if err := b.putStaticRole(s, name, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.periodicFunc(&logical.Request{Storage: s}); err != nil {
+		t.Fatal(err)
+	}
+	if db.passwords["app"] == password || db.passwords["legacy"] == legacyPassword {
+		t.Fatal("passwords should be rotated when they are due")
+	}
+
+	resp = testOK(t, b, s, logical.ListOperation, "static-roles/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 2 || keys[0] != "app" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testOK(t, b, s, logical.DeleteOperation, "static-roles/app", nil)
+	testError(t, b, s, logical.ReadOperation, "static-creds/app", nil)
+	testError(t, b, s, logical.UpdateOperation, "rotate-role/app", nil)
+}
+
+func TestBackend_rotateRoot(t *testing.T) {
+	b, s, databases := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "rotate-root/mydb", nil)
+
+	testOK(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":    "mock-database-plugin",
+		"connection_url": "mock://ok",
+	})
+	testError(t, b, s, logical.UpdateOperation, "rotate-root/mydb", nil)
+
+	testOK(t, b, s, logical.UpdateOperation, "config/mydb", map[string]interface{}{
+		"plugin_name":              "mock-database-plugin",
+		"connection_url":           "mock://ok",
+		"username":                 "vault",
+		"password":                 "initial",
+		"root_rotation_statements": "ALTER USER {{name}} PASSWORD '{{password}}';",
+	})
+
+	// The password is not returned
+	resp := testOK(t, b, s, logical.ReadOperation, "config/mydb", nil)
+	details := resp.Data["connection_details"].(map[string]interface{})
+	if _, ok := details["password"]; ok || details["username"] != "vault" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["root_rotation_statements"] != "ALTER USER {{name}} PASSWORD '{{password}}';" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testOK(t, b, s, logical.UpdateOperation, "rotate-root/mydb", nil)
+	db := (*databases)[len(*databases)-1]
+	password := db.passwords["vault"]
+	if password == "" || password == "initial" || db.password != password {
+		t.Fatalf("bad: %#v", db)
+	}
+
+	// The new password is stored, and used when reconnecting
+	config, err := b.DatabaseConfig(s, "mydb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ConnectionDetails["password"] != password {
+		t.Fatalf("bad: %#v", config.ConnectionDetails)
+	}
+	testOK(t, b, s, logical.UpdateOperation, "reset/mydb", nil)
+	if db := (*databases)[len(*databases)-1]; db.password != password {
+		t.Fatalf("bad: %#v", db)
+	}
+}
@@ -0,0 +1,44 @@
+package dbplugin
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+// GenerateUsername returns a unique username of the form
+// "v-<display name>-<role name>-<random>-<timestamp>", whose names are
+// truncated to the given lengths and whose whole is truncated to maxLength
+func GenerateUsername(config UsernameConfig, displayNameLength, roleNameLength, maxLength int) (string, error) {
+	displayName := config.DisplayName
+	if len(displayName) > displayNameLength {
+		displayName = displayName[:displayNameLength]
+	}
+	roleName := config.RoleName
+	if len(roleName) > roleNameLength {
+		roleName = roleName[:roleNameLength]
+	}
+
+	userUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+
+	username := fmt.Sprintf("v-%s-%s-%s-%d", displayName, roleName, userUUID, time.Now().Unix())
+	if len(username) > maxLength {
+		username = username[:maxLength]
+	}
+	return username, nil
+}
+
+// GeneratePassword returns a random password. It starts with characters of
+// every class, so that it satisfies the password policies of databases
+// which require them.
+func GeneratePassword() (string, error) {
+	password, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	return "A1a-" + password, nil
+}
@@ -0,0 +1,94 @@
+// Package dbplugin defines the interface between the database backend and
+// the plugins which manage the users of each type of database.
+package dbplugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// APIVersion is the version of the Database interface. The backend refuses
+// plugins which implement another version, so that changes of the interface
+// cannot be mistaken for compatible ones.
+const APIVersion = 3
+
+// Database is implemented by database plugins. A Database is initialized
+// once with the connection details of a configured connection, and is used
+// concurrently until it is closed.
+type Database interface {
+	// Type returns the type of the database, such as "mysql"
+	Type() (string, error)
+
+	// Initialize parses the connection details and, if verifyConnection is
+	// true, connects to the database to check them
+	Initialize(config map[string]interface{}, verifyConnection bool) error
+
+	// CreateUser creates a user with the creation statements, whose
+	// credentials expire at the given time if the database supports it
+	CreateUser(statements Statements, usernameConfig UsernameConfig, expiration time.Time) (username string, password string, err error)
+
+	// RenewUser extends the expiration of a user
+	RenewUser(statements Statements, username string, expiration time.Time) error
+
+	// RevokeUser deletes a user, with the default revocation of the plugin
+	// if there are no revocation statements
+	RevokeUser(statements Statements, username string) error
+
+	// SetCredentials sets the password of an existing user, with the
+	// rotation statements or the default ones of the plugin
+	SetCredentials(statements Statements, username string, password string) error
+
+	// RotateRootCredentials sets a generated password for the user the
+	// plugin connects as, with the given rotation statements or the default
+	// ones of the plugin, connects with it from then on and returns it
+	RotateRootCredentials(statements string) (password string, err error)
+
+	// Close closes the connections of the plugin
+	Close() error
+}
+
+// Statements are the statements of a role, separated by semicolons. They are
+// templates of the "{{name}}", "{{password}}" and "{{expiration}}" values.
+type Statements struct {
+	CreationStatements   string `json:"creation_statements" mapstructure:"creation_statements" structs:"creation_statements"`
+	RevocationStatements string `json:"revocation_statements" mapstructure:"revocation_statements" structs:"revocation_statements"`
+	RollbackStatements   string `json:"rollback_statements" mapstructure:"rollback_statements" structs:"rollback_statements"`
+	RenewStatements      string `json:"renew_statements" mapstructure:"renew_statements" structs:"renew_statements"`
+	RotationStatements   string `json:"rotation_statements" mapstructure:"rotation_statements" structs:"rotation_statements"`
+}
+
+// UsernameConfig holds the names plugins include in the usernames they
+// generate, so that users can be traced back to their roles and tokens
+type UsernameConfig struct {
+	DisplayName string
+	RoleName    string
+}
+
+// Plugin describes a database plugin
+type Plugin struct {
+	// APIVersion is the version of the Database interface the plugin
+	// implements
+	APIVersion int
+
+	// New returns a Database, to be initialized
+	New func() (Database, error)
+}
+
+// Open returns a new Database of the plugin, if it implements the current
+// version of the interface
+func (p *Plugin) Open() (Database, error) {
+	if p.APIVersion != APIVersion {
+		return nil, fmt.Errorf("incompatible plugin API version %d, expected %d", p.APIVersion, APIVersion)
+	}
+	return p.New()
+}
+
+// Query templates a statement with the given values
+func Query(tpl string, data map[string]string) string {
+	for k, v := range data {
+		tpl = strings.Replace(tpl, fmt.Sprintf("{{%s}}", k), v, -1)
+	}
+
+	return tpl
+}
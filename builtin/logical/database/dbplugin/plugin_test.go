@@ -0,0 +1,132 @@
+package dbplugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlugin_Open(t *testing.T) {
+	newDB := func() (Database, error) {
+		return nil, nil
+	}
+	if _, err := (&Plugin{APIVersion: APIVersion, New: newDB}).Open(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&Plugin{APIVersion: APIVersion + 1, New: newDB}).Open(); err == nil {
+		t.Fatal("expected an error for an incompatible plugin")
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	expected := []string{"CREATE USER '{{name}}'", "GRANT SELECT ON *.* TO '{{name}}'"}
+	for _, statements := range []string{
+		"CREATE USER '{{name}}'; GRANT SELECT ON *.* TO '{{name}}';\n",
+		`["CREATE USER '{{name}}'", "GRANT SELECT ON *.* TO '{{name}}'"]`,
+	} {
+		if result := SplitStatements(statements); !reflect.DeepEqual(result, expected) {
+			t.Fatalf("bad: %#v", result)
+		}
+	}
+
+	query := Query(expected[0], map[string]string{"name": "vault"})
+	if query != "CREATE USER 'vault'" {
+		t.Fatalf("bad: %s", query)
+	}
+}
+
+func TestGenerateUsername(t *testing.T) {
+	username, err := GenerateUsername(UsernameConfig{
+		DisplayName: "token-display-name",
+		RoleName:    "readonly",
+	}, 4, 4, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(username) != 16 || !strings.HasPrefix(username, "v-toke-read-") {
+		t.Fatalf("bad: %s", username)
+	}
+
+	other, err := GenerateUsername(UsernameConfig{}, 4, 4, 63)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(other, "v---") {
+		t.Fatalf("bad: %s", other)
+	}
+}
+
+func TestSQLConnectionProducer_Initialize(t *testing.T) {
+	c := &SQLConnectionProducer{DriverName: "unknown"}
+	if err := c.Initialize(map[string]interface{}{}, false); err == nil {
+		t.Fatal("expected an error without connection_url")
+	}
+
+	err := c.Initialize(map[string]interface{}{
+		"connection_url":          "user:password@tcp(localhost:3306)/",
+		"max_open_connections":    json.Number("4"),
+		"max_idle_connections":    "8",
+		"max_connection_lifetime": "30m",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.MaxOpenConnections != 4 || c.MaxIdleConnections != 4 || c.maxConnectionLifetime != 30*time.Minute {
+		t.Fatalf("bad: %#v", c)
+	}
+
+	for raw, expected := range map[interface{}]time.Duration{
+		nil:          0,
+		"":           0,
+		"60":         time.Minute,
+		float64(120): 2 * time.Minute,
+	} {
+		if d, err := parseDuration(raw); err != nil || d != expected {
+			t.Fatalf("%#v: expected %s, got %s (%v)", raw, expected, d, err)
+		}
+	}
+	if _, err := parseDuration("soon"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSQLConnectionProducer_RotateRoot(t *testing.T) {
+	c := &SQLConnectionProducer{DriverName: "unknown"}
+	err := c.Initialize(map[string]interface{}{
+		"connection_url": "user:password@tcp(localhost:3306)/",
+		"username":       "user",
+		"password":       "password",
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var set string
+	setCredentials := func(username, password string) error {
+		if username != "user" {
+			return fmt.Errorf("unknown user %s", username)
+		}
+		set = password
+		return nil
+	}
+
+	// The password cannot change unless the connection URL is a template
+	if _, err := c.RotateRoot(setCredentials); err == nil || set != "" {
+		t.Fatal("expected an error without a templated connection_url")
+	}
+
+	c.ConnectionURL = "{{username}}:{{password}}@tcp(localhost:3306)/"
+	if _, err := c.RotateRoot(func(string, string) error { return fmt.Errorf("denied") }); err == nil || c.Password != "password" {
+		t.Fatalf("expected an error and the previous password: %#v", c)
+	}
+	password, err := c.RotateRoot(setCredentials)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password == "password" || password != set || c.Password != password {
+		t.Fatalf("bad: %s %s %#v", password, set, c)
+	}
+}
@@ -0,0 +1,198 @@
+package dbplugin
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+// SQLConnectionProducer manages the pool of connections of the plugins of
+// SQL databases. It is configured with the "connection_url", "username",
+// "password", "max_open_connections", "max_idle_connections" and
+// "max_connection_lifetime" connection details. The connection URL is a
+// template of the "{{username}}" and "{{password}}" values, so that the
+// password can be rotated.
+type SQLConnectionProducer struct {
+	ConnectionURL            string      `json:"connection_url" mapstructure:"connection_url" structs:"connection_url"`
+	Username                 string      `json:"username" mapstructure:"username" structs:"username"`
+	Password                 string      `json:"password" mapstructure:"password" structs:"password"`
+	MaxOpenConnections       int         `json:"max_open_connections" mapstructure:"max_open_connections" structs:"max_open_connections"`
+	MaxIdleConnections       int         `json:"max_idle_connections" mapstructure:"max_idle_connections" structs:"max_idle_connections"`
+	MaxConnectionLifetimeRaw interface{} `json:"max_connection_lifetime" mapstructure:"max_connection_lifetime" structs:"max_connection_lifetime"`
+
+	// DriverName is the name of the database/sql driver of the database
+	DriverName string `json:"-" mapstructure:"-" structs:"-"`
+
+	maxConnectionLifetime time.Duration
+	db                    *sql.DB
+	sync.Mutex
+}
+
+// Initialize parses the connection details, and checks them by connecting
+// to the database if verifyConnection is true
+func (c *SQLConnectionProducer) Initialize(config map[string]interface{}, verifyConnection bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if err := mapstructure.WeakDecode(config, c); err != nil {
+		return err
+	}
+
+	if c.ConnectionURL == "" {
+		return fmt.Errorf("connection_url cannot be empty")
+	}
+
+	if c.MaxOpenConnections == 0 {
+		c.MaxOpenConnections = 2
+	}
+	if c.MaxIdleConnections == 0 {
+		c.MaxIdleConnections = c.MaxOpenConnections
+	}
+	if c.MaxIdleConnections > c.MaxOpenConnections {
+		c.MaxIdleConnections = c.MaxOpenConnections
+	}
+
+	var err error
+	if c.maxConnectionLifetime, err = parseDuration(c.MaxConnectionLifetimeRaw); err != nil {
+		return fmt.Errorf("invalid max_connection_lifetime: %s", err)
+	}
+
+	if verifyConnection {
+		db, err := c.connection()
+		if err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+		if err := db.Ping(); err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Connection returns the pool of connections to the database
+func (c *SQLConnectionProducer) Connection() (*sql.DB, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.connection()
+}
+
+func (c *SQLConnectionProducer) connection() (*sql.DB, error) {
+	// If we already have a DB, test it and return
+	if c.db != nil {
+		if err := c.db.Ping(); err == nil {
+			return c.db, nil
+		}
+		// If the ping was unsuccessful, close it and ignore errors as we'll be
+		// reestablishing anyways
+		c.db.Close()
+		c.db = nil
+	}
+
+	db, err := sql.Open(c.DriverName, Query(c.ConnectionURL, map[string]string{
+		"username": c.Username,
+		"password": c.Password,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	// The request rate of the backend is low, so few connections are kept
+	db.SetMaxOpenConns(c.MaxOpenConnections)
+	db.SetMaxIdleConns(c.MaxIdleConnections)
+	db.SetConnMaxLifetime(c.maxConnectionLifetime)
+
+	c.db = db
+	return c.db, nil
+}
+
+// Close closes the connections to the database
+func (c *SQLConnectionProducer) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.db != nil {
+		c.db.Close()
+	}
+	c.db = nil
+	return nil
+}
+
+// RotateRoot sets a generated password for the user of the connection with
+// setCredentials, and connects with it from then on. The password can only
+// be rotated if it is given as the "password" connection detail and
+// templated in the connection URL.
+func (c *SQLConnectionProducer) RotateRoot(setCredentials func(username, password string) error) (string, error) {
+	c.Lock()
+	username := c.Username
+	templated := strings.Contains(c.ConnectionURL, "{{password}}")
+	c.Unlock()
+
+	if username == "" || !templated {
+		return "", fmt.Errorf("the root credentials can only be rotated if username is set and connection_url is a template of {{password}}")
+	}
+
+	password, err := GeneratePassword()
+	if err != nil {
+		return "", err
+	}
+	if err := setCredentials(username, password); err != nil {
+		return "", err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// The connections were opened with the previous password
+	c.Password = password
+	if c.db != nil {
+		c.db.Close()
+	}
+	c.db = nil
+	return password, nil
+}
+
+// SplitStatements returns the non-empty statements of a string of
+// statements separated by semicolons
+func SplitStatements(statements string) []string {
+	var result []string
+	for _, statement := range strutil.ParseArbitraryStringSlice(statements, ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			result = append(result, statement)
+		}
+	}
+	return result
+}
+
+// parseDuration parses a duration given either as a string such as "30m",
+// or as a number of seconds
+func parseDuration(raw interface{}) (time.Duration, error) {
+	switch v := raw.(type) {
+	case nil:
+		return 0, nil
+	case string:
+		if v == "" {
+			return 0, nil
+		}
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, nil
+		}
+		var seconds int
+		if err := mapstructure.WeakDecode(v, &seconds); err != nil {
+			return 0, fmt.Errorf("%q is not a duration", v)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	default:
+		var seconds int
+		if err := mapstructure.WeakDecode(v, &seconds); err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+}
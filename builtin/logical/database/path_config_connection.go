@@ -0,0 +1,284 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// connectionConfig is the configuration of a connection to a database
+type connectionConfig struct {
+	PluginName string `json:"plugin_name" structs:"plugin_name" mapstructure:"plugin_name"`
+
+	// ConnectionDetails are the parameters of the connection, which are
+	// specific to the plugin
+	ConnectionDetails map[string]interface{} `json:"connection_details" structs:"connection_details" mapstructure:"connection_details"`
+
+	// AllowedRoles are the roles which can use the connection; "*" allows
+	// all roles
+	AllowedRoles []string `json:"allowed_roles" structs:"allowed_roles" mapstructure:"allowed_roles"`
+
+	// RootRotationStatements set the password of the user of the
+	// connection; the plugin defaults are used if empty
+	RootRotationStatements string `json:"root_rotation_statements" structs:"root_rotation_statements" mapstructure:"root_rotation_statements"`
+}
+
+func pathListConnections(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathConnectionList,
+		},
+
+		HelpSynopsis:    pathConfigConnectionHelpSyn,
+		HelpDescription: pathConfigConnectionHelpDesc,
+	}
+}
+
+func pathConfigConnection(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of this connection.",
+			},
+
+			"plugin_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The name of the database plugin of this connection,
+such as "mysql-database-plugin".`,
+			},
+
+			"verify_connection": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Default:     true,
+				Description: "If set, the connection details are verified by actually connecting to the database.",
+			},
+
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma separated list of the roles which can use
+this connection, or "*" to allow all roles. No role is allowed by default.`,
+			},
+
+			"root_rotation_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Statements to be executed to rotate the password
+of the user of the connection, separated by semicolons. The '{{name}}' and
+'{{password}}' values will be substituted. The defaults of the plugin are
+used if not set.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathConnectionWrite,
+			logical.ReadOperation:   b.pathConnectionRead,
+			logical.DeleteOperation: b.pathConnectionDelete,
+		},
+
+		HelpSynopsis:    pathConfigConnectionHelpSyn,
+		HelpDescription: pathConfigConnectionHelpDesc,
+	}
+}
+
+func pathResetConnection(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "reset/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of this connection.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathConnectionReset,
+		},
+
+		HelpSynopsis:    pathResetConnectionHelpSyn,
+		HelpDescription: pathResetConnectionHelpDesc,
+	}
+}
+
+// DatabaseConfig returns the configuration of the named connection
+func (b *backend) DatabaseConfig(s logical.Storage, name string) (*connectionConfig, error) {
+	entry, err := s.Get("config/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var config connectionConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func (b *backend) pathConnectionList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("config/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathConnectionRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.DatabaseConfig(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The password is never returned, so that it stays unknown once rotated
+	details := make(map[string]interface{}, len(config.ConnectionDetails))
+	for k, v := range config.ConnectionDetails {
+		if k != "password" {
+			details[k] = v
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"plugin_name":              config.PluginName,
+			"connection_details":       details,
+			"allowed_roles":            config.AllowedRoles,
+			"root_rotation_statements": config.RootRotationStatements,
+		},
+	}, nil
+}
+
+func (b *backend) pathConnectionWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("empty name"), nil
+	}
+
+	config := &connectionConfig{
+		PluginName:             data.Get("plugin_name").(string),
+		AllowedRoles:           data.Get("allowed_roles").([]string),
+		RootRotationStatements: data.Get("root_rotation_statements").(string),
+	}
+	if config.PluginName == "" {
+		return logical.ErrorResponse("plugin_name is required"), nil
+	}
+
+	// The other parameters are the connection details of the plugin
+	config.ConnectionDetails = make(map[string]interface{})
+	for k, v := range req.Data {
+		if _, ok := data.Schema[k]; !ok {
+			config.ConnectionDetails[k] = v
+		}
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	db, err := b.openDB(config, data.Get("verify_connection").(bool))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error creating database object: %s", err)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config/"+name, config)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	// The new database replaces the one of the previous configuration
+	b.closeDB(name)
+	b.connections[name] = db
+
+	resp := &logical.Response{}
+	resp.AddWarning("Read access to this endpoint should be controlled via ACLs as it will return the connection details as is, including passwords in connection URLs, if any. Passwords given as the password parameter are not returned.")
+
+	return resp, nil
+}
+
+func (b *backend) pathConnectionDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	if err := req.Storage.Delete("config/" + name); err != nil {
+		return nil, err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.closeDB(name)
+
+	return nil, nil
+}
+
+// pathConnectionReset closes the connections to the database, so that they
+// are reestablished with the stored configuration
+func (b *backend) pathConnectionReset(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.Lock()
+	b.closeDB(name)
+	b.Unlock()
+
+	if _, err := b.DB(req.Storage, name); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return nil, nil
+}
+
+// roleAllowed returns whether the connection can be used by the role
+func (c *connectionConfig) roleAllowed(role string) bool {
+	return strutil.StrListContains(c.AllowedRoles, "*") || strutil.StrListContains(c.AllowedRoles, role)
+}
+
+const pathConfigConnectionHelpSyn = `
+Configure connections to databases.
+`
+
+const pathConfigConnectionHelpDesc = `
+This path configures the connections to databases. Each connection uses a
+database plugin, given by "plugin_name":
+
+  * "cassandra-database-plugin", whose connection details are "hosts",
+    "username", "password", "tls", "insecure_tls", "tls_min_version",
+    "pem_bundle", "pem_json", "protocol_version" and "connect_timeout".
+
+  * "mssql-database-plugin", "mysql-database-plugin" and
+    "postgresql-database-plugin", whose connection details are
+    "connection_url", "username", "password", "max_open_connections",
+    "max_idle_connections" and "max_connection_lifetime". The connection URL
+    can be a template of the "{{username}}" and "{{password}}" values.
+
+The connection details are given as additional parameters. Unless
+"verify_connection" is false, they are verified by connecting to the
+database. The "password" connection detail is not returned when reading the
+connection; it can be rotated by Vault with the "rotate-root" endpoint.
+
+Roles can only use the connections which list them in "allowed_roles".
+`
+
+const pathResetConnectionHelpSyn = `
+Reset the connections to a database.
+`
+
+const pathResetConnectionHelpDesc = `
+This path closes the connections to a database, and reopens them with the
+stored configuration.
+`
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathCredsCreate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsCreateRead,
+		},
+
+		HelpSynopsis:    pathCredsCreateReadHelpSyn,
+		HelpDescription: pathCredsCreateReadHelpDesc,
+	}
+}
+
+func (b *backend) pathCredsCreateRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	// Get the role
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", name)), nil
+	}
+
+	config, err := b.DatabaseConfig(req.Storage, role.DBName)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown connection: %s", role.DBName)), nil
+	}
+	if !config.roleAllowed(name) {
+		return logical.ErrorResponse(fmt.Sprintf("%s is not an allowed role", name)), nil
+	}
+
+	db, err := b.DB(req.Storage, role.DBName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users expire with their lease, for the databases which support it
+	ttl := role.DefaultTTL
+	if ttl == 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+	expiration := time.Now().Add(ttl)
+
+	username, password, err := db.CreateUser(role.Statements, dbplugin.UsernameConfig{
+		DisplayName: req.DisplayName,
+		RoleName:    name,
+	}, expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := b.Secret(SecretCredsType).Response(map[string]interface{}{
+		"username": username,
+		"password": password,
+	}, map[string]interface{}{
+		"username": username,
+		"role":     name,
+		"db_name":  role.DBName,
+	})
+	resp.Secret.TTL = role.DefaultTTL
+	return resp, nil
+}
+
+const pathCredsCreateReadHelpSyn = `
+Request database credentials for a certain role.
+`
+
+const pathCredsCreateReadHelpDesc = `
+This path reads database credentials for a certain role. The
+database credentials will be generated on demand and will be automatically
+revoked when the lease is up.
+`
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+type roleEntry struct {
+	DBName     string              `json:"db_name" mapstructure:"db_name"`
+	Statements dbplugin.Statements `json:"statements" mapstructure:"statements"`
+	DefaultTTL time.Duration       `json:"default_ttl" mapstructure:"default_ttl"`
+	MaxTTL     time.Duration       `json:"max_ttl" mapstructure:"max_ttl"`
+}
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+
+			"db_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the connection this role uses.",
+			},
+
+			"creation_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Statements to be executed to create a user. Must be
+a semicolon-separated string, a base64-encoded semicolon-separated string, a
+serialized JSON string array, or a base64-encoded serialized JSON string
+array. The '{{name}}', '{{password}}' and '{{expiration}}' values will be
+substituted.`,
+			},
+
+			"revocation_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Statements to be executed to revoke a user, in the
+same format as creation_statements. The '{{name}}' value will be substituted.
+The plugin revokes users its own way if empty.`,
+			},
+
+			"rollback_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Statements to be executed to roll back a failed
+creation, for databases without transactions, in the same format as
+creation_statements. The '{{name}}' and '{{password}}' values will be
+substituted.`,
+			},
+
+			"renew_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Statements to be executed to renew a user, in the
+same format as creation_statements. The '{{name}}' and '{{expiration}}'
+values will be substituted.`,
+			},
+
+			"default_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default TTL for the credentials of the role.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum TTL for the credentials of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.UpdateOperation: b.pathRoleCreate,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRoleHelpSyn,
+		HelpDescription: pathRoleHelpDesc,
+	}
+}
+
+func (b *backend) Role(s logical.Storage, n string) (*roleEntry, error) {
+	entry, err := s.Get("role/" + n)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	err := req.Storage.Delete("role/" + data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.Role(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"db_name":               role.DBName,
+			"creation_statements":   role.Statements.CreationStatements,
+			"revocation_statements": role.Statements.RevocationStatements,
+			"rollback_statements":   role.Statements.RollbackStatements,
+			"renew_statements":      role.Statements.RenewStatements,
+			"default_ttl":           int64(role.DefaultTTL / time.Second),
+			"max_ttl":               int64(role.MaxTTL / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	if name == "" {
+		return logical.ErrorResponse("empty role name attribute given"), nil
+	}
+
+	dbName := data.Get("db_name").(string)
+	if dbName == "" {
+		return logical.ErrorResponse("empty database name attribute given"), nil
+	}
+
+	role := &roleEntry{
+		DBName: dbName,
+		Statements: dbplugin.Statements{
+			CreationStatements:   data.Get("creation_statements").(string),
+			RevocationStatements: data.Get("revocation_statements").(string),
+			RollbackStatements:   data.Get("rollback_statements").(string),
+			RenewStatements:      data.Get("renew_statements").(string),
+		},
+		DefaultTTL: time.Duration(data.Get("default_ttl").(int)) * time.Second,
+		MaxTTL:     time.Duration(data.Get("max_ttl").(int)) * time.Second,
+	}
+	if role.MaxTTL != 0 && role.DefaultTTL > role.MaxTTL {
+		return logical.ErrorResponse("default_ttl cannot be greater than max_ttl"), nil
+	}
+
+	// Store it
+	entry, err := logical.StorageEntryJSON("role/"+name, role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathRoleHelpSyn = `
+Manage the roles that can be created with this backend.
+`
+
+const pathRoleHelpDesc = `
+This path lets you manage the roles that can be created with this backend.
+
+The "db_name" parameter is the connection the users of the role are created
+in, which must allow the role. The "creation_statements" parameter customizes
+the statements used to create the users. Some substitution will be done to
+the statements for certain keys. The names of the variables must be
+surrounded by "{{" and "}}" to be replaced.
+
+  * "name" - The random username generated for the DB user.
+
+  * "password" - The random password generated for the DB user.
+
+  * "expiration" - The timestamp when this user will expire.
+
+Example of a decent creation statement for the PostgreSQL plugin:
+
+	CREATE ROLE "{{name}}" WITH
+	  LOGIN
+	  PASSWORD '{{password}}'
+	  VALID UNTIL '{{expiration}}';
+	GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO "{{name}}";
+
+Note the above user would be able to access everything in schema public.
+For more complex GRANT clauses, see the PostgreSQL manual.
+
+The "revocation_statements", "rollback_statements" and "renew_statements"
+parameters customize the revocation, failed creation and renewal of users;
+the plugins have defaults suited to their databases.
+`
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathRotateRoot(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-root/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of this connection.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRootUpdate,
+		},
+
+		HelpSynopsis:    pathRotateRootHelpSyn,
+		HelpDescription: pathRotateRootHelpDesc,
+	}
+}
+
+func (b *backend) pathRotateRootUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	// The connection is locked for the whole rotation, so that it is
+	// neither used with the previous password nor reconfigured meanwhile
+	b.Lock()
+	defer b.Unlock()
+
+	config, err := b.DatabaseConfig(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown connection: %s", name)), nil
+	}
+
+	db, ok := b.connections[name]
+	if !ok {
+		if db, err = b.openDB(config, false); err != nil {
+			return nil, err
+		}
+		b.connections[name] = db
+	}
+
+	password, err := db.RotateRootCredentials(config.RootRotationStatements)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error rotating the root credentials: %s", err)), nil
+	}
+
+	if config.ConnectionDetails == nil {
+		config.ConnectionDetails = make(map[string]interface{})
+	}
+	config.ConnectionDetails["password"] = password
+	entry, err := logical.StorageEntryJSON("config/"+name, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		// The open database keeps working with the new password, but the
+		// connection will fail once it is reopened
+		return nil, fmt.Errorf("the root password was rotated but could not be stored: %s", err)
+	}
+
+	return nil, nil
+}
+
+const pathRotateRootHelpSyn = `
+Rotate the password of the user of a connection.
+`
+
+const pathRotateRootHelpDesc = `
+This path sets a password generated by Vault for the user a connection
+connects as, with the "root_rotation_statements" of the connection or the
+default statements of its plugin, and stores it in place of the previous
+one. The password is never returned, so that only Vault knows it.
+
+The user must be given by the "username" and "password" connection details;
+for SQL databases, the connection URL must be a template of them.
+`
@@ -0,0 +1,444 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/cronutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// minRotationPeriod is the shortest rotation period of static roles, since
+// they are rotated by the periodic function of the backend, once a minute
+const minRotationPeriod = time.Minute
+
+// staticRoleEntry is a static role, which manages the password of an
+// existing account of a database
+type staticRoleEntry struct {
+	DBName             string        `json:"db_name"`
+	Username           string        `json:"username"`
+	Password           string        `json:"password"`
+	RotationStatements string        `json:"rotation_statements"`
+	RotationPeriod     time.Duration `json:"rotation_period"`
+	RotationSchedule   string        `json:"rotation_schedule"`
+	LastVaultRotation  time.Time     `json:"last_vault_rotation"`
+}
+
+// nextRotation returns when the password is due to be rotated
+func (r *staticRoleEntry) nextRotation() (time.Time, error) {
+	if r.RotationSchedule == "" {
+		return r.LastVaultRotation.Add(r.RotationPeriod), nil
+	}
+
+	schedule, err := cronutil.Parse(r.RotationSchedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := schedule.Next(r.LastVaultRotation)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("rotation_schedule %q never runs", r.RotationSchedule)
+	}
+	return next, nil
+}
+
+func pathListStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticRoleList,
+		},
+
+		HelpSynopsis:    pathStaticRoleHelpSyn,
+		HelpDescription: pathStaticRoleHelpDesc,
+	}
+}
+
+func pathStaticRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+
+			"db_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the connection this role uses.",
+			},
+
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the existing database account whose password is managed.",
+			},
+
+			"rotation_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `Period after which the password is rotated, of at
+least a minute. Either rotation_period or rotation_schedule is required.`,
+			},
+
+			"rotation_schedule": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Cron schedule of the rotations of the password, in
+UTC, such as "0 3 * * *". Either rotation_period or rotation_schedule is
+required.`,
+			},
+
+			"rotation_statements": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Statements to be executed to set the password, in
+the same format as the creation_statements of roles. The '{{name}}' and
+'{{password}}' values will be substituted. The plugin sets passwords its own
+way if empty.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticRoleRead,
+			logical.UpdateOperation: b.pathStaticRoleCreate,
+			logical.DeleteOperation: b.pathStaticRoleDelete,
+		},
+
+		HelpSynopsis:    pathStaticRoleHelpSyn,
+		HelpDescription: pathStaticRoleHelpDesc,
+	}
+}
+
+func pathStaticCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathStaticCredsRead,
+		},
+
+		HelpSynopsis:    pathStaticCredsHelpSyn,
+		HelpDescription: pathStaticCredsHelpDesc,
+	}
+}
+
+func pathRotateRole(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "rotate-role/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRotateRole,
+		},
+
+		HelpSynopsis:    pathRotateRoleHelpSyn,
+		HelpDescription: pathRotateRoleHelpDesc,
+	}
+}
+
+func (b *backend) StaticRole(s logical.Storage, n string) (*staticRoleEntry, error) {
+	entry, err := s.Get("static-role/" + n)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result staticRoleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) putStaticRole(s logical.Storage, n string, role *staticRoleEntry) error {
+	entry, err := logical.StorageEntryJSON("static-role/"+n, role)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func (b *backend) pathStaticRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("static-role/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticRoleRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	role, err := b.StaticRole(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	// The password is only returned by static-creds
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"db_name":             role.DBName,
+			"username":            role.Username,
+			"rotation_period":     int64(role.RotationPeriod / time.Second),
+			"rotation_schedule":   role.RotationSchedule,
+			"rotation_statements": role.RotationStatements,
+			"last_vault_rotation": role.LastVaultRotation.Format(time.RFC3339),
+		},
+	}, nil
+}
+
+func (b *backend) pathStaticRoleDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.staticLock.Lock()
+	defer b.staticLock.Unlock()
+
+	err := req.Storage.Delete("static-role/" + data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticRoleCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.staticLock.Lock()
+	defer b.staticLock.Unlock()
+
+	role, err := b.StaticRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The account of existing roles cannot be changed, as its password is
+	// managed by Vault
+	dbName := data.Get("db_name").(string)
+	username := data.Get("username").(string)
+	if role != nil {
+		if (dbName != "" && dbName != role.DBName) || (username != "" && username != role.Username) {
+			return logical.ErrorResponse("db_name and username of existing static roles cannot be changed"), nil
+		}
+	} else {
+		if dbName == "" {
+			return logical.ErrorResponse("empty database name attribute given"), nil
+		}
+		if username == "" {
+			return logical.ErrorResponse("empty username attribute given"), nil
+		}
+		role = &staticRoleEntry{
+			DBName:   dbName,
+			Username: username,
+		}
+	}
+
+	if rotationStatements, ok := data.GetOk("rotation_statements"); ok {
+		role.RotationStatements = rotationStatements.(string)
+	}
+
+	rotationPeriod := time.Duration(data.Get("rotation_period").(int)) * time.Second
+	rotationSchedule := data.Get("rotation_schedule").(string)
+	switch {
+	case rotationPeriod != 0 && rotationSchedule != "":
+		return logical.ErrorResponse("only one of rotation_period and rotation_schedule can be given"), nil
+	case rotationPeriod != 0:
+		if rotationPeriod < minRotationPeriod {
+			return logical.ErrorResponse(fmt.Sprintf("rotation_period must be at least %s", minRotationPeriod)), nil
+		}
+		role.RotationPeriod, role.RotationSchedule = rotationPeriod, ""
+	case rotationSchedule != "":
+		if _, err := cronutil.Parse(rotationSchedule); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid rotation_schedule: %s", err)), nil
+		}
+		role.RotationPeriod, role.RotationSchedule = 0, rotationSchedule
+	case role.RotationPeriod == 0 && role.RotationSchedule == "":
+		return logical.ErrorResponse("rotation_period or rotation_schedule is required"), nil
+	}
+
+	config, err := b.DatabaseConfig(req.Storage, role.DBName)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown connection: %s", role.DBName)), nil
+	}
+	if !config.roleAllowed(name) {
+		return logical.ErrorResponse(fmt.Sprintf("%s is not an allowed role", name)), nil
+	}
+
+	// The password of new roles is rotated right away, so that Vault knows it
+	if role.LastVaultRotation.IsZero() {
+		if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("error setting the password of %s: %s", role.Username, err)), nil
+		}
+		return nil, nil
+	}
+
+	if err := b.putStaticRole(req.Storage, name, role); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathStaticCredsRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	role, err := b.StaticRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown static role: %s", name)), nil
+	}
+
+	next, err := role.nextRotation()
+	if err != nil {
+		return nil, err
+	}
+	ttl := next.Sub(time.Now())
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"username":            role.Username,
+			"password":            role.Password,
+			"last_vault_rotation": role.LastVaultRotation.Format(time.RFC3339),
+			"ttl":                 int64(ttl / time.Second),
+		},
+	}
+	if role.RotationSchedule != "" {
+		resp.Data["rotation_schedule"] = role.RotationSchedule
+	} else {
+		resp.Data["rotation_period"] = int64(role.RotationPeriod / time.Second)
+	}
+	return resp, nil
+}
+
+func (b *backend) pathRotateRole(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.staticLock.Lock()
+	defer b.staticLock.Unlock()
+
+	role, err := b.StaticRole(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown static role: %s", name)), nil
+	}
+
+	if err := b.rotateStaticRole(req.Storage, name, role); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// rotateStaticRole sets a new password for the account of the role, and
+// stores it. The caller must hold the static lock.
+func (b *backend) rotateStaticRole(s logical.Storage, name string, role *staticRoleEntry) error {
+	db, err := b.DB(s, role.DBName)
+	if err != nil {
+		return err
+	}
+
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return err
+	}
+
+	statements := dbplugin.Statements{
+		RotationStatements: role.RotationStatements,
+	}
+	if err := db.SetCredentials(statements, role.Username, password); err != nil {
+		return err
+	}
+
+	// The next rotation is scheduled from this one
+	role.Password = password
+	role.LastVaultRotation = time.Now().UTC()
+	return b.putStaticRole(s, name, role)
+}
+
+// rotateStaticRoleIfDue rotates the password of the named role if its period
+// elapsed or its schedule ran
+func (b *backend) rotateStaticRoleIfDue(s logical.Storage, name string) error {
+	b.staticLock.Lock()
+	defer b.staticLock.Unlock()
+
+	role, err := b.StaticRole(s, name)
+	if err != nil {
+		return err
+	}
+	if role == nil {
+		return nil
+	}
+
+	next, err := role.nextRotation()
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(next) {
+		return nil
+	}
+	return b.rotateStaticRole(s, name, role)
+}
+
+const pathStaticRoleHelpSyn = `
+Manage the static roles, which manage the passwords of existing accounts.
+`
+
+const pathStaticRoleHelpDesc = `
+This path lets you manage the static roles of this backend. Unlike the users
+of roles, which are created on demand and revoked with their leases, the
+accounts of static roles already exist in the database: Vault only manages
+their passwords, for applications which cannot handle dynamic usernames.
+
+The password of the account is rotated when the role is created, then after
+each "rotation_period", or on the cron "rotation_schedule". The
+"rotation_statements" parameter customizes the statements setting the
+password; the "{{name}}" and "{{password}}" values are substituted.
+
+Deleting a static role stops the rotation of the password of its account,
+which is neither changed nor dropped.
+`
+
+const pathStaticCredsHelpSyn = `
+Request the current credentials of a static role.
+`
+
+const pathStaticCredsHelpDesc = `
+This path returns the current username and password of the account of a
+static role, along with the time until its next rotation in "ttl".
+`
+
+const pathRotateRoleHelpSyn = `
+Rotate the password of a static role.
+`
+
+const pathRotateRoleHelpDesc = `
+This path rotates the password of the account of a static role right away.
+Its next rotation is then scheduled from now.
+`
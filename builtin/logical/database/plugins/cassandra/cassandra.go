@@ -0,0 +1,311 @@
+// Package cassandra is the database plugin of Cassandra.
+package cassandra
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/tlsutil"
+	"github.com/mitchellh/mapstructure"
+)
+
+const cassandraTypeName = "cassandra"
+
+const (
+	defaultCreationCQL = `CREATE USER '{{name}}' WITH PASSWORD '{{password}}' NOSUPERUSER;`
+	defaultRollbackCQL = `DROP USER '{{name}}';`
+	defaultRotationCQL = `ALTER USER '{{name}}' WITH PASSWORD '{{password}}';`
+)
+
+// Plugin is the Cassandra database plugin
+var Plugin = &dbplugin.Plugin{
+	APIVersion: dbplugin.APIVersion,
+	New:        New,
+}
+
+// Cassandra manages the users of a Cassandra cluster
+type Cassandra struct {
+	Hosts           string `mapstructure:"hosts"`
+	Username        string `mapstructure:"username"`
+	Password        string `mapstructure:"password"`
+	TLS             bool   `mapstructure:"tls"`
+	InsecureTLS     bool   `mapstructure:"insecure_tls"`
+	PemBundle       string `mapstructure:"pem_bundle"`
+	PemJSON         string `mapstructure:"pem_json"`
+	ProtocolVersion int    `mapstructure:"protocol_version"`
+	ConnectTimeout  int    `mapstructure:"connect_timeout"`
+	TLSMinVersion   string `mapstructure:"tls_min_version"`
+
+	certBundle *certutil.CertBundle
+	session    *gocql.Session
+	sync.Mutex
+}
+
+// New returns a Cassandra database, to be initialized
+func New() (dbplugin.Database, error) {
+	return &Cassandra{}, nil
+}
+
+func (c *Cassandra) Type() (string, error) {
+	return cassandraTypeName, nil
+}
+
+func (c *Cassandra) Initialize(config map[string]interface{}, verifyConnection bool) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.ConnectTimeout = 5
+	c.TLSMinVersion = "tls12"
+	if err := mapstructure.WeakDecode(config, c); err != nil {
+		return err
+	}
+
+	if c.Hosts == "" {
+		return fmt.Errorf("hosts cannot be empty")
+	}
+	if c.Username == "" {
+		return fmt.Errorf("username cannot be empty")
+	}
+	if c.Password == "" {
+		return fmt.Errorf("password cannot be empty")
+	}
+	if c.ProtocolVersion == 0 {
+		c.ProtocolVersion = 2
+	}
+	if _, ok := tlsutil.TLSLookup[c.TLSMinVersion]; !ok {
+		return fmt.Errorf("invalid tls_min_version")
+	}
+
+	switch {
+	case c.PemJSON != "":
+		parsedCertBundle, err := certutil.ParsePKIJSON([]byte(c.PemJSON))
+		if err != nil {
+			return fmt.Errorf("could not parse given JSON; it must be in the format of the output of the PKI backend certificate issuing command: %s", err)
+		}
+		if c.certBundle, err = parsedCertBundle.ToCertBundle(); err != nil {
+			return fmt.Errorf("error marshaling PEM information: %s", err)
+		}
+		c.TLS = true
+	case c.PemBundle != "":
+		parsedCertBundle, err := certutil.ParsePEMBundle(c.PemBundle)
+		if err != nil {
+			return fmt.Errorf("error parsing the given PEM information: %s", err)
+		}
+		if c.certBundle, err = parsedCertBundle.ToCertBundle(); err != nil {
+			return fmt.Errorf("error marshaling PEM information: %s", err)
+		}
+		c.TLS = true
+	}
+	if c.InsecureTLS {
+		c.TLS = true
+	}
+
+	if verifyConnection {
+		if _, err := c.connection(); err != nil {
+			return fmt.Errorf("error verifying connection: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// Connection returns the session of the cluster
+func (c *Cassandra) Connection() (*gocql.Session, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.connection()
+}
+
+func (c *Cassandra) connection() (*gocql.Session, error) {
+	if c.session != nil && !c.session.Closed() {
+		return c.session, nil
+	}
+
+	clusterConfig := gocql.NewCluster(strings.Split(c.Hosts, ",")...)
+	clusterConfig.Authenticator = gocql.PasswordAuthenticator{
+		Username: c.Username,
+		Password: c.Password,
+	}
+	clusterConfig.ProtoVersion = c.ProtocolVersion
+	clusterConfig.Timeout = time.Duration(c.ConnectTimeout) * time.Second
+
+	if c.TLS {
+		// The TLS configuration is set field by field, since it cannot be
+		// copied into the options
+		sslOpts := &gocql.SslOptions{}
+		if c.certBundle != nil {
+			if c.certBundle.Certificate != "" && c.certBundle.PrivateKey == "" {
+				return nil, fmt.Errorf("found certificate for TLS authentication but no private key")
+			}
+			parsedCertBundle, err := c.certBundle.ToParsedCertBundle()
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse certificate bundle: %s", err)
+			}
+			tlsConfig, err := parsedCertBundle.GetTLSConfig(certutil.TLSClient)
+			if err != nil || tlsConfig == nil {
+				return nil, fmt.Errorf("failed to get TLS configuration: tlsConfig:%#v err:%v", tlsConfig, err)
+			}
+			sslOpts.Certificates = tlsConfig.Certificates
+			sslOpts.RootCAs = tlsConfig.RootCAs
+		}
+		sslOpts.InsecureSkipVerify = c.InsecureTLS
+		sslOpts.MinVersion = tlsutil.TLSLookup[c.TLSMinVersion]
+
+		clusterConfig.SslOpts = sslOpts
+	}
+
+	session, err := clusterConfig.CreateSession()
+	if err != nil {
+		return nil, fmt.Errorf("error creating session: %s", err)
+	}
+
+	// Verify the info
+	if err := session.Query(`LIST USERS`).Exec(); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("error validating connection info: %s", err)
+	}
+
+	c.session = session
+	return c.session, nil
+}
+
+func (c *Cassandra) Close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.session != nil {
+		c.session.Close()
+	}
+	c.session = nil
+	return nil
+}
+
+// CreateUser runs the creation statements, or the default ones creating a
+// user without superuser privileges, and the rollback statements if they fail
+func (c *Cassandra) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (string, string, error) {
+	session, err := c.Connection()
+	if err != nil {
+		return "", "", err
+	}
+
+	creationCQL := statements.CreationStatements
+	if creationCQL == "" {
+		creationCQL = defaultCreationCQL
+	}
+	rollbackCQL := statements.RollbackStatements
+	if rollbackCQL == "" {
+		rollbackCQL = defaultRollbackCQL
+	}
+
+	// Unquoted identifiers cannot contain dashes
+	username, err := dbplugin.GenerateUsername(usernameConfig, 15, 15, 100)
+	if err != nil {
+		return "", "", err
+	}
+	username = strings.Replace(username, "-", "_", -1)
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	data := map[string]string{
+		"name":     username,
+		"password": password,
+	}
+	for _, query := range dbplugin.SplitStatements(creationCQL) {
+		if err := session.Query(dbplugin.Query(query, data)).Exec(); err != nil {
+			for _, query := range dbplugin.SplitStatements(rollbackCQL) {
+				session.Query(dbplugin.Query(query, data)).Exec()
+			}
+			return "", "", err
+		}
+	}
+
+	return username, password, nil
+}
+
+// RenewUser does nothing, since Cassandra users do not expire
+func (c *Cassandra) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	return nil
+}
+
+func (c *Cassandra) RevokeUser(statements dbplugin.Statements, username string) error {
+	session, err := c.Connection()
+	if err != nil {
+		return err
+	}
+
+	revocationCQL := statements.RevocationStatements
+	if revocationCQL == "" {
+		revocationCQL = `DROP USER '{{name}}';`
+	}
+
+	// The statements are all attempted, so that as much access as possible
+	// is removed
+	var lastErr error
+	for _, query := range dbplugin.SplitStatements(revocationCQL) {
+		if err := session.Query(dbplugin.Query(query, map[string]string{"name": username})).Exec(); err != nil {
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("error removing user %s: %s", username, lastErr)
+	}
+	return nil
+}
+
+// SetCredentials sets the password of an existing user
+func (c *Cassandra) SetCredentials(statements dbplugin.Statements, username string, password string) error {
+	session, err := c.Connection()
+	if err != nil {
+		return err
+	}
+
+	rotationCQL := statements.RotationStatements
+	if rotationCQL == "" {
+		rotationCQL = defaultRotationCQL
+	}
+
+	data := map[string]string{
+		"name":     username,
+		"password": password,
+	}
+	for _, query := range dbplugin.SplitStatements(rotationCQL) {
+		if err := session.Query(dbplugin.Query(query, data)).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RotateRootCredentials sets a new password for the user of the session, and
+// reconnects with it
+func (c *Cassandra) RotateRootCredentials(statements string) (string, error) {
+	c.Lock()
+	username := c.Username
+	c.Unlock()
+
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return "", err
+	}
+	if err := c.SetCredentials(dbplugin.Statements{RotationStatements: statements}, username, password); err != nil {
+		return "", err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	c.Password = password
+	if c.session != nil {
+		c.session.Close()
+	}
+	c.session = nil
+	return password, nil
+}
@@ -0,0 +1,226 @@
+// Package mssql is the database plugin of Microsoft SQL Server.
+package mssql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/denisenkom/go-mssqldb"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+const msSQLTypeName = "mssql"
+
+// defaultRotationStatements set the passwords of static accounts whose roles
+// have no rotation statements
+const defaultRotationStatements = `ALTER LOGIN [{{name}}] WITH PASSWORD = '{{password}}';`
+
+// Plugin is the MSSQL database plugin
+var Plugin = &dbplugin.Plugin{
+	APIVersion: dbplugin.APIVersion,
+	New:        New,
+}
+
+// MSSQL manages the users of a Microsoft SQL Server database
+type MSSQL struct {
+	dbplugin.SQLConnectionProducer
+}
+
+// New returns a MSSQL database, to be initialized
+func New() (dbplugin.Database, error) {
+	return &MSSQL{
+		SQLConnectionProducer: dbplugin.SQLConnectionProducer{DriverName: "mssql"},
+	}, nil
+}
+
+func (m *MSSQL) Type() (string, error) {
+	return msSQLTypeName, nil
+}
+
+func (m *MSSQL) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (string, string, error) {
+	if statements.CreationStatements == "" {
+		return "", "", fmt.Errorf("empty creation statements")
+	}
+
+	username, err := dbplugin.GenerateUsername(usernameConfig, 20, 20, 128)
+	if err != nil {
+		return "", "", err
+	}
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := m.execute(statements.CreationStatements, map[string]string{
+		"name":       username,
+		"password":   password,
+		"expiration": expiration.Format("2006-01-02 15:04:05"),
+	}); err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// RenewUser runs the renew statements, if any, since SQL Server logins do
+// not expire
+func (m *MSSQL) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	if statements.RenewStatements == "" {
+		return nil
+	}
+	return m.execute(statements.RenewStatements, map[string]string{
+		"name":       username,
+		"expiration": expiration.Format("2006-01-02 15:04:05"),
+	})
+}
+
+func (m *MSSQL) RevokeUser(statements dbplugin.Statements, username string) error {
+	if statements.RevocationStatements == "" {
+		return m.defaultRevokeUser(username)
+	}
+	return m.execute(statements.RevocationStatements, map[string]string{
+		"name": username,
+	})
+}
+
+// SetCredentials sets the password of an existing user
+func (m *MSSQL) SetCredentials(statements dbplugin.Statements, username string, password string) error {
+	rotationStatements := statements.RotationStatements
+	if rotationStatements == "" {
+		rotationStatements = defaultRotationStatements
+	}
+	return m.execute(rotationStatements, map[string]string{
+		"name":     username,
+		"password": password,
+	})
+}
+
+// RotateRootCredentials sets a new password for the user of the connection
+func (m *MSSQL) RotateRootCredentials(statements string) (string, error) {
+	return m.RotateRoot(func(username, password string) error {
+		return m.SetCredentials(dbplugin.Statements{RotationStatements: statements}, username, password)
+	})
+}
+
+// execute runs the templated statements in a transaction
+func (m *MSSQL) execute(statements string, data map[string]string) error {
+	db, err := m.Connection()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range dbplugin.SplitStatements(statements) {
+		stmt, err := tx.Prepare(dbplugin.Query(query, data))
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec()
+		stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// defaultRevokeUser disables the login, kills its sessions and drops its
+// database users, then drops the login
+func (m *MSSQL) defaultRevokeUser(username string) error {
+	db, err := m.Connection()
+	if err != nil {
+		return err
+	}
+
+	// First disable server login
+	if _, err := db.Exec(fmt.Sprintf("ALTER LOGIN [%s] DISABLE;", username)); err != nil {
+		return err
+	}
+
+	// Query for sessions for the login so that we can kill any outstanding
+	// sessions. There cannot be any active sessions before we drop the logins
+	// This isn't done in a transaction because even if we fail along the way,
+	// we want to remove as much access as possible
+	sessionRows, err := db.Query(fmt.Sprintf(
+		"SELECT session_id FROM sys.dm_exec_sessions WHERE login_name = '%s';", username))
+	if err != nil {
+		return err
+	}
+	defer sessionRows.Close()
+
+	var revokeStmts []string
+	for sessionRows.Next() {
+		var sessionID int
+		if err := sessionRows.Scan(&sessionID); err != nil {
+			return err
+		}
+		revokeStmts = append(revokeStmts, fmt.Sprintf("KILL %d;", sessionID))
+	}
+
+	// Query for database users using undocumented stored procedure for now since
+	// it is the easiest way to get this information;
+	// we need to drop the database users before we can drop the login and the role
+	rows, err := db.Query(fmt.Sprintf("EXEC sp_msloginmappings '%s';", username))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var loginName, dbName, qUsername string
+		var aliasName sql.NullString
+		if err := rows.Scan(&loginName, &dbName, &qUsername, &aliasName); err != nil {
+			return err
+		}
+		revokeStmts = append(revokeStmts, fmt.Sprintf(dropUserSQL, dbName, username, username))
+	}
+
+	// we do not stop on error, as we want to remove as
+	// many permissions as possible right now
+	var lastStmtError error
+	for _, query := range revokeStmts {
+		if _, err := db.Exec(query); err != nil {
+			lastStmtError = err
+		}
+	}
+
+	// can't drop if not all database users are dropped
+	if rows.Err() != nil {
+		return fmt.Errorf("could not generate sql statements for all rows: %s", rows.Err())
+	}
+	if lastStmtError != nil {
+		return fmt.Errorf("could not perform all sql statements: %s", lastStmtError)
+	}
+
+	// Drop this login
+	_, err = db.Exec(fmt.Sprintf(dropLoginSQL, username, username))
+	return err
+}
+
+const dropUserSQL = `
+USE [%s]
+IF EXISTS
+  (SELECT name
+   FROM sys.database_principals
+   WHERE name = N'%s')
+BEGIN
+  DROP USER [%s]
+END
+`
+
+const dropLoginSQL = `
+IF EXISTS
+  (SELECT name
+   FROM master.sys.server_principals
+   WHERE name = N'%s')
+BEGIN
+  DROP LOGIN [%s]
+END
+`
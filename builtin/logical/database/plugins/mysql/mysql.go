@@ -0,0 +1,142 @@
+// Package mysql is the database plugin of MySQL.
+package mysql
+
+import (
+	"fmt"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+)
+
+const mySQLTypeName = "mysql"
+
+// defaultRotationStatements set the passwords of static accounts whose roles
+// have no rotation statements
+const defaultRotationStatements = `ALTER USER '{{name}}'@'%' IDENTIFIED BY '{{password}}';`
+
+// The revocation of users without revocation statements revokes their
+// privileges before dropping them, because MySQL does not close the open
+// connections of dropped users
+const defaultRevocationStatements = `
+	REVOKE ALL PRIVILEGES, GRANT OPTION FROM '{{name}}'@'%';
+	DROP USER '{{name}}'@'%';
+`
+
+// Plugin is the MySQL database plugin
+var Plugin = &dbplugin.Plugin{
+	APIVersion: dbplugin.APIVersion,
+	New:        New,
+}
+
+// MySQL manages the users of a MySQL database
+type MySQL struct {
+	dbplugin.SQLConnectionProducer
+}
+
+// New returns a MySQL database, to be initialized
+func New() (dbplugin.Database, error) {
+	return &MySQL{
+		SQLConnectionProducer: dbplugin.SQLConnectionProducer{DriverName: "mysql"},
+	}, nil
+}
+
+func (m *MySQL) Type() (string, error) {
+	return mySQLTypeName, nil
+}
+
+func (m *MySQL) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (string, string, error) {
+	if statements.CreationStatements == "" {
+		return "", "", fmt.Errorf("empty creation statements")
+	}
+
+	// Usernames are limited to 16 characters by older but still prevalent
+	// versions of MySQL
+	username, err := dbplugin.GenerateUsername(usernameConfig, 4, 4, 16)
+	if err != nil {
+		return "", "", err
+	}
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := m.execute(statements.CreationStatements, map[string]string{
+		"name":       username,
+		"password":   password,
+		"expiration": expiration.Format("2006-01-02 15:04:05"),
+	}); err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// RenewUser runs the renew statements, if any, since MySQL users do not
+// expire
+func (m *MySQL) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	if statements.RenewStatements == "" {
+		return nil
+	}
+	return m.execute(statements.RenewStatements, map[string]string{
+		"name":       username,
+		"expiration": expiration.Format("2006-01-02 15:04:05"),
+	})
+}
+
+func (m *MySQL) RevokeUser(statements dbplugin.Statements, username string) error {
+	revocationStatements := statements.RevocationStatements
+	if revocationStatements == "" {
+		revocationStatements = defaultRevocationStatements
+	}
+	return m.execute(revocationStatements, map[string]string{
+		"name": username,
+	})
+}
+
+// SetCredentials sets the password of an existing user
+func (m *MySQL) SetCredentials(statements dbplugin.Statements, username string, password string) error {
+	rotationStatements := statements.RotationStatements
+	if rotationStatements == "" {
+		rotationStatements = defaultRotationStatements
+	}
+	return m.execute(rotationStatements, map[string]string{
+		"name":     username,
+		"password": password,
+	})
+}
+
+// RotateRootCredentials sets a new password for the user of the connection
+func (m *MySQL) RotateRootCredentials(statements string) (string, error) {
+	return m.RotateRoot(func(username, password string) error {
+		return m.SetCredentials(dbplugin.Statements{RotationStatements: statements}, username, password)
+	})
+}
+
+// execute runs the templated statements in a transaction
+func (m *MySQL) execute(statements string, data map[string]string) error {
+	db, err := m.Connection()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range dbplugin.SplitStatements(statements) {
+		stmt, err := tx.Prepare(dbplugin.Query(query, data))
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec()
+		stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,230 @@
+// Package postgresql is the database plugin of PostgreSQL.
+package postgresql
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/lib/pq"
+)
+
+const postgreSQLTypeName = "postgres"
+
+// defaultRotationStatements set the passwords of static accounts whose roles
+// have no rotation statements
+const defaultRotationStatements = `ALTER ROLE "{{name}}" WITH PASSWORD '{{password}}';`
+
+const expirationFormat = "2006-01-02 15:04:05-0700"
+
+// Plugin is the PostgreSQL database plugin
+var Plugin = &dbplugin.Plugin{
+	APIVersion: dbplugin.APIVersion,
+	New:        New,
+}
+
+// PostgreSQL manages the users of a PostgreSQL database
+type PostgreSQL struct {
+	dbplugin.SQLConnectionProducer
+}
+
+// New returns a PostgreSQL database, to be initialized
+func New() (dbplugin.Database, error) {
+	return &PostgreSQL{
+		SQLConnectionProducer: dbplugin.SQLConnectionProducer{DriverName: "postgres"},
+	}, nil
+}
+
+func (p *PostgreSQL) Type() (string, error) {
+	return postgreSQLTypeName, nil
+}
+
+func (p *PostgreSQL) CreateUser(statements dbplugin.Statements, usernameConfig dbplugin.UsernameConfig, expiration time.Time) (string, string, error) {
+	if statements.CreationStatements == "" {
+		return "", "", fmt.Errorf("empty creation statements")
+	}
+
+	// PostgreSQL limits identifiers to 63 characters
+	username, err := dbplugin.GenerateUsername(usernameConfig, 8, 8, 63)
+	if err != nil {
+		return "", "", err
+	}
+	password, err := dbplugin.GeneratePassword()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := p.execute(statements.CreationStatements, map[string]string{
+		"name":       username,
+		"password":   password,
+		"expiration": expiration.Format(expirationFormat),
+	}); err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// RenewUser extends the VALID UNTIL date of the user, unless there are renew
+// statements
+func (p *PostgreSQL) RenewUser(statements dbplugin.Statements, username string, expiration time.Time) error {
+	renewStatements := statements.RenewStatements
+	if renewStatements == "" {
+		renewStatements = fmt.Sprintf("ALTER ROLE %s VALID UNTIL '{{expiration}}';", pq.QuoteIdentifier(username))
+	}
+	return p.execute(renewStatements, map[string]string{
+		"name":       username,
+		"expiration": expiration.Format(expirationFormat),
+	})
+}
+
+func (p *PostgreSQL) RevokeUser(statements dbplugin.Statements, username string) error {
+	if statements.RevocationStatements == "" {
+		return p.defaultRevokeUser(username)
+	}
+	return p.execute(statements.RevocationStatements, map[string]string{
+		"name": username,
+	})
+}
+
+// SetCredentials sets the password of an existing user
+func (p *PostgreSQL) SetCredentials(statements dbplugin.Statements, username string, password string) error {
+	rotationStatements := statements.RotationStatements
+	if rotationStatements == "" {
+		rotationStatements = defaultRotationStatements
+	}
+	return p.execute(rotationStatements, map[string]string{
+		"name":     username,
+		"password": password,
+	})
+}
+
+// RotateRootCredentials sets a new password for the user of the connection
+func (p *PostgreSQL) RotateRootCredentials(statements string) (string, error) {
+	return p.RotateRoot(func(username, password string) error {
+		return p.SetCredentials(dbplugin.Statements{RotationStatements: statements}, username, password)
+	})
+}
+
+// execute runs the templated statements in a transaction
+func (p *PostgreSQL) execute(statements string, data map[string]string) error {
+	db, err := p.Connection()
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range dbplugin.SplitStatements(statements) {
+		stmt, err := tx.Prepare(dbplugin.Query(query, data))
+		if err != nil {
+			return err
+		}
+		_, err = stmt.Exec()
+		stmt.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// defaultRevokeUser revokes the privileges of the user in all the schemas it
+// was granted some, then drops it
+func (p *PostgreSQL) defaultRevokeUser(username string) error {
+	db, err := p.Connection()
+	if err != nil {
+		return err
+	}
+
+	// Check if the role exists
+	var exists bool
+	err = db.QueryRow("SELECT exists (SELECT rolname FROM pg_roles WHERE rolname=$1);", username).Scan(&exists)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if !exists {
+		return nil
+	}
+
+	// Query for permissions; we need to revoke permissions before we can drop
+	// the role. This isn't done in a transaction because even if we fail along
+	// the way, we want to remove as much access as possible
+	rows, err := db.Query("SELECT DISTINCT table_schema FROM information_schema.role_column_grants WHERE grantee=$1;", username)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var revocationStmts []string
+	for rows.Next() {
+		var schema string
+		if err := rows.Scan(&schema); err != nil {
+			// keep going; remove as many permissions as possible right now
+			continue
+		}
+		revocationStmts = append(revocationStmts, fmt.Sprintf(
+			`REVOKE ALL PRIVILEGES ON ALL TABLES IN SCHEMA %s FROM %s;`,
+			pq.QuoteIdentifier(schema),
+			pq.QuoteIdentifier(username)))
+
+		revocationStmts = append(revocationStmts, fmt.Sprintf(
+			`REVOKE USAGE ON SCHEMA %s FROM %s;`,
+			pq.QuoteIdentifier(schema),
+			pq.QuoteIdentifier(username)))
+	}
+
+	// for good measure, revoke all privileges and usage on schema public
+	revocationStmts = append(revocationStmts, fmt.Sprintf(
+		`REVOKE ALL PRIVILEGES ON ALL TABLES IN SCHEMA public FROM %s;`,
+		pq.QuoteIdentifier(username)))
+
+	revocationStmts = append(revocationStmts, fmt.Sprintf(
+		"REVOKE ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public FROM %s;",
+		pq.QuoteIdentifier(username)))
+
+	revocationStmts = append(revocationStmts, fmt.Sprintf(
+		"REVOKE USAGE ON SCHEMA public FROM %s;",
+		pq.QuoteIdentifier(username)))
+
+	// get the current database name so we can issue a REVOKE CONNECT for
+	// this username
+	var dbname sql.NullString
+	if err := db.QueryRow("SELECT current_database();").Scan(&dbname); err != nil {
+		return err
+	}
+
+	if dbname.Valid {
+		revocationStmts = append(revocationStmts, fmt.Sprintf(
+			`REVOKE CONNECT ON DATABASE %s FROM %s;`,
+			pq.QuoteIdentifier(dbname.String),
+			pq.QuoteIdentifier(username)))
+	}
+
+	// again, here, we do not stop on error, as we want to remove as
+	// many permissions as possible right now
+	var lastStmtError error
+	for _, query := range revocationStmts {
+		if _, err := db.Exec(query); err != nil {
+			lastStmtError = err
+		}
+	}
+
+	// can't drop if not all privileges are revoked
+	if rows.Err() != nil {
+		return fmt.Errorf("could not generate revocation statements for all rows: %s", rows.Err())
+	}
+	if lastStmtError != nil {
+		return fmt.Errorf("could not perform all revocation statements: %s", lastStmtError)
+	}
+
+	// Drop this user
+	_, err = db.Exec(fmt.Sprintf(`DROP ROLE IF EXISTS %s;`, pq.QuoteIdentifier(username)))
+	return err
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/builtin/logical/database/dbplugin"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretCredsType = "creds"
+
+func secretCreds(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretCredsType,
+		Fields: map[string]*framework.FieldSchema{
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username",
+			},
+
+			"password": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password",
+			},
+		},
+
+		Renew:  b.secretCredsRenew,
+		Revoke: b.secretCredsRevoke,
+	}
+}
+
+func (b *backend) secretCredsRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	username, roleName, dbName, err := credsInternalData(req)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := b.Role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("error during renew: could not find role with name %s", roleName)
+	}
+
+	f := framework.LeaseExtend(role.DefaultTTL, role.MaxTTL, b.System())
+	resp, err := f(req, d)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the user expires along with the lease
+	if expireTime := resp.Secret.ExpirationTime(); !expireTime.IsZero() {
+		db, err := b.DB(req.Storage, dbName)
+		if err != nil {
+			return nil, err
+		}
+		var statements dbplugin.Statements
+		if role.DBName == dbName {
+			statements = role.Statements
+		}
+		if err := db.RenewUser(statements, username, expireTime); err != nil {
+			return nil, err
+		}
+	}
+
+	return resp, nil
+}
+
+func (b *backend) secretCredsRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	username, roleName, dbName, err := credsInternalData(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Users are revoked with the default revocation of the plugin if their
+	// role was deleted or moved to another connection
+	var statements dbplugin.Statements
+	role, err := b.Role(req.Storage, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if role != nil && role.DBName == dbName {
+		statements = role.Statements
+	}
+
+	db, err := b.DB(req.Storage, dbName)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.RevokeUser(statements, username); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// credsInternalData returns the username, role and connection of the secret
+func credsInternalData(req *logical.Request) (string, string, string, error) {
+	username, ok := req.Secret.InternalData["username"].(string)
+	if !ok {
+		return "", "", "", fmt.Errorf("secret is missing username internal data")
+	}
+	roleName, ok := req.Secret.InternalData["role"].(string)
+	if !ok {
+		return "", "", "", fmt.Errorf("secret is missing role internal data")
+	}
+	dbName, ok := req.Secret.InternalData["db_name"].(string)
+	if !ok {
+		return "", "", "", fmt.Errorf("secret is missing db_name internal data")
+	}
+	return username, roleName, dbName, nil
+}
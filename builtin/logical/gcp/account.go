@@ -0,0 +1,166 @@
+package gcp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	secretTypeAccessToken = "access_token"
+	secretTypeKey         = "service_account_key"
+
+	defaultKeyAlgorithm = "KEY_ALG_RSA_2048"
+	defaultKeyType      = "TYPE_GOOGLE_CREDENTIALS_FILE"
+)
+
+// account is the service account of a roleset or static account, and how
+// its secrets are issued
+type account struct {
+	SecretType          string   `json:"secret_type"`
+	ServiceAccountEmail string   `json:"service_account_email"`
+	Bindings            bindings `json:"bindings"`
+	RawBindings         string   `json:"raw_bindings"`
+	TokenScopes         []string `json:"token_scopes"`
+
+	// TokenKey is the key Vault holds to mint the access tokens of the
+	// service account
+	TokenKey *tokenKey `json:"token_key"`
+}
+
+type tokenKey struct {
+	Name        string `json:"name"`
+	Credentials string `json:"credentials"`
+}
+
+// validateSecretType checks the secret type and token scopes of the account,
+// defaulting the scopes of access tokens to the cloud-platform scope
+func (a *account) validateSecretType() error {
+	switch a.SecretType {
+	case secretTypeAccessToken:
+		if len(a.TokenScopes) == 0 {
+			a.TokenScopes = []string{cloudPlatformScope}
+		}
+	case secretTypeKey:
+		if len(a.TokenScopes) != 0 {
+			return fmt.Errorf("token_scopes are only valid with the %q secret type", secretTypeAccessToken)
+		}
+	default:
+		return fmt.Errorf("secret_type must be %q or %q", secretTypeAccessToken, secretTypeKey)
+	}
+	return nil
+}
+
+// createTokenKey creates the key Vault holds to mint access tokens of the
+// service account
+func (c *gcpClient) createTokenKey(email string) (*tokenKey, error) {
+	key, err := c.createServiceAccountKey(email, defaultKeyAlgorithm, defaultKeyType)
+	if err != nil {
+		return nil, err
+	}
+	creds, err := base64.StdEncoding.DecodeString(key.PrivateKeyData)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding key of service account %s: %s", email, err)
+	}
+	return &tokenKey{
+		Name:        key.Name,
+		Credentials: string(creds),
+	}, nil
+}
+
+// syncTokenKey creates the token key of the account if it issues access
+// tokens, or deletes it if it does not. Failing to delete the key is returned
+// as a warning, since it is unused afterwards.
+func (c *gcpClient) syncTokenKey(a *account) (warning string, err error) {
+	switch {
+	case a.SecretType == secretTypeAccessToken && a.TokenKey == nil:
+		a.TokenKey, err = c.createTokenKey(a.ServiceAccountEmail)
+		return "", err
+
+	case a.SecretType != secretTypeAccessToken && a.TokenKey != nil:
+		if err := c.deleteServiceAccountKey(a.TokenKey.Name); err != nil {
+			warning = fmt.Sprintf("the token key of the service account could not be deleted: %s", err)
+		}
+		a.TokenKey = nil
+	}
+	return warning, nil
+}
+
+// tokenResponse mints an access token of the account with its token key
+func (b *backend) tokenResponse(s logical.Storage, a *account, owner string) (*logical.Response, error) {
+	if a.SecretType != secretTypeAccessToken || a.TokenKey == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"%s does not issue access tokens, but %q secrets", owner, a.SecretType)), nil
+	}
+
+	client, err := b.Client(s)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := parseCredentials([]byte(a.TokenKey.Credentials))
+	if err != nil {
+		return nil, err
+	}
+	token, err := client.keyToken(creds, a.TokenScopes)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Error generating access token: %s", err)), nil
+	}
+
+	// Access tokens cannot be revoked, so they are not leased
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token":              token.Token,
+			"expires_at_seconds": token.Expires.Unix(),
+			"token_ttl":          int64(token.Expires.Sub(time.Now()) / time.Second),
+		},
+	}, nil
+}
+
+// keyResponse creates a leased key of the account
+func (b *backend) keyResponse(s logical.Storage, a *account, owner string,
+	keyAlgorithm, keyType string, internal map[string]interface{}) (*logical.Response, error) {
+	if a.SecretType != secretTypeKey {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"%s does not issue service account keys, but %q secrets", owner, a.SecretType)), nil
+	}
+	if keyAlgorithm == "" {
+		keyAlgorithm = defaultKeyAlgorithm
+	}
+	if keyType == "" {
+		keyType = defaultKeyType
+	}
+
+	client, err := b.Client(s)
+	if err != nil {
+		return nil, err
+	}
+	config, err := b.Config(s)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := client.createServiceAccountKey(a.ServiceAccountEmail,
+		strings.ToUpper(keyAlgorithm), strings.ToUpper(keyType))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Error generating service account key: %s", err)), nil
+	}
+
+	internal["key_name"] = key.Name
+	internal["service_account_email"] = a.ServiceAccountEmail
+	resp := b.Secret(SecretServiceAccountKeyType).Response(map[string]interface{}{
+		"private_key_data": key.PrivateKeyData,
+		"key_algorithm":    key.KeyAlgorithm,
+		"key_type":         key.PrivateKeyType,
+	}, internal)
+	if config != nil {
+		resp.Secret.TTL = config.TTL
+	}
+
+	return resp, nil
+}
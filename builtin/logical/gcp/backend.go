@@ -0,0 +1,128 @@
+package gcp
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	defaultAPIURL           = "https://%s.googleapis.com"
+	defaultMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.apiURL = defaultAPIURL
+	b.metadataTokenURL = defaultMetadataTokenURL
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListRoleSets(&b),
+			pathRoleSet(&b),
+			pathRoleSetRotate(&b),
+			pathRoleSetToken(&b),
+			pathRoleSetKey(&b),
+			pathListStaticAccounts(&b),
+			pathStaticAccount(&b),
+			pathStaticAccountToken(&b),
+			pathStaticAccountKey(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretServiceAccountKey(&b),
+		},
+
+		Clean: b.resetClient,
+
+		WALRollback:       b.walRollback,
+		WALRollbackMinAge: 5 * time.Minute,
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// apiURL is the format of the base URLs of the Google APIs and
+	// metadataTokenURL the token endpoint of the metadata server, which are
+	// replaced in tests
+	apiURL           string
+	metadataTokenURL string
+
+	// client calls the Google APIs with the configured credentials, and is
+	// reset when they change
+	client     *gcpClient
+	clientLock sync.Mutex
+
+	// lock serializes the changes of rolesets and static accounts, whose
+	// service accounts, bindings and keys live outside of Vault
+	lock sync.Mutex
+}
+
+// Client returns the client calling the Google APIs with the configured
+// credentials, or the credentials of the metadata server if there are none
+func (b *backend) Client(s logical.Storage) (*gcpClient, error) {
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+
+	if b.client != nil {
+		return b.client, nil
+	}
+
+	config, err := b.Config(s)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &gcpClient{
+		http:             cleanhttp.DefaultClient(),
+		apiURL:           b.apiURL,
+		metadataTokenURL: b.metadataTokenURL,
+	}
+	if config != nil && config.Credentials != "" {
+		creds, err := parseCredentials([]byte(config.Credentials))
+		if err != nil {
+			return nil, err
+		}
+		client.creds = creds
+	}
+
+	b.client = client
+	return client, nil
+}
+
+// resetClient drops the client, so that it is recreated with the current
+// configuration
+func (b *backend) resetClient() {
+	b.clientLock.Lock()
+	defer b.clientLock.Unlock()
+
+	b.client = nil
+}
+
+const backendHelp = `
+The GCP backend dynamically generates Google Cloud service account keys
+and OAuth2 access tokens.
+
+Rolesets manage a service account of their own, which is granted the
+roles of their bindings on Google Cloud resources. Static accounts
+issue the secrets of an existing service account. Service account keys
+are leased, and deleted when their lease is revoked, while access
+tokens expire on their own.
+
+After mounting this backend, credentials allowed to manage service
+accounts and IAM policies must be configured with the "config" path,
+unless Vault runs on Google Cloud with such a service account.
+`
@@ -0,0 +1,503 @@
+package gcp
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// fakeGoogle serves the parts of the OAuth2, IAM and Resource Manager APIs
+// the backend uses
+type fakeGoogle struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	sync.Mutex
+	accounts map[string]bool
+	keys     map[string]bool
+	policies map[string]*iamPolicy
+	tokens   int
+	nextKey  int
+
+	// failSetPolicy fails the next updates of IAM policies
+	failSetPolicy int
+}
+
+func newFakeGoogle(t *testing.T) *fakeGoogle {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeGoogle{
+		t:        t,
+		key:      key,
+		accounts: make(map[string]bool),
+		keys:     make(map[string]bool),
+		policies: make(map[string]*iamPolicy),
+	}
+	f.server = httptest.NewServer(f)
+	return f
+}
+
+// credentials returns a JSON key file of the service account
+func (f *fakeGoogle) credentials(email, keyID string) string {
+	creds, err := json.Marshal(&serviceAccountCredentials{
+		Type:         "service_account",
+		PrivateKeyID: keyID,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(f.key),
+		})),
+		ClientEmail: email,
+		TokenURI:    f.server.URL + "/oauth2/token",
+	})
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return string(creds)
+}
+
+func (f *fakeGoogle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	path := r.URL.Path
+	if path == "/oauth2/token" {
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") != jwtBearerGrantType || r.PostForm.Get("assertion") == "" {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		f.tokens++
+		json.NewEncoder(w).Encode(&tokenResponse{
+			AccessToken: fmt.Sprintf("token-%d", f.tokens),
+			ExpiresIn:   3600,
+			TokenType:   "Bearer",
+		})
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer token-") {
+		http.Error(w, "unauthenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var input map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&input)
+	}
+
+	switch {
+	case strings.HasPrefix(path, "/cloudresourcemanager/v1/"):
+		resource := strings.TrimPrefix(path, "/cloudresourcemanager/v1/")
+		switch {
+		case strings.HasSuffix(resource, ":getIamPolicy"):
+			policy := f.policies[strings.TrimSuffix(resource, ":getIamPolicy")]
+			if policy == nil {
+				policy = &iamPolicy{}
+			}
+			json.NewEncoder(w).Encode(policy)
+		case strings.HasSuffix(resource, ":setIamPolicy"):
+			if f.failSetPolicy > 0 {
+				f.failSetPolicy--
+				http.Error(w, "failed", http.StatusInternalServerError)
+				return
+			}
+			raw, _ := json.Marshal(input["policy"])
+			var policy iamPolicy
+			json.Unmarshal(raw, &policy)
+			f.policies[strings.TrimSuffix(resource, ":setIamPolicy")] = &policy
+			json.NewEncoder(w).Encode(&policy)
+		default:
+			http.NotFound(w, r)
+		}
+
+	case strings.HasPrefix(path, "/iam/v1/projects/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/iam/v1/projects/"), "/")
+		switch {
+		case len(parts) == 2 && r.Method == "POST":
+			email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", input["accountId"], parts[0])
+			f.accounts[email] = true
+			json.NewEncoder(w).Encode(&serviceAccount{Email: email, ProjectID: parts[0]})
+		case len(parts) == 3 && !f.accounts[parts[2]]:
+			http.NotFound(w, r)
+		case len(parts) == 3 && r.Method == "GET":
+			json.NewEncoder(w).Encode(&serviceAccount{Email: parts[2]})
+		case len(parts) == 3 && r.Method == "DELETE":
+			delete(f.accounts, parts[2])
+			for name := range f.keys {
+				if strings.Contains(name, "/"+parts[2]+"/") {
+					delete(f.keys, name)
+				}
+			}
+			w.Write([]byte("{}"))
+		case len(parts) == 4 && r.Method == "POST":
+			f.nextKey++
+			name := fmt.Sprintf("projects/-/serviceAccounts/%s/keys/%d", parts[2], f.nextKey)
+			f.keys[name] = true
+			json.NewEncoder(w).Encode(&serviceAccountKey{
+				Name:           name,
+				KeyAlgorithm:   input["keyAlgorithm"].(string),
+				PrivateKeyType: input["privateKeyType"].(string),
+				PrivateKeyData: base64.StdEncoding.EncodeToString(
+					[]byte(f.credentials(parts[2], fmt.Sprint(f.nextKey)))),
+			})
+		case len(parts) == 5 && r.Method == "DELETE":
+			name := "projects/" + strings.Join(parts, "/")
+			if !f.keys[name] {
+				http.NotFound(w, r)
+				return
+			}
+			delete(f.keys, name)
+			w.Write([]byte("{}"))
+		default:
+			http.NotFound(w, r)
+		}
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// members returns the members bound to the role on the project
+func (f *fakeGoogle) members(project, role string) []string {
+	f.Lock()
+	defer f.Unlock()
+
+	policy := f.policies["projects/"+project]
+	if policy == nil {
+		return nil
+	}
+	for _, b := range policy.Bindings {
+		if b.Role == role {
+			return b.Members
+		}
+	}
+	return nil
+}
+
+func (f *fakeGoogle) hasAccount(email string) bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.accounts[email]
+}
+
+func (f *fakeGoogle) hasKey(name string) bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.keys[name]
+}
+
+func testBackend(t *testing.T) (*backend, logical.Storage, *fakeGoogle) {
+	f := newFakeGoogle(t)
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	b.apiURL = f.server.URL + "/%s"
+	b.metadataTokenURL = f.server.URL + "/metadata/token"
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	testOK(t, b, config.StorageView, logical.UpdateOperation, "config", map[string]interface{}{
+		"credentials": f.credentials("vault@my-project.iam.gserviceaccount.com", "vault"),
+		"ttl":         3600,
+		"max_ttl":     7200,
+	})
+	return b, config.StorageView, f
+}
+
+func testRequest(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+}
+
+func testOK(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func testError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	resp, err := testRequest(b, s, op, path, data)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error: %s %s: resp: %#v", op, path, resp)
+	}
+}
+
+const testBindings = `
+resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+  roles = ["roles/viewer"]
+}
+`
+
+func TestBackend_config(t *testing.T) {
+	b, s, _ := testBackend(t)
+
+	resp := testOK(t, b, s, logical.ReadOperation, "config", nil)
+	if _, ok := resp.Data["credentials"]; ok || resp.Data["ttl"] != int64(3600) || resp.Data["max_ttl"] != int64(7200) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testError(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"credentials": "{}",
+	})
+	testError(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"ttl": 10000,
+	})
+}
+
+func TestBackend_roleSetToken(t *testing.T) {
+	b, s, f := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "roleset/tokens", map[string]interface{}{
+		"bindings": testBindings,
+	})
+	testError(t, b, s, logical.UpdateOperation, "roleset/tokens", map[string]interface{}{
+		"project": "my-project",
+	})
+	testError(t, b, s, logical.UpdateOperation, "roleset/tokens", map[string]interface{}{
+		"project":  "my-project",
+		"bindings": `resource "projects/my-project" { roles = ["roles/viewer"] }`,
+	})
+
+	testOK(t, b, s, logical.UpdateOperation, "roleset/tokens", map[string]interface{}{
+		"project":  "my-project",
+		"bindings": testBindings,
+	})
+	resp := testOK(t, b, s, logical.ReadOperation, "roleset/tokens", nil)
+	email := resp.Data["service_account_email"].(string)
+	if resp.Data["secret_type"] != secretTypeAccessToken || !f.hasAccount(email) ||
+		!strings.HasSuffix(email, "@my-project.iam.gserviceaccount.com") ||
+		fmt.Sprint(resp.Data["token_scopes"]) != "["+cloudPlatformScope+"]" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if members := f.members("my-project", "roles/viewer"); len(members) != 1 || members[0] != "serviceAccount:"+email {
+		t.Fatalf("bad: %#v", members)
+	}
+
+	resp = testOK(t, b, s, logical.ReadOperation, "roleset/tokens/token", nil)
+	if resp.Secret != nil || !strings.HasPrefix(resp.Data["token"].(string), "token-") || resp.Data["token_ttl"].(int64) <= 0 {
+		t.Fatalf("bad: %#v", resp)
+	}
+	testError(t, b, s, logical.ReadOperation, "roleset/tokens/key", nil)
+
+	resp = testOK(t, b, s, logical.ListOperation, "roleset/", nil)
+	if fmt.Sprint(resp.Data["keys"]) != "[tokens]" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Rotating replaces the service account and its bindings
+	testOK(t, b, s, logical.UpdateOperation, "roleset/tokens/rotate", nil)
+	resp = testOK(t, b, s, logical.ReadOperation, "roleset/tokens", nil)
+	rotated := resp.Data["service_account_email"].(string)
+	if rotated == email || f.hasAccount(email) || !f.hasAccount(rotated) {
+		t.Fatalf("bad: %s %s", email, rotated)
+	}
+	if members := f.members("my-project", "roles/viewer"); len(members) != 1 || members[0] != "serviceAccount:"+rotated {
+		t.Fatalf("bad: %#v", members)
+	}
+	testOK(t, b, s, logical.ReadOperation, "roleset/tokens/token", nil)
+
+	testOK(t, b, s, logical.DeleteOperation, "roleset/tokens", nil)
+	if f.hasAccount(rotated) || len(f.members("my-project", "roles/viewer")) != 0 {
+		t.Fatalf("service account was not deleted")
+	}
+	testError(t, b, s, logical.ReadOperation, "roleset/tokens/token", nil)
+}
+
+func TestBackend_roleSetKey(t *testing.T) {
+	b, s, f := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "roleset/keys", map[string]interface{}{
+		"project":     "my-project",
+		"secret_type": secretTypeKey,
+		"bindings":    testBindings,
+	})
+	testError(t, b, s, logical.ReadOperation, "roleset/keys/token", nil)
+
+	resp := testOK(t, b, s, logical.ReadOperation, "roleset/keys/key", nil)
+	if resp.Secret == nil || resp.Secret.TTL.Seconds() != 3600 || resp.Data["key_type"] != defaultKeyType {
+		t.Fatalf("bad: %#v", resp)
+	}
+	keyName := resp.Secret.InternalData["key_name"].(string)
+	if !f.hasKey(keyName) {
+		t.Fatalf("key %s was not created", keyName)
+	}
+	creds, err := base64.StdEncoding.DecodeString(resp.Data["private_key_data"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseCredentials(creds); err != nil {
+		t.Fatal(err)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	renewReq := &logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   s,
+		Secret:    secret,
+	}
+	if resp, err := b.HandleRequest(renewReq); err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Revoking the lease deletes the key
+	revokeReq := &logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   s,
+		Secret:    secret,
+	}
+	if resp, err := b.HandleRequest(revokeReq); err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if f.hasKey(keyName) {
+		t.Fatalf("key %s was not deleted", keyName)
+	}
+
+	// Keys of replaced service accounts are not renewed
+	testOK(t, b, s, logical.UpdateOperation, "roleset/keys", map[string]interface{}{
+		"bindings": `
+resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+  roles = ["roles/editor"]
+}`,
+	})
+	if resp, err := b.HandleRequest(renewReq); err == nil && !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+	if len(f.members("my-project", "roles/viewer")) != 0 || len(f.members("my-project", "roles/editor")) != 1 {
+		t.Fatalf("bindings were not replaced")
+	}
+}
+
+func TestBackend_roleSetSecretType(t *testing.T) {
+	b, s, f := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "roleset/switch", map[string]interface{}{
+		"project":      "my-project",
+		"secret_type":  secretTypeKey,
+		"token_scopes": "https://www.googleapis.com/auth/cloud-platform",
+		"bindings":     testBindings,
+	})
+	testOK(t, b, s, logical.UpdateOperation, "roleset/switch", map[string]interface{}{
+		"project":  "my-project",
+		"bindings": testBindings,
+	})
+	resp := testOK(t, b, s, logical.ReadOperation, "roleset/switch", nil)
+	email := resp.Data["service_account_email"].(string)
+	rs, err := b.RoleSet(s, "switch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenKeyName := rs.TokenKey.Name
+
+	// Changing the secret type keeps the service account, but deletes the
+	// token key
+	testOK(t, b, s, logical.UpdateOperation, "roleset/switch", map[string]interface{}{
+		"secret_type": secretTypeKey,
+	})
+	resp = testOK(t, b, s, logical.ReadOperation, "roleset/switch", nil)
+	if resp.Data["service_account_email"] != email || f.hasKey(tokenKeyName) || len(resp.Data["token_scopes"].([]string)) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	testOK(t, b, s, logical.ReadOperation, "roleset/switch/key", nil)
+}
+
+func TestBackend_roleSetRollback(t *testing.T) {
+	b, s, f := testBackend(t)
+
+	// Binding the roles fails, which leaves the service account behind
+	f.failSetPolicy = 1
+	testError(t, b, s, logical.UpdateOperation, "roleset/failed", map[string]interface{}{
+		"project":  "my-project",
+		"bindings": testBindings,
+	})
+	if len(f.accounts) != 1 {
+		t.Fatalf("bad: %#v", f.accounts)
+	}
+
+	testOK(t, b, s, logical.RollbackOperation, "", map[string]interface{}{
+		"immediate": true,
+	})
+	if len(f.accounts) != 0 {
+		t.Fatalf("service account was not rolled back: %#v", f.accounts)
+	}
+
+	// Service accounts of stored rolesets are kept
+	testOK(t, b, s, logical.UpdateOperation, "roleset/failed", map[string]interface{}{
+		"project":  "my-project",
+		"bindings": testBindings,
+	})
+	testOK(t, b, s, logical.RollbackOperation, "", map[string]interface{}{
+		"immediate": true,
+	})
+	if len(f.accounts) != 1 {
+		t.Fatalf("bad: %#v", f.accounts)
+	}
+}
+
+func TestBackend_staticAccount(t *testing.T) {
+	b, s, f := testBackend(t)
+
+	email := "existing@my-project.iam.gserviceaccount.com"
+	testError(t, b, s, logical.UpdateOperation, "static-account/existing", map[string]interface{}{
+		"service_account_email": email,
+	})
+	f.accounts[email] = true
+
+	testOK(t, b, s, logical.UpdateOperation, "static-account/existing", map[string]interface{}{
+		"service_account_email": email,
+		"bindings":              testBindings,
+		"token_scopes":          "https://www.googleapis.com/auth/devstorage.read_only",
+	})
+	if members := f.members("my-project", "roles/viewer"); len(members) != 1 || members[0] != "serviceAccount:"+email {
+		t.Fatalf("bad: %#v", members)
+	}
+	testOK(t, b, s, logical.ReadOperation, "static-account/existing/token", nil)
+	testError(t, b, s, logical.UpdateOperation, "static-account/existing", map[string]interface{}{
+		"service_account_email": "other@my-project.iam.gserviceaccount.com",
+	})
+
+	// Removing the bindings revokes them
+	testOK(t, b, s, logical.UpdateOperation, "static-account/existing", map[string]interface{}{
+		"bindings":    "",
+		"secret_type": secretTypeKey,
+	})
+	if members := f.members("my-project", "roles/viewer"); len(members) != 0 {
+		t.Fatalf("bad: %#v", members)
+	}
+	resp := testOK(t, b, s, logical.ReadOperation, "static-account/existing/key", nil)
+	if resp.Secret == nil || resp.Secret.InternalData["static_account"] != "existing" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Deleting the static account keeps the service account
+	testOK(t, b, s, logical.DeleteOperation, "static-account/existing", nil)
+	if !f.hasAccount(email) {
+		t.Fatalf("service account was deleted")
+	}
+	resp = testOK(t, b, s, logical.ListOperation, "static-account/", nil)
+	if len(resp.Data) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
@@ -0,0 +1,119 @@
+package gcp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl"
+)
+
+// bindings are the roles granted to a service account, by the full resource
+// name of the resources they are granted on
+type bindings map[string][]string
+
+// parseBindings parses bindings given as HCL or JSON, optionally base64
+// encoded, in the form:
+//
+//	resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+//	  roles = ["roles/viewer"]
+//	}
+func parseBindings(raw string) (bindings, error) {
+	if decoded, err := base64.StdEncoding.DecodeString(raw); err == nil {
+		raw = string(decoded)
+	}
+
+	var config struct {
+		Resources []struct {
+			Name  string   `hcl:",key"`
+			Roles []string `hcl:"roles"`
+		} `hcl:"resource"`
+	}
+	if err := hcl.Decode(&config, raw); err != nil {
+		return nil, fmt.Errorf("error parsing bindings: %s", err)
+	}
+
+	result := make(bindings)
+	for _, resource := range config.Resources {
+		if !strings.HasPrefix(resource.Name, "//") {
+			return nil, fmt.Errorf("resource %q of the bindings is not a full resource name, such as \"//cloudresourcemanager.googleapis.com/projects/my-project\"", resource.Name)
+		}
+		if len(resource.Roles) == 0 {
+			return nil, fmt.Errorf("resource %q of the bindings has no roles", resource.Name)
+		}
+		for _, role := range resource.Roles {
+			if role == "" {
+				return nil, fmt.Errorf("resource %q of the bindings has an empty role", resource.Name)
+			}
+			if !containsString(result[resource.Name], role) {
+				result[resource.Name] = append(result[resource.Name], role)
+			}
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("bindings must have at least one resource")
+	}
+	for _, roles := range result {
+		sort.Strings(roles)
+	}
+
+	return result, nil
+}
+
+// equal returns whether the bindings grant the same roles
+func (b bindings) equal(other bindings) bool {
+	if len(b) != len(other) {
+		return false
+	}
+	for resource, roles := range b {
+		otherRoles, ok := other[resource]
+		if !ok || len(roles) != len(otherRoles) {
+			return false
+		}
+		for _, role := range roles {
+			if !containsString(otherRoles, role) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// subtract returns the roles of the bindings which other does not grant
+func (b bindings) subtract(other bindings) bindings {
+	result := make(bindings)
+	for resource, roles := range b {
+		for _, role := range roles {
+			if !containsString(other[resource], role) {
+				result[resource] = append(result[resource], role)
+			}
+		}
+	}
+	return result
+}
+
+// serviceAccountMember returns the IAM policy member of a service account
+func serviceAccountMember(email string) string {
+	return "serviceAccount:" + email
+}
+
+// grant grants the roles of the bindings to the service account
+func (c *gcpClient) grant(email string, b bindings) error {
+	for resource, roles := range b {
+		if err := c.addBindings(resource, serviceAccountMember(email), roles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revoke revokes the roles of the bindings from the service account
+func (c *gcpClient) revoke(email string, b bindings) error {
+	for resource, roles := range b {
+		if err := c.removeBindings(resource, serviceAccountMember(email), roles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
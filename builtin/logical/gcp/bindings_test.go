@@ -0,0 +1,63 @@
+package gcp
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+)
+
+func TestParseBindings(t *testing.T) {
+	expected := bindings{
+		"//cloudresourcemanager.googleapis.com/projects/my-project": []string{"roles/editor", "roles/viewer"},
+		"//storage.googleapis.com/projects/_/buckets/my-bucket":     []string{"roles/storage.objectViewer"},
+	}
+
+	hclBindings := `
+resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+  roles = ["roles/viewer", "roles/editor"]
+}
+
+resource "//storage.googleapis.com/projects/_/buckets/my-bucket" {
+  roles = ["roles/storage.objectViewer"]
+}
+
+resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+  roles = ["roles/viewer"]
+}
+`
+	jsonBindings := `{
+  "resource": {
+    "//cloudresourcemanager.googleapis.com/projects/my-project": {
+      "roles": ["roles/editor", "roles/viewer"]
+    },
+    "//storage.googleapis.com/projects/_/buckets/my-bucket": {
+      "roles": ["roles/storage.objectViewer"]
+    }
+  }
+}`
+
+	for _, raw := range []string{
+		hclBindings,
+		jsonBindings,
+		base64.StdEncoding.EncodeToString([]byte(hclBindings)),
+	} {
+		parsed, err := parseBindings(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed, expected) || !parsed.equal(expected) {
+			t.Fatalf("bad: %#v", parsed)
+		}
+	}
+
+	for _, raw := range []string{
+		"",
+		`resource "projects/my-project" { roles = ["roles/viewer"] }`,
+		`resource "//cloudresourcemanager.googleapis.com/projects/my-project" { roles = [] }`,
+		`resource "//cloudresourcemanager.googleapis.com/projects/my-project" {`,
+	} {
+		if _, err := parseBindings(raw); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+}
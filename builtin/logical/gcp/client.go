@@ -0,0 +1,518 @@
+package gcp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cloudPlatformScope is the scope of the tokens Vault uses to call the
+	// Google APIs
+	cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+	// jwtBearerGrantType is the OAuth 2.0 grant type of the tokens requested
+	// with a JWT signed by a service account key
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+)
+
+// serviceAccountCredentials is the JSON credentials file of a service account
+// key, as downloaded from the Cloud Console or returned by the IAM API
+type serviceAccountCredentials struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// parseCredentials parses a JSON credentials file of a service account key
+func parseCredentials(raw []byte) (*serviceAccountCredentials, error) {
+	var creds serviceAccountCredentials
+	if err := json.Unmarshal(raw, &creds); err != nil {
+		return nil, fmt.Errorf("error parsing credentials: %s", err)
+	}
+	if creds.ClientEmail == "" || creds.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials must be the JSON key file of a service account, with client_email and private_key")
+	}
+	if _, err := creds.signer(); err != nil {
+		return nil, err
+	}
+	return &creds, nil
+}
+
+func (c *serviceAccountCredentials) signer() (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("private_key of the credentials is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private_key of the credentials: %s", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private_key of the credentials is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// accessToken is an OAuth 2.0 access token
+type accessToken struct {
+	Token   string
+	Expires time.Time
+}
+
+// tokenResponse is the response of the token endpoints
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	TokenType   string `json:"token_type"`
+}
+
+// gcpClient calls the Google APIs with the credentials of Vault
+type gcpClient struct {
+	http *http.Client
+
+	// apiURL is the format of the base URLs of the Google APIs, given the
+	// name of the service, and metadataTokenURL is the token endpoint of the
+	// metadata server, used when no credentials are configured. They are
+	// replaced in tests.
+	apiURL           string
+	metadataTokenURL string
+
+	// creds are the configured credentials of Vault
+	creds *serviceAccountCredentials
+
+	tokenLock sync.Mutex
+	token     *accessToken
+}
+
+// serviceURL returns the URL of the path of a Google API service
+func (c *gcpClient) serviceURL(service, path string) string {
+	return fmt.Sprintf(c.apiURL, service) + path
+}
+
+// tokenURL returns the token endpoint of service account credentials
+func (c *gcpClient) tokenURL(creds *serviceAccountCredentials) string {
+	if creds.TokenURI != "" {
+		return creds.TokenURI
+	}
+	return c.serviceURL("oauth2", "/token")
+}
+
+// vaultToken returns an access token for the credentials of Vault, which is
+// cached until shortly before it expires
+func (c *gcpClient) vaultToken() (string, error) {
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	if c.token != nil && time.Now().Add(time.Minute).Before(c.token.Expires) {
+		return c.token.Token, nil
+	}
+
+	var token *accessToken
+	var err error
+	if c.creds != nil {
+		token, err = c.keyToken(c.creds, []string{cloudPlatformScope})
+	} else {
+		token, err = c.metadataToken()
+	}
+	if err != nil {
+		return "", err
+	}
+	c.token = token
+	return token.Token, nil
+}
+
+// keyToken exchanges a JWT signed with the key of the credentials for an
+// access token with the given scopes
+func (c *gcpClient) keyToken(creds *serviceAccountCredentials, scopes []string) (*accessToken, error) {
+	key, err := creds.signer()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenURL := c.tokenURL(creds)
+	now := time.Now()
+	assertion, err := signJWT(key, creds.PrivateKeyID, map[string]interface{}{
+		"iss":   creds.ClientEmail,
+		"scope": strings.Join(scopes, " "),
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.PostForm(tokenURL, url.Values{
+		"grant_type": []string{jwtBearerGrantType},
+		"assertion":  []string{assertion},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error requesting access token: %s", err)
+	}
+	defer resp.Body.Close()
+	return decodeToken(resp, now)
+}
+
+// metadataToken returns an access token of the service account of the
+// Compute Engine instance Vault runs on
+func (c *gcpClient) metadataToken() (*accessToken, error) {
+	req, err := http.NewRequest("GET", c.metadataTokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	now := time.Now()
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no credentials are configured, and the metadata server cannot be reached: %s", err)
+	}
+	defer resp.Body.Close()
+	return decodeToken(resp, now)
+}
+
+func decodeToken(resp *http.Response, now time.Time) (*accessToken, error) {
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("error requesting access token: status code %d: %s", resp.StatusCode, body)
+	}
+	var token tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("error decoding access token: %s", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("no access token returned")
+	}
+	return &accessToken{
+		Token:   token.AccessToken,
+		Expires: now.Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// signJWT returns the RS256 signed JWT of the claims
+func signJWT(key *rsa.PrivateKey, keyID string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	}
+	if keyID != "" {
+		header["kid"] = keyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(headerJSON) + "." +
+		base64.RawURLEncoding.EncodeToString(claimsJSON)
+	sum := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// apiError is an error returned by a Google API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("status code %d: %s", e.StatusCode, e.Message)
+}
+
+// isStatus returns whether err is an error of the Google APIs with the given
+// status code
+func isStatus(err error, statusCode int) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == statusCode
+}
+
+// call calls a Google API with the credentials of Vault, encoding the input
+// and decoding the output as JSON if they are not nil
+func (c *gcpClient) call(method, url string, input, output interface{}) error {
+	token, err := c.vaultToken()
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if input != nil {
+		raw, err := json.Marshal(input)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if input != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		raw, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 65536))
+		message := string(raw)
+		if json.Unmarshal(raw, &errResp) == nil && errResp.Error.Message != "" {
+			message = errResp.Error.Message
+		}
+		return &apiError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if output != nil {
+		if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+			return fmt.Errorf("error decoding response of %s: %s", url, err)
+		}
+	}
+	return nil
+}
+
+// serviceAccount is a service account of the IAM API
+type serviceAccount struct {
+	Name        string `json:"name"`
+	ProjectID   string `json:"projectId"`
+	UniqueID    string `json:"uniqueId"`
+	Email       string `json:"email"`
+	DisplayName string `json:"displayName"`
+}
+
+// serviceAccountKey is a service account key of the IAM API. The private key
+// data is only returned when the key is created.
+type serviceAccountKey struct {
+	Name            string `json:"name"`
+	PrivateKeyType  string `json:"privateKeyType"`
+	KeyAlgorithm    string `json:"keyAlgorithm"`
+	PrivateKeyData  string `json:"privateKeyData"`
+	ValidAfterTime  string `json:"validAfterTime"`
+	ValidBeforeTime string `json:"validBeforeTime"`
+}
+
+// createServiceAccount creates a service account in the project
+func (c *gcpClient) createServiceAccount(project, accountID, displayName string) (*serviceAccount, error) {
+	var account serviceAccount
+	err := c.call("POST", c.serviceURL("iam", "/v1/projects/"+url.PathEscape(project)+"/serviceAccounts"), map[string]interface{}{
+		"accountId": accountID,
+		"serviceAccount": map[string]string{
+			"displayName": displayName,
+		},
+	}, &account)
+	if err != nil {
+		return nil, fmt.Errorf("error creating service account: %s", err)
+	}
+	return &account, nil
+}
+
+// getServiceAccount returns a service account, or nil if it does not exist
+func (c *gcpClient) getServiceAccount(email string) (*serviceAccount, error) {
+	var account serviceAccount
+	err := c.call("GET", c.serviceURL("iam", "/v1/projects/-/serviceAccounts/"+url.PathEscape(email)), nil, &account)
+	if isStatus(err, http.StatusNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading service account %s: %s", email, err)
+	}
+	return &account, nil
+}
+
+// deleteServiceAccount deletes a service account and its keys. Deleting a
+// service account which does not exist succeeds.
+func (c *gcpClient) deleteServiceAccount(email string) error {
+	err := c.call("DELETE", c.serviceURL("iam", "/v1/projects/-/serviceAccounts/"+url.PathEscape(email)), nil, nil)
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error deleting service account %s: %s", email, err)
+	}
+	return nil
+}
+
+// createServiceAccountKey creates a key of a service account
+func (c *gcpClient) createServiceAccountKey(email, keyAlgorithm, keyType string) (*serviceAccountKey, error) {
+	var key serviceAccountKey
+	err := c.call("POST", c.serviceURL("iam", "/v1/projects/-/serviceAccounts/"+url.PathEscape(email)+"/keys"), map[string]string{
+		"keyAlgorithm":   keyAlgorithm,
+		"privateKeyType": keyType,
+	}, &key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating key of service account %s: %s", email, err)
+	}
+	return &key, nil
+}
+
+// deleteServiceAccountKey deletes a service account key by its resource
+// name. Deleting a key which does not exist succeeds.
+func (c *gcpClient) deleteServiceAccountKey(name string) error {
+	err := c.call("DELETE", c.serviceURL("iam", "/v1/"+name), nil, nil)
+	if err != nil && !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("error deleting service account key %s: %s", name, err)
+	}
+	return nil
+}
+
+// iamPolicy is the IAM policy of a resource
+type iamPolicy struct {
+	Version  int           `json:"version,omitempty"`
+	Etag     string        `json:"etag,omitempty"`
+	Bindings []*iamBinding `json:"bindings,omitempty"`
+}
+
+type iamBinding struct {
+	Role    string   `json:"role"`
+	Members []string `json:"members"`
+}
+
+// resourceURL returns the URL of a resource given by its full resource name,
+// such as "//cloudresourcemanager.googleapis.com/projects/my-project". The
+// resource must follow the v1 conventions of the Google APIs for its IAM
+// policy.
+func (c *gcpClient) resourceURL(resource string) (string, error) {
+	if !strings.HasPrefix(resource, "//") {
+		return "", fmt.Errorf("%q is not a full resource name", resource)
+	}
+	parts := strings.SplitN(strings.TrimPrefix(resource, "//"), "/", 2)
+	if len(parts) != 2 || !strings.HasSuffix(parts[0], ".googleapis.com") || parts[1] == "" {
+		return "", fmt.Errorf("%q is not a full resource name", resource)
+	}
+	service := strings.TrimSuffix(parts[0], ".googleapis.com")
+	return c.serviceURL(service, "/v1/"+parts[1]), nil
+}
+
+// modifyIAMPolicy applies modify to the IAM policy of a resource, retrying
+// when the policy was changed concurrently. Resources which do not exist are
+// skipped if missingOK is set.
+func (c *gcpClient) modifyIAMPolicy(resource string, missingOK bool, modify func(*iamPolicy) bool) error {
+	resourceURL, err := c.resourceURL(resource)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		var policy iamPolicy
+		err := c.call("POST", resourceURL+":getIamPolicy", map[string]interface{}{}, &policy)
+		if missingOK && isStatus(err, http.StatusNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading IAM policy of %s: %s", resource, err)
+		}
+		if !modify(&policy) {
+			return nil
+		}
+
+		err = c.call("POST", resourceURL+":setIamPolicy", map[string]interface{}{
+			"policy": &policy,
+		}, nil)
+		// The etag of the policy fails the update if it changed meanwhile
+		if isStatus(err, http.StatusConflict) && attempt < 4 {
+			time.Sleep(time.Duration(attempt+1) * 200 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error setting IAM policy of %s: %s", resource, err)
+		}
+		return nil
+	}
+}
+
+// addBindings grants the roles on the resource to the member
+func (c *gcpClient) addBindings(resource, member string, roles []string) error {
+	return c.modifyIAMPolicy(resource, false, func(policy *iamPolicy) bool {
+		changed := false
+		for _, role := range roles {
+			var binding *iamBinding
+			for _, b := range policy.Bindings {
+				if b.Role == role {
+					binding = b
+					break
+				}
+			}
+			if binding == nil {
+				binding = &iamBinding{Role: role}
+				policy.Bindings = append(policy.Bindings, binding)
+			}
+			if !containsString(binding.Members, member) {
+				binding.Members = append(binding.Members, member)
+				changed = true
+			}
+		}
+		return changed
+	})
+}
+
+// removeBindings revokes the roles on the resource from the member. The
+// roles on resources which were deleted are already gone.
+func (c *gcpClient) removeBindings(resource, member string, roles []string) error {
+	return c.modifyIAMPolicy(resource, true, func(policy *iamPolicy) bool {
+		changed := false
+		bindings := policy.Bindings[:0]
+		for _, b := range policy.Bindings {
+			if containsString(roles, b.Role) {
+				members := b.Members[:0]
+				for _, m := range b.Members {
+					if m == member {
+						changed = true
+						continue
+					}
+					members = append(members, m)
+				}
+				b.Members = members
+			}
+			// Bindings without members are invalid
+			if len(b.Members) != 0 {
+				bindings = append(bindings, b)
+			}
+		}
+		policy.Bindings = bindings
+		return changed
+	})
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+package gcp
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+type configEntry struct {
+	Credentials string        `json:"credentials" mapstructure:"credentials"`
+	TTL         time.Duration `json:"ttl" mapstructure:"ttl"`
+	MaxTTL      time.Duration `json:"max_ttl" mapstructure:"max_ttl"`
+}
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"credentials": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `JSON key file of the service account Vault uses
+to manage service accounts, keys and IAM policies. The credentials of the
+metadata server are used if empty.`,
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default TTL for the leases of service account keys.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum TTL for the leases of service account keys.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+// Config returns the configuration of the backend
+func (b *backend) Config(s logical.Storage) (*configEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result configEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	// The credentials are not returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"ttl":     int64(config.TTL / time.Second),
+			"max_ttl": int64(config.MaxTTL / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &configEntry{}
+	}
+
+	// Omitted fields keep their value, so that the TTLs can be changed
+	// without providing the credentials again
+	if credsRaw, ok := data.GetOk("credentials"); ok {
+		config.Credentials = credsRaw.(string)
+		if config.Credentials != "" {
+			if _, err := parseCredentials([]byte(config.Credentials)); err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+	if ttlRaw, ok := data.GetOk("ttl"); ok {
+		config.TTL = time.Duration(ttlRaw.(int)) * time.Second
+	}
+	if maxTTLRaw, ok := data.GetOk("max_ttl"); ok {
+		config.MaxTTL = time.Duration(maxTTLRaw.(int)) * time.Second
+	}
+	if config.MaxTTL != 0 && config.TTL > config.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	b.resetClient()
+	return nil, nil
+}
+
+const pathConfigHelpSyn = `
+Configure the credentials and the lease TTLs of the backend.
+`
+
+const pathConfigHelpDesc = `
+This path configures the credentials Vault uses to call the Google Cloud
+APIs, as the JSON key file of a service account. The service account must
+be allowed to manage service accounts and their keys, and the IAM policies
+of the resources rolesets bind roles on. If no credentials are configured,
+Vault uses the service account of the Compute Engine instance it runs on.
+
+The credentials are never returned when reading the configuration.
+
+The "ttl" and "max_ttl" fields configure the leases of the service account
+keys issued by the backend, which default to the TTLs of the mount.
+`
@@ -0,0 +1,444 @@
+package gcp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// roleSet is a set of roles on Google Cloud resources, bound to a service
+// account the backend creates for the roleset
+type roleSet struct {
+	Name    string `json:"name"`
+	Project string `json:"project"`
+	account
+}
+
+func pathListRoleSets(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roleset/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleSetList,
+		},
+
+		HelpSynopsis:    pathRoleSetHelpSyn,
+		HelpDescription: pathRoleSetHelpDesc,
+	}
+}
+
+func pathRoleSet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roleset/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the roleset.",
+			},
+
+			"project": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Project the service account of the roleset is created in.",
+			},
+
+			"secret_type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: secretTypeAccessToken,
+				Description: `Type of the secrets of the roleset, "access_token"
+or "service_account_key".`,
+			},
+
+			"bindings": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Roles granted to the service account of the
+roleset, as HCL or JSON, optionally base64-encoded, in the form:
+resource "//cloudresourcemanager.googleapis.com/projects/my-project" { roles = ["roles/viewer"] }`,
+			},
+
+			"token_scopes": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `OAuth scopes of the access tokens of the roleset.
+Defaults to the cloud-platform scope.`,
+			},
+		},
+
+		ExistenceCheck: b.pathRoleSetExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleSetRead,
+			logical.CreateOperation: b.pathRoleSetWrite,
+			logical.UpdateOperation: b.pathRoleSetWrite,
+			logical.DeleteOperation: b.pathRoleSetDelete,
+		},
+
+		HelpSynopsis:    pathRoleSetHelpSyn,
+		HelpDescription: pathRoleSetHelpDesc,
+	}
+}
+
+func pathRoleSetRotate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roleset/" + framework.GenericNameRegex("name") + "/rotate",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the roleset.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRoleSetRotate,
+		},
+
+		HelpSynopsis:    pathRoleSetRotateHelpSyn,
+		HelpDescription: pathRoleSetRotateHelpDesc,
+	}
+}
+
+// RoleSet returns the named roleset
+func (b *backend) RoleSet(s logical.Storage, name string) (*roleSet, error) {
+	entry, err := s.Get("roleset/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleSet
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathRoleSetExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	rs, err := b.RoleSet(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return rs != nil, nil
+}
+
+func (b *backend) pathRoleSetList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("roleset/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleSetRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	rs, err := b.RoleSet(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"project":               rs.Project,
+			"secret_type":           rs.SecretType,
+			"bindings":              map[string][]string(rs.Bindings),
+			"token_scopes":          rs.TokenScopes,
+			"service_account_email": rs.ServiceAccountEmail,
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleSetWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	rs, err := b.RoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	var old *roleSet
+	if rs == nil {
+		rs = &roleSet{Name: name}
+		rs.SecretType = data.Get("secret_type").(string)
+	} else {
+		current := *rs
+		old = &current
+	}
+
+	if projectRaw, ok := data.GetOk("project"); ok {
+		rs.Project = projectRaw.(string)
+	}
+	if rs.Project == "" {
+		return logical.ErrorResponse("project is required"), nil
+	}
+
+	if bindingsRaw, ok := data.GetOk("bindings"); ok {
+		rs.RawBindings = bindingsRaw.(string)
+		rs.Bindings, err = parseBindings(rs.RawBindings)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+	if len(rs.Bindings) == 0 {
+		return logical.ErrorResponse("bindings are required"), nil
+	}
+
+	if secretTypeRaw, ok := data.GetOk("secret_type"); ok {
+		rs.SecretType = secretTypeRaw.(string)
+	}
+	if scopesRaw, ok := data.GetOk("token_scopes"); ok {
+		rs.TokenScopes = scopesRaw.([]string)
+	} else if rs.SecretType != secretTypeAccessToken {
+		rs.TokenScopes = nil
+	}
+	if err := rs.validateSecretType(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The service account of the roleset is replaced when its roles change,
+	// so that the roles are revoked from the keys already issued
+	if old == nil || old.Project != rs.Project || !old.Bindings.equal(rs.Bindings) {
+		return b.replaceRoleSetAccount(req.Storage, client, rs, old)
+	}
+
+	warning, err := client.syncTokenKey(&rs.account)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if err := putRoleSet(req.Storage, rs); err != nil {
+		return nil, err
+	}
+
+	if warning != "" {
+		resp := &logical.Response{}
+		resp.AddWarning(warning)
+		return resp, nil
+	}
+	return nil, nil
+}
+
+func (b *backend) pathRoleSetRotate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	old, err := b.RoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if old == nil {
+		return logical.ErrorResponse(fmt.Sprintf("roleset %q does not exist", name)), nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := *old
+	return b.replaceRoleSetAccount(req.Storage, client, &rs, old)
+}
+
+func (b *backend) pathRoleSetDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	rs, err := b.RoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		return nil, nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	walID, err := framework.PutWAL(req.Storage, walTypeAccount, &walAccount{
+		RoleSet:  rs.Name,
+		Email:    rs.ServiceAccountEmail,
+		Bindings: rs.Bindings,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %s", err)
+	}
+
+	if err := req.Storage.Delete("roleset/" + name); err != nil {
+		return nil, err
+	}
+
+	return b.cleanupAccount(req.Storage, client, walID, rs.ServiceAccountEmail, rs.Bindings), nil
+}
+
+// replaceRoleSetAccount creates a new service account for the roleset, with
+// its bindings, and then deletes the previous service account of the
+// roleset, which deletes the keys it issued
+func (b *backend) replaceRoleSetAccount(s logical.Storage, client *gcpClient,
+	rs *roleSet, old *roleSet) (*logical.Response, error) {
+	accountID := roleSetAccountID(rs.Name)
+	email := fmt.Sprintf("%s@%s.iam.gserviceaccount.com", accountID, rs.Project)
+
+	// The WAL entry deletes the service account if the roleset is not
+	// stored with it
+	walID, err := framework.PutWAL(s, walTypeAccount, &walAccount{
+		RoleSet:  rs.Name,
+		Email:    email,
+		Bindings: rs.Bindings,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error writing WAL entry: %s", err)
+	}
+
+	account, err := client.createServiceAccount(rs.Project, accountID,
+		fmt.Sprintf("Vault roleset %s", rs.Name))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	rs.ServiceAccountEmail = account.Email
+	if err := client.grant(rs.ServiceAccountEmail, rs.Bindings); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	rs.TokenKey = nil
+	if _, err := client.syncTokenKey(&rs.account); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// The WAL entry of the previous service account is written before the
+	// roleset, so that the account is cleaned up even if Vault stops
+	// before the cleanup below
+	var oldWALID string
+	if old != nil && old.ServiceAccountEmail != "" {
+		oldWALID, err = framework.PutWAL(s, walTypeAccount, &walAccount{
+			RoleSet:  old.Name,
+			Email:    old.ServiceAccountEmail,
+			Bindings: old.Bindings,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error writing WAL entry: %s", err)
+		}
+	}
+
+	if err := putRoleSet(s, rs); err != nil {
+		return nil, err
+	}
+	if err := framework.DeleteWAL(s, walID); err != nil {
+		return nil, fmt.Errorf("error deleting WAL entry: %s", err)
+	}
+
+	if oldWALID == "" {
+		return nil, nil
+	}
+	return b.cleanupAccount(s, client, oldWALID, old.ServiceAccountEmail, old.Bindings), nil
+}
+
+// cleanupAccount revokes the bindings of a service account the roleset no
+// longer uses and deletes it. Failures are returned as warnings, since the
+// WAL entry retries the cleanup later.
+func (b *backend) cleanupAccount(s logical.Storage, client *gcpClient,
+	walID, email string, bindings bindings) *logical.Response {
+	if err := client.deleteAccount(email, bindings); err != nil {
+		resp := &logical.Response{}
+		resp.AddWarning(fmt.Sprintf(
+			"the previous service account %s of the roleset could not be deleted, and will be cleaned up later: %s", email, err))
+		return resp
+	}
+
+	if err := framework.DeleteWAL(s, walID); err != nil {
+		resp := &logical.Response{}
+		resp.AddWarning(fmt.Sprintf("error deleting WAL entry: %s", err))
+		return resp
+	}
+
+	return nil
+}
+
+// deleteAccount revokes the bindings of a service account and deletes it
+func (c *gcpClient) deleteAccount(email string, bindings bindings) error {
+	if err := c.revoke(email, bindings); err != nil {
+		return err
+	}
+	return c.deleteServiceAccount(email)
+}
+
+func putRoleSet(s logical.Storage, rs *roleSet) error {
+	entry, err := logical.StorageEntryJSON("roleset/"+rs.Name, rs)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// roleSetAccountID returns a unique ID for a new service account of the
+// roleset. IDs are 6 to 30 lowercase letters, digits and dashes, starting
+// with a letter.
+func roleSetAccountID(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(name))
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if max := 30 - len("vault") - len(suffix) - 1; len(name) > max {
+		name = name[:max]
+	}
+	return fmt.Sprintf("vault%s-%s", name, suffix)
+}
+
+const pathRoleSetHelpSyn = `
+Manage the rolesets of the backend.
+`
+
+const pathRoleSetHelpDesc = `
+A roleset binds roles on Google Cloud resources to a service account the
+backend creates for it, in the configured project. The roleset issues
+either OAuth2 access tokens of the service account, minted with a key
+Vault holds, from the "roleset/<name>/token" path, or leased service
+account keys from the "roleset/<name>/key" path, depending on its
+"secret_type".
+
+The bindings are given as HCL or JSON, such as:
+
+    resource "//cloudresourcemanager.googleapis.com/projects/my-project" {
+      roles = ["roles/viewer"]
+    }
+
+Changing the project or the bindings of a roleset replaces its service
+account, which invalidates the keys and tokens already issued.
+`
+
+const pathRoleSetRotateHelpSyn = `
+Replace the service account of a roleset.
+`
+
+const pathRoleSetRotateHelpDesc = `
+This path creates a new service account for the roleset, with its
+bindings, and deletes the previous one, which invalidates all the keys
+and tokens the roleset issued.
+`
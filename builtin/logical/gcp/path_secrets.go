@@ -0,0 +1,183 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func keyFields(description string) map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: description,
+		},
+
+		"key_algorithm": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     defaultKeyAlgorithm,
+			Description: "Algorithm of the key, such as KEY_ALG_RSA_2048.",
+		},
+
+		"key_type": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     defaultKeyType,
+			Description: "Format of the private key, such as TYPE_GOOGLE_CREDENTIALS_FILE.",
+		},
+	}
+}
+
+func pathRoleSetToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roleset/" + framework.GenericNameRegex("name") + "/token",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the roleset.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleSetTokenRead,
+			logical.UpdateOperation: b.pathRoleSetTokenRead,
+		},
+
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
+	}
+}
+
+func pathRoleSetKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roleset/" + framework.GenericNameRegex("name") + "/key",
+		Fields:  keyFields("Name of the roleset."),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleSetKeyRead,
+			logical.UpdateOperation: b.pathRoleSetKeyRead,
+		},
+
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+func pathStaticAccountToken(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-account/" + framework.GenericNameRegex("name") + "/token",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static account.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticAccountTokenRead,
+			logical.UpdateOperation: b.pathStaticAccountTokenRead,
+		},
+
+		HelpSynopsis:    pathTokenHelpSyn,
+		HelpDescription: pathTokenHelpDesc,
+	}
+}
+
+func pathStaticAccountKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-account/" + framework.GenericNameRegex("name") + "/key",
+		Fields:  keyFields("Name of the static account."),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticAccountKeyRead,
+			logical.UpdateOperation: b.pathStaticAccountKeyRead,
+		},
+
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathRoleSetTokenRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	rs, err := b.RoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown roleset: %s", name)), nil
+	}
+
+	return b.tokenResponse(req.Storage, &rs.account, fmt.Sprintf("roleset %q", name))
+}
+
+func (b *backend) pathRoleSetKeyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	rs, err := b.RoleSet(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown roleset: %s", name)), nil
+	}
+
+	return b.keyResponse(req.Storage, &rs.account, fmt.Sprintf("roleset %q", name),
+		data.Get("key_algorithm").(string), data.Get("key_type").(string),
+		map[string]interface{}{
+			"roleset": name,
+		})
+}
+
+func (b *backend) pathStaticAccountTokenRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	sa, err := b.StaticAccount(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if sa == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown static account: %s", name)), nil
+	}
+
+	return b.tokenResponse(req.Storage, &sa.account, fmt.Sprintf("static account %q", name))
+}
+
+func (b *backend) pathStaticAccountKeyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	sa, err := b.StaticAccount(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if sa == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown static account: %s", name)), nil
+	}
+
+	return b.keyResponse(req.Storage, &sa.account, fmt.Sprintf("static account %q", name),
+		data.Get("key_algorithm").(string), data.Get("key_type").(string),
+		map[string]interface{}{
+			"static_account": name,
+		})
+}
+
+const pathTokenHelpSyn = `
+Generate an OAuth2 access token.
+`
+
+const pathTokenHelpDesc = `
+This path mints an OAuth2 access token of the service account, with the
+token scopes of the roleset or static account. Access tokens cannot be
+revoked, so they are not leased, and expire on their own after an hour.
+`
+
+const pathKeyHelpSyn = `
+Generate a service account key.
+`
+
+const pathKeyHelpDesc = `
+This path creates a key of the service account, which is leased and
+deleted when the lease is revoked. The private key is returned base64
+encoded, as a JSON credentials file by default.
+`
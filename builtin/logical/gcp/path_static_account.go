@@ -0,0 +1,281 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// staticAccount issues the secrets of an existing service account, which
+// the backend optionally binds roles to
+type staticAccount struct {
+	Name string `json:"name"`
+	account
+}
+
+func pathListStaticAccounts(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-account/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathStaticAccountList,
+		},
+
+		HelpSynopsis:    pathStaticAccountHelpSyn,
+		HelpDescription: pathStaticAccountHelpDesc,
+	}
+}
+
+func pathStaticAccount(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "static-account/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the static account.",
+			},
+
+			"service_account_email": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Email of the existing service account. Cannot be changed.",
+			},
+
+			"secret_type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: secretTypeAccessToken,
+				Description: `Type of the secrets of the static account,
+"access_token" or "service_account_key".`,
+			},
+
+			"bindings": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Roles granted to the service account, in the same
+format as the bindings of rolesets. Optional.`,
+			},
+
+			"token_scopes": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `OAuth scopes of the access tokens of the static
+account. Defaults to the cloud-platform scope.`,
+			},
+		},
+
+		ExistenceCheck: b.pathStaticAccountExistenceCheck,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathStaticAccountRead,
+			logical.CreateOperation: b.pathStaticAccountWrite,
+			logical.UpdateOperation: b.pathStaticAccountWrite,
+			logical.DeleteOperation: b.pathStaticAccountDelete,
+		},
+
+		HelpSynopsis:    pathStaticAccountHelpSyn,
+		HelpDescription: pathStaticAccountHelpDesc,
+	}
+}
+
+// StaticAccount returns the named static account
+func (b *backend) StaticAccount(s logical.Storage, name string) (*staticAccount, error) {
+	entry, err := s.Get("static-account/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result staticAccount
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathStaticAccountExistenceCheck(
+	req *logical.Request, data *framework.FieldData) (bool, error) {
+	sa, err := b.StaticAccount(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+
+	return sa != nil, nil
+}
+
+func (b *backend) pathStaticAccountList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("static-account/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathStaticAccountRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sa, err := b.StaticAccount(req.Storage, data.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if sa == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"service_account_email": sa.ServiceAccountEmail,
+			"secret_type":           sa.SecretType,
+			"bindings":              map[string][]string(sa.Bindings),
+			"token_scopes":          sa.TokenScopes,
+		},
+	}, nil
+}
+
+func (b *backend) pathStaticAccountWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	sa, err := b.StaticAccount(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	var oldBindings bindings
+	if sa == nil {
+		sa = &staticAccount{Name: name}
+		sa.SecretType = data.Get("secret_type").(string)
+		sa.ServiceAccountEmail = data.Get("service_account_email").(string)
+		if sa.ServiceAccountEmail == "" {
+			return logical.ErrorResponse("service_account_email is required"), nil
+		}
+	} else {
+		oldBindings = sa.Bindings
+		if email, ok := data.GetOk("service_account_email"); ok && email.(string) != sa.ServiceAccountEmail {
+			return logical.ErrorResponse("service_account_email cannot be changed"), nil
+		}
+	}
+
+	// Empty bindings revoke the roles the backend granted
+	if bindingsRaw, ok := data.GetOk("bindings"); ok {
+		sa.RawBindings = bindingsRaw.(string)
+		sa.Bindings = nil
+		if sa.RawBindings != "" {
+			sa.Bindings, err = parseBindings(sa.RawBindings)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), nil
+			}
+		}
+	}
+
+	if secretTypeRaw, ok := data.GetOk("secret_type"); ok {
+		sa.SecretType = secretTypeRaw.(string)
+	}
+	if scopesRaw, ok := data.GetOk("token_scopes"); ok {
+		sa.TokenScopes = scopesRaw.([]string)
+	} else if sa.SecretType != secretTypeAccessToken {
+		sa.TokenScopes = nil
+	}
+	if err := sa.validateSecretType(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := client.getServiceAccount(sa.ServiceAccountEmail)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if account == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"service account %s does not exist", sa.ServiceAccountEmail)), nil
+	}
+
+	if err := client.grant(sa.ServiceAccountEmail, sa.Bindings.subtract(oldBindings)); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	resp := &logical.Response{}
+	warning, err := client.syncTokenKey(&sa.account)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if warning != "" {
+		resp.AddWarning(warning)
+	}
+
+	entry, err := logical.StorageEntryJSON("static-account/"+name, sa)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	// The roles which are no longer bound are revoked once the static
+	// account is stored, so that they are never missing from the account
+	if err := client.revoke(sa.ServiceAccountEmail, oldBindings.subtract(sa.Bindings)); err != nil {
+		resp.AddWarning(fmt.Sprintf("the previous bindings could not be revoked: %s", err))
+	}
+
+	if len(resp.Warnings()) == 0 {
+		return nil, nil
+	}
+	return resp, nil
+}
+
+func (b *backend) pathStaticAccountDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	sa, err := b.StaticAccount(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if sa == nil {
+		return nil, nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// The service account itself is not managed by the backend, so only the
+	// roles and the token key of the backend are removed from it
+	if err := client.revoke(sa.ServiceAccountEmail, sa.Bindings); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if sa.TokenKey != nil {
+		if err := client.deleteServiceAccountKey(sa.TokenKey.Name); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	if err := req.Storage.Delete("static-account/" + name); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathStaticAccountHelpSyn = `
+Manage the static accounts of the backend.
+`
+
+const pathStaticAccountHelpDesc = `
+A static account issues the secrets of an existing service account, from
+the "static-account/<name>/token" or "static-account/<name>/key" paths
+depending on its "secret_type". The backend grants the roles of the
+optional bindings to the service account, and revokes them when they
+are removed from the static account or it is deleted. The service
+account itself is never deleted.
+`
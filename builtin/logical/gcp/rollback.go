@@ -0,0 +1,53 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/mitchellh/mapstructure"
+)
+
+const walTypeAccount = "account"
+
+// walAccount is a service account of a roleset to delete unless the roleset
+// uses it
+type walAccount struct {
+	RoleSet  string
+	Email    string
+	Bindings bindings
+}
+
+func (b *backend) walRollback(req *logical.Request, kind string, data interface{}) error {
+	switch kind {
+	case walTypeAccount:
+		return b.accountRollback(req, data)
+	default:
+		return fmt.Errorf("unknown type to rollback")
+	}
+}
+
+func (b *backend) accountRollback(req *logical.Request, data interface{}) error {
+	var entry walAccount
+	if err := mapstructure.Decode(data, &entry); err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// The account was stored with the roleset after all
+	rs, err := b.RoleSet(req.Storage, entry.RoleSet)
+	if err != nil {
+		return err
+	}
+	if rs != nil && rs.ServiceAccountEmail == entry.Email {
+		return nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return err
+	}
+
+	return client.deleteAccount(entry.Email, entry.Bindings)
+}
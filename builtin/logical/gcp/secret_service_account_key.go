@@ -0,0 +1,102 @@
+package gcp
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const SecretServiceAccountKeyType = "service_account_key"
+
+func secretServiceAccountKey(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretServiceAccountKeyType,
+		Fields: map[string]*framework.FieldSchema{
+			"private_key_data": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64-encoded private key of the service account key",
+			},
+
+			"key_algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Algorithm of the key",
+			},
+
+			"key_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Format of the private key",
+			},
+		},
+
+		Renew:  b.secretServiceAccountKeyRenew,
+		Revoke: b.secretServiceAccountKeyRevoke,
+	}
+}
+
+func (b *backend) secretServiceAccountKeyRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	email, ok := req.Secret.InternalData["service_account_email"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing service_account_email internal data")
+	}
+
+	// Keys of service accounts the roleset or static account replaced are not
+	// renewed, since they no longer have its bindings
+	var a *account
+	if name, ok := req.Secret.InternalData["roleset"].(string); ok {
+		rs, err := b.RoleSet(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if rs == nil {
+			return logical.ErrorResponse(fmt.Sprintf("roleset %q was deleted", name)), nil
+		}
+		a = &rs.account
+	} else if name, ok := req.Secret.InternalData["static_account"].(string); ok {
+		sa, err := b.StaticAccount(req.Storage, name)
+		if err != nil {
+			return nil, err
+		}
+		if sa == nil {
+			return logical.ErrorResponse(fmt.Sprintf("static account %q was deleted", name)), nil
+		}
+		a = &sa.account
+	} else {
+		return nil, fmt.Errorf("secret is missing roleset or static_account internal data")
+	}
+	if a.ServiceAccountEmail != email || a.SecretType != secretTypeKey {
+		return logical.ErrorResponse("the service account of the key was replaced, and the key cannot be renewed"), nil
+	}
+
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &configEntry{}
+	}
+
+	f := framework.LeaseExtend(config.TTL, config.MaxTTL, b.System())
+	return f(req, d)
+}
+
+func (b *backend) secretServiceAccountKeyRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keyName, ok := req.Secret.InternalData["key_name"].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret is missing key_name internal data")
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys deleted with their service account are already gone
+	if err := client.deleteServiceAccountKey(keyName); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,251 @@
+package kv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// defaultMaxVersions is the number of versions kept per key, unless
+	// configured otherwise
+	defaultMaxVersions = 10
+
+	// metadataPrefix is the storage prefix of the metadata of keys, which
+	// are stored under their own path so that they can be listed
+	metadataPrefix = "metadata/"
+
+	// maxCustomMetadataKeys, maxCustomMetadataKeyLength and
+	// maxCustomMetadataValueLength bound the custom metadata of a key
+	maxCustomMetadataKeys        = 64
+	maxCustomMetadataKeyLength   = 128
+	maxCustomMetadataValueLength = 512
+
+	// versionsPrefix is the storage prefix of the versions of keys, which
+	// are stored under the hash of their key
+	versionsPrefix = "versions/"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	b, err := Backend()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.Setup(conf); err != nil {
+		return nil, err
+	}
+	if err := b.setupUpgrade(conf); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func Backend() (*backend, error) {
+	b := &backend{
+		keyLocksMap:   map[string]*sync.RWMutex{},
+		upgradeStopCh: make(chan struct{}),
+		upgradeDoneCh: make(chan struct{}),
+	}
+
+	// Keys are locked by the first byte of their hash, which spreads them
+	// over 256 locks
+	if err := locksutil.CreateLocks(b.keyLocksMap, 256); err != nil {
+		return nil, fmt.Errorf("failed to create key locks: %v", err)
+	}
+
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(b),
+			pathData(b),
+			pathDelete(b),
+			pathUndelete(b),
+			pathDestroy(b),
+			pathMetadata(b),
+		},
+
+		Clean: b.cleanup,
+	}
+	return b, nil
+}
+
+type backend struct {
+	*framework.Backend
+
+	// Map of locks guarding the metadata and versions of keys
+	keyLocksMap map[string]*sync.RWMutex
+
+	// upgrading is set while the secrets of a mount upgraded from the
+	// generic backend are rewritten, which stops when upgradeStopCh is
+	// closed, and upgradeDoneCh is closed once the upgrade returns
+	upgrading     uint32
+	upgradeStopCh chan struct{}
+	upgradeDoneCh chan struct{}
+}
+
+func (b *backend) cleanup() {
+	close(b.upgradeStopCh)
+}
+
+// keyMetadata holds the versions of a key
+type keyMetadata struct {
+	Key            string                      `json:"key"`
+	Versions       map[uint64]*versionMetadata `json:"versions"`
+	CurrentVersion uint64                      `json:"current_version"`
+	OldestVersion  uint64                      `json:"oldest_version"`
+
+	// MaxVersions overrides the number of versions kept of the key, if set
+	MaxVersions int `json:"max_versions"`
+
+	// CustomMetadata is set by operators to describe the key, such as its
+	// owner. It is not part of the data of the key, and is read and written
+	// along with its metadata.
+	CustomMetadata map[string]string `json:"custom_metadata"`
+
+	CreatedTime time.Time `json:"created_time"`
+	UpdatedTime time.Time `json:"updated_time"`
+}
+
+// versionMetadata holds whether a version of a key was deleted, which can
+// be undone, or destroyed, which cannot
+type versionMetadata struct {
+	CreatedTime  time.Time `json:"created_time"`
+	DeletionTime time.Time `json:"deletion_time"`
+	Destroyed    bool      `json:"destroyed"`
+}
+
+// versionData is the data of a version of a key
+type versionData struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// keyHash returns the hash of a key, under which its versions are stored
+func keyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyLock returns the lock guarding the metadata and versions of a key
+func (b *backend) keyLock(key string) *sync.RWMutex {
+	return b.keyLocksMap[keyHash(key)[0:2]]
+}
+
+// versionStorageKey returns the storage key of a version of a key
+func versionStorageKey(key string, version uint64) string {
+	return versionsPrefix + keyHash(key) + "/" + strconv.FormatUint(version, 10)
+}
+
+// keyMetadata returns the metadata of a key, or nil if it does not exist
+func (b *backend) keyMetadata(s logical.Storage, key string) (*keyMetadata, error) {
+	entry, err := s.Get(metadataPrefix + key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var meta keyMetadata
+	if err := entry.DecodeJSON(&meta); err != nil {
+		return nil, err
+	}
+	if meta.Versions == nil {
+		meta.Versions = make(map[uint64]*versionMetadata)
+	}
+	return &meta, nil
+}
+
+func (b *backend) putKeyMetadata(s logical.Storage, meta *keyMetadata) error {
+	entry, err := logical.StorageEntryJSON(metadataPrefix+meta.Key, meta)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// maxVersions returns the number of versions kept of a key
+func (b *backend) maxVersions(s logical.Storage, meta *keyMetadata) (int, error) {
+	if meta.MaxVersions != 0 {
+		return meta.MaxVersions, nil
+	}
+	config, err := b.config(s)
+	if err != nil {
+		return 0, err
+	}
+	if config.MaxVersions != 0 {
+		return config.MaxVersions, nil
+	}
+	return defaultMaxVersions, nil
+}
+
+// pruneVersions destroys the oldest versions of a key past the number of
+// versions kept
+func (b *backend) pruneVersions(s logical.Storage, meta *keyMetadata) error {
+	max, err := b.maxVersions(s, meta)
+	if err != nil {
+		return err
+	}
+	for meta.OldestVersion != 0 && meta.CurrentVersion-meta.OldestVersion >= uint64(max) {
+		if err := s.Delete(versionStorageKey(meta.Key, meta.OldestVersion)); err != nil {
+			return err
+		}
+		delete(meta.Versions, meta.OldestVersion)
+		meta.OldestVersion++
+	}
+	return nil
+}
+
+// formatTime formats the times of versions, which are empty if zero
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// versionResponseData returns the metadata of a version as returned by the
+// backend
+func versionResponseData(version uint64, vm *versionMetadata) map[string]interface{} {
+	return map[string]interface{}{
+		"version":       version,
+		"created_time":  formatTime(vm.CreatedTime),
+		"deletion_time": formatTime(vm.DeletionTime),
+		"destroyed":     vm.Destroyed,
+	}
+}
+
+// parseVersions parses the versions given to the delete, undelete and
+// destroy endpoints
+func parseVersions(raw []string) ([]uint64, error) {
+	versions := make([]uint64, 0, len(raw))
+	for _, v := range raw {
+		version, err := strconv.ParseUint(strings.TrimSpace(v), 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no versions given")
+	}
+	return versions, nil
+}
+
+const backendHelp = `
+The kv backend stores arbitrary secrets, keeping several versions of each.
+
+Secrets are written and read at "data/<path>". Writing a secret adds a new
+version, the oldest versions being dropped past the number of versions
+kept. Versions can be deleted, which can be undone with "undelete/<path>",
+or destroyed, which permanently removes their data. The versions of a
+secret are listed at "metadata/<path>".
+`
@@ -0,0 +1,541 @@
+package kv
+
+import (
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func testBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path, value string) uint64 {
+	resp := testRequest(t, b, s, logical.UpdateOperation, "data/"+path, map[string]interface{}{
+		"data": map[string]interface{}{
+			"value": value,
+		},
+	})
+	return resp.Data["version"].(uint64)
+}
+
+// testRead returns the value of a version of a secret, or an empty string
+// if it was deleted or destroyed
+func testRead(t *testing.T, b *backend, s logical.Storage, path string, version int) string {
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/"+path, map[string]interface{}{
+		"version": version,
+	})
+	if resp == nil {
+		t.Fatalf("no version %d of %s", version, path)
+	}
+	data, _ := resp.Data["data"].(map[string]interface{})
+	if data == nil {
+		return ""
+	}
+	return data["value"].(string)
+}
+
+func TestBackend_versions(t *testing.T) {
+	b, s := testBackend(t)
+
+	for i, value := range []string{"one", "two", "three"} {
+		if version := testWrite(t, b, s, "foo/bar", value); version != uint64(i+1) {
+			t.Fatalf("bad: %d", version)
+		}
+	}
+	if value := testRead(t, b, s, "foo/bar", 0); value != "three" {
+		t.Fatalf("bad: %s", value)
+	}
+	if value := testRead(t, b, s, "foo/bar", 1); value != "one" {
+		t.Fatalf("bad: %s", value)
+	}
+	if resp := testRequest(t, b, s, logical.ReadOperation, "data/foo/bar", map[string]interface{}{
+		"version": 4,
+	}); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if resp := testRequest(t, b, s, logical.ReadOperation, "data/foo/baz", nil); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Deleting the secret deletes its current version
+	testRequest(t, b, s, logical.DeleteOperation, "data/foo/bar", nil)
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/foo/bar", nil)
+	metadata := resp.Data["metadata"].(map[string]interface{})
+	if resp.Data["data"] != nil || metadata["version"] != uint64(3) || metadata["deletion_time"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if value := testRead(t, b, s, "foo/bar", 2); value != "two" {
+		t.Fatalf("bad: %s", value)
+	}
+
+	// Deleted versions can be undeleted, destroyed ones cannot
+	testRequest(t, b, s, logical.UpdateOperation, "delete/foo/bar", map[string]interface{}{
+		"versions": "1,2",
+	})
+	testRequest(t, b, s, logical.UpdateOperation, "destroy/foo/bar", map[string]interface{}{
+		"versions": []interface{}{"1"},
+	})
+	testRequest(t, b, s, logical.UpdateOperation, "undelete/foo/bar", map[string]interface{}{
+		"versions": "1,2,3",
+	})
+	for version, expected := range []string{"three", "", "two", "three"} {
+		if value := testRead(t, b, s, "foo/bar", version); value != expected {
+			t.Fatalf("version %d: bad: %s", version, value)
+		}
+	}
+	if entry, err := s.Get(versionStorageKey("foo/bar", 1)); err != nil || entry != nil {
+		t.Fatalf("destroyed version was not removed: %#v %v", entry, err)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "destroy/foo/bar",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"versions": "one",
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	resp = testRequest(t, b, s, logical.ReadOperation, "metadata/foo/bar", nil)
+	versions := resp.Data["versions"].(map[string]interface{})
+	if resp.Data["current_version"] != uint64(3) || resp.Data["oldest_version"] != uint64(1) || len(versions) != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if versions["1"].(map[string]interface{})["destroyed"] != true {
+		t.Fatalf("bad: %#v", versions)
+	}
+}
+
+func TestBackend_maxVersions(t *testing.T) {
+	b, s := testBackend(t)
+
+	testRequest(t, b, s, logical.UpdateOperation, "config", map[string]interface{}{
+		"max_versions": 3,
+	})
+	resp := testRequest(t, b, s, logical.ReadOperation, "config", nil)
+	if resp.Data["max_versions"] != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, value := range []string{"one", "two", "three", "four", "five"} {
+		testWrite(t, b, s, "foo", value)
+	}
+	resp = testRequest(t, b, s, logical.ReadOperation, "metadata/foo", nil)
+	if resp.Data["oldest_version"] != uint64(3) || len(resp.Data["versions"].(map[string]interface{})) != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp := testRequest(t, b, s, logical.ReadOperation, "data/foo", map[string]interface{}{
+		"version": 2,
+	}); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if entry, _ := s.Get(versionStorageKey("foo", 2)); entry != nil {
+		t.Fatalf("pruned version was not removed")
+	}
+
+	// The number of versions kept of a key overrides the configuration
+	testRequest(t, b, s, logical.UpdateOperation, "metadata/foo", map[string]interface{}{
+		"max_versions": 1,
+	})
+	resp = testRequest(t, b, s, logical.ReadOperation, "metadata/foo", nil)
+	if resp.Data["oldest_version"] != uint64(5) || resp.Data["max_versions"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if value := testRead(t, b, s, "foo", 0); value != "five" {
+		t.Fatalf("bad: %s", value)
+	}
+}
+
+func TestBackend_metadata(t *testing.T) {
+	b, s := testBackend(t)
+
+	testWrite(t, b, s, "foo", "one")
+	testWrite(t, b, s, "foo/bar", "two")
+	testWrite(t, b, s, "foo/bar", "three")
+	testWrite(t, b, s, "baz/qux", "four")
+
+	resp := testRequest(t, b, s, logical.ListOperation, "metadata/", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"baz/", "foo", "foo/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testRequest(t, b, s, logical.ListOperation, "metadata/foo", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"bar"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Deleting the metadata of a key removes all its versions
+	testRequest(t, b, s, logical.DeleteOperation, "metadata/foo/bar", nil)
+	if resp := testRequest(t, b, s, logical.ReadOperation, "data/foo/bar", nil); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	keys, err := s.List(versionsPrefix + keyHash("foo/bar") + "/")
+	if err != nil || len(keys) != 0 {
+		t.Fatalf("bad: %#v %v", keys, err)
+	}
+	if value := testRead(t, b, s, "foo", 0); value != "one" {
+		t.Fatalf("bad: %s", value)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "data/foo/",
+		Storage:   s,
+		Data: map[string]interface{}{
+			"data": map[string]interface{}{},
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_checkAndSet(t *testing.T) {
+	b, s := testBackend(t)
+
+	write := func(cas int) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "data/foo",
+			Storage:   s,
+			Data: map[string]interface{}{
+				"data": map[string]interface{}{
+					"value": "bar",
+				},
+				"cas": cas,
+			},
+		})
+	}
+
+	// Zero requires the secret not to exist
+	for i, cas := range []int{0, 1, 2} {
+		resp, err := write(cas)
+		if err != nil || resp.Data["version"] != uint64(i+1) {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+
+	for _, cas := range []int{0, 2, 4} {
+		resp, err := write(cas)
+		if err != logical.ErrConflict || resp == nil || !resp.IsError() {
+			t.Fatalf("expected conflict: %#v %v", resp, err)
+		}
+	}
+	if resp, err := write(-1); err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// Writes without cas are not checked
+	if version := testWrite(t, b, s, "foo", "baz"); version != 4 {
+		t.Fatalf("bad: %d", version)
+	}
+}
+
+func TestBackend_patch(t *testing.T) {
+	b, s := testBackend(t)
+
+	patch := func(cas interface{}, data map[string]interface{}) (*logical.Response, error) {
+		req := &logical.Request{
+			Operation: logical.PatchOperation,
+			Path:      "data/foo",
+			Storage:   s,
+			Data: map[string]interface{}{
+				"data": data,
+			},
+		}
+		if cas != nil {
+			req.Data["cas"] = cas
+		}
+		return b.HandleRequest(req)
+	}
+
+	// Secrets must exist to be patched
+	if resp, err := patch(nil, map[string]interface{}{"a": "b"}); err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	testRequest(t, b, s, logical.UpdateOperation, "data/foo", map[string]interface{}{
+		"data": map[string]interface{}{
+			"user":     "alice",
+			"password": "secret",
+			"options": map[string]interface{}{
+				"ssl":  true,
+				"port": 5432,
+			},
+		},
+	})
+
+	resp, err := patch(nil, map[string]interface{}{
+		"password": "changed",
+		"user":     nil,
+		"options": map[string]interface{}{
+			"port":    nil,
+			"timeout": "5s",
+		},
+	})
+	if err != nil || resp.Data["version"] != uint64(2) {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp = testRequest(t, b, s, logical.ReadOperation, "data/foo", nil)
+	expected := map[string]interface{}{
+		"password": "changed",
+		"options": map[string]interface{}{
+			"ssl":     true,
+			"timeout": "5s",
+		},
+	}
+	if !reflect.DeepEqual(resp.Data["data"], expected) {
+		t.Fatalf("got: %#v expected: %#v", resp.Data["data"], expected)
+	}
+
+	// Patches can be checked
+	if resp, err := patch(1, map[string]interface{}{"a": "b"}); err != logical.ErrConflict || !resp.IsError() {
+		t.Fatalf("expected conflict: %#v %v", resp, err)
+	}
+	if resp, err := patch(2, map[string]interface{}{"a": "b"}); err != nil || resp.Data["version"] != uint64(3) {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Deleted secrets cannot be patched
+	testRequest(t, b, s, logical.DeleteOperation, "data/foo", nil)
+	if resp, err := patch(nil, map[string]interface{}{"a": "b"}); err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_customMetadata(t *testing.T) {
+	b, s := testBackend(t)
+
+	testRequest(t, b, s, logical.UpdateOperation, "metadata/foo", map[string]interface{}{
+		"custom_metadata": map[string]interface{}{
+			"owner":          "team-a",
+			"classification": "internal",
+		},
+	})
+	testWrite(t, b, s, "foo", "bar")
+
+	// Custom metadata is kept across writes, and not returned with the data
+	resp := testRequest(t, b, s, logical.ReadOperation, "metadata/foo", nil)
+	expected := map[string]string{
+		"owner":          "team-a",
+		"classification": "internal",
+	}
+	if !reflect.DeepEqual(resp.Data["custom_metadata"], expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testRequest(t, b, s, logical.ReadOperation, "data/foo", nil)
+	if _, ok := resp.Data["data"].(map[string]interface{})["owner"]; ok {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Writing custom metadata replaces it
+	testRequest(t, b, s, logical.UpdateOperation, "metadata/foo", map[string]interface{}{
+		"custom_metadata": map[string]interface{}{
+			"rotated": "2016-09-12",
+		},
+	})
+	resp = testRequest(t, b, s, logical.ReadOperation, "metadata/foo", nil)
+	if !reflect.DeepEqual(resp.Data["custom_metadata"], map[string]string{"rotated": "2016-09-12"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, customMetadata := range []map[string]interface{}{
+		{"owner": 1},
+		{"": "team-a"},
+		{"owner": strings.Repeat("a", maxCustomMetadataValueLength+1)},
+	} {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "metadata/foo",
+			Storage:   s,
+			Data: map[string]interface{}{
+				"custom_metadata": customMetadata,
+			},
+		})
+		if err != nil || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error: %#v %v", resp, err)
+		}
+	}
+}
+
+func testPutLegacy(t *testing.T, s logical.Storage, key, value string) {
+	entry, err := logical.StorageEntryJSON(key, map[string]interface{}{
+		"value": value,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackend_upgrade(t *testing.T) {
+	s := &logical.InmemStorage{}
+	testPutLegacy(t, s, "foo", "bar")
+	testPutLegacy(t, s, "team/app/db", "secret")
+
+	config := logical.TestBackendConfig()
+	config.StorageView = s
+	config.Config = map[string]string{"upgrade": "true"}
+	raw, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := raw.(*backend)
+	defer b.Cleanup()
+
+	select {
+	case <-b.upgradeDoneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upgrade did not complete")
+	}
+	if b.isUpgrading() {
+		t.Fatal("still upgrading")
+	}
+
+	// The secrets are the first versions of keys, the generic secrets are
+	// removed, and the upgrade is marked completed
+	if v := testRead(t, b, s, "foo", 1); v != "bar" {
+		t.Fatalf("bad: %q", v)
+	}
+	if v := testRead(t, b, s, "team/app/db", 0); v != "secret" {
+		t.Fatalf("bad: %q", v)
+	}
+	for _, key := range []string{"foo", "team/app/db"} {
+		if entry, err := s.Get(key); err != nil || entry != nil {
+			t.Fatalf("bad: %s: %#v %v", key, entry, err)
+		}
+	}
+	if upgrade, err := getUpgradeEntry(s); err != nil || upgrade == nil || !upgrade.Completed {
+		t.Fatalf("bad: %#v %v", upgrade, err)
+	}
+
+	if version := testWrite(t, b, s, "foo", "baz"); version != 2 {
+		t.Fatalf("bad: %d", version)
+	}
+
+	// The upgrade option stays in the mount table, and does not start the
+	// upgrade again once it completed
+	raw, err = Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remounted := raw.(*backend)
+	defer remounted.Cleanup()
+	if remounted.isUpgrading() {
+		t.Fatal("upgrading again")
+	}
+	if v := testRead(t, remounted, s, "foo", 0); v != "baz" {
+		t.Fatalf("bad: %q", v)
+	}
+}
+
+func TestBackend_upgradeResume(t *testing.T) {
+	s := &logical.InmemStorage{}
+	testPutLegacy(t, s, "foo", "bar")
+	entry, err := logical.StorageEntryJSON(upgradeKey, &upgradeEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+
+	config := logical.TestBackendConfig()
+	config.StorageView = s
+	raw, err := Factory(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := raw.(*backend)
+	defer b.Cleanup()
+
+	select {
+	case <-b.upgradeDoneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("upgrade did not complete")
+	}
+	if v := testRead(t, b, s, "foo", 1); v != "bar" {
+		t.Fatalf("bad: %q", v)
+	}
+}
+
+func TestBackend_upgradeConflict(t *testing.T) {
+	s := &logical.InmemStorage{}
+	testPutLegacy(t, s, "metadata/foo", "bar")
+
+	config := logical.TestBackendConfig()
+	config.StorageView = s
+	config.Config = map[string]string{"upgrade": "true"}
+	if _, err := Factory(config); err == nil {
+		t.Fatal("expected error")
+	}
+	if entry, err := s.Get(upgradeKey); err != nil || entry != nil {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+}
+
+func TestBackend_upgradeReads(t *testing.T) {
+	b, s := testBackend(t)
+	testPutLegacy(t, s, "foo", "bar")
+	atomic.StoreUint32(&b.upgrading, 1)
+
+	// Secrets not rewritten yet are read as their first version
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/foo", nil)
+	if resp.Data["data"].(map[string]interface{})["value"] != "bar" ||
+		resp.Data["metadata"].(map[string]interface{})["version"] != uint64(1) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testRequest(t, b, s, logical.ReadOperation, "data/foo", map[string]interface{}{
+		"version": 2,
+	})
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Other requests are rejected until the upgrade completes
+	for _, req := range []*logical.Request{
+		{Operation: logical.UpdateOperation, Path: "data/foo", Data: map[string]interface{}{"data": map[string]interface{}{"value": "baz"}}},
+		{Operation: logical.ReadOperation, Path: "metadata/foo"},
+		{Operation: logical.ListOperation, Path: "metadata/"},
+	} {
+		req.Storage = s
+		resp, err := b.HandleRequest(req)
+		if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+			t.Fatalf("expected error: %s %s: %#v %v", req.Operation, req.Path, resp, err)
+		}
+	}
+
+	atomic.StoreUint32(&b.upgrading, 0)
+	testWrite(t, b, s, "foo", "baz")
+}
@@ -0,0 +1,98 @@
+package kv
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"max_versions": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "The number of versions kept per key. Defaults to 10.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) config(s logical.Storage) (*configEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	var result configEntry
+	if entry != nil {
+		if err := entry.DecodeJSON(&result); err != nil {
+			return nil, err
+		}
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	maxVersions := config.MaxVersions
+	if maxVersions == 0 {
+		maxVersions = defaultMaxVersions
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"max_versions": maxVersions,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxVersions, ok := d.GetOk("max_versions"); ok {
+		if maxVersions.(int) < 0 {
+			return logical.ErrorResponse("max_versions cannot be negative"), nil
+		}
+		config.MaxVersions = maxVersions.(int)
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(entry)
+}
+
+type configEntry struct {
+	// MaxVersions is the number of versions kept per key, unless set on
+	// the key, or zero for the default
+	MaxVersions int `json:"max_versions"`
+}
+
+const pathConfigHelpSyn = `
+Configure the number of versions kept per key.
+`
+
+const pathConfigHelpDesc = `
+Writing a key adds a new version of it. Past the number of versions kept,
+which defaults to 10, its oldest version is destroyed. The number of
+versions kept of a key can be overridden in its metadata.
+
+Lowering the number of versions kept destroys the oldest versions of keys
+the next time they are written.
+`
@@ -0,0 +1,316 @@
+package kv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathData(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "data/(?P<path>.*)",
+		Fields: map[string]*framework.FieldSchema{
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Location of the secret.",
+			},
+			"version": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "The version to read. Defaults to the current version.",
+			},
+			"data": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: "The data of the new version of the secret.",
+			},
+			"cas": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "If set, the write is only made if the current version of the secret is this version, zero meaning that the secret must not exist.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathDataRead,
+			logical.UpdateOperation: b.pathDataWrite,
+			logical.PatchOperation:  b.pathDataPatch,
+			logical.DeleteOperation: b.pathDataDelete,
+		},
+
+		HelpSynopsis:    pathDataHelpSyn,
+		HelpDescription: pathDataHelpDesc,
+	}
+}
+
+// validKey returns an error response if a key cannot hold a secret
+func validKey(key string) *logical.Response {
+	if key == "" {
+		return logical.ErrorResponse("missing path")
+	}
+	if strings.HasSuffix(key, "/") {
+		return logical.ErrorResponse("path cannot end in '/'")
+	}
+	return nil
+}
+
+func (b *backend) pathDataRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+
+	lock := b.keyLock(key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		// The secret may not be rewritten yet by the upgrade of a generic
+		// mount
+		if b.isUpgrading() {
+			return b.legacyRead(req.Storage, key, d.Get("version").(int))
+		}
+		return nil, nil
+	}
+
+	version := meta.CurrentVersion
+	if v := d.Get("version").(int); v > 0 {
+		version = uint64(v)
+	}
+	vm, ok := meta.Versions[version]
+	if !ok {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"data":     nil,
+			"metadata": versionResponseData(version, vm),
+		},
+	}
+
+	// The metadata of deleted and destroyed versions is returned, so that
+	// clients can tell them from secrets that do not exist
+	if !vm.DeletionTime.IsZero() || vm.Destroyed {
+		return resp, nil
+	}
+
+	entry, err := req.Storage.Get(versionStorageKey(key, version))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return resp, nil
+	}
+	var data versionData
+	if err := entry.DecodeJSON(&data); err != nil {
+		return nil, err
+	}
+	resp.Data["data"] = data.Data
+	return resp, nil
+}
+
+func (b *backend) pathDataWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+	data, ok := d.GetOk("data")
+	if !ok {
+		return logical.ErrorResponse("missing data"), nil
+	}
+
+	lock := b.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = &keyMetadata{
+			Key:         key,
+			Versions:    make(map[uint64]*versionMetadata),
+			CreatedTime: time.Now().UTC(),
+		}
+	}
+	if resp, err := checkAndSet(d, meta); resp != nil || err != nil {
+		return resp, err
+	}
+
+	return b.putVersion(req.Storage, meta, data.(map[string]interface{}))
+}
+
+// pathDataPatch adds a new version of a key, merging the given data into
+// its current version following JSON merge patch semantics: fields holding
+// null are removed, and objects are merged recursively
+func (b *backend) pathDataPatch(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+	patch, ok := d.GetOk("data")
+	if !ok {
+		return logical.ErrorResponse("missing data"), nil
+	}
+
+	lock := b.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil || meta.CurrentVersion == 0 {
+		return logical.ErrorResponse("no secret to patch"), logical.ErrInvalidRequest
+	}
+	if vm := meta.Versions[meta.CurrentVersion]; vm == nil || !vm.DeletionTime.IsZero() || vm.Destroyed {
+		return logical.ErrorResponse("the current version of the secret was deleted"), logical.ErrInvalidRequest
+	}
+	if resp, err := checkAndSet(d, meta); resp != nil || err != nil {
+		return resp, err
+	}
+
+	entry, err := req.Storage.Get(versionStorageKey(key, meta.CurrentVersion))
+	if err != nil {
+		return nil, err
+	}
+	var current versionData
+	if entry != nil {
+		if err := entry.DecodeJSON(&current); err != nil {
+			return nil, err
+		}
+	}
+
+	data := mergePatch(current.Data, patch.(map[string]interface{}))
+	return b.putVersion(req.Storage, meta, data.(map[string]interface{}))
+}
+
+// checkAndSet returns an error response if the write is a check-and-set
+// write, and was not made from the current version of the key. It keeps
+// concurrent writers from overwriting each other.
+func checkAndSet(d *framework.FieldData, meta *keyMetadata) (*logical.Response, error) {
+	cas, ok := d.GetOk("cas")
+	if !ok {
+		return nil, nil
+	}
+	if cas.(int) < 0 {
+		return logical.ErrorResponse("cas cannot be negative"), nil
+	}
+	if uint64(cas.(int)) != meta.CurrentVersion {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"check-and-set parameter did not match the current version %d", meta.CurrentVersion)), logical.ErrConflict
+	}
+	return nil, nil
+}
+
+// putVersion stores a new version of a key, and prunes its oldest versions
+func (b *backend) putVersion(s logical.Storage, meta *keyMetadata, data map[string]interface{}) (*logical.Response, error) {
+	now := time.Now().UTC()
+	version := meta.CurrentVersion + 1
+	entry, err := logical.StorageEntryJSON(versionStorageKey(meta.Key, version), &versionData{
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Put(entry); err != nil {
+		return nil, err
+	}
+
+	vm := &versionMetadata{
+		CreatedTime: now,
+	}
+	meta.Versions[version] = vm
+	meta.CurrentVersion = version
+	meta.UpdatedTime = now
+	if meta.OldestVersion == 0 {
+		meta.OldestVersion = version
+	}
+	if err := b.pruneVersions(s, meta); err != nil {
+		return nil, err
+	}
+	if err := b.putKeyMetadata(s, meta); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: versionResponseData(version, vm),
+	}, nil
+}
+
+// mergePatch applies a JSON merge patch to a value, as defined by RFC 7386
+func mergePatch(target, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	result := make(map[string]interface{})
+	if targetMap, ok := target.(map[string]interface{}); ok {
+		for k, v := range targetMap {
+			result[k] = v
+		}
+	}
+	for k, v := range patchMap {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = mergePatch(result[k], v)
+	}
+	return result
+}
+
+// pathDataDelete deletes the current version of a key
+func (b *backend) pathDataDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+
+	lock := b.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+	return nil, b.deleteVersions(req.Storage, meta, []uint64{meta.CurrentVersion})
+}
+
+const pathDataHelpSyn = `
+Write, read and delete the versions of secrets.
+`
+
+const pathDataHelpDesc = `
+Writing a secret adds a new version of it, holding the given "data". If
+"cas" is given, the write is rejected unless it is the current version of
+the secret, zero meaning that the secret must not exist.
+
+Patching a secret adds a new version of it, merging the given "data" into
+its current version: fields holding null are removed, and objects are
+merged recursively. Patches can also be checked with "cas".
+
+Reads return the current version of a secret, or the version given as
+"version", along with its metadata. The data of deleted and destroyed
+versions is not returned.
+
+Deleting a secret deletes its current version, which can be undone with
+"undelete/<path>". Its data is only removed when it is destroyed, or once
+it is the oldest of more versions than are kept.
+`
@@ -0,0 +1,159 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// versionsFields are the fields of the endpoints acting on versions of keys
+func versionsFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"path": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Location of the secret.",
+		},
+		"versions": &framework.FieldSchema{
+			Type:        framework.TypeCommaStringSlice,
+			Description: "The versions of the secret.",
+		},
+	}
+}
+
+func pathDelete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "delete/(?P<path>.*)",
+		Fields:  versionsFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.versionsOperation(b.deleteVersions),
+		},
+
+		HelpSynopsis:    pathDeleteHelpSyn,
+		HelpDescription: pathDeleteHelpDesc,
+	}
+}
+
+func pathUndelete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "undelete/(?P<path>.*)",
+		Fields:  versionsFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.versionsOperation(b.undeleteVersions),
+		},
+
+		HelpSynopsis:    pathUndeleteHelpSyn,
+		HelpDescription: pathUndeleteHelpDesc,
+	}
+}
+
+func pathDestroy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "destroy/(?P<path>.*)",
+		Fields:  versionsFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.versionsOperation(b.destroyVersions),
+		},
+
+		HelpSynopsis:    pathDestroyHelpSyn,
+		HelpDescription: pathDestroyHelpDesc,
+	}
+}
+
+// versionsOperation returns the callback of an endpoint applying an
+// operation to the given versions of a key
+func (b *backend) versionsOperation(
+	op func(logical.Storage, *keyMetadata, []uint64) error) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		key := d.Get("path").(string)
+		if resp := validKey(key); resp != nil {
+			return resp, nil
+		}
+		versions, err := parseVersions(d.Get("versions").([]string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		lock := b.keyLock(key)
+		lock.Lock()
+		defer lock.Unlock()
+
+		meta, err := b.keyMetadata(req.Storage, key)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			return nil, nil
+		}
+		return nil, op(req.Storage, meta, versions)
+	}
+}
+
+// deleteVersions marks versions of a key as deleted. Their data is kept so
+// that they can be undeleted.
+func (b *backend) deleteVersions(s logical.Storage, meta *keyMetadata, versions []uint64) error {
+	now := time.Now().UTC()
+	for _, version := range versions {
+		if vm, ok := meta.Versions[version]; ok && vm.DeletionTime.IsZero() {
+			vm.DeletionTime = now
+		}
+	}
+	return b.putKeyMetadata(s, meta)
+}
+
+// undeleteVersions restores deleted versions of a key, unless they were
+// destroyed
+func (b *backend) undeleteVersions(s logical.Storage, meta *keyMetadata, versions []uint64) error {
+	for _, version := range versions {
+		if vm, ok := meta.Versions[version]; ok && !vm.Destroyed {
+			vm.DeletionTime = time.Time{}
+		}
+	}
+	return b.putKeyMetadata(s, meta)
+}
+
+// destroyVersions permanently removes the data of versions of a key
+func (b *backend) destroyVersions(s logical.Storage, meta *keyMetadata, versions []uint64) error {
+	for _, version := range versions {
+		vm, ok := meta.Versions[version]
+		if !ok || vm.Destroyed {
+			continue
+		}
+		if err := s.Delete(versionStorageKey(meta.Key, version)); err != nil {
+			return err
+		}
+		vm.Destroyed = true
+	}
+	return b.putKeyMetadata(s, meta)
+}
+
+const pathDeleteHelpSyn = `
+Delete versions of a secret.
+`
+
+const pathDeleteHelpDesc = `
+Marks the given "versions" of a secret as deleted, so that they are no
+longer returned by reads. Their data is kept, and they can be restored
+with "undelete/<path>".
+`
+
+const pathUndeleteHelpSyn = `
+Restore deleted versions of a secret.
+`
+
+const pathUndeleteHelpDesc = `
+Restores the given "versions" of a secret which were deleted, unless they
+were destroyed.
+`
+
+const pathDestroyHelpSyn = `
+Permanently remove versions of a secret.
+`
+
+const pathDestroyHelpDesc = `
+Permanently removes the data of the given "versions" of a secret. Their
+metadata is kept, and marks them as destroyed.
+`
@@ -0,0 +1,211 @@
+package kv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathMetadata(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "metadata/(?P<path>.*)",
+		Fields: map[string]*framework.FieldSchema{
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Location of the secret.",
+			},
+			"max_versions": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "The number of versions kept of the secret. Zero uses the backend configuration.",
+			},
+			"custom_metadata": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: "String values describing the secret, such as its owner. Replaces the current custom metadata.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathMetadataRead,
+			logical.ListOperation:   b.pathMetadataList,
+			logical.UpdateOperation: b.pathMetadataWrite,
+			logical.DeleteOperation: b.pathMetadataDelete,
+		},
+
+		HelpSynopsis:    pathMetadataHelpSyn,
+		HelpDescription: pathMetadataHelpDesc,
+	}
+}
+
+func (b *backend) pathMetadataList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	prefix := d.Get("path").(string)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	keys, err := req.Storage.List(metadataPrefix + prefix)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) pathMetadataRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+
+	lock := b.keyLock(key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	versions := make(map[string]interface{}, len(meta.Versions))
+	for version, vm := range meta.Versions {
+		data := versionResponseData(version, vm)
+		delete(data, "version")
+		versions[strconv.FormatUint(version, 10)] = data
+	}
+	customMetadata := meta.CustomMetadata
+	if customMetadata == nil {
+		customMetadata = map[string]string{}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"current_version": meta.CurrentVersion,
+			"oldest_version":  meta.OldestVersion,
+			"max_versions":    meta.MaxVersions,
+			"custom_metadata": customMetadata,
+			"created_time":    formatTime(meta.CreatedTime),
+			"updated_time":    formatTime(meta.UpdatedTime),
+			"versions":        versions,
+		},
+	}, nil
+}
+
+func (b *backend) pathMetadataWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+
+	lock := b.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if meta == nil {
+		meta = &keyMetadata{
+			Key:         key,
+			Versions:    make(map[uint64]*versionMetadata),
+			CreatedTime: now,
+		}
+	}
+
+	if maxVersions, ok := d.GetOk("max_versions"); ok {
+		if maxVersions.(int) < 0 {
+			return logical.ErrorResponse("max_versions cannot be negative"), nil
+		}
+		meta.MaxVersions = maxVersions.(int)
+	}
+	if raw, ok := d.GetOk("custom_metadata"); ok {
+		customMetadata, err := parseCustomMetadata(raw.(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		meta.CustomMetadata = customMetadata
+	}
+	meta.UpdatedTime = now
+
+	if err := b.pruneVersions(req.Storage, meta); err != nil {
+		return nil, err
+	}
+	return nil, b.putKeyMetadata(req.Storage, meta)
+}
+
+// pathMetadataDelete permanently removes all the versions of a key, and its
+// metadata
+func (b *backend) pathMetadataDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if resp := validKey(key); resp != nil {
+		return resp, nil
+	}
+
+	lock := b.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.keyMetadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+	for version := range meta.Versions {
+		if err := req.Storage.Delete(versionStorageKey(key, version)); err != nil {
+			return nil, err
+		}
+	}
+	return nil, req.Storage.Delete(metadataPrefix + key)
+}
+
+// parseCustomMetadata checks that custom metadata only holds strings, and
+// is within bounds
+func parseCustomMetadata(raw map[string]interface{}) (map[string]string, error) {
+	if len(raw) > maxCustomMetadataKeys {
+		return nil, fmt.Errorf("custom_metadata cannot have more than %d keys", maxCustomMetadataKeys)
+	}
+	result := make(map[string]string, len(raw))
+	for k, v := range raw {
+		value, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("custom_metadata value of %q is not a string", k)
+		}
+		if k == "" || len(k) > maxCustomMetadataKeyLength {
+			return nil, fmt.Errorf("custom_metadata keys must be 1 to %d bytes long", maxCustomMetadataKeyLength)
+		}
+		if len(value) > maxCustomMetadataValueLength {
+			return nil, fmt.Errorf("custom_metadata value of %q is longer than %d bytes", k, maxCustomMetadataValueLength)
+		}
+		result[k] = value
+	}
+	return result, nil
+}
+
+const pathMetadataHelpSyn = `
+Read, configure and list the metadata of secrets.
+`
+
+const pathMetadataHelpDesc = `
+Reads return the versions of a secret, and whether they were deleted or
+destroyed. Listing returns the secrets under a path, folders being
+suffixed with "/".
+
+The number of versions kept of a secret can be set as "max_versions",
+overriding the configuration of the backend; versions past it are
+destroyed right away. Operators can describe a secret, such as with its
+owner or classification, by setting "custom_metadata" to a map of strings.
+It is stored apart from the data of the secret, so that it can be read by
+policies which cannot read the secret. Deleting the metadata of a secret permanently
+removes all its versions.
+`
@@ -0,0 +1,268 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// upgradeKey is the storage key marking a mount upgraded from the generic
+// backend, whose secrets are being rewritten until the upgrade completes
+const upgradeKey = "upgrading"
+
+// upgradeRetryInterval is how long a failed upgrade waits before resuming
+var upgradeRetryInterval = time.Minute
+
+var errUpgradeStopped = errors.New("upgrade stopped")
+
+// upgradeEntry is stored at upgradeKey when the upgrade starts, and kept
+// once it completes
+type upgradeEntry struct {
+	StartTime time.Time `json:"start_time"`
+	Completed bool      `json:"completed"`
+}
+
+// setupUpgrade starts rewriting the secrets of a generic mount when the
+// mount is upgraded, which is given by the "upgrade" option, or resumes an
+// upgrade interrupted by a seal. The option stays in the mount table, so
+// the upgrade is only started if it was not started before.
+func (b *backend) setupUpgrade(conf *logical.BackendConfig) error {
+	s := conf.StorageView
+	if s == nil {
+		return nil
+	}
+
+	upgrade, err := getUpgradeEntry(s)
+	if err != nil {
+		return err
+	}
+	if upgrade == nil && conf.Config["upgrade"] == "true" {
+		if err := checkUpgradeConflicts(s); err != nil {
+			return err
+		}
+		upgrade = &upgradeEntry{
+			StartTime: time.Now().UTC(),
+		}
+		if err := putUpgradeEntry(s, upgrade); err != nil {
+			return err
+		}
+	}
+	if upgrade == nil || upgrade.Completed {
+		return nil
+	}
+
+	atomic.StoreUint32(&b.upgrading, 1)
+	go b.runUpgrade(s, upgrade)
+	return nil
+}
+
+// getUpgradeEntry returns the upgrade of the mount, or nil if the mount was
+// not upgraded from the generic backend
+func getUpgradeEntry(s logical.Storage) (*upgradeEntry, error) {
+	entry, err := s.Get(upgradeKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var upgrade upgradeEntry
+	if err := entry.DecodeJSON(&upgrade); err != nil {
+		return nil, err
+	}
+	return &upgrade, nil
+}
+
+// putUpgradeEntry stores the upgrade of the mount
+func putUpgradeEntry(s logical.Storage, upgrade *upgradeEntry) error {
+	entry, err := logical.StorageEntryJSON(upgradeKey, upgrade)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// checkUpgradeConflicts returns an error if secrets of a generic mount are
+// stored where the backend keeps its own data
+func checkUpgradeConflicts(s logical.Storage) error {
+	keys, err := s.List("")
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if !isLegacyKey(key) {
+			return fmt.Errorf("cannot upgrade: secrets are stored at %q, which conflicts with the storage of the kv backend", key)
+		}
+	}
+	return nil
+}
+
+// isLegacyKey returns whether a storage key can hold a secret of the
+// generic backend, rather than data of the kv backend
+func isLegacyKey(key string) bool {
+	return key != "config" &&
+		key != upgradeKey &&
+		!strings.HasPrefix(key, metadataPrefix) &&
+		!strings.HasPrefix(key, versionsPrefix)
+}
+
+// isUpgrading returns whether the secrets of a generic mount are still
+// being rewritten
+func (b *backend) isUpgrading() bool {
+	return atomic.LoadUint32(&b.upgrading) == 1
+}
+
+// runUpgrade rewrites the secrets of a generic mount until it completes, or
+// the backend is unmounted
+func (b *backend) runUpgrade(s logical.Storage, upgrade *upgradeEntry) {
+	defer close(b.upgradeDoneCh)
+
+	for {
+		err := b.upgradePrefix(s, "")
+		if err == nil {
+			upgrade.Completed = true
+			err = putUpgradeEntry(s, upgrade)
+		}
+		if err == nil {
+			atomic.StoreUint32(&b.upgrading, 0)
+			b.Logger().Printf("[INFO] kv: upgrade of the generic secrets completed")
+			return
+		}
+		if err == errUpgradeStopped {
+			return
+		}
+
+		b.Logger().Printf("[ERR] kv: upgrade of the generic secrets failed, retrying in %s: %v", upgradeRetryInterval, err)
+		select {
+		case <-b.upgradeStopCh:
+			return
+		case <-time.After(upgradeRetryInterval):
+		}
+	}
+}
+
+// upgradePrefix rewrites the secrets of a generic mount stored under a
+// prefix
+func (b *backend) upgradePrefix(s logical.Storage, prefix string) error {
+	keys, err := s.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		key := prefix + k
+		if !isLegacyKey(key) {
+			continue
+		}
+
+		select {
+		case <-b.upgradeStopCh:
+			return errUpgradeStopped
+		default:
+		}
+
+		if strings.HasSuffix(key, "/") {
+			if err := b.upgradePrefix(s, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := b.upgradeSecret(s, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upgradeSecret rewrites a secret of a generic mount as the first version
+// of a key
+func (b *backend) upgradeSecret(s logical.Storage, key string) error {
+	lock := b.keyLock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := s.Get(key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	// The secret was already rewritten if the upgrade was interrupted
+	// before removing it
+	meta, err := b.keyMetadata(s, key)
+	if err != nil {
+		return err
+	}
+	if meta == nil {
+		var data map[string]interface{}
+		if err := entry.DecodeJSON(&data); err != nil {
+			return fmt.Errorf("failed to decode secret %q: %v", key, err)
+		}
+
+		meta = &keyMetadata{
+			Key:         key,
+			Versions:    make(map[uint64]*versionMetadata),
+			CreatedTime: time.Now().UTC(),
+		}
+		if _, err := b.putVersion(s, meta, data); err != nil {
+			return err
+		}
+	}
+
+	return s.Delete(key)
+}
+
+// legacyRead reads a secret of a generic mount not rewritten yet, as the
+// first version of a key
+func (b *backend) legacyRead(s logical.Storage, key string, version int) (*logical.Response, error) {
+	if !isLegacyKey(key) || version > 1 {
+		return nil, nil
+	}
+
+	entry, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var data map[string]interface{}
+	if err := entry.DecodeJSON(&data); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"data":     data,
+			"metadata": versionResponseData(1, &versionMetadata{}),
+		},
+	}, nil
+}
+
+// HandleRequest rejects the requests other than reads of secrets while the
+// secrets of an upgraded generic mount are rewritten
+func (b *backend) HandleRequest(req *logical.Request) (*logical.Response, error) {
+	if b.isUpgrading() {
+		switch req.Operation {
+		case logical.ReadOperation:
+			if !strings.HasPrefix(req.Path, "data/") {
+				return upgradingResponse(), logical.ErrInvalidRequest
+			}
+		case logical.CreateOperation, logical.UpdateOperation, logical.PatchOperation,
+			logical.DeleteOperation, logical.ListOperation:
+			return upgradingResponse(), logical.ErrInvalidRequest
+		}
+	}
+	return b.Backend.HandleRequest(req)
+}
+
+func upgradingResponse() *logical.Response {
+	return logical.ErrorResponse("the secrets of the mount are being upgraded to versioned secrets, only reads of secrets are served until the upgrade completes")
+}
@@ -0,0 +1,73 @@
+package mongodbatlas
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const defaultAPIURL = "https://cloud.mongodb.com/api/atlas/v1.0"
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.apiURL = defaultAPIURL
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathCreds(&b),
+		},
+
+		Secrets: []*framework.Secret{
+			secretProgrammaticAPIKey(&b),
+			secretDatabaseUser(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// apiURL is the base URL of the Atlas API, which is replaced in tests
+	apiURL string
+}
+
+// Client returns a client calling the Atlas API with the configured API key
+func (b *backend) Client(s logical.Storage) (*atlasClient, error) {
+	config, err := b.Config(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("the backend is not configured")
+	}
+
+	return &atlasClient{
+		http:       cleanhttp.DefaultClient(),
+		apiURL:     b.apiURL,
+		publicKey:  config.PublicKey,
+		privateKey: config.PrivateKey,
+	}, nil
+}
+
+const backendHelp = `
+The MongoDB Atlas backend dynamically generates programmatic API keys of
+Atlas organizations and projects, and database users of Atlas projects.
+
+After mounting this backend, an API key allowed to manage the API keys or
+the database users of the organizations and projects of the roles must be
+configured with the "config" path. The keys and users are deleted when
+their lease expires or is revoked.
+`
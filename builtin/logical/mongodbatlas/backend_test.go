@@ -0,0 +1,333 @@
+package mongodbatlas
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	testPublicKey  = "vaultpub"
+	testPrivateKey = "vault-private-key"
+	testRealm      = "MMS Public API"
+	testNonce      = "nonce-1"
+)
+
+// testAtlas serves the API keys and database users of the Atlas API, behind
+// digest authentication
+type testAtlas struct {
+	sync.Mutex
+	keys       map[string]*apiKey
+	accessList map[string][]*accessListEntry
+	users      map[string]*databaseUser
+}
+
+func (a *testAtlas) authorized(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "Digest ") {
+		return false
+	}
+	params := parseChallenge(strings.TrimPrefix(authorization, "Digest "))
+	if params["username"] != testPublicKey || params["nonce"] != testNonce || params["uri"] != r.URL.RequestURI() {
+		return false
+	}
+	ha1 := md5Hex(testPublicKey + ":" + testRealm + ":" + testPrivateKey)
+	ha2 := md5Hex(r.Method + ":" + params["uri"])
+	return params["response"] == md5Hex(ha1+":"+testNonce+":"+params["nc"]+":"+params["cnonce"]+":auth:"+ha2)
+}
+
+func (a *testAtlas) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.Lock()
+	defer a.Unlock()
+
+	if !a.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Digest realm="`+testRealm+`", domain="", nonce="`+testNonce+`", algorithm=MD5, qop="auth", stale=false`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 2 && parts[0] == "groups" && r.Method == "GET":
+		json.NewEncoder(w).Encode(map[string]string{"id": parts[1], "orgId": "org-of-" + parts[1]})
+	case len(parts) == 3 && parts[2] == "apiKeys" && r.Method == "POST":
+		var key apiKey
+		json.NewDecoder(r.Body).Decode(&key)
+		key.ID, _ = uuid.GenerateUUID()
+		key.PublicKey = "pub-" + key.ID[:8]
+		key.PrivateKey, _ = uuid.GenerateUUID()
+		a.keys[key.ID] = &key
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&key)
+	case len(parts) == 5 && parts[0] == "orgs" && parts[4] == "accessList" && r.Method == "POST":
+		var entries []*accessListEntry
+		json.NewDecoder(r.Body).Decode(&entries)
+		for _, entry := range entries {
+			if entry.IPAddress == "203.0.113.99" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"detail": "IP address not allowed"})
+				return
+			}
+		}
+		a.accessList[parts[3]] = entries
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 4 && parts[0] == "orgs" && r.Method == "DELETE":
+		if _, ok := a.keys[parts[3]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(a.keys, parts[3])
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 3 && parts[2] == "databaseUsers" && r.Method == "POST":
+		var user databaseUser
+		json.NewDecoder(r.Body).Decode(&user)
+		a.users[user.Username] = &user
+		w.WriteHeader(http.StatusCreated)
+	case len(parts) == 5 && parts[2] == "databaseUsers" && r.Method == "DELETE":
+		if _, ok := a.users[parts[4]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(a.users, parts[4])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage, *testAtlas, *httptest.Server) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	atlas := &testAtlas{
+		keys:       make(map[string]*apiKey),
+		accessList: make(map[string][]*accessListEntry),
+		users:      make(map[string]*databaseUser),
+	}
+	server := httptest.NewServer(atlas)
+
+	b := Backend()
+	b.apiURL = server.URL
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView, atlas, server
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation:   op,
+		Path:        path,
+		Storage:     s,
+		Data:        data,
+		DisplayName: "token",
+	})
+	if err != nil {
+		t.Fatalf("%s: err:%v resp:%#v", path, err, resp)
+	}
+	return resp
+}
+
+func TestBackend_roles(t *testing.T) {
+	b, storage, _, server := createBackendWithStorage(t)
+	defer server.Close()
+
+	for _, data := range []map[string]interface{}{
+		{"roles": "ORG_READ_ONLY"},
+		{"organization_id": "org", "project_id": "project", "roles": "ORG_READ_ONLY"},
+		{"organization_id": "org"},
+		{"organization_id": "org", "roles": "ORG_READ_ONLY", "ip_addresses": "not-an-ip"},
+		{"organization_id": "org", "roles": "ORG_READ_ONLY", "cidr_blocks": "203.0.113.0"},
+		{"credential_type": "database_user", "project_id": "project"},
+		{"credential_type": "database_user", "project_id": "project", "database_roles": "readWrite"},
+		{"credential_type": "database_user", "project_id": "project", "database_roles": "read@app", "roles": "GROUP_READ_ONLY"},
+		{"credential_type": "other", "organization_id": "org", "roles": "ORG_READ_ONLY"},
+	} {
+		resp := testRequest(t, b, storage, logical.UpdateOperation, "roles/test", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"credential_type": "database_user",
+		"project_id":      "project",
+		"database_roles":  "readWrite@app,read@app.orders.2020",
+		"ttl":             3600,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+	role, err := b.Role(storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	roles, err := role.databaseRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 || roles[1].RoleName != "read" || roles[1].DatabaseName != "app" || roles[1].CollectionName != "orders.2020" {
+		t.Fatalf("bad: %#v", roles)
+	}
+
+	resp = testRequest(t, b, storage, logical.ReadOperation, "roles/test", nil)
+	if resp.Data["credential_type"] != "database_user" || resp.Data["ttl"] != int64(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testRequest(t, b, storage, logical.ListOperation, "roles/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "test" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_programmaticAPIKeys(t *testing.T) {
+	b, storage, atlas, server := createBackendWithStorage(t)
+	defer server.Close()
+
+	testRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"public_key":  testPublicKey,
+		"private_key": testPrivateKey,
+	})
+	resp := testRequest(t, b, storage, logical.ReadOperation, "config", nil)
+	if _, ok := resp.Data["private_key"]; ok || resp.Data["public_key"] != testPublicKey {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testRequest(t, b, storage, logical.UpdateOperation, "roles/project", map[string]interface{}{
+		"project_id":   "project",
+		"roles":        "GROUP_READ_ONLY",
+		"ip_addresses": "203.0.113.10",
+		"cidr_blocks":  "198.51.100.0/24",
+		"ttl":          3600,
+		"max_ttl":      7200,
+	})
+
+	resp = testRequest(t, b, storage, logical.ReadOperation, "creds/project", nil)
+	if resp == nil || resp.IsError() || resp.Secret == nil || resp.Secret.TTL != time.Hour {
+		t.Fatalf("resp: %#v", resp)
+	}
+	keyID := resp.Secret.InternalData["api_key_id"].(string)
+	key, ok := atlas.keys[keyID]
+	if !ok || resp.Data["public_key"] != key.PublicKey || resp.Data["private_key"] != key.PrivateKey {
+		t.Fatalf("key not created: %#v", resp.Data)
+	}
+	if len(key.Roles) != 1 || key.Roles[0] != "GROUP_READ_ONLY" || !strings.HasPrefix(key.Desc, "Vault project token ") {
+		t.Fatalf("bad key: %#v", key)
+	}
+	if entries := atlas.accessList[keyID]; len(entries) != 2 || entries[0].IPAddress != "203.0.113.10" || entries[1].CIDRBlock != "198.51.100.0/24" {
+		t.Fatalf("bad access list: %#v", entries)
+	}
+	if resp.Secret.InternalData["organization_id"] != "org-of-project" {
+		t.Fatalf("bad internal data: %#v", resp.Secret.InternalData)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || resp == nil || resp.IsError() || resp.Secret.TTL != time.Hour {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+
+	// Revoking a deleted key succeeds
+	for i := 0; i < 2; i++ {
+		if _, err := b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    secret,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if len(atlas.keys) != 0 {
+			t.Fatalf("key not deleted: %#v", atlas.keys)
+		}
+	}
+
+	// Keys whose access list cannot be added are deleted
+	testRequest(t, b, storage, logical.UpdateOperation, "roles/org", map[string]interface{}{
+		"organization_id": "org",
+		"roles":           "ORG_MEMBER",
+		"ip_addresses":    "203.0.113.99",
+	})
+	resp = testRequest(t, b, storage, logical.ReadOperation, "creds/org", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+	if len(atlas.keys) != 0 {
+		t.Fatalf("key not deleted: %#v", atlas.keys)
+	}
+
+	// Wrong credentials are refused
+	testRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"public_key":  testPublicKey,
+		"private_key": "wrong",
+	})
+	resp = testRequest(t, b, storage, logical.ReadOperation, "creds/project", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
+
+func TestBackend_databaseUsers(t *testing.T) {
+	b, storage, atlas, server := createBackendWithStorage(t)
+	defer server.Close()
+
+	testRequest(t, b, storage, logical.UpdateOperation, "config", map[string]interface{}{
+		"public_key":  testPublicKey,
+		"private_key": testPrivateKey,
+	})
+	testRequest(t, b, storage, logical.UpdateOperation, "roles/app", map[string]interface{}{
+		"credential_type": "database_user",
+		"project_id":      "project",
+		"database_roles":  "readWrite@app",
+		"max_ttl":         86400,
+	})
+
+	resp := testRequest(t, b, storage, logical.ReadOperation, "creds/app", nil)
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("resp: %#v", resp)
+	}
+	user, ok := atlas.users[resp.Data["username"].(string)]
+	if !ok || user.Password != resp.Data["password"] || user.DatabaseName != "admin" {
+		t.Fatalf("user not created: %#v", resp.Data)
+	}
+	if len(user.Roles) != 1 || user.Roles[0].RoleName != "readWrite" || user.Roles[0].DatabaseName != "app" {
+		t.Fatalf("bad user: %#v", user)
+	}
+	deleteAfter, err := time.Parse(time.RFC3339, user.DeleteAfterDate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := deleteAfter.Sub(time.Now()); d < 23*time.Hour || d > 25*time.Hour {
+		t.Fatalf("bad deleteAfterDate: %s", user.DeleteAfterDate)
+	}
+
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   storage,
+		Secret:    resp.Secret,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(atlas.users) != 0 {
+		t.Fatalf("user not deleted: %#v", atlas.users)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	params := parseChallenge(`realm="MMS Public API", domain="", nonce="a,b", algorithm=MD5, qop="auth", stale=false`)
+	if params["realm"] != "MMS Public API" || params["nonce"] != "a,b" || params["algorithm"] != "MD5" ||
+		params["qop"] != "auth" || params["stale"] != "false" || params["domain"] != "" {
+		t.Fatalf("bad: %#v", params)
+	}
+}
@@ -0,0 +1,297 @@
+package mongodbatlas
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// atlasClient calls the MongoDB Atlas administration API with a programmatic
+// API key, which authenticates with HTTP digest authentication
+type atlasClient struct {
+	http       *http.Client
+	apiURL     string
+	publicKey  string
+	privateKey string
+}
+
+// apiError is an error returned by the Atlas API
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("status code %d: %s", e.StatusCode, e.Message)
+}
+
+// isStatus returns whether err is an error of the Atlas API with the given
+// status code
+func isStatus(err error, statusCode int) bool {
+	apiErr, ok := err.(*apiError)
+	return ok && apiErr.StatusCode == statusCode
+}
+
+// call calls the Atlas API, encoding the input and decoding the output as
+// JSON if they are not nil. Requests are first sent without credentials, and
+// sent again with the digest authorization of the challenge of the API.
+func (c *atlasClient) call(method, path string, input, output interface{}) error {
+	var raw []byte
+	if input != nil {
+		var err error
+		raw, err = json.Marshal(input)
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.do(method, path, raw, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		authorization, err := c.digestAuthorization(challenge, method, path)
+		if err != nil {
+			return err
+		}
+		resp, err = c.do(method, path, raw, authorization)
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Detail string `json:"detail"`
+		}
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 65536))
+		message := strings.TrimSpace(string(body))
+		if json.Unmarshal(body, &errResp) == nil && errResp.Detail != "" {
+			message = errResp.Detail
+		}
+		return &apiError{StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if output != nil {
+		if err := json.NewDecoder(resp.Body).Decode(output); err != nil {
+			return fmt.Errorf("error decoding response of %s: %s", path, err)
+		}
+	}
+	return nil
+}
+
+func (c *atlasClient) do(method, path string, body []byte, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.apiURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.http.Do(req)
+}
+
+// digestAuthorization returns the Authorization header answering the digest
+// challenge of RFC 2617 with the API key, for the MD5 algorithm and the
+// "auth" quality of protection the Atlas API uses
+func (c *atlasClient) digestAuthorization(challenge, method, path string) (string, error) {
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return "", fmt.Errorf("Atlas API did not send a digest challenge: %q", challenge)
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Digest "))
+	if algorithm := params["algorithm"]; algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	qop := ""
+	for _, option := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(option) == "auth" {
+			qop = "auth"
+		}
+	}
+	if params["qop"] != "" && qop == "" {
+		return "", fmt.Errorf("unsupported digest quality of protection %q", params["qop"])
+	}
+
+	u, err := url.Parse(c.apiURL + path)
+	if err != nil {
+		return "", err
+	}
+	uri := u.RequestURI()
+
+	cnonceRaw := make([]byte, 8)
+	if _, err := rand.Read(cnonceRaw); err != nil {
+		return "", err
+	}
+	cnonce := hex.EncodeToString(cnonceRaw)
+	const nc = "00000001"
+
+	ha1 := md5Hex(c.publicKey + ":" + params["realm"] + ":" + c.privateKey)
+	ha2 := md5Hex(method + ":" + uri)
+	var response string
+	if qop == "" {
+		response = md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+	} else {
+		response = md5Hex(ha1 + ":" + params["nonce"] + ":" + nc + ":" + cnonce + ":" + qop + ":" + ha2)
+	}
+
+	authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s", algorithm=MD5`,
+		c.publicKey, params["realm"], params["nonce"], uri, response)
+	if qop != "" {
+		authorization += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+	if opaque, ok := params["opaque"]; ok {
+		authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return authorization, nil
+}
+
+// parseChallenge parses the comma-separated key=value parameters of a digest
+// challenge, whose values may be quoted
+func parseChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+	for len(challenge) != 0 {
+		challenge = strings.TrimLeft(challenge, " ,")
+		eq := strings.Index(challenge, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(challenge[:eq]))
+		challenge = challenge[eq+1:]
+
+		var value string
+		if strings.HasPrefix(challenge, `"`) {
+			end := strings.Index(challenge[1:], `"`)
+			if end < 0 {
+				value, challenge = challenge[1:], ""
+			} else {
+				value, challenge = challenge[1:end+1], challenge[end+2:]
+			}
+		} else {
+			end := strings.Index(challenge, ",")
+			if end < 0 {
+				end = len(challenge)
+			}
+			value, challenge = strings.TrimSpace(challenge[:end]), challenge[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKey is a programmatic API key of an organization
+type apiKey struct {
+	ID         string   `json:"id,omitempty"`
+	Desc       string   `json:"desc"`
+	Roles      []string `json:"roles"`
+	PublicKey  string   `json:"publicKey,omitempty"`
+	PrivateKey string   `json:"privateKey,omitempty"`
+}
+
+// accessListEntry is an IP address or a CIDR block an API key can be used
+// from
+type accessListEntry struct {
+	IPAddress string `json:"ipAddress,omitempty"`
+	CIDRBlock string `json:"cidrBlock,omitempty"`
+}
+
+// createOrgAPIKey creates an API key of the organization
+func (c *atlasClient) createOrgAPIKey(orgID string, key *apiKey) (*apiKey, error) {
+	var created apiKey
+	if err := c.call("POST", "/orgs/"+url.PathEscape(orgID)+"/apiKeys", key, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// createProjectAPIKey creates an API key of the organization of the project,
+// assigned to the project with the roles of the key
+func (c *atlasClient) createProjectAPIKey(projectID string, key *apiKey) (*apiKey, error) {
+	var created apiKey
+	if err := c.call("POST", "/groups/"+url.PathEscape(projectID)+"/apiKeys", key, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// addAccessList allows an API key to be used from the entries
+func (c *atlasClient) addAccessList(orgID, keyID string, entries []*accessListEntry) error {
+	return c.call("POST", "/orgs/"+url.PathEscape(orgID)+"/apiKeys/"+url.PathEscape(keyID)+"/accessList", entries, nil)
+}
+
+// deleteAPIKey deletes an API key of the organization, which also removes
+// it from its projects. Keys which do not exist anymore are not an error.
+func (c *atlasClient) deleteAPIKey(orgID, keyID string) error {
+	err := c.call("DELETE", "/orgs/"+url.PathEscape(orgID)+"/apiKeys/"+url.PathEscape(keyID), nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// projectOrgID returns the ID of the organization of the project
+func (c *atlasClient) projectOrgID(projectID string) (string, error) {
+	var project struct {
+		OrgID string `json:"orgId"`
+	}
+	if err := c.call("GET", "/groups/"+url.PathEscape(projectID), nil, &project); err != nil {
+		return "", err
+	}
+	if project.OrgID == "" {
+		return "", fmt.Errorf("Atlas API did not return the organization of project %q", projectID)
+	}
+	return project.OrgID, nil
+}
+
+// databaseUser is a database user of a project
+type databaseUser struct {
+	DatabaseName    string          `json:"databaseName"`
+	Username        string          `json:"username"`
+	Password        string          `json:"password,omitempty"`
+	Roles           []*databaseRole `json:"roles"`
+	DeleteAfterDate string          `json:"deleteAfterDate,omitempty"`
+}
+
+// databaseRole is a role of a database user on a database, or on a
+// collection of the database
+type databaseRole struct {
+	RoleName       string `json:"roleName"`
+	DatabaseName   string `json:"databaseName"`
+	CollectionName string `json:"collectionName,omitempty"`
+}
+
+// createDatabaseUser creates a database user of the project, authenticated
+// with a password against the admin database
+func (c *atlasClient) createDatabaseUser(projectID string, user *databaseUser) error {
+	return c.call("POST", "/groups/"+url.PathEscape(projectID)+"/databaseUsers", user, nil)
+}
+
+// deleteDatabaseUser deletes a database user of the project. Users which do
+// not exist anymore are not an error.
+func (c *atlasClient) deleteDatabaseUser(projectID, username string) error {
+	err := c.call("DELETE", "/groups/"+url.PathEscape(projectID)+"/databaseUsers/admin/"+url.PathEscape(username), nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
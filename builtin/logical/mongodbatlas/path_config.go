@@ -0,0 +1,102 @@
+package mongodbatlas
+
+import (
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config",
+		Fields: map[string]*framework.FieldSchema{
+			"public_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Public key of the programmatic API key Vault uses.",
+			},
+
+			"private_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Private key of the programmatic API key Vault uses.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+type configEntry struct {
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+}
+
+// Config returns the configuration of the backend, or nil if there is none
+func (b *backend) Config(s logical.Storage) (*configEntry, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result configEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": config.PublicKey,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config := &configEntry{
+		PublicKey:  d.Get("public_key").(string),
+		PrivateKey: d.Get("private_key").(string),
+	}
+	if config.PublicKey == "" || config.PrivateKey == "" {
+		return logical.ErrorResponse("public_key and private_key are required"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigHelpSyn = `
+Configure the API key Vault uses to call the MongoDB Atlas API.
+`
+
+const pathConfigHelpDesc = `
+This path configures the programmatic API key Vault calls the Atlas API
+with. It must be allowed to manage the API keys of the organizations of the
+roles, with the Organization Owner role, or the database users of their
+projects, with the Project Owner role. The private key is never returned.
+`
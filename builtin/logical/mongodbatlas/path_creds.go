@@ -0,0 +1,173 @@
+package mongodbatlas
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// maxDeleteAfter is how far in the future Atlas accepts the deletion date of
+// temporary database users
+const maxDeleteAfter = 7 * 24 * time.Hour
+
+func pathCreds(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsRead,
+		},
+
+		HelpSynopsis:    pathCredsHelpSyn,
+		HelpDescription: pathCredsHelpDesc,
+	}
+}
+
+func (b *backend) pathCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' not found", name)), nil
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if role.CredentialType == credentialTypeDatabaseUser {
+		return b.createDatabaseUser(req, client, name, role)
+	}
+	return b.createProgrammaticAPIKey(req, client, name, role)
+}
+
+func (b *backend) createProgrammaticAPIKey(req *logical.Request,
+	client *atlasClient, name string, role *roleEntry) (*logical.Response, error) {
+	key := &apiKey{
+		Desc:  fmt.Sprintf("Vault %s %s %d", name, req.DisplayName, time.Now().Unix()),
+		Roles: role.Roles,
+	}
+	if len(key.Desc) > 250 {
+		key.Desc = key.Desc[:250]
+	}
+
+	// Keys of projects are keys of their organization, which their access
+	// list and deletion go through
+	orgID := role.OrganizationID
+	var created *apiKey
+	var err error
+	if role.ProjectID != "" {
+		orgID, err = client.projectOrgID(role.ProjectID)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		created, err = client.createProjectAPIKey(role.ProjectID, key)
+	} else {
+		created, err = client.createOrgAPIKey(orgID, key)
+	}
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error creating API key: %s", err)), nil
+	}
+
+	var accessList []*accessListEntry
+	for _, ip := range role.IPAddresses {
+		accessList = append(accessList, &accessListEntry{IPAddress: ip})
+	}
+	for _, cidr := range role.CIDRBlocks {
+		accessList = append(accessList, &accessListEntry{CIDRBlock: cidr})
+	}
+	if len(accessList) != 0 {
+		if err := client.addAccessList(orgID, created.ID, accessList); err != nil {
+			if deleteErr := client.deleteAPIKey(orgID, created.ID); deleteErr != nil {
+				return nil, fmt.Errorf("error adding the access list of API key %s: %s; error deleting it: %s",
+					created.ID, err, deleteErr)
+			}
+			return logical.ErrorResponse(fmt.Sprintf("error adding the access list of the API key: %s", err)), nil
+		}
+	}
+
+	resp := b.Secret(SecretProgrammaticAPIKeyType).Response(map[string]interface{}{
+		"public_key":  created.PublicKey,
+		"private_key": created.PrivateKey,
+	}, map[string]interface{}{
+		"role":            name,
+		"organization_id": orgID,
+		"api_key_id":      created.ID,
+	})
+	resp.Secret.TTL = role.TTL
+	return resp, nil
+}
+
+func (b *backend) createDatabaseUser(req *logical.Request,
+	client *atlasClient, name string, role *roleEntry) (*logical.Response, error) {
+	databaseRoles, err := role.databaseRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	suffix, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	password, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	user := &databaseUser{
+		DatabaseName: "admin",
+		Username:     fmt.Sprintf("vault-%s-%d-%s", name, time.Now().Unix(), suffix[:8]),
+		Password:     password,
+		Roles:        databaseRoles,
+	}
+
+	// Users are temporary in Atlas too, in case their revocation fails, if
+	// the maximum TTL is short enough for Atlas
+	maxTTL := role.MaxTTL
+	if maxTTL == 0 {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+	if maxTTL <= maxDeleteAfter {
+		user.DeleteAfterDate = time.Now().Add(maxTTL).UTC().Format(time.RFC3339)
+	}
+
+	if err := client.createDatabaseUser(role.ProjectID, user); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error creating database user: %s", err)), nil
+	}
+
+	resp := b.Secret(SecretDatabaseUserType).Response(map[string]interface{}{
+		"username": user.Username,
+		"password": user.Password,
+	}, map[string]interface{}{
+		"role":       name,
+		"project_id": role.ProjectID,
+		"username":   user.Username,
+	})
+	resp.Secret.TTL = role.TTL
+	return resp, nil
+}
+
+const pathCredsHelpSyn = `
+Generate credentials from a specific role.
+`
+
+const pathCredsHelpDesc = `
+This path creates a programmatic API key or a database user of MongoDB
+Atlas for a role, depending on its credential type. API keys are returned
+as "public_key" and "private_key", and database users as "username" and
+"password". They are deleted when the lease expires or is revoked.
+`
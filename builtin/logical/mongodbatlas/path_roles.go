@@ -0,0 +1,298 @@
+package mongodbatlas
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	credentialTypeProgram      = "program"
+	credentialTypeDatabaseUser = "database_user"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathRoleList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role.",
+			},
+
+			"credential_type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: credentialTypeProgram,
+				Description: `Type of the credentials of the role: 'program'
+for programmatic API keys, or 'database_user' for
+database users. Defaults to 'program'.`,
+			},
+
+			"organization_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "ID of the organization of the API keys.",
+			},
+
+			"project_id": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `ID of the project the API keys are assigned to,
+or of the project of the database users.`,
+			},
+
+			"roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the organization or
+project roles of the API keys, such as
+'ORG_READ_ONLY' or 'GROUP_READ_ONLY'.`,
+			},
+
+			"ip_addresses": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the IP addresses the
+API keys can be used from.`,
+			},
+
+			"cidr_blocks": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the CIDR blocks the
+API keys can be used from.`,
+			},
+
+			"database_roles": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the roles of the
+database users, each given as
+'<role>@<database>[.<collection>]'.`,
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default TTL of the credentials of the role.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum TTL of the credentials of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathRoleRead,
+			logical.UpdateOperation: b.pathRoleWrite,
+			logical.DeleteOperation: b.pathRoleDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+type roleEntry struct {
+	CredentialType string        `json:"credential_type"`
+	OrganizationID string        `json:"organization_id"`
+	ProjectID      string        `json:"project_id"`
+	Roles          []string      `json:"roles"`
+	IPAddresses    []string      `json:"ip_addresses"`
+	CIDRBlocks     []string      `json:"cidr_blocks"`
+	DatabaseRoles  []string      `json:"database_roles"`
+	TTL            time.Duration `json:"ttl"`
+	MaxTTL         time.Duration `json:"max_ttl"`
+}
+
+// Role returns the role of the given name, or nil if there is none
+func (b *backend) Role(s logical.Storage, name string) (*roleEntry, error) {
+	entry, err := s.Get("roles/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathRoleList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("roles/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathRoleRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := b.Role(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"credential_type": role.CredentialType,
+			"organization_id": role.OrganizationID,
+			"project_id":      role.ProjectID,
+			"roles":           role.Roles,
+			"ip_addresses":    role.IPAddresses,
+			"cidr_blocks":     role.CIDRBlocks,
+			"database_roles":  role.DatabaseRoles,
+			"ttl":             int64(role.TTL / time.Second),
+			"max_ttl":         int64(role.MaxTTL / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathRoleWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role := &roleEntry{
+		CredentialType: d.Get("credential_type").(string),
+		OrganizationID: d.Get("organization_id").(string),
+		ProjectID:      d.Get("project_id").(string),
+		Roles:          nonEmpty(d.Get("roles").([]string)),
+		IPAddresses:    nonEmpty(d.Get("ip_addresses").([]string)),
+		CIDRBlocks:     nonEmpty(d.Get("cidr_blocks").([]string)),
+		DatabaseRoles:  nonEmpty(d.Get("database_roles").([]string)),
+		TTL:            time.Duration(d.Get("ttl").(int)) * time.Second,
+		MaxTTL:         time.Duration(d.Get("max_ttl").(int)) * time.Second,
+	}
+
+	switch role.CredentialType {
+	case credentialTypeProgram:
+		if (role.OrganizationID == "") == (role.ProjectID == "") {
+			return logical.ErrorResponse("exactly one of organization_id and project_id must be set"), nil
+		}
+		if len(role.Roles) == 0 {
+			return logical.ErrorResponse("roles cannot be empty"), nil
+		}
+		if len(role.DatabaseRoles) != 0 {
+			return logical.ErrorResponse("database_roles can only be set for database users"), nil
+		}
+		for _, ip := range role.IPAddresses {
+			if net.ParseIP(ip) == nil {
+				return logical.ErrorResponse(fmt.Sprintf("invalid IP address %q", ip)), nil
+			}
+		}
+		for _, cidr := range role.CIDRBlocks {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return logical.ErrorResponse(fmt.Sprintf("invalid CIDR block %q", cidr)), nil
+			}
+		}
+	case credentialTypeDatabaseUser:
+		if role.ProjectID == "" || role.OrganizationID != "" {
+			return logical.ErrorResponse("project_id must be set, and organization_id not, for database users"), nil
+		}
+		if len(role.Roles) != 0 || len(role.IPAddresses) != 0 || len(role.CIDRBlocks) != 0 {
+			return logical.ErrorResponse("roles, ip_addresses and cidr_blocks can only be set for API keys"), nil
+		}
+		if len(role.DatabaseRoles) == 0 {
+			return logical.ErrorResponse("database_roles cannot be empty"), nil
+		}
+		if _, err := role.databaseRoles(); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	default:
+		return logical.ErrorResponse(fmt.Sprintf(
+			"credential_type must be %q or %q", credentialTypeProgram, credentialTypeDatabaseUser)), nil
+	}
+
+	if role.MaxTTL != 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("roles/"+d.Get("name").(string), role)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathRoleDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("roles/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// databaseRoles parses the database roles of the role
+func (r *roleEntry) databaseRoles() ([]*databaseRole, error) {
+	var roles []*databaseRole
+	for _, raw := range r.DatabaseRoles {
+		at := strings.Index(raw, "@")
+		if at <= 0 || at == len(raw)-1 {
+			return nil, fmt.Errorf("database role %q must be given as '<role>@<database>[.<collection>]'", raw)
+		}
+		role := &databaseRole{RoleName: raw[:at]}
+
+		// Database names cannot contain dots, while collection names can
+		target := raw[at+1:]
+		if dot := strings.Index(target, "."); dot >= 0 {
+			role.DatabaseName, role.CollectionName = target[:dot], target[dot+1:]
+		} else {
+			role.DatabaseName = target
+		}
+		if role.DatabaseName == "" {
+			return nil, fmt.Errorf("database role %q has no database", raw)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// nonEmpty returns the items which are not empty
+func nonEmpty(items []string) []string {
+	var result []string
+	for _, item := range items {
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+const pathRolesHelpSyn = `
+Manage the roles that credentials can be created for.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles of the backend.
+
+Roles of the 'program' credential type create programmatic API keys,
+either of the organization of "organization_id" with organization roles,
+or assigned to the project of "project_id" with project roles. The keys
+can only be used from the "ip_addresses" and "cidr_blocks" of the role,
+if any.
+
+Roles of the 'database_user' credential type create database users of the
+project of "project_id", with the "database_roles" of the role, such as
+'readWrite@app' or 'read@app.orders'.
+`
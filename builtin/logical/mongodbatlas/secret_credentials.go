@@ -0,0 +1,122 @@
+package mongodbatlas
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	SecretProgrammaticAPIKeyType = "programmatic_api_key"
+	SecretDatabaseUserType       = "database_user"
+)
+
+func secretProgrammaticAPIKey(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretProgrammaticAPIKeyType,
+		Fields: map[string]*framework.FieldSchema{
+			"public_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Public key of the API key",
+			},
+
+			"private_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Private key of the API key",
+			},
+		},
+
+		Renew:  b.secretCredentialsRenew,
+		Revoke: b.secretProgrammaticAPIKeyRevoke,
+	}
+}
+
+func secretDatabaseUser(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretDatabaseUserType,
+		Fields: map[string]*framework.FieldSchema{
+			"username": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Username of the database user",
+			},
+
+			"password": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Password of the database user",
+			},
+		},
+
+		Renew:  b.secretCredentialsRenew,
+		Revoke: b.secretDatabaseUserRevoke,
+	}
+}
+
+// internalString returns the internal data of the secret of the given key
+func internalString(req *logical.Request, key string) (string, error) {
+	value, ok := req.Secret.InternalData[key].(string)
+	if !ok {
+		return "", fmt.Errorf("secret is missing %s internal data", key)
+	}
+	return value, nil
+}
+
+func (b *backend) secretCredentialsRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name, err := internalString(req, "role")
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := b.Role(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' not found", name)), nil
+	}
+
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+func (b *backend) secretProgrammaticAPIKeyRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	orgID, err := internalString(req, "organization_id")
+	if err != nil {
+		return nil, err
+	}
+	keyID, err := internalString(req, "api_key_id")
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.deleteAPIKey(orgID, keyID); err != nil {
+		return nil, fmt.Errorf("error deleting API key %s: %s", keyID, err)
+	}
+	return nil, nil
+}
+
+func (b *backend) secretDatabaseUserRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	projectID, err := internalString(req, "project_id")
+	if err != nil {
+		return nil, err
+	}
+	username, err := internalString(req, "username")
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := b.Client(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.deleteDatabaseUser(projectID, username); err != nil {
+		return nil, fmt.Errorf("error deleting database user %s: %s", username, err)
+	}
+	return nil, nil
+}
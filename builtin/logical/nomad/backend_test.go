@@ -0,0 +1,214 @@
+package nomad
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+)
+
+const testManagementToken = "management"
+
+// testNomad serves the ACL token endpoints of the Nomad HTTP API
+type testNomad struct {
+	sync.Mutex
+	tokens map[string]*aclToken
+}
+
+func (n *testNomad) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.Lock()
+	defer n.Unlock()
+
+	if r.Header.Get("X-Nomad-Token") != testManagementToken {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/v1/acl/token" && r.Method == "POST":
+		var token aclToken
+		json.NewDecoder(r.Body).Decode(&token)
+		if token.Type == "client" && len(token.Policies) == 0 {
+			http.Error(w, "client token missing policies", http.StatusBadRequest)
+			return
+		}
+		token.AccessorID, _ = uuid.GenerateUUID()
+		token.SecretID, _ = uuid.GenerateUUID()
+		n.tokens[token.AccessorID] = &token
+		json.NewEncoder(w).Encode(&token)
+	case strings.HasPrefix(r.URL.Path, "/v1/acl/token/") && r.Method == "DELETE":
+		accessorID := strings.TrimPrefix(r.URL.Path, "/v1/acl/token/")
+		if _, ok := n.tokens[accessorID]; !ok {
+			http.Error(w, "ACL token not found", http.StatusNotFound)
+			return
+		}
+		delete(n.tokens, accessorID)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func createBackendWithStorage(t *testing.T) (*backend, logical.Storage, *testNomad, *httptest.Server) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	nomad := &testNomad{tokens: make(map[string]*aclToken)}
+	return b, config.StorageView, nomad, httptest.NewServer(nomad)
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation:   op,
+		Path:        path,
+		Storage:     s,
+		Data:        data,
+		DisplayName: "token",
+	})
+	if err != nil {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	return resp
+}
+
+func TestBackend_roles(t *testing.T) {
+	b, storage, _, server := createBackendWithStorage(t)
+	defer server.Close()
+
+	for _, data := range []map[string]interface{}{
+		{"type": "client"},
+		{"type": "management", "policies": "readonly"},
+		{"type": "other", "policies": "readonly"},
+		{"policies": "readonly", "ttl": 7200, "max_ttl": 3600},
+	} {
+		resp := testRequest(t, b, storage, logical.UpdateOperation, "roles/web", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("%v: expected an error: %#v", data, resp)
+		}
+	}
+
+	resp := testRequest(t, b, storage, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"policies": "readonly, deploy",
+		"ttl":      3600,
+	})
+	if resp != nil && resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+
+	resp = testRequest(t, b, storage, logical.ReadOperation, "roles/web", nil)
+	if resp == nil || resp.IsError() {
+		t.Fatalf("resp: %#v", resp)
+	}
+	policies := resp.Data["policies"].([]string)
+	if len(policies) != 2 || policies[0] != "readonly" || policies[1] != "deploy" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp.Data["type"] != "client" || resp.Data["ttl"] != int64(3600) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testRequest(t, b, storage, logical.ListOperation, "roles/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "web" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testRequest(t, b, storage, logical.DeleteOperation, "roles/web", nil)
+	if resp := testRequest(t, b, storage, logical.ReadOperation, "roles/web", nil); resp != nil {
+		t.Fatalf("expected the role to be deleted: %#v", resp)
+	}
+}
+
+func TestBackend_creds(t *testing.T) {
+	b, storage, nomad, server := createBackendWithStorage(t)
+	defer server.Close()
+
+	// Credentials need the access configuration
+	testRequest(t, b, storage, logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"policies": "readonly",
+		"ttl":      3600,
+		"max_ttl":  7200,
+	})
+	resp := testRequest(t, b, storage, logical.ReadOperation, "creds/web", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+
+	testRequest(t, b, storage, logical.UpdateOperation, "config/access", map[string]interface{}{
+		"address": server.URL,
+		"token":   testManagementToken,
+	})
+	resp = testRequest(t, b, storage, logical.ReadOperation, "config/access", nil)
+	if resp.Data["address"] != server.URL {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["token"]; ok {
+		t.Fatalf("token should not be returned")
+	}
+
+	resp = testRequest(t, b, storage, logical.ReadOperation, "creds/web", nil)
+	if resp == nil || resp.IsError() || resp.Secret == nil {
+		t.Fatalf("resp: %#v", resp)
+	}
+	if resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad TTL: %s", resp.Secret.TTL)
+	}
+	token, ok := nomad.tokens[resp.Data["accessor_id"].(string)]
+	if !ok || token.SecretID != resp.Data["secret_id"] {
+		t.Fatalf("token not created: %#v", resp.Data)
+	}
+	if token.Type != "client" || len(token.Policies) != 1 || token.Policies[0] != "readonly" {
+		t.Fatalf("bad token: %#v", token)
+	}
+	if !strings.HasPrefix(token.Name, "vault-web-token-") {
+		t.Fatalf("bad token name: %s", token.Name)
+	}
+
+	secret := resp.Secret
+	secret.IssueTime = time.Now()
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RenewOperation,
+		Storage:   storage,
+		Secret:    secret,
+	})
+	if err != nil || resp == nil || resp.IsError() {
+		t.Fatalf("err:%v resp:%#v", err, resp)
+	}
+	if resp.Secret.TTL != time.Hour {
+		t.Fatalf("bad TTL: %s", resp.Secret.TTL)
+	}
+
+	// Revoking a deleted token succeeds
+	for i := 0; i < 2; i++ {
+		resp, err = b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   storage,
+			Secret:    secret,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("err:%v resp:%#v", err, resp)
+		}
+		if len(nomad.tokens) != 0 {
+			t.Fatalf("token not deleted: %#v", nomad.tokens)
+		}
+	}
+
+	// Errors of the Nomad API are returned
+	testRequest(t, b, storage, logical.UpdateOperation, "config/access", map[string]interface{}{
+		"address": server.URL,
+		"token":   "other",
+	})
+	resp = testRequest(t, b, storage, logical.ReadOperation, "creds/web", nil)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %#v", resp)
+	}
+}
@@ -0,0 +1,117 @@
+package nomad
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/logical"
+)
+
+// nomadClient calls the ACL endpoints of the Nomad HTTP API
+type nomadClient struct {
+	http    *http.Client
+	address string
+	token   string
+}
+
+// aclToken is a Nomad ACL token
+type aclToken struct {
+	AccessorID string   `json:"AccessorID,omitempty"`
+	SecretID   string   `json:"SecretID,omitempty"`
+	Name       string   `json:"Name"`
+	Type       string   `json:"Type"`
+	Policies   []string `json:"Policies"`
+}
+
+// apiError is a response of the Nomad API with an unexpected status
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("nomad API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+func client(s logical.Storage) (*nomadClient, error, error) {
+	conf, userErr, intErr := readConfigAccess(s)
+	if intErr != nil {
+		return nil, nil, intErr
+	}
+	if userErr != nil {
+		return nil, userErr, nil
+	}
+	if conf == nil {
+		return nil, nil, fmt.Errorf("no error received but no configuration found")
+	}
+
+	return &nomadClient{
+		http:    cleanhttp.DefaultClient(),
+		address: strings.TrimRight(conf.Address, "/"),
+		token:   conf.Token,
+	}, nil, nil
+}
+
+func (c *nomadClient) call(method, path string, body, out interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.address+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("X-Nomad-Token", c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return &apiError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// createToken creates an ACL token and returns it with its accessor and
+// secret IDs
+func (c *nomadClient) createToken(token *aclToken) (*aclToken, error) {
+	var created aclToken
+	if err := c.call("POST", "/v1/acl/token", token, &created); err != nil {
+		return nil, err
+	}
+	if created.AccessorID == "" || created.SecretID == "" {
+		return nil, fmt.Errorf("nomad API did not return the created token")
+	}
+	return &created, nil
+}
+
+// deleteToken deletes the ACL token of the accessor. Tokens which do not
+// exist anymore are not an error.
+func (c *nomadClient) deleteToken(accessorID string) error {
+	err := c.call("DELETE", "/v1/acl/token/"+url.PathEscape(accessorID), nil, nil)
+	if apiErr, ok := err.(*apiError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
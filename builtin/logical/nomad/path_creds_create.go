@@ -0,0 +1,89 @@
+package nomad
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathCredsCreate(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "creds/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathCredsRead,
+		},
+
+		HelpSynopsis:    pathCredsCreateHelpSyn,
+		HelpDescription: pathCredsCreateHelpDesc,
+	}
+}
+
+func (b *backend) pathCredsRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	role, err := readRole(req.Storage, name)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %s", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' not found", name)), nil
+	}
+
+	// Get the nomad client
+	c, userErr, intErr := client(req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		return logical.ErrorResponse(userErr.Error()), nil
+	}
+
+	// Generate a name for the token
+	tokenName := fmt.Sprintf("vault-%s-%s-%d", name, req.DisplayName, time.Now().UnixNano())
+	if len(tokenName) > 256 {
+		tokenName = tokenName[:256]
+	}
+
+	// Create it
+	token, err := c.createToken(&aclToken{
+		Name:     tokenName,
+		Type:     role.TokenType,
+		Policies: role.Policies,
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Use the helper to create the secret
+	s := b.Secret(SecretTokenType).Response(map[string]interface{}{
+		"secret_id":   token.SecretID,
+		"accessor_id": token.AccessorID,
+	}, map[string]interface{}{
+		"accessor_id": token.AccessorID,
+		"role":        name,
+	})
+	s.Secret.TTL = role.TTL
+
+	return s, nil
+}
+
+const pathCredsCreateHelpSyn = `
+Generate a Nomad ACL token from a specific role.
+`
+
+const pathCredsCreateHelpDesc = `
+This path creates a Nomad ACL token of the type and the policies of a role.
+The secret ID of the token is its credential; the accessor ID identifies it
+in the Nomad ACL API. The token is deleted when the lease expires or is
+revoked.
+`
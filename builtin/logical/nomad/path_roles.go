@@ -0,0 +1,190 @@
+package nomad
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListRoles(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: pathRolesList,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func pathRoles() *framework.Path {
+	return &framework.Path{
+		Pattern: "roles/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the role",
+			},
+
+			"policies": &framework.FieldSchema{
+				Type: framework.TypeCommaStringSlice,
+				Description: `Comma-separated list of the Nomad ACL policies
+of the tokens. Required for 'client' tokens.`,
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "client",
+				Description: `Which type of token to create: 'client'
+or 'management'. If a 'management' token,
+the "policies" parameter is not required.
+Defaults to 'client'.`,
+			},
+
+			"ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Default TTL of the tokens of the role.",
+			},
+
+			"max_ttl": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "Maximum TTL of the tokens of the role.",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   pathRolesRead,
+			logical.UpdateOperation: pathRolesWrite,
+			logical.DeleteOperation: pathRolesDelete,
+		},
+
+		HelpSynopsis:    pathRolesHelpSyn,
+		HelpDescription: pathRolesHelpDesc,
+	}
+}
+
+func readRole(s logical.Storage, name string) (*roleConfig, error) {
+	entry, err := s.Get("role/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result roleConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func pathRolesList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("role/")
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(entries), nil
+}
+
+func pathRolesRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	role, err := readRole(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policies": role.Policies,
+			"type":     role.TokenType,
+			"ttl":      int64(role.TTL / time.Second),
+			"max_ttl":  int64(role.MaxTTL / time.Second),
+		},
+	}, nil
+}
+
+func pathRolesWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	tokenType := d.Get("type").(string)
+
+	switch tokenType {
+	case "client":
+	case "management":
+	default:
+		return logical.ErrorResponse(
+			"type must be \"client\" or \"management\""), nil
+	}
+
+	var policies []string
+	for _, policy := range d.Get("policies").([]string) {
+		if policy != "" {
+			policies = append(policies, policy)
+		}
+	}
+	switch {
+	case tokenType == "client" && len(policies) == 0:
+		return logical.ErrorResponse(
+			"policies cannot be empty when not using management tokens"), nil
+	case tokenType == "management" && len(policies) != 0:
+		return logical.ErrorResponse(
+			"policies cannot be set when using management tokens"), nil
+	}
+
+	role := roleConfig{
+		Policies:  policies,
+		TokenType: tokenType,
+		TTL:       time.Duration(d.Get("ttl").(int)) * time.Second,
+		MaxTTL:    time.Duration(d.Get("max_ttl").(int)) * time.Second,
+	}
+	if role.MaxTTL != 0 && role.TTL > role.MaxTTL {
+		return logical.ErrorResponse("ttl cannot be greater than max_ttl"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("role/"+d.Get("name").(string), role)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func pathRolesDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	if err := req.Storage.Delete("role/" + name); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+type roleConfig struct {
+	Policies  []string      `json:"policies"`
+	TokenType string        `json:"type"`
+	TTL       time.Duration `json:"ttl"`
+	MaxTTL    time.Duration `json:"max_ttl"`
+}
+
+const pathRolesHelpSyn = `
+Manage the roles that tokens can be created for.
+`
+
+const pathRolesHelpDesc = `
+This path lets you manage the roles of the backend. Each role creates Nomad
+ACL tokens of its "type": 'client' tokens are granted the ACL policies of
+"policies", which must already exist in Nomad, while 'management' tokens
+are granted every permission.
+
+The tokens are deleted from Nomad when their lease expires or is revoked.
+`
@@ -0,0 +1,74 @@
+package nomad
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	SecretTokenType = "token"
+)
+
+func secretToken(b *backend) *framework.Secret {
+	return &framework.Secret{
+		Type: SecretTokenType,
+		Fields: map[string]*framework.FieldSchema{
+			"secret_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Secret ID of the token",
+			},
+
+			"accessor_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Accessor ID of the token",
+			},
+		},
+
+		Renew:  b.secretTokenRenew,
+		Revoke: secretTokenRevoke,
+	}
+}
+
+func (b *backend) secretTokenRenew(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleRaw, ok := req.Secret.InternalData["role"]
+	if !ok {
+		return nil, fmt.Errorf("secret is missing role internal data")
+	}
+
+	role, err := readRole(req.Storage, roleRaw.(string))
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %s", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"Role '%s' not found", roleRaw.(string))), nil
+	}
+
+	return framework.LeaseExtend(role.TTL, role.MaxTTL, b.System())(req, d)
+}
+
+func secretTokenRevoke(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	c, userErr, intErr := client(req.Storage)
+	if intErr != nil {
+		return nil, intErr
+	}
+	if userErr != nil {
+		// Returning logical.ErrorResponse from revocation function is risky
+		return nil, userErr
+	}
+
+	accessorRaw, ok := req.Secret.InternalData["accessor_id"]
+	if !ok {
+		return nil, fmt.Errorf("secret is missing accessor_id internal data")
+	}
+
+	if err := c.deleteToken(accessorRaw.(string)); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,105 @@
+package pki
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// acmeValidateChallenge validates a challenge of an authorization in the
+// background, and stores its result
+func (b *backend) acmeValidateChallenge(s logical.Storage, accountID, authzID,
+	challengeType, domain, token, keyAuthorization string) {
+	var acmeErr *acmeError
+	switch challengeType {
+	case acmeChallengeHTTP01:
+		acmeErr = b.acmeValidateHTTP01(domain, token, keyAuthorization)
+	case acmeChallengeDNS01:
+		acmeErr = b.acmeValidateDNS01(domain, keyAuthorization)
+	default:
+		acmeErr = &acmeError{Type: acmeErrMalformed, Detail: fmt.Sprintf("unsupported challenge type %q", challengeType)}
+	}
+
+	b.acmeLock.Lock()
+	defer b.acmeLock.Unlock()
+
+	authz, err := b.acmeAuthorization(s, accountID, authzID)
+	if err != nil {
+		b.Logger().Printf("[ERR] pki: error loading ACME authorization %s: %s", authzID, err)
+		return
+	}
+	if authz == nil || authz.Status != acmeStatusPending {
+		return
+	}
+
+	// The authorization is valid once any of its challenges is; a failed
+	// challenge invalidates it
+	for _, challenge := range authz.Challenges {
+		if challenge.Type != challengeType || challenge.Status != acmeStatusProcessing {
+			continue
+		}
+		if acmeErr != nil {
+			challenge.Status = acmeStatusInvalid
+			challenge.Error = acmeErr
+			authz.Status = acmeStatusInvalid
+		} else {
+			challenge.Status = acmeStatusValid
+			challenge.Validated = time.Now()
+			authz.Status = acmeStatusValid
+		}
+	}
+
+	if err := acmePut(s, "acme/authorizations/"+accountID+"/"+authzID, authz); err != nil {
+		b.Logger().Printf("[ERR] pki: error storing ACME authorization %s: %s", authzID, err)
+	}
+}
+
+// acmeValidateHTTP01 checks that the domain serves the key authorization of
+// the token over HTTP
+func (b *backend) acmeValidateHTTP01(domain, token, keyAuthorization string) *acmeError {
+	url := fmt.Sprintf("http://%s/.well-known/acme-challenge/%s", domain, token)
+	resp, err := b.acmeHTTPClient.Get(url)
+	if err != nil {
+		return &acmeError{Type: acmeErrConnection, Detail: fmt.Sprintf("error fetching %s: %s", url, err), Status: 400}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &acmeError{Type: acmeErrUnauthorized, Detail: fmt.Sprintf("unexpected status %d fetching %s", resp.StatusCode, url), Status: 403}
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, 4096))
+	if err != nil {
+		return &acmeError{Type: acmeErrConnection, Detail: fmt.Sprintf("error reading %s: %s", url, err), Status: 400}
+	}
+	if strings.TrimSpace(string(body)) != keyAuthorization {
+		return &acmeError{Type: acmeErrIncorrectResponse, Detail: fmt.Sprintf("unexpected key authorization at %s", url), Status: 403}
+	}
+
+	return nil
+}
+
+// acmeValidateDNS01 checks that the TXT records of the domain have the
+// digest of the key authorization
+func (b *backend) acmeValidateDNS01(domain, keyAuthorization string) *acmeError {
+	name := "_acme-challenge." + domain
+	records, err := b.acmeLookupTXT(name)
+	if err != nil {
+		return &acmeError{Type: acmeErrDNS, Detail: fmt.Sprintf("error looking up TXT records of %s: %s", name, err), Status: 400}
+	}
+
+	sum := sha256.Sum256([]byte(keyAuthorization))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			return nil
+		}
+	}
+
+	return &acmeError{Type: acmeErrIncorrectResponse, Detail: fmt.Sprintf("no TXT record of %s has the key authorization", name), Status: 403}
+}
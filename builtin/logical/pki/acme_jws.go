@@ -0,0 +1,286 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// acmeNonceLifetime is how long the nonces of the ACME server remain valid
+const acmeNonceLifetime = 30 * time.Minute
+
+// ACME error types, from RFC 8555
+const (
+	acmeErrAccountDoesNotExist = "urn:ietf:params:acme:error:accountDoesNotExist"
+	acmeErrAlreadyRevoked      = "urn:ietf:params:acme:error:alreadyRevoked"
+	acmeErrBadCSR              = "urn:ietf:params:acme:error:badCSR"
+	acmeErrBadNonce            = "urn:ietf:params:acme:error:badNonce"
+	acmeErrBadSignatureAlg     = "urn:ietf:params:acme:error:badSignatureAlgorithm"
+	acmeErrConnection          = "urn:ietf:params:acme:error:connection"
+	acmeErrDNS                 = "urn:ietf:params:acme:error:dns"
+	acmeErrIncorrectResponse   = "urn:ietf:params:acme:error:incorrectResponse"
+	acmeErrInvalidContact      = "urn:ietf:params:acme:error:invalidContact"
+	acmeErrMalformed           = "urn:ietf:params:acme:error:malformed"
+	acmeErrOrderNotReady       = "urn:ietf:params:acme:error:orderNotReady"
+	acmeErrRejectedIdentifier  = "urn:ietf:params:acme:error:rejectedIdentifier"
+	acmeErrUnauthorized        = "urn:ietf:params:acme:error:unauthorized"
+	acmeErrUnsupportedIdent    = "urn:ietf:params:acme:error:unsupportedIdentifier"
+)
+
+// acmeError is an ACME problem document
+type acmeError struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Status int    `json:"status,omitempty"`
+}
+
+func (e *acmeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Detail)
+}
+
+// acmeNonces are the outstanding nonces of the ACME server, which are valid
+// only once
+type acmeNonces struct {
+	lock   sync.Mutex
+	nonces map[string]time.Time
+}
+
+func newACMENonces() *acmeNonces {
+	return &acmeNonces{
+		nonces: map[string]time.Time{},
+	}
+}
+
+// get returns a new nonce
+func (n *acmeNonces) get() (string, error) {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return "", err
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(nonceBytes)
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	now := time.Now()
+	for k, expiry := range n.nonces {
+		if now.After(expiry) {
+			delete(n.nonces, k)
+		}
+	}
+	n.nonces[nonce] = now.Add(acmeNonceLifetime)
+
+	return nonce, nil
+}
+
+// redeem returns whether the nonce is valid, and invalidates it
+func (n *acmeNonces) redeem(nonce string) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	expiry, ok := n.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(n.nonces, nonce)
+
+	return time.Now().Before(expiry)
+}
+
+// acmeJWSHeader is the protected header of the JWS of ACME requests, which
+// has either the JWK of the request or the key ID of its account
+type acmeJWSHeader struct {
+	Alg   string   `json:"alg"`
+	Nonce string   `json:"nonce"`
+	URL   string   `json:"url"`
+	JWK   *acmeJWK `json:"jwk"`
+	KID   string   `json:"kid"`
+}
+
+// acmeJWK is a public JSON Web Key, of type RSA or EC
+type acmeJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+func decodeJWKInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns the public key of the JWK
+func (k *acmeJWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeJWKInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeJWKInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys < 2048 bits are unsafe and not supported")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeJWKInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeJWKInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// thumbprint returns the base64url-encoded SHA-256 thumbprint of the JWK, as
+// defined by RFC 7638
+func (k *acmeJWK) thumbprint() string {
+	var input string
+	switch k.Kty {
+	case "RSA":
+		input = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	default:
+		input = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	}
+	sum := sha256.Sum256([]byte(input))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// verifyJWS verifies the signature of a JWS with the algorithm of its header,
+// which must match the key
+func verifyJWS(key crypto.PublicKey, alg string, signingInput, signature []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			break
+		}
+		sum := sha256.Sum256(signingInput)
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, sum[:], signature)
+
+	case "ES256", "ES384":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			break
+		}
+		var sum []byte
+		switch {
+		case alg == "ES256" && ecKey.Curve == elliptic.P256():
+			hashed := sha256.Sum256(signingInput)
+			sum = hashed[:]
+		case alg == "ES384" && ecKey.Curve == elliptic.P384():
+			hashed := sha512.Sum384(signingInput)
+			sum = hashed[:]
+		default:
+			return fmt.Errorf("algorithm %s does not match the key", alg)
+		}
+
+		// The signature is the concatenation of r and s
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, sum, r, s) {
+			return fmt.Errorf("invalid signature")
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	return fmt.Errorf("algorithm %s does not match the key", alg)
+}
+
+// parseJWS parses and verifies the flattened JWS of an ACME request. The key
+// is looked up from the key ID of the header if the request has no JWK.
+func parseJWS(protected, payload, signature string,
+	lookupKey func(kid string) (*acmeJWK, error)) (*acmeJWSHeader, []byte, error) {
+	headerBytes, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return nil, nil, &acmeError{Type: acmeErrMalformed, Detail: "invalid protected header encoding", Status: 400}
+	}
+	var header acmeJWSHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, nil, &acmeError{Type: acmeErrMalformed, Detail: "invalid protected header", Status: 400}
+	}
+	if (header.JWK == nil) == (header.KID == "") {
+		return nil, nil, &acmeError{Type: acmeErrMalformed, Detail: "exactly one of jwk and kid must be set", Status: 400}
+	}
+
+	jwk := header.JWK
+	if jwk == nil {
+		jwk, err = lookupKey(header.KID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	key, err := jwk.publicKey()
+	if err != nil {
+		return nil, nil, &acmeError{Type: acmeErrMalformed, Detail: fmt.Sprintf("invalid key: %s", err), Status: 400}
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, nil, &acmeError{Type: acmeErrMalformed, Detail: "invalid signature encoding", Status: 400}
+	}
+	if err := verifyJWS(key, header.Alg, []byte(protected+"."+payload), sig); err != nil {
+		errType := acmeErrMalformed
+		switch header.Alg {
+		case "RS256", "ES256", "ES384":
+		default:
+			errType = acmeErrBadSignatureAlg
+		}
+		return nil, nil, &acmeError{Type: errType, Detail: fmt.Sprintf("invalid JWS signature: %s", err), Status: 400}
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, nil, &acmeError{Type: acmeErrMalformed, Detail: "invalid payload encoding", Status: 400}
+	}
+
+	return &header, payloadBytes, nil
+}
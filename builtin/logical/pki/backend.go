@@ -1,10 +1,14 @@
 package pki
 
 import (
+	"net"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -21,44 +25,69 @@ func Backend() *backend {
 		Help: strings.TrimSpace(backendHelp),
 
 		PathsSpecial: &logical.Paths{
+			Root: []string{
+				"sign-verbatim",
+				"sign-verbatim/*",
+			},
+
 			Unauthenticated: []string{
 				"cert/*",
 				"ca/pem",
 				"ca",
+				"ca_chain",
 				"crl/pem",
 				"crl",
+				"ocsp",
+				"ocsp/*",
+				"acme/*",
 			},
 		},
 
-		Paths: []*framework.Path{
-			pathListRoles(&b),
-			pathRoles(&b),
-			pathGenerateRoot(&b),
-			pathGenerateIntermediate(&b),
-			pathSetSignedIntermediate(&b),
-			pathSignIntermediate(&b),
-			pathConfigCA(&b),
-			pathConfigCRL(&b),
-			pathConfigURLs(&b),
-			pathSignVerbatim(&b),
-			pathSign(&b),
-			pathIssue(&b),
-			pathRotateCRL(&b),
-			pathFetchCA(&b),
-			pathFetchCRL(&b),
-			pathFetchCRLViaCertPath(&b),
-			pathFetchValid(&b),
-			pathFetchListCerts(&b),
-			pathRevoke(&b),
-			pathTidy(&b),
-		},
+		Paths: framework.PathAppend(
+			[]*framework.Path{
+				pathListRoles(&b),
+				pathRoles(&b),
+				pathGenerateRoot(&b),
+				pathGenerateIntermediate(&b),
+				pathSetSignedIntermediate(&b),
+				pathSignIntermediate(&b),
+				pathConfigCA(&b),
+				pathConfigCRL(&b),
+				pathConfigURLs(&b),
+				pathSignVerbatim(&b),
+				pathSign(&b),
+				pathIssue(&b),
+				pathRotateCRL(&b),
+				pathFetchCA(&b),
+				pathFetchCAChain(&b),
+				pathFetchCRL(&b),
+				pathFetchCRLViaCertPath(&b),
+				pathFetchValid(&b),
+				pathFetchListCerts(&b),
+				pathRevoke(&b),
+				pathOCSP(&b),
+				pathTidy(&b),
+				pathTidyStatus(&b),
+				pathConfigAutoTidy(&b),
+				pathConfigACME(&b),
+			},
+			pathACME(&b),
+		),
 
 		Secrets: []*framework.Secret{
 			secretCerts(&b),
 		},
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.crlLifetime = time.Hour * 72
+	b.lastTidy = time.Now()
+
+	b.acmeNonces = newACMENonces()
+	b.acmeHTTPClient = cleanhttp.DefaultClient()
+	b.acmeHTTPClient.Timeout = 10 * time.Second
+	b.acmeLookupTXT = net.LookupTXT
 
 	return &b
 }
@@ -68,6 +97,33 @@ type backend struct {
 
 	crlLifetime       time.Duration
 	revokeStorageLock sync.RWMutex
+
+	// tidyLock is set while a tidy operation is running, whose progress
+	// is in tidyStatus
+	tidyLock       uint32
+	tidyStatusLock sync.RWMutex
+	tidyStatus     *tidyStatus
+	lastTidy       time.Time
+
+	// acmeLock serializes the changes to ACME objects. Challenges are
+	// validated with acmeHTTPClient and acmeLookupTXT.
+	acmeLock       sync.Mutex
+	acmeNonces     *acmeNonces
+	acmeHTTPClient *http.Client
+	acmeLookupTXT  func(string) ([]string, error)
+}
+
+// periodicFunc rebuilds the CRL before it expires, and runs the automatic
+// tidy operations
+func (b *backend) periodicFunc(req *logical.Request) error {
+	var result error
+	if err := b.rebuildExpiringCRL(req); err != nil {
+		result = multierror.Append(result, err)
+	}
+	if err := b.autoTidy(req); err != nil {
+		result = multierror.Append(result, err)
+	}
+	return result
 }
 
 const backendHelp = `
@@ -6,23 +6,33 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"fmt"
 	"math"
+	"math/big"
 	mathrand "math/rand"
 	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/mitchellh/mapstructure"
@@ -39,7 +49,8 @@ var (
 func TestBackend_RSAKey(t *testing.T) {
 	defaultLeaseTTLVal := time.Hour * 24
 	maxLeaseTTLVal := time.Hour * 24 * 30
-	b, err := Factory(&logical.BackendConfig{
+	b := Backend()
+	_, err := b.Setup(&logical.BackendConfig{
 		Logger: nil,
 		System: &logical.StaticSystemView{
 			DefaultLeaseTTLVal: defaultLeaseTTLVal,
@@ -59,7 +70,7 @@ func TestBackend_RSAKey(t *testing.T) {
 
 	intdata := map[string]interface{}{}
 	reqdata := map[string]interface{}{}
-	testCase.Steps = append(testCase.Steps, generateCATestingSteps(t, rsaCACert, rsaCAKey, ecCACert, intdata, reqdata)...)
+	testCase.Steps = append(testCase.Steps, generateCATestingSteps(t, b, rsaCACert, rsaCAKey, ecCACert, intdata, reqdata)...)
 
 	logicaltest.Test(t, testCase)
 }
@@ -69,7 +80,8 @@ func TestBackend_RSAKey(t *testing.T) {
 func TestBackend_ECKey(t *testing.T) {
 	defaultLeaseTTLVal := time.Hour * 24
 	maxLeaseTTLVal := time.Hour * 24 * 30
-	b, err := Factory(&logical.BackendConfig{
+	b := Backend()
+	_, err := b.Setup(&logical.BackendConfig{
 		Logger: nil,
 		System: &logical.StaticSystemView{
 			DefaultLeaseTTLVal: defaultLeaseTTLVal,
@@ -89,7 +101,7 @@ func TestBackend_ECKey(t *testing.T) {
 
 	intdata := map[string]interface{}{}
 	reqdata := map[string]interface{}{}
-	testCase.Steps = append(testCase.Steps, generateCATestingSteps(t, ecCACert, ecCAKey, rsaCACert, intdata, reqdata)...)
+	testCase.Steps = append(testCase.Steps, generateCATestingSteps(t, b, ecCACert, ecCAKey, rsaCACert, intdata, reqdata)...)
 
 	logicaltest.Test(t, testCase)
 }
@@ -708,9 +720,23 @@ func generateCSRSteps(t *testing.T, caCert, caKey string, intdata, reqdata map[s
 	return ret
 }
 
+// Returns a step check waiting for the tidy operation started by the step,
+// which runs in the background, to finish
+func waitForTidyCheck(b *backend) func(*logical.Response) error {
+	return func(resp *logical.Response) error {
+		for i := 0; i < 100; i++ {
+			if atomic.LoadUint32(&b.tidyLock) == 0 {
+				return nil
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		return fmt.Errorf("tidy operation did not finish")
+	}
+}
+
 // Generates steps to test out CA configuration -- certificates + CRL expiry,
 // and ensure that the certificates are readable after storing them
-func generateCATestingSteps(t *testing.T, caCert, caKey, otherCaCert string, intdata, reqdata map[string]interface{}) []logicaltest.TestStep {
+func generateCATestingSteps(t *testing.T, b *backend, caCert, caKey, otherCaCert string, intdata, reqdata map[string]interface{}) []logicaltest.TestStep {
 	setSerialUnderTest := func(req *logical.Request) error {
 		req.Path = serialUnderTest
 		return nil
@@ -1210,6 +1236,7 @@ func generateCATestingSteps(t *testing.T, caCert, caKey, otherCaCert string, int
 				"tidy_cert_store":      true,
 				"tidy_revocation_list": true,
 			},
+			Check: waitForTidyCheck(b),
 		},
 
 		// We still expect to find these
@@ -1322,6 +1349,7 @@ func generateCATestingSteps(t *testing.T, caCert, caKey, otherCaCert string, int
 				"tidy_cert_store":      true,
 				"tidy_revocation_list": true,
 			},
+			Check: waitForTidyCheck(b),
 		},
 
 		// We do *not* expect to find these
@@ -1998,3 +2026,1095 @@ O30prQ/sanDzNAeJhftoGtNPJDspwx0fzclHvKIhgl3JVUc=
 -----END CERTIFICATE-----
 `
 )
+
+func TestBackend_IntermediateChain(t *testing.T) {
+	newBackend := func() (*backend, logical.Storage) {
+		config := logical.TestBackendConfig()
+		storage := &logical.InmemStorage{}
+		config.StorageView = storage
+
+		b := Backend()
+		_, err := b.Setup(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b, storage
+	}
+
+	request := func(b *backend, storage logical.Storage, path string, data map[string]interface{}) *logical.Response {
+		var operation logical.Operation = logical.UpdateOperation
+		if data == nil {
+			operation = logical.ReadOperation
+		}
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed request to %s: %#v", path, resp)
+		}
+		return resp
+	}
+
+	// The root mount signs the first intermediate, which signs the second
+	root, rootStorage := newBackend()
+	request(root, rootStorage, "root/generate/internal", map[string]interface{}{
+		"common_name": "root.test.com",
+		"ttl":         "10h",
+	})
+
+	inter, interStorage := newBackend()
+	resp := request(inter, interStorage, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "inter.test.com",
+	})
+	resp = request(root, rootStorage, "root/sign-intermediate", map[string]interface{}{
+		"csr":    resp.Data["csr"],
+		"format": "pem",
+		"ttl":    "8h",
+	})
+	interCert := resp.Data["certificate"].(string)
+	interChain := resp.Data["ca_chain"].([]string)
+	if len(interChain) != 1 || interChain[0] != resp.Data["issuing_ca"] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	request(inter, interStorage, "intermediate/set-signed", map[string]interface{}{
+		"certificate": interCert + "\n" + interChain[0],
+	})
+
+	leaf, leafStorage := newBackend()
+	resp = request(leaf, leafStorage, "intermediate/generate/internal", map[string]interface{}{
+		"common_name": "leaf.test.com",
+	})
+	csr := resp.Data["csr"]
+	resp = request(inter, interStorage, "root/sign-intermediate", map[string]interface{}{
+		"csr":    csr,
+		"format": "pem",
+		"ttl":    "6h",
+	})
+	leafCert := resp.Data["certificate"].(string)
+	leafChain := resp.Data["ca_chain"].([]string)
+	if len(leafChain) != 2 || leafChain[0] != interCert || leafChain[1] != interChain[0] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Certificates that are not part of the chain are rejected
+	other, otherStorage := newBackend()
+	resp = request(other, otherStorage, "root/generate/internal", map[string]interface{}{
+		"common_name": "other.test.com",
+	})
+	resp, err := leaf.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "intermediate/set-signed",
+		Storage:   leafStorage,
+		Data: map[string]interface{}{
+			"certificate": strings.Join([]string{leafCert, interCert, resp.Data["certificate"].(string)}, "\n"),
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// The chain may be given in any order
+	request(leaf, leafStorage, "intermediate/set-signed", map[string]interface{}{
+		"certificate": strings.Join([]string{interChain[0], leafCert, interCert}, "\n"),
+	})
+
+	request(leaf, leafStorage, "roles/test", map[string]interface{}{
+		"allowed_domains":  "test.com",
+		"allow_subdomains": true,
+		"max_ttl":          "4h",
+	})
+	resp = request(leaf, leafStorage, "issue/test", map[string]interface{}{
+		"common_name": "host.test.com",
+	})
+	chain := resp.Data["ca_chain"].([]string)
+	if resp.Data["issuing_ca"] != leafCert || len(chain) != 3 ||
+		chain[0] != leafCert || chain[1] != interCert || chain[2] != interChain[0] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = request(leaf, leafStorage, "cert/ca_chain", nil)
+	if resp.Data["certificate"] != strings.Join(chain, "\n")+"\n" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = request(leaf, leafStorage, "ca_chain", nil)
+	if string(resp.Data[logical.HTTPRawBody].([]byte)) != strings.Join(chain, "\n")+"\n" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_CRLRebuild(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b := Backend()
+	_, err := b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed request to %s: %#v", path, resp)
+		}
+		return resp
+	}
+
+	fetchCRL := func() *pkix.CertificateList {
+		resp := request(logical.ReadOperation, "crl", nil)
+		certList, err := x509.ParseCRL(resp.Data[logical.HTTPRawBody].([]byte))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return certList
+	}
+
+	// Without a CA there is no CRL to rebuild
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+
+	request(logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "test.com",
+		"ttl":         "6h",
+	})
+
+	// Setting the expiry rebuilds the CRL
+	request(logical.UpdateOperation, "config/crl", map[string]interface{}{
+		"expiry": "2s",
+	})
+	crl := fetchCRL()
+	lifetime := crl.TBSCertList.NextUpdate.Sub(crl.TBSCertList.ThisUpdate)
+	if lifetime < time.Second || lifetime > 3*time.Second {
+		t.Fatalf("bad: CRL lifetime is %s", lifetime)
+	}
+
+	// The CRL is only rebuilt once it nears its expiry
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if !fetchCRL().TBSCertList.ThisUpdate.Equal(crl.TBSCertList.ThisUpdate) {
+		t.Fatalf("CRL was rebuilt early")
+	}
+
+	time.Sleep(2 * time.Second)
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if !fetchCRL().TBSCertList.ThisUpdate.After(crl.TBSCertList.ThisUpdate) {
+		t.Fatalf("CRL was not rebuilt")
+	}
+}
+
+func TestBackend_OCSP(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b := Backend()
+	_, err := b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed request to %s: %#v", path, resp)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "test.com",
+		"ttl":         "6h",
+	})
+	caCert, err := x509.ParseCertificate(mustPEMBytes(t, resp.Data["certificate"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allowed_domains":  "test.com",
+		"allow_subdomains": true,
+		"max_ttl":          "4h",
+	})
+	issue := func() *x509.Certificate {
+		resp := request(logical.UpdateOperation, "issue/test", map[string]interface{}{
+			"common_name": "host.test.com",
+		})
+		cert, err := x509.ParseCertificate(mustPEMBytes(t, resp.Data["certificate"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+	good, revoked := issue(), issue()
+	request(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": certutil.GetOctalFormatted(revoked.SerialNumber.Bytes(), ":"),
+	})
+
+	// Certificate IDs hash the name and key of the issuer
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(caCert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		t.Fatal(err)
+	}
+	nameHash := sha1.Sum(caCert.RawSubject)
+	keyHash := sha1.Sum(spki.PublicKey.RightAlign())
+	certID := func(serial *big.Int) ocspCertID {
+		return ocspCertID{
+			HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.RawValue{Tag: asn1.TagNull}},
+			IssuerNameHash: nameHash[:],
+			IssuerKeyHash:  keyHash[:],
+			SerialNumber:   serial,
+		}
+	}
+	otherIssuer := certID(good.SerialNumber)
+	otherIssuer.IssuerKeyHash = nameHash[:]
+
+	nonce := pkix.Extension{Id: oidOCSPNonce, Value: []byte{0x04, 0x02, 0x01, 0x02}}
+	reqBytes, err := asn1.Marshal(ocspRequest{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspSingleRequest{
+				{CertID: certID(good.SerialNumber)},
+				{CertID: certID(revoked.SerialNumber)},
+				{CertID: certID(big.NewInt(42))},
+				{CertID: otherIssuer},
+			},
+			Extensions: []pkix.Extension{nonce},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkResponse := func(resp *logical.Response) {
+		if resp.Data[logical.HTTPContentType] != "application/ocsp-response" {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+		status, data, err := parseOCSPResponse(resp.Data[logical.HTTPRawBody].([]byte), caCert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if status != ocspSuccessful || len(data.Responses) != 4 {
+			t.Fatalf("bad: %d %#v", status, data)
+		}
+		if len(data.Extensions) != 1 || !reflect.DeepEqual(data.Extensions[0].Value, nonce.Value) {
+			t.Fatalf("bad: nonce not echoed: %#v", data.Extensions)
+		}
+		if r := data.Responses[0]; !r.Good || r.Unknown || r.CertID.SerialNumber.Cmp(good.SerialNumber) != 0 {
+			t.Fatalf("bad: %#v", r)
+		}
+		if r := data.Responses[1]; bool(r.Good || r.Unknown) || r.Revoked.RevocationTime.IsZero() {
+			t.Fatalf("bad: %#v", r)
+		}
+		if r := data.Responses[2]; r.Good || !r.Unknown {
+			t.Fatalf("bad: %#v", r)
+		}
+		if r := data.Responses[3]; r.Good || !r.Unknown {
+			t.Fatalf("bad: %#v", r)
+		}
+	}
+
+	checkResponse(request(logical.UpdateOperation, "ocsp", map[string]interface{}{
+		logical.HTTPContentType: "application/ocsp-request",
+		logical.HTTPRawBody:     reqBytes,
+	}))
+	checkResponse(request(logical.ReadOperation, "ocsp/"+base64.StdEncoding.EncodeToString(reqBytes), nil))
+
+	resp = request(logical.ReadOperation, "ocsp/bm90IGEgcmVxdWVzdA==", nil)
+	status, _, err := parseOCSPResponse(resp.Data[logical.HTTPRawBody].([]byte), caCert)
+	if err != nil || status != ocspMalformedRequest {
+		t.Fatalf("bad: %d %v", status, err)
+	}
+}
+
+func mustPEMBytes(t *testing.T, data string) []byte {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		t.Fatalf("no PEM data in %q", data)
+	}
+	return block.Bytes
+}
+
+// Verifies that the OCSP response was signed by the CA certificate, and
+// returns its data
+func parseOCSPResponse(respBytes []byte, caCert *x509.Certificate) (asn1.Enumerated, *ocspResponseData, error) {
+	var resp ocspResponse
+	if _, err := asn1.Unmarshal(respBytes, &resp); err != nil {
+		return 0, nil, err
+	}
+	if resp.Status != ocspSuccessful {
+		return resp.Status, nil, nil
+	}
+
+	var basic ocspBasicResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return 0, nil, err
+	}
+
+	var sigAlg x509.SignatureAlgorithm
+	switch {
+	case basic.SignatureAlgorithm.Algorithm.Equal(oidSHA256WithRSA):
+		sigAlg = x509.SHA256WithRSA
+	case basic.SignatureAlgorithm.Algorithm.Equal(oidECDSAWithSHA256):
+		sigAlg = x509.ECDSAWithSHA256
+	default:
+		return 0, nil, fmt.Errorf("unknown signature algorithm %v", basic.SignatureAlgorithm.Algorithm)
+	}
+	if err := caCert.CheckSignature(sigAlg, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()); err != nil {
+		return 0, nil, err
+	}
+
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return 0, nil, err
+	}
+	return resp.Status, &data, nil
+}
+
+func TestBackend_Tidy(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b := Backend()
+	_, err := b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed request to %s: %#v", path, resp)
+		}
+		return resp
+	}
+
+	waitForTidy := func() *logical.Response {
+		for i := 0; i < 50; i++ {
+			resp := request(logical.ReadOperation, "tidy-status", nil)
+			if resp.Data["state"] != tidyStatusRunning {
+				return resp
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("tidy operation did not finish")
+		return nil
+	}
+
+	resp := request(logical.ReadOperation, "tidy-status", nil)
+	if resp.Data["state"] != "Inactive" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	request(logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "test.com",
+		"ttl":         "6h",
+	})
+	request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"allowed_domains":  "test.com",
+		"allow_subdomains": true,
+		"max_ttl":          "4h",
+	})
+	issue := func(ttl string) string {
+		resp := request(logical.UpdateOperation, "issue/test", map[string]interface{}{
+			"common_name": "host.test.com",
+			"ttl":         ttl,
+		})
+		return resp.Data["serial_number"].(string)
+	}
+	expired := issue("1s")
+	valid := issue("1h")
+	request(logical.UpdateOperation, "revoke", map[string]interface{}{
+		"serial_number": expired,
+	})
+	time.Sleep(2 * time.Second)
+
+	// Tidy operations run in the background, one at a time
+	resp = request(logical.UpdateOperation, "tidy", map[string]interface{}{
+		"tidy_cert_store":      true,
+		"tidy_revocation_list": true,
+		"safety_buffer":        "1s",
+	})
+	if len(resp.Warnings()) != 1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = waitForTidy()
+	if resp.Data["state"] != tidyStatusFinished || resp.Data["cert_store_deleted_count"] != 1 ||
+		resp.Data["revoked_cert_deleted_count"] != 1 || resp.Data["safety_buffer"] != int64(1) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	certs, err := storage.List("certs/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(certs) != 2 || !strutil.StrListContains(certs, valid) || strutil.StrListContains(certs, expired) {
+		t.Fatalf("bad: %#v", certs)
+	}
+	revoked, err := storage.List("revoked/")
+	if err != nil || len(revoked) != 0 {
+		t.Fatalf("bad: %#v %v", revoked, err)
+	}
+
+	// Automatic tidy operations run periodically once enabled
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/auto-tidy",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enabled": true,
+		},
+	})
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	request(logical.UpdateOperation, "config/auto-tidy", map[string]interface{}{
+		"enabled":           true,
+		"interval_duration": "1s",
+		"tidy_cert_store":   true,
+		"safety_buffer":     "1s",
+	})
+	resp = request(logical.ReadOperation, "config/auto-tidy", nil)
+	if resp.Data["enabled"] != true || resp.Data["interval_duration"] != int64(1) || resp.Data["tidy_revocation_list"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	expired = issue("1s")
+	time.Sleep(2 * time.Second)
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	resp = waitForTidy()
+	if resp.Data["state"] != tidyStatusFinished || resp.Data["cert_store_deleted_count"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	certs, err = storage.List("certs/")
+	if err != nil || len(certs) != 2 || strutil.StrListContains(certs, expired) {
+		t.Fatalf("bad: %#v %v", certs, err)
+	}
+}
+
+func TestBackend_SANs(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b := Backend()
+	_, err := b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		resp := handle(path, data)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed request to %s: %#v", path, resp)
+		}
+		return resp
+	}
+	requestError := func(path string, data map[string]interface{}) {
+		resp := handle(path, data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error from %s: %#v", path, resp)
+		}
+	}
+	parseCert := func(resp *logical.Response) *x509.Certificate {
+		cert, err := x509.ParseCertificate(mustPEMBytes(t, resp.Data["certificate"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert
+	}
+
+	request("root/generate/internal", map[string]interface{}{
+		"common_name": "example.com",
+		"ttl":         "6h",
+	})
+
+	requestError("roles/test", map[string]interface{}{
+		"ext_key_usage": "ServerAuth,Bogus",
+	})
+	requestError("roles/test", map[string]interface{}{
+		"allowed_other_sans": "1.2.3;UTF16:foo",
+	})
+	request("roles/test", map[string]interface{}{
+		"allowed_domains":    "ftp*.example.com",
+		"allow_glob_domains": true,
+		"allowed_uri_sans":   "spiffe://example.com/*",
+		"allowed_other_sans": "1.3.6.1.4.1.311.20.2.3;UTF8:*@example.com",
+		"ext_key_usage":      "TimeStamping,ServerAuth",
+		"max_ttl":            "1h",
+	})
+
+	resp := request("issue/test", map[string]interface{}{
+		"common_name": "ftp1.example.com",
+		"ip_sans":     "127.0.0.1",
+		"uri_sans":    "spiffe://example.com/service",
+		"other_sans":  "1.3.6.1.4.1.311.20.2.3;UTF8:user@example.com",
+	})
+	cert := parseCert(resp)
+	if !reflect.DeepEqual(cert.DNSNames, []string{"ftp1.example.com"}) ||
+		len(cert.IPAddresses) != 1 || !cert.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")) ||
+		len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://example.com/service" {
+		t.Fatalf("bad: %#v %#v %#v", cert.DNSNames, cert.IPAddresses, cert.URIs)
+	}
+	if !reflect.DeepEqual(cert.ExtKeyUsage, []x509.ExtKeyUsage{
+		x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageTimeStamping}) {
+		t.Fatalf("bad: %#v", cert.ExtKeyUsage)
+	}
+
+	// The other SAN is encoded in the SAN extension along with the others
+	var otherName struct {
+		TypeID asn1.ObjectIdentifier
+		Value  asn1.RawValue
+	}
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionSubjectAltName) {
+			continue
+		}
+		var names []asn1.RawValue
+		if _, err := asn1.Unmarshal(ext.Value, &names); err != nil {
+			t.Fatal(err)
+		}
+		for _, name := range names {
+			if name.Tag != 0 {
+				continue
+			}
+			if _, err := asn1.UnmarshalWithParams(name.FullBytes, &otherName, "tag:0"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var otherValue string
+	if _, err := asn1.Unmarshal(otherName.Value.Bytes, &otherValue); err != nil {
+		t.Fatal(err)
+	}
+	if otherName.TypeID.String() != "1.3.6.1.4.1.311.20.2.3" || otherValue != "user@example.com" {
+		t.Fatalf("bad: %s %s", otherName.TypeID, otherValue)
+	}
+
+	// Names not allowed by the role are refused
+	requestError("issue/test", map[string]interface{}{
+		"common_name": "www.example.com",
+	})
+	requestError("issue/test", map[string]interface{}{
+		"common_name": "ftp1.example.com.evil.com",
+	})
+	requestError("issue/test", map[string]interface{}{
+		"common_name": "ftp1.example.com",
+		"uri_sans":    "spiffe://other.com/service",
+	})
+	requestError("issue/test", map[string]interface{}{
+		"common_name": "ftp1.example.com",
+		"uri_sans":    "not a uri",
+	})
+	requestError("issue/test", map[string]interface{}{
+		"common_name": "ftp1.example.com",
+		"other_sans":  "1.3.6.1.4.1.311.20.2.3;UTF8:user@other.com",
+	})
+	requestError("issue/test", map[string]interface{}{
+		"common_name": "ftp1.example.com",
+		"other_sans":  "1.2.3;UTF8:user@example.com",
+	})
+
+	// Signing verbatim requires sudo, and takes the values of the CSR
+	if !strutil.StrListContains(b.SpecialPaths().Root, "sign-verbatim/*") {
+		t.Fatalf("bad: %#v", b.SpecialPaths().Root)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "anything.com"},
+		DNSNames: []string{"anything.com"},
+		URIs:     []*url.URL{&url.URL{Scheme: "urn", Opaque: "anything"}},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr}))
+	cert = parseCert(request("sign-verbatim", map[string]interface{}{
+		"csr": csrPEM,
+		"ttl": "1h",
+	}))
+	if cert.Subject.CommonName != "anything.com" || len(cert.URIs) != 1 ||
+		cert.URIs[0].String() != "urn:anything" || len(cert.ExtKeyUsage) != 0 {
+		t.Fatalf("bad: %#v", cert)
+	}
+	cert = parseCert(request("sign-verbatim/test", map[string]interface{}{
+		"csr": csrPEM,
+	}))
+	if cert.Subject.CommonName != "anything.com" || len(cert.ExtKeyUsage) != 3 ||
+		cert.NotAfter.After(time.Now().Add(time.Hour)) {
+		t.Fatalf("bad: %#v", cert)
+	}
+	requestError("sign-verbatim/unknown", map[string]interface{}{
+		"csr": csrPEM,
+	})
+}
+
+func TestBackend_ACME(t *testing.T) {
+	config := logical.TestBackendConfig()
+	storage := &logical.InmemStorage{}
+	config.StorageView = storage
+
+	b := Backend()
+	_, err := b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   storage,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp != nil && resp.IsError() {
+			t.Fatalf("failed request to %s: %#v", path, resp)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, "root/generate/internal", map[string]interface{}{
+		"common_name": "example.com",
+		"ttl":         "6h",
+	})
+	caCert, err := x509.ParseCertificate(mustPEMBytes(t, resp.Data["certificate"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request(logical.UpdateOperation, "roles/acme", map[string]interface{}{
+		"allowed_domains":  "example.com",
+		"allow_subdomains": true,
+		"key_type":         "ec",
+		"key_bits":         256,
+		"max_ttl":          "4h",
+	})
+
+	// The ACME server is disabled until configured
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "acme/directory",
+		Storage:   storage,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[logical.HTTPStatusCode].(int) != 404 {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	baseURL := "https://vault.example.com/v1/pki"
+	resp, err = b.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "config/acme",
+		Storage:   storage,
+		Data: map[string]interface{}{
+			"enabled": true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected an error enabling ACME without base_url and role")
+	}
+	request(logical.UpdateOperation, "config/acme", map[string]interface{}{
+		"enabled":  true,
+		"base_url": baseURL + "/",
+		"role":     "acme",
+	})
+	resp = request(logical.ReadOperation, "config/acme", nil)
+	if resp.Data["base_url"] != baseURL {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// acmeResponse returns the status, headers and decoded body of an ACME
+	// response
+	acmeResponse := func(resp *logical.Response) (int, map[string]string, map[string]interface{}) {
+		body := map[string]interface{}{}
+		if raw := resp.Data[logical.HTTPRawBody].([]byte); len(raw) != 0 &&
+			strings.HasSuffix(resp.Data[logical.HTTPContentType].(string), "json") {
+			if err := json.Unmarshal(raw, &body); err != nil {
+				t.Fatalf("bad body %q: %s", raw, err)
+			}
+		}
+		return resp.Data[logical.HTTPStatusCode].(int), resp.Data[logical.HTTPRawHeaders].(map[string]string), body
+	}
+
+	resp = request(logical.ReadOperation, "acme/directory", nil)
+	status, headers, body := acmeResponse(resp)
+	if status != 200 || body["newOrder"] != baseURL+"/acme/new-order" {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	if headers["Link"] != `<`+baseURL+`/acme/directory>;rel="index"` {
+		t.Fatalf("bad: %#v", headers)
+	}
+	nonce := headers["Replay-Nonce"]
+
+	// acmePost signs requests with ES256, either with the key ID of the
+	// account or with the JWK of the key
+	acmePostRaw := func(key *ecdsa.PrivateKey, kid, path string, payload interface{}) *logical.Response {
+		header := map[string]interface{}{
+			"alg":   "ES256",
+			"nonce": nonce,
+			"url":   baseURL + "/" + path,
+		}
+		if kid != "" {
+			header["kid"] = kid
+		} else {
+			header["jwk"] = map[string]string{
+				"kty": "EC",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			}
+		}
+		headerBytes, err := json.Marshal(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payloadBytes []byte
+		if payload != nil {
+			if payloadBytes, err = json.Marshal(payload); err != nil {
+				t.Fatal(err)
+			}
+		}
+		protected := base64.RawURLEncoding.EncodeToString(headerBytes)
+		encodedPayload := base64.RawURLEncoding.EncodeToString(payloadBytes)
+		sum := sha256.Sum256([]byte(protected + "." + encodedPayload))
+		r, s, err := ecdsa.Sign(rand.Reader, key, sum[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+		resp := request(logical.UpdateOperation, path, map[string]interface{}{
+			"protected": protected,
+			"payload":   encodedPayload,
+			"signature": base64.RawURLEncoding.EncodeToString(signature),
+		})
+		nonce = resp.Data[logical.HTTPRawHeaders].(map[string]string)["Replay-Nonce"]
+		return resp
+	}
+	acmePost := func(key *ecdsa.PrivateKey, kid, path string, payload interface{}) (int, map[string]string, map[string]interface{}) {
+		return acmeResponse(acmePostRaw(key, kid, path, payload))
+	}
+
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, body = acmePost(accountKey, "", "acme/new-account", map[string]interface{}{
+		"onlyReturnExisting": true,
+	})
+	if status != 400 || body["type"] != acmeErrAccountDoesNotExist {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	status, headers, body = acmePost(accountKey, "", "acme/new-account", map[string]interface{}{
+		"contact":              []string{"mailto:admin@example.com"},
+		"termsOfServiceAgreed": true,
+	})
+	if status != 201 || body["status"] != acmeStatusValid {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	kid := headers["Location"]
+	status, headers, _ = acmePost(accountKey, "", "acme/new-account", map[string]interface{}{})
+	if status != 200 || headers["Location"] != kid {
+		t.Fatalf("bad: %d %#v", status, headers)
+	}
+
+	// Nonces are valid only once
+	usedNonce := nonce
+	acmePost(accountKey, kid, "acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "www.example.com"}},
+	})
+	nonce = usedNonce
+	status, _, body = acmePost(accountKey, kid, "acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "www.example.com"}},
+	})
+	if status != 400 || body["type"] != acmeErrBadNonce {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+
+	// The identifiers of orders are subject to the role
+	status, _, body = acmePost(accountKey, kid, "acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{{"type": "dns", "value": "www.example.org"}},
+	})
+	if status != 400 || body["type"] != acmeErrRejectedIdentifier {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+
+	status, headers, body = acmePost(accountKey, kid, "acme/new-order", map[string]interface{}{
+		"identifiers": []map[string]string{
+			{"type": "dns", "value": "www.example.com"},
+			{"type": "dns", "value": "*.example.com"},
+		},
+	})
+	if status != 201 || body["status"] != acmeStatusPending {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	orderURL := headers["Location"]
+	finalizeURL := body["finalize"].(string)
+	authzURLs := body["authorizations"].([]interface{})
+	if len(authzURLs) != 2 {
+		t.Fatalf("bad: %#v", body)
+	}
+
+	csrKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: "www.example.com"},
+		DNSNames: []string{"*.example.com"},
+	}, csrKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalize := map[string]interface{}{
+		"csr": base64.RawURLEncoding.EncodeToString(csrBytes),
+	}
+	path := func(url string) string {
+		return strings.TrimPrefix(url, baseURL+"/")
+	}
+	status, _, body = acmePost(accountKey, kid, path(finalizeURL), finalize)
+	if status != 403 || body["type"] != acmeErrOrderNotReady {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+
+	// Challenges are validated with the key authorizations served over
+	// HTTP and DNS
+	httpResponses := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "www.example.com" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(httpResponses[r.URL.Path]))
+	}))
+	defer server.Close()
+	b.acmeHTTPClient = &http.Client{
+		Transport: &http.Transport{
+			Dial: func(network, addr string) (net.Conn, error) {
+				return net.Dial(network, server.Listener.Addr().String())
+			},
+		},
+	}
+	txtRecords := map[string][]string{}
+	b.acmeLookupTXT = func(name string) ([]string, error) {
+		b.acmeLock.Lock()
+		defer b.acmeLock.Unlock()
+		return txtRecords[name], nil
+	}
+
+	thumbprint := (&acmeJWK{
+		Kty: "EC",
+		Crv: "P-256",
+		X:   base64.RawURLEncoding.EncodeToString(accountKey.X.FillBytes(make([]byte, 32))),
+		Y:   base64.RawURLEncoding.EncodeToString(accountKey.Y.FillBytes(make([]byte, 32))),
+	}).thumbprint()
+	for _, authzURL := range authzURLs {
+		status, _, body = acmePost(accountKey, kid, path(authzURL.(string)), nil)
+		if status != 200 || body["status"] != acmeStatusPending {
+			t.Fatalf("bad: %d %#v", status, body)
+		}
+		identifier := body["identifier"].(map[string]interface{})["value"].(string)
+		wildcard, _ := body["wildcard"].(bool)
+		if identifier != "example.com" && identifier != "www.example.com" || wildcard != (identifier == "example.com") {
+			t.Fatalf("bad: %#v", body)
+		}
+
+		var challenge map[string]interface{}
+		for _, c := range body["challenges"].([]interface{}) {
+			c := c.(map[string]interface{})
+			if wildcard && c["type"] == acmeChallengeHTTP01 {
+				t.Fatalf("wildcard authorization offers http-01: %#v", body)
+			}
+			if (wildcard && c["type"] == acmeChallengeDNS01) || (!wildcard && c["type"] == acmeChallengeHTTP01) {
+				challenge = c
+			}
+		}
+		if challenge == nil {
+			t.Fatalf("bad: %#v", body)
+		}
+		keyAuthorization := challenge["token"].(string) + "." + thumbprint
+		if wildcard {
+			sum := sha256.Sum256([]byte(keyAuthorization))
+			b.acmeLock.Lock()
+			txtRecords["_acme-challenge."+identifier] = []string{base64.RawURLEncoding.EncodeToString(sum[:])}
+			b.acmeLock.Unlock()
+		} else {
+			httpResponses["/.well-known/acme-challenge/"+challenge["token"].(string)] = keyAuthorization
+		}
+
+		status, headers, body = acmePost(accountKey, kid, path(challenge["url"].(string)), map[string]interface{}{})
+		if status != 200 || body["status"] != acmeStatusProcessing {
+			t.Fatalf("bad: %d %#v", status, body)
+		}
+		if !strings.HasPrefix(headers["Link"], `<`+authzURL.(string)+`>;rel="up"`) {
+			t.Fatalf("bad: %#v", headers)
+		}
+
+		for i := 0; ; i++ {
+			status, _, body = acmePost(accountKey, kid, path(authzURL.(string)), nil)
+			if body["status"] != acmeStatusPending {
+				break
+			}
+			if i == 100 {
+				t.Fatalf("authorization was not validated: %#v", body)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		if status != 200 || body["status"] != acmeStatusValid {
+			t.Fatalf("bad: %d %#v", status, body)
+		}
+	}
+
+	status, _, body = acmePost(accountKey, kid, path(orderURL), nil)
+	if status != 200 || body["status"] != acmeStatusReady {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+
+	// The CSR must have exactly the identifiers of the order
+	badCSRBytes, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "www.example.com"},
+	}, csrKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, body = acmePost(accountKey, kid, path(finalizeURL), map[string]interface{}{
+		"csr": base64.RawURLEncoding.EncodeToString(badCSRBytes),
+	})
+	if status != 400 || body["type"] != acmeErrBadCSR {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+
+	status, _, body = acmePost(accountKey, kid, path(finalizeURL), finalize)
+	if status != 200 || body["status"] != acmeStatusValid {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+
+	// The certificate is followed by the CA certificate
+	resp = acmePostRaw(accountKey, kid, path(body["certificate"].(string)), nil)
+	if resp.Data[logical.HTTPContentType] != "application/pem-certificate-chain" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	rest := resp.Data[logical.HTTPRawBody].([]byte)
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) != 2 || !chain[1].Equal(caCert) {
+		t.Fatalf("bad chain of %d certificates", len(chain))
+	}
+	if chain[0].Subject.CommonName != "www.example.com" ||
+		!strutil.EquivalentSlices(chain[0].DNSNames, []string{"www.example.com", "*.example.com"}) {
+		t.Fatalf("bad: %#v %#v", chain[0].Subject, chain[0].DNSNames)
+	}
+	if err := chain[0].CheckSignatureFrom(caCert); err != nil {
+		t.Fatal(err)
+	}
+
+	// Certificates can be revoked with their own key, only once
+	revoke := map[string]interface{}{
+		"certificate": base64.RawURLEncoding.EncodeToString(chain[0].Raw),
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, _, body = acmePost(otherKey, "", "acme/revoke-cert", revoke)
+	if status != 403 || body["type"] != acmeErrUnauthorized {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	status, _, body = acmePost(csrKey, "", "acme/revoke-cert", revoke)
+	if status != 200 {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	status, _, body = acmePost(accountKey, kid, "acme/revoke-cert", revoke)
+	if status != 400 || body["type"] != acmeErrAlreadyRevoked {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	serial := certutil.GetOctalFormatted(chain[0].SerialNumber.Bytes(), ":")
+	resp = request(logical.ReadOperation, "cert/"+serial, nil)
+	if resp.Data["revocation_time"].(int64) == 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Deactivated accounts can no longer be used
+	status, _, body = acmePost(accountKey, kid, path(kid), map[string]interface{}{
+		"status": acmeStatusDeactivated,
+	})
+	if status != 200 || body["status"] != acmeStatusDeactivated {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+	status, _, body = acmePost(accountKey, kid, path(orderURL), nil)
+	if status != 403 || body["type"] != acmeErrUnauthorized {
+		t.Fatalf("bad: %d %#v", status, body)
+	}
+}
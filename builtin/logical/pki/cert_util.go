@@ -8,15 +8,19 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"net"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -35,6 +39,8 @@ type creationBundle struct {
 	DNSNames       []string
 	EmailAddresses []string
 	IPAddresses    []net.IP
+	URIs           []*url.URL
+	OtherSANs      []otherSAN
 	IsCA           bool
 	KeyType        string
 	KeyBits        int
@@ -42,6 +48,7 @@ type creationBundle struct {
 	TTL            time.Duration
 	KeyUsage       x509.KeyUsage
 	ExtKeyUsage    certExtKeyUsage
+	ExtKeyUsages   []x509.ExtKeyUsage
 
 	// Only used when signing a CA cert
 	UseCSRValues bool
@@ -53,6 +60,19 @@ type creationBundle struct {
 	MaxPathLength int
 }
 
+// otherSAN is an otherName Subject Alternative Name with a UTF-8 string value
+type otherSAN struct {
+	// A nil OID matches any other SAN, when used as a role pattern
+	OID   asn1.ObjectIdentifier
+	Value string
+}
+
+func (o otherSAN) String() string {
+	return fmt.Sprintf("%s;UTF8:%s", o.OID, o.Value)
+}
+
+var oidExtensionSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+
 type caInfoBundle struct {
 	certutil.ParsedCertBundle
 	URLs *urlEntries
@@ -84,6 +104,15 @@ func getFormat(data *framework.FieldData) string {
 	return format
 }
 
+// Returns the base64-encoded DER certificates of a CA chain
+func encodeCAChainDER(chain []*certutil.CertBlock) []string {
+	var result []string
+	for _, cert := range chain {
+		result = append(result, base64.StdEncoding.EncodeToString(cert.Bytes))
+	}
+	return result
+}
+
 func validateKeyTypeLength(keyType string, keyBits int) *logical.Response {
 	switch keyType {
 	case "rsa":
@@ -336,6 +365,14 @@ func validateNames(req *logical.Request, names []string, role *roleEntry) (strin
 						break
 					}
 				}
+
+				if role.AllowGlobDomains &&
+					strings.Contains(currDomain, "*") &&
+					(strutil.GlobbedStringsMatch(currDomain, name) ||
+						(isEmail && strutil.GlobbedStringsMatch(currDomain, emailDomain))) {
+					valid = true
+					break
+				}
 			}
 			if valid {
 				continue
@@ -349,6 +386,167 @@ func validateNames(req *logical.Request, names []string, role *roleEntry) (strin
 	return "", nil
 }
 
+// parseOtherSANs parses a comma-separated list of other SANs, in the
+// <oid>;UTF8:<value> format. If allowAny is set, "*" is accepted and
+// matches any other SAN.
+func parseOtherSANs(input string, allowAny bool) ([]otherSAN, error) {
+	var result []otherSAN
+	for _, v := range strings.Split(input, ",") {
+		if v == "" {
+			continue
+		}
+		if allowAny && v == "*" {
+			result = append(result, otherSAN{Value: "*"})
+			continue
+		}
+
+		splitOther := strings.SplitN(v, ";", 2)
+		if len(splitOther) != 2 {
+			return nil, fmt.Errorf("other SAN %q is not in the <oid>;UTF8:<value> format", v)
+		}
+		splitValue := strings.SplitN(splitOther[1], ":", 2)
+		if len(splitValue) != 2 {
+			return nil, fmt.Errorf("other SAN %q is not in the <oid>;UTF8:<value> format", v)
+		}
+		switch splitValue[0] {
+		case "UTF8", "UTF-8":
+		default:
+			return nil, fmt.Errorf("other SAN %q has an unsupported type; only UTF8 is supported", v)
+		}
+
+		var oid asn1.ObjectIdentifier
+		for _, n := range strings.Split(splitOther[0], ".") {
+			i, err := strconv.Atoi(n)
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("other SAN %q has an invalid OID", v)
+			}
+			oid = append(oid, i)
+		}
+		if len(oid) < 2 {
+			return nil, fmt.Errorf("other SAN %q has an invalid OID", v)
+		}
+
+		result = append(result, otherSAN{
+			OID:   oid,
+			Value: splitValue[1],
+		})
+	}
+
+	return result, nil
+}
+
+// Verifies that the requested URI SANs match the globs of the role. If one
+// does not, it is returned.
+func validateURISANs(uris []*url.URL, role *roleEntry) string {
+	for _, uri := range uris {
+		valid := false
+		for _, allowed := range strings.Split(role.AllowedURISANs, ",") {
+			if allowed != "" && strutil.GlobbedStringsMatch(allowed, uri.String()) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return uri.String()
+		}
+	}
+
+	return ""
+}
+
+// Verifies that the requested other SANs match the patterns of the role. If
+// one does not, it is returned.
+func validateOtherSANs(sans []otherSAN, role *roleEntry) (string, error) {
+	allowedSANs, err := parseOtherSANs(role.AllowedOtherSANs, true)
+	if err != nil {
+		return "", err
+	}
+
+	for _, san := range sans {
+		valid := false
+		for _, allowed := range allowedSANs {
+			if allowed.OID == nil ||
+				(allowed.OID.Equal(san.OID) && strutil.GlobbedStringsMatch(allowed.Value, san.Value)) {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return san.String(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// marshalSANs encodes the Subject Alternative Name extension. It is only
+// needed for other SANs, as the x509 package encodes the other types itself.
+func marshalSANs(dnsNames, emailAddresses []string, ipAddresses []net.IP,
+	uris []*url.URL, otherSANs []otherSAN) ([]byte, error) {
+	var rawValues []asn1.RawValue
+	for _, name := range dnsNames {
+		rawValues = append(rawValues, asn1.RawValue{Tag: 2, Class: asn1.ClassContextSpecific, Bytes: []byte(name)})
+	}
+	for _, email := range emailAddresses {
+		rawValues = append(rawValues, asn1.RawValue{Tag: 1, Class: asn1.ClassContextSpecific, Bytes: []byte(email)})
+	}
+	for _, rawIP := range ipAddresses {
+		// If possible, we always want to encode IPv4 addresses in 4 bytes
+		ip := rawIP.To4()
+		if ip == nil {
+			ip = rawIP
+		}
+		rawValues = append(rawValues, asn1.RawValue{Tag: 7, Class: asn1.ClassContextSpecific, Bytes: ip})
+	}
+	for _, uri := range uris {
+		rawValues = append(rawValues, asn1.RawValue{Tag: 6, Class: asn1.ClassContextSpecific, Bytes: []byte(uri.String())})
+	}
+	for _, san := range otherSANs {
+		value, err := asn1.MarshalWithParams(san.Value, "utf8")
+		if err != nil {
+			return nil, err
+		}
+		otherName, err := asn1.MarshalWithParams(struct {
+			TypeID asn1.ObjectIdentifier
+			Value  asn1.RawValue
+		}{
+			TypeID: san.OID,
+			Value:  asn1.RawValue{Tag: 0, Class: asn1.ClassContextSpecific, IsCompound: true, Bytes: value},
+		}, "tag:0")
+		if err != nil {
+			return nil, err
+		}
+		rawValues = append(rawValues, asn1.RawValue{FullBytes: otherName})
+	}
+
+	return asn1.Marshal(rawValues)
+}
+
+// addSANs sets the Subject Alternative Names of the creation bundle on the
+// template, encoding the extension when there are other SANs
+func addSANs(creationInfo *creationBundle, certTemplate *x509.Certificate) error {
+	certTemplate.DNSNames = creationInfo.DNSNames
+	certTemplate.EmailAddresses = creationInfo.EmailAddresses
+	certTemplate.IPAddresses = creationInfo.IPAddresses
+	certTemplate.URIs = creationInfo.URIs
+
+	if len(creationInfo.OtherSANs) == 0 {
+		return nil
+	}
+
+	sans, err := marshalSANs(creationInfo.DNSNames, creationInfo.EmailAddresses,
+		creationInfo.IPAddresses, creationInfo.URIs, creationInfo.OtherSANs)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("error marshalling subject alternative names: %s", err)}
+	}
+	certTemplate.ExtraExtensions = append(certTemplate.ExtraExtensions, pkix.Extension{
+		Id:    oidExtensionSubjectAltName,
+		Value: sans,
+	})
+
+	return nil
+}
+
 func generateCert(b *backend,
 	role *roleEntry,
 	signingBundle *caInfoBundle,
@@ -625,6 +823,46 @@ func generateCreationBundle(b *backend,
 		}
 	}
 
+	// Get and verify any URI SANs
+	uris := []*url.URL{}
+	{
+		uriAlt := data.Get("uri_sans").(string)
+		if len(uriAlt) != 0 {
+			for _, v := range strings.Split(uriAlt, ",") {
+				parsedURI, err := url.Parse(v)
+				if err != nil || parsedURI.Scheme == "" {
+					return nil, errutil.UserError{Err: fmt.Sprintf(
+						"the value '%s' is not a valid URI", v)}
+				}
+				uris = append(uris, parsedURI)
+			}
+
+			if badURI := validateURISANs(uris, role); len(badURI) != 0 {
+				return nil, errutil.UserError{Err: fmt.Sprintf(
+					"URI Subject Alternative Name %s not allowed by this role", badURI)}
+			}
+		}
+	}
+
+	// Get and verify any other SANs
+	var otherSANs []otherSAN
+	{
+		otherSANs, err = parseOtherSANs(data.Get("other_sans").(string), false)
+		if err != nil {
+			return nil, errutil.UserError{Err: err.Error()}
+		}
+
+		badSAN, err := validateOtherSANs(otherSANs, role)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf(
+				"error parsing the other SANs of the role: %s", err)}
+		}
+		if len(badSAN) != 0 {
+			return nil, errutil.UserError{Err: fmt.Sprintf(
+				"other Subject Alternative Name %s not allowed by this role", badSAN)}
+		}
+	}
+
 	// Get the TTL and very it against the max allowed
 	var ttlField string
 	var ttl time.Duration
@@ -695,17 +933,26 @@ func generateCreationBundle(b *backend,
 		}
 	}
 
+	extUsages, err := parseExtKeyUsages(role.ExtKeyUsage)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf(
+			"error parsing the extended key usages of the role: %s", err)}
+	}
+
 	creationBundle := &creationBundle{
 		CommonName:     cn,
 		DNSNames:       dnsNames,
 		EmailAddresses: emailAddresses,
 		IPAddresses:    ipAddresses,
+		URIs:           uris,
+		OtherSANs:      otherSANs,
 		KeyType:        role.KeyType,
 		KeyBits:        role.KeyBits,
 		SigningBundle:  signingBundle,
 		TTL:            ttl,
 		KeyUsage:       x509.KeyUsage(parseKeyUsages(role.KeyUsage)),
 		ExtKeyUsage:    extUsage,
+		ExtKeyUsages:   extUsages,
 	}
 
 	// Don't deal with URLs or max path length if it's self-signed, as these
@@ -762,6 +1009,20 @@ func addKeyUsages(creationInfo *creationBundle, certTemplate *x509.Certificate)
 	if creationInfo.ExtKeyUsage&emailProtectionExtKeyUsage != 0 {
 		certTemplate.ExtKeyUsage = append(certTemplate.ExtKeyUsage, x509.ExtKeyUsageEmailProtection)
 	}
+
+	// Add the extended key usages of the role not already set by its flags
+	for _, usage := range creationInfo.ExtKeyUsages {
+		found := false
+		for _, existing := range certTemplate.ExtKeyUsage {
+			if existing == usage {
+				found = true
+				break
+			}
+		}
+		if !found {
+			certTemplate.ExtKeyUsage = append(certTemplate.ExtKeyUsage, usage)
+		}
+	}
 }
 
 // Performs the heavy lifting of creating a certificate. Returns
@@ -791,15 +1052,16 @@ func createCertificate(creationInfo *creationBundle) (*certutil.ParsedCertBundle
 	}
 
 	certTemplate := &x509.Certificate{
-		SerialNumber:   serialNumber,
-		Subject:        subject,
-		NotBefore:      time.Now().Add(-30 * time.Second),
-		NotAfter:       time.Now().Add(creationInfo.TTL),
-		IsCA:           false,
-		SubjectKeyId:   subjKeyID,
-		DNSNames:       creationInfo.DNSNames,
-		EmailAddresses: creationInfo.EmailAddresses,
-		IPAddresses:    creationInfo.IPAddresses,
+		SerialNumber: serialNumber,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-30 * time.Second),
+		NotAfter:     time.Now().Add(creationInfo.TTL),
+		IsCA:         false,
+		SubjectKeyId: subjKeyID,
+	}
+
+	if err := addSANs(creationInfo, certTemplate); err != nil {
+		return nil, err
 	}
 
 	// Add this before calling addKeyUsages
@@ -858,6 +1120,7 @@ func createCertificate(creationInfo *creationBundle) (*certutil.ParsedCertBundle
 	if creationInfo.SigningBundle != nil {
 		result.IssuingCABytes = creationInfo.SigningBundle.CertificateBytes
 		result.IssuingCA = creationInfo.SigningBundle.Certificate
+		result.CAChain = creationInfo.SigningBundle.GetCAChain()
 	} else {
 		result.IssuingCABytes = result.CertificateBytes
 		result.IssuingCA = result.Certificate
@@ -888,6 +1151,19 @@ func createCSR(creationInfo *creationBundle) (*certutil.ParsedCSRBundle, error)
 		DNSNames:       creationInfo.DNSNames,
 		EmailAddresses: creationInfo.EmailAddresses,
 		IPAddresses:    creationInfo.IPAddresses,
+		URIs:           creationInfo.URIs,
+	}
+
+	if len(creationInfo.OtherSANs) != 0 {
+		sans, err := marshalSANs(creationInfo.DNSNames, creationInfo.EmailAddresses,
+			creationInfo.IPAddresses, creationInfo.URIs, creationInfo.OtherSANs)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("error marshalling subject alternative names: %s", err)}
+		}
+		csrTemplate.ExtraExtensions = append(csrTemplate.ExtraExtensions, pkix.Extension{
+			Id:    oidExtensionSubjectAltName,
+			Value: sans,
+		})
 	}
 
 	switch creationInfo.KeyType {
@@ -967,12 +1243,13 @@ func signCertificate(creationInfo *creationBundle,
 		certTemplate.DNSNames = csr.DNSNames
 		certTemplate.EmailAddresses = csr.EmailAddresses
 		certTemplate.IPAddresses = csr.IPAddresses
+		certTemplate.URIs = csr.URIs
 
 		certTemplate.ExtraExtensions = csr.Extensions
 	} else {
-		certTemplate.DNSNames = creationInfo.DNSNames
-		certTemplate.EmailAddresses = creationInfo.EmailAddresses
-		certTemplate.IPAddresses = creationInfo.IPAddresses
+		if err := addSANs(creationInfo, certTemplate); err != nil {
+			return nil, err
+		}
 	}
 
 	addKeyUsages(creationInfo, certTemplate)
@@ -1013,6 +1290,7 @@ func signCertificate(creationInfo *creationBundle,
 
 	result.IssuingCABytes = creationInfo.SigningBundle.CertificateBytes
 	result.IssuingCA = creationInfo.SigningBundle.Certificate
+	result.CAChain = creationInfo.SigningBundle.GetCAChain()
 
 	return result, nil
 }
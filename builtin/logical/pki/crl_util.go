@@ -116,6 +116,33 @@ func revokeCert(b *backend, req *logical.Request, serial string, fromLease bool)
 	}, nil
 }
 
+// Rebuilds the CRL when less than a tenth of its lifetime remains, so that
+// it never expires for lack of revocations. There is nothing to rebuild until
+// a CA is set, which builds the first CRL.
+func (b *backend) rebuildExpiringCRL(req *logical.Request) error {
+	b.revokeStorageLock.RLock()
+	defer b.revokeStorageLock.RUnlock()
+
+	entry, err := req.Storage.Get("crl")
+	if err != nil {
+		return err
+	}
+	if entry == nil || len(entry.Value) == 0 {
+		return nil
+	}
+
+	certList, err := x509.ParseCRL(entry.Value)
+	if err == nil {
+		thisUpdate := certList.TBSCertList.ThisUpdate
+		nextUpdate := certList.TBSCertList.NextUpdate
+		if time.Now().Before(nextUpdate.Add(-nextUpdate.Sub(thisUpdate) / 10)) {
+			return nil
+		}
+	}
+
+	return buildCRL(b, req)
+}
+
 // Builds a CRL by going through the list of revoked certificates and building
 // a new CRL with the stored revocation times and serial numbers.
 func buildCRL(b *backend, req *logical.Request) error {
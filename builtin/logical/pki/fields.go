@@ -28,6 +28,19 @@ certificate pem. Defaults to "pem".`,
 comma-delimited list`,
 	}
 
+	fields["uri_sans"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `The requested URI SANs, if any, in a
+comma-delimited list`,
+	}
+
+	fields["other_sans"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `The requested other SANs, if any, in a
+comma-delimited list, in the format
+<oid>;UTF8:<value>`,
+	}
+
 	return fields
 }
 
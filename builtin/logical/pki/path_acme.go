@@ -0,0 +1,1040 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// acmeOrderLifetime is how long ACME orders and their authorizations remain
+// valid
+const acmeOrderLifetime = 24 * time.Hour
+
+// Statuses of ACME objects
+const (
+	acmeStatusPending     = "pending"
+	acmeStatusProcessing  = "processing"
+	acmeStatusReady       = "ready"
+	acmeStatusValid       = "valid"
+	acmeStatusInvalid     = "invalid"
+	acmeStatusDeactivated = "deactivated"
+)
+
+// Types of ACME challenges
+const (
+	acmeChallengeHTTP01 = "http-01"
+	acmeChallengeDNS01  = "dns-01"
+)
+
+// acmeKeyMode is how the JWS of an ACME request identifies its key
+type acmeKeyMode int
+
+const (
+	// The request is not signed
+	acmeKeyNone acmeKeyMode = iota
+	// The request has a JWK, as when creating an account
+	acmeKeyJWK
+	// The request has the key ID of an account
+	acmeKeyKID
+	// The request has either
+	acmeKeyAny
+)
+
+type acmeAccount struct {
+	ID        string    `json:"id"`
+	Key       *acmeJWK  `json:"key"`
+	Status    string    `json:"status"`
+	Contact   []string  `json:"contact"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeOrder struct {
+	ID                string           `json:"id"`
+	Status            string           `json:"status"`
+	Expires           time.Time        `json:"expires"`
+	Identifiers       []acmeIdentifier `json:"identifiers"`
+	AuthorizationIDs  []string         `json:"authorization_ids"`
+	CertificateSerial string           `json:"certificate_serial"`
+}
+
+type acmeAuthorization struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status"`
+	Expires    time.Time        `json:"expires"`
+	Identifier acmeIdentifier   `json:"identifier"`
+	Wildcard   bool             `json:"wildcard"`
+	Challenges []*acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type      string     `json:"type"`
+	Token     string     `json:"token"`
+	Status    string     `json:"status"`
+	Validated time.Time  `json:"validated"`
+	Error     *acmeError `json:"error"`
+}
+
+// acmeRequest is a verified ACME request
+type acmeRequest struct {
+	config *acmeConfig
+
+	// The JWK of the request, or the account of its key ID
+	jwk     *acmeJWK
+	account *acmeAccount
+
+	// The payload is empty for POST-as-GET requests
+	payload []byte
+}
+
+type acmeOperationFunc func(*logical.Request, *framework.FieldData, *acmeRequest) (*logical.Response, error)
+
+func pathACME(b *backend) []*framework.Path {
+	acmePath := func(pattern string, op logical.Operation, keyMode acmeKeyMode, f acmeOperationFunc) *framework.Path {
+		return &framework.Path{
+			Pattern: "acme/" + pattern,
+			Fields: map[string]*framework.FieldSchema{
+				"id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "ID of the ACME resource",
+				},
+				"type": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Type of the ACME challenge",
+				},
+				"protected": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Protected header of the JWS",
+				},
+				"payload": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Payload of the JWS",
+				},
+				"signature": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Signature of the JWS",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				op: b.acmeHandler(keyMode, f),
+			},
+
+			HelpSynopsis:    pathACMEHelpSyn,
+			HelpDescription: pathACMEHelpDesc,
+		}
+	}
+
+	return []*framework.Path{
+		acmePath("directory", logical.ReadOperation, acmeKeyNone, b.pathACMEDirectory),
+		acmePath("new-nonce", logical.ReadOperation, acmeKeyNone, b.pathACMENewNonce),
+		acmePath("new-account", logical.UpdateOperation, acmeKeyJWK, b.pathACMENewAccount),
+		acmePath("account/"+framework.GenericNameRegex("id"), logical.UpdateOperation, acmeKeyKID, b.pathACMEAccount),
+		acmePath("account/"+framework.GenericNameRegex("id")+"/orders", logical.UpdateOperation, acmeKeyKID, b.pathACMEAccountOrders),
+		acmePath("new-order", logical.UpdateOperation, acmeKeyKID, b.pathACMENewOrder),
+		acmePath("order/"+framework.GenericNameRegex("id"), logical.UpdateOperation, acmeKeyKID, b.pathACMEOrder),
+		acmePath("order/"+framework.GenericNameRegex("id")+"/finalize", logical.UpdateOperation, acmeKeyKID, b.pathACMEFinalize),
+		acmePath("authorization/"+framework.GenericNameRegex("id"), logical.UpdateOperation, acmeKeyKID, b.pathACMEAuthorization),
+		acmePath("challenge/"+framework.GenericNameRegex("id")+"/(?P<type>http-01|dns-01)", logical.UpdateOperation, acmeKeyKID, b.pathACMEChallenge),
+		acmePath("cert/"+framework.GenericNameRegex("id"), logical.UpdateOperation, acmeKeyKID, b.pathACMECert),
+		acmePath("revoke-cert", logical.UpdateOperation, acmeKeyAny, b.pathACMERevokeCert),
+	}
+}
+
+// acmeURL returns the URL of an ACME resource
+func (c *acmeConfig) acmeURL(parts ...string) string {
+	return c.BaseURL + "/acme/" + strings.Join(parts, "/")
+}
+
+// acmeHandler verifies ACME requests before handling them, and turns the
+// responses and ACME errors into raw responses with a new nonce
+func (b *backend) acmeHandler(keyMode acmeKeyMode, f acmeOperationFunc) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		config, err := b.acmeConfig(req.Storage)
+		if err != nil {
+			return nil, err
+		}
+		if !config.Enabled {
+			return acmeErrorResponse(&acmeError{Type: acmeErrMalformed, Detail: "ACME is not enabled on this mount", Status: 404})
+		}
+
+		// State changes of ACME objects are serialized; challenges are
+		// validated in the background
+		b.acmeLock.Lock()
+		defer b.acmeLock.Unlock()
+
+		resp, err := b.handleACME(req, data, config, keyMode, f)
+		if acmeErr, ok := err.(*acmeError); ok {
+			resp, err = acmeErrorResponse(acmeErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		nonce, err := b.acmeNonces.get()
+		if err != nil {
+			return nil, err
+		}
+		headers := resp.Data[logical.HTTPRawHeaders].(map[string]string)
+		headers["Replay-Nonce"] = nonce
+		index := fmt.Sprintf(`<%s>;rel="index"`, config.acmeURL("directory"))
+		if link, ok := headers["Link"]; ok {
+			headers["Link"] = link + ", " + index
+		} else {
+			headers["Link"] = index
+		}
+
+		return resp, nil
+	}
+}
+
+func (b *backend) handleACME(req *logical.Request, data *framework.FieldData,
+	config *acmeConfig, keyMode acmeKeyMode, f acmeOperationFunc) (*logical.Response, error) {
+	r := &acmeRequest{
+		config: config,
+	}
+	if keyMode == acmeKeyNone {
+		return f(req, data, r)
+	}
+
+	accountPrefix := config.acmeURL("account") + "/"
+	header, payload, err := parseJWS(data.Get("protected").(string),
+		data.Get("payload").(string), data.Get("signature").(string),
+		func(kid string) (*acmeJWK, error) {
+			if keyMode == acmeKeyJWK {
+				return nil, &acmeError{Type: acmeErrMalformed, Detail: "the request must have a jwk", Status: 400}
+			}
+			if !strings.HasPrefix(kid, accountPrefix) {
+				return nil, &acmeError{Type: acmeErrAccountDoesNotExist, Detail: "unknown key ID", Status: 400}
+			}
+			account, err := b.acmeAccount(req.Storage, strings.TrimPrefix(kid, accountPrefix))
+			if err != nil {
+				return nil, err
+			}
+			if account == nil {
+				return nil, &acmeError{Type: acmeErrAccountDoesNotExist, Detail: "unknown key ID", Status: 400}
+			}
+			if account.Status != acmeStatusValid {
+				return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the account is " + account.Status, Status: 403}
+			}
+			r.account = account
+			return account.Key, nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	if keyMode == acmeKeyKID && r.account == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "the request must have a kid", Status: 400}
+	}
+	if r.account == nil {
+		r.jwk = header.JWK
+	}
+
+	if !b.acmeNonces.redeem(header.Nonce) {
+		return nil, &acmeError{Type: acmeErrBadNonce, Detail: "invalid or expired nonce", Status: 400}
+	}
+	if header.URL != config.BaseURL+"/"+req.Path {
+		return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the url of the request does not match", Status: 403}
+	}
+
+	r.payload = payload
+	return f(req, data, r)
+}
+
+// acmeJSONResponse returns a raw JSON response, to which headers can be
+// added
+func acmeJSONResponse(status int, body interface{}) (*logical.Response, error) {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return acmeRawResponse(status, "application/json", bodyBytes), nil
+}
+
+func acmeRawResponse(status int, contentType string, body []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPStatusCode:  status,
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
+			logical.HTTPRawHeaders:  map[string]string{},
+		},
+	}
+}
+
+func acmeErrorResponse(acmeErr *acmeError) (*logical.Response, error) {
+	resp, err := acmeJSONResponse(acmeErr.Status, acmeErr)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data[logical.HTTPContentType] = "application/problem+json"
+	return resp, nil
+}
+
+// acmeDecodePayload decodes the JSON payload of a request
+func acmeDecodePayload(r *acmeRequest, out interface{}) error {
+	if err := json.Unmarshal(r.payload, out); err != nil {
+		return &acmeError{Type: acmeErrMalformed, Detail: fmt.Sprintf("invalid payload: %s", err), Status: 400}
+	}
+	return nil
+}
+
+func acmeGet(s logical.Storage, key string, out interface{}) (bool, error) {
+	entry, err := s.Get(key)
+	if err != nil {
+		return false, err
+	}
+	if entry == nil {
+		return false, nil
+	}
+	if err := entry.DecodeJSON(out); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func acmePut(s logical.Storage, key string, v interface{}) error {
+	entry, err := logical.StorageEntryJSON(key, v)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func (b *backend) acmeAccount(s logical.Storage, id string) (*acmeAccount, error) {
+	var account acmeAccount
+	ok, err := acmeGet(s, "acme/accounts/"+id, &account)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// acmeAuthorization returns an authorization of the account; pending and
+// valid authorizations become invalid once expired
+func (b *backend) acmeAuthorization(s logical.Storage, accountID, id string) (*acmeAuthorization, error) {
+	var authz acmeAuthorization
+	ok, err := acmeGet(s, "acme/authorizations/"+accountID+"/"+id, &authz)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if (authz.Status == acmeStatusPending || authz.Status == acmeStatusValid) &&
+		time.Now().After(authz.Expires) {
+		authz.Status = acmeStatusInvalid
+	}
+
+	return &authz, nil
+}
+
+// acmeOrder returns an order of the account, whose pending status is
+// updated from the ones of its authorizations
+func (b *backend) acmeOrder(s logical.Storage, accountID, id string) (*acmeOrder, error) {
+	var order acmeOrder
+	ok, err := acmeGet(s, "acme/orders/"+accountID+"/"+id, &order)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	switch order.Status {
+	case acmeStatusPending:
+		ready := true
+		for _, authzID := range order.AuthorizationIDs {
+			authz, err := b.acmeAuthorization(s, accountID, authzID)
+			if err != nil {
+				return nil, err
+			}
+			if authz == nil || (authz.Status != acmeStatusPending && authz.Status != acmeStatusValid) {
+				order.Status = acmeStatusInvalid
+				break
+			}
+			if authz.Status != acmeStatusValid {
+				ready = false
+			}
+		}
+		if order.Status == acmeStatusPending && ready {
+			order.Status = acmeStatusReady
+		}
+	}
+	if (order.Status == acmeStatusPending || order.Status == acmeStatusReady) &&
+		time.Now().After(order.Expires) {
+		order.Status = acmeStatusInvalid
+	}
+
+	return &order, nil
+}
+
+func acmeAccountJSON(config *acmeConfig, account *acmeAccount) map[string]interface{} {
+	contact := account.Contact
+	if contact == nil {
+		contact = []string{}
+	}
+	return map[string]interface{}{
+		"status":  account.Status,
+		"contact": contact,
+		"orders":  config.acmeURL("account", account.ID, "orders"),
+	}
+}
+
+func acmeOrderJSON(config *acmeConfig, order *acmeOrder) map[string]interface{} {
+	authorizations := []string{}
+	for _, authzID := range order.AuthorizationIDs {
+		authorizations = append(authorizations, config.acmeURL("authorization", authzID))
+	}
+
+	result := map[string]interface{}{
+		"status":         order.Status,
+		"expires":        order.Expires.Format(time.RFC3339),
+		"identifiers":    order.Identifiers,
+		"authorizations": authorizations,
+		"finalize":       config.acmeURL("order", order.ID, "finalize"),
+	}
+	if order.CertificateSerial != "" {
+		result["certificate"] = config.acmeURL("cert", order.ID)
+	}
+	return result
+}
+
+func acmeChallengeJSON(config *acmeConfig, authz *acmeAuthorization, challenge *acmeChallenge) map[string]interface{} {
+	result := map[string]interface{}{
+		"type":   challenge.Type,
+		"url":    config.acmeURL("challenge", authz.ID, challenge.Type),
+		"token":  challenge.Token,
+		"status": challenge.Status,
+	}
+	if !challenge.Validated.IsZero() {
+		result["validated"] = challenge.Validated.Format(time.RFC3339)
+	}
+	if challenge.Error != nil {
+		result["error"] = challenge.Error
+	}
+	return result
+}
+
+func acmeAuthorizationJSON(config *acmeConfig, authz *acmeAuthorization) map[string]interface{} {
+	challenges := []map[string]interface{}{}
+	for _, challenge := range authz.Challenges {
+		challenges = append(challenges, acmeChallengeJSON(config, authz, challenge))
+	}
+
+	result := map[string]interface{}{
+		"status":     authz.Status,
+		"expires":    authz.Expires.Format(time.RFC3339),
+		"identifier": authz.Identifier,
+		"challenges": challenges,
+	}
+	if authz.Wildcard {
+		result["wildcard"] = true
+	}
+	return result
+}
+
+func validateACMEContacts(contact []string) error {
+	for _, c := range contact {
+		if !strings.HasPrefix(c, "mailto:") || len(c) == len("mailto:") {
+			return &acmeError{Type: acmeErrInvalidContact, Detail: fmt.Sprintf("unsupported contact %q; only mailto: contacts are supported", c), Status: 400}
+		}
+	}
+	return nil
+}
+
+func (b *backend) pathACMEDirectory(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	return acmeJSONResponse(http.StatusOK, map[string]interface{}{
+		"newNonce":   r.config.acmeURL("new-nonce"),
+		"newAccount": r.config.acmeURL("new-account"),
+		"newOrder":   r.config.acmeURL("new-order"),
+		"revokeCert": r.config.acmeURL("revoke-cert"),
+		"meta": map[string]interface{}{
+			"externalAccountRequired": false,
+		},
+	})
+}
+
+func (b *backend) pathACMENewNonce(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	resp := acmeRawResponse(http.StatusOK, "application/json", []byte{})
+	resp.Data[logical.HTTPRawHeaders].(map[string]string)["Cache-Control"] = "no-store"
+	return resp, nil
+}
+
+func (b *backend) pathACMENewAccount(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	var payload struct {
+		Contact              []string `json:"contact"`
+		TermsOfServiceAgreed bool     `json:"termsOfServiceAgreed"`
+		OnlyReturnExisting   bool     `json:"onlyReturnExisting"`
+	}
+	if err := acmeDecodePayload(r, &payload); err != nil {
+		return nil, err
+	}
+
+	// Accounts are looked up by the thumbprint of their key
+	keyStorageKey := "acme/account-keys/" + r.jwk.thumbprint()
+	entry, err := req.Storage.Get(keyStorageKey)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		account, err := b.acmeAccount(req.Storage, string(entry.Value))
+		if err != nil {
+			return nil, err
+		}
+		if account == nil {
+			return nil, fmt.Errorf("account %s of key not found", entry.Value)
+		}
+		if account.Status != acmeStatusValid {
+			return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the account is " + account.Status, Status: 403}
+		}
+
+		resp, err := acmeJSONResponse(http.StatusOK, acmeAccountJSON(r.config, account))
+		if err != nil {
+			return nil, err
+		}
+		resp.Data[logical.HTTPRawHeaders].(map[string]string)["Location"] = r.config.acmeURL("account", account.ID)
+		return resp, nil
+	}
+	if payload.OnlyReturnExisting {
+		return nil, &acmeError{Type: acmeErrAccountDoesNotExist, Detail: "no account exists with the key", Status: 400}
+	}
+	if err := validateACMEContacts(payload.Contact); err != nil {
+		return nil, err
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	account := &acmeAccount{
+		ID:        id,
+		Key:       r.jwk,
+		Status:    acmeStatusValid,
+		Contact:   payload.Contact,
+		CreatedAt: time.Now(),
+	}
+	if err := acmePut(req.Storage, "acme/accounts/"+id, account); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(&logical.StorageEntry{
+		Key:   keyStorageKey,
+		Value: []byte(id),
+	}); err != nil {
+		return nil, err
+	}
+
+	resp, err := acmeJSONResponse(http.StatusCreated, acmeAccountJSON(r.config, account))
+	if err != nil {
+		return nil, err
+	}
+	resp.Data[logical.HTTPRawHeaders].(map[string]string)["Location"] = r.config.acmeURL("account", id)
+	return resp, nil
+}
+
+func (b *backend) pathACMEAccount(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	account := r.account
+	if account.ID != data.Get("id").(string) {
+		return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the key ID does not match the account", Status: 403}
+	}
+
+	if len(r.payload) != 0 {
+		var payload struct {
+			Contact []string `json:"contact"`
+			Status  string   `json:"status"`
+		}
+		if err := acmeDecodePayload(r, &payload); err != nil {
+			return nil, err
+		}
+
+		switch payload.Status {
+		case "":
+		case acmeStatusDeactivated:
+			account.Status = acmeStatusDeactivated
+		default:
+			return nil, &acmeError{Type: acmeErrMalformed, Detail: fmt.Sprintf("invalid account status %q", payload.Status), Status: 400}
+		}
+		if payload.Contact != nil {
+			if err := validateACMEContacts(payload.Contact); err != nil {
+				return nil, err
+			}
+			account.Contact = payload.Contact
+		}
+
+		if err := acmePut(req.Storage, "acme/accounts/"+account.ID, account); err != nil {
+			return nil, err
+		}
+	}
+
+	return acmeJSONResponse(http.StatusOK, acmeAccountJSON(r.config, account))
+}
+
+func (b *backend) pathACMEAccountOrders(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	if r.account.ID != data.Get("id").(string) {
+		return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the key ID does not match the account", Status: 403}
+	}
+
+	ids, err := req.Storage.List("acme/orders/" + r.account.ID + "/")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(ids)
+	orders := []string{}
+	for _, id := range ids {
+		orders = append(orders, r.config.acmeURL("order", id))
+	}
+
+	return acmeJSONResponse(http.StatusOK, map[string]interface{}{
+		"orders": orders,
+	})
+}
+
+func (b *backend) pathACMENewOrder(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	var payload struct {
+		Identifiers []acmeIdentifier `json:"identifiers"`
+		NotBefore   string           `json:"notBefore"`
+		NotAfter    string           `json:"notAfter"`
+	}
+	if err := acmeDecodePayload(r, &payload); err != nil {
+		return nil, err
+	}
+	if len(payload.Identifiers) == 0 {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "the order has no identifiers", Status: 400}
+	}
+	if payload.NotBefore != "" || payload.NotAfter != "" {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "notBefore and notAfter are not supported; the role sets the validity of certificates", Status: 400}
+	}
+
+	role, err := b.getRole(req.Storage, r.config.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("ACME role %s not found", r.config.Role)
+	}
+
+	// The identifiers must be allowed by the role
+	var identifiers []acmeIdentifier
+	for _, identifier := range payload.Identifiers {
+		if identifier.Type != "dns" {
+			return nil, &acmeError{Type: acmeErrUnsupportedIdent, Detail: fmt.Sprintf("unsupported identifier type %q", identifier.Type), Status: 400}
+		}
+		value := strings.ToLower(identifier.Value)
+		badName, err := validateNames(req, []string{value}, role)
+		if err != nil {
+			return nil, err
+		}
+		if badName != "" || strings.Contains(value, "@") {
+			return nil, &acmeError{Type: acmeErrRejectedIdentifier, Detail: fmt.Sprintf("name %s not allowed by the policy of this server", identifier.Value), Status: 400}
+		}
+
+		duplicate := false
+		for _, existing := range identifiers {
+			duplicate = duplicate || existing.Value == value
+		}
+		if !duplicate {
+			identifiers = append(identifiers, acmeIdentifier{Type: "dns", Value: value})
+		}
+	}
+
+	expires := time.Now().Add(acmeOrderLifetime)
+	orderID, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	order := &acmeOrder{
+		ID:          orderID,
+		Status:      acmeStatusPending,
+		Expires:     expires,
+		Identifiers: identifiers,
+	}
+
+	// Each identifier is authorized separately; wildcard names can only be
+	// validated through DNS
+	for _, identifier := range identifiers {
+		authzID, err := uuid.GenerateUUID()
+		if err != nil {
+			return nil, err
+		}
+		authz := &acmeAuthorization{
+			ID:         authzID,
+			Status:     acmeStatusPending,
+			Expires:    expires,
+			Identifier: identifier,
+		}
+		if strings.HasPrefix(identifier.Value, "*.") {
+			authz.Identifier.Value = identifier.Value[2:]
+			authz.Wildcard = true
+		}
+
+		challengeTypes := []string{acmeChallengeHTTP01, acmeChallengeDNS01}
+		if authz.Wildcard {
+			challengeTypes = []string{acmeChallengeDNS01}
+		}
+		for _, challengeType := range challengeTypes {
+			tokenBytes := make([]byte, 32)
+			if _, err := rand.Read(tokenBytes); err != nil {
+				return nil, err
+			}
+			authz.Challenges = append(authz.Challenges, &acmeChallenge{
+				Type:   challengeType,
+				Token:  base64.RawURLEncoding.EncodeToString(tokenBytes),
+				Status: acmeStatusPending,
+			})
+		}
+
+		if err := acmePut(req.Storage, "acme/authorizations/"+r.account.ID+"/"+authzID, authz); err != nil {
+			return nil, err
+		}
+		order.AuthorizationIDs = append(order.AuthorizationIDs, authzID)
+	}
+
+	if err := acmePut(req.Storage, "acme/orders/"+r.account.ID+"/"+orderID, order); err != nil {
+		return nil, err
+	}
+
+	resp, err := acmeJSONResponse(http.StatusCreated, acmeOrderJSON(r.config, order))
+	if err != nil {
+		return nil, err
+	}
+	resp.Data[logical.HTTPRawHeaders].(map[string]string)["Location"] = r.config.acmeURL("order", orderID)
+	return resp, nil
+}
+
+func (b *backend) pathACMEOrder(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	order, err := b.acmeOrder(req.Storage, r.account.ID, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "order not found", Status: 404}
+	}
+
+	return acmeJSONResponse(http.StatusOK, acmeOrderJSON(r.config, order))
+}
+
+func (b *backend) pathACMEFinalize(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	order, err := b.acmeOrder(req.Storage, r.account.ID, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "order not found", Status: 404}
+	}
+	if order.Status != acmeStatusReady {
+		return nil, &acmeError{Type: acmeErrOrderNotReady, Detail: "the order is " + order.Status, Status: 403}
+	}
+
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := acmeDecodePayload(r, &payload); err != nil {
+		return nil, err
+	}
+	csrBytes, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		return nil, &acmeError{Type: acmeErrBadCSR, Detail: "invalid CSR encoding", Status: 400}
+	}
+	csr, err := x509.ParseCertificateRequest(csrBytes)
+	if err != nil {
+		return nil, &acmeError{Type: acmeErrBadCSR, Detail: "the CSR could not be parsed", Status: 400}
+	}
+
+	// The CSR must request exactly the identifiers of the order
+	var names, expected []string
+	if csr.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(csr.Subject.CommonName))
+	}
+	for _, name := range csr.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+	for _, identifier := range order.Identifiers {
+		expected = append(expected, identifier.Value)
+	}
+	if !strutil.EquivalentSlices(names, expected) || len(csr.EmailAddresses) != 0 ||
+		len(csr.IPAddresses) != 0 || len(csr.URIs) != 0 {
+		return nil, &acmeError{Type: acmeErrBadCSR, Detail: "the names of the CSR do not match the identifiers of the order", Status: 400}
+	}
+
+	role, err := b.getRole(req.Storage, r.config.Role)
+	if err != nil {
+		return nil, err
+	}
+	if role == nil {
+		return nil, fmt.Errorf("ACME role %s not found", r.config.Role)
+	}
+	role.UseCSRCommonName = false
+
+	signingBundle, err := fetchCAInfo(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching CA certificate: %s", err)
+	}
+
+	commonName := strings.ToLower(csr.Subject.CommonName)
+	if commonName == "" {
+		commonName = expected[0]
+	}
+	signData := &framework.FieldData{
+		Raw: map[string]interface{}{
+			"csr":         string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})),
+			"common_name": commonName,
+			"alt_names":   strings.Join(expected, ","),
+		},
+		Schema: pathSign(b).Fields,
+	}
+	parsedBundle, err := signCert(b, role, signingBundle, false, false, req, signData)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return nil, &acmeError{Type: acmeErrBadCSR, Detail: err.Error(), Status: 400}
+		default:
+			return nil, err
+		}
+	}
+
+	cb, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		return nil, fmt.Errorf("error converting raw cert bundle to cert bundle: %s", err)
+	}
+	if err := req.Storage.Put(&logical.StorageEntry{
+		Key:   "certs/" + cb.SerialNumber,
+		Value: parsedBundle.CertificateBytes,
+	}); err != nil {
+		return nil, fmt.Errorf("unable to store certificate locally: %s", err)
+	}
+
+	// Certificates issued to accounts can be revoked with their key
+	if err := req.Storage.Put(&logical.StorageEntry{
+		Key:   "acme/certs/" + cb.SerialNumber,
+		Value: []byte(r.account.ID),
+	}); err != nil {
+		return nil, err
+	}
+
+	order.Status = acmeStatusValid
+	order.CertificateSerial = cb.SerialNumber
+	if err := acmePut(req.Storage, "acme/orders/"+r.account.ID+"/"+order.ID, order); err != nil {
+		return nil, err
+	}
+
+	resp, err := acmeJSONResponse(http.StatusOK, acmeOrderJSON(r.config, order))
+	if err != nil {
+		return nil, err
+	}
+	resp.Data[logical.HTTPRawHeaders].(map[string]string)["Location"] = r.config.acmeURL("order", order.ID)
+	return resp, nil
+}
+
+func (b *backend) pathACMEAuthorization(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	authz, err := b.acmeAuthorization(req.Storage, r.account.ID, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if authz == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "authorization not found", Status: 404}
+	}
+
+	if len(r.payload) != 0 {
+		var payload struct {
+			Status string `json:"status"`
+		}
+		if err := acmeDecodePayload(r, &payload); err != nil {
+			return nil, err
+		}
+		if payload.Status != acmeStatusDeactivated {
+			return nil, &acmeError{Type: acmeErrMalformed, Detail: fmt.Sprintf("invalid authorization status %q", payload.Status), Status: 400}
+		}
+		if authz.Status != acmeStatusPending && authz.Status != acmeStatusValid {
+			return nil, &acmeError{Type: acmeErrMalformed, Detail: "the authorization is " + authz.Status, Status: 400}
+		}
+
+		authz.Status = acmeStatusDeactivated
+		if err := acmePut(req.Storage, "acme/authorizations/"+r.account.ID+"/"+authz.ID, authz); err != nil {
+			return nil, err
+		}
+	}
+
+	return acmeJSONResponse(http.StatusOK, acmeAuthorizationJSON(r.config, authz))
+}
+
+func (b *backend) pathACMEChallenge(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	authz, err := b.acmeAuthorization(req.Storage, r.account.ID, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if authz == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "authorization not found", Status: 404}
+	}
+	var challenge *acmeChallenge
+	for _, c := range authz.Challenges {
+		if c.Type == data.Get("type").(string) {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "challenge not found", Status: 404}
+	}
+
+	// Responding to a pending challenge starts its validation in the
+	// background, which the client follows through the authorization
+	if len(r.payload) != 0 && authz.Status == acmeStatusPending && challenge.Status == acmeStatusPending {
+		challenge.Status = acmeStatusProcessing
+		if err := acmePut(req.Storage, "acme/authorizations/"+r.account.ID+"/"+authz.ID, authz); err != nil {
+			return nil, err
+		}
+
+		keyAuthorization := challenge.Token + "." + r.account.Key.thumbprint()
+		go b.acmeValidateChallenge(req.Storage, r.account.ID, authz.ID,
+			challenge.Type, authz.Identifier.Value, challenge.Token, keyAuthorization)
+	}
+
+	resp, err := acmeJSONResponse(http.StatusOK, acmeChallengeJSON(r.config, authz, challenge))
+	if err != nil {
+		return nil, err
+	}
+	resp.Data[logical.HTTPRawHeaders].(map[string]string)["Link"] = fmt.Sprintf(`<%s>;rel="up"`, r.config.acmeURL("authorization", authz.ID))
+	return resp, nil
+}
+
+func (b *backend) pathACMECert(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	order, err := b.acmeOrder(req.Storage, r.account.ID, data.Get("id").(string))
+	if err != nil {
+		return nil, err
+	}
+	if order == nil || order.CertificateSerial == "" {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "certificate not found", Status: 404}
+	}
+
+	certEntry, err := fetchCertBySerial(req, "certs/", order.CertificateSerial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry == nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "certificate not found", Status: 404}
+	}
+	signingBundle, err := fetchCAInfo(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching CA certificate: %s", err)
+	}
+
+	// The certificate is followed by its chain
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certEntry.Value})
+	for _, block := range signingBundle.GetCAChain() {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: block.Bytes})...)
+	}
+
+	return acmeRawResponse(http.StatusOK, "application/pem-certificate-chain", chain), nil
+}
+
+func (b *backend) pathACMERevokeCert(
+	req *logical.Request, data *framework.FieldData, r *acmeRequest) (*logical.Response, error) {
+	var payload struct {
+		Certificate string `json:"certificate"`
+	}
+	if err := acmeDecodePayload(r, &payload); err != nil {
+		return nil, err
+	}
+	certBytes, err := base64.RawURLEncoding.DecodeString(payload.Certificate)
+	if err != nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "invalid certificate encoding", Status: 400}
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "the certificate could not be parsed", Status: 400}
+	}
+
+	serial := certutil.GetOctalFormatted(cert.SerialNumber.Bytes(), ":")
+	certEntry, err := fetchCertBySerial(req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry == nil || !bytes.Equal(certEntry.Value, certBytes) {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: "certificate not found", Status: 404}
+	}
+
+	// Certificates can be revoked by the account they were issued to, or
+	// with their own key
+	if r.account != nil {
+		owner, err := req.Storage.Get("acme/certs/" + serial)
+		if err != nil {
+			return nil, err
+		}
+		if owner == nil || string(owner.Value) != r.account.ID {
+			return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the certificate was not issued to this account", Status: 403}
+		}
+	} else {
+		key, err := r.jwk.publicKey()
+		if err != nil {
+			return nil, err
+		}
+		keyBytes, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		certKeyBytes, err := x509.MarshalPKIXPublicKey(cert.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(keyBytes, certKeyBytes) {
+			return nil, &acmeError{Type: acmeErrUnauthorized, Detail: "the key does not match the certificate", Status: 403}
+		}
+	}
+
+	revokedEntry, err := fetchCertBySerial(req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revokedEntry != nil {
+		return nil, &acmeError{Type: acmeErrAlreadyRevoked, Detail: "the certificate is already revoked", Status: 400}
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	resp, err := revokeCert(b, req, serial, false)
+	if err != nil {
+		return nil, err
+	}
+	if resp != nil && resp.IsError() {
+		return nil, &acmeError{Type: acmeErrMalformed, Detail: resp.Data["error"].(string), Status: 400}
+	}
+
+	return acmeRawResponse(http.StatusOK, "application/json", []byte{}), nil
+}
+
+const pathACMEHelpSyn = `
+ACME server of the backend.
+`
+
+const pathACMEHelpDesc = `
+These paths implement the ACME protocol (RFC 8555), which lets standard
+ACME clients obtain certificates from this backend once it is enabled
+through the 'config/acme' endpoint. Clients start from the directory at
+'acme/directory'.
+`
@@ -0,0 +1,143 @@
+package pki
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// acmeConfig is the configuration of the ACME server of the backend
+type acmeConfig struct {
+	Enabled bool   `json:"enabled" structs:"enabled" mapstructure:"enabled"`
+	BaseURL string `json:"base_url" structs:"base_url" mapstructure:"base_url"`
+	Role    string `json:"role" structs:"role" mapstructure:"role"`
+}
+
+func pathConfigACME(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/acme",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Set to true to enable the ACME server`,
+			},
+
+			"base_url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The URL of this mount as reachable by ACME
+clients, e.g. https://vault.example.com:8200/v1/pki`,
+			},
+
+			"role": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The role whose policy applies to the
+identifiers of ACME orders, and which issues
+their certificates`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathACMEConfigRead,
+			logical.UpdateOperation: b.pathACMEConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigACMEHelpSyn,
+		HelpDescription: pathConfigACMEHelpDesc,
+	}
+}
+
+func (b *backend) acmeConfig(s logical.Storage) (*acmeConfig, error) {
+	entry, err := s.Get("config/acme")
+	if err != nil {
+		return nil, err
+	}
+
+	var result acmeConfig
+	if entry == nil {
+		return &result, nil
+	}
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathACMEConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.acmeConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":  config.Enabled,
+			"base_url": config.BaseURL,
+			"role":     config.Role,
+		},
+	}, nil
+}
+
+func (b *backend) pathACMEConfigWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.acmeConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if baseURLRaw, ok := data.GetOk("base_url"); ok {
+		config.BaseURL = strings.TrimSuffix(baseURLRaw.(string), "/")
+	}
+	if roleRaw, ok := data.GetOk("role"); ok {
+		config.Role = roleRaw.(string)
+	}
+
+	if config.BaseURL != "" {
+		u, err := url.Parse(config.BaseURL)
+		if err != nil || !u.IsAbs() {
+			return logical.ErrorResponse(fmt.Sprintf("invalid base_url %q", config.BaseURL)), nil
+		}
+	}
+	if config.Role != "" {
+		role, err := b.getRole(req.Storage, config.Role)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return logical.ErrorResponse(fmt.Sprintf("unknown role: %s", config.Role)), nil
+		}
+	}
+	if config.Enabled && (config.BaseURL == "" || config.Role == "") {
+		return logical.ErrorResponse("base_url and role are required to enable the ACME server"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config/acme", config)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigACMEHelpSyn = `
+Configure the ACME server of the backend.
+`
+
+const pathConfigACMEHelpDesc = `
+This endpoint configures the ACME server, which lets standard ACME clients
+obtain certificates from this backend. Its directory is served at
+'acme/directory'. The identifiers of orders are subject to the policy of
+the given role, which also issues their certificates. The 'base_url' is the
+URL of this mount as reachable by clients, from which the URLs of the ACME
+resources are built.
+`
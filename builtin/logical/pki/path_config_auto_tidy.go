@@ -0,0 +1,131 @@
+package pki
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathConfigAutoTidy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/auto-tidy",
+		Fields: map[string]*framework.FieldSchema{
+			"enabled": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Set to true to enable automatic tidy operations`,
+			},
+
+			"interval_duration": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The interval between automatic tidy operations.
+Defaults to 12 hours.`,
+				Default: 43200, //12h
+			},
+
+			"tidy_cert_store": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to true to enable tidying up
+the certificate store`,
+			},
+
+			"tidy_revocation_list": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Set to true to enable tidying up
+the revocation list`,
+			},
+
+			"safety_buffer": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The amount of extra time that must have passed
+beyond certificate expiration before it is removed
+from the backend storage and/or revocation list.
+Defaults to 72 hours.`,
+				Default: 259200, //72h
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathAutoTidyRead,
+			logical.UpdateOperation: b.pathAutoTidyWrite,
+		},
+
+		HelpSynopsis:    pathConfigAutoTidyHelpSyn,
+		HelpDescription: pathConfigAutoTidyHelpDesc,
+	}
+}
+
+// Returns the configuration of automatic tidy operations, which are disabled
+// unless configured
+func (b *backend) autoTidyConfig(s logical.Storage) (*tidyConfig, error) {
+	entry, err := s.Get("config/auto_tidy")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return &tidyConfig{
+			Interval:     12 * time.Hour,
+			SafetyBuffer: 72 * time.Hour,
+		}, nil
+	}
+
+	var result tidyConfig
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathAutoTidyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.autoTidyConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":              config.Enabled,
+			"interval_duration":    int64(config.Interval.Seconds()),
+			"tidy_cert_store":      config.CertStore,
+			"tidy_revocation_list": config.RevocationList,
+			"safety_buffer":        int64(config.SafetyBuffer.Seconds()),
+		},
+	}, nil
+}
+
+func (b *backend) pathAutoTidyWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := &tidyConfig{
+		Enabled:        data.Get("enabled").(bool),
+		Interval:       time.Duration(data.Get("interval_duration").(int)) * time.Second,
+		CertStore:      data.Get("tidy_cert_store").(bool),
+		RevocationList: data.Get("tidy_revocation_list").(bool),
+		SafetyBuffer:   time.Duration(data.Get("safety_buffer").(int)) * time.Second,
+	}
+	if config.Enabled && !config.CertStore && !config.RevocationList {
+		return logical.ErrorResponse("automatic tidy operations must tidy up the certificate store, the revocation list, or both"), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("config/auto_tidy", config)
+	if err != nil {
+		return nil, err
+	}
+	err = req.Storage.Put(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+const pathConfigAutoTidyHelpSyn = `
+Configure automatic tidy operations.
+`
+
+const pathConfigAutoTidyHelpDesc = `
+This endpoint configures tidy operations which run automatically in the
+background, every 'interval_duration', with the same parameters as the
+'tidy' endpoint. They are disabled unless 'enabled' is set.
+`
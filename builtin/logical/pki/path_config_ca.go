@@ -1,6 +1,7 @@
 package pki
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/hashicorp/vault/helper/certutil"
@@ -75,6 +76,16 @@ func (b *backend) pathCAWrite(
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
+	// An issuing CA given along with the certificate is the start of its
+	// chain
+	if parsedBundle.IssuingCA != nil &&
+		!bytes.Equal(parsedBundle.IssuingCABytes, parsedBundle.CertificateBytes) {
+		parsedBundle.CAChain = []*certutil.CertBlock{&certutil.CertBlock{
+			Certificate: parsedBundle.IssuingCA,
+			Bytes:       parsedBundle.IssuingCABytes,
+		}}
+	}
+
 	cb, err := parsedBundle.ToCertBundle()
 	if err != nil {
 		return nil, fmt.Errorf("error converting raw values into cert bundle: %s", err)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -91,6 +92,26 @@ func (b *backend) pathCRLWrite(
 		return nil, err
 	}
 
+	// Rebuild the current CRL, if any, so that the new expiry applies
+	crlEntry, err := req.Storage.Get("crl")
+	if err != nil {
+		return nil, err
+	}
+	if crlEntry == nil {
+		return nil, nil
+	}
+
+	b.revokeStorageLock.RLock()
+	defer b.revokeStorageLock.RUnlock()
+
+	crlErr := buildCRL(b, req)
+	switch crlErr.(type) {
+	case errutil.UserError:
+		return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
+	case errutil.InternalError:
+		return nil, fmt.Errorf("Error encountered during CRL building: %s", crlErr)
+	}
+
 	return nil, nil
 }
 
@@ -99,5 +120,7 @@ Configure the CRL expiration.
 `
 
 const pathConfigCRLHelpDesc = `
-This endpoint allows configuration of the CRL lifetime.
+This endpoint allows configuration of the CRL lifetime. Setting it rebuilds
+the current CRL with the new lifetime. The CRL is also rebuilt automatically
+before it expires.
 `
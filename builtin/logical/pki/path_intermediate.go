@@ -1,7 +1,9 @@
 package pki
 
 import (
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 
 	"github.com/hashicorp/vault/helper/certutil"
@@ -38,7 +40,8 @@ func pathSetSignedIntermediate(b *backend) *framework.Path {
 				Description: `PEM-format certificate. This must be a CA
 certificate with a public key matching the
 previously-generated key from the generation
-endpoint.`,
+endpoint. It may be followed by the chain of its
+issuing CA certificates.`,
 			},
 		},
 
@@ -130,26 +133,11 @@ func (b *backend) pathSetSignedIntermediate(
 		return logical.ErrorResponse("no certificate provided in the \"certficate\" parameter"), nil
 	}
 
-	inputBundle, err := certutil.ParsePEMBundle(cert)
+	certs, err := parseCertificatesPEM(cert)
 	if err != nil {
-		switch err.(type) {
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return logical.ErrorResponse(err.Error()), nil
-		}
-	}
-
-	// If only one certificate is provided and it's a CA
-	// the parsing will assign it to the IssuingCA, so move it over
-	if inputBundle.Certificate == nil && inputBundle.IssuingCA != nil {
-		inputBundle.Certificate = inputBundle.IssuingCA
-		inputBundle.IssuingCA = nil
-		inputBundle.CertificateBytes = inputBundle.IssuingCABytes
-		inputBundle.IssuingCABytes = nil
+		return logical.ErrorResponse(err.Error()), nil
 	}
-
-	if inputBundle.Certificate == nil {
+	if len(certs) == 0 {
 		return logical.ErrorResponse("supplied certificate could not be successfully parsed"), nil
 	}
 
@@ -179,18 +167,44 @@ func (b *backend) pathSetSignedIntermediate(
 		return nil, fmt.Errorf("saved key could not be parsed successfully")
 	}
 
-	equal, err := certutil.ComparePublicKeys(parsedCB.PrivateKey.Public(), inputBundle.Certificate.PublicKey)
-	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf(
-			"error matching public keys: %v", err)), nil
+	// The signed certificate is the one matching the stored key; any other
+	// certificates must form the chain of its issuers
+	var signed *certutil.CertBlock
+	var others []*certutil.CertBlock
+	for _, c := range certs {
+		equal, err := certutil.ComparePublicKeys(parsedCB.PrivateKey.Public(), c.Certificate.PublicKey)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"error matching public keys: %v", err)), nil
+		}
+		if equal && signed == nil {
+			signed = c
+		} else {
+			others = append(others, c)
+		}
 	}
-	if !equal {
+	if signed == nil {
 		return logical.ErrorResponse("key in certificate does not match stored key"), nil
 	}
 
-	inputBundle.PrivateKey = parsedCB.PrivateKey
-	inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
-	inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
+	chain, err := buildCAChain(signed, others)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	inputBundle := &certutil.ParsedCertBundle{
+		Certificate:      signed.Certificate,
+		CertificateBytes: signed.Bytes,
+		CAChain:          chain,
+		PrivateKey:       parsedCB.PrivateKey,
+		PrivateKeyType:   parsedCB.PrivateKeyType,
+		PrivateKeyFormat: parsedCB.PrivateKeyFormat,
+		PrivateKeyBytes:  parsedCB.PrivateKeyBytes,
+	}
+	if len(chain) > 0 {
+		inputBundle.IssuingCA = chain[0].Certificate
+		inputBundle.IssuingCABytes = chain[0].Bytes
+	}
 
 	if !inputBundle.Certificate.IsCA {
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
@@ -232,6 +246,60 @@ func (b *backend) pathSetSignedIntermediate(
 	return nil, err
 }
 
+// Parses the PEM-encoded certificates of the input, which must not contain
+// anything else
+func parseCertificatesPEM(input string) ([]*certutil.CertBlock, error) {
+	var certs []*certutil.CertBlock
+	rest := []byte(input)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block of type %q; only certificates may be provided", block.Type)
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing certificate: %v", err)
+		}
+		certs = append(certs, &certutil.CertBlock{
+			Certificate: cert,
+			Bytes:       block.Bytes,
+		})
+	}
+
+	return certs, nil
+}
+
+// Orders the given certificates into the chain of issuers of the
+// certificate, starting with its issuer. All of the certificates must be
+// part of the chain, in any order.
+func buildCAChain(cert *certutil.CertBlock, others []*certutil.CertBlock) ([]*certutil.CertBlock, error) {
+	var chain []*certutil.CertBlock
+	current := cert
+	for len(others) > 0 {
+		found := -1
+		for i, c := range others {
+			if current.Certificate.CheckSignatureFrom(c.Certificate) == nil {
+				found = i
+				break
+			}
+		}
+		if found < 0 {
+			return nil, fmt.Errorf("certificate with subject %q is not part of the chain of the signed certificate", others[0].Certificate.Subject.CommonName)
+		}
+
+		current = others[found]
+		chain = append(chain, current)
+		others = append(others[:found], others[found+1:]...)
+	}
+
+	return chain, nil
+}
+
 const pathGenerateIntermediateHelpSyn = `
 Generate a new CSR and private key used for signing.
 `
@@ -245,5 +313,10 @@ Provide the signed intermediate CA cert.
 `
 
 const pathSetSignedIntermediateHelpDesc = `
+This sets the signed intermediate CA certificate, whose key must be the one
+previously generated by "intermediate/generate". The certificate may be
+followed by the chain of its issuing CA certificates, which is returned as
+"ca_chain" along with the certificates issued by this mount.
+
 See the API documentation for more information.
 `
@@ -53,14 +53,14 @@ func pathSign(b *backend) *framework.Path {
 
 func pathSignVerbatim(b *backend) *framework.Path {
 	ret := &framework.Path{
-		Pattern: "sign-verbatim/" + framework.GenericNameRegex("role"),
+		Pattern: "sign-verbatim" + framework.OptionalParamRegex("role"),
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.UpdateOperation: b.pathSignVerbatim,
 		},
 
-		HelpSynopsis:    pathSignHelpSyn,
-		HelpDescription: pathSignHelpDesc,
+		HelpSynopsis:    pathSignVerbatimHelpSyn,
+		HelpDescription: pathSignVerbatimHelpDesc,
 	}
 
 	ret.Fields = addNonCACommonFields(map[string]*framework.FieldSchema{})
@@ -113,7 +113,7 @@ func (b *backend) pathSign(
 }
 
 // pathSignVerbatim issues a certificate from a submitted CSR, *not* subject to
-// role restrictions
+// role restrictions. If a role is given, its TTLs and key usages are used.
 func (b *backend) pathSignVerbatim(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 
@@ -123,8 +123,30 @@ func (b *backend) pathSignVerbatim(
 		AllowLocalhost:   true,
 		AllowAnyName:     true,
 		AllowIPSANs:      true,
+		AllowedURISANs:   "*",
+		AllowedOtherSANs: "*",
 		EnforceHostnames: false,
 		KeyType:          "any",
+		UseCSRCommonName: true,
+	}
+
+	if roleName := data.Get("role").(string); roleName != "" {
+		entry, err := b.getRole(req.Storage, roleName)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			return logical.ErrorResponse(fmt.Sprintf("Unknown role: %s", roleName)), nil
+		}
+
+		role.TTL = entry.TTL
+		role.MaxTTL = entry.MaxTTL
+		role.KeyUsage = entry.KeyUsage
+		role.ExtKeyUsage = entry.ExtKeyUsage
+		role.ServerFlag = entry.ServerFlag
+		role.ClientFlag = entry.ClientFlag
+		role.CodeSigningFlag = entry.CodeSigningFlag
+		role.EmailProtectionFlag = entry.EmailProtectionFlag
 	}
 
 	return b.pathIssueSignCert(req, data, role, true, true)
@@ -184,6 +206,7 @@ func (b *backend) pathIssueSignCert(
 	case "pem":
 		resp.Data["issuing_ca"] = cb.IssuingCA
 		resp.Data["certificate"] = cb.Certificate
+		resp.Data["ca_chain"] = cb.CAChain
 
 		if !useCSR {
 			resp.Data["private_key"] = cb.PrivateKey
@@ -193,6 +216,7 @@ func (b *backend) pathIssueSignCert(
 	case "pem_bundle":
 		resp.Data["issuing_ca"] = cb.IssuingCA
 		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, cb.IssuingCA)
+		resp.Data["ca_chain"] = cb.CAChain
 		if !useCSR {
 			resp.Data["private_key"] = cb.PrivateKey
 			resp.Data["private_key_type"] = cb.PrivateKeyType
@@ -202,6 +226,7 @@ func (b *backend) pathIssueSignCert(
 	case "der":
 		resp.Data["certificate"] = base64.StdEncoding.EncodeToString(parsedBundle.CertificateBytes)
 		resp.Data["issuing_ca"] = base64.StdEncoding.EncodeToString(parsedBundle.IssuingCABytes)
+		resp.Data["ca_chain"] = encodeCAChainDER(parsedBundle.CAChain)
 		if !useCSR {
 			resp.Data["private_key"] = base64.StdEncoding.EncodeToString(parsedBundle.PrivateKeyBytes)
 		}
@@ -246,3 +271,14 @@ requested common name is allowed by the role policy.
 This path requires a CSR; if you want Vault to generate a private key
 for you, use the issue path instead.
 `
+
+const pathSignVerbatimHelpSyn = `
+Request certificates with the values of a CSR, not subject to role restrictions.
+`
+
+const pathSignVerbatimHelpDesc = `
+This path signs a CSR taking its subject, Subject Alternative Names and
+extensions verbatim, except for basic constraints. It is not subject to
+role restrictions, and so requires sudo access. If a role is given, its
+TTLs and key usages are used; otherwise the backend default TTL is used.
+`
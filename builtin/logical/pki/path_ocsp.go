@@ -0,0 +1,358 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"math/big"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// The ASN.1 structures of OCSP requests and responses, per RFC 6960
+
+const (
+	ocspSuccessful       asn1.Enumerated = 0
+	ocspMalformedRequest asn1.Enumerated = 1
+	ocspInternalError    asn1.Enumerated = 2
+	ocspUnauthorized     asn1.Enumerated = 6
+)
+
+var (
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPNonce         = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+
+	oidSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspTBSRequest struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   []ocspSingleRequest
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspSingleRequest struct {
+	CertID     ocspCertID
+	Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+// The status of the certificate is exactly one of Good, Revoked and Unknown
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time `asn1:"generalized"`
+}
+
+func pathOCSP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp(/(?P<req>.+))?`,
+		Fields: map[string]*framework.FieldSchema{
+			"req": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Base64-encoded DER OCSP request, for GET requests`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathOCSPRead,
+			logical.UpdateOperation: b.pathOCSPWrite,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+func (b *backend) pathOCSPRead(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	reqBytes, err := base64.StdEncoding.DecodeString(data.Get("req").(string))
+	if err != nil {
+		return ocspErrorResponse(ocspMalformedRequest), nil
+	}
+	return b.respondOCSP(req, reqBytes)
+}
+
+func (b *backend) pathOCSPWrite(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	reqBytes, ok := req.Data[logical.HTTPRawBody].([]byte)
+	if !ok {
+		return ocspErrorResponse(ocspMalformedRequest), nil
+	}
+	return b.respondOCSP(req, reqBytes)
+}
+
+// Answers an OCSP request with the status of each requested certificate,
+// signed by the CA. Certificates of other issuers have an unknown status.
+func (b *backend) respondOCSP(req *logical.Request, reqBytes []byte) (*logical.Response, error) {
+	var ocspReq ocspRequest
+	rest, err := asn1.Unmarshal(reqBytes, &ocspReq)
+	if err != nil || len(rest) != 0 || len(ocspReq.TBSRequest.RequestList) == 0 {
+		return ocspErrorResponse(ocspMalformedRequest), nil
+	}
+
+	caInfo, err := fetchCAInfo(req)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return ocspErrorResponse(ocspUnauthorized), nil
+		default:
+			b.Logger().Printf("[ERR] pki: error fetching CA for OCSP response: %s", err)
+			return ocspErrorResponse(ocspInternalError), nil
+		}
+	}
+
+	b.revokeStorageLock.RLock()
+	defer b.revokeStorageLock.RUnlock()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	responseData := ocspResponseData{
+		ResponderID: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1,
+			IsCompound: true,
+			Bytes:      caInfo.Certificate.RawSubject,
+		},
+		ProducedAt: now,
+	}
+	for _, ext := range ocspReq.TBSRequest.Extensions {
+		if ext.Id.Equal(oidOCSPNonce) {
+			responseData.Extensions = append(responseData.Extensions, ext)
+		}
+	}
+
+	for _, single := range ocspReq.TBSRequest.RequestList {
+		resp := ocspSingleResponse{
+			CertID:     single.CertID,
+			ThisUpdate: now,
+		}
+		if err := ocspCertStatus(req, caInfo, &resp); err != nil {
+			b.Logger().Printf("[ERR] pki: error fetching certificate status for OCSP response: %s", err)
+			return ocspErrorResponse(ocspInternalError), nil
+		}
+		responseData.Responses = append(responseData.Responses, resp)
+	}
+
+	respBytes, err := signOCSPResponse(caInfo, responseData)
+	if err != nil {
+		b.Logger().Printf("[ERR] pki: error signing OCSP response: %s", err)
+		return ocspErrorResponse(ocspInternalError), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/ocsp-response",
+			logical.HTTPRawBody:     respBytes,
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
+
+// Sets the status of the certificate identified in the response: revoked or
+// good if it was issued by the CA, unknown otherwise
+func ocspCertStatus(req *logical.Request, caInfo *caInfoBundle, resp *ocspSingleResponse) error {
+	h := ocspHash(resp.CertID.HashAlgorithm.Algorithm)
+	if h == nil || resp.CertID.SerialNumber == nil {
+		resp.Unknown = true
+		return nil
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(caInfo.Certificate.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return err
+	}
+	h.Write(caInfo.Certificate.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	if !bytes.Equal(nameHash, resp.CertID.IssuerNameHash) || !bytes.Equal(keyHash, resp.CertID.IssuerKeyHash) {
+		resp.Unknown = true
+		return nil
+	}
+
+	serial := certutil.GetOctalFormatted(resp.CertID.SerialNumber.Bytes(), ":")
+	revokedEntry, err := req.Storage.Get("revoked/" + serial)
+	if err != nil {
+		return err
+	}
+	if revokedEntry != nil {
+		var revInfo revocationInfo
+		if err := revokedEntry.DecodeJSON(&revInfo); err != nil {
+			return err
+		}
+		resp.Revoked = ocspRevokedInfo{
+			RevocationTime: time.Unix(revInfo.RevocationTime, 0).UTC(),
+		}
+		return nil
+	}
+
+	certEntry, err := req.Storage.Get("certs/" + serial)
+	if err != nil {
+		return err
+	}
+	if certEntry != nil {
+		resp.Good = true
+	} else {
+		resp.Unknown = true
+	}
+	return nil
+}
+
+// Signs the response data with the key of the CA, and returns the DER
+// encoding of the successful OCSP response, which includes the CA
+// certificate for clients to find the signer
+func signOCSPResponse(caInfo *caInfoBundle, responseData ocspResponseData) ([]byte, error) {
+	tbs, err := asn1.Marshal(responseData)
+	if err != nil {
+		return nil, err
+	}
+
+	var sigAlg pkix.AlgorithmIdentifier
+	switch caInfo.PrivateKeyType {
+	case certutil.RSAPrivateKey:
+		sigAlg = pkix.AlgorithmIdentifier{
+			Algorithm:  oidSHA256WithRSA,
+			Parameters: asn1.RawValue{Tag: asn1.TagNull},
+		}
+	case certutil.ECPrivateKey:
+		sigAlg = pkix.AlgorithmIdentifier{
+			Algorithm: oidECDSAWithSHA256,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported CA key type %s", caInfo.PrivateKeyType)
+	}
+
+	digest := sha256.Sum256(tbs)
+	signature, err := caInfo.PrivateKey.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		return nil, err
+	}
+
+	basic, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: sigAlg,
+		Signature: asn1.BitString{
+			Bytes:     signature,
+			BitLength: 8 * len(signature),
+		},
+		Certificates: []asn1.RawValue{
+			asn1.RawValue{FullBytes: caInfo.Certificate.Raw},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspResponse{
+		Status: ocspSuccessful,
+		ResponseBytes: ocspResponseBytes{
+			ResponseType: oidOCSPBasicResponse,
+			Response:     basic,
+		},
+	})
+}
+
+// Returns a new hash of the algorithm of a certificate ID, or nil if it is
+// not supported
+func ocspHash(oid asn1.ObjectIdentifier) hash.Hash {
+	switch {
+	case oid.Equal(oidSHA1):
+		return sha1.New()
+	case oid.Equal(oidSHA256):
+		return sha256.New()
+	case oid.Equal(oidSHA384):
+		return sha512.New384()
+	case oid.Equal(oidSHA512):
+		return sha512.New()
+	default:
+		return nil
+	}
+}
+
+// Returns an unsuccessful OCSP response; it is still an HTTP success
+func ocspErrorResponse(status asn1.Enumerated) *logical.Response {
+	respBytes, _ := asn1.Marshal(struct {
+		Status asn1.Enumerated
+	}{status})
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/ocsp-response",
+			logical.HTTPRawBody:     respBytes,
+			logical.HTTPStatusCode:  200,
+		},
+	}
+}
+
+const pathOCSPHelpSyn = `
+Query the revocation status of certificates with OCSP.
+`
+
+const pathOCSPHelpDesc = `
+This is an OCSP responder, per RFC 6960. DER-encoded OCSP requests are
+either POSTed to "ocsp" with the "application/ocsp-request" content type, or
+base64-encoded in the path of a GET to "ocsp/<request>". Responses are
+signed by the CA of this backend.
+`
@@ -83,6 +83,14 @@ including wildcard subdomains. See the documentation for
 more information.`,
 			},
 
+			"allow_glob_domains": &framework.FieldSchema{
+				Type:    framework.TypeBool,
+				Default: false,
+				Description: `If set, domains specified in "allowed_domains"
+can include glob patterns, e.g. "ftp*.example.com". See
+the documentation for more information.`,
+			},
+
 			"allow_any_name": &framework.FieldSchema{
 				Type:    framework.TypeBool,
 				Default: false,
@@ -105,6 +113,24 @@ CN and SANs. Defaults to true.`,
 Any valid IP is accepted.`,
 			},
 
+			"allowed_uri_sans": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "",
+				Description: `If set, a comma-separated list of the URI
+Subject Alternative Names clients can request. Any
+valid URI is accepted; these values support globbing.`,
+			},
+
+			"allowed_other_sans": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "",
+				Description: `If set, a comma-separated list of the other
+Subject Alternative Names clients can request, in the
+same format as the "other_sans" parameter of the issue
+and sign endpoints: <oid>;UTF8:<value>. The values
+support globbing; "*" allows any other SAN.`,
+			},
+
 			"server_flag": &framework.FieldSchema{
 				Type:    framework.TypeBool,
 				Default: true,
@@ -159,6 +185,17 @@ To remove all key usages from being set, set
 this value to an empty string.`,
 			},
 
+			"ext_key_usage": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "",
+				Description: `A comma-separated set of extended key usages,
+in addition to the ones set by the server_flag,
+client_flag, code_signing_flag and
+email_protection_flag options. Valid values can be
+found at https://golang.org/pkg/crypto/x509/#ExtKeyUsage
+-- simply drop the "ExtKeyUsage" part of the name.`,
+			},
+
 			"use_csr_common_name": &framework.FieldSchema{
 				Type:    framework.TypeBool,
 				Default: true,
@@ -317,9 +354,12 @@ func (b *backend) pathRoleCreate(
 		AllowedDomains:      data.Get("allowed_domains").(string),
 		AllowBareDomains:    data.Get("allow_bare_domains").(bool),
 		AllowSubdomains:     data.Get("allow_subdomains").(bool),
+		AllowGlobDomains:    data.Get("allow_glob_domains").(bool),
 		AllowAnyName:        data.Get("allow_any_name").(bool),
 		EnforceHostnames:    data.Get("enforce_hostnames").(bool),
 		AllowIPSANs:         data.Get("allow_ip_sans").(bool),
+		AllowedURISANs:      data.Get("allowed_uri_sans").(string),
+		AllowedOtherSANs:    data.Get("allowed_other_sans").(string),
 		ServerFlag:          data.Get("server_flag").(bool),
 		ClientFlag:          data.Get("client_flag").(bool),
 		CodeSigningFlag:     data.Get("code_signing_flag").(bool),
@@ -328,6 +368,7 @@ func (b *backend) pathRoleCreate(
 		KeyBits:             data.Get("key_bits").(int),
 		UseCSRCommonName:    data.Get("use_csr_common_name").(bool),
 		KeyUsage:            data.Get("key_usage").(string),
+		ExtKeyUsage:         data.Get("ext_key_usage").(string),
 	}
 
 	if entry.KeyType == "rsa" && entry.KeyBits < 2048 {
@@ -377,6 +418,14 @@ func (b *backend) pathRoleCreate(
 		return errResp, nil
 	}
 
+	if _, err := parseExtKeyUsages(entry.ExtKeyUsage); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	if _, err := parseOtherSANs(entry.AllowedOtherSANs, true); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
 	// Store it
 	jsonEntry, err := logical.StorageEntryJSON("role/"+name, entry)
 	if err != nil {
@@ -418,6 +467,42 @@ func parseKeyUsages(input string) int {
 	return int(parsedKeyUsages)
 }
 
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"any":                            x509.ExtKeyUsageAny,
+	"serverauth":                     x509.ExtKeyUsageServerAuth,
+	"clientauth":                     x509.ExtKeyUsageClientAuth,
+	"codesigning":                    x509.ExtKeyUsageCodeSigning,
+	"emailprotection":                x509.ExtKeyUsageEmailProtection,
+	"ipsecendsystem":                 x509.ExtKeyUsageIPSECEndSystem,
+	"ipsectunnel":                    x509.ExtKeyUsageIPSECTunnel,
+	"ipsecuser":                      x509.ExtKeyUsageIPSECUser,
+	"timestamping":                   x509.ExtKeyUsageTimeStamping,
+	"ocspsigning":                    x509.ExtKeyUsageOCSPSigning,
+	"microsoftservergatedcrypto":     x509.ExtKeyUsageMicrosoftServerGatedCrypto,
+	"netscapeservergatedcrypto":      x509.ExtKeyUsageNetscapeServerGatedCrypto,
+	"microsoftcommercialcodesigning": x509.ExtKeyUsageMicrosoftCommercialCodeSigning,
+	"microsoftkernelcodesigning":     x509.ExtKeyUsageMicrosoftKernelCodeSigning,
+}
+
+// parseExtKeyUsages parses a comma-separated set of extended key usages;
+// unlike key usages, unknown values are an error
+func parseExtKeyUsages(input string) ([]x509.ExtKeyUsage, error) {
+	var parsedExtKeyUsages []x509.ExtKeyUsage
+	for _, k := range strings.Split(input, ",") {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if k == "" {
+			continue
+		}
+		usage, ok := extKeyUsages[k]
+		if !ok {
+			return nil, fmt.Errorf("unknown extended key usage %q", k)
+		}
+		parsedExtKeyUsages = append(parsedExtKeyUsages, usage)
+	}
+
+	return parsedExtKeyUsages, nil
+}
+
 type roleEntry struct {
 	LeaseMax              string `json:"lease_max" structs:"lease_max" mapstructure:"lease_max"`
 	Lease                 string `json:"lease" structs:"lease" mapstructure:"lease"`
@@ -430,9 +515,12 @@ type roleEntry struct {
 	AllowBareDomains      bool   `json:"allow_bare_domains" structs:"allow_bare_domains" mapstructure:"allow_bare_domains"`
 	AllowTokenDisplayName bool   `json:"allow_token_displayname" structs:"allow_token_displayname" mapstructure:"allow_token_displayname"`
 	AllowSubdomains       bool   `json:"allow_subdomains" structs:"allow_subdomains" mapstructure:"allow_subdomains"`
+	AllowGlobDomains      bool   `json:"allow_glob_domains" structs:"allow_glob_domains" mapstructure:"allow_glob_domains"`
 	AllowAnyName          bool   `json:"allow_any_name" structs:"allow_any_name" mapstructure:"allow_any_name"`
 	EnforceHostnames      bool   `json:"enforce_hostnames" structs:"enforce_hostnames" mapstructure:"enforce_hostnames"`
 	AllowIPSANs           bool   `json:"allow_ip_sans" structs:"allow_ip_sans" mapstructure:"allow_ip_sans"`
+	AllowedURISANs        string `json:"allowed_uri_sans" structs:"allowed_uri_sans" mapstructure:"allowed_uri_sans"`
+	AllowedOtherSANs      string `json:"allowed_other_sans" structs:"allowed_other_sans" mapstructure:"allowed_other_sans"`
 	ServerFlag            bool   `json:"server_flag" structs:"server_flag" mapstructure:"server_flag"`
 	ClientFlag            bool   `json:"client_flag" structs:"client_flag" mapstructure:"client_flag"`
 	CodeSigningFlag       bool   `json:"code_signing_flag" structs:"code_signing_flag" mapstructure:"code_signing_flag"`
@@ -442,6 +530,7 @@ type roleEntry struct {
 	KeyBits               int    `json:"key_bits" structs:"key_bits" mapstructure:"key_bits"`
 	MaxPathLength         *int   `json:",omitempty" structs:",omitempty"`
 	KeyUsage              string `json:"key_usage" structs:"key_usage" mapstructure:"key_usage"`
+	ExtKeyUsage           string `json:"ext_key_usage" structs:"ext_key_usage" mapstructure:"ext_key_usage"`
 }
 
 const pathListRolesHelpSyn = `List the existing roles in this backend`
@@ -190,6 +190,8 @@ func (b *backend) pathCASignIntermediate(
 		AllowLocalhost:   true,
 		AllowAnyName:     true,
 		AllowIPSANs:      true,
+		AllowedURISANs:   "*",
+		AllowedOtherSANs: "*",
 		EnforceHostnames: false,
 		KeyType:          "any",
 	}
@@ -243,14 +245,17 @@ func (b *backend) pathCASignIntermediate(
 	case "pem":
 		resp.Data["certificate"] = cb.Certificate
 		resp.Data["issuing_ca"] = cb.IssuingCA
+		resp.Data["ca_chain"] = cb.CAChain
 
 	case "pem_bundle":
 		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, cb.IssuingCA)
 		resp.Data["issuing_ca"] = cb.IssuingCA
+		resp.Data["ca_chain"] = cb.CAChain
 
 	case "der":
 		resp.Data["certificate"] = base64.StdEncoding.EncodeToString(parsedBundle.CertificateBytes)
 		resp.Data["issuing_ca"] = base64.StdEncoding.EncodeToString(parsedBundle.IssuingCABytes)
+		resp.Data["ca_chain"] = encodeCAChainDER(parsedBundle.CAChain)
 	}
 
 	err = req.Storage.Put(&logical.StorageEntry{
@@ -3,6 +3,7 @@ package pki
 import (
 	"crypto/x509"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
@@ -46,100 +47,254 @@ Defaults to 72 hours.`,
 	}
 }
 
+// tidyConfig is the configuration of a tidy operation, and of the automatic
+// tidy operations
+type tidyConfig struct {
+	Enabled        bool          `json:"enabled"`
+	Interval       time.Duration `json:"interval_duration"`
+	CertStore      bool          `json:"tidy_cert_store"`
+	RevocationList bool          `json:"tidy_revocation_list"`
+	SafetyBuffer   time.Duration `json:"safety_buffer"`
+}
+
+// tidyStatus is the progress of the last tidy operation
+type tidyStatus struct {
+	Config       *tidyConfig
+	State        string
+	Err          error
+	TimeStarted  time.Time
+	TimeFinished time.Time
+
+	CertStoreDeletedCount   int
+	RevokedCertDeletedCount int
+}
+
+const (
+	tidyStatusRunning  = "Running"
+	tidyStatusFinished = "Finished"
+	tidyStatusError    = "Error"
+)
+
 func (b *backend) pathTidyWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	safetyBuffer := d.Get("safety_buffer").(int)
-	tidyCertStore := d.Get("tidy_cert_store").(bool)
-	tidyRevocationList := d.Get("tidy_revocation_list").(bool)
+	config := &tidyConfig{
+		CertStore:      d.Get("tidy_cert_store").(bool),
+		RevocationList: d.Get("tidy_revocation_list").(bool),
+		SafetyBuffer:   time.Duration(d.Get("safety_buffer").(int)) * time.Second,
+	}
+	if !config.CertStore && !config.RevocationList {
+		return nil, nil
+	}
+
+	resp := &logical.Response{}
+	if !b.startTidy(req.Storage, config) {
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
 
-	bufferDuration := time.Duration(safetyBuffer) * time.Second
+	resp.AddWarning("Tidy operation successfully started. Its progress can be read from the tidy-status endpoint.")
+	return resp, nil
+}
+
+func (b *backend) pathTidyStatusRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	b.tidyStatusLock.RLock()
+	defer b.tidyStatusLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"state": "Inactive",
+		},
+	}
+	status := b.tidyStatus
+	if status == nil {
+		return resp, nil
+	}
+
+	resp.Data["state"] = status.State
+	resp.Data["tidy_cert_store"] = status.Config.CertStore
+	resp.Data["tidy_revocation_list"] = status.Config.RevocationList
+	resp.Data["safety_buffer"] = int64(status.Config.SafetyBuffer.Seconds())
+	resp.Data["time_started"] = status.TimeStarted
+	resp.Data["cert_store_deleted_count"] = status.CertStoreDeletedCount
+	resp.Data["revoked_cert_deleted_count"] = status.RevokedCertDeletedCount
+	if !status.TimeFinished.IsZero() {
+		resp.Data["time_finished"] = status.TimeFinished
+	}
+	if status.Err != nil {
+		resp.Data["error"] = status.Err.Error()
+	}
+
+	return resp, nil
+}
+
+// Starts a tidy operation in the background, unless one is already running
+func (b *backend) startTidy(s logical.Storage, config *tidyConfig) bool {
+	if !atomic.CompareAndSwapUint32(&b.tidyLock, 0, 1) {
+		return false
+	}
+
+	b.tidyStatusLock.Lock()
+	b.tidyStatus = &tidyStatus{
+		Config:      config,
+		State:       tidyStatusRunning,
+		TimeStarted: time.Now(),
+	}
+	b.lastTidy = time.Now()
+	b.tidyStatusLock.Unlock()
 
-	if tidyCertStore {
-		serials, err := req.Storage.List("certs/")
+	go func() {
+		defer atomic.StoreUint32(&b.tidyLock, 0)
+
+		err := b.tidy(s, config)
+
+		b.tidyStatusLock.Lock()
+		defer b.tidyStatusLock.Unlock()
+		b.tidyStatus.TimeFinished = time.Now()
+		if err != nil {
+			b.tidyStatus.State = tidyStatusError
+			b.tidyStatus.Err = err
+			b.Logger().Printf("[ERR] pki: tidy operation failed: %v", err)
+			return
+		}
+		b.tidyStatus.State = tidyStatusFinished
+		b.Logger().Printf("[INFO] pki: tidy operation removed %d certificates and %d revoked certificates",
+			b.tidyStatus.CertStoreDeletedCount, b.tidyStatus.RevokedCertDeletedCount)
+	}()
+
+	return true
+}
+
+// Starts a tidy operation if automatic tidying is enabled and the interval
+// has passed since the last one
+func (b *backend) autoTidy(req *logical.Request) error {
+	config, err := b.autoTidyConfig(req.Storage)
+	if err != nil {
+		return err
+	}
+	if !config.Enabled {
+		return nil
+	}
+
+	b.tidyStatusLock.RLock()
+	due := time.Now().After(b.lastTidy.Add(config.Interval))
+	b.tidyStatusLock.RUnlock()
+	if !due {
+		return nil
+	}
+
+	b.startTidy(req.Storage, config)
+	return nil
+}
+
+// Removes the certificates and revocation entries which expired more than
+// the safety buffer ago
+func (b *backend) tidy(s logical.Storage, config *tidyConfig) error {
+	if config.CertStore {
+		serials, err := s.List("certs/")
 		if err != nil {
-			return nil, fmt.Errorf("error fetching list of certs: %s", err)
+			return fmt.Errorf("error fetching list of certs: %s", err)
 		}
 
 		for _, serial := range serials {
-			certEntry, err := req.Storage.Get("certs/" + serial)
+			certEntry, err := s.Get("certs/" + serial)
 			if err != nil {
-				return nil, fmt.Errorf("error fetching certificate %s: %s", serial, err)
+				return fmt.Errorf("error fetching certificate %s: %s", serial, err)
 			}
 
 			if certEntry == nil {
-				return nil, fmt.Errorf("certificate entry for serial %s is nil", serial)
+				return fmt.Errorf("certificate entry for serial %s is nil", serial)
 			}
 
 			if certEntry.Value == nil || len(certEntry.Value) == 0 {
-				return nil, fmt.Errorf("found entry for serial %s but actual certificate is empty", serial)
+				return fmt.Errorf("found entry for serial %s but actual certificate is empty", serial)
 			}
 
 			cert, err := x509.ParseCertificate(certEntry.Value)
 			if err != nil {
-				return nil, fmt.Errorf("unable to parse stored certificate with serial %s: %s", serial, err)
+				return fmt.Errorf("unable to parse stored certificate with serial %s: %s", serial, err)
 			}
 
-			if time.Now().After(cert.NotAfter.Add(bufferDuration)) {
-				if err := req.Storage.Delete("certs/" + serial); err != nil {
-					return nil, fmt.Errorf("error deleting serial %s from storage: %s", serial, err)
+			if time.Now().After(cert.NotAfter.Add(config.SafetyBuffer)) {
+				if err := s.Delete("certs/" + serial); err != nil {
+					return fmt.Errorf("error deleting serial %s from storage: %s", serial, err)
 				}
+				b.tidyStatusLock.Lock()
+				b.tidyStatus.CertStoreDeletedCount++
+				b.tidyStatusLock.Unlock()
 			}
 		}
 	}
 
-	if tidyRevocationList {
+	if config.RevocationList {
 		b.revokeStorageLock.Lock()
 		defer b.revokeStorageLock.Unlock()
 
 		tidiedRevoked := false
 
-		revokedSerials, err := req.Storage.List("revoked/")
+		revokedSerials, err := s.List("revoked/")
 		if err != nil {
-			return nil, fmt.Errorf("error fetching list of revoked certs: %s", err)
+			return fmt.Errorf("error fetching list of revoked certs: %s", err)
 		}
 
 		var revInfo revocationInfo
 		for _, serial := range revokedSerials {
-			revokedEntry, err := req.Storage.Get("revoked/" + serial)
+			revokedEntry, err := s.Get("revoked/" + serial)
 			if err != nil {
-				return nil, fmt.Errorf("unable to fetch revoked cert with serial %s: %s", serial, err)
+				return fmt.Errorf("unable to fetch revoked cert with serial %s: %s", serial, err)
 			}
 			if revokedEntry == nil {
-				return nil, fmt.Errorf("revoked certificate entry for serial %s is nil", serial)
+				return fmt.Errorf("revoked certificate entry for serial %s is nil", serial)
 			}
 			if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
 				// TODO: In this case, remove it and continue? How likely is this to
 				// happen? Alternately, could skip it entirely, or could implement a
 				// delete function so that there is a way to remove these
-				return nil, fmt.Errorf("found revoked serial but actual certificate is empty")
+				return fmt.Errorf("found revoked serial but actual certificate is empty")
 			}
 
 			err = revokedEntry.DecodeJSON(&revInfo)
 			if err != nil {
-				return nil, fmt.Errorf("error decoding revocation entry for serial %s: %s", serial, err)
+				return fmt.Errorf("error decoding revocation entry for serial %s: %s", serial, err)
 			}
 
 			revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
 			if err != nil {
-				return nil, fmt.Errorf("unable to parse stored revoked certificate with serial %s: %s", serial, err)
+				return fmt.Errorf("unable to parse stored revoked certificate with serial %s: %s", serial, err)
 			}
 
-			if time.Now().After(revokedCert.NotAfter.Add(bufferDuration)) {
-				if err := req.Storage.Delete("revoked/" + serial); err != nil {
-					return nil, fmt.Errorf("error deleting serial %s from revoked list: %s", serial, err)
+			if time.Now().After(revokedCert.NotAfter.Add(config.SafetyBuffer)) {
+				if err := s.Delete("revoked/" + serial); err != nil {
+					return fmt.Errorf("error deleting serial %s from revoked list: %s", serial, err)
 				}
 				tidiedRevoked = true
+				b.tidyStatusLock.Lock()
+				b.tidyStatus.RevokedCertDeletedCount++
+				b.tidyStatusLock.Unlock()
 			}
 		}
 
 		if tidiedRevoked {
-			if err := buildCRL(b, req); err != nil {
-				return nil, err
+			if err := buildCRL(b, &logical.Request{Storage: s}); err != nil {
+				return err
 			}
 		}
 	}
 
-	return nil, nil
+	return nil
+}
+
+func pathTidyStatus(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "tidy-status",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathTidyStatusRead,
+		},
+
+		HelpSynopsis:    pathTidyStatusHelpSyn,
+		HelpDescription: pathTidyStatusHelpDesc,
+	}
 }
 
 const pathTidyHelpSyn = `
@@ -162,9 +317,21 @@ minutes behind). The 'safety_buffer' parameter can be an integer number of
 seconds or a string duration like "72h".
 
 All certificates and/or revocation information currently stored in the backend
-will be checked when this endpoint is hit. The expiration of the
+will be checked when this endpoint is hit, in the background; the progress of
+the operation can be read from the 'tidy-status' endpoint. The expiration of the
 certificate/revocation information of each certificate being held in
 certificate storage or in revocation infomation will then be checked. If the
 current time, minus the value of 'safety_buffer', is greater than the
 expiration, it will be removed.
 `
+
+const pathTidyStatusHelpSyn = `
+Read the progress of the last tidy operation.
+`
+
+const pathTidyStatusHelpDesc = `
+This endpoint returns the state of the last tidy operation, manual or
+automatic: "Running", "Finished" or "Error", or "Inactive" if none ran since
+the backend started. It also returns the number of certificates and revoked
+certificates it removed so far, and its parameters.
+`
@@ -2,6 +2,9 @@ package rabbitmq
 
 import (
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"strings"
 	"sync"
 
@@ -117,6 +120,22 @@ func (b *backend) Lease(s logical.Storage) (*configLease, error) {
 	return &result, nil
 }
 
+// checkResponse closes the body of a response of the RabbitMQ management
+// API, and returns an error if the request failed. The client only returns
+// errors for requests which could not be sent.
+func checkResponse(res *http.Response, err error) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+		return fmt.Errorf("unexpected status code %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
 const backendHelp = `
 The RabbitMQ backend dynamically generates RabbitMQ users.
 
@@ -2,6 +2,8 @@ package rabbitmq
 
 import (
 	"fmt"
+	"regexp"
+	"strings"
 
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/logical"
@@ -66,23 +68,19 @@ func (b *backend) pathCredsRead(req *logical.Request, d *framework.FieldData) (*
 	}
 
 	// Register the generated credentials in the backend, with the RabbitMQ server
-	if _, err = client.PutUser(username, rabbithole.UserSettings{
+	if err := checkResponse(client.PutUser(username, rabbithole.UserSettings{
 		Password: password,
 		Tags:     role.Tags,
-	}); err != nil {
-		return nil, fmt.Errorf("failed to create a new user with the generated credentials")
+	})); err != nil {
+		return nil, fmt.Errorf("failed to create a new user with the generated credentials: %s", err)
 	}
 
 	// If the role had vhost permissions specified, assign those permissions
 	// to the created username for respective vhosts.
 	for vhost, permission := range role.VHosts {
-		if _, err := client.UpdatePermissionsIn(vhost, username, rabbithole.Permissions{
-			Configure: permission.Configure,
-			Write:     permission.Write,
-			Read:      permission.Read,
-		}); err != nil {
+		if err := checkResponse(client.UpdatePermissionsIn(vhost, username, permission.expand(username))); err != nil {
 			// Delete the user because it's in an unknown state
-			if _, rmErr := client.DeleteUser(username); rmErr != nil {
+			if rmErr := checkResponse(client.DeleteUser(username)); rmErr != nil {
 				return nil, fmt.Errorf("failed to delete user:%s, err: %s. %s", username, err, rmErr)
 			}
 			return nil, fmt.Errorf("failed to update permissions to the %s user. err:%s", username, err)
@@ -109,6 +107,17 @@ func (b *backend) pathCredsRead(req *logical.Request, d *framework.FieldData) (*
 	return resp, nil
 }
 
+// expand returns the permissions of the user, in which the "{{username}}"
+// templates are replaced with the username, quoted as a regular expression
+func (p vhostPermission) expand(username string) rabbithole.Permissions {
+	replacer := strings.NewReplacer("{{username}}", regexp.QuoteMeta(username))
+	return rabbithole.Permissions{
+		Configure: replacer.Replace(p.Configure),
+		Write:     replacer.Replace(p.Write),
+		Read:      replacer.Replace(p.Read),
+	}
+}
+
 const pathRoleCreateReadHelpSyn = `
 Request RabbitMQ credentials for a certain role.
 `
@@ -0,0 +1,142 @@
+package rabbitmq
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/michaelklishin/rabbit-hole"
+)
+
+// testManagementAPI serves the users and permissions of the RabbitMQ
+// management API
+type testManagementAPI struct {
+	sync.Mutex
+	users       map[string]bool
+	permissions map[string]rabbithole.Permissions
+
+	// status fails the requests with the status code if set
+	status int
+}
+
+func (m *testManagementAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.status != 0 {
+		w.WriteHeader(m.status)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/api/"), "/")
+	switch {
+	case parts[0] == "users" && r.Method == "PUT":
+		m.users[parts[1]] = true
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "users" && r.Method == "DELETE":
+		if !m.users[parts[1]] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(m.users, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "permissions" && r.Method == "PUT":
+		var permissions rabbithole.Permissions
+		json.NewDecoder(r.Body).Decode(&permissions)
+		m.permissions[parts[1]+"/"+parts[2]] = permissions
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestBackend_credsPermissionTemplates(t *testing.T) {
+	api := &testManagementAPI{
+		users:       make(map[string]bool),
+		permissions: make(map[string]rabbithole.Permissions),
+	}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation:   op,
+			Path:        path,
+			Storage:     config.StorageView,
+			Data:        data,
+			DisplayName: "app.web",
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+		}
+		return resp
+	}
+
+	request(logical.UpdateOperation, "config/connection", map[string]interface{}{
+		"connection_uri":    server.URL,
+		"username":          "admin",
+		"password":          "password",
+		"verify_connection": false,
+	})
+	request(logical.UpdateOperation, "roles/web", map[string]interface{}{
+		"vhosts": `{"/": {"configure": "^{{username}}-.*", "write": "^{{username}}-.*", "read": ".*"}}`,
+	})
+
+	resp := request(logical.ReadOperation, "creds/web", nil)
+	username := resp.Data["username"].(string)
+	if !api.users[username] {
+		t.Fatalf("user %s was not created", username)
+	}
+	expected := "^" + strings.Replace(username, ".", `\.`, -1) + "-.*"
+	permissions := api.permissions["%2F/"+username]
+	if permissions.Configure != expected || permissions.Write != expected || permissions.Read != ".*" {
+		t.Fatalf("bad: %#v", api.permissions)
+	}
+
+	// Failed revocations are reported, so that they are retried
+	secret := resp.Secret
+	api.status = http.StatusInternalServerError
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.RevokeOperation,
+		Storage:   config.StorageView,
+		Secret:    secret,
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	api.status = 0
+	for i := 0; i < 2; i++ {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: logical.RevokeOperation,
+			Storage:   config.StorageView,
+			Secret:    secret,
+		})
+		if err != nil || (resp != nil && resp.IsError()) {
+			t.Fatalf("bad: resp: %#v\nerr: %v", resp, err)
+		}
+	}
+	if api.users[username] {
+		t.Fatalf("user %s was not deleted", username)
+	}
+
+	// Users are not issued if they cannot be created
+	api.status = http.StatusUnauthorized
+	if _, err := b.HandleRequest(&logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "creds/web",
+		Storage:   config.StorageView,
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+}
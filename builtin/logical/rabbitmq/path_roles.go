@@ -33,8 +33,9 @@ func pathRoles(b *backend) *framework.Path {
 				Description: "Comma-separated list of tags for this role.",
 			},
 			"vhosts": &framework.FieldSchema{
-				Type:        framework.TypeString,
-				Description: "A map of virtual hosts to permissions.",
+				Type: framework.TypeString,
+				Description: `A map of virtual hosts to permissions, in which "{{username}}"
+is replaced with the generated username.`,
 			},
 		},
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -178,4 +179,9 @@ passed as a string in the form:
 		"read": ".*"
 	}
 }
+
+The "{{username}}" template in the permissions is replaced with the
+generated username, quoted as a regular expression, so that users can be
+restricted to the resources named after them, such as with
+"^{{username}}-.*".
 `
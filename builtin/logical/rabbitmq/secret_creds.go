@@ -2,6 +2,7 @@ package rabbitmq
 
 import (
 	"fmt"
+	"net/http"
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -59,7 +60,13 @@ func (b *backend) secretCredsRevoke(
 		return nil, err
 	}
 
-	if _, err = client.DeleteUser(username); err != nil {
+	// Users which were already deleted are revoked
+	res, err := client.DeleteUser(username)
+	if err == nil && res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, nil
+	}
+	if err := checkResponse(res, err); err != nil {
 		return nil, fmt.Errorf("could not delete user: %s", err)
 	}
 
@@ -1,8 +1,12 @@
 package ssh
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -637,3 +641,212 @@ func testCredsWrite(t *testing.T, roleName string, data map[string]interface{},
 		},
 	}
 }
+
+func TestSSHBackend_CA(t *testing.T) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+
+	b, err := Backend(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Setup(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(operation logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Operation: operation,
+			Path:      path,
+			Storage:   config.StorageView,
+			Data:      data,
+		})
+		if err != nil {
+			t.Fatalf("failed request to %s: %s", path, err)
+		}
+		return resp
+	}
+
+	resp := request(logical.UpdateOperation, "sign/test", map[string]interface{}{})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error signing with a missing role: %#v", resp)
+	}
+
+	caSigner, err := ssh.ParsePrivateKey([]byte(testSharedPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caPublicKey := string(ssh.MarshalAuthorizedKey(caSigner.PublicKey()))
+	resp = request(logical.UpdateOperation, "config/ca", map[string]interface{}{
+		"private_key": testSharedPrivateKey,
+		"public_key":  caPublicKey,
+	})
+	if resp != nil {
+		t.Fatalf("failed to configure the CA: %#v", resp)
+	}
+	resp = request(logical.UpdateOperation, "config/ca", map[string]interface{}{})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error replacing the CA: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, "config/ca", nil)
+	if resp.Data["public_key"] != caPublicKey {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = request(logical.ReadOperation, "public_key", nil)
+	if string(resp.Data[logical.HTTPRawBody].([]byte)) != caPublicKey {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = request(logical.UpdateOperation, "roles/test", map[string]interface{}{
+		"key_type":                "ca",
+		"default_user":            "ubuntu",
+		"allowed_users":           "admin,deploy",
+		"ttl":                     "1h",
+		"max_ttl":                 "2h",
+		"allowed_extensions":      "permit-pty,permit-port-forwarding",
+		"default_extensions":      map[string]interface{}{"permit-pty": ""},
+		"allow_user_certificates": true,
+	})
+	if resp != nil {
+		t.Fatalf("failed to create role: %#v", resp)
+	}
+	resp = request(logical.ReadOperation, "roles/test", nil)
+	if resp.Data["key_type"] != KeyTypeCA || resp.Data["ttl"] != int64(3600) || resp.Data["max_ttl"] != int64(7200) ||
+		!reflect.DeepEqual(resp.Data["default_extensions"], map[string]string{"permit-pty": ""}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = request(logical.UpdateOperation, "creds/test", map[string]interface{}{
+		"ip": testIP,
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error creating credentials with a CA role: %#v", resp)
+	}
+
+	userKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	userPublicKey, err := ssh.NewPublicKey(userKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(data map[string]interface{}) (*ssh.Certificate, *logical.Response) {
+		data["public_key"] = string(ssh.MarshalAuthorizedKey(userPublicKey))
+		resp := request(logical.UpdateOperation, "sign/test", data)
+		if resp == nil {
+			t.Fatal("nil response")
+		}
+		if resp.IsError() {
+			return nil, resp
+		}
+		parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Data["signed_key"].(string)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, ok := parsed.(*ssh.Certificate)
+		if !ok {
+			t.Fatalf("signed key is not a certificate: %#v", parsed)
+		}
+		if resp.Data["serial_number"] != fmt.Sprintf("%016x", cert.Serial) {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+		return cert, resp
+	}
+
+	// The certificate is trusted for the default user of the role
+	cert, _ := sign(map[string]interface{}{})
+	checker := &ssh.CertChecker{
+		IsAuthority: func(auth ssh.PublicKey) bool {
+			return string(auth.Marshal()) == string(caSigner.PublicKey().Marshal())
+		},
+	}
+	if err := checker.CheckCert("ubuntu", cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckCert("admin", cert); err == nil {
+		t.Fatal("expected the certificate to be invalid for admin")
+	}
+	if cert.CertType != ssh.UserCert || !reflect.DeepEqual(cert.Extensions, map[string]string{"permit-pty": ""}) {
+		t.Fatalf("bad: %#v", cert)
+	}
+	if lifetime := time.Duration(cert.ValidBefore-cert.ValidAfter) * time.Second; lifetime != time.Hour+certificateClockSkew {
+		t.Fatalf("bad lifetime: %s", lifetime)
+	}
+	if !strings.HasPrefix(cert.KeyId, "vault-test-") {
+		t.Fatalf("bad key ID: %s", cert.KeyId)
+	}
+
+	cert, _ = sign(map[string]interface{}{
+		"valid_principals": "admin,deploy",
+		"ttl":              "90m",
+		"extensions":       map[string]interface{}{"permit-port-forwarding": ""},
+	})
+	if !reflect.DeepEqual(cert.ValidPrincipals, []string{"admin", "deploy"}) ||
+		!reflect.DeepEqual(cert.Extensions, map[string]string{"permit-port-forwarding": ""}) {
+		t.Fatalf("bad: %#v", cert)
+	}
+	if err := checker.CheckCert("deploy", cert); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"valid_principals": "root"},
+		{"ttl": "3h"},
+		{"extensions": map[string]interface{}{"permit-x11-forwarding": ""}},
+		{"critical_options": map[string]interface{}{"force-command": "/bin/true"}},
+		{"key_id": "chosen"},
+		{"cert_type": "host", "valid_principals": "www.example.com"},
+	} {
+		if _, resp := sign(data); resp == nil {
+			t.Fatalf("expected an error signing with %#v", data)
+		}
+	}
+
+	// Host certificates are signed for the domains of the role
+	resp = request(logical.UpdateOperation, "roles/hosts", map[string]interface{}{
+		"key_type":                "ca",
+		"allowed_domains":         "example.com",
+		"allow_subdomains":        true,
+		"allow_host_certificates": true,
+	})
+	if resp != nil {
+		t.Fatalf("failed to create role: %#v", resp)
+	}
+	resp = request(logical.UpdateOperation, "sign/hosts", map[string]interface{}{
+		"public_key":       string(ssh.MarshalAuthorizedKey(userPublicKey)),
+		"cert_type":        "host",
+		"valid_principals": "www.example.com,*.app.example.com",
+	})
+	if resp == nil || resp.IsError() {
+		t.Fatalf("failed to sign host key: %#v", resp)
+	}
+	parsed, _, _, _, err := ssh.ParseAuthorizedKey([]byte(resp.Data["signed_key"].(string)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert = parsed.(*ssh.Certificate)
+	if cert.CertType != ssh.HostCert || len(cert.Extensions) != 0 {
+		t.Fatalf("bad: %#v", cert)
+	}
+	if err := checker.CheckCert("www.example.com", cert); err != nil {
+		t.Fatal(err)
+	}
+	if err := checker.CheckCert("db.example.com", cert); err == nil {
+		t.Fatal("expected the certificate to be invalid for db.example.com")
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"cert_type": "host"},
+		{"cert_type": "host", "valid_principals": "example.com"},
+		{"cert_type": "host", "valid_principals": "www.example.org"},
+		{"cert_type": "host", "valid_principals": "www.*.example.com"},
+		{"cert_type": "host", "valid_principals": "www.example.com", "extensions": map[string]interface{}{"permit-pty": ""}},
+		{"cert_type": "user", "valid_principals": "www.example.com"},
+	} {
+		data["public_key"] = string(ssh.MarshalAuthorizedKey(userPublicKey))
+		if resp := request(logical.UpdateOperation, "sign/hosts", data); resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error signing with %#v", data)
+		}
+	}
+}
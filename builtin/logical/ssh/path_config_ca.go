@@ -0,0 +1,264 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	caPublicKeyStoragePath  = "config/ca_public_key"
+	caPrivateKeyStoragePath = "config/ca_private_key"
+)
+
+// Structure that represents a key of the CA, stored in its authorized_keys
+// format for the public key and in PEM format for the private key.
+type keyStorageEntry struct {
+	Key string `json:"key"`
+}
+
+func pathConfigCA(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/ca",
+		Fields: map[string]*framework.FieldSchema{
+			"private_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Private half of the SSH key that will be used to sign certificates.`,
+			},
+			"public_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Public half of the SSH key that will be used to sign certificates.`,
+			},
+			"generate_signing_key": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: `Generate SSH key pair internally rather than use the private_key and public_key fields.`,
+				Default:     true,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigCARead,
+			logical.UpdateOperation: b.pathConfigCAUpdate,
+			logical.DeleteOperation: b.pathConfigCADelete,
+		},
+
+		HelpSynopsis:    pathConfigCASyn,
+		HelpDescription: pathConfigCADesc,
+	}
+}
+
+func pathFetchPublicKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "public_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchPublicKey,
+		},
+
+		HelpSynopsis:    pathFetchPublicKeySyn,
+		HelpDescription: pathFetchPublicKeyDesc,
+	}
+}
+
+func caKey(s logical.Storage, path string) (*keyStorageEntry, error) {
+	entry, err := s.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result keyStorageEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Returns the signer of the CA, or nil if the CA is not configured
+func caSigner(s logical.Storage) (ssh.Signer, error) {
+	privateKeyEntry, err := caKey(s, caPrivateKeyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if privateKeyEntry == nil {
+		return nil, nil
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(privateKeyEntry.Key))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing the CA private key: %s", err)
+	}
+	return signer, nil
+}
+
+func (b *backend) pathConfigCARead(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	publicKeyEntry, err := caKey(req.Storage, caPublicKeyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if publicKeyEntry == nil {
+		return logical.ErrorResponse("CA is not configured"), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": publicKeyEntry.Key,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigCADelete(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete(caPrivateKeyStoragePath); err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Delete(caPublicKeyStoragePath); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathConfigCAUpdate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	// Replacing the keys of the CA would invalidate all the certificates it
+	// signed, so they have to be deleted first
+	existing, err := caKey(req.Storage, caPrivateKeyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse("CA is already configured; delete the existing keys first"), nil
+	}
+
+	publicKey := d.Get("public_key").(string)
+	privateKey := d.Get("private_key").(string)
+
+	// The keys are generated unless given
+	generateSigningKey := d.Get("generate_signing_key").(bool)
+	if publicKey != "" || privateKey != "" {
+		if publicKey == "" || privateKey == "" {
+			return logical.ErrorResponse("Both public_key and private_key must be provided"), nil
+		}
+		generateSigningKey = false
+	}
+
+	if generateSigningKey {
+		publicKey, privateKey, err = generateCAKeyPair()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if publicKey == "" {
+			return logical.ErrorResponse("Missing public_key"), nil
+		}
+
+		// The keys must be a valid pair
+		parsedPublicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Invalid public_key: %s", err)), nil
+		}
+		signer, err := ssh.ParsePrivateKey([]byte(privateKey))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Invalid private_key: %s", err)), nil
+		}
+		if string(signer.PublicKey().Marshal()) != string(parsedPublicKey.Marshal()) {
+			return logical.ErrorResponse("public_key does not match private_key"), nil
+		}
+		publicKey = string(ssh.MarshalAuthorizedKey(parsedPublicKey))
+	}
+
+	entry, err := logical.StorageEntryJSON(caPublicKeyStoragePath, &keyStorageEntry{Key: publicKey})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+	entry, err = logical.StorageEntryJSON(caPrivateKeyStoragePath, &keyStorageEntry{Key: privateKey})
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	if generateSigningKey {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"public_key": publicKey,
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+// Generates a 4096 bit RSA key pair for the CA
+func generateCAKeyPair() (string, string, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return "", "", err
+	}
+
+	privateKeyPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
+	})
+
+	publicKey, err := ssh.NewPublicKey(privateKey.Public())
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(ssh.MarshalAuthorizedKey(publicKey)), string(privateKeyPEM), nil
+}
+
+func (b *backend) pathFetchPublicKey(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	publicKeyEntry, err := caKey(req.Storage, caPublicKeyStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	if publicKeyEntry == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "text/plain",
+			logical.HTTPRawBody:     []byte(publicKeyEntry.Key),
+			logical.HTTPStatusCode:  200,
+		},
+	}, nil
+}
+
+const pathConfigCASyn = `
+Set the SSH private key used for signing certificates.
+`
+
+const pathConfigCADesc = `
+This sets the key pair of the CA which signs the certificates of this
+mount. The keys are generated unless 'private_key' and 'public_key' are
+given, in the PEM and authorized_keys formats respectively.
+
+For security reasons, the private key cannot be retrieved later.
+
+Read operations will return the public key, if already stored/generated.
+`
+
+const pathFetchPublicKeySyn = `
+Retrieve the public key of the CA.
+`
+
+const pathFetchPublicKeyDesc = `
+This allows the public key of the SSH CA certificate that this backend has been
+configured with to be fetched, in the authorized_keys format. It can be added to
+the TrustedUserCAKeys file of SSH servers to trust the certificates of users
+signed by this backend, and to the known_hosts file of clients as a
+@cert-authority to trust the certificates of hosts.
+`
@@ -60,6 +60,9 @@ func (b *backend) pathCredsCreateWrite(
 	if role == nil {
 		return logical.ErrorResponse(fmt.Sprintf("Role '%s' not found", roleName)), nil
 	}
+	if role.KeyType == KeyTypeCA {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' signs keys; use the 'sign/' endpoint", roleName)), nil
+	}
 
 	// username is an optional parameter.
 	username := d.Get("username").(string)
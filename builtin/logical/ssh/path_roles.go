@@ -3,6 +3,7 @@ package ssh
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -11,23 +12,36 @@ import (
 const (
 	KeyTypeOTP     = "otp"
 	KeyTypeDynamic = "dynamic"
+	KeyTypeCA      = "ca"
 )
 
 // Structure that represents a role in SSH backend. This is a common role structure
-// for both OTP and Dynamic roles. Not all the fields are mandatory for both type.
+// for OTP, Dynamic and CA roles. Not all the fields are mandatory for all types.
 // Some are applicable for one and not for other. It doesn't matter.
 type sshRole struct {
-	KeyType         string `mapstructure:"key_type" json:"key_type"`
-	KeyName         string `mapstructure:"key" json:"key"`
-	KeyBits         int    `mapstructure:"key_bits" json:"key_bits"`
-	AdminUser       string `mapstructure:"admin_user" json:"admin_user"`
-	DefaultUser     string `mapstructure:"default_user" json:"default_user"`
-	CIDRList        string `mapstructure:"cidr_list" json:"cidr_list"`
-	ExcludeCIDRList string `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
-	Port            int    `mapstructure:"port" json:"port"`
-	InstallScript   string `mapstructure:"install_script" json:"install_script"`
-	AllowedUsers    string `mapstructure:"allowed_users" json:"allowed_users"`
-	KeyOptionSpecs  string `mapstructure:"key_option_specs" json:"key_option_specs"`
+	KeyType                string            `mapstructure:"key_type" json:"key_type"`
+	KeyName                string            `mapstructure:"key" json:"key"`
+	KeyBits                int               `mapstructure:"key_bits" json:"key_bits"`
+	AdminUser              string            `mapstructure:"admin_user" json:"admin_user"`
+	DefaultUser            string            `mapstructure:"default_user" json:"default_user"`
+	CIDRList               string            `mapstructure:"cidr_list" json:"cidr_list"`
+	ExcludeCIDRList        string            `mapstructure:"exclude_cidr_list" json:"exclude_cidr_list"`
+	Port                   int               `mapstructure:"port" json:"port"`
+	InstallScript          string            `mapstructure:"install_script" json:"install_script"`
+	AllowedUsers           string            `mapstructure:"allowed_users" json:"allowed_users"`
+	KeyOptionSpecs         string            `mapstructure:"key_option_specs" json:"key_option_specs"`
+	TTL                    time.Duration     `mapstructure:"ttl" json:"ttl"`
+	MaxTTL                 time.Duration     `mapstructure:"max_ttl" json:"max_ttl"`
+	AllowedCriticalOptions string            `mapstructure:"allowed_critical_options" json:"allowed_critical_options"`
+	AllowedExtensions      string            `mapstructure:"allowed_extensions" json:"allowed_extensions"`
+	DefaultCriticalOptions map[string]string `mapstructure:"default_critical_options" json:"default_critical_options"`
+	DefaultExtensions      map[string]string `mapstructure:"default_extensions" json:"default_extensions"`
+	AllowUserCertificates  bool              `mapstructure:"allow_user_certificates" json:"allow_user_certificates"`
+	AllowUserKeyIDs        bool              `mapstructure:"allow_user_key_ids" json:"allow_user_key_ids"`
+	AllowHostCertificates  bool              `mapstructure:"allow_host_certificates" json:"allow_host_certificates"`
+	AllowedDomains         string            `mapstructure:"allowed_domains" json:"allowed_domains"`
+	AllowBareDomains       bool              `mapstructure:"allow_bare_domains" json:"allow_bare_domains"`
+	AllowSubdomains        bool              `mapstructure:"allow_subdomains" json:"allow_subdomains"`
 }
 
 func pathListRoles(b *backend) *framework.Path {
@@ -73,10 +87,11 @@ func pathRoles(b *backend) *framework.Path {
 			"default_user": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
-				[Required for both types]
+				[Required for OTP and Dynamic types] [Optional for CA type]
 				Default username for which a credential will be generated.
 				When the endpoint 'creds/' is used without a username, this
-				value will be used as default username.`,
+				value will be used as default username. For CA type, this is the
+				default principal of the signed certificates.`,
 			},
 			"cidr_list": &framework.FieldSchema{
 				Type: framework.TypeString,
@@ -105,9 +120,10 @@ func pathRoles(b *backend) *framework.Path {
 			"key_type": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
-				[Required for both types] 
-				Type of key used to login to hosts. It can be either 'otp' or 'dynamic'.
-				'otp' type requires agent to be installed in remote hosts.`,
+				[Required for all types]
+				Type of key used to login to hosts. It can be either 'otp', 'dynamic' or 'ca'.
+				'otp' type requires agent to be installed in remote hosts. 'ca' type signs
+				the keys of users with the CA configured at the 'config/ca' endpoint.`,
 			},
 			"key_bits": &framework.FieldSchema{
 				Type: framework.TypeInt,
@@ -126,12 +142,13 @@ func pathRoles(b *backend) *framework.Path {
 			"allowed_users": &framework.FieldSchema{
 				Type: framework.TypeString,
 				Description: `
-				[Optional for both types]
+				[Optional for all types]
 				If this option is not specified, client can request for a credential for
 				any valid user at the remote host, including the admin user. If only certain
 				usernames are to be allowed, then this list enforces it. If this field is
 				set, then credentials can only be created for default_user and usernames
-				present in this list.
+				present in this list. For CA type, this lists the principals that
+				certificates can be signed for besides default_user, or '*' to allow any.
 				`,
 			},
 			"key_option_specs": &framework.FieldSchema{
@@ -143,6 +160,91 @@ func pathRoles(b *backend) *framework.Path {
 				file format and should not contain spaces.
 				`,
 			},
+			"ttl": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				The default lease of the certificates signed with this role. Defaults
+				to the default lease of the backend.`,
+			},
+			"max_ttl": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				The maximum lease of the certificates signed with this role. Defaults
+				to the maximum lease of the backend.`,
+			},
+			"allowed_critical_options": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				Comma separated list of critical options that certificates can be signed
+				for, or '*' to allow any. By default, only the default critical options
+				are allowed.`,
+			},
+			"allowed_extensions": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				Comma separated list of extensions that certificates can be signed for,
+				or '*' to allow any. By default, only the default extensions are
+				allowed.`,
+			},
+			"default_critical_options": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				Critical options of the certificates signed with this role, unless
+				others are requested.`,
+			},
+			"default_extensions": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				Extensions of the certificates signed with this role, unless others
+				are requested, e.g. {"permit-pty": ""}.`,
+			},
+			"allow_user_certificates": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				If set, certificates are allowed to be signed for use as a 'user'.`,
+			},
+			"allow_user_key_ids": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				If set, users can choose the key ID of their certificates. By default,
+				the key ID identifies the role and the signed key.`,
+			},
+			"allow_host_certificates": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				If set, certificates are allowed to be signed for use as a 'host'.`,
+			},
+			"allowed_domains": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				Comma separated list of domains that host certificates can be signed
+				for, according to 'allow_bare_domains' and 'allow_subdomains', or '*'
+				to allow any.`,
+			},
+			"allow_bare_domains": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				If set, host certificates can be signed for the domains of
+				'allowed_domains' themselves.`,
+			},
+			"allow_subdomains": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `
+				[Optional for CA type] [Not applicable for OTP and Dynamic types]
+				If set, host certificates can be signed for the subdomains of
+				'allowed_domains', including wildcard subdomains.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -165,8 +267,16 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 	// Allowed users is an optional field, applicable for both OTP and Dynamic types.
 	allowedUsers := d.Get("allowed_users").(string)
 
+	keyType := d.Get("key_type").(string)
+	if keyType == "" {
+		return logical.ErrorResponse("Missing key type"), nil
+	}
+	keyType = strings.ToLower(keyType)
+
+	// The default user of CA roles is optional, since the principals of
+	// certificates can be requested
 	defaultUser := d.Get("default_user").(string)
-	if defaultUser == "" {
+	if defaultUser == "" && keyType != KeyTypeCA {
 		return logical.ErrorResponse("Missing default user"), nil
 	}
 
@@ -199,12 +309,6 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 		port = 22
 	}
 
-	keyType := d.Get("key_type").(string)
-	if keyType == "" {
-		return logical.ErrorResponse("Missing key type"), nil
-	}
-	keyType = strings.ToLower(keyType)
-
 	var roleEntry sshRole
 	if keyType == KeyTypeOTP {
 		// Admin user is not used if OTP key type is used because there is
@@ -273,6 +377,41 @@ func (b *backend) pathRoleWrite(req *logical.Request, d *framework.FieldData) (*
 			AllowedUsers:    allowedUsers,
 			KeyOptionSpecs:  keyOptionSpecs,
 		}
+	} else if keyType == KeyTypeCA {
+		ttl := time.Duration(d.Get("ttl").(int)) * time.Second
+		maxTTL := time.Duration(d.Get("max_ttl").(int)) * time.Second
+		if maxTTL != 0 && ttl > maxTTL {
+			return logical.ErrorResponse("ttl cannot be larger than max_ttl"), nil
+		}
+
+		defaultCriticalOptions, err := convertMapToStringValue(d.Get("default_critical_options").(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Invalid default_critical_options: %s", err)), nil
+		}
+		defaultExtensions, err := convertMapToStringValue(d.Get("default_extensions").(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("Invalid default_extensions: %s", err)), nil
+		}
+
+		// Certificates are not tied to addresses, so only the fields relevant
+		// to signing are stored
+		roleEntry = sshRole{
+			KeyType:                KeyTypeCA,
+			DefaultUser:            defaultUser,
+			AllowedUsers:           allowedUsers,
+			TTL:                    ttl,
+			MaxTTL:                 maxTTL,
+			AllowedCriticalOptions: d.Get("allowed_critical_options").(string),
+			AllowedExtensions:      d.Get("allowed_extensions").(string),
+			DefaultCriticalOptions: defaultCriticalOptions,
+			DefaultExtensions:      defaultExtensions,
+			AllowUserCertificates:  d.Get("allow_user_certificates").(bool),
+			AllowUserKeyIDs:        d.Get("allow_user_key_ids").(bool),
+			AllowHostCertificates:  d.Get("allow_host_certificates").(bool),
+			AllowedDomains:         d.Get("allowed_domains").(string),
+			AllowBareDomains:       d.Get("allow_bare_domains").(bool),
+			AllowSubdomains:        d.Get("allow_subdomains").(bool),
+		}
 	} else {
 		return logical.ErrorResponse("Invalid key type"), nil
 	}
@@ -324,7 +463,27 @@ func (b *backend) pathRoleRead(req *logical.Request, d *framework.FieldData) (*l
 	}
 
 	// Return information should be based on the key type of the role
-	if role.KeyType == KeyTypeOTP {
+	if role.KeyType == KeyTypeCA {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"key_type":                 role.KeyType,
+				"default_user":             role.DefaultUser,
+				"allowed_users":            role.AllowedUsers,
+				"ttl":                      int64(role.TTL.Seconds()),
+				"max_ttl":                  int64(role.MaxTTL.Seconds()),
+				"allowed_critical_options": role.AllowedCriticalOptions,
+				"allowed_extensions":       role.AllowedExtensions,
+				"default_critical_options": role.DefaultCriticalOptions,
+				"default_extensions":       role.DefaultExtensions,
+				"allow_user_certificates":  role.AllowUserCertificates,
+				"allow_user_key_ids":       role.AllowUserKeyIDs,
+				"allow_host_certificates":  role.AllowHostCertificates,
+				"allowed_domains":          role.AllowedDomains,
+				"allow_bare_domains":       role.AllowBareDomains,
+				"allow_subdomains":         role.AllowSubdomains,
+			},
+		}, nil
+	} else if role.KeyType == KeyTypeOTP {
 		return &logical.Response{
 			Data: map[string]interface{}{
 				"default_user":      role.DefaultUser,
@@ -385,7 +544,10 @@ This path allows you to manage the roles that are used to generate credentials.
 
 Role takes a 'key_type' parameter that decides what type of credential this role
 can generate. If remote hosts have Vault SSH Agent installed, an 'otp' type can
-be used, otherwise 'dynamic' type can be used.
+be used, otherwise 'dynamic' type can be used. If remote hosts trust the CA of
+this backend, a 'ca' type can be used to sign the keys of users at the 'sign/'
+endpoint. The 'ca' type can also sign the host keys of remote hosts, which
+clients then trust through the same CA.
 
 If the backend is mounted at "ssh" and the role is created at "ssh/roles/web",
 then a user could request for a credential at "ssh/creds/web" for an IP that
@@ -0,0 +1,332 @@
+package ssh
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Certificates are valid slightly before they are signed, to allow for
+// clock skew between Vault and the hosts
+const certificateClockSkew = 30 * time.Second
+
+func pathSign(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "sign/" + framework.GenericNameRegex("role"),
+		Fields: map[string]*framework.FieldSchema{
+			"role": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The desired role with configuration for this request.`,
+			},
+			"public_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `SSH public key that should be signed, in the authorized_keys format.`,
+			},
+			"ttl": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The requested Time To Live for the SSH certificate;
+sets the expiration date. If not specified
+the role default, backend default, or system
+default TTL is used, in that order. Cannot
+be later than the role max TTL.`,
+			},
+			"valid_principals": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Comma separated list of usernames or hostnames that are to be signed. Defaults to the default user of the role for user certificates.`,
+			},
+			"cert_type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Type of certificate to be created; either "user" or "host".`,
+				Default:     "user",
+			},
+			"key_id": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Key ID of the signed certificate. Requires the 'allow_user_key_ids' option of the role.`,
+			},
+			"critical_options": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: `Critical options that the certificate should be signed for. Defaults to the default critical options of the role.`,
+			},
+			"extensions": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: `Extensions that the certificate should be signed for. Defaults to the default extensions of the role.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathSignCertificate,
+		},
+
+		HelpSynopsis:    pathSignSyn,
+		HelpDescription: pathSignDesc,
+	}
+}
+
+func (b *backend) pathSignCertificate(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	roleName := d.Get("role").(string)
+	role, err := b.getRole(req.Storage, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("error retrieving role: %s", err)
+	}
+	if role == nil {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' not found", roleName)), nil
+	}
+	if role.KeyType != KeyTypeCA {
+		return logical.ErrorResponse(fmt.Sprintf("Role '%s' is not of type '%s'", roleName, KeyTypeCA)), nil
+	}
+
+	var certType uint32
+	switch d.Get("cert_type").(string) {
+	case "user":
+		if !role.AllowUserCertificates {
+			return logical.ErrorResponse("Role does not allow user certificates"), nil
+		}
+		certType = ssh.UserCert
+	case "host":
+		if !role.AllowHostCertificates {
+			return logical.ErrorResponse("Role does not allow host certificates"), nil
+		}
+		certType = ssh.HostCert
+	default:
+		return logical.ErrorResponse("cert_type must be either 'user' or 'host'"), nil
+	}
+
+	signer, err := caSigner(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if signer == nil {
+		return logical.ErrorResponse("CA is not configured"), nil
+	}
+
+	publicKeyRaw := d.Get("public_key").(string)
+	if publicKeyRaw == "" {
+		return logical.ErrorResponse("Missing public_key"), nil
+	}
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKeyRaw))
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("Invalid public_key: %s", err)), nil
+	}
+
+	var principals []string
+	if certType == ssh.HostCert {
+		principals, err = b.calculateValidHostPrincipals(d, role)
+	} else {
+		principals, err = b.calculateValidPrincipals(d, role)
+	}
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	ttl, err := b.calculateTTL(d, role)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	keyID, err := b.calculateKeyID(d, role, roleName, publicKey)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	// Critical options and extensions are only defined for user certificates
+	var criticalOptions, extensions map[string]string
+	if certType == ssh.HostCert {
+		if len(d.Get("critical_options").(map[string]interface{})) != 0 ||
+			len(d.Get("extensions").(map[string]interface{})) != 0 {
+			return logical.ErrorResponse("critical_options and extensions are not supported for host certificates"), nil
+		}
+	} else {
+		criticalOptions, err = calculateOptions(d, "critical_options", role.AllowedCriticalOptions, role.DefaultCriticalOptions)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		extensions, err = calculateOptions(d, "extensions", role.AllowedExtensions, role.DefaultExtensions)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+	}
+
+	serialBytes := make([]byte, 8)
+	if _, err := rand.Read(serialBytes); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	certificate := &ssh.Certificate{
+		Serial:          binary.BigEndian.Uint64(serialBytes),
+		Key:             publicKey,
+		KeyId:           keyID,
+		ValidPrincipals: principals,
+		ValidAfter:      uint64(now.Add(-certificateClockSkew).Unix()),
+		ValidBefore:     uint64(now.Add(ttl).Unix()),
+		CertType:        certType,
+		Permissions: ssh.Permissions{
+			CriticalOptions: criticalOptions,
+			Extensions:      extensions,
+		},
+	}
+	if err := certificate.SignCert(rand.Reader, signer); err != nil {
+		return nil, fmt.Errorf("failed to sign the certificate: %s", err)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"serial_number": fmt.Sprintf("%016x", certificate.Serial),
+			"signed_key":    string(ssh.MarshalAuthorizedKey(certificate)),
+		},
+	}, nil
+}
+
+// Returns the principals of the certificate, which must be either the
+// default user or allowed users of the role
+func (b *backend) calculateValidPrincipals(d *framework.FieldData, role *sshRole) ([]string, error) {
+	var principals []string
+	for _, principal := range strings.Split(d.Get("valid_principals").(string), ",") {
+		if principal = strings.TrimSpace(principal); principal != "" {
+			principals = append(principals, principal)
+		}
+	}
+
+	if len(principals) == 0 {
+		if role.DefaultUser == "" {
+			return nil, fmt.Errorf("No default username registered. Use 'valid_principals' option")
+		}
+		return []string{role.DefaultUser}, nil
+	}
+
+	for _, principal := range principals {
+		if principal != role.DefaultUser && validateUsername(principal, role.AllowedUsers) != nil {
+			return nil, fmt.Errorf("%s is not a valid value for valid_principals", principal)
+		}
+	}
+
+	return principals, nil
+}
+
+// Returns the hostnames of a host certificate, which must be allowed by the
+// domains of the role
+func (b *backend) calculateValidHostPrincipals(d *framework.FieldData, role *sshRole) ([]string, error) {
+	var principals []string
+	for _, principal := range strings.Split(d.Get("valid_principals").(string), ",") {
+		if principal = strings.ToLower(strings.TrimSpace(principal)); principal != "" {
+			principals = append(principals, principal)
+		}
+	}
+	if len(principals) == 0 {
+		return nil, fmt.Errorf("Missing valid_principals for host certificate")
+	}
+
+	allowedDomains := strutil.ParseDedupAndSortStrings(role.AllowedDomains, ",")
+	for _, principal := range principals {
+		if !validateHostname(principal, allowedDomains, role.AllowBareDomains, role.AllowSubdomains) {
+			return nil, fmt.Errorf("%s is not a valid value for valid_principals", principal)
+		}
+	}
+
+	return principals, nil
+}
+
+// Checks if the hostname is one of the allowed domains, or one of their
+// subdomains, as allowed
+func validateHostname(hostname string, allowedDomains []string, allowBareDomains, allowSubdomains bool) bool {
+	for _, domain := range allowedDomains {
+		domain = strings.ToLower(domain)
+		switch {
+		case domain == "*":
+			return true
+		case hostname == domain:
+			if allowBareDomains {
+				return true
+			}
+		case allowSubdomains && strings.HasSuffix(hostname, "."+domain):
+			// Wildcards are only allowed as the leftmost label
+			sub := strings.TrimSuffix(hostname, "."+domain)
+			sub = strings.TrimPrefix(sub, "*.")
+			if sub == "*" || (sub != "" && !strings.Contains(sub, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the TTL of the certificate, which cannot exceed the maximum TTL of
+// the role
+func (b *backend) calculateTTL(d *framework.FieldData, role *sshRole) (time.Duration, error) {
+	ttl := time.Duration(d.Get("ttl").(int)) * time.Second
+	if ttl == 0 {
+		ttl = role.TTL
+	}
+	if ttl == 0 {
+		ttl = b.System().DefaultLeaseTTL()
+	}
+
+	maxTTL := role.MaxTTL
+	if maxTTL == 0 {
+		maxTTL = b.System().MaxLeaseTTL()
+	}
+
+	if ttl > maxTTL {
+		return 0, fmt.Errorf("ttl is larger than maximum allowed (%d)", maxTTL/time.Second)
+	}
+
+	return ttl, nil
+}
+
+// Returns the key ID of the certificate, which identifies the role and the
+// key unless the role allows users to choose it
+func (b *backend) calculateKeyID(d *framework.FieldData, role *sshRole, roleName string, publicKey ssh.PublicKey) (string, error) {
+	keyID := d.Get("key_id").(string)
+	if keyID != "" {
+		if !role.AllowUserKeyIDs {
+			return "", fmt.Errorf("Setting key_id is not allowed by role")
+		}
+		return keyID, nil
+	}
+
+	sum := sha256.Sum256(publicKey.Marshal())
+	return fmt.Sprintf("vault-%s-%x", roleName, sum), nil
+}
+
+// Returns the requested critical options or extensions, which must be
+// allowed by the role, or the defaults of the role if none are requested
+func calculateOptions(d *framework.FieldData, field, allowed string, defaults map[string]string) (map[string]string, error) {
+	requested := d.Get(field).(map[string]interface{})
+	if len(requested) == 0 {
+		return defaults, nil
+	}
+
+	options, err := convertMapToStringValue(requested)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %s", field, err)
+	}
+	for name := range options {
+		if allowed != "*" && !strutil.StrListContains(strutil.ParseDedupAndSortStrings(allowed, ","), name) {
+			return nil, fmt.Errorf("%s '%s' is not allowed by role", field, name)
+		}
+	}
+
+	return options, nil
+}
+
+const pathSignSyn = `
+Request signing an SSH key using a certain role with the provided details.
+`
+
+const pathSignDesc = `
+This path allows SSH keys to be signed according to the policy of the given
+role. The role must be of type 'ca'. The signed certificate is returned in
+the authorized_keys format. User certificates can be used alongside the
+private key to authenticate to SSH servers which trust the public key of the
+CA. Host certificates let SSH servers authenticate to clients which trust the
+public key of the CA for the hostnames of the certificate.
+`
@@ -238,3 +238,17 @@ func createSSHComm(username, ip string, port int, hostkey string) (*comm, error)
 
 	return SSHCommNew(fmt.Sprintf("%s:%d", ip, port), config)
 }
+
+// Converts a map of interface values, as given by framework.TypeMap fields,
+// to a map of string values
+func convertMapToStringValue(initial map[string]interface{}) (map[string]string, error) {
+	result := map[string]string{}
+	for key, value := range initial {
+		stringValue, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("value of '%s' must be a string", key)
+		}
+		result[key] = stringValue
+	}
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package totp
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathListKeys(&b),
+			pathKeys(&b),
+			pathCode(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+
+	// lock serializes the validation of codes, so that each code is only
+	// accepted once
+	lock sync.Mutex
+}
+
+const backendHelp = `
+The TOTP backend generates and validates the time-based one-time passwords of
+RFC 6238.
+
+Keys are either generated by the backend, which returns them once as an
+otpauth URL and a QR code for authenticator applications, or imported from
+the URL or seed given by a third-party service. Vault can then validate the
+codes of users, or generate codes, without distributing the seed.
+`
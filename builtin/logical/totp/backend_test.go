@@ -0,0 +1,189 @@
+package totp
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+}
+
+func testOK(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func testError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+}
+
+func TestBackend_generatedKey(t *testing.T) {
+	b, s := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "keys/user", map[string]interface{}{
+		"generate": true,
+	})
+	testError(t, b, s, logical.UpdateOperation, "keys/user", map[string]interface{}{
+		"generate":     true,
+		"issuer":       "Vault",
+		"account_name": "user@example.com",
+		"digits":       7,
+	})
+	resp := testOK(t, b, s, logical.UpdateOperation, "keys/user", map[string]interface{}{
+		"generate":     true,
+		"issuer":       "Vault",
+		"account_name": "user@example.com",
+	})
+
+	u, err := url.Parse(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Vault:user@example.com" {
+		t.Fatalf("bad url: %s", u)
+	}
+	seed, err := otputil.DecodeKey(u.Query().Get("secret"))
+	if err != nil || len(seed) != 20 {
+		t.Fatalf("bad secret: %s", u.Query().Get("secret"))
+	}
+
+	barcode, err := base64.StdEncoding.DecodeString(resp.Data["barcode"].(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(barcode)); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = testOK(t, b, s, logical.ReadOperation, "keys/user", nil)
+	if resp.Data["issuer"] != "Vault" || resp.Data["algorithm"] != "SHA1" || resp.Data["digits"] != 6 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["key"]; ok {
+		t.Fatal("the seed should not be returned")
+	}
+
+	// Codes of the authenticator are valid only once
+	totp := &otputil.TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	code, err := totp.Passcode(seed, totp.Counter(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = testOK(t, b, s, logical.UpdateOperation, "code/user", map[string]interface{}{
+		"code": code,
+	})
+	if resp.Data["valid"] != true {
+		t.Fatalf("expected code to be valid: %#v", resp.Data)
+	}
+	resp = testOK(t, b, s, logical.UpdateOperation, "code/user", map[string]interface{}{
+		"code": code,
+	})
+	if resp.Data["valid"] != false {
+		t.Fatalf("expected reused code to be invalid: %#v", resp.Data)
+	}
+
+	// Codes outside of the skew are invalid
+	code, err = totp.Passcode(seed, totp.Counter(time.Now())+5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = testOK(t, b, s, logical.UpdateOperation, "code/user", map[string]interface{}{
+		"code": code,
+	})
+	if resp.Data["valid"] != false {
+		t.Fatalf("expected future code to be invalid: %#v", resp.Data)
+	}
+
+	// Keys which are not exported are not returned
+	resp = testOK(t, b, s, logical.UpdateOperation, "keys/hidden", map[string]interface{}{
+		"generate":     true,
+		"exported":     false,
+		"issuer":       "Vault",
+		"account_name": "user@example.com",
+	})
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	resp = testOK(t, b, s, logical.ListOperation, "keys/", nil)
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 2 || keys[0] != "hidden" || keys[1] != "user" {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func TestBackend_importedKey(t *testing.T) {
+	b, s := testBackend(t)
+
+	// The seed of RFC 6238 for SHA256
+	seed := []byte("12345678901234567890123456789012")
+	totp := &otputil.TOTP{Algorithm: "SHA256", Digits: 8, Period: 60 * time.Second}
+
+	testError(t, b, s, logical.UpdateOperation, "keys/service", map[string]interface{}{
+		"url": "https://example.com/",
+	})
+	testError(t, b, s, logical.UpdateOperation, "keys/service", map[string]interface{}{
+		"key": "not base32!",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "keys/service", map[string]interface{}{
+		"url": totp.URL("Example", "ops@example.com", seed),
+	})
+
+	resp := testOK(t, b, s, logical.ReadOperation, "keys/service", nil)
+	if resp.Data["issuer"] != "Example" || resp.Data["account_name"] != "ops@example.com" ||
+		resp.Data["algorithm"] != "SHA256" || resp.Data["digits"] != 8 || resp.Data["period"] != int64(60) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testOK(t, b, s, logical.ReadOperation, "code/service", nil)
+	code := resp.Data["code"].(string)
+	if len(code) != 8 {
+		t.Fatalf("bad code: %s", code)
+	}
+	if _, ok := totp.Check(seed, code, time.Now(), 1); !ok {
+		t.Fatalf("code %s does not match the seed", code)
+	}
+
+	// Keys can be given as base32 seeds
+	testOK(t, b, s, logical.UpdateOperation, "keys/seed", map[string]interface{}{
+		"key": strings.ToLower(otputil.EncodeKey(seed)),
+	})
+	resp = testOK(t, b, s, logical.ReadOperation, "code/seed", nil)
+	sha1 := &otputil.TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	if _, ok := sha1.Check(seed, resp.Data["code"].(string), time.Now(), 1); !ok {
+		t.Fatalf("code %s does not match the seed", resp.Data["code"])
+	}
+
+	testOK(t, b, s, logical.DeleteOperation, "keys/service", nil)
+	testError(t, b, s, logical.ReadOperation, "code/service", nil)
+}
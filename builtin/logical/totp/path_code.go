@@ -0,0 +1,105 @@
+package totp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathCode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "code/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"code": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Code to validate.",
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathCodeRead,
+			logical.UpdateOperation: b.pathCodeValidate,
+		},
+		HelpSynopsis:    pathCodeHelpSyn,
+		HelpDescription: pathCodeHelpDesc,
+	}
+}
+
+func (b *backend) pathCodeRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	key, err := b.Key(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown key: %s", name)), nil
+	}
+
+	totp := key.totp()
+	code, err := totp.Passcode(key.Key, totp.Counter(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"code": code,
+		},
+	}, nil
+}
+
+func (b *backend) pathCodeValidate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	code := d.Get("code").(string)
+	if code == "" {
+		return logical.ErrorResponse("missing code"), nil
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	key, err := b.Key(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown key: %s", name)), nil
+	}
+
+	// Codes are only valid once, so that observed codes cannot be replayed
+	counter, ok := key.totp().Check(key.Key, code, time.Now(), key.Skew)
+	if ok && counter <= key.LastCounter {
+		ok = false
+	}
+	if ok {
+		key.LastCounter = counter
+		if err := b.putKey(req.Storage, name, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": ok,
+		},
+	}, nil
+}
+
+const pathCodeHelpSyn = `
+Generate or validate the codes of a key.
+`
+
+const pathCodeHelpDesc = `
+Reading this endpoint returns the current code of the key.
+
+Writing a code to it returns whether it is valid: a code is valid if it is
+the code of the current period, or of the periods within the skew of the key,
+and if neither it nor a later code was already validated.
+`
@@ -0,0 +1,339 @@
+package totp
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/helper/qrutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// keyEntry is a stored key and the parameters of its codes
+type keyEntry struct {
+	Key         []byte        `json:"key"`
+	Issuer      string        `json:"issuer"`
+	AccountName string        `json:"account_name"`
+	Algorithm   string        `json:"algorithm"`
+	Digits      int           `json:"digits"`
+	Period      time.Duration `json:"period"`
+	Skew        int           `json:"skew"`
+
+	// LastCounter is the counter of the last validated code, which cannot
+	// be used again
+	LastCounter uint64 `json:"last_counter"`
+}
+
+func (k *keyEntry) totp() *otputil.TOTP {
+	return &otputil.TOTP{
+		Algorithm: k.Algorithm,
+		Digits:    k.Digits,
+		Period:    k.Period,
+	}
+}
+
+func pathListKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/?$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathKeyList,
+		},
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+func pathKeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key.",
+			},
+			"generate": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Whether the key is generated by Vault rather than given.",
+			},
+			"exported": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether a generated key is returned, as a URL and a
+QR code. Only used when generate is true.`,
+				Default: true,
+			},
+			"key_size": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "Size in bytes of a generated key.",
+				Default:     20,
+			},
+			"url": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `otpauth URL of the key, as encoded in the QR codes
+of third-party services. Its parameters take precedence over the other
+fields.`,
+			},
+			"key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base32 encoded seed of the key, when not given by url.",
+			},
+			"issuer": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the service the key is for.",
+			},
+			"account_name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the account the key is for.",
+			},
+			"period": &framework.FieldSchema{
+				Type:        framework.TypeDurationSecond,
+				Description: "How long each code is valid.",
+				Default:     30,
+			},
+			"algorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `HMAC hash of the codes: "SHA1", "SHA256" or "SHA512".`,
+				Default:     "SHA1",
+			},
+			"digits": &framework.FieldSchema{
+				Type:        framework.TypeInt,
+				Description: "Number of digits of the codes, 6 or 8.",
+				Default:     6,
+			},
+			"skew": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `Number of periods before and after the current one
+whose codes are also accepted, 0 or 1.`,
+				Default: 1,
+			},
+			"qr_size": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `Approximate size in pixels of the QR code of a
+generated key; 0 disables it.`,
+				Default: 200,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathKeyRead,
+			logical.UpdateOperation: b.pathKeyUpdate,
+			logical.DeleteOperation: b.pathKeyDelete,
+		},
+		HelpSynopsis:    pathKeyHelpSyn,
+		HelpDescription: pathKeyHelpDesc,
+	}
+}
+
+// Key returns the named key, or nil if it does not exist
+func (b *backend) Key(s logical.Storage, n string) (*keyEntry, error) {
+	entry, err := s.Get("key/" + n)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result keyEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) putKey(s logical.Storage, n string, key *keyEntry) error {
+	entry, err := logical.StorageEntryJSON("key/"+n, key)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func (b *backend) pathKeyList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	keys, err := req.Storage.List("key/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) pathKeyRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, err := b.Key(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, nil
+	}
+
+	// The seed is never returned
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer":       key.Issuer,
+			"account_name": key.AccountName,
+			"algorithm":    key.Algorithm,
+			"digits":       key.Digits,
+			"period":       int64(key.Period / time.Second),
+		},
+	}, nil
+}
+
+func (b *backend) pathKeyDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	if err := req.Storage.Delete("key/" + d.Get("name").(string)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (b *backend) pathKeyUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	generate := d.Get("generate").(bool)
+
+	key := &keyEntry{
+		Issuer:      d.Get("issuer").(string),
+		AccountName: d.Get("account_name").(string),
+		Algorithm:   strings.ToUpper(d.Get("algorithm").(string)),
+		Digits:      d.Get("digits").(int),
+		Period:      time.Duration(d.Get("period").(int)) * time.Second,
+		Skew:        d.Get("skew").(int),
+	}
+
+	if generate {
+		if d.Get("url").(string) != "" || d.Get("key").(string) != "" {
+			return logical.ErrorResponse("url and key cannot be given when generate is true"), nil
+		}
+		if key.Issuer == "" || key.AccountName == "" {
+			return logical.ErrorResponse("issuer and account_name are required when generate is true"), nil
+		}
+		keySize := d.Get("key_size").(int)
+		if keySize < 16 {
+			return logical.ErrorResponse("key_size must be at least 16 bytes"), nil
+		}
+
+		var err error
+		if key.Key, err = otputil.GenerateKey(keySize); err != nil {
+			return nil, err
+		}
+	} else if rawURL := d.Get("url").(string); rawURL != "" {
+		if err := parseURL(key, rawURL); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid url: %s", err)), nil
+		}
+	} else {
+		encoded := d.Get("key").(string)
+		if encoded == "" {
+			return logical.ErrorResponse("url or key is required when generate is false"), nil
+		}
+		var err error
+		if key.Key, err = otputil.DecodeKey(encoded); err != nil || len(key.Key) == 0 {
+			return logical.ErrorResponse("key must be a base32 encoded seed"), nil
+		}
+	}
+
+	if err := key.totp().Validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if key.Skew != 0 && key.Skew != 1 {
+		return logical.ErrorResponse("skew must be 0 or 1"), nil
+	}
+
+	if err := b.putKey(req.Storage, name, key); err != nil {
+		return nil, err
+	}
+
+	if !generate || !d.Get("exported").(bool) {
+		return nil, nil
+	}
+
+	keyURL := key.totp().URL(key.Issuer, key.AccountName, key.Key)
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"url": keyURL,
+		},
+	}
+
+	if qrSize := d.Get("qr_size").(int); qrSize > 0 {
+		code, err := qrutil.Encode(keyURL)
+		if err != nil {
+			return nil, err
+		}
+		scale := qrSize / (code.Size + 8)
+		if scale < 1 {
+			scale = 1
+		}
+		barcode, err := code.PNG(scale)
+		if err != nil {
+			return nil, err
+		}
+		resp.Data["barcode"] = base64.StdEncoding.EncodeToString(barcode)
+	}
+
+	return resp, nil
+}
+
+// parseURL sets the seed and parameters of the key from an otpauth URL,
+// such as otpauth://totp/Issuer:account?secret=...&issuer=Issuer
+func parseURL(key *keyEntry, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		return fmt.Errorf("not an otpauth://totp/ URL")
+	}
+
+	label := strings.TrimPrefix(u.Path, "/")
+	if i := strings.Index(label, ":"); i >= 0 {
+		key.Issuer = label[:i]
+		key.AccountName = strings.TrimSpace(label[i+1:])
+	} else {
+		key.AccountName = label
+	}
+
+	q := u.Query()
+	if key.Key, err = otputil.DecodeKey(q.Get("secret")); err != nil || len(key.Key) == 0 {
+		return fmt.Errorf("secret must be a base32 encoded seed")
+	}
+	if issuer := q.Get("issuer"); issuer != "" {
+		key.Issuer = issuer
+	}
+	if algorithm := q.Get("algorithm"); algorithm != "" {
+		key.Algorithm = strings.ToUpper(algorithm)
+	}
+	if digits := q.Get("digits"); digits != "" {
+		if key.Digits, err = strconv.Atoi(digits); err != nil {
+			return fmt.Errorf("invalid digits %q", digits)
+		}
+	}
+	if period := q.Get("period"); period != "" {
+		seconds, err := strconv.Atoi(period)
+		if err != nil {
+			return fmt.Errorf("invalid period %q", period)
+		}
+		key.Period = time.Duration(seconds) * time.Second
+	}
+
+	return nil
+}
+
+const pathKeyHelpSyn = `
+Manage the keys of the backend.
+`
+
+const pathKeyHelpDesc = `
+Keys are either generated by Vault, when generate is true, or given by a
+third-party service as an otpauth URL or a base32 encoded seed.
+
+Generated keys are returned once, as an otpauth URL and the base64 encoded PNG
+image of its QR code, to be enrolled into authenticator applications, unless
+exported is false. The seed of keys is never returned afterwards; the codes
+are read or validated through the code/ endpoint instead.
+`
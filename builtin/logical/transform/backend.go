@@ -0,0 +1,45 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathListTemplates(&b),
+			pathTemplates(&b),
+			pathListTransformations(&b),
+			pathTransformations(&b),
+			pathEncode(&b),
+			pathDecode(&b),
+		},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The transform backend encodes values, such as credit card or social security
+numbers, into values of the same format, so that they can be stored where the
+original values were, such as in fixed-format database columns.
+
+Transformations either encrypt the values with format-preserving encryption
+(FF3-1), or replace them with tokens. The format of the values is described by
+templates: a regular expression whose capture groups are the characters to
+encode, and the alphabet of these characters.
+`
@@ -0,0 +1,197 @@
+package transform
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func testBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+	return b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+}
+
+func testOK(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || (resp != nil && resp.IsError()) {
+		t.Fatalf("bad: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+	return resp
+}
+
+func testError(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) {
+	resp, err := testRequest(b, s, op, path, data)
+	if err != nil || resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %s %s: resp: %#v\nerr: %v", op, path, resp, err)
+	}
+}
+
+func TestBackend_templates(t *testing.T) {
+	b, s := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "template/bad", map[string]interface{}{
+		"pattern":  `\d+`,
+		"alphabet": "numeric",
+	})
+	testError(t, b, s, logical.UpdateOperation, "template/bad", map[string]interface{}{
+		"pattern":  `(\d+)`,
+		"alphabet": "hexadecimal",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "template/plate", map[string]interface{}{
+		"pattern":  `([A-Z]{3})-(\d{4})`,
+		"alphabet": "alphanumericupper",
+	})
+
+	resp := testOK(t, b, s, logical.ReadOperation, "template/plate", nil)
+	if resp.Data["pattern"] != `([A-Z]{3})-(\d{4})` || resp.Data["alphabet"] != "alphanumericupper" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testOK(t, b, s, logical.ListOperation, "template/", nil)
+	keys := resp.Data["keys"].([]string)
+	if len(keys) != 3 || keys[2] != "plate" {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func TestBackend_fpe(t *testing.T) {
+	b, s := testBackend(t)
+
+	testError(t, b, s, logical.UpdateOperation, "transformation/ccn", map[string]interface{}{
+		"template": "builtin/unknown",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "transformation/ccn", map[string]interface{}{
+		"template": "builtin/creditcardnumber",
+	})
+	testError(t, b, s, logical.UpdateOperation, "transformation/ccn", map[string]interface{}{
+		"template": "builtin/creditcardnumber",
+	})
+	resp := testOK(t, b, s, logical.ReadOperation, "transformation/ccn", nil)
+	if resp.Data["type"] != "fpe" || resp.Data["tweak_source"] != "supplied" || resp.Data["key"] != nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	tweak := base64.StdEncoding.EncodeToString([]byte("tweak01"))
+	testError(t, b, s, logical.UpdateOperation, "encode/ccn", map[string]interface{}{
+		"value": "4111-1111-1111-1111",
+	})
+	testError(t, b, s, logical.UpdateOperation, "encode/ccn", map[string]interface{}{
+		"value": "4111-1111-1111",
+		"tweak": tweak,
+	})
+	resp = testOK(t, b, s, logical.UpdateOperation, "encode/ccn", map[string]interface{}{
+		"value": "4111-1111-1111-1111",
+		"tweak": tweak,
+	})
+	encoded := resp.Data["encoded_value"].(string)
+	if len(encoded) != 19 || encoded[4] != '-' || encoded[9] != '-' || encoded == "4111-1111-1111-1111" {
+		t.Fatalf("bad: %s", encoded)
+	}
+
+	// Encoding is deterministic for a tweak
+	resp = testOK(t, b, s, logical.UpdateOperation, "encode/ccn", map[string]interface{}{
+		"value": "4111-1111-1111-1111",
+		"tweak": tweak,
+	})
+	if resp.Data["encoded_value"] != encoded {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = testOK(t, b, s, logical.UpdateOperation, "decode/ccn", map[string]interface{}{
+		"value": encoded,
+		"tweak": tweak,
+	})
+	if resp.Data["decoded_value"] != "4111-1111-1111-1111" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Transformations with an internal tweak need none
+	testOK(t, b, s, logical.UpdateOperation, "transformation/ssn", map[string]interface{}{
+		"template":     "builtin/socialsecuritynumber",
+		"tweak_source": "internal",
+	})
+	resp = testOK(t, b, s, logical.UpdateOperation, "encode/ssn", map[string]interface{}{
+		"value": "123456789",
+	})
+	encoded = resp.Data["encoded_value"].(string)
+	resp = testOK(t, b, s, logical.UpdateOperation, "decode/ssn", map[string]interface{}{
+		"value": encoded,
+	})
+	if resp.Data["decoded_value"] != "123456789" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBackend_tokenization(t *testing.T) {
+	b, s := testBackend(t)
+
+	testOK(t, b, s, logical.UpdateOperation, "transformation/convertible", map[string]interface{}{
+		"type":     "tokenization",
+		"template": "builtin/socialsecuritynumber",
+	})
+	testOK(t, b, s, logical.UpdateOperation, "transformation/irreversible", map[string]interface{}{
+		"type":     "tokenization",
+		"template": "builtin/socialsecuritynumber",
+		"mode":     "irreversible",
+	})
+	resp := testOK(t, b, s, logical.ReadOperation, "transformation/irreversible", nil)
+	if resp.Data["type"] != "tokenization" || resp.Data["mode"] != "irreversible" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	encode := func(name string) string {
+		resp := testOK(t, b, s, logical.UpdateOperation, "encode/"+name, map[string]interface{}{
+			"value": "123-45-6789",
+		})
+		token := resp.Data["encoded_value"].(string)
+		if len(token) != 11 || token[3] != '-' || token[6] != '-' || token == "123-45-6789" {
+			t.Fatalf("bad: %s", token)
+		}
+		return token
+	}
+
+	// Convertible tokens are random, and decode to their value
+	token := encode("convertible")
+	if encode("convertible") == token {
+		t.Fatalf("bad: %s", token)
+	}
+	resp = testOK(t, b, s, logical.UpdateOperation, "decode/convertible", map[string]interface{}{
+		"value": token,
+	})
+	if resp.Data["decoded_value"] != "123-45-6789" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	testError(t, b, s, logical.UpdateOperation, "decode/convertible", map[string]interface{}{
+		"value": "000-00-0000",
+	})
+
+	// Irreversible tokens are derived from their value, and cannot be decoded
+	token = encode("irreversible")
+	if encode("irreversible") != token {
+		t.Fatalf("bad: %s", token)
+	}
+	testError(t, b, s, logical.UpdateOperation, "decode/irreversible", map[string]interface{}{
+		"value": token,
+	})
+
+	// Deleting a transformation deletes its tokens
+	testOK(t, b, s, logical.DeleteOperation, "transformation/convertible", nil)
+	tokens, err := s.List(tokensPrefix("convertible"))
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("bad: %#v %v", tokens, err)
+	}
+}
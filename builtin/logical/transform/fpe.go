@@ -0,0 +1,173 @@
+package transform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"math/big"
+)
+
+// ff3TweakSize is the size of the tweaks of FF3-1, 56 bits
+const ff3TweakSize = 7
+
+// ff3 implements the FF3-1 format-preserving encryption mode of NIST SP
+// 800-38G Revision 1, over strings of the numerals of a radix
+type ff3 struct {
+	block  cipher.Block
+	radix  *big.Int
+	minLen int
+	maxLen int
+}
+
+// newFF3 returns FF3-1 with the given AES key, over strings of the given
+// radix
+func newFF3(key []byte, radix int) (*ff3, error) {
+	if radix < 2 || radix > 1<<16 {
+		return nil, fmt.Errorf("invalid radix %d", radix)
+	}
+
+	// The key is used byte-reversed
+	reversed := make([]byte, len(key))
+	for i := range key {
+		reversed[i] = key[len(key)-1-i]
+	}
+	block, err := aes.NewCipher(reversed)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &ff3{
+		block: block,
+		radix: big.NewInt(int64(radix)),
+	}
+	f.minLen, f.maxLen = ff3Bounds(radix)
+	if f.minLen > f.maxLen {
+		return nil, fmt.Errorf("radix %d is too small", radix)
+	}
+
+	return f, nil
+}
+
+// ff3Bounds returns the bounds of the length of the inputs of FF3-1 of the
+// radix: the domain must hold at least a million values, and each half of
+// the input must fit in 96 bits
+func ff3Bounds(radix int) (int, int) {
+	million := big.NewInt(1000000)
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	size := big.NewInt(1)
+	minLen := 0
+	for n := 1; ; n++ {
+		size.Mul(size, big.NewInt(int64(radix)))
+		if minLen == 0 && size.Cmp(million) >= 0 {
+			minLen = n
+		}
+		if size.Cmp(limit) > 0 {
+			return minLen, 2 * (n - 1)
+		}
+	}
+}
+
+// Encrypt encrypts the numerals with the 56-bit tweak
+func (f *ff3) Encrypt(tweak []byte, numerals []int) ([]int, error) {
+	return f.cipher(tweak, numerals, false)
+}
+
+// Decrypt decrypts the numerals with the 56-bit tweak
+func (f *ff3) Decrypt(tweak []byte, numerals []int) ([]int, error) {
+	return f.cipher(tweak, numerals, true)
+}
+
+func (f *ff3) cipher(tweak []byte, numerals []int, decrypt bool) ([]int, error) {
+	if len(tweak) != ff3TweakSize {
+		return nil, fmt.Errorf("tweak must be %d bytes long", ff3TweakSize)
+	}
+	if len(numerals) < f.minLen || len(numerals) > f.maxLen {
+		return nil, fmt.Errorf("input must be between %d and %d characters long", f.minLen, f.maxLen)
+	}
+
+	// The 56-bit tweak is split into two 32-bit halves
+	t := []byte{
+		tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0,
+		tweak[4], tweak[5], tweak[6], (tweak[3] & 0x0f) << 4,
+	}
+	return f.rounds(t[:4], t[4:], numerals, decrypt), nil
+}
+
+// rounds runs the eight Feistel rounds of FF3 with the halves of the 64-bit
+// tweak
+func (f *ff3) rounds(tweakLeft, tweakRight []byte, numerals []int, decrypt bool) []int {
+	u := (len(numerals) + 1) / 2
+	a := append([]int{}, numerals[:u]...)
+	b := append([]int{}, numerals[u:]...)
+
+	for r := 0; r < 8; r++ {
+		i := r
+		if decrypt {
+			i = 7 - r
+		}
+
+		m, w := u, tweakRight
+		if i%2 == 1 {
+			m, w = len(numerals)-u, tweakLeft
+		}
+
+		// The half which is not modified is the input of the round function
+		in, out := b, a
+		if decrypt {
+			in, out = a, b
+		}
+		p := make([]byte, 16)
+		copy(p, w)
+		p[3] ^= byte(i)
+		f.num(in).FillBytes(p[4:])
+
+		reverseBytes(p)
+		f.block.Encrypt(p, p)
+		reverseBytes(p)
+		y := new(big.Int).SetBytes(p)
+
+		c := f.num(out)
+		if decrypt {
+			c.Sub(c, y)
+		} else {
+			c.Add(c, y)
+		}
+		c.Mod(c, new(big.Int).Exp(f.radix, big.NewInt(int64(m)), nil))
+
+		if decrypt {
+			a, b = f.str(c, m), a
+		} else {
+			a, b = b, f.str(c, m)
+		}
+	}
+
+	return append(a, b...)
+}
+
+// num returns the number of the numerals, least significant first
+func (f *ff3) num(numerals []int) *big.Int {
+	n := new(big.Int)
+	for i := len(numerals) - 1; i >= 0; i-- {
+		n.Mul(n, f.radix)
+		n.Add(n, big.NewInt(int64(numerals[i])))
+	}
+	return n
+}
+
+// str returns the m numerals of the number, least significant first
+func (f *ff3) str(n *big.Int, m int) []int {
+	numerals := make([]int, m)
+	n = new(big.Int).Set(n)
+	digit := new(big.Int)
+	for i := range numerals {
+		n.DivMod(n, f.radix, digit)
+		numerals[i] = int(digit.Int64())
+	}
+	return numerals
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
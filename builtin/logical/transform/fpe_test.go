@@ -0,0 +1,85 @@
+package transform
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func numerals(s string) []int {
+	n := make([]int, len(s))
+	for i, c := range s {
+		n[i] = int(c - '0')
+	}
+	return n
+}
+
+func TestFF3_rounds(t *testing.T) {
+	// Samples of FF3 from NIST, which share the rounds of FF3-1
+	key, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+	f, err := newFF3(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{"D8E7920AFA330A73", "890121234567890000", "750918814058654607"},
+		{"9A768A92F60E12D8", "890121234567890000", "018989839189395384"},
+		{"D8E7920AFA330A73", "89012123456789000000789000000", "48598367162252569629397416226"},
+		{"0000000000000000", "89012123456789000000789000000", "34695224821734535122613701434"},
+	}
+	for _, c := range cases {
+		tweak, _ := hex.DecodeString(c.tweak)
+		ciphertext := f.rounds(tweak[:4], tweak[4:], numerals(c.plaintext), false)
+		if !reflect.DeepEqual(ciphertext, numerals(c.ciphertext)) {
+			t.Fatalf("bad: %v", ciphertext)
+		}
+		plaintext := f.rounds(tweak[:4], tweak[4:], ciphertext, true)
+		if !reflect.DeepEqual(plaintext, numerals(c.plaintext)) {
+			t.Fatalf("bad: %v", plaintext)
+		}
+	}
+}
+
+func TestFF3(t *testing.T) {
+	key, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+	f, err := newFF3(key, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.minLen != 6 || f.maxLen != 56 {
+		t.Fatalf("bad: %d %d", f.minLen, f.maxLen)
+	}
+
+	tweak, _ := hex.DecodeString("D8E7920AFA330A")
+	plaintext := numerals("4111111111111111")
+	ciphertext, err := f.Encrypt(tweak, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != len(plaintext) || reflect.DeepEqual(ciphertext, plaintext) {
+		t.Fatalf("bad: %v", ciphertext)
+	}
+	decrypted, err := f.Decrypt(tweak, ciphertext)
+	if err != nil || !reflect.DeepEqual(decrypted, plaintext) {
+		t.Fatalf("bad: %v %v", decrypted, err)
+	}
+
+	// The ciphertext depends on the tweak
+	tweak[3] ^= 1
+	other, err := f.Encrypt(tweak, plaintext)
+	if err != nil || reflect.DeepEqual(other, ciphertext) {
+		t.Fatalf("bad: %v %v", other, err)
+	}
+
+	if _, err := f.Encrypt(tweak, numerals("12345")); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := f.Encrypt(tweak[:6], plaintext); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,295 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// maxTokenAttempts bounds the number of random tokens generated for a value
+// before giving up, when they collide with existing tokens
+const maxTokenAttempts = 10
+
+// tokenEntry is the value of a token of a convertible transformation
+type tokenEntry struct {
+	Value string `json:"value"`
+}
+
+// tokensPrefix returns the storage prefix of the tokens of a transformation,
+// which are stored under their hash
+func tokensPrefix(name string) string {
+	return "tokens/" + name + "/"
+}
+
+func tokenStorageKey(name, token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return tokensPrefix(name) + hex.EncodeToString(sum[:])
+}
+
+func encodeFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the transformation.",
+		},
+		"value": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The value to encode or decode.",
+		},
+		"tweak": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `The base64-encoded 7-byte tweak of "fpe"
+transformations whose tweak is supplied.`,
+		},
+	}
+}
+
+func pathEncode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "encode/" + framework.GenericNameRegex("name"),
+		Fields:  encodeFields(),
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncodeWrite,
+		},
+		HelpSynopsis:    pathEncodeHelpSyn,
+		HelpDescription: pathEncodeHelpDesc,
+	}
+}
+
+func pathDecode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "decode/" + framework.GenericNameRegex("name"),
+		Fields:  encodeFields(),
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecodeWrite,
+		},
+		HelpSynopsis:    pathDecodeHelpSyn,
+		HelpDescription: pathDecodeHelpDesc,
+	}
+}
+
+func (b *backend) pathEncodeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.transform(req, d, false)
+}
+
+func (b *backend) pathDecodeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.transform(req, d, true)
+}
+
+// transform encodes or decodes the value of the request with the named
+// transformation
+func (b *backend) transform(
+	req *logical.Request, d *framework.FieldData, decode bool) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	value := d.Get("value").(string)
+	if value == "" {
+		return logical.ErrorResponse("missing value"), nil
+	}
+
+	t, err := b.Transformation(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return logical.ErrorResponse(fmt.Sprintf("transformation %s not found", name)), nil
+	}
+
+	numerals, replace, err := t.Template.parse(value)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	var result string
+	switch t.Type {
+	case transformationTypeFPE:
+		var out []int
+		out, err = t.encrypt(d.Get("tweak").(string), numerals, decode)
+		if err == nil {
+			result = replace(out)
+		}
+	case transformationTypeTokenization:
+		if decode {
+			result, err = b.detokenize(req.Storage, name, t, value)
+		} else {
+			result, err = b.tokenize(req.Storage, name, t, value, numerals, replace)
+		}
+	default:
+		return nil, fmt.Errorf("unknown transformation type %q", t.Type)
+	}
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	key := "encoded_value"
+	if decode {
+		key = "decoded_value"
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			key: result,
+		},
+	}, nil
+}
+
+// encrypt encrypts or decrypts the numerals with FF3-1
+func (t *transformationEntry) encrypt(tweakRaw string, numerals []int, decrypt bool) ([]int, error) {
+	tweak := t.Tweak
+	if t.TweakSource == tweakSourceSupplied {
+		if tweakRaw == "" {
+			return nil, errutil.UserError{Err: "missing tweak"}
+		}
+		var err error
+		tweak, err = base64.StdEncoding.DecodeString(tweakRaw)
+		if err != nil {
+			return nil, errutil.UserError{Err: "failed to base64-decode tweak"}
+		}
+		if len(tweak) != ff3TweakSize {
+			return nil, errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes long", ff3TweakSize)}
+		}
+	}
+
+	f, err := newFF3(t.Key, t.Template.radix())
+	if err != nil {
+		return nil, err
+	}
+	if len(numerals) < f.minLen || len(numerals) > f.maxLen {
+		return nil, errutil.UserError{Err: fmt.Sprintf("value must have between %d and %d characters to encode", f.minLen, f.maxLen)}
+	}
+	if decrypt {
+		return f.Decrypt(tweak, numerals)
+	}
+	return f.Encrypt(tweak, numerals)
+}
+
+// tokenize returns a token of the value, of the same format. The tokens of
+// convertible transformations are random, and stored along with the value;
+// the tokens of irreversible ones are derived from the value.
+func (b *backend) tokenize(s logical.Storage, name string, t *transformationEntry,
+	value string, numerals []int, replace func([]int) string) (string, error) {
+	radix := t.Template.radix()
+	if minLen, _ := ff3Bounds(radix); len(numerals) < minLen {
+		return "", errutil.UserError{Err: fmt.Sprintf("value must have at least %d characters to encode", minLen)}
+	}
+	domain := new(big.Int).Exp(big.NewInt(int64(radix)), big.NewInt(int64(len(numerals))), nil)
+
+	if t.Mode == tokenizationModeIrreversible {
+		return replace(toNumerals(t.derive(value, domain), radix, len(numerals))), nil
+	}
+
+	for i := 0; i < maxTokenAttempts; i++ {
+		n, err := rand.Int(rand.Reader, domain)
+		if err != nil {
+			return "", err
+		}
+		token := replace(toNumerals(n, radix, len(numerals)))
+		if token == value {
+			continue
+		}
+
+		key := tokenStorageKey(name, token)
+		existing, err := s.Get(key)
+		if err != nil {
+			return "", err
+		}
+		if existing != nil {
+			continue
+		}
+
+		entry, err := logical.StorageEntryJSON(key, &tokenEntry{
+			Value: value,
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := s.Put(entry); err != nil {
+			return "", err
+		}
+		return token, nil
+	}
+
+	return "", fmt.Errorf("failed to generate a unique token")
+}
+
+// detokenize returns the value of a token
+func (b *backend) detokenize(s logical.Storage, name string, t *transformationEntry, token string) (string, error) {
+	if t.Mode == tokenizationModeIrreversible {
+		return "", errutil.UserError{Err: "tokens of irreversible transformations cannot be decoded"}
+	}
+
+	entry, err := s.Get(tokenStorageKey(name, token))
+	if err != nil {
+		return "", err
+	}
+	if entry == nil {
+		return "", errutil.UserError{Err: "token not found"}
+	}
+
+	var result tokenEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return "", err
+	}
+	return result.Value, nil
+}
+
+// derive returns a number of the domain derived from the value with the key
+// of the transformation. HMAC blocks are generated until they exceed the
+// domain by 64 bits, so that the bias of reducing them is negligible.
+func (t *transformationEntry) derive(value string, domain *big.Int) *big.Int {
+	var sum []byte
+	for counter := uint32(0); len(sum)*8 < domain.BitLen()+64; counter++ {
+		mac := hmac.New(sha256.New, t.Key)
+		binary.Write(mac, binary.BigEndian, counter)
+		mac.Write([]byte(value))
+		sum = mac.Sum(sum)
+	}
+	n := new(big.Int).SetBytes(sum)
+	return n.Mod(n, domain)
+}
+
+// toNumerals returns the m numerals of the number in the radix
+func toNumerals(n *big.Int, radix, m int) []int {
+	numerals := make([]int, m)
+	n = new(big.Int).Set(n)
+	digit := new(big.Int)
+	for i := m - 1; i >= 0; i-- {
+		n.DivMod(n, big.NewInt(int64(radix)), digit)
+		numerals[i] = int(digit.Int64())
+	}
+	return numerals
+}
+
+const pathEncodeHelpSyn = `
+Encode a value with a transformation.
+`
+
+const pathEncodeHelpDesc = `
+This path encodes the given value, which must match the template of the
+transformation, into a value of the same format: the characters of the
+capture groups of the template are encrypted or tokenized, and the other
+characters are kept as is.
+`
+
+const pathDecodeHelpSyn = `
+Decode a value encoded with a transformation.
+`
+
+const pathDecodeHelpDesc = `
+This path decodes a value encoded with the transformation, given the same
+tweak. The tokens of irreversible transformations cannot be decoded.
+`
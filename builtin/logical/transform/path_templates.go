@@ -0,0 +1,256 @@
+package transform
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// alphabets are the sets of characters templates can encode
+var alphabets = map[string]string{
+	"numeric":           "0123456789",
+	"alphalower":        "abcdefghijklmnopqrstuvwxyz",
+	"alphaupper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alphanumericlower": "0123456789abcdefghijklmnopqrstuvwxyz",
+	"alphanumericupper": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"alphanumeric":      "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// builtinTemplatePrefix prefixes the names of the templates of the backend,
+// which cannot be modified
+const builtinTemplatePrefix = "builtin/"
+
+// builtinTemplates are the templates of common formats
+var builtinTemplates = map[string]*templateEntry{
+	"builtin/creditcardnumber": &templateEntry{
+		Pattern:  `(\d{4})[- ]?(\d{4})[- ]?(\d{4})[- ]?(\d{4})`,
+		Alphabet: "numeric",
+	},
+	"builtin/socialsecuritynumber": &templateEntry{
+		Pattern:  `(\d{3})[- ]?(\d{2})[- ]?(\d{4})`,
+		Alphabet: "numeric",
+	},
+}
+
+func pathListTemplates(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "template/?$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathTemplateList,
+		},
+		HelpSynopsis:    pathTemplateHelpSyn,
+		HelpDescription: pathTemplateHelpDesc,
+	}
+}
+
+func pathTemplates(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "template/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the template.",
+			},
+			"pattern": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Regular expression matching the values, whose
+capture groups are the characters to encode.`,
+			},
+			"alphabet": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Alphabet of the characters to encode: "numeric",
+"alphalower", "alphaupper", "alphanumericlower", "alphanumericupper" or
+"alphanumeric".`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTemplateRead,
+			logical.UpdateOperation: b.pathTemplateUpdate,
+			logical.DeleteOperation: b.pathTemplateDelete,
+		},
+		HelpSynopsis:    pathTemplateHelpSyn,
+		HelpDescription: pathTemplateHelpDesc,
+	}
+}
+
+// Template returns the named template, which may be builtin
+func (b *backend) Template(s logical.Storage, n string) (*templateEntry, error) {
+	if strings.HasPrefix(n, builtinTemplatePrefix) {
+		return builtinTemplates[n], nil
+	}
+
+	entry, err := s.Get("template/" + n)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result templateEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathTemplateList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	templates, err := req.Storage.List("template/")
+	if err != nil {
+		return nil, err
+	}
+	for name := range builtinTemplates {
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+
+	return logical.ListResponse(templates), nil
+}
+
+func (b *backend) pathTemplateRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	template, err := b.Template(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: structs.New(template).Map(),
+	}, nil
+}
+
+func (b *backend) pathTemplateUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	template := &templateEntry{
+		Pattern:  d.Get("pattern").(string),
+		Alphabet: d.Get("alphabet").(string),
+	}
+	if err := template.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("template/"+name, template)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathTemplateDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete("template/" + d.Get("name").(string))
+}
+
+// templateEntry describes the format of values: the pattern matching them,
+// whose capture groups are the characters to encode, and their alphabet
+type templateEntry struct {
+	Pattern  string `json:"pattern" structs:"pattern" mapstructure:"pattern"`
+	Alphabet string `json:"alphabet" structs:"alphabet" mapstructure:"alphabet"`
+}
+
+func (t *templateEntry) validate() error {
+	if t.Pattern == "" {
+		return fmt.Errorf("missing pattern")
+	}
+	re, err := t.regexp()
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %s", err)
+	}
+	if re.NumSubexp() == 0 {
+		return fmt.Errorf("pattern has no capture group")
+	}
+	if _, ok := alphabets[t.Alphabet]; !ok {
+		return fmt.Errorf("unknown alphabet %q", t.Alphabet)
+	}
+	return nil
+}
+
+// regexp returns the pattern, matching whole values
+func (t *templateEntry) regexp() (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + t.Pattern + ")$")
+}
+
+// radix returns the number of characters of the alphabet
+func (t *templateEntry) radix() int {
+	return len(alphabets[t.Alphabet])
+}
+
+// parse returns the numerals of the characters of the value to encode, and a
+// function replacing them with the given numerals in the value
+func (t *templateEntry) parse(value string) ([]int, func([]int) string, error) {
+	re, err := t.regexp()
+	if err != nil {
+		return nil, nil, err
+	}
+	match := re.FindStringSubmatchIndex(value)
+	if match == nil {
+		return nil, nil, fmt.Errorf("value does not match the template")
+	}
+
+	// The spans of the capture groups, skipping nested groups
+	var spans [][2]int
+	end := 0
+	for i := 2; i < len(match); i += 2 {
+		if match[i] < 0 || match[i] < end {
+			continue
+		}
+		spans = append(spans, [2]int{match[i], match[i+1]})
+		end = match[i+1]
+	}
+
+	alphabet := alphabets[t.Alphabet]
+	var numerals []int
+	for _, span := range spans {
+		for _, c := range value[span[0]:span[1]] {
+			n := strings.IndexRune(alphabet, c)
+			if n < 0 {
+				return nil, nil, fmt.Errorf("character %q is not in the %s alphabet", c, t.Alphabet)
+			}
+			numerals = append(numerals, n)
+		}
+	}
+
+	replace := func(out []int) string {
+		result := []byte(value)
+		i := 0
+		for _, span := range spans {
+			for j := span[0]; j < span[1]; j++ {
+				result[j] = alphabet[out[i]]
+				i++
+			}
+		}
+		return string(result)
+	}
+	return numerals, replace, nil
+}
+
+const pathTemplateHelpSyn = `
+Manage the templates describing the format of values.
+`
+
+const pathTemplateHelpDesc = `
+This path lets you manage the templates of the backend. The "pattern" of a
+template is a regular expression matching whole values, whose capture groups
+are the characters to encode; the other characters, such as separators, are
+kept as is. The "alphabet" is the set of the characters to encode.
+
+The builtin templates "builtin/creditcardnumber" and
+"builtin/socialsecuritynumber" can be used by transformations, but cannot be
+modified.
+`
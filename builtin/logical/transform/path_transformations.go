@@ -0,0 +1,266 @@
+package transform
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	transformationTypeFPE          = "fpe"
+	transformationTypeTokenization = "tokenization"
+
+	// The tweak of FF3-1 is supplied with each request, or generated along
+	// with the transformation
+	tweakSourceSupplied = "supplied"
+	tweakSourceInternal = "internal"
+
+	// The tokens of convertible transformations can be decoded, while the
+	// tokens of irreversible ones cannot
+	tokenizationModeConvertible  = "convertible"
+	tokenizationModeIrreversible = "irreversible"
+)
+
+func pathListTransformations(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "transformation/?$",
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathTransformationList,
+		},
+		HelpSynopsis:    pathTransformationHelpSyn,
+		HelpDescription: pathTransformationHelpDesc,
+	}
+}
+
+func pathTransformations(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "transformation/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the transformation.",
+			},
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     transformationTypeFPE,
+				Description: `Type of the transformation, "fpe" or "tokenization". Defaults to "fpe".`,
+			},
+			"template": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the template of the values.",
+			},
+			"tweak_source": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: tweakSourceSupplied,
+				Description: `Source of the tweak of "fpe" transformations:
+"supplied" with each request, or "internal" to the transformation. Defaults
+to "supplied".`,
+			},
+			"mode": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: tokenizationModeConvertible,
+				Description: `Mode of "tokenization" transformations:
+"convertible" tokens can be decoded, "irreversible" ones cannot. Defaults to
+"convertible".`,
+			},
+		},
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTransformationRead,
+			logical.UpdateOperation: b.pathTransformationUpdate,
+			logical.DeleteOperation: b.pathTransformationDelete,
+		},
+		HelpSynopsis:    pathTransformationHelpSyn,
+		HelpDescription: pathTransformationHelpDesc,
+	}
+}
+
+// Transformation returns the named transformation
+func (b *backend) Transformation(s logical.Storage, n string) (*transformationEntry, error) {
+	entry, err := s.Get("transformation/" + n)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result transformationEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (b *backend) pathTransformationList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	transformations, err := req.Storage.List("transformation/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(transformations), nil
+}
+
+func (b *backend) pathTransformationRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	t, err := b.Transformation(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"type":     t.Type,
+			"template": t.TemplateName,
+		},
+	}
+	switch t.Type {
+	case transformationTypeFPE:
+		resp.Data["tweak_source"] = t.TweakSource
+	case transformationTypeTokenization:
+		resp.Data["mode"] = t.Mode
+	}
+	return resp, nil
+}
+
+func (b *backend) pathTransformationUpdate(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	// The key of a transformation cannot change, or the values it encoded
+	// could not be decoded anymore
+	existing, err := b.Transformation(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return logical.ErrorResponse(fmt.Sprintf("transformation %s already exists", name)), nil
+	}
+
+	templateName := d.Get("template").(string)
+	if templateName == "" {
+		return logical.ErrorResponse("missing template"), nil
+	}
+	template, err := b.Template(req.Storage, templateName)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return logical.ErrorResponse(fmt.Sprintf("template %s not found", templateName)), nil
+	}
+
+	t := &transformationEntry{
+		Type:         d.Get("type").(string),
+		TemplateName: templateName,
+		Template:     template,
+		Key:          make([]byte, 32),
+	}
+	if _, err := rand.Read(t.Key); err != nil {
+		return nil, err
+	}
+
+	switch t.Type {
+	case transformationTypeFPE:
+		t.TweakSource = d.Get("tweak_source").(string)
+		switch t.TweakSource {
+		case tweakSourceSupplied:
+		case tweakSourceInternal:
+			t.Tweak = make([]byte, ff3TweakSize)
+			if _, err := rand.Read(t.Tweak); err != nil {
+				return nil, err
+			}
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("invalid tweak source %q", t.TweakSource)), nil
+		}
+		if _, err := newFF3(t.Key, template.radix()); err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+	case transformationTypeTokenization:
+		t.Mode = d.Get("mode").(string)
+		switch t.Mode {
+		case tokenizationModeConvertible, tokenizationModeIrreversible:
+		default:
+			return logical.ErrorResponse(fmt.Sprintf("invalid mode %q", t.Mode)), nil
+		}
+
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid type %q", t.Type)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("transformation/"+name, t)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.Storage.Put(entry); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathTransformationDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	// Delete the tokens of the transformation along with it
+	tokens, err := req.Storage.List(tokensPrefix(name))
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if err := req.Storage.Delete(tokensPrefix(name) + token); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, req.Storage.Delete("transformation/" + name)
+}
+
+// transformationEntry encodes values of the format of its template
+type transformationEntry struct {
+	Type string `json:"type"`
+
+	// The template is copied into the transformation, so that the values it
+	// encoded can be decoded even if the template changes
+	TemplateName string         `json:"template_name"`
+	Template     *templateEntry `json:"template"`
+
+	// The FF3-1 key of "fpe" transformations, or the HMAC key deriving the
+	// tokens of "irreversible" ones
+	Key []byte `json:"key"`
+
+	TweakSource string `json:"tweak_source,omitempty"`
+	Tweak       []byte `json:"tweak,omitempty"`
+
+	Mode string `json:"mode,omitempty"`
+}
+
+const pathTransformationHelpSyn = `
+Manage the transformations encoding values.
+`
+
+const pathTransformationHelpDesc = `
+This path lets you manage the transformations of the backend, which encode
+values of the format of their "template".
+
+"fpe" transformations encrypt the values with the FF3-1 format-preserving
+encryption mode. Its tweak is either "supplied" with each request, as a
+base64-encoded 7-byte value, or "internal" to the transformation.
+
+"tokenization" transformations replace the values with random tokens of the
+same format. The tokens of "convertible" transformations are stored along
+with their values, so that they can be decoded. The tokens of "irreversible"
+ones are derived from the values, which are not stored: the same value always
+gets the same token, which cannot be decoded.
+
+Transformations cannot be modified once created, since the values they
+encoded could not be decoded anymore. Deleting a transformation deletes its
+tokens.
+`
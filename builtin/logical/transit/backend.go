@@ -1,6 +1,13 @@
 package transit
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -18,19 +25,38 @@ func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
 func Backend(conf *logical.BackendConfig) *backend {
 	var b backend
 	b.Backend = &framework.Backend{
+		PathsSpecial: &logical.Paths{
+			// Exporting and backing up keys requires sudo
+			Root: []string{
+				"export/*",
+				"backup/*",
+			},
+		},
+
 		Paths: []*framework.Path{
 			// Rotate/Config needs to come before Keys
 			// as the handler is greedy
 			b.pathConfig(),
 			b.pathRotate(),
+			b.pathImport(),
+			b.pathImportVersion(),
 			b.pathRewrap(),
 			b.pathKeys(),
 			b.pathEncrypt(),
 			b.pathDecrypt(),
 			b.pathDatakey(),
+			b.pathSign(),
+			b.pathVerify(),
+			b.pathHMAC(),
+			b.pathExportKeys(),
+			b.pathBackup(),
+			b.pathRestore(),
+			b.pathWrappingKey(),
 		},
 
 		Secrets: []*framework.Secret{},
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.lm = newLockManager(conf.System.CachingDisabled())
@@ -41,4 +67,58 @@ func Backend(conf *logical.BackendConfig) *backend {
 type backend struct {
 	*framework.Backend
 	lm *lockManager
+
+	// Guards the generation of the wrapping key of imported keys
+	wrappingKeyLock sync.Mutex
+}
+
+// periodicFunc of the backend will be invoked once a minute by the
+// RollbackManager. It rotates the keys whose auto-rotate period has elapsed.
+func (b *backend) periodicFunc(req *logical.Request) error {
+	names, err := req.Storage.List("policy/")
+	if err != nil {
+		return err
+	}
+
+	var result error
+	for _, name := range names {
+		if err := b.autoRotateKey(req.Storage, name); err != nil {
+			result = multierror.Append(result, errwrap.Wrapf(
+				fmt.Sprintf("failed to rotate key %s: {{err}}", name), err))
+		}
+	}
+	return result
+}
+
+// autoRotateKey rotates the named key if it is due
+func (b *backend) autoRotateKey(storage logical.Storage, name string) error {
+	// Check with a shared lock first, as most keys are not due
+	p, lock, err := b.lm.GetPolicyShared(storage, name)
+	if lock != nil {
+		lock.RUnlock()
+	}
+	if err != nil {
+		return err
+	}
+	if p == nil || !p.autoRotateDue(time.Now()) {
+		return nil
+	}
+
+	p, lock, err = b.lm.GetPolicyExclusive(storage, name)
+	if lock != nil {
+		defer lock.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	if p == nil || !p.autoRotateDue(time.Now()) {
+		return nil
+	}
+
+	if err := p.rotate(storage); err != nil {
+		return err
+	}
+	metrics.IncrCounter([]string{"transit", "auto_rotate"}, 1)
+	b.Logger().Printf("[INFO] transit: automatically rotated key %s to version %d", name, p.LatestVersion)
+	return nil
 }
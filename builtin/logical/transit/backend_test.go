@@ -1,19 +1,33 @@
 package transit
 
 import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	crand "crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/helper/keywrap"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 	logicaltest "github.com/hashicorp/vault/logical/testing"
 	"github.com/mitchellh/mapstructure"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 const (
@@ -254,7 +268,7 @@ func testAccStepReadPolicy(t *testing.T, name string, expectNone, derived bool)
 			if d.Derived != derived {
 				return fmt.Errorf("bad: %#v", d)
 			}
-			if derived && d.KDFMode != kdfMode {
+			if derived && d.KDFMode != kdfModeHKDF {
 				return fmt.Errorf("bad: %#v", d)
 			}
 			return nil
@@ -592,6 +606,18 @@ func TestConvergentEncryption(t *testing.T) {
 		t.Fatalf("bad: got resp %#v", *resp)
 	}
 
+	// Keys created before nonces were derived require them to be supplied
+	p, lock, err := b.lm.GetPolicyExclusive(storage, "testkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ConvergentVersion = 1
+	err = p.Persist(storage)
+	lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// First, test using an invalid length of nonce
 	req.Path = "encrypt/testkey"
 	req.Data = map[string]interface{}{
@@ -711,6 +737,1182 @@ func TestConvergentEncryption(t *testing.T) {
 	}
 }
 
+func TestConvergentEncryption_derivedNonce(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/testkey",
+		Data: map[string]interface{}{
+			"derived":               true,
+			"convergent_encryption": true,
+		},
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/testkey",
+	})
+	if err != nil || resp.Data["convergent_encryption_version"] != 2 {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	encrypt := func(plaintext, context string) string {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      "encrypt/testkey",
+			Data: map[string]interface{}{
+				"plaintext": plaintext,
+				"context":   context,
+			},
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+		return resp.Data["ciphertext"].(string)
+	}
+
+	// The same plaintext and context produce the same ciphertext, without
+	// a nonce being supplied
+	ciphertext1 := encrypt("emlwIHphcA==", "Y29udGV4dDE=")
+	if ciphertext2 := encrypt("emlwIHphcA==", "Y29udGV4dDE="); ciphertext1 != ciphertext2 {
+		t.Fatalf("expected the same ciphertext but got %s and %s", ciphertext1, ciphertext2)
+	}
+	if ciphertext3 := encrypt("emlwIHphcA==", "Y29udGV4dDI="); ciphertext1 == ciphertext3 {
+		t.Fatalf("expected different ciphertexts")
+	}
+	if ciphertext4 := encrypt("Zm9vIGJhcg==", "Y29udGV4dDE="); ciphertext1 == ciphertext4 {
+		t.Fatalf("expected different ciphertexts")
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "decrypt/testkey",
+		Data: map[string]interface{}{
+			"ciphertext": ciphertext1,
+			"context":    "Y29udGV4dDE=",
+		},
+	})
+	if err != nil || resp == nil || resp.Data["plaintext"] != "emlwIHphcA==" {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_signVerify(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+	digest := sha512.Sum384([]byte(testPlaintext))
+	prehashed := base64.StdEncoding.EncodeToString(digest[:])
+
+	for _, keyType := range []string{"ecdsa-p256", "ecdsa-p384", "ecdsa-p521", "ed25519", "rsa-2048"} {
+		if resp, err := request(logical.UpdateOperation, "keys/"+keyType, map[string]interface{}{
+			"type": keyType,
+		}); err != nil || resp != nil {
+			t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+		}
+
+		resp, err := request(logical.ReadOperation, "keys/"+keyType, nil)
+		if err != nil || resp.Data["type"] != keyType || resp.Data["supports_signing"] != true {
+			t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+		}
+		keys := resp.Data["keys"].(map[string]map[string]interface{})
+		if keys["1"]["public_key"] == "" {
+			t.Fatalf("%s: bad: %#v", keyType, keys)
+		}
+
+		// Signing keys other than RSA keys cannot encrypt
+		if keyType != "rsa-2048" {
+			resp, err = request(logical.UpdateOperation, "encrypt/"+keyType, map[string]interface{}{
+				"plaintext": input,
+			})
+			if err != logical.ErrInvalidRequest || !resp.IsError() {
+				t.Fatalf("%s: expected error: %#v %v", keyType, resp, err)
+			}
+		}
+
+		sign := map[string]interface{}{
+			"input": input,
+		}
+		signatureAlgorithms := []string{""}
+		switch keyType {
+		case "ed25519":
+		case "rsa-2048":
+			signatureAlgorithms = []string{"pss", "pkcs1v15"}
+			fallthrough
+		default:
+			sign = map[string]interface{}{
+				"input":          prehashed,
+				"prehashed":      true,
+				"hash_algorithm": "sha2-384",
+			}
+		}
+
+		for _, signatureAlgorithm := range signatureAlgorithms {
+			data := map[string]interface{}{
+				"signature_algorithm": signatureAlgorithm,
+			}
+			for k, v := range sign {
+				data[k] = v
+			}
+			resp, err = request(logical.UpdateOperation, "sign/"+keyType, data)
+			if err != nil || resp.IsError() {
+				t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+			}
+			signature := resp.Data["signature"].(string)
+			if !strings.HasPrefix(signature, "vault:v1:") {
+				t.Fatalf("%s: bad: %s", keyType, signature)
+			}
+
+			// The prehashed signatures verify the input itself
+			verify := map[string]interface{}{
+				"input":               input,
+				"signature":           signature,
+				"signature_algorithm": signatureAlgorithm,
+			}
+			if keyType != "ed25519" {
+				verify["hash_algorithm"] = "sha2-384"
+			}
+			resp, err = request(logical.UpdateOperation, "verify/"+keyType, verify)
+			if err != nil || resp.Data["valid"] != true {
+				t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+			}
+
+			verify["input"] = base64.StdEncoding.EncodeToString([]byte("tampered"))
+			resp, err = request(logical.UpdateOperation, "verify/"+keyType, verify)
+			if err != nil || resp.Data["valid"] != false {
+				t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+			}
+		}
+
+		// Signatures of past versions verify after rotation
+		resp, err = request(logical.UpdateOperation, "sign/"+keyType, map[string]interface{}{
+			"input": input,
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+		}
+		signature := resp.Data["signature"].(string)
+		if _, err := request(logical.UpdateOperation, "keys/"+keyType+"/rotate", nil); err != nil {
+			t.Fatal(err)
+		}
+		resp, err = request(logical.UpdateOperation, "verify/"+keyType, map[string]interface{}{
+			"input":     input,
+			"signature": signature,
+		})
+		if err != nil || resp.Data["valid"] != true {
+			t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+		}
+	}
+
+	// Ed25519 keys sign their input, which cannot be prehashed
+	resp, err := request(logical.UpdateOperation, "sign/ed25519", map[string]interface{}{
+		"input":     prehashed,
+		"prehashed": true,
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// Encryption keys cannot sign
+	request(logical.UpdateOperation, "keys/aes", nil)
+	resp, err = request(logical.UpdateOperation, "sign/aes", map[string]interface{}{
+		"input": input,
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// Derivation is only supported by encryption keys
+	resp, err = request(logical.UpdateOperation, "keys/derived", map[string]interface{}{
+		"type":    "ed25519",
+		"derived": true,
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_rsaEncryption(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	if _, err := request("keys/rsa", map[string]interface{}{
+		"type":       "rsa-2048",
+		"exportable": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/rsa",
+	})
+	if err != nil || resp.Data["supports_encryption"] != true || resp.Data["supports_signing"] != true {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+	resp, err = request("encrypt/rsa", map[string]interface{}{
+		"plaintext": input,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("bad: %s", ciphertext)
+	}
+
+	// The plaintext must fit in a single RSA-OAEP block
+	resp, err = request("encrypt/rsa", map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(make([]byte, 256)),
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// The exported private key decrypts the ciphertext
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "export/encryption-key/rsa/1",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	block, _ := pem.Decode([]byte(resp.Data["keys"].(map[string]string)["1"]))
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "vault:v1:"))
+	plaintext, err := rsa.DecryptOAEP(sha256.New(), nil, key, decoded, nil)
+	if err != nil || string(plaintext) != testPlaintext {
+		t.Fatalf("bad: %q %v", plaintext, err)
+	}
+
+	// Ciphertexts are rewrapped with the latest version
+	if _, err := request("keys/rsa/rotate", nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request("rewrap/rsa", map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	rewrapped := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(rewrapped, "vault:v2:") {
+		t.Fatalf("bad: %s", rewrapped)
+	}
+
+	for _, ciphertext := range []string{ciphertext, rewrapped} {
+		resp, err = request("decrypt/rsa", map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+		if err != nil || resp.IsError() || resp.Data["plaintext"] != input {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+	resp, err = request("decrypt/rsa", map[string]interface{}{
+		"ciphertext": rewrapped[:len(rewrapped)-4] + "AAA=",
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_chacha20Poly1305(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	if _, err := request("keys/chacha", map[string]interface{}{
+		"type":       "chacha20-poly1305",
+		"exportable": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/chacha",
+	})
+	if err != nil || resp.Data["type"] != "chacha20-poly1305" ||
+		resp.Data["supports_encryption"] != true || resp.Data["supports_signing"] != false {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+	resp, err = request("encrypt/chacha", map[string]interface{}{
+		"plaintext": input,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(ciphertext, "vault:v1:") {
+		t.Fatalf("bad: %s", ciphertext)
+	}
+
+	// The exported key decrypts the ciphertext, which starts with its nonce
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "export/encryption-key/chacha/1",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	key, _ := base64.StdEncoding.DecodeString(resp.Data["keys"].(map[string]string)["1"])
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "vault:v1:"))
+	plaintext, err := aead.Open(nil, decoded[:aead.NonceSize()], decoded[aead.NonceSize():], nil)
+	if err != nil || string(plaintext) != testPlaintext {
+		t.Fatalf("bad: %q %v", plaintext, err)
+	}
+
+	// After a rotation, new ciphertexts use the latest version, and older
+	// ones still decrypt
+	if _, err := request("keys/chacha/rotate", nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request("encrypt/chacha", map[string]interface{}{
+		"plaintext": input,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	latest := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(latest, "vault:v2:") {
+		t.Fatalf("bad: %s", latest)
+	}
+	resp, err = request("rewrap/chacha", map[string]interface{}{
+		"ciphertext": ciphertext,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	rewrapped := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(rewrapped, "vault:v2:") {
+		t.Fatalf("bad: %s", rewrapped)
+	}
+
+	for _, ciphertext := range []string{ciphertext, latest, rewrapped} {
+		resp, err = request("decrypt/chacha", map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+		if err != nil || resp.IsError() || resp.Data["plaintext"] != input {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+	resp, err = request("decrypt/chacha", map[string]interface{}{
+		"ciphertext": latest[:len(latest)-4] + "AAA=",
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// Derived keys encrypt with the key of each context, convergently if
+	// requested
+	if _, err := request("keys/chacha-derived", map[string]interface{}{
+		"type":                  "chacha20-poly1305",
+		"derived":               true,
+		"convergent_encryption": true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	context := base64.StdEncoding.EncodeToString([]byte("tenant"))
+	var ciphertexts []string
+	for i := 0; i < 2; i++ {
+		resp, err = request("encrypt/chacha-derived", map[string]interface{}{
+			"plaintext": input,
+			"context":   context,
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+		ciphertexts = append(ciphertexts, resp.Data["ciphertext"].(string))
+	}
+	if ciphertexts[0] != ciphertexts[1] {
+		t.Fatalf("bad: %v", ciphertexts)
+	}
+	resp, err = request("decrypt/chacha-derived", map[string]interface{}{
+		"ciphertext": ciphertexts[0],
+		"context":    context,
+	})
+	if err != nil || resp.IsError() || resp.Data["plaintext"] != input {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_hmac(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+	for _, keyType := range []string{"aes256-gcm96", "ed25519"} {
+		request("keys/"+keyType, map[string]interface{}{
+			"type": keyType,
+		})
+
+		resp, err := request("hmac/"+keyType, map[string]interface{}{
+			"input":     input,
+			"algorithm": "sha2-512",
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+		}
+		hmac1 := resp.Data["hmac"].(string)
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(hmac1, "vault:v1:"))
+		if err != nil || len(decoded) != 64 {
+			t.Fatalf("%s: bad: %s", keyType, hmac1)
+		}
+
+		// HMACs are deterministic
+		resp, _ = request("hmac/"+keyType, map[string]interface{}{
+			"input":     input,
+			"algorithm": "sha2-512",
+		})
+		if resp.Data["hmac"] != hmac1 {
+			t.Fatalf("%s: bad: %#v", keyType, resp.Data)
+		}
+
+		// After rotation, HMACs are computed with the latest version, and
+		// past versions can still be selected and verified
+		request("keys/"+keyType+"/rotate", nil)
+		resp, _ = request("hmac/"+keyType, map[string]interface{}{
+			"input":     input,
+			"algorithm": "sha2-512",
+		})
+		hmac2 := resp.Data["hmac"].(string)
+		if !strings.HasPrefix(hmac2, "vault:v2:") {
+			t.Fatalf("%s: bad: %s", keyType, hmac2)
+		}
+		resp, _ = request("hmac/"+keyType, map[string]interface{}{
+			"input":       input,
+			"algorithm":   "sha2-512",
+			"key_version": 1,
+		})
+		if resp.Data["hmac"] != hmac1 {
+			t.Fatalf("%s: bad: %#v", keyType, resp.Data)
+		}
+
+		for _, hmacValue := range []string{hmac1, hmac2} {
+			resp, err = request("verify/"+keyType, map[string]interface{}{
+				"input":          input,
+				"hmac":           hmacValue,
+				"hash_algorithm": "sha2-512",
+			})
+			if err != nil || resp.Data["valid"] != true {
+				t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+			}
+		}
+		resp, err = request("verify/"+keyType, map[string]interface{}{
+			"input": input,
+			"hmac":  hmac1,
+		})
+		if err != nil || resp.Data["valid"] != false {
+			t.Fatalf("%s: bad: %#v %v", keyType, resp, err)
+		}
+	}
+
+	resp, err := request("hmac/aes256-gcm96", map[string]interface{}{
+		"input":     input,
+		"algorithm": "md5",
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_rewrap(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+	rewrap := func(ciphertext string) (*logical.Response, error) {
+		return request("rewrap/test", map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+	}
+
+	if _, err := request("keys/test", nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := request("encrypt/test", map[string]interface{}{
+		"plaintext": "Zm9vIGJhcg==",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	// Ciphertext of the latest version is unchanged, but still authenticated
+	resp, err = rewrap(ciphertext)
+	if err != nil || resp.IsError() || resp.Data["ciphertext"] != ciphertext {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp, err = rewrap(ciphertext[:len(ciphertext)-4] + "AAA=")
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	if _, err := request("keys/test/rotate", nil); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = rewrap(ciphertext)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	rewrapped := resp.Data["ciphertext"].(string)
+	if !strings.HasPrefix(rewrapped, "vault:v2:") {
+		t.Fatalf("bad: %s", rewrapped)
+	}
+	resp, err = rewrap(rewrapped)
+	if err != nil || resp.IsError() || resp.Data["ciphertext"] != rewrapped {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	resp, err = request("decrypt/test", map[string]interface{}{
+		"ciphertext": rewrapped,
+	})
+	if err != nil || resp.IsError() || resp.Data["plaintext"] != "Zm9vIGJhcg==" {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_autoRotate(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	request(logical.UpdateOperation, "keys/manual", nil)
+	request(logical.UpdateOperation, "keys/auto", nil)
+	resp, err := request(logical.UpdateOperation, "keys/auto/config", map[string]interface{}{
+		"auto_rotate_period": "10m",
+	})
+	if err != nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	resp, err = request(logical.UpdateOperation, "keys/auto/config", map[string]interface{}{
+		"auto_rotate_period":       "24h",
+		"keep_decryption_versions": 2,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp, err = request(logical.ReadOperation, "keys/auto", nil)
+	if err != nil || resp.Data["auto_rotate_period"] != int64(86400) || resp.Data["keep_decryption_versions"] != 2 {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Age the latest version of both keys
+	age := func(name string) {
+		p, lock, err := b.lm.GetPolicyExclusive(storage, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Unlock()
+		entry := p.Keys[p.LatestVersion]
+		entry.CreationTime -= 2 * 86400
+		p.Keys[p.LatestVersion] = entry
+		if err := p.Persist(storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	version := func(name string) (int, int) {
+		resp, err := request(logical.ReadOperation, "keys/"+name, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data["latest_version"].(int), resp.Data["min_decryption_version"].(int)
+	}
+
+	for i := 2; i <= 4; i++ {
+		age("auto")
+		age("manual")
+		if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+		if latest, min := version("auto"); latest != i || min != i-1 {
+			t.Fatalf("bad: %d %d", latest, min)
+		}
+		if latest, _ := version("manual"); latest != 1 {
+			t.Fatalf("bad: %d", latest)
+		}
+	}
+
+	// Keys are not rotated again before their period elapses
+	if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+		t.Fatal(err)
+	}
+	if latest, _ := version("auto"); latest != 4 {
+		t.Fatalf("bad: %d", latest)
+	}
+}
+
+func TestBackend_import(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	resp, err := request(logical.ReadOperation, "wrapping_key", nil)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	block, _ := pem.Decode([]byte(resp.Data["public_key"].(string)))
+	wrappingKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrap := func(keyMaterial []byte) string {
+		ephemeralKey := make([]byte, 32)
+		if _, err := crand.Read(ephemeralKey); err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := rsa.EncryptOAEP(sha256.New(), crand.Reader, wrappingKey.(*rsa.PublicKey), ephemeralKey, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wrapped, err := keywrap.Wrap(ephemeralKey, keyMaterial)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(append(encrypted, wrapped...))
+	}
+	// decryptLocally checks that the ciphertext was encrypted with the key
+	decryptLocally := func(key []byte, ciphertext string) {
+		decoded, _ := base64.StdEncoding.DecodeString(ciphertext[len("vault:v1:"):])
+		aesCipher, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gcm, _ := cipher.NewGCM(aesCipher)
+		plaintext, err := gcm.Open(nil, decoded[:gcm.NonceSize()], decoded[gcm.NonceSize():], nil)
+		if err != nil || string(plaintext) != "foo bar" {
+			t.Fatalf("bad: %q %v", plaintext, err)
+		}
+	}
+	encrypt := func() string {
+		resp, err := request(logical.UpdateOperation, "encrypt/aes", map[string]interface{}{
+			"plaintext": "Zm9vIGJhcg==",
+		})
+		if err != nil || resp.IsError() {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+		return resp.Data["ciphertext"].(string)
+	}
+
+	aesKey := bytes.Repeat([]byte{1}, 32)
+	resp, err = request(logical.UpdateOperation, "keys/aes/import", map[string]interface{}{
+		"ciphertext": wrap(aesKey),
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	decryptLocally(aesKey, encrypt())
+
+	// Existing keys get new versions imported instead
+	resp, err = request(logical.UpdateOperation, "keys/aes/import", map[string]interface{}{
+		"ciphertext": wrap(aesKey),
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	newAESKey := bytes.Repeat([]byte{2}, 32)
+	resp, err = request(logical.UpdateOperation, "keys/aes/import_version", map[string]interface{}{
+		"ciphertext": wrap(newAESKey),
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	ciphertext := encrypt()
+	if !strings.HasPrefix(ciphertext, "vault:v2:") {
+		t.Fatalf("bad: %s", ciphertext)
+	}
+	decryptLocally(newAESKey, ciphertext)
+
+	// Invalid key material is rejected
+	for _, keyMaterial := range [][]byte{make([]byte, 16), []byte("not a key")} {
+		resp, err = request(logical.UpdateOperation, "keys/aes/import_version", map[string]interface{}{
+			"ciphertext": wrap(keyMaterial),
+		})
+		if err != logical.ErrInvalidRequest || !resp.IsError() {
+			t.Fatalf("expected error: %#v %v", resp, err)
+		}
+	}
+	tampered, _ := base64.StdEncoding.DecodeString(wrap(aesKey))
+	tampered[len(tampered)-1] ^= 1
+	resp, err = request(logical.UpdateOperation, "keys/aes/import_version", map[string]interface{}{
+		"ciphertext": base64.StdEncoding.EncodeToString(tampered),
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// Asymmetric keys are imported as PKCS #8 private keys
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), crand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = request(logical.UpdateOperation, "keys/ecdsa/import", map[string]interface{}{
+		"ciphertext": wrap(der),
+		"type":       "ecdsa-p384",
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	resp, err = request(logical.UpdateOperation, "keys/ecdsa/import", map[string]interface{}{
+		"ciphertext": wrap(der),
+		"type":       "ecdsa-p256",
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp, err = request(logical.ReadOperation, "keys/ecdsa", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	publicKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+	if keys := resp.Data["keys"].(map[string]map[string]interface{}); keys["1"]["public_key"] != publicKey {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
+func TestBackend_batch(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil || resp == nil || resp.IsError() {
+			t.Fatalf("bad: %s: %#v %v", path, resp, err)
+		}
+		return resp
+	}
+
+	plaintexts := []string{"Zm9v", "YmFy", "YmF6"}
+
+	// Batch encryption upserts the key, derived if an item has a context
+	resp := request(logical.CreateOperation, "encrypt/derived", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"plaintext": plaintexts[0], "context": "Y29udGV4dDE="},
+			map[string]interface{}{"plaintext": plaintexts[1], "context": "Y29udGV4dDI="},
+			map[string]interface{}{"plaintext": plaintexts[2], "context": "not base64"},
+			map[string]interface{}{"plaintext": plaintexts[2]},
+		},
+	})
+	results := resp.Data["batch_results"].([]BatchResponseItem)
+	if len(results) != 4 || results[0].Ciphertext == "" || results[1].Ciphertext == "" ||
+		results[2].Error != "failed to base64-decode context" || results[3].Error == "" {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	if _, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/derived/rotate",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp = request(logical.UpdateOperation, "rewrap/derived", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"ciphertext": results[0].Ciphertext, "context": "Y29udGV4dDE="},
+			map[string]interface{}{"ciphertext": results[1].Ciphertext, "context": "Y29udGV4dDI="},
+		},
+	})
+	rewrapped := resp.Data["batch_results"].([]BatchResponseItem)
+	for _, result := range rewrapped {
+		if !strings.HasPrefix(result.Ciphertext, "vault:v2:") {
+			t.Fatalf("bad: %#v", rewrapped)
+		}
+	}
+
+	// Items are decrypted independently of each other
+	resp = request(logical.UpdateOperation, "decrypt/derived", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"ciphertext": rewrapped[0].Ciphertext, "context": "Y29udGV4dDE="},
+			map[string]interface{}{"ciphertext": rewrapped[1].Ciphertext, "context": "Y29udGV4dDE="},
+			map[string]interface{}{"ciphertext": results[1].Ciphertext, "context": "Y29udGV4dDI="},
+		},
+	})
+	decrypted := resp.Data["batch_results"].([]BatchResponseItem)
+	if decrypted[0].Plaintext != plaintexts[0] || decrypted[1].Error == "" || decrypted[2].Plaintext != plaintexts[1] {
+		t.Fatalf("bad: %#v", decrypted)
+	}
+
+	if _, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "keys/signing",
+		Data: map[string]interface{}{
+			"type": "ecdsa-p256",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	resp = request(logical.UpdateOperation, "sign/signing", map[string]interface{}{
+		"batch_input": []interface{}{
+			map[string]interface{}{"input": plaintexts[0]},
+			map[string]interface{}{"input": ""},
+		},
+	})
+	signed := resp.Data["batch_results"].([]BatchResponseItem)
+	if signed[0].Signature == "" || signed[1].Error != "missing input" {
+		t.Fatalf("bad: %#v", signed)
+	}
+	resp = request(logical.UpdateOperation, "verify/signing", map[string]interface{}{
+		"input":     plaintexts[0],
+		"signature": signed[0].Signature,
+	})
+	if resp.Data["valid"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.UpdateOperation,
+		Path:      "encrypt/derived",
+		Data: map[string]interface{}{
+			"batch_input": []interface{}{},
+		},
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+}
+
+func TestBackend_export(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	if !reflect.DeepEqual(b.SpecialPaths().Root, []string{"export/*", "backup/*"}) {
+		t.Fatalf("bad: %#v", b.SpecialPaths())
+	}
+
+	request(logical.UpdateOperation, "keys/private", nil)
+	resp, err := request(logical.ReadOperation, "export/encryption-key/private", nil)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	request(logical.UpdateOperation, "keys/aes", map[string]interface{}{
+		"exportable": true,
+	})
+	request(logical.UpdateOperation, "keys/aes/rotate", nil)
+	resp, err = request(logical.UpdateOperation, "encrypt/aes", map[string]interface{}{
+		"plaintext": "Zm9vIGJhcg==",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	resp, err = request(logical.ReadOperation, "export/encryption-key/aes", nil)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	keys := resp.Data["keys"].(map[string]string)
+	if len(keys) != 2 {
+		t.Fatalf("bad: %#v", keys)
+	}
+
+	// The exported key decrypts the ciphertexts of its version
+	key, _ := base64.StdEncoding.DecodeString(keys["2"])
+	decoded, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, "vault:v2:"))
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, _ := cipher.NewGCM(aesCipher)
+	plaintext, err := gcm.Open(nil, decoded[:gcm.NonceSize()], decoded[gcm.NonceSize():], nil)
+	if err != nil || string(plaintext) != "foo bar" {
+		t.Fatalf("bad: %q %v", plaintext, err)
+	}
+
+	for _, path := range []string{"export/hmac-key/aes/latest", "export/hmac-key/aes/2"} {
+		resp, err = request(logical.ReadOperation, path, nil)
+		if err != nil || resp.IsError() || len(resp.Data["keys"].(map[string]string)["2"]) == 0 {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+	for _, path := range []string{"export/signing-key/aes", "export/hmac-key/aes/3", "export/private-key/aes"} {
+		resp, err = request(logical.ReadOperation, path, nil)
+		if err != logical.ErrInvalidRequest || !resp.IsError() {
+			t.Fatalf("%s: expected error: %#v %v", path, resp, err)
+		}
+	}
+
+	request(logical.UpdateOperation, "keys/ecdsa", map[string]interface{}{
+		"type":       "ecdsa-p384",
+		"exportable": true,
+	})
+	resp, err = request(logical.ReadOperation, "export/signing-key/ecdsa/1", nil)
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	block, _ := pem.Decode([]byte(resp.Data["keys"].(map[string]string)["1"]))
+	if block == nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, err := x509.ParseECPrivateKey(block.Bytes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBackend_backupRestore(t *testing.T) {
+	newBackend := func() (logical.Backend, logical.Storage) {
+		storage := &logical.InmemStorage{}
+		return Backend(&logical.BackendConfig{
+			StorageView: storage,
+			System:      logical.TestSystemView(),
+		}), storage
+	}
+	request := func(b logical.Backend, storage logical.Storage, path string, data map[string]interface{}) (*logical.Response, error) {
+		return b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+	}
+
+	b, storage := newBackend()
+	request(b, storage, "keys/test", nil)
+	resp, err := request(b, storage, "encrypt/test", map[string]interface{}{
+		"plaintext": "Zm9vIGJhcg==",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	oldCiphertext := resp.Data["ciphertext"].(string)
+	request(b, storage, "keys/test/rotate", nil)
+	request(b, storage, "keys/test/rotate", nil)
+	request(b, storage, "keys/test/config", map[string]interface{}{
+		"min_decryption_version": 2,
+	})
+	resp, err = request(b, storage, "encrypt/test", map[string]interface{}{
+		"plaintext": "Zm9vIGJhcg==",
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	ciphertext := resp.Data["ciphertext"].(string)
+
+	backupKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	resp, err = request(b, storage, "backup/test", map[string]interface{}{
+		"backup_key": base64.StdEncoding.EncodeToString(make([]byte, 16)),
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	resp, err = request(b, storage, "backup/test", map[string]interface{}{
+		"backup_key": backupKey,
+	})
+	if err != nil || resp.IsError() {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	backup := resp.Data["backup"].(string)
+	if !strings.HasPrefix(backup, "vault:backup:v1:") {
+		t.Fatalf("bad: %s", backup)
+	}
+
+	// Restore on another backend
+	b, storage = newBackend()
+	resp, err = request(b, storage, "restore", map[string]interface{}{
+		"backup":     backup,
+		"backup_key": base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)),
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	resp, err = request(b, storage, "restore", map[string]interface{}{
+		"backup":     backup,
+		"backup_key": backupKey,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	decrypt := func(name, ciphertext string) (*logical.Response, error) {
+		return request(b, storage, "decrypt/"+name, map[string]interface{}{
+			"ciphertext": ciphertext,
+		})
+	}
+	resp, err = decrypt("test", ciphertext)
+	if err != nil || resp.IsError() || resp.Data["plaintext"] != "Zm9vIGJhcg==" {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp, err = decrypt("test", oldCiphertext)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// The archived versions are restored
+	request(b, storage, "keys/test/config", map[string]interface{}{
+		"min_decryption_version": 1,
+	})
+	resp, err = decrypt("test", oldCiphertext)
+	if err != nil || resp.IsError() || resp.Data["plaintext"] != "Zm9vIGJhcg==" {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Existing keys are only overwritten if forced
+	resp, err = request(b, storage, "restore", map[string]interface{}{
+		"backup":     backup,
+		"backup_key": backupKey,
+	})
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+	resp, err = request(b, storage, "restore", map[string]interface{}{
+		"backup":     backup,
+		"backup_key": backupKey,
+		"force":      true,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp, err = decrypt("test", oldCiphertext)
+	if err != logical.ErrInvalidRequest || !resp.IsError() {
+		t.Fatalf("expected error: %#v %v", resp, err)
+	}
+
+	// Keys can be restored under another name
+	resp, err = request(b, storage, "restore/renamed", map[string]interface{}{
+		"backup":     backup,
+		"backup_key": backupKey,
+	})
+	if err != nil || resp != nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	resp, err = decrypt("renamed", ciphertext)
+	if err != nil || resp.IsError() || resp.Data["plaintext"] != "Zm9vIGJhcg==" {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+}
+
 func TestPolicyFuzzing(t *testing.T) {
 	var be *backend
 	sysView := logical.TestSystemView()
@@ -0,0 +1,77 @@
+package transit
+
+import (
+	"encoding/base64"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+// BatchRequestItem is an item of the batch_input of a request, holding the
+// parameters of one operation
+type BatchRequestItem struct {
+	Plaintext  string `mapstructure:"plaintext"`
+	Ciphertext string `mapstructure:"ciphertext"`
+	Input      string `mapstructure:"input"`
+
+	// Context and Nonce are base64 encoded, and decoded by decode
+	Context string `mapstructure:"context"`
+	Nonce   string `mapstructure:"nonce"`
+
+	context []byte
+	nonce   []byte
+}
+
+// BatchResponseItem is an item of the batch_results of a response. Error is
+// set if the operation of the item failed, in place of its result.
+type BatchResponseItem struct {
+	Ciphertext string `json:"ciphertext,omitempty" mapstructure:"ciphertext"`
+	Plaintext  string `json:"plaintext,omitempty" mapstructure:"plaintext"`
+	Signature  string `json:"signature,omitempty" mapstructure:"signature"`
+	Error      string `json:"error,omitempty" mapstructure:"error"`
+}
+
+// batchInputField is the field of the endpoints accepting batch requests
+func batchInputField(description string) *framework.FieldSchema {
+	return &framework.FieldSchema{
+		Type:        framework.TypeSlice,
+		Description: description,
+	}
+}
+
+// batchInput returns the items of a request's batch_input, and whether it was
+// given. If it was not, the request is a single item built from its fields.
+func batchInput(d *framework.FieldData, single BatchRequestItem) ([]BatchRequestItem, bool, error) {
+	raw, ok := d.GetOk("batch_input")
+	if !ok {
+		return []BatchRequestItem{single}, false, nil
+	}
+
+	var items []BatchRequestItem
+	if err := mapstructure.Decode(raw, &items); err != nil {
+		return nil, true, errutil.UserError{Err: "failed to parse batch input: " + err.Error()}
+	}
+	if len(items) == 0 {
+		return nil, true, errutil.UserError{Err: "missing batch input to process"}
+	}
+	return items, true, nil
+}
+
+// decode decodes the context and nonce of the item
+func (item *BatchRequestItem) decode() error {
+	var err error
+	if len(item.Context) != 0 {
+		item.context, err = base64.StdEncoding.DecodeString(item.Context)
+		if err != nil {
+			return errutil.UserError{Err: "failed to base64-decode context"}
+		}
+	}
+	if len(item.Nonce) != 0 {
+		item.nonce, err = base64.StdEncoding.DecodeString(item.Nonce)
+		if err != nil {
+			return errutil.UserError{Err: "failed to base64-decode nonce"}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package transit
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"fmt"
+)
+
+// KeyType is the type of the key material of a named key. Keys created before
+// types were introduced have the zero value, AES-256-GCM.
+type KeyType int
+
+const (
+	KeyTypeAES256GCM96 KeyType = iota
+	KeyTypeECDSAP256
+	KeyTypeECDSAP384
+	KeyTypeECDSAP521
+	KeyTypeEd25519
+	KeyTypeRSA2048
+	KeyTypeRSA4096
+	KeyTypeChaCha20Poly1305
+)
+
+var keyTypeNames = map[KeyType]string{
+	KeyTypeAES256GCM96:      "aes256-gcm96",
+	KeyTypeECDSAP256:        "ecdsa-p256",
+	KeyTypeECDSAP384:        "ecdsa-p384",
+	KeyTypeECDSAP521:        "ecdsa-p521",
+	KeyTypeEd25519:          "ed25519",
+	KeyTypeRSA2048:          "rsa-2048",
+	KeyTypeRSA4096:          "rsa-4096",
+	KeyTypeChaCha20Poly1305: "chacha20-poly1305",
+}
+
+// parseKeyType returns the key type of the given name
+func parseKeyType(name string) (KeyType, error) {
+	for keyType, n := range keyTypeNames {
+		if n == name {
+			return keyType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown key type %q", name)
+}
+
+func (kt KeyType) String() string {
+	if name, ok := keyTypeNames[kt]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// EncryptionSupported returns whether keys of the type can encrypt and
+// decrypt. RSA keys encrypt with RSA-OAEP.
+func (kt KeyType) EncryptionSupported() bool {
+	switch kt {
+	case KeyTypeAES256GCM96, KeyTypeChaCha20Poly1305, KeyTypeRSA2048, KeyTypeRSA4096:
+		return true
+	}
+	return false
+}
+
+// DerivationSupported returns whether keys of the type can be derived from a
+// context
+func (kt KeyType) DerivationSupported() bool {
+	return kt.symmetric()
+}
+
+// symmetric returns whether keys of the type are 256-bit symmetric keys
+// encrypting with an AEAD
+func (kt KeyType) symmetric() bool {
+	return kt == KeyTypeAES256GCM96 || kt == KeyTypeChaCha20Poly1305
+}
+
+// SigningSupported returns whether keys of the type can sign and verify
+func (kt KeyType) SigningSupported() bool {
+	switch kt {
+	case KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeECDSAP521,
+		KeyTypeEd25519, KeyTypeRSA2048, KeyTypeRSA4096:
+		return true
+	}
+	return false
+}
+
+// curve returns the elliptic curve of ECDSA key types
+func (kt KeyType) curve() elliptic.Curve {
+	switch kt {
+	case KeyTypeECDSAP256:
+		return elliptic.P256()
+	case KeyTypeECDSAP384:
+		return elliptic.P384()
+	case KeyTypeECDSAP521:
+		return elliptic.P521()
+	}
+	return nil
+}
+
+// rsaBits returns the size of the modulus of RSA key types
+func (kt KeyType) rsaBits() int {
+	switch kt {
+	case KeyTypeRSA2048:
+		return 2048
+	case KeyTypeRSA4096:
+		return 4096
+	}
+	return 0
+}
+
+// hashAlgorithms are the hash functions which inputs can be signed with
+var hashAlgorithms = map[string]crypto.Hash{
+	"sha2-224": crypto.SHA224,
+	"sha2-256": crypto.SHA256,
+	"sha2-384": crypto.SHA384,
+	"sha2-512": crypto.SHA512,
+}
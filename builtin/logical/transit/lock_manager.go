@@ -18,6 +18,24 @@ var (
 	errNeedExclusiveLock = errors.New("an exclusive lock is needed for this operation")
 )
 
+// policyRequest holds the parameters of a named key, used when getting it
+// may create it
+type policyRequest struct {
+	storage logical.Storage
+	name    string
+
+	// The type, derivation, convergent encryption and exportability of the
+	// key, if it is created
+	keyType    KeyType
+	derived    bool
+	convergent bool
+	exportable bool
+
+	// The imported key material of the first version of the key, if it is
+	// created. If nil, the key material is generated.
+	keyEntry *KeyEntry
+}
+
 type lockManager struct {
 	// A lock for each named key
 	locks map[string]*sync.RWMutex
@@ -105,42 +123,43 @@ func (lm *lockManager) UnlockPolicy(lock *sync.RWMutex, lockType bool) {
 // is needed (for instance, for an upgrade/migration), give up the read lock,
 // call again with an exclusive lock, then swap back out for a read lock.
 func (lm *lockManager) GetPolicyShared(storage logical.Storage, name string) (*Policy, *sync.RWMutex, error) {
-	p, lock, _, err := lm.getPolicyCommon(storage, name, false, false, false, shared)
+	req := policyRequest{storage: storage, name: name}
+	p, lock, _, err := lm.getPolicyCommon(req, false, shared)
 	if err == nil ||
 		(err != nil && err != errNeedExclusiveLock) {
 		return p, lock, err
 	}
 
 	// Try again while asking for an exlusive lock
-	p, lock, _, err = lm.getPolicyCommon(storage, name, false, false, false, exclusive)
+	p, lock, _, err = lm.getPolicyCommon(req, false, exclusive)
 	if err != nil || p == nil || lock == nil {
 		return p, lock, err
 	}
 
 	lock.Unlock()
 
-	p, lock, _, err = lm.getPolicyCommon(storage, name, false, false, false, shared)
+	p, lock, _, err = lm.getPolicyCommon(req, false, shared)
 	return p, lock, err
 }
 
 // Get the policy with an exclusive lock
 func (lm *lockManager) GetPolicyExclusive(storage logical.Storage, name string) (*Policy, *sync.RWMutex, error) {
-	p, lock, _, err := lm.getPolicyCommon(storage, name, false, false, false, exclusive)
+	p, lock, _, err := lm.getPolicyCommon(policyRequest{storage: storage, name: name}, false, exclusive)
 	return p, lock, err
 }
 
 // Get the policy with a read lock; if it returns that an exclusive lock is
 // needed, retry. If successful, call one more time to get a read lock and
 // return the value.
-func (lm *lockManager) GetPolicyUpsert(storage logical.Storage, name string, derived, convergent bool) (*Policy, *sync.RWMutex, bool, error) {
-	p, lock, _, err := lm.getPolicyCommon(storage, name, true, derived, convergent, shared)
+func (lm *lockManager) GetPolicyUpsert(req policyRequest) (*Policy, *sync.RWMutex, bool, error) {
+	p, lock, _, err := lm.getPolicyCommon(req, true, shared)
 	if err == nil ||
 		(err != nil && err != errNeedExclusiveLock) {
 		return p, lock, false, err
 	}
 
 	// Try again while asking for an exlusive lock
-	p, lock, upserted, err := lm.getPolicyCommon(storage, name, true, derived, convergent, exclusive)
+	p, lock, upserted, err := lm.getPolicyCommon(req, true, exclusive)
 	if err != nil || p == nil || lock == nil {
 		return p, lock, upserted, err
 	}
@@ -148,14 +167,16 @@ func (lm *lockManager) GetPolicyUpsert(storage logical.Storage, name string, der
 	lock.Unlock()
 
 	// Now get a shared lock for the return, but preserve the value of upsert
-	p, lock, _, err = lm.getPolicyCommon(storage, name, true, derived, convergent, shared)
+	p, lock, _, err = lm.getPolicyCommon(req, true, shared)
 
 	return p, lock, upserted, err
 }
 
 // When the function returns, a lock will be held on the policy if err == nil.
 // It is the caller's responsibility to unlock.
-func (lm *lockManager) getPolicyCommon(storage logical.Storage, name string, upsert, derived, convergent, lockType bool) (*Policy, *sync.RWMutex, bool, error) {
+func (lm *lockManager) getPolicyCommon(req policyRequest, upsert, lockType bool) (*Policy, *sync.RWMutex, bool, error) {
+	storage := req.storage
+	name := req.name
 	lock := lm.policyLock(name, lockType)
 
 	var p *Policy
@@ -192,21 +213,40 @@ func (lm *lockManager) getPolicyCommon(storage logical.Storage, name string, ups
 			return nil, nil, false, errNeedExclusiveLock
 		}
 
-		if !derived && convergent {
+		if !req.derived && req.convergent {
+			lm.UnlockPolicy(lock, lockType)
 			return nil, nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
 		}
+		if req.derived && !req.keyType.DerivationSupported() {
+			lm.UnlockPolicy(lock, lockType)
+			return nil, nil, false, fmt.Errorf("key derivation is not supported by key type %s", req.keyType)
+		}
 
 		p = &Policy{
 			Name:       name,
-			CipherMode: "aes-gcm",
-			Derived:    derived,
+			Type:       req.keyType,
+			Derived:    req.derived,
+			Exportable: req.exportable,
 		}
-		if derived {
-			p.KDFMode = kdfMode
-			p.ConvergentEncryption = convergent
+		switch req.keyType {
+		case KeyTypeAES256GCM96:
+			p.CipherMode = "aes-gcm"
+		case KeyTypeChaCha20Poly1305:
+			p.CipherMode = "chacha20-poly1305"
+		}
+		if req.derived {
+			p.KDFMode = kdfModeHKDF
+			p.ConvergentEncryption = req.convergent
+			if req.convergent {
+				p.ConvergentVersion = 2
+			}
 		}
 
-		err = p.rotate(storage)
+		if req.keyEntry != nil {
+			err = p.addVersion(storage, req.keyEntry)
+		} else {
+			err = p.rotate(storage)
+		}
 		if err != nil {
 			lm.UnlockPolicy(lock, lockType)
 			return nil, nil, false, err
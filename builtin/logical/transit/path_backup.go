@@ -0,0 +1,262 @@
+package transit
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	uuid "github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// backupPrefix prefixes backups, and versions their format
+const backupPrefix = "vault:backup:v1:"
+
+// KeyData is the content of the backup of a key: its policy, and all its
+// versions
+type KeyData struct {
+	Policy       *Policy       `json:"policy"`
+	ArchivedKeys *ArchivedKeys `json:"archived_keys"`
+}
+
+func (b *backend) pathBackup() *framework.Path {
+	return &framework.Path{
+		Pattern: "backup/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"backup_key": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Base64-encoded 256-bit key encrypting the
+backup, which is needed to restore it.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathBackupWrite,
+		},
+
+		HelpSynopsis:    pathBackupHelpSyn,
+		HelpDescription: pathBackupHelpDesc,
+	}
+}
+
+func (b *backend) pathRestore() *framework.Path {
+	return &framework.Path{
+		Pattern: "restore" + framework.OptionalParamRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name to restore the key as. Defaults to the name of the backed up key.",
+			},
+
+			"backup": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The backup, as returned by the backup endpoint",
+			},
+
+			"backup_key": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Base64-encoded key the backup was encrypted with",
+			},
+
+			"force": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Whether to overwrite a key of the same name",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathRestoreWrite,
+		},
+
+		HelpSynopsis:    pathRestoreHelpSyn,
+		HelpDescription: pathRestoreHelpDesc,
+	}
+}
+
+// backupCipher returns the AEAD encrypting backups with the given key
+func backupCipher(d *framework.FieldData) (cipher.AEAD, error) {
+	keyRaw := d.Get("backup_key").(string)
+	if keyRaw == "" {
+		return nil, errutil.UserError{Err: "missing backup_key"}
+	}
+	key, err := base64.StdEncoding.DecodeString(keyRaw)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to base64-decode backup_key"}
+	}
+	if len(key) != 32 {
+		return nil, errutil.UserError{Err: "backup_key must be 256 bits long"}
+	}
+
+	aesCipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errutil.InternalError{Err: err.Error()}
+	}
+	return cipher.NewGCM(aesCipher)
+}
+
+func (b *backend) pathBackupWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	gcm, err := backupCipher(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+
+	archive, err := p.loadArchive(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(&KeyData{
+		Policy:       p,
+		ArchivedKeys: archive,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The nonce is prepended to the sealed backup, authenticated along with
+	// its prefix
+	nonce, err := uuid.GenerateRandomBytes(gcm.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(backupPrefix))
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"backup": backupPrefix + base64.StdEncoding.EncodeToString(sealed),
+		},
+	}, nil
+}
+
+func (b *backend) pathRestoreWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	backup := d.Get("backup").(string)
+	if backup == "" {
+		return logical.ErrorResponse("missing backup"), logical.ErrInvalidRequest
+	}
+	if !strings.HasPrefix(backup, backupPrefix) {
+		return logical.ErrorResponse("invalid backup: no prefix"), logical.ErrInvalidRequest
+	}
+
+	gcm, err := backupCipher(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(backup, backupPrefix))
+	if err != nil {
+		return logical.ErrorResponse("invalid backup: could not decode base64"), logical.ErrInvalidRequest
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return logical.ErrorResponse("invalid backup: too short"), logical.ErrInvalidRequest
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(backupPrefix))
+	if err != nil {
+		return logical.ErrorResponse("invalid backup: unable to decrypt"), logical.ErrInvalidRequest
+	}
+
+	keyData := KeyData{
+		Policy: &Policy{
+			Keys: KeyEntryMap{},
+		},
+	}
+	if err := jsonutil.DecodeJSON(plaintext, &keyData); err != nil {
+		return nil, err
+	}
+	if keyData.Policy.Name == "" || keyData.ArchivedKeys == nil {
+		return logical.ErrorResponse("invalid backup: missing key data"), logical.ErrInvalidRequest
+	}
+
+	name := d.Get("name").(string)
+	if name == "" {
+		name = keyData.Policy.Name
+	}
+
+	err = b.lm.RestorePolicy(req.Storage, name, keyData, d.Get("force").(bool))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// RestorePolicy stores the backed up key under the given name, which must not
+// be taken unless forced
+func (lm *lockManager) RestorePolicy(storage logical.Storage, name string, keyData KeyData, force bool) error {
+	lm.cacheMutex.Lock()
+	lock := lm.policyLock(name, exclusive)
+	defer lock.Unlock()
+	defer lm.cacheMutex.Unlock()
+
+	if !force {
+		p, err := lm.getStoredPolicy(storage, name)
+		if err != nil {
+			return err
+		}
+		if p != nil {
+			return errutil.UserError{Err: fmt.Sprintf("key %s already exists", name)}
+		}
+	}
+
+	// Store the archive before the policy, which moves its keys to the
+	// archive when persisted
+	p := keyData.Policy
+	p.Name = name
+	if err := p.storeArchive(keyData.ArchivedKeys, storage); err != nil {
+		return err
+	}
+	if err := p.Persist(storage); err != nil {
+		return err
+	}
+
+	if lm.CacheActive() {
+		lm.cache[name] = p
+	}
+	return nil
+}
+
+const pathBackupHelpSyn = `Backup the named key`
+
+const pathBackupHelpDesc = `
+This path is used to back up the named key, with all its versions
+and configuration. The backup is encrypted and authenticated with the
+given "backup_key", which is needed to restore it, possibly on another
+Vault cluster. Backing up is root-protected: it requires the "sudo"
+capability on the path.
+`
+
+const pathRestoreHelpSyn = `Restore the named key`
+
+const pathRestoreHelpDesc = `
+This path is used to restore a key from a backup. The key is restored
+under the name it was backed up with, unless a name is given. An
+existing key of the same name is only overwritten if "force" is set.
+`
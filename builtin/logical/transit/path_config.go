@@ -2,6 +2,7 @@ package transit
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -26,6 +27,19 @@ to be decrypted.`,
 				Type:        framework.TypeBool,
 				Description: "Whether to allow deletion of the key",
 			},
+
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The period after which the key is automatically
+rotated, at least an hour. Set to 0 to disable automatic rotation.`,
+			},
+
+			"keep_decryption_versions": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `If set, the number of latest versions of the key
+kept usable for decryption when the key is rotated: the minimum decryption
+version is advanced accordingly. Set to 0 to disable.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -92,6 +106,31 @@ func (b *backend) pathConfigWrite(
 		}
 	}
 
+	autoRotatePeriodRaw, ok := d.GetOk("auto_rotate_period")
+	if ok {
+		autoRotatePeriod := time.Duration(autoRotatePeriodRaw.(int)) * time.Second
+		if autoRotatePeriod != 0 && autoRotatePeriod < minAutoRotatePeriod {
+			return logical.ErrorResponse(
+				fmt.Sprintf("auto rotate period must be 0 or at least %s", minAutoRotatePeriod)), nil
+		}
+		if autoRotatePeriod != p.AutoRotatePeriod {
+			p.AutoRotatePeriod = autoRotatePeriod
+			persistNeeded = true
+		}
+	}
+
+	keepDecryptionVersionsRaw, ok := d.GetOk("keep_decryption_versions")
+	if ok {
+		keepDecryptionVersions := keepDecryptionVersionsRaw.(int)
+		if keepDecryptionVersions < 0 {
+			return logical.ErrorResponse("number of kept decryption versions cannot be negative"), nil
+		}
+		if keepDecryptionVersions != p.KeepDecryptionVersions {
+			p.KeepDecryptionVersions = keepDecryptionVersions
+			persistNeeded = true
+		}
+	}
+
 	// Add this as a guard here before persisting since we now require the min
 	// decryption version to start at 1; even if it's not explicitly set here,
 	// force the upgrade
@@ -111,10 +150,17 @@ func (b *backend) pathConfigWrite(
 	return resp, p.Persist(req.Storage)
 }
 
+// minAutoRotatePeriod is the shortest period keys can be automatically
+// rotated after
+const minAutoRotatePeriod = time.Hour
+
 const pathConfigHelpSyn = `Configure a named encryption key`
 
 const pathConfigHelpDesc = `
 This path is used to configure the named key. Currently, this
 supports adjusting the minimum version of the key allowed to
-be used for decryption via the min_decryption_version paramter.
+be used for decryption via the min_decryption_version paramter,
+allowing deletion of the key, and rotating the key automatically
+every auto_rotate_period, keeping keep_decryption_versions of its
+latest versions usable for decryption.
 `
@@ -1,7 +1,6 @@
 package transit
 
 import (
-	"encoding/base64"
 	"fmt"
 
 	"github.com/hashicorp/vault/helper/errutil"
@@ -30,8 +29,13 @@ func (b *backend) pathDecrypt() *framework.Path {
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
+
+			"batch_input": batchInputField(`A list of items to decrypt in a
+single request, each holding a "ciphertext", and a "context" and "nonce" if
+needed. If given, the other parameters are ignored and "batch_results" are
+returned, holding the "plaintext" or the "error" of each item.`),
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -46,31 +50,27 @@ func (b *backend) pathDecrypt() *framework.Path {
 func (b *backend) pathDecryptWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
-	ciphertext := d.Get("ciphertext").(string)
-	if len(ciphertext) == 0 {
+
+	items, batch, err := batchInput(d, BatchRequestItem{
+		Ciphertext: d.Get("ciphertext").(string),
+		Context:    d.Get("context").(string),
+		Nonce:      d.Get("nonce").(string),
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if !batch && len(items[0].Ciphertext) == 0 {
 		return logical.ErrorResponse("missing ciphertext to decrypt"), logical.ErrInvalidRequest
 	}
 
-	var err error
-
-	// Decode the context if any
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
+	results := make([]BatchResponseItem, len(items))
+	for i := range items {
+		if err := items[i].decode(); err != nil {
+			results[i].Error = err.Error()
 		}
 	}
-
-	// Decode the nonce if any
-	nonceRaw := d.Get("nonce").(string)
-	var nonce []byte
-	if len(nonceRaw) != 0 {
-		nonce, err = base64.StdEncoding.DecodeString(nonceRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode nonce"), logical.ErrInvalidRequest
-		}
+	if !batch && results[0].Error != "" {
+		return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
 	}
 
 	// Get the policy
@@ -85,34 +85,54 @@ func (b *backend) pathDecryptWrite(
 		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
 	}
 
-	plaintext, err := p.Decrypt(context, nonce, ciphertext)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return nil, err
+	for i, item := range items {
+		if results[i].Error != "" {
+			continue
+		}
+		if len(item.Ciphertext) == 0 {
+			results[i].Error = "missing ciphertext to decrypt"
+			continue
+		}
+
+		plaintext, err := p.Decrypt(item.context, item.nonce, item.Ciphertext)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				results[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
 		}
-	}
 
-	if plaintext == "" {
-		return nil, fmt.Errorf("empty plaintext returned")
+		if plaintext == "" {
+			return nil, fmt.Errorf("empty plaintext returned")
+		}
+		results[i].Plaintext = plaintext
 	}
 
 	// Generate the response
-	resp := &logical.Response{
+	if batch {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": results,
+			},
+		}, nil
+	}
+	if results[0].Error != "" {
+		return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
+	}
+	return &logical.Response{
 		Data: map[string]interface{}{
-			"plaintext": plaintext,
+			"plaintext": results[0].Plaintext,
 		},
-	}
-	return resp, nil
+	}, nil
 }
 
 const pathDecryptHelpSyn = `Decrypt a ciphertext value using a named key`
 
 const pathDecryptHelpDesc = `
 This path uses the named key from the request path to decrypt a user
-provided ciphertext. The plaintext is returned base64 encoded.
+provided ciphertext. The plaintext is returned base64 encoded. Several
+ciphertexts can be decrypted at once with "batch_input".
 `
@@ -1,7 +1,6 @@
 package transit
 
 import (
-	"encoding/base64"
 	"fmt"
 	"sync"
 
@@ -31,8 +30,13 @@ func (b *backend) pathEncrypt() *framework.Path {
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
+
+			"batch_input": batchInputField(`A list of items to encrypt in a
+single request, each holding a "plaintext", and a "context" and "nonce" if
+needed. If given, the other parameters are ignored and "batch_results" are
+returned, holding the "ciphertext" or the "error" of each item.`),
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -63,39 +67,46 @@ func (b *backend) pathEncryptExistenceCheck(
 func (b *backend) pathEncryptWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
-	value := d.Get("plaintext").(string)
-	if len(value) == 0 {
+
+	items, batch, err := batchInput(d, BatchRequestItem{
+		Plaintext: d.Get("plaintext").(string),
+		Context:   d.Get("context").(string),
+		Nonce:     d.Get("nonce").(string),
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if !batch && len(items[0].Plaintext) == 0 {
 		return logical.ErrorResponse("missing plaintext to encrypt"), logical.ErrInvalidRequest
 	}
 
-	var err error
-
-	// Decode the context if any
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
+	// Decode the context and nonce of the items. Keys are upserted as derived
+	// keys if any item has a context.
+	results := make([]BatchResponseItem, len(items))
+	contextSet := false
+	for i := range items {
+		if err := items[i].decode(); err != nil {
+			results[i].Error = err.Error()
+			continue
 		}
-	}
-
-	// Decode the nonce if any
-	nonceRaw := d.Get("nonce").(string)
-	var nonce []byte
-	if len(nonceRaw) != 0 {
-		nonce, err = base64.StdEncoding.DecodeString(nonceRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode nonce"), logical.ErrInvalidRequest
+		if len(items[i].context) != 0 {
+			contextSet = true
 		}
 	}
+	if !batch && results[0].Error != "" {
+		return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
+	}
 
 	// Get the policy
 	var p *Policy
 	var lock *sync.RWMutex
 	var upserted bool
 	if req.Operation == logical.CreateOperation {
-		p, lock, upserted, err = b.lm.GetPolicyUpsert(req.Storage, name, len(context) != 0, false)
+		p, lock, upserted, err = b.lm.GetPolicyUpsert(policyRequest{
+			storage: req.Storage,
+			name:    name,
+			derived: contextSet,
+		})
 	} else {
 		p, lock, err = b.lm.GetPolicyShared(req.Storage, name)
 	}
@@ -109,27 +120,45 @@ func (b *backend) pathEncryptWrite(
 		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
 	}
 
-	ciphertext, err := p.Encrypt(context, nonce, value)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return nil, err
+	for i, item := range items {
+		if results[i].Error != "" {
+			continue
+		}
+		if len(item.Plaintext) == 0 {
+			results[i].Error = "missing plaintext to encrypt"
+			continue
+		}
+
+		ciphertext, err := p.Encrypt(item.context, item.nonce, item.Plaintext)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				results[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
 		}
-	}
 
-	if ciphertext == "" {
-		return nil, fmt.Errorf("empty ciphertext returned")
+		if ciphertext == "" {
+			return nil, fmt.Errorf("empty ciphertext returned")
+		}
+		results[i].Ciphertext = ciphertext
 	}
 
 	// Generate the response
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"ciphertext": ciphertext,
-		},
+	resp := &logical.Response{}
+	if batch {
+		resp.Data = map[string]interface{}{
+			"batch_results": results,
+		}
+	} else {
+		if results[0].Error != "" {
+			return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
+		}
+		resp.Data = map[string]interface{}{
+			"ciphertext": results[0].Ciphertext,
+		}
 	}
 
 	if req.Operation == logical.CreateOperation && !upserted {
@@ -143,5 +172,6 @@ const pathEncryptHelpSyn = `Encrypt a plaintext value using a named key`
 
 const pathEncryptHelpDesc = `
 This path uses the named key from the request path to encrypt a user
-provided plaintext. The plaintext must be base64 encoded.
+provided plaintext. The plaintext must be base64 encoded. Several
+plaintexts can be encrypted at once with "batch_input".
 `
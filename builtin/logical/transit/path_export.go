@@ -0,0 +1,183 @@
+package transit
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	exportTypeEncryptionKey = "encryption-key"
+	exportTypeSigningKey    = "signing-key"
+	exportTypeHMACKey       = "hmac-key"
+)
+
+func (b *backend) pathExportKeys() *framework.Path {
+	return &framework.Path{
+		Pattern: "export/" + framework.GenericNameRegex("type") + "/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("version"),
+		Fields: map[string]*framework.FieldSchema{
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Type of key to export (encryption-key, signing-key, hmac-key)`,
+			},
+
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"version": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Version of the key, or "latest". Defaults to all the versions which can be used.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathExportKeysRead,
+		},
+
+		HelpSynopsis:    pathExportHelpSyn,
+		HelpDescription: pathExportHelpDesc,
+	}
+}
+
+func (b *backend) pathExportKeysRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	exportType := d.Get("type").(string)
+	name := d.Get("name").(string)
+	version := d.Get("version").(string)
+
+	switch exportType {
+	case exportTypeEncryptionKey, exportTypeSigningKey, exportTypeHMACKey:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid export type: %s", exportType)), logical.ErrInvalidRequest
+	}
+
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+
+	if !p.Exportable {
+		return logical.ErrorResponse("key is not exportable"), logical.ErrInvalidRequest
+	}
+	switch exportType {
+	case exportTypeEncryptionKey:
+		if !p.Type.EncryptionSupported() {
+			return logical.ErrorResponse("encryption not supported for the key"), logical.ErrInvalidRequest
+		}
+	case exportTypeSigningKey:
+		if !p.Type.SigningSupported() {
+			return logical.ErrorResponse("signing not supported for the key"), logical.ErrInvalidRequest
+		}
+	}
+
+	// Export all the versions which can be used, unless one is given
+	versions := []int{}
+	switch version {
+	case "":
+		for ver := p.MinDecryptionVersion; ver <= p.LatestVersion; ver++ {
+			versions = append(versions, ver)
+		}
+	case "latest":
+		versions = append(versions, p.LatestVersion)
+	default:
+		ver, err := strconv.Atoi(version)
+		if err != nil {
+			return logical.ErrorResponse("invalid key version"), logical.ErrInvalidRequest
+		}
+		if ver == 0 {
+			ver = 1
+		}
+		if ver < p.MinDecryptionVersion || ver > p.LatestVersion {
+			return logical.ErrorResponse("version not found"), logical.ErrInvalidRequest
+		}
+		versions = append(versions, ver)
+	}
+
+	retKeys := map[string]string{}
+	for _, ver := range versions {
+		key, err := p.exportKey(exportType, ver)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			default:
+				return nil, err
+			}
+		}
+		retKeys[strconv.Itoa(ver)] = key
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name": p.Name,
+			"type": p.Type.String(),
+			"keys": retKeys,
+		},
+	}, nil
+}
+
+// exportKey returns the key material of the given type of a version of the
+// key: the base64 encoded AES, ChaCha20, HMAC or Ed25519 key, or the PEM encoded ECDSA
+// or RSA private key
+func (p *Policy) exportKey(exportType string, ver int) (string, error) {
+	keyEntry := p.Keys[ver]
+
+	switch exportType {
+	case exportTypeEncryptionKey:
+		switch p.Type {
+		case KeyTypeAES256GCM96, KeyTypeChaCha20Poly1305:
+			return base64.StdEncoding.EncodeToString(keyEntry.Key), nil
+		case KeyTypeRSA2048, KeyTypeRSA4096:
+			return string(pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: keyEntry.PrivateKey,
+			})), nil
+		}
+
+	case exportTypeHMACKey:
+		key, err := p.HMACKey(ver)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(key), nil
+
+	case exportTypeSigningKey:
+		switch p.Type {
+		case KeyTypeEd25519:
+			return base64.StdEncoding.EncodeToString(keyEntry.PrivateKey), nil
+		case KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeECDSAP521:
+			return string(pem.EncodeToMemory(&pem.Block{
+				Type:  "EC PRIVATE KEY",
+				Bytes: keyEntry.PrivateKey,
+			})), nil
+		case KeyTypeRSA2048, KeyTypeRSA4096:
+			return string(pem.EncodeToMemory(&pem.Block{
+				Type:  "RSA PRIVATE KEY",
+				Bytes: keyEntry.PrivateKey,
+			})), nil
+		}
+	}
+
+	return "", errutil.UserError{Err: fmt.Sprintf("unknown key type %s for export type %s", p.Type, exportType)}
+}
+
+const pathExportHelpSyn = `Export named encryption or signing key`
+
+const pathExportHelpDesc = `
+This path is used to export the keys that are configured as
+exportable. Exporting is root-protected: it requires the "sudo"
+capability on the path.
+`
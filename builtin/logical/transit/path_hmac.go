@@ -0,0 +1,110 @@
+package transit
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func (b *backend) pathHMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "hmac/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"input": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The base64-encoded input data",
+			},
+
+			"algorithm": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "sha2-256",
+				Description: `Algorithm to use (POST body parameter). Valid values are:
+
+* sha2-224
+* sha2-256
+* sha2-384
+* sha2-512
+
+Defaults to "sha2-256".`,
+			},
+
+			"key_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version of the key to use. Defaults to the
+latest version.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathHMACWrite,
+		},
+
+		HelpSynopsis:    pathHMACHelpSyn,
+		HelpDescription: pathHMACHelpDesc,
+	}
+}
+
+func (b *backend) pathHMACWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	inputRaw := d.Get("input").(string)
+	if len(inputRaw) == 0 {
+		return logical.ErrorResponse("missing input"), logical.ErrInvalidRequest
+	}
+	input, err := base64.StdEncoding.DecodeString(inputRaw)
+	if err != nil {
+		return logical.ErrorResponse("failed to base64-decode input"), logical.ErrInvalidRequest
+	}
+
+	algorithm := d.Get("algorithm").(string)
+	hashAlgorithm, ok := hashAlgorithms[algorithm]
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported algorithm %s", algorithm)), logical.ErrInvalidRequest
+	}
+
+	// Get the policy
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
+	}
+
+	value, err := p.HMAC(d.Get("key_version").(int), hashAlgorithm, input)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"hmac": value,
+		},
+	}, nil
+}
+
+const pathHMACHelpSyn = `Generate an HMAC for input data using the named key`
+
+const pathHMACHelpDesc = `
+Generates an HMAC of the given input data using the named key and the given
+hash algorithm. The HMAC key is derived from each version of the named key,
+so keys of every type can generate HMACs. HMACs are verified with the
+verify endpoint.
+`
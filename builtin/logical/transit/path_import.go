@@ -0,0 +1,322 @@
+package transit
+
+import (
+	stded25519 "crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/keywrap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"golang.org/x/crypto/ed25519"
+)
+
+// wrappingKeyPath is the storage path of the RSA key imported keys are
+// wrapped with
+const wrappingKeyPath = "wrapping_key"
+
+// importFields are the fields shared by the import endpoints
+func importFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the key",
+		},
+
+		"ciphertext": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `The base64-encoded wrapped key material: an
+ephemeral AES-256 key encrypted with the wrapping key using RSA-OAEP,
+followed by the key material wrapped with the ephemeral key using AES key
+wrap with padding (RFC 5649). AES and ChaCha20 keys are given as raw bytes, and asymmetric
+keys as PKCS #8 DER encoded private keys.`,
+		},
+
+		"hash_function": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "sha2-256",
+			Description: `The hash function of RSA-OAEP. Valid values are:
+
+* sha2-224
+* sha2-256
+* sha2-384
+* sha2-512
+
+Defaults to "sha2-256".`,
+		},
+	}
+}
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathImport() *framework.Path {
+	fields := importFields()
+	fields["type"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Default:     "aes256-gcm96",
+		Description: `The type of the imported key. Defaults to "aes256-gcm96".`,
+	}
+	fields["derived"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Enables key derivation mode",
+	}
+	fields["convergent_encryption"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Whether to support convergent encryption",
+	}
+	fields["exportable"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Enables keys to be exportable",
+	}
+
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+func (b *backend) pathImportVersion() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import_version",
+		Fields:  importFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportVersionWrite,
+		},
+
+		HelpSynopsis:    pathImportVersionHelpSyn,
+		HelpDescription: pathImportVersionHelpDesc,
+	}
+}
+
+// wrappingKey returns the RSA key imported keys are wrapped with, generating
+// it on first use
+func (b *backend) wrappingKey(storage logical.Storage) (*rsa.PrivateKey, error) {
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	entry, err := storage.Get(wrappingKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		return x509.ParsePKCS1PrivateKey(entry.Value)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Put(&logical.StorageEntry{
+		Key:   wrappingKeyPath,
+		Value: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (b *backend) pathWrappingKeyRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, err := b.wrappingKey(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": string(pem.EncodeToMemory(&pem.Block{
+				Type:  "PUBLIC KEY",
+				Bytes: der,
+			})),
+		},
+	}, nil
+}
+
+// unwrapImportedKey returns the key entry of the wrapped key material of an
+// import request, for a key of the given type
+func (b *backend) unwrapImportedKey(storage logical.Storage, d *framework.FieldData, keyType KeyType) (*KeyEntry, error) {
+	ciphertextRaw := d.Get("ciphertext").(string)
+	if ciphertextRaw == "" {
+		return nil, errutil.UserError{Err: "missing ciphertext"}
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextRaw)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to base64-decode ciphertext"}
+	}
+	hashFunction, ok := hashAlgorithms[d.Get("hash_function").(string)]
+	if !ok {
+		return nil, errutil.UserError{Err: fmt.Sprintf("unsupported hash function %s", d.Get("hash_function").(string))}
+	}
+
+	wrappingKey, err := b.wrappingKey(storage)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) <= wrappingKey.Size() {
+		return nil, errutil.UserError{Err: "invalid ciphertext: too short"}
+	}
+	ephemeralKey, err := rsa.DecryptOAEP(hashFunction.New(), rand.Reader, wrappingKey, ciphertext[:wrappingKey.Size()], nil)
+	if err != nil {
+		return nil, errutil.UserError{Err: "invalid ciphertext: unable to decrypt the ephemeral key"}
+	}
+	if len(ephemeralKey) != 32 {
+		return nil, errutil.UserError{Err: "the ephemeral key must be 256 bits long"}
+	}
+	keyMaterial, err := keywrap.Unwrap(ephemeralKey, ciphertext[wrappingKey.Size():])
+	if err != nil {
+		return nil, errutil.UserError{Err: "invalid ciphertext: unable to unwrap the key"}
+	}
+
+	var key interface{} = keyMaterial
+	if !keyType.symmetric() {
+		key, err = x509.ParsePKCS8PrivateKey(keyMaterial)
+		if err != nil {
+			return nil, errutil.UserError{Err: "failed to parse the PKCS #8 private key"}
+		}
+		if k, ok := key.(stded25519.PrivateKey); ok {
+			key = ed25519.PrivateKey(k)
+		}
+	}
+
+	return newKeyEntry(keyType, key)
+}
+
+func (b *backend) pathImportWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	derived := d.Get("derived").(bool)
+	convergent := d.Get("convergent_encryption").(bool)
+
+	keyType, err := parseKeyType(d.Get("type").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if !derived && convergent {
+		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), logical.ErrInvalidRequest
+	}
+	if derived && !keyType.DerivationSupported() {
+		return logical.ErrorResponse(fmt.Sprintf("key derivation is not supported by key type %s", keyType)), logical.ErrInvalidRequest
+	}
+
+	entry, err := b.unwrapImportedKey(req.Storage, d, keyType)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	p, lock, upserted, err := b.lm.GetPolicyUpsert(policyRequest{
+		storage:    req.Storage,
+		name:       name,
+		keyType:    keyType,
+		derived:    derived,
+		convergent: convergent,
+		exportable: d.Get("exportable").(bool),
+		keyEntry:   entry,
+	})
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, fmt.Errorf("error importing key: returned policy was nil")
+	}
+	if !upserted {
+		return logical.ErrorResponse(
+				fmt.Sprintf("key %s already exists; new versions are imported with import_version", name)),
+			logical.ErrInvalidRequest
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathImportVersionWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, lock, err := b.lm.GetPolicyExclusive(req.Storage, name)
+	if lock != nil {
+		defer lock.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse(
+				fmt.Sprintf("no existing key named %s could be found", name)),
+			logical.ErrInvalidRequest
+	}
+
+	entry, err := b.unwrapImportedKey(req.Storage, d, p.Type)
+	if err == nil {
+		err = p.addVersion(req.Storage, entry)
+	}
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to wrap imported keys with`
+
+const pathWrappingKeyHelpDesc = `
+This path returns the PEM encoded public key of the RSA-4096 key of the
+backend which wraps the key material imported with the import endpoints.
+The key is generated on first use.
+`
+
+const pathImportHelpSyn = `Import a key`
+
+const pathImportHelpDesc = `
+This path is used to create a key from key material generated outside of
+Vault, such as in an HSM. The key material is wrapped with an ephemeral
+AES-256 key, itself encrypted with the public key returned by the
+wrapping_key endpoint.
+`
+
+const pathImportVersionHelpSyn = `Import a new version of a key`
+
+const pathImportVersionHelpDesc = `
+This path is used to import key material generated outside of Vault as the
+latest version of an existing key, wrapped as with the import endpoint.
+`
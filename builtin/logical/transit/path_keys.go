@@ -17,6 +17,16 @@ func (b *backend) pathKeys() *framework.Path {
 				Description: "Name of the key",
 			},
 
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "aes256-gcm96",
+				Description: `The type of key to create. Currently,
+"aes256-gcm96" and "chacha20-poly1305" (symmetric
+encryption), "ecdsa-p256", "ecdsa-p384", "ecdsa-p521",
+"ed25519", "rsa-2048" and "rsa-4096" (signing) are
+supported. Defaults to "aes256-gcm96".`,
+			},
+
 			"derived": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `Enables key derivation mode. This
@@ -28,15 +38,20 @@ allows for per-transaction unique keys.`,
 				Description: `Whether to support convergent encryption.
 This is only supported when using a key with
 key derivation enabled and will require all
-requests to carry both a context and 96-bit
-(12-byte) nonce. The given nonce will be used
+requests to carry a context. The nonce is
+derived from the plaintext and the derived key
 in place of a randomly generated nonce. As a
-result, when the same context and nonce are
-supplied, the same ciphertext is generated. It
-is *very important* when using this mode that
-you ensure that all nonces are unique for a
-given context. Failing to do so will severely
-impact the ciphertext's security.`,
+result, when the same plaintext and context are
+supplied, the same ciphertext is generated,
+which allows encrypted values to be compared
+for equality.`,
+			},
+
+			"exportable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables keys to be exportable.
+This allows for all the valid keys
+in the key ring to be exported.`,
 			},
 		},
 
@@ -56,12 +71,28 @@ func (b *backend) pathPolicyWrite(
 	name := d.Get("name").(string)
 	derived := d.Get("derived").(bool)
 	convergent := d.Get("convergent_encryption").(bool)
+	exportable := d.Get("exportable").(bool)
+
+	keyType, err := parseKeyType(d.Get("type").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
 
 	if !derived && convergent {
 		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
 	}
+	if derived && !keyType.DerivationSupported() {
+		return logical.ErrorResponse(fmt.Sprintf("key derivation is not supported by key type %s", keyType)), logical.ErrInvalidRequest
+	}
 
-	p, lock, upserted, err := b.lm.GetPolicyUpsert(req.Storage, name, derived, convergent)
+	p, lock, upserted, err := b.lm.GetPolicyUpsert(policyRequest{
+		storage:    req.Storage,
+		name:       name,
+		keyType:    keyType,
+		derived:    derived,
+		convergent: convergent,
+		exportable: exportable,
+	})
 	if lock != nil {
 		defer lock.RUnlock()
 	}
@@ -98,24 +129,48 @@ func (b *backend) pathPolicyRead(
 	// Return the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"name":                   p.Name,
-			"cipher_mode":            p.CipherMode,
-			"derived":                p.Derived,
-			"deletion_allowed":       p.DeletionAllowed,
-			"min_decryption_version": p.MinDecryptionVersion,
-			"latest_version":         p.LatestVersion,
+			"name":                     p.Name,
+			"type":                     p.Type.String(),
+			"derived":                  p.Derived,
+			"deletion_allowed":         p.DeletionAllowed,
+			"exportable":               p.Exportable,
+			"min_decryption_version":   p.MinDecryptionVersion,
+			"latest_version":           p.LatestVersion,
+			"supports_encryption":      p.Type.EncryptionSupported(),
+			"supports_signing":         p.Type.SigningSupported(),
+			"auto_rotate_period":       int64(p.AutoRotatePeriod.Seconds()),
+			"keep_decryption_versions": p.KeepDecryptionVersions,
 		},
 	}
+	if p.CipherMode != "" {
+		resp.Data["cipher_mode"] = p.CipherMode
+	}
 	if p.Derived {
 		resp.Data["kdf_mode"] = p.KDFMode
 		resp.Data["convergent_encryption"] = p.ConvergentEncryption
+		if p.ConvergentEncryption {
+			resp.Data["convergent_encryption_version"] = p.ConvergentVersion
+		}
 	}
 
-	retKeys := map[string]int64{}
-	for k, v := range p.Keys {
-		retKeys[strconv.Itoa(k)] = v.CreationTime
+	// Keys are returned with their creation time, and the public key of
+	// asymmetric keys
+	if p.Type.SigningSupported() {
+		retKeys := map[string]map[string]interface{}{}
+		for k, v := range p.Keys {
+			retKeys[strconv.Itoa(k)] = map[string]interface{}{
+				"creation_time": v.CreationTime,
+				"public_key":    v.FormattedPublicKey,
+			}
+		}
+		resp.Data["keys"] = retKeys
+	} else {
+		retKeys := map[string]int64{}
+		for k, v := range p.Keys {
+			retKeys[strconv.Itoa(k)] = v.CreationTime
+		}
+		resp.Data["keys"] = retKeys
 	}
-	resp.Data["keys"] = retKeys
 
 	return resp, nil
 }
@@ -138,5 +193,7 @@ const pathPolicyHelpSyn = `Managed named encryption keys`
 const pathPolicyHelpDesc = `
 This path is used to manage the named keys that are available.
 Doing a write with no value against a new named key will create
-it using a randomly generated key.
+it using a randomly generated key. Keys of the "aes256-gcm96" and
+"chacha20-poly1305" types encrypt and decrypt data; asymmetric keys sign and verify it, and
+their public keys are returned when reading them.
 `
@@ -1,8 +1,8 @@
 package transit
 
 import (
-	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
@@ -30,8 +30,13 @@ func (b *backend) pathRewrap() *framework.Path {
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
+
+			"batch_input": batchInputField(`A list of items to rewrap in a
+single request, each holding a "ciphertext", and a "context" and "nonce" if
+needed. If given, the other parameters are ignored and "batch_results" are
+returned, holding the "ciphertext" or the "error" of each item.`),
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -47,31 +52,26 @@ func (b *backend) pathRewrapWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
 
-	value := d.Get("ciphertext").(string)
-	if len(value) == 0 {
+	items, batch, err := batchInput(d, BatchRequestItem{
+		Ciphertext: d.Get("ciphertext").(string),
+		Context:    d.Get("context").(string),
+		Nonce:      d.Get("nonce").(string),
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if !batch && len(items[0].Ciphertext) == 0 {
 		return logical.ErrorResponse("missing ciphertext to decrypt"), logical.ErrInvalidRequest
 	}
 
-	var err error
-
-	// Decode the context if any
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
+	results := make([]BatchResponseItem, len(items))
+	for i := range items {
+		if err := items[i].decode(); err != nil {
+			results[i].Error = err.Error()
 		}
 	}
-
-	// Decode the nonce if any
-	nonceRaw := d.Get("nonce").(string)
-	var nonce []byte
-	if len(nonceRaw) != 0 {
-		nonce, err = base64.StdEncoding.DecodeString(nonceRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode nonce"), logical.ErrInvalidRequest
-		}
+	if !batch && results[0].Error != "" {
+		return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
 	}
 
 	// Get the policy
@@ -87,45 +87,70 @@ func (b *backend) pathRewrapWrite(
 		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
 	}
 
-	plaintext, err := p.Decrypt(context, nonce, value)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return nil, err
+	for i, item := range items {
+		if results[i].Error != "" {
+			continue
+		}
+		if len(item.Ciphertext) == 0 {
+			results[i].Error = "missing ciphertext to decrypt"
+			continue
 		}
-	}
 
-	if plaintext == "" {
-		return nil, fmt.Errorf("empty plaintext returned during rewrap")
-	}
+		plaintext, err := p.Decrypt(item.context, item.nonce, item.Ciphertext)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				results[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
 
-	ciphertext, err := p.Encrypt(context, nonce, plaintext)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return nil, err
+		if plaintext == "" {
+			return nil, fmt.Errorf("empty plaintext returned during rewrap")
 		}
-	}
 
-	if ciphertext == "" {
-		return nil, fmt.Errorf("empty ciphertext returned")
+		// Ciphertext of the latest version, once authenticated, is returned
+		// as is
+		if strings.HasPrefix(item.Ciphertext, fmt.Sprintf("vault:v%d:", p.LatestVersion)) {
+			results[i].Ciphertext = item.Ciphertext
+			continue
+		}
+
+		ciphertext, err := p.Encrypt(item.context, item.nonce, plaintext)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				results[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
+
+		if ciphertext == "" {
+			return nil, fmt.Errorf("empty ciphertext returned")
+		}
+		results[i].Ciphertext = ciphertext
 	}
 
 	// Generate the response
-	resp := &logical.Response{
+	if batch {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": results,
+			},
+		}, nil
+	}
+	if results[0].Error != "" {
+		return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
+	}
+	return &logical.Response{
 		Data: map[string]interface{}{
-			"ciphertext": ciphertext,
+			"ciphertext": results[0].Ciphertext,
 		},
-	}
-	return resp, nil
+	}, nil
 }
 
 const pathRewrapHelpSyn = `Rewrap ciphertext`
@@ -134,5 +159,6 @@ const pathRewrapHelpDesc = `
 After key rotation, this function can be used to rewrap the
 given ciphertext with the latest version of the named key.
 If the given ciphertext is already using the latest version
-of the key, this function is a no-op.
+of the key, it is returned unchanged once authenticated. Several ciphertexts can
+be rewrapped at once with "batch_input".
 `
@@ -0,0 +1,263 @@
+package transit
+
+import (
+	"crypto"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// signingFields are the fields shared by the sign and verify endpoints
+func signingFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the key",
+		},
+
+		"input": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The base64-encoded input data",
+		},
+
+		"hash_algorithm": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "sha2-256",
+			Description: `Hash algorithm to use (POST body parameter). Valid values are:
+
+* sha2-224
+* sha2-256
+* sha2-384
+* sha2-512
+
+Defaults to "sha2-256". Not used by ed25519 keys.`,
+		},
+
+		"prehashed": &framework.FieldSchema{
+			Type: framework.TypeBool,
+			Description: `Set to 'true' when the input is already hashed
+with the hash algorithm. Not supported by ed25519 keys.`,
+		},
+
+		"signature_algorithm": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `The signature algorithm of RSA keys, "pss" or
+"pkcs1v15". Defaults to "pss".`,
+		},
+	}
+}
+
+func (b *backend) pathSign() *framework.Path {
+	fields := signingFields()
+	fields["key_version"] = &framework.FieldSchema{
+		Type: framework.TypeInt,
+		Description: `The version of the key to sign with. Defaults to
+the latest version.`,
+	}
+	fields["batch_input"] = batchInputField(`A list of items to sign in a
+single request, each holding an "input". If given, "input" is ignored and
+"batch_results" are returned, holding the "signature" or the "error" of
+each item.`)
+
+	return &framework.Path{
+		Pattern: "sign/" + framework.GenericNameRegex("name"),
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathSignWrite,
+		},
+
+		HelpSynopsis:    pathSignHelpSyn,
+		HelpDescription: pathSignHelpDesc,
+	}
+}
+
+func (b *backend) pathVerify() *framework.Path {
+	fields := signingFields()
+	fields["signature"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The signature, as returned by sign",
+	}
+	fields["hmac"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The HMAC, as returned by hmac. Given in place of a signature.",
+	}
+
+	return &framework.Path{
+		Pattern: "verify/" + framework.GenericNameRegex("name"),
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVerifyWrite,
+		},
+
+		HelpSynopsis:    pathVerifyHelpSyn,
+		HelpDescription: pathVerifyHelpDesc,
+	}
+}
+
+// signingHashAlgorithm returns the hash algorithm of a sign or verify
+// request
+func signingHashAlgorithm(d *framework.FieldData) (crypto.Hash, *logical.Response) {
+	hashAlgorithm, ok := hashAlgorithms[d.Get("hash_algorithm").(string)]
+	if !ok {
+		return 0, logical.ErrorResponse(fmt.Sprintf("unsupported hash algorithm %s", d.Get("hash_algorithm").(string)))
+	}
+	return hashAlgorithm, nil
+}
+
+// decodeInput decodes the base64 encoded input of a sign or verify request
+func decodeInput(inputRaw string) ([]byte, error) {
+	if len(inputRaw) == 0 {
+		return nil, errutil.UserError{Err: "missing input"}
+	}
+	input, err := base64.StdEncoding.DecodeString(inputRaw)
+	if err != nil {
+		return nil, errutil.UserError{Err: "failed to base64-decode input"}
+	}
+	return input, nil
+}
+
+func (b *backend) pathSignWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	hashAlgorithm, errResp := signingHashAlgorithm(d)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+
+	items, batch, err := batchInput(d, BatchRequestItem{
+		Input: d.Get("input").(string),
+	})
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if !batch {
+		if _, err := decodeInput(items[0].Input); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	// Get the policy
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
+	}
+
+	results := make([]BatchResponseItem, len(items))
+	for i, item := range items {
+		signature := ""
+		input, err := decodeInput(item.Input)
+		if err == nil {
+			signature, err = p.Sign(d.Get("key_version").(int), input, hashAlgorithm,
+				d.Get("prehashed").(bool), d.Get("signature_algorithm").(string))
+		}
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				results[i].Error = err.Error()
+				continue
+			default:
+				return nil, err
+			}
+		}
+		results[i].Signature = signature
+	}
+
+	// Generate the response
+	if batch {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"batch_results": results,
+			},
+		}, nil
+	}
+	if results[0].Error != "" {
+		return logical.ErrorResponse(results[0].Error), logical.ErrInvalidRequest
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature": results[0].Signature,
+		},
+	}, nil
+}
+
+func (b *backend) pathVerifyWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	hashAlgorithm, errResp := signingHashAlgorithm(d)
+	if errResp != nil {
+		return errResp, logical.ErrInvalidRequest
+	}
+	input, err := decodeInput(d.Get("input").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	signature := d.Get("signature").(string)
+	hmacValue := d.Get("hmac").(string)
+	switch {
+	case signature != "" && hmacValue != "":
+		return logical.ErrorResponse("only one of signature or hmac can be given"), logical.ErrInvalidRequest
+	case signature == "" && hmacValue == "":
+		return logical.ErrorResponse("missing signature or hmac"), logical.ErrInvalidRequest
+	}
+
+	// Get the policy
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
+	}
+
+	var valid bool
+	if hmacValue != "" {
+		valid, err = p.VerifyHMAC(input, hmacValue, hashAlgorithm)
+	} else {
+		valid, err = p.Verify(input, signature, hashAlgorithm,
+			d.Get("prehashed").(bool), d.Get("signature_algorithm").(string))
+	}
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": valid,
+		},
+	}, nil
+}
+
+const pathSignHelpSyn = `Generate a signature for input data using the named key`
+
+const pathSignHelpDesc = `
+Generates a signature of the given input data using the named key and the
+given hash algorithm. The key must be an asymmetric key type. The private
+key never leaves Vault.
+`
+
+const pathVerifyHelpSyn = `Verify a signature or HMAC for input data created using the named key`
+
+const pathVerifyHelpDesc = `
+Verifies a signature of the given input data, as returned by the sign
+endpoint, or its HMAC, as returned by the hmac endpoint, using the named key
+and the given hash algorithm.
+`
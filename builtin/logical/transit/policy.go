@@ -1,12 +1,21 @@
 package transit
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 	"time"
@@ -16,11 +25,17 @@ import (
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/kdf"
 	"github.com/hashicorp/vault/logical"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/ed25519"
 )
 
 const (
-	// kdfMode is the only KDF mode currently supported
-	kdfMode = "hmac-sha256-counter"
+	// kdfModeCounter derives keys with the NIST SP 800-108 counter mode KDF,
+	// and is used by derived keys created before kdfModeHKDF
+	kdfModeCounter = "hmac-sha256-counter"
+
+	// kdfModeHKDF derives keys with HKDF-SHA256, the context being its info
+	kdfModeHKDF = "hkdf_sha256"
 
 	ErrTooOld = "ciphertext version is disallowed by policy (too old)"
 )
@@ -29,6 +44,14 @@ const (
 type KeyEntry struct {
 	Key          []byte `json:"key"`
 	CreationTime int64  `json:"creation_time"`
+
+	// The private key of asymmetric keys: a SEC 1 EC private key, a PKCS #1
+	// RSA private key or an Ed25519 private key
+	PrivateKey []byte `json:"private_key,omitempty"`
+
+	// The public key of asymmetric keys, PEM encoded except for Ed25519 keys,
+	// which are base64 encoded
+	FormattedPublicKey string `json:"public_key,omitempty"`
 }
 
 // KeyEntryMap is used to allow JSON marshal/unmarshal
@@ -66,6 +89,7 @@ type Policy struct {
 	Key        []byte      `json:"key,omitempty"` //DEPRECATED
 	Keys       KeyEntryMap `json:"keys"`
 	CipherMode string      `json:"cipher"`
+	Type       KeyType     `json:"type"`
 
 	// Derived keys MUST provide a context and the master underlying key is
 	// never used. If convergent encryption is true, the context will be used
@@ -74,6 +98,11 @@ type Policy struct {
 	KDFMode              string `json:"kdf_mode"`
 	ConvergentEncryption bool   `json:"convergent_encryption"`
 
+	// The version of convergent encryption. Version 1 requires the nonce
+	// to be supplied with each request; from version 2 it is derived from
+	// the plaintext and the key, and stored in the ciphertext.
+	ConvergentVersion int `json:"convergent_version"`
+
 	// The minimum version of the key allowed to be used
 	// for decryption
 	MinDecryptionVersion int `json:"min_decryption_version"`
@@ -87,6 +116,18 @@ type Policy struct {
 
 	// Whether the key is allowed to be deleted
 	DeletionAllowed bool `json:"deletion_allowed"`
+
+	// Whether the key material can be exported, which can only be set when
+	// the key is created
+	Exportable bool `json:"exportable"`
+
+	// The period after which the key is automatically rotated, if set
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
+
+	// If set, the number of latest versions of the key kept usable for
+	// decryption when the key is rotated, by advancing the minimum
+	// decryption version
+	KeepDecryptionVersions int `json:"keep_decryption_versions"`
 }
 
 // ArchivedKeys stores old keys. This is used to keep the key loading time sane
@@ -260,6 +301,11 @@ func (p *Policy) needsUpgrade() bool {
 		return true
 	}
 
+	// Convergent keys created before nonces were derived use supplied nonces
+	if p.ConvergentEncryption && p.ConvergentVersion == 0 {
+		return true
+	}
+
 	return false
 }
 
@@ -289,6 +335,12 @@ func (p *Policy) upgrade(storage logical.Storage) error {
 		persistNeeded = true
 	}
 
+	// Convergent keys created before nonces were derived use supplied nonces
+	if p.ConvergentEncryption && p.ConvergentVersion == 0 {
+		p.ConvergentVersion = 1
+		persistNeeded = true
+	}
+
 	if persistNeeded {
 		err := p.Persist(storage)
 		if err != nil {
@@ -323,52 +375,54 @@ func (p *Policy) DeriveKey(context []byte, ver int) ([]byte, error) {
 	}
 
 	switch p.KDFMode {
-	case kdfMode:
+	case kdfModeCounter:
 		prf := kdf.HMACSHA256PRF
 		prfLen := kdf.HMACSHA256PRFLen
 		return kdf.CounterMode(prf, prfLen, p.Keys[ver].Key, context, 256)
+	case kdfModeHKDF:
+		return kdf.HKDF(sha256.New, p.Keys[ver].Key, nil, context, 32)
 	default:
 		return nil, errutil.InternalError{Err: "unsupported key derivation mode"}
 	}
 }
 
 func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
+	if !p.Type.EncryptionSupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("message encryption not supported for key type %s", p.Type)}
+	}
+
 	// Decode the plaintext value
 	plaintext, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
 		return "", errutil.UserError{Err: "failed to base64-decode plaintext"}
 	}
 
+	switch p.Type {
+	case KeyTypeRSA2048, KeyTypeRSA4096:
+		return p.encryptRSA(plaintext)
+	}
+
 	// Derive the key that should be used
 	key, err := p.DeriveKey(context, p.LatestVersion)
 	if err != nil {
 		return "", err
 	}
 
-	// Guard against a potentially invalid cipher-mode
-	switch p.CipherMode {
-	case "aes-gcm":
-	default:
-		return "", errutil.InternalError{Err: "unsupported cipher mode"}
-	}
-
-	// Setup the cipher
-	aesCipher, err := aes.NewCipher(key)
-	if err != nil {
-		return "", errutil.InternalError{Err: err.Error()}
-	}
-
-	// Setup the GCM AEAD
-	gcm, err := cipher.NewGCM(aesCipher)
+	gcm, err := p.aead(key)
 	if err != nil {
-		return "", errutil.InternalError{Err: err.Error()}
+		return "", err
 	}
 
-	if p.ConvergentEncryption {
+	switch {
+	case p.ConvergentEncryption && p.ConvergentVersion == 1:
 		if len(nonce) != gcm.NonceSize() {
 			return "", errutil.UserError{Err: fmt.Sprintf("base64-decoded nonce must be %d bytes long when using convergent encryption with this key", gcm.NonceSize())}
 		}
-	} else {
+	case p.ConvergentEncryption:
+		// Derive the nonce from the plaintext, so that the same plaintext
+		// and context always produce the same ciphertext
+		nonce = deriveNonce(key, plaintext, gcm.NonceSize())
+	default:
 		// Compute random nonce
 		nonce, err = uuid.GenerateRandomBytes(gcm.NonceSize())
 		if err != nil {
@@ -379,9 +433,10 @@ func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
 	// Encrypt and tag with GCM
 	out := gcm.Seal(nil, nonce, plaintext, nil)
 
-	// Place the encrypted data after the nonce
+	// Place the encrypted data after the nonce, unless the nonce is supplied
+	// with each request
 	full := out
-	if !p.ConvergentEncryption {
+	if !p.suppliedNonce() {
 		full = append(nonce, out...)
 	}
 
@@ -395,81 +450,120 @@ func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
 }
 
 func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
-	// Verify the prefix
-	if !strings.HasPrefix(value, "vault:v") {
-		return "", errutil.UserError{Err: "invalid ciphertext: no prefix"}
+	if !p.Type.EncryptionSupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("message decryption not supported for key type %s", p.Type)}
 	}
 
-	if p.ConvergentEncryption && (nonce == nil || len(nonce) == 0) {
+	if p.suppliedNonce() && (nonce == nil || len(nonce) == 0) {
 		return "", errutil.UserError{Err: "invalid convergent nonce supplied"}
 	}
 
-	splitVerCiphertext := strings.SplitN(strings.TrimPrefix(value, "vault:v"), ":", 2)
-	if len(splitVerCiphertext) != 2 {
-		return "", errutil.UserError{Err: "invalid ciphertext: wrong number of fields"}
+	ver, encoded, err := p.splitVersioned("ciphertext", value)
+	if err != nil {
+		return "", err
 	}
 
-	ver, err := strconv.Atoi(splitVerCiphertext[0])
+	switch p.Type {
+	case KeyTypeRSA2048, KeyTypeRSA4096:
+		return p.decryptRSA(ver, encoded)
+	}
+
+	// Derive the key that should be used
+	key, err := p.DeriveKey(context, ver)
 	if err != nil {
-		return "", errutil.UserError{Err: "invalid ciphertext: version number could not be decoded"}
+		return "", err
 	}
 
-	if ver == 0 {
-		// Compatibility mode with initial implementation, where keys start at
-		// zero
-		ver = 1
+	gcm, err := p.aead(key)
+	if err != nil {
+		return "", err
 	}
 
-	if ver > p.LatestVersion {
-		return "", errutil.UserError{Err: "invalid ciphertext: version is too new"}
+	// Decode the base64
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errutil.UserError{Err: "invalid ciphertext: could not decode base64"}
 	}
 
-	if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
-		return "", errutil.UserError{Err: ErrTooOld}
+	// Extract the nonce and ciphertext
+	var ciphertext []byte
+	if p.suppliedNonce() {
+		ciphertext = decoded
+	} else {
+		if len(decoded) < gcm.NonceSize() {
+			return "", errutil.UserError{Err: "invalid ciphertext: too short"}
+		}
+		nonce = decoded[:gcm.NonceSize()]
+		ciphertext = decoded[gcm.NonceSize():]
 	}
 
-	// Derive the key that should be used
-	key, err := p.DeriveKey(context, ver)
+	// Verify and Decrypt
+	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return "", err
+		return "", errutil.UserError{Err: "invalid ciphertext: unable to decrypt"}
 	}
 
-	// Guard against a potentially invalid cipher-mode
+	return base64.StdEncoding.EncodeToString(plain), nil
+}
+
+// aead returns the AEAD of the cipher mode of the key, AES-GCM or
+// ChaCha20-Poly1305, with the given key. Both use 96-bit nonces.
+func (p *Policy) aead(key []byte) (cipher.AEAD, error) {
 	switch p.CipherMode {
 	case "aes-gcm":
+		aesCipher, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, errutil.InternalError{Err: err.Error()}
+		}
+		gcm, err := cipher.NewGCM(aesCipher)
+		if err != nil {
+			return nil, errutil.InternalError{Err: err.Error()}
+		}
+		return gcm, nil
+	case "chacha20-poly1305":
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, errutil.InternalError{Err: err.Error()}
+		}
+		return aead, nil
 	default:
-		return "", errutil.InternalError{Err: "unsupported cipher mode"}
+		return nil, errutil.InternalError{Err: "unsupported cipher mode"}
 	}
+}
 
-	// Decode the base64
-	decoded, err := base64.StdEncoding.DecodeString(splitVerCiphertext[1])
+// encryptRSA encrypts the plaintext with RSA-OAEP and SHA-256, using the
+// public key of the latest version of the key
+func (p *Policy) encryptRSA(plaintext []byte) (string, error) {
+	key, err := x509.ParsePKCS1PrivateKey(p.Keys[p.LatestVersion].PrivateKey)
 	if err != nil {
-		return "", errutil.UserError{Err: "invalid ciphertext: could not decode base64"}
+		return "", errutil.InternalError{Err: err.Error()}
 	}
 
-	// Setup the cipher
-	aesCipher, err := aes.NewCipher(key)
+	ciphertext, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, &key.PublicKey, plaintext, nil)
 	if err != nil {
+		if err == rsa.ErrMessageTooLong {
+			return "", errutil.UserError{Err: "plaintext is too long for the key"}
+		}
 		return "", errutil.InternalError{Err: err.Error()}
 	}
 
-	// Setup the GCM AEAD
-	gcm, err := cipher.NewGCM(aesCipher)
+	return "vault:v" + strconv.Itoa(p.LatestVersion) + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// decryptRSA decrypts the base64 encoded RSA-OAEP ciphertext of the given
+// version of the key
+func (p *Policy) decryptRSA(ver int, encoded string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return "", errutil.InternalError{Err: err.Error()}
+		return "", errutil.UserError{Err: "invalid ciphertext: could not decode base64"}
 	}
 
-	// Extract the nonce and ciphertext
-	var ciphertext []byte
-	if p.ConvergentEncryption {
-		ciphertext = decoded
-	} else {
-		nonce = decoded[:gcm.NonceSize()]
-		ciphertext = decoded[gcm.NonceSize():]
+	key, err := x509.ParsePKCS1PrivateKey(p.Keys[ver].PrivateKey)
+	if err != nil {
+		return "", errutil.InternalError{Err: err.Error()}
 	}
 
-	// Verify and Decrypt
-	plain, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plain, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, key, decoded, nil)
 	if err != nil {
 		return "", errutil.UserError{Err: "invalid ciphertext: unable to decrypt"}
 	}
@@ -477,7 +571,284 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 	return base64.StdEncoding.EncodeToString(plain), nil
 }
 
+// splitVersioned splits a value output by the key, such as a ciphertext,
+// into the version of the key and the base64 encoded value, checking that the
+// version can still be used
+func (p *Policy) splitVersioned(what, value string) (int, string, error) {
+	// Verify the prefix
+	if !strings.HasPrefix(value, "vault:v") {
+		return 0, "", errutil.UserError{Err: fmt.Sprintf("invalid %s: no prefix", what)}
+	}
+
+	splitVerValue := strings.SplitN(strings.TrimPrefix(value, "vault:v"), ":", 2)
+	if len(splitVerValue) != 2 {
+		return 0, "", errutil.UserError{Err: fmt.Sprintf("invalid %s: wrong number of fields", what)}
+	}
+
+	ver, err := strconv.Atoi(splitVerValue[0])
+	if err != nil {
+		return 0, "", errutil.UserError{Err: fmt.Sprintf("invalid %s: version number could not be decoded", what)}
+	}
+
+	if ver == 0 {
+		// Compatibility mode with initial implementation, where keys start at
+		// zero
+		ver = 1
+	}
+
+	if ver > p.LatestVersion {
+		return 0, "", errutil.UserError{Err: fmt.Sprintf("invalid %s: version is too new", what)}
+	}
+
+	if p.MinDecryptionVersion > 0 && ver < p.MinDecryptionVersion {
+		return 0, "", errutil.UserError{Err: ErrTooOld}
+	}
+
+	return ver, splitVerValue[1], nil
+}
+
+// HMACKey returns the key used to compute HMACs with the given version of the
+// key. It is derived from the key material, so that keys of all types can
+// compute HMACs.
+func (p *Policy) HMACKey(ver int) ([]byte, error) {
+	if ver <= 0 || ver > p.LatestVersion {
+		return nil, errutil.UserError{Err: "invalid key version"}
+	}
+	keyEntry := p.Keys[ver]
+	secret := keyEntry.Key
+	if len(secret) == 0 {
+		secret = keyEntry.PrivateKey
+	}
+	if len(secret) == 0 {
+		return nil, errutil.InternalError{Err: "unable to access the key; no key material found"}
+	}
+	return kdf.HKDF(sha256.New, secret, nil, []byte("hmac"), 32)
+}
+
+// HMAC returns the HMAC of the input with the given version of the key, or
+// its latest version if zero
+func (p *Policy) HMAC(ver int, hashAlgorithm crypto.Hash, input []byte) (string, error) {
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	sum, err := p.hmacSum(ver, hashAlgorithm, input)
+	if err != nil {
+		return "", err
+	}
+	return "vault:v" + strconv.Itoa(ver) + ":" + base64.StdEncoding.EncodeToString(sum), nil
+}
+
+// VerifyHMAC returns whether the value, as output by HMAC, is the HMAC of
+// the input
+func (p *Policy) VerifyHMAC(input []byte, value string, hashAlgorithm crypto.Hash) (bool, error) {
+	ver, encoded, err := p.splitVersioned("hmac", value)
+	if err != nil {
+		return false, err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, errutil.UserError{Err: "invalid hmac: could not decode base64"}
+	}
+	sum, err := p.hmacSum(ver, hashAlgorithm, input)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(sum, decoded), nil
+}
+
+func (p *Policy) hmacSum(ver int, hashAlgorithm crypto.Hash, input []byte) ([]byte, error) {
+	if ver < p.MinDecryptionVersion {
+		return nil, errutil.UserError{Err: "invalid key version"}
+	}
+	key, err := p.HMACKey(ver)
+	if err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(hashAlgorithm.New, key)
+	mac.Write(input)
+	return mac.Sum(nil), nil
+}
+
+// ecdsaSignature is the ASN.1 encoding of ECDSA signatures
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+// signingDigest returns the input to sign or verify with ECDSA and RSA keys:
+// the input itself if it is already hashed, or else its hash
+func signingDigest(input []byte, hashAlgorithm crypto.Hash, prehashed bool) ([]byte, error) {
+	if prehashed {
+		if len(input) != hashAlgorithm.Size() {
+			return nil, errutil.UserError{Err: fmt.Sprintf("prehashed input must be %d bytes long", hashAlgorithm.Size())}
+		}
+		return input, nil
+	}
+	h := hashAlgorithm.New()
+	h.Write(input)
+	return h.Sum(nil), nil
+}
+
+// Sign signs the input with the given version of the key, or its latest
+// version if zero. ECDSA signatures are ASN.1 encoded, and RSA signatures use
+// the PSS or PKCS #1 v1.5 signature algorithm. Ed25519 keys sign the input
+// itself, which cannot be prehashed.
+func (p *Policy) Sign(ver int, input []byte, hashAlgorithm crypto.Hash, prehashed bool, signatureAlgorithm string) (string, error) {
+	if !p.Type.SigningSupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("message signing not supported for key type %s", p.Type)}
+	}
+
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	if ver < p.MinDecryptionVersion || ver > p.LatestVersion {
+		return "", errutil.UserError{Err: "invalid key version"}
+	}
+	keyEntry := p.Keys[ver]
+
+	var sig []byte
+	switch p.Type {
+	case KeyTypeEd25519:
+		if prehashed {
+			return "", errutil.UserError{Err: "prehashed input is not supported by ed25519 keys"}
+		}
+		sig = ed25519.Sign(ed25519.PrivateKey(keyEntry.PrivateKey), input)
+
+	case KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeECDSAP521:
+		digest, err := signingDigest(input, hashAlgorithm, prehashed)
+		if err != nil {
+			return "", err
+		}
+		key, err := x509.ParseECPrivateKey(keyEntry.PrivateKey)
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+		sig, err = asn1.Marshal(ecdsaSignature{R: r, S: s})
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+
+	case KeyTypeRSA2048, KeyTypeRSA4096:
+		digest, err := signingDigest(input, hashAlgorithm, prehashed)
+		if err != nil {
+			return "", err
+		}
+		key, err := x509.ParsePKCS1PrivateKey(keyEntry.PrivateKey)
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+		switch signatureAlgorithm {
+		case "", "pss":
+			sig, err = rsa.SignPSS(rand.Reader, key, hashAlgorithm, digest, nil)
+		case "pkcs1v15":
+			sig, err = rsa.SignPKCS1v15(rand.Reader, key, hashAlgorithm, digest)
+		default:
+			return "", errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %q", signatureAlgorithm)}
+		}
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+	}
+
+	return "vault:v" + strconv.Itoa(ver) + ":" + base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Verify returns whether the signature, as output by Sign, is a valid
+// signature of the input
+func (p *Policy) Verify(input []byte, signature string, hashAlgorithm crypto.Hash, prehashed bool, signatureAlgorithm string) (bool, error) {
+	if !p.Type.SigningSupported() {
+		return false, errutil.UserError{Err: fmt.Sprintf("message verification not supported for key type %s", p.Type)}
+	}
+
+	ver, encoded, err := p.splitVersioned("signature", signature)
+	if err != nil {
+		return false, err
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return false, errutil.UserError{Err: "invalid signature: could not decode base64"}
+	}
+	keyEntry := p.Keys[ver]
+
+	switch p.Type {
+	case KeyTypeEd25519:
+		if prehashed {
+			return false, errutil.UserError{Err: "prehashed input is not supported by ed25519 keys"}
+		}
+		key := ed25519.PrivateKey(keyEntry.PrivateKey)
+		return ed25519.Verify(key.Public().(ed25519.PublicKey), input, sig), nil
+
+	case KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeECDSAP521:
+		digest, err := signingDigest(input, hashAlgorithm, prehashed)
+		if err != nil {
+			return false, err
+		}
+		key, err := x509.ParseECPrivateKey(keyEntry.PrivateKey)
+		if err != nil {
+			return false, errutil.InternalError{Err: err.Error()}
+		}
+		var ecdsaSig ecdsaSignature
+		if rest, err := asn1.Unmarshal(sig, &ecdsaSig); err != nil || len(rest) != 0 {
+			return false, nil
+		}
+		if ecdsaSig.R == nil || ecdsaSig.S == nil {
+			return false, nil
+		}
+		return ecdsa.Verify(&key.PublicKey, digest, ecdsaSig.R, ecdsaSig.S), nil
+
+	case KeyTypeRSA2048, KeyTypeRSA4096:
+		digest, err := signingDigest(input, hashAlgorithm, prehashed)
+		if err != nil {
+			return false, err
+		}
+		key, err := x509.ParsePKCS1PrivateKey(keyEntry.PrivateKey)
+		if err != nil {
+			return false, errutil.InternalError{Err: err.Error()}
+		}
+		switch signatureAlgorithm {
+		case "", "pss":
+			err = rsa.VerifyPSS(&key.PublicKey, hashAlgorithm, digest, sig, nil)
+		case "pkcs1v15":
+			err = rsa.VerifyPKCS1v15(&key.PublicKey, hashAlgorithm, digest, sig)
+		default:
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %q", signatureAlgorithm)}
+		}
+		return err == nil, nil
+	}
+
+	return false, errutil.InternalError{Err: "unsupported key type"}
+}
+
+// suppliedNonce returns whether the nonce of the key is supplied with each
+// request, rather than stored in the ciphertext
+func (p *Policy) suppliedNonce() bool {
+	return p.ConvergentEncryption && p.ConvergentVersion == 1
+}
+
+// deriveNonce returns the nonce used to encrypt a plaintext with a
+// convergent key: the HMAC of the plaintext with the key, truncated
+func deriveNonce(key, plaintext []byte, size int) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(plaintext)
+	return mac.Sum(nil)[:size]
+}
+
 func (p *Policy) rotate(storage logical.Storage) error {
+	entry, err := generateKeyEntry(p.Type)
+	if err != nil {
+		return err
+	}
+
+	return p.addVersion(storage, entry)
+}
+
+// addVersion adds the key entry as the latest version of the key, and
+// persists the policy
+func (p *Policy) addVersion(storage logical.Storage, entry *KeyEntry) error {
 	if p.Keys == nil {
 		// This is an initial key rotation when generating a new policy. We
 		// don't need to call migrate here because if we've called getPolicy to
@@ -485,19 +856,9 @@ func (p *Policy) rotate(storage logical.Storage) error {
 		p.Keys = KeyEntryMap{}
 	}
 
-	// Generate a 256bit key
-	newKey := make([]byte, 32)
-	_, err := rand.Read(newKey)
-	if err != nil {
-		return err
-	}
-
 	p.LatestVersion += 1
 
-	p.Keys[p.LatestVersion] = KeyEntry{
-		Key:          newKey,
-		CreationTime: time.Now().Unix(),
-	}
+	p.Keys[p.LatestVersion] = *entry
 
 	// This ensures that with new key creations min decryption version is set
 	// to 1 rather than the int default of 0, since keys start at 1 (either
@@ -506,11 +867,116 @@ func (p *Policy) rotate(storage logical.Storage) error {
 		p.MinDecryptionVersion = 1
 	}
 
+	if p.KeepDecryptionVersions > 0 {
+		minDecryptionVersion := p.LatestVersion - p.KeepDecryptionVersions + 1
+		if minDecryptionVersion > p.MinDecryptionVersion {
+			p.MinDecryptionVersion = minDecryptionVersion
+		}
+	}
+
 	//fmt.Printf("policy %s rotated to %d\n", p.Name, p.LatestVersion)
 
 	return p.Persist(storage)
 }
 
+// autoRotateDue returns whether the key should be automatically rotated, its
+// latest version being older than the auto-rotate period
+func (p *Policy) autoRotateDue(now time.Time) bool {
+	if p.AutoRotatePeriod <= 0 {
+		return false
+	}
+	created := time.Unix(p.Keys[p.LatestVersion].CreationTime, 0)
+	return now.Sub(created) >= p.AutoRotatePeriod
+}
+
+// generateKeyEntry generates a new version of a key of the given type
+func generateKeyEntry(keyType KeyType) (*KeyEntry, error) {
+	var key interface{}
+	var err error
+	switch keyType {
+	case KeyTypeAES256GCM96, KeyTypeChaCha20Poly1305:
+		// Generate a 256bit key
+		aesKey := make([]byte, 32)
+		_, err = rand.Read(aesKey)
+		key = aesKey
+
+	case KeyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+
+	case KeyTypeECDSAP256, KeyTypeECDSAP384, KeyTypeECDSAP521:
+		key, err = ecdsa.GenerateKey(keyType.curve(), rand.Reader)
+
+	case KeyTypeRSA2048, KeyTypeRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, keyType.rsaBits())
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", keyType)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return newKeyEntry(keyType, key)
+}
+
+// newKeyEntry returns a new version of a key of the given type holding the key
+// material: an AES or ChaCha20 key as a []byte, an ed25519.PrivateKey, or an ECDSA or RSA
+// private key
+func newKeyEntry(keyType KeyType, key interface{}) (*KeyEntry, error) {
+	entry := &KeyEntry{
+		CreationTime: time.Now().Unix(),
+	}
+
+	var publicKey interface{}
+	switch k := key.(type) {
+	case []byte:
+		if !keyType.symmetric() || len(k) != 32 {
+			break
+		}
+		entry.Key = k
+		return entry, nil
+
+	case ed25519.PrivateKey:
+		if keyType != KeyTypeEd25519 || len(k) != ed25519.PrivateKeySize {
+			break
+		}
+		entry.PrivateKey = k
+		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(k[32:])
+		return entry, nil
+
+	case *ecdsa.PrivateKey:
+		if keyType.curve() == nil || k.Curve != keyType.curve() {
+			break
+		}
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+		entry.PrivateKey = der
+		publicKey = &k.PublicKey
+
+	case *rsa.PrivateKey:
+		if keyType.rsaBits() == 0 || k.N.BitLen() != keyType.rsaBits() {
+			break
+		}
+		entry.PrivateKey = x509.MarshalPKCS1PrivateKey(k)
+		publicKey = &k.PublicKey
+	}
+	if publicKey == nil {
+		return nil, errutil.UserError{Err: fmt.Sprintf("key material does not match key type %s", keyType)}
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	entry.FormattedPublicKey = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	}))
+	return entry, nil
+}
+
 func (p *Policy) migrateKeyToKeysMap() {
 	p.Keys = KeyEntryMap{
 		1: KeyEntry{
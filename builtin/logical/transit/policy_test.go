@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/hashicorp/vault/helper/kdf"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -22,7 +23,7 @@ func Test_KeyUpgrade(t *testing.T) {
 
 func testKeyUpgradeCommon(t *testing.T, lm *lockManager) {
 	storage := &logical.InmemStorage{}
-	p, lock, upserted, err := lm.GetPolicyUpsert(storage, "test", false, false)
+	p, lock, upserted, err := lm.GetPolicyUpsert(policyRequest{storage: storage, name: "test"})
 	if lock != nil {
 		defer lock.RUnlock()
 	}
@@ -53,6 +54,55 @@ func testKeyUpgradeCommon(t *testing.T, lm *lockManager) {
 	}
 }
 
+func Test_DeriveKey(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	p, lock, _, err := newLockManager(true).GetPolicyUpsert(policyRequest{storage: storage, name: "test", derived: true})
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.KDFMode != kdfModeHKDF {
+		t.Fatalf("bad: %s", p.KDFMode)
+	}
+
+	// Each context derives its own key
+	key1, err := p.DeriveKey([]byte("tenant-1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key2, err := p.DeriveKey([]byte("tenant-2"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key1) != 32 || reflect.DeepEqual(key1, key2) || reflect.DeepEqual(key1, p.Keys[1].Key) {
+		t.Fatalf("bad: %x %x", key1, key2)
+	}
+	if _, err := p.DeriveKey(nil, 1); err == nil {
+		t.Fatal("expected error")
+	}
+
+	ciphertext, err := p.Encrypt([]byte("tenant-1"), nil, "Zm9vIGJhcg==")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Decrypt([]byte("tenant-2"), nil, ciphertext); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Keys derived before HKDF keep using the counter mode KDF
+	p.KDFMode = kdfModeCounter
+	legacy, err := p.DeriveKey([]byte("tenant-1"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := kdf.CounterMode(kdf.HMACSHA256PRF, kdf.HMACSHA256PRFLen, p.Keys[1].Key, []byte("tenant-1"), 256)
+	if !reflect.DeepEqual(legacy, expected) {
+		t.Fatalf("bad: %x", legacy)
+	}
+}
+
 func Test_ArchivingUpgrade(t *testing.T) {
 	testArchivingUpgradeCommon(t, newLockManager(false))
 	testArchivingUpgradeCommon(t, newLockManager(true))
@@ -68,7 +118,7 @@ func testArchivingUpgradeCommon(t *testing.T, lm *lockManager) {
 
 	storage := &logical.InmemStorage{}
 
-	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", false, false)
+	p, lock, _, err := lm.GetPolicyUpsert(policyRequest{storage: storage, name: "test"})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -198,7 +248,7 @@ func testArchivingCommon(t *testing.T, lm *lockManager) {
 
 	storage := &logical.InmemStorage{}
 
-	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", false, false)
+	p, lock, _, err := lm.GetPolicyUpsert(policyRequest{storage: storage, name: "test"})
 	if lock != nil {
 		defer lock.RUnlock()
 	}
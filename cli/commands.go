@@ -11,21 +11,36 @@ import (
 	credAppId "github.com/hashicorp/vault/builtin/credential/app-id"
 	credAppRole "github.com/hashicorp/vault/builtin/credential/approle"
 	credAwsEc2 "github.com/hashicorp/vault/builtin/credential/aws-ec2"
+	credAzure "github.com/hashicorp/vault/builtin/credential/azure"
 	credCert "github.com/hashicorp/vault/builtin/credential/cert"
+	credGcp "github.com/hashicorp/vault/builtin/credential/gcp"
 	credGitHub "github.com/hashicorp/vault/builtin/credential/github"
+	credJWT "github.com/hashicorp/vault/builtin/credential/jwt"
+	credKerberos "github.com/hashicorp/vault/builtin/credential/kerberos"
+	credKube "github.com/hashicorp/vault/builtin/credential/kubernetes"
 	credLdap "github.com/hashicorp/vault/builtin/credential/ldap"
+	credOkta "github.com/hashicorp/vault/builtin/credential/okta"
 	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
 
+	"github.com/hashicorp/vault/builtin/logical/ad"
 	"github.com/hashicorp/vault/builtin/logical/aws"
+	"github.com/hashicorp/vault/builtin/logical/azure"
 	"github.com/hashicorp/vault/builtin/logical/cassandra"
 	"github.com/hashicorp/vault/builtin/logical/consul"
+	"github.com/hashicorp/vault/builtin/logical/database"
+	"github.com/hashicorp/vault/builtin/logical/gcp"
+	"github.com/hashicorp/vault/builtin/logical/kv"
 	"github.com/hashicorp/vault/builtin/logical/mongodb"
+	"github.com/hashicorp/vault/builtin/logical/mongodbatlas"
 	"github.com/hashicorp/vault/builtin/logical/mssql"
 	"github.com/hashicorp/vault/builtin/logical/mysql"
+	"github.com/hashicorp/vault/builtin/logical/nomad"
 	"github.com/hashicorp/vault/builtin/logical/pki"
 	"github.com/hashicorp/vault/builtin/logical/postgresql"
 	"github.com/hashicorp/vault/builtin/logical/rabbitmq"
 	"github.com/hashicorp/vault/builtin/logical/ssh"
+	"github.com/hashicorp/vault/builtin/logical/totp"
+	"github.com/hashicorp/vault/builtin/logical/transform"
 	"github.com/hashicorp/vault/builtin/logical/transit"
 
 	"github.com/hashicorp/vault/audit"
@@ -66,26 +81,44 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"syslog": auditSyslog.Factory,
 				},
 				CredentialBackends: map[string]logical.Factory{
-					"approle":  credAppRole.Factory,
-					"cert":     credCert.Factory,
-					"aws-ec2":  credAwsEc2.Factory,
-					"app-id":   credAppId.Factory,
-					"github":   credGitHub.Factory,
-					"userpass": credUserpass.Factory,
-					"ldap":     credLdap.Factory,
+					"approle":    credAppRole.Factory,
+					"cert":       credCert.Factory,
+					"aws-ec2":    credAwsEc2.Factory,
+					"azure":      credAzure.Factory,
+					"app-id":     credAppId.Factory,
+					"gcp":        credGcp.Factory,
+					"github":     credGitHub.Factory,
+					"jwt":        credJWT.Factory,
+					"kerberos":   credKerberos.Factory,
+					"kubernetes": credKube.Factory,
+					"oidc":       credJWT.Factory,
+					"okta":       credOkta.Factory,
+					"userpass":   credUserpass.Factory,
+					"ldap":       credLdap.Factory,
 				},
 				LogicalBackends: map[string]logical.Factory{
-					"aws":        aws.Factory,
-					"consul":     consul.Factory,
-					"postgresql": postgresql.Factory,
-					"cassandra":  cassandra.Factory,
-					"pki":        pki.Factory,
-					"transit":    transit.Factory,
-					"mongodb":    mongodb.Factory,
-					"mssql":      mssql.Factory,
-					"mysql":      mysql.Factory,
-					"ssh":        ssh.Factory,
-					"rabbitmq":   rabbitmq.Factory,
+					"ad":           ad.Factory,
+					"aws":          aws.Factory,
+					"azure":        azure.Factory,
+					"consul":       consul.Factory,
+					"database":     database.Factory,
+					"gcp":          gcp.Factory,
+					"pki":          pki.Factory,
+					"transit":      transit.Factory,
+					"transform":    transform.Factory,
+					"totp":         totp.Factory,
+					"kv":           kv.Factory,
+					"mongodb":      mongodb.Factory,
+					"mongodbatlas": mongodbatlas.Factory,
+					"nomad":        nomad.Factory,
+					"ssh":          ssh.Factory,
+					"rabbitmq":     rabbitmq.Factory,
+
+					// Deprecated in favor of the database backend
+					"cassandra":  deprecatedBackend("cassandra", cassandra.Factory),
+					"mssql":      deprecatedBackend("mssql", mssql.Factory),
+					"mysql":      deprecatedBackend("mysql", mysql.Factory),
+					"postgresql": deprecatedBackend("postgresql", postgresql.Factory),
 				},
 				ShutdownCh:  command.MakeShutdownCh(),
 				SighupCh:    command.MakeSighupCh(),
@@ -112,6 +145,7 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"github":   &credGitHub.CLIHandler{},
 					"userpass": &credUserpass.CLIHandler{},
 					"ldap":     &credLdap.CLIHandler{},
+					"okta":     &credOkta.CLIHandler{},
 					"cert":     &credCert.CLIHandler{},
 				},
 			}, nil
@@ -325,3 +359,14 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 		},
 	}
 }
+
+// deprecatedBackend wraps the factory of a deprecated logical backend,
+// logging a warning whenever a mount of it is set up
+func deprecatedBackend(name string, f logical.Factory) logical.Factory {
+	return func(conf *logical.BackendConfig) (logical.Backend, error) {
+		if conf.Logger != nil {
+			conf.Logger.Printf("[WARN] core: the %s backend is deprecated in favor of the database backend, and will be removed in a future release", name)
+		}
+		return f(conf)
+	}
+}
@@ -15,6 +15,16 @@ import (
 	"github.com/hashicorp/vault/meta"
 )
 
+const (
+	// otpLength is the length of OTPs, which encode the ID of a service
+	// token: its "s." prefix followed by a UUID
+	otpLength = 38
+
+	// legacyOTPLength is the length of OTPs used by Vault servers that
+	// predate typed token prefixes, which encode the raw bytes of a UUID
+	legacyOTPLength = 16
+)
+
 // GenerateRootCommand is a Command that generates a new root token.
 type GenerateRootCommand struct {
 	meta.Meta
@@ -46,14 +56,14 @@ func (c *GenerateRootCommand) Run(args []string) int {
 	}
 
 	if genotp {
-		buf := make([]byte, 16)
+		buf := make([]byte, otpLength)
 		readLen, err := rand.Read(buf)
 		if err != nil {
 			c.Ui.Error(fmt.Sprintf("Error reading random bytes: %s", err))
 			return 1
 		}
-		if readLen != 16 {
-			c.Ui.Error(fmt.Sprintf("Read %d bytes when we should have read 16", readLen))
+		if readLen != otpLength {
+			c.Ui.Error(fmt.Sprintf("Read %d bytes when we should have read %d", readLen, otpLength))
 			return 1
 		}
 		c.Ui.Output(fmt.Sprintf("OTP: %s", base64.StdEncoding.EncodeToString(buf)))
@@ -197,7 +207,7 @@ func (c *GenerateRootCommand) verifyOTP(otp string) error {
 	if err != nil {
 		return fmt.Errorf("Error decoding base64 OTP value: %s", err)
 	}
-	if otpBytes == nil || len(otpBytes) != 16 {
+	if otpBytes == nil || (len(otpBytes) != otpLength && len(otpBytes) != legacyOTPLength) {
 		return fmt.Errorf("Decoded OTP value is invalid or wrong length")
 	}
 
@@ -211,10 +221,14 @@ func (c *GenerateRootCommand) decode(encodedVal, otp string) int {
 		return 1
 	}
 
-	token, err := uuid.FormatUUID(tokenBytes)
-	if err != nil {
-		c.Ui.Error(fmt.Sprintf("Error formatting base64 token value: %v", err))
-		return 1
+	// Legacy OTPs encode the raw bytes of a UUID, rather than the token ID
+	token := string(tokenBytes)
+	if len(tokenBytes) == legacyOTPLength {
+		token, err = uuid.FormatUUID(tokenBytes)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error formatting base64 token value: %v", err))
+			return 1
+		}
 	}
 
 	c.Ui.Output(fmt.Sprintf("Root token: %s", token))
@@ -302,11 +316,12 @@ Usage: vault generate-root [options] [key]
   One (and only one) of the following must be provided at attempt
   initialization time:
   
-  1) A 16-byte, base64-encoded One Time Password (OTP) provided in the '-otp'
+  1) A 38-byte, base64-encoded One Time Password (OTP) provided in the '-otp'
   flag; the token is XOR'd with this value before it is returned once the final
   unseal key has been provided. The '-decode' operation can be used with this
   value and the OTP to output the final token value. The '-genotp' flag can be
-  used to generate a suitable value.
+  used to generate a suitable value. Legacy 16-byte OTPs are also accepted,
+  in which case the root token is a UUID rather than a typed token.
 
   or
 
@@ -335,7 +350,7 @@ Rekey Options:
   -genotp                 Returns a high-quality OTP suitable for passing into
                           the '-init' method.
 
-  -otp=abcd               The base64-encoded 16-byte OTP for use with the
+  -otp=abcd               The base64-encoded 38-byte OTP for use with the
                           '-init' or '-decode' methods.
 
   -pgp-key                A file on disk containing a binary- or base64-format
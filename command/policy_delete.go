@@ -13,7 +13,9 @@ type PolicyDeleteCommand struct {
 }
 
 func (c *PolicyDeleteCommand) Run(args []string) int {
+	var revoke bool
 	flags := c.Meta.FlagSet("policy-delete", meta.FlagSetDefault)
+	flags.BoolVar(&revoke, "revoke", false, "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -35,6 +37,19 @@ func (c *PolicyDeleteCommand) Run(args []string) int {
 	}
 
 	name := args[0]
+	if revoke {
+		revoked, err := client.Sys().DeletePolicyRevoke(name)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error: %s", err))
+			return 1
+		}
+
+		c.Ui.Output(fmt.Sprintf(
+			"Policy '%s' deleted and %d token(s) referencing it revoked.", name, revoked))
+		return 0
+	}
+
 	if err := client.Sys().DeletePolicy(name); err != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Error: %s", err))
@@ -60,6 +75,11 @@ Usage: vault policy-delete [options] name
   doesn't exist, it is identical to not being associated with that policy.
 
 General Options:
-` + meta.GeneralOptionsUsage()
+` + meta.GeneralOptionsUsage() + `
+Policy Delete Options:
+
+  -revoke                 Revoke the tokens referencing the policy, and their
+                          children, along with deleting it.
+`
 	return strings.TrimSpace(helpText)
 }
@@ -2,8 +2,10 @@ package command
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"strings"
 
@@ -16,7 +18,9 @@ type PolicyWriteCommand struct {
 }
 
 func (c *PolicyWriteCommand) Run(args []string) int {
+	var signaturePath string
 	flags := c.Meta.FlagSet("policy-write", meta.FlagSetDefault)
+	flags.StringVar(&signaturePath, "signature", "", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -60,7 +64,24 @@ func (c *PolicyWriteCommand) Run(args []string) int {
 	}
 	rules := buf.String()
 
-	if err := client.Sys().PutPolicy(name, rules); err != nil {
+	if signaturePath != "" {
+		sig, err := ioutil.ReadFile(signaturePath)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error reading signature: %s", err))
+			return 1
+		}
+
+		// Binary signatures are sent base64-encoded, armored ones as-is
+		signature := string(sig)
+		if !bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+			signature = base64.StdEncoding.EncodeToString(sig)
+		}
+		err = client.Sys().PutPolicySigned(name, rules, signature)
+	} else {
+		err = client.Sys().PutPolicy(name, rules)
+	}
+	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Error: %s", err))
 		return 1
@@ -84,6 +105,12 @@ Usage: vault policy-write [options] name path
   loaded from the file at the given path.
 
 General Options:
-` + meta.GeneralOptionsUsage()
+` + meta.GeneralOptionsUsage() + `
+Policy Write Options:
+
+  -signature=path         Path to a detached PGP signature of the policy file,
+                          such as one made by "gpg --detach-sign". It is
+                          checked against the keys trusted to sign policies.
+`
 	return strings.TrimSpace(helpText)
 }
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/helper/kv-builder"
 	"github.com/hashicorp/vault/meta"
 )
 
@@ -29,8 +30,8 @@ func (c *ReadCommand) Run(args []string) int {
 	}
 
 	args = flags.Args()
-	if len(args) != 1 || len(args[0]) == 0 {
-		c.Ui.Error("read expects one argument")
+	if len(args) < 1 || len(args[0]) == 0 {
+		c.Ui.Error("read expects at least one argument")
 		flags.Usage()
 		return 1
 	}
@@ -40,6 +41,13 @@ func (c *ReadCommand) Run(args []string) int {
 		path = path[1:]
 	}
 
+	data, err := parseQueryData(args[1:])
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error loading data: %s", err))
+		return 1
+	}
+
 	client, err := c.Client()
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
@@ -47,7 +55,7 @@ func (c *ReadCommand) Run(args []string) int {
 		return 2
 	}
 
-	secret, err = client.Logical().Read(path)
+	secret, err = client.Logical().ReadWithData(path, data)
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Error reading %s: %s", path, err))
@@ -67,13 +75,28 @@ func (c *ReadCommand) Run(args []string) int {
 	return OutputSecret(c.Ui, format, secret)
 }
 
+// parseQueryData parses key=value arguments into the query parameters of
+// a request
+func parseQueryData(args []string) (map[string][]string, error) {
+	builder := &kvbuilder.Builder{}
+	if err := builder.Add(args...); err != nil {
+		return nil, err
+	}
+
+	data := make(map[string][]string)
+	for k, v := range builder.Map() {
+		data[k] = []string{fmt.Sprintf("%v", v)}
+	}
+	return data, nil
+}
+
 func (c *ReadCommand) Synopsis() string {
 	return "Read data or secrets from Vault"
 }
 
 func (c *ReadCommand) Help() string {
 	helpText := `
-Usage: vault read [options] path
+Usage: vault read [options] path [data]
 
   Read data from Vault.
 
@@ -82,6 +105,11 @@ Usage: vault read [options] path
   materialized backends. Please reference the documentation for the
   backends in use to determine key structure.
 
+  Data given as key=value pairs is sent as query parameters, such as
+  the version of a versioned secret:
+
+      $ vault read kv/data/my-secret version=1
+
 General Options:
 ` + meta.GeneralOptionsUsage() + `
 Read Options:
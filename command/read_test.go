@@ -1,8 +1,11 @@
 package command
 
 import (
+	"encoding/json"
 	"testing"
 
+	"github.com/hashicorp/vault/api"
+	"github.com/hashicorp/vault/builtin/logical/kv"
 	"github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/meta"
 	"github.com/hashicorp/vault/vault"
@@ -135,3 +138,63 @@ func TestRead_field_notFound(t *testing.T) {
 		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
 	}
 }
+
+func TestRead_version(t *testing.T) {
+	if err := vault.AddTestLogicalBackend("kv", kv.Factory); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	ui := new(cli.MockUi)
+	c := &ReadCommand{
+		Meta: meta.Meta{
+			ClientToken: token,
+			Ui:          ui,
+		},
+	}
+
+	args := []string{
+		"-address", addr,
+		"-format", "json",
+		"kv/data/foo",
+		"version=1",
+	}
+
+	// Run once so the client is setup, ignore errors
+	c.Run(args)
+
+	// Get the client so we can write versions
+	client, err := c.Client()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := client.Sys().Mount("kv", &api.MountInput{Type: "kv"}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	for _, value := range []string{"1", "2"} {
+		data := map[string]interface{}{
+			"data": map[string]interface{}{"value": value},
+		}
+		if _, err := client.Logical().Write("kv/data/foo", data); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Run the read of the older version
+	ui.OutputWriter.Reset()
+	if code := c.Run(args); code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+
+	var secret api.Secret
+	if err := json.Unmarshal(ui.OutputWriter.Bytes(), &secret); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	value := secret.Data["data"].(map[string]interface{})["value"]
+	if value != "1" {
+		t.Fatalf("bad: %#v", value)
+	}
+}
@@ -188,6 +188,7 @@ func (c *ServerCommand) Run(args []string) int {
 		Logger:             c.logger,
 		DisableCache:       config.DisableCache,
 		DisableMlock:       config.DisableMlock,
+		PolicyCacheSize:    config.PolicyCacheSize,
 		MaxLeaseTTL:        config.MaxLeaseTTL,
 		DefaultLeaseTTL:    config.DefaultLeaseTTL,
 		ClusterName:        config.ClusterName,
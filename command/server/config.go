@@ -27,6 +27,8 @@ type Config struct {
 	DisableCache bool `hcl:"disable_cache"`
 	DisableMlock bool `hcl:"disable_mlock"`
 
+	PolicyCacheSize int `hcl:"policy_cache_size"`
+
 	Telemetry *Telemetry `hcl:"telemetry"`
 
 	MaxLeaseTTL        time.Duration `hcl:"-"`
@@ -212,6 +214,11 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.DefaultLeaseTTL = c2.DefaultLeaseTTL
 	}
 
+	result.PolicyCacheSize = c.PolicyCacheSize
+	if c2.PolicyCacheSize != 0 {
+		result.PolicyCacheSize = c2.PolicyCacheSize
+	}
+
 	result.ClusterName = c.ClusterName
 	if c2.ClusterName != "" {
 		result.ClusterName = c2.ClusterName
@@ -281,6 +288,7 @@ func ParseConfig(d string) (*Config, error) {
 		"listener",
 		"disable_cache",
 		"disable_mlock",
+		"policy_cache_size",
 		"telemetry",
 		"default_lease_ttl",
 		"max_lease_ttl",
@@ -57,6 +57,8 @@ func TestLoadConfigFile(t *testing.T) {
 		DisableCache: true,
 		DisableMlock: true,
 
+		PolicyCacheSize: 4096,
+
 		MaxLeaseTTL:        10 * time.Hour,
 		MaxLeaseTTLRaw:     "10h",
 		DefaultLeaseTTL:    10 * time.Hour,
@@ -1,5 +1,6 @@
 disable_cache = true
 disable_mlock = true
+policy_cache_size = 4096
 statsd_addr = "bar"
 statsite_addr = "foo"
 
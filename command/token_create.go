@@ -17,11 +17,11 @@ type TokenCreateCommand struct {
 
 func (c *TokenCreateCommand) Run(args []string) int {
 	var format string
-	var id, displayName, lease, ttl, explicitMaxTTL, role string
+	var id, displayName, lease, ttl, explicitMaxTTL, period, role, tokenType string
 	var orphan, noDefaultPolicy, renewable bool
 	var metadata map[string]string
 	var numUses int
-	var policies []string
+	var policies, boundCIDRs []string
 	flags := c.Meta.FlagSet("mount", meta.FlagSetDefault)
 	flags.StringVar(&format, "format", "table", "")
 	flags.StringVar(&displayName, "display-name", "", "")
@@ -29,13 +29,16 @@ func (c *TokenCreateCommand) Run(args []string) int {
 	flags.StringVar(&lease, "lease", "", "")
 	flags.StringVar(&ttl, "ttl", "", "")
 	flags.StringVar(&explicitMaxTTL, "explicit-max-ttl", "", "")
+	flags.StringVar(&period, "period", "", "")
 	flags.StringVar(&role, "role", "", "")
+	flags.StringVar(&tokenType, "type", "", "")
 	flags.BoolVar(&orphan, "orphan", false, "")
 	flags.BoolVar(&renewable, "renewable", true, "")
 	flags.BoolVar(&noDefaultPolicy, "no-default-policy", false, "")
 	flags.IntVar(&numUses, "use-limit", 0, "")
 	flags.Var((*kvFlag.Flag)(&metadata), "metadata", "")
 	flags.Var((*sliceflag.StringFlag)(&policies), "policy", "")
+	flags.Var((*sliceflag.StringFlag)(&boundCIDRs), "bound-cidr", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -71,6 +74,9 @@ func (c *TokenCreateCommand) Run(args []string) int {
 		NumUses:         numUses,
 		Renewable:       new(bool),
 		ExplicitMaxTTL:  explicitMaxTTL,
+		Period:          period,
+		BoundCIDRs:      boundCIDRs,
+		Type:            tokenType,
 	}
 	*tcr.Renewable = renewable
 
@@ -135,6 +141,11 @@ Token Options:
                           configuration file, this lifetime is a hard limit set
                           on the token itself and cannot be exceeded.
 
+  -period="24h"           If specified, the token will be periodic: it has no
+                          maximum TTL, and every renewal resets its TTL to
+                          this period. A root token or sudo privileges are
+                          required to create a periodic token.
+
   -renewable=true         Whether or not the token is renewable to extend its
                           TTL up to Vault's configured maximum TTL for tokens.
                           This defaults to true; set to false to disable
@@ -157,6 +168,15 @@ Token Options:
   -use-limit=5            The number of times this token can be used until
                           it is automatically revoked.
 
+  -bound-cidr="10.0.0.0/8"  CIDR block the token can be used from. This can
+                          be specified multiple times. Tokens created by a
+                          token bound to CIDR blocks are bound within them.
+
+  -type=batch             The type of token to create, "service" or "batch".
+                          Batch tokens are not persisted, and cannot be
+                          renewed, revoked or used to create child tokens.
+                          They must have a TTL. Defaults to "service".
+
   -format=table           The format for output. By default it is a whitespace-
                           delimited table. This can also be json or yaml.
 
@@ -37,8 +37,10 @@ func (c *UnwrapCommand) Run(args []string) int {
 		return 1
 	}
 
+	// Wrapping tokens are service tokens, whose IDs are a UUID with a typed
+	// prefix unless they predate prefixes
 	tokenID := args[0]
-	_, err = uuid.ParseUUID(tokenID)
+	_, err = uuid.ParseUUID(strings.TrimPrefix(tokenID, "s."))
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf(
 			"Given token could not be parsed as a UUID: %s", err))
@@ -73,6 +73,13 @@ type CertBundle struct {
 	IssuingCA      string         `json:"issuing_ca" structs:"issuing_ca" mapstructure:"issuing_ca"`
 	PrivateKey     string         `json:"private_key" structs:"private_key" mapstructure:"private_key"`
 	SerialNumber   string         `json:"serial_number" structs:"serial_number" mapstructure:"serial_number"`
+	CAChain        []string       `json:"ca_chain,omitempty" structs:"ca_chain,omitempty" mapstructure:"ca_chain"`
+}
+
+// CertBlock contains a certificate and its DER-encoded bytes
+type CertBlock struct {
+	Certificate *x509.Certificate
+	Bytes       []byte
 }
 
 // ParsedCertBundle contains a key type, a DER-encoded private key,
@@ -86,6 +93,7 @@ type ParsedCertBundle struct {
 	IssuingCA        *x509.Certificate
 	CertificateBytes []byte
 	Certificate      *x509.Certificate
+	CAChain          []*CertBlock
 }
 
 // CSRBundle contains a key type, a PEM-encoded private key,
@@ -173,6 +181,21 @@ func (c *CertBundle) ToParsedCertBundle() (*ParsedCertBundle, error) {
 		}
 	}
 
+	for _, certPEM := range c.CAChain {
+		pemBlock, _ = pem.Decode([]byte(certPEM))
+		if pemBlock == nil {
+			return nil, errutil.UserError{"Error decoding CA chain certificate from cert bundle"}
+		}
+		cert, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			return nil, errutil.UserError{fmt.Sprintf("Error parsing CA chain certificate: %s", err)}
+		}
+		result.CAChain = append(result.CAChain, &CertBlock{
+			Certificate: cert,
+			Bytes:       pemBlock.Bytes,
+		})
+	}
+
 	if len(c.SerialNumber) == 0 && len(c.Certificate) > 0 {
 		c.SerialNumber = GetOctalFormatted(result.Certificate.SerialNumber.Bytes(), ":")
 	}
@@ -202,6 +225,11 @@ func (p *ParsedCertBundle) ToCertBundle() (*CertBundle, error) {
 		result.IssuingCA = strings.TrimSpace(string(pem.EncodeToMemory(&block)))
 	}
 
+	for _, caCert := range p.CAChain {
+		block.Bytes = caCert.Bytes
+		result.CAChain = append(result.CAChain, strings.TrimSpace(string(pem.EncodeToMemory(&block))))
+	}
+
 	if p.PrivateKeyBytes != nil && len(p.PrivateKeyBytes) > 0 {
 		block.Type = string(p.PrivateKeyFormat)
 		block.Bytes = p.PrivateKeyBytes
@@ -271,6 +299,20 @@ func (p *ParsedCertBundle) SetParsedPrivateKey(privateKey crypto.Signer, private
 	p.PrivateKeyBytes = privateKeyBytes
 }
 
+// GetCAChain returns the chain of a certificate issued with this bundle: its
+// certificate, followed by the chain of its issuers
+func (p *ParsedCertBundle) GetCAChain() []*CertBlock {
+	if p.Certificate == nil {
+		return nil
+	}
+
+	chain := []*CertBlock{&CertBlock{
+		Certificate: p.Certificate,
+		Bytes:       p.CertificateBytes,
+	}}
+	return append(chain, p.CAChain...)
+}
+
 func getPKCS8Type(bs []byte) (PrivateKeyType, error) {
 	k, err := x509.ParsePKCS8PrivateKey(bs)
 	if err != nil {
@@ -0,0 +1,63 @@
+package cronutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * FOO *",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Fatalf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2017, 5, 10, 13, 37, 42, 0, time.UTC)
+	for spec, expected := range map[string]time.Time{
+		"* * * * *":       time.Date(2017, 5, 10, 13, 38, 0, 0, time.UTC),
+		"*/15 * * * *":    time.Date(2017, 5, 10, 13, 45, 0, 0, time.UTC),
+		"5/20 * * * *":    time.Date(2017, 5, 10, 13, 45, 0, 0, time.UTC),
+		"0 3 * * *":       time.Date(2017, 5, 11, 3, 0, 0, 0, time.UTC),
+		"30 12 * * *":     time.Date(2017, 5, 11, 12, 30, 0, 0, time.UTC),
+		"0 0 1 * *":       time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 * * SUN":     time.Date(2017, 5, 14, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":       time.Date(2017, 5, 14, 0, 0, 0, 0, time.UTC),
+		"0 9 * * mon-fri": time.Date(2017, 5, 11, 9, 0, 0, 0, time.UTC),
+		"0 0 29 feb *":    time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"0,30 8-10 * * *": time.Date(2017, 5, 11, 8, 0, 0, 0, time.UTC),
+		"0 0 31 * *":      time.Date(2017, 5, 31, 0, 0, 0, 0, time.UTC),
+		"0 0 15 * FRI":    time.Date(2017, 5, 12, 0, 0, 0, 0, time.UTC),
+		"0 0 1 jan,jul *": time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC),
+		"59 23 31 DEC *":  time.Date(2017, 12, 31, 23, 59, 0, 0, time.UTC),
+	} {
+		s, err := Parse(spec)
+		if err != nil {
+			t.Fatalf("%s: %s", spec, err)
+		}
+		if next := s.Next(now); !next.Equal(expected) {
+			t.Fatalf("%s: expected %s, got %s", spec, expected, next)
+		}
+	}
+
+	s, err := Parse("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(now); !next.IsZero() {
+		t.Fatalf("expected no activation, got %s", next)
+	}
+}
@@ -0,0 +1,371 @@
+// Package jwtutil parses JWTs in compact serialization and verifies them
+// with RSA or ECDSA public keys, given as PEM or as a JWKS.
+package jwtutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+// ClockSkewLeeway is the leeway allowed when validating the times in the
+// claims of a JWT, accounting for clock skew between Vault and the issuer
+const ClockSkewLeeway = time.Minute
+
+// signingHashes are the hashes of the supported signing algorithms. Only
+// asymmetric algorithms are supported, as the keys are public.
+var signingHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// Header is the header of a JWT, limited to the fields used here
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// JWT is a parsed JWT. Its claims cannot be trusted until Verify succeeds.
+type JWT struct {
+	Header Header
+
+	// Claims are the decoded claims of the JWT. Numbers are decoded as
+	// json.Number.
+	Claims map[string]interface{}
+
+	signed    []byte
+	signature []byte
+}
+
+// Parse decodes a JWT in compact serialization
+func Parse(raw string) (*JWT, error) {
+	parts := strings.Split(strings.TrimSpace(raw), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed JWT")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %s", err)
+	}
+	var header Header
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("malformed JWT header: %s", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %s", err)
+	}
+	var claims map[string]interface{}
+	if err := jsonutil.DecodeJSON(payload, &claims); err != nil {
+		return nil, fmt.Errorf("malformed JWT payload: %s", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed JWT signature: %s", err)
+	}
+
+	return &JWT{
+		Header:    header,
+		Claims:    claims,
+		signed:    []byte(parts[0] + "." + parts[1]),
+		signature: signature,
+	}, nil
+}
+
+// Verify checks the signature of the JWT against the given keys. Keys with
+// an ID are only tried if the JWT names that ID, or names none.
+func (j *JWT) Verify(keys []*PublicKey) error {
+	hash, ok := signingHashes[j.Header.Alg]
+	if !ok {
+		return fmt.Errorf("unsupported JWT signing algorithm %q", j.Header.Alg)
+	}
+	h := hash.New()
+	h.Write(j.signed)
+	digest := h.Sum(nil)
+
+	for _, key := range keys {
+		if j.Header.Kid != "" && key.ID != "" && j.Header.Kid != key.ID {
+			continue
+		}
+
+		switch k := key.Key.(type) {
+		case *rsa.PublicKey:
+			if !strings.HasPrefix(j.Header.Alg, "RS") {
+				continue
+			}
+			if rsa.VerifyPKCS1v15(k, hash, digest, j.signature) == nil {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if !strings.HasPrefix(j.Header.Alg, "ES") {
+				continue
+			}
+			// ECDSA signatures are the concatenation of r and s, each the
+			// size of the curve
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if len(j.signature) != 2*size {
+				continue
+			}
+			r := new(big.Int).SetBytes(j.signature[:size])
+			s := new(big.Int).SetBytes(j.signature[size:])
+			if ecdsa.Verify(k, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("failed to verify JWT signature")
+}
+
+// ValidateTimes checks that the JWT has not expired and is already valid.
+// JWTs must expire.
+func (j *JWT) ValidateTimes(now time.Time) error {
+	exp, ok, err := j.TimeClaim("exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("JWT has no expiration time")
+	}
+	if now.After(exp.Add(ClockSkewLeeway)) {
+		return fmt.Errorf("JWT has expired")
+	}
+
+	for _, claim := range []string{"nbf", "iat"} {
+		t, ok, err := j.TimeClaim(claim)
+		if err != nil {
+			return err
+		}
+		if ok && now.Add(ClockSkewLeeway).Before(t) {
+			return fmt.Errorf("JWT is not valid yet")
+		}
+	}
+	return nil
+}
+
+// TimeClaim returns the time held by the given claim, if set
+func (j *JWT) TimeClaim(claim string) (time.Time, bool, error) {
+	raw, ok := j.Claims[claim]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	number, ok := raw.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("invalid %q claim", claim)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %q claim: %s", claim, err)
+	}
+	return time.Unix(int64(seconds), 0), true, nil
+}
+
+// StringClaim returns the value of the given claim, which must be a
+// string, a number or a boolean
+func (j *JWT) StringClaim(claim string) (string, bool) {
+	return claimString(j.Claims[claim])
+}
+
+// StringsClaim returns the values of the given claim, which may also be a
+// list of them
+func (j *JWT) StringsClaim(claim string) []string {
+	raw, ok := j.Claims[claim].([]interface{})
+	if !ok {
+		raw = []interface{}{j.Claims[claim]}
+	}
+
+	var values []string
+	for _, value := range raw {
+		if s, ok := claimString(value); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+func claimString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprintf("%t", v), true
+	default:
+		return "", false
+	}
+}
+
+// PublicKey is a key JWTs can be verified with, along with its ID if it
+// came from a JWKS
+type PublicKey struct {
+	ID  string
+	Key crypto.PublicKey
+}
+
+// HasKeyID returns whether one of the keys has the given ID
+func HasKeyID(keys []*PublicKey, id string) bool {
+	for _, key := range keys {
+		if key.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePublicKeysPEM parses PEM encoded public keys or certificates
+func ParsePublicKeysPEM(pems []string) ([]*PublicKey, error) {
+	var keys []*PublicKey
+	for _, p := range pems {
+		block, _ := pem.Decode([]byte(p))
+		if block == nil {
+			return nil, fmt.Errorf("no PEM data found")
+		}
+
+		var key crypto.PublicKey
+		switch block.Type {
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			key = cert.PublicKey
+		default:
+			var err error
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey:
+		default:
+			return nil, fmt.Errorf("only RSA and ECDSA keys are supported")
+		}
+		keys = append(keys, &PublicKey{Key: key})
+	}
+	return keys, nil
+}
+
+// JSONWebKey is a key of a JWKS, limited to the fields of RSA and EC keys
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// ParseJWKS reads the keys of a JWKS. Keys of other types, or not used for
+// signatures, are skipped.
+func ParseJWKS(r io.Reader) ([]*PublicKey, error) {
+	var jwks struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := jsonutil.DecodeJSONFromReader(r, &jwks); err != nil {
+		return nil, fmt.Errorf("error decoding JWKS: %s", err)
+	}
+
+	var keys []*PublicKey
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch jwk.Kty {
+		case "RSA":
+			key, err = jwk.rsaKey()
+		case "EC":
+			key, err = jwk.ecdsaKey()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q in JWKS: %s", jwk.Kid, err)
+		}
+		keys = append(keys, &PublicKey{ID: jwk.Kid, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no supported signing keys found in JWKS")
+	}
+	return keys, nil
+}
+
+func (k *JSONWebKey) rsaKey() (*rsa.PublicKey, error) {
+	n, err := decodeBigInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeBigInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func (k *JSONWebKey) ecdsaKey() (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := decodeBigInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeBigInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing key parameter")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
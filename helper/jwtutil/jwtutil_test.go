@@ -0,0 +1,177 @@
+package jwtutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+)
+
+func publicKeyPEM(t *testing.T, key crypto.Signer) string {
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func testClaims(issuer string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":    issuer,
+		"sub":    "alice",
+		"aud":    []string{"vault", "other"},
+		"exp":    now.Add(time.Minute).Unix(),
+		"iat":    now.Unix(),
+		"groups": []string{"dev", "ops"},
+	}
+}
+
+func generateKeys(t *testing.T) (*rsa.PrivateKey, *ecdsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rsaKey, ecKey
+}
+
+func TestJWT_Verify(t *testing.T) {
+	rsaKey, ecKey := generateKeys(t)
+	keys, err := ParsePublicKeysPEM([]string{publicKeyPEM(t, rsaKey), publicKeyPEM(t, ecKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []crypto.Signer{rsaKey, ecKey} {
+		token, err := Parse(TestSign(t, key, "", testClaims("issuer")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := token.Verify(keys); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := token.ValidateTimes(time.Now()); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// JWTs signed with unknown keys, tampered with, or not signed are
+	// rejected
+	otherKey, _ := generateKeys(t)
+	token, err := Parse(TestSign(t, otherKey, "", testClaims("issuer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := token.Verify(keys); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	raw := TestSign(t, rsaKey, "", testClaims("issuer"))
+	parts := strings.Split(raw, ".")
+	claims := testClaims("issuer")
+	claims["sub"] = "mallory"
+	payload, _ := json.Marshal(claims)
+	token, err = Parse(parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := token.Verify(keys); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	token, err = Parse(header + "." + parts[1] + ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := token.Verify(keys); err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	// Expired JWTs, JWTs not valid yet, and JWTs that never expire are
+	// rejected
+	for _, tweak := range []func(map[string]interface{}){
+		func(c map[string]interface{}) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		func(c map[string]interface{}) { c["nbf"] = time.Now().Add(2 * time.Minute).Unix() },
+		func(c map[string]interface{}) { delete(c, "exp") },
+	} {
+		claims := testClaims("issuer")
+		tweak(claims)
+		token, err := Parse(TestSign(t, rsaKey, "", claims))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := token.ValidateTimes(time.Now()); err == nil {
+			t.Fatalf("%v: expected an error", claims)
+		}
+	}
+}
+
+func TestJWT_Claims(t *testing.T) {
+	rsaKey, _ := generateKeys(t)
+	token, err := Parse(TestSign(t, rsaKey, "1", testClaims("issuer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header.Alg != "RS256" || token.Header.Kid != "1" {
+		t.Fatalf("bad header: %#v", token.Header)
+	}
+	if sub, ok := token.StringClaim("sub"); !ok || sub != "alice" {
+		t.Fatalf("bad sub: %q", sub)
+	}
+	if _, ok := token.StringClaim("groups"); ok {
+		t.Fatalf("expected groups not to be a string claim")
+	}
+	if aud := token.StringsClaim("aud"); len(aud) != 2 || aud[0] != "vault" {
+		t.Fatalf("bad aud: %#v", aud)
+	}
+	if iss := token.StringsClaim("iss"); len(iss) != 1 || iss[0] != "issuer" {
+		t.Fatalf("bad iss: %#v", iss)
+	}
+	if _, ok, err := token.TimeClaim("exp"); err != nil || !ok {
+		t.Fatalf("expected an exp claim")
+	}
+
+	for _, raw := range []string{"", "a.b", "a.b.c", "a.b.c.d"} {
+		if _, err := Parse(raw); err == nil {
+			t.Fatalf("%q: expected an error", raw)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	key1, _ := generateKeys(t)
+	key2, _ := generateKeys(t)
+	keys, err := ParseJWKS(bytes.NewReader(TestJWKS(t, map[string]*rsa.PrivateKey{"1": key1, "2": key2})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !HasKeyID(keys, "1") || !HasKeyID(keys, "2") || HasKeyID(keys, "3") {
+		t.Fatalf("bad keys: %#v", keys)
+	}
+
+	token, err := Parse(TestSign(t, key2, "2", testClaims("issuer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := token.Verify(keys); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if _, err := ParseJWKS(strings.NewReader(`{"keys":[]}`)); err == nil {
+		t.Fatalf("expected an error")
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
+	"hash"
 )
 
 // PRF is a pseudo-random function that takes a key or seed,
@@ -75,3 +76,34 @@ func HMACSHA256PRF(key []byte, data []byte) ([]byte, error) {
 	hash.Write(data)
 	return hash.Sum(nil), nil
 }
+
+// HKDF implements the HMAC-based extract-and-expand KDF of RFC 5869. The
+// pseudo-random key is extracted from the secret and the optional salt, then
+// expanded with the info, which binds the derived key to its context.
+func HKDF(h func() hash.Hash, secret, salt, info []byte, length int) ([]byte, error) {
+	size := h().Size()
+	if length > 255*size {
+		return nil, fmt.Errorf("cannot derive more than %d bytes", 255*size)
+	}
+	if len(salt) == 0 {
+		salt = make([]byte, size)
+	}
+
+	// Extract
+	extractor := hmac.New(h, salt)
+	extractor.Write(secret)
+	prk := extractor.Sum(nil)
+
+	// Expand
+	expander := hmac.New(h, prk)
+	var out, prev []byte
+	for counter := byte(1); len(out) < length; counter++ {
+		expander.Reset()
+		expander.Write(prev)
+		expander.Write(info)
+		expander.Write([]byte{counter})
+		prev = expander.Sum(nil)
+		out = append(out, prev...)
+	}
+	return out[:length], nil
+}
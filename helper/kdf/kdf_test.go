@@ -2,6 +2,8 @@ package kdf
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"testing"
 )
 
@@ -70,3 +72,42 @@ func TestHMACSHA256PRF(t *testing.T) {
 		t.Fatalf("mis-matched output")
 	}
 }
+
+func TestHKDF(t *testing.T) {
+	// Test cases 1 and 3 of RFC 5869
+	cases := []struct {
+		secret, salt, info, okm string
+	}{
+		{
+			"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			"000102030405060708090a0b0c",
+			"f0f1f2f3f4f5f6f7f8f9",
+			"3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865",
+		},
+		{
+			"0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b",
+			"",
+			"",
+			"8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d9d201395faa4b61a96c8",
+		},
+	}
+
+	for _, c := range cases {
+		secret, _ := hex.DecodeString(c.secret)
+		salt, _ := hex.DecodeString(c.salt)
+		info, _ := hex.DecodeString(c.info)
+		expected, _ := hex.DecodeString(c.okm)
+
+		out, err := HKDF(sha256.New, secret, salt, info, len(expected))
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(out, expected) {
+			t.Fatalf("bad: %x", out)
+		}
+	}
+
+	if _, err := HKDF(sha256.New, []byte("secret"), nil, nil, 255*32+1); err == nil {
+		t.Fatalf("expected error")
+	}
+}
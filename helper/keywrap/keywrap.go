@@ -0,0 +1,97 @@
+// This package implements the AES key wrap with padding algorithm (KWP) of
+// RFC 5649, which is used to protect key material in transit, such as when
+// importing keys generated outside of Vault.
+package keywrap
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+)
+
+// alternativeIV is the constant high half of the initial value of KWP
+var alternativeIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// Wrap wraps the key with the key encryption key, which must be a valid AES
+// key
+func Wrap(kek, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key to wrap is empty")
+	}
+
+	// The initial value holds the length of the key, which is padded to a
+	// multiple of 8 bytes
+	n := (len(key) + 7) / 8
+	out := make([]byte, 8*(n+1))
+	copy(out, alternativeIV)
+	binary.BigEndian.PutUint32(out[4:8], uint32(len(key)))
+	copy(out[8:], key)
+
+	if n == 1 {
+		block.Encrypt(out, out)
+		return out, nil
+	}
+
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, out[:8])
+			copy(b[8:], out[8*i:8*i+8])
+			block.Encrypt(b, b)
+
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[8*i:8*i+8], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// Unwrap unwraps the key wrapped with the key encryption key, checking its
+// integrity
+func Unwrap(kek, wrapped []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, fmt.Errorf("invalid wrapped key length %d", len(wrapped))
+	}
+
+	n := len(wrapped)/8 - 1
+	out := make([]byte, len(wrapped))
+	copy(out, wrapped)
+
+	if n == 1 {
+		block.Decrypt(out, out)
+	} else {
+		b := make([]byte, 16)
+		for j := 5; j >= 0; j-- {
+			for i := n; i >= 1; i-- {
+				t := uint64(n*j + i)
+				binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(out[:8])^t)
+				copy(b[8:], out[8*i:8*i+8])
+				block.Decrypt(b, b)
+
+				copy(out[:8], b[:8])
+				copy(out[8*i:8*i+8], b[8:])
+			}
+		}
+	}
+
+	// Check the initial value, the length of the key and its padding
+	length := int(binary.BigEndian.Uint32(out[4:8]))
+	valid := subtle.ConstantTimeCompare(out[:4], alternativeIV) == 1 &&
+		length > 8*(n-1) && length <= 8*n &&
+		bytes.Equal(out[8+length:], make([]byte, 8*n-length))
+	if !valid {
+		return nil, fmt.Errorf("integrity check of the wrapped key failed")
+	}
+	return out[8 : 8+length], nil
+}
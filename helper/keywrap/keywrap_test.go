@@ -0,0 +1,65 @@
+package keywrap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	// Test vectors of RFC 5649, section 6
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	cases := []struct {
+		key     string
+		wrapped string
+	}{
+		{
+			key:     "c37b7e6492584340bed12207808941155068f738",
+			wrapped: "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+		},
+		{
+			key:     "466f7250617369",
+			wrapped: "afbeb0f07dfbf5419200f2ccb50bb24f",
+		},
+	}
+
+	for _, c := range cases {
+		key, _ := hex.DecodeString(c.key)
+		expected, _ := hex.DecodeString(c.wrapped)
+
+		wrapped, err := Wrap(kek, key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(wrapped, expected) {
+			t.Fatalf("bad: %x", wrapped)
+		}
+
+		unwrapped, err := Unwrap(kek, wrapped)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("bad: %x", unwrapped)
+		}
+
+		// Any change to the wrapped key is detected
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err := Unwrap(kek, wrapped); err == nil {
+			t.Fatalf("expected error")
+		}
+	}
+
+	// Keys of a multiple of 8 bytes are not padded
+	key := bytes.Repeat([]byte{1}, 32)
+	wrapped, err := Wrap(kek, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(wrapped) != 40 {
+		t.Fatalf("bad: %x", wrapped)
+	}
+	if _, err := Unwrap(bytes.Repeat([]byte{2}, 24), wrapped); err == nil {
+		t.Fatalf("expected error")
+	}
+}
@@ -18,6 +18,11 @@ import (
 	"github.com/hashicorp/vault/logical/framework"
 )
 
+// MetadataKey is the key of the token metadata recording the type of MFA a
+// login passed. It is informational only: policies check Auth.MFA, since
+// metadata may also come from the caller.
+const MetadataKey = "mfa"
+
 // MFAPaths returns paths to wrap the original login path and configure MFA.
 // When adding MFA to a backend, these paths should be included instead of
 // the login path in Backend.Paths.
@@ -78,7 +83,15 @@ func (b *backend) wrapLoginHandler(loginHandler framework.OperationFunc) framewo
 		// perform multi-factor authentication if type supported
 		handler, ok := handlers[mfa_config.Type]
 		if ok {
-			return handler(req, d, resp)
+			resp, err = handler(req, d, resp)
+			if err == nil && resp != nil && resp.Auth != nil {
+				if resp.Auth.Metadata == nil {
+					resp.Auth.Metadata = make(map[string]string)
+				}
+				resp.Auth.Metadata[MetadataKey] = mfa_config.Type
+				resp.Auth.MFA = true
+			}
+			return resp, err
 		} else {
 			return resp, err
 		}
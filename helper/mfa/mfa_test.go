@@ -1,6 +1,7 @@
 package mfa
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
@@ -111,7 +112,18 @@ func testAccStepLogin(t *testing.T, username string) logicaltest.TestStep {
 			"username": username,
 		},
 		Unauthenticated: true,
-		Check:           logicaltest.TestCheckAuth([]string{"foo"}),
+		Check: func(resp *logical.Response) error {
+			if err := logicaltest.TestCheckAuth([]string{"foo"})(resp); err != nil {
+				return err
+			}
+			if resp.Auth.Metadata[MetadataKey] != "test" {
+				return fmt.Errorf("MFA type not recorded: %#v", resp.Auth.Metadata)
+			}
+			if !resp.Auth.MFA {
+				return fmt.Errorf("MFA not recorded on the login")
+			}
+			return nil
+		},
 	}
 }
 
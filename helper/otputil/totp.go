@@ -0,0 +1,150 @@
+// Package otputil implements the time-based one-time passwords of RFC 6238.
+package otputil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TOTP holds the parameters of time-based one-time passwords
+type TOTP struct {
+	// Algorithm is the HMAC hash, SHA1, SHA256 or SHA512
+	Algorithm string
+
+	// Digits is the number of digits of the passcodes, 6 or 8
+	Digits int
+
+	// Period is how long each passcode is valid
+	Period time.Duration
+}
+
+// Validate returns an error if the parameters are not supported
+func (t *TOTP) Validate() error {
+	if _, err := t.hash(); err != nil {
+		return err
+	}
+	if t.Digits != 6 && t.Digits != 8 {
+		return fmt.Errorf("digits must be 6 or 8")
+	}
+	if t.Period < time.Second {
+		return fmt.Errorf("period must be at least one second")
+	}
+	return nil
+}
+
+func (t *TOTP) hash() (func() hash.Hash, error) {
+	switch strings.ToUpper(t.Algorithm) {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q", t.Algorithm)
+	}
+}
+
+// Counter returns the counter of the passcode valid at the given time
+func (t *TOTP) Counter(now time.Time) uint64 {
+	return uint64(now.Unix() / int64(t.Period/time.Second))
+}
+
+// Passcode returns the passcode of the given key for the given counter
+func (t *TOTP) Passcode(key []byte, counter uint64) (string, error) {
+	h, err := t.hash()
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, counter)
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation of RFC 4226
+	offset := sum[len(sum)-1] & 0xf
+	code := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, code%mod), nil
+}
+
+// Check returns the counter of the given passcode if it is valid at the
+// given time, allowing skew periods before and after. The counter lets
+// callers reject passcodes that were already used.
+func (t *TOTP) Check(key []byte, passcode string, now time.Time, skew int) (uint64, bool) {
+	if len(passcode) != t.Digits {
+		return 0, false
+	}
+	current := t.Counter(now)
+	for i := -skew; i <= skew; i++ {
+		counter := uint64(int64(current) + int64(i))
+		expected, err := t.Passcode(key, counter)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(passcode)) {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateKey returns a random key of the given size
+func GenerateKey(size int) ([]byte, error) {
+	key := make([]byte, size)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// EncodeKey returns the unpadded base32 encoding of the key, as entered in
+// authenticator applications
+func EncodeKey(key []byte) string {
+	return strings.TrimRight(base32.StdEncoding.EncodeToString(key), "=")
+}
+
+// DecodeKey decodes a key encoded by EncodeKey, ignoring case and spaces
+func DecodeKey(encoded string) ([]byte, error) {
+	encoded = strings.ToUpper(strings.Replace(encoded, " ", "", -1))
+	if pad := len(encoded) % 8; pad != 0 {
+		encoded += strings.Repeat("=", 8-pad)
+	}
+	return base32.StdEncoding.DecodeString(encoded)
+}
+
+// URL returns the otpauth URL of the key, which authenticator applications
+// read from QR codes
+func (t *TOTP) URL(issuer, account string, key []byte) string {
+	v := url.Values{}
+	v.Set("secret", EncodeKey(key))
+	v.Set("issuer", issuer)
+	v.Set("algorithm", strings.ToUpper(t.Algorithm))
+	v.Set("digits", strconv.Itoa(t.Digits))
+	v.Set("period", strconv.Itoa(int(t.Period/time.Second)))
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
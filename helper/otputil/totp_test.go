@@ -0,0 +1,89 @@
+package otputil
+
+import (
+	"testing"
+	"time"
+)
+
+// The test vectors of RFC 6238, appendix B
+func TestTOTP_Passcode(t *testing.T) {
+	keys := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	for _, c := range []struct {
+		time     int64
+		expected map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	} {
+		for algorithm, expected := range c.expected {
+			totp := &TOTP{Algorithm: algorithm, Digits: 8, Period: 30 * time.Second}
+			passcode, err := totp.Passcode(keys[algorithm], totp.Counter(time.Unix(c.time, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if passcode != expected {
+				t.Fatalf("%s at %d: expected %s, got %s", algorithm, c.time, expected, passcode)
+			}
+		}
+	}
+}
+
+func TestTOTP_Check(t *testing.T) {
+	totp := &TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	if err := totp.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	key, err := GenerateKey(20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1500000000, 0)
+	passcode, err := totp.Passcode(key, totp.Counter(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counter, ok := totp.Check(key, passcode, now.Add(30*time.Second), 1); !ok || counter != totp.Counter(now) {
+		t.Fatalf("expected the passcode to be valid within the skew")
+	}
+	if _, ok := totp.Check(key, passcode, now.Add(90*time.Second), 1); ok {
+		t.Fatalf("expected the passcode to be invalid out of the skew")
+	}
+	if _, ok := totp.Check(key, "12345", now, 1); ok {
+		t.Fatalf("expected a short passcode to be invalid")
+	}
+
+	for _, invalid := range []*TOTP{
+		{Algorithm: "MD5", Digits: 6, Period: time.Second},
+		{Algorithm: "SHA1", Digits: 7, Period: time.Second},
+		{Algorithm: "SHA1", Digits: 6},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Fatalf("%#v: expected an error", invalid)
+		}
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	key := []byte("12345678901234567890")
+	encoded := EncodeKey(key)
+	if encoded != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Fatalf("bad: %s", encoded)
+	}
+	decoded, err := DecodeKey("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil || string(decoded) != string(key) {
+		t.Fatalf("err:%v decoded:%q", err, decoded)
+	}
+
+	totp := &TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	expected := "otpauth://totp/Vault:alice?algorithm=SHA1&digits=6&issuer=Vault&period=30&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if u := totp.URL("Vault", "alice", key); u != expected {
+		t.Fatalf("expected %s, got %s", expected, u)
+	}
+}
@@ -0,0 +1,109 @@
+// Package passwordpolicy implements the password policies stored by the
+// core, which backends managing passwords check them against.
+package passwordpolicy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy holds the requirements passwords must meet
+type Policy struct {
+	Name string `json:"name"`
+
+	// MinLength is the minimum number of characters of passwords
+	MinLength int `json:"min_length"`
+
+	// The minimum number of characters of each class
+	MinUppercase int `json:"min_uppercase"`
+	MinLowercase int `json:"min_lowercase"`
+	MinDigits    int `json:"min_digits"`
+	MinSymbols   int `json:"min_symbols"`
+
+	// History is the number of previous passwords, including the current
+	// one, that a new password cannot be the same as
+	History int `json:"history"`
+
+	// MaxAge is how long passwords are valid after being set, or zero if
+	// they do not expire
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// Validate returns an error if the requirements of the policy are invalid
+func (p *Policy) Validate() error {
+	for name, value := range map[string]int{
+		"min_length":    p.MinLength,
+		"min_uppercase": p.MinUppercase,
+		"min_lowercase": p.MinLowercase,
+		"min_digits":    p.MinDigits,
+		"min_symbols":   p.MinSymbols,
+		"history":       p.History,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%s cannot be negative", name)
+		}
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("max_age cannot be negative")
+	}
+	if classes := p.MinUppercase + p.MinLowercase + p.MinDigits + p.MinSymbols; classes > p.MinLength && p.MinLength != 0 {
+		return fmt.Errorf("min_length is lower than the sum of the minimums of the character classes")
+	}
+	return nil
+}
+
+// Check returns an error listing the requirements of the policy the
+// password does not meet, or nil if it meets them all. Passwords are
+// compared with previous passwords by the backends storing them.
+func (p *Policy) Check(password string) error {
+	var upper, lower, digits, symbols int
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsDigit(r):
+			digits++
+		default:
+			symbols++
+		}
+	}
+
+	var problems []string
+	if utf8.RuneCountInString(password) < p.MinLength {
+		problems = append(problems, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+	for _, class := range []struct {
+		count, min int
+		name       string
+	}{
+		{upper, p.MinUppercase, "uppercase letters"},
+		{lower, p.MinLowercase, "lowercase letters"},
+		{digits, p.MinDigits, "digits"},
+		{symbols, p.MinSymbols, "symbols"},
+	} {
+		if class.count < class.min {
+			problems = append(problems, fmt.Sprintf("at least %d %s", class.min, class.name))
+		}
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("password does not meet password policy '%s': it must have %s",
+			p.Name, strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// Expired returns whether a password set at the given time has expired.
+// Passwords set before the policy applied, whose time is zero, do not
+// expire.
+func (p *Policy) Expired(setTime, now time.Time) bool {
+	if p.MaxAge == 0 || setTime.IsZero() {
+		return false
+	}
+	return now.After(setTime.Add(p.MaxAge))
+}
@@ -0,0 +1,80 @@
+package passwordpolicy
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy_Check(t *testing.T) {
+	p := &Policy{
+		Name:         "strict",
+		MinLength:    10,
+		MinUppercase: 1,
+		MinLowercase: 2,
+		MinDigits:    2,
+		MinSymbols:   1,
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for password, expected := range map[string][]string{
+		"Correct-horse42": nil,
+		"Éléphant-1234":   nil,
+		"short":           {"10 characters", "uppercase", "digits", "symbols"},
+		"alllowercase12!": {"uppercase"},
+		"NOLOWERCASE12!!": {"lowercase"},
+		"NoDigitsHere!!":  {"digits"},
+		"NoSymbolsHere12": {"symbols"},
+	} {
+		err := p.Check(password)
+		if expected == nil {
+			if err != nil {
+				t.Fatalf("%s: err: %v", password, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: expected error", password)
+		}
+		for _, problem := range expected {
+			if !strings.Contains(err.Error(), problem) {
+				t.Fatalf("%s: %q does not mention %q", password, err, problem)
+			}
+		}
+	}
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	for _, p := range []*Policy{
+		{MinLength: -1},
+		{History: -1},
+		{MaxAge: -time.Second},
+		{MinLength: 3, MinUppercase: 2, MinDigits: 2},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("expected error: %#v", p)
+		}
+	}
+	if err := (&Policy{MinUppercase: 2, MinDigits: 2}).Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestPolicy_Expired(t *testing.T) {
+	now := time.Now()
+	p := &Policy{MaxAge: time.Hour}
+	if p.Expired(now.Add(-time.Minute), now) {
+		t.Fatalf("expected password to be valid")
+	}
+	if !p.Expired(now.Add(-2*time.Hour), now) {
+		t.Fatalf("expected password to be expired")
+	}
+	if p.Expired(time.Time{}, now) {
+		t.Fatalf("expected password set before the policy to be valid")
+	}
+	if (&Policy{}).Expired(now.Add(-1000*time.Hour), now) {
+		t.Fatalf("expected password to be valid without max_age")
+	}
+}
@@ -0,0 +1,91 @@
+package qrutil
+
+import (
+	"bytes"
+	"image/png"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// The data codewords of "HELLO WORLD" at version 1 and medium level
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	expected := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	ecc := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	if !reflect.DeepEqual(ecc, expected) {
+		t.Fatalf("expected %v, got %v", expected, ecc)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	if bits := formatBits(0); bits != 0x5412 {
+		t.Fatalf("bad format bits for mask 0: %015b", bits)
+	}
+	if bits := versionBits(7); bits != 0x07C94 {
+		t.Fatalf("bad version bits for version 7: %018b", bits)
+	}
+}
+
+func TestNumDataCodewords(t *testing.T) {
+	for version, expected := range map[int]int{1: 16, 7: 124, 10: 216, 20: 669} {
+		if n := numDataCodewords(version); n != expected {
+			t.Fatalf("version %d: expected %d data codewords, got %d", version, expected, n)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for text, expectedVersion := range map[string]int{
+		"":                      1,
+		"HELLO WORLD":           1,
+		strings.Repeat("a", 14): 1,
+		strings.Repeat("a", 15): 2,
+		"otpauth://totp/Vault:test@example.com?algorithm=SHA1&digits=6&issuer=Vault&period=30&secret=JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP": 8,
+		strings.Repeat("a", 666): 20,
+	} {
+		code, err := Encode(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code.Version != expectedVersion {
+			t.Fatalf("%d bytes: expected version %d, got %d", len(text), expectedVersion, code.Version)
+		}
+		if code.Size != 4*expectedVersion+17 {
+			t.Fatalf("bad size %d", code.Size)
+		}
+
+		// The top left finder pattern
+		for y := 0; y < 7; y++ {
+			for x := 0; x < 7; x++ {
+				expected := !(x == 1 || x == 5 || y == 1 || y == 5) || x == 0 || x == 6 || y == 0 || y == 6
+				if code.Dark(x, y) != expected {
+					t.Fatalf("bad finder pattern at (%d, %d)", x, y)
+				}
+			}
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("a", 667)); err == nil {
+		t.Fatal("expected an error for too long text")
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("HELLO WORLD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := code.PNG(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Dx(); size != (21+2*quietZone)*2 {
+		t.Fatalf("bad image size %d", size)
+	}
+}
@@ -239,3 +239,28 @@ func EquivalentSlices(a, b []string) bool {
 
 	return true
 }
+
+// GlobbedStringsMatch checks whether the value matches the pattern, in which
+// each '*' matches any sequence of characters.
+func GlobbedStringsMatch(pattern, val string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == val
+	}
+
+	// The value must start with the first part and end with the last one,
+	// with the other parts in order in between
+	last := len(parts) - 1
+	if !strings.HasPrefix(val, parts[0]) {
+		return false
+	}
+	val = val[len(parts[0]):]
+	for _, part := range parts[1:last] {
+		i := strings.Index(val, part)
+		if i < 0 {
+			return false
+		}
+		val = val[i+len(part):]
+	}
+	return strings.HasSuffix(val, parts[last])
+}
@@ -242,3 +242,37 @@ $$`,
 		t.Fatalf("bad: expected:\n%#v\nactual:\n%#v", jsonExpected, actual)
 	}
 }
+
+func TestStrutil_GlobbedStringsMatch(t *testing.T) {
+	type tCase struct {
+		pattern string
+		val     string
+		expect  bool
+	}
+
+	tCases := []tCase{
+		tCase{"", "", true},
+		tCase{"*", "*", true},
+		tCase{"*", "", true},
+		tCase{"*", "foo", true},
+		tCase{"foo", "foo", true},
+		tCase{"foo", "foobar", false},
+		tCase{"foo*", "foobar", true},
+		tCase{"*bar", "foobar", true},
+		tCase{"*bar", "barfoo", false},
+		tCase{"f*r", "foobar", true},
+		tCase{"f*o*r", "foobar", true},
+		tCase{"f*b*o", "foobar", false},
+		tCase{"ftp*.example.com", "ftp1.example.com", true},
+		tCase{"ftp*.example.com", "ftp.example.com.evil", false},
+		tCase{"*.example.com", "example.com", false},
+		tCase{"ab*ba", "aba", false},
+	}
+
+	for _, tc := range tCases {
+		actual := GlobbedStringsMatch(tc.pattern, tc.val)
+		if actual != tc.expect {
+			t.Fatalf("bad: pattern %q, value %q: expected %t", tc.pattern, tc.val, tc.expect)
+		}
+	}
+}
@@ -22,6 +22,10 @@ const (
 	// WrapHeaderName is the name of the header containing a directive to wrap the
 	// response.
 	WrapTTLHeaderName = "X-Vault-Wrap-TTL"
+
+	// ControlGroupHeaderName is the name of the header containing the ID
+	// of the approved control group request a request carries out
+	ControlGroupHeaderName = "X-Vault-Control-Group"
 )
 
 // Handler returns an http.Handler for the API. This can be used on
@@ -45,6 +49,8 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/rekey-recovery-key/init", handleSysRekeyInit(core, true))
 	mux.Handle("/v1/sys/rekey-recovery-key/update", handleSysRekeyUpdate(core, true))
 	mux.Handle("/v1/sys/capabilities-self", handleLogical(core, true, sysCapabilitiesSelfCallback))
+	mux.Handle("/v1/sys/control-group/authorize", handleLogical(core, true, sysControlGroupAuthorizeCallback))
+	mux.Handle("/v1/sys/mfa/method/totp/", handleLogical(core, true, sysMFATOTPGenerateCallback))
 	mux.Handle("/v1/sys/", handleLogical(core, true, nil))
 	mux.Handle("/v1/", handleLogical(core, false, nil))
 
@@ -66,6 +72,34 @@ func sysCapabilitiesSelfCallback(req *logical.Request) error {
 	return nil
 }
 
+// The system backend needs the token of the authorizer to approve a control
+// group request, so it is set in the data as for sys/capabilities-self. It is
+// always replaced, so clients can only authorize with their own token.
+func sysControlGroupAuthorizeCallback(req *logical.Request) error {
+	if req == nil || req.Data == nil {
+		return fmt.Errorf("invalid request")
+	}
+	req.Data["token"] = req.ClientToken
+	return nil
+}
+
+// Users generate their own TOTP key with sys/mfa/method/totp/<name>/generate,
+// for which the system backend needs their token to find their identity. It
+// is set as for sys/capabilities-self, and only for that endpoint.
+func sysMFATOTPGenerateCallback(req *logical.Request) error {
+	if req == nil {
+		return fmt.Errorf("invalid request")
+	}
+	if !strings.HasSuffix(req.Path, "/generate") {
+		return nil
+	}
+	if req.Data == nil {
+		req.Data = make(map[string]interface{})
+	}
+	req.Data["token"] = req.ClientToken
+	return nil
+}
+
 // stripPrefix is a helper to strip a prefix from the path. It will
 // return false from the second return value if it the prefix doesn't exist.
 func stripPrefix(prefix, path string) (string, bool) {
@@ -89,6 +123,23 @@ func parseRequest(r *http.Request, out interface{}) error {
 	return err
 }
 
+// parseQuery returns the query parameters of a read, list or delete request
+// as request data. Parameters given more than once use the first value. It
+// returns nil if there are no parameters besides "list".
+func parseQuery(values url.Values) map[string]interface{} {
+	data := map[string]interface{}{}
+	for k, v := range values {
+		if k == "list" || len(v) == 0 {
+			continue
+		}
+		data[k] = v[0]
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return data
+}
+
 // request is a helper to perform a request and properly exit in the
 // case of an error.
 func request(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *logical.Request) (*logical.Response, bool) {
@@ -147,13 +198,18 @@ func respondStandby(core *vault.Core, w http.ResponseWriter, reqURL *url.URL) {
 	w.WriteHeader(307)
 }
 
-// requestAuth adds the token to the logical.Request if it exists.
+// requestAuth adds the token, and the ID of the control group request being
+// carried out, to the logical.Request if they exist.
 func requestAuth(r *http.Request, req *logical.Request) *logical.Request {
 	// Attach the header value if we have it
 	if v := r.Header.Get(AuthHeaderName); v != "" {
 		req.ClientToken = v
 	}
 
+	if v := r.Header.Get(ControlGroupHeaderName); v != "" {
+		req.ControlGroupID = v
+	}
+
 	return req
 }
 
@@ -224,6 +280,10 @@ func respondErrorCommon(w http.ResponseWriter, resp *logical.Response, err error
 			statusCode = http.StatusBadRequest
 		case errwrap.Contains(err, logical.ErrPermissionDenied.Error()):
 			statusCode = http.StatusForbidden
+		case errwrap.Contains(err, logical.ErrRateLimited.Error()):
+			statusCode = http.StatusTooManyRequests
+		case errwrap.Contains(err, logical.ErrConflict.Error()):
+			statusCode = http.StatusConflict
 		case errwrap.Contains(err, logical.ErrUnsupportedOperation.Error()):
 			statusCode = http.StatusMethodNotAllowed
 		case errwrap.Contains(err, logical.ErrUnsupportedPath.Error()):
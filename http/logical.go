@@ -2,6 +2,7 @@ package http
 
 import (
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"strconv"
@@ -15,6 +16,12 @@ import (
 
 type PrepareRequestFunc func(req *logical.Request) error
 
+// rawRequestContentTypes are the content types of request bodies which are
+// passed to backends as is, rather than decoded as JSON
+var rawRequestContentTypes = map[string]bool{
+	"application/ocsp-request": true,
+}
+
 func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Request, int, error) {
 	// Determine the path...
 	if !strings.HasPrefix(r.URL.Path, "/v1/") {
@@ -44,8 +51,14 @@ func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Reque
 				op = logical.ListOperation
 			}
 		}
+	case "HEAD":
+		// The response body is discarded; only the status and headers of
+		// raw responses are meaningful
+		op = logical.ReadOperation
 	case "POST", "PUT":
 		op = logical.UpdateOperation
+	case "PATCH":
+		op = logical.PatchOperation
 	case "LIST":
 		op = logical.ListOperation
 	default:
@@ -54,7 +67,21 @@ func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Reque
 
 	// Parse the request if we can
 	var data map[string]interface{}
-	if op == logical.UpdateOperation {
+	if op == logical.ReadOperation || op == logical.ListOperation ||
+		op == logical.DeleteOperation {
+		data = parseQuery(r.URL.Query())
+	}
+	contentType := r.Header.Get("Content-Type")
+	if op == logical.UpdateOperation && rawRequestContentTypes[contentType] {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		data = map[string]interface{}{
+			logical.HTTPContentType: contentType,
+			logical.HTTPRawBody:     body,
+		}
+	} else if op == logical.UpdateOperation || op == logical.PatchOperation {
 		err := parseRequest(r, &data)
 		if err == io.EOF {
 			data = nil
@@ -239,6 +266,18 @@ func respondRaw(w http.ResponseWriter, r *http.Request, path string, resp *logic
 		return
 	}
 
+	// Get any additional headers
+	if headersRaw, ok := resp.Data[logical.HTTPRawHeaders]; ok {
+		headers, ok := headersRaw.(map[string]string)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, nil)
+			return
+		}
+		for k, v := range headers {
+			w.Header().Set(k, v)
+		}
+	}
+
 	// Write the response
 	w.Header().Set("Content-Type", contentType)
 	w.WriteHeader(status)
@@ -5,12 +5,14 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"net/http"
 	"os"
 	"reflect"
 	"strconv"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/vault/builtin/logical/kv"
 	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/vault"
 )
@@ -65,6 +67,64 @@ func TestLogical(t *testing.T) {
 	testResponseStatus(t, resp, 404)
 }
 
+func TestLogical_Patch(t *testing.T) {
+	if err := vault.AddTestLogicalBackend("kv", kv.Factory); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/mounts/kv", map[string]interface{}{
+		"type": "kv",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/kv/data/foo", map[string]interface{}{
+		"data": map[string]interface{}{
+			"a": "1",
+			"b": "2",
+		},
+	})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpData(t, "PATCH", token, addr+"/v1/kv/data/foo", map[string]interface{}{
+		"data": map[string]interface{}{
+			"b": nil,
+			"c": "3",
+		},
+	})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpGet(t, token, addr+"/v1/kv/data/foo")
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	expected := map[string]interface{}{
+		"a": "1",
+		"c": "3",
+	}
+	if data := actual["data"].(map[string]interface{})["data"]; !reflect.DeepEqual(data, expected) {
+		t.Fatalf("bad:\nactual:\n%#v\nexpected:\n%#v", data, expected)
+	}
+
+	// Outdated check-and-set patches conflict
+	resp = testHttpData(t, "PATCH", token, addr+"/v1/kv/data/foo", map[string]interface{}{
+		"data": map[string]interface{}{
+			"a": "2",
+		},
+		"cas": 1,
+	})
+	testResponseStatus(t, resp, 409)
+
+	// Backends that do not support patching reject it
+	resp = testHttpData(t, "PATCH", token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 405)
+}
+
 func TestLogical_noExist(t *testing.T) {
 	core, _, token := vault.TestCoreUnsealed(t)
 	ln, addr := TestServer(t, core)
@@ -146,6 +206,7 @@ func TestLogical_StandbyRedirect(t *testing.T) {
 			"creation_ttl":     json.Number("0"),
 			"role":             "",
 			"explicit_max_ttl": json.Number("0"),
+			"type":             "service",
 		},
 		"warnings":  nilWarnings,
 		"wrap_info": nil,
@@ -222,7 +283,7 @@ func TestLogical_RawHTTP(t *testing.T) {
 	testResponseStatus(t, resp, 200)
 
 	// Test the headers
-	if resp.Header.Get("Content-Type") != "plain/text" {
+	if resp.Header.Get("Content-Type") != "plain/text" || resp.Header.Get("X-Hello") != "world" {
 		t.Fatalf("Bad: %#v", resp.Header)
 	}
 
@@ -232,4 +293,80 @@ func TestLogical_RawHTTP(t *testing.T) {
 	if string(body.Bytes()) != "hello world" {
 		t.Fatalf("Bad: %s", body.Bytes())
 	}
+
+	// HEAD requests are reads without a body
+	req, err := http.NewRequest("HEAD", addr+"/v1/foo/raw", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testResponseStatus(t, resp, 200)
+	if resp.Header.Get("X-Hello") != "world" {
+		t.Fatalf("Bad: %#v", resp.Header)
+	}
+	body.Reset()
+	io.Copy(body, resp.Body)
+	if body.Len() != 0 {
+		t.Fatalf("Bad: %s", body.Bytes())
+	}
+}
+
+func TestLogical_QueryData(t *testing.T) {
+	if err := vault.AddTestLogicalBackend("kv", kv.Factory); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/mounts/kv", map[string]interface{}{
+		"type": "kv",
+	})
+	testResponseStatus(t, resp, 204)
+	for _, value := range []string{"1", "2"} {
+		resp = testHttpPut(t, token, addr+"/v1/kv/data/foo", map[string]interface{}{
+			"data": map[string]interface{}{
+				"value": value,
+			},
+		})
+		testResponseStatus(t, resp, 200)
+	}
+
+	read := func(token, url string) interface{} {
+		resp := testHttpGet(t, token, url)
+		testResponseStatus(t, resp, 200)
+		var actual map[string]interface{}
+		testResponseBody(t, resp, &actual)
+		return actual["data"].(map[string]interface{})["data"].(map[string]interface{})["value"]
+	}
+
+	// Query parameters reach the backend
+	if value := read(token, addr+"/v1/kv/data/foo?version=1"); value != "1" {
+		t.Fatalf("bad: %#v", value)
+	}
+	if value := read(token, addr+"/v1/kv/data/foo"); value != "2" {
+		t.Fatalf("bad: %#v", value)
+	}
+
+	// and are checked against the parameters allowed by policies
+	resp = testHttpPut(t, token, addr+"/v1/sys/policy/latest", map[string]interface{}{
+		"rules": `path "kv/data/*" {
+			capabilities = ["read"]
+			denied_parameters = {
+				"version" = []
+			}
+		}`,
+	})
+	testResponseStatus(t, resp, 204)
+	vault.TestLoginToken(t, core, "reader", []string{"latest"})
+	if value := read("reader", addr+"/v1/kv/data/foo"); value != "2" {
+		t.Fatalf("bad: %#v", value)
+	}
+	resp = testHttpGet(t, "reader", addr+"/v1/kv/data/foo?version=1")
+	testResponseStatus(t, resp, 403)
 }
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysControlGroup(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/policy/prod", map[string]interface{}{
+		"rules": `path "secret/prod/*" {
+			capabilities = ["read"]
+			control_group {
+				policy = "approvers"
+			}
+		}`,
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpPut(t, token, addr+"/v1/sys/policy/approvers", map[string]interface{}{
+		"rules": `path "sys/control-group/authorize" { capabilities = ["update"] }`,
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpPut(t, token, addr+"/v1/secret/prod/db", map[string]interface{}{
+		"password": "hunter2",
+	})
+	testResponseStatus(t, resp, 204)
+
+	vault.TestLoginToken(t, core, "requester", []string{"default", "prod"})
+	vault.TestLoginToken(t, core, "approver", []string{"default", "approvers"})
+
+	// The read waits for approval
+	resp = testHttpGet(t, "requester", addr+"/v1/secret/prod/db")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	id, _ := data["control_group_id"].(string)
+	if id == "" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The authorizer cannot claim to be someone else
+	resp = testHttpPut(t, "approver", addr+"/v1/sys/control-group/authorize", map[string]interface{}{
+		"id":    id,
+		"token": "requester",
+	})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpPut(t, "requester", addr+"/v1/sys/control-group/request", map[string]interface{}{
+		"id": id,
+	})
+	testResponseStatus(t, resp, 200)
+	actual = nil
+	testResponseBody(t, resp, &actual)
+	data = actual["data"].(map[string]interface{})
+	if data["approved"] != true {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The approved read is carried out with the header
+	req, err := http.NewRequest("GET", addr+"/v1/secret/prod/db", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set(AuthHeaderName, "requester")
+	req.Header.Set(ControlGroupHeaderName, id)
+	resp, err = cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testResponseStatus(t, resp, 200)
+	actual = nil
+	testResponseBody(t, resp, &actual)
+	data = actual["data"].(map[string]interface{})
+	if data["password"] != "hunter2" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Without approval the header is rejected
+	resp, err = cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testResponseStatus(t, resp, 400)
+	actual = nil
+	testResponseBody(t, resp, &actual)
+	if errs, ok := actual["errors"].([]interface{}); !ok || len(errs) == 0 || !strings.Contains(errs[0].(string), "not found") {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -305,6 +305,7 @@ func TestSysGenerateRoot_Update_OTP(t *testing.T) {
 		"path":             "auth/token/root",
 		"role":             "",
 		"explicit_max_ttl": json.Number("0"),
+		"type":             "service",
 	}
 
 	resp = testHttpGet(t, newRootToken, addr+"/v1/auth/token/lookup-self")
@@ -388,6 +389,7 @@ func TestSysGenerateRoot_Update_PGP(t *testing.T) {
 		"path":             "auth/token/root",
 		"role":             "",
 		"explicit_max_ttl": json.Number("0"),
+		"type":             "service",
 	}
 
 	resp = testHttpGet(t, newRootToken, addr+"/v1/auth/token/lookup-self")
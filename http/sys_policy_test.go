@@ -47,6 +47,11 @@ func TestSysReadPolicy(t *testing.T) {
 
 	resp := testHttpGet(t, token, addr+"/v1/sys/policy/root")
 
+	rootRules := `
+path "*" {
+    capabilities = ["create", "read", "update", "patch", "delete", "list", "sudo"]
+}
+`
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
 		"lease_id":       "",
@@ -56,11 +61,25 @@ func TestSysReadPolicy(t *testing.T) {
 		"warnings":       nil,
 		"auth":           nil,
 		"data": map[string]interface{}{
-			"name":  "root",
-			"rules": "",
+			"name":             "root",
+			"rules":            rootRules,
+			"syntax":           "hcl",
+			"metadata":         nil,
+			"expire_time":      "",
+			"delete_on_expire": false,
+			"shadow":           false,
+			"signature":        "",
+			"signed_by":        "",
 		},
-		"name":  "root",
-		"rules": "",
+		"name":             "root",
+		"rules":            rootRules,
+		"syntax":           "hcl",
+		"metadata":         nil,
+		"expire_time":      "",
+		"delete_on_expire": false,
+		"shadow":           false,
+		"signature":        "",
+		"signed_by":        "",
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -111,6 +130,83 @@ func TestSysWritePolicy(t *testing.T) {
 	testResponseStatus(t, resp, 400)
 }
 
+func TestSysListPoliciesDetailed(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/policy/foo", map[string]interface{}{
+		"rules": ``,
+		"metadata": map[string]interface{}{
+			"owner": "team-a",
+		},
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/policy?detailed=true")
+
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+
+	expected := map[string]interface{}{
+		"default": map[string]interface{}{
+			"metadata": nil,
+		},
+		"foo": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"owner": "team-a",
+			},
+		},
+		"root": map[string]interface{}{
+			"metadata": nil,
+		},
+	}
+	keyInfo := actual["data"].(map[string]interface{})["key_info"]
+	if !reflect.DeepEqual(keyInfo, expected) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", keyInfo, expected)
+	}
+}
+
+func TestSysExportImportPolicies(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/policy/foo", map[string]interface{}{
+		"rules": `path "secret/*" { capabilities = ["read"] }`,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/sys/policy-export", map[string]interface{}{
+		"policies": "foo",
+	})
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	bundle := actual["data"].(map[string]interface{})["bundle"]
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/policy/foo")
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/sys/policy-import", map[string]interface{}{
+		"bundle": bundle,
+	})
+	testResponseStatus(t, resp, 200)
+	actual = nil
+	testResponseBody(t, resp, &actual)
+	expected := map[string]interface{}{
+		"imported":  []interface{}{"foo"},
+		"unchanged": []interface{}{},
+		"skipped":   []interface{}{},
+	}
+	if !reflect.DeepEqual(actual["data"], expected) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual["data"], expected)
+	}
+}
+
 func TestSysDeletePolicy(t *testing.T) {
 	core, _, token := vault.TestCoreUnsealed(t)
 	ln, addr := TestServer(t, core)
@@ -154,3 +250,95 @@ func TestSysDeletePolicy(t *testing.T) {
 		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual, expected)
 	}
 }
+
+func TestSysDeletePolicy_revoke(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/policy/foo", map[string]interface{}{
+		"rules": ``,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"id":       "child",
+		"policies": []string{"foo"},
+	})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/policy/foo?revoke=true")
+	testResponseStatus(t, resp, 200)
+
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if data["revoked_tokens"] != json.Number("1") {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	resp = testHttpGet(t, "child", addr+"/v1/auth/token/lookup-self")
+	testResponseStatus(t, resp, 403)
+}
+
+func TestSysPolicyTrash(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/policy/foo", map[string]interface{}{
+		"rules": `path "secret/*" { capabilities = ["read"] }`,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"id":       "child",
+		"policies": []string{"foo"},
+	})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/policy/foo")
+	testResponseStatus(t, resp, 204)
+	resp = testHttpGet(t, "child", addr+"/v1/secret/bar")
+	testResponseStatus(t, resp, 403)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/policy-trash?list=true")
+	testResponseStatus(t, resp, 200)
+	var actual map[string]interface{}
+	testResponseBody(t, resp, &actual)
+	data := actual["data"].(map[string]interface{})
+	if !reflect.DeepEqual(data["keys"], []interface{}{"foo"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Tokens still referencing the policy are granted its rules again
+	resp = testHttpPut(t, token, addr+"/v1/sys/policy-trash/restore/foo", nil)
+	testResponseStatus(t, resp, 204)
+	resp = testHttpGet(t, "child", addr+"/v1/secret/bar")
+	testResponseStatus(t, resp, 404)
+}
+
+func TestSysWritePolicy_rateLimit(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/policy/foo", map[string]interface{}{
+		"rules": `rate_limit { rps = 0.001 burst = 1 } path "auth/token/lookup-self" { capabilities = ["read"] }`,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"id":       "child",
+		"policies": []string{"foo"},
+	})
+	testResponseStatus(t, resp, 200)
+
+	resp = testHttpGet(t, "child", addr+"/v1/auth/token/lookup-self")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpGet(t, "child", addr+"/v1/auth/token/lookup-self")
+	testResponseStatus(t, resp, 429)
+}
@@ -48,6 +48,19 @@ type Auth struct {
 	// should never expire. The token should be renewed within the duration
 	// specified by this period.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
+
+	// ExplicitMaxTTL is the hard limit on the lifetime of the token
+	// generated using this Auth object, regardless of renewals.
+	ExplicitMaxTTL time.Duration `json:"explicit_max_ttl" mapstructure:"explicit_max_ttl" structs:"explicit_max_ttl"`
+
+	// BoundCIDRs restricts the token generated using this Auth object to
+	// requests made from within the given CIDR blocks.
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// MFA is whether the login passed the MFA of the credential backend.
+	// It is only set by helper/mfa and is never decoded from user input,
+	// unlike Metadata, which some backends copy from their callers.
+	MFA bool `json:"-" mapstructure:"-" structs:"-"`
 }
 
 func (a *Auth) GoString() string {
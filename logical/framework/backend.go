@@ -521,6 +521,10 @@ func (t FieldType) Zero() interface{} {
 		return map[string]interface{}{}
 	case TypeDurationSecond:
 		return 0
+	case TypeCommaStringSlice:
+		return []string{}
+	case TypeSlice:
+		return []interface{}{}
 	default:
 		panic("unknown type: " + t.String())
 	}
@@ -146,6 +146,57 @@ func TestFieldDataGet(t *testing.T) {
 			"foo",
 			0,
 		},
+
+		"comma string slice type, comma string value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeCommaStringSlice},
+			},
+			map[string]interface{}{
+				"foo": "bar, baz",
+			},
+			"foo",
+			[]string{"bar", "baz"},
+		},
+
+		"comma string slice type, slice value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeCommaStringSlice},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{"bar", "baz,qux"},
+			},
+			"foo",
+			[]string{"bar", "baz,qux"},
+		},
+
+		"comma string slice type, unset value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeCommaStringSlice},
+			},
+			map[string]interface{}{},
+			"foo",
+			[]string{},
+		},
+
+		"slice type, slice value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeSlice},
+			},
+			map[string]interface{}{
+				"foo": []interface{}{"bar", map[string]interface{}{"baz": 1}},
+			},
+			"foo",
+			[]interface{}{"bar", map[string]interface{}{"baz": 1}},
+		},
+
+		"slice type, unset value": {
+			map[string]*FieldSchema{
+				"foo": &FieldSchema{Type: TypeSlice},
+			},
+			map[string]interface{}{},
+			"foo",
+			[]interface{}{},
+		},
 	}
 
 	for name, tc := range cases {
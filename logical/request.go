@@ -60,6 +60,15 @@ type Request struct {
 	// WrapTTL contains the requested TTL of the token used to wrap the
 	// response in a cubbyhole.
 	WrapTTL time.Duration `json:"wrap_ttl" struct:"wrap_ttl" mapstructure:"wrap_ttl"`
+
+	// ControlGroupID identifies the approved control group request this
+	// request carries out, for paths that require approval.
+	ControlGroupID string `json:"control_group_id" structs:"control_group_id" mapstructure:"control_group_id"`
+
+	// ShadowDenials are the policies in shadow mode that would have denied
+	// this request had they been enforced. It is set by the core so that
+	// it is recorded in the audit log.
+	ShadowDenials []string `json:"shadow_denials" structs:"shadow_denials" mapstructure:"shadow_denials"`
 }
 
 // Get returns a data field and guards for nil Data
@@ -136,6 +145,10 @@ const (
 	ListOperation             = "list"
 	HelpOperation             = "help"
 
+	// PatchOperation updates some of the fields of a resource, following
+	// JSON merge patch semantics
+	PatchOperation = "patch"
+
 	// The operations below are called globally, the path is less relevant.
 	RevokeOperation   Operation = "revoke"
 	RenewOperation              = "renew"
@@ -156,4 +169,13 @@ var (
 
 	// ErrPermissionDenied is returned if the client is not authorized
 	ErrPermissionDenied = errors.New("permission denied")
+
+	// ErrRateLimited is returned if the client has exceeded the rate of
+	// requests its policies allow
+	ErrRateLimited = errors.New("rate limit exceeded")
+
+	// ErrConflict is returned if the request conflicts with the current
+	// state of the resource, such as a check-and-set write of an outdated
+	// version
+	ErrConflict = errors.New("conflict")
 )
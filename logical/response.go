@@ -20,12 +20,21 @@ const (
 	// HTTPRawBody is the raw content of the HTTP body that goes with the HTTPContentType.
 	// This can only be specified for non-secrets, and should should be similarly
 	// avoided like the HTTPContentType. The value must be a byte slice.
+	//
+	// The HTTP front end also sets the HTTPRawBody and HTTPContentType in the
+	// Data field of update requests whose body has a raw content type, such as
+	// "application/ocsp-request", rather than decoding it as JSON.
 	HTTPRawBody = "http_raw_body"
 
 	// HTTPStatusCode is the response code of the HTTP body that goes with the HTTPContentType.
 	// This can only be specified for non-secrets, and should should be similarly
 	// avoided like the HTTPContentType. The value must be an integer.
 	HTTPStatusCode = "http_status_code"
+
+	// HTTPRawHeaders are additional HTTP headers of the response that goes
+	// with the HTTPContentType, such as the ones required by a specification.
+	// The value must be a map[string]string.
+	HTTPRawHeaders = "http_raw_headers"
 )
 
 type WrapInfo struct {
@@ -1,6 +1,10 @@
 package logical
 
-import "time"
+import (
+	"time"
+
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+)
 
 // SystemView exposes system configuration information in a safe way
 // for logical backends to consume
@@ -30,6 +34,10 @@ type SystemView interface {
 	// Returns true if caching is disabled. If true, no caches should be used,
 	// despite known slowdowns.
 	CachingDisabled() bool
+
+	// PasswordPolicy returns the named password policy, or nil if it does
+	// not exist. Backends managing passwords use it to check them.
+	PasswordPolicy(name string) (*passwordpolicy.Policy, error)
 }
 
 type StaticSystemView struct {
@@ -38,6 +46,7 @@ type StaticSystemView struct {
 	SudoPrivilegeVal   bool
 	TaintedVal         bool
 	CachingDisabledVal bool
+	PasswordPolicies   map[string]*passwordpolicy.Policy
 }
 
 func (d StaticSystemView) DefaultLeaseTTL() time.Duration {
@@ -59,3 +68,7 @@ func (d StaticSystemView) Tainted() bool {
 func (d StaticSystemView) CachingDisabled() bool {
 	return d.CachingDisabledVal
 }
+
+func (d StaticSystemView) PasswordPolicy(name string) (*passwordpolicy.Policy, error) {
+	return d.PasswordPolicies[name], nil
+}
@@ -1,7 +1,13 @@
 package vault
 
 import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
 	"github.com/armon/go-radix"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -14,21 +20,484 @@ type ACL struct {
 	// globRules contains the path policies that glob
 	globRules *radix.Tree
 
+	// wildcardRules contains the path policies with "+" segments, keyed by
+	// their pattern, which ends in "*" if they also glob
+	wildcardRules *radix.Tree
+
 	// root is enabled if the "root" named policy is present.
 	root bool
+
+	// now returns the time requests are checked at, for rules that only
+	// apply at certain times
+	now func() time.Time
+
+	// shadow is the ACL built with the policies in shadow mode as well,
+	// used to find the requests they would deny. It is nil if there are
+	// no such policies.
+	shadow         *ACL
+	shadowPolicies []string
+
+	// allowHook is called with the policies whose rules allowed a request
+	// checked by AllowOperation, if set
+	allowHook func(policies []string)
+
+	// rateLimits are the rate limits of the policies, by name
+	rateLimits map[string]*RateLimit
+}
+
+// aclEnvironment holds what rules that only apply to some requests are
+// checked against.
+type aclEnvironment struct {
+	now time.Time
+
+	// remoteIP is the address the request came from, or nil if unknown
+	remoteIP net.IP
+}
+
+// ACLPermissions holds what the policies of an ACL permit on a path
+type ACLPermissions struct {
+	CapabilitiesBitmap uint32
+
+	// AllowedParameters and DeniedParameters map request parameters to the
+	// values that may or may not be given for them. An empty list stands
+	// for any value, and a "*" key for any parameter.
+	AllowedParameters map[string][]interface{}
+	DeniedParameters  map[string][]interface{}
+
+	// RequiredParameters must all be present in the request
+	RequiredParameters []string
+
+	// MinWrappingTTL and MaxWrappingTTL bound the response wrapping TTL
+	// requests must use; zero values are unbounded
+	MinWrappingTTL time.Duration
+	MaxWrappingTTL time.Duration
+
+	// ControlGroup requires requests to be approved before they are carried
+	// out, if set
+	ControlGroup *ControlGroup
+
+	// sources are the policy rules that were combined into these
+	// permissions, used to explain access decisions
+	sources []ACLRuleSource
+
+	// schedule limits when the permissions apply, if set
+	schedule *TimeSchedule
+
+	// boundCIDRs limits the addresses the permissions apply to, if set
+	boundCIDRs []*net.IPNet
+}
+
+// aclRule holds the permissions the policies of an ACL give a single path
+// pattern.
+type aclRule struct {
+	// always are the permissions that apply to every request, or nil if
+	// every rule for the pattern is conditional
+	always *ACLPermissions
+
+	// conditional are the permissions of each rule that only applies at
+	// certain times or from certain addresses
+	conditional []*ACLPermissions
+}
+
+// add adds the permissions of another rule for the pattern
+func (r *aclRule) add(perms *ACLPermissions) {
+	if perms.conditional() {
+		r.conditional = append(r.conditional, perms)
+		return
+	}
+	r.always = combinePermissions(r.always, perms)
+}
+
+// permissions returns the permissions that apply in the given environment,
+// or nil if none do
+func (r *aclRule) permissions(env *aclEnvironment) *ACLPermissions {
+	if len(r.conditional) == 0 {
+		return r.always
+	}
+
+	// Merging modifies the permissions, so work on copies
+	var active *ACLPermissions
+	if r.always != nil {
+		active = r.always.clone()
+	}
+	for _, perms := range r.conditional {
+		if perms.appliesIn(env) {
+			active = combinePermissions(active, perms.clone())
+		}
+	}
+	return active
+}
+
+// combinePermissions returns the permissions of two rules for the same path,
+// either of which may be nil. A denial overrides anything else.
+func combinePermissions(existing, perms *ACLPermissions) *ACLPermissions {
+	switch {
+	case existing == nil:
+		return perms
+
+	case existing.CapabilitiesBitmap&DenyCapabilityInt > 0:
+		// If we are explicitly denied in the existing capability set,
+		// don't save anything else
+		return existing
+
+	case perms.CapabilitiesBitmap&DenyCapabilityInt > 0:
+		// If this new policy explicitly denies, only save the deny value
+		return denyPermissions(perms.sources)
+
+	default:
+		// Merge the permissions in this new policy into the existing value
+		existing.merge(perms)
+		return existing
+	}
+}
+
+// ACLRuleSource identifies a path rule in a policy
+type ACLRuleSource struct {
+	Policy string
+	Path   string
+}
+
+// ACLExplanation describes how an ACL decided on a request
+type ACLExplanation struct {
+	Allowed bool
+	Sudo    bool
+
+	// Pattern is the rule pattern that matched the path, or empty if no
+	// rule matched
+	Pattern string
+
+	// Sources are the policy rules that were combined into the matching
+	// rule. If a rule denies access, only the denying rules are given.
+	Sources []ACLRuleSource
+
+	// Reason is a human readable explanation of the decision
+	Reason string
+}
+
+// newACLPermissions returns the permissions granted by a single path rule.
+// The parameter maps are copied so that merging never modifies the policy.
+func newACLPermissions(policy string, pc *PathCapabilities) *ACLPermissions {
+	pattern := pc.Prefix
+	if pc.Glob {
+		pattern += "*"
+	}
+	return &ACLPermissions{
+		CapabilitiesBitmap: pc.CapabilitiesBitmap,
+		AllowedParameters:  copyParameters(pc.AllowedParameters),
+		DeniedParameters:   copyParameters(pc.DeniedParameters),
+		RequiredParameters: pc.RequiredParameters,
+		MinWrappingTTL:     pc.MinWrappingTTL,
+		MaxWrappingTTL:     pc.MaxWrappingTTL,
+		ControlGroup:       pc.ControlGroup,
+		sources:            []ACLRuleSource{{Policy: policy, Path: pattern}},
+		schedule:           pc.Schedule,
+		boundCIDRs:         pc.BoundNets,
+	}
+}
+
+// conditional returns whether the permissions only apply to some requests
+func (p *ACLPermissions) conditional() bool {
+	return p.schedule != nil || len(p.boundCIDRs) > 0
+}
+
+// appliesIn returns whether the permissions apply in the given environment.
+// Permissions bound to addresses never apply if the address is unknown.
+func (p *ACLPermissions) appliesIn(env *aclEnvironment) bool {
+	if p.schedule != nil && !p.schedule.Contains(env.now) {
+		return false
+	}
+	if len(p.boundCIDRs) == 0 {
+		return true
+	}
+	if env.remoteIP == nil {
+		return false
+	}
+	for _, cidr := range p.boundCIDRs {
+		if cidr.Contains(env.remoteIP) {
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a copy of the permissions that can be merged into without
+// modifying the original.
+func (p *ACLPermissions) clone() *ACLPermissions {
+	c := *p
+	c.AllowedParameters = copyParameters(p.AllowedParameters)
+	c.DeniedParameters = copyParameters(p.DeniedParameters)
+	c.RequiredParameters = append([]string(nil), p.RequiredParameters...)
+	c.sources = append([]ACLRuleSource(nil), p.sources...)
+	return &c
+}
+
+// denyPermissions returns permissions that only deny, keeping the sources of
+// the rules that caused the denial.
+func denyPermissions(sources []ACLRuleSource) *ACLPermissions {
+	return &ACLPermissions{
+		CapabilitiesBitmap: DenyCapabilityInt,
+		sources:            sources,
+	}
+}
+
+// merge adds the permissions granted by another policy for the same path.
+// Capabilities and denied parameters are combined; parameters, wrapping TTLs
+// and control groups are only restricted or required if both policies
+// restrict or require them, since either one would allow the request on its
+// own. If both require a control group, that of the first is kept.
+func (p *ACLPermissions) merge(other *ACLPermissions) {
+	p.CapabilitiesBitmap |= other.CapabilitiesBitmap
+	p.sources = append(p.sources, other.sources...)
+
+	if other.ControlGroup == nil {
+		p.ControlGroup = nil
+	}
+
+	var required []string
+	for _, param := range p.RequiredParameters {
+		if strutil.StrListContains(other.RequiredParameters, param) {
+			required = append(required, param)
+		}
+	}
+	p.RequiredParameters = required
+
+	if other.MinWrappingTTL < p.MinWrappingTTL {
+		p.MinWrappingTTL = other.MinWrappingTTL
+	}
+	if p.MaxWrappingTTL == 0 || other.MaxWrappingTTL == 0 {
+		p.MaxWrappingTTL = 0
+	} else if other.MaxWrappingTTL > p.MaxWrappingTTL {
+		p.MaxWrappingTTL = other.MaxWrappingTTL
+	}
+
+	if len(p.AllowedParameters) == 0 || len(other.AllowedParameters) == 0 {
+		p.AllowedParameters = nil
+	} else {
+		for key, values := range other.AllowedParameters {
+			existing, ok := p.AllowedParameters[key]
+			if !ok {
+				p.AllowedParameters[key] = values
+				continue
+			}
+			p.AllowedParameters[key] = mergeParameterValues(existing, values)
+		}
+	}
+
+	for key, values := range other.DeniedParameters {
+		if p.DeniedParameters == nil {
+			p.DeniedParameters = make(map[string][]interface{})
+		}
+		existing, ok := p.DeniedParameters[key]
+		if !ok {
+			p.DeniedParameters[key] = values
+			continue
+		}
+		p.DeniedParameters[key] = mergeParameterValues(existing, values)
+	}
+}
+
+// allowParameters checks the given request data against the allowed and
+// denied parameters, and against the required parameters if required is set.
+func (p *ACLPermissions) allowParameters(data map[string]interface{}, required bool) bool {
+	if _, ok := p.DeniedParameters["*"]; ok {
+		return false
+	}
+
+	if required && len(p.RequiredParameters) > 0 {
+		present := make([]string, 0, len(data))
+		for key := range data {
+			present = append(present, strings.ToLower(key))
+		}
+		if !strutil.StrListSubset(present, p.RequiredParameters) {
+			return false
+		}
+	}
+	_, allowedAll := p.AllowedParameters["*"]
+
+	for key, value := range data {
+		key = strings.ToLower(key)
+
+		if denied, ok := p.DeniedParameters[key]; ok {
+			if len(denied) == 0 || parameterValueInList(value, denied) {
+				return false
+			}
+		}
+
+		if len(p.AllowedParameters) == 0 {
+			continue
+		}
+		allowed, ok := p.AllowedParameters[key]
+		switch {
+		case !ok && !allowedAll:
+			return false
+		case ok && len(allowed) > 0 && !parameterValueInList(value, allowed):
+			return false
+		}
+	}
+	return true
+}
+
+// mergeParameterValues combines two value lists for the same parameter. An
+// empty list stands for any value, so it wins over any other list.
+func mergeParameterValues(a, b []interface{}) []interface{} {
+	if len(a) == 0 || len(b) == 0 {
+		return []interface{}{}
+	}
+	merged := make([]interface{}, 0, len(a)+len(b))
+	merged = append(merged, a...)
+	return append(merged, b...)
+}
+
+// parameterValueInList checks whether a request value matches one of the
+// values given in a policy. Values are compared in their string form, since
+// request data and policies do not agree on numeric types, and a trailing
+// "*" in a policy value matches any suffix.
+func parameterValueInList(value interface{}, list []interface{}) bool {
+	var values []string
+	switch v := value.(type) {
+	case []interface{}:
+		// Every element of a list has to match
+		for _, elem := range v {
+			if !parameterValueInList(elem, list) {
+				return false
+			}
+		}
+		return len(v) > 0
+	case []string:
+		values = v
+	default:
+		values = []string{fmt.Sprintf("%v", v)}
+	}
+
+	for _, val := range values {
+		found := false
+		for _, item := range list {
+			pattern := fmt.Sprintf("%v", item)
+			if pattern == val ||
+				(strings.HasSuffix(pattern, "*") && strings.HasPrefix(val, strings.TrimSuffix(pattern, "*"))) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return len(values) > 0
+}
+
+func copyParameters(params map[string][]interface{}) map[string][]interface{} {
+	if params == nil {
+		return nil
+	}
+	ret := make(map[string][]interface{}, len(params))
+	for k, v := range params {
+		ret[k] = v
+	}
+	return ret
+}
+
+// firstWildcard returns the offset of the first wildcard in a pattern.
+func firstWildcard(pattern string) int {
+	offset := 0
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "+" {
+			return offset
+		}
+		if i := strings.Index(segment, "*"); i != -1 {
+			return offset + i
+		}
+		offset += len(segment) + 1
+	}
+	return len(pattern)
+}
+
+func countSegmentWildcards(pattern string) int {
+	count := 0
+	for _, segment := range strings.Split(pattern, "/") {
+		if segment == "+" {
+			count++
+		}
+	}
+	return count
+}
+
+// globDenial records a glob path denied by one of the policies making up
+// an ACL.
+type globDenial struct {
+	prefix    string
+	wildcards bool
+	policy    int
+}
+
+// covers returns whether every path matched by a rule with the given prefix
+// is also matched by the denial.
+func (d globDenial) covers(prefix string) bool {
+	if !d.wildcards {
+		return strings.HasPrefix(prefix, d.prefix)
+	}
+	return matchSegmentWildcards(d.prefix+"*", prefix)
 }
 
 // New is used to construct a policy based ACL from a set of policies.
+// Policies in shadow mode are left out, but kept aside to check what they
+// would deny.
 func NewACL(policies []*Policy) (*ACL, error) {
+	var enforced []*Policy
+	var shadowPolicies []string
+	for _, policy := range policies {
+		if policy != nil && policy.Shadow {
+			shadowPolicies = append(shadowPolicies, policy.Name)
+			continue
+		}
+		enforced = append(enforced, policy)
+	}
+
+	a, err := newACL(enforced)
+	if err != nil {
+		return nil, err
+	}
+	if len(shadowPolicies) > 0 {
+		if a.shadow, err = newACL(policies); err != nil {
+			return nil, err
+		}
+		a.shadowPolicies = shadowPolicies
+	}
+	return a, nil
+}
+
+func newACL(policies []*Policy) (*ACL, error) {
 	// Initialize
 	a := &ACL{
-		exactRules: radix.New(),
-		globRules:  radix.New(),
-		root:       false,
+		exactRules:    radix.New(),
+		globRules:     radix.New(),
+		wildcardRules: radix.New(),
+		root:          false,
+		now:           time.Now,
+	}
+
+	// Collect the glob denials of each policy, as these take precedence over
+	// anything other policies allow beneath them. Denials that only apply to
+	// some requests are left to their own path.
+	var globDenials []globDenial
+	for i, policy := range policies {
+		if policy == nil {
+			continue
+		}
+		for _, pc := range policy.Paths {
+			if pc.Glob && !pc.Templated && pc.Schedule == nil && len(pc.BoundNets) == 0 &&
+				pc.CapabilitiesBitmap&DenyCapabilityInt > 0 {
+				globDenials = append(globDenials, globDenial{
+					prefix:    pc.Prefix,
+					wildcards: pc.SegmentWildcards,
+					policy:    i,
+				})
+			}
+		}
 	}
 
 	// Inject each policy
-	for _, policy := range policies {
+	for i, policy := range policies {
 		// Ignore a nil policy object
 		if policy == nil {
 			continue
@@ -37,63 +506,178 @@ func NewACL(policies []*Policy) (*ACL, error) {
 		if policy.Name == "root" {
 			a.root = true
 		}
+		if policy.RateLimit != nil {
+			if a.rateLimits == nil {
+				a.rateLimits = make(map[string]*RateLimit)
+			}
+			a.rateLimits[policy.Name] = policy.RateLimit
+		}
 		for _, pc := range policy.Paths {
+			// Templated paths only apply once resolved for an identity
+			if pc.Templated {
+				continue
+			}
+
 			// Check which tree to use
 			tree := a.exactRules
-			if pc.Glob {
+			key := pc.Prefix
+			switch {
+			case pc.SegmentWildcards:
+				tree = a.wildcardRules
+				if pc.Glob {
+					key += "*"
+				}
+			case pc.Glob:
 				tree = a.globRules
 			}
 
+			// A denial by another policy covering this whole path overrides
+			// whatever this policy grants
+			perms := newACLPermissions(policy.Name, pc)
+			for _, denial := range globDenials {
+				if denial.policy != i && denial.covers(pc.Prefix) {
+					perms = denyPermissions([]ACLRuleSource{{
+						Policy: policies[denial.policy].Name,
+						Path:   denial.prefix + "*",
+					}})
+					break
+				}
+			}
+
 			// Check for an existing policy
-			raw, ok := tree.Get(pc.Prefix)
+			raw, ok := tree.Get(key)
 			if !ok {
-				tree.Insert(pc.Prefix, pc.CapabilitiesBitmap)
+				rule := &aclRule{}
+				rule.add(perms)
+				tree.Insert(key, rule)
 				continue
 			}
-			existing := raw.(uint32)
-
-			switch {
-			case existing&DenyCapabilityInt > 0:
-				// If we are explicitly denied in the existing capability set,
-				// don't save anything else
-
-			case pc.CapabilitiesBitmap&DenyCapabilityInt > 0:
-				// If this new policy explicitly denies, only save the deny value
-				tree.Insert(pc.Prefix, DenyCapabilityInt)
-
-			default:
-				// Insert the capabilities in this new policy into the existing
-				// value
-				tree.Insert(pc.Prefix, existing|pc.CapabilitiesBitmap)
-			}
+			raw.(*aclRule).add(perms)
 		}
 	}
 	return a, nil
 }
 
-func (a *ACL) Capabilities(path string) (pathCapabilities []string) {
-	// Fast-path root
-	if a.root {
-		return []string{RootCapability}
+// permissions returns the pattern and permissions of the most specific rule
+// matching the given path, as they apply in the given environment. The
+// pattern is empty if there is no such rule, and the permissions are nil if
+// there is no rule or it does not apply.
+func (a *ACL) permissions(path string, env *aclEnvironment) (string, *ACLPermissions) {
+	pattern, rule := a.rule(path)
+	if rule == nil {
+		return "", nil
 	}
+	return pattern, rule.permissions(env)
+}
+
+// environment returns the environment the given request is checked in. The
+// request may be nil if there is none, in which case rules bound to
+// addresses do not apply.
+func (a *ACL) environment(req *logical.Request) *aclEnvironment {
+	env := &aclEnvironment{now: a.now()}
+	if req != nil && req.Connection != nil {
+		env.remoteIP = net.ParseIP(req.Connection.RemoteAddr)
+	}
+	return env
+}
 
+// rule returns the pattern and rule that are the most specific match for the
+// given path, or nil if there is no such rule.
+func (a *ACL) rule(path string) (string, *aclRule) {
 	// Find an exact matching rule, look for glob if no match
-	var capabilities uint32
 	raw, ok := a.exactRules.Get(path)
 	if ok {
-		capabilities = raw.(uint32)
-		goto CHECK
+		return path, raw.(*aclRule)
+	}
+
+	// Find a glob rule
+	var bestPattern string
+	var best *aclRule
+	if prefix, raw, ok := a.globRules.LongestPrefix(path); ok {
+		bestPattern = prefix + "*"
+		best = raw.(*aclRule)
+	}
+
+	// Check whether a rule with segment wildcards is more specific
+	a.wildcardRules.Walk(func(pattern string, raw interface{}) bool {
+		if !matchSegmentWildcards(pattern, path) {
+			return false
+		}
+		if best == nil || morePreciseThan(pattern, bestPattern) {
+			bestPattern = pattern
+			best = raw.(*aclRule)
+		}
+		return false
+	})
+
+	return bestPattern, best
+}
+
+// matchSegmentWildcards checks whether the given path matches a pattern in
+// which "+" segments match any single segment, and a trailing "*" globs.
+func matchSegmentWildcards(pattern, path string) bool {
+	glob := strings.HasSuffix(pattern, "*")
+	patternSegments := strings.Split(strings.TrimSuffix(pattern, "*"), "/")
+	pathSegments := strings.Split(path, "/")
+
+	if len(pathSegments) < len(patternSegments) ||
+		(!glob && len(pathSegments) != len(patternSegments)) {
+		return false
+	}
+
+	last := len(patternSegments) - 1
+	for i, segment := range patternSegments {
+		switch {
+		case segment == "+":
+			// A wildcard segment matches anything, but only one segment
+			// unless the pattern globs after it
+			if i == last && glob {
+				return true
+			}
+		case i == last && glob:
+			return strings.HasPrefix(pathSegments[i], segment)
+		case segment != pathSegments[i]:
+			return false
+		}
 	}
+	return true
+}
 
-	// Find a glob rule, default deny if no match
-	_, raw, ok = a.globRules.LongestPrefix(path)
-	if !ok {
+// morePreciseThan returns whether the first of two patterns matching the same
+// path takes precedence. In order, a pattern is more precise if its first
+// wildcard comes later, if it does not glob, if it has fewer "+" segments, if
+// it is longer, and finally if it sorts later.
+func morePreciseThan(a, b string) bool {
+	if aPos, bPos := firstWildcard(a), firstWildcard(b); aPos != bPos {
+		return aPos > bPos
+	}
+	if aGlob, bGlob := strings.HasSuffix(a, "*"), strings.HasSuffix(b, "*"); aGlob != bGlob {
+		return bGlob
+	}
+	if aCount, bCount := countSegmentWildcards(a), countSegmentWildcards(b); aCount != bCount {
+		return aCount < bCount
+	}
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+// Capabilities returns the capabilities the ACL grants on the given path.
+// Rules bound to addresses are left out, as there is no request to check.
+func (a *ACL) Capabilities(path string) (pathCapabilities []string) {
+	// Fast-path root
+	if a.root {
+		return []string{RootCapability}
+	}
+
+	// Default deny if no rule matches
+	_, perms := a.permissions(path, a.environment(nil))
+	if perms == nil {
 		return []string{DenyCapability}
-	} else {
-		capabilities = raw.(uint32)
 	}
+	capabilities := perms.CapabilitiesBitmap
 
-CHECK:
 	if capabilities&SudoCapabilityInt > 0 {
 		pathCapabilities = append(pathCapabilities, SudoCapability)
 	}
@@ -106,6 +690,9 @@ CHECK:
 	if capabilities&UpdateCapabilityInt > 0 {
 		pathCapabilities = append(pathCapabilities, UpdateCapability)
 	}
+	if capabilities&PatchCapabilityInt > 0 {
+		pathCapabilities = append(pathCapabilities, PatchCapability)
+	}
 	if capabilities&DeleteCapabilityInt > 0 {
 		pathCapabilities = append(pathCapabilities, DeleteCapability)
 	}
@@ -121,59 +708,204 @@ CHECK:
 	return
 }
 
-// AllowOperation is used to check if the given operation is permitted. The
+// WrappingTTLs returns the bounds on the response wrapping TTL of the given
+// request. Zero values mean there is no bound.
+func (a *ACL) WrappingTTLs(req *logical.Request) (min, max time.Duration) {
+	if a.root {
+		return 0, 0
+	}
+
+	_, perms := a.permissions(req.Path, a.environment(req))
+	if perms == nil {
+		return 0, 0
+	}
+	return perms.MinWrappingTTL, perms.MaxWrappingTTL
+}
+
+// ControlGroup returns the control group that must approve the given request
+// before it is carried out, or nil if there is none.
+func (a *ACL) ControlGroup(req *logical.Request) *ControlGroup {
+	if a.root {
+		return nil
+	}
+
+	_, perms := a.permissions(req.Path, a.environment(req))
+	if perms == nil {
+		return nil
+	}
+	return perms.ControlGroup
+}
+
+// RateLimits returns the rate limits of the policies whose rules allow the
+// given request, by policy name, or nil if none of them has one.
+func (a *ACL) RateLimits(req *logical.Request) map[string]*RateLimit {
+	if a.root || len(a.rateLimits) == 0 {
+		return nil
+	}
+
+	explanation := a.Explain(req)
+	if !explanation.Allowed {
+		return nil
+	}
+	var limits map[string]*RateLimit
+	for _, source := range explanation.Sources {
+		limit, ok := a.rateLimits[source.Policy]
+		if !ok {
+			continue
+		}
+		if limits == nil {
+			limits = make(map[string]*RateLimit)
+		}
+		limits[source.Policy] = limit
+	}
+	return limits
+}
+
+// AllowOperation is used to check if the given request is permitted. The
 // first bool indicates if an op is allowed, the second whether sudo priviliges
 // exist for that op and path.
-func (a *ACL) AllowOperation(op logical.Operation, path string) (allowed bool, sudo bool) {
+func (a *ACL) AllowOperation(req *logical.Request) (allowed bool, sudo bool) {
+	explanation := a.Explain(req)
+	if explanation.Allowed && a.allowHook != nil {
+		var policies []string
+		for _, source := range explanation.Sources {
+			if !strutil.StrListContains(policies, source.Policy) {
+				policies = append(policies, source.Policy)
+			}
+		}
+		a.allowHook(policies)
+	}
+	return explanation.Allowed, explanation.Sudo
+}
+
+// ShadowDenials returns the policies in shadow mode that would deny the given
+// request if they were enforced. Requests to root protected paths must also
+// have sudo privileges.
+func (a *ACL) ShadowDenials(req *logical.Request, rootPath bool) []string {
+	if a.shadow == nil {
+		return nil
+	}
+	explanation := a.shadow.Explain(req)
+	if explanation.Allowed && (!rootPath || explanation.Sudo) {
+		return nil
+	}
+
+	var denials []string
+	for _, source := range explanation.Sources {
+		if strutil.StrListContains(a.shadowPolicies, source.Policy) &&
+			!strutil.StrListContains(denials, source.Policy) {
+			denials = append(denials, source.Policy)
+		}
+	}
+
+	// If no rule of a shadow policy decided it, such as when one that does
+	// not apply at this time is the most specific, blame them all
+	if len(denials) == 0 {
+		return a.shadowPolicies
+	}
+	return denials
+}
+
+// Explain checks if the given request is permitted like AllowOperation, and
+// also returns which rule made the decision and why.
+func (a *ACL) Explain(req *logical.Request) *ACLExplanation {
 	// Fast-path root
 	if a.root {
-		return true, true
+		return &ACLExplanation{
+			Allowed: true,
+			Sudo:    true,
+			Sources: []ACLRuleSource{{Policy: "root"}},
+			Reason:  "the root policy allows everything",
+		}
 	}
+	op := req.Operation
 
 	// Help is always allowed
 	if op == logical.HelpOperation {
-		return true, false
+		return &ACLExplanation{
+			Allowed: true,
+			Reason:  "help is always allowed",
+		}
 	}
 
-	// Find an exact matching rule, look for glob if no match
-	var capabilities uint32
-	raw, ok := a.exactRules.Get(path)
-	if ok {
-		capabilities = raw.(uint32)
-		goto CHECK
+	// Default deny if no rule matches
+	pattern, perms := a.permissions(req.Path, a.environment(req))
+	if pattern == "" {
+		return &ACLExplanation{
+			Reason: "no policy has a rule matching the path",
+		}
+	}
+	if perms == nil {
+		return &ACLExplanation{
+			Pattern: pattern,
+			Reason:  "the matching rule does not apply at this time or from this address",
+		}
 	}
+	capabilities := perms.CapabilitiesBitmap
 
-	// Find a glob rule, default deny if no match
-	_, raw, ok = a.globRules.LongestPrefix(path)
-	if !ok {
-		return false, false
-	} else {
-		capabilities = raw.(uint32)
+	explanation := &ACLExplanation{
+		Pattern: pattern,
+		Sources: perms.sources,
+	}
+	if capabilities&DenyCapabilityInt > 0 {
+		explanation.Reason = "the matching rule denies access"
+		return explanation
 	}
 
-CHECK:
 	// Check if the minimum permissions are met
-	// If "deny" has been explicitly set, only deny will be in the map, so we
-	// only need to check for the existence of other values
-	sudo = capabilities&SudoCapabilityInt > 0
+	var required string
+	explanation.Sudo = capabilities&SudoCapabilityInt > 0
 	switch op {
 	case logical.ReadOperation:
-		allowed = capabilities&ReadCapabilityInt > 0
+		explanation.Allowed = capabilities&ReadCapabilityInt > 0
+		required = ReadCapability
 	case logical.ListOperation:
-		allowed = capabilities&ListCapabilityInt > 0
+		explanation.Allowed = capabilities&ListCapabilityInt > 0
+		required = ListCapability
 	case logical.UpdateOperation:
-		allowed = capabilities&UpdateCapabilityInt > 0
+		explanation.Allowed = capabilities&UpdateCapabilityInt > 0
+		required = UpdateCapability
+	case logical.PatchOperation:
+		explanation.Allowed = capabilities&PatchCapabilityInt > 0
+		required = PatchCapability
 	case logical.DeleteOperation:
-		allowed = capabilities&DeleteCapabilityInt > 0
+		explanation.Allowed = capabilities&DeleteCapabilityInt > 0
+		required = DeleteCapability
 	case logical.CreateOperation:
-		allowed = capabilities&CreateCapabilityInt > 0
+		explanation.Allowed = capabilities&CreateCapabilityInt > 0
+		required = CreateCapability
 
 	// These three re-use UpdateCapabilityInt since that's the most appropriate capability/operation mapping
 	case logical.RevokeOperation, logical.RenewOperation, logical.RollbackOperation:
-		allowed = capabilities&UpdateCapabilityInt > 0
+		explanation.Allowed = capabilities&UpdateCapabilityInt > 0
+		required = UpdateCapability
 
 	default:
-		return false, false
+		return &ACLExplanation{
+			Reason: fmt.Sprintf("unsupported operation '%s'", op),
+		}
 	}
-	return
+
+	if !explanation.Allowed {
+		explanation.Reason = fmt.Sprintf("the matching rule does not grant the '%s' capability", required)
+		return explanation
+	}
+
+	// Parameters are checked on every operation that carries them, such as
+	// the query parameters of reads, lists and deletes. Required parameters
+	// only apply to the operations that write data.
+	write := op == logical.UpdateOperation || op == logical.CreateOperation || op == logical.PatchOperation
+	if write || len(req.Data) > 0 {
+		if !perms.allowParameters(req.Data, write) {
+			explanation.Allowed = false
+			explanation.Reason = "the request parameters are not permitted by the matching rule"
+			return explanation
+		}
+	}
+
+	explanation.Reason = fmt.Sprintf("the matching rule grants the '%s' capability", required)
+	if cg := perms.ControlGroup; cg != nil {
+		explanation.Reason += fmt.Sprintf(" once approved by %d holder(s) of the '%s' policy", cg.Approvals, cg.Policy)
+	}
+	return explanation
 }
@@ -3,6 +3,7 @@ package vault
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 )
@@ -59,7 +60,7 @@ func TestACL_Root(t *testing.T) {
 		t.Fatalf("err: %v", err)
 	}
 
-	allowed, rootPrivs := acl.AllowOperation(logical.UpdateOperation, "sys/mount/foo")
+	allowed, rootPrivs := acl.AllowOperation(&logical.Request{Operation: logical.UpdateOperation, Path: "sys/mount/foo"})
 	if !rootPrivs {
 		t.Fatalf("expected root")
 	}
@@ -81,7 +82,7 @@ func TestACL_Single(t *testing.T) {
 
 	// Type of operation is not important here as we only care about checking
 	// sudo/root
-	_, rootPrivs := acl.AllowOperation(logical.ReadOperation, "sys/mount/foo")
+	_, rootPrivs := acl.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "sys/mount/foo"})
 	if rootPrivs {
 		t.Fatalf("unexpected root")
 	}
@@ -117,7 +118,7 @@ func TestACL_Single(t *testing.T) {
 	}
 
 	for _, tc := range tcases {
-		allowed, rootPrivs := acl.AllowOperation(tc.op, tc.path)
+		allowed, rootPrivs := acl.AllowOperation(&logical.Request{Operation: tc.op, Path: tc.path})
 		if allowed != tc.allowed {
 			t.Fatalf("bad: case %#v: %v, %v", tc, allowed, rootPrivs)
 		}
@@ -148,7 +149,7 @@ func TestACL_Layered(t *testing.T) {
 func testLayeredACL(t *testing.T, acl *ACL) {
 	// Type of operation is not important here as we only care about checking
 	// sudo/root
-	_, rootPrivs := acl.AllowOperation(logical.ReadOperation, "sys/mount/foo")
+	_, rootPrivs := acl.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "sys/mount/foo"})
 	if rootPrivs {
 		t.Fatalf("unexpected root")
 	}
@@ -180,7 +181,8 @@ func testLayeredACL(t *testing.T, acl *ACL) {
 		{logical.ReadOperation, "prod/aws/foo", false, false},
 
 		{logical.ReadOperation, "sys/status", false, false},
-		{logical.UpdateOperation, "sys/seal", true, true},
+		// Denied by "sys/*" in the other policy
+		{logical.UpdateOperation, "sys/seal", false, false},
 
 		{logical.ReadOperation, "foo/bar", false, false},
 		{logical.ListOperation, "foo/bar", false, false},
@@ -189,7 +191,7 @@ func testLayeredACL(t *testing.T, acl *ACL) {
 	}
 
 	for _, tc := range tcases {
-		allowed, rootPrivs := acl.AllowOperation(tc.op, tc.path)
+		allowed, rootPrivs := acl.AllowOperation(&logical.Request{Operation: tc.op, Path: tc.path})
 		if allowed != tc.allowed {
 			t.Fatalf("bad: case %#v: %v, %v", tc, allowed, rootPrivs)
 		}
@@ -199,6 +201,896 @@ func testLayeredACL(t *testing.T, acl *ACL) {
 	}
 }
 
+func TestACL_DenyAcrossPolicies(t *testing.T) {
+	policy1, err := Parse(aclDenyPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	policy2, err := Parse(aclDenyPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		allowed bool
+	}
+	tcases := []tcase{
+		// Within a single policy the most specific rule still applies
+		{logical.ReadOperation, "secret/foo", true},
+		{logical.ReadOperation, "secret/admin/foo", false},
+		{logical.ReadOperation, "secret/admin/public", true},
+
+		// A glob denial overrides more specific rules in other policies
+		{logical.ReadOperation, "secret/admin/keys", false},
+		{logical.ReadOperation, "secret/admin/keys/foo", false},
+
+		// Rules outside of the denied prefix are unaffected
+		{logical.ReadOperation, "other/foo", true},
+		{logical.ReadOperation, "secret/adminx", true},
+	}
+
+	for _, tc := range tcases {
+		allowed, _ := acl.AllowOperation(&logical.Request{Operation: tc.op, Path: tc.path})
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+}
+
+func TestACL_Explain(t *testing.T) {
+	policy1, err := Parse(aclPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy2, err := Parse(aclPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy3, err := Parse(aclDenyPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy4, err := Parse(aclDenyPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy1, policy2, policy3, policy4})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		allowed bool
+		pattern string
+		sources []ACLRuleSource
+		reason  string
+	}
+	tcases := []tcase{
+		{logical.ReadOperation, "prod/foo", true, "prod/*",
+			[]ACLRuleSource{{"dev", "prod/*"}, {"ops", "prod/*"}},
+			"the matching rule grants the 'read' capability"},
+		{logical.DeleteOperation, "stage/aws/foo", false, "stage/aws/*",
+			[]ACLRuleSource{{"dev", "stage/aws/*"}},
+			"the matching rule does not grant the 'delete' capability"},
+		{logical.ReadOperation, "foo/bar", false, "foo/bar",
+			[]ACLRuleSource{{"ops", "foo/bar"}},
+			"the matching rule denies access"},
+		{logical.ReadOperation, "secret/admin/keys", false, "secret/admin/keys",
+			[]ACLRuleSource{{"secrets", "secret/admin/*"}},
+			"the matching rule denies access"},
+		{logical.ReadOperation, "unknown/path", false, "", nil,
+			"no policy has a rule matching the path"},
+	}
+
+	for _, tc := range tcases {
+		explanation := acl.Explain(&logical.Request{Operation: tc.op, Path: tc.path})
+		if explanation.Allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %#v", tc, explanation)
+		}
+		if explanation.Pattern != tc.pattern {
+			t.Fatalf("bad: case %#v: %#v", tc, explanation)
+		}
+		if !reflect.DeepEqual(explanation.Sources, tc.sources) {
+			t.Fatalf("bad: case %#v: %#v", tc, explanation)
+		}
+		if explanation.Reason != tc.reason {
+			t.Fatalf("bad: case %#v: %#v", tc, explanation)
+		}
+	}
+}
+
+func TestACL_Parameters(t *testing.T) {
+	policy, err := Parse(aclParametersPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		data    map[string]interface{}
+		allowed bool
+	}
+	tcases := []tcase{
+		{logical.UpdateOperation, "db/roles/foo", nil, true},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"sql": "CREATE"}, true},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"ttl": "1h"}, true},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"TTL": "2h"}, true},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"ttl": "3h"}, false},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"max_ttl": "1h"}, false},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"other": "1h"}, false},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"names": []interface{}{"app-a", "app-b"}}, true},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"names": []interface{}{"app-a", "web"}}, false},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"num_uses": float64(1)}, true},
+		{logical.UpdateOperation, "db/roles/foo", map[string]interface{}{"num_uses": float64(2)}, false},
+		{logical.ReadOperation, "db/roles/foo", nil, true},
+		{logical.ReadOperation, "db/roles/foo", map[string]interface{}{"ttl": "1h"}, true},
+		{logical.ReadOperation, "db/roles/foo", map[string]interface{}{"max_ttl": "1h"}, false},
+
+		{logical.UpdateOperation, "kv/foo", map[string]interface{}{"value": "bar"}, true},
+		{logical.UpdateOperation, "kv/foo", map[string]interface{}{"value": "root"}, false},
+		{logical.UpdateOperation, "kv/foo", map[string]interface{}{"ttl": "1h"}, false},
+
+		{logical.UpdateOperation, "locked/foo", nil, false},
+		{logical.UpdateOperation, "locked/foo", map[string]interface{}{"value": "bar"}, false},
+	}
+
+	for _, tc := range tcases {
+		req := &logical.Request{
+			Operation: tc.op,
+			Path:      tc.path,
+			Data:      tc.data,
+		}
+		allowed, _ := acl.AllowOperation(req)
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+}
+
+func TestACL_Patch(t *testing.T) {
+	policy, err := Parse(aclPatchPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	actual := acl.Capabilities("kv/data/foo")
+	expected := []string{"read", "patch"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual, expected)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		data    map[string]interface{}
+		allowed bool
+	}
+	tcases := []tcase{
+		{logical.PatchOperation, "kv/data/foo", map[string]interface{}{"data": "bar"}, true},
+		{logical.PatchOperation, "kv/data/foo", map[string]interface{}{"cas": 1}, false},
+		{logical.UpdateOperation, "kv/data/foo", map[string]interface{}{"data": "bar"}, false},
+		{logical.PatchOperation, "secret/foo", nil, false},
+		{logical.UpdateOperation, "secret/foo", nil, true},
+	}
+
+	for _, tc := range tcases {
+		req := &logical.Request{
+			Operation: tc.op,
+			Path:      tc.path,
+			Data:      tc.data,
+		}
+		allowed, _ := acl.AllowOperation(req)
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+}
+
+var aclPatchPolicy = `
+name = "patch"
+path "kv/data/*" {
+	capabilities = ["read", "patch"]
+	allowed_parameters = {
+		"data" = []
+	}
+}
+path "secret/*" {
+	policy = "write"
+}
+`
+
+func TestACL_ParametersMerged(t *testing.T) {
+	policy1, err := Parse(aclParametersPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	policy2, err := Parse(aclParametersPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path    string
+		data    map[string]interface{}
+		allowed bool
+	}
+	tcases := []tcase{
+		// Allowed values are combined
+		{"db/roles/foo", map[string]interface{}{"ttl": "3h"}, true},
+		{"db/roles/foo", map[string]interface{}{"ttl": "4h"}, false},
+		// Denied parameters are combined
+		{"db/roles/foo", map[string]interface{}{"sql": "DROP"}, false},
+		// No allowed parameters in the second policy means any are allowed
+		{"kv/foo", map[string]interface{}{"ttl": "1h"}, true},
+		{"kv/foo", map[string]interface{}{"value": "root"}, false},
+	}
+
+	for _, tc := range tcases {
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      tc.path,
+			Data:      tc.data,
+		}
+		allowed, _ := acl.AllowOperation(req)
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+
+	// Merging must not modify the policies themselves
+	if len(policy1.Paths[0].AllowedParameters["ttl"]) != 2 {
+		t.Fatalf("policy modified: %#v", policy1.Paths[0].AllowedParameters)
+	}
+}
+
+func TestACL_RequiredParameters(t *testing.T) {
+	policy1, err := Parse(`
+path "auth/token/create" {
+	capabilities = ["update"]
+	required_parameters = ["TTL", "policies"]
+}
+path "secret/*" {
+	capabilities = ["create", "update"]
+	required_parameters = ["value"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy1})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		data    map[string]interface{}
+		allowed bool
+	}
+	tcases := []tcase{
+		{logical.UpdateOperation, "auth/token/create", nil, false},
+		{logical.UpdateOperation, "auth/token/create", map[string]interface{}{"ttl": "1h"}, false},
+		{logical.UpdateOperation, "auth/token/create", map[string]interface{}{"ttl": "1h", "Policies": "foo"}, true},
+		{logical.CreateOperation, "secret/foo", map[string]interface{}{"other": "bar"}, false},
+		{logical.CreateOperation, "secret/foo", map[string]interface{}{"value": "bar"}, true},
+	}
+	for _, tc := range tcases {
+		req := &logical.Request{
+			Operation: tc.op,
+			Path:      tc.path,
+			Data:      tc.data,
+		}
+		allowed, _ := acl.AllowOperation(req)
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+
+	// A policy that does not require the parameter lifts the requirement
+	policy2, err := Parse(`
+path "auth/token/create" {
+	capabilities = ["update"]
+	required_parameters = ["policies"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err = NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req := &logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "auth/token/create",
+		Data:      map[string]interface{}{"policies": "foo"},
+	}
+	if allowed, _ := acl.AllowOperation(req); !allowed {
+		t.Fatalf("expected allowed")
+	}
+	req.Data = map[string]interface{}{"ttl": "1h"}
+	if allowed, _ := acl.AllowOperation(req); allowed {
+		t.Fatalf("expected denied")
+	}
+}
+
+func TestACL_SegmentWildcards(t *testing.T) {
+	policy, err := Parse(`
+path "secret/+/db-creds" {
+	capabilities = ["read"]
+}
+path "secret/+/db-creds/*" {
+	capabilities = ["list"]
+}
+path "secret/team-a/db-creds" {
+	capabilities = ["update"]
+}
+path "secret/*" {
+	capabilities = ["create"]
+}
+path "apps/+/+/config" {
+	capabilities = ["read"]
+}
+path "apps/prod/+/config" {
+	capabilities = ["update"]
+}
+path "users/+/private*" {
+	capabilities = ["deny"]
+}
+path "users/+/*" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !policy.Paths[0].SegmentWildcards || policy.Paths[2].SegmentWildcards {
+		t.Fatalf("bad: %#v", policy.Paths)
+	}
+
+	acl, err := NewACL([]*Policy{policy})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		allowed bool
+	}
+	tcases := []tcase{
+		{logical.ReadOperation, "secret/team-b/db-creds", true},
+		{logical.CreateOperation, "secret/team-b/db-creds", false},
+		{logical.ReadOperation, "secret/team-b/sub/db-creds", false},
+		{logical.CreateOperation, "secret/team-b/sub/db-creds", true},
+		// Both wildcards start at the same point, and "secret/*" has fewer
+		// "+" segments
+		{logical.ListOperation, "secret/team-b/db-creds/foo", false},
+		{logical.CreateOperation, "secret/team-b/db-creds/foo", true},
+
+		// An exact path wins over a wildcard
+		{logical.UpdateOperation, "secret/team-a/db-creds", true},
+		{logical.ReadOperation, "secret/team-a/db-creds", false},
+
+		// A later wildcard wins
+		{logical.UpdateOperation, "apps/prod/web/config", true},
+		{logical.ReadOperation, "apps/prod/web/config", false},
+		{logical.ReadOperation, "apps/dev/web/config", true},
+		{logical.ReadOperation, "apps/dev/config", false},
+
+		{logical.ReadOperation, "users/bob/public", true},
+		{logical.ReadOperation, "users/bob/private", false},
+		{logical.ReadOperation, "users/bob/private-keys/foo", false},
+	}
+	for _, tc := range tcases {
+		allowed, _ := acl.AllowOperation(&logical.Request{Operation: tc.op, Path: tc.path})
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+
+	// A wildcard denial in one policy covers rules of other policies
+	other, err := Parse(`
+path "users/bob/private" {
+	capabilities = ["read"]
+}
+path "users/bob/public" {
+	capabilities = ["update"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl, err = NewACL([]*Policy{policy, other})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if allowed, _ := acl.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "users/bob/private"}); allowed {
+		t.Fatalf("expected denied")
+	}
+	if allowed, _ := acl.AllowOperation(&logical.Request{Operation: logical.UpdateOperation, Path: "users/bob/public"}); !allowed {
+		t.Fatalf("expected allowed")
+	}
+}
+
+func TestACL_WrappingTTLs(t *testing.T) {
+	policy1, err := Parse(`
+path "secret/wrapped" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "1m"
+	max_wrapping_ttl = 3600
+}
+path "secret/both" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "2m"
+	max_wrapping_ttl = "1h"
+}
+path "secret/loose" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "1m"
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	policy2, err := Parse(`
+path "secret/both" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "1m"
+	max_wrapping_ttl = "2h"
+}
+path "secret/loose" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path string
+		min  time.Duration
+		max  time.Duration
+	}
+	tcases := []tcase{
+		{"secret/wrapped", time.Minute, time.Hour},
+		{"secret/both", time.Minute, 2 * time.Hour},
+		{"secret/loose", 0, 0},
+		{"secret/other", 0, 0},
+	}
+	for _, tc := range tcases {
+		min, max := acl.WrappingTTLs(&logical.Request{Path: tc.path})
+		if min != tc.min || max != tc.max {
+			t.Fatalf("bad: case %#v: %s, %s", tc, min, max)
+		}
+	}
+}
+
+func TestACL_AllowedTimes(t *testing.T) {
+	policy1, err := Parse(`
+path "secret/*" {
+	capabilities = ["read"]
+}
+path "secret/prod/*" {
+	capabilities = ["read", "update"]
+	allowed_times = ["Mon-Thu 09:00-17:00"]
+}
+path "secret/night" {
+	capabilities = ["read"]
+	allowed_times = ["* 22:00-06:00"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy2, err := Parse(`
+path "secret/prod/*" {
+	capabilities = ["deny"]
+	allowed_times = ["Mon 12:00-13:00"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy2.Name = "freeze"
+
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// 2016-08-01 is a Monday
+	type tcase struct {
+		now     string
+		op      logical.Operation
+		path    string
+		allowed bool
+	}
+	tcases := []tcase{
+		{"2016-08-01T10:00:00Z", logical.UpdateOperation, "secret/prod/foo", true},
+		{"2016-08-01T12:30:00Z", logical.ReadOperation, "secret/prod/foo", false},
+		{"2016-08-04T16:59:00Z", logical.UpdateOperation, "secret/prod/foo", true},
+		{"2016-08-04T17:00:00Z", logical.ReadOperation, "secret/prod/foo", false},
+		{"2016-08-05T10:00:00Z", logical.UpdateOperation, "secret/prod/foo", false},
+		{"2016-08-05T10:00:00Z", logical.ReadOperation, "secret/foo", true},
+		{"2016-08-05T23:00:00Z", logical.ReadOperation, "secret/night", true},
+		{"2016-08-06T05:59:00Z", logical.ReadOperation, "secret/night", true},
+		{"2016-08-06T06:00:00Z", logical.ReadOperation, "secret/night", false},
+	}
+
+	for _, tc := range tcases {
+		now, err := time.Parse(time.RFC3339, tc.now)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		acl.now = func() time.Time { return now }
+
+		allowed, _ := acl.AllowOperation(&logical.Request{Operation: tc.op, Path: tc.path})
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+
+	explanation := acl.Explain(&logical.Request{Operation: logical.ReadOperation, Path: "secret/night"})
+	if explanation.Allowed || explanation.Pattern != "secret/night" ||
+		explanation.Reason != "the matching rule does not apply at this time or from this address" {
+		t.Fatalf("bad: %#v", explanation)
+	}
+}
+
+func TestACL_BoundCIDRs(t *testing.T) {
+	policy, err := Parse(`
+path "secret/*" {
+	capabilities = ["read"]
+}
+path "secret/prod/*" {
+	capabilities = ["read", "update"]
+	bound_cidrs = ["10.0.0.0/8", "192.168.1.0/24"]
+}
+path "secret/office" {
+	capabilities = ["read"]
+	bound_cidrs = ["172.16.0.0/12"]
+	allowed_times = ["Mon-Fri"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{policy})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// 2016-08-01 is a Monday
+	now := time.Date(2016, 8, 1, 12, 0, 0, 0, time.UTC)
+	acl.now = func() time.Time { return now }
+
+	type tcase struct {
+		op         logical.Operation
+		path       string
+		remoteAddr string
+		allowed    bool
+	}
+	tcases := []tcase{
+		{logical.UpdateOperation, "secret/prod/foo", "10.1.2.3", true},
+		{logical.UpdateOperation, "secret/prod/foo", "192.168.1.20", true},
+		{logical.ReadOperation, "secret/prod/foo", "192.168.2.20", false},
+		{logical.ReadOperation, "secret/prod/foo", "", false},
+		{logical.ReadOperation, "secret/prod/foo", "not-an-address", false},
+		{logical.ReadOperation, "secret/foo", "192.168.2.20", true},
+		{logical.ReadOperation, "secret/office", "172.16.5.5", true},
+		{logical.ReadOperation, "secret/office", "10.1.2.3", false},
+	}
+
+	for _, tc := range tcases {
+		req := &logical.Request{Operation: tc.op, Path: tc.path}
+		if tc.remoteAddr != "" {
+			req.Connection = &logical.Connection{RemoteAddr: tc.remoteAddr}
+		}
+		allowed, _ := acl.AllowOperation(req)
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+
+	// Time windows apply as well
+	now = now.Add(5 * 24 * time.Hour)
+	req := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "secret/office",
+		Connection: &logical.Connection{RemoteAddr: "172.16.5.5"},
+	}
+	if allowed, _ := acl.AllowOperation(req); allowed {
+		t.Fatalf("expected to be denied")
+	}
+
+	// Without an address, rules bound to addresses do not apply
+	if caps := acl.Capabilities("secret/prod/foo"); !reflect.DeepEqual(caps, []string{DenyCapability}) {
+		t.Fatalf("bad: %#v", caps)
+	}
+}
+
+func TestACL_ControlGroup(t *testing.T) {
+	gated, err := Parse(`
+path "secret/prod/*" {
+	capabilities = ["read", "update"]
+	control_group {
+		policy = "approvers"
+		approvals = 2
+	}
+}
+path "secret/shared/*" {
+	capabilities = ["read"]
+	control_group {
+		policy = "approvers"
+	}
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	open, err := Parse(`
+path "secret/shared/*" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{gated, open})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := &logical.Request{Operation: logical.UpdateOperation, Path: "secret/prod/db"}
+	cg := acl.ControlGroup(req)
+	if cg == nil || cg.Policy != "approvers" || cg.Approvals != 2 {
+		t.Fatalf("bad: %#v", cg)
+	}
+	explanation := acl.Explain(req)
+	if !explanation.Allowed || explanation.Reason !=
+		"the matching rule grants the 'update' capability once approved by 2 holder(s) of the 'approvers' policy" {
+		t.Fatalf("bad: %#v", explanation)
+	}
+
+	// A policy granting access without approval wins
+	if cg := acl.ControlGroup(&logical.Request{Operation: logical.ReadOperation, Path: "secret/shared/foo"}); cg != nil {
+		t.Fatalf("bad: %#v", cg)
+	}
+}
+
+func TestACL_RateLimits(t *testing.T) {
+	limited, err := Parse(`
+rate_limit {
+	rps = 5
+}
+path "secret/*" {
+	capabilities = ["read"]
+}
+path "secret/admin" {
+	capabilities = ["deny"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	limited.Name = "limited"
+	open, err := Parse(`
+path "secret/shared" {
+	capabilities = ["read"]
+}
+path "sys/*" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	open.Name = "open"
+
+	acl, err := NewACL([]*Policy{limited, open})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	limits := acl.RateLimits(&logical.Request{Operation: logical.ReadOperation, Path: "secret/foo"})
+	if !reflect.DeepEqual(limits, map[string]*RateLimit{"limited": limited.RateLimit}) {
+		t.Fatalf("bad: %#v", limits)
+	}
+
+	// Requests allowed by other policies, or denied, are not limited
+	for _, path := range []string{"secret/shared", "sys/mounts", "secret/admin"} {
+		if limits := acl.RateLimits(&logical.Request{Operation: logical.ReadOperation, Path: path}); limits != nil {
+			t.Fatalf("bad: %s: %#v", path, limits)
+		}
+	}
+}
+
+func TestACL_Shadow(t *testing.T) {
+	enforced, err := Parse(`
+path "secret/*" {
+	capabilities = ["read", "update"]
+}
+path "sys/raw/*" {
+	capabilities = ["read", "sudo"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	enforced.Name = "enforced"
+	shadow, err := Parse(`
+path "secret/prod/*" {
+	capabilities = ["read"]
+}
+path "secret/new/*" {
+	capabilities = ["read"]
+}
+path "sys/raw/foo" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	shadow.Name = "tightened"
+	shadow.Shadow = true
+
+	acl, err := NewACL([]*Policy{enforced, shadow})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op       logical.Operation
+		path     string
+		rootPath bool
+		allowed  bool
+		denials  []string
+	}
+	tcases := []tcase{
+		{logical.ReadOperation, "secret/foo", false, true, nil},
+		{logical.UpdateOperation, "secret/foo", false, true, nil},
+		{logical.ReadOperation, "secret/prod/db", false, true, nil},
+		{logical.UpdateOperation, "secret/prod/db", false, true, []string{"tightened"}},
+		{logical.ReadOperation, "sys/raw/foo", true, true, []string{"tightened"}},
+
+		// Shadow policies grant nothing
+		{logical.DeleteOperation, "secret/new/foo", false, false, nil},
+	}
+	for _, tc := range tcases {
+		req := &logical.Request{Operation: tc.op, Path: tc.path}
+		allowed, _ := acl.AllowOperation(req)
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+		if !allowed {
+			continue
+		}
+		if denials := acl.ShadowDenials(req, tc.rootPath); !reflect.DeepEqual(denials, tc.denials) {
+			t.Fatalf("bad: case %#v: %#v", tc, denials)
+		}
+	}
+	if caps := acl.Capabilities("secret/prod/db"); !reflect.DeepEqual(caps, []string{"read", "update"}) {
+		t.Fatalf("bad: %#v", caps)
+	}
+}
+
+var aclParametersPolicy = `
+name = "params"
+path "db/roles/*" {
+	capabilities = ["read", "update"]
+	allowed_parameters = {
+		"ttl" = ["1h", "2h"]
+		"sql" = []
+		"names" = ["app-*"]
+		"num_uses" = [1]
+	}
+	denied_parameters = {
+		"max_ttl" = []
+	}
+}
+path "kv/*" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"value" = []
+	}
+	denied_parameters = {
+		"value" = ["root"]
+	}
+}
+path "locked/*" {
+	capabilities = ["update"]
+	denied_parameters = {
+		"*" = []
+	}
+}
+`
+
+var aclParametersPolicy2 = `
+name = "params2"
+path "db/roles/*" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"ttl" = ["3h"]
+		"sql" = []
+	}
+	denied_parameters = {
+		"sql" = ["DROP"]
+	}
+}
+path "kv/*" {
+	capabilities = ["update"]
+}
+`
+
+var aclDenyPolicy = `
+name = "secrets"
+path "secret/*" {
+	capabilities = ["read"]
+}
+path "secret/admin/*" {
+	capabilities = ["deny"]
+}
+path "secret/admin/public" {
+	capabilities = ["read"]
+}
+`
+
+var aclDenyPolicy2 = `
+name = "admin"
+path "secret/admin/keys" {
+	capabilities = ["read"]
+}
+path "secret/admin/keys/*" {
+	capabilities = ["read"]
+}
+path "secret/adminx" {
+	capabilities = ["read"]
+}
+path "other/*" {
+	capabilities = ["read"]
+}
+`
+
 var tokenCreationPolicy = `
 name = "tokenCreation"
 path "auth/token/create*" {
@@ -118,6 +118,20 @@ func (c *Core) disableCredential(path string) error {
 		return fmt.Errorf("no matching backend")
 	}
 
+	if err := c.taintCredential(path); err != nil {
+		return err
+	}
+
+	// Revoke credentials from this path, which can take longer than a
+	// request when there are many, then remove the backend
+	return c.expiration.QueueRevokePrefix(fullPath, false, func() error {
+		return c.removeCredential(path, view)
+	})
+}
+
+// taintCredential is used to stop routing requests to a credential backend
+// being disabled
+func (c *Core) taintCredential(path string) error {
 	c.authLock.Lock()
 	defer c.authLock.Unlock()
 
@@ -127,19 +141,22 @@ func (c *Core) disableCredential(path string) error {
 	}
 
 	// Taint the router path to prevent routing
-	if err := c.router.Taint(fullPath); err != nil {
-		return err
-	}
+	return c.router.Taint(credentialRoutePrefix + path)
+}
 
-	// Revoke credentials from this path
-	if err := c.expiration.RevokePrefix(fullPath); err != nil {
-		return err
-	}
+// removeCredential is used to remove a tainted credential backend once its
+// leases are revoked
+func (c *Core) removeCredential(path string, view *BarrierView) error {
+	fullPath := credentialRoutePrefix + path
+
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
 
 	// Unmount the backend
 	if err := c.router.Unmount(fullPath); err != nil {
 		return err
 	}
+	c.loginLockouts.UnlockMount(fullPath)
 
 	// Clear the data in the view
 	if view != nil {
@@ -1,6 +1,10 @@
 package vault
 
-import "sort"
+import (
+	"sort"
+
+	"github.com/hashicorp/vault/logical"
+)
 
 // Struct to identify user input errors.
 // This is helpful in responding the appropriate status codes to clients
@@ -20,6 +24,26 @@ func (c *Core) Capabilities(token, path string) ([]string, error) {
 		return nil, &StatusBadRequest{Err: "missing path"}
 	}
 
+	capabilities, err := c.CapabilitiesPaths(token, []string{path})
+	if err != nil {
+		return nil, err
+	}
+	return capabilities[path], nil
+}
+
+// CapabilitiesPaths is used to fetch the capabilities of the given token on
+// each of the given paths. The token's ACL is only built once, so this is
+// cheaper than fetching the capabilities of each path in turn.
+func (c *Core) CapabilitiesPaths(token string, paths []string) (map[string][]string, error) {
+	if len(paths) == 0 {
+		return nil, &StatusBadRequest{Err: "missing path"}
+	}
+	for _, path := range paths {
+		if path == "" {
+			return nil, &StatusBadRequest{Err: "missing path"}
+		}
+	}
+
 	if token == "" {
 		return nil, &StatusBadRequest{Err: "missing token"}
 	}
@@ -32,29 +56,50 @@ func (c *Core) Capabilities(token, path string) ([]string, error) {
 		return nil, &StatusBadRequest{Err: "invalid token"}
 	}
 
-	if te.Policies == nil {
-		return []string{DenyCapability}, nil
+	result := make(map[string][]string, len(paths))
+	if len(te.Policies) == 0 {
+		for _, path := range paths {
+			result[path] = []string{DenyCapability}
+		}
+		return result, nil
 	}
 
-	var policies []*Policy
-	for _, tePolicy := range te.Policies {
-		policy, err := c.policyStore.GetPolicy(tePolicy)
-		if err != nil {
-			return nil, err
-		}
-		policies = append(policies, policy)
+	acl, err := c.policyStore.identityACL(c.tokenStore.identityForToken(te), te.Policies...)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(policies) == 0 {
-		return []string{DenyCapability}, nil
+	for _, path := range paths {
+		capabilities := acl.Capabilities(path)
+		sort.Strings(capabilities)
+		result[path] = capabilities
+	}
+	return result, nil
+}
+
+// ExplainAccess is used to explain whether the given token may make the given
+// request, and which of its policy rules decided it
+func (c *Core) ExplainAccess(token string, req *logical.Request) (*ACLExplanation, error) {
+	if req.Path == "" {
+		return nil, &StatusBadRequest{Err: "missing path"}
+	}
+
+	if token == "" {
+		return nil, &StatusBadRequest{Err: "missing token"}
+	}
+
+	te, err := c.tokenStore.Lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return nil, &StatusBadRequest{Err: "invalid token"}
 	}
 
-	acl, err := NewACL(policies)
+	acl, err := c.policyStore.identityACL(c.tokenStore.identityForToken(te), te.Policies...)
 	if err != nil {
 		return nil, err
 	}
 
-	capabilities := acl.Capabilities(path)
-	sort.Strings(capabilities)
-	return capabilities, nil
+	return acl.Explain(req), nil
 }
@@ -43,3 +43,30 @@ func TestCapabilities(t *testing.T) {
 		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual, expected)
 	}
 }
+
+func TestCapabilitiesPaths(t *testing.T) {
+	c, _, token := TestCoreUnsealed(t)
+
+	policy, _ := Parse(aclPolicy)
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testCoreMakeToken(t, c, token, "capabilitiestoken", "", []string{"dev"})
+
+	actual, err := c.CapabilitiesPaths("capabilitiestoken", []string{"foo/bar", "stage/aws/test", "nope"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := map[string][]string{
+		"foo/bar":        []string{"create", "read", "sudo"},
+		"stage/aws/test": []string{"list", "read", "sudo", "update"},
+		"nope":           []string{"deny"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual, expected)
+	}
+
+	if _, err := c.CapabilitiesPaths("capabilitiestoken", []string{"foo/bar", ""}); err == nil {
+		t.Fatalf("expected error")
+	}
+}
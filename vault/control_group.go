@@ -0,0 +1,313 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// controlGroupSubPath is the sub-path used for the requests waiting
+	// for approval by a control group
+	controlGroupSubPath = "control-group/"
+
+	// defaultControlGroupTTL is how long requests wait for approval if the
+	// control group does not say
+	defaultControlGroupTTL = 24 * time.Hour
+)
+
+// ControlGroupRequest is a request that must be approved by a control group
+// before it is carried out. Once approved, the requester carries it out by
+// making the same request again with the ID of the control group request.
+type ControlGroupRequest struct {
+	ID        string            `json:"id"`
+	Path      string            `json:"path"`
+	Operation logical.Operation `json:"operation"`
+
+	// DataHash is a hash of the request data, so that the request carried
+	// out is the one that was approved
+	DataHash string `json:"data_hash"`
+
+	// The token that made the request, which must be the one carrying it
+	// out, and who holds it, who cannot approve it
+	RequesterAccessor  string `json:"requester_accessor"`
+	RequesterName      string `json:"requester_name"`
+	RequesterPrincipal string `json:"requester_principal"`
+
+	// Policy is the policy authorizers must hold, and Approvals how many
+	// of them must approve
+	Policy    string `json:"policy"`
+	Approvals int    `json:"approvals"`
+
+	Authorizations []*ControlGroupAuthorization `json:"authorizations"`
+
+	CreationTime time.Time `json:"creation_time"`
+	ExpireTime   time.Time `json:"expire_time"`
+}
+
+// ControlGroupAuthorization is the approval of a request by one authorizer
+type ControlGroupAuthorization struct {
+	Accessor    string    `json:"accessor"`
+	DisplayName string    `json:"display_name"`
+	Time        time.Time `json:"time"`
+
+	// Principal is who holds the token that approved, see
+	// TokenEntry.principal
+	Principal string `json:"principal"`
+}
+
+// Approved returns whether enough authorizers have approved the request
+func (r *ControlGroupRequest) Approved() bool {
+	return len(r.Authorizations) >= r.Approvals
+}
+
+// ControlGroupPendingError is returned when a request must be approved by a
+// control group before it is carried out.
+type ControlGroupPendingError struct {
+	Request *ControlGroupRequest
+}
+
+func (e *ControlGroupPendingError) Error() string {
+	return fmt.Sprintf("request %s requires approval by %d holder(s) of the '%s' policy",
+		e.Request.ID, e.Request.Approvals, e.Request.Policy)
+}
+
+// ControlGroupStore holds the requests waiting for approval by control groups
+type ControlGroupStore struct {
+	view        *BarrierView
+	policyStore *PolicyStore
+
+	// lock serializes updates to requests, so that concurrent approvals
+	// are not lost
+	lock sync.Mutex
+}
+
+// NewControlGroupStore creates a new ControlGroupStore that is backed
+// using a given view. The policy store is used to check what policies
+// authorizers hold.
+func NewControlGroupStore(view *BarrierView, policyStore *PolicyStore) *ControlGroupStore {
+	return &ControlGroupStore{
+		view:        view,
+		policyStore: policyStore,
+	}
+}
+
+// setupControlGroups is used to initialize the control group store
+// when the vault is being unsealed.
+func (c *Core) setupControlGroups() error {
+	view := c.systemBarrierView.SubView(controlGroupSubPath)
+	c.controlGroups = NewControlGroupStore(view, c.policyStore)
+	return nil
+}
+
+// teardownControlGroups is used to reverse setupControlGroups
+// when the vault is being sealed.
+func (c *Core) teardownControlGroups() error {
+	c.controlGroups = nil
+	return nil
+}
+
+// check is used when a request requires approval by the given control
+// group. If the request does not carry out an approved control group
+// request, a new one is created and returned in a ControlGroupPendingError.
+// Approved requests are removed once carried out, so each approval is used
+// only once.
+func (s *ControlGroupStore) check(req *logical.Request, te *TokenEntry, cg *ControlGroup) error {
+	defer metrics.MeasureSince([]string{"control_group", "check"}, time.Now())
+	dataHash, err := hashRequestData(req.Data)
+	if err != nil {
+		return err
+	}
+
+	if req.ControlGroupID == "" {
+		return s.create(req, te, cg, dataHash)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cgReq, err := s.get(req.ControlGroupID)
+	if err != nil {
+		return err
+	}
+	if cgReq == nil || cgReq.RequesterAccessor != te.Accessor {
+		return fmt.Errorf("control group request %s not found", req.ControlGroupID)
+	}
+	if cgReq.Path != req.Path || cgReq.Operation != req.Operation || cgReq.DataHash != dataHash {
+		return fmt.Errorf("request does not match control group request %s", cgReq.ID)
+	}
+	if !cgReq.Approved() {
+		return fmt.Errorf("control group request %s has %d of %d approvals",
+			cgReq.ID, len(cgReq.Authorizations), cgReq.Approvals)
+	}
+
+	if err := s.view.Delete(cgReq.ID); err != nil {
+		return fmt.Errorf("failed to delete control group request: %v", err)
+	}
+	return nil
+}
+
+func (s *ControlGroupStore) create(req *logical.Request, te *TokenEntry, cg *ControlGroup, dataHash string) error {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return fmt.Errorf("failed to generate control group request ID: %v", err)
+	}
+
+	now := time.Now()
+	cgReq := &ControlGroupRequest{
+		ID:                 id,
+		Path:               req.Path,
+		Operation:          req.Operation,
+		DataHash:           dataHash,
+		RequesterAccessor:  te.Accessor,
+		RequesterName:      te.DisplayName,
+		RequesterPrincipal: te.principal(),
+		Policy:             cg.Policy,
+		Approvals:          cg.Approvals,
+		CreationTime:       now,
+		ExpireTime:         now.Add(cg.TTL),
+	}
+	if err := s.put(cgReq); err != nil {
+		return err
+	}
+	return &ControlGroupPendingError{Request: cgReq}
+}
+
+// Get returns the control group request with the given ID, or nil if it
+// does not exist or has expired.
+func (s *ControlGroupStore) Get(id string) (*ControlGroupRequest, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.get(id)
+}
+
+func (s *ControlGroupStore) get(id string) (*ControlGroupRequest, error) {
+	out, err := s.view.Get(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read control group request: %v", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	cgReq := new(ControlGroupRequest)
+	if err := out.DecodeJSON(cgReq); err != nil {
+		return nil, fmt.Errorf("failed to decode control group request: %v", err)
+	}
+
+	// Expired requests are cleaned up as they are found
+	if time.Now().After(cgReq.ExpireTime) {
+		if err := s.view.Delete(id); err != nil {
+			return nil, fmt.Errorf("failed to delete control group request: %v", err)
+		}
+		return nil, nil
+	}
+	return cgReq, nil
+}
+
+func (s *ControlGroupStore) put(cgReq *ControlGroupRequest) error {
+	entry, err := logical.StorageEntryJSON(cgReq.ID, cgReq)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := s.view.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist control group request: %v", err)
+	}
+	return nil
+}
+
+// Authorize records the approval of a control group request by the holder
+// of the given token, which must hold the policy the control group requires.
+// Approvals are counted once per principal rather than per token, since
+// anyone can create child tokens, and the principal of the requester cannot
+// approve its own request.
+func (s *ControlGroupStore) Authorize(id string, te *TokenEntry) (*ControlGroupRequest, error) {
+	defer metrics.MeasureSince([]string{"control_group", "authorize"}, time.Now())
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	cgReq, err := s.get(id)
+	if err != nil {
+		return nil, err
+	}
+	if cgReq == nil {
+		return nil, fmt.Errorf("control group request %s not found", id)
+	}
+	principal := te.principal()
+	if te.Accessor == cgReq.RequesterAccessor || principal == cgReq.RequesterPrincipal {
+		return nil, fmt.Errorf("requests cannot be authorized by the requester")
+	}
+	for _, authz := range cgReq.Authorizations {
+		if authz.Accessor == te.Accessor || authz.Principal == principal {
+			return nil, fmt.Errorf("request has already been authorized by this authorizer")
+		}
+	}
+
+	policies, err := s.policyStore.ExpandGroups(te.Policies)
+	if err != nil {
+		return nil, err
+	}
+	if !strutil.StrListContains(policies, cgReq.Policy) {
+		return nil, fmt.Errorf("authorizers must hold the '%s' policy", cgReq.Policy)
+	}
+
+	cgReq.Authorizations = append(cgReq.Authorizations, &ControlGroupAuthorization{
+		Accessor:    te.Accessor,
+		DisplayName: te.DisplayName,
+		Time:        time.Now(),
+		Principal:   principal,
+	})
+	if err := s.put(cgReq); err != nil {
+		return nil, err
+	}
+	return cgReq, nil
+}
+
+// hashRequestData returns a hash of the data of a request. Map keys are
+// sorted when encoding, so this is stable.
+func hashRequestData(data map[string]interface{}) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode request data: %v", err)
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// controlGroupResponse returns the response describing a control group
+// request and its approvals.
+func controlGroupResponse(cgReq *ControlGroupRequest) *logical.Response {
+	authorizations := make([]map[string]interface{}, 0, len(cgReq.Authorizations))
+	for _, authz := range cgReq.Authorizations {
+		authorizations = append(authorizations, map[string]interface{}{
+			"display_name": authz.DisplayName,
+			"time":         authz.Time.Format(time.RFC3339Nano),
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"control_group_id":   cgReq.ID,
+			"path":               cgReq.Path,
+			"operation":          string(cgReq.Operation),
+			"requester":          cgReq.RequesterName,
+			"policy":             cgReq.Policy,
+			"approvals_required": cgReq.Approvals,
+			"authorizations":     authorizations,
+			"approved":           cgReq.Approved(),
+			"creation_time":      cgReq.CreationTime.Format(time.RFC3339Nano),
+			"expire_time":        cgReq.ExpireTime.Format(time.RFC3339Nano),
+		},
+	}
+}
@@ -0,0 +1,182 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+var controlGroupPolicy = `
+path "secret/prod/*" {
+	capabilities = ["create", "read", "update"]
+	control_group {
+		policy = "approvers"
+		approvals = 2
+	}
+}
+`
+
+var controlGroupApproversPolicy = `
+path "sys/control-group/authorize" {
+	capabilities = ["update"]
+}
+`
+
+// testControlGroupChild creates a child token of the given token, with the
+// same policies, and returns it
+func testControlGroupChild(t *testing.T, c *Core, parent string) string {
+	parentEntry, err := c.tokenStore.Lookup(parent)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req := logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = parent
+	req.Data["policies"] = parentEntry.Policies
+	req.Data["display_name"] = "someone-else"
+	resp, err := c.tokenStore.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	return resp.Auth.ClientToken
+}
+
+func TestCore_ControlGroup(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	for name, rules := range map[string]string{
+		"prod":      controlGroupPolicy,
+		"approvers": controlGroupApproversPolicy,
+	} {
+		policy, err := Parse(rules)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		policy.Name = name
+		if err := c.policyStore.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	TestLoginToken(t, c, "requester", []string{"prod", "approvers"})
+	TestLoginToken(t, c, "approver1", []string{"approvers"})
+	TestLoginToken(t, c, "approver2", []string{"approvers"})
+	TestLoginToken(t, c, "bystander", []string{"default"})
+
+	write := func(controlGroupID string, value string) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation:      logical.UpdateOperation,
+			Path:           "secret/prod/db",
+			ClientToken:    "requester",
+			ControlGroupID: controlGroupID,
+			Data:           map[string]interface{}{"password": value},
+		})
+	}
+	authorize := func(token, id string) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        "sys/control-group/authorize",
+			ClientToken: token,
+			Data:        map[string]interface{}{"id": id, "token": token},
+		})
+	}
+
+	// The request waits for approval
+	resp, err := write("", "hunter2")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	id, _ := resp.Data["control_group_id"].(string)
+	if id == "" || resp.Data["approved"] != false || resp.Data["approvals_required"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if out, _ := c.router.Route(&logical.Request{Operation: logical.ReadOperation, Path: "secret/prod/db"}); out != nil {
+		t.Fatalf("request should not have been carried out: %#v", out)
+	}
+
+	// It cannot be carried out until approved
+	if _, err := write(id, "hunter2"); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// The requester and tokens without the policy cannot approve
+	for _, token := range []string{"requester", "bystander"} {
+		if _, err := authorize(token, id); err == nil {
+			t.Fatalf("expected error authorizing with %s", token)
+		}
+	}
+
+	// Neither can child tokens of the requester
+	if _, err := authorize(testControlGroupChild(t, c, "requester"), id); err == nil {
+		t.Fatalf("expected error authorizing with a child of the requester")
+	}
+
+	resp, err = authorize("approver1", id)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if _, err := authorize("approver1", id); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// An authorizer cannot approve again through its child tokens
+	if _, err := authorize(testControlGroupChild(t, c, "approver1"), id); err == nil {
+		t.Fatalf("expected error authorizing with a child of an authorizer")
+	}
+	resp, err = authorize("approver2", id)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp.Data["approved"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Only the approved request can be carried out
+	resp, err = write(id, "something-else")
+	if err == nil || !strings.Contains(resp.Data["error"].(string), "does not match") {
+		t.Fatalf("bad: %v %#v", err, resp)
+	}
+	if resp, err := write(id, "hunter2"); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	out, err := c.router.Route(&logical.Request{Operation: logical.ReadOperation, Path: "secret/prod/db"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || out.Data["password"] != "hunter2" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Approvals are only used once
+	if _, err := write(id, "hunter2"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestSystemBackend_ControlGroupRequest(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	te := &TokenEntry{Accessor: "requester-accessor", DisplayName: "token-requester"}
+	cg := &ControlGroup{Policy: "approvers", Approvals: 1, TTL: defaultControlGroupTTL}
+	err := c.controlGroups.check(&logical.Request{Operation: logical.ReadOperation, Path: "secret/foo"}, te, cg)
+	pending, ok := err.(*ControlGroupPendingError)
+	if !ok {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "control-group/request")
+	req.Data["id"] = pending.Request.ID
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["path"] != "secret/foo" || resp.Data["operation"] != "read" ||
+		resp.Data["requester"] != "token-requester" || resp.Data["approved"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req.Data["id"] = "missing"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+}
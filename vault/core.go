@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -202,6 +203,17 @@ type Core struct {
 	// policy store is used to manage named ACL policies
 	policyStore *PolicyStore
 
+	// controlGroups holds the requests waiting for approval
+	controlGroups *ControlGroupStore
+
+	// mfa holds the MFA methods, where they are enforced, and the logins
+	// waiting for MFA
+	mfa *MFAStore
+
+	// loginLockouts tracks the failed logins of users, locking out those
+	// that fail too many times
+	loginLockouts *LoginLockouts
+
 	// token store is used to manage authentication tokens
 	tokenStore *TokenStore
 
@@ -220,6 +232,10 @@ type Core struct {
 	// cachingDisabled indicates whether caches are disabled
 	cachingDisabled bool
 
+	// policyCacheSize is the number of policies the policy store caches,
+	// or zero for the default
+	policyCacheSize int
+
 	clusterName string
 }
 
@@ -249,6 +265,9 @@ type CoreConfig struct {
 	// Custom cache size of zero for default
 	CacheSize int `json:"cache_size" structs:"cache_size" mapstructure:"cache_size"`
 
+	// Custom policy cache size of zero for default
+	PolicyCacheSize int `json:"policy_cache_size" structs:"policy_cache_size" mapstructure:"policy_cache_size"`
+
 	// Set as the leader address for HA
 	AdvertiseAddr string `json:"advertise_addr" structs:"advertise_addr" mapstructure:"advertise_addr"`
 
@@ -274,6 +293,9 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	if conf.DefaultLeaseTTL > conf.MaxLeaseTTL {
 		return nil, fmt.Errorf("cannot have DefaultLeaseTTL larger than MaxLeaseTTL")
 	}
+	if conf.PolicyCacheSize < 0 {
+		return nil, fmt.Errorf("cannot have a negative PolicyCacheSize")
+	}
 
 	// Validate the advertise addr if its given to us
 	if conf.AdvertiseAddr != "" {
@@ -337,7 +359,9 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		defaultLeaseTTL: conf.DefaultLeaseTTL,
 		maxLeaseTTL:     conf.MaxLeaseTTL,
 		cachingDisabled: conf.DisableCache,
+		policyCacheSize: conf.PolicyCacheSize,
 		clusterName:     conf.ClusterName,
+		loginLockouts:   NewLoginLockouts(),
 	}
 
 	if conf.HAPhysical != nil && conf.HAPhysical.HAEnabled() {
@@ -426,8 +450,13 @@ func (c *Core) fetchACLandTokenEntry(req *logical.Request) (*ACL, *TokenEntry, e
 		return nil, nil, logical.ErrPermissionDenied
 	}
 
+	// Tokens bound to CIDR blocks can only be used from within them
+	if len(te.BoundCIDRs) > 0 && !remoteAddrAllowed(req.Connection, te.BoundCIDRs) {
+		return nil, nil, logical.ErrPermissionDenied
+	}
+
 	// Construct the corresponding ACL object
-	acl, err := c.policyStore.ACL(te.Policies...)
+	acl, err := c.policyStore.identityACL(c.tokenStore.identityForToken(te), te.Policies...)
 	if err != nil {
 		c.logger.Printf("[ERR] core: failed to construct ACL: %v", err)
 		return nil, nil, ErrInternalError
@@ -444,6 +473,11 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		return nil, te, err
 	}
 
+	// Batch tokens have no cubbyhole, as it would never be destroyed
+	if te != nil && isBatchToken(te.ID) && strings.HasPrefix(req.Path, "cubbyhole/") {
+		return nil, te, logical.ErrPermissionDenied
+	}
+
 	// Check if this is a root protected path
 	rootPath := c.router.RootPath(req.Path)
 
@@ -486,7 +520,7 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 
 	// Check the standard non-root ACLs. Return the token entry if it's not
 	// allowed so we can decrement the use count.
-	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
+	allowed, rootPrivs := acl.AllowOperation(req)
 	if !allowed {
 		return nil, te, logical.ErrPermissionDenied
 	}
@@ -494,6 +528,46 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		return nil, te, logical.ErrPermissionDenied
 	}
 
+	// Rule policies are checked once the path rules allow the request
+	if !acl.root {
+		denied, err := c.policyStore.CheckRulePolicies(req, te)
+		if err != nil {
+			c.logger.Printf("[WARN] core: request to '%s' denied: %v", req.Path, err)
+			return nil, te, logical.ErrPermissionDenied
+		}
+		if denied != "" {
+			return nil, te, logical.ErrPermissionDenied
+		}
+	}
+
+	// Requests count against the rate limits of the policies allowing them
+	if limited := c.policyStore.allowRate(te.ID, acl.RateLimits(req)); limited != "" {
+		return nil, te, logical.ErrRateLimited
+	}
+
+	// Policies in shadow mode do not deny anything, but what they would deny
+	// is recorded in the audit log
+	req.ShadowDenials = acl.ShadowDenials(req, rootPath)
+	if len(req.ShadowDenials) > 0 {
+		metrics.IncrCounter([]string{"policy", "shadow_denial"}, 1)
+	}
+
+	// Check that the request is response wrapped as the policies require
+	minWrapTTL, maxWrapTTL := acl.WrappingTTLs(req)
+	if minWrapTTL > 0 && req.WrapTTL < minWrapTTL {
+		return nil, te, fmt.Errorf("request must be response wrapped with a TTL of at least %s", minWrapTTL)
+	}
+	if maxWrapTTL > 0 && (req.WrapTTL == 0 || req.WrapTTL > maxWrapTTL) {
+		return nil, te, fmt.Errorf("request must be response wrapped with a TTL of at most %s", maxWrapTTL)
+	}
+
+	// Check that the request has been approved if the policies require it
+	if cg := acl.ControlGroup(req); cg != nil {
+		if err := c.controlGroups.check(req, te, cg); err != nil {
+			return nil, te, err
+		}
+	}
+
 	// Create the auth response
 	auth := &logical.Auth{
 		ClientToken: req.ClientToken,
@@ -794,7 +868,7 @@ func (c *Core) sealInitCommon(req *logical.Request) (retErr error) {
 	}
 
 	// Verify that this operation is allowed
-	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
+	allowed, rootPrivs := acl.AllowOperation(req)
 	if !allowed {
 		retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
 		return retErr
@@ -880,7 +954,7 @@ func (c *Core) StepDown(req *logical.Request) (retErr error) {
 	}
 
 	// Verify that this operation is allowed
-	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
+	allowed, rootPrivs := acl.AllowOperation(req)
 	if !allowed {
 		retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
 		return retErr
@@ -982,6 +1056,12 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupPolicyStore(); err != nil {
 		return err
 	}
+	if err := c.setupControlGroups(); err != nil {
+		return err
+	}
+	if err := c.setupMFA(); err != nil {
+		return err
+	}
 	if err := c.loadCredentials(); err != nil {
 		return err
 	}
@@ -1032,6 +1112,12 @@ func (c *Core) preSeal() error {
 	if err := c.teardownCredentials(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down credentials: {{err}}", err))
 	}
+	if err := c.teardownMFA(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down MFA: {{err}}", err))
+	}
+	if err := c.teardownControlGroups(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down control groups: {{err}}", err))
+	}
 	if err := c.teardownPolicyStore(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down policy store: {{err}}", err))
 	}
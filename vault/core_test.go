@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -672,6 +673,10 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 		DisplayName:  "foo-armon",
 		TTL:          time.Hour * 24,
 		CreationTime: te.CreationTime,
+		EntityName:   "foo-armon",
+		EntityMeta: map[string]string{
+			"user": "armon",
+		},
 	}
 
 	if !reflect.DeepEqual(te, expect) {
@@ -684,6 +689,446 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 	}
 }
 
+func TestCore_HandleLogin_BoundCIDRs(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:   []string{"foo"},
+				BoundCIDRs: []string{"10.0.0.0/8"},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	_, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Attempt to login
+	lreq := &logical.Request{
+		Path: "auth/foo/login",
+	}
+	lresp, err := c.HandleRequest(lreq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The token is bound to the CIDR blocks given by the backend
+	te, err := c.tokenStore.Lookup(lresp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(te.BoundCIDRs, []string{"10.0.0.0/8"}) {
+		t.Fatalf("bad: %#v", te)
+	}
+}
+
+func TestCore_HandleLogin_BatchToken(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"foo"},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	_, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Tune it to issue batch tokens
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["token_type"] = "bogus"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+	req.Data["token_type"] = TokenTypeBatch
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/auth/foo/tune")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["token_type"] != TokenTypeBatch {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Attempt to login
+	lreq := &logical.Request{
+		Path: "auth/foo/login",
+	}
+	lresp, err := c.HandleRequest(lreq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	clientToken := lresp.Auth.ClientToken
+	if !isBatchToken(clientToken) || lresp.Auth.Renewable {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+
+	// The token is usable, but has no lease and no cubbyhole
+	te, err := c.tokenStore.Lookup(clientToken)
+	if err != nil || te == nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+	if !reflect.DeepEqual(te.Policies, []string{"default", "foo"}) || te.Path != "auth/foo/login" {
+		t.Fatalf("bad: %#v", te)
+	}
+	leaseTimes, err := c.expiration.FetchLeaseTimesByToken(te.Path, te.ID)
+	if err != nil || leaseTimes != nil {
+		t.Fatalf("bad: %#v %v", leaseTimes, err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = clientToken
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "cubbyhole/foo")
+	req.Data["foo"] = "bar"
+	req.ClientToken = clientToken
+	if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_HandleRequest_CubbyholeTTL(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "cubbyhole/foo")
+	req.Data["foo"] = "bar"
+	req.Data["ttl"] = "1s"
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Secret == nil || !strings.HasPrefix(resp.Secret.LeaseID, "cubbyhole/foo/") {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "cubbyhole/foo")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The entry is removed once its lease expires, while the token lives on
+	time.Sleep(2 * time.Second)
+
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestCore_HandleLogin_AuthMountTune(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"foo"},
+				LeaseOptions: logical.LeaseOptions{
+					TTL: 2 * time.Hour,
+				},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.Data["description"] = "foo logins"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The mount is hidden from unauthenticated clients by default
+	listReq := logical.TestRequest(t, logical.ReadOperation, "sys/internal/ui/mounts")
+	resp, err := c.HandleRequest(listReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(resp.Data["auth"].(map[string]interface{})) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Tune it
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["listing_visibility"] = "bogus"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+	req.Data["listing_visibility"] = ListingVisibilityUnauth
+	req.Data["explicit_max_ttl"] = "1h"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/auth/foo/tune")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["explicit_max_ttl"] != 3600 || resp.Data["listing_visibility"] != ListingVisibilityUnauth {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = c.HandleRequest(listReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"foo/": map[string]interface{}{
+			"type":        "noop",
+			"description": "foo logins",
+		},
+	}
+	if !reflect.DeepEqual(resp.Data["auth"], exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data["auth"], exp)
+	}
+
+	// Tokens issued by the mount are limited by its explicit max TTL
+	lresp, err := c.HandleRequest(&logical.Request{
+		Path: "auth/foo/login",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if lresp.Auth.TTL != time.Hour {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+	te, err := c.tokenStore.Lookup(lresp.Auth.ClientToken)
+	if err != nil || te == nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+	if te.ExplicitMaxTTL != time.Hour {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// Hiding it again
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["listing_visibility"] = ListingVisibilityHidden
+	req.Data["explicit_max_ttl"] = "system"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err = c.HandleRequest(listReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(resp.Data["auth"].(map[string]interface{})) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	noop.Response.Auth.ExplicitMaxTTL = 0
+	noop.Response.Auth.TTL = 2 * time.Hour
+	lresp, err = c.HandleRequest(&logical.Request{
+		Path: "auth/foo/login",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if lresp.Auth.TTL != 2*time.Hour {
+		t.Fatalf("bad: %#v", lresp.Auth)
+	}
+}
+
+func TestCore_HandleLogin_Lockout(t *testing.T) {
+	failure := logical.ErrorResponse("invalid username or password")
+	success := &logical.Response{
+		Auth: &logical.Auth{
+			Policies: []string{"foo"},
+		},
+	}
+	noop := &NoopBackend{
+		Login:    []string{"login", "login/*"},
+		Response: failure,
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	// Enable the credential backend
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/auth/foo/tune")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["lockout_threshold"] != 5 || resp.Data["lockout_duration"] != 900 || resp.Data["lockout_enable"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	login := func(user string) (*logical.Response, error) {
+		path := "auth/foo/login"
+		if user != "" {
+			path += "/" + user
+		}
+		return c.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Connection: &logical.Connection{
+				RemoteAddr: "127.0.0.1",
+			},
+		})
+	}
+	backoff := func(user string) {
+		c.loginLockouts.failures["auth/foo/"][user].last = time.Now().Add(-time.Minute)
+	}
+
+	// Failures are not tracked until lockouts are enabled on the mount
+	for i := 0; i < 3; i++ {
+		if resp, err := login("alice"); err != nil || resp != failure {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+
+	// Lock out users after two failures
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["lockout_threshold"] = -1
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+	req.Data["lockout_threshold"] = 2
+	req.Data["lockout_duration"] = "1h"
+	req.Data["lockout_enable"] = true
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/auth/foo/tune")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["lockout_threshold"] != 2 || resp.Data["lockout_duration"] != 3600 || resp.Data["lockout_enable"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A failed login has to be followed by a wait
+	if resp, err := login("alice"); err != nil || resp != failure {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if _, err := login("alice"); err == nil || !errwrap.Contains(err, logical.ErrRateLimited.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The second failure locks the user out
+	backoff("alice")
+	if resp, err := login("Alice"); err != nil || resp != failure {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	backoff("alice")
+	noop.Response = success
+	resp, err = login("alice")
+	if err == nil || !errwrap.Contains(err, logical.ErrRateLimited.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.Contains(resp.Data["error"].(string), "try again in 1h0m0s") {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Other users can still login
+	if resp, err := login("bob"); err != nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/locked-users")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	users := resp.Data["by_mount"].(map[string]interface{})["auth/foo/"].(map[string]interface{})
+	alice := users["alice"].(map[string]interface{})
+	if len(users) != 1 || alice["locked"] != true || alice["failed_attempts"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Unlocking the user lets them login
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/locked-users/foo/unlock/alice")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+	if resp, err := login("alice"); err != nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Failures of logins without a username are not tracked, even from
+	// the same address
+	noop.Response = failure
+	for i := 0; i < 3; i++ {
+		if resp, err := login(""); err != nil || resp != failure {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+	if _, ok := c.loginLockouts.failures["auth/foo/"]; ok {
+		t.Fatalf("bad: %#v", c.loginLockouts.failures)
+	}
+
+	// Failures are not tracked once lockouts are disabled again
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo/tune")
+	req.Data["lockout_enable"] = false
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if resp, err := login("alice"); err != nil || resp != failure {
+			t.Fatalf("bad: %#v %v", resp, err)
+		}
+	}
+}
+
 func TestCore_HandleRequest_AuditTrail(t *testing.T) {
 	// Create a noop audit backend
 	noop := &NoopAudit{}
@@ -748,6 +1193,163 @@ func TestCore_HandleRequest_AuditTrail(t *testing.T) {
 	}
 }
 
+func TestCore_HandleRequest_AuditTrail_ShadowPolicy(t *testing.T) {
+	noop := &NoopAudit{}
+	c, _, root := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop = &NoopAudit{
+			Config: config,
+		}
+		return noop, nil
+	}
+
+	for name, rules := range map[string]string{
+		"writer":    `path "secret/*" { capabilities = ["create", "update"] }`,
+		"read-only": `path "secret/test" { capabilities = ["read"] }`,
+	} {
+		policy, err := Parse(rules)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		policy.Name = name
+		policy.Shadow = name == "read-only"
+		if err := c.policyStore.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	testCoreMakeToken(t, c, root, "client", "", []string{"writer", "read-only"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The write is allowed, but audited as denied by the shadow policy
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/test",
+		Data:        map[string]interface{}{"foo": "bar"},
+		ClientToken: "client",
+	}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(noop.Req) != 1 || !reflect.DeepEqual(noop.Req[0].ShadowDenials, []string{"read-only"}) {
+		t.Fatalf("bad: %#v", noop.Req)
+	}
+}
+
+func TestCore_HandleRequest_RulePolicy(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	testCoreMakeToken(t, c, root, "child", "", []string{"test"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/policy/test")
+	req.Data["rules"] = `path "secret/*" { policy = "write" }`
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Writes to production secrets require MFA
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policy-rule/prod-mfa")
+	req.Data["paths"] = "secret/prod/*"
+	req.Data["condition"] = `operation == "read" || mfa`
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	write := func(token, path string) error {
+		_, err := c.HandleRequest(&logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        path,
+			Data:        map[string]interface{}{"foo": "bar"},
+			ClientToken: token,
+		})
+		return err
+	}
+	if err := write("child", "secret/prod/db"); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+	if err := write("child", "secret/dev/db"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := write(root, "secret/prod/db"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, err := c.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "secret/prod/db",
+		ClientToken: "child",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	te := &TokenEntry{
+		Path:     "auth/userpass/login/alice",
+		Policies: []string{"test"},
+		Meta:     map[string]string{"mfa": "duo"},
+		MFA:      true,
+	}
+	if err := c.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := write(te.ID, "secret/prod/db"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_HandleRequest_RateLimit(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/policy/test")
+	req.Data["rules"] = `
+rate_limit {
+	rps = 0.001
+	burst = 2
+}
+path "secret/*" {
+	capabilities = ["read"]
+}
+`
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testCoreMakeToken(t, c, root, "child", "", []string{"test"})
+	testCoreMakeToken(t, c, root, "other", "", []string{"test"})
+
+	read := func(token string) error {
+		_, err := c.HandleRequest(&logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        "secret/foo",
+			ClientToken: token,
+		})
+		return err
+	}
+	for i := 0; i < 2; i++ {
+		if err := read("child"); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if err := read("child"); err == nil || !errwrap.Contains(err, logical.ErrRateLimited.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The limit applies to each token on its own, and not to root tokens
+	if err := read("other"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := read(root); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
+
 // Ensure we get a client token
 func TestCore_HandleLogin_AuditTrail(t *testing.T) {
 	// Create a badass credential backend that always logs in as armon
@@ -864,6 +1466,7 @@ func TestCore_HandleRequest_CreateToken_Lease(t *testing.T) {
 		ID:           clientToken,
 		Accessor:     te.Accessor,
 		Parent:       root,
+		TreeAccessor: testTokenAccessor(t, c.tokenStore, root),
 		Policies:     []string{"default", "foo"},
 		Path:         "auth/token/create",
 		DisplayName:  "token",
@@ -909,6 +1512,7 @@ func TestCore_HandleRequest_CreateToken_NoDefaultPolicy(t *testing.T) {
 		ID:           clientToken,
 		Accessor:     te.Accessor,
 		Parent:       root,
+		TreeAccessor: testTokenAccessor(t, c.tokenStore, root),
 		Policies:     []string{"foo"},
 		Path:         "auth/token/create",
 		DisplayName:  "token",
@@ -1414,6 +2018,103 @@ func TestCore_Standby_SeparateHA(t *testing.T) {
 	testCore_Standby_Common(t, physical.NewInmemHA(logger), physical.NewInmemHA(logger))
 }
 
+// Policies cached by a node must not outlive its time as the active node, as
+// other nodes may change them while it is a standby
+func TestCore_Standby_PolicyCache(t *testing.T) {
+	logger = log.New(os.Stderr, "", log.LstdFlags)
+	inmha := physical.NewInmemHA(logger)
+
+	newCore := func(advertise string) *Core {
+		core, err := NewCore(&CoreConfig{
+			Physical:      inmha,
+			HAPhysical:    inmha,
+			AdvertiseAddr: advertise,
+			DisableMlock:  true,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return core
+	}
+	setPolicy := func(core *Core, rules string) {
+		policy, err := Parse(rules)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		policy.Name = "dev"
+		if err := core.policyStore.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	core := newCore("http://127.0.0.1:8200")
+	key, root := TestCoreInit(t, core)
+	if _, err := core.Unseal(TestKeyCopy(key)); err != nil {
+		t.Fatalf("unseal err: %s", err)
+	}
+	testWaitActive(t, core)
+
+	// Cache the policy on the first core
+	setPolicy(core, aclPolicy)
+	if p, _ := core.policyStore.GetPolicy("dev"); p == nil || p.Raw != aclPolicy {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	core2 := newCore("http://127.0.0.1:8500")
+	if _, err := core2.Unseal(TestKeyCopy(key)); err != nil {
+		t.Fatalf("unseal err: %s", err)
+	}
+
+	stepDown := func(core *Core) {
+		req := &logical.Request{
+			ClientToken: root,
+			Path:        "sys/step-down",
+		}
+		if err := core.StepDown(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	waitActive := func(core *Core) {
+		// A core that stepped down waits before taking over again
+		deadline := time.Now().Add(manualStepDownSleepPeriod + 5*time.Second)
+		for time.Now().Before(deadline) {
+			if standby, err := core.Standby(); err == nil && !standby {
+				return
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		t.Fatalf("should not be in standby mode")
+	}
+
+	// Hand over to the second core by stepping down. The demoted core must
+	// have dropped its cached policies.
+	stepDown(core)
+	waitActive(core2)
+	if standby, err := core.Standby(); err != nil || !standby {
+		t.Fatalf("should be standby: %v", err)
+	}
+	core.stateLock.RLock()
+	policyStore := core.policyStore
+	core.stateLock.RUnlock()
+	if policyStore != nil {
+		t.Fatalf("policy store should be torn down on standby")
+	}
+
+	// The second core changes the policy, then hands back to the first,
+	// which must see the change
+	setPolicy(core2, aclPolicy2)
+	stepDown(core2)
+	waitActive(core)
+
+	p, err := core.policyStore.GetPolicy("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p == nil || p.Raw != aclPolicy2 {
+		t.Fatalf("bad: %#v", p)
+	}
+}
+
 func testCore_Standby_Common(t *testing.T, inm physical.Backend, inmha physical.HABackend) {
 	// Create the first core and initialize it
 	advertiseOriginal := "http://127.0.0.1:8200"
@@ -3,6 +3,7 @@ package vault
 import (
 	"time"
 
+	"github.com/hashicorp/vault/helper/passwordpolicy"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -36,7 +37,7 @@ func (d dynamicSystemView) SudoPrivilege(path string, token string) bool {
 	}
 
 	// Construct the corresponding ACL object
-	acl, err := d.core.policyStore.ACL(te.Policies...)
+	acl, err := d.core.policyStore.identityACL(d.core.tokenStore.identityForToken(te), te.Policies...)
 	if err != nil {
 		d.core.logger.Printf("[ERR] failed to retrieve ACL for policies [%#v]: %s", te.Policies, err)
 		return false
@@ -45,7 +46,11 @@ func (d dynamicSystemView) SudoPrivilege(path string, token string) bool {
 	// The operation type isn't important here as this is run from a path the
 	// user has already been given access to; we only care about whether they
 	// have sudo
-	_, rootPrivs := acl.AllowOperation(logical.ReadOperation, path)
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      path,
+	}
+	_, rootPrivs := acl.AllowOperation(req)
 	return rootPrivs
 }
 
@@ -74,3 +79,8 @@ func (d dynamicSystemView) Tainted() bool {
 func (d dynamicSystemView) CachingDisabled() bool {
 	return d.core.cachingDisabled
 }
+
+// PasswordPolicy returns the named password policy from the policy store
+func (d dynamicSystemView) PasswordPolicy(name string) (*passwordpolicy.Policy, error) {
+	return d.core.policyStore.GetPasswordPolicy(name)
+}
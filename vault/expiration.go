@@ -2,6 +2,7 @@ package vault
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -41,8 +42,41 @@ const (
 
 	// defaultLeaseDuration is the default lease duration used when no lease is specified
 	defaultLeaseTTL = maxLeaseTTL
+
+	// revokeQueueSize limits how many prefix revocations can be queued
+	revokeQueueSize = 64
+
+	// revokeWorkers is how many leases of a queued prefix revocation are
+	// revoked concurrently
+	revokeWorkers = 16
+
+	// revokeQueueWait is how long a request waits for a queued prefix
+	// revocation before leaving it to complete in the background
+	revokeQueueWait = 10 * time.Second
+)
+
+var (
+	// errRevocationQueued is returned when a queued prefix revocation is
+	// left to complete in the background
+	errRevocationQueued = errors.New("revocation continues in the background")
+
+	// errRevokeQueueStopped is returned for queued prefix revocations that
+	// are interrupted by the expiration manager stopping
+	errRevokeQueueStopped = errors.New("expiration manager stopped")
 )
 
+// revokeJob is a prefix revocation queued to run in the background
+type revokeJob struct {
+	prefix string
+	force  bool
+
+	// then, if set, is run once every lease is revoked
+	then func() error
+
+	// doneCh receives the result of the revocation
+	doneCh chan error
+}
+
 // ExpirationManager is used by the Core to manage leases. Secrets
 // can provide a lease, meaning that they can be renewed or revoked.
 // If a secret is not renewed in timely manner, it may be expired, and
@@ -54,8 +88,29 @@ type ExpirationManager struct {
 	tokenStore *TokenStore
 	logger     *log.Logger
 
+	// policyStore is used to delete policies that expire, if set
+	policyStore *PolicyStore
+
 	pending     map[string]*time.Timer
 	pendingLock sync.Mutex
+
+	// pendingPolicies holds the timers of the policies to be deleted once
+	// they expire, guarded by pendingLock
+	pendingPolicies map[string]*time.Timer
+
+	// pendingDeletedPolicies holds the timers of the deleted policies to be
+	// purged once their retention passes, guarded by pendingLock
+	pendingDeletedPolicies map[string]*time.Timer
+
+	// revokeQueue holds the prefix revocations run in the background. The
+	// queue runs until revokeStopCh is closed, then closes revokeDoneCh.
+	revokeQueue    chan *revokeJob
+	revokeStopCh   chan struct{}
+	revokeDoneCh   chan struct{}
+	revokeStopOnce sync.Once
+
+	// revokeWait is how long QueueRevokePrefix waits for the revocation
+	revokeWait time.Duration
 }
 
 // NewExpirationManager creates a new ExpirationManager that is backed
@@ -71,7 +126,16 @@ func NewExpirationManager(router *Router, view *BarrierView, ts *TokenStore, log
 		tokenStore: ts,
 		logger:     logger,
 		pending:    make(map[string]*time.Timer),
+
+		pendingPolicies:        make(map[string]*time.Timer),
+		pendingDeletedPolicies: make(map[string]*time.Timer),
+
+		revokeQueue:  make(chan *revokeJob, revokeQueueSize),
+		revokeStopCh: make(chan struct{}),
+		revokeDoneCh: make(chan struct{}),
+		revokeWait:   revokeQueueWait,
 	}
+	go exp.runRevokeQueue()
 	return exp
 }
 
@@ -90,10 +154,17 @@ func (c *Core) setupExpiration() error {
 	// Link the token store to this
 	c.tokenStore.SetExpirationManager(mgr)
 
+	// Link the policy store to this, so that expired policies are deleted
+	mgr.policyStore = c.policyStore
+	c.policyStore.SetExpirationManager(mgr)
+
 	// Restore the existing state
 	if err := c.expiration.Restore(); err != nil {
 		return fmt.Errorf("expiration state restore failed: %v", err)
 	}
+	if err := c.expiration.restorePolicies(); err != nil {
+		return fmt.Errorf("policy expiration restore failed: %v", err)
+	}
 	return nil
 }
 
@@ -167,7 +238,21 @@ func (m *ExpirationManager) Stop() error {
 		timer.Stop()
 	}
 	m.pending = make(map[string]*time.Timer)
+	for _, timer := range m.pendingPolicies {
+		timer.Stop()
+	}
+	m.pendingPolicies = make(map[string]*time.Timer)
+	for _, timer := range m.pendingDeletedPolicies {
+		timer.Stop()
+	}
+	m.pendingDeletedPolicies = make(map[string]*time.Timer)
 	m.pendingLock.Unlock()
+
+	// Stop the revocation queue, interrupting the running revocation
+	m.revokeStopOnce.Do(func() {
+		close(m.revokeStopCh)
+		<-m.revokeDoneCh
+	})
 	return nil
 }
 
@@ -297,6 +382,138 @@ func (m *ExpirationManager) revokePrefixCommon(prefix string, force bool) error
 	return nil
 }
 
+// QueueRevokePrefix queues the revocation of all secrets with a given
+// prefix, rather than revoking them within the request, and runs then once
+// they are revoked. It waits for the revocation for a limited time, after
+// which errRevocationQueued is returned and it completes in the background.
+func (m *ExpirationManager) QueueRevokePrefix(prefix string, force bool, then func() error) error {
+	select {
+	case <-m.revokeStopCh:
+		return errRevokeQueueStopped
+	default:
+	}
+
+	job := &revokeJob{
+		prefix: prefix,
+		force:  force,
+		then:   then,
+		doneCh: make(chan error, 1),
+	}
+	select {
+	case m.revokeQueue <- job:
+	default:
+		return fmt.Errorf("revocation queue is full")
+	}
+
+	select {
+	case err := <-job.doneCh:
+		return err
+	case <-time.After(m.revokeWait):
+		return errRevocationQueued
+	}
+}
+
+// runRevokeQueue runs the queued prefix revocations one at a time until the
+// expiration manager is stopped
+func (m *ExpirationManager) runRevokeQueue() {
+	defer close(m.revokeDoneCh)
+	for {
+		// Stopping takes precedence over the revocations still queued
+		select {
+		case <-m.revokeStopCh:
+			m.failRevokeQueue()
+			return
+		default:
+		}
+
+		select {
+		case <-m.revokeStopCh:
+			m.failRevokeQueue()
+			return
+
+		case job := <-m.revokeQueue:
+			err := m.revokePrefixConcurrent(job.prefix, job.force)
+			if err == nil && job.then != nil {
+				err = job.then()
+			}
+			if err != nil {
+				m.logger.Printf("[ERR] expire: queued revocation of prefix '%s' failed: %v", job.prefix, err)
+			}
+			job.doneCh <- err
+		}
+	}
+}
+
+// failRevokeQueue fails the queued revocations that did not get to run
+func (m *ExpirationManager) failRevokeQueue() {
+	for {
+		select {
+		case job := <-m.revokeQueue:
+			job.doneCh <- errRevokeQueueStopped
+		default:
+			return
+		}
+	}
+}
+
+// revokePrefixConcurrent revokes all secrets with a given prefix using a
+// pool of workers. It stops at the first error, or when the expiration
+// manager is stopped.
+func (m *ExpirationManager) revokePrefixConcurrent(prefix string, force bool) error {
+	defer metrics.MeasureSince([]string{"expire", "revoke-prefix-queued"}, time.Now())
+
+	// Ensure there is a trailing slash
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+
+	// Accumulate existing leases
+	sub := m.idView.SubView(prefix)
+	existing, err := CollectKeys(sub)
+	if err != nil {
+		return fmt.Errorf("failed to scan for leases: %v", err)
+	}
+
+	leaseCh := make(chan string)
+	errCh := make(chan error, revokeWorkers)
+	var wg sync.WaitGroup
+	for i := 0; i < revokeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for leaseID := range leaseCh {
+				if err := m.revokeCommon(leaseID, force, false); err != nil {
+					errCh <- fmt.Errorf("failed to revoke '%s': %v", leaseID, err)
+					return
+				}
+			}
+		}()
+	}
+
+	var result error
+FEED:
+	for _, suffix := range existing {
+		select {
+		case leaseCh <- prefix + suffix:
+		case result = <-errCh:
+			break FEED
+		case <-m.revokeStopCh:
+			result = errRevokeQueueStopped
+			break FEED
+		}
+	}
+	close(leaseCh)
+	wg.Wait()
+
+	if result == nil {
+		select {
+		case result = <-errCh:
+		default:
+		}
+	}
+	return result
+}
+
 // Renew is used to renew a secret using the given leaseID
 // and a renew interval. The increment may be ignored.
 func (m *ExpirationManager) Renew(leaseID string, increment time.Duration) (*logical.Response, error) {
@@ -389,6 +606,22 @@ func (m *ExpirationManager) RenewToken(req *logical.Request, source string, toke
 		}, nil
 	}
 
+	// Renewals are handled by the backend that issued the token, which does
+	// not know about its explicit max TTL, so it is enforced here
+	te, err := m.tokenStore.Lookup(token)
+	if err != nil {
+		return nil, err
+	}
+	if te != nil && te.ExplicitMaxTTL > 0 {
+		remaining := le.IssueTime.Add(te.ExplicitMaxTTL).Sub(time.Now())
+		if remaining <= 0 {
+			return logical.ErrorResponse("past the explicit max TTL, cannot renew"), logical.ErrInvalidRequest
+		}
+		if resp.Auth.TTL > remaining {
+			resp.Auth.TTL = remaining
+		}
+	}
+
 	// Attach the ClientToken
 	resp.Auth.ClientToken = token
 	resp.Auth.Increment = 0
@@ -2,6 +2,7 @@ package vault
 
 import (
 	"fmt"
+	"path"
 	"reflect"
 	"sort"
 	"strings"
@@ -338,6 +339,103 @@ func TestExpiration_RevokePrefix(t *testing.T) {
 	}
 }
 
+func TestExpiration_QueueRevokePrefix(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	for i := 0; i < 50; i++ {
+		req := &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      fmt.Sprintf("prod/aws/%d", i),
+		}
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		}
+		if _, err := exp.Register(req, resp); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Every lease is revoked before the next step runs
+	revoked := -1
+	err = exp.QueueRevokePrefix("prod/aws/", false, func() error {
+		revoked = len(noop.Requests)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if revoked != 50 {
+		t.Fatalf("bad: %d", revoked)
+	}
+	for _, req := range noop.Requests {
+		if req.Operation != logical.RevokeOperation {
+			t.Fatalf("bad: %v", req)
+		}
+	}
+	existing, err := CollectKeys(exp.idView.SubView("prod/aws/"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(existing) != 0 {
+		t.Fatalf("bad: %v", existing)
+	}
+
+	// Revocations taking too long continue in the background
+	exp.revokeWait = 10 * time.Millisecond
+	releaseCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	err = exp.QueueRevokePrefix("prod/aws/", false, func() error {
+		<-releaseCh
+		close(doneCh)
+		return nil
+	})
+	if err != errRevocationQueued {
+		t.Fatalf("err: %v", err)
+	}
+	close(releaseCh)
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("queued revocation did not complete")
+	}
+
+	// Stopping fails the revocations that did not get to run
+	releaseCh = make(chan struct{})
+	if err := exp.QueueRevokePrefix("prod/aws/", false, func() error {
+		<-releaseCh
+		return nil
+	}); err != errRevocationQueued {
+		t.Fatalf("err: %v", err)
+	}
+	job := &revokeJob{prefix: "prod/aws/", doneCh: make(chan error, 1)}
+	exp.revokeQueue <- job
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(releaseCh)
+	}()
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := <-job.doneCh; err != errRevokeQueueStopped {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.QueueRevokePrefix("prod/aws/", false, nil); err != errRevokeQueueStopped {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestExpiration_RevokeByToken(t *testing.T) {
 	exp := mockExpiration(t)
 	noop := &NoopBackend{}
@@ -437,6 +535,72 @@ func TestExpiration_RenewToken(t *testing.T) {
 	}
 }
 
+func TestExpiration_RenewToken_ExplicitMaxTTL(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				LeaseOptions: logical.LeaseOptions{
+					TTL:       time.Hour,
+					Renewable: true,
+				},
+			},
+		},
+	}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "auth/foo/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "auth/foo/", &MountEntry{UUID: meUUID}, view)
+
+	// Create a token whose lifetime is hard limited
+	te := &TokenEntry{
+		Path:           "auth/foo/login",
+		Policies:       []string{"default"},
+		TTL:            time.Minute,
+		ExplicitMaxTTL: 30 * time.Minute,
+	}
+	if err := exp.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	auth := &logical.Auth{
+		ClientToken: te.ID,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       time.Minute,
+			Renewable: true,
+		},
+	}
+	if err := exp.RegisterAuth("auth/foo/login", auth); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The backend renews for an hour, but the token cannot outlive its
+	// explicit max TTL
+	out, err := exp.RenewToken(&logical.Request{}, "auth/foo/login", te.ID, 0)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Auth.TTL <= 0 || out.Auth.TTL > 30*time.Minute {
+		t.Fatalf("bad: %#v", out.Auth)
+	}
+
+	// Renewals are refused once the explicit max TTL has passed
+	le, err := exp.loadEntry(path.Join("auth/foo/login", exp.tokenStore.SaltID(te.ID)))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	le.IssueTime = time.Now().Add(-time.Hour)
+	if err := exp.persistEntry(le); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp, err := exp.RenewToken(&logical.Request{}, "auth/foo/login", te.ID, 0)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("expected error: %v %#v", err, resp)
+	}
+}
+
 func TestExpiration_RenewToken_NotRenewable(t *testing.T) {
 	exp := mockExpiration(t)
 	root, err := exp.tokenStore.rootToken()
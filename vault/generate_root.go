@@ -11,6 +11,16 @@ import (
 	"github.com/hashicorp/vault/shamir"
 )
 
+const (
+	// legacyOTPLength is the length of OTPs that encode a root token whose
+	// ID is a plain UUID, as given by clients that predate typed token
+	// prefixes
+	legacyOTPLength = 16
+
+	// otpLength is the length of OTPs that encode the ID of a service token
+	otpLength = len(serviceTokenPrefix) + 36
+)
+
 // GenerateRootConfig holds the configuration for a root generation
 // command.
 type GenerateRootConfig struct {
@@ -80,7 +90,7 @@ func (c *Core) GenerateRootInit(otp, pgpKey string) error {
 		if err != nil {
 			return fmt.Errorf("error decoding base64 OTP value: %s", err)
 		}
-		if otpBytes == nil || len(otpBytes) != 16 {
+		if otpBytes == nil || (len(otpBytes) != otpLength && len(otpBytes) != legacyOTPLength) {
 			return fmt.Errorf("decoded OTP value is invalid or wrong length")
 		}
 
@@ -235,7 +245,25 @@ func (c *Core) GenerateRootUpdate(key []byte, nonce string) (*GenerateRootResult
 		}
 	}
 
-	te, err := c.tokenStore.rootToken()
+	// A legacy OTP can only encode a UUID, so the root token is given one as
+	// its ID rather than a typed one
+	var legacyOTP bool
+	if len(c.generateRootConfig.OTP) > 0 {
+		otpBytes, err := base64.StdEncoding.DecodeString(c.generateRootConfig.OTP)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding base64 OTP value: %s", err)
+		}
+		legacyOTP = len(otpBytes) == legacyOTPLength
+	}
+
+	var rootID string
+	if legacyOTP {
+		if rootID, err = uuid.GenerateUUID(); err != nil {
+			return nil, err
+		}
+	}
+
+	te, err := c.tokenStore.rootTokenWithID(rootID)
 	if err != nil {
 		c.logger.Printf("[ERR] core: root token generation failed: %v", err)
 		return nil, err
@@ -245,16 +273,19 @@ func (c *Core) GenerateRootUpdate(key []byte, nonce string) (*GenerateRootResult
 		return nil, fmt.Errorf("got nil token entry back from root generation")
 	}
 
-	uuidBytes, err := uuid.ParseUUID(te.ID)
-	if err != nil {
-		c.tokenStore.Revoke(te.ID)
-		c.logger.Printf("[ERR] core: error getting generated token bytes: %v", err)
-		return nil, err
-	}
-	if uuidBytes == nil {
-		c.tokenStore.Revoke(te.ID)
-		c.logger.Printf("[ERR] core: got nil parsed UUID bytes")
-		return nil, fmt.Errorf("got nil parsed UUID bytes")
+	tokenIDBytes := []byte(te.ID)
+	if legacyOTP {
+		tokenIDBytes, err = uuid.ParseUUID(te.ID)
+		if err != nil {
+			c.tokenStore.Revoke(te.ID)
+			c.logger.Printf("[ERR] core: error getting generated token bytes: %v", err)
+			return nil, err
+		}
+		if tokenIDBytes == nil {
+			c.tokenStore.Revoke(te.ID)
+			c.logger.Printf("[ERR] core: got nil parsed UUID bytes")
+			return nil, fmt.Errorf("got nil parsed UUID bytes")
+		}
 	}
 
 	var tokenBytes []byte
@@ -264,7 +295,7 @@ func (c *Core) GenerateRootUpdate(key []byte, nonce string) (*GenerateRootResult
 	case len(c.generateRootConfig.OTP) > 0:
 		// This function performs decoding checks so rather than decode the OTP,
 		// just encode the value we're passing in.
-		tokenBytes, err = xor.XORBase64(c.generateRootConfig.OTP, base64.StdEncoding.EncodeToString(uuidBytes))
+		tokenBytes, err = xor.XORBase64(c.generateRootConfig.OTP, base64.StdEncoding.EncodeToString(tokenIDBytes))
 		if err != nil {
 			c.tokenStore.Revoke(te.ID)
 			c.logger.Printf("[ERR] core: xor of root token failed: %v", err)
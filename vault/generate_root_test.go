@@ -2,6 +2,7 @@ package vault
 
 import (
 	"encoding/base64"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-uuid"
@@ -164,15 +165,16 @@ func testCore_GenerateRoot_InvalidMasterNonce_Common(t *testing.T, c *Core, keys
 
 func TestCore_GenerateRoot_Update_OTP(t *testing.T) {
 	c, master, _ := TestCoreUnsealed(t)
-	testCore_GenerateRoot_Update_OTP_Common(t, c, [][]byte{master})
+	testCore_GenerateRoot_Update_OTP_Common(t, c, [][]byte{master}, otpLength)
+	testCore_GenerateRoot_Update_OTP_Common(t, c, [][]byte{master}, legacyOTPLength)
 
 	bc, rc := TestSealDefConfigs()
 	c, _, recoveryKeys, _ := TestCoreUnsealedWithConfigs(t, bc, rc)
-	testCore_GenerateRoot_Update_OTP_Common(t, c, recoveryKeys[0:rc.SecretThreshold])
+	testCore_GenerateRoot_Update_OTP_Common(t, c, recoveryKeys[0:rc.SecretThreshold], otpLength)
 }
 
-func testCore_GenerateRoot_Update_OTP_Common(t *testing.T, c *Core, keys [][]byte) {
-	otpBytes, err := GenerateRandBytes(16)
+func testCore_GenerateRoot_Update_OTP_Common(t *testing.T, c *Core, keys [][]byte, length int) {
+	otpBytes, err := GenerateRandBytes(length)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -229,9 +231,15 @@ func testCore_GenerateRoot_Update_OTP_Common(t *testing.T, c *Core, keys [][]byt
 	if err != nil {
 		t.Fatal(err)
 	}
-	token, err := uuid.FormatUUID(tokenBytes)
-	if err != nil {
-		t.Fatal(err)
+	token := string(tokenBytes)
+	if length == legacyOTPLength {
+		// Legacy OTPs are given a root token whose ID is a UUID
+		token, err = uuid.FormatUUID(tokenBytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+	} else if !strings.HasPrefix(token, serviceTokenPrefix) {
+		t.Fatalf("bad: %s", token)
 	}
 
 	// Ensure that the token is a root token
@@ -1,10 +1,14 @@
 package vault
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/hashicorp/vault/helper/duration"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -34,6 +38,13 @@ func CubbyholeBackendFactory(conf *logical.BackendConfig) (logical.Backend, erro
 				HelpDescription: strings.TrimSpace(cubbyholeHelpDescription),
 			},
 		},
+
+		Secrets: []*framework.Secret{
+			&framework.Secret{
+				Type:   cubbyholeEntryType,
+				Revoke: b.handleEntryRevoke,
+			},
+		},
 	}
 
 	if conf == nil {
@@ -44,6 +55,9 @@ func CubbyholeBackendFactory(conf *logical.BackendConfig) (logical.Backend, erro
 	return &b, nil
 }
 
+// cubbyholeEntryType is the type of the leases of entries written with a TTL
+const cubbyholeEntryType = "cubbyhole_entry"
+
 // CubbyholeBackend is used for storing secrets directly into the physical
 // backend. The secrets are encrypted in the durable storage.
 // This differs from generic in that every token has its own private
@@ -118,6 +132,19 @@ func (b *CubbyholeBackend) handleWrite(
 		return nil, fmt.Errorf("missing data fields")
 	}
 
+	// Check if there is a ttl key, after which the entry is removed
+	var ttl time.Duration
+	if ttlRaw, ok := req.Data["ttl"]; ok {
+		dur, err := duration.ParseDurationSecond(fmt.Sprintf("%v", ttlRaw))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid ttl: %v", err)), nil
+		}
+		if dur <= 0 {
+			return logical.ErrorResponse("ttl must be positive"), nil
+		}
+		ttl = dur
+	}
+
 	// JSON encode the data
 	buf, err := json.Marshal(req.Data)
 	if err != nil {
@@ -133,9 +160,54 @@ func (b *CubbyholeBackend) handleWrite(
 		return nil, fmt.Errorf("failed to write: %v", err)
 	}
 
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	// Lease the entry so that the expiration manager removes it, even if the
+	// token lives on. The revocation has no client token, so the lease keeps
+	// the storage key, and a hash of the value so that a later write of the
+	// same path is not removed along with it
+	resp := b.Secret(cubbyholeEntryType).Response(nil, map[string]interface{}{
+		"key":  entry.Key,
+		"hash": cubbyholeEntryHash(buf),
+	})
+	resp.Secret.TTL = ttl
+	resp.Secret.Renewable = false
+
+	return resp, nil
+}
+
+func (b *CubbyholeBackend) handleEntryRevoke(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	key, _ := req.Secret.InternalData["key"].(string)
+	hash, _ := req.Secret.InternalData["hash"].(string)
+	if key == "" {
+		return nil, fmt.Errorf("[ERR] cubbyhole: storage key missing from lease")
+	}
+
+	out, err := req.Storage.Get(key)
+	if err != nil {
+		return nil, fmt.Errorf("read failed: %v", err)
+	}
+
+	// The entry was already deleted, or has been overwritten since
+	if out == nil || cubbyholeEntryHash(out.Value) != hash {
+		return nil, nil
+	}
+
+	if err := req.Storage.Delete(key); err != nil {
+		return nil, err
+	}
+
 	return nil, nil
 }
 
+func cubbyholeEntryHash(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:])
+}
+
 func (b *CubbyholeBackend) handleDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	if req.ClientToken == "" {
@@ -191,6 +263,10 @@ sharing possible (per-token cubbyholes). This can be useful for implementing
 certain authentication workflows, as well as "scratch" areas for individual
 clients. When the token is revoked, the entire set of stored values for that
 token is also removed.
+
+A TTL can be given when writing with the "ttl" field. The value is then
+removed once the TTL elapses, even if the token is still valid, which is
+useful for one-time handoff data.
 `
 
 const cubbyholeHelpSynopsis = `
@@ -204,4 +280,7 @@ encrypting it along the way.
 
 The view into the cubbyhole storage space is different for each token; it is
 a per-token cubbyhole. When the token is revoked all values are removed.
+
+If the "ttl" field is written, the write returns a lease, and the value is
+removed when the lease expires or is revoked.
 `
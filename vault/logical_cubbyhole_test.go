@@ -262,6 +262,75 @@ func TestCubbyholeIsolation(t *testing.T) {
 	}
 }
 
+func TestCubbyholeBackend_WriteTTL(t *testing.T) {
+	b := testCubbyholeBackend()
+	req := logical.TestRequest(t, logical.UpdateOperation, "foo")
+	clientToken, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ClientToken = clientToken
+	storage := req.Storage
+
+	req.Data["raw"] = "test"
+	req.Data["ttl"] = "bogus"
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	req.Data["ttl"] = "5m"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Secret == nil || resp.Secret.TTL != 5*time.Minute || resp.Secret.Renewable {
+		t.Fatalf("bad: %#v", resp)
+	}
+	secret := resp.Secret
+
+	// Revoking the lease removes the entry
+	revokeReq := logical.RevokeRequest("foo", secret, nil)
+	revokeReq.Storage = storage
+	if _, err := b.HandleRequest(revokeReq); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	readReq := logical.TestRequest(t, logical.ReadOperation, "foo")
+	readReq.Storage = storage
+	readReq.ClientToken = clientToken
+	resp, err = b.HandleRequest(readReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// An entry written again since is not removed by the old lease
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Data = map[string]interface{}{"raw": "other"}
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := b.HandleRequest(revokeReq); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp, err = b.HandleRequest(readReq)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data["raw"] != "other" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
 func testCubbyholeBackend() logical.Backend {
 	b, _ := CubbyholeBackendFactory(&logical.BackendConfig{
 		Logger: nil,
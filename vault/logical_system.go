@@ -7,6 +7,10 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/helper/duration"
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 	"github.com/mitchellh/mapstructure"
@@ -37,6 +41,14 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 				"audit/*",
 				"raw/*",
 				"rotate",
+				"policy-signing",
+				"locked-users",
+				"locked-users/*",
+			},
+
+			Unauthenticated: []string{
+				"mfa/validate",
+				"internal/ui/mounts",
 			},
 		},
 
@@ -53,6 +65,10 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 						Type:        framework.TypeString,
 						Description: "Path on which capabilities are being queried.",
 					},
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "Paths on which capabilities are being queried, as a list or a comma separated string.",
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -75,6 +91,10 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 						Type:        framework.TypeString,
 						Description: "Path on which capabilities are being queried.",
 					},
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "Paths on which capabilities are being queried, as a list or a comma separated string.",
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -85,6 +105,41 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 				HelpDescription: strings.TrimSpace(sysHelp["capabilities"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "capabilities-explain$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Token for which access is being explained.",
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Path for which access is being explained.",
+					},
+					"operation": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     "read",
+						Description: "Operation for which access is being explained.",
+					},
+					"data": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "Request parameters to check against the policies.",
+					},
+					"remote_address": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Address the request is made from. Defaults to the address of this request.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleCapabilitiesExplain,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["capabilities_explain"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["capabilities_explain"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "capabilities-self$",
 
@@ -97,6 +152,10 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 						Type:        framework.TypeString,
 						Description: "Path on which capabilities are being queried.",
 					},
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: "Paths on which capabilities are being queried, as a list or a comma separated string.",
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -162,6 +221,30 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_token_type"][0]),
+					},
+					"explicit_max_ttl": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_explicit_max_ttl"][0]),
+					},
+					"listing_visibility": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_listing_visibility"][0]),
+					},
+					"lockout_threshold": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["tune_lockout_threshold"][0]),
+					},
+					"lockout_duration": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_lockout_duration"][0]),
+					},
+					"lockout_enable": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["tune_lockout_enable"][0]),
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ReadOperation:   b.handleAuthTuneRead,
@@ -171,6 +254,50 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 				HelpDescription: strings.TrimSpace(sysHelp["auth_tune"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "locked-users$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLockedUsersRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["locked-users"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["locked-users"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "locked-users/(?P<path>.+?)/unlock/(?P<user>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["auth_path"][0]),
+					},
+					"user": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["locked-users-user"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleLockedUsersUnlock,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["locked-users-unlock"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["locked-users-unlock"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "internal/ui/mounts$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleInternalUIMounts,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["internal-ui-mounts"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["internal-ui-mounts"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "mounts/(?P<path>.+?)/tune$",
 
@@ -198,6 +325,24 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 				HelpDescription: strings.TrimSpace(sysHelp["mount_tune"][1]),
 			},
 
+			&framework.Path{
+				Pattern: "mounts/(?P<path>.+?)/upgrade$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mount_path"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMountUpgrade,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mount_upgrade"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mount_upgrade"][1]),
+			},
+
 			&framework.Path{
 				Pattern: "mounts/(?P<path>.+?)",
 
@@ -383,6 +528,13 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 			&framework.Path{
 				Pattern: "policy$",
 
+				Fields: map[string]*framework.FieldSchema{
+					"detailed": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["policy-detailed"][0]),
+					},
+				},
+
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ReadOperation: b.handlePolicyList,
 					logical.ListOperation: b.handlePolicyList,
@@ -393,275 +545,1258 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 			},
 
 			&framework.Path{
-				Pattern: "policy/(?P<name>.+)",
+				Pattern: "policy-validate$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"name": &framework.FieldSchema{
-						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
-					},
 					"rules": &framework.FieldSchema{
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["policy-rules"][0]),
 					},
+					"syntax": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     PolicySyntaxHCL,
+						Description: strings.TrimSpace(sysHelp["policy-syntax"][0]),
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation:   b.handlePolicyRead,
-					logical.UpdateOperation: b.handlePolicySet,
-					logical.DeleteOperation: b.handlePolicyDelete,
+					logical.UpdateOperation: b.handlePolicyValidate,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["policy"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["policy"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-validate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-validate"][1]),
 			},
 
 			&framework.Path{
-				Pattern:         "seal-status$",
-				HelpSynopsis:    strings.TrimSpace(sysHelp["seal-status"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["seal-status"][1]),
+				Pattern: "policy-cache/purge$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handlePolicyCachePurge,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-cache-purge"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-cache-purge"][1]),
 			},
 
 			&framework.Path{
-				Pattern:         "seal$",
-				HelpSynopsis:    strings.TrimSpace(sysHelp["seal"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["seal"][1]),
+				Pattern: "policy-usage$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handlePolicyUsage,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-usage"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-usage"][1]),
 			},
 
 			&framework.Path{
-				Pattern:         "unseal$",
-				HelpSynopsis:    strings.TrimSpace(sysHelp["unseal"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["unseal"][1]),
+				Pattern: "policy-rule/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleRulePolicyList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-rule-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-rule-list"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "audit-hash/(?P<path>.+)",
+				Pattern: "policy-rule/(?P<name>.+)",
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
+					"name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
 					},
-
-					"input": &framework.FieldSchema{
-						Type: framework.TypeString,
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["policy-rule-paths"][0]),
+					},
+					"condition": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-rule-condition"][0]),
+					},
+					"time_zone": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-rule-time-zone"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleAuditHash,
+					logical.ReadOperation:   b.handleRulePolicyRead,
+					logical.UpdateOperation: b.handleRulePolicySet,
+					logical.DeleteOperation: b.handleRulePolicyDelete,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-hash"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audit-hash"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-rule"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-rule"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "audit$",
+				Pattern: "policies/password/?$",
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handleAuditTable,
+					logical.ListOperation: b.handlePasswordPolicyList,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-table"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audit-table"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-password-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-password-list"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "audit/(?P<path>.+)",
+				Pattern: "policies/password/(?P<name>.+)",
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
+					"name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
 					},
-					"type": &framework.FieldSchema{
-						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_type"][0]),
+					"min_length": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Minimum number of characters of passwords.",
 					},
-					"description": &framework.FieldSchema{
-						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_desc"][0]),
+					"min_uppercase": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Minimum number of uppercase letters of passwords.",
 					},
-					"options": &framework.FieldSchema{
-						Type:        framework.TypeMap,
-						Description: strings.TrimSpace(sysHelp["audit_opts"][0]),
+					"min_lowercase": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Minimum number of lowercase letters of passwords.",
+					},
+					"min_digits": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Minimum number of digits of passwords.",
+					},
+					"min_symbols": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Minimum number of symbols of passwords.",
+					},
+					"history": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: "Number of previous passwords, including the current one, that cannot be reused.",
+					},
+					"max_age": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: "How long passwords are valid after being set. Passwords do not expire if zero.",
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleEnableAudit,
-					logical.DeleteOperation: b.handleDisableAudit,
+					logical.ReadOperation:   b.handlePasswordPolicyRead,
+					logical.UpdateOperation: b.handlePasswordPolicySet,
+					logical.DeleteOperation: b.handlePasswordPolicyDelete,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audit"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audit"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-password"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-password"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "raw/(?P<path>.+)",
+				Pattern: "policy-trash/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handlePolicyTrashList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-trash"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-trash"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policy-trash/config$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
-						Type: framework.TypeString,
-					},
-					"value": &framework.FieldSchema{
-						Type: framework.TypeString,
+					"retention": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: strings.TrimSpace(sysHelp["policy-trash-retention"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation:   b.handleRawRead,
-					logical.UpdateOperation: b.handleRawWrite,
-					logical.DeleteOperation: b.handleRawDelete,
+					logical.ReadOperation:   b.handlePolicyTrashConfigRead,
+					logical.UpdateOperation: b.handlePolicyTrashConfigUpdate,
 				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-trash-config"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-trash-config"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "key-status$",
+				Pattern: "policy-trash/restore/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+					},
+				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handleKeyStatus,
+					logical.UpdateOperation: b.handlePolicyTrashRestore,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["key-status"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["key-status"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-trash-restore"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-trash-restore"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "rotate$",
+				Pattern: "policy-unmounted$",
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleRotate,
+					logical.ReadOperation: b.handlePolicyUnmounted,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["rotate"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["rotate"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-unmounted"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-unmounted"][1]),
 			},
-		},
-	}
 
-	b.Backend.Setup(config)
+			&framework.Path{
+				Pattern: "policy-signing$",
 
-	return b.Backend
-}
+				Fields: map[string]*framework.FieldSchema{
+					"trusted_keys": &framework.FieldSchema{
+						Type:        framework.TypeCommaStringSlice,
+						Description: strings.TrimSpace(sysHelp["policy-signing-trusted-keys"][0]),
+					},
+					"required": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["policy-signing-required"][0]),
+					},
+				},
 
-// SystemBackend implements logical.Backend and is used to interact with
-// the core of the system. This backend is hardcoded to exist at the "sys"
-// prefix. Conceptually it is similar to procfs on Linux.
-type SystemBackend struct {
-	Core    *Core
-	Backend *framework.Backend
-}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handlePolicySigningRead,
+					logical.UpdateOperation: b.handlePolicySigningUpdate,
+				},
 
-// handleCapabilitiesreturns the ACL capabilities of the token for a given path
-func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	capabilities, err := b.Core.Capabilities(d.Get("token").(string), d.Get("path").(string))
-	if err != nil {
-		return nil, err
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-signing"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-signing"][1]),
+			},
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"capabilities": capabilities,
-		},
-	}, nil
-}
+			&framework.Path{
+				Pattern: "policy-export$",
 
-// handleCapabilitiesAccessor returns the ACL capabilities of the token associted
-// with the given accessor for a given path.
-func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	accessor := d.Get("accessor").(string)
-	if accessor == "" {
-		return logical.ErrorResponse("missing accessor"), nil
-	}
+				Fields: map[string]*framework.FieldSchema{
+					"policies": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-export-policies"][0]),
+					},
+					"signing_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-bundle-signing-key"][0]),
+					},
+				},
 
-	aEntry, err := b.Core.tokenStore.lookupByAccessor(accessor)
-	if err != nil {
-		return nil, err
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handlePolicyExport,
+				},
 
-	capabilities, err := b.Core.Capabilities(aEntry.TokenID, d.Get("path").(string))
-	if err != nil {
-		return nil, err
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-export"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-export"][1]),
+			},
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"capabilities": capabilities,
-		},
-	}, nil
-}
+			&framework.Path{
+				Pattern: "policy-import$",
 
-// handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
-// rekey operation
-func (b *SystemBackend) handleRekeyRetrieve(
+				Fields: map[string]*framework.FieldSchema{
+					"bundle": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["policy-import-bundle"][0]),
+					},
+					"signing_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-bundle-signing-key"][0]),
+					},
+					"conflict": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     PolicyImportConflictFail,
+						Description: strings.TrimSpace(sysHelp["policy-import-conflict"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handlePolicyImport,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-import"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-import"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policy-group/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handlePolicyGroupList,
+					logical.ListOperation: b.handlePolicyGroupList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-group-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-group-list"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policy-group/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-group-name"][0]),
+					},
+					"policies": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-group-policies"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handlePolicyGroupRead,
+					logical.UpdateOperation: b.handlePolicyGroupSet,
+					logical.DeleteOperation: b.handlePolicyGroupDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-group"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-group"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policy/(?P<name>.+)/diff$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+					},
+					"rules": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-diff-rules"][0]),
+					},
+					"syntax": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     PolicySyntaxHCL,
+						Description: strings.TrimSpace(sysHelp["policy-syntax"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handlePolicyDiff,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-diff"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-diff"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policy/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+					},
+					"rules": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-rules"][0]),
+					},
+					"syntax": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     PolicySyntaxHCL,
+						Description: strings.TrimSpace(sysHelp["policy-syntax"][0]),
+					},
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["policy-metadata"][0]),
+					},
+					"ttl": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: strings.TrimSpace(sysHelp["policy-ttl"][0]),
+					},
+					"delete_on_expire": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["policy-delete-on-expire"][0]),
+					},
+					"shadow": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["policy-shadow"][0]),
+					},
+					"revoke": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["policy-revoke"][0]),
+					},
+					"signature": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-signature"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handlePolicyRead,
+					logical.UpdateOperation: b.handlePolicySet,
+					logical.DeleteOperation: b.handlePolicyDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy"][1]),
+			},
+
+			&framework.Path{
+				Pattern:         "seal-status$",
+				HelpSynopsis:    strings.TrimSpace(sysHelp["seal-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["seal-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern:         "seal$",
+				HelpSynopsis:    strings.TrimSpace(sysHelp["seal"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["seal"][1]),
+			},
+
+			&framework.Path{
+				Pattern:         "unseal$",
+				HelpSynopsis:    strings.TrimSpace(sysHelp["unseal"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["unseal"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "control-group/request$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control-group-id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupRequest,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-request"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-request"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "control-group/authorize$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control-group-id"][0]),
+					},
+					"token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Token of the authorizer. This is set to the token making the request.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupAuthorize,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group-authorize"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group-authorize"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit-hash/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+
+					"input": &framework.FieldSchema{
+						Type: framework.TypeString,
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleAuditHash,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-hash"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-hash"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuditTable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-table"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-table"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_type"][0]),
+					},
+					"description": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_desc"][0]),
+					},
+					"options": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["audit_opts"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEnableAudit,
+					logical.DeleteOperation: b.handleDisableAudit,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "raw/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type: framework.TypeString,
+					},
+					"value": &framework.FieldSchema{
+						Type: framework.TypeString,
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRawRead,
+					logical.UpdateOperation: b.handleRawWrite,
+					logical.DeleteOperation: b.handleRawDelete,
+				},
+			},
+
+			&framework.Path{
+				Pattern: "key-status$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleKeyStatus,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["key-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["key-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "rotate$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRotate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rotate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rotate"][1]),
+			},
+		},
+	}
+	b.Backend.Paths = append(b.Backend.Paths, mfaPaths(b)...)
+
+	b.Backend.Setup(config)
+
+	return b.Backend
+}
+
+// SystemBackend implements logical.Backend and is used to interact with
+// the core of the system. This backend is hardcoded to exist at the "sys"
+// prefix. Conceptually it is similar to procfs on Linux.
+type SystemBackend struct {
+	Core    *Core
+	Backend *framework.Backend
+}
+
+// handleCapabilitiesreturns the ACL capabilities of the token for a given path
+func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.capabilitiesResponse(d.Get("token").(string), d)
+}
+
+// handleCapabilitiesAccessor returns the ACL capabilities of the token associted
+// with the given accessor for a given path.
+func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	accessor := d.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), nil
+	}
+
+	aEntry, err := b.Core.tokenStore.lookupByAccessor(accessor)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.capabilitiesResponse(aEntry.TokenID, d)
+}
+
+// capabilitiesResponse returns the capabilities of the token on the path
+// given in "path", and on each of the paths given in "paths"
+func (b *SystemBackend) capabilitiesResponse(token string, d *framework.FieldData) (*logical.Response, error) {
+	path := d.Get("path").(string)
+	paths := d.Get("paths").([]string)
+	if len(paths) == 0 {
+		capabilities, err := b.Core.Capabilities(token, path)
+		if err != nil {
+			return nil, err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"capabilities": capabilities,
+			},
+		}, nil
+	}
+
+	if path != "" {
+		paths = append(paths, path)
+	}
+	capabilities, err := b.Core.CapabilitiesPaths(token, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"paths": capabilities,
+		},
+	}
+	if path != "" {
+		resp.Data["capabilities"] = capabilities[path]
+	}
+	return resp, nil
+}
+
+// handleCapabilitiesExplain returns which policy rules allow or deny the
+// token the given operation on a path
+func (b *SystemBackend) handleCapabilitiesExplain(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	op := logical.Operation(strings.ToLower(d.Get("operation").(string)))
+	switch op {
+	case logical.CreateOperation, logical.ReadOperation, logical.UpdateOperation,
+		logical.PatchOperation, logical.DeleteOperation, logical.ListOperation:
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported operation '%s'", op)), nil
+	}
+
+	// Policy paths may be bound to addresses, so explain the request as if
+	// it was made from the given address, or from where this one was
+	conn := &logical.Connection{
+		RemoteAddr: d.Get("remote_address").(string),
+	}
+	if conn.RemoteAddr == "" && req.Connection != nil {
+		conn.RemoteAddr = req.Connection.RemoteAddr
+	}
+
+	explanation, err := b.Core.ExplainAccess(d.Get("token").(string), &logical.Request{
+		Operation:  op,
+		Path:       d.Get("path").(string),
+		Data:       d.Get("data").(map[string]interface{}),
+		Connection: conn,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make([]map[string]interface{}, 0, len(explanation.Sources))
+	for _, source := range explanation.Sources {
+		sources = append(sources, map[string]interface{}{
+			"policy": source.Policy,
+			"path":   source.Path,
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"allowed": explanation.Allowed,
+			"sudo":    explanation.Sudo,
+			"pattern": explanation.Pattern,
+			"sources": sources,
+			"reason":  explanation.Reason,
+		},
+	}, nil
+}
+
+// handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
+// rekey operation
+func (b *SystemBackend) handleRekeyRetrieve(
 	req *logical.Request,
 	data *framework.FieldData,
 	recovery bool) (*logical.Response, error) {
 	backup, err := b.Core.RekeyRetrieveBackup(recovery)
 	if err != nil {
-		return nil, fmt.Errorf("unable to look up backed-up keys: %v", err)
+		return nil, fmt.Errorf("unable to look up backed-up keys: %v", err)
+	}
+	if backup == nil {
+		return logical.ErrorResponse("no backed-up keys found"), nil
+	}
+
+	// Format the status
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"nonce": backup.Nonce,
+			"keys":  backup.Keys,
+		},
+	}
+
+	return resp, nil
+}
+
+func (b *SystemBackend) handleRekeyRetrieveBarrier(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyRetrieve(req, data, false)
+}
+
+func (b *SystemBackend) handleRekeyRetrieveRecovery(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyRetrieve(req, data, true)
+}
+
+// handleRekeyDelete deletes backed-up, PGP-encrypted unseal keys from a rekey
+// operation
+func (b *SystemBackend) handleRekeyDelete(
+	req *logical.Request,
+	data *framework.FieldData,
+	recovery bool) (*logical.Response, error) {
+	err := b.Core.RekeyDeleteBackup(recovery)
+	if err != nil {
+		return nil, fmt.Errorf("error during deletion of backed-up keys: %v", err)
+	}
+
+	return nil, nil
+}
+func (b *SystemBackend) handleRekeyDeleteBarrier(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyDelete(req, data, false)
+}
+
+func (b *SystemBackend) handleRekeyDeleteRecovery(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyDelete(req, data, true)
+}
+
+// handleMountTable handles the "mounts" endpoint to provide the mount table
+func (b *SystemBackend) handleMountTable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.mountsLock.RLock()
+	defer b.Core.mountsLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: make(map[string]interface{}),
+	}
+
+	for _, entry := range b.Core.mounts.Entries {
+		info := map[string]interface{}{
+			"type":        entry.Type,
+			"description": entry.Description,
+			"config": map[string]interface{}{
+				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
+				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
+			},
+		}
+
+		resp.Data[entry.Path] = info
+	}
+
+	return resp, nil
+}
+
+// handleMount is used to mount a new path
+func (b *SystemBackend) handleMount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	path := data.Get("path").(string)
+	logicalType := data.Get("type").(string)
+	description := data.Get("description").(string)
+
+	path = sanitizeMountPath(path)
+
+	var config MountConfig
+
+	var apiConfig struct {
+		DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
+		MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
+	}
+	configMap := data.Get("config").(map[string]interface{})
+	if configMap != nil && len(configMap) != 0 {
+		err := mapstructure.Decode(configMap, &apiConfig)
+		if err != nil {
+			return logical.ErrorResponse(
+					"unable to convert given mount config information"),
+				logical.ErrInvalidRequest
+		}
+	}
+
+	switch apiConfig.DefaultLeaseTTL {
+	case "":
+	case "system":
+	default:
+		tmpDef, err := duration.ParseDurationSecond(apiConfig.DefaultLeaseTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse default TTL of %s: %s", apiConfig.DefaultLeaseTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.DefaultLeaseTTL = tmpDef
+	}
+
+	switch apiConfig.MaxLeaseTTL {
+	case "":
+	case "system":
+	default:
+		tmpMax, err := duration.ParseDurationSecond(apiConfig.MaxLeaseTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse max TTL of %s: %s", apiConfig.MaxLeaseTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.MaxLeaseTTL = tmpMax
+	}
+
+	if config.MaxLeaseTTL != 0 && config.DefaultLeaseTTL > config.MaxLeaseTTL {
+		return logical.ErrorResponse(
+				"given default lease TTL greater than given max lease TTL"),
+			logical.ErrInvalidRequest
+	}
+
+	if config.DefaultLeaseTTL > b.Core.maxLeaseTTL {
+		return logical.ErrorResponse(fmt.Sprintf(
+				"given default lease TTL greater than system max lease TTL of %d", int(b.Core.maxLeaseTTL.Seconds()))),
+			logical.ErrInvalidRequest
+	}
+
+	if logicalType == "" {
+		return logical.ErrorResponse(
+				"backend type must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	// Create the mount entry
+	me := &MountEntry{
+		Table:       mountTableType,
+		Path:        path,
+		Type:        logicalType,
+		Description: description,
+		Config:      config,
+	}
+
+	// Attempt mount
+	if err := b.Core.mount(me); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: mount %s failed: %v", me.Path, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// used to intercept an HTTPCodedError so it goes back to callee
+func handleError(
+	err error) (*logical.Response, error) {
+	switch err.(type) {
+	case logical.HTTPCodedError:
+		return logical.ErrorResponse(err.Error()), err
+	default:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+}
+
+// revocationQueuedResponse is the response to a request whose revocations
+// are left to complete in the background
+func revocationQueuedResponse() *logical.Response {
+	resp := &logical.Response{}
+	resp.AddWarning("Revoking the leases is taking a while, and continues in the background. Any errors will be printed to Vault's server logs.")
+	return resp
+}
+
+// handleUnmount is used to unmount a path
+func (b *SystemBackend) handleUnmount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	suffix := strings.TrimPrefix(req.Path, "mounts/")
+	if len(suffix) == 0 {
+		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	}
+
+	suffix = sanitizeMountPath(suffix)
+
+	// Attempt unmount
+	err := b.Core.unmount(suffix)
+	if err == errRevocationQueued {
+		return revocationQueuedResponse(), nil
+	}
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: unmount '%s' failed: %v", suffix, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleRemount is used to remount a path
+func (b *SystemBackend) handleRemount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get the paths
+	fromPath := data.Get("from").(string)
+	toPath := data.Get("to").(string)
+	if fromPath == "" || toPath == "" {
+		return logical.ErrorResponse(
+				"both 'from' and 'to' path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	fromPath = sanitizeMountPath(fromPath)
+	toPath = sanitizeMountPath(toPath)
+
+	// Attempt remount
+	if err := b.Core.remount(fromPath, toPath); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: remount '%s' to '%s' failed: %v", fromPath, toPath, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleMountUpgrade is used to upgrade a generic mount to the kv backend
+func (b *SystemBackend) handleMountUpgrade(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	path = sanitizeMountPath(path)
+
+	// Attempt upgrade
+	if err := b.Core.upgradeMount(path); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: upgrade of '%s' failed: %v", path, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleAuthTuneRead is used to get config settings on a auth path
+func (b *SystemBackend) handleAuthTuneRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	path = sanitizeMountPath("auth/" + path)
+
+	resp, err := b.handleTuneReadCommon(path)
+	if err != nil {
+		return resp, err
+	}
+
+	resp.Data["token_type"] = TokenTypeService
+	resp.Data["explicit_max_ttl"] = 0
+	resp.Data["listing_visibility"] = ListingVisibilityHidden
+	if mountEntry := b.Core.router.MatchingMountEntry(path); mountEntry != nil {
+		if mountEntry.Config.TokenType != "" {
+			resp.Data["token_type"] = mountEntry.Config.TokenType
+		}
+		resp.Data["explicit_max_ttl"] = int(mountEntry.Config.ExplicitMaxTTL.Seconds())
+		if mountEntry.Config.ListingVisibility != "" {
+			resp.Data["listing_visibility"] = mountEntry.Config.ListingVisibility
+		}
+		if mountEntry.Type != "token" {
+			config := mountEntry.Config
+			config.LockoutEnable = true
+			threshold, lockoutDuration := lockoutSettings(config)
+			resp.Data["lockout_threshold"] = threshold
+			resp.Data["lockout_duration"] = int(lockoutDuration.Seconds())
+			resp.Data["lockout_enable"] = mountEntry.Config.LockoutEnable
+		}
+	}
+	return resp, nil
+}
+
+// handleMountTuneRead is used to get config settings on a backend
+func (b *SystemBackend) handleMountTuneRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	// This call will read both logical backend's configuration as well as auth backends'.
+	// Retaining this behavior for backward compatibility. If this behavior is not desired,
+	// an error can be returned if path has a prefix of "auth/".
+	return b.handleTuneReadCommon(path)
+}
+
+// handleTuneReadCommon returns the config settings of a path
+func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
+	path = sanitizeMountPath(path)
+
+	sysView := b.Core.router.MatchingSystemView(path)
+	if sysView == nil {
+		err := fmt.Errorf("[ERR] sys: cannot fetch sysview for path %s", path)
+		b.Backend.Logger().Print(err)
+		return handleError(err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"default_lease_ttl": int(sysView.DefaultLeaseTTL().Seconds()),
+			"max_lease_ttl":     int(sysView.MaxLeaseTTL().Seconds()),
+		},
+	}
+
+	return resp, nil
+}
+
+// handleAuthTuneWrite is used to set config settings on an auth path
+func (b *SystemBackend) handleAuthTuneWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	resp, err := b.handleTuneWriteCommon("auth/"+path, data)
+	if err != nil {
+		return resp, err
+	}
+
+	if tokenType, ok := data.GetOk("token_type"); ok {
+		if err := b.tuneTokenType("auth/"+path, tokenType.(string)); err != nil {
+			b.Backend.Logger().Printf("[ERR] sys: tune of path 'auth/%s' failed: %v", path, err)
+			return handleError(err)
+		}
+	}
+
+	if raw, ok := data.GetOk("explicit_max_ttl"); ok {
+		var explicitMaxTTL time.Duration
+		switch raw.(string) {
+		case "", "system":
+		default:
+			explicitMaxTTL, err = duration.ParseDurationSecond(raw.(string))
+			if err != nil {
+				return handleError(err)
+			}
+		}
+		if err := b.tuneExplicitMaxTTL("auth/"+path, explicitMaxTTL); err != nil {
+			b.Backend.Logger().Printf("[ERR] sys: tune of path 'auth/%s' failed: %v", path, err)
+			return handleError(err)
+		}
+	}
+
+	if visibility, ok := data.GetOk("listing_visibility"); ok {
+		if err := b.tuneListingVisibility("auth/"+path, visibility.(string)); err != nil {
+			b.Backend.Logger().Printf("[ERR] sys: tune of path 'auth/%s' failed: %v", path, err)
+			return handleError(err)
+		}
+	}
+
+	var lockoutThreshold *int
+	var lockoutDuration *time.Duration
+	var lockoutEnable *bool
+	if raw, ok := data.GetOk("lockout_threshold"); ok {
+		threshold := raw.(int)
+		lockoutThreshold = &threshold
+	}
+	if raw, ok := data.GetOk("lockout_duration"); ok {
+		var d time.Duration
+		if raw.(string) != "" {
+			d, err = duration.ParseDurationSecond(raw.(string))
+			if err != nil {
+				return handleError(err)
+			}
+		}
+		lockoutDuration = &d
+	}
+	if raw, ok := data.GetOk("lockout_enable"); ok {
+		enable := raw.(bool)
+		lockoutEnable = &enable
+	}
+	if lockoutThreshold != nil || lockoutDuration != nil || lockoutEnable != nil {
+		if err := b.tuneLockout("auth/"+path, lockoutThreshold, lockoutDuration, lockoutEnable); err != nil {
+			b.Backend.Logger().Printf("[ERR] sys: tune of path 'auth/%s' failed: %v", path, err)
+			return handleError(err)
+		}
+	}
+	return resp, nil
+}
+
+// handleMountTuneWrite is used to set config settings on a backend
+func (b *SystemBackend) handleMountTuneWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("path must be specified as a string"),
+			logical.ErrInvalidRequest
 	}
-	if backup == nil {
-		return logical.ErrorResponse("no backed-up keys found"), nil
+	// This call will write both logical backend's configuration as well as auth backends'.
+	// Retaining this behavior for backward compatibility. If this behavior is not desired,
+	// an error can be returned if path has a prefix of "auth/".
+	return b.handleTuneWriteCommon(path, data)
+}
+
+// handleTuneWriteCommon is used to set config settings on a path
+func (b *SystemBackend) handleTuneWriteCommon(
+	path string, data *framework.FieldData) (*logical.Response, error) {
+	path = sanitizeMountPath(path)
+
+	// Prevent protected paths from being changed
+	for _, p := range untunableMounts {
+		if strings.HasPrefix(path, p) {
+			err := fmt.Errorf("[ERR] core: cannot tune '%s'", path)
+			b.Backend.Logger().Print(err)
+			return handleError(err)
+		}
 	}
 
-	// Format the status
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"nonce": backup.Nonce,
-			"keys":  backup.Keys,
-		},
+	mountEntry := b.Core.router.MatchingMountEntry(path)
+	if mountEntry == nil {
+		err := fmt.Errorf("[ERR] sys: tune of path '%s' failed: no mount entry found", path)
+		b.Backend.Logger().Print(err)
+		return handleError(err)
 	}
 
-	return resp, nil
-}
+	var lock *sync.RWMutex
+	switch {
+	case strings.HasPrefix(path, "auth/"):
+		lock = &b.Core.authLock
+	default:
+		lock = &b.Core.mountsLock
+	}
 
-func (b *SystemBackend) handleRekeyRetrieveBarrier(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyRetrieve(req, data, false)
+	// Timing configuration parameters
+	{
+		var newDefault, newMax *time.Duration
+		defTTL := data.Get("default_lease_ttl").(string)
+		switch defTTL {
+		case "":
+		case "system":
+			tmpDef := time.Duration(0)
+			newDefault = &tmpDef
+		default:
+			tmpDef, err := duration.ParseDurationSecond(defTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newDefault = &tmpDef
+		}
+
+		maxTTL := data.Get("max_lease_ttl").(string)
+		switch maxTTL {
+		case "":
+		case "system":
+			tmpMax := time.Duration(0)
+			newMax = &tmpMax
+		default:
+			tmpMax, err := duration.ParseDurationSecond(maxTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newMax = &tmpMax
+		}
+
+		if newDefault != nil || newMax != nil {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if err := b.tuneMountTTLs(path, &mountEntry.Config, newDefault, newMax); err != nil {
+				b.Backend.Logger().Printf("[ERR] sys: tune of path '%s' failed: %v", path, err)
+				return handleError(err)
+			}
+		}
+	}
+
+	return nil, nil
 }
 
-func (b *SystemBackend) handleRekeyRetrieveRecovery(
+// handleRenew is used to renew a lease with a given LeaseID
+func (b *SystemBackend) handleRenew(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyRetrieve(req, data, true)
-}
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		leaseID = data.Get("url_lease_id").(string)
+	}
+	incrementRaw := data.Get("increment").(int)
 
-// handleRekeyDelete deletes backed-up, PGP-encrypted unseal keys from a rekey
-// operation
-func (b *SystemBackend) handleRekeyDelete(
-	req *logical.Request,
-	data *framework.FieldData,
-	recovery bool) (*logical.Response, error) {
-	err := b.Core.RekeyDeleteBackup(recovery)
+	// Convert the increment
+	increment := time.Duration(incrementRaw) * time.Second
+
+	// Invoke the expiration manager directly
+	resp, err := b.Core.expiration.Renew(leaseID, increment)
 	if err != nil {
-		return nil, fmt.Errorf("error during deletion of backed-up keys: %v", err)
+		b.Backend.Logger().Printf("[ERR] sys: renew '%s' failed: %v", leaseID, err)
+		return handleError(err)
 	}
+	return resp, err
+}
+
+// handleRevoke is used to revoke a given LeaseID
+func (b *SystemBackend) handleRevoke(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
 
+	// Invoke the expiration manager directly
+	if err := b.Core.expiration.Revoke(leaseID); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: revoke '%s' failed: %v", leaseID, err)
+		return handleError(err)
+	}
 	return nil, nil
 }
-func (b *SystemBackend) handleRekeyDeleteBarrier(
+
+// handleRevokePrefix is used to revoke a prefix with many LeaseIDs
+func (b *SystemBackend) handleRevokePrefix(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyDelete(req, data, false)
+	return b.handleRevokePrefixCommon(req, data, false)
 }
 
-func (b *SystemBackend) handleRekeyDeleteRecovery(
+// handleRevokeForce is used to revoke a prefix with many LeaseIDs, ignoring errors
+func (b *SystemBackend) handleRevokeForce(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyDelete(req, data, true)
+	return b.handleRevokePrefixCommon(req, data, true)
 }
 
-// handleMountTable handles the "mounts" endpoint to provide the mount table
-func (b *SystemBackend) handleMountTable(
+// handleRevokePrefixCommon is used to revoke a prefix with many LeaseIDs
+func (b *SystemBackend) handleRevokePrefixCommon(
+	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
+	// Get all the options
+	prefix := data.Get("prefix").(string)
+
+	// Queue the revocation with the expiration manager, as there can be
+	// too many leases to revoke within the request
+	err := b.Core.expiration.QueueRevokePrefix(prefix, force, nil)
+	if err == errRevocationQueued {
+		return revocationQueuedResponse(), nil
+	}
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: revoke prefix '%s' failed: %v", prefix, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleAuthTable handles the "auth" endpoint to provide the auth table
+func (b *SystemBackend) handleAuthTable(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.mountsLock.RLock()
-	defer b.Core.mountsLock.RUnlock()
+	b.Core.authLock.RLock()
+	defer b.Core.authLock.RUnlock()
 
 	resp := &logical.Response{
 		Data: make(map[string]interface{}),
 	}
-
-	for _, entry := range b.Core.mounts.Entries {
+	for _, entry := range b.Core.auth.Entries {
 		info := map[string]interface{}{
 			"type":        entry.Type,
 			"description": entry.Description,
@@ -670,76 +1805,72 @@ func (b *SystemBackend) handleMountTable(
 				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
 			},
 		}
-
 		resp.Data[entry.Path] = info
 	}
-
 	return resp, nil
 }
 
-// handleMount is used to mount a new path
-func (b *SystemBackend) handleMount(
+// handleLockedUsersRead is used to list the users that failed to login on
+// each auth mount, and whether they are locked out
+func (b *SystemBackend) handleLockedUsersRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	path := data.Get("path").(string)
-	logicalType := data.Get("type").(string)
-	description := data.Get("description").(string)
-
-	path = sanitizeMountPath(path)
-
-	var config MountConfig
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"by_mount": b.Core.loginLockouts.List(),
+		},
+	}, nil
+}
 
-	var apiConfig struct {
-		DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
-		MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
-	}
-	configMap := data.Get("config").(map[string]interface{})
-	if configMap != nil && len(configMap) != 0 {
-		err := mapstructure.Decode(configMap, &apiConfig)
-		if err != nil {
-			return logical.ErrorResponse(
-					"unable to convert given mount config information"),
-				logical.ErrInvalidRequest
-		}
+// handleLockedUsersUnlock is used to clear the failed logins of a user,
+// lifting their lockout
+func (b *SystemBackend) handleLockedUsersUnlock(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := sanitizeMountPath(credentialRoutePrefix + data.Get("path").(string))
+	user := data.Get("user").(string)
+	if user == "" {
+		return logical.ErrorResponse("user must be specified"), logical.ErrInvalidRequest
 	}
 
-	switch apiConfig.DefaultLeaseTTL {
-	case "":
-	case "system":
-	default:
-		tmpDef, err := duration.ParseDurationSecond(apiConfig.DefaultLeaseTTL)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-					"unable to parse default TTL of %s: %s", apiConfig.DefaultLeaseTTL, err)),
-				logical.ErrInvalidRequest
-		}
-		config.DefaultLeaseTTL = tmpDef
+	if !b.Core.loginLockouts.Unlock(path, strings.ToLower(user)) {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"user %q has not failed to login on %q", user, path)), logical.ErrInvalidRequest
 	}
+	b.Backend.Logger().Printf("[INFO] sys: unlocked user %q of %q", user, path)
+	return nil, nil
+}
 
-	switch apiConfig.MaxLeaseTTL {
-	case "":
-	case "system":
-	default:
-		tmpMax, err := duration.ParseDurationSecond(apiConfig.MaxLeaseTTL)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-					"unable to parse max TTL of %s: %s", apiConfig.MaxLeaseTTL, err)),
-				logical.ErrInvalidRequest
+// handleInternalUIMounts is used to list the auth mounts visible to
+// unauthenticated clients
+func (b *SystemBackend) handleInternalUIMounts(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.authLock.RLock()
+	defer b.Core.authLock.RUnlock()
+
+	auth := make(map[string]interface{})
+	for _, entry := range b.Core.auth.Entries {
+		if entry.Config.ListingVisibility != ListingVisibilityUnauth {
+			continue
+		}
+		auth[entry.Path] = map[string]interface{}{
+			"type":        entry.Type,
+			"description": entry.Description,
 		}
-		config.MaxLeaseTTL = tmpMax
 	}
 
-	if config.MaxLeaseTTL != 0 && config.DefaultLeaseTTL > config.MaxLeaseTTL {
-		return logical.ErrorResponse(
-				"given default lease TTL greater than given max lease TTL"),
-			logical.ErrInvalidRequest
-	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"auth": auth,
+		},
+	}, nil
+}
 
-	if config.DefaultLeaseTTL > b.Core.maxLeaseTTL {
-		return logical.ErrorResponse(fmt.Sprintf(
-				"given default lease TTL greater than system max lease TTL of %d", int(b.Core.maxLeaseTTL.Seconds()))),
-			logical.ErrInvalidRequest
-	}
+// handleEnableAuth is used to enable a new credential backend
+func (b *SystemBackend) handleEnableAuth(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	path := data.Get("path").(string)
+	logicalType := data.Get("type").(string)
+	description := data.Get("description").(string)
 
 	if logicalType == "" {
 		return logical.ErrorResponse(
@@ -747,425 +1878,793 @@ func (b *SystemBackend) handleMount(
 			logical.ErrInvalidRequest
 	}
 
+	path = sanitizeMountPath(path)
+
 	// Create the mount entry
 	me := &MountEntry{
-		Table:       mountTableType,
+		Table:       credentialTableType,
 		Path:        path,
 		Type:        logicalType,
 		Description: description,
-		Config:      config,
 	}
 
-	// Attempt mount
-	if err := b.Core.mount(me); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: mount %s failed: %v", me.Path, err)
+	// Attempt enabling
+	if err := b.Core.enableCredential(me); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: enable auth %s failed: %v", me.Path, err)
 		return handleError(err)
 	}
-
 	return nil, nil
 }
 
-// used to intercept an HTTPCodedError so it goes back to callee
-func handleError(
-	err error) (*logical.Response, error) {
-	switch err.(type) {
-	case logical.HTTPCodedError:
-		return logical.ErrorResponse(err.Error()), err
-	default:
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-	}
-}
-
-// handleUnmount is used to unmount a path
-func (b *SystemBackend) handleUnmount(
+// handleDisableAuth is used to disable a credential backend
+func (b *SystemBackend) handleDisableAuth(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	suffix := strings.TrimPrefix(req.Path, "mounts/")
+	suffix := strings.TrimPrefix(req.Path, "auth/")
 	if len(suffix) == 0 {
 		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
 	}
 
 	suffix = sanitizeMountPath(suffix)
 
-	// Attempt unmount
-	if err := b.Core.unmount(suffix); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: unmount '%s' failed: %v", suffix, err)
+	// Attempt disable
+	err := b.Core.disableCredential(suffix)
+	if err == errRevocationQueued {
+		return revocationQueuedResponse(), nil
+	}
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: disable auth '%s' failed: %v", suffix, err)
 		return handleError(err)
 	}
-
 	return nil, nil
 }
 
-// handleRemount is used to remount a path
-func (b *SystemBackend) handleRemount(
+// handlePolicyList handles the "policy" endpoint to provide the enabled policies
+func (b *SystemBackend) handlePolicyList(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get the paths
-	fromPath := data.Get("from").(string)
-	toPath := data.Get("to").(string)
-	if fromPath == "" || toPath == "" {
-		return logical.ErrorResponse(
-				"both 'from' and 'to' path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
+	// Get all the configured policies
+	policies, err := b.Core.policyStore.ListPolicies()
 
-	fromPath = sanitizeMountPath(fromPath)
-	toPath = sanitizeMountPath(toPath)
+	// Add the special "root" policy
+	policies = append(policies, "root")
+	resp := logical.ListResponse(policies)
 
-	// Attempt remount
-	if err := b.Core.remount(fromPath, toPath); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: remount '%s' to '%s' failed: %v", fromPath, toPath, err)
-		return handleError(err)
+	// Backwords compatibility
+	resp.Data["policies"] = resp.Data["keys"]
+
+	if err == nil && data.Get("detailed").(bool) {
+		entries, err := b.Core.policyStore.GetPolicies(policies)
+		if err != nil {
+			return handleError(err)
+		}
+
+		keyInfo := make(map[string]interface{}, len(policies))
+		for i, name := range policies {
+			var metadata map[string]string
+			if entries[i] != nil {
+				metadata = entries[i].Metadata
+			}
+			keyInfo[name] = map[string]interface{}{
+				"metadata": metadata,
+			}
+		}
+		resp.Data["key_info"] = keyInfo
 	}
 
-	return nil, nil
+	return resp, err
 }
 
-// handleAuthTuneRead is used to get config settings on a auth path
-func (b *SystemBackend) handleAuthTuneRead(
+// handlePolicyRead handles the "policy/<name>" endpoint to read a policy
+func (b *SystemBackend) handlePolicyRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse(
-				"path must be specified as a string"),
-			logical.ErrInvalidRequest
+	name := data.Get("name").(string)
+
+	policy, err := b.Core.policyStore.GetPolicy(name)
+	if err != nil {
+		return handleError(err)
 	}
-	return b.handleTuneReadCommon("auth/" + path)
-}
 
-// handleMountTuneRead is used to get config settings on a backend
-func (b *SystemBackend) handleMountTuneRead(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse(
-				"path must be specified as a string"),
-			logical.ErrInvalidRequest
+	if policy == nil {
+		return nil, nil
 	}
 
-	// This call will read both logical backend's configuration as well as auth backends'.
-	// Retaining this behavior for backward compatibility. If this behavior is not desired,
-	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneReadCommon(path)
+	syntax := policy.Syntax
+	if syntax == "" {
+		syntax = PolicySyntaxHCL
+	}
+
+	var expireTime string
+	if !policy.ExpireTime.IsZero() {
+		expireTime = policy.ExpireTime.Format(time.RFC3339Nano)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":             name,
+			"rules":            policy.Raw,
+			"syntax":           syntax,
+			"metadata":         policy.Metadata,
+			"expire_time":      expireTime,
+			"delete_on_expire": policy.DeleteOnExpire,
+			"shadow":           policy.Shadow,
+			"signature":        policy.Signature,
+			"signed_by":        policy.SignedBy,
+		},
+	}, nil
 }
 
-// handleTuneReadCommon returns the config settings of a path
-func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
-	path = sanitizeMountPath(path)
+// handlePolicySet handles the "policy/<name>" endpoint to set a policy
+func (b *SystemBackend) handlePolicySet(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	rules := data.Get("rules").(string)
 
-	sysView := b.Core.router.MatchingSystemView(path)
-	if sysView == nil {
-		err := fmt.Errorf("[ERR] sys: cannot fetch sysview for path %s", path)
-		b.Backend.Logger().Print(err)
+	// Validate the rules parse
+	syntax := data.Get("syntax").(string)
+	parse, err := ParseSyntax(rules, syntax)
+	if err != nil {
 		return handleError(err)
 	}
 
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"default_lease_ttl": int(sysView.DefaultLeaseTTL().Seconds()),
-			"max_lease_ttl":     int(sysView.MaxLeaseTTL().Seconds()),
-		},
+	// Override the name
+	parse.Name = strings.ToLower(name)
+
+	// Keep the existing metadata, expiration and mode unless new ones are
+	// given
+	existing, err := b.Core.policyStore.GetPolicy(parse.Name)
+	if err != nil {
+		return handleError(err)
+	}
+	if existing != nil {
+		parse.Metadata = existing.Metadata
+		parse.ExpireTime = existing.ExpireTime
+		parse.DeleteOnExpire = existing.DeleteOnExpire
+		parse.Shadow = existing.Shadow
+
+		// The signature is only kept if the rules it signs are unchanged
+		if existing.Raw == parse.Raw {
+			parse.Signature = existing.Signature
+		}
+	}
+
+	if raw, ok := data.GetOk("metadata"); ok {
+		metadata, err := policyMetadata(raw.(map[string]interface{}))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		parse.Metadata = metadata
+	}
+
+	if raw, ok := data.GetOk("ttl"); ok {
+		parse.ExpireTime = time.Time{}
+		if ttl := raw.(int); ttl > 0 {
+			parse.ExpireTime = time.Now().Add(time.Duration(ttl) * time.Second)
+		} else if ttl < 0 {
+			return logical.ErrorResponse("ttl cannot be negative"), logical.ErrInvalidRequest
+		}
+	}
+	if raw, ok := data.GetOk("delete_on_expire"); ok {
+		parse.DeleteOnExpire = raw.(bool)
+	}
+	if raw, ok := data.GetOk("shadow"); ok {
+		parse.Shadow = raw.(bool)
+	}
+	if raw, ok := data.GetOk("signature"); ok {
+		parse.Signature = raw.(string)
 	}
 
+	// Update the policy
+	if err := b.Core.policyStore.SetPolicy(parse); err != nil {
+		return handleError(err)
+	}
+
+	// Point out rules that are likely to be mistakes, such as overlapping
+	// paths or paths where nothing is mounted
+	_, warnings := ValidatePolicySyntax(rules, syntax)
+	for _, pattern := range unmountedPaths(parse, b.Core.router.MountPoints()) {
+		warnings = append(warnings, &PolicyIssue{
+			Message: fmt.Sprintf(unmountedPathWarning, pattern),
+		})
+	}
+	if len(warnings) == 0 {
+		return nil, nil
+	}
+	resp := &logical.Response{}
+	for _, warning := range warnings {
+		if warning.Line > 0 {
+			resp.AddWarning(fmt.Sprintf("line %d: %s", warning.Line, warning.Message))
+		} else {
+			resp.AddWarning(warning.Message)
+		}
+	}
 	return resp, nil
 }
 
-// handleAuthTuneWrite is used to set config settings on an auth path
-func (b *SystemBackend) handleAuthTuneWrite(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse("path must be specified as a string"),
-			logical.ErrInvalidRequest
+// policyMetadata converts the metadata given for a policy, which must have
+// string values.
+func policyMetadata(raw map[string]interface{}) (map[string]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string, len(raw))
+	for key, value := range raw {
+		str, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("metadata value for '%s' must be a string", key)
+		}
+		metadata[key] = str
 	}
-	return b.handleTuneWriteCommon("auth/"+path, data)
+	return metadata, nil
 }
 
-// handleMountTuneWrite is used to set config settings on a backend
-func (b *SystemBackend) handleMountTuneWrite(
+// handlePolicyValidate handles the "policy-validate" endpoint to check the
+// rules of a policy without storing them
+func (b *SystemBackend) handlePolicyValidate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse("path must be specified as a string"),
-			logical.ErrInvalidRequest
+	rules := data.Get("rules").(string)
+	if rules == "" {
+		return logical.ErrorResponse("missing rules"), nil
 	}
-	// This call will write both logical backend's configuration as well as auth backends'.
-	// Retaining this behavior for backward compatibility. If this behavior is not desired,
-	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneWriteCommon(path, data)
+
+	errs, warnings := ValidatePolicySyntax(rules, data.Get("syntax").(string))
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid":    len(errs) == 0,
+			"errors":   policyIssueList(errs),
+			"warnings": policyIssueList(warnings),
+		},
+	}, nil
 }
 
-// handleTuneWriteCommon is used to set config settings on a path
-func (b *SystemBackend) handleTuneWriteCommon(
-	path string, data *framework.FieldData) (*logical.Response, error) {
-	path = sanitizeMountPath(path)
+func policyIssueList(issues []*PolicyIssue) []map[string]interface{} {
+	ret := make([]map[string]interface{}, 0, len(issues))
+	for _, issue := range issues {
+		ret = append(ret, map[string]interface{}{
+			"line":    issue.Line,
+			"message": issue.Message,
+		})
+	}
+	return ret
+}
 
-	// Prevent protected paths from being changed
-	for _, p := range untunableMounts {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Errorf("[ERR] core: cannot tune '%s'", path)
-			b.Backend.Logger().Print(err)
-			return handleError(err)
-		}
+// handlePolicyDiff handles the "policy/<name>/diff" endpoint to compare the
+// stored rules of a policy with candidate rules
+func (b *SystemBackend) handlePolicyDiff(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(data.Get("name").(string))
+	rules := data.Get("rules").(string)
+	if rules == "" {
+		return logical.ErrorResponse("missing rules"), logical.ErrInvalidRequest
 	}
 
-	mountEntry := b.Core.router.MatchingMountEntry(path)
-	if mountEntry == nil {
-		err := fmt.Errorf("[ERR] sys: tune of path '%s' failed: no mount entry found", path)
-		b.Backend.Logger().Print(err)
+	candidate, err := ParseSyntax(rules, data.Get("syntax").(string))
+	if err != nil {
 		return handleError(err)
 	}
-
-	var lock *sync.RWMutex
-	switch {
-	case strings.HasPrefix(path, "auth/"):
-		lock = &b.Core.authLock
-	default:
-		lock = &b.Core.mountsLock
+	current, err := b.Core.policyStore.GetPolicy(name)
+	if err != nil {
+		return handleError(err)
 	}
 
-	// Timing configuration parameters
-	{
-		var newDefault, newMax *time.Duration
-		defTTL := data.Get("default_lease_ttl").(string)
-		switch defTTL {
-		case "":
-		case "system":
-			tmpDef := time.Duration(0)
-			newDefault = &tmpDef
-		default:
-			tmpDef, err := duration.ParseDurationSecond(defTTL)
-			if err != nil {
-				return handleError(err)
-			}
-			newDefault = &tmpDef
-		}
+	diff := DiffPolicies(current, candidate)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":      name,
+			"exists":    current != nil,
+			"identical": diff.Empty(),
+			"added":     policyPathDiffList(diff.Added),
+			"removed":   policyPathDiffList(diff.Removed),
+			"changed":   policyPathDiffList(diff.Changed),
+		},
+	}, nil
+}
 
-		maxTTL := data.Get("max_lease_ttl").(string)
-		switch maxTTL {
-		case "":
-		case "system":
-			tmpMax := time.Duration(0)
-			newMax = &tmpMax
-		default:
-			tmpMax, err := duration.ParseDurationSecond(maxTTL)
-			if err != nil {
-				return handleError(err)
-			}
-			newMax = &tmpMax
-		}
+func policyPathDiffList(diffs []*PolicyPathDiff) []map[string]interface{} {
+	ret := make([]map[string]interface{}, 0, len(diffs))
+	for _, diff := range diffs {
+		ret = append(ret, map[string]interface{}{
+			"path":                 diff.Path,
+			"added_capabilities":   nonNilStrings(diff.AddedCapabilities),
+			"removed_capabilities": nonNilStrings(diff.RemovedCapabilities),
+			"settings":             nonNilStrings(diff.Settings),
+		})
+	}
+	return ret
+}
 
-		if newDefault != nil || newMax != nil {
-			lock.Lock()
-			defer lock.Unlock()
+// handlePolicyCachePurge handles the "policy-cache/purge" endpoint to clear
+// the cached policies
+func (b *SystemBackend) handlePolicyCachePurge(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.policyStore.Purge()
+	return nil, nil
+}
 
-			if err := b.tuneMountTTLs(path, &mountEntry.Config, newDefault, newMax); err != nil {
-				b.Backend.Logger().Printf("[ERR] sys: tune of path '%s' failed: %v", path, err)
-				return handleError(err)
-			}
+// handlePolicyUsage handles the "policy-usage" endpoint to report how often
+// each policy allowed a request
+func (b *SystemBackend) handlePolicyUsage(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policies, err := b.Core.policyStore.ListPolicies()
+	if err != nil {
+		return handleError(err)
+	}
+	policies = append(policies, "root")
+
+	usage := b.Core.policyStore.Usage(policies)
+	info := make(map[string]interface{}, len(policies))
+	unused := []string{}
+	for _, name := range policies {
+		var lastAllowed string
+		if u := usage[name]; u.Allowed > 0 {
+			lastAllowed = u.LastAllowed.Format(time.RFC3339Nano)
+		} else {
+			unused = append(unused, name)
+		}
+		info[name] = map[string]interface{}{
+			"allowed":      usage[name].Allowed,
+			"last_allowed": lastAllowed,
 		}
 	}
 
-	return nil, nil
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policies": info,
+			"unused":   unused,
+		},
+	}, nil
 }
 
-// handleRenew is used to renew a lease with a given LeaseID
-func (b *SystemBackend) handleRenew(
+// handlePolicyTrashList handles the "policy-trash" endpoint to list the
+// deleted policies that can be restored
+func (b *SystemBackend) handlePolicyTrashList(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
-	if leaseID == "" {
-		leaseID = data.Get("url_lease_id").(string)
+	deleted, err := b.Core.policyStore.ListDeletedPolicies()
+	if err != nil {
+		return handleError(err)
 	}
-	incrementRaw := data.Get("increment").(int)
 
-	// Convert the increment
-	increment := time.Duration(incrementRaw) * time.Second
+	names := make([]string, 0, len(deleted))
+	keyInfo := make(map[string]interface{}, len(deleted))
+	for _, policy := range deleted {
+		names = append(names, policy.Name)
+		keyInfo[policy.Name] = map[string]interface{}{
+			"delete_time": policy.DeleteTime.Format(time.RFC3339Nano),
+			"purge_time":  policy.PurgeTime.Format(time.RFC3339Nano),
+		}
+	}
+	resp := logical.ListResponse(names)
+	resp.Data["key_info"] = keyInfo
+	return resp, nil
+}
 
-	// Invoke the expiration manager directly
-	resp, err := b.Core.expiration.Renew(leaseID, increment)
+// handlePolicyTrashConfigRead handles the "policy-trash/config" endpoint to
+// read how long deleted policies are kept
+func (b *SystemBackend) handlePolicyTrashConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Core.policyStore.TrashConfig()
 	if err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: renew '%s' failed: %v", leaseID, err)
 		return handleError(err)
 	}
-	return resp, err
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"retention": int64(config.Retention.Seconds()),
+		},
+	}, nil
 }
 
-// handleRevoke is used to revoke a given LeaseID
-func (b *SystemBackend) handleRevoke(
+// handlePolicyTrashConfigUpdate handles the "policy-trash/config" endpoint to
+// set how long deleted policies are kept
+func (b *SystemBackend) handlePolicyTrashConfigUpdate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
+	raw, ok := data.GetOk("retention")
+	if !ok {
+		return logical.ErrorResponse("missing retention"), logical.ErrInvalidRequest
+	}
 
-	// Invoke the expiration manager directly
-	if err := b.Core.expiration.Revoke(leaseID); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: revoke '%s' failed: %v", leaseID, err)
+	config := &PolicyTrashConfig{
+		Retention: time.Duration(raw.(int)) * time.Second,
+	}
+	if err := b.Core.policyStore.SetTrashConfig(config); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
 }
 
-// handleRevokePrefix is used to revoke a prefix with many LeaseIDs
-func (b *SystemBackend) handleRevokePrefix(
+// handlePolicyTrashRestore handles the "policy-trash/restore/<name>" endpoint
+// to restore a deleted policy
+func (b *SystemBackend) handlePolicyTrashRestore(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRevokePrefixCommon(req, data, false)
+	name := strings.ToLower(data.Get("name").(string))
+	if err := b.Core.policyStore.RestorePolicy(name); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
 }
 
-// handleRevokeForce is used to revoke a prefix with many LeaseIDs, ignoring errors
-func (b *SystemBackend) handleRevokeForce(
+// handlePolicyUnmounted handles the "policy-unmounted" endpoint to find the
+// paths of policies where no backend is mounted
+func (b *SystemBackend) handlePolicyUnmounted(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRevokePrefixCommon(req, data, true)
+	names, err := b.Core.policyStore.ListPolicies()
+	if err != nil {
+		return handleError(err)
+	}
+	policies, err := b.Core.policyStore.GetPolicies(names)
+	if err != nil {
+		return handleError(err)
+	}
+
+	mounts := b.Core.router.MountPoints()
+	unmounted := make(map[string]interface{})
+	for _, policy := range policies {
+		if policy == nil {
+			continue
+		}
+		if paths := unmountedPaths(policy, mounts); len(paths) > 0 {
+			unmounted[policy.Name] = paths
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"policies": unmounted,
+		},
+	}, nil
 }
 
-// handleRevokePrefixCommon is used to revoke a prefix with many LeaseIDs
-func (b *SystemBackend) handleRevokePrefixCommon(
-	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
-	// Get all the options
-	prefix := data.Get("prefix").(string)
+// handleRulePolicyList handles the "policy-rule" endpoint to list the rule
+// policies
+func (b *SystemBackend) handleRulePolicyList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.policyStore.ListRulePolicies()
+	if err != nil {
+		return handleError(err)
+	}
+	return logical.ListResponse(names), nil
+}
 
-	// Invoke the expiration manager directly
-	var err error
-	if force {
-		err = b.Core.expiration.RevokeForce(prefix)
-	} else {
-		err = b.Core.expiration.RevokePrefix(prefix)
+// handleRulePolicyRead handles the "policy-rule/<name>" endpoint to read a
+// rule policy
+func (b *SystemBackend) handleRulePolicyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	policy, err := b.Core.policyStore.GetRulePolicy(name)
+	if err != nil {
+		return handleError(err)
+	}
+	if policy == nil {
+		return nil, nil
 	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":      policy.Name,
+			"paths":     policy.Paths,
+			"condition": policy.Condition,
+			"time_zone": policy.TimeZone,
+		},
+	}, nil
+}
+
+// handleRulePolicySet handles the "policy-rule/<name>" endpoint to set a
+// rule policy
+func (b *SystemBackend) handleRulePolicySet(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(data.Get("name").(string))
+
+	policy, err := ParseRulePolicy(name,
+		data.Get("paths").([]string),
+		data.Get("condition").(string),
+		data.Get("time_zone").(string))
 	if err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: revoke prefix '%s' failed: %v", prefix, err)
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.policyStore.SetRulePolicy(policy); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
 }
 
-// handleAuthTable handles the "auth" endpoint to provide the auth table
-func (b *SystemBackend) handleAuthTable(
+// handleRulePolicyDelete handles the "policy-rule/<name>" endpoint to delete
+// a rule policy
+func (b *SystemBackend) handleRulePolicyDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.authLock.RLock()
-	defer b.Core.authLock.RUnlock()
+	if err := b.Core.policyStore.DeleteRulePolicy(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
 
-	resp := &logical.Response{
-		Data: make(map[string]interface{}),
+// handlePasswordPolicyList handles the "policies/password" endpoint to list
+// the password policies
+func (b *SystemBackend) handlePasswordPolicyList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.policyStore.ListPasswordPolicies()
+	if err != nil {
+		return handleError(err)
 	}
-	for _, entry := range b.Core.auth.Entries {
-		info := map[string]interface{}{
-			"type":        entry.Type,
-			"description": entry.Description,
-			"config": map[string]interface{}{
-				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
-				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
-			},
-		}
-		resp.Data[entry.Path] = info
+	return logical.ListResponse(names), nil
+}
+
+// handlePasswordPolicyRead handles the "policies/password/<name>" endpoint to
+// read a password policy
+func (b *SystemBackend) handlePasswordPolicyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policy, err := b.Core.policyStore.GetPasswordPolicy(data.Get("name").(string))
+	if err != nil {
+		return handleError(err)
 	}
-	return resp, nil
+	if policy == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":          policy.Name,
+			"min_length":    policy.MinLength,
+			"min_uppercase": policy.MinUppercase,
+			"min_lowercase": policy.MinLowercase,
+			"min_digits":    policy.MinDigits,
+			"min_symbols":   policy.MinSymbols,
+			"history":       policy.History,
+			"max_age":       int64(policy.MaxAge.Seconds()),
+		},
+	}, nil
 }
 
-// handleEnableAuth is used to enable a new credential backend
-func (b *SystemBackend) handleEnableAuth(
+// handlePasswordPolicySet handles the "policies/password/<name>" endpoint to
+// set a password policy
+func (b *SystemBackend) handlePasswordPolicySet(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	path := data.Get("path").(string)
-	logicalType := data.Get("type").(string)
-	description := data.Get("description").(string)
+	policy := &passwordpolicy.Policy{
+		Name:         strings.ToLower(data.Get("name").(string)),
+		MinLength:    data.Get("min_length").(int),
+		MinUppercase: data.Get("min_uppercase").(int),
+		MinLowercase: data.Get("min_lowercase").(int),
+		MinDigits:    data.Get("min_digits").(int),
+		MinSymbols:   data.Get("min_symbols").(int),
+		History:      data.Get("history").(int),
+		MaxAge:       time.Duration(data.Get("max_age").(int)) * time.Second,
+	}
+	if err := policy.Validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
 
-	if logicalType == "" {
-		return logical.ErrorResponse(
-				"backend type must be specified as a string"),
-			logical.ErrInvalidRequest
+	if err := b.Core.policyStore.SetPasswordPolicy(policy); err != nil {
+		return handleError(err)
 	}
+	return nil, nil
+}
 
-	path = sanitizeMountPath(path)
+// handlePasswordPolicyDelete handles the "policies/password/<name>" endpoint
+// to delete a password policy
+func (b *SystemBackend) handlePasswordPolicyDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.policyStore.DeletePasswordPolicy(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
 
-	// Create the mount entry
-	me := &MountEntry{
-		Table:       credentialTableType,
-		Path:        path,
-		Type:        logicalType,
-		Description: description,
+// handlePolicySigningRead handles the "policy-signing" endpoint to read the
+// keys trusted to sign policies
+func (b *SystemBackend) handlePolicySigningRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.Core.policyStore.SigningConfig()
+	if err != nil {
+		return handleError(err)
 	}
 
-	// Attempt enabling
-	if err := b.Core.enableCredential(me); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: enable auth %s failed: %v", me.Path, err)
+	fingerprints, err := pgpkeys.GetFingerprints(config.TrustedKeys, nil)
+	if err != nil {
 		return handleError(err)
 	}
-	return nil, nil
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"trusted_keys": config.TrustedKeys,
+			"fingerprints": fingerprints,
+			"required":     config.Required,
+		},
+	}, nil
 }
 
-// handleDisableAuth is used to disable a credential backend
-func (b *SystemBackend) handleDisableAuth(
+// handlePolicySigningUpdate handles the "policy-signing" endpoint to set the
+// keys trusted to sign policies
+func (b *SystemBackend) handlePolicySigningUpdate(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	suffix := strings.TrimPrefix(req.Path, "auth/")
-	if len(suffix) == 0 {
-		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	config, err := b.Core.policyStore.SigningConfig()
+	if err != nil {
+		return handleError(err)
 	}
 
-	suffix = sanitizeMountPath(suffix)
+	if raw, ok := data.GetOk("trusted_keys"); ok {
+		config.TrustedKeys = raw.([]string)
+	}
+	if raw, ok := data.GetOk("required"); ok {
+		config.Required = raw.(bool)
+	}
 
-	// Attempt disable
-	if err := b.Core.disableCredential(suffix); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: disable auth '%s' failed: %v", suffix, err)
+	if err := b.Core.policyStore.SetSigningConfig(config); err != nil {
 		return handleError(err)
 	}
 	return nil, nil
 }
 
-// handlePolicyList handles the "policy" endpoint to provide the enabled policies
-func (b *SystemBackend) handlePolicyList(
+// handlePolicyExport handles the "policy-export" endpoint to export policies
+// as a signed bundle
+func (b *SystemBackend) handlePolicyExport(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the configured policies
-	policies, err := b.Core.policyStore.ListPolicies()
+	names := strutil.ParseDedupAndSortStrings(data.Get("policies").(string), ",")
 
-	// Add the special "root" policy
-	policies = append(policies, "root")
-	resp := logical.ListResponse(policies)
+	bundle, err := b.Core.policyStore.ExportPolicies(names, data.Get("signing_key").(string))
+	if err != nil {
+		return handleError(err)
+	}
 
-	// Backwords compatibility
-	resp.Data["policies"] = resp.Data["keys"]
+	policies := make(map[string]interface{}, len(bundle.Policies))
+	for name, entry := range bundle.Policies {
+		policy := map[string]interface{}{
+			"rules":    entry.Rules,
+			"metadata": entry.Metadata,
+		}
+		if entry.Signature != "" {
+			policy["signature"] = entry.Signature
+		}
+		policies[name] = policy
+	}
 
-	return resp, err
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"bundle": map[string]interface{}{
+				"version":   bundle.Version,
+				"policies":  policies,
+				"signature": bundle.Signature,
+			},
+		},
+	}, nil
 }
 
-// handlePolicyRead handles the "policy/<name>" endpoint to read a policy
-func (b *SystemBackend) handlePolicyRead(
+// handlePolicyImport handles the "policy-import" endpoint to write the
+// policies of a bundle
+func (b *SystemBackend) handlePolicyImport(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
+	raw := data.Get("bundle").(map[string]interface{})
+	if len(raw) == 0 {
+		return logical.ErrorResponse("missing bundle"), logical.ErrInvalidRequest
+	}
 
-	policy, err := b.Core.policyStore.GetPolicy(name)
+	var bundle PolicyBundle
+	if err := mapstructure.WeakDecode(raw, &bundle); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid bundle: %v", err)), logical.ErrInvalidRequest
+	}
+
+	result, err := b.Core.policyStore.ImportPolicies(&bundle,
+		data.Get("signing_key").(string), data.Get("conflict").(string))
 	if err != nil {
 		return handleError(err)
 	}
 
-	if policy == nil {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"imported":  nonNilStrings(result.Imported),
+			"unchanged": nonNilStrings(result.Unchanged),
+			"skipped":   nonNilStrings(result.Skipped),
+		},
+	}, nil
+}
+
+// nonNilStrings returns an empty list in place of nil, so that responses
+// contain a list rather than null.
+func nonNilStrings(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// handlePolicyGroupList handles the "policy-group" endpoint to list the
+// policy groups
+func (b *SystemBackend) handlePolicyGroupList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	groups, err := b.Core.policyStore.ListGroups()
+	if err != nil {
+		return handleError(err)
+	}
+	return logical.ListResponse(groups), nil
+}
+
+// handlePolicyGroupRead handles the "policy-group/<name>" endpoint to read a
+// policy group
+func (b *SystemBackend) handlePolicyGroupRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	group, err := b.Core.policyStore.GetGroup(data.Get("name").(string))
+	if err != nil {
+		return handleError(err)
+	}
+	if group == nil {
 		return nil, nil
 	}
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"name":  name,
-			"rules": policy.Raw,
+			"name":     group.Name,
+			"policies": group.Policies,
 		},
 	}, nil
 }
 
-// handlePolicySet handles the "policy/<name>" endpoint to set a policy
-func (b *SystemBackend) handlePolicySet(
+// handlePolicyGroupSet handles the "policy-group/<name>" endpoint to set a
+// policy group
+func (b *SystemBackend) handlePolicyGroupSet(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	group := &PolicyGroup{
+		Name:     strings.ToLower(data.Get("name").(string)),
+		Policies: policyutil.SanitizePolicies(strings.Split(data.Get("policies").(string), ","), false),
+	}
+	if len(group.Policies) == 0 {
+		return logical.ErrorResponse("missing policies"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.policyStore.SetGroup(group); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handlePolicyGroupDelete handles the "policy-group/<name>" endpoint to
+// delete a policy group
+func (b *SystemBackend) handlePolicyGroupDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.policyStore.DeleteGroup(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleControlGroupRequest handles the "control-group/request" endpoint to
+// read the status of a control group request
+func (b *SystemBackend) handleControlGroupRequest(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
-	rules := data.Get("rules").(string)
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("missing control group request id"), nil
+	}
 
-	// Validate the rules parse
-	parse, err := Parse(rules)
+	cgReq, err := b.Core.controlGroups.Get(id)
 	if err != nil {
 		return handleError(err)
 	}
+	if cgReq == nil {
+		return logical.ErrorResponse(fmt.Sprintf("control group request %s not found", id)), logical.ErrInvalidRequest
+	}
+	return controlGroupResponse(cgReq), nil
+}
 
-	// Override the name
-	parse.Name = strings.ToLower(name)
+// handleControlGroupAuthorize handles the "control-group/authorize" endpoint
+// to approve a control group request
+func (b *SystemBackend) handleControlGroupAuthorize(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("missing control group request id"), nil
+	}
 
-	// Update the policy
-	if err := b.Core.policyStore.SetPolicy(parse); err != nil {
+	te, err := b.Core.tokenStore.Lookup(data.Get("token").(string))
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	cgReq, err := b.Core.controlGroups.Authorize(id, te)
+	if err != nil {
 		return handleError(err)
 	}
-	return nil, nil
+	return controlGroupResponse(cgReq), nil
 }
 
 // handlePolicyDelete handles the "policy/<name>" endpoint to delete a policy
@@ -1176,7 +2675,21 @@ func (b *SystemBackend) handlePolicyDelete(
 	if err := b.Core.policyStore.DeletePolicy(name); err != nil {
 		return handleError(err)
 	}
-	return nil, nil
+
+	if !data.Get("revoke").(bool) {
+		return nil, nil
+	}
+
+	// Policy names are stored normalized on tokens
+	revoked, err := b.Core.tokenStore.revokeByPolicy(strings.ToLower(name))
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"revoked_tokens": revoked,
+		},
+	}, nil
 }
 
 // handleAuditTable handles the "audit" endpoint to provide the audit table
@@ -1531,6 +3044,66 @@ and max_lease_ttl.`,
 		`The max lease TTL for this mount.`,
 	},
 
+	"tune_token_type": {
+		`The type of tokens issued by this auth mount, "service" or "batch".`,
+	},
+
+	"tune_explicit_max_ttl": {
+		`The hard limit of the lifetime of the tokens issued by this auth mount, which cannot be renewed past it. "system" or "0" removes the limit.`,
+	},
+
+	"tune_listing_visibility": {
+		`Whether this auth mount is listed to unauthenticated clients by sys/internal/ui/mounts, "unauth" or "hidden".`,
+	},
+
+	"tune_lockout_threshold": {
+		`The number of consecutive failed logins after which the users of this auth mount are locked out. Zero sets the default of 5.`,
+	},
+
+	"tune_lockout_duration": {
+		`How long the users of this auth mount are locked out for. "0" sets the default of 15 minutes.`,
+	},
+
+	"tune_lockout_enable": {
+		`Whether failed logins on this auth mount are throttled, and its users locked out. Only logins with a username are.`,
+	},
+
+	"locked-users": {
+		"Lists the users that failed to login, and those locked out.",
+		`
+Users that fail to login on an auth mount with lockouts enabled have to wait
+before attempting again, a second after their first failure and twice as
+long after each following one. Once their consecutive failures reach the
+lockout threshold of the mount, they are locked out for the lockout duration
+of the mount. A successful login clears the failures of a user.
+
+Users are identified by the username given to the backend. Failures of
+logins without a username are not tracked. Failures are only tracked by the
+active node, and are lost when it is restarted.
+		`,
+	},
+
+	"locked-users-user": {
+		`The user to unlock, as listed by sys/locked-users.`,
+	},
+
+	"locked-users-unlock": {
+		"Unlocks a user locked out of an auth mount.",
+		`
+Clears the failed logins of a user of an auth mount, lifting their lockout
+and letting them login right away.
+		`,
+	},
+
+	"internal-ui-mounts": {
+		"Lists the auth mounts visible to unauthenticated clients.",
+		`
+Login pages use this endpoint, which does not require a token, to offer the
+auth mounts whose listing visibility has been tuned to "unauth". Only their
+type and description are returned.
+		`,
+	},
+
 	"remount": {
 		"Move the mount point of an already-mounted backend.",
 		`
@@ -1543,8 +3116,9 @@ This path responds to the following HTTP methods.
 
 	"auth_tune": {
 		"Tune the configuration parameters for an auth path.",
-		`Read and write the 'default-lease-ttl' and 'max-lease-ttl' values of
-the auth path.`,
+		`Read and write the 'default-lease-ttl', 'max-lease-ttl' and 'token-type'
+values of the auth path. Auth paths tuned to issue batch tokens do not
+persist them, which cannot be renewed or revoked.`,
 	},
 
 	"mount_tune": {
@@ -1553,6 +3127,18 @@ the auth path.`,
 the mount.`,
 	},
 
+	"mount_upgrade": {
+		"Upgrade a generic mount to the versioned kv backend.",
+		`
+The mount is switched to the kv backend in place, keeping its path and its
+secrets, each of which becomes the first version of a versioned secret. The
+secrets are rewritten in the background: until this completes, secrets can
+be read at "data/<path>", and other requests to the mount are rejected.
+The upgrade is refused if secrets are stored at "config", "metadata/" or
+"versions/", which the kv backend uses for its own storage.
+		`,
+	},
+
 	"renew": {
 		"Renew a lease on a secret",
 		`
@@ -1665,10 +3251,14 @@ Example: you might have an OAuth backend for GitHub, and one for Google Apps.
 This path responds to the following HTTP methods.
 
     GET /
-        List the names of the configured access control policies.
+        List the names of the configured access control policies. With
+        "detailed" set, the metadata of each policy is returned as well.
 
     GET /<name>
-        Retrieve the rules for the named policy.
+        Retrieve the rules and metadata for the named policy.
+
+    PUT /validate
+        Check the rules of a policy without storing them.
 
     PUT /<name>
         Add or update a policy.
@@ -1682,7 +3272,252 @@ This path responds to the following HTTP methods.
 		`Read, Modify, or Delete an access control policy.`,
 		`
 Read the rules of an existing policy, create or update the rules of a policy,
-or delete a policy.
+or delete a policy. Policies may carry metadata, such as a description or the
+owner of the policy. If no metadata is given when a policy is updated, its
+existing metadata is kept.
+
+A policy may be given a TTL, after which it no longer grants anything, such as
+for temporary break-glass access. If "delete_on_expire" is set, the policy is
+also deleted once it expires. The expiration is kept when a policy is updated
+without a TTL.
+
+A policy may be put in shadow mode to try it out against real traffic. Such a
+policy grants nothing and denies nothing, but the requests it would deny are
+recorded in the audit log with the policy in "shadow_denials". Setting
+"shadow" to false starts enforcing it.
+
+Deleting a policy leaves tokens referencing it in place, without the access it
+granted. If "revoke" is set when deleting, those tokens and their children are
+revoked as well, and the number of tokens referencing the policy is returned.
+		`,
+	},
+
+	"policy-cache-purge": {
+		"Clears the cached policies, policy groups and ACLs.",
+		`
+Policies are cached once read, along with policy groups and the ACLs built
+from them. The number of policies cached can be set with "policy_cache_size"
+in the server configuration. This clears the caches, so that everything is
+read from storage again.
+		`,
+	},
+
+	"policy-diff": {
+		"Compares candidate rules with the stored rules of a policy.",
+		`
+The candidate rules are parsed and compared with the stored version of the
+policy, path by path. Paths only in the candidate are listed as added, paths
+only in the stored version as removed, and paths in both whose capabilities
+or other settings differ as changed. Nothing is written.
+		`,
+	},
+
+	"policy-diff-rules": {
+		`The candidate rules of the policy.`,
+		"",
+	},
+
+	"policy-usage": {
+		"Reports how often each policy allowed a request.",
+		`
+Each time a request is allowed, the policies whose rules allowed it are
+counted. The counts are kept in memory since the Vault was last unsealed or
+became active, and are also emitted as the "vault.policy.allowed.<name>"
+metric. Policies that allowed nothing in that time are listed as unused, and
+may be candidates for deletion.
+		`,
+	},
+
+	"policy-trash": {
+		"Lists the deleted policies that can be restored.",
+		`
+Deleted policies are kept for the configured retention, seven days by
+default, during which they can be restored with "policy-trash/restore".
+Returns the names of the deleted policies, along with when each was deleted
+and when it will be purged.
+		`,
+	},
+
+	"policy-trash-config": {
+		"Configures how long deleted policies are kept.",
+		`
+Deleted policies can be restored until the retention passes, after which
+they are purged. A retention of zero deletes policies outright. Changing the
+retention does not affect policies that were already deleted.
+		`,
+	},
+
+	"policy-trash-retention": {
+		`How long deleted policies can be restored, in seconds or as a duration such as "72h". Zero deletes policies outright.`,
+		"",
+	},
+
+	"policy-trash-restore": {
+		"Restores a deleted policy.",
+		`
+Restores the policy as it was when deleted, including its metadata and
+signature. A policy or policy group of the same name must not have been
+created since. Tokens that still reference the policy are granted its rules
+again.
+		`,
+	},
+
+	"policy-unmounted": {
+		"Lists the paths of policies where no backend is mounted.",
+		`
+Returns, for each policy with such paths, the path patterns that can never
+match a request because no backend is mounted where they point, such as
+"secrets/*" when the generic backend is mounted at "secret/". Templated
+paths are not checked.
+		`,
+	},
+
+	"policy-rule-list": {
+		"Lists the rule policies.",
+		"",
+	},
+
+	"policy-rule": {
+		"Read, write, and delete rule policies.",
+		`
+Rule policies are checked after the path rules of a token's policies have
+allowed a request. Each applies to requests to its paths, and denies those
+for which its condition is false. Conditions may refer to the operation, the
+request data, the token's policies and metadata, whether the token was
+obtained with MFA, the client address, and the time of the request. Rule
+policies apply to every token but root tokens.
+		`,
+	},
+
+	"policy-rule-paths": {
+		`The paths the rule policy applies to, as a list or comma-separated string. A trailing "*" globs, and "+" matches any one segment.`,
+		"",
+	},
+
+	"policy-rule-condition": {
+		`The condition requests must meet, such as 'mfa && time.hour >= 9 && time.hour < 17'.`,
+		"",
+	},
+
+	"policy-rule-time-zone": {
+		`The time zone the time of requests is given in, such as "America/New_York". Defaults to UTC.`,
+		"",
+	},
+
+	"policy-signing": {
+		"Configures the PGP keys trusted to sign policies.",
+		`
+Policies may be written with a detached PGP signature of their rules. The
+signature is checked against the keys trusted here before the policy is
+stored, and is kept with the policy along with the fingerprint of the key
+that made it. If "required" is set, policies that are not signed are
+rejected.
+		`,
+	},
+
+	"policy-signing-trusted-keys": {
+		`Base64-encoded PGP public keys trusted to sign policies, as a list or comma-separated string.`,
+		"",
+	},
+
+	"policy-signing-required": {
+		`If set, policies must be signed by one of the trusted keys.`,
+		"",
+	},
+
+	"policy-export": {
+		`Export policies as a signed bundle.`,
+		`
+Returns a bundle of the given policies, or of all policies if none are given,
+that can be imported into another Vault with "policy-import". The bundle
+includes the rules and metadata of each policy. If a signing key is given, the
+bundle is signed with an HMAC and the same key must be given on import;
+otherwise it carries a digest that detects corruption.
+		`,
+	},
+
+	"policy-export-policies": {
+		`Comma-separated list of the policies to export. Defaults to all policies.`,
+		"",
+	},
+
+	"policy-bundle-signing-key": {
+		`Key used to sign the bundle with an HMAC, and to verify it on import.`,
+		"",
+	},
+
+	"policy-import": {
+		`Import policies from a bundle.`,
+		`
+Writes the policies of a bundle created by "policy-export", after checking its
+signature. All policies are checked before any are written, and if writing one
+fails the policies already written are restored, so either the whole bundle is
+imported or none of it is.
+
+Policies that already exist with different rules or metadata are handled
+according to "conflict": "fail" rejects the import, "skip" keeps the existing
+policy and "overwrite" replaces it.
+		`,
+	},
+
+	"policy-import-bundle": {
+		`The bundle returned by "policy-export".`,
+		"",
+	},
+
+	"policy-import-conflict": {
+		`How to handle existing policies: "fail", "skip" or "overwrite". Defaults to "fail".`,
+		"",
+	},
+
+	"policy-group-list": {
+		`List the policy groups.`,
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        List the names of the policy groups.
+
+    GET /<name>
+        Retrieve the policies of the named group.
+
+    PUT /<name>
+        Add or update a policy group.
+
+    DELETE /<name>
+        Delete the policy group with the given name.
+		`,
+	},
+
+	"policy-group": {
+		`Read, Modify, or Delete a policy group.`,
+		`
+A policy group is a named set of policies. Tokens can be given the name of a
+group in place of a policy, and get the policies that are in the group each
+time they are used, so changing a group changes the access of every token it
+was given to. Groups share names with policies, and cannot contain other
+groups.
+		`,
+	},
+
+	"policy-group-name": {
+		`The name of the policy group.`,
+		"",
+	},
+
+	"policy-group-policies": {
+		`Comma-separated list of the policies in the group.`,
+		"",
+	},
+
+	"policy-validate": {
+		`Check the rules of a policy without storing them.`,
+		`
+Parses the given rules as a policy without storing them, and returns the errors
+that would prevent them from being written along with the line they occur on.
+Warnings are also returned for rules that are valid but likely to be mistakes,
+such as paths that are defined more than once or capabilities that have no
+effect.
 		`,
 	},
 
@@ -1696,6 +3531,46 @@ or delete a policy.
 		"",
 	},
 
+	"policy-syntax": {
+		`The syntax of the rules: "hcl", the default, for HCL1 or JSON, or "hcl2" for HCL2 native syntax.`,
+		"",
+	},
+
+	"policy-metadata": {
+		`Metadata to store with the policy, as a map of string keys to string values.`,
+		"",
+	},
+
+	"policy-ttl": {
+		`How long the policy grants access for, after which it no longer applies to any token. Zero removes the expiration.`,
+		"",
+	},
+
+	"policy-delete-on-expire": {
+		`If set, the policy is deleted once it expires.`,
+		"",
+	},
+
+	"policy-shadow": {
+		`If set, the policy is in shadow mode: what it would deny is audited but not denied.`,
+		"",
+	},
+
+	"policy-signature": {
+		`Detached PGP signature of the rules, armored or base64-encoded.`,
+		"",
+	},
+
+	"policy-revoke": {
+		`If set when deleting the policy, tokens referencing it are revoked.`,
+		"",
+	},
+
+	"policy-detailed": {
+		`If set, the metadata of each policy is returned as well.`,
+		"",
+	},
+
 	"audit-hash": {
 		"The hash of the given string via the given audit backend",
 		"",
@@ -1768,18 +3643,153 @@ Enable a new audit backend or disable an existing backend.
 	"capabilities": {
 		"Fetches the capabilities of the given token on the given path.",
 		`Returns the capabilities of the given token on the path.
-		The path will be searched for a path match in all the policies associated with the token.`,
+		The path will be searched for a path match in all the policies associated with the token.
+		Several paths can be given in "paths", in which case the capabilities on each are returned
+		in "paths", keyed by path.`,
 	},
 
 	"capabilities_self": {
 		"Fetches the capabilities of the given token on the given path.",
 		`Returns the capabilities of the client token on the path.
-		The path will be searched for a path match in all the policies associated with the client token.`,
+		The path will be searched for a path match in all the policies associated with the client token.
+		Several paths can be given in "paths", in which case the capabilities on each are returned
+		in "paths", keyed by path.`,
+	},
+
+	"capabilities_explain": {
+		"Explains whether the given token may perform an operation on the given path.",
+		`Returns whether the token is allowed the operation on the path, the rule
+that matched the path, the policies that rule came from, and the reason for
+the decision. Request parameters can be given as "data" to check them against
+parameter constraints, and "remote_address" gives the address to check rules
+bound to addresses against.`,
+	},
+
+	"control-group-request": {
+		"Reads the status of a request waiting for approval by a control group.",
+		`
+Policies can require requests to a path to be approved by holders of a
+policy before they are carried out. Such requests return the ID of a control
+group request, and this endpoint returns whether it has been approved and by
+whom. Once approved, the request is carried out by making it again with the
+ID in the X-Vault-Control-Group header.
+		`,
+	},
+
+	"control-group-authorize": {
+		"Approves a request waiting for approval by a control group.",
+		`
+The token making this request must hold the policy the control group requires,
+and cannot be the token that made the request being approved. Each token can
+approve a request once.
+		`,
+	},
+
+	"control-group-id": {
+		"ID of the control group request.",
+		"",
 	},
 
 	"capabilities_accessor": {
 		"Fetches the capabilities of the token associated with the given token, on the given path.",
 		`When there is no access to the token, token accessor can be used to fetch the token's capabilities
-		on a given path.`,
+		on a given path. Several paths can be given in "paths", as for the capabilities endpoint.`,
+	},
+
+	"policy-password-list": {
+		"Lists the password policies.",
+		"",
+	},
+
+	"policy-password": {
+		"Read, write, or delete a password policy.",
+		`
+Password policies set the requirements of passwords: their minimum length,
+the minimum number of characters of each class, how many previous passwords
+cannot be reused, and how long they are valid. They are referenced by the
+backends managing passwords, such as userpass, which check passwords against
+them when they are set.
+		`,
+	},
+
+	"mfa-method-list": {
+		"Lists the MFA methods.",
+		`
+MFA methods are the factors, such as TOTP passcodes or Duo pushes, that login
+enforcements require logins to pass before their token is issued.
+		`,
+	},
+
+	"mfa-method-name": {
+		"Name of the MFA method.",
+		"",
+	},
+
+	"mfa-method-totp": {
+		"Configures a TOTP MFA method.",
+		`
+Logins enforced with a TOTP method must give a passcode generated with the
+key of their user. Keys are generated by users with the "generate" endpoint
+of the method, or by operators with the "admin-generate" endpoint.
+		`,
+	},
+
+	"mfa-method-duo": {
+		"Configures a Duo MFA method.",
+		`
+Logins enforced with a Duo method must be approved with a push notification,
+or with a passcode if one is given, through the Duo Auth API. Users are
+mapped to Duo users with the username of the login and "username_format".
+		`,
+	},
+
+	"mfa-method-webhook": {
+		"Configures a webhook MFA method.",
+		`
+Logins enforced with a webhook method are sent to the webhook, which approves
+or denies them. Requests are signed with an HMAC-SHA256 of their body, keyed
+with "secret", in the X-Vault-MFA-Signature header.
+		`,
+	},
+
+	"mfa-totp-generate": {
+		"Generates the TOTP key of the user of the token making the request.",
+		`
+Returns an otpauth URL that can be loaded in authenticator applications. A key
+can only be generated once per user; operators can replace or destroy it with
+the "admin-generate" and "admin-destroy" endpoints.
+		`,
+	},
+
+	"mfa-totp-admin": {
+		"Generates or destroys the TOTP key of a user.",
+		`
+Users are identified by the display name of the tokens their logins issue,
+such as "userpass-alice".
+		`,
+	},
+
+	"mfa-enforcement-list": {
+		"Lists the MFA login enforcements.",
+		"",
+	},
+
+	"mfa-enforcement": {
+		"Configures an MFA login enforcement.",
+		`
+Logins to the given auth mounts, or to the given login paths, must pass all
+the MFA methods of the enforcement before their token is issued. They instead
+return an MFA request ID, which is given with the passcodes of the methods to
+sys/mfa/validate.
+		`,
+	},
+
+	"mfa-validate": {
+		"Completes a login waiting for MFA.",
+		`
+The methods of the login are validated with the passcodes of "mfa_payload",
+and the token of the login is issued if they all pass. Each MFA request ID can
+be validated once, within five minutes of the login.
+		`,
 	},
 }
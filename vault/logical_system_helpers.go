@@ -79,3 +79,107 @@ func (b *SystemBackend) tuneMountTTLs(path string, meConfig *MountConfig, newDef
 
 	return nil
 }
+
+// tuneTokenType is used to set the type of tokens issued by an auth mount
+func (b *SystemBackend) tuneTokenType(path, tokenType string) error {
+	path = sanitizeMountPath(path)
+
+	switch tokenType {
+	case TokenTypeService, TokenTypeBatch:
+	default:
+		return fmt.Errorf("invalid token type %q", tokenType)
+	}
+
+	// The token store issues the type of token requested on creation
+	if path == "auth/token/" {
+		return fmt.Errorf("token type of the token store cannot be tuned")
+	}
+
+	return b.tuneAuthConfig(path, func(config *MountConfig) {
+		config.TokenType = tokenType
+	})
+}
+
+// tuneExplicitMaxTTL is used to set the hard limit of the lifetime of the
+// tokens issued by an auth mount, zero removing it
+func (b *SystemBackend) tuneExplicitMaxTTL(path string, explicitMaxTTL time.Duration) error {
+	path = sanitizeMountPath(path)
+	if explicitMaxTTL < 0 {
+		return fmt.Errorf("explicit max TTL cannot be negative")
+	}
+	return b.tuneAuthConfig(path, func(config *MountConfig) {
+		config.ExplicitMaxTTL = explicitMaxTTL
+	})
+}
+
+// tuneLockout is used to enable lockouts on an auth mount, and to set the
+// number of consecutive failed logins after which its users are locked out,
+// and for how long
+func (b *SystemBackend) tuneLockout(path string, threshold *int, duration *time.Duration, enable *bool) error {
+	path = sanitizeMountPath(path)
+	if path == "auth/token/" {
+		return fmt.Errorf("the token store has no logins to lock out")
+	}
+	if threshold != nil && *threshold < 0 {
+		return fmt.Errorf("lockout threshold cannot be negative")
+	}
+	if duration != nil && *duration < 0 {
+		return fmt.Errorf("lockout duration cannot be negative")
+	}
+	return b.tuneAuthConfig(path, func(config *MountConfig) {
+		if threshold != nil {
+			config.LockoutThreshold = *threshold
+		}
+		if duration != nil {
+			config.LockoutDuration = *duration
+		}
+		if enable != nil {
+			config.LockoutEnable = *enable
+		}
+	})
+}
+
+// tuneListingVisibility is used to set whether an auth mount is listed to
+// unauthenticated clients
+func (b *SystemBackend) tuneListingVisibility(path, visibility string) error {
+	path = sanitizeMountPath(path)
+	switch visibility {
+	case ListingVisibilityHidden, ListingVisibilityUnauth:
+	default:
+		return fmt.Errorf("invalid listing visibility %q", visibility)
+	}
+	if visibility == ListingVisibilityHidden {
+		visibility = ""
+	}
+	return b.tuneAuthConfig(path, func(config *MountConfig) {
+		config.ListingVisibility = visibility
+	})
+}
+
+// tuneAuthConfig applies an update to the config of an auth mount, and
+// persists the auth table
+func (b *SystemBackend) tuneAuthConfig(path string, update func(*MountConfig)) error {
+	b.Core.authLock.Lock()
+	defer b.Core.authLock.Unlock()
+
+	mountEntry := b.Core.router.MatchingMountEntry(path)
+	if mountEntry == nil {
+		return fmt.Errorf("no mount entry found")
+	}
+
+	origConfig := mountEntry.Config
+	update(&mountEntry.Config)
+	if mountEntry.Config == origConfig {
+		return nil
+	}
+
+	// Update the auth table
+	if err := b.Core.persistAuth(b.Core.auth); err != nil {
+		mountEntry.Config = origConfig
+		return fmt.Errorf("failed to update auth table, rolling back tune")
+	}
+
+	b.Core.logger.Printf("[INFO] core: tuned '%s'", path)
+
+	return nil
+}
@@ -0,0 +1,529 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// mfaMethodFields are the fields of the configuration of each type of MFA
+// method
+var mfaMethodFields = map[string]map[string]*framework.FieldSchema{
+	MFATypeTOTP: {
+		"issuer": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "Vault",
+			Description: "The issuer shown in authenticator applications.",
+		},
+		"algorithm": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "SHA1",
+			Description: "The hash algorithm of the passcodes, SHA1, SHA256 or SHA512.",
+		},
+		"digits": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Default:     6,
+			Description: "The number of digits of the passcodes, 6 or 8.",
+		},
+		"period": &framework.FieldSchema{
+			Type:        framework.TypeDurationSecond,
+			Default:     30,
+			Description: "How long each passcode is valid.",
+		},
+		"skew": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Default:     1,
+			Description: "The number of periods before and after the current one whose passcodes are accepted.",
+		},
+		"key_size": &framework.FieldSchema{
+			Type:        framework.TypeInt,
+			Default:     20,
+			Description: "The size in bytes of the generated keys.",
+		},
+	},
+
+	MFATypeDuo: {
+		"integration_key": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The integration key of the Duo Auth API application.",
+		},
+		"secret_key": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The secret key of the Duo Auth API application.",
+		},
+		"api_hostname": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The API hostname of the Duo Auth API application.",
+		},
+		"username_format": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Default:     "%s",
+			Description: "Format string mapping the username of logins to Duo usernames.",
+		},
+		"push_info": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "URL-encoded key/value pairs shown in push notifications.",
+		},
+	},
+
+	MFATypeWebhook: {
+		"url": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The URL of the webhook.",
+		},
+		"secret": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The key of the HMAC-SHA256 signing the requests to the webhook.",
+		},
+	},
+}
+
+// mfaPaths returns the paths of the system backend configuring MFA and
+// completing logins waiting for MFA
+func mfaPaths(b *SystemBackend) []*framework.Path {
+	paths := []*framework.Path{
+		&framework.Path{
+			Pattern: "mfa/method/?$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.handleMFAMethodList,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-list"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-list"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/generate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
+				},
+				"token": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Token of the user. This is set to the token making the request.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleMFATOTPGenerate,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-generate"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-generate"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-(?P<action>generate|destroy)$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
+				},
+				"action": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Whether to generate or destroy the key.",
+				},
+				"display_name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Display name of the tokens of the user, such as 'userpass-alice'.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.UpdateOperation: b.handleMFATOTPAdmin,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-totp-admin"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-totp-admin"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "mfa/login-enforcement/?$",
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation: b.handleMFAEnforcementList,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-enforcement-list"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-enforcement-list"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "mfa/login-enforcement/" + framework.GenericNameRegex("name") + "$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"name": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "Name of the login enforcement.",
+				},
+				"mfa_methods": &framework.FieldSchema{
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The MFA methods logins must pass.",
+				},
+				"auth_mounts": &framework.FieldSchema{
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The auth mounts whose logins must pass the MFA methods, such as 'userpass'.",
+				},
+				"paths": &framework.FieldSchema{
+					Type:        framework.TypeCommaStringSlice,
+					Description: "The login paths which must pass the MFA methods, which are prefixes if they end with '*'.",
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.handleMFAEnforcementRead,
+				logical.UpdateOperation: b.handleMFAEnforcementWrite,
+				logical.DeleteOperation: b.handleMFAEnforcementDelete,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-enforcement"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-enforcement"][1]),
+		},
+
+		// Validations are handled by the core, which issues the token of
+		// the login being completed; the path only declares the fields
+		&framework.Path{
+			Pattern: "mfa/validate$",
+
+			Fields: map[string]*framework.FieldSchema{
+				"mfa_request_id": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "ID of the login waiting for MFA.",
+				},
+				"mfa_payload": &framework.FieldSchema{
+					Type:        framework.TypeMap,
+					Description: "Passcodes of the MFA methods, by method name. Methods without passcodes are given an empty string.",
+				},
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-validate"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-validate"][1]),
+		},
+	}
+
+	for _, methodType := range []string{MFATypeTOTP, MFATypeDuo, MFATypeWebhook} {
+		fields := map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: strings.TrimSpace(sysHelp["mfa-method-name"][0]),
+			},
+		}
+		for name, schema := range mfaMethodFields[methodType] {
+			fields[name] = schema
+		}
+
+		paths = append(paths, &framework.Path{
+			Pattern: "mfa/method/" + methodType + "/" + framework.GenericNameRegex("name") + "$",
+
+			Fields: fields,
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.handleMFAMethodRead,
+				logical.UpdateOperation: b.handleMFAMethodWrite(methodType),
+				logical.DeleteOperation: b.handleMFAMethodDelete,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["mfa-method-"+methodType][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["mfa-method-"+methodType][1]),
+		})
+	}
+
+	return paths
+}
+
+// handleMFAMethodList handles the "mfa/method" endpoint to list the MFA
+// methods
+func (b *SystemBackend) handleMFAMethodList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	names, err := b.Core.mfa.ListMethods()
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(names), nil
+}
+
+// handleMFAMethodRead handles the "mfa/method/<type>/<name>" endpoint to
+// read an MFA method. Secrets are not returned.
+func (b *SystemBackend) handleMFAMethodRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	method, err := b.Core.mfa.Method(strings.ToLower(data.Get("name").(string)))
+	if err != nil {
+		return handleError(err)
+	}
+	if method == nil || !strings.HasPrefix(req.Path, "mfa/method/"+method.Type+"/") {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"name": method.Name,
+			"type": method.Type,
+		},
+	}
+	switch method.Type {
+	case MFATypeTOTP:
+		resp.Data["issuer"] = method.Issuer
+		resp.Data["algorithm"] = method.Algorithm
+		resp.Data["digits"] = method.Digits
+		resp.Data["period"] = int64(method.Period / time.Second)
+		resp.Data["skew"] = method.Skew
+		resp.Data["key_size"] = method.KeySize
+	case MFATypeDuo:
+		resp.Data["integration_key"] = method.IntegrationKey
+		resp.Data["api_hostname"] = method.APIHostname
+		resp.Data["username_format"] = method.UsernameFormat
+		resp.Data["push_info"] = method.PushInfo
+	case MFATypeWebhook:
+		resp.Data["url"] = method.URL
+	}
+	return resp, nil
+}
+
+// handleMFAMethodWrite returns the handler of the
+// "mfa/method/<type>/<name>" endpoint creating or updating MFA methods of
+// the given type. Fields which are not given keep their current value.
+func (b *SystemBackend) handleMFAMethodWrite(methodType string) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := strings.ToLower(data.Get("name").(string))
+		method, err := b.Core.mfa.Method(name)
+		if err != nil {
+			return handleError(err)
+		}
+		created := method == nil
+		if created {
+			method = &MFAMethod{Name: name, Type: methodType}
+		}
+		if method.Type != methodType {
+			return logical.ErrorResponse(fmt.Sprintf("MFA method %s is of type %s", name, method.Type)), logical.ErrInvalidRequest
+		}
+
+		// get returns the value of a field and whether to set it, which is
+		// when it is given or when the method is created, to its default
+		get := func(field string) (interface{}, bool) {
+			if raw, ok := data.GetOk(field); ok {
+				return raw, true
+			}
+			return data.Get(field), created
+		}
+
+		switch methodType {
+		case MFATypeTOTP:
+			if v, ok := get("issuer"); ok {
+				method.Issuer = v.(string)
+			}
+			if v, ok := get("algorithm"); ok {
+				method.Algorithm = strings.ToUpper(v.(string))
+			}
+			if v, ok := get("digits"); ok {
+				method.Digits = v.(int)
+			}
+			if v, ok := get("period"); ok {
+				method.Period = time.Duration(v.(int)) * time.Second
+			}
+			if v, ok := get("skew"); ok {
+				method.Skew = v.(int)
+			}
+			if v, ok := get("key_size"); ok {
+				method.KeySize = v.(int)
+			}
+			if err := method.totp().Validate(); err != nil {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+			if method.Skew < 0 || method.Skew > 10 {
+				return logical.ErrorResponse("skew must be between 0 and 10"), logical.ErrInvalidRequest
+			}
+			if method.KeySize < 16 {
+				return logical.ErrorResponse("key_size must be at least 16"), logical.ErrInvalidRequest
+			}
+
+		case MFATypeDuo:
+			if v, ok := get("integration_key"); ok {
+				method.IntegrationKey = v.(string)
+			}
+			if v, ok := get("secret_key"); ok {
+				method.SecretKey = v.(string)
+			}
+			if v, ok := get("api_hostname"); ok {
+				method.APIHostname = v.(string)
+			}
+			if v, ok := get("username_format"); ok {
+				method.UsernameFormat = v.(string)
+			}
+			if v, ok := get("push_info"); ok {
+				method.PushInfo = v.(string)
+			}
+			if method.IntegrationKey == "" || method.SecretKey == "" || method.APIHostname == "" {
+				return logical.ErrorResponse("integration_key, secret_key and api_hostname must be set"), logical.ErrInvalidRequest
+			}
+			if strings.Count(method.UsernameFormat, "%s") != 1 {
+				return logical.ErrorResponse("username_format must contain '%s' once"), logical.ErrInvalidRequest
+			}
+
+		case MFATypeWebhook:
+			if v, ok := get("url"); ok {
+				method.URL = v.(string)
+			}
+			if v, ok := get("secret"); ok {
+				method.Secret = v.(string)
+			}
+			if !strings.HasPrefix(method.URL, "https://") && !strings.HasPrefix(method.URL, "http://") {
+				return logical.ErrorResponse("url must be an HTTP or HTTPS URL"), logical.ErrInvalidRequest
+			}
+			if method.Secret == "" {
+				return logical.ErrorResponse("secret must be set"), logical.ErrInvalidRequest
+			}
+		}
+
+		if err := b.Core.mfa.SetMethod(method); err != nil {
+			return handleError(err)
+		}
+		return nil, nil
+	}
+}
+
+// handleMFAMethodDelete handles the "mfa/method/<type>/<name>" endpoint to
+// delete an MFA method
+func (b *SystemBackend) handleMFAMethodDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(data.Get("name").(string))
+	method, err := b.Core.mfa.Method(name)
+	if err != nil {
+		return handleError(err)
+	}
+	if method == nil || !strings.HasPrefix(req.Path, "mfa/method/"+method.Type+"/") {
+		return nil, nil
+	}
+	if err := b.Core.mfa.DeleteMethod(name); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleMFATOTPGenerate handles the "mfa/method/totp/<name>/generate"
+// endpoint to generate the TOTP key of the user of the token making the
+// request
+func (b *SystemBackend) handleMFATOTPGenerate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	te, err := b.Core.tokenStore.Lookup(data.Get("token").(string))
+	if err != nil {
+		return nil, err
+	}
+	if te == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+	if te.DisplayName == "" || te.DisplayName == "root" {
+		return logical.ErrorResponse("TOTP keys can only be generated for tokens issued by logins"), logical.ErrInvalidRequest
+	}
+
+	url, err := b.Core.mfa.GenerateTOTP(strings.ToLower(data.Get("name").(string)), te.DisplayName, false)
+	if err != nil {
+		return handleError(err)
+	}
+	return mfaTOTPKeyResponse(url)
+}
+
+// handleMFATOTPAdmin handles the "mfa/method/totp/<name>/admin-generate"
+// and "mfa/method/totp/<name>/admin-destroy" endpoints to manage the TOTP
+// key of any user
+func (b *SystemBackend) handleMFATOTPAdmin(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := strings.ToLower(data.Get("name").(string))
+	displayName := data.Get("display_name").(string)
+	if displayName == "" {
+		return logical.ErrorResponse("missing display_name"), nil
+	}
+
+	if data.Get("action").(string) == "destroy" {
+		if err := b.Core.mfa.DestroyTOTP(name, displayName); err != nil {
+			return handleError(err)
+		}
+		return nil, nil
+	}
+
+	url, err := b.Core.mfa.GenerateTOTP(name, displayName, true)
+	if err != nil {
+		return handleError(err)
+	}
+	return mfaTOTPKeyResponse(url)
+}
+
+func mfaTOTPKeyResponse(url string) (*logical.Response, error) {
+	// The key is also returned on its own, for users entering it by hand
+	secret := url[strings.Index(url, "secret=")+len("secret="):]
+	if i := strings.Index(secret, "&"); i != -1 {
+		secret = secret[:i]
+	}
+	if _, err := otputil.DecodeKey(secret); err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url": url,
+			"key": secret,
+		},
+	}, nil
+}
+
+// handleMFAEnforcementList handles the "mfa/login-enforcement" endpoint to
+// list the login enforcements
+func (b *SystemBackend) handleMFAEnforcementList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.mfa.ListEnforcements()), nil
+}
+
+// handleMFAEnforcementRead handles the "mfa/login-enforcement/<name>"
+// endpoint to read a login enforcement
+func (b *SystemBackend) handleMFAEnforcementRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	enforcement := b.Core.mfa.Enforcement(strings.ToLower(data.Get("name").(string)))
+	if enforcement == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":        enforcement.Name,
+			"mfa_methods": enforcement.Methods,
+			"auth_mounts": enforcement.AuthMounts,
+			"paths":       enforcement.Paths,
+		},
+	}, nil
+}
+
+// handleMFAEnforcementWrite handles the "mfa/login-enforcement/<name>"
+// endpoint to create or update a login enforcement
+func (b *SystemBackend) handleMFAEnforcementWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	methods := data.Get("mfa_methods").([]string)
+	for i, method := range methods {
+		methods[i] = strings.ToLower(method)
+	}
+
+	enforcement := &MFAEnforcement{
+		Name:       strings.ToLower(data.Get("name").(string)),
+		Methods:    methods,
+		AuthMounts: data.Get("auth_mounts").([]string),
+		Paths:      data.Get("paths").([]string),
+	}
+	if err := b.Core.mfa.SetEnforcement(enforcement); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleMFAEnforcementDelete handles the "mfa/login-enforcement/<name>"
+// endpoint to delete a login enforcement
+func (b *SystemBackend) handleMFAEnforcementDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.mfa.DeleteEnforcement(strings.ToLower(data.Get("name").(string))); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
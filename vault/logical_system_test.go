@@ -9,6 +9,7 @@ import (
 
 	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/pgpkeys"
 	"github.com/hashicorp/vault/helper/salt"
 	"github.com/hashicorp/vault/logical"
 )
@@ -22,6 +23,9 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"audit/*",
 		"raw/*",
 		"rotate",
+		"policy-signing",
+		"locked-users",
+		"locked-users/*",
 	}
 
 	b := testSystemBackend(t)
@@ -114,6 +118,42 @@ func TestSystemBackend_unmount(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_unmount_queued(t *testing.T) {
+	core, b, _ := testCoreSystemBackend(t)
+
+	// Hold up the revocation queue
+	core.expiration.revokeWait = 10 * time.Millisecond
+	releaseCh := make(chan struct{})
+	if err := core.expiration.QueueRevokePrefix("secret/", false, func() error {
+		<-releaseCh
+		return nil
+	}); err != errRevocationQueued {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.DeleteOperation, "mounts/secret/")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || len(resp.Warnings()) != 1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The mount is tainted until the revocation completes
+	if core.router.MatchingMount("secret/foo") != "secret/" {
+		t.Fatalf("expected mount to remain")
+	}
+	close(releaseCh)
+	start := time.Now()
+	for core.router.MatchingMount("secret/foo") != "" {
+		if time.Now().Sub(start) > 5*time.Second {
+			t.Fatalf("mount was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 var capabilitiesPolicy = `
 name = "test"
 path "foo/bar*" {
@@ -173,6 +213,125 @@ func testCapabilities(t *testing.T, endpoint string) {
 	if !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual, expected)
 	}
+
+	// Several paths at once
+	req = logical.TestRequest(t, logical.UpdateOperation, endpoint)
+	req.Data["token"] = "tokenid"
+	req.Data["paths"] = []interface{}{"foo/bar", "secret/foo"}
+
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := resp.Data["capabilities"]; ok {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	actual = resp.Data["paths"]
+	expectedPaths := map[string][]string{
+		"foo/bar":    []string{"create", "sudo", "update"},
+		"secret/foo": []string{"deny"},
+	}
+	if !reflect.DeepEqual(actual, expectedPaths) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", actual, expectedPaths)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, endpoint)
+	req.Data["token"] = "tokenid"
+	req.Data["path"] = "foo/bar"
+	req.Data["paths"] = "secret/foo"
+
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["paths"], expectedPaths) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", resp.Data["paths"], expectedPaths)
+	}
+	if !reflect.DeepEqual(resp.Data["capabilities"], expected) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", resp.Data["capabilities"], expected)
+	}
+}
+
+func TestSystemBackend_CapabilitiesExplain(t *testing.T) {
+	core, b, rootToken := testCoreSystemBackend(t)
+
+	policy, _ := Parse(capabilitiesPolicy)
+	err := core.policyStore.SetPolicy(policy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testMakeToken(t, core.tokenStore, rootToken, "tokenid", "", []string{"test"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "capabilities-explain")
+	req.Data["token"] = "tokenid"
+	req.Data["path"] = "foo/bar/baz"
+	req.Data["operation"] = "read"
+
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil {
+		t.Fatalf("bad: %v", resp)
+	}
+
+	exp := map[string]interface{}{
+		"allowed": false,
+		"sudo":    true,
+		"pattern": "foo/bar*",
+		"sources": []map[string]interface{}{
+			map[string]interface{}{
+				"policy": "test",
+				"path":   "foo/bar*",
+			},
+		},
+		"reason": "the matching rule does not grant the 'read' capability",
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", resp.Data, exp)
+	}
+
+	// Rules bound to addresses are checked against the given address
+	policy, _ = Parse(`
+path "secret/prod/*" {
+	capabilities = ["read"]
+	bound_cidrs = ["10.0.0.0/8"]
+}`)
+	policy.Name = "internal"
+	if err := core.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testMakeToken(t, core.tokenStore, rootToken, "internaltoken", "", []string{"internal"})
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "capabilities-explain")
+	req.Data["token"] = "internaltoken"
+	req.Data["path"] = "secret/prod/db"
+	req.Connection = &logical.Connection{RemoteAddr: "10.1.1.1"}
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["allowed"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req.Data["remote_address"] = "192.168.1.1"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["allowed"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req.Data["operation"] = "bogus"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
 }
 
 func TestSystemBackend_CapabilitiesAccessor(t *testing.T) {
@@ -563,7 +722,9 @@ func TestSystemBackend_revokePrefixAuth(t *testing.T) {
 		t.Fatalf("bad: %#v", resp)
 	}
 
-	te, err = ts.Lookup(te.ID)
+	// The token is revoked by the core's token store, whose cache is not
+	// shared with ts
+	te, err = core.tokenStore.Lookup(te.ID)
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -678,20 +839,853 @@ func TestSystemBackend_policyList(t *testing.T) {
 	}
 }
 
-func TestSystemBackend_policyCRUD(t *testing.T) {
+func TestSystemBackend_policyMetadata(t *testing.T) {
 	b := testSystemBackend(t)
 
-	// Create the policy
+	// Create the policy with metadata
 	rules := `path "foo/" { policy = "read" }`
-	req := logical.TestRequest(t, logical.UpdateOperation, "policy/Foo")
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = rules
+	req.Data["metadata"] = map[string]interface{}{
+		"owner":       "team-a",
+		"description": "read access to foo",
+	}
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	expMeta := map[string]string{
+		"owner":       "team-a",
+		"description": "read access to foo",
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["metadata"], expMeta) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data["metadata"], expMeta)
+	}
+
+	// Updating the rules alone keeps the metadata
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = `path "foo/" { policy = "write" }`
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	// List the policies with their metadata
+	req = logical.TestRequest(t, logical.ListOperation, "policy")
+	req.Data["detailed"] = "true"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expInfo := map[string]interface{}{
+		"default": map[string]interface{}{
+			"metadata": map[string]string(nil),
+		},
+		"foo": map[string]interface{}{
+			"metadata": expMeta,
+		},
+		"root": map[string]interface{}{
+			"metadata": map[string]string(nil),
+		},
+	}
+	if !reflect.DeepEqual(resp.Data["key_info"], expInfo) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data["key_info"], expInfo)
+	}
+
+	// Metadata values must be strings
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = rules
+	req.Data["metadata"] = map[string]interface{}{
+		"tags": []interface{}{"a", "b"},
+	}
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_policyExportImport(t *testing.T) {
+	b := testSystemBackend(t)
+
+	rules := `path "foo/" { policy = "read" }`
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
 	req.Data["rules"] = rules
+	req.Data["metadata"] = map[string]interface{}{
+		"owner": "team-a",
+	}
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-export")
+	req.Data["policies"] = "foo"
+	req.Data["signing_key"] = "key"
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	bundle := resp.Data["bundle"].(map[string]interface{})
+	policies := bundle["policies"].(map[string]interface{})
+	if len(policies) != 1 || policies["foo"] == nil {
+		t.Fatalf("bad: %#v", bundle)
+	}
+
+	// Import into another backend
+	b = testSystemBackend(t)
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-import")
+	req.Data["bundle"] = bundle
+	req.Data["signing_key"] = "key"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	exp := map[string]interface{}{
+		"imported":  []string{"foo"},
+		"unchanged": []string{},
+		"skipped":   []string{},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["rules"] != rules || !reflect.DeepEqual(resp.Data["metadata"], map[string]string{"owner": "team-a"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The signing key is checked
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-import")
+	req.Data["bundle"] = bundle
+	req.Data["signing_key"] = "other"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_policyGroupCRUD(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy-group/Admins")
+	req.Data["policies"] = "dev, ops"
 	resp, err := b.HandleRequest(req)
 	if err != nil {
 		t.Fatalf("err: %v %#v", err, resp)
 	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy-group/admins")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"name":     "admins",
+		"policies": []string{"dev", "ops"},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "policy-group")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"admins"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A policy cannot take the name of a group
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/admins")
+	req.Data["rules"] = `path "foo/" { policy = "read" }`
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "policy-group/admins")
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy-group/admins")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
 	if resp != nil {
 		t.Fatalf("bad: %#v", resp)
 	}
+}
+
+func TestSystemBackend_policyCachePurge(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	policy, _ := Parse(`path "secret/*" { policy = "read" }`)
+	policy.Name = "foo"
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Change the policy behind the cache's back
+	entry, err := logical.StorageEntryJSON("foo", &PolicyEntry{
+		Version: 2,
+		Raw:     `path "secret/*" { policy = "write" }`,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.policyStore.view.Put(entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p, err := c.policyStore.GetPolicy("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Paths[0].Policy != "read" {
+		t.Fatalf("bad: %#v", p.Paths[0])
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy-cache/purge")
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	p, err = c.policyStore.GetPolicy("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Paths[0].Policy != "write" {
+		t.Fatalf("bad: %#v", p.Paths[0])
+	}
+}
+
+func TestSystemBackend_policySetWarnings(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read", "list"] }
+path "secret/app/*" { capabilities = ["update"] }`
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	expected := []string{
+		`line 2: path "secret/app/*" takes precedence over path "secret/*" on line 1 without granting its capabilities 'read', 'list'; capabilities are not combined across paths`,
+	}
+	if resp == nil || !reflect.DeepEqual(resp.Warnings(), expected) {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The policy is written regardless
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil || resp == nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	// Paths where nothing is mounted are pointed out
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = `path "secrets/*" { capabilities = ["read"] }`
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	expected = []string{
+		`path "secrets/*" can never match, as no backend is mounted there`,
+	}
+	if resp == nil || !reflect.DeepEqual(resp.Warnings(), expected) {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestSystemBackend_policyUnmounted(t *testing.T) {
+	b := testSystemBackend(t)
+
+	for name, rules := range map[string]string{
+		"good": `path "secret/*" { capabilities = ["read"] }`,
+		"typo": `path "secrets/*" { capabilities = ["read"] }
+path "sys/mounts" { capabilities = ["read"] }
+path "transit/keys" { capabilities = ["list"] }`,
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "policy/"+name)
+		req.Data["rules"] = rules
+		if _, err := b.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "policy-unmounted")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"typo": []string{"secrets/*", "transit/keys"},
+	}
+	if !reflect.DeepEqual(resp.Data["policies"], expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_policyTrash(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "policy-trash/config")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["retention"] != int64(defaultPolicyTrashRetention.Seconds()) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-trash/config")
+	req.Data["retention"] = "1h"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read"] }`
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.DeleteOperation, "policy/foo")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "policy-trash/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"foo"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	info := resp.Data["key_info"].(map[string]interface{})["foo"].(map[string]interface{})
+	deleteTime, err := time.Parse(time.RFC3339Nano, info["delete_time"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	purgeTime, err := time.Parse(time.RFC3339Nano, info["purge_time"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if purgeTime.Sub(deleteTime) != time.Hour {
+		t.Fatalf("bad: %#v", info)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-trash/restore/foo")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["rules"] != `path "secret/*" { capabilities = ["read"] }` {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The policy is no longer in the trash
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-trash/restore/foo")
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_policyDiff(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read"] }`
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo/diff")
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read", "list"] }
+path "sys/mounts" { capabilities = ["read"] }`
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	exp := map[string]interface{}{
+		"name":      "foo",
+		"exists":    true,
+		"identical": false,
+		"added": []map[string]interface{}{
+			{
+				"path":                 "sys/mounts",
+				"added_capabilities":   []string{"read"},
+				"removed_capabilities": []string{},
+				"settings":             []string{},
+			},
+		},
+		"removed": []map[string]interface{}{},
+		"changed": []map[string]interface{}{
+			{
+				"path":                 "secret/*",
+				"added_capabilities":   []string{"list"},
+				"removed_capabilities": []string{},
+				"settings":             []string{},
+			},
+		},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	// Nothing is written
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["rules"] != `path "secret/*" { capabilities = ["read"] }` {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Invalid rules are rejected
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo/diff")
+	req.Data["rules"] = `path "secret/*" { capabilities = ["bogus"] }`
+	if _, err := b.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestSystemBackend_policyHCL2(t *testing.T) {
+	core, b, _ := testCoreSystemBackend(t)
+
+	// HCL2 rules are rejected unless the syntax is given
+	rules := "path \"sys/*\" {\n  max_wrapping_ttl = 60 * 60\n}\n"
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = rules
+	if _, err := b.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+	req.Data["syntax"] = "hcl3"
+	if _, err := b.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+	req.Data["syntax"] = "hcl2"
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["rules"] != rules || resp.Data["syntax"] != "hcl2" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The syntax is kept when the policy is read back from storage
+	core.policyStore.lru.Purge()
+	p, err := core.policyStore.GetPolicy("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Syntax != PolicySyntaxHCL2 || p.Paths[0].MaxWrappingTTL != time.Hour {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-validate")
+	req.Data["rules"] = rules
+	req.Data["syntax"] = "hcl2"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["valid"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_policyUsage(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	acl, err := c.policyStore.ACL("default")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if allowed, _ := acl.AllowOperation(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "auth/token/renew-self",
+	}); !allowed {
+		t.Fatalf("should be allowed")
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "policy-usage")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policies := resp.Data["policies"].(map[string]interface{})
+	usage := policies["default"].(map[string]interface{})
+	if usage["allowed"] != uint64(1) || usage["last_allowed"] == "" {
+		t.Fatalf("bad: %#v", usage)
+	}
+	if !reflect.DeepEqual(resp.Data["unused"], []string{"root"}) {
+		t.Fatalf("bad: %#v", resp.Data["unused"])
+	}
+}
+
+func TestSystemBackend_rulePolicyCRUD(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy-rule/Hours")
+	req.Data["paths"] = "secret/prod/*,sys/mounts"
+	req.Data["condition"] = `time.hour >= 9 && time.hour < 17`
+	req.Data["time_zone"] = "Europe/Paris"
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy-rule/hours")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"name":      "hours",
+		"paths":     []string{"secret/prod/*", "sys/mounts"},
+		"condition": `time.hour >= 9 && time.hour < 17`,
+		"time_zone": "Europe/Paris",
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "policy-rule/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"hours"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Conditions are checked when written
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-rule/bad")
+	req.Data["paths"] = "secret/*"
+	req.Data["condition"] = `os.Getenv("HOME") != ""`
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest || resp == nil || !resp.IsError() {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "policy-rule/hours")
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policy-rule/hours")
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+}
+
+func TestSystemBackend_policySigning(t *testing.T) {
+	_, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy-signing")
+	req.Data["trusted_keys"] = pgpkeys.TestPubKey1
+	req.Data["required"] = true
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy-signing")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	fingerprints, err := pgpkeys.GetFingerprints([]string{pgpkeys.TestPubKey1}, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"trusted_keys": []string{pgpkeys.TestPubKey1},
+		"fingerprints": fingerprints,
+		"required":     true,
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Unsigned policies are rejected
+	rules := `path "secret/*" { policy = "read" }`
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = rules
+	if _, err := b.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v", err)
+	}
+
+	sig := testSignPolicy(t, pgpkeys.TestPrivKey1, rules)
+	req.Data["signature"] = sig
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	// The signature is kept while the rules are unchanged
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/foo")
+	req.Data["rules"] = rules
+	req.Data["metadata"] = map[string]interface{}{"owner": "security"}
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["signature"] != sig || resp.Data["signed_by"] != fingerprints[0] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The signature is carried by exported bundles
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-export")
+	req.Data["policies"] = "foo"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	bundle := resp.Data["bundle"].(map[string]interface{})
+
+	_, b, _ = testCoreSystemBackend(t)
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-signing")
+	req.Data["trusted_keys"] = pgpkeys.TestPubKey1
+	req.Data["required"] = true
+	if resp, err := b.HandleRequest(req); err != nil || resp != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy-import")
+	req.Data["bundle"] = bundle
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["signature"] != sig || resp.Data["signed_by"] != fingerprints[0] {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_policyShadow(t *testing.T) {
+	c, b, root := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/trial")
+	req.Data["rules"] = `path "secret/*" { policy = "write" }`
+	req.Data["shadow"] = true
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	// The mode is kept when the rules are updated
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/trial")
+	req.Data["rules"] = `path "secret/*" { policy = "read" }`
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/trial")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["shadow"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A policy in shadow mode grants nothing
+	testMakeToken(t, c.tokenStore, root, "trial", "", []string{"trial"})
+	caps, err := c.Capabilities("trial", "secret/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(caps, []string{DenyCapability}) {
+		t.Fatalf("bad: %#v", caps)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/trial")
+	req.Data["rules"] = `path "secret/*" { policy = "read" }`
+	req.Data["shadow"] = false
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	caps, err = c.Capabilities("trial", "secret/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(caps, []string{"list", "read"}) {
+		t.Fatalf("bad: %#v", caps)
+	}
+}
+
+func TestSystemBackend_policyTTL(t *testing.T) {
+	c, b, root := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/breakglass")
+	req.Data["rules"] = `path "secret/*" { policy = "write" }`
+	req.Data["ttl"] = "1h"
+	req.Data["delete_on_expire"] = true
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/breakglass")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expireTime, err := time.Parse(time.RFC3339Nano, resp.Data["expire_time"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if remaining := expireTime.Sub(time.Now()); remaining < 59*time.Minute || remaining > time.Hour {
+		t.Fatalf("bad: %v", expireTime)
+	}
+	if resp.Data["delete_on_expire"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testMakeToken(t, c.tokenStore, root, "breakglass", "", []string{"breakglass"})
+	caps, err := c.Capabilities("breakglass", "secret/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(caps) != 5 {
+		t.Fatalf("bad: %#v", caps)
+	}
+
+	// Once expired the policy no longer grants anything
+	p, err := c.policyStore.GetPolicy("breakglass")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p.ExpireTime = time.Now().Add(-time.Second)
+	p.DeleteOnExpire = false
+	if err := c.policyStore.SetPolicy(p); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	caps, err = c.Capabilities("breakglass", "secret/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(caps, []string{DenyCapability}) {
+		t.Fatalf("bad: %#v", caps)
+	}
+
+	// A zero TTL removes the expiration
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/breakglass")
+	req.Data["rules"] = `path "secret/*" { policy = "write" }`
+	req.Data["ttl"] = 0
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	caps, err = c.Capabilities("breakglass", "secret/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(caps) != 5 {
+		t.Fatalf("bad: %#v", caps)
+	}
+}
+
+func TestSystemBackend_policyValidate(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy-validate")
+	req.Data["rules"] = `path "foo/" { capabilities = ["read", "banana"] }`
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	exp := map[string]interface{}{
+		"valid": false,
+		"errors": []map[string]interface{}{
+			map[string]interface{}{
+				"line":    1,
+				"message": `path "foo/": invalid capability 'banana'`,
+			},
+		},
+		"warnings": []map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req.Data["rules"] = `path "foo/" { capabilities = ["read"] }`
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.Data["valid"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Nothing should have been stored
+	req = logical.TestRequest(t, logical.ReadOperation, "policy-validate")
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrUnsupportedOperation {
+		t.Fatalf("expected unsupported operation, got: %v %#v", err, resp)
+	}
+	policies, err := c.policyStore.ListPolicies()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(policies, []string{"default"}) {
+		t.Fatalf("bad: %#v", policies)
+	}
+
+	// A policy can be named validate
+	req = logical.TestRequest(t, logical.UpdateOperation, "policy/validate")
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read"] }`
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "policy/validate")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["name"] != "validate" || resp.Data["rules"] != `path "secret/*" { capabilities = ["read"] }` {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_policyCRUD(t *testing.T) {
+	b := testSystemBackend(t)
+
+	// Create the policy
+	rules := `path "foo/" { policy = "read" }`
+	req := logical.TestRequest(t, logical.UpdateOperation, "policy/Foo")
+	req.Data["rules"] = rules
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp == nil || !reflect.DeepEqual(resp.Warnings(), []string{`path "foo/" can never match, as no backend is mounted there`}) {
+		t.Fatalf("bad: %#v", resp)
+	}
 
 	// Read the policy
 	req = logical.TestRequest(t, logical.ReadOperation, "policy/foo")
@@ -701,8 +1695,15 @@ func TestSystemBackend_policyCRUD(t *testing.T) {
 	}
 
 	exp := map[string]interface{}{
-		"name":  "foo",
-		"rules": rules,
+		"name":             "foo",
+		"rules":            rules,
+		"syntax":           "hcl",
+		"metadata":         map[string]string(nil),
+		"expire_time":      "",
+		"delete_on_expire": false,
+		"shadow":           false,
+		"signature":        "",
+		"signed_by":        "",
 	}
 	if !reflect.DeepEqual(resp.Data, exp) {
 		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
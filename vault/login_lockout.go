@@ -0,0 +1,254 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// defaultLockoutThreshold is the number of consecutive failed logins of
+	// a user after which they are locked out, on mounts with lockouts
+	// enabled but no threshold
+	defaultLockoutThreshold = 5
+
+	// defaultLockoutDuration is how long users are locked out for, on mounts
+	// with lockouts enabled but no duration
+	defaultLockoutDuration = 15 * time.Minute
+
+	// loginBackoffBase is how long a user has to wait after their first
+	// failed login. The wait doubles with every failure until they are
+	// locked out.
+	loginBackoffBase = time.Second
+
+	// loginFailureSweepInterval is how often the failures of users that
+	// have not attempted to login for a while are dropped
+	loginFailureSweepInterval = time.Minute
+)
+
+// loginFailures holds the consecutive failed logins of a user of a mount,
+// with the lockout duration of the mount at the last failure
+type loginFailures struct {
+	count       int
+	last        time.Time
+	lockedUntil time.Time
+	duration    time.Duration
+}
+
+// LoginLockouts tracks the failed logins of the users of the auth mounts
+// with lockouts enabled, to slow down and then lock out those guessing
+// passwords. It is not
+// persisted: lockouts are lifted when the vault is restarted, or on the
+// standby that takes over.
+type LoginLockouts struct {
+	l sync.Mutex
+
+	// failures maps the paths of mounts, such as "auth/userpass/", to the
+	// failures of their users
+	failures map[string]map[string]*loginFailures
+	swept    time.Time
+}
+
+// NewLoginLockouts creates a new login lockout tracker
+func NewLoginLockouts() *LoginLockouts {
+	return &LoginLockouts{
+		failures: make(map[string]map[string]*loginFailures),
+	}
+}
+
+// lockoutSettings returns the number of failures after which the users of a
+// mount are locked out, and for how long, or a zero threshold if lockouts
+// are not enabled on it
+func lockoutSettings(config MountConfig) (int, time.Duration) {
+	if !config.LockoutEnable {
+		return 0, 0
+	}
+	threshold, duration := config.LockoutThreshold, config.LockoutDuration
+	if threshold == 0 {
+		threshold = defaultLockoutThreshold
+	}
+	if duration == 0 {
+		duration = defaultLockoutDuration
+	}
+	return threshold, duration
+}
+
+// wait returns how long a user has to wait before attempting to login
+// again, which is zero if they can login now
+func (f *loginFailures) wait(now time.Time, duration time.Duration) time.Duration {
+	until := f.lockedUntil
+	if until.IsZero() {
+		backoff := loginBackoffBase << uint(f.count-1)
+		if backoff > duration || backoff <= 0 {
+			backoff = duration
+		}
+		until = f.last.Add(backoff)
+	}
+	if now.Before(until) {
+		return until.Sub(now)
+	}
+	return 0
+}
+
+// Check returns how long a user of a mount has to wait before attempting to
+// login again, which is zero if they can login now
+func (l *LoginLockouts) Check(mount, user string, config MountConfig) time.Duration {
+	threshold, duration := lockoutSettings(config)
+	if threshold == 0 {
+		return 0
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	f, ok := l.failures[mount][user]
+	if !ok {
+		return 0
+	}
+	return f.wait(time.Now(), duration)
+}
+
+// Failed records a failed login of a user of a mount, locking them out once
+// their consecutive failures reach the threshold of the mount
+func (l *LoginLockouts) Failed(mount, user string, config MountConfig) {
+	threshold, duration := lockoutSettings(config)
+	if threshold == 0 {
+		return
+	}
+	now := time.Now()
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	if now.Sub(l.swept) > loginFailureSweepInterval {
+		l.sweep(now)
+	}
+
+	users, ok := l.failures[mount]
+	if !ok {
+		users = make(map[string]*loginFailures)
+		l.failures[mount] = users
+	}
+	f, ok := users[user]
+	if !ok {
+		f = &loginFailures{}
+		users[user] = f
+	} else if !f.lockedUntil.IsZero() && !now.Before(f.lockedUntil) {
+		// Lockouts that are over start counting again
+		*f = loginFailures{}
+	}
+
+	f.count++
+	f.last = now
+	f.duration = duration
+	if f.count >= threshold && f.lockedUntil.IsZero() {
+		f.lockedUntil = now.Add(duration)
+		metrics.IncrCounter([]string{"core", "login", "lockout"}, 1)
+	}
+}
+
+// Succeeded clears the failures of a user of a mount after a successful
+// login
+func (l *LoginLockouts) Succeeded(mount, user string) {
+	l.Unlock(mount, user)
+}
+
+// Unlock clears the failures of a user of a mount, lifting their lockout.
+// It returns whether the user had failed to login.
+func (l *LoginLockouts) Unlock(mount, user string) bool {
+	l.l.Lock()
+	defer l.l.Unlock()
+	users, ok := l.failures[mount]
+	if !ok {
+		return false
+	}
+	if _, ok := users[user]; !ok {
+		return false
+	}
+	delete(users, user)
+	if len(users) == 0 {
+		delete(l.failures, mount)
+	}
+	return true
+}
+
+// UnlockMount clears the failures of all the users of a mount, which is
+// done when it is disabled
+func (l *LoginLockouts) UnlockMount(mount string) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	delete(l.failures, mount)
+}
+
+// List returns the users of each mount that failed to login, with their
+// consecutive failures and when their lockout ends, if they are locked out
+func (l *LoginLockouts) List() map[string]interface{} {
+	now := time.Now()
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	out := make(map[string]interface{}, len(l.failures))
+	for mount, users := range l.failures {
+		info := make(map[string]interface{}, len(users))
+		for user, f := range users {
+			locked := !f.lockedUntil.IsZero() && now.Before(f.lockedUntil)
+			lockedUntil := ""
+			if locked {
+				lockedUntil = f.lockedUntil.Format(time.RFC3339)
+			}
+			info[user] = map[string]interface{}{
+				"failed_attempts": f.count,
+				"last_failure":    f.last.Format(time.RFC3339),
+				"locked":          locked,
+				"locked_until":    lockedUntil,
+			}
+		}
+		out[mount] = info
+	}
+	return out
+}
+
+// sweep drops the failures of users whose lockout is over, or that have not
+// attempted to login for the lockout duration of their mount
+func (l *LoginLockouts) sweep(now time.Time) {
+	for mount, users := range l.failures {
+		for user, f := range users {
+			over := !f.lockedUntil.IsZero() && !now.Before(f.lockedUntil)
+			stale := f.lockedUntil.IsZero() && now.Sub(f.last) > f.duration
+			if over || stale {
+				delete(users, user)
+			}
+		}
+		if len(users) == 0 {
+			delete(l.failures, mount)
+		}
+	}
+	l.swept = now
+}
+
+// loginUser returns the user a login request is for, which its failures are
+// tracked under. It is the username given to the backend, either in the
+// data of the request or as the last element of its path, such as
+// "auth/userpass/login/alice". It is empty for logins without a username,
+// whose failures are not tracked: clients sharing an address must not lock
+// each other out.
+func loginUser(req *logical.Request, mount string) string {
+	if username, ok := req.Data["username"].(string); ok && username != "" {
+		return strings.ToLower(username)
+	}
+	path := strings.TrimPrefix(req.Path, mount)
+	if strings.HasPrefix(path, "login/") && len(path) > len("login/") {
+		return strings.ToLower(strings.TrimPrefix(path, "login/"))
+	}
+	return ""
+}
+
+// lockoutError returns the error returned to a user that has to wait before
+// attempting to login again
+func lockoutError(wait time.Duration) (*logical.Response, error) {
+	wait = (wait + time.Second - 1) / time.Second * time.Second
+	return logical.ErrorResponse(fmt.Sprintf(
+		"too many failed login attempts, try again in %s", wait)), logical.ErrRateLimited
+}
@@ -0,0 +1,46 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginLockouts_Sweep(t *testing.T) {
+	l := NewLoginLockouts()
+	long := MountConfig{LockoutEnable: true, LockoutDuration: time.Hour}
+	short := MountConfig{LockoutEnable: true, LockoutDuration: 2 * time.Minute}
+	l.Failed("auth/long/", "alice", long)
+	l.Failed("auth/short/", "bob", short)
+
+	// Failures are dropped once the user has not attempted to login for
+	// the lockout duration of their mount
+	now := time.Now()
+	l.failures["auth/long/"]["alice"].last = now.Add(-30 * time.Minute)
+	l.failures["auth/short/"]["bob"].last = now.Add(-5 * time.Minute)
+	l.sweep(now)
+	if _, ok := l.failures["auth/long/"]["alice"]; !ok {
+		t.Fatalf("bad: %#v", l.failures)
+	}
+	if _, ok := l.failures["auth/short/"]; ok {
+		t.Fatalf("bad: %#v", l.failures)
+	}
+
+	l.failures["auth/long/"]["alice"].last = now.Add(-2 * time.Hour)
+	l.sweep(now)
+	if len(l.failures) != 0 {
+		t.Fatalf("bad: %#v", l.failures)
+	}
+
+	// Lockouts end after the duration of the mount
+	for i := 0; i < defaultLockoutThreshold; i++ {
+		l.Failed("auth/short/", "bob", short)
+	}
+	wait := l.Check("auth/short/", "bob", short)
+	if wait <= time.Minute || wait > 2*time.Minute {
+		t.Fatalf("bad: %s", wait)
+	}
+	l.sweep(now.Add(3 * time.Minute))
+	if len(l.failures) != 0 {
+		t.Fatalf("bad: %#v", l.failures)
+	}
+}
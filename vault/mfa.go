@@ -0,0 +1,443 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/mfa/duo"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// mfaSubPath is the sub-path used for the MFA methods, login
+	// enforcements and TOTP secrets
+	mfaSubPath = "mfa/"
+
+	// The prefixes of the MFA configuration in the MFA view
+	mfaMethodPrefix      = "method/"
+	mfaEnforcementPrefix = "login-enforcement/"
+	mfaTOTPSecretPrefix  = "totp-secret/"
+
+	// mfaValidatePath is the path logins waiting for MFA are completed at
+	mfaValidatePath = "sys/mfa/validate"
+
+	// mfaLoginTTL is how long logins wait for their MFA credentials
+	mfaLoginTTL = 5 * time.Minute
+)
+
+// The types of MFA methods
+const (
+	MFATypeTOTP    = "totp"
+	MFATypeDuo     = "duo"
+	MFATypeWebhook = "webhook"
+)
+
+// MFAMethod is a second factor logins can be required to pass. Only the
+// fields of its type are set.
+type MFAMethod struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// TOTP passcodes, from keys generated for each user
+	Issuer    string        `json:"issuer,omitempty"`
+	Algorithm string        `json:"algorithm,omitempty"`
+	Digits    int           `json:"digits,omitempty"`
+	Period    time.Duration `json:"period,omitempty"`
+	Skew      int           `json:"skew,omitempty"`
+	KeySize   int           `json:"key_size,omitempty"`
+
+	// Duo push notifications or passcodes
+	IntegrationKey string `json:"integration_key,omitempty"`
+	SecretKey      string `json:"secret_key,omitempty"`
+	APIHostname    string `json:"api_hostname,omitempty"`
+	UsernameFormat string `json:"username_format,omitempty"`
+	PushInfo       string `json:"push_info,omitempty"`
+
+	// Webhooks approving logins, called with requests signed with the
+	// secret
+	URL    string `json:"url,omitempty"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// UsesPasscode returns whether users must give a passcode for the method.
+// Duo passcodes are optional, a push notification being sent otherwise.
+func (m *MFAMethod) UsesPasscode() bool {
+	return m.Type == MFATypeTOTP
+}
+
+// MFAEnforcement requires logins on auth mounts, or on login paths, to pass
+// MFA methods
+type MFAEnforcement struct {
+	Name       string   `json:"name"`
+	Methods    []string `json:"methods"`
+	AuthMounts []string `json:"auth_mounts"`
+
+	// Paths are login paths, or prefixes of login paths if they end with
+	// a '*'
+	Paths []string `json:"paths"`
+}
+
+// matches returns whether the enforcement applies to the given login path
+func (e *MFAEnforcement) matches(path string) bool {
+	for _, mount := range e.AuthMounts {
+		if strings.HasPrefix(path, mount) {
+			return true
+		}
+	}
+	for _, p := range e.Paths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaLogin is a login held until its MFA credentials are validated
+type mfaLogin struct {
+	ID       string
+	Path     string
+	Response *logical.Response
+	Methods  []string
+
+	// Identity names the user for the methods keeping state for each
+	// user, and Username is the name of the user for the other systems
+	Identity string
+	Username string
+
+	RemoteAddr string
+	ExpireTime time.Time
+}
+
+// MFAStore holds the MFA methods, the logins they are enforced on, and the
+// logins waiting for MFA
+type MFAStore struct {
+	view   *BarrierView
+	client *http.Client
+
+	// duoClient returns the client of the Duo Auth API of a method. It is
+	// only replaced in tests.
+	duoClient func(method *MFAMethod) (duo.AuthClient, error)
+
+	// lock protects the cached enforcements and the logins, and
+	// serializes the use of TOTP passcodes
+	lock         sync.Mutex
+	enforcements map[string]*MFAEnforcement
+	logins       map[string]*mfaLogin
+}
+
+// NewMFAStore creates a new MFAStore that is backed using a given view
+func NewMFAStore(view *BarrierView) *MFAStore {
+	return &MFAStore{
+		view:         view,
+		client:       cleanhttp.DefaultClient(),
+		duoClient:    newDuoClient,
+		enforcements: make(map[string]*MFAEnforcement),
+		logins:       make(map[string]*mfaLogin),
+	}
+}
+
+// setupMFA is used to initialize the MFA store when the vault is being
+// unsealed.
+func (c *Core) setupMFA() error {
+	view := c.systemBarrierView.SubView(mfaSubPath)
+	c.mfa = NewMFAStore(view)
+	return c.mfa.loadEnforcements()
+}
+
+// teardownMFA is used to reverse setupMFA when the vault is being sealed.
+// Logins waiting for MFA are lost.
+func (c *Core) teardownMFA() error {
+	c.mfa = nil
+	return nil
+}
+
+func (s *MFAStore) loadEnforcements() error {
+	names, err := s.view.List(mfaEnforcementPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list MFA login enforcements: %v", err)
+	}
+	for _, name := range names {
+		var enforcement MFAEnforcement
+		if err := s.get(mfaEnforcementPrefix+name, &enforcement); err != nil {
+			return err
+		}
+		s.enforcements[name] = &enforcement
+	}
+	return nil
+}
+
+func (s *MFAStore) get(key string, out interface{}) error {
+	entry, err := s.view.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	if entry == nil {
+		return nil
+	}
+	if err := entry.DecodeJSON(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *MFAStore) put(key string, v interface{}) error {
+	entry, err := logical.StorageEntryJSON(key, v)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := s.view.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist %s: %v", key, err)
+	}
+	return nil
+}
+
+// Method returns the MFA method with the given name, or nil if it does not
+// exist
+func (s *MFAStore) Method(name string) (*MFAMethod, error) {
+	method := new(MFAMethod)
+	if err := s.get(mfaMethodPrefix+name, method); err != nil {
+		return nil, err
+	}
+	if method.Name == "" {
+		return nil, nil
+	}
+	return method, nil
+}
+
+// ListMethods returns the names of the MFA methods
+func (s *MFAStore) ListMethods() ([]string, error) {
+	return s.view.List(mfaMethodPrefix)
+}
+
+// SetMethod creates or updates an MFA method. Its type cannot be changed.
+func (s *MFAStore) SetMethod(method *MFAMethod) error {
+	existing, err := s.Method(method.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.Type != method.Type {
+		return fmt.Errorf("MFA method %s is of type %s", method.Name, existing.Type)
+	}
+	return s.put(mfaMethodPrefix+method.Name, method)
+}
+
+// DeleteMethod deletes an MFA method, which cannot be used by a login
+// enforcement
+func (s *MFAStore) DeleteMethod(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, enforcement := range s.enforcements {
+		if strutil.StrListContains(enforcement.Methods, name) {
+			return fmt.Errorf("MFA method %s is used by login enforcement %s", name, enforcement.Name)
+		}
+	}
+	if err := s.view.Delete(mfaMethodPrefix + name); err != nil {
+		return fmt.Errorf("failed to delete MFA method: %v", err)
+	}
+	return nil
+}
+
+// Enforcement returns the login enforcement with the given name, or nil if
+// it does not exist
+func (s *MFAStore) Enforcement(name string) *MFAEnforcement {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.enforcements[name]
+}
+
+// ListEnforcements returns the names of the login enforcements
+func (s *MFAStore) ListEnforcements() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, 0, len(s.enforcements))
+	for name := range s.enforcements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetEnforcement creates or updates a login enforcement, whose methods
+// must exist
+func (s *MFAStore) SetEnforcement(enforcement *MFAEnforcement) error {
+	if len(enforcement.Methods) == 0 {
+		return fmt.Errorf("at least one MFA method must be given")
+	}
+	if len(enforcement.AuthMounts) == 0 && len(enforcement.Paths) == 0 {
+		return fmt.Errorf("at least one auth mount or path must be given")
+	}
+	for _, name := range enforcement.Methods {
+		method, err := s.Method(name)
+		if err != nil {
+			return err
+		}
+		if method == nil {
+			return fmt.Errorf("MFA method %s does not exist", name)
+		}
+	}
+	for i, mount := range enforcement.AuthMounts {
+		mount = strings.Trim(mount, "/")
+		if mount == "" {
+			return fmt.Errorf("invalid auth mount")
+		}
+		enforcement.AuthMounts[i] = credentialRoutePrefix + strings.TrimPrefix(mount, credentialRoutePrefix) + "/"
+	}
+	for _, p := range enforcement.Paths {
+		if !strings.HasPrefix(p, credentialRoutePrefix) {
+			return fmt.Errorf("path %s is not a login path under %s", p, credentialRoutePrefix)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.put(mfaEnforcementPrefix+enforcement.Name, enforcement); err != nil {
+		return err
+	}
+	s.enforcements[enforcement.Name] = enforcement
+	return nil
+}
+
+// DeleteEnforcement deletes a login enforcement
+func (s *MFAStore) DeleteEnforcement(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.view.Delete(mfaEnforcementPrefix + name); err != nil {
+		return fmt.Errorf("failed to delete MFA login enforcement: %v", err)
+	}
+	delete(s.enforcements, name)
+	return nil
+}
+
+// enforcedMethods returns the names of the MFA methods logins on the given
+// path must pass
+func (s *MFAStore) enforcedMethods(path string) []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var methods []string
+	for _, enforcement := range s.enforcements {
+		if enforcement.matches(path) {
+			methods = append(methods, enforcement.Methods...)
+		}
+	}
+	return strutil.RemoveDuplicates(methods)
+}
+
+// hold keeps a login until its MFA credentials are validated, and returns
+// the response telling the client how to complete it
+func (s *MFAStore) hold(req *logical.Request, resp *logical.Response, methods []string, username string) (*logical.Response, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate MFA request ID: %v", err)
+	}
+
+	login := &mfaLogin{
+		ID:         id,
+		Path:       req.Path,
+		Response:   resp,
+		Methods:    methods,
+		Identity:   resp.Auth.DisplayName,
+		Username:   username,
+		ExpireTime: time.Now().Add(mfaLoginTTL),
+	}
+	if req.Connection != nil {
+		login.RemoteAddr = req.Connection.RemoteAddr
+	}
+
+	s.lock.Lock()
+	for id, other := range s.logins {
+		if time.Now().After(other.ExpireTime) {
+			delete(s.logins, id)
+		}
+	}
+	s.logins[id] = login
+	s.lock.Unlock()
+
+	requirements := make([]map[string]interface{}, 0, len(methods))
+	for _, name := range methods {
+		method, err := s.Method(name)
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return nil, fmt.Errorf("MFA method %s does not exist", name)
+		}
+		requirements = append(requirements, map[string]interface{}{
+			"name":          method.Name,
+			"type":          method.Type,
+			"uses_passcode": method.UsesPasscode(),
+		})
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"mfa_request_id": id,
+			"mfa_methods":    requirements,
+			"expire_time":    login.ExpireTime.Format(time.RFC3339Nano),
+		},
+	}, nil
+}
+
+// Validate checks the MFA credentials of a login waiting for MFA, given for
+// each method. The login is returned if all its methods pass. Each login
+// can only be validated once, whether its credentials are valid or not.
+func (s *MFAStore) Validate(id string, passcodes map[string]string) (*mfaLogin, error) {
+	defer metrics.MeasureSince([]string{"mfa", "validate"}, time.Now())
+
+	s.lock.Lock()
+	login, ok := s.logins[id]
+	delete(s.logins, id)
+	s.lock.Unlock()
+
+	if !ok || time.Now().After(login.ExpireTime) {
+		return nil, fmt.Errorf("MFA request %s not found", id)
+	}
+
+	for _, name := range login.Methods {
+		method, err := s.Method(name)
+		if err != nil {
+			return nil, err
+		}
+		if method == nil {
+			return nil, fmt.Errorf("MFA method %s does not exist", name)
+		}
+		passcode := passcodes[name]
+		if method.UsesPasscode() && passcode == "" {
+			return nil, fmt.Errorf("missing passcode for MFA method %s", name)
+		}
+
+		switch method.Type {
+		case MFATypeTOTP:
+			err = s.validateTOTP(method, login, passcode)
+		case MFATypeDuo:
+			err = s.validateDuo(method, login, passcode)
+		case MFATypeWebhook:
+			err = s.validateWebhook(method, login, passcode)
+		default:
+			err = fmt.Errorf("unsupported MFA method type %s", method.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("MFA method %s failed: %v", name, err)
+		}
+	}
+	return login, nil
+}
+
+// identityKey returns the key of the state of a method for a user
+func identityKey(method, identity string) string {
+	sum := sha256.Sum256([]byte(identity))
+	return method + "/" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,254 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/duosecurity/duo_api_golang"
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/vault/helper/mfa/duo"
+	"github.com/hashicorp/vault/helper/otputil"
+)
+
+const (
+	// mfaWebhookSignatureHeader is the header of webhook requests holding
+	// the HMAC-SHA256 of their body, keyed with the secret of the method
+	mfaWebhookSignatureHeader = "X-Vault-MFA-Signature"
+
+	// maxMFAWebhookResponseSize bounds the size of webhook responses
+	maxMFAWebhookResponseSize = 64 * 1024
+)
+
+// mfaTOTPSecret is the TOTP key of a user for a method
+type mfaTOTPSecret struct {
+	Identity string `json:"identity"`
+	Key      []byte `json:"key"`
+
+	// LastCounter is the counter of the last passcode used, so that
+	// passcodes cannot be used twice
+	LastCounter uint64 `json:"last_counter"`
+}
+
+func (m *MFAMethod) totp() *otputil.TOTP {
+	return &otputil.TOTP{
+		Algorithm: m.Algorithm,
+		Digits:    m.Digits,
+		Period:    m.Period,
+	}
+}
+
+// GenerateTOTP generates the TOTP key of the user with the given identity,
+// which is the display name of their tokens, and returns its otpauth URL.
+// Unless overwrite is set, users who already have a key cannot replace it,
+// so that a stolen token cannot be used to enroll a new device.
+func (s *MFAStore) GenerateTOTP(name, identity string, overwrite bool) (string, error) {
+	method, err := s.Method(name)
+	if err != nil {
+		return "", err
+	}
+	if method == nil || method.Type != MFATypeTOTP {
+		return "", fmt.Errorf("TOTP MFA method %s does not exist", name)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := mfaTOTPSecretPrefix + identityKey(name, identity)
+	if !overwrite {
+		existing := new(mfaTOTPSecret)
+		if err := s.get(key, existing); err != nil {
+			return "", err
+		}
+		if existing.Identity != "" {
+			return "", fmt.Errorf("a TOTP key has already been generated for %s", identity)
+		}
+	}
+
+	secret, err := otputil.GenerateKey(method.KeySize)
+	if err != nil {
+		return "", err
+	}
+	if err := s.put(key, &mfaTOTPSecret{Identity: identity, Key: secret}); err != nil {
+		return "", err
+	}
+	return method.totp().URL(method.Issuer, identity, secret), nil
+}
+
+// DestroyTOTP deletes the TOTP key of the user with the given identity
+func (s *MFAStore) DestroyTOTP(name, identity string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.view.Delete(mfaTOTPSecretPrefix + identityKey(name, identity)); err != nil {
+		return fmt.Errorf("failed to delete TOTP key: %v", err)
+	}
+	return nil
+}
+
+func (s *MFAStore) validateTOTP(method *MFAMethod, login *mfaLogin, passcode string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := mfaTOTPSecretPrefix + identityKey(method.Name, login.Identity)
+	secret := new(mfaTOTPSecret)
+	if err := s.get(key, secret); err != nil {
+		return err
+	}
+	if secret.Identity == "" {
+		return fmt.Errorf("no TOTP key has been generated for %s", login.Identity)
+	}
+
+	counter, ok := method.totp().Check(secret.Key, passcode, time.Now(), method.Skew)
+	if !ok {
+		return fmt.Errorf("invalid passcode")
+	}
+	if counter <= secret.LastCounter {
+		return fmt.Errorf("passcode has already been used")
+	}
+	secret.LastCounter = counter
+	return s.put(key, secret)
+}
+
+// newDuoClient returns the client of the Duo Auth API of a method
+func newDuoClient(method *MFAMethod) (duo.AuthClient, error) {
+	client := duoapi.NewDuoApi(
+		method.IntegrationKey,
+		method.SecretKey,
+		method.APIHostname,
+		"vault",
+		duoapi.SetTimeout(time.Minute),
+	)
+	return authapi.NewAuthApi(*client), nil
+}
+
+func (s *MFAStore) validateDuo(method *MFAMethod, login *mfaLogin, passcode string) error {
+	client, err := s.duoClient(method)
+	if err != nil {
+		return err
+	}
+	username := fmt.Sprintf(method.UsernameFormat, login.Username)
+
+	preauth, err := client.Preauth(
+		authapi.PreauthUsername(username),
+		authapi.PreauthIpAddr(login.RemoteAddr),
+	)
+	if err != nil || preauth == nil {
+		return fmt.Errorf("could not call Duo preauth")
+	}
+	if preauth.StatResult.Stat != "OK" {
+		return fmt.Errorf("could not look up Duo user information: %s", duoStatMessage(preauth.StatResult))
+	}
+
+	switch preauth.Response.Result {
+	case "allow":
+		return nil
+	case "deny":
+		return fmt.Errorf("%s", preauth.Response.Status_Msg)
+	case "enroll":
+		return fmt.Errorf("%s (%s)", preauth.Response.Status_Msg, preauth.Response.Enroll_Portal_Url)
+	case "auth":
+	default:
+		return fmt.Errorf("invalid Duo preauth response: %s", preauth.Response.Result)
+	}
+
+	factor := "push"
+	options := []func(*url.Values){
+		authapi.AuthUsername(username),
+		authapi.AuthIpAddr(login.RemoteAddr),
+	}
+	if passcode != "" {
+		factor = "passcode"
+		options = append(options, authapi.AuthPasscode(passcode))
+	} else {
+		options = append(options, authapi.AuthDevice("auto"))
+		if method.PushInfo != "" {
+			options = append(options, authapi.AuthPushinfo(method.PushInfo))
+		}
+	}
+
+	result, err := client.Auth(factor, options...)
+	if err != nil || result == nil {
+		return fmt.Errorf("could not call Duo auth")
+	}
+	if result.StatResult.Stat != "OK" {
+		return fmt.Errorf("could not authenticate Duo user: %s", duoStatMessage(result.StatResult))
+	}
+	if result.Response.Result != "allow" {
+		return fmt.Errorf("%s", result.Response.Status_Msg)
+	}
+	return nil
+}
+
+func duoStatMessage(stat authapi.StatResult) string {
+	msg := stat.Stat
+	if stat.Message != nil {
+		msg = *stat.Message
+	}
+	if stat.Message_Detail != nil {
+		msg = msg + " (" + *stat.Message_Detail + ")"
+	}
+	return msg
+}
+
+// validateWebhook asks the webhook of the method whether to approve the
+// login. The request is signed with the secret of the method, so that the
+// webhook can check it comes from Vault.
+func (s *MFAStore) validateWebhook(method *MFAMethod, login *mfaLogin, passcode string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"mfa_request_id": login.ID,
+		"method":         method.Name,
+		"path":           login.Path,
+		"display_name":   login.Identity,
+		"username":       login.Username,
+		"remote_addr":    login.RemoteAddr,
+		"passcode":       passcode,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", method.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(method.Secret))
+	mac.Write(body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(mfaWebhookSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not call webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook returned status code %d", resp.StatusCode)
+	}
+
+	raw, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxMFAWebhookResponseSize))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		Approved bool   `json:"approved"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return fmt.Errorf("invalid webhook response: %v", err)
+	}
+	if !result.Approved {
+		if result.Reason != "" {
+			return fmt.Errorf("login denied by webhook: %s", result.Reason)
+		}
+		return fmt.Errorf("login denied by webhook")
+	}
+	return nil
+}
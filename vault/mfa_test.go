@@ -0,0 +1,428 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/vault/helper/mfa/duo"
+	"github.com/hashicorp/vault/helper/otputil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testCoreMFA returns an unsealed core with a noop credential backend
+// mounted at auth/foo, and a function logging in to it as armon
+func testCoreMFA(t *testing.T) (*Core, string, func() *logical.Response) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	login := func() *logical.Response {
+		noop.Response = &logical.Response{
+			Auth: &logical.Auth{
+				Policies:    []string{"foo"},
+				Metadata:    map[string]string{"username": "armon"},
+				DisplayName: "armon",
+			},
+		}
+		resp, err := c.HandleRequest(&logical.Request{
+			Operation:  logical.UpdateOperation,
+			Path:       "auth/foo/login",
+			Connection: &logical.Connection{RemoteAddr: "127.0.0.1"},
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	return c, root, login
+}
+
+func testMFAWrite(t *testing.T, c *Core, root, path string, data map[string]interface{}) *logical.Response {
+	req := logical.TestRequest(t, logical.UpdateOperation, path)
+	req.Data = data
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	return resp
+}
+
+func testMFAValidate(c *Core, id string, payload map[string]interface{}) (*logical.Response, error) {
+	return c.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "sys/mfa/validate",
+		Data: map[string]interface{}{
+			"mfa_request_id": id,
+			"mfa_payload":    payload,
+		},
+	})
+}
+
+// testMFAHeld checks a login is held for MFA and returns its request ID
+func testMFAHeld(t *testing.T, resp *logical.Response) string {
+	if resp == nil || resp.Auth != nil {
+		t.Fatalf("login was not held for MFA: %#v", resp)
+	}
+	id, _ := resp.Data["mfa_request_id"].(string)
+	if id == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	return id
+}
+
+func TestMFA_TOTP(t *testing.T) {
+	c, root, login := testCoreMFA(t)
+
+	testMFAWrite(t, c, root, "sys/mfa/method/totp/otp", map[string]interface{}{
+		"issuer": "Acme",
+	})
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/mfa/method/totp/otp")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["issuer"] != "Acme" || resp.Data["digits"] != 6 || resp.Data["period"] != int64(30) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Logins are not held until an enforcement matches them
+	resp = login()
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	token := resp.Auth.ClientToken
+
+	// Tokens of logins that did not pass MFA cannot claim it through the
+	// metadata of their child tokens
+	req = logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = token
+	req.Data["meta"] = map[string]interface{}{
+		"mfa": "totp",
+	}
+	resp, err = c.tokenStore.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	for _, id := range []string{token, resp.Auth.ClientToken} {
+		te, err := c.tokenStore.Lookup(id)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if te.MFA || ruleEnvironment(&logical.Request{}, te, time.Now())["mfa"] != false {
+			t.Fatalf("bad: %#v", te)
+		}
+	}
+
+	testMFAWrite(t, c, root, "sys/mfa/login-enforcement/foo", map[string]interface{}{
+		"mfa_methods": "otp",
+		"auth_mounts": "foo",
+	})
+
+	// Users generate their key once
+	resp = testMFAWrite(t, c, root, "sys/mfa/method/totp/otp/generate", map[string]interface{}{
+		"token": token,
+	})
+	u, err := url.Parse(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if u.Scheme != "otpauth" || u.Path != "/Acme:foo-armon" {
+		t.Fatalf("bad: %s", u)
+	}
+	key, err := otputil.DecodeKey(resp.Data["key"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/otp/generate")
+	req.Data["token"] = token
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error generating a second key")
+	}
+
+	totp := &otputil.TOTP{Algorithm: "SHA1", Digits: 6, Period: 30 * time.Second}
+	counter := totp.Counter(time.Now())
+	passcode, err := totp.Passcode(key, counter)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Invalid and missing passcodes fail, and consume the MFA request
+	stale, _ := totp.Passcode(key, counter-10)
+	id := testMFAHeld(t, login())
+	if _, err := testMFAValidate(c, id, map[string]interface{}{"otp": stale}); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := testMFAValidate(c, id, map[string]interface{}{"otp": passcode}); err == nil {
+		t.Fatalf("expected error validating twice")
+	}
+	id = testMFAHeld(t, login())
+	if _, err := testMFAValidate(c, id, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	id = testMFAHeld(t, login())
+	resp, err = testMFAValidate(c, id, map[string]interface{}{"otp": []interface{}{passcode}})
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	te, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.Path != "auth/foo/login" || te.DisplayName != "foo-armon" || strings.Join(te.Policies, ",") != "default,foo" || !te.MFA {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	// Passcodes cannot be used twice
+	id = testMFAHeld(t, login())
+	if _, err := testMFAValidate(c, id, map[string]interface{}{"otp": passcode}); err == nil {
+		t.Fatalf("expected error reusing passcode")
+	}
+	next, _ := totp.Passcode(key, counter+1)
+	id = testMFAHeld(t, login())
+	if resp, err := testMFAValidate(c, id, map[string]interface{}{"otp": next}); err != nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// Methods used by enforcements cannot be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/mfa/method/totp/otp")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Destroyed keys can be regenerated by operators
+	testMFAWrite(t, c, root, "sys/mfa/method/totp/otp/admin-destroy", map[string]interface{}{
+		"display_name": "foo-armon",
+	})
+	id = testMFAHeld(t, login())
+	if _, err := testMFAValidate(c, id, map[string]interface{}{"otp": next}); err == nil {
+		t.Fatalf("expected error without key")
+	}
+	resp = testMFAWrite(t, c, root, "sys/mfa/method/totp/otp/admin-generate", map[string]interface{}{
+		"display_name": "foo-armon",
+	})
+	if resp.Data["key"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Logins are no longer held once the enforcement is deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/mfa/login-enforcement/foo")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp := login(); resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestMFA_Webhook(t *testing.T) {
+	var received map[string]interface{}
+	approve := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("hunter2"))
+		mac.Write(body)
+		if r.Header.Get("X-Vault-MFA-Signature") != hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.Unmarshal(body, &received)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"approved": approve,
+			"reason":   "not on call",
+		})
+	}))
+	defer server.Close()
+
+	c, root, login := testCoreMFA(t)
+	testMFAWrite(t, c, root, "sys/mfa/method/webhook/hook", map[string]interface{}{
+		"url":    server.URL,
+		"secret": "hunter2",
+	})
+	testMFAWrite(t, c, root, "sys/mfa/login-enforcement/foo", map[string]interface{}{
+		"mfa_methods": "hook",
+		"paths":       "auth/foo/log*",
+	})
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/mfa/method/webhook/hook")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := resp.Data["secret"]; ok || resp.Data["url"] != server.URL {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp = login()
+	id := testMFAHeld(t, resp)
+	methods := resp.Data["mfa_methods"].([]map[string]interface{})
+	if len(methods) != 1 || methods[0]["name"] != "hook" || methods[0]["uses_passcode"] != false {
+		t.Fatalf("bad: %#v", methods)
+	}
+	resp, err = testMFAValidate(c, id, nil)
+	if err != nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if received["username"] != "armon" || received["display_name"] != "foo-armon" ||
+		received["path"] != "auth/foo/login" || received["remote_addr"] != "127.0.0.1" {
+		t.Fatalf("bad: %#v", received)
+	}
+
+	approve = false
+	id = testMFAHeld(t, login())
+	resp, err = testMFAValidate(c, id, nil)
+	if err == nil || !strings.Contains(resp.Data["error"].(string), "not on call") {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+
+	// A bad signature is rejected by the webhook
+	testMFAWrite(t, c, root, "sys/mfa/method/webhook/hook", map[string]interface{}{
+		"secret": "wrong",
+	})
+	approve = true
+	id = testMFAHeld(t, login())
+	if _, err := testMFAValidate(c, id, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+type testDuoClient struct {
+	factor string
+	result string
+}
+
+func (d *testDuoClient) Preauth(options ...func(*url.Values)) (*authapi.PreauthResult, error) {
+	result := &authapi.PreauthResult{}
+	result.StatResult.Stat = "OK"
+	result.Response.Result = "auth"
+	return result, nil
+}
+
+func (d *testDuoClient) Auth(factor string, options ...func(*url.Values)) (*authapi.AuthResult, error) {
+	d.factor = factor
+	result := &authapi.AuthResult{}
+	result.StatResult.Stat = "OK"
+	result.Response.Result = d.result
+	result.Response.Status_Msg = "denied"
+	return result, nil
+}
+
+func TestMFA_Duo(t *testing.T) {
+	c, root, login := testCoreMFA(t)
+	client := &testDuoClient{result: "allow"}
+	c.mfa.duoClient = func(*MFAMethod) (duo.AuthClient, error) {
+		return client, nil
+	}
+
+	testMFAWrite(t, c, root, "sys/mfa/method/duo/duo", map[string]interface{}{
+		"integration_key": "ikey",
+		"secret_key":      "skey",
+		"api_hostname":    "api.duo.example.com",
+	})
+	testMFAWrite(t, c, root, "sys/mfa/login-enforcement/foo", map[string]interface{}{
+		"mfa_methods": "duo",
+		"paths":       "auth/foo/login",
+	})
+
+	id := testMFAHeld(t, login())
+	if resp, err := testMFAValidate(c, id, nil); err != nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if client.factor != "push" {
+		t.Fatalf("bad: %s", client.factor)
+	}
+
+	id = testMFAHeld(t, login())
+	if resp, err := testMFAValidate(c, id, map[string]interface{}{"duo": "123456"}); err != nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v %v", resp, err)
+	}
+	if client.factor != "passcode" {
+		t.Fatalf("bad: %s", client.factor)
+	}
+
+	client.result = "deny"
+	id = testMFAHeld(t, login())
+	if _, err := testMFAValidate(c, id, nil); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// The type of a method cannot be changed
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/webhook/duo")
+	req.Data["url"] = "https://example.com"
+	req.Data["secret"] = "foo"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestMFAEnforcement_Matches(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	if err := c.mfa.SetMethod(&MFAMethod{Name: "hook", Type: MFATypeWebhook}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	enforcement := &MFAEnforcement{
+		Name:       "foo",
+		Methods:    []string{"hook"},
+		AuthMounts: []string{"userpass/", "auth/ldap"},
+		Paths:      []string{"auth/github/login", "auth/okta/login/*"},
+	}
+	if err := c.mfa.SetEnforcement(enforcement); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for path, expected := range map[string]bool{
+		"auth/userpass/login/armon":  true,
+		"auth/userpass2/login/armon": false,
+		"auth/ldap/login/armon":      true,
+		"auth/github/login":          true,
+		"auth/github/login/foo":      false,
+		"auth/okta/login/armon":      true,
+		"auth/token/create":          false,
+	} {
+		if enforcement.matches(path) != expected {
+			t.Fatalf("bad: %s", path)
+		}
+	}
+
+	for _, bad := range []*MFAEnforcement{
+		{Name: "bad", AuthMounts: []string{"userpass"}},
+		{Name: "bad", Methods: []string{"hook"}},
+		{Name: "bad", Methods: []string{"missing"}, AuthMounts: []string{"userpass"}},
+		{Name: "bad", Methods: []string{"hook"}, Paths: []string{"sys/mounts"}},
+	} {
+		if err := c.mfa.SetEnforcement(bad); err == nil {
+			t.Fatalf("expected error: %#v", bad)
+		}
+	}
+}
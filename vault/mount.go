@@ -141,8 +141,30 @@ type MountEntry struct {
 type MountConfig struct {
 	DefaultLeaseTTL time.Duration `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"` // Override for global default
 	MaxLeaseTTL     time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`             // Override for global default
+	TokenType       string        `json:"token_type,omitempty" structs:"token_type" mapstructure:"token_type"`            // Type of tokens issued by auth mounts
+
+	// ExplicitMaxTTL hard limits the lifetime of the tokens issued by auth
+	// mounts, whatever the TTLs the backend sets
+	ExplicitMaxTTL time.Duration `json:"explicit_max_ttl,omitempty" structs:"explicit_max_ttl" mapstructure:"explicit_max_ttl"`
+
+	// ListingVisibility is whether auth mounts are listed to
+	// unauthenticated clients, such as login pages, if "unauth"
+	ListingVisibility string `json:"listing_visibility,omitempty" structs:"listing_visibility" mapstructure:"listing_visibility"`
+
+	// The number of consecutive failed logins after which the users of
+	// auth mounts are locked out, and for how long, zero meaning the
+	// defaults, if lockouts are enabled
+	LockoutThreshold int           `json:"lockout_threshold,omitempty" structs:"lockout_threshold" mapstructure:"lockout_threshold"`
+	LockoutDuration  time.Duration `json:"lockout_duration,omitempty" structs:"lockout_duration" mapstructure:"lockout_duration"`
+	LockoutEnable    bool          `json:"lockout_enable,omitempty" structs:"lockout_enable" mapstructure:"lockout_enable"`
 }
 
+// The listing visibilities of auth mounts
+const (
+	ListingVisibilityHidden = "hidden"
+	ListingVisibilityUnauth = "unauth"
+)
+
 // Returns a deep copy of the mount entry
 func (e *MountEntry) Clone() *MountEntry {
 	optClone := make(map[string]string)
@@ -197,7 +219,7 @@ func (c *Core) mount(me *MountEntry) error {
 	me.UUID = meUUID
 	view := NewBarrierView(c.barrier, backendBarrierPrefix+me.UUID+"/")
 
-	backend, err := c.newLogicalBackend(me.Type, c.mountEntrySysView(me), view, nil)
+	backend, err := c.newLogicalBackend(me.Type, c.mountEntrySysView(me), view, me.Options)
 	if err != nil {
 		return err
 	}
@@ -241,6 +263,19 @@ func (c *Core) unmount(path string) error {
 	// Store the view for this backend
 	view := c.router.MatchingStorageView(path)
 
+	if err := c.taintMount(path); err != nil {
+		return err
+	}
+
+	// Revoke all the dynamic keys, which can take longer than a request
+	// when there are many, then remove the backend
+	return c.expiration.QueueRevokePrefix(path, false, func() error {
+		return c.removeMount(path, view)
+	})
+}
+
+// taintMount is used to stop routing requests to a mount being unmounted
+func (c *Core) taintMount(path string) error {
 	c.mountsLock.Lock()
 	defer c.mountsLock.Unlock()
 
@@ -255,14 +290,13 @@ func (c *Core) unmount(path string) error {
 	}
 
 	// Invoke the rollback manager a final time
-	if err := c.rollback.Rollback(path); err != nil {
-		return err
-	}
+	return c.rollback.Rollback(path)
+}
 
-	// Revoke all the dynamic keys
-	if err := c.expiration.RevokePrefix(path); err != nil {
-		return err
-	}
+// removeMount is used to remove a tainted mount once its leases are revoked
+func (c *Core) removeMount(path string, view *BarrierView) error {
+	c.mountsLock.Lock()
+	defer c.mountsLock.Unlock()
 
 	// Unmount the backend entirely
 	if err := c.router.Unmount(path); err != nil {
@@ -391,6 +425,88 @@ func (c *Core) remount(src, dst string) error {
 	return nil
 }
 
+// upgradeMount converts a generic mount to the versioned kv backend, which
+// keeps its storage view and rewrites its secrets in the background
+func (c *Core) upgradeMount(path string) error {
+	// Ensure we end the path in a slash
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	// Verify exact match of the route
+	match := c.router.MatchingMount(path)
+	if match == "" || path != match {
+		return fmt.Errorf("no matching mount at '%s'", path)
+	}
+
+	if _, ok := c.logicalBackends["kv"]; !ok {
+		return fmt.Errorf("the kv backend is not available")
+	}
+
+	c.mountsLock.Lock()
+	defer c.mountsLock.Unlock()
+
+	var ent *MountEntry
+	for _, e := range c.mounts.Entries {
+		if e.Path == path {
+			ent = e
+			break
+		}
+	}
+	if ent == nil {
+		return fmt.Errorf("no matching mount at '%s'", path)
+	}
+	if ent.Type != "generic" {
+		return logical.CodedError(400, fmt.Sprintf("cannot upgrade mount of type '%s'", ent.Type))
+	}
+
+	// Revoke the leases of the generic backend, which the kv backend
+	// cannot revoke
+	if err := c.expiration.RevokePrefix(path); err != nil {
+		return err
+	}
+
+	// Update the mount table, recording the upgrade in the options of the
+	// mount along with its type, so that the kv backend starts the upgrade
+	// when the mount is set up if the backend cannot be created below
+	revert := func() {
+		ent.Type = "generic"
+		delete(ent.Options, "upgrade")
+	}
+	ent.Type = "kv"
+	if ent.Options == nil {
+		ent.Options = make(map[string]string)
+	}
+	ent.Options["upgrade"] = "true"
+	if err := c.persistMounts(c.mounts); err != nil {
+		revert()
+		return logical.CodedError(500, "failed to update mount table")
+	}
+
+	// Create the kv backend, which refuses to upgrade secrets conflicting
+	// with its own storage, and otherwise starts rewriting them
+	view := c.router.MatchingStorageView(path)
+	backend, err := c.newLogicalBackend("kv", c.mountEntrySysView(ent), view, ent.Options)
+	if err != nil {
+		revert()
+		if err := c.persistMounts(c.mounts); err != nil {
+			return logical.CodedError(500, "failed to update mount table")
+		}
+		return logical.CodedError(400, err.Error())
+	}
+
+	// Replace the generic backend
+	if err := c.router.Unmount(path); err != nil {
+		return err
+	}
+	if err := c.router.Mount(backend, path, ent, view); err != nil {
+		return err
+	}
+
+	c.logger.Printf("[INFO] core: upgraded '%s' to type: kv", path)
+	return nil
+}
+
 // loadMounts is invoked as part of postUnseal to load the mount table
 func (c *Core) loadMounts() error {
 	mountTable := &MountTable{}
@@ -530,7 +646,7 @@ func (c *Core) setupMounts() error {
 
 		// Initialize the backend
 		// Create the new backend
-		backend, err = c.newLogicalBackend(entry.Type, c.mountEntrySysView(entry), view, nil)
+		backend, err = c.newLogicalBackend(entry.Type, c.mountEntrySysView(entry), view, entry.Options)
 		if err != nil {
 			c.logger.Printf(
 				"[ERR] core: failed to create mount entry %s: %v",
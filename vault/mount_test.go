@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/builtin/logical/kv"
 	"github.com/hashicorp/vault/helper/compressutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -322,6 +323,105 @@ func TestCore_Remount_Protected(t *testing.T) {
 	}
 }
 
+func TestCore_UpgradeMount(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	c.logicalBackends["kv"] = kv.Factory
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/secret/upgrade")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if me := c.router.MatchingMountEntry("secret/"); me == nil || me.Type != "kv" {
+		t.Fatalf("bad: %#v", me)
+	}
+
+	// The secret is read as the first version of a key, whether it was
+	// rewritten yet or not
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/data/foo")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data["data"].(map[string]interface{})["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Only generic mounts are upgraded
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/secret/upgrade")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+// An upgrade interrupted after updating the mount table, before the kv
+// backend started it, is started when the mount is set up
+func TestCore_UpgradeMount_Interrupted(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["value"] = "bar"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Update the mount table as upgradeMount does, and crash
+	c.mountsLock.Lock()
+	for _, ent := range c.mounts.Entries {
+		if ent.Path == "secret/" {
+			ent.Type = "kv"
+			ent.Options = map[string]string{"upgrade": "true"}
+		}
+	}
+	err := c.persistMounts(c.mounts)
+	c.mountsLock.Unlock()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	conf := &CoreConfig{
+		Physical:        c.physical,
+		DisableMlock:    true,
+		LogicalBackends: map[string]logical.Factory{"kv": kv.Factory},
+	}
+	c2, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := c2.Unseal(key); err != nil || !unseal {
+		t.Fatalf("should be unsealed: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/data/foo")
+	req.ClientToken = root
+	resp, err := c2.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Data["data"].(map[string]interface{})["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestCore_UpgradeMount_Protected(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.logicalBackends["kv"] = kv.Factory
+	err := c.upgradeMount("cubbyhole")
+	if err == nil || err.Error() != "cannot upgrade mount of type 'cubbyhole'" {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 func TestDefaultMountTable(t *testing.T) {
 	table := defaultMountTable()
 	verifyDefaultTable(t, table)
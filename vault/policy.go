@@ -1,12 +1,17 @@
 package vault
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/duration"
 )
 
 const (
@@ -18,6 +23,7 @@ const (
 	ListCapability   = "list"
 	SudoCapability   = "sudo"
 	RootCapability   = "root"
+	PatchCapability  = "patch"
 
 	// Backwards compatibility
 	OldDenyPathPolicy  = "deny"
@@ -34,6 +40,7 @@ const (
 	DeleteCapabilityInt
 	ListCapabilityInt
 	SudoCapabilityInt
+	PatchCapabilityInt
 )
 
 var (
@@ -45,6 +52,7 @@ var (
 		DeleteCapability: DeleteCapabilityInt,
 		ListCapability:   ListCapabilityInt,
 		SudoCapability:   SudoCapabilityInt,
+		PatchCapability:  PatchCapabilityInt,
 	}
 )
 
@@ -54,6 +62,48 @@ type Policy struct {
 	Name  string              `hcl:"name"`
 	Paths []*PathCapabilities `hcl:"-"`
 	Raw   string
+
+	// Syntax is the syntax Raw is written in, PolicySyntaxHCL2 if the
+	// rules were given as HCL2, or empty for HCL1
+	Syntax string `hcl:"-"`
+
+	// Metadata is free-form information about the policy, such as its
+	// description or owner. It is stored alongside the rules.
+	Metadata map[string]string `hcl:"-"`
+
+	// ExpireTime is when the policy stops granting anything, if set. If
+	// DeleteOnExpire is set, the policy is also deleted at that time.
+	ExpireTime     time.Time `hcl:"-"`
+	DeleteOnExpire bool      `hcl:"-"`
+
+	// Shadow marks a policy that is being tried out. It grants nothing,
+	// and what it would deny is recorded in the audit log rather than
+	// denied.
+	Shadow bool `hcl:"-"`
+
+	// Signature is a detached PGP signature of the rules, and SignedBy the
+	// fingerprint of the trusted key that made it, if the policy is signed.
+	Signature string `hcl:"-"`
+	SignedBy  string `hcl:"-"`
+
+	// RateLimit bounds how often each token may make requests allowed by
+	// the policy, if set
+	RateLimit *RateLimit `hcl:"-"`
+}
+
+// RateLimit bounds the rate of requests a token may make with a policy.
+type RateLimit struct {
+	// RequestsPerSecond is the sustained rate of requests allowed
+	RequestsPerSecond float64
+
+	// Burst is how many requests may be made at once before the rate
+	// applies
+	Burst int
+}
+
+// Expired returns whether the policy has an expiration time that has passed.
+func (p *Policy) Expired() bool {
+	return !p.ExpireTime.IsZero() && time.Now().After(p.ExpireTime)
 }
 
 // PathCapabilities represents a policy for a path in the namespace.
@@ -63,14 +113,64 @@ type PathCapabilities struct {
 	Capabilities       []string
 	CapabilitiesBitmap uint32 `hcl:"-"`
 	Glob               bool
+	Templated          bool `hcl:"-"`
+
+	// SegmentWildcards is set if a segment of the prefix is "+", which
+	// matches exactly one segment of a path
+	SegmentWildcards bool `hcl:"-"`
+
+	// Restrictions on the parameters of create and update requests
+	AllowedParameters  map[string][]interface{} `hcl:"allowed_parameters"`
+	DeniedParameters   map[string][]interface{} `hcl:"denied_parameters"`
+	RequiredParameters []string                 `hcl:"required_parameters"`
+
+	// Bounds on the response wrapping TTL that requests must use
+	MinWrappingTTL    time.Duration `hcl:"-"`
+	MaxWrappingTTL    time.Duration `hcl:"-"`
+	MinWrappingTTLHCL interface{}   `hcl:"min_wrapping_ttl"`
+	MaxWrappingTTLHCL interface{}   `hcl:"max_wrapping_ttl"`
+
+	// Schedule limits when the rule applies, if set. Outside of its windows
+	// the rule grants nothing.
+	Schedule     *TimeSchedule `hcl:"-"`
+	AllowedTimes []string      `hcl:"allowed_times"`
+	TimeZone     string        `hcl:"time_zone"`
+
+	// BoundNets limits the addresses the rule applies to, if set. Requests
+	// from other addresses are granted nothing.
+	BoundNets  []*net.IPNet `hcl:"-"`
+	BoundCIDRs []string     `hcl:"bound_cidrs"`
+
+	// ControlGroup requires requests to be approved before they are
+	// carried out, if set
+	ControlGroup *ControlGroup `hcl:"-"`
+}
+
+// ControlGroup requires requests to a path to be approved by a number of
+// authorizers before they are carried out.
+type ControlGroup struct {
+	// Policy is the policy authorizers must hold
+	Policy string
+
+	// Approvals is the number of authorizers that must approve
+	Approvals int
+
+	// TTL is how long a request waits for approval
+	TTL time.Duration
 }
 
 // Parse is used to parse the specified ACL rules into an
 // intermediary set of policies, before being compiled into
 // the ACL
 func Parse(rules string) (*Policy, error) {
+	return ParseSyntax(rules, "")
+}
+
+// ParseSyntax is like Parse, for rules written in the given syntax,
+// PolicySyntaxHCL or PolicySyntaxHCL2. An empty syntax is HCL1.
+func ParseSyntax(rules, syntax string) (*Policy, error) {
 	// Parse the rules
-	root, err := hcl.Parse(rules)
+	root, err := parsePolicyHCL(rules, syntax)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to parse policy: %s", err)
 	}
@@ -85,6 +185,7 @@ func Parse(rules string) (*Policy, error) {
 	valid := []string{
 		"name",
 		"path",
+		"rate_limit",
 	}
 	if err := checkHCLKeys(list, valid); err != nil {
 		return nil, fmt.Errorf("Failed to parse policy: %s", err)
@@ -93,6 +194,9 @@ func Parse(rules string) (*Policy, error) {
 	// Create the initial policy and store the raw text of the rules
 	var p Policy
 	p.Raw = rules
+	if syntax == PolicySyntaxHCL2 {
+		p.Syntax = syntax
+	}
 	if err := hcl.DecodeObject(&p, list); err != nil {
 		return nil, fmt.Errorf("Failed to parse policy: %s", err)
 	}
@@ -103,9 +207,94 @@ func Parse(rules string) (*Policy, error) {
 		}
 	}
 
+	if o := list.Filter("rate_limit"); len(o.Items) > 0 {
+		limit, err := parseRateLimit(o)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse policy: invalid rate_limit: %v", err)
+		}
+		p.RateLimit = limit
+	}
+
+	if isJSONPolicy(rules) {
+		if err := restoreJSONEmptyParameters(&p, rules); err != nil {
+			return nil, fmt.Errorf("Failed to parse policy: %s", err)
+		}
+	}
+
 	return &p, nil
 }
 
+// isJSONPolicy returns whether the rules of a policy are given in JSON rather
+// than HCL, which is how the HCL parser tells them apart as well.
+func isJSONPolicy(rules string) bool {
+	return strings.HasPrefix(strings.TrimSpace(rules), "{")
+}
+
+// jsonPathParameters holds the parameter constraints of a path in a JSON
+// policy.
+type jsonPathParameters struct {
+	AllowedParameters map[string]interface{} `json:"allowed_parameters"`
+	DeniedParameters  map[string]interface{} `json:"denied_parameters"`
+}
+
+// restoreJSONEmptyParameters adds back the parameters of JSON policies that
+// are given an empty list of values. The HCL parser drops empty lists from
+// JSON documents, but in parameter constraints they stand for any value.
+func restoreJSONEmptyParameters(p *Policy, rules string) error {
+	var doc struct {
+		Path json.RawMessage `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(rules), &doc); err != nil {
+		return err
+	}
+	if len(doc.Path) == 0 {
+		return nil
+	}
+
+	// Paths are either given as one object keyed by path, or as a list of
+	// such objects
+	var objects []map[string]jsonPathParameters
+	var single map[string]jsonPathParameters
+	if err := json.Unmarshal(doc.Path, &single); err == nil {
+		objects = append(objects, single)
+	} else if err := json.Unmarshal(doc.Path, &objects); err != nil {
+		return err
+	}
+
+	for _, object := range objects {
+		for pattern, params := range object {
+			pattern = strings.TrimPrefix(pattern, "/")
+			for _, pc := range p.Paths {
+				prefix := pc.Prefix
+				if pc.Glob {
+					prefix += "*"
+				}
+				if prefix != pattern {
+					continue
+				}
+				pc.AllowedParameters = addEmptyParameters(pc.AllowedParameters, params.AllowedParameters)
+				pc.DeniedParameters = addEmptyParameters(pc.DeniedParameters, params.DeniedParameters)
+			}
+		}
+	}
+	return nil
+}
+
+// addEmptyParameters adds the parameters given an empty list of values in a
+// JSON policy to the parsed parameters.
+func addEmptyParameters(parsed map[string][]interface{}, raw map[string]interface{}) map[string][]interface{} {
+	for key, value := range raw {
+		if values, ok := value.([]interface{}); !ok || len(values) > 0 {
+			continue
+		}
+		if parsed == nil {
+			parsed = make(map[string][]interface{})
+		}
+		parsed[strings.ToLower(key)] = []interface{}{}
+	}
+	return parsed
+}
+
 func parsePaths(result *Policy, list *ast.ObjectList) error {
 	paths := make([]*PathCapabilities, 0, len(list.Items))
 	for _, item := range list.Items {
@@ -117,6 +306,15 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 		valid := []string{
 			"policy",
 			"capabilities",
+			"allowed_parameters",
+			"denied_parameters",
+			"required_parameters",
+			"min_wrapping_ttl",
+			"max_wrapping_ttl",
+			"allowed_times",
+			"time_zone",
+			"bound_cidrs",
+			"control_group",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
@@ -139,6 +337,19 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 			pc.Glob = true
 		}
 
+		// Check for single segment wildcards
+		if hasSegmentWildcards(pc.Prefix) {
+			pc.SegmentWildcards = true
+		}
+
+		// Check for placeholders to be resolved when the ACL is built
+		if isTemplatedPath(pc.Prefix) {
+			if err := validateTemplatedPath(pc.Prefix); err != nil {
+				return fmt.Errorf("path %q: %v", key, err)
+			}
+			pc.Templated = true
+		}
+
 		// Map old-style policies into capabilities
 		if len(pc.Policy) > 0 {
 			switch pc.Policy {
@@ -164,7 +375,7 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 				pc.Capabilities = []string{DenyCapability}
 				pc.CapabilitiesBitmap = DenyCapabilityInt
 				goto PathFinished
-			case CreateCapability, ReadCapability, UpdateCapability, DeleteCapability, ListCapability, SudoCapability:
+			case CreateCapability, ReadCapability, UpdateCapability, PatchCapability, DeleteCapability, ListCapability, SudoCapability:
 				pc.CapabilitiesBitmap |= cap2Int[cap]
 			default:
 				return fmt.Errorf("path %q: invalid capability '%s'", key, cap)
@@ -173,6 +384,59 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 
 	PathFinished:
 
+		// Parameter names are matched case-insensitively
+		pc.AllowedParameters = lowerParameterKeys(pc.AllowedParameters)
+		pc.DeniedParameters = lowerParameterKeys(pc.DeniedParameters)
+		for i, param := range pc.RequiredParameters {
+			pc.RequiredParameters[i] = strings.ToLower(param)
+		}
+
+		if pc.MinWrappingTTLHCL != nil {
+			dur, err := parseDuration(pc.MinWrappingTTLHCL)
+			if err != nil {
+				return fmt.Errorf("path %q: invalid min_wrapping_ttl: %v", key, err)
+			}
+			pc.MinWrappingTTL = dur
+		}
+		if pc.MaxWrappingTTLHCL != nil {
+			dur, err := parseDuration(pc.MaxWrappingTTLHCL)
+			if err != nil {
+				return fmt.Errorf("path %q: invalid max_wrapping_ttl: %v", key, err)
+			}
+			pc.MaxWrappingTTL = dur
+		}
+		if pc.MaxWrappingTTL > 0 && pc.MinWrappingTTL > pc.MaxWrappingTTL {
+			return fmt.Errorf("path %q: max_wrapping_ttl cannot be less than min_wrapping_ttl", key)
+		}
+
+		if len(pc.AllowedTimes) > 0 {
+			schedule, err := ParseTimeSchedule(pc.AllowedTimes, pc.TimeZone)
+			if err != nil {
+				return fmt.Errorf("path %q: %v", key, err)
+			}
+			pc.Schedule = schedule
+		} else if pc.TimeZone != "" {
+			return fmt.Errorf("path %q: time_zone requires allowed_times", key)
+		}
+
+		for _, raw := range pc.BoundCIDRs {
+			_, cidr, err := net.ParseCIDR(raw)
+			if err != nil {
+				return fmt.Errorf("path %q: invalid bound_cidrs entry '%s'", key, raw)
+			}
+			pc.BoundNets = append(pc.BoundNets, cidr)
+		}
+
+		if obj, ok := item.Val.(*ast.ObjectType); ok {
+			if o := obj.List.Filter("control_group"); len(o.Items) > 0 {
+				cg, err := parseControlGroup(o)
+				if err != nil {
+					return fmt.Errorf("path %q: invalid control_group: %v", key, err)
+				}
+				pc.ControlGroup = cg
+			}
+		}
+
 		paths = append(paths, &pc)
 	}
 
@@ -180,6 +444,141 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseControlGroup(list *ast.ObjectList) (*ControlGroup, error) {
+	if len(list.Items) > 1 {
+		return nil, fmt.Errorf("only one control_group may be given")
+	}
+	item := list.Items[0]
+	if err := checkHCLKeys(item.Val, []string{"policy", "approvals", "ttl"}); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		Policy    string
+		Approvals int
+		TTL       interface{} `hcl:"ttl"`
+	}
+	if err := hcl.DecodeObject(&raw, item.Val); err != nil {
+		return nil, err
+	}
+
+	cg := &ControlGroup{
+		Policy:    raw.Policy,
+		Approvals: raw.Approvals,
+		TTL:       defaultControlGroupTTL,
+	}
+	if cg.Policy == "" {
+		return nil, fmt.Errorf("policy is required")
+	}
+	if cg.Policy == "root" {
+		return nil, fmt.Errorf("authorizers cannot be required to hold the root policy")
+	}
+	switch {
+	case cg.Approvals < 0:
+		return nil, fmt.Errorf("approvals cannot be negative")
+	case cg.Approvals == 0:
+		cg.Approvals = 1
+	}
+	if raw.TTL != nil {
+		ttl, err := parseDuration(raw.TTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ttl: %v", err)
+		}
+		if ttl > 0 {
+			cg.TTL = ttl
+		}
+	}
+	return cg, nil
+}
+
+func parseRateLimit(list *ast.ObjectList) (*RateLimit, error) {
+	if len(list.Items) > 1 {
+		return nil, fmt.Errorf("only one rate_limit may be given")
+	}
+	item := list.Items[0]
+	if err := checkHCLKeys(item.Val, []string{"rps", "burst"}); err != nil {
+		return nil, err
+	}
+
+	var raw struct {
+		RPS   interface{} `hcl:"rps"`
+		Burst int         `hcl:"burst"`
+	}
+	if err := hcl.DecodeObject(&raw, item.Val); err != nil {
+		return nil, err
+	}
+
+	limit := &RateLimit{
+		Burst: raw.Burst,
+	}
+	switch v := raw.RPS.(type) {
+	case int:
+		limit.RequestsPerSecond = float64(v)
+	case float64:
+		limit.RequestsPerSecond = v
+	case nil:
+	default:
+		return nil, fmt.Errorf("rps must be a number")
+	}
+	if limit.RequestsPerSecond <= 0 {
+		return nil, fmt.Errorf("rps must be greater than zero")
+	}
+	switch {
+	case limit.Burst < 0:
+		return nil, fmt.Errorf("burst cannot be negative")
+	case limit.Burst == 0:
+		// By default a second's worth of requests may be made at once
+		limit.Burst = int(math.Ceil(limit.RequestsPerSecond))
+	}
+	return limit, nil
+}
+
+// parseDuration parses a TTL given either as a duration string or
+// a number of seconds.
+func parseDuration(raw interface{}) (time.Duration, error) {
+	var dur time.Duration
+	switch v := raw.(type) {
+	case string:
+		var err error
+		dur, err = duration.ParseDurationSecond(v)
+		if err != nil {
+			return 0, err
+		}
+	case int:
+		dur = time.Duration(v) * time.Second
+	case float64:
+		dur = time.Duration(v) * time.Second
+	default:
+		return 0, fmt.Errorf("unsupported type %T", raw)
+	}
+	if dur < 0 {
+		return 0, fmt.Errorf("cannot be negative")
+	}
+	return dur, nil
+}
+
+// hasSegmentWildcards returns whether any segment of the given policy path
+// is the "+" wildcard.
+func hasSegmentWildcards(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "+" {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerParameterKeys(params map[string][]interface{}) map[string][]interface{} {
+	if len(params) == 0 {
+		return nil
+	}
+	ret := make(map[string][]interface{}, len(params))
+	for k, v := range params {
+		ret[strings.ToLower(k)] = v
+	}
+	return ret
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
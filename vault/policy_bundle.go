@@ -0,0 +1,272 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+const (
+	// policyBundleVersion is the version of the policy bundle format
+	policyBundleVersion = 1
+
+	// Prefixes of the signatures of policy bundles
+	policyBundleDigestPrefix = "sha256:"
+	policyBundleHMACPrefix   = "hmac-sha256:"
+
+	// Ways of resolving conflicts with existing policies on import
+	PolicyImportConflictFail      = "fail"
+	PolicyImportConflictSkip      = "skip"
+	PolicyImportConflictOverwrite = "overwrite"
+)
+
+// PolicyBundle is a set of policies exported from one Vault to be imported
+// into another.
+type PolicyBundle struct {
+	Version  int                           `json:"version" structs:"version" mapstructure:"version"`
+	Policies map[string]*PolicyBundleEntry `json:"policies" structs:"policies" mapstructure:"policies"`
+
+	// Signature is either a SHA-256 digest of the policies, which detects
+	// corruption, or an HMAC of them if a signing key was given on export.
+	Signature string `json:"signature" structs:"signature" mapstructure:"signature"`
+}
+
+// PolicyBundleEntry is a single policy in a bundle
+type PolicyBundleEntry struct {
+	Rules    string            `json:"rules" structs:"rules" mapstructure:"rules"`
+	Metadata map[string]string `json:"metadata" structs:"metadata" mapstructure:"metadata"`
+
+	// Syntax is the syntax of the rules, if they are not HCL1
+	Syntax string `json:"syntax,omitempty" structs:"syntax,omitempty" mapstructure:"syntax"`
+
+	// Signature is the PGP signature of the rules, if the policy is signed
+	Signature string `json:"signature,omitempty" structs:"signature,omitempty" mapstructure:"signature"`
+}
+
+// PolicyImportResult lists what happened to each policy of an imported bundle
+type PolicyImportResult struct {
+	Imported  []string
+	Unchanged []string
+	Skipped   []string
+}
+
+// sign sets the signature of the bundle, using an HMAC if a key is given
+func (b *PolicyBundle) sign(key string) error {
+	sig, err := b.signature(key)
+	if err != nil {
+		return err
+	}
+	b.Signature = sig
+	return nil
+}
+
+// verify checks the signature of the bundle. If the bundle was signed with a
+// key, the same key must be given.
+func (b *PolicyBundle) verify(key string) error {
+	switch {
+	case strings.HasPrefix(b.Signature, policyBundleHMACPrefix):
+		if key == "" {
+			return fmt.Errorf("bundle is signed; a signing key is required")
+		}
+	case strings.HasPrefix(b.Signature, policyBundleDigestPrefix):
+		if key != "" {
+			return fmt.Errorf("bundle is not signed with a key")
+		}
+	default:
+		return fmt.Errorf("bundle has no valid signature")
+	}
+
+	expected, err := b.signature(key)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(expected), []byte(b.Signature)) {
+		return fmt.Errorf("bundle signature does not match")
+	}
+	return nil
+}
+
+func (b *PolicyBundle) signature(key string) (string, error) {
+	// Map keys are sorted when encoding, so this is stable
+	payload, err := json.Marshal(b.Policies)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode policies: %v", err)
+	}
+
+	if key == "" {
+		sum := sha256.Sum256(payload)
+		return policyBundleDigestPrefix + hex.EncodeToString(sum[:]), nil
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return policyBundleHMACPrefix + hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ExportPolicies returns a signed bundle of the named policies, or of all
+// policies that can be written if no names are given.
+func (ps *PolicyStore) ExportPolicies(names []string, key string) (*PolicyBundle, error) {
+	all := len(names) == 0
+	if all {
+		var err error
+		names, err = ps.ListPolicies()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	bundle := &PolicyBundle{
+		Version:  policyBundleVersion,
+		Policies: make(map[string]*PolicyBundleEntry, len(names)),
+	}
+	policies, err := ps.GetPolicies(names)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if strutil.StrListContains(immutablePolicies, name) {
+			if all {
+				continue
+			}
+			return nil, fmt.Errorf("cannot export %s policy", name)
+		}
+
+		policy := policies[i]
+		if policy == nil {
+			return nil, fmt.Errorf("policy '%s' not found", name)
+		}
+		bundle.Policies[name] = &PolicyBundleEntry{
+			Rules:     policy.Raw,
+			Syntax:    policy.Syntax,
+			Metadata:  policy.Metadata,
+			Signature: policy.Signature,
+		}
+	}
+
+	if err := bundle.sign(key); err != nil {
+		return nil, err
+	}
+	return bundle, nil
+}
+
+// ImportPolicies writes the policies of a bundle after checking its
+// signature. Every policy is parsed and checked for conflicts before any is
+// written, and policies that were already written are restored if a later
+// write fails, so either all policies are imported or none are.
+func (ps *PolicyStore) ImportPolicies(bundle *PolicyBundle, key, conflict string) (*PolicyImportResult, error) {
+	if bundle.Version != policyBundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	switch conflict {
+	case PolicyImportConflictFail, PolicyImportConflictSkip, PolicyImportConflictOverwrite:
+	default:
+		return nil, fmt.Errorf("invalid conflict resolution '%s'", conflict)
+	}
+	if err := bundle.verify(key); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(bundle.Policies))
+	for name := range bundle.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	existing, err := ps.GetPolicies(names)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse every policy and sort out conflicts before writing anything
+	var errs error
+	result := &PolicyImportResult{}
+	var toWrite []*Policy
+	var previous []*Policy
+	for i, name := range names {
+		if name != strings.ToLower(name) {
+			errs = multierror.Append(errs, fmt.Errorf("policy '%s': names must be lowercase", name))
+			continue
+		}
+		if strutil.StrListContains(immutablePolicies, name) {
+			errs = multierror.Append(errs, fmt.Errorf("cannot update %s policy", name))
+			continue
+		}
+
+		entry := bundle.Policies[name]
+		if entry == nil {
+			errs = multierror.Append(errs, fmt.Errorf("policy '%s': missing rules", name))
+			continue
+		}
+		policy, err := ParseSyntax(entry.Rules, entry.Syntax)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("policy '%s': %v", name, err))
+			continue
+		}
+		policy.Name = name
+		policy.Signature = entry.Signature
+		if len(entry.Metadata) > 0 {
+			policy.Metadata = entry.Metadata
+		}
+
+		if current := existing[i]; current != nil {
+			if current.Raw == policy.Raw && current.Signature == policy.Signature && reflect.DeepEqual(current.Metadata, policy.Metadata) {
+				result.Unchanged = append(result.Unchanged, name)
+				continue
+			}
+			switch conflict {
+			case PolicyImportConflictFail:
+				errs = multierror.Append(errs, fmt.Errorf("policy '%s' already exists", name))
+				continue
+			case PolicyImportConflictSkip:
+				result.Skipped = append(result.Skipped, name)
+				continue
+			}
+		}
+
+		toWrite = append(toWrite, policy)
+		previous = append(previous, existing[i])
+	}
+	if errs != nil {
+		return nil, errs
+	}
+
+	for i, policy := range toWrite {
+		if err := ps.SetPolicy(policy); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to import policy '%s': %v", policy.Name, err))
+
+			// Put back the policies that were already written
+			for j := i - 1; j >= 0; j-- {
+				if err := ps.restorePolicy(toWrite[j].Name, previous[j]); err != nil {
+					errs = multierror.Append(errs, err)
+				}
+			}
+			return nil, errs
+		}
+		result.Imported = append(result.Imported, policy.Name)
+	}
+
+	return result, nil
+}
+
+// restorePolicy puts back the previous version of a policy, deleting it if
+// it did not exist before.
+func (ps *PolicyStore) restorePolicy(name string, previous *Policy) error {
+	var err error
+	if previous == nil {
+		err = ps.DeletePolicy(name)
+	} else {
+		err = ps.SetPolicy(previous)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore policy '%s': %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyStore_ExportImport(t *testing.T) {
+	source := mockPolicyStore(t)
+	for _, raw := range []string{aclPolicy, aclPolicy2} {
+		policy, _ := Parse(raw)
+		policy.Metadata = map[string]string{"owner": policy.Name + "-team"}
+		if err := source.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	bundle, err := source.ExportPolicies(nil, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(bundle.Policies) != 2 || bundle.Policies["dev"] == nil || bundle.Policies["ops"] == nil {
+		t.Fatalf("bad: %#v", bundle.Policies)
+	}
+	if !strings.HasPrefix(bundle.Signature, policyBundleDigestPrefix) {
+		t.Fatalf("bad signature: %s", bundle.Signature)
+	}
+
+	dest := mockPolicyStore(t)
+	result, err := dest.ImportPolicies(bundle, "", PolicyImportConflictFail)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(result.Imported, []string{"dev", "ops"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	p, err := dest.GetPolicy("ops")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Raw != aclPolicy2 || p.Metadata["owner"] != "ops-team" {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	// Importing again changes nothing
+	result, err = dest.ImportPolicies(bundle, "", PolicyImportConflictFail)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(result.Imported) != 0 || !reflect.DeepEqual(result.Unchanged, []string{"dev", "ops"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestPolicyStore_ImportConflicts(t *testing.T) {
+	source := mockPolicyStore(t)
+	for _, raw := range []string{aclPolicy, aclPolicy2} {
+		policy, _ := Parse(raw)
+		if err := source.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	bundle, err := source.ExportPolicies([]string{"dev", "ops"}, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	dest := mockPolicyStore(t)
+	existing, _ := Parse(aclPolicy)
+	existing.Name = "ops"
+	if err := dest.SetPolicy(existing); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Nothing is written if a policy conflicts
+	_, err = dest.ImportPolicies(bundle, "", PolicyImportConflictFail)
+	if err == nil || !strings.Contains(err.Error(), "policy 'ops' already exists") {
+		t.Fatalf("bad: %v", err)
+	}
+	if p, _ := dest.GetPolicy("dev"); p != nil {
+		t.Fatalf("unexpected policy: %#v", p)
+	}
+
+	result, err := dest.ImportPolicies(bundle, "", PolicyImportConflictSkip)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(result.Imported, []string{"dev"}) || !reflect.DeepEqual(result.Skipped, []string{"ops"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if p, _ := dest.GetPolicy("ops"); p.Raw != aclPolicy {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	result, err = dest.ImportPolicies(bundle, "", PolicyImportConflictOverwrite)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(result.Imported, []string{"ops"}) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if p, _ := dest.GetPolicy("ops"); p.Raw != aclPolicy2 {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	// A bad policy prevents the whole bundle from being imported
+	dest = mockPolicyStore(t)
+	bundle.Policies["bad"] = &PolicyBundleEntry{Rules: `path "foo" { capabilities = ["banana"] }`}
+	bundle.sign("")
+	if _, err := dest.ImportPolicies(bundle, "", PolicyImportConflictFail); err == nil {
+		t.Fatalf("expected error")
+	}
+	if p, _ := dest.GetPolicy("dev"); p != nil {
+		t.Fatalf("unexpected policy: %#v", p)
+	}
+}
+
+func TestPolicyStore_ImportSignature(t *testing.T) {
+	source := mockPolicyStore(t)
+	policy, _ := Parse(aclPolicy)
+	if err := source.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	bundle, err := source.ExportPolicies(nil, "secret-key")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(bundle.Signature, policyBundleHMACPrefix) {
+		t.Fatalf("bad signature: %s", bundle.Signature)
+	}
+
+	dest := mockPolicyStore(t)
+	for _, key := range []string{"", "wrong-key"} {
+		if _, err := dest.ImportPolicies(bundle, key, PolicyImportConflictFail); err == nil {
+			t.Fatalf("expected error with key %q", key)
+		}
+	}
+
+	// Tampering is detected
+	bundle.Policies["dev"].Rules = `path "*" { policy = "sudo" }`
+	if _, err := dest.ImportPolicies(bundle, "secret-key", PolicyImportConflictFail); err == nil {
+		t.Fatalf("expected error")
+	}
+	bundle.Policies["dev"].Rules = aclPolicy
+
+	if _, err := dest.ImportPolicies(bundle, "secret-key", PolicyImportConflictFail); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
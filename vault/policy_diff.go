@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// PolicyDiff is the difference between the path rules of two versions of a
+// policy
+type PolicyDiff struct {
+	Added   []*PolicyPathDiff
+	Removed []*PolicyPathDiff
+	Changed []*PolicyPathDiff
+}
+
+// Empty returns whether the two versions grant the same
+func (d *PolicyDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// PolicyPathDiff describes how the rules for a path pattern differ. Added
+// and removed paths list all of their capabilities as added or removed.
+type PolicyPathDiff struct {
+	Path                string
+	AddedCapabilities   []string
+	RemovedCapabilities []string
+
+	// Settings lists the other settings of the rules that changed, such as
+	// "allowed_parameters" or "control_group"
+	Settings []string
+}
+
+// policyPathRules is what the rules of a policy set for one path pattern.
+// A policy may give the same pattern more than once, in which case the
+// capabilities are merged.
+type policyPathRules struct {
+	capabilities []string
+	settings     map[string][]interface{}
+}
+
+// policyPathSettings returns the settings of a rule other than its
+// capabilities, by the name used in policies.
+func policyPathSettings(pc *PathCapabilities) map[string]interface{} {
+	return map[string]interface{}{
+		"allowed_parameters":  pc.AllowedParameters,
+		"denied_parameters":   pc.DeniedParameters,
+		"required_parameters": pc.RequiredParameters,
+		"min_wrapping_ttl":    pc.MinWrappingTTL,
+		"max_wrapping_ttl":    pc.MaxWrappingTTL,
+		"allowed_times":       pc.AllowedTimes,
+		"time_zone":           pc.TimeZone,
+		"bound_cidrs":         pc.BoundCIDRs,
+		"control_group":       pc.ControlGroup,
+	}
+}
+
+// policyRulesByPath groups the rules of a policy by path pattern
+func policyRulesByPath(p *Policy) map[string]*policyPathRules {
+	ret := make(map[string]*policyPathRules)
+	if p == nil {
+		return ret
+	}
+
+	for _, pc := range p.Paths {
+		pattern := pc.Prefix
+		if pc.Glob {
+			pattern += "*"
+		}
+
+		rules, ok := ret[pattern]
+		if !ok {
+			rules = &policyPathRules{
+				settings: make(map[string][]interface{}),
+			}
+			ret[pattern] = rules
+		}
+		rules.capabilities = strutil.RemoveDuplicates(append(rules.capabilities, pc.Capabilities...))
+		for name, value := range policyPathSettings(pc) {
+			// Only settings that are given are compared, so that splitting
+			// a pattern into several rules does not show as a change
+			if reflect.DeepEqual(value, reflect.Zero(reflect.TypeOf(value)).Interface()) {
+				continue
+			}
+			rules.settings[name] = append(rules.settings[name], value)
+		}
+	}
+	return ret
+}
+
+// DiffPolicies compares the path rules of a policy with a candidate version
+// of it. Either may be nil, as when the policy does not exist yet.
+func DiffPolicies(current, candidate *Policy) *PolicyDiff {
+	before := policyRulesByPath(current)
+	after := policyRulesByPath(candidate)
+
+	patterns := make([]string, 0, len(before)+len(after))
+	for pattern := range before {
+		patterns = append(patterns, pattern)
+	}
+	for pattern := range after {
+		if _, ok := before[pattern]; !ok {
+			patterns = append(patterns, pattern)
+		}
+	}
+	sort.Strings(patterns)
+
+	diff := &PolicyDiff{}
+	for _, pattern := range patterns {
+		oldRules, hadOld := before[pattern]
+		newRules, hasNew := after[pattern]
+		switch {
+		case !hadOld:
+			diff.Added = append(diff.Added, &PolicyPathDiff{
+				Path:              pattern,
+				AddedCapabilities: newRules.capabilities,
+			})
+		case !hasNew:
+			diff.Removed = append(diff.Removed, &PolicyPathDiff{
+				Path:                pattern,
+				RemovedCapabilities: oldRules.capabilities,
+			})
+		default:
+			pathDiff := &PolicyPathDiff{
+				Path:                pattern,
+				AddedCapabilities:   missingStrings(newRules.capabilities, oldRules.capabilities),
+				RemovedCapabilities: missingStrings(oldRules.capabilities, newRules.capabilities),
+			}
+			for name := range policyPathSettings(&PathCapabilities{}) {
+				if !reflect.DeepEqual(newRules.settings[name], oldRules.settings[name]) {
+					pathDiff.Settings = append(pathDiff.Settings, name)
+				}
+			}
+			sort.Strings(pathDiff.Settings)
+
+			if len(pathDiff.AddedCapabilities) > 0 || len(pathDiff.RemovedCapabilities) > 0 || len(pathDiff.Settings) > 0 {
+				diff.Changed = append(diff.Changed, pathDiff)
+			}
+		}
+	}
+	return diff
+}
+
+// missingStrings returns the items of a that are not in b
+func missingStrings(a, b []string) []string {
+	var ret []string
+	for _, item := range a {
+		if !strutil.StrListContains(b, item) {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
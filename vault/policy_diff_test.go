@@ -0,0 +1,83 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	current, err := Parse(`
+path "secret/app/*" {
+	capabilities = ["read", "list"]
+}
+path "secret/old" {
+	capabilities = ["read"]
+}
+path "sys/mounts" {
+	capabilities = ["read"]
+}
+path "auth/token/create" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"policies" = ["app"]
+	}
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	candidate, err := Parse(`
+path "secret/app/*" {
+	capabilities = ["read", "update"]
+}
+path "secret/new" {
+	capabilities = ["create", "read"]
+}
+path "sys/mounts" {
+	policy = "read"
+}
+path "sys/mounts" {
+	capabilities = ["sudo"]
+}
+path "auth/token/create" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"policies" = ["app", "admin"]
+	}
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expected := &PolicyDiff{
+		Added: []*PolicyPathDiff{
+			{Path: "secret/new", AddedCapabilities: []string{"create", "read"}},
+		},
+		Removed: []*PolicyPathDiff{
+			{Path: "secret/old", RemovedCapabilities: []string{"read"}},
+		},
+		Changed: []*PolicyPathDiff{
+			{Path: "auth/token/create", Settings: []string{"allowed_parameters"}},
+			{Path: "secret/app/*", AddedCapabilities: []string{"update"}, RemovedCapabilities: []string{"list"}},
+			{Path: "sys/mounts", AddedCapabilities: []string{"list", "sudo"}},
+		},
+	}
+	diff := DiffPolicies(current, candidate)
+	if !reflect.DeepEqual(diff, expected) {
+		t.Fatalf("bad: %#v", diff)
+	}
+	if diff.Empty() {
+		t.Fatalf("should not be empty")
+	}
+
+	if diff := DiffPolicies(current, current); !diff.Empty() {
+		t.Fatalf("bad: %#v", diff)
+	}
+
+	// Everything is added to a policy that does not exist
+	diff = DiffPolicies(nil, candidate)
+	if len(diff.Added) != 4 || len(diff.Removed) != 0 || len(diff.Changed) != 0 {
+		t.Fatalf("bad: %#v", diff)
+	}
+}
@@ -0,0 +1,146 @@
+package vault
+
+import (
+	"time"
+)
+
+// RegisterPolicy schedules the deletion of the named policy at the given
+// time, replacing any deletion scheduled before. A zero time cancels the
+// deletion.
+func (m *ExpirationManager) RegisterPolicy(name string, deleteTime time.Time) {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+
+	if timer, ok := m.pendingPolicies[name]; ok {
+		timer.Stop()
+		delete(m.pendingPolicies, name)
+	}
+	if deleteTime.IsZero() {
+		return
+	}
+
+	expires := deleteTime.Sub(time.Now())
+	if expires <= 0 {
+		expires = minRevokeDelay
+	}
+	m.pendingPolicies[name] = time.AfterFunc(expires, func() {
+		m.expirePolicy(name)
+	})
+}
+
+// expirePolicy is invoked when the named policy is due to be deleted
+func (m *ExpirationManager) expirePolicy(name string) {
+	// Clear from the pending deletions
+	m.pendingLock.Lock()
+	delete(m.pendingPolicies, name)
+	m.pendingLock.Unlock()
+
+	for attempt := uint(0); attempt < maxRevokeAttempts; attempt++ {
+		err := m.deleteExpiredPolicy(name)
+		if err == nil {
+			return
+		}
+		m.logger.Printf("[ERR] expire: failed to delete policy '%s': %v", name, err)
+		time.Sleep((1 << attempt) * revokeRetryBase)
+	}
+	m.logger.Printf("[ERR] expire: maximum attempts to delete policy '%s' reached", name)
+}
+
+// deleteExpiredPolicy deletes the named policy if it is still set to be
+// deleted once expired, as it may have been updated since it was scheduled.
+func (m *ExpirationManager) deleteExpiredPolicy(name string) error {
+	policy, err := m.policyStore.GetPolicy(name)
+	if err != nil {
+		return err
+	}
+	if policy == nil || !policy.DeleteOnExpire || !policy.Expired() {
+		return nil
+	}
+
+	if err := m.policyStore.DeletePolicy(name); err != nil {
+		return err
+	}
+	m.logger.Printf("[INFO] expire: deleted expired policy '%s'", name)
+	return nil
+}
+
+// RegisterDeletedPolicy schedules the purge of the named deleted policy at
+// the given time, replacing any purge scheduled before. A zero time cancels
+// the purge.
+func (m *ExpirationManager) RegisterDeletedPolicy(name string, purgeTime time.Time) {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+
+	if timer, ok := m.pendingDeletedPolicies[name]; ok {
+		timer.Stop()
+		delete(m.pendingDeletedPolicies, name)
+	}
+	if purgeTime.IsZero() {
+		return
+	}
+
+	expires := purgeTime.Sub(time.Now())
+	if expires <= 0 {
+		expires = minRevokeDelay
+	}
+	m.pendingDeletedPolicies[name] = time.AfterFunc(expires, func() {
+		m.purgeDeletedPolicy(name)
+	})
+}
+
+// purgeDeletedPolicy is invoked when the named deleted policy can no longer
+// be restored
+func (m *ExpirationManager) purgeDeletedPolicy(name string) {
+	m.pendingLock.Lock()
+	delete(m.pendingDeletedPolicies, name)
+	m.pendingLock.Unlock()
+
+	for attempt := uint(0); attempt < maxRevokeAttempts; attempt++ {
+		err := m.policyStore.purgeDeletedPolicy(name)
+		if err == nil {
+			return
+		}
+		m.logger.Printf("[ERR] expire: failed to purge deleted policy '%s': %v", name, err)
+		time.Sleep((1 << attempt) * revokeRetryBase)
+	}
+	m.logger.Printf("[ERR] expire: maximum attempts to purge deleted policy '%s' reached", name)
+}
+
+// restorePolicies schedules the deletion of the policies that are set to be
+// deleted once expired, and the purge of deleted policies. This is used
+// after starting the vault.
+func (m *ExpirationManager) restorePolicies() error {
+	names, err := m.policyStore.ListPolicies()
+	if err != nil {
+		return err
+	}
+	policies, err := m.policyStore.GetPolicies(names)
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	for _, policy := range policies {
+		if policy == nil || !policy.DeleteOnExpire || policy.ExpireTime.IsZero() {
+			continue
+		}
+		m.RegisterPolicy(policy.Name, policy.ExpireTime)
+		restored++
+	}
+	if restored > 0 {
+		m.logger.Printf("[INFO] expire: restored %d policy expirations", restored)
+	}
+
+	// Deleted policies are purged once their retention passes
+	if err := m.policyStore.purgeDeletedPolicies(); err != nil {
+		return err
+	}
+	deleted, err := m.policyStore.ListDeletedPolicies()
+	if err != nil {
+		return err
+	}
+	for _, policy := range deleted {
+		m.RegisterDeletedPolicy(policy.Name, policy.PurgeTime)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiration_RegisterPolicy(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	for _, raw := range []string{aclPolicy, aclPolicy2} {
+		policy, _ := Parse(raw)
+		policy.ExpireTime = time.Now().Add(100 * time.Millisecond)
+		policy.DeleteOnExpire = true
+		if err := c.policyStore.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Updating a policy so it is kept cancels its deletion
+	ops, _ := c.policyStore.GetPolicy("ops")
+	ops.DeleteOnExpire = false
+	if err := c.policyStore.SetPolicy(ops); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	dev, err := c.policyStore.GetPolicy("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if dev != nil {
+		t.Fatalf("expected policy to be deleted: %#v", dev)
+	}
+
+	ops, err = c.policyStore.GetPolicy("ops")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ops == nil || !ops.Expired() {
+		t.Fatalf("bad: %#v", ops)
+	}
+}
+
+func TestExpiration_RestorePolicies(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	policy, _ := Parse(aclPolicy)
+	policy.ExpireTime = time.Now().Add(time.Hour)
+	policy.DeleteOnExpire = true
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	exp := c.expiration
+	exp.Stop()
+	if len(exp.pendingPolicies) != 0 {
+		t.Fatalf("bad: %#v", exp.pendingPolicies)
+	}
+
+	if err := exp.restorePolicies(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := exp.pendingPolicies["dev"]; !ok || len(exp.pendingPolicies) != 1 {
+		t.Fatalf("bad: %#v", exp.pendingPolicies)
+	}
+}
+
+func TestExpiration_RegisterDeletedPolicy(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	if err := c.policyStore.SetTrashConfig(&PolicyTrashConfig{Retention: 100 * time.Millisecond}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, raw := range []string{aclPolicy, aclPolicy2} {
+		policy, _ := Parse(raw)
+		if err := c.policyStore.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := c.policyStore.DeletePolicy(policy.Name); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Restoring a policy cancels its purge
+	if err := c.policyStore.RestorePolicy("ops"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c.expiration.pendingLock.Lock()
+	_, ok := c.expiration.pendingDeletedPolicies["ops"]
+	c.expiration.pendingLock.Unlock()
+	if ok {
+		t.Fatalf("expected purge to be cancelled")
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	out, err := c.policyStore.trashView.Get(policyTrashDeletedPrefix + "dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out != nil {
+		t.Fatalf("expected deleted policy to be purged: %#v", out)
+	}
+	if ops, _ := c.policyStore.GetPolicy("ops"); ops == nil {
+		t.Fatalf("expected policy to be restored")
+	}
+}
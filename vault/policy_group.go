@@ -0,0 +1,147 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// PolicyGroup is a named set of policies. A token given the name of a group
+// gets the group's policies, as they are when the token is used.
+type PolicyGroup struct {
+	Name     string   `json:"name"`
+	Policies []string `json:"policies"`
+}
+
+// SetGroup is used to create or update the given policy group
+func (ps *PolicyStore) SetGroup(g *PolicyGroup) error {
+	defer metrics.MeasureSince([]string{"policy", "set_group"}, time.Now())
+	if g.Name == "" {
+		return fmt.Errorf("group name missing")
+	}
+	if g.Name == "root" || g.Name == "default" || strutil.StrListContains(immutablePolicies, g.Name) {
+		return fmt.Errorf("cannot create a group named %s", g.Name)
+	}
+	for _, name := range g.Policies {
+		if name == "root" || strutil.StrListContains(nonAssignablePolicies, name) {
+			return fmt.Errorf("cannot add %s policy to a group", name)
+		}
+	}
+
+	// Policies and groups share names, as tokens may be given either
+	policy, err := ps.GetPolicy(g.Name)
+	if err != nil {
+		return err
+	}
+	if policy != nil {
+		return fmt.Errorf("a policy named %s exists", g.Name)
+	}
+
+	entry, err := logical.StorageEntryJSON(g.Name, g)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := ps.groupView.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist group: %v", err)
+	}
+
+	if ps.groupLRU != nil {
+		// Update the LRU cache
+		ps.groupLRU.Add(g.Name, g)
+	}
+	return nil
+}
+
+// GetGroup is used to fetch the named policy group. It returns nil if the
+// group does not exist.
+func (ps *PolicyStore) GetGroup(name string) (*PolicyGroup, error) {
+	defer metrics.MeasureSince([]string{"policy", "get_group"}, time.Now())
+	if ps.groupLRU != nil {
+		// Check for cached group
+		if raw, ok := ps.groupLRU.Get(name); ok {
+			return raw.(*PolicyGroup), nil
+		}
+	}
+
+	out, err := ps.groupView.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read group: %v", err)
+	}
+	if out == nil {
+		// Most names looked up are policies rather than groups, so cache
+		// that the group does not exist as well
+		if ps.groupLRU != nil {
+			ps.groupLRU.Add(name, (*PolicyGroup)(nil))
+		}
+		return nil, nil
+	}
+
+	group := new(PolicyGroup)
+	if err := out.DecodeJSON(group); err != nil {
+		return nil, fmt.Errorf("failed to decode group: %v", err)
+	}
+
+	if ps.groupLRU != nil {
+		// Update the LRU cache
+		ps.groupLRU.Add(name, group)
+	}
+	return group, nil
+}
+
+// ListGroups is used to list the policy groups
+func (ps *PolicyStore) ListGroups() ([]string, error) {
+	defer metrics.MeasureSince([]string{"policy", "list_groups"}, time.Now())
+	return CollectKeys(ps.groupView)
+}
+
+// DeleteGroup is used to delete the named policy group. Tokens given the
+// group lose its policies.
+func (ps *PolicyStore) DeleteGroup(name string) error {
+	defer metrics.MeasureSince([]string{"policy", "delete_group"}, time.Now())
+	if err := ps.groupView.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete group: %v", err)
+	}
+
+	if ps.groupLRU != nil {
+		// Clear the cache
+		ps.groupLRU.Remove(name)
+	}
+	return nil
+}
+
+// ExpandGroups replaces the names of policy groups with the policies in
+// them. Names that are not groups are kept, and duplicates are removed.
+// Groups do not nest, so the policies of a group are never expanded further.
+func (ps *PolicyStore) ExpandGroups(names []string) ([]string, error) {
+	expanded := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	add := func(names ...string) {
+		for _, name := range names {
+			if !seen[name] {
+				seen[name] = true
+				expanded = append(expanded, name)
+			}
+		}
+	}
+	for _, name := range names {
+		// Skip the lookup for the policies every token may have
+		if name == "root" || name == "default" {
+			add(name)
+			continue
+		}
+
+		group, err := ps.GetGroup(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get policy group '%s': %v", name, err)
+		}
+		if group == nil {
+			add(name)
+			continue
+		}
+		add(group.Policies...)
+	}
+	return expanded, nil
+}
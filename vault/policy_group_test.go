@@ -0,0 +1,121 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPolicyStore_Groups(t *testing.T) {
+	testPolicyStore_Groups(t, mockPolicyStore(t))
+	testPolicyStore_Groups(t, mockPolicyStoreNoCache(t))
+}
+
+func testPolicyStore_Groups(t *testing.T, ps *PolicyStore) {
+	for _, raw := range []string{aclPolicy, aclPolicy2} {
+		policy, _ := Parse(raw)
+		if err := ps.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Get should return nothing
+	g, err := ps.GetGroup("admins")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if g != nil {
+		t.Fatalf("bad: %#v", g)
+	}
+
+	group := &PolicyGroup{Name: "admins", Policies: []string{"dev", "ops"}}
+	if err := ps.SetGroup(group); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	g, err = ps.GetGroup("admins")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(g, group) {
+		t.Fatalf("bad: %#v", g)
+	}
+
+	groups, err := ps.ListGroups()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(groups, []string{"admins"}) {
+		t.Fatalf("bad: %#v", groups)
+	}
+
+	// Groups and policies cannot share names
+	if err := ps.SetGroup(&PolicyGroup{Name: "dev", Policies: []string{"ops"}}); err == nil {
+		t.Fatalf("expected error")
+	}
+	policy, _ := Parse(aclPolicy)
+	policy.Name = "admins"
+	if err := ps.SetPolicy(policy); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := ps.SetGroup(&PolicyGroup{Name: "sneaky", Policies: []string{"root"}}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	names, err := ps.ExpandGroups([]string{"default", "admins", "ops", "missing"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"default", "dev", "ops", "missing"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	acl, err := ps.ACL("admins")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testLayeredACL(t, acl)
+
+	if err := ps.DeleteGroup("admins"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	g, err = ps.GetGroup("admins")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if g != nil {
+		t.Fatalf("bad: %#v", g)
+	}
+}
+
+func TestCore_PolicyGroup(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	policy, _ := Parse(aclPolicy)
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.policyStore.SetGroup(&PolicyGroup{Name: "team", Policies: []string{"dev"}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	testMakeToken(t, c.tokenStore, root, "grouptoken", "", []string{"team"})
+
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "stage/foo",
+		ClientToken: "grouptoken",
+	}
+	if _, _, err := c.checkToken(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Changing the group changes what the token may do
+	if err := c.policyStore.SetGroup(&PolicyGroup{Name: "team", Policies: []string{"default"}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := c.checkToken(req); err != logical.ErrPermissionDenied {
+		t.Fatalf("err: %v", err)
+	}
+}
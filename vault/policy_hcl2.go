@@ -0,0 +1,1091 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/hcl/hcl/token"
+)
+
+const (
+	// PolicySyntaxHCL is the syntax of the rules of policies, HCL1 or its
+	// JSON form, unless another one is given
+	PolicySyntaxHCL = "hcl"
+
+	// PolicySyntaxHCL2 is HCL2 native syntax. Rules are only parsed as HCL2
+	// when it is given explicitly.
+	PolicySyntaxHCL2 = "hcl2"
+)
+
+// parsePolicyHCL parses the rules of a policy in the given syntax, HCL1 if
+// it is empty. Rules that fail to parse are never retried in the other
+// syntax, since the same rules can mean different things in each, such as
+// strings holding "${".
+func parsePolicyHCL(rules, syntax string) (*ast.File, error) {
+	switch syntax {
+	case "", PolicySyntaxHCL:
+		return hcl.Parse(rules)
+	case PolicySyntaxHCL2:
+		return parseHCL2(rules)
+	default:
+		return nil, fmt.Errorf("unknown syntax %q", syntax)
+	}
+}
+
+// parseHCL2 parses HCL2 native syntax into the HCL1 syntax tree that
+// policies are decoded from. Policies have no variables or functions, so
+// expressions are evaluated as they are parsed, and the tree holds their
+// values. Errors are *hclParser.PosError, given at the position of the
+// offending token.
+func parseHCL2(src string) (*ast.File, error) {
+	p := &hcl2Parser{
+		src:      src,
+		state:    hcl2State{line: 1, column: 1},
+		newlines: true,
+	}
+	list, err := p.parseBody(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ast.File{Node: list}, nil
+}
+
+// hcl2State is a position in the source being parsed
+type hcl2State struct {
+	offset int
+	line   int
+	column int
+}
+
+func (s hcl2State) pos() token.Pos {
+	return token.Pos{Offset: s.offset, Line: s.line, Column: s.column}
+}
+
+type hcl2TokenType int
+
+const (
+	hcl2TokenEOF hcl2TokenType = iota
+	hcl2TokenNewline
+	hcl2TokenIdent
+	hcl2TokenNumber
+	hcl2TokenQuote
+	hcl2TokenHeredoc
+	hcl2TokenPunct
+	hcl2TokenInvalid
+)
+
+// hcl2Token is a token of HCL2 native syntax. Quoted strings and heredocs
+// are templates, which are read by the parser from the end of their opening
+// token.
+type hcl2Token struct {
+	typ  hcl2TokenType
+	text string
+	pos  token.Pos
+	next hcl2State
+
+	// strip is set for heredocs opened with "<<-", whose lines are
+	// unindented
+	strip bool
+}
+
+func (t hcl2Token) is(punct string) bool {
+	return t.typ == hcl2TokenPunct && t.text == punct
+}
+
+func (t hcl2Token) describe() string {
+	switch t.typ {
+	case hcl2TokenEOF:
+		return "the end of the file"
+	case hcl2TokenNewline:
+		return "a newline"
+	case hcl2TokenQuote:
+		return "a quoted string"
+	case hcl2TokenHeredoc:
+		return "a heredoc"
+	}
+	return strconv.Quote(t.text)
+}
+
+// hcl2Punctuation lists the operators and delimiters, two-character ones
+// first so that they are preferred
+var hcl2Punctuation = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"=", ":", ",", "{", "}", "[", "]", "(", ")", "?",
+	"+", "-", "*", "/", "%", "<", ">", "!", ".",
+}
+
+// hcl2Precedence lists the binary operators from the loosest binding to
+// the tightest
+var hcl2Precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+type hcl2Parser struct {
+	src   string
+	state hcl2State
+
+	// newlines is set where newlines end arguments and attributes, and
+	// cleared within parentheses, lists and interpolations
+	newlines bool
+}
+
+// hcl2Error returns a parse error in the form HCL2 reports them, with a
+// summary of the problem followed by details
+func hcl2Error(pos token.Pos, summary, detail string, args ...interface{}) error {
+	return &hclParser.PosError{
+		Pos: pos,
+		Err: fmt.Errorf("%s; %s", summary, fmt.Sprintf(detail, args...)),
+	}
+}
+
+// advance moves past the next n bytes of the source
+func (p *hcl2Parser) advance(s hcl2State, n int) hcl2State {
+	end := s.offset + n
+	for s.offset < end {
+		r, size := utf8.DecodeRuneInString(p.src[s.offset:])
+		s.offset += size
+		if r == '\n' {
+			s.line++
+			s.column = 1
+		} else {
+			s.column++
+		}
+	}
+	return s
+}
+
+// peek returns the next token without consuming it
+func (p *hcl2Parser) peek() hcl2Token {
+	s := p.state
+	for {
+		rest := p.src[s.offset:]
+		switch {
+		case rest == "":
+			return hcl2Token{typ: hcl2TokenEOF, pos: s.pos(), next: s}
+		case rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\r':
+			s = p.advance(s, 1)
+			continue
+		case rest[0] == '#' || strings.HasPrefix(rest, "//"):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			s = p.advance(s, end)
+			continue
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return hcl2Token{typ: hcl2TokenInvalid, text: "/*", pos: s.pos(), next: s}
+			}
+			s = p.advance(s, end+4)
+			continue
+		case rest[0] == '\n':
+			if !p.newlines {
+				s = p.advance(s, 1)
+				continue
+			}
+			return hcl2Token{typ: hcl2TokenNewline, text: "\n", pos: s.pos(), next: p.advance(s, 1)}
+		}
+		return p.scan(s)
+	}
+}
+
+// scan reads the token starting at the given state
+func (p *hcl2Parser) scan(s hcl2State) hcl2Token {
+	rest := p.src[s.offset:]
+	r, size := utf8.DecodeRuneInString(rest)
+	switch {
+	case r == '"':
+		return hcl2Token{typ: hcl2TokenQuote, text: `"`, pos: s.pos(), next: p.advance(s, 1)}
+
+	case unicode.IsLetter(r) || r == '_':
+		end := size
+		for end < len(rest) {
+			r, size := utf8.DecodeRuneInString(rest[end:])
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' {
+				break
+			}
+			end += size
+		}
+		return hcl2Token{typ: hcl2TokenIdent, text: rest[:end], pos: s.pos(), next: p.advance(s, end)}
+
+	case r >= '0' && r <= '9':
+		end := scanDigits(rest, 0)
+		if end+1 < len(rest) && rest[end] == '.' && isDigit(rest[end+1]) {
+			end = scanDigits(rest, end+1)
+		}
+		if end < len(rest) && (rest[end] == 'e' || rest[end] == 'E') {
+			exp := end + 1
+			if exp < len(rest) && (rest[exp] == '+' || rest[exp] == '-') {
+				exp++
+			}
+			if exp < len(rest) && isDigit(rest[exp]) {
+				end = scanDigits(rest, exp)
+			}
+		}
+		return hcl2Token{typ: hcl2TokenNumber, text: rest[:end], pos: s.pos(), next: p.advance(s, end)}
+
+	case strings.HasPrefix(rest, "<<"):
+		end := 2
+		strip := strings.HasPrefix(rest, "<<-")
+		if strip {
+			end++
+		}
+		start := end
+		for end < len(rest) && (isDigit(rest[end]) || rest[end] == '_' || rest[end] == '-' ||
+			unicode.IsLetter(rune(rest[end]))) {
+			end++
+		}
+		marker := rest[start:end]
+		if marker == "" || !strings.HasPrefix(rest[end:], "\n") && !strings.HasPrefix(rest[end:], "\r\n") {
+			return hcl2Token{typ: hcl2TokenInvalid, text: rest[:end], pos: s.pos(), next: s}
+		}
+		return hcl2Token{typ: hcl2TokenHeredoc, text: marker, strip: strip, pos: s.pos(), next: p.advance(s, end)}
+	}
+
+	for _, punct := range hcl2Punctuation {
+		if strings.HasPrefix(rest, punct) {
+			return hcl2Token{typ: hcl2TokenPunct, text: punct, pos: s.pos(), next: p.advance(s, len(punct))}
+		}
+	}
+	return hcl2Token{typ: hcl2TokenInvalid, text: string(r), pos: s.pos(), next: s}
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func scanDigits(s string, i int) int {
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+// next consumes and returns the next token
+func (p *hcl2Parser) next() hcl2Token {
+	tok := p.peek()
+	p.state = tok.next
+	return tok
+}
+
+// expect consumes the given punctuation, or returns an error with the
+// given summary and details
+func (p *hcl2Parser) expect(punct, summary, detail string) (hcl2Token, error) {
+	tok := p.peek()
+	if !tok.is(punct) {
+		return tok, hcl2Error(tok.pos, summary, "%s", detail)
+	}
+	return p.next(), nil
+}
+
+// parseBody parses the arguments and blocks of the file, or of a block
+// opened at the given token
+func (p *hcl2Parser) parseBody(open *hcl2Token) (*ast.ObjectList, error) {
+	list := &ast.ObjectList{}
+	set := make(map[string]token.Pos)
+	for {
+		tok := p.peek()
+		switch {
+		case tok.typ == hcl2TokenNewline:
+			p.next()
+			continue
+		case tok.typ == hcl2TokenEOF && open == nil:
+			return list, nil
+		case tok.typ == hcl2TokenEOF:
+			return nil, hcl2Error(open.pos, "Unclosed configuration block",
+				"There is no closing brace for this block before the end of the file.")
+		case tok.is("}") && open != nil:
+			return list, nil
+		case tok.typ != hcl2TokenIdent:
+			return nil, hcl2Error(tok.pos, "Argument or block definition required",
+				"An argument or block definition is required here, but found %s.", tok.describe())
+		}
+
+		name := p.next()
+		key := &ast.ObjectKey{Token: token.Token{Type: token.IDENT, Text: name.text, Pos: name.pos}}
+		var item *ast.ObjectItem
+		if assign := p.peek(); assign.is("=") {
+			p.next()
+			if first, ok := set[name.text]; ok {
+				return nil, hcl2Error(name.pos, "Attribute redefined",
+					"The argument %q was already set at %s. Each argument may be set only once.", name.text, first)
+			}
+			set[name.text] = name.pos
+
+			value, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			if value.kind == hcl2Null {
+				// Null arguments are the same as unset ones
+				if err := p.endItem(open); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			node, err := value.node()
+			if err != nil {
+				return nil, err
+			}
+			item = &ast.ObjectItem{Keys: []*ast.ObjectKey{key}, Assign: assign.pos, Val: node}
+		} else {
+			var err error
+			if item, err = p.parseBlock(key); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := p.endItem(open); err != nil {
+			return nil, err
+		}
+		list.Add(item)
+	}
+}
+
+// endItem checks that an argument or block is followed by a newline, or
+// ends a block given on a single line
+func (p *hcl2Parser) endItem(open *hcl2Token) error {
+	tok := p.peek()
+	if tok.typ == hcl2TokenNewline || tok.typ == hcl2TokenEOF || tok.is("}") && open != nil {
+		return nil
+	}
+	return hcl2Error(tok.pos, "Missing newline after definition",
+		"An argument or block definition must end with a newline, but found %s.", tok.describe())
+}
+
+// parseBlock parses the labels and body of a block, given its type
+func (p *hcl2Parser) parseBlock(key *ast.ObjectKey) (*ast.ObjectItem, error) {
+	keys := []*ast.ObjectKey{key}
+	for {
+		tok := p.peek()
+		switch tok.typ {
+		case hcl2TokenIdent:
+			p.next()
+			keys = append(keys, &ast.ObjectKey{Token: token.Token{Type: token.IDENT, Text: tok.text, Pos: tok.pos}})
+			continue
+		case hcl2TokenQuote:
+			p.next()
+			label, interpolated, err := p.parseQuoted(tok)
+			if err != nil {
+				return nil, err
+			}
+			if interpolated {
+				return nil, hcl2Error(tok.pos, "Invalid block label",
+					"Block labels cannot contain interpolations.")
+			}
+			keys = append(keys, &ast.ObjectKey{Token: hcl2StringToken(label, tok.pos)})
+			continue
+		}
+		if !tok.is("{") {
+			return nil, hcl2Error(tok.pos, "Invalid argument or block definition",
+				`Either a quoted block label, an opening brace ("{") to begin a block or an equals sign ("=") to set an argument is expected here, but found %s.`,
+				tok.describe())
+		}
+		break
+	}
+
+	open := p.next()
+	body, err := p.parseBody(&open)
+	if err != nil {
+		return nil, err
+	}
+	closing := p.next()
+	return &ast.ObjectItem{
+		Keys: keys,
+		Val: &ast.ObjectType{
+			Lbrace: open.pos,
+			Rbrace: closing.pos,
+			List:   body,
+		},
+	}, nil
+}
+
+// parseExpression parses an expression, including conditionals
+func (p *hcl2Parser) parseExpression() (*hcl2Value, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek().is("?") {
+		return cond, nil
+	}
+	p.next()
+
+	result, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(":", "Missing false expression in conditional",
+		`The conditional operator (...?...:...) requires a false expression, delimited by a colon.`); err != nil {
+		return nil, err
+	}
+	other, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if cond.kind != hcl2Bool {
+		return nil, hcl2Error(cond.pos, "Incorrect condition type",
+			"The condition expression must be of type bool.")
+	}
+	if !cond.b {
+		result = other
+	}
+	return result, nil
+}
+
+// parseBinary parses the operands and binary operators from the given
+// level of precedence on
+func (p *hcl2Parser) parseBinary(level int) (*hcl2Value, error) {
+	if level == len(hcl2Precedence) {
+		return p.parseUnary()
+	}
+
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		if op.typ != hcl2TokenPunct || !hcl2HasOperator(hcl2Precedence[level], op.text) {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = hcl2Binary(op, left, right); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func hcl2HasOperator(ops []string, op string) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUnary parses a term, along with any negation
+func (p *hcl2Parser) parseUnary() (*hcl2Value, error) {
+	op := p.peek()
+	if !op.is("-") && !op.is("!") {
+		return p.parseTerm()
+	}
+	p.next()
+
+	operand, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if op.text == "-" {
+		if operand.kind != hcl2Number {
+			return nil, hcl2Error(operand.pos, "Invalid operand",
+				"Unsuitable value for unary operand: a number is required.")
+		}
+		return &hcl2Value{kind: hcl2Number, pos: op.pos, n: -operand.n}, nil
+	}
+	if operand.kind != hcl2Bool {
+		return nil, hcl2Error(operand.pos, "Invalid operand",
+			"Unsuitable value for unary operand: a bool is required.")
+	}
+	return &hcl2Value{kind: hcl2Bool, pos: op.pos, b: !operand.b}, nil
+}
+
+// parseTerm parses a literal, template, list, object or parenthesized
+// expression
+func (p *hcl2Parser) parseTerm() (*hcl2Value, error) {
+	tok := p.next()
+	var value *hcl2Value
+	switch {
+	case tok.typ == hcl2TokenNumber:
+		n, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, hcl2Error(tok.pos, "Invalid number literal", "%v", err)
+		}
+		value = &hcl2Value{kind: hcl2Number, pos: tok.pos, n: n}
+
+	case tok.typ == hcl2TokenIdent:
+		switch tok.text {
+		case "true", "false":
+			value = &hcl2Value{kind: hcl2Bool, pos: tok.pos, b: tok.text == "true"}
+		case "null":
+			value = &hcl2Value{kind: hcl2Null, pos: tok.pos}
+		default:
+			if p.peek().is("(") {
+				return nil, hcl2Error(tok.pos, "Function calls not allowed",
+					"Functions may not be called here.")
+			}
+			return nil, hcl2Error(tok.pos, "Variables not allowed",
+				"Variables may not be used here.")
+		}
+
+	case tok.typ == hcl2TokenQuote:
+		s, _, err := p.parseQuoted(tok)
+		if err != nil {
+			return nil, err
+		}
+		value = &hcl2Value{kind: hcl2String, pos: tok.pos, s: s}
+
+	case tok.typ == hcl2TokenHeredoc:
+		s, err := p.parseHeredoc(tok)
+		if err != nil {
+			return nil, err
+		}
+		value = &hcl2Value{kind: hcl2String, pos: tok.pos, s: s}
+
+	case tok.is("("):
+		newlines := p.newlines
+		p.newlines = false
+		inner, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(")", "Unbalanced parentheses",
+			"Expected a closing parenthesis to terminate the expression."); err != nil {
+			return nil, err
+		}
+		p.newlines = newlines
+		value = inner
+
+	case tok.is("["):
+		list, err := p.parseList(tok)
+		if err != nil {
+			return nil, err
+		}
+		value = list
+
+	case tok.is("{"):
+		object, err := p.parseObject(tok)
+		if err != nil {
+			return nil, err
+		}
+		value = object
+
+	default:
+		return nil, hcl2Error(tok.pos, "Invalid expression",
+			"Expected the start of an expression, but found %s.", tok.describe())
+	}
+
+	if next := p.peek(); next.is("[") || next.is(".") {
+		return nil, hcl2Error(next.pos, "Unsupported expression",
+			"Index and attribute access cannot be used in policies.")
+	}
+	return value, nil
+}
+
+// parseList parses the items of a list opened at the given token
+func (p *hcl2Parser) parseList(open hcl2Token) (*hcl2Value, error) {
+	newlines := p.newlines
+	p.newlines = false
+
+	list := &hcl2Value{kind: hcl2List, pos: open.pos}
+	for !p.peek().is("]") {
+		item, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		list.items = append(list.items, item)
+
+		if p.peek().is(",") {
+			p.next()
+		} else if !p.peek().is("]") {
+			tok := p.peek()
+			return nil, hcl2Error(tok.pos, "Missing item separator",
+				"Expected a comma to mark the beginning of the next item, but found %s.", tok.describe())
+		}
+	}
+	p.next()
+
+	p.newlines = newlines
+	return list, nil
+}
+
+// parseObject parses the attributes of an object opened at the given token
+func (p *hcl2Parser) parseObject(open hcl2Token) (*hcl2Value, error) {
+	newlines := p.newlines
+	p.newlines = true
+
+	object := &hcl2Value{kind: hcl2Object, pos: open.pos}
+	set := make(map[string]token.Pos)
+	for {
+		for p.peek().typ == hcl2TokenNewline {
+			p.next()
+		}
+		if p.peek().is("}") {
+			break
+		}
+
+		key, err := p.parseObjectKey()
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := set[key.s]; ok {
+			return nil, hcl2Error(key.pos, "Duplicate object attribute",
+				"An attribute named %q was already defined at %s.", key.s, first)
+		}
+		set[key.s] = key.pos
+
+		if tok := p.peek(); !tok.is("=") && !tok.is(":") {
+			return nil, hcl2Error(tok.pos, "Missing key/value separator",
+				`Expected an equals sign ("=") to mark the beginning of the attribute value, but found %s.`, tok.describe())
+		}
+		p.next()
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		object.attrs = append(object.attrs, &hcl2Attribute{key: key, value: value})
+
+		switch tok := p.peek(); {
+		case tok.is(","), tok.typ == hcl2TokenNewline:
+			p.next()
+		case tok.is("}"):
+		default:
+			return nil, hcl2Error(tok.pos, "Missing attribute separator",
+				"Expected a newline or comma to mark the beginning of the next attribute, but found %s.", tok.describe())
+		}
+	}
+	p.next()
+
+	p.newlines = newlines
+	return object, nil
+}
+
+// parseObjectKey parses the key of an object attribute, which is a name, a
+// template or a parenthesized expression
+func (p *hcl2Parser) parseObjectKey() (*hcl2Value, error) {
+	tok := p.peek()
+	var key *hcl2Value
+	switch {
+	case tok.typ == hcl2TokenIdent:
+		p.next()
+		key = &hcl2Value{kind: hcl2String, pos: tok.pos, s: tok.text}
+	case tok.typ == hcl2TokenQuote, tok.is("("):
+		var err error
+		if key, err = p.parseTerm(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, hcl2Error(tok.pos, "Invalid object key",
+			"Expected an attribute name, but found %s.", tok.describe())
+	}
+
+	s, err := key.interpolate()
+	if err != nil {
+		return nil, err
+	}
+	return &hcl2Value{kind: hcl2String, pos: key.pos, s: s}, nil
+}
+
+// parseQuoted parses the rest of a quoted template opened at the given
+// token, returning its value and whether it interpolated anything
+func (p *hcl2Parser) parseQuoted(open hcl2Token) (string, bool, error) {
+	var buf bytes.Buffer
+	interpolated := false
+	for {
+		s := p.state
+		rest := p.src[s.offset:]
+		switch {
+		case rest == "" || rest[0] == '\n':
+			return "", false, hcl2Error(open.pos, "Unterminated template string",
+				"No closing marker was found for the string.")
+
+		case rest[0] == '"':
+			p.state = p.advance(s, 1)
+			return buf.String(), interpolated, nil
+
+		case rest[0] == '\\':
+			r, n, err := hcl2Escape(rest)
+			if err != nil {
+				return "", false, hcl2Error(s.pos(), "Invalid escape sequence", "%v", err)
+			}
+			buf.WriteRune(r)
+			p.state = p.advance(s, n)
+
+		default:
+			done, err := p.parseTemplateChar(&buf)
+			if err != nil {
+				return "", false, err
+			}
+			interpolated = interpolated || done
+		}
+	}
+}
+
+// parseHeredoc parses the rest of a heredoc opened at the given token. As
+// in HCL2, no escapes are processed, and if opened with "<<-" its lines are
+// unindented by the least indentation among them.
+func (p *hcl2Parser) parseHeredoc(open hcl2Token) (string, error) {
+	// The heredoc ends at the first line holding only its marker
+	start := p.advance(p.state, strings.IndexByte(p.src[p.state.offset:], '\n')+1)
+	end := -1
+	indent := -1
+	for offset := start.offset; offset < len(p.src); {
+		line := p.src[offset:]
+		if i := strings.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i+1]
+		}
+		if strings.TrimSpace(line) == open.text {
+			end = offset
+			break
+		}
+		if trimmed := strings.TrimLeft(line, " \t"); strings.TrimSpace(trimmed) != "" {
+			if n := len(line) - len(trimmed); indent < 0 || n < indent {
+				indent = n
+			}
+		}
+		offset += len(line)
+	}
+	if end < 0 {
+		return "", hcl2Error(open.pos, "Unterminated template string",
+			"No closing marker was found for the heredoc; the marker %q must be on a line of its own.", open.text)
+	}
+	if !open.strip || indent < 0 {
+		indent = 0
+	}
+
+	var buf bytes.Buffer
+	p.state = start
+	lineStart := true
+	for p.state.offset < end {
+		if lineStart {
+			// Drop the indentation common to every line
+			n := 0
+			for n < indent && p.state.offset+n < end &&
+				(p.src[p.state.offset+n] == ' ' || p.src[p.state.offset+n] == '\t') {
+				n++
+			}
+			p.state = p.advance(p.state, n)
+		}
+		lineStart = p.src[p.state.offset] == '\n'
+		if _, err := p.parseTemplateChar(&buf); err != nil {
+			return "", err
+		}
+		if p.state.offset > end {
+			return "", hcl2Error(open.pos, "Unterminated template string",
+				"An interpolation in the heredoc is not closed before its marker.")
+		}
+	}
+
+	// Move past the marker, leaving the newline that ends the argument
+	line := p.src[end:]
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+	p.state = p.advance(p.state, len(line))
+	return buf.String(), nil
+}
+
+// parseTemplateChar parses a character of a template, or an interpolation
+// and its escapes, returning whether it parsed an interpolation
+func (p *hcl2Parser) parseTemplateChar(buf *bytes.Buffer) (bool, error) {
+	s := p.state
+	rest := p.src[s.offset:]
+	switch {
+	case strings.HasPrefix(rest, "$${"), strings.HasPrefix(rest, "%%{"):
+		buf.WriteString(rest[1:3])
+		p.state = p.advance(s, 3)
+		return false, nil
+
+	case strings.HasPrefix(rest, "%{"):
+		return false, hcl2Error(s.pos(), "Unsupported template directive",
+			"Template directives cannot be used in policies. To write a literal %%{, use %%%%{.")
+
+	case strings.HasPrefix(rest, "${"):
+		p.state = p.advance(s, 2)
+		newlines := p.newlines
+		p.newlines = false
+		value, err := p.parseExpression()
+		if err != nil {
+			return false, err
+		}
+		if _, err := p.expect("}", "Unterminated template interpolation",
+			`Expected a closing brace ("}") to end the interpolation.`); err != nil {
+			return false, err
+		}
+		p.newlines = newlines
+
+		str, err := value.interpolate()
+		if err != nil {
+			return false, err
+		}
+		buf.WriteString(str)
+		return true, nil
+	}
+
+	_, size := utf8.DecodeRuneInString(rest)
+	buf.WriteString(rest[:size])
+	p.state = p.advance(s, size)
+	return false, nil
+}
+
+// hcl2Escape decodes the escape sequence at the start of s, returning the
+// rune and the length of the sequence
+func hcl2Escape(s string) (rune, int, error) {
+	if len(s) < 2 {
+		return 0, 0, errors.New("The escape sequence is incomplete.")
+	}
+	switch s[1] {
+	case 'n':
+		return '\n', 2, nil
+	case 'r':
+		return '\r', 2, nil
+	case 't':
+		return '\t', 2, nil
+	case '"':
+		return '"', 2, nil
+	case '\\':
+		return '\\', 2, nil
+	case 'u', 'U':
+		n := 4
+		if s[1] == 'U' {
+			n = 8
+		}
+		if len(s) < 2+n {
+			return 0, 0, errors.New("The escape sequence is incomplete.")
+		}
+		code, err := strconv.ParseUint(s[2:2+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return 0, 0, fmt.Errorf("The escape sequence %q is not a valid character.", s[:2+n])
+		}
+		return rune(code), 2 + n, nil
+	}
+	return 0, 0, fmt.Errorf(`The symbol %q is not a valid escape sequence selector. Valid sequences are \n, \r, \t, \", \\, \uNNNN and \UNNNNNNNN.`, s[1:2])
+}
+
+type hcl2Kind int
+
+const (
+	hcl2Null hcl2Kind = iota
+	hcl2Bool
+	hcl2Number
+	hcl2String
+	hcl2List
+	hcl2Object
+)
+
+// hcl2Value is the value of an expression
+type hcl2Value struct {
+	kind hcl2Kind
+	pos  token.Pos
+
+	b     bool
+	n     float64
+	s     string
+	items []*hcl2Value
+	attrs []*hcl2Attribute
+}
+
+// hcl2Attribute is an attribute of an object, whose key is a string
+type hcl2Attribute struct {
+	key   *hcl2Value
+	value *hcl2Value
+}
+
+// hcl2Binary applies a binary operator to its operands
+func hcl2Binary(op hcl2Token, left, right *hcl2Value) (*hcl2Value, error) {
+	result := &hcl2Value{pos: left.pos}
+	switch op.text {
+	case "==", "!=":
+		result.kind = hcl2Bool
+		result.b = left.equal(right) == (op.text == "==")
+		return result, nil
+
+	case "&&", "||":
+		if err := hcl2Operands(hcl2Bool, "a bool", left, right); err != nil {
+			return nil, err
+		}
+		result.kind = hcl2Bool
+		if op.text == "&&" {
+			result.b = left.b && right.b
+		} else {
+			result.b = left.b || right.b
+		}
+		return result, nil
+	}
+
+	if err := hcl2Operands(hcl2Number, "a number", left, right); err != nil {
+		return nil, err
+	}
+	result.kind = hcl2Number
+	switch op.text {
+	case "+":
+		result.n = left.n + right.n
+	case "-":
+		result.n = left.n - right.n
+	case "*":
+		result.n = left.n * right.n
+	case "/", "%":
+		if right.n == 0 {
+			return nil, hcl2Error(op.pos, "Operation failed",
+				"Error during operation: can't divide by zero.")
+		}
+		if op.text == "/" {
+			result.n = left.n / right.n
+		} else {
+			result.n = math.Mod(left.n, right.n)
+		}
+	default:
+		result.kind = hcl2Bool
+		switch op.text {
+		case "<":
+			result.b = left.n < right.n
+		case "<=":
+			result.b = left.n <= right.n
+		case ">":
+			result.b = left.n > right.n
+		case ">=":
+			result.b = left.n >= right.n
+		}
+	}
+	return result, nil
+}
+
+// hcl2Operands checks that both operands of an operator are of its kind
+func hcl2Operands(kind hcl2Kind, describe string, left, right *hcl2Value) error {
+	if left.kind != kind {
+		return hcl2Error(left.pos, "Invalid operand",
+			"Unsuitable value for left operand: %s is required.", describe)
+	}
+	if right.kind != kind {
+		return hcl2Error(right.pos, "Invalid operand",
+			"Unsuitable value for right operand: %s is required.", describe)
+	}
+	return nil
+}
+
+// equal returns whether two values are the same
+func (v *hcl2Value) equal(other *hcl2Value) bool {
+	if v.kind != other.kind {
+		return false
+	}
+	switch v.kind {
+	case hcl2Bool:
+		return v.b == other.b
+	case hcl2Number:
+		return v.n == other.n
+	case hcl2String:
+		return v.s == other.s
+	case hcl2List:
+		if len(v.items) != len(other.items) {
+			return false
+		}
+		for i, item := range v.items {
+			if !item.equal(other.items[i]) {
+				return false
+			}
+		}
+	case hcl2Object:
+		if len(v.attrs) != len(other.attrs) {
+			return false
+		}
+		for _, attr := range v.attrs {
+			found := false
+			for _, o := range other.attrs {
+				if attr.key.s == o.key.s {
+					found = attr.value.equal(o.value)
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// interpolate returns the value as included in a template
+func (v *hcl2Value) interpolate() (string, error) {
+	switch v.kind {
+	case hcl2String:
+		return v.s, nil
+	case hcl2Number:
+		return strconv.FormatFloat(v.n, 'f', -1, 64), nil
+	case hcl2Bool:
+		return strconv.FormatBool(v.b), nil
+	case hcl2Null:
+		return "", hcl2Error(v.pos, "Invalid template interpolation value",
+			"The expression result is null.")
+	}
+	return "", hcl2Error(v.pos, "Invalid template interpolation value",
+		"Cannot include the given value in a string template: string required.")
+}
+
+// node returns the syntax tree HCL1 would have parsed the value into
+func (v *hcl2Value) node() (ast.Node, error) {
+	switch v.kind {
+	case hcl2Bool:
+		return &ast.LiteralType{Token: token.Token{Type: token.BOOL, Text: strconv.FormatBool(v.b), Pos: v.pos}}, nil
+
+	case hcl2Number:
+		if v.n == math.Trunc(v.n) && math.Abs(v.n) < 1<<53 {
+			return &ast.LiteralType{Token: token.Token{Type: token.NUMBER, Text: strconv.FormatInt(int64(v.n), 10), Pos: v.pos}}, nil
+		}
+		return &ast.LiteralType{Token: token.Token{Type: token.FLOAT, Text: strconv.FormatFloat(v.n, 'g', -1, 64), Pos: v.pos}}, nil
+
+	case hcl2String:
+		return &ast.LiteralType{Token: hcl2StringToken(v.s, v.pos)}, nil
+
+	case hcl2List:
+		list := &ast.ListType{Lbrack: v.pos}
+		for _, item := range v.items {
+			if item.kind == hcl2Null {
+				return nil, hcl2Error(item.pos, "Invalid value",
+					"Null values cannot be used in lists.")
+			}
+			node, err := item.node()
+			if err != nil {
+				return nil, err
+			}
+			list.Add(node)
+		}
+		return list, nil
+
+	case hcl2Object:
+		list := &ast.ObjectList{}
+		for _, attr := range v.attrs {
+			// Null attributes are the same as unset ones
+			if attr.value.kind == hcl2Null {
+				continue
+			}
+			node, err := attr.value.node()
+			if err != nil {
+				return nil, err
+			}
+			list.Add(&ast.ObjectItem{
+				Keys: []*ast.ObjectKey{&ast.ObjectKey{Token: hcl2StringToken(attr.key.s, attr.key.pos)}},
+				Val:  node,
+			})
+		}
+		return &ast.ObjectType{Lbrace: v.pos, List: list}, nil
+	}
+	return nil, hcl2Error(v.pos, "Invalid value", "Null values cannot be used here.")
+}
+
+// hcl2StringToken returns an HCL1 string token holding the given string.
+// It is quoted as JSON strings are, so that HCL1 unquotes it without
+// treating interpolations specially.
+func hcl2StringToken(s string, pos token.Pos) token.Token {
+	return token.Token{Type: token.STRING, Text: strconv.Quote(s), Pos: pos, JSON: true}
+}
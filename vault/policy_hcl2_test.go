@@ -0,0 +1,252 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/hcl"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+)
+
+func TestParse_HCL2(t *testing.T) {
+	rules := `
+# HCL2 evaluates expressions, which HCL1 cannot parse
+path "secret/*" {
+  capabilities     = ["read", "list",]
+  min_wrapping_ttl = 60 * 5
+  max_wrapping_ttl = (1 + 1) * 3600
+  allowed_parameters = {
+    foo: ["a", "b"]
+    "bar" = []
+  }
+  required_parameters = null
+}
+
+path "sys/*" { capabilities = [1 > 2 ? "read" : "deny"] }
+
+rate_limit {
+  rps   = 10 / 4
+  burst = 5
+}
+`
+	p, err := ParseSyntax(rules, PolicySyntaxHCL2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Syntax != PolicySyntaxHCL2 {
+		t.Fatalf("bad: %q", p.Syntax)
+	}
+
+	// HCL2 is never tried unless it is given
+	if _, err := Parse(rules); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	expected, err := Parse(`
+path "secret/*" {
+  capabilities = ["read", "list"]
+  min_wrapping_ttl = 300
+  max_wrapping_ttl = 7200
+  allowed_parameters = {
+    "foo" = ["a", "b"]
+    "bar" = []
+  }
+}
+path "sys/*" {
+  capabilities = ["deny"]
+}
+rate_limit {
+  rps = 2.5
+  burst = 5
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(p.Paths, expected.Paths) {
+		t.Fatalf("bad:\n%#v\nexpected:\n%#v", p.Paths, expected.Paths)
+	}
+	if !reflect.DeepEqual(p.RateLimit, expected.RateLimit) {
+		t.Fatalf("bad: %#v", p.RateLimit)
+	}
+}
+
+func TestParse_HCL1Compatibility(t *testing.T) {
+	// Policies HCL1 parses are read as they always were, including
+	// strings that would be templates in HCL2
+	p, err := Parse(`path "secret/*" { policy = "read", allowed_parameters = { "foo" = ["${bar}"] } }`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Paths[0].Policy != "read" {
+		t.Fatalf("bad: %#v", p.Paths[0])
+	}
+	if !reflect.DeepEqual(p.Paths[0].AllowedParameters["foo"], []interface{}{"${bar}"}) {
+		t.Fatalf("bad: %#v", p.Paths[0].AllowedParameters)
+	}
+	if p.Syntax != "" {
+		t.Fatalf("bad: %q", p.Syntax)
+	}
+
+	if _, err := ParseSyntax(`path "secret/*" { policy = "read" }`, "hcl3"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestParse_HCL1HCL2Equivalence(t *testing.T) {
+	cases := []struct {
+		hcl1 string
+		hcl2 string
+	}{
+		{
+			`path "secret/*" { policy = "write" }`,
+			`path "secret/*" { policy = "write" }`,
+		},
+		{
+			`
+path "secret/foo" {
+  capabilities = ["create", "update"]
+  allowed_parameters = {
+    "zip" = []
+    "zap" = ["a", "b"]
+  }
+  denied_parameters = {
+    "*" = ["c"]
+  }
+  required_parameters = ["zip"]
+}
+path "sys/*" {
+  capabilities = ["deny"]
+}`,
+			`
+path "secret/foo" {
+  capabilities = ["create", "update",]
+  allowed_parameters = {
+    zip = []
+    "zap": ["a", "b"]
+  }
+  denied_parameters = { "*" = ["c"] }
+  required_parameters = ["zip"]
+}
+
+path "sys/*" { capabilities = ["deny"] }`,
+		},
+		{
+			`
+path "sys/wrapping/*" {
+  capabilities = ["update"]
+  min_wrapping_ttl = "300s"
+  max_wrapping_ttl = 3600
+  bound_cidrs = ["10.0.0.0/8"]
+}
+rate_limit {
+  rps = 2.5
+  burst = 10
+}`,
+			`
+path "sys/wrapping/*" {
+  capabilities     = ["update"]
+  min_wrapping_ttl = "300s"
+  max_wrapping_ttl = 60 * 60
+  bound_cidrs      = ["10.0.0.0/8"]
+}
+
+rate_limit {
+  rps   = 5 / 2
+  burst = 10
+}`,
+		},
+	}
+	for _, tc := range cases {
+		p1, err := ParseSyntax(tc.hcl1, PolicySyntaxHCL)
+		if err != nil {
+			t.Fatalf("%q: err: %v", tc.hcl1, err)
+		}
+		p2, err := ParseSyntax(tc.hcl2, PolicySyntaxHCL2)
+		if err != nil {
+			t.Fatalf("%q: err: %v", tc.hcl2, err)
+		}
+		if !reflect.DeepEqual(p1.Paths, p2.Paths) {
+			t.Fatalf("bad:\n%#v\nexpected:\n%#v", p2.Paths, p1.Paths)
+		}
+		if !reflect.DeepEqual(p1.RateLimit, p2.RateLimit) {
+			t.Fatalf("bad: %#v, expected: %#v", p2.RateLimit, p1.RateLimit)
+		}
+	}
+}
+
+func TestParseHCL2_Templates(t *testing.T) {
+	root, err := parseHCL2(`
+interpolated = "a${1 + 1}b$${c}%%{d}"
+escaped      = "\u00e9\t\"\\"
+key          = { ("x${1}") = true }
+heredoc      = <<EOT
+  line ${"one"}
+    two
+EOT
+stripped = <<-EOT
+    line one
+      two
+    EOT
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var out map[string]interface{}
+	if err := hcl.DecodeObject(&out, root.Node); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"interpolated": "a2b${c}%{d}",
+		"escaped":      "\u00e9\t\"\\",
+		"key":          []map[string]interface{}{{"x1": true}},
+		"heredoc":      "  line one\n    two\n",
+		"stripped":     "line one\n  two\n",
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Fatalf("bad:\n%#v\nexpected:\n%#v", out, expected)
+	}
+}
+
+func TestParseHCL2_Errors(t *testing.T) {
+	cases := []struct {
+		src     string
+		line    int
+		column  int
+		summary string
+	}{
+		{"path \"a\" {\n  capabilities = [\"read\"\n}", 3, 1, "Missing item separator"},
+		{"path \"a\" {\n  capabilities = [read]\n}", 2, 19, "Variables not allowed"},
+		{"path \"a\" {\n  capabilities = [lower(\"READ\")]\n}", 2, 19, "Function calls not allowed"},
+		{"path \"a\" {\n  min_wrapping_ttl = 60 *\n}", 2, 26, "Invalid expression"},
+		{"path \"a\" {\n  min_wrapping_ttl = 60 / 0\n}", 2, 25, "Operation failed"},
+		{"path \"a\" {\n  min_wrapping_ttl = \"60\" * 2\n}", 2, 22, "Invalid operand"},
+		{"path \"a\" {\n  policy = \"read\"\n  policy = \"deny\"\n}", 3, 3, "Attribute redefined"},
+		{"path \"a\" {\n  policy = \"read\"\n", 1, 10, "Unclosed configuration block"},
+		{"path \"a\" {\n  policy = \"read\n}", 2, 12, "Unterminated template string"},
+		{"path \"a\" {\n  policy = \"\\q\"\n}", 2, 13, "Invalid escape sequence"},
+		{"path \"a\" {\n  policy = \"read\" capabilities = []\n}", 2, 19, "Missing newline after definition"},
+		{"path \"a\" {\n  x = {a = 1 b = 2}\n}", 2, 14, "Missing attribute separator"},
+		{"path \"a\" {\n  x = [1][0]\n}", 2, 10, "Unsupported expression"},
+		{"path \"a\" {\n  x = true ? 1\n}", 2, 15, "Missing false expression in conditional"},
+	}
+	for _, tc := range cases {
+		_, err := parseHCL2(tc.src)
+		posErr, ok := err.(*hclParser.PosError)
+		if !ok {
+			t.Fatalf("%q: bad: %#v", tc.src, err)
+		}
+		if posErr.Pos.Line != tc.line || posErr.Pos.Column != tc.column ||
+			!strings.HasPrefix(posErr.Err.Error(), tc.summary+"; ") {
+			t.Fatalf("%q: bad: %v", tc.src, err)
+		}
+
+		// Validation reports the line HCL2 gives
+		errs, _ := ValidatePolicySyntax(tc.src, PolicySyntaxHCL2)
+		if len(errs) != 1 || errs[0].Line != tc.line {
+			t.Fatalf("%q: bad: %#v", tc.src, errs)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package vault
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// unmountedPathWarning is the warning given for a path of a policy where no
+// backend is mounted
+const unmountedPathWarning = "path %q can never match, as no backend is mounted there"
+
+// unmountedPaths returns the path patterns of a policy that can never match
+// a request, as no backend is mounted where they point. Templated paths are
+// left out, as they are only known once resolved.
+func unmountedPaths(p *Policy, mounts []string) []string {
+	var ret []string
+	for _, pc := range p.Paths {
+		if pc.Templated {
+			continue
+		}
+		pattern := pc.Prefix
+		if pc.Glob {
+			pattern += "*"
+		}
+		if patternReachesMount(pattern, mounts) {
+			continue
+		}
+		if !strutil.StrListContains(ret, pattern) {
+			ret = append(ret, pattern)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// patternReachesMount returns whether a path pattern can match a path under
+// one of the given mount points
+func patternReachesMount(pattern string, mounts []string) bool {
+	// Only the part before the first wildcard is fixed
+	i := firstWildcard(pattern)
+	literal, wildcard := pattern[:i], i < len(pattern)
+
+	for _, mount := range mounts {
+		switch {
+		case strings.HasPrefix(literal, mount):
+			return true
+		case literal+"/" == mount:
+			// Requests to a mount point without the trailing slash are
+			// routed to the mount
+			return true
+		case wildcard && strings.HasPrefix(mount, literal):
+			return true
+		}
+	}
+	return false
+}
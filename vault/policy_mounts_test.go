@@ -0,0 +1,33 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnmountedPaths(t *testing.T) {
+	mounts := []string{"secret/", "sys/", "auth/token/", "auth/github-eng/", "cubbyhole/"}
+
+	p, err := Parse(`
+path "secret/app/*" { capabilities = ["read"] }
+path "secrets/app/*" { capabilities = ["read"] }
+path "secret" { capabilities = ["list"] }
+path "sys/mounts" { capabilities = ["read"] }
+path "sys*" { capabilities = ["read"] }
+path "auth/github*" { capabilities = ["read"] }
+path "auth/gitlab*" { capabilities = ["read"] }
+path "auth/+/login" { capabilities = ["update"] }
+path "+/app" { capabilities = ["read"] }
+path "transit/keys/*" { capabilities = ["read"] }
+path "transit/keys/+" { capabilities = ["read"] }
+path "auth/ldap/users/{{identity.entity.name}}" { capabilities = ["read"] }
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expected := []string{"auth/gitlab*", "secrets/app/*", "transit/keys/*", "transit/keys/+"}
+	if actual := unmountedPaths(p, mounts); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,85 @@
+package vault
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// policyPasswordSubPath is the sub-path used to store password
+	// policies, nested under the system view.
+	policyPasswordSubPath = "policy-password/"
+)
+
+// SetPasswordView provides the policy store with the view used to store
+// password policies.
+func (ps *PolicyStore) SetPasswordView(view *BarrierView) {
+	ps.passwordView = view
+}
+
+// SetPasswordPolicy stores a password policy
+func (ps *PolicyStore) SetPasswordPolicy(p *passwordpolicy.Policy) error {
+	if ps.passwordView == nil {
+		return fmt.Errorf("password policies are not available")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("policy name missing")
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	entry, err := logical.StorageEntryJSON(p.Name, p)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := ps.passwordView.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist password policy: %v", err)
+	}
+	return nil
+}
+
+// GetPasswordPolicy returns the named password policy, or nil if it does not
+// exist
+func (ps *PolicyStore) GetPasswordPolicy(name string) (*passwordpolicy.Policy, error) {
+	if ps.passwordView == nil {
+		return nil, nil
+	}
+
+	out, err := ps.passwordView.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password policy: %v", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	p := new(passwordpolicy.Policy)
+	if err := out.DecodeJSON(p); err != nil {
+		return nil, fmt.Errorf("failed to decode password policy: %v", err)
+	}
+	p.Name = name
+	return p, nil
+}
+
+// ListPasswordPolicies returns the names of the password policies
+func (ps *PolicyStore) ListPasswordPolicies() ([]string, error) {
+	if ps.passwordView == nil {
+		return nil, nil
+	}
+	return CollectKeys(ps.passwordView)
+}
+
+// DeletePasswordPolicy deletes the named password policy. Backends
+// referencing it refuse to set passwords until it is created again.
+func (ps *PolicyStore) DeletePasswordPolicy(name string) error {
+	if ps.passwordView == nil {
+		return nil
+	}
+	if err := ps.passwordView.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete password policy: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/passwordpolicy"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPolicyStore_PasswordPolicies(t *testing.T) {
+	ps := mockPolicyStore(t)
+	_, barrier, _ := mockBarrier(t)
+	ps.SetPasswordView(NewBarrierView(barrier, "foo-password/"))
+
+	p := &passwordpolicy.Policy{
+		Name:      "strict",
+		MinLength: 12,
+		MinDigits: 2,
+		History:   5,
+		MaxAge:    90 * 24 * time.Hour,
+	}
+	if err := ps.SetPasswordPolicy(p); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := ps.GetPasswordPolicy("strict")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(out, p) {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	if err := ps.SetPasswordPolicy(&passwordpolicy.Policy{Name: "bad", History: -1}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	names, err := ps.ListPasswordPolicies()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"strict"}) {
+		t.Fatalf("bad: %v", names)
+	}
+
+	if err := ps.DeletePasswordPolicy("strict"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, err := ps.GetPasswordPolicy("strict"); err != nil || out != nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+}
+
+func TestSystemBackend_PasswordPolicies(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/policies/password/Strict")
+	req.Data["min_length"] = 10
+	req.Data["min_symbols"] = 1
+	req.Data["max_age"] = "24h"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/policies/password/strict")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["min_length"] != 10 || resp.Data["min_symbols"] != 1 || resp.Data["max_age"] != int64(86400) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Backends read password policies through their system view
+	me := &MountEntry{Path: "userpass/", Type: "userpass"}
+	p, err := dynamicSystemView{core: c, mountEntry: me}.PasswordPolicy("strict")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p == nil || p.Check("tooshort") == nil || p.Check("long-enough") != nil {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policies/password/bad")
+	req.Data["min_length"] = -1
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "sys/policies/password")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"strict"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/policies/password/strict")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p, err := c.policyStore.GetPasswordPolicy("strict"); err != nil || p != nil {
+		t.Fatalf("bad: %#v %v", p, err)
+	}
+}
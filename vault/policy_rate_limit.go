@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// rateBucketSweepInterval is how often the buckets of tokens that have
+	// not made requests for a while are dropped
+	rateBucketSweepInterval = time.Minute
+)
+
+// rateBucket is a token bucket holding the requests a token may still make
+// with a rate limited policy
+type rateBucket struct {
+	limit   *RateLimit
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the requests earned since the bucket was last updated
+func (b *rateBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.RequestsPerSecond)
+	}
+	b.updated = now
+}
+
+// allowRate checks a request made by a token against the rate limits of the
+// policies that allowed it. The request counts against every limit, and is
+// only allowed if none of them is exceeded. It returns the name of a policy
+// whose limit is exceeded, or an empty string if the request is allowed.
+func (ps *PolicyStore) allowRate(tokenID string, limits map[string]*RateLimit) string {
+	if len(limits) == 0 {
+		return ""
+	}
+	now := time.Now()
+
+	ps.rateLock.Lock()
+	defer ps.rateLock.Unlock()
+	if ps.rateBuckets == nil {
+		ps.rateBuckets = make(map[string]*rateBucket)
+	}
+	if now.Sub(ps.rateSwept) > rateBucketSweepInterval {
+		ps.sweepRateBuckets(now)
+	}
+
+	names := make([]string, 0, len(limits))
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buckets := make([]*rateBucket, 0, len(names))
+	for _, name := range names {
+		limit := limits[name]
+		key := tokenID + "/" + name
+		bucket, ok := ps.rateBuckets[key]
+		if !ok || *bucket.limit != *limit {
+			// New buckets, and those of policies whose limit changed,
+			// start full
+			bucket = &rateBucket{
+				limit:   limit,
+				tokens:  float64(limit.Burst),
+				updated: now,
+			}
+			ps.rateBuckets[key] = bucket
+		} else {
+			bucket.refill(now)
+		}
+
+		if bucket.tokens < 1 {
+			metrics.IncrCounter([]string{"policy", "rate_limited", name}, 1)
+			return name
+		}
+		buckets = append(buckets, bucket)
+	}
+
+	for _, bucket := range buckets {
+		bucket.tokens--
+	}
+	return ""
+}
+
+// sweepRateBuckets drops the buckets that have refilled, as those of tokens
+// that are no longer used eventually do. Dropping them changes nothing, as
+// new buckets start full.
+func (ps *PolicyStore) sweepRateBuckets(now time.Time) {
+	for key, bucket := range ps.rateBuckets {
+		bucket.refill(now)
+		if bucket.tokens >= float64(bucket.limit.Burst) {
+			delete(ps.rateBuckets, key)
+		}
+	}
+	ps.rateSwept = now
+}
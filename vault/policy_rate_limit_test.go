@@ -0,0 +1,61 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyStore_AllowRate(t *testing.T) {
+	ps := mockPolicyStore(t)
+
+	slow := &RateLimit{RequestsPerSecond: 1, Burst: 2}
+	fast := &RateLimit{RequestsPerSecond: 100, Burst: 5}
+	limits := map[string]*RateLimit{"slow": slow, "fast": fast}
+
+	// The burst of the tightest limit may be used up at once
+	for i := 0; i < 2; i++ {
+		if limited := ps.allowRate("token", limits); limited != "" {
+			t.Fatalf("bad: %d: %s", i, limited)
+		}
+	}
+	if limited := ps.allowRate("token", limits); limited != "slow" {
+		t.Fatalf("bad: %s", limited)
+	}
+
+	// A request that is limited does not count against the other limits
+	if tokens := ps.rateBuckets["token/fast"].tokens; int(tokens) != 3 {
+		t.Fatalf("bad: %v", tokens)
+	}
+	if limited := ps.allowRate("token", map[string]*RateLimit{"fast": fast}); limited != "" {
+		t.Fatalf("bad: %s", limited)
+	}
+
+	// Other tokens have their own buckets
+	if limited := ps.allowRate("other", limits); limited != "" {
+		t.Fatalf("bad: %s", limited)
+	}
+
+	// Buckets refill over time
+	ps.rateBuckets["token/slow"].updated = time.Now().Add(-time.Second)
+	if limited := ps.allowRate("token", limits); limited != "" {
+		t.Fatalf("bad: %s", limited)
+	}
+	if limited := ps.allowRate("token", limits); limited != "slow" {
+		t.Fatalf("bad: %s", limited)
+	}
+
+	// Changing the limit starts a new bucket
+	if limited := ps.allowRate("token", map[string]*RateLimit{"slow": &RateLimit{RequestsPerSecond: 1, Burst: 3}}); limited != "" {
+		t.Fatalf("bad: %s", limited)
+	}
+
+	// Buckets that have refilled are dropped
+	for _, bucket := range ps.rateBuckets {
+		bucket.updated = time.Now().Add(-time.Hour)
+	}
+	ps.rateSwept = time.Time{}
+	ps.allowRate("new", limits)
+	if len(ps.rateBuckets) != 2 {
+		t.Fatalf("bad: %#v", ps.rateBuckets)
+	}
+}
@@ -0,0 +1,276 @@
+package vault
+
+import (
+	"fmt"
+	"go/ast"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// policyRuleSubPath is the sub-path used to store rule policies, nested
+	// under the system view.
+	policyRuleSubPath = "policy-rule/"
+)
+
+// RulePolicy is a policy checked after the path rules of ACL policies have
+// allowed a request. It applies to requests to its paths, and denies those
+// for which its condition is not true. Unlike ACL policies, rule policies
+// are not attached to tokens; they apply to every token but root tokens.
+type RulePolicy struct {
+	Name string
+
+	// Paths are the patterns of the paths the policy applies to, as in
+	// ACL policies: a trailing "*" globs and "+" matches any one segment
+	Paths []string
+
+	// Condition is the expression that must be true for requests to be
+	// allowed
+	Condition string
+
+	// TimeZone is the zone the time of requests is given in, UTC if empty
+	TimeZone string
+
+	expr     ast.Expr
+	location *time.Location
+}
+
+// rulePolicyEntry is used to store a rule policy
+type rulePolicyEntry struct {
+	Paths     []string `json:"paths"`
+	Condition string   `json:"condition"`
+	TimeZone  string   `json:"time_zone"`
+}
+
+// ParseRulePolicy checks the condition and time zone of a rule policy
+func ParseRulePolicy(name string, paths []string, condition, timeZone string) (*RulePolicy, error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("at least one path is required")
+	}
+	for i, path := range paths {
+		paths[i] = strings.TrimPrefix(path, "/")
+	}
+
+	expr, err := parseRuleCondition(condition)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time_zone: %v", err)
+	}
+
+	return &RulePolicy{
+		Name:      name,
+		Paths:     paths,
+		Condition: condition,
+		TimeZone:  timeZone,
+		expr:      expr,
+		location:  location,
+	}, nil
+}
+
+// AppliesTo returns whether the policy applies to requests to the path
+func (p *RulePolicy) AppliesTo(path string) bool {
+	for _, pattern := range p.Paths {
+		if matchSegmentWildcards(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows evaluates the condition of the policy for a request. Conditions that
+// cannot be evaluated, such as one comparing a string with a number, deny
+// the request.
+func (p *RulePolicy) Allows(req *logical.Request, te *TokenEntry, now time.Time) (bool, error) {
+	allowed, err := evalRuleCondition(p.expr, ruleEnvironment(req, te, now.In(p.location)))
+	if err != nil {
+		return false, fmt.Errorf("rule policy '%s': %v", p.Name, err)
+	}
+	return allowed, nil
+}
+
+// ruleEnvironment returns the properties of a request that conditions may
+// refer to
+func ruleEnvironment(req *logical.Request, te *TokenEntry, now time.Time) map[string]interface{} {
+	var remoteAddr string
+	if req.Connection != nil {
+		remoteAddr = req.Connection.RemoteAddr
+		if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+			remoteAddr = host
+		}
+	}
+
+	env := map[string]interface{}{
+		"operation":   string(req.Operation),
+		"path":        req.Path,
+		"data":        req.Data,
+		"remote_addr": remoteAddr,
+		"time": map[string]interface{}{
+			"hour":    float64(now.Hour()),
+			"minute":  float64(now.Minute()),
+			"weekday": strings.ToLower(now.Weekday().String()),
+			"day":     float64(now.Day()),
+			"month":   float64(now.Month()),
+			"year":    float64(now.Year()),
+			"unix":    float64(now.Unix()),
+		},
+		"mfa": false,
+	}
+	if te != nil {
+		env["token"] = map[string]interface{}{
+			"policies":     te.Policies,
+			"metadata":     te.Meta,
+			"display_name": te.DisplayName,
+			"path":         te.Path,
+			"num_uses":     te.NumUses,
+		}
+		env["mfa"] = te.MFA
+	}
+	return env
+}
+
+// SetRuleView provides the policy store with the view used to store rule
+// policies.
+func (ps *PolicyStore) SetRuleView(view *BarrierView) {
+	ps.ruleView = view
+}
+
+// SetRulePolicy stores a rule policy
+func (ps *PolicyStore) SetRulePolicy(p *RulePolicy) error {
+	if ps.ruleView == nil {
+		return fmt.Errorf("rule policies are not available")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("policy name missing")
+	}
+
+	entry, err := logical.StorageEntryJSON(p.Name, &rulePolicyEntry{
+		Paths:     p.Paths,
+		Condition: p.Condition,
+		TimeZone:  p.TimeZone,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+
+	ps.ruleLock.Lock()
+	defer ps.ruleLock.Unlock()
+	if err := ps.ruleView.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist rule policy: %v", err)
+	}
+	ps.rules = nil
+	return nil
+}
+
+// GetRulePolicy returns the named rule policy, or nil if it does not exist
+func (ps *PolicyStore) GetRulePolicy(name string) (*RulePolicy, error) {
+	if ps.ruleView == nil {
+		return nil, nil
+	}
+
+	out, err := ps.ruleView.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule policy: %v", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+
+	var entry rulePolicyEntry
+	if err := out.DecodeJSON(&entry); err != nil {
+		return nil, fmt.Errorf("failed to decode rule policy: %v", err)
+	}
+	p, err := ParseRulePolicy(name, entry.Paths, entry.Condition, entry.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rule policy '%s': %v", name, err)
+	}
+	return p, nil
+}
+
+// ListRulePolicies returns the names of the rule policies
+func (ps *PolicyStore) ListRulePolicies() ([]string, error) {
+	if ps.ruleView == nil {
+		return nil, nil
+	}
+	return CollectKeys(ps.ruleView)
+}
+
+// DeleteRulePolicy deletes the named rule policy
+func (ps *PolicyStore) DeleteRulePolicy(name string) error {
+	if ps.ruleView == nil {
+		return nil
+	}
+
+	ps.ruleLock.Lock()
+	defer ps.ruleLock.Unlock()
+	if err := ps.ruleView.Delete(name); err != nil {
+		return fmt.Errorf("failed to delete rule policy: %v", err)
+	}
+	ps.rules = nil
+	return nil
+}
+
+// rulePolicies returns every rule policy. They are kept loaded, as every
+// request is checked against them.
+func (ps *PolicyStore) rulePolicies() ([]*RulePolicy, error) {
+	ps.ruleLock.RLock()
+	rules := ps.rules
+	ps.ruleLock.RUnlock()
+	if rules != nil {
+		return rules, nil
+	}
+
+	ps.ruleLock.Lock()
+	defer ps.ruleLock.Unlock()
+	if ps.rules != nil {
+		return ps.rules, nil
+	}
+
+	names, err := ps.ListRulePolicies()
+	if err != nil {
+		return nil, err
+	}
+	rules = make([]*RulePolicy, 0, len(names))
+	for _, name := range names {
+		p, err := ps.GetRulePolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			rules = append(rules, p)
+		}
+	}
+
+	// Without caching, rules are loaded for every request
+	if ps.lru != nil {
+		ps.rules = rules
+	}
+	return rules, nil
+}
+
+// CheckRulePolicies checks a request allowed by the ACL policies of a token
+// against the rule policies that apply to it. It returns the name of the
+// first policy that denies the request, or an empty string if none does.
+func (ps *PolicyStore) CheckRulePolicies(req *logical.Request, te *TokenEntry) (string, error) {
+	rules, err := ps.rulePolicies()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	for _, p := range rules {
+		if !p.AppliesTo(req.Path) {
+			continue
+		}
+		allowed, err := p.Allows(req, te, now)
+		if err != nil || !allowed {
+			return p.Name, err
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,498 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// Rule policy conditions are boolean expressions over the properties of a
+// request. They use the syntax of Go expressions, which is parsed with the
+// standard library, but are evaluated by the small interpreter below: only
+// literals, the names in ruleNames, field and index access, the operators
+// ! && || == != < <= > >= and the functions in ruleFunctions are allowed.
+
+// ruleNames are the names a condition may refer to
+var ruleNames = []string{
+	"operation",
+	"path",
+	"data",
+	"token",
+	"mfa",
+	"remote_addr",
+	"time",
+	"true",
+	"false",
+	"nil",
+}
+
+// ruleFunction is a function that may be called in a condition
+type ruleFunction func(args []interface{}) (interface{}, error)
+
+// ruleFunctions are the functions a condition may call
+var ruleFunctions = map[string]ruleFunction{
+	"has_prefix": ruleStringsFunc(strings.HasPrefix),
+	"has_suffix": ruleStringsFunc(strings.HasSuffix),
+	"glob": ruleStringsFunc(func(value, pattern string) bool {
+		return matchSegmentWildcards(pattern, value)
+	}),
+	"contains": ruleContains,
+	"one_of":   ruleOneOf,
+	"len":      ruleLen,
+}
+
+// parseRuleCondition parses a condition and checks that it only uses what
+// the interpreter supports
+func parseRuleCondition(condition string) (ast.Expr, error) {
+	expr, err := parser.ParseExpr(condition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition: %v", err)
+	}
+	if err := checkRuleExpr(expr); err != nil {
+		return nil, fmt.Errorf("invalid condition: %v", err)
+	}
+	return expr, nil
+}
+
+// checkRuleExpr walks a parsed condition, rejecting anything the interpreter
+// does not support before the condition is stored
+func checkRuleExpr(node ast.Expr) error {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return checkRuleExpr(n.X)
+
+	case *ast.BasicLit:
+		switch n.Kind {
+		case token.STRING, token.INT, token.FLOAT:
+			return nil
+		}
+		return fmt.Errorf("unsupported literal %s", n.Value)
+
+	case *ast.Ident:
+		if !strutil.StrListContains(ruleNames, n.Name) {
+			return fmt.Errorf("unknown name '%s'", n.Name)
+		}
+		return nil
+
+	case *ast.SelectorExpr:
+		// The selected field is not a name, so only its parent is checked
+		return checkRuleExpr(n.X)
+
+	case *ast.IndexExpr:
+		if err := checkRuleExpr(n.X); err != nil {
+			return err
+		}
+		return checkRuleExpr(n.Index)
+
+	case *ast.UnaryExpr:
+		if n.Op != token.NOT && n.Op != token.SUB {
+			return fmt.Errorf("unsupported operator '%s'", n.Op)
+		}
+		return checkRuleExpr(n.X)
+
+	case *ast.BinaryExpr:
+		switch n.Op {
+		case token.LAND, token.LOR, token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ:
+		default:
+			return fmt.Errorf("unsupported operator '%s'", n.Op)
+		}
+		if err := checkRuleExpr(n.X); err != nil {
+			return err
+		}
+		return checkRuleExpr(n.Y)
+
+	case *ast.CallExpr:
+		fun, ok := n.Fun.(*ast.Ident)
+		if !ok || n.Ellipsis.IsValid() {
+			return fmt.Errorf("only the built-in functions may be called")
+		}
+		if _, ok := ruleFunctions[fun.Name]; !ok {
+			return fmt.Errorf("unknown function '%s'", fun.Name)
+		}
+		for _, arg := range n.Args {
+			if err := checkRuleExpr(arg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unsupported expression")
+}
+
+// evalRuleCondition evaluates a parsed condition against the properties of
+// a request, which must make it true or false
+func evalRuleCondition(expr ast.Expr, env map[string]interface{}) (bool, error) {
+	value, err := evalRuleExpr(expr, env)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition is %s rather than true or false", ruleTypeName(value))
+	}
+	return result, nil
+}
+
+// evalRuleExpr evaluates a node of a condition to a rule value
+func evalRuleExpr(node ast.Expr, env map[string]interface{}) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return evalRuleExpr(n.X, env)
+
+	case *ast.BasicLit:
+		switch n.Kind {
+		case token.STRING:
+			return strconv.Unquote(n.Value)
+		case token.INT, token.FLOAT:
+			return strconv.ParseFloat(n.Value, 64)
+		}
+		return nil, fmt.Errorf("unsupported literal %s", n.Value)
+
+	case *ast.Ident:
+		switch n.Name {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil":
+			return nil, nil
+		}
+		value, ok := env[n.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown name '%s'", n.Name)
+		}
+		return ruleValue(value), nil
+
+	case *ast.SelectorExpr:
+		base, err := evalRuleExpr(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		return ruleIndex(base, n.Sel.Name)
+
+	case *ast.IndexExpr:
+		base, err := evalRuleExpr(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		key, err := evalRuleExpr(n.Index, env)
+		if err != nil {
+			return nil, err
+		}
+		return ruleIndex(base, key)
+
+	case *ast.UnaryExpr:
+		value, err := evalRuleExpr(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case token.NOT:
+			b, ok := value.(bool)
+			if !ok {
+				return nil, fmt.Errorf("'!' requires true or false, not %s", ruleTypeName(value))
+			}
+			return !b, nil
+		case token.SUB:
+			f, ok := ruleNumber(value)
+			if !ok {
+				return nil, fmt.Errorf("'-' requires a number, not %s", ruleTypeName(value))
+			}
+			return -f, nil
+		}
+
+	case *ast.BinaryExpr:
+		return evalRuleBinary(n, env)
+
+	case *ast.CallExpr:
+		fun, ok := n.Fun.(*ast.Ident)
+		if !ok {
+			return nil, fmt.Errorf("only the built-in functions may be called")
+		}
+		f, ok := ruleFunctions[fun.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown function '%s'", fun.Name)
+		}
+		args := make([]interface{}, 0, len(n.Args))
+		for _, arg := range n.Args {
+			value, err := evalRuleExpr(arg, env)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, value)
+		}
+		value, err := f(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", fun.Name, err)
+		}
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("unsupported expression")
+}
+
+// evalRuleBinary evaluates a binary operation
+func evalRuleBinary(n *ast.BinaryExpr, env map[string]interface{}) (interface{}, error) {
+	left, err := evalRuleExpr(n.X, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// The logical operators short-circuit
+	if n.Op == token.LAND || n.Op == token.LOR {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("'%s' requires true or false, not %s", n.Op, ruleTypeName(left))
+		}
+		if (n.Op == token.LAND && !l) || (n.Op == token.LOR && l) {
+			return l, nil
+		}
+		right, err := evalRuleExpr(n.Y, env)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("'%s' requires true or false, not %s", n.Op, ruleTypeName(right))
+		}
+		return r, nil
+	}
+
+	right, err := evalRuleExpr(n.Y, env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case token.EQL:
+		return ruleEqual(left, right), nil
+	case token.NEQ:
+		return !ruleEqual(left, right), nil
+	}
+
+	// Order numbers, or else strings
+	var cmp int
+	l, lok := ruleNumber(left)
+	r, rok := ruleNumber(right)
+	ls, lsok := left.(string)
+	rs, rsok := right.(string)
+	switch {
+	case lok && rok:
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case lsok && rsok:
+		cmp = strings.Compare(ls, rs)
+	default:
+		return nil, fmt.Errorf("cannot compare %s with %s", ruleTypeName(left), ruleTypeName(right))
+	}
+
+	switch n.Op {
+	case token.LSS:
+		return cmp < 0, nil
+	case token.LEQ:
+		return cmp <= 0, nil
+	case token.GTR:
+		return cmp > 0, nil
+	case token.GEQ:
+		return cmp >= 0, nil
+	}
+	return nil, fmt.Errorf("unsupported operator '%s'", n.Op)
+}
+
+// ruleValue converts values from requests to the types conditions work
+// with: strings, numbers as float64, bools, lists, maps and nil
+func ruleValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, float64, []interface{}, map[string]interface{}:
+		return v
+	case []string:
+		ret := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			ret = append(ret, item)
+		}
+		return ret
+	case map[string]string:
+		ret := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			ret[key] = item
+		}
+		return ret
+	}
+	if f, ok := ruleNumber(value); ok {
+		return f
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// ruleNumber returns the value as a number, if it is one. Strings holding a
+// number count, as request data often carries numbers as strings.
+func ruleNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+// ruleIndex returns a field of a map or an item of a list. Missing fields
+// are nil, as are fields of nil, so that conditions can test for them.
+func ruleIndex(base, key interface{}) (interface{}, error) {
+	switch b := base.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		k, ok := key.(string)
+		if !ok {
+			return nil, fmt.Errorf("fields are named by strings, not %s", ruleTypeName(key))
+		}
+		return ruleValue(b[k]), nil
+	case []interface{}:
+		i, ok := ruleNumber(key)
+		if !ok || i != float64(int(i)) {
+			return nil, fmt.Errorf("lists are indexed by whole numbers, not %s", ruleTypeName(key))
+		}
+		if int(i) < 0 || int(i) >= len(b) {
+			return nil, nil
+		}
+		return ruleValue(b[int(i)]), nil
+	}
+	return nil, fmt.Errorf("cannot index %s", ruleTypeName(base))
+}
+
+// ruleEqual compares two values, comparing numbers by value
+func ruleEqual(left, right interface{}) bool {
+	if l, ok := ruleNumber(left); ok {
+		if r, ok := ruleNumber(right); ok {
+			return l == r
+		}
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+func ruleTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return "a string"
+	case bool:
+		return "true or false"
+	case float64:
+		return "a number"
+	case []interface{}:
+		return "a list"
+	case map[string]interface{}:
+		return "a map"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// ruleStringsFunc adapts a function of two strings
+func ruleStringsFunc(f func(a, b string) bool) ruleFunction {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("takes 2 arguments, not %d", len(args))
+		}
+		a, aok := args[0].(string)
+		b, bok := args[1].(string)
+		if args[0] == nil {
+			return false, nil
+		}
+		if !aok || !bok {
+			return nil, fmt.Errorf("takes strings")
+		}
+		return f(a, b), nil
+	}
+}
+
+// ruleContains returns whether a list has an item, a map has a key or a
+// string has a substring
+func ruleContains(args []interface{}) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("takes 2 arguments, not %d", len(args))
+	}
+	switch container := args[0].(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range container {
+			if ruleEqual(ruleValue(item), args[1]) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]interface{}:
+		key, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("map keys are strings, not %s", ruleTypeName(args[1]))
+		}
+		_, ok = container[key]
+		return ok, nil
+	case string:
+		sub, ok := args[1].(string)
+		if !ok {
+			return nil, fmt.Errorf("strings contain strings, not %s", ruleTypeName(args[1]))
+		}
+		return strings.Contains(container, sub), nil
+	}
+	return nil, fmt.Errorf("cannot look in %s", ruleTypeName(args[0]))
+}
+
+// ruleOneOf returns whether the first argument equals any of the others
+func ruleOneOf(args []interface{}) (interface{}, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("takes a value and at least one candidate")
+	}
+	for _, candidate := range args[1:] {
+		if ruleEqual(args[0], candidate) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ruleLen returns the length of a string, list or map
+func ruleLen(args []interface{}) (interface{}, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("takes 1 argument, not %d", len(args))
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return float64(0), nil
+	case string:
+		return float64(len(v)), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("cannot take the length of %s", ruleTypeName(args[0]))
+}
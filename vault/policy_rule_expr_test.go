@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"testing"
+)
+
+func TestRuleCondition_Parse(t *testing.T) {
+	valid := []string{
+		`mfa`,
+		`operation == "read" || time.hour >= 9 && time.hour < 17`,
+		`!has_prefix(path, "secret/prod/") && token.metadata["team"] != nil`,
+		`one_of(time.weekday, "saturday", "sunday") == false`,
+		`len(token.policies) > 1 && contains(token.policies, "admin")`,
+		`glob(remote_addr, "10.0.+.*") && -data.count < 0`,
+	}
+	for _, condition := range valid {
+		if _, err := parseRuleCondition(condition); err != nil {
+			t.Fatalf("%s: %v", condition, err)
+		}
+	}
+
+	invalid := []string{
+		``,
+		`mfa &&`,
+		`os.Exit(1)`,
+		`unknown == 1`,
+		`exec("ls")`,
+		`path + "x"`,
+		`'a' == 'a'`,
+		`func() bool { return true }()`,
+		`data.(string)`,
+	}
+	for _, condition := range invalid {
+		if _, err := parseRuleCondition(condition); err == nil {
+			t.Fatalf("%s: expected error", condition)
+		}
+	}
+}
+
+func TestRuleCondition_Eval(t *testing.T) {
+	env := map[string]interface{}{
+		"operation":   "update",
+		"path":        "secret/prod/db",
+		"remote_addr": "10.0.1.5",
+		"mfa":         false,
+		"data": map[string]interface{}{
+			"count": 3,
+			"tags":  []interface{}{"a", "b"},
+		},
+		"time": map[string]interface{}{
+			"hour":    float64(20),
+			"weekday": "friday",
+		},
+		"token": map[string]interface{}{
+			"policies": []string{"default", "dev"},
+			"metadata": map[string]string{"team": "ops"},
+		},
+	}
+
+	cases := map[string]bool{
+		`operation == "update"`:                               true,
+		`mfa || time.hour >= 9 && time.hour < 17`:             false,
+		`!mfa && has_prefix(path, "secret/prod/")`:            true,
+		`has_suffix(path, "/db")`:                             true,
+		`glob(path, "secret/+/db")`:                           true,
+		`glob(remote_addr, "10.0.2.*")`:                       false,
+		`data.count == 3 && data["count"] > 2.5`:              true,
+		`data.tags[1] == "b" && len(data.tags) == 2`:          true,
+		`data.missing == nil && data.tags[5] == nil`:          true,
+		`token.metadata.team == "ops"`:                        true,
+		`contains(token.policies, "dev")`:                     true,
+		`contains(token.metadata, "owner")`:                   false,
+		`contains(path, "prod")`:                              true,
+		`one_of(time.weekday, "saturday", "sunday")`:          false,
+		`"b" > "a" && -time.hour < 0`:                         true,
+		`false && data.count > "x"`:                           false,
+		`(operation == "read" || operation == "list") == mfa`: true,
+	}
+	for condition, expected := range cases {
+		expr, err := parseRuleCondition(condition)
+		if err != nil {
+			t.Fatalf("%s: %v", condition, err)
+		}
+		actual, err := evalRuleCondition(expr, env)
+		if err != nil {
+			t.Fatalf("%s: %v", condition, err)
+		}
+		if actual != expected {
+			t.Fatalf("%s: expected %v", condition, expected)
+		}
+	}
+
+	// Conditions that cannot be evaluated are errors
+	for _, condition := range []string{
+		`path`,
+		`data.count > "x"`,
+		`path.prefix == "x"`,
+		`data.tags["x"] == "a"`,
+		`has_prefix(data.count, "x")`,
+		`!mfa && data.count`,
+	} {
+		expr, err := parseRuleCondition(condition)
+		if err != nil {
+			t.Fatalf("%s: %v", condition, err)
+		}
+		if _, err := evalRuleCondition(expr, env); err == nil {
+			t.Fatalf("%s: expected error", condition)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestParseRulePolicy(t *testing.T) {
+	p, err := ParseRulePolicy("hours", []string{"/secret/prod/*", "sys/+/mounts"}, `time.hour >= 9`, "America/New_York")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(p.Paths, []string{"secret/prod/*", "sys/+/mounts"}) {
+		t.Fatalf("bad: %#v", p.Paths)
+	}
+	for path, expected := range map[string]bool{
+		"secret/prod/db":  true,
+		"secret/prod":     false,
+		"secret/dev/db":   false,
+		"sys/foo/mounts":  true,
+		"sys/foo/bar/baz": false,
+	} {
+		if p.AppliesTo(path) != expected {
+			t.Fatalf("%s: expected %v", path, expected)
+		}
+	}
+
+	// The time is given in the policy's time zone: 13:00 UTC is 9:00 in New
+	// York in the summer
+	req := &logical.Request{Operation: logical.ReadOperation, Path: "secret/prod/db"}
+	now := time.Date(2016, 7, 1, 13, 0, 0, 0, time.UTC)
+	if allowed, err := p.Allows(req, nil, now); err != nil || !allowed {
+		t.Fatalf("should be allowed: %v", err)
+	}
+	if allowed, err := p.Allows(req, nil, now.Add(-time.Minute)); err != nil || allowed {
+		t.Fatalf("should be denied: %v", err)
+	}
+
+	if _, err := ParseRulePolicy("bad", nil, `mfa`, ""); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := ParseRulePolicy("bad", []string{"secret/*"}, `mfa ==`, ""); err == nil {
+		t.Fatalf("expected error")
+	}
+	if _, err := ParseRulePolicy("bad", []string{"secret/*"}, `mfa`, "Mars/Olympus"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPolicyStore_RulePolicies(t *testing.T) {
+	ps := mockPolicyStore(t)
+	_, barrier, _ := mockBarrier(t)
+	ps.SetRuleView(NewBarrierView(barrier, "foo-rule/"))
+
+	p, err := ParseRulePolicy("prod-mfa", []string{"secret/prod/*"}, `operation == "read" || mfa`, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ps.SetRulePolicy(p); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	out, err := ps.GetRulePolicy("prod-mfa")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Condition != p.Condition || !reflect.DeepEqual(out.Paths, p.Paths) {
+		t.Fatalf("bad: %#v", out)
+	}
+	names, err := ps.ListRulePolicies()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"prod-mfa"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	write := &logical.Request{Operation: logical.UpdateOperation, Path: "secret/prod/db"}
+	te := &TokenEntry{Policies: []string{"dev"}}
+	if denied, err := ps.CheckRulePolicies(write, te); err != nil || denied != "prod-mfa" {
+		t.Fatalf("bad: %q %v", denied, err)
+	}
+
+	// Metadata can be set by whoever creates a token, so it does not tell
+	// whether MFA was passed
+	te.Meta = map[string]string{"mfa": "duo"}
+	if denied, err := ps.CheckRulePolicies(write, te); err != nil || denied != "prod-mfa" {
+		t.Fatalf("bad: %q %v", denied, err)
+	}
+
+	// Tokens obtained with MFA are recorded at login
+	te.MFA = true
+	if denied, err := ps.CheckRulePolicies(write, te); err != nil || denied != "" {
+		t.Fatalf("bad: %q %v", denied, err)
+	}
+
+	// Other paths are not checked
+	te.MFA = false
+	write.Path = "secret/dev/db"
+	if denied, err := ps.CheckRulePolicies(write, te); err != nil || denied != "" {
+		t.Fatalf("bad: %q %v", denied, err)
+	}
+
+	if err := ps.DeleteRulePolicy("prod-mfa"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	write.Path = "secret/prod/db"
+	if denied, err := ps.CheckRulePolicies(write, te); err != nil || denied != "" {
+		t.Fatalf("bad: %q %v", denied, err)
+	}
+	if out, _ := ps.GetRulePolicy("prod-mfa"); out != nil {
+		t.Fatalf("bad: %#v", out)
+	}
+}
@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minutesPerDay = 24 * 60
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeSchedule is a set of weekly windows of time, used to limit when a path
+// rule of a policy applies.
+type TimeSchedule struct {
+	Windows  []*TimeWindow
+	Location *time.Location
+}
+
+// TimeWindow is a span of time on some days of the week. Start and End are
+// minutes since midnight. If End is not after Start, the window runs past
+// midnight into the following day.
+type TimeWindow struct {
+	Days  [7]bool
+	Start int
+	End   int
+}
+
+// ParseTimeSchedule parses windows such as "Mon-Fri 09:00-17:00", in the
+// named time zone, which is UTC if empty. Days are given as a single day, a
+// range such as "Fri-Mon", a comma separated list of either, or "*" for
+// every day. The times may be left out to cover the whole of each day.
+func ParseTimeSchedule(windows []string, zone string) (*TimeSchedule, error) {
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no time windows given")
+	}
+
+	s := &TimeSchedule{Location: time.UTC}
+	if zone != "" {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time zone '%s': %v", zone, err)
+		}
+		s.Location = loc
+	}
+
+	for _, raw := range windows {
+		w, err := parseTimeWindow(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time window '%s': %v", raw, err)
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	return s, nil
+}
+
+func parseTimeWindow(raw string) (*TimeWindow, error) {
+	fields := strings.Fields(raw)
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("expected days and an optional time range")
+	}
+
+	w := &TimeWindow{Start: 0, End: minutesPerDay}
+	if fields[0] == "*" {
+		for i := range w.Days {
+			w.Days[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(fields[0], ",") {
+			first, last, err := parseWeekdayRange(part)
+			if err != nil {
+				return nil, err
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				w.Days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+
+	if len(fields) == 1 {
+		return w, nil
+	}
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("expected a time range such as 09:00-17:00")
+	}
+	var err error
+	if w.Start, err = parseTimeOfDay(times[0]); err != nil {
+		return nil, err
+	}
+	if w.End, err = parseTimeOfDay(times[1]); err != nil {
+		return nil, err
+	}
+	if w.Start == minutesPerDay {
+		return nil, fmt.Errorf("a window cannot start at 24:00")
+	}
+	if w.Start == w.End {
+		return nil, fmt.Errorf("a window cannot start and end at the same time")
+	}
+	return w, nil
+}
+
+func parseWeekdayRange(raw string) (time.Weekday, time.Weekday, error) {
+	days := strings.Split(raw, "-")
+	if len(days) > 2 {
+		return 0, 0, fmt.Errorf("invalid days '%s'", raw)
+	}
+	first, ok := weekdayNames[strings.ToLower(days[0])]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid day '%s'", days[0])
+	}
+	if len(days) == 1 {
+		return first, first, nil
+	}
+	last, ok := weekdayNames[strings.ToLower(days[1])]
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid day '%s'", days[1])
+	}
+	return first, last, nil
+}
+
+// parseTimeOfDay parses a time such as "17:30" into minutes since midnight.
+// "24:00" is accepted as the end of the day.
+func parseTimeOfDay(raw string) (int, error) {
+	parts := strings.Split(raw, ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("invalid time '%s'", raw)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s'", raw)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s'", raw)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time '%s'", raw)
+	}
+	return hour*60 + minute, nil
+}
+
+// Contains returns whether the given time falls in any window of the schedule
+func (s *TimeSchedule) Contains(t time.Time) bool {
+	t = t.In(s.Location)
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	yesterday := (day + 6) % 7
+	for _, w := range s.Windows {
+		if w.Start < w.End {
+			if w.Days[day] && minute >= w.Start && minute < w.End {
+				return true
+			}
+			continue
+		}
+
+		// The window runs past midnight
+		if (w.Days[day] && minute >= w.Start) || (w.Days[yesterday] && minute < w.End) {
+			return true
+		}
+	}
+	return false
+}
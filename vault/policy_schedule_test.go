@@ -0,0 +1,65 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeSchedule(t *testing.T) {
+	type tcase struct {
+		windows []string
+		zone    string
+		time    string
+		in      bool
+	}
+	// 2016-08-01 is a Monday
+	tcases := []tcase{
+		{[]string{"Mon-Fri 09:00-17:00"}, "", "2016-08-01T09:00:00Z", true},
+		{[]string{"Mon-Fri 09:00-17:00"}, "", "2016-08-01T08:59:00Z", false},
+		{[]string{"Mon-Fri 09:00-17:00"}, "", "2016-08-06T10:00:00Z", false},
+		{[]string{"sat,SUN"}, "", "2016-08-07T23:59:00Z", true},
+		{[]string{"Fri-Mon"}, "", "2016-08-02T10:00:00Z", false},
+		{[]string{"Fri-Mon"}, "", "2016-08-01T10:00:00Z", true},
+		{[]string{"Fri 22:00-02:00"}, "", "2016-08-06T01:00:00Z", true},
+		{[]string{"Fri 22:00-02:00"}, "", "2016-08-05T01:00:00Z", false},
+		{[]string{"* 18:00-24:00"}, "", "2016-08-03T23:59:00Z", true},
+		{[]string{"Tue 12:00-13:00", "Wed"}, "", "2016-08-03T00:00:00Z", true},
+		{[]string{"Mon-Fri 09:00-17:00"}, "America/New_York", "2016-08-01T14:00:00Z", true},
+		{[]string{"Mon-Fri 09:00-17:00"}, "America/New_York", "2016-08-01T22:00:00Z", false},
+	}
+
+	for _, tc := range tcases {
+		s, err := ParseTimeSchedule(tc.windows, tc.zone)
+		if err != nil {
+			t.Fatalf("err: case %#v: %v", tc, err)
+		}
+		now, err := time.Parse(time.RFC3339, tc.time)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if in := s.Contains(now); in != tc.in {
+			t.Fatalf("bad: case %#v: %v", tc, in)
+		}
+	}
+
+	invalid := [][]string{
+		nil,
+		{""},
+		{"Someday"},
+		{"Mon-Tue-Wed"},
+		{"Mon 9-17"},
+		{"Mon 09:00"},
+		{"Mon 09:00-25:00"},
+		{"Mon 24:00-01:00"},
+		{"Mon 09:00-09:00"},
+		{"Mon 09:00-17:00 extra"},
+	}
+	for _, windows := range invalid {
+		if _, err := ParseTimeSchedule(windows, ""); err == nil {
+			t.Fatalf("expected error for %#v", windows)
+		}
+	}
+	if _, err := ParseTimeSchedule([]string{"Mon"}, "Nowhere/Special"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
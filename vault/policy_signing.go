@@ -0,0 +1,127 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/hashicorp/vault/logical"
+	"github.com/keybase/go-crypto/openpgp"
+)
+
+const (
+	// policySigningSubPath is the sub-path used to store the policy signing
+	// configuration, nested under the system view.
+	policySigningSubPath = "policy-signing/"
+
+	// policySigningConfigKey is the key of the signing configuration
+	policySigningConfigKey = "config"
+)
+
+// PolicySigningConfig holds the PGP keys trusted to sign policies
+type PolicySigningConfig struct {
+	// TrustedKeys are base64-encoded PGP public keys. A signed policy must be
+	// signed by one of them.
+	TrustedKeys []string `json:"trusted_keys"`
+
+	// Required rejects policies that are not signed
+	Required bool `json:"required"`
+}
+
+// SetSigningView provides the policy store with the view used to store the
+// keys trusted to sign policies.
+func (ps *PolicyStore) SetSigningView(view *BarrierView) {
+	ps.signingView = view
+}
+
+// SigningConfig returns the policy signing configuration, which is empty if
+// none was set.
+func (ps *PolicyStore) SigningConfig() (*PolicySigningConfig, error) {
+	config := &PolicySigningConfig{}
+	if ps.signingView == nil {
+		return config, nil
+	}
+
+	out, err := ps.signingView.Get(policySigningConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy signing config: %v", err)
+	}
+	if out == nil {
+		return config, nil
+	}
+	if err := out.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("failed to decode policy signing config: %v", err)
+	}
+	return config, nil
+}
+
+// SetSigningConfig checks and stores the policy signing configuration
+func (ps *PolicyStore) SetSigningConfig(config *PolicySigningConfig) error {
+	if ps.signingView == nil {
+		return fmt.Errorf("policy signing is not available")
+	}
+	if config.Required && len(config.TrustedKeys) == 0 {
+		return fmt.Errorf("signatures cannot be required without trusted keys")
+	}
+	if _, err := pgpkeys.GetEntities(config.TrustedKeys); err != nil {
+		return err
+	}
+
+	entry, err := logical.StorageEntryJSON(policySigningConfigKey, config)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := ps.signingView.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist policy signing config: %v", err)
+	}
+	return nil
+}
+
+// verifyPolicySignature checks the signature of a policy against the trusted
+// keys, setting the fingerprint of the signing key. Unsigned policies are
+// rejected if signatures are required.
+func (ps *PolicyStore) verifyPolicySignature(p *Policy) error {
+	p.SignedBy = ""
+
+	config, err := ps.SigningConfig()
+	if err != nil {
+		return err
+	}
+	if p.Signature == "" {
+		if config.Required {
+			return fmt.Errorf("policy '%s' must be signed", p.Name)
+		}
+		return nil
+	}
+	if len(config.TrustedKeys) == 0 {
+		return fmt.Errorf("no keys are trusted to sign policies")
+	}
+
+	entities, err := pgpkeys.GetEntities(config.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	keyring := openpgp.EntityList(entities)
+
+	// The signature may be armored, as made by "gpg --armor --detach-sign",
+	// or binary and base64-encoded
+	var signer *openpgp.Entity
+	rules := strings.NewReader(p.Raw)
+	if strings.HasPrefix(strings.TrimSpace(p.Signature), "-----BEGIN") {
+		signer, err = openpgp.CheckArmoredDetachedSignature(keyring, rules, strings.NewReader(p.Signature))
+	} else {
+		sig, decodeErr := base64.StdEncoding.DecodeString(p.Signature)
+		if decodeErr != nil {
+			return fmt.Errorf("failed to decode signature of policy '%s': %v", p.Name, decodeErr)
+		}
+		signer, err = openpgp.CheckDetachedSignature(keyring, rules, bytes.NewReader(sig))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid signature for policy '%s': %v", p.Name, err)
+	}
+
+	p.SignedBy = fmt.Sprintf("%x", signer.PrimaryKey.Fingerprint)
+	return nil
+}
@@ -0,0 +1,99 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/packet"
+)
+
+// testSignPolicy returns a base64-encoded detached signature of the rules
+// made with the given base64-encoded private key
+func testSignPolicy(t *testing.T, privKey, rules string) string {
+	keyBytes, err := base64.StdEncoding.DecodeString(privKey)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entity, err := openpgp.ReadEntity(packet.NewReader(bytes.NewBuffer(keyBytes)))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := openpgp.DetachSign(&buf, entity, strings.NewReader(rules), nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestPolicyStore_Signing(t *testing.T) {
+	ps := mockPolicyStore(t)
+	_, barrier, _ := mockBarrier(t)
+	ps.SetSigningView(NewBarrierView(barrier, "foo-signing/"))
+
+	rules := `path "secret/*" { policy = "read" }`
+	sig := testSignPolicy(t, pgpkeys.TestPrivKey1, rules)
+
+	// Without trusted keys, a signature cannot be checked
+	policy, _ := Parse(rules)
+	policy.Name = "dev"
+	policy.Signature = sig
+	if err := ps.SetPolicy(policy); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Signatures cannot be required without keys
+	if err := ps.SetSigningConfig(&PolicySigningConfig{Required: true}); err == nil {
+		t.Fatalf("expected error")
+	}
+	err := ps.SetSigningConfig(&PolicySigningConfig{
+		TrustedKeys: []string{pgpkeys.TestPubKey1, pgpkeys.TestPubKey2},
+		Required:    true,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A valid signature is stored along with the signer
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	fingerprints, err := pgpkeys.GetFingerprints([]string{pgpkeys.TestPubKey1}, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ps.Purge()
+	p, err := ps.GetPolicy("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Signature != sig || p.SignedBy != fingerprints[0] {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	// Unsigned policies are rejected
+	unsigned, _ := Parse(rules)
+	unsigned.Name = "ops"
+	if err := ps.SetPolicy(unsigned); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// So are policies signed by untrusted keys, or whose rules changed
+	unsigned.Signature = testSignPolicy(t, pgpkeys.TestPrivKey3, rules)
+	if err := ps.SetPolicy(unsigned); err == nil {
+		t.Fatalf("expected error")
+	}
+	changed, _ := Parse(`path "secret/*" { policy = "write" }`)
+	changed.Name = "ops"
+	changed.Signature = sig
+	if err := ps.SetPolicy(changed); err == nil {
+		t.Fatalf("expected error")
+	}
+	if p, _ := ps.GetPolicy("ops"); p != nil {
+		t.Fatalf("bad: %#v", p)
+	}
+}
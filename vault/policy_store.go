@@ -2,10 +2,15 @@ package vault
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/golang-lru"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
@@ -16,9 +21,26 @@ const (
 	// view. This is nested under the system view.
 	policySubPath = "policy/"
 
+	// policyGroupSubPath is the sub-path used for policy groups, nested
+	// under the system view next to the policy store view.
+	policyGroupSubPath = "policy-group/"
+
 	// policyCacheSize is the number of policies that are kept cached
 	policyCacheSize = 1024
 
+	// aclCacheSize is the number of ACLs, one for each set of policies,
+	// that are kept cached
+	aclCacheSize = 1024
+
+	// rootPolicy describes what the root policy grants. It is only shown
+	// when reading the policy; tokens with the root policy are allowed
+	// everything regardless of its rules.
+	rootPolicy = `
+path "*" {
+    capabilities = ["create", "read", "update", "patch", "delete", "list", "sudo"]
+}
+`
+
 	// cubbyholeResponseWrappingPolicyName is the name of the fixed policy
 	cubbyholeResponseWrappingPolicyName = "response-wrapping"
 
@@ -56,6 +78,10 @@ path "sys/capabilities-self" {
     capabilities = ["update"]
 }
 
+path "sys/control-group/request" {
+    capabilities = ["update"]
+}
+
 path "sys/renew" {
     capabilities = ["update"]
 }
@@ -81,23 +107,92 @@ var (
 type PolicyStore struct {
 	view *BarrierView
 	lru  *lru.TwoQueueCache
+
+	// groupView and groupLRU store and cache policy groups
+	groupView *BarrierView
+	groupLRU  *lru.TwoQueueCache
+
+	// expiration deletes policies that expire, if set
+	expiration *ExpirationManager
+
+	// signingView stores the keys trusted to sign policies, if set
+	signingView *BarrierView
+
+	// usage records how often each policy allowed a request since the
+	// policy store was set up
+	usage     map[string]*PolicyUsage
+	usageLock sync.Mutex
+
+	// ruleView stores rule policies, which are kept loaded in rules once
+	// read, if set
+	ruleView *BarrierView
+	rules    []*RulePolicy
+	ruleLock sync.RWMutex
+
+	// trashView keeps deleted policies until they are purged, if set
+	trashView *BarrierView
+
+	// passwordView stores password policies, if set
+	passwordView *BarrierView
+
+	// rateBuckets hold what each token may still request with each rate
+	// limited policy, keyed by token ID and policy name
+	rateBuckets map[string]*rateBucket
+	rateSwept   time.Time
+	rateLock    sync.Mutex
+
+	// aclLRU caches the ACLs built from sets of policies, keyed by the
+	// sorted policy names. It is purged whenever a policy changes, which
+	// also bumps aclGeneration, so that ACLs built from policies read
+	// before the change are not cached.
+	aclLRU        *lru.TwoQueueCache
+	aclGeneration uint32
+}
+
+// aclCacheEntry is an ACL cached for a set of policies
+type aclCacheEntry struct {
+	acl *ACL
+
+	// expireTime is when the first of the policies expires, after which
+	// the ACL must be built again, or zero if none of them expire
+	expireTime time.Time
 }
 
 // PolicyEntry is used to store a policy by name
 type PolicyEntry struct {
-	Version int
-	Raw     string
+	Version  int
+	Raw      string
+	Syntax   string
+	Metadata map[string]string
+
+	ExpireTime     time.Time
+	DeleteOnExpire bool
+
+	Shadow bool
+
+	Signature string
+	SignedBy  string
 }
 
 // NewPolicyStore creates a new PolicyStore that is backed
 // using a given view. It used used to durable store and manage named policy.
-func NewPolicyStore(view *BarrierView, system logical.SystemView) *PolicyStore {
+// Policy groups are stored in the group view. Up to cacheSize policies and
+// groups are cached, or policyCacheSize if zero.
+func NewPolicyStore(view, groupView *BarrierView, system logical.SystemView, cacheSize int) *PolicyStore {
 	p := &PolicyStore{
-		view: view,
+		view:      view,
+		groupView: groupView,
+	}
+	if cacheSize == 0 {
+		cacheSize = policyCacheSize
 	}
 	if !system.CachingDisabled() {
-		cache, _ := lru.New2Q(policyCacheSize)
+		cache, _ := lru.New2Q(cacheSize)
 		p.lru = cache
+		groupCache, _ := lru.New2Q(cacheSize)
+		p.groupLRU = groupCache
+		aclCache, _ := lru.New2Q(aclCacheSize)
+		p.aclLRU = aclCache
 	}
 
 	return p
@@ -108,9 +203,14 @@ func NewPolicyStore(view *BarrierView, system logical.SystemView) *PolicyStore {
 func (c *Core) setupPolicyStore() error {
 	// Create a sub-view
 	view := c.systemBarrierView.SubView(policySubPath)
+	groupView := c.systemBarrierView.SubView(policyGroupSubPath)
 
 	// Create the policy store
-	c.policyStore = NewPolicyStore(view, &dynamicSystemView{core: c})
+	c.policyStore = NewPolicyStore(view, groupView, &dynamicSystemView{core: c}, c.policyCacheSize)
+	c.policyStore.SetSigningView(c.systemBarrierView.SubView(policySigningSubPath))
+	c.policyStore.SetRuleView(c.systemBarrierView.SubView(policyRuleSubPath))
+	c.policyStore.SetTrashView(c.systemBarrierView.SubView(policyTrashSubPath))
+	c.policyStore.SetPasswordView(c.systemBarrierView.SubView(policyPasswordSubPath))
 
 	// Ensure that the default policy exists, and if not, create it
 	policy, err := c.policyStore.GetPolicy("default")
@@ -140,7 +240,9 @@ func (c *Core) setupPolicyStore() error {
 }
 
 // teardownPolicyStore is used to reverse setupPolicyStore
-// when the vault is being sealed.
+// when the vault is being sealed. This also happens when stepping down to
+// standby, which discards the cached policies and groups, so a node never
+// serves policies that were changed by another node while it was a standby.
 func (c *Core) teardownPolicyStore() error {
 	c.policyStore = nil
 	return nil
@@ -156,14 +258,35 @@ func (ps *PolicyStore) SetPolicy(p *Policy) error {
 		return fmt.Errorf("cannot update %s policy", p.Name)
 	}
 
+	// Policies and groups share names, as tokens may be given either
+	group, err := ps.GetGroup(p.Name)
+	if err != nil {
+		return err
+	}
+	if group != nil {
+		return fmt.Errorf("a policy group named %s exists", p.Name)
+	}
+
+	// Check the signature against the trusted keys, if any
+	if err := ps.verifyPolicySignature(p); err != nil {
+		return err
+	}
+
 	return ps.setPolicyInternal(p)
 }
 
 func (ps *PolicyStore) setPolicyInternal(p *Policy) error {
 	// Create the entry
 	entry, err := logical.StorageEntryJSON(p.Name, &PolicyEntry{
-		Version: 2,
-		Raw:     p.Raw,
+		Version:        2,
+		Raw:            p.Raw,
+		Syntax:         p.Syntax,
+		Metadata:       p.Metadata,
+		ExpireTime:     p.ExpireTime,
+		DeleteOnExpire: p.DeleteOnExpire,
+		Shadow:         p.Shadow,
+		Signature:      p.Signature,
+		SignedBy:       p.SignedBy,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create entry: %v", err)
@@ -176,9 +299,26 @@ func (ps *PolicyStore) setPolicyInternal(p *Policy) error {
 		// Update the LRU cache
 		ps.lru.Add(p.Name, p)
 	}
+	// Any cached ACL may have been built with the old policy
+	ps.purgeACLs()
+
+	if ps.expiration != nil {
+		// Schedule or cancel the deletion of the policy
+		var deleteTime time.Time
+		if p.DeleteOnExpire {
+			deleteTime = p.ExpireTime
+		}
+		ps.expiration.RegisterPolicy(p.Name, deleteTime)
+	}
 	return nil
 }
 
+// SetExpirationManager is used to provide the policy store with an
+// expiration manager, which deletes policies that expire.
+func (ps *PolicyStore) SetExpirationManager(exp *ExpirationManager) {
+	ps.expiration = exp
+}
+
 // GetPolicy is used to fetch the named policy
 func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 	defer metrics.MeasureSince([]string{"policy", "get_policy"}, time.Now())
@@ -189,12 +329,86 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 		}
 	}
 
+	policy, err := ps.loadPolicy(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if ps.lru != nil && policy != nil {
+		// Update the LRU cache
+		ps.lru.Add(name, policy)
+	}
+
+	return policy, nil
+}
+
+// GetPolicies is used to fetch several named policies at once. Policies that
+// are not cached are loaded concurrently. The returned policies are in the
+// same order as the names, and are nil for policies that do not exist.
+func (ps *PolicyStore) GetPolicies(names []string) ([]*Policy, error) {
+	defer metrics.MeasureSince([]string{"policy", "get_policies"}, time.Now())
+	policies := make([]*Policy, len(names))
+
+	// Find the policies that have to be loaded, loading each only once
+	missing := make(map[string][]int)
+	for i, name := range names {
+		if ps.lru != nil {
+			if raw, ok := ps.lru.Get(name); ok {
+				policies[i] = raw.(*Policy)
+				continue
+			}
+		}
+		missing[name] = append(missing[name], i)
+	}
+	if len(missing) == 0 {
+		return policies, nil
+	}
+
+	type loadResult struct {
+		name   string
+		policy *Policy
+		err    error
+	}
+	results := make(chan loadResult, len(missing))
+	for name := range missing {
+		go func(name string) {
+			policy, err := ps.loadPolicy(name)
+			results <- loadResult{name: name, policy: policy, err: err}
+		}(name)
+	}
+
+	var errs *multierror.Error
+	for range missing {
+		result := <-results
+		if result.err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to get policy '%s': %v", result.name, result.err))
+			continue
+		}
+		for _, i := range missing[result.name] {
+			policies[i] = result.policy
+		}
+		if ps.lru != nil && result.policy != nil {
+			// Update the LRU cache
+			ps.lru.Add(result.name, result.policy)
+		}
+	}
+	if errs != nil {
+		return nil, errs.ErrorOrNil()
+	}
+
+	return policies, nil
+}
+
+// loadPolicy reads and parses the named policy from storage, bypassing the
+// cache. It returns nil if the policy does not exist.
+func (ps *PolicyStore) loadPolicy(name string) (*Policy, error) {
 	// Special case the root policy
 	if name == "root" {
-		p := &Policy{Name: "root"}
-		if ps.lru != nil {
-			ps.lru.Add(p.Name, p)
+		p, err := Parse(rootPolicy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse root policy: %v", err)
 		}
+		p.Name = "root"
 		return p, nil
 	}
 
@@ -213,11 +427,17 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 	var policy *Policy
 	if err := out.DecodeJSON(policyEntry); err == nil {
 		// Parse normally
-		p, err := Parse(policyEntry.Raw)
+		p, err := ParseSyntax(policyEntry.Raw, policyEntry.Syntax)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse policy: %v", err)
 		}
 		p.Name = name
+		p.Metadata = policyEntry.Metadata
+		p.ExpireTime = policyEntry.ExpireTime
+		p.DeleteOnExpire = policyEntry.DeleteOnExpire
+		p.Shadow = policyEntry.Shadow
+		p.Signature = policyEntry.Signature
+		p.SignedBy = policyEntry.SignedBy
 		policy = p
 
 	} else {
@@ -235,11 +455,6 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 		policy = p
 	}
 
-	if ps.lru != nil {
-		// Update the LRU cache
-		ps.lru.Add(name, policy)
-	}
-
 	return policy, nil
 }
 
@@ -278,6 +493,10 @@ func (ps *PolicyStore) DeletePolicy(name string) error {
 	if name == "default" {
 		return fmt.Errorf("cannot delete default policy")
 	}
+	// Keep the policy so that it can be restored for a while
+	if err := ps.trashPolicy(name); err != nil {
+		return err
+	}
 	if err := ps.view.Delete(name); err != nil {
 		return fmt.Errorf("failed to delete policy: %v", err)
 	}
@@ -286,20 +505,67 @@ func (ps *PolicyStore) DeletePolicy(name string) error {
 		// Clear the cache
 		ps.lru.Remove(name)
 	}
+	ps.purgeACLs()
+	ps.forgetUsage(name)
+
+	if ps.expiration != nil {
+		// Cancel any scheduled deletion
+		ps.expiration.RegisterPolicy(name, time.Time{})
+	}
 	return nil
 }
 
 // ACL is used to return an ACL which is built using the
 // named policies.
 func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
-	// Fetch the policies
-	var policy []*Policy
-	for _, name := range names {
-		p, err := ps.GetPolicy(name)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get policy '%s': %v", name, err)
+	return ps.identityACL(nil, names...)
+}
+
+// identityACL is used to return an ACL which is built using the named
+// policies, with any templated paths resolved against the given identity.
+// ACLs are cached for each set of policies, unless they depend on the
+// identity.
+func (ps *PolicyStore) identityACL(ident *policyIdentity, names ...string) (*ACL, error) {
+	// Expand policy groups and fetch the policies
+	names, err := ps.ExpandGroups(names)
+	if err != nil {
+		return nil, err
+	}
+
+	key := aclCacheKey(names)
+	if ps.aclLRU != nil {
+		if raw, ok := ps.aclLRU.Get(key); ok {
+			entry := raw.(*aclCacheEntry)
+			if entry.expireTime.IsZero() || time.Now().Before(entry.expireTime) {
+				return entry.acl, nil
+			}
+			ps.aclLRU.Remove(key)
+		}
+	}
+
+	generation := atomic.LoadUint32(&ps.aclGeneration)
+	policy, err := ps.GetPolicies(names)
+	if err != nil {
+		return nil, err
+	}
+	cacheable := true
+	var expireTime time.Time
+	for i, p := range policy {
+		if p == nil {
+			continue
+		}
+		// Expired policies no longer grant anything
+		if p.Expired() {
+			policy[i] = nil
+			continue
+		}
+		if !p.ExpireTime.IsZero() && (expireTime.IsZero() || p.ExpireTime.Before(expireTime)) {
+			expireTime = p.ExpireTime
 		}
-		policy = append(policy, p)
+		if p.Templated() {
+			cacheable = false
+		}
+		policy[i] = p.resolveTemplates(ident)
 	}
 
 	// Construct the ACL
@@ -307,9 +573,51 @@ func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to construct ACL: %v", err)
 	}
+	acl.allowHook = ps.recordAllowed
+
+	if ps.aclLRU != nil && cacheable && atomic.LoadUint32(&ps.aclGeneration) == generation {
+		ps.aclLRU.Add(key, &aclCacheEntry{
+			acl:        acl,
+			expireTime: expireTime,
+		})
+	}
 	return acl, nil
 }
 
+// Purge clears the cached policies, policy groups and ACLs, so that they are
+// read from storage again
+func (ps *PolicyStore) Purge() {
+	if ps.lru != nil {
+		ps.lru.Purge()
+	}
+	if ps.groupLRU != nil {
+		ps.groupLRU.Purge()
+	}
+	ps.purgeACLs()
+
+	ps.ruleLock.Lock()
+	ps.rules = nil
+	ps.ruleLock.Unlock()
+}
+
+// purgeACLs clears the cached ACLs, as they may have been built with a
+// policy that has changed
+func (ps *PolicyStore) purgeACLs() {
+	atomic.AddUint32(&ps.aclGeneration, 1)
+	if ps.aclLRU != nil {
+		ps.aclLRU.Purge()
+	}
+}
+
+// aclCacheKey returns the key an ACL built from the named policies is
+// cached under, which does not depend on their order.
+func aclCacheKey(names []string) string {
+	sorted := make([]string, len(names))
+	copy(sorted, names)
+	sort.Strings(sorted)
+	return strings.Join(sorted, "\n")
+}
+
 func (ps *PolicyStore) createDefaultPolicy() error {
 	policy, err := Parse(defaultPolicy)
 	if err != nil {
@@ -3,6 +3,7 @@ package vault
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 )
@@ -10,7 +11,8 @@ import (
 func mockPolicyStore(t *testing.T) *PolicyStore {
 	_, barrier, _ := mockBarrier(t)
 	view := NewBarrierView(barrier, "foo/")
-	p := NewPolicyStore(view, logical.TestSystemView())
+	groupView := NewBarrierView(barrier, "foo-group/")
+	p := NewPolicyStore(view, groupView, logical.TestSystemView(), 0)
 	return p
 }
 
@@ -19,7 +21,8 @@ func mockPolicyStoreNoCache(t *testing.T) *PolicyStore {
 	sysView.CachingDisabledVal = true
 	_, barrier, _ := mockBarrier(t)
 	view := NewBarrierView(barrier, "foo/")
-	p := NewPolicyStore(view, sysView)
+	groupView := NewBarrierView(barrier, "foo-group/")
+	p := NewPolicyStore(view, groupView, sysView, 0)
 	return p
 }
 
@@ -37,6 +40,17 @@ func TestPolicyStore_Root(t *testing.T) {
 	if p.Name != "root" {
 		t.Fatalf("bad: %v", p)
 	}
+	if p.Raw != rootPolicy || len(p.Paths) != 1 || p.Paths[0].Prefix != "" || !p.Paths[0].Glob {
+		t.Fatalf("bad: %#v", p)
+	}
+
+	// The rules list every capability but deny
+	for cap, bit := range cap2Int {
+		granted := p.Paths[0].CapabilitiesBitmap&bit != 0
+		if granted == (cap == DenyCapability) {
+			t.Fatalf("bad: %q: %v", cap, p.Paths[0].Capabilities)
+		}
+	}
 
 	// Set should fail
 	err = ps.SetPolicy(p)
@@ -194,6 +208,148 @@ func TestPolicyStore_ACL(t *testing.T) {
 	testLayeredACL(t, acl)
 }
 
+func TestPolicyStore_ACLCache(t *testing.T) {
+	ps := mockPolicyStore(t)
+
+	policy, _ := Parse(aclPolicy)
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy, _ = Parse(aclPolicy2)
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The same set of policies in any order shares an ACL
+	acl1, err := ps.ACL("dev", "ops")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl2, err := ps.ACL("ops", "dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if acl1 != acl2 {
+		t.Fatalf("expected cached ACL")
+	}
+
+	// Changing a policy purges the cache
+	policy, _ = Parse(`path "dev/*" { policy = "deny" }`)
+	policy.Name = "ops"
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl3, err := ps.ACL("dev", "ops")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if acl3 == acl1 {
+		t.Fatalf("expected new ACL")
+	}
+	if allowed, _ := acl3.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "dev/foo"}); allowed {
+		t.Fatalf("bad: stale ACL")
+	}
+
+	if err := ps.DeletePolicy("ops"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl4, err := ps.ACL("dev", "ops")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if allowed, _ := acl4.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "dev/foo"}); !allowed {
+		t.Fatalf("bad: stale ACL")
+	}
+
+	// ACLs are not cached past the expiration of a policy
+	p, err := ps.GetPolicy("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p.ExpireTime = time.Now().Add(50 * time.Millisecond)
+	if err := ps.SetPolicy(p); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := ps.ACL("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	acl5, err := ps.ACL("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if allowed, _ := acl5.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "dev/foo"}); allowed {
+		t.Fatalf("bad: expired policy still applies")
+	}
+}
+
+func TestPolicyStore_GetPolicies(t *testing.T) {
+	testPolicyStore_GetPolicies(t, mockPolicyStore(t))
+	testPolicyStore_GetPolicies(t, mockPolicyStoreNoCache(t))
+}
+
+func testPolicyStore_GetPolicies(t *testing.T, ps *PolicyStore) {
+	for _, raw := range []string{aclPolicy, aclPolicy2} {
+		policy, _ := Parse(raw)
+		if err := ps.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if ps.lru != nil {
+		ps.lru.Purge()
+	}
+
+	names := []string{"ops", "missing", "root", "dev", "ops"}
+	policies, err := ps.GetPolicies(names)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(policies) != len(names) {
+		t.Fatalf("bad: %#v", policies)
+	}
+	for i, name := range names {
+		if name == "missing" {
+			if policies[i] != nil {
+				t.Fatalf("bad: %#v", policies[i])
+			}
+			continue
+		}
+		if policies[i] == nil || policies[i].Name != name {
+			t.Fatalf("bad: %d: %#v", i, policies[i])
+		}
+	}
+
+	// The loaded policies should now be cached
+	if ps.lru != nil {
+		for _, name := range []string{"ops", "root", "dev"} {
+			if !ps.lru.Contains(name) {
+				t.Fatalf("expected %s to be cached", name)
+			}
+		}
+		if ps.lru.Contains("missing") {
+			t.Fatalf("missing policy should not be cached")
+		}
+	}
+}
+
+func TestPolicyStore_Metadata(t *testing.T) {
+	ps := mockPolicyStoreNoCache(t)
+
+	policy, _ := Parse(aclPolicy)
+	policy.Metadata = map[string]string{"owner": "team-a"}
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	p, err := ps.GetPolicy("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(p.Metadata, policy.Metadata) {
+		t.Fatalf("bad: %#v", p.Metadata)
+	}
+}
+
 func TestPolicyStore_v1Upgrade(t *testing.T) {
 	ps := mockPolicyStore(t)
 
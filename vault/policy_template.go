@@ -0,0 +1,152 @@
+package vault
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Placeholders that may be used in templated policy paths
+	templateEntityID       = "identity.entity.id"
+	templateEntityName     = "identity.entity.name"
+	templateEntityMetadata = "identity.entity.metadata."
+)
+
+var (
+	// templatePlaceholderRegex matches a {{placeholder}} in a policy path
+	templatePlaceholderRegex = regexp.MustCompile(`{{\s*([^{}]*?)\s*}}`)
+)
+
+// policyIdentity holds the values that placeholders in templated policy
+// paths are resolved against.
+type policyIdentity struct {
+	EntityID   string
+	EntityName string
+	Metadata   map[string]string
+}
+
+// identityForToken returns the identity used to resolve templated policies
+// for the given token. The entity name is the display name of the login the
+// token descends from, made of the mount and user name, and the metadata is
+// the one the auth backend set at login; child tokens inherit both. The entity
+// ID is a salted hash of that name, so it is opaque but stable across logins
+// of the same user. Tokens that do not descend from a login have no identity.
+func (ts *TokenStore) identityForToken(te *TokenEntry) *policyIdentity {
+	if te == nil {
+		return nil
+	}
+
+	ident := &policyIdentity{
+		EntityName: te.EntityName,
+		Metadata:   te.EntityMeta,
+	}
+	if te.EntityName != "" {
+		ident.EntityID = ts.SaltID("entity/" + te.EntityName)
+	}
+	return ident
+}
+
+// isTemplatedPath returns whether the given policy path contains any
+// placeholders.
+func isTemplatedPath(path string) bool {
+	return templatePlaceholderRegex.MatchString(path)
+}
+
+// validateTemplatedPath checks that every placeholder in the given policy
+// path is one that can be resolved.
+func validateTemplatedPath(path string) error {
+	for _, match := range templatePlaceholderRegex.FindAllStringSubmatch(path, -1) {
+		switch name := match[1]; {
+		case name == templateEntityID, name == templateEntityName:
+		case strings.HasPrefix(name, templateEntityMetadata) && len(name) > len(templateEntityMetadata):
+		default:
+			return fmt.Errorf("invalid template placeholder '%s'", match[0])
+		}
+	}
+	return nil
+}
+
+// resolveTemplatedPath fills in the placeholders in the given policy path.
+// The second return value is false if any placeholder cannot be resolved to
+// a single path segment for the given identity.
+func resolveTemplatedPath(path string, ident *policyIdentity) (string, bool) {
+	if ident == nil {
+		return "", false
+	}
+
+	ok := true
+	resolved := templatePlaceholderRegex.ReplaceAllStringFunc(path, func(match string) string {
+		var value string
+		switch name := templatePlaceholderRegex.FindStringSubmatch(match)[1]; {
+		case name == templateEntityID:
+			value = ident.EntityID
+		case name == templateEntityName:
+			value = ident.EntityName
+		case strings.HasPrefix(name, templateEntityMetadata):
+			value = ident.Metadata[strings.TrimPrefix(name, templateEntityMetadata)]
+		}
+
+		// Refuse values that would let a templated path reach outside of
+		// the segment it was written for
+		if value == "" || value == "+" || strings.ContainsAny(value, "/*{}") {
+			ok = false
+		}
+		return value
+	})
+	if !ok {
+		return "", false
+	}
+	return resolved, true
+}
+
+// resolveTemplates returns a copy of the policy with all templated paths
+// resolved against the given identity. Paths that cannot be resolved are
+// dropped, so they grant nothing. If the policy has no templated paths it is
+// returned as-is.
+func (p *Policy) resolveTemplates(ident *policyIdentity) *Policy {
+	if p == nil || !p.Templated() {
+		return p
+	}
+
+	resolved := &Policy{
+		Name:           p.Name,
+		Raw:            p.Raw,
+		Syntax:         p.Syntax,
+		Metadata:       p.Metadata,
+		ExpireTime:     p.ExpireTime,
+		DeleteOnExpire: p.DeleteOnExpire,
+		Shadow:         p.Shadow,
+		Signature:      p.Signature,
+		SignedBy:       p.SignedBy,
+		RateLimit:      p.RateLimit,
+		Paths:          make([]*PathCapabilities, 0, len(p.Paths)),
+	}
+	for _, pc := range p.Paths {
+		if !pc.Templated {
+			resolved.Paths = append(resolved.Paths, pc)
+			continue
+		}
+
+		prefix, ok := resolveTemplatedPath(pc.Prefix, ident)
+		if !ok {
+			continue
+		}
+
+		rpc := *pc
+		rpc.Prefix = prefix
+		rpc.Templated = false
+		resolved.Paths = append(resolved.Paths, &rpc)
+	}
+	return resolved
+}
+
+// Templated returns whether any of the policy's paths contain placeholders.
+func (p *Policy) Templated() bool {
+	for _, pc := range p.Paths {
+		if pc.Templated {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,256 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+var templatedPolicy = strings.TrimSpace(`
+path "user-secrets/{{identity.entity.name}}/*" {
+	capabilities = ["create", "read", "update", "delete", "list"]
+}
+
+path "team/{{ identity.entity.metadata.team }}/shared" {
+	capabilities = ["read"]
+}
+
+path "by-id/{{identity.entity.id}}" {
+	capabilities = ["read"]
+}
+
+path "common" {
+	capabilities = ["read"]
+}
+`)
+
+func TestPolicy_ParseTemplated(t *testing.T) {
+	p, err := Parse(templatedPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if !p.Templated() {
+		t.Fatalf("expected templated policy")
+	}
+	if !p.Paths[0].Templated || !p.Paths[0].Glob {
+		t.Fatalf("bad: %#v", p.Paths[0])
+	}
+	if p.Paths[3].Templated {
+		t.Fatalf("bad: %#v", p.Paths[3])
+	}
+
+	_, err = Parse(strings.TrimSpace(`
+path "secret/{{identity.entity.bogus}}" {
+	capabilities = ["read"]
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), "invalid template placeholder '{{identity.entity.bogus}}'") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestPolicy_ResolveTemplates(t *testing.T) {
+	p, err := Parse(templatedPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ident := &policyIdentity{
+		EntityID:   "abcd",
+		EntityName: "userpass-bob",
+		Metadata: map[string]string{
+			"team": "ops",
+		},
+	}
+	acl, err := NewACL([]*Policy{p.resolveTemplates(ident)})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		allowed bool
+	}
+	tcases := []tcase{
+		{logical.ReadOperation, "user-secrets/userpass-bob/foo", true},
+		{logical.UpdateOperation, "user-secrets/userpass-bob/foo/bar", true},
+		{logical.ReadOperation, "user-secrets/userpass-alice/foo", false},
+		{logical.ReadOperation, "user-secrets/{{identity.entity.name}}/foo", false},
+		{logical.ReadOperation, "team/ops/shared", true},
+		{logical.ReadOperation, "team/dev/shared", false},
+		{logical.ReadOperation, "by-id/abcd", true},
+		{logical.ReadOperation, "common", true},
+	}
+	for _, tc := range tcases {
+		allowed, _ := acl.AllowOperation(&logical.Request{Operation: tc.op, Path: tc.path})
+		if allowed != tc.allowed {
+			t.Fatalf("bad: case %#v: %v", tc, allowed)
+		}
+	}
+
+	// Unresolvable paths must not grant anything
+	ident = &policyIdentity{
+		EntityName: "bad/name",
+	}
+	acl, err = NewACL([]*Policy{p.resolveTemplates(ident)})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, path := range []string{"user-secrets/bad/name/foo", "team//shared", "by-id/"} {
+		if allowed, _ := acl.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: path}); allowed {
+			t.Fatalf("unexpected access to %s", path)
+		}
+	}
+	if allowed, _ := acl.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "common"}); !allowed {
+		t.Fatalf("expected access to common")
+	}
+
+	// Without an identity only the plain paths apply
+	acl, err = NewACL([]*Policy{p})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if allowed, _ := acl.AllowOperation(&logical.Request{Operation: logical.ReadOperation, Path: "user-secrets/userpass-bob/foo"}); allowed {
+		t.Fatalf("unexpected access")
+	}
+}
+
+func TestCore_TemplatedPolicy(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	p, err := Parse(templatedPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p.Name = "templated"
+	if err := c.policyStore.SetPolicy(p); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	te := &TokenEntry{
+		Path:        "auth/userpass/login/bob",
+		Policies:    []string{"templated"},
+		DisplayName: "userpass-bob",
+		EntityName:  "userpass-bob",
+		EntityMeta: map[string]string{
+			"team": "ops",
+		},
+	}
+	if err := c.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	caps, err := c.Capabilities(te.ID, "user-secrets/userpass-bob/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(caps) != 5 {
+		t.Fatalf("bad: %#v", caps)
+	}
+
+	caps, err = c.Capabilities(te.ID, "user-secrets/userpass-alice/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(caps) != 1 || caps[0] != DenyCapability {
+		t.Fatalf("bad: %#v", caps)
+	}
+
+	// The entity ID is stable for the same login name
+	other := &TokenEntry{EntityName: "userpass-bob"}
+	if c.tokenStore.identityForToken(te).EntityID != c.tokenStore.identityForToken(other).EntityID {
+		t.Fatalf("expected stable entity ID")
+	}
+}
+
+func TestCore_TemplatedPolicy_ChildToken(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	p, err := Parse(templatedPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	p.Name = "templated"
+	if err := c.policyStore.SetPolicy(p); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	te := &TokenEntry{
+		Path:        "auth/userpass/login/bob",
+		Policies:    []string{"templated"},
+		DisplayName: "userpass-bob",
+		EntityName:  "userpass-bob",
+		EntityMeta: map[string]string{
+			"team": "ops",
+		},
+	}
+	if err := c.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The metadata and display name of a child token are chosen by its
+	// creator, and must not change the identity it acts for
+	req := logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = te.ID
+	req.Data["display_name"] = "userpass-alice"
+	req.Data["meta"] = map[string]interface{}{
+		"team": "dev",
+	}
+	resp, err := c.tokenStore.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %#v", err, resp)
+	}
+	child := resp.Auth.ClientToken
+
+	childEntry, err := c.tokenStore.Lookup(child)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	ident := c.tokenStore.identityForToken(childEntry)
+	if ident.EntityName != "userpass-bob" || ident.Metadata["team"] != "ops" ||
+		ident.EntityID != c.tokenStore.identityForToken(te).EntityID {
+		t.Fatalf("bad: %#v", ident)
+	}
+
+	for path, allowed := range map[string]bool{
+		"user-secrets/userpass-bob/foo":         true,
+		"team/ops/shared":                       true,
+		"user-secrets/userpass-alice/foo":       false,
+		"user-secrets/token-userpass-alice/foo": false,
+		"team/dev/shared":                       false,
+	} {
+		caps, err := c.Capabilities(child, path)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		denied := len(caps) == 1 && caps[0] == DenyCapability
+		if denied == allowed {
+			t.Fatalf("bad: %s: %#v", path, caps)
+		}
+	}
+
+	// Tokens that do not descend from a login have no identity
+	root := &TokenEntry{
+		Policies:    []string{"templated"},
+		DisplayName: "userpass-bob",
+		Meta: map[string]string{
+			"team": "ops",
+		},
+	}
+	if err := c.tokenStore.create(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	caps, err := c.Capabilities(root.ID, "user-secrets/userpass-bob/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(caps) != 1 || caps[0] != DenyCapability {
+		t.Fatalf("bad: %#v", caps)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var rawPolicy = strings.TrimSpace(`
@@ -49,35 +50,56 @@ func TestPolicy_Parse(t *testing.T) {
 	}
 
 	expect := []*PathCapabilities{
-		&PathCapabilities{"", "deny",
-			[]string{
+		&PathCapabilities{
+			Prefix: "",
+			Policy: "deny",
+			Capabilities: []string{
 				"deny",
-			}, DenyCapabilityInt, true},
-		&PathCapabilities{"stage/", "sudo",
-			[]string{
+			},
+			CapabilitiesBitmap: DenyCapabilityInt,
+			Glob:               true,
+		},
+		&PathCapabilities{
+			Prefix: "stage/",
+			Policy: "sudo",
+			Capabilities: []string{
 				"create",
 				"read",
 				"update",
 				"delete",
 				"list",
 				"sudo",
-			}, CreateCapabilityInt | ReadCapabilityInt | UpdateCapabilityInt |
-				DeleteCapabilityInt | ListCapabilityInt | SudoCapabilityInt, true},
-		&PathCapabilities{"prod/version", "read",
-			[]string{
+			},
+			CapabilitiesBitmap: CreateCapabilityInt | ReadCapabilityInt | UpdateCapabilityInt |
+				DeleteCapabilityInt | ListCapabilityInt | SudoCapabilityInt,
+			Glob: true,
+		},
+		&PathCapabilities{
+			Prefix: "prod/version",
+			Policy: "read",
+			Capabilities: []string{
 				"read",
 				"list",
-			}, ReadCapabilityInt | ListCapabilityInt, false},
-		&PathCapabilities{"foo/bar", "read",
-			[]string{
+			},
+			CapabilitiesBitmap: ReadCapabilityInt | ListCapabilityInt,
+		},
+		&PathCapabilities{
+			Prefix: "foo/bar",
+			Policy: "read",
+			Capabilities: []string{
 				"read",
 				"list",
-			}, ReadCapabilityInt | ListCapabilityInt, false},
-		&PathCapabilities{"foo/bar", "",
-			[]string{
+			},
+			CapabilitiesBitmap: ReadCapabilityInt | ListCapabilityInt,
+		},
+		&PathCapabilities{
+			Prefix: "foo/bar",
+			Capabilities: []string{
 				"create",
 				"sudo",
-			}, CreateCapabilityInt | SudoCapabilityInt, false},
+			},
+			CapabilitiesBitmap: CreateCapabilityInt | SudoCapabilityInt,
+		},
 	}
 	if !reflect.DeepEqual(p.Paths, expect) {
 		t.Errorf("expected \n\n%#v\n\n to be \n\n%#v\n\n", p.Paths, expect)
@@ -148,3 +170,297 @@ path "/" {
 		t.Errorf("bad error: %s", err)
 	}
 }
+
+func TestPolicy_ParseParameters(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "db/roles/*" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"TTL" = ["1h", "2h"]
+		"sql" = []
+	}
+	denied_parameters = {
+		"max_ttl" = []
+	}
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expectAllowed := map[string][]interface{}{
+		"ttl": []interface{}{"1h", "2h"},
+		"sql": []interface{}{},
+	}
+	if !reflect.DeepEqual(p.Paths[0].AllowedParameters, expectAllowed) {
+		t.Fatalf("bad: %#v", p.Paths[0].AllowedParameters)
+	}
+	expectDenied := map[string][]interface{}{
+		"max_ttl": []interface{}{},
+	}
+	if !reflect.DeepEqual(p.Paths[0].DeniedParameters, expectDenied) {
+		t.Fatalf("bad: %#v", p.Paths[0].DeniedParameters)
+	}
+}
+
+func TestPolicy_ParseJSON(t *testing.T) {
+	hclPolicy, err := Parse(strings.TrimSpace(`
+path "db/roles/*" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"TTL" = ["1h", "2h"]
+		"sql" = []
+	}
+	denied_parameters = {
+		"max_ttl" = []
+	}
+	min_wrapping_ttl = 30
+}
+
+path "secret/foo" {
+	policy = "read"
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	rules := []string{
+		`{
+  "path": {
+    "db/roles/*": {
+      "capabilities": ["update"],
+      "allowed_parameters": {"TTL": ["1h", "2h"], "sql": []},
+      "denied_parameters": {"max_ttl": []},
+      "min_wrapping_ttl": 30
+    },
+    "secret/foo": {
+      "policy": "read"
+    }
+  }
+}`,
+		`{
+  "path": [
+    {"db/roles/*": {
+      "capabilities": ["update"],
+      "allowed_parameters": {"TTL": ["1h", "2h"], "sql": []},
+      "denied_parameters": {"max_ttl": []},
+      "min_wrapping_ttl": 30
+    }},
+    {"secret/foo": {"policy": "read"}}
+  ]
+}`,
+	}
+	for _, raw := range rules {
+		p, err := Parse(raw)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if p.Raw != raw {
+			t.Fatalf("raw rules not preserved: %s", p.Raw)
+		}
+
+		paths := make(map[string]*PathCapabilities)
+		for _, pc := range p.Paths {
+			paths[pc.Prefix] = pc
+		}
+		for _, expected := range hclPolicy.Paths {
+			if !reflect.DeepEqual(paths[expected.Prefix], expected) {
+				t.Fatalf("bad: got\n%#v\nexpected\n%#v\n", paths[expected.Prefix], expected)
+			}
+		}
+	}
+}
+
+func TestPolicy_ParseBadWrappingTTL(t *testing.T) {
+	_, err := Parse(strings.TrimSpace(`
+path "/" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "2h"
+	max_wrapping_ttl = "1h"
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), `path "/": max_wrapping_ttl cannot be less than min_wrapping_ttl`) {
+		t.Errorf("bad error: %s", err)
+	}
+
+	_, err = Parse(strings.TrimSpace(`
+path "/" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "banana"
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), `path "/": invalid min_wrapping_ttl`) {
+		t.Errorf("bad error: %s", err)
+	}
+}
+
+func TestPolicy_ParseAllowedTimes(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["update"]
+	allowed_times = ["Mon-Fri 09:00-17:00"]
+	time_zone = "Europe/London"
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	schedule := p.Paths[0].Schedule
+	if schedule == nil || len(schedule.Windows) != 1 || schedule.Location.String() != "Europe/London" {
+		t.Fatalf("bad: %#v", schedule)
+	}
+
+	_, err = Parse(strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["update"]
+	allowed_times = ["Mon-Fri 9am-5pm"]
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), `path "secret/prod/*": invalid time window 'Mon-Fri 9am-5pm'`) {
+		t.Errorf("bad error: %s", err)
+	}
+
+	_, err = Parse(strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["update"]
+	time_zone = "Europe/London"
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), `path "secret/prod/*": time_zone requires allowed_times`) {
+		t.Errorf("bad error: %s", err)
+	}
+}
+
+func TestPolicy_ParseBoundCIDRs(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["read"]
+	bound_cidrs = ["10.0.0.0/8", "192.168.1.1/32"]
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	nets := p.Paths[0].BoundNets
+	if len(nets) != 2 || nets[0].String() != "10.0.0.0/8" || nets[1].String() != "192.168.1.1/32" {
+		t.Fatalf("bad: %#v", nets)
+	}
+
+	_, err = Parse(strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["read"]
+	bound_cidrs = ["10.0.0.1"]
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if !strings.Contains(err.Error(), `path "secret/prod/*": invalid bound_cidrs entry '10.0.0.1'`) {
+		t.Errorf("bad error: %s", err)
+	}
+}
+
+func TestPolicy_ParseControlGroup(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "secret/prod/*" {
+	capabilities = ["read"]
+	control_group {
+		policy = "approvers"
+		approvals = 2
+		ttl = "4h"
+	}
+}
+path "secret/dev/*" {
+	capabilities = ["read"]
+	control_group {
+		policy = "approvers"
+	}
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := []*ControlGroup{
+		{Policy: "approvers", Approvals: 2, TTL: 4 * time.Hour},
+		{Policy: "approvers", Approvals: 1, TTL: defaultControlGroupTTL},
+	}
+	for i, cg := range expected {
+		if !reflect.DeepEqual(p.Paths[i].ControlGroup, cg) {
+			t.Fatalf("bad: %d: %#v", i, p.Paths[i].ControlGroup)
+		}
+	}
+
+	p, err = Parse(`{"path": {"secret/prod/*": {"capabilities": ["read"], "control_group": {"policy": "approvers", "approvals": 3}}}}`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cg := p.Paths[0].ControlGroup; cg == nil || cg.Policy != "approvers" || cg.Approvals != 3 {
+		t.Fatalf("bad: %#v", cg)
+	}
+
+	for _, body := range []string{
+		`control_group { approvals = 2 }`,
+		`control_group { policy = "root" }`,
+		`control_group { policy = "approvers" approvals = -1 }`,
+		`control_group { policy = "approvers" color = "red" }`,
+	} {
+		_, err := Parse(`path "secret/prod/*" { capabilities = ["read"] ` + body + ` }`)
+		if err == nil || !strings.Contains(err.Error(), `path "secret/prod/*": invalid control_group`) {
+			t.Fatalf("bad: %s: %v", body, err)
+		}
+	}
+}
+
+func TestPolicy_ParseRateLimit(t *testing.T) {
+	p, err := Parse(`
+rate_limit {
+	rps = 2.5
+	burst = 10
+}
+path "secret/*" {
+	capabilities = ["read"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(p.RateLimit, &RateLimit{RequestsPerSecond: 2.5, Burst: 10}) {
+		t.Fatalf("bad: %#v", p.RateLimit)
+	}
+
+	// By default a second's worth of requests may be made at once
+	p, err = Parse(`{"rate_limit": {"rps": 2.5}, "path": {"secret/*": {"capabilities": ["read"]}}}`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(p.RateLimit, &RateLimit{RequestsPerSecond: 2.5, Burst: 3}) {
+		t.Fatalf("bad: %#v", p.RateLimit)
+	}
+
+	for _, rules := range []string{
+		`rate_limit { burst = 10 }`,
+		`rate_limit { rps = -1 }`,
+		`rate_limit { rps = "fast" }`,
+		`rate_limit { rps = 1 burst = -1 }`,
+		`rate_limit { rps = 1 period = "1m" }`,
+		`rate_limit { rps = 1 } rate_limit { rps = 2 }`,
+	} {
+		_, err := Parse(rules)
+		if err == nil || !strings.Contains(err.Error(), "invalid rate_limit") {
+			t.Fatalf("bad: %s: %v", rules, err)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// policyTrashSubPath is the sub-path used to keep deleted policies,
+	// nested under the system view. Deleted policies are kept under
+	// policyTrashDeletedPrefix, and the configuration at policyTrashConfigKey.
+	policyTrashSubPath       = "policy-trash/"
+	policyTrashDeletedPrefix = "deleted/"
+	policyTrashConfigKey     = "config"
+
+	// defaultPolicyTrashRetention is how long deleted policies are kept if
+	// no retention is configured
+	defaultPolicyTrashRetention = 7 * 24 * time.Hour
+)
+
+// PolicyTrashConfig configures how deleted policies are kept
+type PolicyTrashConfig struct {
+	// Retention is how long deleted policies can be restored. Policies are
+	// deleted outright if it is zero.
+	Retention time.Duration `json:"retention"`
+}
+
+// DeletedPolicy is a policy that was deleted and can still be restored
+type DeletedPolicy struct {
+	Name string
+
+	// Entry is the policy as it was stored
+	Entry *PolicyEntry
+
+	// DeleteTime is when the policy was deleted, and PurgeTime when it can
+	// no longer be restored
+	DeleteTime time.Time
+	PurgeTime  time.Time
+}
+
+// deletedPolicyEntry is used to store a deleted policy
+type deletedPolicyEntry struct {
+	Entry      *PolicyEntry `json:"entry"`
+	DeleteTime time.Time    `json:"delete_time"`
+	PurgeTime  time.Time    `json:"purge_time"`
+}
+
+// SetTrashView provides the policy store with the view used to keep deleted
+// policies. Without it, policies are deleted outright.
+func (ps *PolicyStore) SetTrashView(view *BarrierView) {
+	ps.trashView = view
+}
+
+// TrashConfig returns how deleted policies are kept, which is the default
+// retention if none was set.
+func (ps *PolicyStore) TrashConfig() (*PolicyTrashConfig, error) {
+	config := &PolicyTrashConfig{
+		Retention: defaultPolicyTrashRetention,
+	}
+	if ps.trashView == nil {
+		return config, nil
+	}
+
+	out, err := ps.trashView.Get(policyTrashConfigKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy trash config: %v", err)
+	}
+	if out == nil {
+		return config, nil
+	}
+	if err := out.DecodeJSON(config); err != nil {
+		return nil, fmt.Errorf("failed to decode policy trash config: %v", err)
+	}
+	return config, nil
+}
+
+// SetTrashConfig stores how deleted policies are kept. Policies already
+// deleted keep the retention they were deleted with.
+func (ps *PolicyStore) SetTrashConfig(config *PolicyTrashConfig) error {
+	if ps.trashView == nil {
+		return fmt.Errorf("policy trash is not available")
+	}
+	if config.Retention < 0 {
+		return fmt.Errorf("retention cannot be negative")
+	}
+
+	entry, err := logical.StorageEntryJSON(policyTrashConfigKey, config)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := ps.trashView.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist policy trash config: %v", err)
+	}
+	return nil
+}
+
+// trashPolicy keeps the stored entry of a policy that is being deleted, so
+// that it can be restored until the retention passes
+func (ps *PolicyStore) trashPolicy(name string) error {
+	if ps.trashView == nil {
+		return nil
+	}
+	config, err := ps.TrashConfig()
+	if err != nil {
+		return err
+	}
+	if config.Retention == 0 {
+		return nil
+	}
+
+	out, err := ps.view.Get(name)
+	if err != nil {
+		return fmt.Errorf("failed to read policy: %v", err)
+	}
+	if out == nil {
+		return nil
+	}
+	var policyEntry PolicyEntry
+	if err := out.DecodeJSON(&policyEntry); err != nil {
+		return fmt.Errorf("failed to decode policy: %v", err)
+	}
+
+	now := time.Now()
+	deleted := &deletedPolicyEntry{
+		Entry:      &policyEntry,
+		DeleteTime: now,
+		PurgeTime:  now.Add(config.Retention),
+	}
+	entry, err := logical.StorageEntryJSON(policyTrashDeletedPrefix+name, deleted)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := ps.trashView.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist deleted policy: %v", err)
+	}
+
+	if ps.expiration != nil {
+		ps.expiration.RegisterDeletedPolicy(name, deleted.PurgeTime)
+	}
+	return nil
+}
+
+// deletedPolicy returns the named deleted policy, or nil if there is none
+// or it can no longer be restored
+func (ps *PolicyStore) deletedPolicy(name string) (*DeletedPolicy, error) {
+	if ps.trashView == nil {
+		return nil, nil
+	}
+
+	out, err := ps.trashView.Get(policyTrashDeletedPrefix + name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deleted policy: %v", err)
+	}
+	if out == nil {
+		return nil, nil
+	}
+	var deleted deletedPolicyEntry
+	if err := out.DecodeJSON(&deleted); err != nil {
+		return nil, fmt.Errorf("failed to decode deleted policy: %v", err)
+	}
+	if time.Now().After(deleted.PurgeTime) {
+		return nil, nil
+	}
+
+	return &DeletedPolicy{
+		Name:       name,
+		Entry:      deleted.Entry,
+		DeleteTime: deleted.DeleteTime,
+		PurgeTime:  deleted.PurgeTime,
+	}, nil
+}
+
+// ListDeletedPolicies returns the deleted policies that can still be
+// restored, sorted by name
+func (ps *PolicyStore) ListDeletedPolicies() ([]*DeletedPolicy, error) {
+	if ps.trashView == nil {
+		return nil, nil
+	}
+
+	names, err := CollectKeys(ps.trashView.SubView(policyTrashDeletedPrefix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	var ret []*DeletedPolicy
+	for _, name := range names {
+		deleted, err := ps.deletedPolicy(name)
+		if err != nil {
+			return nil, err
+		}
+		if deleted != nil {
+			ret = append(ret, deleted)
+		}
+	}
+	return ret, nil
+}
+
+// RestorePolicy restores a deleted policy as it was when deleted. A policy
+// or group of the same name must not have been created since.
+func (ps *PolicyStore) RestorePolicy(name string) error {
+	deleted, err := ps.deletedPolicy(name)
+	if err != nil {
+		return err
+	}
+	if deleted == nil {
+		return fmt.Errorf("no deleted policy named %s", name)
+	}
+
+	existing, err := ps.GetPolicy(name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("a policy named %s exists", name)
+	}
+	group, err := ps.GetGroup(name)
+	if err != nil {
+		return err
+	}
+	if group != nil {
+		return fmt.Errorf("a policy group named %s exists", name)
+	}
+
+	entry, err := logical.StorageEntryJSON(name, deleted.Entry)
+	if err != nil {
+		return fmt.Errorf("failed to create entry: %v", err)
+	}
+	if err := ps.view.Put(entry); err != nil {
+		return fmt.Errorf("failed to persist policy: %v", err)
+	}
+	if ps.lru != nil {
+		ps.lru.Remove(name)
+	}
+	ps.purgeACLs()
+
+	if err := ps.trashView.Delete(policyTrashDeletedPrefix + name); err != nil {
+		return fmt.Errorf("failed to delete restored policy from trash: %v", err)
+	}
+	if ps.expiration != nil {
+		ps.expiration.RegisterDeletedPolicy(name, time.Time{})
+		if deleted.Entry.DeleteOnExpire {
+			ps.expiration.RegisterPolicy(name, deleted.Entry.ExpireTime)
+		}
+	}
+	return nil
+}
+
+// purgeDeletedPolicy removes a deleted policy once it can no longer be
+// restored. A policy deleted again since is kept.
+func (ps *PolicyStore) purgeDeletedPolicy(name string) error {
+	if ps.trashView == nil {
+		return nil
+	}
+	deleted, err := ps.deletedPolicy(name)
+	if err != nil || deleted != nil {
+		return err
+	}
+	if err := ps.trashView.Delete(policyTrashDeletedPrefix + name); err != nil {
+		return fmt.Errorf("failed to purge deleted policy: %v", err)
+	}
+	return nil
+}
+
+// purgeDeletedPolicies removes the deleted policies that can no longer be
+// restored
+func (ps *PolicyStore) purgeDeletedPolicies() error {
+	if ps.trashView == nil {
+		return nil
+	}
+	names, err := CollectKeys(ps.trashView.SubView(policyTrashDeletedPrefix))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := ps.purgeDeletedPolicy(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
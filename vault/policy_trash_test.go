@@ -0,0 +1,125 @@
+package vault
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyStore_TrashRestore(t *testing.T) {
+	ps := mockPolicyStoreNoCache(t)
+	_, barrier, _ := mockBarrier(t)
+	ps.SetTrashView(NewBarrierView(barrier, "foo-trash/"))
+
+	policy, _ := Parse(aclPolicy)
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ps.DeletePolicy("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, _ := ps.GetPolicy("dev"); out != nil {
+		t.Fatalf("expected policy to be deleted: %#v", out)
+	}
+
+	deleted, err := ps.ListDeletedPolicies()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].Name != "dev" {
+		t.Fatalf("bad: %#v", deleted)
+	}
+	if retention := deleted[0].PurgeTime.Sub(deleted[0].DeleteTime); retention != defaultPolicyTrashRetention {
+		t.Fatalf("bad: %v", retention)
+	}
+
+	// A policy created since cannot be overwritten. It is removed from the
+	// view directly so that the deleted policy is kept.
+	other, _ := Parse(aclPolicy)
+	if err := ps.SetPolicy(other); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ps.RestorePolicy("dev"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := ps.view.Delete("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := ps.RestorePolicy("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := ps.GetPolicy("dev")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || out.Raw != policy.Raw {
+		t.Fatalf("bad: %#v", out)
+	}
+	if deleted, _ := ps.ListDeletedPolicies(); len(deleted) != 0 {
+		t.Fatalf("bad: %#v", deleted)
+	}
+	if err := ps.RestorePolicy("dev"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestPolicyStore_TrashRetention(t *testing.T) {
+	ps := mockPolicyStore(t)
+	_, barrier, _ := mockBarrier(t)
+	ps.SetTrashView(NewBarrierView(barrier, "foo-trash/"))
+
+	if err := ps.SetTrashConfig(&PolicyTrashConfig{Retention: -time.Second}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// Without retention, policies are deleted outright
+	if err := ps.SetTrashConfig(&PolicyTrashConfig{}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy, _ := Parse(aclPolicy)
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ps.DeletePolicy("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if deleted, _ := ps.ListDeletedPolicies(); len(deleted) != 0 {
+		t.Fatalf("bad: %#v", deleted)
+	}
+
+	// Policies cannot be restored once their retention passes
+	if err := ps.SetTrashConfig(&PolicyTrashConfig{Retention: 50 * time.Millisecond}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	config, err := ps.TrashConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config.Retention != 50*time.Millisecond {
+		t.Fatalf("bad: %#v", config)
+	}
+	if err := ps.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ps.DeletePolicy("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if deleted, _ := ps.ListDeletedPolicies(); len(deleted) != 1 {
+		t.Fatalf("bad: %#v", deleted)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if deleted, _ := ps.ListDeletedPolicies(); len(deleted) != 0 {
+		t.Fatalf("bad: %#v", deleted)
+	}
+	if err := ps.RestorePolicy("dev"); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := ps.purgeDeletedPolicies(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, _ := ps.trashView.Get(policyTrashDeletedPrefix + "dev"); out != nil {
+		t.Fatalf("expected deleted policy to be purged: %#v", out)
+	}
+}
@@ -0,0 +1,65 @@
+package vault
+
+import (
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+// PolicyUsage records how often a policy allowed a request. It is kept in
+// memory, so it covers the time since the Vault was last unsealed or became
+// active.
+type PolicyUsage struct {
+	// Allowed is the number of requests the rules of the policy allowed
+	Allowed uint64
+
+	// LastAllowed is when the policy last allowed a request
+	LastAllowed time.Time
+}
+
+// recordAllowed is called by ACLs built by the policy store with the
+// policies whose rules allowed a request.
+func (ps *PolicyStore) recordAllowed(policies []string) {
+	now := time.Now()
+
+	ps.usageLock.Lock()
+	defer ps.usageLock.Unlock()
+	if ps.usage == nil {
+		ps.usage = make(map[string]*PolicyUsage)
+	}
+	for _, name := range policies {
+		metrics.IncrCounter([]string{"policy", "allowed", name}, 1)
+
+		usage, ok := ps.usage[name]
+		if !ok {
+			usage = &PolicyUsage{}
+			ps.usage[name] = usage
+		}
+		usage.Allowed++
+		usage.LastAllowed = now
+	}
+}
+
+// forgetUsage drops the usage of a deleted policy
+func (ps *PolicyStore) forgetUsage(name string) {
+	ps.usageLock.Lock()
+	defer ps.usageLock.Unlock()
+	delete(ps.usage, name)
+}
+
+// Usage returns how often each of the named policies allowed a request.
+// Policies that allowed none have a zero usage.
+func (ps *PolicyStore) Usage(names []string) map[string]PolicyUsage {
+	ps.usageLock.Lock()
+	defer ps.usageLock.Unlock()
+
+	ret := make(map[string]PolicyUsage, len(names))
+	for _, name := range names {
+		if usage, ok := ps.usage[name]; ok {
+			ret[name] = *usage
+		} else {
+			ret[name] = PolicyUsage{}
+		}
+	}
+	return ret
+}
@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPolicyStore_Usage(t *testing.T) {
+	ps := mockPolicyStore(t)
+	for name, rules := range map[string]string{
+		"dev": `path "secret/dev/*" { capabilities = ["read"] }`,
+		"ops": `path "secret/*" { capabilities = ["read"] }`,
+		"old": `path "secret/old/*" { capabilities = ["read"] }`,
+	} {
+		policy, _ := Parse(rules)
+		policy.Name = name
+		if err := ps.SetPolicy(policy); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	acl, err := ps.ACL("dev", "ops", "old")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, path := range []string{"secret/dev/foo", "secret/dev/bar", "secret/ops/foo"} {
+		allowed, _ := acl.AllowOperation(&logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      path,
+		})
+		if !allowed {
+			t.Fatalf("should be allowed: %s", path)
+		}
+	}
+
+	// Denied requests are not counted
+	if allowed, _ := acl.AllowOperation(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "secret/dev/foo",
+	}); allowed {
+		t.Fatalf("should not be allowed")
+	}
+
+	usage := ps.Usage([]string{"dev", "ops", "old"})
+	if usage["dev"].Allowed != 2 || usage["dev"].LastAllowed.IsZero() {
+		t.Fatalf("bad: %#v", usage["dev"])
+	}
+	if usage["ops"].Allowed != 1 {
+		t.Fatalf("bad: %#v", usage["ops"])
+	}
+	if usage["old"].Allowed != 0 || !usage["old"].LastAllowed.IsZero() {
+		t.Fatalf("bad: %#v", usage["old"])
+	}
+
+	// Usage is forgotten along with a deleted policy
+	if err := ps.DeletePolicy("dev"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if usage := ps.Usage([]string{"dev"}); usage["dev"].Allowed != 0 {
+		t.Fatalf("bad: %#v", usage["dev"])
+	}
+}
@@ -0,0 +1,279 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	hclParser "github.com/hashicorp/hcl/hcl/parser"
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// PolicyIssue is an error or warning found when validating the rules of a
+// policy. Line is zero if the issue cannot be tied to a line.
+type PolicyIssue struct {
+	Line    int    `json:"line" structs:"line" mapstructure:"line"`
+	Message string `json:"message" structs:"message" mapstructure:"message"`
+}
+
+// ValidatePolicy checks the given rules without storing them. It returns the
+// errors that would prevent the rules from being used as a policy, and
+// warnings about rules that are likely to be mistakes.
+func ValidatePolicy(rules string) (errs []*PolicyIssue, warnings []*PolicyIssue) {
+	return ValidatePolicySyntax(rules, "")
+}
+
+// ValidatePolicySyntax is like ValidatePolicy, for rules written in the
+// given syntax
+func ValidatePolicySyntax(rules, syntax string) (errs []*PolicyIssue, warnings []*PolicyIssue) {
+	root, err := parsePolicyHCL(rules, syntax)
+	if err != nil {
+		issue := &PolicyIssue{Message: err.Error()}
+		if posErr, ok := err.(*hclParser.PosError); ok {
+			issue.Line = posErr.Pos.Line
+			issue.Message = posErr.Err.Error()
+		}
+		return []*PolicyIssue{issue}, nil
+	}
+
+	list, ok := root.Node.(*ast.ObjectList)
+	if !ok {
+		return []*PolicyIssue{&PolicyIssue{Message: "does not contain a root object"}}, nil
+	}
+
+	// Each path is checked on its own so that errors can be tied to it
+	definedOn := make(map[string]int)
+	var lintRules []*policyLintRule
+	var rateLimitOn int
+	for _, item := range list.Items {
+		line := item.Keys[0].Pos().Line
+		single := &ast.ObjectList{Items: []*ast.ObjectItem{item}}
+		switch key := item.Keys[0].Token.Value().(string); key {
+		case "name":
+			warnings = append(warnings, &PolicyIssue{
+				Line:    line,
+				Message: "the name given in the rules is ignored; policies are named when they are written",
+			})
+			continue
+		case "rate_limit":
+			if rateLimitOn > 0 {
+				errs = append(errs, &PolicyIssue{
+					Line:    line,
+					Message: fmt.Sprintf("rate_limit is also given on line %d; only one may be given", rateLimitOn),
+				})
+				continue
+			}
+			rateLimitOn = line
+			if _, err := parseRateLimit(single); err != nil {
+				errs = append(errs, &PolicyIssue{
+					Line:    line,
+					Message: fmt.Sprintf("invalid rate_limit: %v", err),
+				})
+			}
+			continue
+		case "path":
+		default:
+			errs = append(errs, &PolicyIssue{
+				Line:    line,
+				Message: fmt.Sprintf("invalid key '%s'", key),
+			})
+			continue
+		}
+
+		var p Policy
+		if err := parsePaths(&p, single.Filter("path")); err != nil {
+			if merr, ok := err.(*multierror.Error); ok {
+				for _, err := range merr.Errors {
+					errs = append(errs, &PolicyIssue{
+						Line:    line,
+						Message: err.Error(),
+					})
+				}
+			} else {
+				errs = append(errs, &PolicyIssue{
+					Line:    line,
+					Message: err.Error(),
+				})
+			}
+			continue
+		}
+		pc := p.Paths[0]
+
+		pattern := pc.Prefix
+		if pc.Glob {
+			pattern += "*"
+		}
+		if first, ok := definedOn[pattern]; ok {
+			warnings = append(warnings, &PolicyIssue{
+				Line:    line,
+				Message: fmt.Sprintf("path %q is also defined on line %d; the two are combined", pattern, first),
+			})
+			for _, rule := range lintRules {
+				if rule.pattern == pattern {
+					rule.capabilities |= pc.CapabilitiesBitmap
+				}
+			}
+		} else {
+			definedOn[pattern] = line
+			if !pc.Templated {
+				lintRules = append(lintRules, &policyLintRule{
+					pattern:      pattern,
+					line:         line,
+					exact:        !pc.Glob && !pc.SegmentWildcards,
+					capabilities: pc.CapabilitiesBitmap,
+				})
+			}
+		}
+
+		warnings = append(warnings, pathWarnings(pattern, line, item)...)
+	}
+
+	warnings = append(warnings, overlapWarnings(lintRules)...)
+	return errs, warnings
+}
+
+// policyLintRule is a path of a policy as checked against the other paths
+type policyLintRule struct {
+	pattern      string
+	line         int
+	exact        bool
+	capabilities uint32
+}
+
+// overlapWarnings returns warnings about paths that overlap. A path whose
+// every match is taken by a more precise path can never apply. A path that
+// takes precedence over a broader one replaces its capabilities rather than
+// adding to them, so one that grants less than the broader path is likely
+// a mistake unless it denies access.
+func overlapWarnings(rules []*policyLintRule) []*PolicyIssue {
+	var warnings []*PolicyIssue
+	for _, rule := range rules {
+		var broader *policyLintRule
+		for _, other := range rules {
+			if other == rule || other.exact || !patternCovers(other.pattern, rule.pattern) {
+				continue
+			}
+
+			if !rule.exact && morePreciseThan(other.pattern, rule.pattern) {
+				warnings = append(warnings, &PolicyIssue{
+					Line: rule.line,
+					Message: fmt.Sprintf("path %q never applies, as every path it matches is matched by the more precise path %q on line %d",
+						rule.pattern, other.pattern, other.line),
+				})
+				broader = nil
+				break
+			}
+			if broader == nil || morePreciseThan(other.pattern, broader.pattern) {
+				broader = other
+			}
+		}
+		if broader == nil || rule.capabilities == 0 || rule.capabilities&DenyCapabilityInt != 0 {
+			continue
+		}
+
+		if missing := missingCapabilities(broader.capabilities, rule.capabilities); len(missing) > 0 {
+			warnings = append(warnings, &PolicyIssue{
+				Line: rule.line,
+				Message: fmt.Sprintf("path %q takes precedence over path %q on line %d without granting its capabilities %s; capabilities are not combined across paths",
+					rule.pattern, broader.pattern, broader.line, strings.Join(missing, ", ")),
+			})
+		}
+	}
+	return warnings
+}
+
+// missingCapabilities returns the names of the capabilities granted by one
+// bitmap but not another, unless the first denies access
+func missingCapabilities(granted, other uint32) []string {
+	if granted&DenyCapabilityInt != 0 {
+		return nil
+	}
+
+	var missing []string
+	for _, cap := range []string{CreateCapability, ReadCapability, UpdateCapability, PatchCapability, DeleteCapability, ListCapability, SudoCapability} {
+		if granted&cap2Int[cap] != 0 && other&cap2Int[cap] == 0 {
+			missing = append(missing, fmt.Sprintf("'%s'", cap))
+		}
+	}
+	return missing
+}
+
+// patternCovers returns whether every path matched by the second pattern is
+// also matched by the first. Patterns are split into segments, where "+"
+// matches any one segment and a trailing "*" globs.
+func patternCovers(outer, inner string) bool {
+	outerGlob, innerGlob := strings.HasSuffix(outer, "*"), strings.HasSuffix(inner, "*")
+	outerSegments := strings.Split(strings.TrimSuffix(outer, "*"), "/")
+	innerSegments := strings.Split(strings.TrimSuffix(inner, "*"), "/")
+
+	switch {
+	case !outerGlob && (innerGlob || len(innerSegments) != len(outerSegments)):
+		return false
+	case len(innerSegments) < len(outerSegments):
+		return false
+	}
+
+	outerLast, innerLast := len(outerSegments)-1, len(innerSegments)-1
+	for i, segment := range outerSegments {
+		innerSegment := innerSegments[i]
+		outerPrefix := outerGlob && i == outerLast
+		innerPrefix := innerGlob && i == innerLast
+		switch {
+		case segment == "+":
+		case innerSegment == "+":
+			if !outerPrefix || segment != "" {
+				return false
+			}
+		case outerPrefix:
+			if !strings.HasPrefix(innerSegment, segment) {
+				return false
+			}
+		case innerPrefix || innerSegment != segment:
+			return false
+		}
+	}
+	return true
+}
+
+// pathWarnings returns warnings about a single path of a policy that parsed
+// successfully.
+func pathWarnings(pattern string, line int, item *ast.ObjectItem) []*PolicyIssue {
+	// Decode again, as parsing rewrites the capabilities
+	var raw struct {
+		Policy       string
+		Capabilities []string
+	}
+	if err := hcl.DecodeObject(&raw, item.Val); err != nil {
+		return nil
+	}
+
+	var warnings []*PolicyIssue
+	switch {
+	case raw.Policy == "" && len(raw.Capabilities) == 0:
+		warnings = append(warnings, &PolicyIssue{
+			Line:    line,
+			Message: fmt.Sprintf("path %q grants no capabilities", pattern),
+		})
+	case raw.Policy == OldDenyPathPolicy && len(raw.Capabilities) > 0,
+		strutil.StrListContains(raw.Capabilities, DenyCapability) && (raw.Policy != "" || len(raw.Capabilities) > 1):
+		warnings = append(warnings, &PolicyIssue{
+			Line:    line,
+			Message: fmt.Sprintf("path %q denies access, so its other capabilities have no effect", pattern),
+		})
+	}
+
+	seen := make(map[string]bool, len(raw.Capabilities))
+	for _, cap := range raw.Capabilities {
+		if seen[cap] {
+			warnings = append(warnings, &PolicyIssue{
+				Line:    line,
+				Message: fmt.Sprintf("path %q lists capability '%s' more than once", pattern, cap),
+			})
+		}
+		seen[cap] = true
+	}
+
+	return warnings
+}
@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	errs, warnings := ValidatePolicy(strings.TrimSpace(`
+name = "dev"
+
+path "secret/*" {
+	capabilities = ["read", "list", "read"]
+}
+
+path "secret/admin" {
+	capabilities = ["deny", "read"]
+}
+
+path "secret/*" {
+	capabilities = ["update"]
+}
+
+path "secret/empty" {
+}
+
+path "secret/bad" {
+	capabilities = ["banana"]
+}
+
+path "secret/typo" {
+	capabilites = ["read"]
+}
+
+bogus = "foo"
+`))
+
+	expectErrs := []*PolicyIssue{
+		&PolicyIssue{Line: 18, Message: `path "secret/bad": invalid capability 'banana'`},
+		&PolicyIssue{Line: 22, Message: `path "secret/typo": invalid key 'capabilites' on line 23`},
+		&PolicyIssue{Line: 26, Message: "invalid key 'bogus'"},
+	}
+	if !reflect.DeepEqual(errs, expectErrs) {
+		for _, err := range errs {
+			t.Logf("%#v", err)
+		}
+		t.Fatalf("bad errors")
+	}
+
+	expectWarnings := []*PolicyIssue{
+		&PolicyIssue{Line: 1, Message: "the name given in the rules is ignored; policies are named when they are written"},
+		&PolicyIssue{Line: 3, Message: `path "secret/*" lists capability 'read' more than once`},
+		&PolicyIssue{Line: 7, Message: `path "secret/admin" denies access, so its other capabilities have no effect`},
+		&PolicyIssue{Line: 11, Message: `path "secret/*" is also defined on line 3; the two are combined`},
+		&PolicyIssue{Line: 15, Message: `path "secret/empty" grants no capabilities`},
+	}
+	if !reflect.DeepEqual(warnings, expectWarnings) {
+		for _, warning := range warnings {
+			t.Logf("%#v", warning)
+		}
+		t.Fatalf("bad warnings")
+	}
+}
+
+func TestValidatePolicy_SyntaxError(t *testing.T) {
+	errs, warnings := ValidatePolicy(strings.TrimSpace(`
+path "secret/*" {
+	capabilities = ["read"]
+}
+
+path "secret/foo" {
+	capabilities = ["read",]]
+}
+`))
+	if len(warnings) != 0 {
+		t.Fatalf("bad: %#v", warnings)
+	}
+	if len(errs) != 1 || errs[0].Line != 6 {
+		for _, err := range errs {
+			t.Logf("%#v", err)
+		}
+		t.Fatalf("bad errors")
+	}
+}
+
+func TestValidatePolicy_Overlap(t *testing.T) {
+	errs, warnings := ValidatePolicy(strings.TrimSpace(`
+path "secret/*" {
+	capabilities = ["read", "list"]
+}
+
+path "secret/+/config" {
+	capabilities = ["read", "list", "update"]
+}
+
+path "secret/app/*" {
+	capabilities = ["update"]
+}
+
+path "secret/+/*" {
+	capabilities = ["read"]
+}
+
+path "secret/private" {
+	capabilities = ["deny"]
+}
+
+path "secret/app/config" {
+	capabilities = ["list"]
+}
+`))
+	if len(errs) != 0 {
+		t.Fatalf("bad: %#v", errs)
+	}
+
+	expectWarnings := []*PolicyIssue{
+		&PolicyIssue{Line: 9, Message: `path "secret/app/*" takes precedence over path "secret/*" on line 1 without granting its capabilities 'read', 'list'; capabilities are not combined across paths`},
+		&PolicyIssue{Line: 13, Message: `path "secret/+/*" never applies, as every path it matches is matched by the more precise path "secret/*" on line 1`},
+		&PolicyIssue{Line: 21, Message: `path "secret/app/config" takes precedence over path "secret/app/*" on line 9 without granting its capabilities 'update'; capabilities are not combined across paths`},
+	}
+	if !reflect.DeepEqual(warnings, expectWarnings) {
+		for _, warning := range warnings {
+			t.Logf("%#v", warning)
+		}
+		t.Fatalf("bad warnings")
+	}
+}
+
+func TestPatternCovers(t *testing.T) {
+	cases := []struct {
+		outer, inner string
+		covers       bool
+	}{
+		{"secret/*", "secret/foo", true},
+		{"secret/*", "secret/foo/*", true},
+		{"secret/*", "secret/+/bar", true},
+		{"secret/*", "secret/+", true},
+		{"secret/f*", "secret/+", false},
+		{"secret/f*", "secret/foo*", true},
+		{"secret/foo*", "secret/f*", false},
+		{"secret/+", "secret/foo", true},
+		{"secret/+", "secret/foo/bar", false},
+		{"secret/+", "secret/*", false},
+		{"secret/+/bar", "secret/foo/bar", true},
+		{"secret/+/bar", "secret/foo/baz", false},
+		{"secret/+/*", "secret/*", false},
+		{"secret/+/*", "secret/foo/bar/*", true},
+		{"secret/foo/*", "secret/*", false},
+	}
+	for _, tc := range cases {
+		if actual := patternCovers(tc.outer, tc.inner); actual != tc.covers {
+			t.Fatalf("bad: %q covers %q: %v", tc.outer, tc.inner, actual)
+		}
+	}
+}
+
+func TestValidatePolicy_RateLimit(t *testing.T) {
+	errs, _ := ValidatePolicy(strings.TrimSpace(`
+rate_limit {
+	rps = 0
+}
+
+rate_limit {
+	rps = 10
+}
+
+path "secret/*" {
+	capabilities = ["read"]
+}
+`))
+
+	expectErrs := []*PolicyIssue{
+		&PolicyIssue{Line: 1, Message: "invalid rate_limit: rps must be greater than zero"},
+		&PolicyIssue{Line: 5, Message: "rate_limit is also given on line 1; only one may be given"},
+	}
+	if !reflect.DeepEqual(errs, expectErrs) {
+		for _, err := range errs {
+			t.Logf("%#v", err)
+		}
+		t.Fatalf("bad errors")
+	}
+}
@@ -2,6 +2,7 @@ package vault
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
@@ -31,7 +32,8 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	// backends. Basically, it's all just terrible, so don't allow it.
 	if strings.HasSuffix(req.Path, "/") &&
 		(req.Operation == logical.UpdateOperation ||
-			req.Operation == logical.CreateOperation) {
+			req.Operation == logical.CreateOperation ||
+			req.Operation == logical.PatchOperation) {
 		return logical.ErrorResponse("cannot write to a path ending in '/'"), nil
 	}
 
@@ -131,7 +133,7 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		// return invalid request so that the status codes can be correct
 		var errType error
 		switch ctErr {
-		case ErrInternalError, logical.ErrPermissionDenied:
+		case ErrInternalError, logical.ErrPermissionDenied, logical.ErrRateLimited:
 			errType = ctErr
 		default:
 			errType = logical.ErrInvalidRequest
@@ -142,6 +144,12 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 				req.Path, err)
 		}
 
+		// A request waiting for approval is not an error, the client is
+		// told how to follow it up
+		if pending, ok := ctErr.(*ControlGroupPendingError); ok {
+			return controlGroupResponse(pending.Request), nil, nil
+		}
+
 		if errType != nil {
 			retErr = multierror.Append(retErr, errType)
 		}
@@ -194,6 +202,14 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			resp.Secret.TTL = maxTTL
 		}
 
+		// Batch tokens are not revoked, so leases are not revoked along
+		// with them and must not outlive them
+		if te != nil && isBatchToken(te.ID) {
+			if remaining := te.batchRemaining(); resp.Secret.TTL > remaining {
+				resp.Secret.TTL = remaining
+			}
+		}
+
 		// Generic mounts should return the TTL but not register
 		// for a lease as this provides a massive slowdown
 		registerLease := true
@@ -235,20 +251,23 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			return nil, auth, retErr
 		}
 
-		// Register with the expiration manager. We use the token's actual path
-		// here because roles allow suffixes.
-		te, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
-		if err != nil {
-			c.logger.Printf("[ERR] core: failed to lookup token: %v", err)
-			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, nil, retErr
-		}
+		// Register with the expiration manager, unless this is a batch
+		// token, which is not persisted and expires by itself
+		if !isBatchToken(resp.Auth.ClientToken) {
+			// We use the token's actual path here because roles allow suffixes.
+			te, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+			if err != nil {
+				c.logger.Printf("[ERR] core: failed to lookup token: %v", err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+				return nil, nil, retErr
+			}
 
-		if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
-			c.logger.Printf("[ERR] core: failed to register token lease "+
-				"(request path: %s): %v", req.Path, err)
-			retErr = multierror.Append(retErr, ErrInternalError)
-			return nil, auth, retErr
+			if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
+				c.logger.Printf("[ERR] core: failed to register token lease "+
+					"(request path: %s): %v", req.Path, err)
+				retErr = multierror.Append(retErr, ErrInternalError)
+				return nil, auth, retErr
+			}
 		}
 	}
 
@@ -280,8 +299,34 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 		return nil, nil, ErrInternalError
 	}
 
+	// Logins held for MFA are completed by the core, since the token is
+	// issued for the original login
+	if req.Path == mfaValidatePath {
+		return c.handleMFAValidate(req)
+	}
+
+	// Users that failed to login on mounts with lockouts enabled have to
+	// wait before attempting again, and are locked out once they fail too
+	// many times
+	var lockoutConfig MountConfig
+	lockoutMount := c.router.MatchingMount(req.Path)
+	lockoutUser := loginUser(req, lockoutMount)
+	if entry := c.router.MatchingMountEntry(req.Path); entry != nil && lockoutUser != "" && strings.HasPrefix(lockoutMount, credentialRoutePrefix) {
+		lockoutConfig = entry.Config
+	}
+	if wait := c.loginLockouts.Check(lockoutMount, lockoutUser, lockoutConfig); wait > 0 {
+		resp, err := lockoutError(wait)
+		return resp, nil, err
+	}
+
 	// Route the request
 	resp, err := c.router.Route(req)
+	switch {
+	case resp != nil && resp.Auth != nil:
+		c.loginLockouts.Succeeded(lockoutMount, lockoutUser)
+	case resp != nil && resp.IsError(), err == logical.ErrPermissionDenied:
+		c.loginLockouts.Failed(lockoutMount, lockoutUser, lockoutConfig)
+	}
 	if resp != nil {
 		// We don't allow backends to specify this, so ensure it's not set
 		resp.WrapInfo = nil
@@ -315,59 +360,196 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 		source = strings.Replace(source, "/", "-", -1)
 
 		// Prepend the source to the display name
+		username := auth.Metadata["username"]
+		if username == "" {
+			username = auth.DisplayName
+		}
 		auth.DisplayName = strings.TrimSuffix(source+auth.DisplayName, "-")
 
-		sysView := c.router.MatchingSystemView(req.Path)
-		if sysView == nil {
-			c.logger.Printf("[ERR] core: unable to look up sys view for login path"+
-				"(request path: %s)", req.Path)
-			return nil, nil, ErrInternalError
+		// Logins on which MFA is enforced are held until their MFA
+		// credentials are validated at sys/mfa/validate
+		if methods := c.mfa.enforcedMethods(req.Path); len(methods) != 0 {
+			mfaResp, err := c.mfa.hold(req, resp, methods, username)
+			if err != nil {
+				c.logger.Printf("[ERR] core: failed to hold login for MFA "+
+					"(request path: %s): %v", req.Path, err)
+				return nil, nil, ErrInternalError
+			}
+			return mfaResp, nil, nil
 		}
 
-		// Set the default lease if not provided
-		if auth.TTL == 0 {
-			auth.TTL = sysView.DefaultLeaseTTL()
+		if err := c.issueLoginToken(req.Path, auth, false); err != nil {
+			return nil, auth, err
 		}
 
-		// Limit the lease duration
-		if auth.TTL > sysView.MaxLeaseTTL() {
-			auth.TTL = sysView.MaxLeaseTTL()
+		// Attach the display name, might be used by audit backends
+		req.DisplayName = auth.DisplayName
+	}
+
+	return resp, auth, err
+}
+
+// handleMFAValidate completes a login held for MFA, issuing its token once
+// its MFA credentials are validated
+func (c *Core) handleMFAValidate(req *logical.Request) (*logical.Response, *logical.Auth, error) {
+	id, _ := req.Data["mfa_request_id"].(string)
+	if id == "" {
+		return logical.ErrorResponse("missing mfa_request_id"), nil, logical.ErrInvalidRequest
+	}
+	passcodes, err := parseMFAPayload(req.Data["mfa_payload"])
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil, logical.ErrInvalidRequest
+	}
+
+	login, err := c.mfa.Validate(id, passcodes)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil, logical.ErrInvalidRequest
+	}
+
+	resp := login.Response
+	if req.WrapTTL != 0 {
+		resp.WrapInfo = &logical.WrapInfo{
+			TTL: req.WrapTTL,
 		}
+	}
+	auth := resp.Auth
+	if err := c.issueLoginToken(login.Path, auth, true); err != nil {
+		return nil, auth, err
+	}
+	req.DisplayName = auth.DisplayName
+	return resp, auth, nil
+}
 
-		// Generate a token
-		te := TokenEntry{
-			Path:         req.Path,
-			Policies:     auth.Policies,
-			Meta:         auth.Metadata,
-			DisplayName:  auth.DisplayName,
-			CreationTime: time.Now().Unix(),
-			TTL:          auth.TTL,
+// parseMFAPayload returns the passcodes given for each MFA method, either as
+// a string or as a list holding one string
+func parseMFAPayload(raw interface{}) (map[string]string, error) {
+	passcodes := make(map[string]string)
+	if raw == nil {
+		return passcodes, nil
+	}
+	payload, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mfa_payload must map MFA methods to passcodes")
+	}
+	for name, value := range payload {
+		switch v := value.(type) {
+		case string:
+			passcodes[name] = v
+		case []interface{}:
+			if len(v) > 1 {
+				return nil, fmt.Errorf("only one passcode can be given for MFA method %s", name)
+			}
+			if len(v) == 1 {
+				passcode, ok := v[0].(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid passcode for MFA method %s", name)
+				}
+				passcodes[name] = passcode
+			}
+		default:
+			return nil, fmt.Errorf("invalid passcode for MFA method %s", name)
 		}
+	}
+	return passcodes, nil
+}
 
-		te.Policies = policyutil.SanitizePolicies(te.Policies, true)
+// issueLoginToken creates the token of a login on the given path, and
+// registers it with the expiration manager. mfa is whether the login passed
+// the MFA enforced by the core.
+func (c *Core) issueLoginToken(path string, auth *logical.Auth, mfa bool) error {
+	sysView := c.router.MatchingSystemView(path)
+	if sysView == nil {
+		c.logger.Printf("[ERR] core: unable to look up sys view for login path"+
+			"(request path: %s)", path)
+		return ErrInternalError
+	}
 
-		if err := c.tokenStore.create(&te); err != nil {
-			c.logger.Printf("[ERR] core: failed to create token: %v", err)
-			return nil, auth, ErrInternalError
+	// Mounts can be tuned to issue batch tokens, which are not
+	// persisted and expire by themselves, and to hard limit the lifetime
+	// of their tokens
+	batch := false
+	if entry := c.router.MatchingMountEntry(path); entry != nil {
+		batch = entry.Config.TokenType == TokenTypeBatch
+		if max := entry.Config.ExplicitMaxTTL; max > 0 && (auth.ExplicitMaxTTL == 0 || auth.ExplicitMaxTTL > max) {
+			auth.ExplicitMaxTTL = max
 		}
+	}
+
+	// Set the default lease if not provided
+	if auth.TTL == 0 {
+		auth.TTL = sysView.DefaultLeaseTTL()
+	}
+
+	// Limit the lease duration
+	if auth.TTL > sysView.MaxLeaseTTL() {
+		auth.TTL = sysView.MaxLeaseTTL()
+	}
 
-		// Populate the client token and accessor
-		auth.ClientToken = te.ID
-		auth.Accessor = te.Accessor
-		auth.Policies = te.Policies
+	// Auth backends can hard limit the lifetime of the token
+	if auth.ExplicitMaxTTL > 0 && auth.TTL > auth.ExplicitMaxTTL {
+		auth.TTL = auth.ExplicitMaxTTL
+	}
 
-		// Register with the expiration manager
-		if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
-			c.logger.Printf("[ERR] core: failed to register token lease "+
-				"(request path: %s): %v", req.Path, err)
-			return nil, auth, ErrInternalError
+	// Generate a token
+	te := TokenEntry{
+		Path:           path,
+		Policies:       auth.Policies,
+		Meta:           auth.Metadata,
+		DisplayName:    auth.DisplayName,
+		CreationTime:   time.Now().Unix(),
+		TTL:            auth.TTL,
+		Period:         auth.Period,
+		ExplicitMaxTTL: auth.ExplicitMaxTTL,
+		EntityName:     auth.DisplayName,
+
+		// Credential backends doing their own MFA record it on the
+		// login, apart from its metadata, which callers may supply
+		MFA: mfa || auth.MFA,
+	}
+
+	// The identity of the login is kept apart from the metadata, which
+	// child tokens can be given freely
+	if len(auth.Metadata) != 0 {
+		te.EntityMeta = make(map[string]string, len(auth.Metadata))
+		for k, v := range auth.Metadata {
+			te.EntityMeta[k] = v
 		}
+	}
 
-		// Attach the display name, might be used by audit backends
-		req.DisplayName = auth.DisplayName
+	// Auth backends can bind the token to CIDR blocks
+	boundCIDRs, err := parseBoundCIDRs(auth.BoundCIDRs)
+	if err != nil {
+		c.logger.Printf("[ERR] core: invalid bound CIDR blocks for login "+
+			"(request path: %s): %v", path, err)
+		return ErrInternalError
 	}
+	te.BoundCIDRs = boundCIDRs
 
-	return resp, auth, err
+	te.Policies = policyutil.SanitizePolicies(te.Policies, true)
+
+	create := c.tokenStore.create
+	if batch {
+		create = c.tokenStore.createBatch
+	}
+	if err := create(&te); err != nil {
+		c.logger.Printf("[ERR] core: failed to create token: %v", err)
+		return ErrInternalError
+	}
+
+	// Populate the client token and accessor
+	auth.ClientToken = te.ID
+	auth.Accessor = te.Accessor
+	auth.Policies = te.Policies
+
+	// Register with the expiration manager
+	if batch {
+		auth.Renewable = false
+	} else if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
+		c.logger.Printf("[ERR] core: failed to register token lease "+
+			"(request path: %s): %v", path, err)
+		return ErrInternalError
+	}
+	return nil
 }
 
 func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*logical.Response, error) {
@@ -1,10 +1,12 @@
 package vault
 
 import (
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/go-uuid"
+	credAppRole "github.com/hashicorp/vault/builtin/credential/approle"
 	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
 	"github.com/hashicorp/vault/logical"
 )
@@ -136,3 +138,234 @@ func TestRequestHandling_LoginWrapping(t *testing.T) {
 		t.Fatalf("bad: %#v", resp)
 	}
 }
+
+func TestRequestHandling_RequiredParameters(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+
+	policy, err := Parse(`
+path "auth/token/create" {
+	capabilities = ["update"]
+	required_parameters = ["ttl"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy.Name = "ttl-required"
+	if err := core.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := &logical.Request{
+		Path:        "auth/token/create",
+		ClientToken: root,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"policies": []string{"ttl-required"},
+		},
+	}
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	token := resp.Auth.ClientToken
+
+	// Missing the required parameter
+	req = &logical.Request{
+		Path:        "auth/token/create",
+		ClientToken: token,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"policies": []string{"ttl-required"},
+		},
+	}
+	_, err = core.HandleRequest(req)
+	if err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+
+	req = &logical.Request{
+		Path:        "auth/token/create",
+		ClientToken: token,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"policies": []string{"ttl-required"},
+			"TTL":      "1h",
+		},
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Auth == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestRequestHandling_WrappingTTLPolicy(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+
+	req := &logical.Request{
+		Path:        "secret/foo",
+		ClientToken: root,
+		Operation:   logical.UpdateOperation,
+		Data: map[string]interface{}{
+			"zip": "zap",
+		},
+	}
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	policy, err := Parse(`
+path "secret/foo" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "1m"
+	max_wrapping_ttl = "1h"
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy.Name = "wrapped"
+	if err := core.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	te := &TokenEntry{
+		Path:     "auth/token/create",
+		Policies: []string{"wrapped"},
+	}
+	if err := core.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, wrapTTL := range []time.Duration{0, 30 * time.Second, 2 * time.Hour} {
+		req = &logical.Request{
+			Path:        "secret/foo",
+			ClientToken: te.ID,
+			Operation:   logical.ReadOperation,
+			WrapTTL:     wrapTTL,
+		}
+		resp, err := core.HandleRequest(req)
+		if err == nil || !strings.Contains(err.Error(), logical.ErrInvalidRequest.Error()) {
+			t.Fatalf("expected invalid request for wrap TTL %s, got: %v", wrapTTL, err)
+		}
+		if resp == nil || !strings.Contains(resp.Data["error"].(string), "response wrapped") {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+
+	req = &logical.Request{
+		Path:        "secret/foo",
+		ClientToken: te.ID,
+		Operation:   logical.ReadOperation,
+		WrapTTL:     5 * time.Minute,
+	}
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.WrapInfo == nil || resp.WrapInfo.TTL != 5*time.Minute {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestRequestHandling_LoginMetadataNotMFA(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+	core.credentialBackends["approle"] = credAppRole.Factory
+
+	policy, err := Parse(`
+path "secret/prod/*" {
+	capabilities = ["create", "update"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy.Name = "prod"
+	if err := core.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	rule, err := ParseRulePolicy("prod-mfa", []string{"secret/prod/*"}, `mfa`, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := core.policyStore.SetRulePolicy(rule); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, req := range []*logical.Request{
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "sys/auth/approle",
+			Data:      map[string]interface{}{"type": "approle"},
+		},
+		{
+			Operation: logical.UpdateOperation,
+			Path:      "auth/approle/role/app",
+			Data:      map[string]interface{}{"policies": "prod"},
+		},
+	} {
+		req.ClientToken = root
+		if _, err := core.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	resp, err := core.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "auth/approle/role/app/role-id",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	roleID := resp.Data["role_id"].(string)
+
+	// Whoever creates the SecretID chooses its metadata, which is given
+	// to the login
+	resp, err = core.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "auth/approle/role/app/secret-id",
+		ClientToken: root,
+		Data:        map[string]interface{}{"metadata": `{"mfa": "duo"}`},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	secretID := resp.Data["secret_id"].(string)
+
+	resp, err = core.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      "auth/approle/login",
+		Data: map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": secretID,
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Auth == nil || resp.Auth.Metadata["mfa"] != "duo" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	te, err := core.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te.MFA {
+		t.Fatalf("login metadata should not record MFA")
+	}
+
+	_, err = core.HandleRequest(&logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/prod/db",
+		ClientToken: resp.Auth.ClientToken,
+		Data:        map[string]interface{}{"foo": "bar"},
+	})
+	if err == nil || !strings.Contains(err.Error(), logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got: %v", err)
+	}
+}
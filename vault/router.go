@@ -138,6 +138,19 @@ func (r *Router) MatchingMount(path string) string {
 	return mount
 }
 
+// MountPoints returns the prefixes backends are mounted at
+func (r *Router) MountPoints() []string {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	var mounts []string
+	r.root.Walk(func(prefix string, raw interface{}) bool {
+		mounts = append(mounts, prefix)
+		return false
+	})
+	return mounts
+}
+
 // MatchingView returns the view used for a path
 func (r *Router) MatchingStorageView(path string) *BarrierView {
 	r.l.RLock()
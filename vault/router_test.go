@@ -2,6 +2,7 @@ package vault
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -93,6 +94,10 @@ func TestRouter_Mount(t *testing.T) {
 		t.Fatalf("bad: %s", path)
 	}
 
+	if mounts := r.MountPoints(); !reflect.DeepEqual(mounts, []string{"prod/aws/"}) {
+		t.Fatalf("bad: %v", mounts)
+	}
+
 	if v := r.MatchingStorageView("stage/aws/foo"); v != nil {
 		t.Fatalf("bad: %s", v)
 	}
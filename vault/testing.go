@@ -106,13 +106,21 @@ func TestCoreWithSeal(t *testing.T, testSeal Seal) *Core {
 		logicalBackends[backendName] = backendFactory
 	}
 
+	credentialBackends := make(map[string]logical.Factory)
+	for backendName, backendFactory := range noopBackends {
+		credentialBackends[backendName] = backendFactory
+	}
+	for backendName, backendFactory := range testCredentialBackends {
+		credentialBackends[backendName] = backendFactory
+	}
+
 	logger := log.New(os.Stderr, "", log.LstdFlags)
 	physicalBackend := physical.NewInmem(logger)
 	conf := &CoreConfig{
 		Physical:           physicalBackend,
 		AuditBackends:      noopAudits,
 		LogicalBackends:    logicalBackends,
-		CredentialBackends: noopBackends,
+		CredentialBackends: credentialBackends,
 		DisableMlock:       true,
 		Logger:             logger,
 	}
@@ -196,6 +204,22 @@ func TestCoreWithTokenStore(t *testing.T) (*Core, *TokenStore, []byte, string) {
 	return c, ts, key, root
 }
 
+// TestLoginToken creates a token with the given ID and policies as if it was
+// issued by a login of the userpass backend, so that tokens created by
+// different calls belong to different principals
+func TestLoginToken(t *testing.T, core *Core, id string, policies []string) {
+	te := &TokenEntry{
+		ID:          id,
+		Path:        "auth/userpass/login/" + id,
+		Policies:    policies,
+		DisplayName: "userpass-" + id,
+		EntityName:  "userpass-" + id,
+	}
+	if err := core.tokenStore.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
 // TestKeyCopy is a silly little function to just copy the key so that
 // it can be used with Unseal easily.
 func TestKeyCopy(key []byte) []byte {
@@ -206,6 +230,8 @@ func TestKeyCopy(key []byte) []byte {
 
 var testLogicalBackends = map[string]logical.Factory{}
 
+var testCredentialBackends = map[string]logical.Factory{}
+
 // Starts the test server which responds to SSH authentication.
 // Used to test the SSH secret backend.
 func StartSSHHostTestServer() (string, error) {
@@ -310,6 +336,19 @@ func AddTestLogicalBackend(name string, factory logical.Factory) error {
 	return nil
 }
 
+// This adds a credential backend for the test core. This needs to be
+// invoked before the test core is created.
+func AddTestCredentialBackend(name string, factory logical.Factory) error {
+	if name == "" {
+		return fmt.Errorf("Missing backend name")
+	}
+	if factory == nil {
+		return fmt.Errorf("Missing backend factory function")
+	}
+	testCredentialBackends[name] = factory
+	return nil
+}
+
 type noopAudit struct {
 	Config *audit.BackendConfig
 }
@@ -334,6 +373,9 @@ func (n *rawHTTP) HandleRequest(req *logical.Request) (*logical.Response, error)
 			logical.HTTPStatusCode:  200,
 			logical.HTTPContentType: "plain/text",
 			logical.HTTPRawBody:     []byte("hello world"),
+			logical.HTTPRawHeaders: map[string]string{
+				"X-Hello": "world",
+			},
 		},
 	}, nil
 }
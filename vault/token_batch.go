@@ -0,0 +1,227 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// TokenTypeService is the type of tokens that are persisted in the
+	// token store, and can be renewed and revoked
+	TokenTypeService = "service"
+
+	// TokenTypeBatch is the type of tokens that are never persisted. They
+	// carry their own entry, authenticated by the token store, and
+	// cannot be renewed or revoked.
+	TokenTypeBatch = "batch"
+
+	// batchTokenPrefix is the prefix of batch token IDs, distinguishing
+	// them from the UUIDs of service tokens
+	batchTokenPrefix = "b."
+
+	// batchKeyPath is the path used to store the key that batch tokens
+	// are authenticated with
+	batchKeyPath = "batch-key"
+
+	// batchKeySize is the size of the batch token key in bytes
+	batchKeySize = 32
+)
+
+// batchTokenPayload is the token entry carried by a batch token. Field
+// names are kept short since they are part of every token ID.
+type batchTokenPayload struct {
+	// Nonce makes tokens created at the same time with the same
+	// parameters distinct
+	Nonce string `json:"n"`
+
+	Policies     []string          `json:"p,omitempty"`
+	Path         string            `json:"pa,omitempty"`
+	Meta         map[string]string `json:"m,omitempty"`
+	DisplayName  string            `json:"d,omitempty"`
+	CreationTime int64             `json:"c"`
+	TTL          int64             `json:"t"`
+	Role         string            `json:"r,omitempty"`
+	BoundCIDRs   []string          `json:"bc,omitempty"`
+	EntityName   string            `json:"en,omitempty"`
+	EntityMeta   map[string]string `json:"em,omitempty"`
+	MFA          bool              `json:"mfa,omitempty"`
+	TreeAccessor string            `json:"ta,omitempty"`
+
+	// SaltedParent is the salted ID of the parent token, so that tokens
+	// do not disclose the ID of their parent
+	SaltedParent string `json:"sp,omitempty"`
+}
+
+// isBatchToken returns whether the given token ID is that of a batch token
+func isBatchToken(id string) bool {
+	return strings.HasPrefix(id, batchTokenPrefix)
+}
+
+// setupBatchKey loads the key used to authenticate batch tokens, creating
+// it on first use
+func (ts *TokenStore) setupBatchKey() error {
+	raw, err := ts.view.Get(batchKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read batch token key: %v", err)
+	}
+	if raw != nil {
+		ts.batchKey = raw.Value
+		return nil
+	}
+
+	key := make([]byte, batchKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate batch token key: %v", err)
+	}
+	if err := ts.view.Put(&logical.StorageEntry{Key: batchKeyPath, Value: key}); err != nil {
+		return fmt.Errorf("failed to persist batch token key: %v", err)
+	}
+	ts.batchKey = key
+	return nil
+}
+
+// batchSignature returns the signature of an encoded batch token payload
+func (ts *TokenStore) batchSignature(payload string) []byte {
+	mac := hmac.New(sha256.New, ts.batchKey)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// createBatch is used to create a new batch token. Nothing is written to
+// storage: the entry is encoded in the token ID, which is signed so that
+// it cannot be altered. Batch tokens are never given an accessor.
+func (ts *TokenStore) createBatch(entry *TokenEntry) error {
+	defer metrics.MeasureSince([]string{"token", "create-batch"}, time.Now())
+	if entry.ID != "" {
+		return fmt.Errorf("batch tokens cannot be given an ID")
+	}
+	if entry.NumUses != 0 {
+		return fmt.Errorf("batch tokens cannot have a limited number of uses")
+	}
+	if entry.TTL <= 0 {
+		return fmt.Errorf("batch tokens must have a TTL")
+	}
+
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	entry.Policies = policyutil.SanitizePolicies(entry.Policies, false)
+	payload := &batchTokenPayload{
+		Nonce:        nonce,
+		Policies:     entry.Policies,
+		Path:         entry.Path,
+		Meta:         entry.Meta,
+		DisplayName:  entry.DisplayName,
+		CreationTime: entry.CreationTime,
+		TTL:          int64(entry.TTL.Seconds()),
+		Role:         entry.Role,
+		BoundCIDRs:   entry.BoundCIDRs,
+		EntityName:   entry.EntityName,
+		EntityMeta:   entry.EntityMeta,
+		MFA:          entry.MFA,
+		TreeAccessor: entry.TreeAccessor,
+	}
+
+	if entry.Parent != "" {
+		// Ensure the parent exists, as it is checked on every lookup
+		parent, err := ts.Lookup(entry.Parent)
+		if err != nil {
+			return fmt.Errorf("failed to lookup parent: %v", err)
+		}
+		if parent == nil {
+			return fmt.Errorf("parent token not found")
+		}
+		if isBatchToken(parent.ID) {
+			return fmt.Errorf("batch tokens cannot create child tokens")
+		}
+		payload.SaltedParent = ts.SaltID(entry.Parent)
+	}
+
+	enc, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %v", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(enc)
+	signature := base64.RawURLEncoding.EncodeToString(ts.batchSignature(encoded))
+
+	entry.ID = batchTokenPrefix + encoded + "." + signature
+	entry.TTL = time.Duration(payload.TTL) * time.Second
+	entry.batchParent = payload.SaltedParent
+	return nil
+}
+
+// lookupBatch is used to verify and decode a batch token. Tokens that were
+// tampered with, have expired or whose parent was revoked are not found.
+func (ts *TokenStore) lookupBatch(id string) (*TokenEntry, error) {
+	parts := strings.Split(strings.TrimPrefix(id, batchTokenPrefix), ".")
+	if len(parts) != 2 {
+		return nil, nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(signature, ts.batchSignature(parts[0])) {
+		return nil, nil
+	}
+
+	enc, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode entry: %v", err)
+	}
+	var payload batchTokenPayload
+	if err := jsonutil.DecodeJSON(enc, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode entry: %v", err)
+	}
+
+	entry := &TokenEntry{
+		ID:           id,
+		Policies:     payload.Policies,
+		Path:         payload.Path,
+		Meta:         payload.Meta,
+		DisplayName:  payload.DisplayName,
+		CreationTime: payload.CreationTime,
+		TTL:          time.Duration(payload.TTL) * time.Second,
+		Role:         payload.Role,
+		BoundCIDRs:   payload.BoundCIDRs,
+		EntityName:   payload.EntityName,
+		EntityMeta:   payload.EntityMeta,
+		MFA:          payload.MFA,
+		TreeAccessor: payload.TreeAccessor,
+		batchParent:  payload.SaltedParent,
+	}
+	if entry.batchRemaining() <= 0 {
+		return nil, nil
+	}
+
+	// Batch tokens are not revoked along with their parent, so they are
+	// only valid as long as it is
+	if payload.SaltedParent != "" {
+		parent, err := ts.lookupSalted(payload.SaltedParent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup parent: %v", err)
+		}
+		if parent == nil {
+			return nil, nil
+		}
+	}
+
+	return entry, nil
+}
+
+// batchRemaining returns how long a batch token remains valid
+func (te *TokenEntry) batchRemaining() time.Duration {
+	expireTime := time.Unix(te.CreationTime, 0).Add(te.TTL)
+	return expireTime.Sub(time.Now())
+}
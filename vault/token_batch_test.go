@@ -0,0 +1,154 @@
+package vault
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTokenStore_Batch(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	existing, err := ts.view.List(lookupPrefix)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = root
+	req.Data["type"] = "batch"
+	req.Data["policies"] = []string{"foo"}
+	req.Data["ttl"] = "1h"
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	token := resp.Auth.ClientToken
+	if !strings.HasPrefix(token, batchTokenPrefix) || resp.Auth.Accessor != "" || resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Nothing is persisted
+	out, err := ts.view.List(lookupPrefix)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(out, existing) {
+		t.Fatalf("bad: %v", out)
+	}
+
+	te, err := ts.Lookup(token)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := &TokenEntry{
+		ID:           token,
+		Policies:     []string{"default", "foo"},
+		Path:         "auth/token/create",
+		DisplayName:  "token",
+		CreationTime: te.CreationTime,
+		TTL:          time.Hour,
+		batchParent:  ts.SaltID(root),
+		TreeAccessor: testTokenAccessor(t, ts, root),
+	}
+	if !reflect.DeepEqual(te, expected) {
+		t.Fatalf("bad: expected:%#v\nactual:%#v", expected, te)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "lookup-self")
+	req.ClientToken = token
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Data["type"] != TokenTypeBatch || resp.Data["orphan"] != false ||
+		resp.Data["renewable"] != false || resp.Data["ttl"].(int64) <= 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Tokens cannot be altered
+	tampered := strings.Replace(token, ".", ".x", 1)
+	if te, err := ts.Lookup(tampered); err != nil || te != nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+
+	// Batch tokens cannot be renewed, revoked or create children
+	req = logical.TestRequest(t, logical.UpdateOperation, "renew-self")
+	req.ClientToken = token
+	if resp, err := ts.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("expected error: %v %v", err, resp)
+	}
+	if err := ts.Revoke(token); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := ts.RevokeTree(token); err == nil {
+		t.Fatalf("expected error")
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = token
+	if resp, err := ts.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("expected error: %v %v", err, resp)
+	}
+}
+
+func TestTokenStore_Batch_Invalid(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	cases := []map[string]interface{}{
+		{"type": "bogus", "ttl": "1h"},
+		{"type": "batch", "ttl": "1h", "num_uses": 1},
+		{"type": "batch", "ttl": "1h", "id": "foo"},
+		{"type": "batch"},
+		{"id": "b.foo"},
+	}
+	for _, data := range cases {
+		req := logical.TestRequest(t, logical.UpdateOperation, "create")
+		req.ClientToken = root
+		req.Data = data
+		if resp, err := ts.HandleRequest(req); err != logical.ErrInvalidRequest {
+			t.Fatalf("%v: expected error: %v %v", data, err, resp)
+		}
+	}
+}
+
+func TestTokenStore_Batch_Expiry(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+	testMakeToken(t, ts, root, "parent", "", []string{"root"})
+
+	// Batch tokens cannot outlive their TTL
+	te := &TokenEntry{
+		Parent:       "parent",
+		Policies:     []string{"foo"},
+		CreationTime: time.Now().Add(-2 * time.Hour).Unix(),
+		TTL:          time.Hour,
+	}
+	if err := ts.createBatch(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, err := ts.Lookup(te.ID); err != nil || out != nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+
+	// Nor their parent
+	te = &TokenEntry{
+		Parent:       "parent",
+		Policies:     []string{"foo"},
+		CreationTime: time.Now().Unix(),
+		TTL:          time.Hour,
+	}
+	if err := ts.createBatch(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, err := ts.Lookup(te.ID); err != nil || out == nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+	if err := ts.Revoke("parent"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, err := ts.Lookup(te.ID); err != nil || out != nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+}
@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// parseBoundCIDRs parses the CIDR blocks a token is bound to, given either
+// as a list or as a comma separated string. Bare IP addresses are bound to
+// themselves.
+func parseBoundCIDRs(raw interface{}) ([]string, error) {
+	var blocks []string
+	switch raw := raw.(type) {
+	case nil:
+	case string:
+		blocks = strutil.ParseStringSlice(raw, ",")
+	case []string:
+		for _, block := range raw {
+			blocks = append(blocks, strutil.ParseStringSlice(block, ",")...)
+		}
+	case []interface{}:
+		for _, block := range raw {
+			s, ok := block.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid CIDR block: %v", block)
+			}
+			blocks = append(blocks, strutil.ParseStringSlice(s, ",")...)
+		}
+	default:
+		return nil, fmt.Errorf("invalid CIDR blocks: %v", raw)
+	}
+
+	var cidrs []string
+	for _, block := range blocks {
+		block = strings.TrimSpace(block)
+		if block == "" {
+			continue
+		}
+		if !strings.Contains(block, "/") {
+			ip := net.ParseIP(block)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid CIDR block: %s", block)
+			}
+			if ip.To4() != nil {
+				block += "/32"
+			} else {
+				block += "/128"
+			}
+		}
+		_, cidr, err := net.ParseCIDR(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR block: %s", block)
+		}
+		cidrs = append(cidrs, cidr.String())
+	}
+	if len(cidrs) == 0 {
+		return nil, nil
+	}
+	return strutil.RemoveDuplicates(cidrs), nil
+}
+
+// cidrsSubset returns whether every CIDR block in sub is contained in one
+// of the blocks in super
+func cidrsSubset(super, sub []string) bool {
+	for _, block := range sub {
+		_, subNet, err := net.ParseCIDR(block)
+		if err != nil {
+			return false
+		}
+		subOnes, _ := subNet.Mask.Size()
+
+		contained := false
+		for _, superBlock := range super {
+			_, superNet, err := net.ParseCIDR(superBlock)
+			if err != nil {
+				continue
+			}
+			superOnes, _ := superNet.Mask.Size()
+			if superNet.Contains(subNet.IP) && superOnes <= subOnes {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// remoteAddrAllowed returns whether a request made over the given
+// connection falls within the CIDR blocks a token is bound to. Requests
+// without a known remote address are not allowed.
+func remoteAddrAllowed(conn *logical.Connection, cidrs []string) bool {
+	if conn == nil {
+		return false
+	}
+	ip := net.ParseIP(conn.RemoteAddr)
+	if ip == nil {
+		return false
+	}
+
+	for _, block := range cidrs {
+		_, cidr, err := net.ParseCIDR(block)
+		if err != nil {
+			continue
+		}
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestParseBoundCIDRs(t *testing.T) {
+	cases := []struct {
+		raw      interface{}
+		expected []string
+	}{
+		{nil, nil},
+		{"", nil},
+		{"10.0.0.0/8, 192.168.1.1", []string{"10.0.0.0/8", "192.168.1.1/32"}},
+		{[]interface{}{"10.1.2.3/8", "::1"}, []string{"10.0.0.0/8", "::1/128"}},
+		{[]string{"10.0.0.0/8,10.0.0.0/8"}, []string{"10.0.0.0/8"}},
+	}
+	for _, tc := range cases {
+		out, err := parseBoundCIDRs(tc.raw)
+		if err != nil {
+			t.Fatalf("%v: err: %v", tc.raw, err)
+		}
+		if !reflect.DeepEqual(out, tc.expected) {
+			t.Fatalf("%v: bad: %#v", tc.raw, out)
+		}
+	}
+
+	for _, raw := range []interface{}{"10.0.0.0/33", "foo", []interface{}{1}, 1} {
+		if _, err := parseBoundCIDRs(raw); err == nil {
+			t.Fatalf("%v: expected error", raw)
+		}
+	}
+}
+
+func TestCIDRsSubset(t *testing.T) {
+	super := []string{"10.0.0.0/8", "192.168.0.0/16"}
+	if !cidrsSubset(super, []string{"10.1.0.0/16", "192.168.0.0/16"}) {
+		t.Fatalf("expected subset")
+	}
+	if cidrsSubset(super, []string{"10.0.0.0/7"}) {
+		t.Fatalf("expected broader block not to be a subset")
+	}
+	if cidrsSubset(super, []string{"172.16.0.0/12"}) {
+		t.Fatalf("expected disjoint block not to be a subset")
+	}
+}
+
+func TestRemoteAddrAllowed(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8"}
+	if !remoteAddrAllowed(&logical.Connection{RemoteAddr: "10.1.2.3"}, cidrs) {
+		t.Fatalf("expected address to be allowed")
+	}
+	if remoteAddrAllowed(&logical.Connection{RemoteAddr: "11.1.2.3"}, cidrs) {
+		t.Fatalf("expected address not to be allowed")
+	}
+	if remoteAddrAllowed(&logical.Connection{}, cidrs) || remoteAddrAllowed(nil, cidrs) {
+		t.Fatalf("expected unknown address not to be allowed")
+	}
+}
+
+func TestTokenStore_BoundCIDRs(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	inside := &logical.Connection{RemoteAddr: "10.1.2.3"}
+	outside := &logical.Connection{RemoteAddr: "11.1.2.3"}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["bound_cidrs"] = "10.0.0.0/8"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	bound := resp.Auth.ClientToken
+
+	// The token can only be used from within its CIDR blocks
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = bound
+	req.Connection = outside
+	if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("err: %v", err)
+	}
+	req.Connection = inside
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if !reflect.DeepEqual(resp.Data["bound_cidrs"], []string{"10.0.0.0/8"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Children inherit the binding, and cannot broaden it
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = bound
+	req.Connection = inside
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	child, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(child.BoundCIDRs, []string{"10.0.0.0/8"}) {
+		t.Fatalf("bad: %#v", child)
+	}
+
+	req.Data["bound_cidrs"] = []string{"0.0.0.0/0"}
+	if resp, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+	req.Data["bound_cidrs"] = []string{"10.1.0.0/16"}
+	if resp, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+}
@@ -0,0 +1,176 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	// searchPrefix is the prefix used to store the index from the display
+	// name and metadata of tokens to their accessor
+	searchPrefix = "search/"
+)
+
+// searchTerms returns the terms a token can be searched by
+func searchTerms(displayName string, meta map[string]string) []string {
+	var terms []string
+	if displayName != "" {
+		terms = append(terms, "display_name="+displayName)
+	}
+	for k, v := range meta {
+		terms = append(terms, "meta:"+k+"="+v)
+	}
+	return terms
+}
+
+// searchPath returns the path of the search index entry of the token with
+// the given salted ID for the given term
+func (ts *TokenStore) searchPath(term, saltedId string) string {
+	return searchPrefix + ts.SaltID(term) + "/" + saltedId
+}
+
+// createSearchIndex is used to index a token by its display name and
+// metadata. The index entries hold the accessor of the token.
+func (ts *TokenStore) createSearchIndex(entry *TokenEntry, saltedId string) error {
+	if entry.Accessor == "" {
+		return nil
+	}
+	for _, term := range searchTerms(entry.DisplayName, entry.Meta) {
+		le := &logical.StorageEntry{
+			Key:   ts.searchPath(term, saltedId),
+			Value: []byte(entry.Accessor),
+		}
+		if err := ts.view.Put(le); err != nil {
+			return fmt.Errorf("failed to persist search index entry: %v", err)
+		}
+	}
+	return nil
+}
+
+// deleteSearchIndex is used to remove the search index entries of a token
+func (ts *TokenStore) deleteSearchIndex(entry *TokenEntry, saltedId string) error {
+	for _, term := range searchTerms(entry.DisplayName, entry.Meta) {
+		if err := ts.view.Delete(ts.searchPath(term, saltedId)); err != nil {
+			return fmt.Errorf("failed to delete search index entry: %v", err)
+		}
+	}
+	return nil
+}
+
+// search returns the accessors of the tokens matching every given term
+func (ts *TokenStore) search(terms []string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"token", "search"}, time.Now())
+
+	var matches map[string]bool
+	for _, term := range terms {
+		saltedIds, err := ts.view.List(searchPrefix + ts.SaltID(term) + "/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search index: %v", err)
+		}
+
+		found := make(map[string]bool, len(saltedIds))
+		for _, saltedId := range saltedIds {
+			if matches == nil || matches[saltedId] {
+				found[saltedId] = true
+			}
+		}
+		matches = found
+		if len(matches) == 0 {
+			break
+		}
+	}
+
+	accessors := make([]string, 0, len(matches))
+	for saltedId := range matches {
+		// Skip index entries left behind by tokens that no longer exist
+		exists, err := ts.tokenExistsSalted(saltedId)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			continue
+		}
+
+		raw, err := ts.view.Get(ts.searchPath(terms[0], saltedId))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read search index entry: %v", err)
+		}
+		if raw != nil {
+			accessors = append(accessors, string(raw.Value))
+		}
+	}
+	sort.Strings(accessors)
+	return accessors, nil
+}
+
+// handleSearch handles the auth/token/accessors/search path, which finds the
+// accessors of tokens by display name and metadata
+func (ts *TokenStore) handleSearch(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	meta := map[string]string{}
+	for k, v := range data.Get("meta").(map[string]interface{}) {
+		s, ok := v.(string)
+		if !ok {
+			return logical.ErrorResponse(fmt.Sprintf("metadata value for %q must be a string", k)),
+				logical.ErrInvalidRequest
+		}
+		meta[k] = s
+	}
+
+	// Display names are matched as stored, including the prefix given by
+	// the auth backend that created the token
+	terms := searchTerms(data.Get("display_name").(string), meta)
+	if len(terms) == 0 {
+		return logical.ErrorResponse("display_name or meta must be provided"), logical.ErrInvalidRequest
+	}
+
+	accessors, err := ts.search(terms)
+	if err != nil {
+		return nil, err
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"keys": accessors,
+		},
+	}, nil
+}
+
+// tidySearchIndex removes the search index entries of tokens that no
+// longer exist
+func (ts *TokenStore) tidySearchIndex() (int, error) {
+	terms, err := ts.view.List(searchPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list search index: %v", err)
+	}
+
+	removed := 0
+	for i, term := range terms {
+		metrics.SetGauge([]string{"token", "tidy", "search_terms_scanned"}, float32(i+1))
+
+		saltedIds, err := ts.view.List(searchPrefix + term)
+		if err != nil {
+			return removed, fmt.Errorf("failed to scan search index: %v", err)
+		}
+		for _, saltedId := range saltedIds {
+			exists, err := ts.tokenExistsSalted(saltedId)
+			if err != nil {
+				return removed, err
+			}
+			if exists {
+				continue
+			}
+
+			if err := ts.view.Delete(searchPrefix + term + saltedId); err != nil {
+				return removed, fmt.Errorf("failed to delete search index entry: %v", err)
+			}
+			metrics.IncrCounter([]string{"token", "tidy", "dangling_search_entries"}, 1)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,99 @@
+package vault
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTokenStore_Search(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	create := func(displayName string, meta map[string]string) string {
+		req := logical.TestRequest(t, logical.UpdateOperation, "create")
+		req.ClientToken = root
+		req.Data["display_name"] = displayName
+		req.Data["meta"] = meta
+		resp, err := ts.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v %v", err, resp)
+		}
+		return resp.Auth.Accessor
+	}
+	search := func(data map[string]interface{}) []string {
+		req := logical.TestRequest(t, logical.UpdateOperation, "accessors/search")
+		req.ClientToken = root
+		req.Data = data
+		resp, err := ts.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v %v", err, resp)
+		}
+		return resp.Data["keys"].([]string)
+	}
+	sorted := func(accessors ...string) []string {
+		sort.Strings(accessors)
+		return accessors
+	}
+
+	web1 := create("web", map[string]string{"app": "web", "env": "prod"})
+	web2 := create("web", map[string]string{"app": "web", "env": "dev"})
+	db := create("db", map[string]string{"app": "db", "env": "prod"})
+
+	out := search(map[string]interface{}{"meta": map[string]interface{}{"app": "web"}})
+	if !reflect.DeepEqual(out, sorted(web1, web2)) {
+		t.Fatalf("bad: %v", out)
+	}
+	out = search(map[string]interface{}{"meta": map[string]interface{}{"env": "prod"}})
+	if !reflect.DeepEqual(out, sorted(web1, db)) {
+		t.Fatalf("bad: %v", out)
+	}
+	out = search(map[string]interface{}{
+		"display_name": "token-web",
+		"meta":         map[string]interface{}{"env": "prod"},
+	})
+	if !reflect.DeepEqual(out, []string{web1}) {
+		t.Fatalf("bad: %v", out)
+	}
+	out = search(map[string]interface{}{"meta": map[string]interface{}{"app": "cache"}})
+	if len(out) != 0 {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Revoked tokens are no longer found
+	aEntry, err := ts.lookupByAccessor(web1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ts.Revoke(aEntry.TokenID); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out = search(map[string]interface{}{"display_name": "token-web"})
+	if !reflect.DeepEqual(out, []string{web2}) {
+		t.Fatalf("bad: %v", out)
+	}
+
+	// Index entries whose token is gone are tidied
+	aEntry, err = ts.lookupByAccessor(db)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ts.view.Delete(lookupPrefix + ts.SaltID(aEntry.TokenID)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	removed, err := ts.tidySearchIndex()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if removed != 3 {
+		t.Fatalf("bad: %d", removed)
+	}
+
+	// Something must be searched for
+	req := logical.TestRequest(t, logical.UpdateOperation, "accessors/search")
+	req.ClientToken = root
+	if resp, err := ts.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("expected error: %v %v", err, resp)
+	}
+}
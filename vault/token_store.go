@@ -10,6 +10,7 @@ import (
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/golang-lru"
 	"github.com/hashicorp/vault/helper/duration"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
@@ -40,9 +41,22 @@ const (
 
 	// rolesPrefix is the prefix used to store role information
 	rolesPrefix = "roles/"
+
+	// tokenCacheSize is the number of token entries that are kept cached
+	tokenCacheSize = 4096
+
+	// serviceTokenPrefix is the prefix of generated service token IDs, so
+	// that the type of a token can be told from its ID. Tokens created
+	// before typed prefixes were introduced have plain UUIDs as IDs, and
+	// remain valid.
+	serviceTokenPrefix = "s."
 )
 
 var (
+	// typedTokenPrefixes are the prefixes that identify the type of a token,
+	// which custom token IDs cannot begin with
+	typedTokenPrefixes = []string{serviceTokenPrefix, batchTokenPrefix}
+
 	// displayNameSanitize is used to sanitize a display name given to a token.
 	displayNameSanitize = regexp.MustCompile("[^a-zA-Z0-9-]")
 
@@ -66,6 +80,19 @@ type TokenStore struct {
 	policyLookupFunc func(string) (*Policy, error)
 
 	tokenLocks map[string]*sync.RWMutex
+
+	// lru caches encoded token entries by salted ID, so that every request
+	// does not read its token from storage. Entries are only added while
+	// holding the token's lock, and removed along with every write of the
+	// stored entry. Renewals are tracked by the expiration manager and do
+	// not change the entry.
+	lru *lru.TwoQueueCache
+
+	// batchKey is used to authenticate batch tokens
+	batchKey []byte
+
+	// tidyLock is set while a tidy operation is running
+	tidyLock uint32
 }
 
 // NewTokenStore is used to construct a token store that is
@@ -92,6 +119,16 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 	}
 	t.salt = salt
 
+	// Setup the batch token key
+	if err := t.setupBatchKey(); err != nil {
+		return nil, err
+	}
+
+	if !config.System.CachingDisabled() {
+		cache, _ := lru.New2Q(tokenCacheSize)
+		t.lru = cache
+	}
+
 	t.tokenLocks = map[string]*sync.RWMutex{}
 
 	// Create 256 locks
@@ -99,8 +136,6 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 		return nil, fmt.Errorf("failed to create locks: %v", err)
 	}
 
-	t.tokenLocks["custom"] = &sync.RWMutex{}
-
 	// Setup the framework endpoints
 	t.Backend = &framework.Backend{
 		AuthRenew: t.authRenew,
@@ -109,6 +144,7 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 			Root: []string{
 				"revoke-orphan/*",
 				"accessors*",
+				"tidy",
 			},
 		},
 
@@ -135,6 +171,39 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 				HelpDescription: tokenListAccessorsHelp,
 			},
 
+			&framework.Path{
+				Pattern: "accessors/search$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"display_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "Display name of the tokens to find",
+					},
+					"meta": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: "Metadata key/value pairs the tokens to find must have",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: t.handleSearch,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(tokenSearchHelp),
+				HelpDescription: strings.TrimSpace(tokenSearchDesc),
+			},
+
+			&framework.Path{
+				Pattern: "tidy$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: t.handleTidy,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(tokenTidyHelp),
+				HelpDescription: strings.TrimSpace(tokenTidyDesc),
+			},
+
 			&framework.Path{
 				Pattern: "roles/" + framework.GenericNameRegex("role_name"),
 				Fields: map[string]*framework.FieldSchema{
@@ -473,6 +542,50 @@ type TokenEntry struct {
 
 	// If set, the role that was used for parameters at creation time
 	Role string `json:"role" mapstructure:"role" structs:"role"`
+
+	// If set, the token is periodic: every renewal resets its TTL to the
+	// period, regardless of the max TTL
+	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
+
+	// If set, the token can only be used by requests made from within
+	// these CIDR blocks
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// The identity of the login the token descends from, which templated
+	// policies are resolved against. Unlike the display name and metadata,
+	// it is only set at login, and copied unchanged to child tokens.
+	EntityName string            `json:"entity_name,omitempty" mapstructure:"entity_name" structs:"entity_name"`
+	EntityMeta map[string]string `json:"entity_meta,omitempty" mapstructure:"entity_meta" structs:"entity_meta"`
+
+	// Whether the login the token descends from passed MFA. Like the
+	// identity, it is only set at login and copied to child tokens.
+	MFA bool `json:"mfa,omitempty" mapstructure:"mfa" structs:"mfa"`
+
+	// The accessor of the token at the root of the token's tree, unless the
+	// token is such a root, such as the token of a login. It is shared by
+	// all the tokens created from that token, orphans included.
+	TreeAccessor string `json:"tree_accessor,omitempty" mapstructure:"tree_accessor" structs:"tree_accessor"`
+
+	// The salted ID of the parent of a batch token, which is never
+	// persisted
+	batchParent string
+}
+
+// principal returns who holds the token, so that approvals that must come
+// from distinct people cannot be given through several tokens: the identity
+// of the login the token descends from or, for tokens that do not descend
+// from a login, the token at the root of its tree.
+func (te *TokenEntry) principal() string {
+	switch {
+	case te.EntityName != "":
+		return "entity:" + te.EntityName
+	case te.TreeAccessor != "":
+		return "tree:" + te.TreeAccessor
+	case te.Accessor != "":
+		return "tree:" + te.Accessor
+	default:
+		return "token:" + te.ID
+	}
 }
 
 // tsRoleEntry contains token store role information
@@ -525,7 +638,14 @@ func (ts *TokenStore) SaltID(id string) string {
 
 // RootToken is used to generate a new token with root privileges and no parent
 func (ts *TokenStore) rootToken() (*TokenEntry, error) {
+	return ts.rootTokenWithID("")
+}
+
+// rootTokenWithID is used to generate a new root token with the given ID, or
+// a generated one if empty
+func (ts *TokenStore) rootTokenWithID(id string) (*TokenEntry, error) {
 	te := &TokenEntry{
+		ID:           id,
 		Policies:     []string{"root"},
 		Path:         "auth/token/root",
 		DisplayName:  "root",
@@ -607,7 +727,7 @@ func (ts *TokenStore) create(entry *TokenEntry) error {
 		if err != nil {
 			return err
 		}
-		entry.ID = entryUUID
+		entry.ID = serviceTokenPrefix + entryUUID
 	}
 
 	entry.Policies = policyutil.SanitizePolicies(entry.Policies, false)
@@ -660,6 +780,11 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 				return fmt.Errorf("failed to persist entry: %v", err)
 			}
 		}
+
+		// Index the token by display name and metadata
+		if err := ts.createSearchIndex(entry, saltedId); err != nil {
+			return err
+		}
 	}
 
 	// Write the primary ID
@@ -668,30 +793,29 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 	if err := ts.view.Put(le); err != nil {
 		return fmt.Errorf("failed to persist entry: %v", err)
 	}
-	return nil
-}
 
-func (ts *TokenStore) getTokenLock(id string) *sync.RWMutex {
-	// Find our multilevel lock, or fall back to global
-	var lock *sync.RWMutex
-	var ok bool
-	if len(id) >= 2 {
-		lock, ok = ts.tokenLocks[id[0:2]]
-	}
-	if !ok || lock == nil {
-		// Fall back for custom token IDs
-		lock = ts.tokenLocks["custom"]
+	if ts.lru != nil {
+		// Clear the cache. Callers updating an existing entry hold the
+		// token's lock, so it cannot be cached again with the old entry.
+		ts.lru.Remove(saltedId)
 	}
+	return nil
+}
 
-	return lock
+// getTokenLock returns the lock guarding updates to the token with the given
+// salted ID. Locks are sharded by salted ID rather than token ID, so that
+// custom token IDs are spread evenly and code that only knows the salted ID
+// takes the same lock.
+func (ts *TokenStore) getTokenLock(saltedId string) *sync.RWMutex {
+	return ts.tokenLocks[saltedId[0:2]]
 }
 
 // UseToken is used to manage restricted use tokens and decrement their
 // available uses. Returns two values: a potentially updated entry or, if the
-// token has been revoked, nil; and whether an error was encountered. The
-// locking here isn't perfect, as other parts of the code may update an entry,
-// but usually none after the entry is already created...so this is pretty
-// good.
+// token has been revoked or its uses were exhausted by concurrent requests,
+// nil; and whether an error was encountered. The decrement is a
+// read-modify-write of the stored entry under the token's lock, which every
+// update of a stored entry takes, so each use is granted exactly once.
 func (ts *TokenStore) UseToken(te *TokenEntry) (*TokenEntry, error) {
 	if te == nil {
 		return nil, fmt.Errorf("invalid token entry provided for use count decrementing")
@@ -704,21 +828,24 @@ func (ts *TokenStore) UseToken(te *TokenEntry) (*TokenEntry, error) {
 		return te, nil
 	}
 
-	lock := ts.getTokenLock(te.ID)
+	saltedId := ts.SaltID(te.ID)
+	lock := ts.getTokenLock(saltedId)
 
 	lock.Lock()
 	defer lock.Unlock()
 
-	// Call lookupSalted instead of Lookup to avoid deadlocking since Lookup grabs a read lock
-	te, err := ts.lookupSalted(ts.SaltID(te.ID))
+	// Call lookupSalted instead of Lookup to avoid deadlocking since Lookup
+	// grabs a read lock. The entry must be read again under the lock, as the
+	// one given may be stale.
+	te, err := ts.lookupSalted(saltedId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to refresh entry: %v", err)
 	}
-	// If it can't be found we shouldn't be trying to use it, so if we get nil
-	// back, it is because it has been revoked in the interim or will be
-	// revoked (NumUses is -1)
+	// If it can't be found it has been revoked in the interim, or will be
+	// revoked as a concurrent request used it for the last time (NumUses is
+	// -1), so the use is refused
 	if te == nil {
-		return nil, fmt.Errorf("token not found or fully used already")
+		return nil, nil
 	}
 
 	// Decrement the count. If this is our last use count, we need to indicate
@@ -741,13 +868,17 @@ func (ts *TokenStore) UseToken(te *TokenEntry) (*TokenEntry, error) {
 	}
 
 	// Write under the primary ID
-	saltedId := ts.SaltID(te.ID)
 	path := lookupPrefix + saltedId
 	le := &logical.StorageEntry{Key: path, Value: enc}
 	if err := ts.view.Put(le); err != nil {
 		return nil, fmt.Errorf("failed to persist entry: %v", err)
 	}
 
+	if ts.lru != nil {
+		// Update the LRU cache
+		ts.lru.Add(saltedId, enc)
+	}
+
 	return te, nil
 }
 
@@ -758,30 +889,61 @@ func (ts *TokenStore) Lookup(id string) (*TokenEntry, error) {
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
-	lock := ts.getTokenLock(id)
+	// Batch tokens carry their own entry
+	if isBatchToken(id) {
+		return ts.lookupBatch(id)
+	}
+
+	saltedId := ts.SaltID(id)
+	lock := ts.getTokenLock(saltedId)
 	lock.RLock()
 	defer lock.RUnlock()
 
-	return ts.lookupSalted(ts.SaltID(id))
+	return ts.lookupSaltedCommon(saltedId, true)
 }
 
 // lookupSlated is used to find a token given its salted ID
 func (ts *TokenStore) lookupSalted(saltedId string) (*TokenEntry, error) {
-	// Lookup token
-	path := lookupPrefix + saltedId
-	raw, err := ts.view.Get(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read entry: %v", err)
+	return ts.lookupSaltedCommon(saltedId, false)
+}
+
+// lookupSaltedCommon handles the actual lookup of a token given its salted
+// ID, possibly caching the entry. Entries may only be cached while holding
+// the token's lock, or a concurrent revocation could leave a revoked token
+// in the cache. The cache holds encoded entries, so every caller gets an
+// entry of its own to modify.
+func (ts *TokenStore) lookupSaltedCommon(saltedId string, cache bool) (*TokenEntry, error) {
+	var enc []byte
+	if ts.lru != nil {
+		// Check for cached entry
+		if raw, ok := ts.lru.Get(saltedId); ok {
+			enc = raw.([]byte)
+		}
 	}
 
-	// Bail if not found
-	if raw == nil {
-		return nil, nil
+	if enc == nil {
+		// Lookup token
+		path := lookupPrefix + saltedId
+		raw, err := ts.view.Get(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entry: %v", err)
+		}
+
+		// Bail if not found
+		if raw == nil {
+			return nil, nil
+		}
+		enc = raw.Value
+
+		if cache && ts.lru != nil {
+			// Update the LRU cache
+			ts.lru.Add(saltedId, enc)
+		}
 	}
 
 	// Unmarshal the token
 	entry := new(TokenEntry)
-	if err := jsonutil.DecodeJSON(raw.Value, entry); err != nil {
+	if err := jsonutil.DecodeJSON(enc, entry); err != nil {
 		return nil, fmt.Errorf("failed to decode entry: %v", err)
 	}
 
@@ -800,6 +962,9 @@ func (ts *TokenStore) Revoke(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if isBatchToken(id) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	return ts.revokeSalted(ts.SaltID(id))
 }
@@ -813,11 +978,20 @@ func (ts *TokenStore) revokeSalted(saltedId string) error {
 		return err
 	}
 
-	// Nuke the primary key first
+	// Nuke the primary key first. The token's lock is held so that a
+	// concurrent lookup cannot cache the entry again.
+	lock := ts.getTokenLock(saltedId)
+	lock.Lock()
 	path := lookupPrefix + saltedId
-	if ts.view.Delete(path); err != nil {
+	if err := ts.view.Delete(path); err != nil {
+		lock.Unlock()
 		return fmt.Errorf("failed to delete entry: %v", err)
 	}
+	if ts.lru != nil {
+		// Clear the cache
+		ts.lru.Remove(saltedId)
+	}
+	lock.Unlock()
 
 	// Clear the secondary index if any
 	if entry != nil && entry.Parent != "" {
@@ -835,6 +1009,13 @@ func (ts *TokenStore) revokeSalted(saltedId string) error {
 		}
 	}
 
+	// Clear the search index if any
+	if entry != nil {
+		if err := ts.deleteSearchIndex(entry, saltedId); err != nil {
+			return err
+		}
+	}
+
 	// Revoke all secrets under this token
 	if entry != nil {
 		if err := ts.expiration.RevokeByToken(entry); err != nil {
@@ -859,6 +1040,9 @@ func (ts *TokenStore) RevokeTree(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if isBatchToken(id) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	// Get the salted ID
 	saltedId := ts.SaltID(id)
@@ -896,6 +1080,45 @@ func (ts *TokenStore) revokeTreeSalted(saltedId string) error {
 	return nil
 }
 
+// revokeByPolicy is used to revoke every token that references the given
+// policy, along with their child tokens. Tokens are found using the accessor
+// index. It returns how many tokens referenced the policy.
+func (ts *TokenStore) revokeByPolicy(policy string) (int, error) {
+	defer metrics.MeasureSince([]string{"token", "revoke-by-policy"}, time.Now())
+	saltedAccessors, err := ts.view.List(accessorPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan for accessors: %v", err)
+	}
+
+	// Find the tokens first, as revoking a token removes the accessors of
+	// its children
+	var ids []string
+	for _, saltedAccessor := range saltedAccessors {
+		aEntry, err := ts.lookupBySaltedAccessor(saltedAccessor)
+		if err != nil {
+			return 0, err
+		}
+		if aEntry.TokenID == "" {
+			continue
+		}
+
+		te, err := ts.Lookup(aEntry.TokenID)
+		if err != nil {
+			return 0, err
+		}
+		if te != nil && strutil.StrListContains(te.Policies, policy) {
+			ids = append(ids, te.ID)
+		}
+	}
+
+	for _, id := range ids {
+		if err := ts.RevokeTree(id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), nil
+}
+
 // handleCreateAgainstRole handles the auth/token/create path for a role
 func (ts *TokenStore) handleCreateAgainstRole(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
@@ -1048,6 +1271,13 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	// Batch tokens are not persisted, so their children could not be
+	// revoked along with them
+	if isBatchToken(parent.ID) {
+		return logical.ErrorResponse("batch tokens cannot create child tokens"),
+			logical.ErrInvalidRequest
+	}
+
 	// Check if the client token has sudo/root privileges for the requested path
 	isSudo := ts.System().SudoPrivilege(req.MountPoint+req.Path, req.ClientToken)
 
@@ -1064,6 +1294,9 @@ func (ts *TokenStore) handleCreateCommon(
 		ExplicitMaxTTL  string `mapstructure:"explicit_max_ttl"`
 		DisplayName     string `mapstructure:"display_name"`
 		NumUses         int    `mapstructure:"num_uses"`
+		Period          string
+		Type            string
+		BoundCIDRs      interface{} `mapstructure:"bound_cidrs"`
 	}
 	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -1076,6 +1309,32 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	batch := false
+	switch data.Type {
+	case "", TokenTypeService:
+	case TokenTypeBatch:
+		batch = true
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", data.Type)),
+			logical.ErrInvalidRequest
+	}
+
+	// Batch tokens are never persisted, so none of the state that would
+	// have to be stored can be set on them
+	if batch {
+		switch {
+		case data.NumUses > 0:
+			return logical.ErrorResponse("batch tokens cannot have a limited number of uses"),
+				logical.ErrInvalidRequest
+		case data.ID != "":
+			return logical.ErrorResponse("batch tokens cannot be given an ID"),
+				logical.ErrInvalidRequest
+		case data.Period != "", role != nil && role.Period > 0:
+			return logical.ErrorResponse("batch tokens cannot be periodic"),
+				logical.ErrInvalidRequest
+		}
+	}
+
 	// Setup the token entry
 	te := TokenEntry{
 		Parent: req.ClientToken,
@@ -1089,6 +1348,17 @@ func (ts *TokenStore) handleCreateCommon(
 		DisplayName:  "token",
 		NumUses:      data.NumUses,
 		CreationTime: time.Now().Unix(),
+
+		// Child tokens act for the same login as their parent, whatever
+		// their display name and metadata
+		EntityName: parent.EntityName,
+		EntityMeta: parent.EntityMeta,
+		MFA:        parent.MFA,
+
+		TreeAccessor: parent.TreeAccessor,
+	}
+	if te.TreeAccessor == "" {
+		te.TreeAccessor = parent.Accessor
 	}
 
 	renewable := true
@@ -1129,6 +1399,12 @@ func (ts *TokenStore) handleCreateCommon(
 			return logical.ErrorResponse("root or sudo privileges required to specify token id"),
 				logical.ErrInvalidRequest
 		}
+		for _, prefix := range typedTokenPrefixes {
+			if strings.HasPrefix(data.ID, prefix) {
+				return logical.ErrorResponse(fmt.Sprintf("token ids cannot begin with %q", prefix)),
+					logical.ErrInvalidRequest
+			}
+		}
 		te.ID = data.ID
 	}
 
@@ -1219,6 +1495,39 @@ func (ts *TokenStore) handleCreateCommon(
 		te.ExplicitMaxTTL = dur
 	}
 
+	// Tokens bound to CIDR blocks can only create tokens bound within them,
+	// otherwise they could escape the binding
+	boundCIDRs, err := parseBoundCIDRs(data.BoundCIDRs)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	switch {
+	case len(parent.BoundCIDRs) == 0:
+	case len(boundCIDRs) == 0:
+		boundCIDRs = parent.BoundCIDRs
+	case !cidrsSubset(parent.BoundCIDRs, boundCIDRs):
+		return logical.ErrorResponse("bound CIDR blocks must be within those of the parent"),
+			logical.ErrInvalidRequest
+	}
+	te.BoundCIDRs = boundCIDRs
+
+	// Only allow a periodic token if the client has sudo policy, as it can
+	// be renewed indefinitely
+	if data.Period != "" {
+		if !isSudo {
+			return logical.ErrorResponse("root or sudo privileges required to create periodic token"),
+				logical.ErrInvalidRequest
+		}
+		dur, err := duration.ParseDurationSecond(data.Period)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		if dur < 0 {
+			return logical.ErrorResponse("period must be positive"), logical.ErrInvalidRequest
+		}
+		te.Period = dur
+	}
+
 	// Parse the TTL/lease if any
 	if data.TTL != "" {
 		dur, err := duration.ParseDurationSecond(data.TTL)
@@ -1284,12 +1593,17 @@ func (ts *TokenStore) handleCreateCommon(
 		}
 	}
 
+	// The period of a role takes precedence over the one requested
 	if role != nil && role.Period > 0 {
+		te.Period = role.Period
+	}
+
+	if te.Period > 0 {
 		// Periodic tokens are allowed to escape max TTL confines so don't check limits
 		if te.ExplicitMaxTTL > 0 {
-			return logical.ErrorResponse("using an explicit max TTL not supported when using periodic token roles"), nil
+			return logical.ErrorResponse("using an explicit max TTL not supported with periodic tokens"), nil
 		}
-		te.TTL = role.Period
+		te.TTL = te.Period
 	} else {
 		// Set the default lease if not provided, root tokens are exempt
 		if te.TTL == 0 && !strutil.StrListContains(te.Policies, "root") {
@@ -1302,6 +1616,14 @@ func (ts *TokenStore) handleCreateCommon(
 		}
 	}
 
+	// Batch tokens are never renewable, and expire by themselves
+	if batch {
+		if te.TTL == 0 {
+			return logical.ErrorResponse("batch tokens must have a TTL"), logical.ErrInvalidRequest
+		}
+		renewable = false
+	}
+
 	// Don't advertise non-expiring root tokens as renewable, as attempts to renew them are denied
 	if te.TTL == 0 {
 		if parent.TTL != 0 {
@@ -1318,7 +1640,11 @@ func (ts *TokenStore) handleCreateCommon(
 	}
 
 	// Create the token
-	if err := ts.create(&te); err != nil {
+	create := ts.create
+	if batch {
+		create = ts.createBatch
+	}
+	if err := create(&te); err != nil {
 		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
 
@@ -1468,13 +1794,30 @@ func (ts *TokenStore) handleLookup(
 			"ttl":              int64(0),
 			"role":             out.Role,
 			"explicit_max_ttl": int64(out.ExplicitMaxTTL.Seconds()),
+			"type":             TokenTypeService,
 		},
 	}
 
+	if len(out.BoundCIDRs) > 0 {
+		resp.Data["bound_cidrs"] = out.BoundCIDRs
+	}
+
+	// Batch tokens have no lease to fetch times from
+	if isBatchToken(out.ID) {
+		resp.Data["type"] = TokenTypeBatch
+		resp.Data["orphan"] = out.batchParent == ""
+		resp.Data["ttl"] = int64(out.batchRemaining().Seconds())
+		resp.Data["renewable"] = false
+		return resp, nil
+	}
+
 	if out.Parent == "" {
 		resp.Data["orphan"] = true
 	}
 
+	if out.Period != 0 {
+		resp.Data["period"] = int64(out.Period.Seconds())
+	}
 	// Fetch the last renewal time
 	leaseTimes, err := ts.expiration.FetchLeaseTimesByToken(out.Path, out.ID)
 	if err != nil {
@@ -1529,6 +1872,9 @@ func (ts *TokenStore) handleRenew(
 	if te == nil {
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
+	if isBatchToken(te.ID) {
+		return logical.ErrorResponse("batch tokens cannot be renewed"), logical.ErrInvalidRequest
+	}
 
 	// Renew the token and its children
 	return ts.expiration.RenewToken(req, te.Path, te.ID, increment)
@@ -1558,8 +1904,12 @@ func (ts *TokenStore) authRenew(
 
 	f := framework.LeaseExtend(req.Auth.Increment, te.ExplicitMaxTTL, ts.System())
 
-	// No role? Use normal LeaseExtend semantics
+	// No role? Use the token's own period, or normal LeaseExtend semantics
 	if te.Role == "" {
+		if te.Period != 0 && te.ExplicitMaxTTL == 0 {
+			req.Auth.TTL = te.Period
+			return &logical.Response{Auth: req.Auth}, nil
+		}
 		return f(req, d)
 	}
 
@@ -1732,7 +2082,7 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 			}
 			resp.AddWarning(fmt.Sprintf(
 				"Given explicit max TTL of %d is greater than system/mount allowed value of %d seconds; until this is fixed attempting to create tokens against this role will result in an error",
-				entry.ExplicitMaxTTL.Seconds(), sysView.MaxLeaseTTL().Seconds()))
+				int64(entry.ExplicitMaxTTL.Seconds()), int64(sysView.MaxLeaseTTL().Seconds())))
 		}
 	}
 
@@ -1846,4 +2196,25 @@ or revoke them. Because this can be used to
 cause a denial of service, this endpoint
 requires 'sudo' capability in addition to
 'list'.`
+	tokenSearchHelp = `
+This endpoint finds the accessors of tokens by display name or metadata.`
+	tokenSearchDesc = `
+This endpoint returns the accessors of the tokens whose display name and
+metadata match every given value. Tokens are found using an index, rather than
+by looking up every token. As this can be used to discover tokens, it requires
+'sudo' capability in addition to 'update'.
+`
+	tokenTidyHelp = `
+This endpoint performs cleanup tasks that can be run if certain error
+conditions have occurred.`
+	tokenTidyDesc = `
+This endpoint performs cleanup tasks that can be run to clean up token and
+lease entries after certain error conditions. Usually running this is not
+necessary, and is only required if upgrade notes or support personnel
+suggest it.
+
+It removes accessor entries whose token is gone, makes orphans of tokens
+whose parent is gone, and revokes leases whose token is gone. The cleanup
+runs in the background and reports its results to the server logs. This
+requires 'sudo' capability.`
 )
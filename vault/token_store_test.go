@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -52,6 +54,15 @@ func testCoreMakeToken(t *testing.T, c *Core, root, client, ttl string, policy [
 	}
 }
 
+// testTokenAccessor returns the accessor of the given token
+func testTokenAccessor(t *testing.T, ts *TokenStore, id string) string {
+	te, err := ts.Lookup(id)
+	if err != nil || te == nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+	return te.Accessor
+}
+
 func TestTokenStore_AccessorIndex(t *testing.T) {
 	_, ts, _, _ := TestCoreWithTokenStore(t)
 
@@ -311,6 +322,112 @@ func TestTokenStore_CreateLookup_ProvidedID(t *testing.T) {
 	}
 }
 
+func TestTokenStore_TypedPrefix(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	ent := &TokenEntry{Path: "test", Policies: []string{"dev"}}
+	if err := ts.create(ent); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !strings.HasPrefix(ent.ID, serviceTokenPrefix) {
+		t.Fatalf("bad: %s", ent.ID)
+	}
+
+	// Tokens with plain UUIDs as IDs remain valid
+	legacyID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	legacy := &TokenEntry{ID: legacyID, Path: "test", Policies: []string{"dev"}}
+	if err := ts.create(legacy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	out, err := ts.Lookup(legacyID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || out.ID != legacyID {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Custom IDs cannot be mistaken for typed ones
+	req := logical.TestRequest(t, logical.UpdateOperation, "create")
+	req.ClientToken = root
+	req.Data["id"] = serviceTokenPrefix + "foo"
+	if resp, err := ts.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("expected error: %v %v", err, resp)
+	}
+}
+
+func TestTokenStore_Cache(t *testing.T) {
+	c, ts, _, _ := TestCoreWithTokenStore(t)
+
+	ent := &TokenEntry{Path: "test", Policies: []string{"dev"}, NumUses: 3}
+	if err := ts.create(ent); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	saltedId := ts.SaltID(ent.ID)
+
+	out, err := ts.Lookup(ent.ID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !ts.lru.Contains(saltedId) {
+		t.Fatalf("expected entry to be cached")
+	}
+
+	// Entries handed out do not alias the cached one
+	out.Policies[0] = "root"
+	if out, err = ts.Lookup(ent.ID); err != nil || out.Policies[0] != "dev" {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+
+	// Uses are reflected in the cache
+	if _, err := ts.UseToken(out); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, err = ts.Lookup(ent.ID); err != nil || out.NumUses != 2 {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+
+	// Cached entries are served without reading storage
+	raw, err := ts.view.Get(lookupPrefix + saltedId)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ts.view.Delete(lookupPrefix + saltedId); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out, err = ts.Lookup(ent.ID); err != nil || out == nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+	if err := ts.view.Put(raw); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Revoking the token clears the cache
+	if err := ts.Revoke(ent.ID); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ts.lru.Contains(saltedId) {
+		t.Fatalf("expected entry to be evicted")
+	}
+	if out, err = ts.Lookup(ent.ID); err != nil || out != nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+
+	// Nothing is cached when caching is disabled
+	config := getBackendConfig(c)
+	config.System = logical.StaticSystemView{CachingDisabledVal: true}
+	ts2, err := NewTokenStore(c, config)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ts2.lru != nil {
+		t.Fatalf("expected no cache")
+	}
+}
+
 func TestTokenStore_UseToken(t *testing.T) {
 	_, ts, _, root := TestCoreWithTokenStore(t)
 
@@ -390,6 +507,47 @@ func TestTokenStore_UseToken(t *testing.T) {
 	}
 }
 
+func TestTokenStore_UseToken_Concurrent(t *testing.T) {
+	_, ts, _, _ := TestCoreWithTokenStore(t)
+
+	ent := &TokenEntry{Path: "test", Policies: []string{"dev"}, NumUses: 10}
+	if err := ts.create(ent); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Each use must be granted exactly once
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	granted := 0
+	var errs []error
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			te, err := ts.UseToken(ent)
+			l.Lock()
+			defer l.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			if te != nil {
+				granted++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(errs) != 0 {
+		t.Fatalf("err: %v", errs)
+	}
+	if granted != 10 {
+		t.Fatalf("bad: %d uses granted", granted)
+	}
+	if out, err := ts.Lookup(ent.ID); err != nil || out != nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+}
+
 func TestTokenStore_Revoke(t *testing.T) {
 	_, ts, _, _ := TestCoreWithTokenStore(t)
 
@@ -537,6 +695,57 @@ func TestTokenStore_RevokeTree(t *testing.T) {
 	}
 }
 
+func TestTokenStore_RevokeByPolicy(t *testing.T) {
+	_, ts, _, _ := TestCoreWithTokenStore(t)
+
+	ent1 := &TokenEntry{Policies: []string{"foo", "bar"}}
+	if err := ts.create(ent1); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The child is revoked with its parent, even though it does not
+	// reference the policy
+	ent2 := &TokenEntry{Parent: ent1.ID, Policies: []string{"bar"}}
+	if err := ts.create(ent2); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ent3 := &TokenEntry{Policies: []string{"foo"}}
+	if err := ts.create(ent3); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ent4 := &TokenEntry{Policies: []string{"foobar"}}
+	if err := ts.create(ent4); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	revoked, err := ts.revokeByPolicy("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if revoked != 2 {
+		t.Fatalf("bad: %d", revoked)
+	}
+
+	for _, id := range []string{ent1.ID, ent2.ID, ent3.ID} {
+		out, err := ts.Lookup(id)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out != nil {
+			t.Fatalf("bad: %#v", out)
+		}
+	}
+	out, err := ts.Lookup(ent4.ID)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil {
+		t.Fatalf("token without the policy should not be revoked")
+	}
+}
+
 func TestTokenStore_RevokeSelf(t *testing.T) {
 	_, ts, _, _ := TestCoreWithTokenStore(t)
 
@@ -619,13 +828,14 @@ func TestTokenStore_HandleRequest_CreateToken_DisplayName(t *testing.T) {
 	}
 
 	expected := &TokenEntry{
-		ID:          resp.Auth.ClientToken,
-		Accessor:    resp.Auth.Accessor,
-		Parent:      root,
-		Policies:    []string{"root"},
-		Path:        "auth/token/create",
-		DisplayName: "token-foo-bar-baz",
-		TTL:         0,
+		ID:           resp.Auth.ClientToken,
+		Accessor:     resp.Auth.Accessor,
+		Parent:       root,
+		TreeAccessor: testTokenAccessor(t, ts, root),
+		Policies:     []string{"root"},
+		Path:         "auth/token/create",
+		DisplayName:  "token-foo-bar-baz",
+		TTL:          0,
 	}
 	out, err := ts.Lookup(resp.Auth.ClientToken)
 	if err != nil {
@@ -650,14 +860,15 @@ func TestTokenStore_HandleRequest_CreateToken_NumUses(t *testing.T) {
 	}
 
 	expected := &TokenEntry{
-		ID:          resp.Auth.ClientToken,
-		Accessor:    resp.Auth.Accessor,
-		Parent:      root,
-		Policies:    []string{"root"},
-		Path:        "auth/token/create",
-		DisplayName: "token",
-		NumUses:     1,
-		TTL:         0,
+		ID:           resp.Auth.ClientToken,
+		Accessor:     resp.Auth.Accessor,
+		Parent:       root,
+		TreeAccessor: testTokenAccessor(t, ts, root),
+		Policies:     []string{"root"},
+		Path:         "auth/token/create",
+		DisplayName:  "token",
+		NumUses:      1,
+		TTL:          0,
 	}
 	out, err := ts.Lookup(resp.Auth.ClientToken)
 	if err != nil {
@@ -714,13 +925,14 @@ func TestTokenStore_HandleRequest_CreateToken_NoPolicy(t *testing.T) {
 	}
 
 	expected := &TokenEntry{
-		ID:          resp.Auth.ClientToken,
-		Accessor:    resp.Auth.Accessor,
-		Parent:      root,
-		Policies:    []string{"root"},
-		Path:        "auth/token/create",
-		DisplayName: "token",
-		TTL:         0,
+		ID:           resp.Auth.ClientToken,
+		Accessor:     resp.Auth.Accessor,
+		Parent:       root,
+		TreeAccessor: testTokenAccessor(t, ts, root),
+		Policies:     []string{"root"},
+		Path:         "auth/token/create",
+		DisplayName:  "token",
+		TTL:          0,
 	}
 	out, err := ts.Lookup(resp.Auth.ClientToken)
 	if err != nil {
@@ -1163,6 +1375,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(0),
 		"role":             "",
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1199,6 +1412,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(3600),
 		"role":             "",
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 		"renewable":        true,
 	}
 
@@ -1242,6 +1456,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(3600),
 		"role":             "",
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 		"renewable":        true,
 	}
 
@@ -1308,6 +1523,7 @@ func TestTokenStore_HandleRequest_LookupSelf(t *testing.T) {
 		"ttl":              int64(0),
 		"role":             "",
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -2008,6 +2224,82 @@ func TestTokenStore_RolePeriod(t *testing.T) {
 	}
 }
 
+func TestTokenStore_Periodic(t *testing.T) {
+	core, _, _, root := TestCoreWithTokenStore(t)
+
+	core.defaultLeaseTTL = 10 * time.Second
+	core.maxLeaseTTL = 10 * time.Second
+
+	// Note: these requests are sent to Core since Core handles registration
+	// with the expiration manager and we need the storage to be consistent
+
+	// Periodic tokens cannot have an explicit max TTL
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"period":           300,
+		"explicit_max_ttl": 60,
+	}
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	// The TTL of a periodic token is its period, and renewing it resets the
+	// TTL to the period regardless of the increment and max TTL
+	req.Data = map[string]interface{}{
+		"policies": []string{"default"},
+		"period":   300,
+		"ttl":      5,
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if resp.Auth.TTL != 300*time.Second {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+	periodic := resp.Auth.ClientToken
+
+	req.ClientToken = periodic
+	req.Operation = logical.UpdateOperation
+	req.Path = "auth/token/renew-self"
+	req.Data = map[string]interface{}{
+		"increment": 1,
+	}
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req.Operation = logical.ReadOperation
+	req.Path = "auth/token/lookup-self"
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ttl := resp.Data["ttl"].(int64); ttl < 299 {
+		t.Fatalf("TTL too small: %d", ttl)
+	}
+	if resp.Data["period"].(int64) != 300 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Only sudo clients can create periodic tokens
+	req.Operation = logical.UpdateOperation
+	req.Path = "auth/token/create"
+	req.Data = map[string]interface{}{
+		"period": 300,
+	}
+	resp, err = core.HandleRequest(req)
+	if err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
+
 func TestTokenStore_RoleExplicitMaxTTL(t *testing.T) {
 	core, _, _, root := TestCoreWithTokenStore(t)
 
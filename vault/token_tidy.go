@@ -0,0 +1,245 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// handleTidy handles the auth/token/tidy path, which cleans up the storage
+// left behind by tokens that no longer exist. The cleanup runs in the
+// background, as it scans every token.
+func (ts *TokenStore) handleTidy(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if !atomic.CompareAndSwapUint32(&ts.tidyLock, 0, 1) {
+		resp := &logical.Response{}
+		resp.AddWarning("Tidy operation already in progress.")
+		return resp, nil
+	}
+
+	go func() {
+		defer atomic.StoreUint32(&ts.tidyLock, 0)
+		if err := ts.tidy(); err != nil {
+			ts.Logger().Printf("[ERR] token: tidy operation failed: %v", err)
+		}
+	}()
+
+	resp := &logical.Response{}
+	resp.AddWarning("Tidy operation successfully started. Any information from the operation will be printed to Vault's server logs.")
+	return resp, nil
+}
+
+// tidy cleans up accessor entries whose token is gone, parent index
+// entries whose parent is gone, leases whose token is gone, and search
+// index entries whose token is gone.
+func (ts *TokenStore) tidy() error {
+	defer metrics.MeasureSince([]string{"token", "tidy"}, time.Now())
+	logger := ts.Logger()
+	logger.Printf("[INFO] token: beginning tidy operation on tokens")
+
+	accessors, err := ts.tidyAccessors()
+	if err != nil {
+		return err
+	}
+	orphans, err := ts.tidyParents()
+	if err != nil {
+		return err
+	}
+	leases, err := ts.tidyLeases()
+	if err != nil {
+		return err
+	}
+	searchEntries, err := ts.tidySearchIndex()
+	if err != nil {
+		return err
+	}
+
+	logger.Printf("[INFO] token: tidy operation complete; removed %d dangling accessors, "+
+		"orphaned %d tokens whose parent is gone, revoked %d leases whose token is gone, "+
+		"removed %d dangling search index entries",
+		accessors, orphans, leases, searchEntries)
+	return nil
+}
+
+// tokenExistsSalted returns whether an entry is stored for the given salted
+// token ID, even if it is awaiting deferred revocation
+func (ts *TokenStore) tokenExistsSalted(saltedId string) (bool, error) {
+	raw, err := ts.view.Get(lookupPrefix + saltedId)
+	if err != nil {
+		return false, fmt.Errorf("failed to read entry: %v", err)
+	}
+	return raw != nil, nil
+}
+
+// tidyAccessors removes the accessor index entries of tokens that no
+// longer exist
+func (ts *TokenStore) tidyAccessors() (int, error) {
+	saltedAccessors, err := ts.view.List(accessorPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list accessors: %v", err)
+	}
+
+	removed := 0
+	for i, saltedAccessor := range saltedAccessors {
+		metrics.SetGauge([]string{"token", "tidy", "accessors_scanned"}, float32(i+1))
+
+		aEntry, err := ts.lookupBySaltedAccessor(saltedAccessor)
+		if err != nil {
+			ts.Logger().Printf("[WARN] token: tidy could not read accessor entry: %v", err)
+			continue
+		}
+
+		exists := false
+		if aEntry.TokenID != "" {
+			exists, err = ts.tokenExistsSalted(ts.SaltID(aEntry.TokenID))
+			if err != nil {
+				return removed, err
+			}
+		}
+		if exists {
+			continue
+		}
+
+		if err := ts.view.Delete(accessorPrefix + saltedAccessor); err != nil {
+			return removed, fmt.Errorf("failed to delete accessor entry: %v", err)
+		}
+		metrics.IncrCounter([]string{"token", "tidy", "dangling_accessors"}, 1)
+		removed++
+	}
+	return removed, nil
+}
+
+// tidyParents removes the parent index entries of parents that no longer
+// exist. Their children are left behind when a parent is revoked without
+// its tree, so they are made orphans rather than revoked.
+func (ts *TokenStore) tidyParents() (int, error) {
+	parents, err := ts.view.List(parentPrefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list parents: %v", err)
+	}
+
+	orphaned := 0
+	for i, parent := range parents {
+		metrics.SetGauge([]string{"token", "tidy", "parents_scanned"}, float32(i+1))
+
+		exists, err := ts.tokenExistsSalted(strings.TrimSuffix(parent, "/"))
+		if err != nil {
+			return orphaned, err
+		}
+		if exists {
+			continue
+		}
+
+		children, err := ts.view.List(parentPrefix + parent)
+		if err != nil {
+			return orphaned, fmt.Errorf("failed to scan for children: %v", err)
+		}
+		for _, child := range children {
+			ok, err := ts.orphanSalted(child)
+			if err != nil {
+				return orphaned, err
+			}
+			if ok {
+				metrics.IncrCounter([]string{"token", "tidy", "orphaned_tokens"}, 1)
+				orphaned++
+			}
+
+			if err := ts.view.Delete(parentPrefix + parent + child); err != nil {
+				return orphaned, fmt.Errorf("failed to delete parent index entry: %v", err)
+			}
+		}
+	}
+	return orphaned, nil
+}
+
+// orphanSalted clears the parent of the token with the given salted ID,
+// returning whether it exists
+func (ts *TokenStore) orphanSalted(saltedId string) (bool, error) {
+	// Hold the token's lock so that concurrent uses are not overwritten
+	lock := ts.getTokenLock(saltedId)
+	lock.Lock()
+	defer lock.Unlock()
+
+	entry, err := ts.lookupSalted(saltedId)
+	if err != nil || entry == nil {
+		return false, err
+	}
+
+	entry.Parent = ""
+	if err := ts.store(entry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// tidyLeases revokes the leases of tokens that no longer exist. Leases of
+// batch tokens are skipped as long as the token is valid, since batch
+// tokens are never stored.
+func (ts *TokenStore) tidyLeases() (int, error) {
+	m := ts.expiration
+	tokens, err := m.tokenView.List("")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list lease token index: %v", err)
+	}
+
+	revoked := 0
+	for i, token := range tokens {
+		metrics.SetGauge([]string{"token", "tidy", "lease_tokens_scanned"}, float32(i+1))
+
+		exists, err := ts.tokenExistsSalted(strings.TrimSuffix(token, "/"))
+		if err != nil {
+			return revoked, err
+		}
+		if exists {
+			continue
+		}
+
+		leases, err := m.tokenView.List(token)
+		if err != nil {
+			return revoked, fmt.Errorf("failed to list leases: %v", err)
+		}
+		for _, lease := range leases {
+			index, err := m.tokenView.Get(token + lease)
+			if err != nil {
+				return revoked, fmt.Errorf("failed to read lease index: %v", err)
+			}
+			if index == nil {
+				continue
+			}
+			leaseID := string(index.Value)
+
+			le, err := m.loadEntry(leaseID)
+			if err != nil {
+				return revoked, err
+			}
+			if le != nil && isBatchToken(le.ClientToken) {
+				te, err := ts.lookupBatch(le.ClientToken)
+				if err != nil {
+					return revoked, err
+				}
+				if te != nil {
+					continue
+				}
+			}
+
+			// Revoking the lease removes its index entry, which is left
+			// behind if the lease itself is already gone
+			if le != nil {
+				if err := m.Revoke(leaseID); err != nil {
+					return revoked, fmt.Errorf("failed to revoke '%s': %v", leaseID, err)
+				}
+				metrics.IncrCounter([]string{"token", "tidy", "revoked_leases"}, 1)
+				revoked++
+			}
+			if err := m.tokenView.Delete(token + lease); err != nil {
+				return revoked, fmt.Errorf("failed to delete lease index entry: %v", err)
+			}
+		}
+	}
+	return revoked, nil
+}
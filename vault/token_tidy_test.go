@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTokenStore_Tidy(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	// Mount a noop backend
+	noop := &NoopBackend{}
+	ts.expiration.router.Mount(noop, "", &MountEntry{UUID: ""}, nil)
+
+	// A token whose entry is lost leaves its accessor and leases behind
+	lost := &TokenEntry{Path: "test", Policies: []string{"dev"}}
+	if err := ts.create(lost); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "secret/foo",
+		ClientToken: lost.ID,
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	leaseID, err := ts.expiration.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := ts.view.Delete(lookupPrefix + ts.SaltID(lost.ID)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The leases of a valid batch token are kept, although it is not stored
+	batch := &TokenEntry{Path: "test", TTL: time.Hour, CreationTime: time.Now().Unix()}
+	if err := ts.createBatch(batch); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.ClientToken = batch.ID
+	batchLeaseID, err := ts.expiration.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Revoking a parent without its tree leaves its children behind
+	testMakeToken(t, ts, root, "parent", "", []string{"root"})
+	testMakeToken(t, ts, "parent", "child", "", []string{"root"})
+	if err := ts.Revoke("parent"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := ts.tidy(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if _, err := ts.lookupByAccessor(lost.Accessor); err == nil {
+		t.Fatalf("expected accessor to be removed")
+	}
+	if out, err := ts.expiration.loadEntry(leaseID); err != nil || out != nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+	if out, err := ts.expiration.loadEntry(batchLeaseID); err != nil || out == nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+
+	child, err := ts.Lookup("child")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if child == nil || child.Parent != "" {
+		t.Fatalf("bad: %#v", child)
+	}
+	children, err := ts.view.List(parentPrefix + ts.SaltID("parent") + "/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(children) != 0 {
+		t.Fatalf("bad: %v", children)
+	}
+
+	// Tokens that exist are left alone
+	if out, err := ts.Lookup(root); err != nil || out == nil {
+		t.Fatalf("bad: %#v %v", out, err)
+	}
+}
+
+func TestTokenStore_HandleRequest_Tidy(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	// Only one tidy operation runs at a time
+	ts.tidyLock = 1
+	req := logical.TestRequest(t, logical.UpdateOperation, "tidy")
+	req.ClientToken = root
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if len(resp.Warnings()) != 1 || resp.Warnings()[0] != "Tidy operation already in progress." {
+		t.Fatalf("bad: %#v", resp)
+	}
+}